@@ -0,0 +1,448 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bench
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/op/go-logging"
+
+	"github.com/hyperledger/fabric/consensus"
+	"github.com/hyperledger/fabric/consensus/honeybadger"
+	"github.com/hyperledger/fabric/consensus/pbft"
+	"github.com/hyperledger/fabric/consensus/raft"
+	"github.com/hyperledger/fabric/consensus/solo"
+	pb "github.com/hyperledger/fabric/protos"
+)
+
+var logger *logging.Logger // package-level logger
+
+func init() {
+	logger = logging.MustGetLogger("consensus/bench")
+}
+
+// plugin describes how to run a consensus plugin in a benchmark cluster, the
+// keys being those of the plugin's configuration which the sweep sets
+type plugin struct {
+	prefix     string // environment prefix of the plugin's configuration
+	new        func(consensus.Stack) consensus.Consenter
+	nKey       string
+	batchKey   string
+	timeoutKey string // empty if the plugin has no batch timeout
+	settings   func(n int) map[string]string
+}
+
+var plugins = map[string]*plugin{
+	"pbft": {
+		prefix:     "CORE_PBFT",
+		new:        pbft.New,
+		nKey:       "general.N",
+		batchKey:   "general.batchsize",
+		timeoutKey: "general.timeout.batch",
+		settings: func(n int) map[string]string {
+			return map[string]string{"general.f": fmt.Sprint((n - 1) / 3)}
+		},
+	},
+	"raft": {
+		prefix:     "CORE_RAFT",
+		new:        raft.New,
+		nKey:       "general.N",
+		batchKey:   "general.batchsize",
+		timeoutKey: "general.timeout.batch",
+	},
+	"honeybadger": {
+		prefix:   "CORE_HONEYBADGER",
+		new:      honeybadger.New,
+		nKey:     "general.N",
+		batchKey: "general.batchsize",
+	},
+	"solo": {
+		prefix:     "CORE_SOLO",
+		new:        solo.New,
+		batchKey:   "general.batch.maxmessagecount",
+		timeoutKey: "general.batch.timeout",
+		settings: func(n int) map[string]string {
+			return map[string]string{"general.orderer": "0"}
+		},
+	},
+}
+
+// Plugins returns the names of the plugins which can be benchmarked
+func Plugins() []string {
+	var names []string
+	for name := range plugins {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Config describes a benchmark: the plugin, the parameters to sweep and the
+// load to drive against every combination of them
+type Config struct {
+	Plugin        string
+	N             []int           // Cluster sizes
+	BatchSizes    []int           // Batch sizes
+	BatchTimeouts []time.Duration // Batch timeouts, ignored by plugins without one
+
+	Transactions int           // Transactions measured per run
+	Warmup       int           // Transactions committed before measuring
+	Rate         float64       // Transactions submitted per second, 0 to submit as fast as Window allows
+	Window       int           // Transactions outstanding at most when Rate is 0
+	PayloadSize  int           // Bytes of payload of each transaction
+	Timeout      time.Duration // Time a run may take before it is given up
+}
+
+// Params are the parameters of a single run
+type Params struct {
+	Plugin       string
+	N            int
+	BatchSize    int
+	BatchTimeout time.Duration // 0 for plugins without a batch timeout
+}
+
+// Result is the measurement of a single run, latency being the time from the
+// submission of a transaction until the first replica commits it
+type Result struct {
+	Params
+	Committed  int
+	Elapsed    time.Duration
+	Throughput float64 // Transactions committed per second
+	P50        time.Duration
+	P90        time.Duration
+	P99        time.Duration
+	Max        time.Duration
+}
+
+// Run sweeps every combination of the parameters of config, running a fresh
+// cluster for each, and returns the results in sweep order.  The plugins read
+// their settings from the environment, so benchmarks must not run
+// concurrently with each other nor with other users of the plugins.
+func Run(config Config) ([]*Result, error) {
+	p, ok := plugins[config.Plugin]
+	if !ok {
+		return nil, fmt.Errorf("Unknown plugin %s, expected one of %s", config.Plugin, strings.Join(Plugins(), ", "))
+	}
+	if len(config.N) == 0 || len(config.BatchSizes) == 0 {
+		return nil, fmt.Errorf("Expected at least one cluster size and one batch size")
+	}
+	timeouts := config.BatchTimeouts
+	if p.timeoutKey == "" || len(timeouts) == 0 {
+		timeouts = []time.Duration{0}
+	}
+
+	var results []*Result
+	for _, n := range config.N {
+		for _, batchSize := range config.BatchSizes {
+			for _, timeout := range timeouts {
+				result, err := RunOnce(config, Params{
+					Plugin:       config.Plugin,
+					N:            n,
+					BatchSize:    batchSize,
+					BatchTimeout: timeout,
+				})
+				if err != nil {
+					return results, err
+				}
+				results = append(results, result)
+			}
+		}
+	}
+	return results, nil
+}
+
+// RunOnce runs a cluster with the parameters and drives the load of config
+// against it
+func RunOnce(config Config, params Params) (*Result, error) {
+	p, ok := plugins[params.Plugin]
+	if !ok {
+		return nil, fmt.Errorf("Unknown plugin %s, expected one of %s", params.Plugin, strings.Join(Plugins(), ", "))
+	}
+	if params.N < 1 || params.BatchSize < 1 {
+		return nil, fmt.Errorf("Invalid parameters %+v, N and the batch size must be positive", params)
+	}
+	if config.Transactions < 1 {
+		return nil, fmt.Errorf("Expected at least one transaction to measure")
+	}
+	if config.Rate <= 0 && config.Window < 1 {
+		config.Window = 1
+	}
+	if config.Timeout <= 0 {
+		config.Timeout = time.Minute
+	}
+
+	settings := map[string]string{p.batchKey: fmt.Sprint(params.BatchSize)}
+	if p.nKey != "" {
+		settings[p.nKey] = fmt.Sprint(params.N)
+	}
+	if p.timeoutKey != "" && params.BatchTimeout > 0 {
+		settings[p.timeoutKey] = params.BatchTimeout.String()
+	}
+	if p.settings != nil {
+		for key, value := range p.settings(params.N) {
+			settings[key] = value
+		}
+	}
+	restore := setEnv(p.prefix, settings)
+	defer restore()
+
+	logger.Infof("Benchmarking %+v", params)
+	tracker := newTracker()
+	c := newCluster(params.N, p.new, tracker.committed)
+	defer c.stop()
+
+	run := &run{config: config, cluster: c, tracker: tracker}
+	if config.Warmup > 0 {
+		tracker.reset(config.Warmup)
+		if err := run.drive("warmup", config.Warmup); err != nil {
+			return nil, err
+		}
+	}
+	tracker.reset(config.Transactions)
+	start := time.Now()
+	if err := run.drive("bench", config.Transactions); err != nil {
+		return nil, err
+	}
+	return tracker.result(params, start), nil
+}
+
+// run drives the load of a benchmark against a cluster
+type run struct {
+	config  Config
+	cluster *cluster
+	tracker *tracker
+}
+
+// drive submits count transactions, round robin to the replicas, and waits
+// until they are committed
+func (r *run) drive(phase string, count int) error {
+	deadline := time.After(r.config.Timeout)
+	interval := time.Duration(0)
+	if r.config.Rate > 0 {
+		interval = time.Duration(float64(time.Second) / r.config.Rate)
+	}
+	next := time.Now()
+	for i := 0; i < count; i++ {
+		if interval > 0 {
+			if wait := next.Sub(time.Now()); wait > 0 {
+				time.Sleep(wait)
+			}
+			next = next.Add(interval)
+		} else {
+			select {
+			case <-r.tracker.slots(r.config.Window):
+			case <-deadline:
+				return fmt.Errorf("Timed out after %v submitting %s transactions", r.config.Timeout, phase)
+			}
+		}
+		tx := &pb.Transaction{
+			Type:    pb.Transaction_CHAINCODE_INVOKE,
+			Uuid:    fmt.Sprintf("%s-%d", phase, i),
+			Payload: make([]byte, r.config.PayloadSize),
+		}
+		raw, err := proto.Marshal(tx)
+		if err != nil {
+			return fmt.Errorf("Could not marshal transaction: %s", err)
+		}
+		r.tracker.submitted(tx.Uuid)
+		for replica := uint64(i % r.cluster.size()); ; {
+			err := r.cluster.submit(replica, raw)
+			if err != consensus.ErrBusy && err != consensus.ErrRateLimited {
+				break
+			}
+			select {
+			case <-time.After(time.Millisecond):
+			case <-deadline:
+				return fmt.Errorf("Timed out after %v submitting %s transactions", r.config.Timeout, phase)
+			}
+		}
+	}
+	select {
+	case <-r.tracker.done:
+		return nil
+	case <-deadline:
+		return fmt.Errorf("Timed out after %v, %d of %d %s transactions committed", r.config.Timeout, r.tracker.count(), count, phase)
+	}
+}
+
+// tracker measures the latency of the transactions in flight
+type tracker struct {
+	lock      sync.Mutex
+	pending   map[string]time.Time // submission times of the transactions in flight
+	latencies []time.Duration
+	expected  int
+	last      time.Time
+	window    chan struct{}
+	done      chan struct{}
+}
+
+func newTracker() *tracker {
+	return &tracker{}
+}
+
+// reset starts measuring a phase of expected transactions
+func (t *tracker) reset(expected int) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	t.pending = make(map[string]time.Time)
+	t.latencies = nil
+	t.expected = expected
+	t.window = nil
+	t.done = make(chan struct{})
+}
+
+// slots returns the channel of free slots of a window of size transactions
+func (t *tracker) slots(size int) chan struct{} {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	if t.window == nil {
+		t.window = make(chan struct{}, size)
+		for i := 0; i < size; i++ {
+			t.window <- struct{}{}
+		}
+	}
+	return t.window
+}
+
+func (t *tracker) submitted(uuid string) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	t.pending[uuid] = time.Now()
+}
+
+// committed is called whenever a replica commits a block
+func (t *tracker) committed(txs []*pb.Transaction) {
+	now := time.Now()
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	for _, tx := range txs {
+		submitted, ok := t.pending[tx.Uuid]
+		if !ok {
+			continue // committed before by another replica, or of an earlier phase
+		}
+		delete(t.pending, tx.Uuid)
+		t.latencies = append(t.latencies, now.Sub(submitted))
+		t.last = now
+		if t.window != nil {
+			select {
+			case t.window <- struct{}{}:
+			default:
+			}
+		}
+		if len(t.latencies) == t.expected {
+			close(t.done)
+		}
+	}
+}
+
+func (t *tracker) count() int {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	return len(t.latencies)
+}
+
+// result summarizes the measurements of the phase started at start
+func (t *tracker) result(params Params, start time.Time) *Result {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	latencies := append([]time.Duration(nil), t.latencies...)
+	sort.Sort(durations(latencies))
+	result := &Result{
+		Params:    params,
+		Committed: len(latencies),
+		Elapsed:   t.last.Sub(start),
+		P50:       percentile(latencies, 50),
+		P90:       percentile(latencies, 90),
+		P99:       percentile(latencies, 99),
+		Max:       percentile(latencies, 100),
+	}
+	if result.Elapsed > 0 {
+		result.Throughput = float64(result.Committed) / result.Elapsed.Seconds()
+	}
+	return result
+}
+
+type durations []time.Duration
+
+func (d durations) Len() int           { return len(d) }
+func (d durations) Less(i, j int) bool { return d[i] < d[j] }
+func (d durations) Swap(i, j int)      { d[i], d[j] = d[j], d[i] }
+
+// percentile returns the p-th percentile of sorted latencies, by the nearest
+// rank method
+func percentile(sorted []time.Duration, p int) time.Duration {
+	if len(sorted) == 0 {
+		return 0
+	}
+	rank := (p*len(sorted) + 99) / 100
+	if rank < 1 {
+		rank = 1
+	}
+	return sorted[rank-1]
+}
+
+// WriteResults formats results as a table, one row per run
+func WriteResults(w io.Writer, results []*Result) error {
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(tw, "plugin\tN\tbatch\ttimeout\ttx\ttx/s\tp50\tp90\tp99\tmax\t")
+	for _, r := range results {
+		timeout := "-"
+		if r.BatchTimeout > 0 {
+			timeout = r.BatchTimeout.String()
+		}
+		fmt.Fprintf(tw, "%s\t%d\t%d\t%s\t%d\t%.1f\t%v\t%v\t%v\t%v\t\n", r.Plugin, r.N, r.BatchSize, timeout,
+			r.Committed, r.Throughput, round(r.P50), round(r.P90), round(r.P99), round(r.Max))
+	}
+	return tw.Flush()
+}
+
+// round drops the precision of a latency which measurements don't support
+func round(d time.Duration) time.Duration {
+	return d / (10 * time.Microsecond) * (10 * time.Microsecond)
+}
+
+// setEnv sets the plugin settings in the environment, where the plugins read
+// them from, and returns the function restoring the previous environment
+func setEnv(prefix string, settings map[string]string) func() {
+	previous := make(map[string]*string)
+	for key, value := range settings {
+		name := prefix + "_" + strings.ToUpper(strings.Replace(key, ".", "_", -1))
+		if old, ok := os.LookupEnv(name); ok {
+			previous[name] = &old
+		} else {
+			previous[name] = nil
+		}
+		os.Setenv(name, value)
+	}
+	return func() {
+		for name, old := range previous {
+			if old == nil {
+				os.Unsetenv(name)
+			} else {
+				os.Setenv(name, *old)
+			}
+		}
+	}
+}
@@ -0,0 +1,100 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bench
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPercentile(t *testing.T) {
+	var sorted []time.Duration
+	for i := 1; i <= 10; i++ {
+		sorted = append(sorted, time.Duration(i)*time.Millisecond)
+	}
+	for p, expected := range map[int]time.Duration{
+		0:   time.Millisecond,
+		50:  5 * time.Millisecond,
+		90:  9 * time.Millisecond,
+		99:  10 * time.Millisecond,
+		100: 10 * time.Millisecond,
+	} {
+		if actual := percentile(sorted, p); actual != expected {
+			t.Errorf("Expected percentile %d to be %v, got %v", p, expected, actual)
+		}
+	}
+	if actual := percentile(nil, 50); actual != 0 {
+		t.Errorf("Expected the percentile of no latencies to be 0, got %v", actual)
+	}
+}
+
+func TestUnknownPlugin(t *testing.T) {
+	if _, err := Run(Config{Plugin: "nonsense", N: []int{4}, BatchSizes: []int{1}, Transactions: 1}); err == nil {
+		t.Fatalf("Expected an unknown plugin to be rejected")
+	}
+}
+
+func TestSweep(t *testing.T) {
+	for _, plugin := range Plugins() {
+		results, err := Run(Config{
+			Plugin:        plugin,
+			N:             []int{1, 4},
+			BatchSizes:    []int{1, 10},
+			BatchTimeouts: []time.Duration{10 * time.Millisecond},
+			Transactions:  50,
+			Warmup:        10,
+			Window:        20,
+			Timeout:       30 * time.Second,
+		})
+		if err != nil {
+			t.Fatalf("Benchmark of %s failed: %s", plugin, err)
+		}
+		if len(results) != 4 {
+			t.Fatalf("Expected a result for each of the 4 combinations of %s, got %d", plugin, len(results))
+		}
+		for _, r := range results {
+			if r.Committed != 50 || r.Throughput <= 0 || r.P50 > r.P99 || r.P99 > r.Max {
+				t.Errorf("Implausible result %+v", r)
+			}
+		}
+
+		var out bytes.Buffer
+		if err := WriteResults(&out, results); err != nil {
+			t.Fatalf("Could not write results: %s", err)
+		}
+		if lines := strings.Count(out.String(), "\n"); lines != 5 {
+			t.Errorf("Expected a header and 4 rows, got:\n%s", out.String())
+		}
+	}
+}
+
+func TestRateLimited(t *testing.T) {
+	start := time.Now()
+	result, err := RunOnce(Config{Transactions: 20, Rate: 200, Timeout: 30 * time.Second},
+		Params{Plugin: "pbft", N: 4, BatchSize: 5, BatchTimeout: 10 * time.Millisecond})
+	if err != nil {
+		t.Fatalf("Benchmark failed: %s", err)
+	}
+	if elapsed := time.Since(start); elapsed < 90*time.Millisecond {
+		t.Errorf("Expected 20 transactions at 200 per second to take at least 100ms, took %v", elapsed)
+	}
+	if result.Committed != 20 {
+		t.Errorf("Expected 20 transactions to be committed, got %d", result.Committed)
+	}
+}
@@ -0,0 +1,336 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bench
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/golang/protobuf/proto"
+
+	"github.com/hyperledger/fabric/consensus"
+	"github.com/hyperledger/fabric/consensus/util"
+	pb "github.com/hyperledger/fabric/protos"
+)
+
+// streamSize is the number of messages buffered between two replicas, large
+// enough that a loaded cluster does not drop messages
+const streamSize = 100000
+
+// cluster runs N replicas in process, connected over a memory network, each
+// with a ledger of its own which only records the blocks
+type cluster struct {
+	replicas []*replica
+	memory   *util.MemoryNetwork
+	done     chan struct{}
+}
+
+// replica implements consensus.Stack for one replica of a cluster, plugins
+// which use the legacy executor are not supported, its methods panic
+type replica struct {
+	consensus.LegacyExecutor
+
+	id        uint64
+	handle    *pb.PeerID
+	cluster   *cluster
+	transport consensus.Transport
+	consenter consensus.Consenter
+	committed func(txs []*pb.Transaction)
+
+	lock    sync.Mutex
+	blocks  []*pb.Block
+	hashes  [][]byte
+	pending []*pb.Transaction // executed but not committed yet
+	state   map[string][]byte
+}
+
+func newCluster(n int, new func(consensus.Stack) consensus.Consenter, committed func(txs []*pb.Transaction)) *cluster {
+	c := &cluster{
+		memory: util.NewMemoryNetwork(streamSize),
+		done:   make(chan struct{}),
+	}
+	genesis := pb.NewBlock(nil, nil)
+	hash, _ := genesis.GetHash()
+	for id := uint64(0); id < uint64(n); id++ {
+		handle := &pb.PeerID{Name: "vp" + strconv.FormatUint(id, 10)}
+		c.replicas = append(c.replicas, &replica{
+			id:        id,
+			handle:    handle,
+			cluster:   c,
+			transport: c.memory.Transport(handle),
+			committed: committed,
+			blocks:    []*pb.Block{genesis},
+			hashes:    [][]byte{hash},
+			state:     make(map[string][]byte),
+		})
+	}
+	for _, r := range c.replicas {
+		r.consenter = new(r)
+	}
+	for _, r := range c.replicas {
+		go r.deliver()
+	}
+	return c
+}
+
+func (c *cluster) size() int {
+	return len(c.replicas)
+}
+
+// submit hands a client transaction to a replica
+func (c *cluster) submit(id uint64, tx []byte) error {
+	r := c.replicas[id]
+	return r.consenter.RecvMsg(&pb.Message{Type: pb.Message_CHAIN_TRANSACTION, Payload: tx}, r.handle)
+}
+
+func (c *cluster) stop() {
+	close(c.done)
+	c.memory.Close()
+	for _, r := range c.replicas {
+		if closer, ok := r.consenter.(interface {
+			Close()
+		}); ok {
+			closer.Close()
+		}
+	}
+}
+
+// deliver hands the messages the replica receives to its consenter
+func (r *replica) deliver() {
+	for {
+		select {
+		case received := <-r.transport.Receive():
+			r.consenter.RecvMsg(received.Msg, received.Sender)
+		case <-r.cluster.done:
+			return
+		}
+	}
+}
+
+func (r *replica) GetNetworkInfo() (self *pb.PeerEndpoint, network []*pb.PeerEndpoint, err error) {
+	for _, other := range r.cluster.replicas {
+		endpoint := &pb.PeerEndpoint{ID: other.handle, Type: pb.PeerEndpoint_VALIDATOR}
+		if other == r {
+			self = endpoint
+		} else {
+			network = append(network, endpoint)
+		}
+	}
+	return
+}
+
+func (r *replica) GetNetworkHandles() (self *pb.PeerID, network []*pb.PeerID, err error) {
+	for _, other := range r.cluster.replicas {
+		network = append(network, other.handle)
+	}
+	return r.handle, network, nil
+}
+
+func (r *replica) Broadcast(msg *pb.Message, peerType pb.PeerEndpoint_Type) error {
+	return r.transport.Broadcast(msg, peerType)
+}
+
+func (r *replica) Unicast(msg *pb.Message, receiverHandle *pb.PeerID) error {
+	return r.transport.Send(msg, receiverHandle)
+}
+
+func (r *replica) Sign(msg []byte) ([]byte, error) {
+	return msg, nil
+}
+
+func (r *replica) Verify(peerID *pb.PeerID, signature []byte, message []byte) error {
+	return nil
+}
+
+func (r *replica) VerifyTransaction(tx *pb.Transaction) error {
+	return fmt.Errorf("security is disabled")
+}
+
+func (r *replica) Start() {}
+
+func (r *replica) Halt() {}
+
+func (r *replica) Execute(tag interface{}, txs []*pb.Transaction) {
+	r.lock.Lock()
+	r.pending = append(r.pending, txs...)
+	r.lock.Unlock()
+	go r.consenter.Executed(tag)
+}
+
+func (r *replica) Commit(tag interface{}, metadata []byte) {
+	r.lock.Lock()
+	txs := r.pending
+	r.pending = nil
+	block := pb.NewBlock(txs, metadata)
+	block.PreviousBlockHash = r.hashes[len(r.hashes)-1]
+	hash, err := block.GetHash()
+	if err != nil {
+		r.lock.Unlock()
+		panic(fmt.Errorf("Replica %d could not hash block: %s", r.id, err))
+	}
+	r.blocks = append(r.blocks, block)
+	r.hashes = append(r.hashes, hash)
+	info := r.infoLocked()
+	r.lock.Unlock()
+
+	r.committed(txs)
+	go r.consenter.Committed(tag, info)
+}
+
+func (r *replica) Rollback(tag interface{}) {
+	r.lock.Lock()
+	r.pending = nil
+	r.lock.Unlock()
+	go r.consenter.RolledBack(tag)
+}
+
+// UpdateState copies the blocks up to the target from the first of the peers
+// which has them
+func (r *replica) UpdateState(tag interface{}, target *pb.BlockchainInfo, peers []*pb.PeerID) {
+	for _, other := range r.cluster.replicas {
+		if other == r || !containsPeer(peers, other.handle) {
+			continue
+		}
+		other.lock.Lock()
+		if uint64(len(other.blocks)) < target.Height {
+			other.lock.Unlock()
+			continue
+		}
+		blocks := append([]*pb.Block(nil), other.blocks[:target.Height]...)
+		hashes := append([][]byte(nil), other.hashes[:target.Height]...)
+		other.lock.Unlock()
+
+		r.lock.Lock()
+		r.blocks, r.hashes, r.pending = blocks, hashes, nil
+		info := r.infoLocked()
+		r.lock.Unlock()
+		go r.consenter.StateUpdated(tag, info)
+		return
+	}
+	go r.consenter.StateUpdated(tag, nil)
+}
+
+func containsPeer(peers []*pb.PeerID, handle *pb.PeerID) bool {
+	if len(peers) == 0 {
+		return true
+	}
+	for _, peer := range peers {
+		if peer.Name == handle.Name {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *replica) InvalidateState() {}
+
+func (r *replica) ValidateState() {}
+
+func (r *replica) GetBlock(id uint64) (*pb.Block, error) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	if id >= uint64(len(r.blocks)) {
+		return nil, fmt.Errorf("Replica %d has no block %d", r.id, id)
+	}
+	return r.blocks[id], nil
+}
+
+func (r *replica) GetBlockchainSize() uint64 {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	return uint64(len(r.blocks))
+}
+
+func (r *replica) GetBlockchainInfo() *pb.BlockchainInfo {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	return r.infoLocked()
+}
+
+func (r *replica) GetBlockchainInfoBlob() []byte {
+	raw, _ := proto.Marshal(r.GetBlockchainInfo())
+	return raw
+}
+
+func (r *replica) GetBlockHeadMetadata() ([]byte, error) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	return r.blocks[len(r.blocks)-1].ConsensusMetadata, nil
+}
+
+// infoLocked returns the blockchain info, it must be called with the lock held
+func (r *replica) infoLocked() *pb.BlockchainInfo {
+	height := len(r.blocks)
+	info := &pb.BlockchainInfo{
+		Height:           uint64(height),
+		CurrentBlockHash: r.hashes[height-1],
+	}
+	if height > 1 {
+		info.PreviousBlockHash = r.hashes[height-2]
+	}
+	return info
+}
+
+func (r *replica) StoreState(key string, value []byte) error {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.state[key] = value
+	return nil
+}
+
+func (r *replica) ReadState(key string) ([]byte, error) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	if value, ok := r.state[key]; ok {
+		return value, nil
+	}
+	return nil, fmt.Errorf("cannot find key %s", key)
+}
+
+func (r *replica) ReadStateSet(prefix string) (map[string][]byte, error) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	set := make(map[string][]byte)
+	for key, value := range r.state {
+		if strings.HasPrefix(key, prefix) {
+			set[key] = value
+		}
+	}
+	return set, nil
+}
+
+func (r *replica) IterateState(prefix string, visit func(key string, value []byte) bool) error {
+	set, _ := r.ReadStateSet(prefix)
+	util.IterateStateSet(set, visit)
+	return nil
+}
+
+func (r *replica) DelState(key string) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	delete(r.state, key)
+}
+
+func (r *replica) Health() consensus.Health {
+	return consensus.Health{Healthy: true}
+}
+
+func (r *replica) Metrics() consensus.Metrics {
+	return nil
+}
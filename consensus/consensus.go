@@ -17,9 +17,21 @@ limitations under the License.
 package consensus
 
 import (
+	"errors"
+
+	"github.com/hyperledger/fabric/consensus/util"
 	pb "github.com/hyperledger/fabric/protos"
 )
 
+// ErrBusy is returned by RecvMsg when the consenter is too far behind to
+// accept a client transaction, the transaction may be submitted again later
+var ErrBusy = errors.New("consensus is busy, retry later")
+
+// ErrRateLimited is returned by RecvMsg when the client of a transaction
+// submits faster than its rate limit allows, the transaction may be submitted
+// again later
+var ErrRateLimited = errors.New("client exceeded its transaction rate, retry later")
+
 // ExecutionConsumer allows callbacks from asycnhronous execution and statetransfer
 type ExecutionConsumer interface {
 	Executed(tag interface{})                                // Called whenever Execute completes
@@ -28,11 +40,49 @@ type ExecutionConsumer interface {
 	StateUpdated(tag interface{}, target *pb.BlockchainInfo) // Called when state transfer completes, if target is nil, this indicates a failure and a new target should be supplied
 }
 
+// Health is whether a component of consensus works, with a short
+// description of what it is doing, or of why it does not work
+type Health struct {
+	Healthy bool
+	Detail  string
+}
+
+// Metrics are numeric measurements of a component of consensus, by name,
+// the names being prefixed with the name of the component, e.g. pbft.view
+type Metrics map[string]float64
+
+// HealthReporter is polled uniformly by the controller and the peer, whatever the plugin
+type HealthReporter interface {
+	Health() Health   // Reports whether the component works, it must not block for long even if the component is stuck
+	Metrics() Metrics // Reports the current measurements of the component, nil if it cannot take them
+}
+
 // Consenter is used to receive messages from the network
 // Every consensus plugin needs to implement this interface
 type Consenter interface {
 	RecvMsg(msg *pb.Message, senderHandle *pb.PeerID) error // Called serially with incoming messages from gRPC
 	ExecutionConsumer
+	HealthReporter
+}
+
+// StateDumper may be implemented by a Consenter which can describe its internal state for debugging
+type StateDumper interface {
+	DumpState() ([]byte, error) // Returns the current state of the consenter, serialized as JSON
+}
+
+// ConfigReloader may be implemented by a Consenter which can apply changes to its configuration without a restart
+type ConfigReloader interface {
+	ReloadConfig() error // Re-reads the configuration, the consenter decides which settings to apply and when
+}
+
+// PluginSwitcher may be implemented by a Consenter which can hand over to another consensus plugin at runtime
+type PluginSwitcher interface {
+	SwitchPlugin(plugin string, height uint64) error // Hands over once the blockchain reaches height, which must be the same on every validator
+}
+
+// ClientLimiter may be implemented by a Consenter which limits the rate at which each client submits transactions
+type ClientLimiter interface {
+	SetClientLimit(client string, rate float64, burst int) error // Overrides the limits of a client until restart, a zero rate lifts them, a negative one restores the configured limits
 }
 
 // Inquirer is used to retrieve info about the validating network
@@ -47,6 +97,14 @@ type Communicator interface {
 	Unicast(msg *pb.Message, receiverHandle *pb.PeerID) error
 }
 
+// Transport carries consensus messages between validators, core/peer being the
+// default one, so the plugins run unchanged over another, or in memory under test
+type Transport interface {
+	Send(msg *pb.Message, receiverHandle *pb.PeerID) error          // Sends a message to a single peer
+	Broadcast(msg *pb.Message, peerType pb.PeerEndpoint_Type) error // Sends a message to every connected peer of peerType
+	Receive() <-chan *util.Message                                  // Delivers the messages of every peer, each peer's in the order it sent them
+}
+
 // NetworkStack is used to retrieve network info and send messages
 type NetworkStack interface {
 	Communicator
@@ -57,6 +115,7 @@ type NetworkStack interface {
 type SecurityUtils interface {
 	Sign(msg []byte) ([]byte, error)
 	Verify(peerID *pb.PeerID, signature []byte, message []byte) error
+	VerifyTransaction(tx *pb.Transaction) error // Checks the certificate chain and signature of a client transaction, fails if they cannot be checked
 }
 
 // ReadOnlyLedger is used for interrogating the blockchain
@@ -71,10 +130,12 @@ type ReadOnlyLedger interface {
 // LegacyExecutor is used to invoke transactions, potentially modifying the backing ledger
 type LegacyExecutor interface {
 	BeginTxBatch(id interface{}) error
-	ExecTxs(id interface{}, txs []*pb.Transaction) ([]byte, error)
+	ExecTxs(id interface{}, txs []*pb.Transaction) (stateHash []byte, results []*pb.TransactionResult, err error) // One result per transaction, err only if the batch as a whole could not execute
 	CommitTxBatch(id interface{}, metadata []byte) (*pb.Block, error)
+	CommitTxBatchN(id interface{}, metadata []byte, n int) ([]*pb.Block, error) // Commits once n batches accumulated, staging them until then
 	RollbackTxBatch(id interface{}) error
 	PreviewCommitTxBatch(id interface{}, metadata []byte) ([]byte, error)
+	SetCommitCertificate(blockNumber uint64, cert *pb.CommitCertificate) error // Attaches to a committed block the proof it was properly ordered, kept out of the block hash
 }
 
 // Executor is intended to eventually supplant the old Executor interface
@@ -100,6 +161,7 @@ type StatePersistor interface {
 	StoreState(key string, value []byte) error
 	ReadState(key string) ([]byte, error)
 	ReadStateSet(prefix string) (map[string][]byte, error)
+	IterateState(prefix string, visit func(key string, value []byte) bool) error // Visits the pairs whose key starts with prefix in key order, until visit returns false
 	DelState(key string)
 }
 
@@ -112,4 +174,5 @@ type Stack interface {
 	LedgerManager
 	ReadOnlyLedger
 	StatePersistor
+	HealthReporter
 }
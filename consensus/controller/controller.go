@@ -23,25 +23,93 @@ import (
 	"github.com/spf13/viper"
 
 	"github.com/hyperledger/fabric/consensus"
+	"github.com/hyperledger/fabric/consensus/helper/persist"
+	"github.com/hyperledger/fabric/consensus/honeybadger"
+	"github.com/hyperledger/fabric/consensus/kafka"
 	"github.com/hyperledger/fabric/consensus/noops"
 	"github.com/hyperledger/fabric/consensus/pbft"
+	"github.com/hyperledger/fabric/consensus/raft"
+	"github.com/hyperledger/fabric/consensus/solo"
 )
 
 var logger *logging.Logger // package-level logger
 var consenter consensus.Consenter
 
+// plugins constructs a new instance of each consensus plugin, for the
+// validator to switch to at runtime
+var plugins = map[string]func(consensus.Stack) consensus.Consenter{
+	"pbft":        pbft.New,
+	"raft":        raft.New,
+	"honeybadger": honeybadger.New,
+	"solo":        solo.New,
+	"kafka":       kafka.New,
+	"noops":       noops.GetNoops,
+}
+
 func init() {
 	logger = logging.MustGetLogger("consensus/controller")
 }
 
-// NewConsenter constructs a Consenter object if not already present
+// NewConsenter constructs a Consenter object if not already present.  The
+// consenter runs the configured plugin, unless the validator switched to
+// another one at runtime.
 func NewConsenter(stack consensus.Stack) consensus.Consenter {
-
 	plugin := strings.ToLower(viper.GetString("peer.validator.consensus.plugin"))
+	if _, ok := plugins[plugin]; !ok {
+		plugin = "noops"
+	}
+	configured := newNamespacedStack(stack, plugin)
+	migrateConfigured(stack, plugin, configured.ns)
+	return newSwitchingConsenter(stack, plugin, func() consensus.Consenter {
+		return newConfiguredConsenter(plugin, configured)
+	})
+}
+
+// chain returns the name of the chain the consensus plugins order, their
+// state is kept apart from that of the plugins ordering other chains
+func chain() string {
+	if name := viper.GetString("peer.validator.consensus.chain"); name != "" {
+		return name
+	}
+	return "default"
+}
+
+// migrateConfigured moves the state persisted before namespaces were
+// introduced into the namespace of the configured plugin, which is the one
+// that persisted it.  The keys of the controller and of switched plugins
+// stay where they are.
+func migrateConfigured(stack consensus.Stack, plugin string, ns *persist.Namespace) {
+	moved, err := persist.Migrate(stack, "", ns, func(key string) bool {
+		return strings.HasPrefix(key, "controller.") || legacySwitchedKey.MatchString(key)
+	})
+	if err != nil {
+		logger.Errorf("Could not move the state of consensus plugin %s into its namespace: %s", plugin, err)
+	} else if moved > 0 {
+		logger.Infof("Moved %d entries of the state of consensus plugin %s into its namespace", moved, plugin)
+	}
+}
+
+func newConfiguredConsenter(plugin string, stack consensus.Stack) consensus.Consenter {
 	if plugin == "pbft" {
 		logger.Infof("Creating consensus plugin %s", plugin)
 		return pbft.GetPlugin(stack)
 	}
+	if plugin == "raft" {
+		logger.Infof("Creating consensus plugin %s", plugin)
+		return raft.GetPlugin(stack)
+	}
+	if plugin == "honeybadger" {
+		logger.Infof("Creating consensus plugin %s", plugin)
+		return honeybadger.GetPlugin(stack)
+	}
+	if plugin == "solo" {
+		logger.Infof("Creating consensus plugin %s", plugin)
+		return solo.GetPlugin(stack)
+	}
+	if plugin == "kafka" {
+		logger.Infof("Creating consensus plugin %s", plugin)
+		return kafka.GetPlugin(stack)
+	}
 	logger.Info("Creating default consensus plugin (noops)")
 	return noops.GetNoops(stack)
 
@@ -0,0 +1,363 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/golang/protobuf/proto"
+
+	"github.com/hyperledger/fabric/consensus"
+	"github.com/hyperledger/fabric/consensus/helper/persist"
+	"github.com/hyperledger/fabric/consensus/noops"
+	pb "github.com/hyperledger/fabric/protos"
+)
+
+// A switch to another plugin is requested on every validator, for the same
+// height of the blockchain.  The running plugin keeps ordering until it
+// commits the block before that height, its last: the controller then
+// quiesces it, delivering it no more messages nor callbacks, records the
+// handover, and starts the new plugin, which commits the next block.
+// Transactions the old plugin ordered past its last block are dropped, their
+// clients submit them again.
+//
+// The new plugin starts as on a new network, on the blockchain the old one
+// left: it reads no block metadata until it commits a block of its own, and
+// keeps its consensus state apart from that of the plugins before it.
+
+const (
+	pendingSwitchKey = "controller.pendingSwitch"
+	activeSwitchKey  = "controller.activeSwitch"
+)
+
+// switchingConsenter delegates to the running consensus plugin, and hands
+// over to another plugin at the requested height
+type switchingConsenter struct {
+	stack consensus.Stack
+
+	lock      sync.Mutex
+	plugin    string              // name of the running plugin
+	consenter consensus.Consenter // the running plugin
+	active    *pb.ConsensusSwitch // switch which started the running plugin, nil for the configured one
+	pending   *pb.ConsensusSwitch // switch to perform, nil if none
+}
+
+func newSwitchingConsenter(stack consensus.Stack, configured string, newConfigured func() consensus.Consenter) *switchingConsenter {
+	sc := &switchingConsenter{
+		stack:   stack,
+		active:  readSwitch(stack, activeSwitchKey),
+		pending: readSwitch(stack, pendingSwitchKey),
+	}
+	if sc.active != nil {
+		migrateSwitched(stack, sc.active)
+	}
+
+	if sc.pending != nil && stack.GetBlockchainSize() >= sc.pending.Height {
+		// the validator stopped after the last block of the old plugin
+		// committed, but before the new plugin started
+		sc.activate(sc.pending)
+	} else if sc.active != nil {
+		logger.Infof("Running consensus plugin %s, switched to at block %d, instead of the configured %s", sc.active.Plugin, sc.active.Height, configured)
+		sc.plugin = sc.active.Plugin
+		sc.consenter = plugins[sc.active.Plugin](newSwitchedStack(stack, sc.active))
+	} else {
+		sc.plugin = configured
+		sc.consenter = newConfigured()
+	}
+
+	if sc.pending != nil {
+		logger.Infof("Consensus plugin %s to take over from %s at block %d", sc.pending.Plugin, sc.plugin, sc.pending.Height)
+	}
+	return sc
+}
+
+func readSwitch(stack consensus.Stack, key string) *pb.ConsensusSwitch {
+	raw, err := stack.ReadState(key)
+	if err != nil {
+		return nil
+	}
+	sw := &pb.ConsensusSwitch{}
+	if err := proto.Unmarshal(raw, sw); err != nil {
+		logger.Errorf("Could not unmarshal %s - local state is damaged: %s", key, err)
+		return nil
+	}
+	if _, ok := plugins[sw.Plugin]; !ok {
+		logger.Errorf("Ignoring %s to unknown consensus plugin %s", key, sw.Plugin)
+		return nil
+	}
+	return sw
+}
+
+func storeSwitch(stack consensus.Stack, key string, sw *pb.ConsensusSwitch) error {
+	raw, err := proto.Marshal(sw)
+	if err != nil {
+		return err
+	}
+	return stack.StoreState(key, raw)
+}
+
+// SwitchPlugin schedules the switch to another plugin once the blockchain
+// reaches height, replacing any switch scheduled before
+func (sc *switchingConsenter) SwitchPlugin(plugin string, height uint64) error {
+	plugin = strings.ToLower(plugin)
+	if _, ok := plugins[plugin]; !ok {
+		return fmt.Errorf("Unknown consensus plugin %s", plugin)
+	}
+
+	sc.lock.Lock()
+	defer sc.lock.Unlock()
+
+	if plugin == sc.plugin {
+		return fmt.Errorf("Consensus plugin %s is already running", plugin)
+	}
+	if size := sc.stack.GetBlockchainSize(); height <= size {
+		return fmt.Errorf("Cannot switch at block %d, the blockchain already has %d blocks", height, size)
+	}
+	if sc.pending != nil {
+		logger.Warningf("Replacing the switch to consensus plugin %s at block %d", sc.pending.Plugin, sc.pending.Height)
+	}
+
+	sw := &pb.ConsensusSwitch{Plugin: plugin, Height: height}
+	if err := storeSwitch(sc.stack, pendingSwitchKey, sw); err != nil {
+		return fmt.Errorf("Could not persist the switch: %s", err)
+	}
+	sc.pending = sw
+	logger.Infof("Consensus plugin %s to take over from %s at block %d", plugin, sc.plugin, height)
+	return nil
+}
+
+// running returns the running plugin
+func (sc *switchingConsenter) running() consensus.Consenter {
+	sc.lock.Lock()
+	defer sc.lock.Unlock()
+	return sc.consenter
+}
+
+// current returns the running plugin, after switching if the blockchain
+// reached the height of the pending switch.  The switch happens on the
+// callback of the commit or state transfer taking the blockchain there, so
+// that no callback of the old plugin reaches the new one.
+func (sc *switchingConsenter) current() (consenter consensus.Consenter, switched bool) {
+	sc.lock.Lock()
+	defer sc.lock.Unlock()
+
+	if sc.pending != nil && sc.stack.GetBlockchainSize() >= sc.pending.Height {
+		logger.Infof("Consensus plugin %s committed its last block %d, handing over to %s", sc.plugin, sc.pending.Height-1, sc.pending.Plugin)
+		if closer, ok := sc.consenter.(interface {
+			Close()
+		}); ok {
+			closer.Close()
+		}
+		sc.activate(sc.pending)
+		switched = true
+	}
+	return sc.consenter, switched
+}
+
+// activate records a switch as done, and starts its plugin
+func (sc *switchingConsenter) activate(sw *pb.ConsensusSwitch) {
+	if err := storeSwitch(sc.stack, activeSwitchKey, sw); err != nil {
+		logger.Errorf("Could not persist the switch to consensus plugin %s, the validator will run %s again after a restart: %s", sw.Plugin, sc.plugin, err)
+	}
+	sc.stack.DelState(pendingSwitchKey)
+	if sc.active != nil {
+		// the state of the previous switched plugin is of no use anymore
+		previous := newSwitchedStack(sc.stack, sc.active)
+		state, _ := previous.ReadStateSet("")
+		for key := range state {
+			previous.DelState(key)
+		}
+	}
+
+	logger.Infof("Creating consensus plugin %s, committing from block %d on", sw.Plugin, sw.Height)
+	sc.plugin = sw.Plugin
+	sc.consenter = plugins[sw.Plugin](newSwitchedStack(sc.stack, sw))
+	sc.active = sw
+	sc.pending = nil
+}
+
+// RecvMsg is called by the stack when a new message is received
+func (sc *switchingConsenter) RecvMsg(msg *pb.Message, senderHandle *pb.PeerID) error {
+	consenter := sc.running()
+	if _, ok := consenter.(*noops.Noops); ok {
+		// noops commits through the legacy executor, which calls nothing
+		// back, so it hands over on the next message instead
+		consenter, _ = sc.current()
+	}
+	return consenter.RecvMsg(msg, senderHandle)
+}
+
+// Executed is called whenever Execute completes
+func (sc *switchingConsenter) Executed(tag interface{}) {
+	sc.running().Executed(tag)
+}
+
+// Committed is called whenever Commit completes, the commit of the last
+// block of a plugin is not delivered to it as it was quiesced
+func (sc *switchingConsenter) Committed(tag interface{}, target *pb.BlockchainInfo) {
+	if consenter, switched := sc.current(); !switched {
+		consenter.Committed(tag, target)
+	}
+}
+
+// RolledBack is called whenever a Rollback completes
+func (sc *switchingConsenter) RolledBack(tag interface{}) {
+	sc.running().RolledBack(tag)
+}
+
+// StateUpdated is called when state transfer completes, which may take the
+// blockchain past the height of the pending switch
+func (sc *switchingConsenter) StateUpdated(tag interface{}, target *pb.BlockchainInfo) {
+	if consenter, switched := sc.current(); !switched {
+		consenter.StateUpdated(tag, target)
+	}
+}
+
+// DumpState returns the state of the running plugin
+func (sc *switchingConsenter) DumpState() ([]byte, error) {
+	consenter := sc.running()
+	dumper, ok := consenter.(consensus.StateDumper)
+	if !ok {
+		return nil, fmt.Errorf("Consenter %T does not support dumping its state", consenter)
+	}
+	return dumper.DumpState()
+}
+
+// ReloadConfig has the running plugin re-read its configuration
+func (sc *switchingConsenter) ReloadConfig() error {
+	consenter := sc.running()
+	reloader, ok := consenter.(consensus.ConfigReloader)
+	if !ok {
+		return fmt.Errorf("Consenter %T does not support reloading its configuration", consenter)
+	}
+	return reloader.ReloadConfig()
+}
+
+// SetClientLimit overrides the limits of a client in the running plugin, the
+// override does not carry over to a plugin switched to
+func (sc *switchingConsenter) SetClientLimit(client string, rate float64, burst int) error {
+	consenter := sc.running()
+	limiter, ok := consenter.(consensus.ClientLimiter)
+	if !ok {
+		return fmt.Errorf("Consenter %T does not support client limits", consenter)
+	}
+	return limiter.SetClientLimit(client, rate, burst)
+}
+
+// Health reports the health of the running plugin
+func (sc *switchingConsenter) Health() consensus.Health {
+	sc.lock.Lock()
+	plugin, consenter := sc.plugin, sc.consenter
+	sc.lock.Unlock()
+
+	health := consenter.Health()
+	health.Detail = plugin + ": " + health.Detail
+	return health
+}
+
+// Metrics reports the metrics of the running plugin, and the height of the
+// pending switch if any
+func (sc *switchingConsenter) Metrics() consensus.Metrics {
+	sc.lock.Lock()
+	consenter, pending := sc.consenter, sc.pending
+	sc.lock.Unlock()
+
+	metrics := consenter.Metrics()
+	if metrics == nil {
+		metrics = make(consensus.Metrics)
+	}
+	if pending != nil {
+		metrics["controller.switchHeight"] = float64(pending.Height)
+	}
+	return metrics
+}
+
+// namespacedStack is the stack of a plugin, whose consensus state is kept
+// in a namespace of its own
+type namespacedStack struct {
+	consensus.Stack
+	ns *persist.Namespace
+}
+
+func newNamespacedStack(stack consensus.Stack, plugin string) *namespacedStack {
+	return &namespacedStack{
+		Stack: stack,
+		ns:    persist.NewNamespace(stack, plugin, chain()),
+	}
+}
+
+func (s *namespacedStack) StoreState(key string, value []byte) error {
+	return s.ns.StoreState(key, value)
+}
+
+func (s *namespacedStack) ReadState(key string) ([]byte, error) {
+	return s.ns.ReadState(key)
+}
+
+func (s *namespacedStack) ReadStateSet(prefix string) (map[string][]byte, error) {
+	return s.ns.ReadStateSet(prefix)
+}
+
+func (s *namespacedStack) IterateState(prefix string, visit func(key string, value []byte) bool) error {
+	return s.ns.IterateState(prefix, visit)
+}
+
+func (s *namespacedStack) DelState(key string) {
+	s.ns.DelState(key)
+}
+
+// switchedStack is the stack of a plugin switched to at runtime.  The plugin
+// finds no block metadata until it commits a block, and its consensus state
+// is kept in a namespace of its own, apart from that of the same plugin
+// running before.
+type switchedStack struct {
+	*namespacedStack
+	height uint64
+}
+
+func newSwitchedStack(stack consensus.Stack, sw *pb.ConsensusSwitch) *switchedStack {
+	return &switchedStack{
+		namespacedStack: newNamespacedStack(stack, fmt.Sprintf("%s@%d", sw.Plugin, sw.Height)),
+		height:          sw.Height,
+	}
+}
+
+func (s *switchedStack) GetBlockHeadMetadata() ([]byte, error) {
+	if s.GetBlockchainSize() <= s.height {
+		return nil, nil
+	}
+	return s.Stack.GetBlockHeadMetadata()
+}
+
+// legacySwitchedKey matches the keys switched plugins persisted under a
+// prefix, before their state was kept in namespaces
+var legacySwitchedKey = regexp.MustCompile(`^[a-z]+@[0-9]+\.`)
+
+// migrateSwitched moves the state a switched plugin persisted under a prefix
+// into its namespace
+func migrateSwitched(stack consensus.Stack, sw *pb.ConsensusSwitch) {
+	switched := newSwitchedStack(stack, sw)
+	moved, err := persist.Migrate(stack, fmt.Sprintf("%s@%d.", sw.Plugin, sw.Height), switched.ns, nil)
+	if err != nil {
+		logger.Errorf("Could not move the state of consensus plugin %s into its namespace: %s", sw.Plugin, err)
+	} else if moved > 0 {
+		logger.Infof("Moved %d entries of the state of consensus plugin %s into its namespace", moved, sw.Plugin)
+	}
+}
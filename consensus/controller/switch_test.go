@@ -0,0 +1,244 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/hyperledger/fabric/consensus"
+	"github.com/hyperledger/fabric/consensus/util"
+	pb "github.com/hyperledger/fabric/protos"
+)
+
+type mockStack struct {
+	consensus.Stack
+	size  uint64
+	meta  []byte
+	state map[string][]byte
+}
+
+func newMockStack(size uint64) *mockStack {
+	return &mockStack{size: size, meta: []byte("old metadata"), state: make(map[string][]byte)}
+}
+
+func (s *mockStack) GetBlockchainSize() uint64 {
+	return s.size
+}
+
+func (s *mockStack) GetBlockHeadMetadata() ([]byte, error) {
+	return s.meta, nil
+}
+
+func (s *mockStack) StoreState(key string, value []byte) error {
+	s.state[key] = value
+	return nil
+}
+
+func (s *mockStack) ReadState(key string) ([]byte, error) {
+	if val, ok := s.state[key]; ok {
+		return val, nil
+	}
+	return nil, fmt.Errorf("cannot find key %s", key)
+}
+
+func (s *mockStack) ReadStateSet(prefix string) (map[string][]byte, error) {
+	ret := make(map[string][]byte)
+	for key, val := range s.state {
+		if strings.HasPrefix(key, prefix) {
+			ret[key] = val
+		}
+	}
+	return ret, nil
+}
+
+func (s *mockStack) IterateState(prefix string, visit func(key string, value []byte) bool) error {
+	state, _ := s.ReadStateSet(prefix)
+	util.IterateStateSet(state, visit)
+	return nil
+}
+
+func (s *mockStack) DelState(key string) {
+	delete(s.state, key)
+}
+
+type mockConsenter struct {
+	name      string
+	stack     consensus.Stack
+	committed int
+	closed    bool
+}
+
+func (mc *mockConsenter) RecvMsg(msg *pb.Message, senderHandle *pb.PeerID) error  { return nil }
+func (mc *mockConsenter) Executed(tag interface{})                                {}
+func (mc *mockConsenter) Committed(tag interface{}, target *pb.BlockchainInfo)    { mc.committed++ }
+func (mc *mockConsenter) RolledBack(tag interface{})                              {}
+func (mc *mockConsenter) StateUpdated(tag interface{}, target *pb.BlockchainInfo) {}
+func (mc *mockConsenter) Health() consensus.Health                                { return consensus.Health{Healthy: true} }
+func (mc *mockConsenter) Metrics() consensus.Metrics                              { return nil }
+func (mc *mockConsenter) Close()                                                  { mc.closed = true }
+
+// withMockPlugins replaces the plugins by mocks for a test
+func withMockPlugins(t *testing.T, test func(created map[string]*mockConsenter)) {
+	saved := plugins
+	defer func() { plugins = saved }()
+
+	created := make(map[string]*mockConsenter)
+	plugins = make(map[string]func(consensus.Stack) consensus.Consenter)
+	for _, name := range []string{"old", "new", "newer"} {
+		name := name
+		plugins[name] = func(stack consensus.Stack) consensus.Consenter {
+			created[name] = &mockConsenter{name: name, stack: stack}
+			return created[name]
+		}
+	}
+	test(created)
+}
+
+func TestSwitchAtHeight(t *testing.T) {
+	withMockPlugins(t, func(created map[string]*mockConsenter) {
+		stack := newMockStack(5)
+		sc := newSwitchingConsenter(stack, "old", func() consensus.Consenter { return plugins["old"](stack) })
+		old := created["old"]
+
+		if err := sc.SwitchPlugin("new", 5); err == nil {
+			t.Errorf("Expected switching at the current height to fail")
+		}
+		if err := sc.SwitchPlugin("old", 7); err == nil {
+			t.Errorf("Expected switching to the running plugin to fail")
+		}
+		if err := sc.SwitchPlugin("NEW", 7); err != nil {
+			t.Fatalf("Could not schedule switch: %s", err)
+		}
+		if metrics := sc.Metrics(); metrics["controller.switchHeight"] != 7 {
+			t.Errorf("Expected the metrics to report the switch height, got %v", metrics)
+		}
+		if health := sc.Health(); !strings.HasPrefix(health.Detail, "old: ") {
+			t.Errorf("Expected the health to name the running plugin, got %q", health.Detail)
+		}
+
+		stack.size = 6
+		sc.Committed(nil, nil)
+		if old.committed != 1 || created["new"] != nil {
+			t.Fatalf("Expected the old plugin to run until the switch height")
+		}
+
+		stack.size = 7
+		sc.Committed(nil, nil)
+		if old.committed != 1 || !old.closed {
+			t.Errorf("Expected the old plugin to be quiesced when it committed its last block")
+		}
+		mc := created["new"]
+		if mc == nil || sc.running() != mc {
+			t.Fatalf("Expected the new plugin to take over")
+		}
+		if meta, _ := mc.stack.GetBlockHeadMetadata(); meta != nil {
+			t.Errorf("Expected the new plugin not to read the metadata of the old one, got %s", meta)
+		}
+		stack.size = 8
+		if meta, _ := mc.stack.GetBlockHeadMetadata(); meta == nil {
+			t.Errorf("Expected the new plugin to read the metadata of its own blocks")
+		}
+		if _, err := stack.ReadState(pendingSwitchKey); err == nil {
+			t.Errorf("Expected the pending switch to be cleared")
+		}
+	})
+}
+
+func TestSwitchedPluginStateIsolated(t *testing.T) {
+	withMockPlugins(t, func(created map[string]*mockConsenter) {
+		stack := newMockStack(5)
+		stack.state["key"] = []byte("old")
+		sc := newSwitchingConsenter(stack, "old", func() consensus.Consenter { return plugins["old"](stack) })
+		sc.SwitchPlugin("new", 6)
+		stack.size = 6
+		sc.StateUpdated(nil, nil)
+
+		state := created["new"].stack
+		if _, err := state.ReadState("key"); err == nil {
+			t.Errorf("Expected the new plugin not to read the state of the old one")
+		}
+		state.StoreState("key", []byte("new"))
+		if set, _ := state.ReadStateSet("k"); !reflect.DeepEqual(set, map[string][]byte{"key": []byte("new")}) {
+			t.Errorf("Expected the new plugin to read its own state, got %v", set)
+		}
+
+		sc.SwitchPlugin("newer", 8)
+		stack.size = 8
+		sc.Committed(nil, nil)
+		if len(stack.state) != 2 || string(stack.state["key"]) != "old" {
+			t.Errorf("Expected the state of the replaced plugin to be removed, the store holds %v", stack.state)
+		}
+	})
+}
+
+func TestSwitchSurvivesRestart(t *testing.T) {
+	withMockPlugins(t, func(created map[string]*mockConsenter) {
+		stack := newMockStack(5)
+		newOld := func() consensus.Consenter { return plugins["old"](stack) }
+		sc := newSwitchingConsenter(stack, "old", newOld)
+		sc.SwitchPlugin("new", 7)
+
+		// the validator stops after the last block of the old plugin
+		stack.size = 7
+		created["new"] = nil
+		newSwitchingConsenter(stack, "old", newOld)
+		if created["new"] == nil {
+			t.Fatalf("Expected the switch to happen on restart")
+		}
+
+		// and again later on
+		created["old"], created["new"] = nil, nil
+		sc = newSwitchingConsenter(stack, "old", newOld)
+		if created["old"] != nil || sc.running() != created["new"] {
+			t.Errorf("Expected the switched plugin to run after a restart instead of the configured one")
+		}
+	})
+}
+
+func TestLegacyStateMigrated(t *testing.T) {
+	withMockPlugins(t, func(created map[string]*mockConsenter) {
+		stack := newMockStack(5)
+		newOld := func() consensus.Consenter { return plugins["old"](stack) }
+		sc := newSwitchingConsenter(stack, "old", newOld)
+		sc.SwitchPlugin("new", 7)
+		stack.size = 7
+		sc.Committed(nil, nil)
+
+		// state persisted by earlier versions, without namespaces
+		stack.state["chkpt.1"] = []byte("old")
+		stack.state["new@7.chkpt.1"] = []byte("new")
+		configured := newNamespacedStack(stack, "old")
+		migrateConfigured(stack, "old", configured.ns)
+		if val, _ := configured.ReadState("chkpt.1"); string(val) != "old" {
+			t.Errorf("Expected the state of the configured plugin in its namespace, got %s", val)
+		}
+
+		created["new"] = nil
+		newSwitchingConsenter(stack, "old", newOld)
+		if val, _ := created["new"].stack.ReadState("chkpt.1"); string(val) != "new" {
+			t.Errorf("Expected the state of the switched plugin in its namespace, got %s", val)
+		}
+		for key := range stack.state {
+			if key == "chkpt.1" || legacySwitchedKey.MatchString(key) {
+				t.Errorf("Expected legacy key %s to be moved", key)
+			}
+		}
+	})
+}
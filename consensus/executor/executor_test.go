@@ -92,14 +92,14 @@ func (mock *mockRawExecutor) BeginTxBatch(id interface{}) error {
 	return nil
 }
 
-func (mock *mockRawExecutor) ExecTxs(id interface{}, txs []*pb.Transaction) ([]byte, error) {
+func (mock *mockRawExecutor) ExecTxs(id interface{}, txs []*pb.Transaction) ([]byte, []*pb.TransactionResult, error) {
 	if mock.curBatch != id {
 		e := fmt.Errorf("Attempted to exec on a different batch")
 		mock.t.Fatal(e)
-		return nil, e
+		return nil, nil, e
 	}
 	mock.curTxs = append(mock.curTxs, txs...)
-	return nil, nil
+	return nil, nil, nil
 }
 
 func (mock *mockRawExecutor) CommitTxBatch(id interface{}, meta []byte) (*pb.Block, error) {
@@ -112,6 +112,15 @@ func (mock *mockRawExecutor) CommitTxBatch(id interface{}, meta []byte) (*pb.Blo
 	return nil, nil
 }
 
+func (mock *mockRawExecutor) CommitTxBatchN(id interface{}, meta []byte, n int) ([]*pb.Block, error) {
+	block, err := mock.CommitTxBatch(id, meta)
+	return []*pb.Block{block}, err
+}
+
+func (mock *mockRawExecutor) SetCommitCertificate(blockNumber uint64, cert *pb.CommitCertificate) error {
+	return nil
+}
+
 func (mock *mockRawExecutor) RollbackTxBatch(id interface{}) error {
 	if mock.curBatch == nil {
 		e := fmt.Errorf("Attempted to rollback a batch which doesn't exist")
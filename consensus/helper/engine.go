@@ -24,18 +24,17 @@ import (
 	"sync"
 
 	"github.com/hyperledger/fabric/consensus/controller"
-	"github.com/hyperledger/fabric/consensus/util"
 	"github.com/hyperledger/fabric/core/chaincode"
 	pb "github.com/hyperledger/fabric/protos"
 	"golang.org/x/net/context"
 )
 
-// EngineImpl implements a struct to hold consensus.Consenter, PeerEndpoint and MessageFan
+// EngineImpl implements a struct to hold consensus.Consenter, PeerEndpoint and the peer transport
 type EngineImpl struct {
 	consenter    consensus.Consenter
 	helper       *Helper
 	peerEndpoint *pb.PeerEndpoint
-	consensusFan *util.MessageFan
+	transport    *peerTransport
 }
 
 // GetHandlerFactory returns new NewConsensusHandler
@@ -83,13 +82,92 @@ func (eng *EngineImpl) ProcessTransactionMsg(msg *pb.Message, tx *pb.Transaction
 		// the consenter gets around to handling the message, but it also provides some
 		// natural feedback to the REST API to determine how long it takes to queue messages
 		err := eng.consenter.RecvMsg(msg, eng.peerEndpoint.ID)
-		if err != nil {
+		if err == consensus.ErrBusy || err == consensus.ErrRateLimited {
+			response = &pb.Response{Status: pb.Response_BUSY, Msg: []byte(err.Error())}
+		} else if err != nil {
 			response = &pb.Response{Status: pb.Response_FAILURE, Msg: []byte(err.Error())}
 		}
 	}
 	return response
 }
 
+// DumpConsensusState returns the internal state of the consenter of the
+// engine, serialized as JSON, for debugging
+func DumpConsensusState() ([]byte, error) {
+	eng := getEngineImpl()
+	if eng == nil || eng.consenter == nil {
+		return nil, fmt.Errorf("Engine not initialized")
+	}
+	dumper, ok := eng.consenter.(consensus.StateDumper)
+	if !ok {
+		return nil, fmt.Errorf("Consenter %T does not support dumping its state", eng.consenter)
+	}
+	return dumper.DumpState()
+}
+
+// ReloadConsensusConfig asks the consenter of the engine to re-read its configuration
+func ReloadConsensusConfig() error {
+	eng := getEngineImpl()
+	if eng == nil || eng.consenter == nil {
+		return fmt.Errorf("Engine not initialized")
+	}
+	reloader, ok := eng.consenter.(consensus.ConfigReloader)
+	if !ok {
+		return fmt.Errorf("Consenter %T does not support reloading its configuration", eng.consenter)
+	}
+	return reloader.ReloadConfig()
+}
+
+// GetConsensusHealth polls the health and metrics of the consenter of the
+// engine and of its stack, whatever the plugin
+func GetConsensusHealth() (*pb.ConsensusHealth, error) {
+	eng := getEngineImpl()
+	if eng == nil || eng.consenter == nil {
+		return nil, fmt.Errorf("Engine not initialized")
+	}
+	consenterHealth := eng.consenter.Health()
+	stackHealth := eng.helper.Health()
+	health := &pb.ConsensusHealth{
+		Healthy: consenterHealth.Healthy && stackHealth.Healthy,
+		Detail:  consenterHealth.Detail + "; " + stackHealth.Detail,
+		Metrics: make(map[string]float64),
+	}
+	for _, metrics := range []consensus.Metrics{eng.consenter.Metrics(), eng.helper.Metrics()} {
+		for name, value := range metrics {
+			health.Metrics[name] = value
+		}
+	}
+	return health, nil
+}
+
+// SwitchConsensusPlugin asks the consenter of the engine to switch to another
+// plugin once the blockchain reaches height
+func SwitchConsensusPlugin(plugin string, height uint64) error {
+	eng := getEngineImpl()
+	if eng == nil || eng.consenter == nil {
+		return fmt.Errorf("Engine not initialized")
+	}
+	switcher, ok := eng.consenter.(consensus.PluginSwitcher)
+	if !ok {
+		return fmt.Errorf("Consenter %T does not support switching plugins", eng.consenter)
+	}
+	return switcher.SwitchPlugin(plugin, height)
+}
+
+// SetClientLimit asks the consenter of the engine to override the
+// transaction rate limits of a client
+func SetClientLimit(client string, rate float64, burst int) error {
+	eng := getEngineImpl()
+	if eng == nil || eng.consenter == nil {
+		return fmt.Errorf("Engine not initialized")
+	}
+	limiter, ok := eng.consenter.(consensus.ClientLimiter)
+	if !ok {
+		return fmt.Errorf("Consenter %T does not support client limits", eng.consenter)
+	}
+	return limiter.SetClientLimit(client, rate, burst)
+}
+
 func (eng *EngineImpl) setConsenter(consenter consensus.Consenter) *EngineImpl {
 	eng.consenter = consenter
 	return eng
@@ -113,17 +191,17 @@ func GetEngine(coord peer.MessageHandlerCoordinator) (peer.Engine, error) {
 	var err error
 	engineOnce.Do(func() {
 		engine = new(EngineImpl)
-		engine.helper = NewHelper(coord)
+		engine.transport = newPeerTransport(coord)
+		engine.helper = NewHelperWithTransport(coord, engine.transport)
 		engine.consenter = controller.NewConsenter(engine.helper)
 		engine.helper.setConsenter(engine.consenter)
 		engine.peerEndpoint, err = coord.GetPeerEndpoint()
-		engine.consensusFan = util.NewMessageFan()
 
 		go func() {
 			logger.Debug("Starting up message thread for consenter")
 
 			// The channel never closes, so this should never break
-			for msg := range engine.consensusFan.GetOutChannel() {
+			for msg := range engine.transport.Receive() {
 				engine.consenter.RecvMsg(msg.Msg, msg.Sender)
 			}
 		}()
@@ -19,6 +19,7 @@ package helper
 import (
 	"fmt"
 
+	"github.com/golang/protobuf/proto"
 	"github.com/op/go-logging"
 	"github.com/spf13/viper"
 
@@ -43,8 +44,9 @@ const (
 // It also implements the Stack.
 type ConsensusHandler struct {
 	peer.MessageHandler
-	consenterChan chan *util.Message
-	coordinator   peer.MessageHandlerCoordinator
+	consenterChan   chan *util.Message
+	coordinator     peer.MessageHandlerCoordinator
+	envelopeVersion uint32 // Consensus envelope version negotiated in the hello, 0 for unwrapped payloads
 }
 
 // NewConsensusHandler constructs a new MessageHandler for the plugin.
@@ -73,15 +75,30 @@ func NewConsensusHandler(coord peer.MessageHandlerCoordinator,
 	pe, _ := handler.To()
 
 	handler.consenterChan = make(chan *util.Message, consensusQueueSize)
-	getEngineImpl().consensusFan.RegisterChannel(pe.ID, handler.consenterChan)
+	getEngineImpl().transport.registerStream(pe.ID, handler.consenterChan)
 
 	return handler, nil
 }
 
 // HandleMessage handles the incoming Fabric messages for the Peer
 func (handler *ConsensusHandler) HandleMessage(msg *pb.Message) error {
+	if msg.Type == pb.Message_DISC_HELLO {
+		handler.negotiateEnvelope(msg)
+	}
+
 	if msg.Type == pb.Message_CONSENSUS {
 		senderPE, _ := handler.To()
+		if handler.envelopeVersion > 0 {
+			payload, err := pb.UnwrapConsensusPayload(msg.Payload)
+			if err != nil {
+				err = fmt.Errorf("Rejecting consensus message from %v: %s", senderPE.ID, err)
+				logger.Error(err)
+				return err
+			}
+			unwrapped := *msg
+			unwrapped.Payload = payload
+			msg = &unwrapped
+		}
 		select {
 		case handler.consenterChan <- &util.Message{
 			Msg:    msg,
@@ -100,3 +117,18 @@ func (handler *ConsensusHandler) HandleMessage(msg *pb.Message) error {
 	}
 	return handler.MessageHandler.HandleMessage(msg)
 }
+
+// negotiateEnvelope settles the consensus envelope version used with the peer
+// from its hello, before the hello is handed on and the peer becomes reachable
+// for broadcasts.  A malformed hello is left for the peer handler to reject
+func (handler *ConsensusHandler) negotiateEnvelope(msg *pb.Message) {
+	hello := &pb.HelloMessage{}
+	if err := proto.Unmarshal(msg.Payload, hello); err != nil || hello.PeerEndpoint == nil {
+		return
+	}
+	handler.envelopeVersion = pb.NegotiateConsensusEnvelopeVersion(hello.ConsensusEnvelopeVersion)
+	if handler.envelopeVersion < pb.ConsensusEnvelopeVersion {
+		logger.Infof("Peer %v supports consensus envelope versions up to %d, exchanging consensus messages with it in version %d", hello.PeerEndpoint.ID, hello.ConsensusEnvelopeVersion, handler.envelopeVersion)
+	}
+	getEngineImpl().transport.setEnvelopeVersion(hello.PeerEndpoint.ID, handler.envelopeVersion)
+}
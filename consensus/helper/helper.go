@@ -18,6 +18,7 @@ package helper
 
 import (
 	"fmt"
+	"time"
 
 	"github.com/golang/protobuf/proto"
 	"github.com/spf13/viper"
@@ -42,19 +43,33 @@ type Helper struct {
 	secHelper    crypto.Peer
 	curBatch     []*pb.Transaction       // TODO, remove after issue 579
 	curBatchErrs []*pb.TransactionResult // TODO, remove after issue 579
+	staged       int                     // Number of transaction batches staged by CommitTxBatchN
 	persist.Helper
 
+	transport consensus.Transport
+	watchdog  *watchdog
+
 	executor consensus.Executor
 }
 
-// NewHelper constructs the consensus helper object
+// NewHelper constructs the consensus helper object, sending the consensus
+// messages over the connections of core/peer
 func NewHelper(mhc peer.MessageHandlerCoordinator) *Helper {
+	return NewHelperWithTransport(mhc, newPeerTransport(mhc))
+}
+
+// NewHelperWithTransport constructs the consensus helper object, sending the
+// consensus messages over transport
+func NewHelperWithTransport(mhc peer.MessageHandlerCoordinator, transport consensus.Transport) *Helper {
 	h := &Helper{
 		coordinator: mhc,
 		secOn:       viper.GetBool("security.enabled"),
 		secHelper:   mhc.GetSecHelper(),
 		valid:       true, // Assume our state is consistent until we are told otherwise, TODO: revisit
+		transport:   transport,
+		watchdog:    newWatchdog(viper.GetDuration("peer.validator.consensus.stalltimeout")),
 	}
+	h.watchdog.start()
 
 	h.executor = executor.NewImpl(h, h, mhc)
 	h.executor.Start()
@@ -107,16 +122,12 @@ func (h *Helper) GetNetworkHandles() (self *pb.PeerID, network []*pb.PeerID, err
 
 // Broadcast sends a message to all validating peers
 func (h *Helper) Broadcast(msg *pb.Message, peerType pb.PeerEndpoint_Type) error {
-	errors := h.coordinator.Broadcast(msg, peerType)
-	if len(errors) > 0 {
-		return fmt.Errorf("Couldn't broadcast successfully")
-	}
-	return nil
+	return h.transport.Broadcast(msg, peerType)
 }
 
 // Unicast sends a message to a specified receiver
 func (h *Helper) Unicast(msg *pb.Message, receiverHandle *pb.PeerID) error {
-	return h.coordinator.Unicast(msg, receiverHandle)
+	return h.transport.Send(msg, receiverHandle)
 }
 
 // Sign a message with this validator's signing key
@@ -155,6 +166,17 @@ func (h *Helper) Verify(replicaID *pb.PeerID, signature []byte, message []byte)
 	return fmt.Errorf("Could not verify message from %s (unknown peer)", replicaID.Name)
 }
 
+// VerifyTransaction checks that the certificate of a transaction was issued
+// by a trusted authority and that the transaction is signed with it.  With
+// security disabled nothing can be checked, so it fails
+func (h *Helper) VerifyTransaction(tx *pb.Transaction) error {
+	if !h.secOn {
+		return fmt.Errorf("Security is disabled")
+	}
+	_, err := h.secHelper.TransactionPreValidation(tx)
+	return err
+}
+
 // BeginTxBatch gets invoked when the next round
 // of transaction-batch execution begins
 func (h *Helper) BeginTxBatch(id interface{}) error {
@@ -171,34 +193,21 @@ func (h *Helper) BeginTxBatch(id interface{}) error {
 }
 
 // ExecTxs executes all the transactions listed in the txs array
-// one-by-one. If all the executions are successful, it returns
-// the candidate global state hash, and nil error array.
-func (h *Helper) ExecTxs(id interface{}, txs []*pb.Transaction) ([]byte, error) {
+// one-by-one. It returns the candidate global state hash, and a result
+// for each transaction, carrying its error if it failed, the failure of
+// one transaction not preventing the others from executing.
+func (h *Helper) ExecTxs(id interface{}, txs []*pb.Transaction) ([]byte, []*pb.TransactionResult, error) {
 	// TODO id is currently ignored, fix once the underlying implementation accepts id
 
 	// The secHelper is set during creat ChaincodeSupport, so we don't need this step
 	// cxt := context.WithValue(context.Background(), "security", h.coordinator.GetSecHelper())
-	// TODO return directly once underlying implementation no longer returns []error
-
-	succeededTxs, res, ccevents, txerrs, err := chaincode.ExecuteTransactions(context.Background(), chaincode.DefaultChain, txs)
-
-	h.curBatch = append(h.curBatch, succeededTxs...) // TODO, remove after issue 579
 
-	//copy errs to result
-	txresults := make([]*pb.TransactionResult, len(txerrs))
+	succeededTxs, res, txresults, err := chaincode.ExecuteTransactions(context.Background(), chaincode.DefaultChain, txs)
 
-	//process errors for each transaction
-	for i, e := range txerrs {
-		//NOTE- it'll be nice if we can have error values. For now success == 0, error == 1
-		if txerrs[i] != nil {
-			txresults[i] = &pb.TransactionResult{Uuid: txs[i].Uuid, Error: e.Error(), ErrorCode: 1, ChaincodeEvent: ccevents[i]}
-		} else {
-			txresults[i] = &pb.TransactionResult{Uuid: txs[i].Uuid, ChaincodeEvent: ccevents[i]}
-		}
-	}
+	h.curBatch = append(h.curBatch, succeededTxs...)      // TODO, remove after issue 579
 	h.curBatchErrs = append(h.curBatchErrs, txresults...) // TODO, remove after issue 579
 
-	return res, err
+	return res, txresults, err
 }
 
 // CommitTxBatch gets invoked when the current transaction-batch needs
@@ -212,7 +221,9 @@ func (h *Helper) CommitTxBatch(id interface{}, metadata []byte) (*pb.Block, erro
 		return nil, fmt.Errorf("Failed to get the ledger: %v", err)
 	}
 	// TODO fix this one the ledger has been fixed to implement
-	if err := ledger.CommitTxBatch(id, h.curBatch, h.curBatchErrs, metadata); err != nil {
+	err = ledger.CommitTxBatch(id, h.curBatch, h.curBatchErrs, metadata)
+	h.staged = 0 // committed along with the batch, or discarded
+	if err != nil {
 		return nil, fmt.Errorf("Failed to commit transaction to the ledger: %v", err)
 	}
 
@@ -232,8 +243,48 @@ func (h *Helper) CommitTxBatch(id interface{}, metadata []byte) (*pb.Block, erro
 	return block, nil
 }
 
+// CommitTxBatchN ends the current transaction-batch like CommitTxBatch, but
+// only writes it to the ledger once n batches have accumulated.  Until then
+// the batch is staged: the next one, begun with the same id, executes against
+// its state, and they all reach the ledger in a single write with no further
+// state hash computation.  This saves a write per batch where they dominate,
+// as when catching up, at the price of losing the staged batches if the peer
+// stops before they are written.  It returns the blocks written, if any
+func (h *Helper) CommitTxBatchN(id interface{}, metadata []byte, n int) ([]*pb.Block, error) {
+	ledger, err := ledger.GetLedger()
+	if err != nil {
+		return nil, fmt.Errorf("Failed to get the ledger: %v", err)
+	}
+
+	if h.staged+1 < n {
+		if err := ledger.StageTxBatch(id, h.curBatch, h.curBatchErrs, metadata); err != nil {
+			return nil, fmt.Errorf("Failed to stage transactions with the ledger: %v", err)
+		}
+		h.staged++
+		h.curBatch = nil     // TODO, remove after issue 579
+		h.curBatchErrs = nil // TODO, remove after issue 579
+		return nil, nil
+	}
+
+	count := uint64(h.staged + 1)
+	if _, err := h.CommitTxBatch(id, metadata); err != nil {
+		return nil, err
+	}
+	size := ledger.GetBlockchainSize()
+	blocks := make([]*pb.Block, 0, count)
+	for blockNumber := size - count; blockNumber < size; blockNumber++ {
+		block, err := ledger.GetBlockByNumber(blockNumber)
+		if err != nil {
+			return nil, fmt.Errorf("Failed to get committed block %d: %v", blockNumber, err)
+		}
+		blocks = append(blocks, block)
+	}
+	return blocks, nil
+}
+
 // RollbackTxBatch discards all the state changes that may have taken
-// place during the execution of current transaction-batch
+// place during the execution of current transaction-batch, including
+// the batches staged by CommitTxBatchN
 func (h *Helper) RollbackTxBatch(id interface{}) error {
 	ledger, err := ledger.GetLedger()
 	if err != nil {
@@ -242,6 +293,7 @@ func (h *Helper) RollbackTxBatch(id interface{}) error {
 	if err := ledger.RollbackTxBatch(id); err != nil {
 		return fmt.Errorf("Failed to rollback transaction with the ledger: %v", err)
 	}
+	h.staged = 0
 	h.curBatch = nil     // TODO, remove after issue 579
 	h.curBatchErrs = nil // TODO, remove after issue 579
 	return nil
@@ -265,6 +317,15 @@ func (h *Helper) PreviewCommitTxBatch(id interface{}, metadata []byte) ([]byte,
 	return rawInfo, nil
 }
 
+// SetCommitCertificate attaches to a committed block the certificate of its ordering
+func (h *Helper) SetCommitCertificate(blockNumber uint64, cert *pb.CommitCertificate) error {
+	ledger, err := ledger.GetLedger()
+	if err != nil {
+		return fmt.Errorf("Failed to get the ledger: %v", err)
+	}
+	return ledger.SetCommitCertificate(blockNumber, cert)
+}
+
 // GetBlock returns a block from the chain
 func (h *Helper) GetBlock(blockNumber uint64) (block *pb.Block, err error) {
 	ledger, err := ledger.GetLedger()
@@ -329,18 +390,42 @@ func (h *Helper) ValidateState() {
 	h.valid = true
 }
 
+// Health reports the stack unhealthy while the execution of transactions is
+// stalled, or while consensus deems its ledger out of date
+func (h *Helper) Health() consensus.Health {
+	if detail, stalled := h.watchdog.status(time.Now()); stalled {
+		return consensus.Health{Detail: detail}
+	}
+	if !h.valid {
+		return consensus.Health{Detail: "ledger out of date, queries rejected"}
+	}
+	return consensus.Health{Healthy: true, Detail: fmt.Sprintf("blockchain height %d", h.GetBlockchainSize())}
+}
+
+// Metrics reports the height of the blockchain and the size of the validating network
+func (h *Helper) Metrics() consensus.Metrics {
+	metrics := consensus.Metrics{"stack.blockchainHeight": float64(h.GetBlockchainSize())}
+	if _, network, err := h.GetNetworkInfo(); err == nil {
+		metrics["stack.validators"] = float64(len(network))
+	}
+	return metrics
+}
+
 // Execute will execute a set of transactions, this may be called in succession
 func (h *Helper) Execute(tag interface{}, txs []*pb.Transaction) {
+	h.watchdog.wait("the executor to execute the transactions")
 	h.executor.Execute(tag, txs)
 }
 
 // Commit will commit whatever transactions have been executed
 func (h *Helper) Commit(tag interface{}, metadata []byte) {
+	h.watchdog.wait("the executor to commit the transactions")
 	h.executor.Commit(tag, metadata)
 }
 
 // Rollback will roll back whatever transactions have been executed
 func (h *Helper) Rollback(tag interface{}) {
+	h.watchdog.wait("the executor to roll back the transactions")
 	h.executor.Rollback(tag)
 }
 
@@ -350,11 +435,14 @@ func (h *Helper) UpdateState(tag interface{}, target *pb.BlockchainInfo, peers [
 		logger.Warning("State transfer is being called for, but the state has not been invalidated")
 	}
 
+	// State transfer takes as long as it takes, it is not watched
+	h.watchdog.idle()
 	h.executor.UpdateState(tag, target, peers)
 }
 
 // Executed is called whenever Execute completes
 func (h *Helper) Executed(tag interface{}) {
+	h.watchdog.wait("the consenter to commit or roll back the executed transactions")
 	if h.consenter != nil {
 		h.consenter.Executed(tag)
 	}
@@ -362,6 +450,7 @@ func (h *Helper) Executed(tag interface{}) {
 
 // Committed is called whenever Commit completes
 func (h *Helper) Committed(tag interface{}, target *pb.BlockchainInfo) {
+	h.watchdog.idle()
 	if h.consenter != nil {
 		h.consenter.Committed(tag, target)
 	}
@@ -369,6 +458,7 @@ func (h *Helper) Committed(tag interface{}, target *pb.BlockchainInfo) {
 
 // RolledBack is called whenever a Rollback completes
 func (h *Helper) RolledBack(tag interface{}) {
+	h.watchdog.idle()
 	if h.consenter != nil {
 		h.consenter.RolledBack(tag)
 	}
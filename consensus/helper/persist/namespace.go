@@ -0,0 +1,103 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package persist
+
+import (
+	"strings"
+
+	"github.com/hyperledger/fabric/consensus"
+)
+
+// namespacePrefix starts the keys of every namespace, no key persisted
+// before namespaces were introduced starts with it
+const namespacePrefix = "ns/"
+
+// Namespace keeps the consensus state of one plugin on one chain apart from
+// the state of the other plugins and chains sharing the persistor
+type Namespace struct {
+	persistor consensus.StatePersistor
+	prefix    string
+}
+
+// NewNamespace returns the namespace of a plugin on a chain
+func NewNamespace(persistor consensus.StatePersistor, plugin, chain string) *Namespace {
+	escape := strings.NewReplacer("%", "%25", "/", "%2F")
+	return &Namespace{
+		persistor: persistor,
+		prefix:    namespacePrefix + escape.Replace(plugin) + "/" + escape.Replace(chain) + "/",
+	}
+}
+
+// StoreState stores a key,value pair
+func (ns *Namespace) StoreState(key string, value []byte) error {
+	return ns.persistor.StoreState(ns.prefix+key, value)
+}
+
+// DelState removes a key,value pair
+func (ns *Namespace) DelState(key string) {
+	ns.persistor.DelState(ns.prefix + key)
+}
+
+// ReadState retrieves a value to a key
+func (ns *Namespace) ReadState(key string) ([]byte, error) {
+	return ns.persistor.ReadState(ns.prefix + key)
+}
+
+// ReadStateSet retrieves all key,value pairs where the key starts with prefix
+func (ns *Namespace) ReadStateSet(prefix string) (map[string][]byte, error) {
+	ret := make(map[string][]byte)
+	err := ns.IterateState(prefix, func(key string, value []byte) bool {
+		ret[key] = value
+		return true
+	})
+	return ret, err
+}
+
+// IterateState visits the key,value pairs where the key starts with prefix,
+// in key order, until visit returns false
+func (ns *Namespace) IterateState(prefix string, visit func(key string, value []byte) bool) error {
+	return ns.persistor.IterateState(ns.prefix+prefix, func(key string, value []byte) bool {
+		return visit(key[len(ns.prefix):], value)
+	})
+}
+
+// Migrate moves state persisted before namespaces were introduced into a
+// namespace.  Every pair whose key starts with prefix is moved, less the
+// prefix, unless skip returns true for its key or the key belongs to a
+// namespace.  It returns the number of pairs moved.
+func Migrate(persistor consensus.StatePersistor, prefix string, ns *Namespace, skip func(key string) bool) (int, error) {
+	legacy := make(map[string][]byte)
+	err := persistor.IterateState(prefix, func(key string, value []byte) bool {
+		if !strings.HasPrefix(key, namespacePrefix) && (skip == nil || !skip(key)) {
+			legacy[key] = value
+		}
+		return true
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	moved := 0
+	for key, value := range legacy {
+		if err := ns.StoreState(key[len(prefix):], value); err != nil {
+			return moved, err
+		}
+		persistor.DelState(key)
+		moved++
+	}
+	return moved, nil
+}
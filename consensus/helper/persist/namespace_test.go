@@ -0,0 +1,138 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package persist
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/hyperledger/fabric/consensus/util"
+)
+
+type memoryPersistor map[string][]byte
+
+func (m memoryPersistor) StoreState(key string, value []byte) error {
+	m[key] = value
+	return nil
+}
+
+func (m memoryPersistor) ReadState(key string) ([]byte, error) {
+	if val, ok := m[key]; ok {
+		return val, nil
+	}
+	return nil, fmt.Errorf("cannot find key %s", key)
+}
+
+func (m memoryPersistor) ReadStateSet(prefix string) (map[string][]byte, error) {
+	ret := make(map[string][]byte)
+	for key, val := range m {
+		if strings.HasPrefix(key, prefix) {
+			ret[key] = val
+		}
+	}
+	return ret, nil
+}
+
+func (m memoryPersistor) IterateState(prefix string, visit func(key string, value []byte) bool) error {
+	state, _ := m.ReadStateSet(prefix)
+	util.IterateStateSet(state, visit)
+	return nil
+}
+
+func (m memoryPersistor) DelState(key string) {
+	delete(m, key)
+}
+
+func TestNamespacesIsolated(t *testing.T) {
+	store := memoryPersistor{}
+	pbftMain := NewNamespace(store, "pbft", "main")
+	pbftOther := NewNamespace(store, "pbft", "other")
+	raftMain := NewNamespace(store, "raft", "main")
+	tricky := NewNamespace(store, "pbft/main", "")
+
+	pbftMain.StoreState("chkpt.1", []byte("a"))
+	pbftOther.StoreState("chkpt.1", []byte("b"))
+	raftMain.StoreState("chkpt.1", []byte("c"))
+	tricky.StoreState("x", []byte("d"))
+
+	if val, _ := pbftMain.ReadState("chkpt.1"); string(val) != "a" {
+		t.Errorf("Expected the namespace to read its own value, got %s", val)
+	}
+	if set, _ := pbftOther.ReadStateSet("chkpt."); !reflect.DeepEqual(set, map[string][]byte{"chkpt.1": []byte("b")}) {
+		t.Errorf("Expected the namespace to read only its own state, got %v", set)
+	}
+	if set, _ := pbftMain.ReadStateSet(""); len(set) != 1 {
+		t.Errorf("Expected a plugin name containing the separator not to reach into another namespace, got %v", set)
+	}
+
+	raftMain.DelState("chkpt.1")
+	if _, err := raftMain.ReadState("chkpt.1"); err == nil {
+		t.Errorf("Expected the key to be removed")
+	}
+	if len(store) != 3 {
+		t.Errorf("Expected the other namespaces to be untouched, the store holds %v", store)
+	}
+}
+
+func TestNamespaceIterate(t *testing.T) {
+	ns := NewNamespace(memoryPersistor{}, "pbft", "main")
+	for _, key := range []string{"b.2", "a.1", "b.1", "b.3"} {
+		ns.StoreState(key, []byte(key))
+	}
+
+	var visited []string
+	ns.IterateState("b.", func(key string, value []byte) bool {
+		if key != string(value) {
+			t.Errorf("Visited key %s with value %s", key, value)
+		}
+		visited = append(visited, key)
+		return len(visited) < 2
+	})
+	if !reflect.DeepEqual(visited, []string{"b.1", "b.2"}) {
+		t.Errorf("Expected to visit the keys in order until told to stop, visited %v", visited)
+	}
+}
+
+func TestMigrate(t *testing.T) {
+	store := memoryPersistor{
+		"chkpt.1":       []byte("a"),
+		"qset":          []byte("b"),
+		"controller.sw": []byte("c"),
+		"ns/raft/main/": []byte("d"),
+	}
+	ns := NewNamespace(store, "pbft", "main")
+
+	moved, err := Migrate(store, "", ns, func(key string) bool { return strings.HasPrefix(key, "controller.") })
+	if err != nil || moved != 2 {
+		t.Fatalf("Expected two keys to be moved, moved %d: %v", moved, err)
+	}
+	if set, _ := ns.ReadStateSet(""); !reflect.DeepEqual(set, map[string][]byte{"chkpt.1": []byte("a"), "qset": []byte("b")}) {
+		t.Errorf("Expected the legacy keys in the namespace, got %v", set)
+	}
+	if _, err := store.ReadState("chkpt.1"); err == nil {
+		t.Errorf("Expected the legacy key to be removed")
+	}
+	if _, err := store.ReadState("controller.sw"); err != nil {
+		t.Errorf("Expected the skipped key to stay")
+	}
+
+	if moved, _ := Migrate(store, "", ns, func(key string) bool { return strings.HasPrefix(key, "controller.") }); moved != 0 {
+		t.Errorf("Expected a second migration to move nothing, moved %d", moved)
+	}
+}
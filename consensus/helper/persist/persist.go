@@ -17,6 +17,8 @@ limitations under the License.
 package persist
 
 import (
+	"bytes"
+
 	"github.com/hyperledger/fabric/core/db"
 )
 
@@ -44,17 +46,29 @@ func (h *Helper) ReadState(key string) ([]byte, error) {
 
 // ReadStateSet retrieves all key,value pairs where the key starts with prefix
 func (h *Helper) ReadStateSet(prefix string) (map[string][]byte, error) {
+	ret := make(map[string][]byte)
+	err := h.IterateState(prefix, func(key string, value []byte) bool {
+		ret[key] = value
+		return true
+	})
+	return ret, err
+}
+
+// IterateState visits the key,value pairs where the key starts with prefix,
+// in key order, until visit returns false
+func (h *Helper) IterateState(prefix string, visit func(key string, value []byte) bool) error {
 	db := db.GetDBHandle()
 	prefixRaw := []byte("consensus." + prefix)
 
-	ret := make(map[string][]byte)
 	it := db.GetIterator(db.PersistCF)
 	defer it.Close()
-	for it.Seek(prefixRaw); it.ValidForPrefix(prefixRaw); it.Next() {
-		key := string(it.Key().Data())
+	for it.Seek(prefixRaw); it.Valid() && bytes.HasPrefix(it.Key(), prefixRaw); it.Next() {
+		key := string(it.Key())
 		key = key[len("consensus."):]
 		// copy data from the slice!
-		ret[key] = append([]byte(nil), it.Value().Data()...)
+		if !visit(key, append([]byte(nil), it.Value()...)) {
+			break
+		}
 	}
-	return ret, nil
+	return nil
 }
@@ -0,0 +1,164 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package helper
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/hyperledger/fabric/consensus/util"
+	"github.com/hyperledger/fabric/core/peer"
+	pb "github.com/hyperledger/fabric/protos"
+)
+
+// peerTransport is the consensus.Transport over the connections of core/peer,
+// each ConsensusHandler feeding it the stream of its peer.  Consensus messages
+// are wrapped into the envelope version negotiated with each peer
+type peerTransport struct {
+	coordinator peer.MessageHandlerCoordinator
+	fan         *util.MessageFan
+
+	envelopeLock     sync.RWMutex
+	envelopeVersions map[pb.PeerID]uint32 // Consensus envelope version negotiated with each peer
+}
+
+func newPeerTransport(coord peer.MessageHandlerCoordinator) *peerTransport {
+	return &peerTransport{
+		coordinator:      coord,
+		fan:              util.NewMessageFan(),
+		envelopeVersions: make(map[pb.PeerID]uint32),
+	}
+}
+
+// Broadcast sends a message to every connected peer of peerType
+func (t *peerTransport) Broadcast(msg *pb.Message, peerType pb.PeerEndpoint_Type) error {
+	if msg.Type != pb.Message_CONSENSUS {
+		return t.broadcast(msg, peerType)
+	}
+
+	receivers, err := t.envelopeReceivers(peerType)
+	if err != nil {
+		return err
+	}
+	if len(receivers) <= 1 {
+		// Every peer agreed on the same envelope version, wrap the message once
+		version := pb.ConsensusEnvelopeVersion
+		for v := range receivers {
+			version = v
+		}
+		wrapped, err := wrapConsensusMsg(msg, version)
+		if err != nil {
+			return err
+		}
+		return t.broadcast(wrapped, peerType)
+	}
+
+	// Mid upgrade, each peer gets the message in the version it understands
+	var failed bool
+	for version, peers := range receivers {
+		wrapped, err := wrapConsensusMsg(msg, version)
+		if err != nil {
+			return err
+		}
+		for _, peerID := range peers {
+			if err := t.coordinator.Unicast(wrapped, peerID); err != nil {
+				logger.Warningf("Could not send consensus message to %v: %s", peerID, err)
+				failed = true
+			}
+		}
+	}
+	if failed {
+		return fmt.Errorf("Couldn't broadcast successfully")
+	}
+	return nil
+}
+
+func (t *peerTransport) broadcast(msg *pb.Message, peerType pb.PeerEndpoint_Type) error {
+	errors := t.coordinator.Broadcast(msg, peerType)
+	if len(errors) > 0 {
+		return fmt.Errorf("Couldn't broadcast successfully")
+	}
+	return nil
+}
+
+// Send sends a message to a single peer
+func (t *peerTransport) Send(msg *pb.Message, receiverHandle *pb.PeerID) error {
+	if msg.Type == pb.Message_CONSENSUS {
+		wrapped, err := wrapConsensusMsg(msg, t.getEnvelopeVersion(receiverHandle))
+		if err != nil {
+			return err
+		}
+		msg = wrapped
+	}
+	return t.coordinator.Unicast(msg, receiverHandle)
+}
+
+// Receive returns the consensus messages the ConsensusHandlers received
+func (t *peerTransport) Receive() <-chan *util.Message {
+	return t.fan.GetOutChannel()
+}
+
+// registerStream adds the stream of consensus messages received from a peer
+func (t *peerTransport) registerStream(sender *pb.PeerID, stream <-chan *util.Message) {
+	t.fan.RegisterChannel(sender, stream)
+}
+
+// setEnvelopeVersion records the consensus envelope version negotiated with a peer
+func (t *peerTransport) setEnvelopeVersion(peerID *pb.PeerID, version uint32) {
+	t.envelopeLock.Lock()
+	defer t.envelopeLock.Unlock()
+	t.envelopeVersions[*peerID] = version
+}
+
+// getEnvelopeVersion returns the consensus envelope version negotiated with a
+// peer, peers which never said hello get unwrapped payloads
+func (t *peerTransport) getEnvelopeVersion(peerID *pb.PeerID) uint32 {
+	t.envelopeLock.RLock()
+	defer t.envelopeLock.RUnlock()
+	return t.envelopeVersions[*peerID]
+}
+
+// envelopeReceivers groups the connected peers of peerType by the consensus
+// envelope version negotiated with them
+func (t *peerTransport) envelopeReceivers(peerType pb.PeerEndpoint_Type) (map[uint32][]*pb.PeerID, error) {
+	peersMsg, err := t.coordinator.GetPeers()
+	if err != nil {
+		return nil, fmt.Errorf("Couldn't retrieve list of peers: %v", err)
+	}
+	receivers := make(map[uint32][]*pb.PeerID)
+	for _, endpoint := range peersMsg.GetPeers() {
+		// pb.PeerEndpoint_UNDEFINED collects all peers, as for the coordinator
+		if peerType != pb.PeerEndpoint_UNDEFINED && endpoint.Type != peerType {
+			continue
+		}
+		version := t.getEnvelopeVersion(endpoint.ID)
+		receivers[version] = append(receivers[version], endpoint.ID)
+	}
+	return receivers, nil
+}
+
+// wrapConsensusMsg returns a copy of the consensus message with its payload
+// wrapped into an envelope of the given version
+func wrapConsensusMsg(msg *pb.Message, version uint32) (*pb.Message, error) {
+	payload, err := pb.WrapConsensusPayload(version, msg.Payload)
+	if err != nil {
+		return nil, err
+	}
+	wrapped := *msg
+	wrapped.Payload = payload
+	return &wrapped, nil
+}
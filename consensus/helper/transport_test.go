@@ -0,0 +1,81 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package helper
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/hyperledger/fabric/core/peer"
+	pb "github.com/hyperledger/fabric/protos"
+)
+
+// envelopeCoordinator records the messages sent to each peer, the rest of
+// peer.MessageHandlerCoordinator panics if called
+type envelopeCoordinator struct {
+	peer.MessageHandlerCoordinator
+	peers []*pb.PeerEndpoint
+	sent  map[string][]*pb.Message
+}
+
+func (c *envelopeCoordinator) GetPeers() (*pb.PeersMessage, error) {
+	return &pb.PeersMessage{Peers: c.peers}, nil
+}
+
+func (c *envelopeCoordinator) Broadcast(msg *pb.Message, peerType pb.PeerEndpoint_Type) []error {
+	for _, endpoint := range c.peers {
+		c.sent[endpoint.ID.Name] = append(c.sent[endpoint.ID.Name], msg)
+	}
+	return nil
+}
+
+func (c *envelopeCoordinator) Unicast(msg *pb.Message, receiverHandle *pb.PeerID) error {
+	c.sent[receiverHandle.Name] = append(c.sent[receiverHandle.Name], msg)
+	return nil
+}
+
+func TestPeerTransportConsensusEnvelopes(t *testing.T) {
+	coord := &envelopeCoordinator{sent: make(map[string][]*pb.Message)}
+	tr := newPeerTransport(coord)
+	for _, name := range []string{"vp1", "vp2"} {
+		id := &pb.PeerID{Name: name}
+		coord.peers = append(coord.peers, &pb.PeerEndpoint{ID: id, Type: pb.PeerEndpoint_VALIDATOR})
+		tr.setEnvelopeVersion(id, pb.ConsensusEnvelopeVersion)
+	}
+	// vp2 has not been upgraded yet
+	tr.setEnvelopeVersion(&pb.PeerID{Name: "vp2"}, 0)
+
+	payload := []byte("consensus payload")
+	if err := tr.Broadcast(&pb.Message{Type: pb.Message_CONSENSUS, Payload: payload}, pb.PeerEndpoint_VALIDATOR); err != nil {
+		t.Fatalf("Broadcast failed: %s", err)
+	}
+	if err := tr.Send(&pb.Message{Type: pb.Message_CONSENSUS, Payload: payload}, &pb.PeerID{Name: "vp1"}); err != nil {
+		t.Fatalf("Send failed: %s", err)
+	}
+
+	if len(coord.sent["vp1"]) != 2 || len(coord.sent["vp2"]) != 1 {
+		t.Fatalf("Expected two messages for vp1 and one for vp2, got %v", coord.sent)
+	}
+	for _, msg := range coord.sent["vp1"] {
+		if unwrapped, err := pb.UnwrapConsensusPayload(msg.Payload); err != nil || !bytes.Equal(unwrapped, payload) {
+			t.Errorf("Expected vp1 to get the payload wrapped in an envelope, got %q", msg.Payload)
+		}
+	}
+	if msg := coord.sent["vp2"][0]; !bytes.Equal(msg.Payload, payload) {
+		t.Errorf("Expected vp2 to get the payload unwrapped, got %q", msg.Payload)
+	}
+}
@@ -0,0 +1,115 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package helper
+
+import (
+	"fmt"
+	"runtime"
+	"sync"
+	"time"
+
+	"github.com/hyperledger/fabric/events/producer"
+)
+
+// watchdog detects the handshake between the consenter and the executor,
+// Execute → Executed → Commit → Committed, stalling beyond timeout, which
+// otherwise presents as a silently frozen peer.  A stall is reported once,
+// with the goroutine stacks and an alert event, until the handshake progresses
+type watchdog struct {
+	timeout time.Duration // Zero disables the watchdog
+
+	lock     sync.Mutex
+	waiting  string    // What the handshake waits for, empty when idle
+	since    time.Time // When it started waiting
+	reported bool      // Whether the current wait was reported stalled
+}
+
+func newWatchdog(timeout time.Duration) *watchdog {
+	return &watchdog{timeout: timeout}
+}
+
+// start polls the handshake in the background, unless the watchdog is disabled
+func (w *watchdog) start() {
+	if w.timeout <= 0 {
+		return
+	}
+	go func() {
+		for now := range time.Tick(w.timeout / 4) {
+			w.poll(now)
+		}
+	}()
+}
+
+// wait records the handshake is now waiting for what
+func (w *watchdog) wait(what string) {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	w.waiting = what
+	w.since = time.Now()
+	w.reported = false
+}
+
+// idle records the handshake completed
+func (w *watchdog) idle() {
+	w.wait("")
+}
+
+// status describes the stall, if the handshake has waited beyond the timeout
+func (w *watchdog) status(now time.Time) (detail string, stalled bool) {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	return w.statusLocked(now)
+}
+
+// statusLocked is status, called with the lock held
+func (w *watchdog) statusLocked(now time.Time) (string, bool) {
+	if w.timeout <= 0 || w.waiting == "" || now.Sub(w.since) < w.timeout {
+		return "", false
+	}
+	return fmt.Sprintf("execution stalled, waiting %v for %s", now.Sub(w.since), w.waiting), true
+}
+
+// poll reports the stall the first time it sees it
+func (w *watchdog) poll(now time.Time) {
+	w.lock.Lock()
+	detail, stalled := w.statusLocked(now)
+	report := stalled && !w.reported
+	if report {
+		w.reported = true
+	}
+	w.lock.Unlock()
+
+	if !report {
+		return
+	}
+	logger.Errorf("Consensus %s, goroutine stacks:\n%s", detail, goroutineStacks())
+	if err := producer.Send(producer.CreateAlertEvent("consensus", detail)); err != nil {
+		logger.Warningf("Could not send alert event: %s", err)
+	}
+}
+
+// goroutineStacks returns the stacks of every goroutine of the process
+func goroutineStacks() []byte {
+	buf := make([]byte, 1<<16)
+	for {
+		n := runtime.Stack(buf, true)
+		if n < len(buf) {
+			return buf[:n]
+		}
+		buf = make([]byte, 2*len(buf))
+	}
+}
@@ -0,0 +1,56 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package helper
+
+import (
+	"testing"
+	"time"
+)
+
+func TestWatchdogStall(t *testing.T) {
+	w := newWatchdog(time.Minute)
+	now := time.Now()
+	if _, stalled := w.status(now.Add(time.Hour)); stalled {
+		t.Errorf("Expected an idle handshake not to stall")
+	}
+
+	w.wait("the executor to execute the transactions")
+	if _, stalled := w.status(now.Add(time.Second)); stalled {
+		t.Errorf("Expected the handshake not to stall before the timeout")
+	}
+	if detail, stalled := w.status(now.Add(time.Hour)); !stalled || detail == "" {
+		t.Errorf("Expected the handshake to stall after the timeout")
+	}
+
+	w.poll(now.Add(time.Hour))
+	if !w.reported {
+		t.Errorf("Expected the stall to be reported")
+	}
+
+	w.idle()
+	if _, stalled := w.status(now.Add(time.Hour)); stalled || w.reported {
+		t.Errorf("Expected the stall to clear once the handshake completes")
+	}
+}
+
+func TestWatchdogDisabled(t *testing.T) {
+	w := newWatchdog(0)
+	w.wait("the executor to execute the transactions")
+	if _, stalled := w.status(time.Now().Add(time.Hour)); stalled {
+		t.Errorf("Expected a disabled watchdog never to report a stall")
+	}
+}
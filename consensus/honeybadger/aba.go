@@ -0,0 +1,282 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package honeybadger
+
+import (
+	"io"
+)
+
+// maxFutureRounds bounds how many rounds ahead of ours we keep messages for,
+// agreement rarely takes more than a few rounds
+const maxFutureRounds = 32
+
+// binaryAgreement is the binary agreement of Mostefaoui, Moumen and Raynal
+// with a threshold common coin, as in HoneyBadgerBFT.  In every round the
+// replicas broadcast their estimate, relay a value f+1 replicas sent, and
+// accept a value 2f+1 replicas sent.  They then broadcast one accepted value,
+// and once n-f replicas did so with accepted values, they toss the coin.  If
+// all those values agree and match the coin, the replicas decide on it,
+// otherwise they carry a value over to the next round.  Deciding replicas
+// announce their decision, f+1 announcements decide the others, and a
+// replica keeps taking part in the rounds until 2f+1 did so.
+type binaryAgreement struct {
+	instance uint64 // the proposer this agreement is about
+	epoch    uint64
+	n, f     int
+	keys     *keyShare
+	rnd      io.Reader
+	send     func(msg *Message) // broadcasts a message of the epoch
+
+	hasInput bool
+	est      bool
+	round    uint64
+	rounds   map[uint64]*abaRound
+
+	decided  bool
+	decision bool
+	termSent bool
+	terms    map[uint64]bool // decisions announced, by replica
+	halted   bool
+}
+
+// abaRound holds the messages of a round of binary agreement
+type abaRound struct {
+	bvalSent  [2]bool
+	bvals     [2]map[uint64]bool // senders of each value
+	binValues [2]bool            // values 2f+1 replicas sent
+	auxSent   bool
+	aux       map[uint64]bool // the value each replica accepted first
+	coinSent  bool
+	coins     map[uint64]point // verified coin shares, by replica
+	coinKnown bool
+	coin      bool
+}
+
+func newBinaryAgreement(instance, epoch uint64, n, f int, keys *keyShare, rnd io.Reader, send func(msg *Message)) *binaryAgreement {
+	return &binaryAgreement{
+		instance: instance,
+		epoch:    epoch,
+		n:        n,
+		f:        f,
+		keys:     keys,
+		rnd:      rnd,
+		send:     send,
+		rounds:   make(map[uint64]*abaRound),
+		terms:    make(map[uint64]bool),
+	}
+}
+
+func bit(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+func (ba *binaryAgreement) getRound(r uint64) *abaRound {
+	rd, ok := ba.rounds[r]
+	if !ok {
+		rd = &abaRound{
+			bvals: [2]map[uint64]bool{make(map[uint64]bool), make(map[uint64]bool)},
+			aux:   make(map[uint64]bool),
+			coins: make(map[uint64]point),
+		}
+		ba.rounds[r] = rd
+	}
+	return rd
+}
+
+// accepts returns whether messages of round r are kept
+func (ba *binaryAgreement) accepts(r uint64) bool {
+	return !ba.halted && r <= ba.round+maxFutureRounds
+}
+
+// input starts the agreement with the value of this replica
+func (ba *binaryAgreement) input(value bool) {
+	if ba.hasInput {
+		return
+	}
+	ba.hasInput = true
+	ba.est = value
+	ba.step()
+}
+
+func (ba *binaryAgreement) sendBval(r uint64, value bool) {
+	rd := ba.getRound(r)
+	if rd.bvalSent[bit(value)] {
+		return
+	}
+	rd.bvalSent[bit(value)] = true
+	ba.send(&Message{Payload: &Message_Bval{Bval: &Bval{Instance: ba.instance, Round: r, Value: value}}})
+}
+
+func (ba *binaryAgreement) recvBval(sender uint64, bval *Bval) {
+	if !ba.accepts(bval.Round) {
+		return
+	}
+	rd := ba.getRound(bval.Round)
+	rd.bvals[bit(bval.Value)][sender] = true
+	// relay the value in any round, replicas behind us may depend on it
+	if ba.hasInput && bval.Round <= ba.round && len(rd.bvals[bit(bval.Value)]) >= ba.f+1 {
+		ba.sendBval(bval.Round, bval.Value)
+	}
+	ba.step()
+}
+
+func (ba *binaryAgreement) recvAux(sender uint64, aux *Aux) {
+	if !ba.accepts(aux.Round) {
+		return
+	}
+	rd := ba.getRound(aux.Round)
+	if _, ok := rd.aux[sender]; ok {
+		return
+	}
+	rd.aux[sender] = aux.Value
+	ba.step()
+}
+
+func (ba *binaryAgreement) recvCoinShare(sender uint64, cs *CoinShare) {
+	if !ba.accepts(cs.Round) {
+		return
+	}
+	rd := ba.getRound(cs.Round)
+	if _, ok := rd.coins[sender]; ok || rd.coinKnown {
+		return
+	}
+	share, err := ba.keys.public.verifyShare(sender, coinPoint(ba.epoch, ba.instance, cs.Round), cs.Share, cs.Proof)
+	if err != nil {
+		logger.Warningf("Replica %d sent an invalid coin share for epoch %d, instance %d, round %d: %s", sender, ba.epoch, ba.instance, cs.Round, err)
+		return
+	}
+	rd.coins[sender] = share
+	ba.step()
+}
+
+func (ba *binaryAgreement) recvTerm(sender uint64, term *Term) {
+	if _, ok := ba.terms[sender]; ok {
+		return
+	}
+	ba.terms[sender] = term.Value
+	count := 0
+	for _, value := range ba.terms {
+		if value == term.Value {
+			count++
+		}
+	}
+	if count >= ba.f+1 {
+		// a correct replica decided on it
+		ba.decide(term.Value)
+	}
+	if count >= 2*ba.f+1 {
+		// f+1 correct replicas announced it, everybody learns of it
+		ba.halted = true
+	}
+}
+
+func (ba *binaryAgreement) decide(value bool) {
+	if !ba.decided {
+		ba.decided = true
+		ba.decision = value
+	}
+	if !ba.termSent {
+		ba.termSent = true
+		ba.send(&Message{Payload: &Message_Term{Term: &Term{Instance: ba.instance, Value: value}}})
+	}
+}
+
+// step advances through the rounds as far as the messages received allow
+func (ba *binaryAgreement) step() {
+	for ba.hasInput && !ba.halted {
+		rd := ba.getRound(ba.round)
+		ba.sendBval(ba.round, ba.est)
+		for _, value := range []bool{false, true} {
+			count := len(rd.bvals[bit(value)])
+			if count >= ba.f+1 {
+				ba.sendBval(ba.round, value)
+			}
+			if count >= 2*ba.f+1 {
+				rd.binValues[bit(value)] = true
+			}
+		}
+		if !rd.binValues[0] && !rd.binValues[1] {
+			return
+		}
+		if !rd.auxSent {
+			rd.auxSent = true
+			value := ba.est
+			if !rd.binValues[bit(value)] {
+				value = !value
+			}
+			ba.send(&Message{Payload: &Message_Aux{Aux: &Aux{Instance: ba.instance, Round: ba.round, Value: value}}})
+		}
+
+		// wait for n-f replicas to accept values we accepted too
+		var vals [2]bool
+		count := 0
+		for _, value := range rd.aux {
+			if rd.binValues[bit(value)] {
+				vals[bit(value)] = true
+				count++
+			}
+		}
+		if count < ba.n-ba.f {
+			return
+		}
+
+		if !ba.tossCoin(rd) {
+			return
+		}
+		if vals[0] != vals[1] {
+			ba.est = vals[1]
+			if ba.est == rd.coin {
+				ba.decide(ba.est)
+			}
+		} else {
+			ba.est = rd.coin
+		}
+		ba.round++
+	}
+}
+
+// tossCoin contributes our share of the coin of the round, and returns
+// whether the coin is known
+func (ba *binaryAgreement) tossCoin(rd *abaRound) bool {
+	if !rd.coinSent {
+		rd.coinSent = true
+		share, proof, err := ba.keys.coinShare(coinPoint(ba.epoch, ba.instance, ba.round), ba.rnd)
+		if err != nil {
+			logger.Errorf("Replica %d could not compute its coin share: %s", ba.keys.id, err)
+		} else {
+			ba.send(&Message{Payload: &Message_CoinShare{CoinShare: &CoinShare{Instance: ba.instance, Round: ba.round, Share: share, Proof: proof}}})
+		}
+	}
+	if rd.coinKnown {
+		return true
+	}
+	if len(rd.coins) < ba.f+1 {
+		return false
+	}
+	coin, err := ba.keys.public.coin(rd.coins)
+	if err != nil {
+		logger.Errorf("Replica %d could not combine the coin of epoch %d, instance %d, round %d: %s", ba.keys.id, ba.epoch, ba.instance, ba.round, err)
+		return false
+	}
+	rd.coinKnown = true
+	rd.coin = coin
+	rd.coins = nil
+	return true
+}
@@ -0,0 +1,305 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package honeybadger
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/golang/protobuf/proto"
+)
+
+// epoch orders the proposals of the replicas for one epoch.  Every replica
+// reliably broadcasts its encrypted proposal, and a binary agreement per
+// replica decides whether its proposal is part of the common subset.  A
+// replica votes for the proposals it delivered, and once n-f proposals were
+// agreed on it votes against the ones it has not delivered yet, so that the
+// subset holds n-f proposals at least.  Only then are the proposals of the
+// subset decrypted: until the subset is fixed, a faulty replica cannot tell
+// which transactions it would exclude.
+type epoch struct {
+	number uint64
+	n, f   int
+	keys   *keyShare
+	rnd    io.Reader
+	send   func(msg *Message) // broadcasts a message of this epoch
+
+	started  bool // a replica sent us a message of this epoch
+	proposed bool // we proposed
+	rbc      []*reliableBroadcast
+	aba      []*binaryAgreement
+
+	subset      map[uint64]*Ciphertext                 // proposals of the common subset, nil for those which do not parse
+	shares      map[uint64]map[uint64]*DecryptionShare // decryption shares yet to verify, by proposer and replica
+	valid       map[uint64]map[uint64]point            // verified decryption shares, by proposer and replica
+	decrypted   map[uint64][][]byte                    // requests of the decrypted proposals, nil if decryption failed
+	outputReady bool
+}
+
+func newEpoch(number uint64, n, f int, keys *keyShare, rnd io.Reader, send func(msg *Message)) *epoch {
+	ep := &epoch{
+		number:    number,
+		n:         n,
+		f:         f,
+		keys:      keys,
+		rnd:       rnd,
+		send:      send,
+		shares:    make(map[uint64]map[uint64]*DecryptionShare),
+		valid:     make(map[uint64]map[uint64]point),
+		decrypted: make(map[uint64][][]byte),
+	}
+	for id := 0; id < n; id++ {
+		ep.rbc = append(ep.rbc, newReliableBroadcast(uint64(id), n, f, send))
+		ep.aba = append(ep.aba, newBinaryAgreement(uint64(id), number, n, f, keys, rnd, send))
+	}
+	return ep
+}
+
+// propose encrypts the requests of this replica and broadcasts them
+func (ep *epoch) propose(requests [][]byte) error {
+	ep.proposed = true
+	plaintext, err := proto.Marshal(&Batch{Epoch: ep.number, Requests: requests})
+	if err != nil {
+		return err
+	}
+	ct, err := ep.keys.public.encrypt(plaintext, ep.rnd)
+	if err != nil {
+		return err
+	}
+	payload, err := proto.Marshal(ct)
+	if err != nil {
+		return err
+	}
+	ep.rbc[ep.keys.id].propose(payload)
+	ep.progress()
+	return nil
+}
+
+// recv processes a message of this epoch
+func (ep *epoch) recv(sender uint64, msg *Message) {
+	if sender != ep.keys.id {
+		ep.started = true
+	}
+	switch m := msg.Payload.(type) {
+	case *Message_Val:
+		if rb := ep.broadcastOf(m.Val.Proposer); rb != nil {
+			rb.recvVal(sender, m.Val)
+		}
+	case *Message_Echo:
+		if rb := ep.broadcastOf(m.Echo.Proposer); rb != nil {
+			rb.recvEcho(sender, m.Echo)
+		}
+	case *Message_Ready:
+		if rb := ep.broadcastOf(m.Ready.Proposer); rb != nil {
+			rb.recvReady(sender, m.Ready)
+		}
+	case *Message_Bval:
+		if ba := ep.agreementOn(m.Bval.Instance); ba != nil {
+			ba.recvBval(sender, m.Bval)
+		}
+	case *Message_Aux:
+		if ba := ep.agreementOn(m.Aux.Instance); ba != nil {
+			ba.recvAux(sender, m.Aux)
+		}
+	case *Message_Term:
+		if ba := ep.agreementOn(m.Term.Instance); ba != nil {
+			ba.recvTerm(sender, m.Term)
+		}
+	case *Message_CoinShare:
+		if ba := ep.agreementOn(m.CoinShare.Instance); ba != nil {
+			ba.recvCoinShare(sender, m.CoinShare)
+		}
+	case *Message_DecryptionShare:
+		ep.recvDecryptionShare(sender, m.DecryptionShare)
+	default:
+		logger.Warningf("Replica %d sent an unexpected message for epoch %d: %v", sender, ep.number, msg)
+	}
+	ep.progress()
+}
+
+func (ep *epoch) broadcastOf(proposer uint64) *reliableBroadcast {
+	if proposer >= uint64(ep.n) {
+		return nil
+	}
+	return ep.rbc[proposer]
+}
+
+func (ep *epoch) agreementOn(instance uint64) *binaryAgreement {
+	if instance >= uint64(ep.n) {
+		return nil
+	}
+	return ep.aba[instance]
+}
+
+// progress feeds the outputs of the broadcasts into the agreements, and the
+// outputs of the agreements into the decryption of the subset
+func (ep *epoch) progress() {
+	for id, rb := range ep.rbc {
+		if rb.delivered {
+			ep.aba[id].input(true)
+		}
+	}
+
+	ones := 0
+	for _, ba := range ep.aba {
+		if ba.decided && ba.decision {
+			ones++
+		}
+	}
+	if ones >= ep.n-ep.f {
+		for _, ba := range ep.aba {
+			ba.input(false)
+		}
+	}
+
+	if ep.subset == nil {
+		subset := make(map[uint64]*Ciphertext)
+		for id, ba := range ep.aba {
+			if !ba.decided {
+				return
+			}
+			if !ba.decision {
+				continue
+			}
+			// a correct replica delivered it, so we eventually do too
+			if !ep.rbc[id].delivered {
+				return
+			}
+			ct := &Ciphertext{}
+			if err := proto.Unmarshal(ep.rbc[id].output, ct); err != nil {
+				logger.Warningf("Replica %d proposed a malformed ciphertext in epoch %d: %s", id, ep.number, err)
+				ct = nil
+			}
+			subset[uint64(id)] = ct
+		}
+		ep.subset = subset
+		ep.sendDecryptionShares()
+	}
+
+	ep.decrypt()
+}
+
+func (ep *epoch) sendDecryptionShares() {
+	for proposer, ct := range ep.subset {
+		if ct == nil {
+			continue
+		}
+		share, proof, err := ep.keys.decryptionShare(ct, ep.rnd)
+		if err != nil {
+			logger.Warningf("Replica %d cannot decrypt the proposal of replica %d in epoch %d: %s", ep.keys.id, proposer, ep.number, err)
+			continue
+		}
+		ep.send(&Message{Payload: &Message_DecryptionShare{DecryptionShare: &DecryptionShare{Proposer: proposer, Share: share, Proof: proof}}})
+	}
+}
+
+func (ep *epoch) recvDecryptionShare(sender uint64, ds *DecryptionShare) {
+	if ds.Proposer >= uint64(ep.n) {
+		return
+	}
+	if _, ok := ep.decrypted[ds.Proposer]; ok {
+		return
+	}
+	if ep.shares[ds.Proposer] == nil {
+		ep.shares[ds.Proposer] = make(map[uint64]*DecryptionShare)
+	}
+	if _, ok := ep.valid[ds.Proposer][sender]; ok {
+		return
+	}
+	if _, ok := ep.shares[ds.Proposer][sender]; !ok {
+		// verified once the ciphertext is known
+		ep.shares[ds.Proposer][sender] = ds
+	}
+}
+
+// decrypt decrypts the proposals of the subset for which f+1 valid shares
+// arrived
+func (ep *epoch) decrypt() {
+	if ep.subset == nil || ep.outputReady {
+		return
+	}
+	for proposer, ct := range ep.subset {
+		if _, ok := ep.decrypted[proposer]; ok {
+			continue
+		}
+		if ct == nil {
+			ep.decrypted[proposer] = nil
+			continue
+		}
+		valid := ep.valid[proposer]
+		if valid == nil {
+			valid = make(map[uint64]point)
+			ep.valid[proposer] = valid
+		}
+		for sender, ds := range ep.shares[proposer] {
+			delete(ep.shares[proposer], sender)
+			share, err := ep.keys.public.verifyDecryptionShare(sender, ct, ds.Share, ds.Proof)
+			if err != nil {
+				logger.Warningf("Replica %d sent an invalid decryption share for the proposal of replica %d in epoch %d: %s", sender, proposer, ep.number, err)
+				continue
+			}
+			valid[sender] = share
+		}
+		if len(valid) < ep.f+1 {
+			continue
+		}
+		plaintext, err := ep.keys.public.decrypt(ct, valid)
+		batch := &Batch{}
+		if err == nil {
+			err = proto.Unmarshal(plaintext, batch)
+		}
+		if err == nil && batch.Epoch != ep.number {
+			err = fmt.Errorf("it is the proposal for epoch %d", batch.Epoch)
+		}
+		if err != nil {
+			// every correct replica fails alike, the proposal is empty
+			logger.Warningf("Replica %d proposed an undecryptable batch in epoch %d: %s", proposer, ep.number, err)
+			ep.decrypted[proposer] = nil
+		} else {
+			ep.decrypted[proposer] = batch.Requests
+		}
+		delete(ep.shares, proposer)
+		delete(ep.valid, proposer)
+	}
+	ep.outputReady = len(ep.decrypted) == len(ep.subset)
+}
+
+// output returns the requests of the epoch, ordered by proposer, once they
+// are decrypted
+func (ep *epoch) output() [][][]byte {
+	if !ep.outputReady {
+		return nil
+	}
+	var proposals [][][]byte
+	for id := uint64(0); id < uint64(ep.n); id++ {
+		if requests, ok := ep.decrypted[id]; ok {
+			proposals = append(proposals, requests)
+		}
+	}
+	return proposals
+}
+
+// halted returns whether every agreement of the epoch is over, so that no
+// replica depends on our messages any longer
+func (ep *epoch) halted() bool {
+	for _, ba := range ep.aba {
+		if !ba.halted {
+			return false
+		}
+	}
+	return true
+}
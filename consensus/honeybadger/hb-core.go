@@ -0,0 +1,349 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package honeybadger
+
+import (
+	"crypto/rand"
+	"fmt"
+	"io"
+	mrand "math/rand"
+	"time"
+
+	"github.com/hyperledger/fabric/consensus/util/events"
+	"github.com/spf13/viper"
+)
+
+// =============================================================================
+// init
+// =============================================================================
+
+// The replicas order the transactions in epochs.  In every epoch each
+// replica proposes a random selection of the transactions at the head of its
+// queue, encrypted so that f+1 replicas must cooperate to decrypt it, and the
+// replicas agree on a common subset of n-f proposals at least.  The subset is
+// decrypted, and the transactions of its proposals, ordered by proposer,
+// become the block of the epoch.  This is HoneyBadgerBFT of Miller et al.: no
+// step waits for a timeout, so ordering progresses at the pace of the
+// network however long its delays are, and it tolerates f < n/3 byzantine
+// replicas.  Encrypting the proposals keeps a faulty replica from censoring
+// transactions it learns of before the subset is fixed, and picking them at
+// random keeps the replicas from proposing the same ones.
+//
+// Every replica must run in every epoch.  A replica which restarts resumes
+// from the epoch after its last block, and acts as a faulty one in an epoch
+// it had taken part in before; a replica which falls more than the epoch
+// window behind cannot catch up, as state transfer is not supported yet.
+
+// =============================================================================
+// custom interfaces and structure definitions
+// =============================================================================
+
+type innerStack interface {
+	broadcast(msg *Message)
+	execute(batch *Batch)
+	getLastApplied() (*Metadata, error)
+}
+
+// hbMessageEvent is sent when a HoneyBadger message is received
+type hbMessageEvent struct {
+	msg    *Message
+	sender uint64
+}
+
+// requestEvent is sent when a client transaction is to be ordered
+type requestEvent []byte
+
+// appliedEvent is sent when the block of an epoch was committed
+type appliedEvent struct {
+	epoch uint64
+}
+
+type hbCore struct {
+	// internal data
+	id       uint64     // replica ID
+	n, f     int        // number of replicas, and of faulty ones tolerated
+	consumer innerStack // execution and messaging
+	keys     *keyShare  // our share of the threshold keys, and the public keys
+	rnd      io.Reader  // randomness of the threshold schemes
+	selector *mrand.Rand
+
+	current uint64            // epoch whose output comes next
+	epochs  map[uint64]*epoch // epochs still running, current ones and those others may depend on
+	inbox   []hbMessageEvent  // our own messages, yet to process
+
+	queue   [][]byte          // requests not ordered yet, in the order received
+	queued  map[string]bool   // digests of the queued requests
+	ordered map[string]uint64 // digests of the requests ordered in recent epochs, by epoch
+
+	pending     []*Batch // ordered batches yet to execute
+	applying    bool     // whether a batch is being executed
+	lastApplied uint64   // epoch of the last block committed
+
+	// configuration
+	batchSize int
+	window    uint64
+}
+
+// =============================================================================
+// constructors
+// =============================================================================
+
+func newHbCore(id uint64, config *viper.Viper, consumer innerStack) *hbCore {
+	instance := &hbCore{}
+	instance.id = id
+	instance.consumer = consumer
+	instance.rnd = rand.Reader
+	instance.selector = mrand.New(mrand.NewSource(time.Now().UnixNano() + int64(id)))
+
+	instance.n = config.GetInt("general.N")
+	instance.f = (instance.n - 1) / 3
+	if instance.n < 1 || id >= uint64(instance.n) {
+		panic(fmt.Errorf("Replica %d is not among the %d replicas", id, instance.n))
+	}
+	instance.batchSize = config.GetInt("general.batchsize")
+	if instance.batchSize < 1 {
+		instance.batchSize = 1
+	}
+	instance.window = uint64(config.GetInt("general.epochwindow"))
+	if instance.window < 1 {
+		instance.window = 1
+	}
+	keys, err := loadKeyShare(id, instance.n, instance.f, config)
+	if err != nil {
+		panic(fmt.Errorf("Cannot load the key share of replica %d: %s", id, err))
+	}
+	instance.keys = keys
+
+	instance.epochs = make(map[uint64]*epoch)
+	instance.queued = make(map[string]bool)
+	instance.ordered = make(map[string]uint64)
+
+	logger.Infof("HoneyBadger replica %d of N = %d, tolerating f = %d", instance.id, instance.n, instance.f)
+	logger.Infof("HoneyBadger batch size = %d", instance.batchSize)
+	logger.Infof("HoneyBadger epoch window = %d", instance.window)
+
+	meta, err := consumer.getLastApplied()
+	if err != nil {
+		logger.Warningf("Replica %d could not read the epoch of its last block, starting from the first: %s", instance.id, err)
+		meta = &Metadata{}
+	}
+	instance.lastApplied = meta.Epoch
+	instance.current = meta.Epoch + 1
+	logger.Infof("Replica %d resuming at epoch %d", instance.id, instance.current)
+
+	return instance
+}
+
+// =============================================================================
+// receive methods
+// =============================================================================
+
+// ProcessEvent handles an event, and processes our own messages it leads to
+func (instance *hbCore) ProcessEvent(e events.Event) events.Event {
+	switch et := e.(type) {
+	case hbMessageEvent:
+		instance.recvMessage(et.sender, et.msg)
+	case requestEvent:
+		instance.recvRequest(et, true)
+	case appliedEvent:
+		instance.applied(et.epoch)
+	default:
+		logger.Warningf("Replica %d received an unknown event type %T", instance.id, et)
+		return nil
+	}
+
+	for {
+		for len(instance.inbox) > 0 {
+			next := instance.inbox[0]
+			instance.inbox = instance.inbox[1:]
+			instance.recvMessage(next.sender, next.msg)
+		}
+		if !instance.advance() && len(instance.inbox) == 0 {
+			return nil
+		}
+	}
+}
+
+func (instance *hbCore) recvMessage(sender uint64, msg *Message) {
+	if sender >= uint64(instance.n) {
+		logger.Warningf("Replica %d received a message from unknown replica %d", instance.id, sender)
+		return
+	}
+	if req := msg.GetRequest(); req != nil {
+		instance.recvRequest(req, false)
+		return
+	}
+	if msg.Epoch+instance.window < instance.current || msg.Epoch > instance.current+instance.window {
+		logger.Debugf("Replica %d dropping message of replica %d for epoch %d, outside of the window around epoch %d", instance.id, sender, msg.Epoch, instance.current)
+		return
+	}
+	ep, ok := instance.epochs[msg.Epoch]
+	if !ok {
+		if msg.Epoch < instance.current {
+			logger.Debugf("Replica %d dropping message of replica %d for epoch %d, which is over", instance.id, sender, msg.Epoch)
+			return
+		}
+		ep = instance.getEpoch(msg.Epoch)
+	}
+	ep.recv(sender, msg)
+}
+
+// recvRequest queues a request, and forwards it to the other replicas if a
+// client submitted it to us
+func (instance *hbCore) recvRequest(req []byte, forward bool) {
+	digest := payloadDigest(req)
+	if _, ok := instance.ordered[digest]; ok || instance.queued[digest] {
+		logger.Debugf("Replica %d ignoring request it already has", instance.id)
+		return
+	}
+	instance.queued[digest] = true
+	instance.queue = append(instance.queue, req)
+	if forward {
+		instance.consumer.broadcast(&Message{Payload: &Message_Request{Request: req}})
+	}
+}
+
+func (instance *hbCore) applied(epoch uint64) {
+	if len(instance.pending) == 0 || instance.pending[0].Epoch != epoch {
+		logger.Warningf("Replica %d committed epoch %d, which it did not execute", instance.id, epoch)
+		return
+	}
+	logger.Debugf("Replica %d committed the block of epoch %d", instance.id, epoch)
+	instance.pending = instance.pending[1:]
+	instance.applying = false
+	instance.lastApplied = epoch
+	instance.maybeApply()
+}
+
+// =============================================================================
+// epochs
+// =============================================================================
+
+func (instance *hbCore) getEpoch(number uint64) *epoch {
+	ep, ok := instance.epochs[number]
+	if !ok {
+		ep = newEpoch(number, instance.n, instance.f, instance.keys, instance.rnd, func(msg *Message) {
+			msg.Epoch = number
+			instance.consumer.broadcast(msg)
+			instance.inbox = append(instance.inbox, hbMessageEvent{msg: msg, sender: instance.id})
+		})
+		instance.epochs[number] = ep
+	}
+	return ep
+}
+
+// advance proposes in the current epoch once there is something to order or
+// other replicas started it, and outputs it once it is decrypted.  It
+// returns whether it did either.
+func (instance *hbCore) advance() bool {
+	ep := instance.getEpoch(instance.current)
+	if !ep.proposed && (len(instance.queue) > 0 || ep.started) {
+		requests := instance.selectRequests()
+		logger.Debugf("Replica %d proposing %d requests in epoch %d", instance.id, len(requests), instance.current)
+		if err := ep.propose(requests); err != nil {
+			logger.Errorf("Replica %d could not propose in epoch %d: %s", instance.id, instance.current, err)
+		}
+		return true
+	}
+
+	proposals := ep.output()
+	if proposals == nil {
+		return false
+	}
+	instance.deliver(instance.current, proposals)
+	instance.current++
+	instance.collectGarbage()
+	return true
+}
+
+// selectRequests picks batchsize/N requests at random among the batchsize
+// at the head of the queue
+func (instance *hbCore) selectRequests() [][]byte {
+	head := instance.queue
+	if len(head) > instance.batchSize {
+		head = head[:instance.batchSize]
+	}
+	count := instance.batchSize / instance.n
+	if count < 1 {
+		count = 1
+	}
+	if count > len(head) {
+		count = len(head)
+	}
+	var requests [][]byte
+	for _, i := range instance.selector.Perm(len(head))[:count] {
+		requests = append(requests, head[i])
+	}
+	return requests
+}
+
+// deliver orders the requests of the proposals of an epoch, dropping those
+// which were already ordered
+func (instance *hbCore) deliver(number uint64, proposals [][][]byte) {
+	batch := &Batch{Epoch: number}
+	for _, requests := range proposals {
+		for _, req := range requests {
+			digest := payloadDigest(req)
+			if _, ok := instance.ordered[digest]; ok {
+				continue
+			}
+			instance.ordered[digest] = number
+			batch.Requests = append(batch.Requests, req)
+		}
+	}
+	logger.Infof("Replica %d ordered %d requests of %d proposals in epoch %d", instance.id, len(batch.Requests), len(proposals), number)
+
+	if len(batch.Requests) > 0 {
+		var queue [][]byte
+		for _, req := range instance.queue {
+			digest := payloadDigest(req)
+			if _, ok := instance.ordered[digest]; ok {
+				delete(instance.queued, digest)
+				continue
+			}
+			queue = append(queue, req)
+		}
+		instance.queue = queue
+		instance.pending = append(instance.pending, batch)
+		instance.maybeApply()
+	}
+}
+
+// collectGarbage drops the epochs no replica depends on any longer, and
+// those which fell out of the window
+func (instance *hbCore) collectGarbage() {
+	for number, ep := range instance.epochs {
+		if number < instance.current && (ep.halted() || number+instance.window < instance.current) {
+			delete(instance.epochs, number)
+		}
+	}
+	for digest, number := range instance.ordered {
+		if number+instance.window < instance.current {
+			delete(instance.ordered, digest)
+		}
+	}
+}
+
+func (instance *hbCore) maybeApply() {
+	if instance.applying || len(instance.pending) == 0 {
+		return
+	}
+	instance.applying = true
+	batch := instance.pending[0]
+	logger.Debugf("Replica %d executing the block of epoch %d", instance.id, batch.Epoch)
+	instance.consumer.execute(batch)
+}
@@ -0,0 +1,170 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package honeybadger
+
+import (
+	"math/rand"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+// checkLedgers checks that every running replica committed the same
+// transactions, each of the expected ones once
+func checkLedgers(t *testing.T, net *testNetwork, expected int) {
+	var first []string
+	for id := uint64(0); id < uint64(len(net.replicas)); id++ {
+		r := net.replicas[id]
+		if r.down {
+			continue
+		}
+		ids := r.txIDs()
+		if first == nil {
+			first = ids
+			sorted := append([]string(nil), ids...)
+			sort.Strings(sorted)
+			for i := 1; i < len(sorted); i++ {
+				if sorted[i] == sorted[i-1] {
+					t.Errorf("Replica %d committed %s twice", id, sorted[i])
+				}
+			}
+			if len(ids) != expected {
+				t.Errorf("Replica %d committed %d transactions, expected %d: %v", id, len(ids), expected, ids)
+			}
+			continue
+		}
+		if !reflect.DeepEqual(ids, first) {
+			t.Errorf("Replica %d committed %v, others %v", id, ids, first)
+		}
+	}
+}
+
+func TestNetworkOrder(t *testing.T) {
+	net := newTestNetwork(4, loadTestConfig())
+	for tag := 0; tag < 10; tag++ {
+		net.submit(uint64(tag%4), tag)
+	}
+	net.process()
+
+	checkLedgers(t, net, 10)
+	for _, r := range net.replicas {
+		if len(r.hb.queue) != 0 {
+			t.Errorf("Replica %d still has %d requests queued", r.id, len(r.hb.queue))
+		}
+		if r.hb.lastApplied != uint64(len(r.ledger)) {
+			t.Errorf("Replica %d committed up to epoch %d, but has %d blocks", r.id, r.hb.lastApplied, len(r.ledger))
+		}
+	}
+}
+
+func TestNetworkRandomDelivery(t *testing.T) {
+	for seed := int64(0); seed < 5; seed++ {
+		net := newTestNetwork(4, loadTestConfig())
+		net.random = rand.New(rand.NewSource(seed))
+		for tag := 0; tag < 8; tag++ {
+			net.submit(uint64(tag%4), tag)
+		}
+		net.process()
+		checkLedgers(t, net, 8)
+	}
+}
+
+func TestNetworkDuplicateRequest(t *testing.T) {
+	net := newTestNetwork(4, loadTestConfig())
+	net.submit(0, 1)
+	net.submit(2, 1)
+	net.process()
+	net.submit(3, 1)
+	net.process()
+
+	checkLedgers(t, net, 1)
+}
+
+func TestNetworkToleratesSilentReplica(t *testing.T) {
+	net := newTestNetwork(4, loadTestConfig())
+	net.random = rand.New(rand.NewSource(1))
+	net.replicas[3].down = true
+	for tag := 0; tag < 6; tag++ {
+		net.submit(uint64(tag%3), tag)
+	}
+	net.process()
+
+	checkLedgers(t, net, 6)
+}
+
+func TestNetworkToleratesInvalidShares(t *testing.T) {
+	net := newTestNetwork(4, loadTestConfig())
+	// replica 3 corrupts every coin and decryption share it sends
+	net.filterFn = func(src, dst uint64, msg *Message) *Message {
+		if src != 3 {
+			return msg
+		}
+		switch m := msg.Payload.(type) {
+		case *Message_CoinShare:
+			return &Message{Epoch: msg.Epoch, Payload: &Message_CoinShare{CoinShare: &CoinShare{Instance: m.CoinShare.Instance, Round: m.CoinShare.Round, Share: m.CoinShare.Share, Proof: make([]byte, 2*scalarSize)}}}
+		case *Message_DecryptionShare:
+			return &Message{Epoch: msg.Epoch, Payload: &Message_DecryptionShare{DecryptionShare: &DecryptionShare{Proposer: m.DecryptionShare.Proposer, Share: net.replicas[0].hb.keys.public.master.bytes(), Proof: m.DecryptionShare.Proof}}}
+		}
+		return msg
+	}
+	for tag := 0; tag < 6; tag++ {
+		net.submit(uint64(tag%4), tag)
+	}
+	net.process()
+
+	checkLedgers(t, net, 6)
+}
+
+func TestNetworkEquivocatingProposer(t *testing.T) {
+	net := newTestNetwork(4, loadTestConfig())
+	// replica 3 proposes a different payload to replica 0
+	net.filterFn = func(src, dst uint64, msg *Message) *Message {
+		if val := msg.GetVal(); val != nil && src == 3 && dst == 0 {
+			return &Message{Epoch: msg.Epoch, Payload: &Message_Val{Val: &Val{Proposer: 3, Payload: []byte("garbage")}}}
+		}
+		return msg
+	}
+	for tag := 0; tag < 6; tag++ {
+		net.submit(uint64(tag%4), tag)
+	}
+	net.process()
+
+	checkLedgers(t, net, 6)
+}
+
+func TestResumeAfterLastBlock(t *testing.T) {
+	r := &testReplica{id: 1, meta: &Metadata{Epoch: 5}}
+	config := loadTestConfig()
+	config.Set("general.N", 4)
+	hb := newHbCore(1, config, r)
+	if hb.current != 6 || hb.lastApplied != 5 {
+		t.Errorf("Expected to resume at epoch 6 after epoch 5, resumed at %d after %d", hb.current, hb.lastApplied)
+	}
+}
+
+func TestEpochWindow(t *testing.T) {
+	net := newTestNetwork(4, loadTestConfig())
+	hb := net.replicas[0].hb
+	hb.recvMessage(1, &Message{Epoch: hb.current + hb.window + 1, Payload: &Message_Bval{Bval: &Bval{}}})
+	if len(hb.epochs) != 0 {
+		t.Errorf("Expected a message beyond the epoch window to be dropped")
+	}
+	hb.recvMessage(1, &Message{Epoch: hb.current + 1, Payload: &Message_Bval{Bval: &Bval{}}})
+	if ep, ok := hb.epochs[hb.current+1]; !ok || !ep.started {
+		t.Errorf("Expected a message within the epoch window to start its epoch")
+	}
+}
@@ -0,0 +1,54 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package honeybadger
+
+import (
+	"fmt"
+
+	"github.com/hyperledger/fabric/consensus"
+	"github.com/hyperledger/fabric/consensus/util/events"
+)
+
+// Health reports the replica unhealthy if its main thread is stuck.  Having
+// no timeouts, HoneyBadger cannot tell a slow network from a stalled one.
+func (op *obcHoneyBadger) Health() consensus.Health {
+	var health consensus.Health
+	if !events.OnMainThread(op.manager, func() {
+		hc := op.hb
+		health.Healthy = true
+		health.Detail = fmt.Sprintf("in epoch %d, last committed %d, %d requests queued", hc.current, hc.lastApplied, len(hc.queue))
+	}) {
+		return consensus.Health{Detail: fmt.Sprintf("main thread unresponsive for %v", events.MainThreadTimeout)}
+	}
+	return health
+}
+
+// Metrics reports the progress of the replica
+func (op *obcHoneyBadger) Metrics() consensus.Metrics {
+	var metrics consensus.Metrics
+	events.OnMainThread(op.manager, func() {
+		hc := op.hb
+		metrics = consensus.Metrics{
+			"honeybadger.epoch":          float64(hc.current),
+			"honeybadger.lastApplied":    float64(hc.lastApplied),
+			"honeybadger.runningEpochs":  float64(len(hc.epochs)),
+			"honeybadger.queuedRequests": float64(len(hc.queue)),
+			"honeybadger.pendingBlocks":  float64(len(hc.pending)),
+		}
+	})
+	return metrics
+}
@@ -0,0 +1,232 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package honeybadger
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/op/go-logging"
+	"github.com/spf13/viper"
+
+	"github.com/hyperledger/fabric/consensus"
+	"github.com/hyperledger/fabric/consensus/util/events"
+	pb "github.com/hyperledger/fabric/protos"
+)
+
+const configPrefix = "CORE_HONEYBADGER"
+
+var logger *logging.Logger // package-level logger
+
+var pluginInstance consensus.Consenter // singleton service
+
+func init() {
+	logger = logging.MustGetLogger("consensus/honeybadger")
+}
+
+// GetPlugin returns the handle to the Consenter singleton
+func GetPlugin(c consensus.Stack) consensus.Consenter {
+	if pluginInstance == nil {
+		pluginInstance = New(c)
+	}
+	return pluginInstance
+}
+
+// New creates a new obcHoneyBadger instance that provides the Consenter
+// interface.  Internally, it uses an opaque hb-core instance.
+func New(stack consensus.Stack) consensus.Consenter {
+	handle, _, _ := stack.GetNetworkHandles()
+	id, err := getValidatorID(handle)
+	if err != nil {
+		panic(err)
+	}
+	return newObcHoneyBadger(id, loadConfig(), stack)
+}
+
+func loadConfig() (config *viper.Viper) {
+	config = viper.New()
+
+	// for environment variables
+	config.SetEnvPrefix(configPrefix)
+	config.AutomaticEnv()
+	replacer := strings.NewReplacer(".", "_")
+	config.SetEnvKeyReplacer(replacer)
+
+	config.SetConfigName("config")
+	config.AddConfigPath("./")
+	config.AddConfigPath("../consensus/honeybadger/")
+	config.AddConfigPath("../../consensus/honeybadger")
+	// Path to look for the config file in based on GOPATH
+	gopath := os.Getenv("GOPATH")
+	for _, p := range filepath.SplitList(gopath) {
+		hbpath := filepath.Join(p, "src/github.com/hyperledger/fabric/consensus/honeybadger")
+		config.AddConfigPath(hbpath)
+	}
+
+	err := config.ReadInConfig()
+	if err != nil {
+		panic(fmt.Errorf("Error reading %s plugin config: %s", configPrefix, err))
+	}
+	return
+}
+
+// Returns the uint64 ID corresponding to a peer handle
+func getValidatorID(handle *pb.PeerID) (id uint64, err error) {
+	if startsWith := strings.HasPrefix(handle.Name, "vp"); startsWith {
+		id, err = strconv.ParseUint(handle.Name[2:], 10, 64)
+		if err != nil {
+			return id, fmt.Errorf("Error extracting ID from \"%s\" handle: %v", handle.Name, err)
+		}
+		return
+	}
+
+	err = fmt.Errorf(`For HoneyBadger, set the VP's peer.id to vpX,
+		where X is a unique integer between 0 and N-1`)
+	return
+}
+
+// obcHoneyBadger connects an hb-core instance to the stack: it turns
+// messages and execution callbacks into events, and executes the ordered
+// batches as blocks
+type obcHoneyBadger struct {
+	stack   consensus.Stack
+	hb      *hbCore
+	manager events.Manager
+}
+
+// executedEvent is sent when the transactions of a batch were executed
+type executedEvent struct {
+	batch *Batch
+}
+
+func newObcHoneyBadger(id uint64, config *viper.Viper, stack consensus.Stack) *obcHoneyBadger {
+	op := &obcHoneyBadger{stack: stack}
+
+	op.manager = events.NewManagerImpl()
+	op.manager.SetReceiver(op)
+	op.hb = newHbCore(id, config, op)
+	op.manager.Start()
+
+	return op
+}
+
+// Close tells us to release resources we are holding
+func (op *obcHoneyBadger) Close() {
+	op.manager.Halt()
+}
+
+// RecvMsg is called by the stack when a new message is received
+func (op *obcHoneyBadger) RecvMsg(ocMsg *pb.Message, senderHandle *pb.PeerID) error {
+	switch ocMsg.Type {
+	case pb.Message_CHAIN_TRANSACTION:
+		op.manager.Queue() <- requestEvent(ocMsg.Payload)
+	case pb.Message_CONSENSUS:
+		senderID, err := getValidatorID(senderHandle)
+		if err != nil {
+			return err
+		}
+		msg := &Message{}
+		if err := proto.Unmarshal(ocMsg.Payload, msg); err != nil {
+			return fmt.Errorf("Error unmarshaling HoneyBadger message from replica %d: %s", senderID, err)
+		}
+		op.manager.Queue() <- hbMessageEvent{msg: msg, sender: senderID}
+	default:
+		return fmt.Errorf("Unexpected message type: %s", ocMsg.Type)
+	}
+	return nil
+}
+
+// Executed is called whenever Execute completes
+func (op *obcHoneyBadger) Executed(tag interface{}) {
+	op.manager.Queue() <- executedEvent{tag.(*Batch)}
+}
+
+// Committed is called whenever Commit completes
+func (op *obcHoneyBadger) Committed(tag interface{}, target *pb.BlockchainInfo) {
+	op.manager.Queue() <- appliedEvent{tag.(*Batch).Epoch}
+}
+
+// RolledBack is called whenever a Rollback completes, HoneyBadger never rolls back
+func (op *obcHoneyBadger) RolledBack(tag interface{}) {
+	logger.Warningf("Replica %d unexpectedly rolled back an execution", op.hb.id)
+}
+
+// StateUpdated is called when state transfer completes, HoneyBadger never
+// transfers state
+func (op *obcHoneyBadger) StateUpdated(tag interface{}, target *pb.BlockchainInfo) {
+	logger.Warningf("Replica %d unexpectedly transferred state", op.hb.id)
+}
+
+// ProcessEvent commits the executed batches, runs the work of other
+// threads, and passes any other event to the hb-core
+func (op *obcHoneyBadger) ProcessEvent(event events.Event) events.Event {
+	switch et := event.(type) {
+	case executedEvent:
+		meta, _ := proto.Marshal(&Metadata{Epoch: et.batch.Epoch})
+		op.stack.Commit(et.batch, meta)
+		return nil
+	case events.WorkEvent:
+		et()
+		return nil
+	}
+	return op.hb.ProcessEvent(event)
+}
+
+// =============================================================================
+// innerStack interface (functions called by hb-core)
+// =============================================================================
+
+func (op *obcHoneyBadger) broadcast(msg *Message) {
+	payload, err := proto.Marshal(msg)
+	if err != nil {
+		logger.Errorf("Replica %d could not marshal message: %s", op.hb.id, err)
+		return
+	}
+	op.stack.Broadcast(&pb.Message{Type: pb.Message_CONSENSUS, Payload: payload}, pb.PeerEndpoint_VALIDATOR)
+}
+
+// execute executes the transactions of a batch, the batch is committed as a
+// block once they executed
+func (op *obcHoneyBadger) execute(batch *Batch) {
+	var txs []*pb.Transaction
+	for _, req := range batch.Requests {
+		tx := &pb.Transaction{}
+		if err := proto.Unmarshal(req, tx); err != nil {
+			logger.Warningf("Replica %d could not unmarshal transaction: %s", op.hb.id, err)
+			continue
+		}
+		txs = append(txs, tx)
+	}
+	logger.Debugf("Replica %d executing epoch %d containing %d transactions", op.hb.id, batch.Epoch, len(txs))
+	op.stack.Execute(batch, txs)
+}
+
+func (op *obcHoneyBadger) getLastApplied() (*Metadata, error) {
+	raw, err := op.stack.GetBlockHeadMetadata()
+	if err != nil {
+		return nil, err
+	}
+	meta := &Metadata{}
+	if err := proto.Unmarshal(raw, meta); err != nil {
+		return nil, err
+	}
+	return meta, nil
+}
@@ -0,0 +1,113 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package honeybadger
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/spf13/viper"
+)
+
+// loadKeyShare reads the key share of replica id from the configured key
+// file, or derives it from the dealer seed if there is none
+func loadKeyShare(id uint64, n, f int, config *viper.Viper) (*keyShare, error) {
+	if file := config.GetString("general.keys.file"); file != "" {
+		raw, err := ioutil.ReadFile(file)
+		if err != nil {
+			return nil, fmt.Errorf("Cannot read key file %s: %s", file, err)
+		}
+		msg := &KeyShare{}
+		if err := proto.Unmarshal(raw, msg); err != nil {
+			return nil, fmt.Errorf("Cannot unmarshal key file %s: %s", file, err)
+		}
+		ks, err := unmarshalKeyShare(msg, f+1)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid key file %s: %s", file, err)
+		}
+		if ks.id != id || len(ks.public.shares) != n {
+			return nil, fmt.Errorf("Key file %s holds the share of replica %d of %d, expected replica %d of %d", file, ks.id, len(ks.public.shares), id, n)
+		}
+		return ks, nil
+	}
+
+	seed := config.GetString("general.keys.dealerseed")
+	if seed == "" {
+		return nil, fmt.Errorf("Neither a key file nor a dealer seed is configured")
+	}
+	logger.Warningf("Replica %d derives its key share from the dealer seed, every replica can decrypt the proposals on its own; deal key files outside of development", id)
+	if id >= uint64(n) {
+		return nil, fmt.Errorf("Replica %d is not among the %d replicas", id, n)
+	}
+	shares, err := dealKeys(n, f+1, newSeedReader(seed))
+	if err != nil {
+		return nil, err
+	}
+	return shares[id], nil
+}
+
+// DealKeyShares shares a new master secret among n replicas, and writes the
+// key file of each replica to dir, as vp<ID>.key.  Each key file must only
+// be given to its replica.
+func DealKeyShares(n int, dir string) error {
+	shares, err := dealKeys(n, (n-1)/3+1, rand.Reader)
+	if err != nil {
+		return err
+	}
+	for _, ks := range shares {
+		raw, err := proto.Marshal(ks.marshal())
+		if err != nil {
+			return err
+		}
+		if err := ioutil.WriteFile(filepath.Join(dir, fmt.Sprintf("vp%d.key", ks.id)), raw, 0600); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// seedReader is a deterministic stream of bytes derived from a seed
+type seedReader struct {
+	seed  []byte
+	ctr   uint64
+	block []byte
+}
+
+func newSeedReader(seed string) *seedReader {
+	return &seedReader{seed: []byte(seed)}
+}
+
+func (sr *seedReader) Read(p []byte) (int, error) {
+	for n := 0; n < len(p); {
+		if len(sr.block) == 0 {
+			h := sha256.New()
+			h.Write(sr.seed)
+			binary.Write(h, binary.BigEndian, sr.ctr)
+			sr.ctr++
+			sr.block = h.Sum(nil)
+		}
+		copied := copy(p[n:], sr.block)
+		sr.block = sr.block[copied:]
+		n += copied
+	}
+	return len(p), nil
+}
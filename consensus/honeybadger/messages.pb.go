@@ -0,0 +1,447 @@
+// Code generated by protoc-gen-go.
+// source: messages.proto
+// DO NOT EDIT!
+
+/*
+Package honeybadger is a generated protocol buffer package.
+
+It is generated from these files:
+	messages.proto
+
+It has these top-level messages:
+	Message
+	Val
+	Echo
+	Ready
+	Bval
+	Aux
+	Term
+	CoinShare
+	DecryptionShare
+	Ciphertext
+	Batch
+	Metadata
+	PublicKeys
+	KeyShare
+*/
+package honeybadger
+
+import proto "github.com/golang/protobuf/proto"
+import fmt "fmt"
+import math "math"
+
+// Reference imports to suppress errors if they are not otherwise used.
+var _ = proto.Marshal
+var _ = fmt.Errorf
+var _ = math.Inf
+
+type Message struct {
+	Epoch uint64 `protobuf:"varint,1,opt,name=epoch" json:"epoch,omitempty"`
+	// Types that are valid to be assigned to Payload:
+	//	*Message_Request
+	//	*Message_Val
+	//	*Message_Echo
+	//	*Message_Ready
+	//	*Message_Bval
+	//	*Message_Aux
+	//	*Message_Term
+	//	*Message_CoinShare
+	//	*Message_DecryptionShare
+	Payload isMessage_Payload `protobuf_oneof:"payload"`
+}
+
+func (m *Message) Reset()         { *m = Message{} }
+func (m *Message) String() string { return proto.CompactTextString(m) }
+func (*Message) ProtoMessage()    {}
+
+type isMessage_Payload interface {
+	isMessage_Payload()
+}
+
+type Message_Request struct {
+	Request []byte `protobuf:"bytes,2,opt,name=request,proto3,oneof"`
+}
+type Message_Val struct {
+	Val *Val `protobuf:"bytes,3,opt,name=val,oneof"`
+}
+type Message_Echo struct {
+	Echo *Echo `protobuf:"bytes,4,opt,name=echo,oneof"`
+}
+type Message_Ready struct {
+	Ready *Ready `protobuf:"bytes,5,opt,name=ready,oneof"`
+}
+type Message_Bval struct {
+	Bval *Bval `protobuf:"bytes,6,opt,name=bval,oneof"`
+}
+type Message_Aux struct {
+	Aux *Aux `protobuf:"bytes,7,opt,name=aux,oneof"`
+}
+type Message_Term struct {
+	Term *Term `protobuf:"bytes,8,opt,name=term,oneof"`
+}
+type Message_CoinShare struct {
+	CoinShare *CoinShare `protobuf:"bytes,9,opt,name=coin_share,oneof"`
+}
+type Message_DecryptionShare struct {
+	DecryptionShare *DecryptionShare `protobuf:"bytes,10,opt,name=decryption_share,oneof"`
+}
+
+func (*Message_Request) isMessage_Payload()         {}
+func (*Message_Val) isMessage_Payload()             {}
+func (*Message_Echo) isMessage_Payload()            {}
+func (*Message_Ready) isMessage_Payload()           {}
+func (*Message_Bval) isMessage_Payload()            {}
+func (*Message_Aux) isMessage_Payload()             {}
+func (*Message_Term) isMessage_Payload()            {}
+func (*Message_CoinShare) isMessage_Payload()       {}
+func (*Message_DecryptionShare) isMessage_Payload() {}
+
+func (m *Message) GetPayload() isMessage_Payload {
+	if m != nil {
+		return m.Payload
+	}
+	return nil
+}
+
+func (m *Message) GetRequest() []byte {
+	if x, ok := m.GetPayload().(*Message_Request); ok {
+		return x.Request
+	}
+	return nil
+}
+
+func (m *Message) GetVal() *Val {
+	if x, ok := m.GetPayload().(*Message_Val); ok {
+		return x.Val
+	}
+	return nil
+}
+
+func (m *Message) GetEcho() *Echo {
+	if x, ok := m.GetPayload().(*Message_Echo); ok {
+		return x.Echo
+	}
+	return nil
+}
+
+func (m *Message) GetReady() *Ready {
+	if x, ok := m.GetPayload().(*Message_Ready); ok {
+		return x.Ready
+	}
+	return nil
+}
+
+func (m *Message) GetBval() *Bval {
+	if x, ok := m.GetPayload().(*Message_Bval); ok {
+		return x.Bval
+	}
+	return nil
+}
+
+func (m *Message) GetAux() *Aux {
+	if x, ok := m.GetPayload().(*Message_Aux); ok {
+		return x.Aux
+	}
+	return nil
+}
+
+func (m *Message) GetTerm() *Term {
+	if x, ok := m.GetPayload().(*Message_Term); ok {
+		return x.Term
+	}
+	return nil
+}
+
+func (m *Message) GetCoinShare() *CoinShare {
+	if x, ok := m.GetPayload().(*Message_CoinShare); ok {
+		return x.CoinShare
+	}
+	return nil
+}
+
+func (m *Message) GetDecryptionShare() *DecryptionShare {
+	if x, ok := m.GetPayload().(*Message_DecryptionShare); ok {
+		return x.DecryptionShare
+	}
+	return nil
+}
+
+// XXX_OneofFuncs is for the internal use of the proto package.
+func (*Message) XXX_OneofFuncs() (func(msg proto.Message, b *proto.Buffer) error, func(msg proto.Message, tag, wire int, b *proto.Buffer) (bool, error), []interface{}) {
+	return _Message_OneofMarshaler, _Message_OneofUnmarshaler, []interface{}{
+		(*Message_Request)(nil),
+		(*Message_Val)(nil),
+		(*Message_Echo)(nil),
+		(*Message_Ready)(nil),
+		(*Message_Bval)(nil),
+		(*Message_Aux)(nil),
+		(*Message_Term)(nil),
+		(*Message_CoinShare)(nil),
+		(*Message_DecryptionShare)(nil),
+	}
+}
+
+func _Message_OneofMarshaler(msg proto.Message, b *proto.Buffer) error {
+	m := msg.(*Message)
+	// payload
+	switch x := m.Payload.(type) {
+	case *Message_Request:
+		b.EncodeVarint(2<<3 | proto.WireBytes)
+		b.EncodeRawBytes(x.Request)
+	case *Message_Val:
+		b.EncodeVarint(3<<3 | proto.WireBytes)
+		if err := b.EncodeMessage(x.Val); err != nil {
+			return err
+		}
+	case *Message_Echo:
+		b.EncodeVarint(4<<3 | proto.WireBytes)
+		if err := b.EncodeMessage(x.Echo); err != nil {
+			return err
+		}
+	case *Message_Ready:
+		b.EncodeVarint(5<<3 | proto.WireBytes)
+		if err := b.EncodeMessage(x.Ready); err != nil {
+			return err
+		}
+	case *Message_Bval:
+		b.EncodeVarint(6<<3 | proto.WireBytes)
+		if err := b.EncodeMessage(x.Bval); err != nil {
+			return err
+		}
+	case *Message_Aux:
+		b.EncodeVarint(7<<3 | proto.WireBytes)
+		if err := b.EncodeMessage(x.Aux); err != nil {
+			return err
+		}
+	case *Message_Term:
+		b.EncodeVarint(8<<3 | proto.WireBytes)
+		if err := b.EncodeMessage(x.Term); err != nil {
+			return err
+		}
+	case *Message_CoinShare:
+		b.EncodeVarint(9<<3 | proto.WireBytes)
+		if err := b.EncodeMessage(x.CoinShare); err != nil {
+			return err
+		}
+	case *Message_DecryptionShare:
+		b.EncodeVarint(10<<3 | proto.WireBytes)
+		if err := b.EncodeMessage(x.DecryptionShare); err != nil {
+			return err
+		}
+	case nil:
+	default:
+		return fmt.Errorf("Message.Payload has unexpected type %T", x)
+	}
+	return nil
+}
+
+func _Message_OneofUnmarshaler(msg proto.Message, tag, wire int, b *proto.Buffer) (bool, error) {
+	m := msg.(*Message)
+	switch tag {
+	case 2: // payload.request
+		if wire != proto.WireBytes {
+			return true, proto.ErrInternalBadWireType
+		}
+		x, err := b.DecodeRawBytes(true)
+		m.Payload = &Message_Request{x}
+		return true, err
+	case 3: // payload.val
+		if wire != proto.WireBytes {
+			return true, proto.ErrInternalBadWireType
+		}
+		msg := new(Val)
+		err := b.DecodeMessage(msg)
+		m.Payload = &Message_Val{msg}
+		return true, err
+	case 4: // payload.echo
+		if wire != proto.WireBytes {
+			return true, proto.ErrInternalBadWireType
+		}
+		msg := new(Echo)
+		err := b.DecodeMessage(msg)
+		m.Payload = &Message_Echo{msg}
+		return true, err
+	case 5: // payload.ready
+		if wire != proto.WireBytes {
+			return true, proto.ErrInternalBadWireType
+		}
+		msg := new(Ready)
+		err := b.DecodeMessage(msg)
+		m.Payload = &Message_Ready{msg}
+		return true, err
+	case 6: // payload.bval
+		if wire != proto.WireBytes {
+			return true, proto.ErrInternalBadWireType
+		}
+		msg := new(Bval)
+		err := b.DecodeMessage(msg)
+		m.Payload = &Message_Bval{msg}
+		return true, err
+	case 7: // payload.aux
+		if wire != proto.WireBytes {
+			return true, proto.ErrInternalBadWireType
+		}
+		msg := new(Aux)
+		err := b.DecodeMessage(msg)
+		m.Payload = &Message_Aux{msg}
+		return true, err
+	case 8: // payload.term
+		if wire != proto.WireBytes {
+			return true, proto.ErrInternalBadWireType
+		}
+		msg := new(Term)
+		err := b.DecodeMessage(msg)
+		m.Payload = &Message_Term{msg}
+		return true, err
+	case 9: // payload.coin_share
+		if wire != proto.WireBytes {
+			return true, proto.ErrInternalBadWireType
+		}
+		msg := new(CoinShare)
+		err := b.DecodeMessage(msg)
+		m.Payload = &Message_CoinShare{msg}
+		return true, err
+	case 10: // payload.decryption_share
+		if wire != proto.WireBytes {
+			return true, proto.ErrInternalBadWireType
+		}
+		msg := new(DecryptionShare)
+		err := b.DecodeMessage(msg)
+		m.Payload = &Message_DecryptionShare{msg}
+		return true, err
+	default:
+		return false, nil
+	}
+}
+
+// reliable broadcast of the proposal of a replica
+type Val struct {
+	Proposer uint64 `protobuf:"varint,1,opt,name=proposer" json:"proposer,omitempty"`
+	Payload  []byte `protobuf:"bytes,2,opt,name=payload,proto3" json:"payload,omitempty"`
+}
+
+func (m *Val) Reset()         { *m = Val{} }
+func (m *Val) String() string { return proto.CompactTextString(m) }
+func (*Val) ProtoMessage()    {}
+
+type Echo struct {
+	Proposer uint64 `protobuf:"varint,1,opt,name=proposer" json:"proposer,omitempty"`
+	Payload  []byte `protobuf:"bytes,2,opt,name=payload,proto3" json:"payload,omitempty"`
+}
+
+func (m *Echo) Reset()         { *m = Echo{} }
+func (m *Echo) String() string { return proto.CompactTextString(m) }
+func (*Echo) ProtoMessage()    {}
+
+type Ready struct {
+	Proposer uint64 `protobuf:"varint,1,opt,name=proposer" json:"proposer,omitempty"`
+	Digest   []byte `protobuf:"bytes,2,opt,name=digest,proto3" json:"digest,omitempty"`
+}
+
+func (m *Ready) Reset()         { *m = Ready{} }
+func (m *Ready) String() string { return proto.CompactTextString(m) }
+func (*Ready) ProtoMessage()    {}
+
+// binary agreement on whether the proposal of a replica is included
+type Bval struct {
+	Instance uint64 `protobuf:"varint,1,opt,name=instance" json:"instance,omitempty"`
+	Round    uint64 `protobuf:"varint,2,opt,name=round" json:"round,omitempty"`
+	Value    bool   `protobuf:"varint,3,opt,name=value" json:"value,omitempty"`
+}
+
+func (m *Bval) Reset()         { *m = Bval{} }
+func (m *Bval) String() string { return proto.CompactTextString(m) }
+func (*Bval) ProtoMessage()    {}
+
+type Aux struct {
+	Instance uint64 `protobuf:"varint,1,opt,name=instance" json:"instance,omitempty"`
+	Round    uint64 `protobuf:"varint,2,opt,name=round" json:"round,omitempty"`
+	Value    bool   `protobuf:"varint,3,opt,name=value" json:"value,omitempty"`
+}
+
+func (m *Aux) Reset()         { *m = Aux{} }
+func (m *Aux) String() string { return proto.CompactTextString(m) }
+func (*Aux) ProtoMessage()    {}
+
+type Term struct {
+	Instance uint64 `protobuf:"varint,1,opt,name=instance" json:"instance,omitempty"`
+	Value    bool   `protobuf:"varint,2,opt,name=value" json:"value,omitempty"`
+}
+
+func (m *Term) Reset()         { *m = Term{} }
+func (m *Term) String() string { return proto.CompactTextString(m) }
+func (*Term) ProtoMessage()    {}
+
+type CoinShare struct {
+	Instance uint64 `protobuf:"varint,1,opt,name=instance" json:"instance,omitempty"`
+	Round    uint64 `protobuf:"varint,2,opt,name=round" json:"round,omitempty"`
+	Share    []byte `protobuf:"bytes,3,opt,name=share,proto3" json:"share,omitempty"`
+	Proof    []byte `protobuf:"bytes,4,opt,name=proof,proto3" json:"proof,omitempty"`
+}
+
+func (m *CoinShare) Reset()         { *m = CoinShare{} }
+func (m *CoinShare) String() string { return proto.CompactTextString(m) }
+func (*CoinShare) ProtoMessage()    {}
+
+// threshold decryption of the proposal of a replica
+type DecryptionShare struct {
+	Proposer uint64 `protobuf:"varint,1,opt,name=proposer" json:"proposer,omitempty"`
+	Share    []byte `protobuf:"bytes,2,opt,name=share,proto3" json:"share,omitempty"`
+	Proof    []byte `protobuf:"bytes,3,opt,name=proof,proto3" json:"proof,omitempty"`
+}
+
+func (m *DecryptionShare) Reset()         { *m = DecryptionShare{} }
+func (m *DecryptionShare) String() string { return proto.CompactTextString(m) }
+func (*DecryptionShare) ProtoMessage()    {}
+
+type Ciphertext struct {
+	U []byte `protobuf:"bytes,1,opt,name=u,proto3" json:"u,omitempty"`
+	V []byte `protobuf:"bytes,2,opt,name=v,proto3" json:"v,omitempty"`
+}
+
+func (m *Ciphertext) Reset()         { *m = Ciphertext{} }
+func (m *Ciphertext) String() string { return proto.CompactTextString(m) }
+func (*Ciphertext) ProtoMessage()    {}
+
+type Batch struct {
+	Epoch    uint64   `protobuf:"varint,1,opt,name=epoch" json:"epoch,omitempty"`
+	Requests [][]byte `protobuf:"bytes,2,rep,name=requests,proto3" json:"requests,omitempty"`
+}
+
+func (m *Batch) Reset()         { *m = Batch{} }
+func (m *Batch) String() string { return proto.CompactTextString(m) }
+func (*Batch) ProtoMessage()    {}
+
+type Metadata struct {
+	Epoch uint64 `protobuf:"varint,1,opt,name=epoch" json:"epoch,omitempty"`
+}
+
+func (m *Metadata) Reset()         { *m = Metadata{} }
+func (m *Metadata) String() string { return proto.CompactTextString(m) }
+func (*Metadata) ProtoMessage()    {}
+
+type PublicKeys struct {
+	Master []byte   `protobuf:"bytes,1,opt,name=master,proto3" json:"master,omitempty"`
+	Shares [][]byte `protobuf:"bytes,2,rep,name=shares,proto3" json:"shares,omitempty"`
+}
+
+func (m *PublicKeys) Reset()         { *m = PublicKeys{} }
+func (m *PublicKeys) String() string { return proto.CompactTextString(m) }
+func (*PublicKeys) ProtoMessage()    {}
+
+type KeyShare struct {
+	Id     uint64      `protobuf:"varint,1,opt,name=id" json:"id,omitempty"`
+	Secret []byte      `protobuf:"bytes,2,opt,name=secret,proto3" json:"secret,omitempty"`
+	Public *PublicKeys `protobuf:"bytes,3,opt,name=public" json:"public,omitempty"`
+}
+
+func (m *KeyShare) Reset()         { *m = KeyShare{} }
+func (m *KeyShare) String() string { return proto.CompactTextString(m) }
+func (*KeyShare) ProtoMessage()    {}
+
+func (m *KeyShare) GetPublic() *PublicKeys {
+	if m != nil {
+		return m.Public
+	}
+	return nil
+}
@@ -0,0 +1,146 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package honeybadger
+
+import (
+	"fmt"
+	"math/rand"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/spf13/viper"
+
+	"github.com/hyperledger/fabric/consensus/util/events"
+	pb "github.com/hyperledger/fabric/protos"
+)
+
+// testReplica stands for the stack of a replica, its ledger holds the
+// batches it committed as blocks
+type testReplica struct {
+	id     uint64
+	net    *testNetwork
+	hb     *hbCore
+	ledger []*Batch
+	meta   *Metadata
+	down   bool
+}
+
+type testEvent struct {
+	dst   uint64
+	event events.Event
+}
+
+// testNetwork delivers the events of its replicas in order, or in a random
+// order if it has a random source
+type testNetwork struct {
+	replicas map[uint64]*testReplica
+	queue    []testEvent
+	random   *rand.Rand
+	filterFn func(src, dst uint64, msg *Message) *Message
+}
+
+func loadTestConfig() *viper.Viper {
+	config := loadConfig()
+	config.Set("general.batchsize", 4)
+	return config
+}
+
+func newTestNetwork(n int, config *viper.Viper) *testNetwork {
+	config.Set("general.N", n)
+	net := &testNetwork{replicas: make(map[uint64]*testReplica)}
+	for id := uint64(0); id < uint64(n); id++ {
+		r := &testReplica{id: id, net: net}
+		r.hb = newHbCore(id, config, r)
+		net.replicas[id] = r
+	}
+	return net
+}
+
+func (net *testNetwork) send(src, dst uint64, msg *Message) {
+	if net.filterFn != nil {
+		if msg = net.filterFn(src, dst, msg); msg == nil {
+			return
+		}
+	}
+	// copy the message, as the network would
+	raw, _ := proto.Marshal(msg)
+	copied := &Message{}
+	proto.Unmarshal(raw, copied)
+	net.queue = append(net.queue, testEvent{dst, hbMessageEvent{msg: copied, sender: src}})
+}
+
+// process delivers the queued events until none are left
+func (net *testNetwork) process() {
+	for i := 0; len(net.queue) > 0; i++ {
+		if i > 1000000 {
+			panic("the network did not settle")
+		}
+		next := 0
+		if net.random != nil {
+			next = net.random.Intn(len(net.queue))
+		}
+		event := net.queue[next]
+		net.queue = append(net.queue[:next], net.queue[next+1:]...)
+		r, ok := net.replicas[event.dst]
+		if !ok || r.down {
+			continue
+		}
+		r.hb.ProcessEvent(event.event)
+	}
+}
+
+// submit has a replica receive a client request
+func (net *testNetwork) submit(id uint64, tag int) {
+	tx, _ := proto.Marshal(&pb.Transaction{Uuid: fmt.Sprintf("tx%d", tag)})
+	net.queue = append(net.queue, testEvent{id, requestEvent(tx)})
+}
+
+func (r *testReplica) txIDs() []string {
+	var ids []string
+	for _, batch := range r.ledger {
+		for _, req := range batch.Requests {
+			tx := &pb.Transaction{}
+			proto.Unmarshal(req, tx)
+			ids = append(ids, tx.Uuid)
+		}
+	}
+	return ids
+}
+
+// =============================================================================
+// innerStack interface
+// =============================================================================
+
+func (r *testReplica) broadcast(msg *Message) {
+	for id := range r.net.replicas {
+		if id != r.id {
+			r.net.send(r.id, id, msg)
+		}
+	}
+}
+
+func (r *testReplica) execute(batch *Batch) {
+	r.ledger = append(r.ledger, batch)
+	r.meta = &Metadata{Epoch: batch.Epoch}
+	r.net.queue = append(r.net.queue, testEvent{r.id, appliedEvent{batch.Epoch}})
+}
+
+func (r *testReplica) getLastApplied() (*Metadata, error) {
+	if r.meta == nil {
+		return &Metadata{}, nil
+	}
+	return r.meta, nil
+}
@@ -0,0 +1,146 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package honeybadger
+
+import (
+	"crypto/sha256"
+)
+
+// reliableBroadcast is Bracha's reliable broadcast of the proposal of one
+// replica: if a correct replica delivers a payload, every correct replica
+// eventually delivers the same one, even if the proposer is faulty.  The
+// replicas echo the payload of the proposer, and are ready once n-f echoed
+// the same payload, or once f+1 are ready, one correct at least.  A payload
+// is delivered once 2f+1 are ready for it.
+//
+// Unlike HoneyBadgerBFT the payload is not erasure coded, every replica
+// echoes it in full.
+type reliableBroadcast struct {
+	proposer uint64
+	n, f     int
+	send     func(msg *Message) // broadcasts a message of the epoch
+
+	echoed     bool                       // we echoed the proposal
+	readied    bool                       // we are ready for a payload
+	echoes     map[string]map[uint64]bool // senders of an echo, by digest of its payload
+	readies    map[string]map[uint64]bool // senders of a ready, by digest
+	payloads   map[string][]byte          // payloads echoed, by digest
+	heard      map[uint64]bool            // replicas which sent us an echo
+	heardReady map[uint64]bool            // replicas which sent us a ready
+
+	delivered bool
+	output    []byte
+}
+
+func newReliableBroadcast(proposer uint64, n, f int, send func(msg *Message)) *reliableBroadcast {
+	return &reliableBroadcast{
+		proposer:   proposer,
+		n:          n,
+		f:          f,
+		send:       send,
+		echoes:     make(map[string]map[uint64]bool),
+		readies:    make(map[string]map[uint64]bool),
+		payloads:   make(map[string][]byte),
+		heard:      make(map[uint64]bool),
+		heardReady: make(map[uint64]bool),
+	}
+}
+
+func payloadDigest(payload []byte) string {
+	digest := sha256.Sum256(payload)
+	return string(digest[:])
+}
+
+// propose broadcasts the payload of this replica, which is the proposer
+func (rb *reliableBroadcast) propose(payload []byte) {
+	rb.send(&Message{Payload: &Message_Val{Val: &Val{Proposer: rb.proposer, Payload: payload}}})
+}
+
+func (rb *reliableBroadcast) recvVal(sender uint64, val *Val) {
+	if sender != rb.proposer {
+		logger.Warningf("Replica %d sent the proposal of replica %d", sender, rb.proposer)
+		return
+	}
+	if rb.echoed {
+		return
+	}
+	rb.echoed = true
+	rb.send(&Message{Payload: &Message_Echo{Echo: &Echo{Proposer: rb.proposer, Payload: val.Payload}}})
+}
+
+func (rb *reliableBroadcast) recvEcho(sender uint64, echo *Echo) {
+	if rb.heard[sender] {
+		return
+	}
+	rb.heard[sender] = true
+
+	digest := payloadDigest(echo.Payload)
+	if _, ok := rb.payloads[digest]; !ok {
+		rb.payloads[digest] = echo.Payload
+	}
+	if rb.echoes[digest] == nil {
+		rb.echoes[digest] = make(map[uint64]bool)
+	}
+	rb.echoes[digest][sender] = true
+	if len(rb.echoes[digest]) >= rb.n-rb.f {
+		rb.ready(digest)
+	}
+	rb.maybeDeliver()
+}
+
+func (rb *reliableBroadcast) recvReady(sender uint64, ready *Ready) {
+	if rb.heardReady[sender] {
+		return
+	}
+	rb.heardReady[sender] = true
+
+	digest := string(ready.Digest)
+	if rb.readies[digest] == nil {
+		rb.readies[digest] = make(map[uint64]bool)
+	}
+	rb.readies[digest][sender] = true
+	if len(rb.readies[digest]) >= rb.f+1 {
+		rb.ready(digest)
+	}
+	rb.maybeDeliver()
+}
+
+func (rb *reliableBroadcast) ready(digest string) {
+	if rb.readied {
+		return
+	}
+	rb.readied = true
+	rb.send(&Message{Payload: &Message_Ready{Ready: &Ready{Proposer: rb.proposer, Digest: []byte(digest)}}})
+}
+
+func (rb *reliableBroadcast) maybeDeliver() {
+	if rb.delivered {
+		return
+	}
+	for digest, senders := range rb.readies {
+		if len(senders) < 2*rb.f+1 {
+			continue
+		}
+		// a correct replica which is ready saw n-f echoes, f+1 of them
+		// correct, so the payload reaches us with their echoes
+		if payload, ok := rb.payloads[digest]; ok {
+			rb.delivered = true
+			rb.output = payload
+			return
+		}
+	}
+}
@@ -0,0 +1,439 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package honeybadger
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/elliptic"
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math/big"
+	"sort"
+)
+
+// The threshold schemes work in the group of the P-256 curve.  A dealer
+// shares the master secret x among the replicas with a polynomial of degree
+// f, so that any f+1 of the shares x_i determine g^x, but f of them reveal
+// nothing of it.  The public keys are g^x and every g^x_i, the latter to
+// verify the shares the replicas contribute.
+//
+// A proposal is encrypted with hashed ElGamal: the key of an AES-GCM
+// ciphertext V is derived from (g^x)^r, which is published as U = g^r.  Each
+// replica contributes U^x_i, and any f+1 contributions yield U^x = (g^x)^r.
+// The common coin of a round of binary agreement is derived alike from H^x,
+// for a point H hashed from the name of the round, so that it is unknown
+// until f+1 replicas, one correct at least, contributed H^x_i.  Each
+// contribution carries a Chaum-Pedersen proof that it was computed with the
+// share of its sender, so that a faulty replica cannot spoil the result.
+
+var curve = elliptic.P256()
+
+// point is a point of the curve in affine coordinates
+type point struct {
+	x, y *big.Int
+}
+
+func basePoint(k *big.Int) point {
+	x, y := curve.ScalarBaseMult(k.Bytes())
+	return point{x, y}
+}
+
+func (p point) mul(k *big.Int) point {
+	x, y := curve.ScalarMult(p.x, p.y, k.Bytes())
+	return point{x, y}
+}
+
+func (p point) add(q point) point {
+	x, y := curve.Add(p.x, p.y, q.x, q.y)
+	return point{x, y}
+}
+
+func (p point) bytes() []byte {
+	return elliptic.Marshal(curve, p.x, p.y)
+}
+
+func parsePoint(raw []byte) (point, error) {
+	x, y := elliptic.Unmarshal(curve, raw)
+	if x == nil {
+		return point{}, fmt.Errorf("Not a point of the curve")
+	}
+	return point{x, y}, nil
+}
+
+// hashToPoint maps data to a point whose discrete logarithm nobody knows,
+// by trying x coordinates until one is on the curve
+func hashToPoint(data ...[]byte) point {
+	params := curve.Params()
+	exp := new(big.Int).Add(params.P, big.NewInt(1)) // P = 3 mod 4, so the square root of a is a^((P+1)/4)
+	exp.Rsh(exp, 2)
+	three := big.NewInt(3)
+	for ctr := uint32(0); ; ctr++ {
+		h := sha256.New()
+		binary.Write(h, binary.BigEndian, ctr)
+		for _, d := range data {
+			h.Write(d)
+		}
+		x := new(big.Int).SetBytes(h.Sum(nil))
+		x.Mod(x, params.P)
+		// y^2 = x^3 - 3x + b
+		rhs := new(big.Int).Exp(x, three, params.P)
+		rhs.Sub(rhs, new(big.Int).Mul(three, x))
+		rhs.Add(rhs, params.B)
+		rhs.Mod(rhs, params.P)
+		y := new(big.Int).Exp(rhs, exp, params.P)
+		if new(big.Int).Exp(y, big.NewInt(2), params.P).Cmp(rhs) == 0 && curve.IsOnCurve(x, y) {
+			return point{x, y}
+		}
+	}
+}
+
+// randomScalar reads a scalar from rnd, with enough extra bytes that its
+// reduction modulo the order is as good as uniform
+func randomScalar(rnd io.Reader) (*big.Int, error) {
+	buf := make([]byte, scalarSize+16)
+	for {
+		if _, err := io.ReadFull(rnd, buf); err != nil {
+			return nil, err
+		}
+		k := new(big.Int).SetBytes(buf)
+		k.Mod(k, curve.Params().N)
+		if k.Sign() > 0 {
+			return k, nil
+		}
+	}
+}
+
+// =============================================================================
+// proofs of equal discrete logarithms
+// =============================================================================
+
+const scalarSize = 32
+
+// proveEqualLog proves that a = g^x and b = h^x for the same secret x, without
+// revealing it
+func proveEqualLog(x *big.Int, a point, h point, b point, rnd io.Reader) ([]byte, error) {
+	w, err := randomScalar(rnd)
+	if err != nil {
+		return nil, err
+	}
+	c := equalLogChallenge(a, h, b, basePoint(w), h.mul(w))
+	z := new(big.Int).Mul(c, x)
+	z.Sub(w, z)
+	z.Mod(z, curve.Params().N)
+
+	proof := make([]byte, 2*scalarSize)
+	putScalar(proof[:scalarSize], c)
+	putScalar(proof[scalarSize:], z)
+	return proof, nil
+}
+
+// putScalar writes k big-endian into buf, padded with leading zeros
+func putScalar(buf []byte, k *big.Int) {
+	raw := k.Bytes()
+	copy(buf[len(buf)-len(raw):], raw)
+}
+
+func verifyEqualLog(a point, h point, b point, proof []byte) error {
+	if len(proof) != 2*scalarSize {
+		return fmt.Errorf("Proof has %d bytes instead of %d", len(proof), 2*scalarSize)
+	}
+	c := new(big.Int).SetBytes(proof[:scalarSize])
+	z := new(big.Int).SetBytes(proof[scalarSize:])
+	// g^w = g^z a^c and h^w = h^z b^c
+	if c.Cmp(equalLogChallenge(a, h, b, basePoint(z).add(a.mul(c)), h.mul(z).add(b.mul(c)))) != 0 {
+		return fmt.Errorf("Proof does not verify")
+	}
+	return nil
+}
+
+func equalLogChallenge(points ...point) *big.Int {
+	h := sha256.New()
+	for _, p := range points {
+		h.Write(p.bytes())
+	}
+	c := new(big.Int).SetBytes(h.Sum(nil))
+	return c.Mod(c, curve.Params().N)
+}
+
+// =============================================================================
+// keys
+// =============================================================================
+
+// publicKeys are the keys every replica knows, any threshold of the shares
+// of the master secret determine its result
+type publicKeys struct {
+	master    point   // g^x
+	shares    []point // g^x_i of each replica, by ID
+	threshold int     // how many shares determine a result
+}
+
+// keyShare is the share of the master secret a replica holds
+type keyShare struct {
+	id     uint64
+	secret *big.Int
+	public *publicKeys
+}
+
+// dealKeys shares a random master secret among n replicas, so that
+// threshold of them determine its results
+func dealKeys(n int, threshold int, rnd io.Reader) ([]*keyShare, error) {
+	if threshold < 1 || threshold > n {
+		return nil, fmt.Errorf("Cannot share a secret among %d replicas with threshold %d", n, threshold)
+	}
+	order := curve.Params().N
+	coefs := make([]*big.Int, threshold)
+	for i := range coefs {
+		k, err := randomScalar(rnd)
+		if err != nil {
+			return nil, err
+		}
+		coefs[i] = k
+	}
+
+	public := &publicKeys{master: basePoint(coefs[0]), threshold: threshold}
+	shares := make([]*keyShare, n)
+	for i := range shares {
+		// evaluate the polynomial at i+1, zero is the master secret
+		at := big.NewInt(int64(i + 1))
+		secret := new(big.Int)
+		for j := len(coefs) - 1; j >= 0; j-- {
+			secret.Mul(secret, at)
+			secret.Add(secret, coefs[j])
+			secret.Mod(secret, order)
+		}
+		shares[i] = &keyShare{id: uint64(i), secret: secret, public: public}
+		public.shares = append(public.shares, basePoint(secret))
+	}
+	return shares, nil
+}
+
+func (pk *publicKeys) marshal() *PublicKeys {
+	msg := &PublicKeys{Master: pk.master.bytes()}
+	for _, share := range pk.shares {
+		msg.Shares = append(msg.Shares, share.bytes())
+	}
+	return msg
+}
+
+func unmarshalPublicKeys(msg *PublicKeys, threshold int) (*publicKeys, error) {
+	if msg == nil {
+		return nil, fmt.Errorf("No public keys")
+	}
+	master, err := parsePoint(msg.Master)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid master key: %s", err)
+	}
+	pk := &publicKeys{master: master, threshold: threshold}
+	for i, raw := range msg.Shares {
+		share, err := parsePoint(raw)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid key of replica %d: %s", i, err)
+		}
+		pk.shares = append(pk.shares, share)
+	}
+	if len(pk.shares) < threshold {
+		return nil, fmt.Errorf("Public keys of %d replicas do not reach the threshold of %d", len(pk.shares), threshold)
+	}
+	return pk, nil
+}
+
+func (ks *keyShare) marshal() *KeyShare {
+	secret := make([]byte, scalarSize)
+	putScalar(secret, ks.secret)
+	return &KeyShare{Id: ks.id, Secret: secret, Public: ks.public.marshal()}
+}
+
+func unmarshalKeyShare(msg *KeyShare, threshold int) (*keyShare, error) {
+	public, err := unmarshalPublicKeys(msg.Public, threshold)
+	if err != nil {
+		return nil, err
+	}
+	if msg.Id >= uint64(len(public.shares)) {
+		return nil, fmt.Errorf("Key share of replica %d, but only %d public keys", msg.Id, len(public.shares))
+	}
+	ks := &keyShare{id: msg.Id, secret: new(big.Int).SetBytes(msg.Secret), public: public}
+	if !bytes.Equal(basePoint(ks.secret).bytes(), public.shares[ks.id].bytes()) {
+		return nil, fmt.Errorf("Key share of replica %d does not match its public key", msg.Id)
+	}
+	return ks, nil
+}
+
+// verifyShare checks that the share of replica id of h is h^x_id
+func (pk *publicKeys) verifyShare(id uint64, h point, rawShare []byte, proof []byte) (point, error) {
+	if id >= uint64(len(pk.shares)) {
+		return point{}, fmt.Errorf("No key for replica %d", id)
+	}
+	share, err := parsePoint(rawShare)
+	if err != nil {
+		return point{}, err
+	}
+	if err := verifyEqualLog(pk.shares[id], h, share, proof); err != nil {
+		return point{}, err
+	}
+	return share, nil
+}
+
+// combine interpolates h^x from threshold shares h^x_i, by ID
+func (pk *publicKeys) combine(shares map[uint64]point) (point, error) {
+	if len(shares) < pk.threshold {
+		return point{}, fmt.Errorf("Have %d shares, need %d", len(shares), pk.threshold)
+	}
+	var ids []uint64
+	for id := range shares {
+		ids = append(ids, id)
+	}
+	sort.Sort(uint64Slice(ids))
+	ids = ids[:pk.threshold]
+
+	order := curve.Params().N
+	var result point
+	for i, id := range ids {
+		// the Lagrange coefficient of id at zero
+		num, den := big.NewInt(1), big.NewInt(1)
+		for _, other := range ids {
+			if other == id {
+				continue
+			}
+			num.Mul(num, big.NewInt(int64(other+1)))
+			den.Mul(den, big.NewInt(int64(other)-int64(id)))
+		}
+		den.Mod(den, order)
+		coef := new(big.Int).Mul(num, den.ModInverse(den, order))
+		coef.Mod(coef, order)
+		term := shares[id].mul(coef)
+		if i == 0 {
+			result = term
+		} else {
+			result = result.add(term)
+		}
+	}
+	return result, nil
+}
+
+type uint64Slice []uint64
+
+func (a uint64Slice) Len() int           { return len(a) }
+func (a uint64Slice) Swap(i, j int)      { a[i], a[j] = a[j], a[i] }
+func (a uint64Slice) Less(i, j int) bool { return a[i] < a[j] }
+
+// =============================================================================
+// threshold encryption
+// =============================================================================
+
+// encrypt encrypts plaintext so that threshold replicas must contribute to
+// decrypt it
+func (pk *publicKeys) encrypt(plaintext []byte, rnd io.Reader) (*Ciphertext, error) {
+	r, err := randomScalar(rnd)
+	if err != nil {
+		return nil, err
+	}
+	u := basePoint(r)
+	aead, err := sessionCipher(pk.master.mul(r))
+	if err != nil {
+		return nil, err
+	}
+	// every key encrypts a single plaintext, the nonce need not vary
+	nonce := make([]byte, aead.NonceSize())
+	return &Ciphertext{U: u.bytes(), V: aead.Seal(nil, nonce, plaintext, u.bytes())}, nil
+}
+
+// decryptionShare returns the contribution of this replica to decrypting ct,
+// with the proof that it is correct
+func (ks *keyShare) decryptionShare(ct *Ciphertext, rnd io.Reader) (share []byte, proof []byte, err error) {
+	u, err := parsePoint(ct.U)
+	if err != nil {
+		return nil, nil, err
+	}
+	d := u.mul(ks.secret)
+	proof, err = proveEqualLog(ks.secret, ks.public.shares[ks.id], u, d, rnd)
+	if err != nil {
+		return nil, nil, err
+	}
+	return d.bytes(), proof, nil
+}
+
+// verifyDecryptionShare returns the contribution of replica id to decrypting
+// ct, if it is correct
+func (pk *publicKeys) verifyDecryptionShare(id uint64, ct *Ciphertext, share []byte, proof []byte) (point, error) {
+	u, err := parsePoint(ct.U)
+	if err != nil {
+		return point{}, err
+	}
+	return pk.verifyShare(id, u, share, proof)
+}
+
+// decrypt combines threshold contributions to decrypt ct
+func (pk *publicKeys) decrypt(ct *Ciphertext, shares map[uint64]point) ([]byte, error) {
+	key, err := pk.combine(shares)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := sessionCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	return aead.Open(nil, nonce, ct.V, ct.U)
+}
+
+func sessionCipher(key point) (cipher.AEAD, error) {
+	digest := sha256.Sum256(append([]byte("honeybadger encryption"), key.bytes()...))
+	block, err := aes.NewCipher(digest[:])
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// =============================================================================
+// common coin
+// =============================================================================
+
+// coinPoint is the point whose power to the master secret determines the
+// coin of a round of binary agreement
+func coinPoint(epoch, instance, round uint64) point {
+	name := make([]byte, 24)
+	binary.BigEndian.PutUint64(name, epoch)
+	binary.BigEndian.PutUint64(name[8:], instance)
+	binary.BigEndian.PutUint64(name[16:], round)
+	return hashToPoint([]byte("honeybadger coin"), name)
+}
+
+// coinShare returns the contribution of this replica to the coin of h, with
+// the proof that it is correct
+func (ks *keyShare) coinShare(h point, rnd io.Reader) (share []byte, proof []byte, err error) {
+	s := h.mul(ks.secret)
+	proof, err = proveEqualLog(ks.secret, ks.public.shares[ks.id], h, s, rnd)
+	if err != nil {
+		return nil, nil, err
+	}
+	return s.bytes(), proof, nil
+}
+
+// coin combines threshold contributions to the coin of h into a bit
+func (pk *publicKeys) coin(shares map[uint64]point) (bool, error) {
+	sig, err := pk.combine(shares)
+	if err != nil {
+		return false, err
+	}
+	digest := sha256.Sum256(sig.bytes())
+	return digest[0]&1 == 1, nil
+}
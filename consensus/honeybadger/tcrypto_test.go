@@ -0,0 +1,149 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package honeybadger
+
+import (
+	"bytes"
+	"crypto/rand"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/golang/protobuf/proto"
+)
+
+func TestThresholdDecryption(t *testing.T) {
+	shares, err := dealKeys(4, 2, rand.Reader)
+	if err != nil {
+		t.Fatalf("Could not deal keys: %s", err)
+	}
+	pk := shares[0].public
+	plaintext := []byte("transactions")
+	ct, err := pk.encrypt(plaintext, rand.Reader)
+	if err != nil {
+		t.Fatalf("Could not encrypt: %s", err)
+	}
+
+	valid := make(map[uint64]point)
+	for _, id := range []uint64{3, 1} {
+		share, proof, err := shares[id].decryptionShare(ct, rand.Reader)
+		if err != nil {
+			t.Fatalf("Replica %d could not compute its decryption share: %s", id, err)
+		}
+		if _, err := pk.verifyDecryptionShare((id+1)%4, ct, share, proof); err == nil {
+			t.Errorf("The decryption share of replica %d verified as that of replica %d", id, (id+1)%4)
+		}
+		p, err := pk.verifyDecryptionShare(id, ct, share, proof)
+		if err != nil {
+			t.Fatalf("The decryption share of replica %d does not verify: %s", id, err)
+		}
+		if _, err := pk.decrypt(ct, valid); err == nil {
+			t.Errorf("Decrypted with %d shares, below the threshold", len(valid))
+		}
+		valid[id] = p
+	}
+	decrypted, err := pk.decrypt(ct, valid)
+	if err != nil {
+		t.Fatalf("Could not decrypt: %s", err)
+	}
+	if !bytes.Equal(decrypted, plaintext) {
+		t.Errorf("Decrypted %q instead of %q", decrypted, plaintext)
+	}
+}
+
+func TestCommonCoin(t *testing.T) {
+	shares, err := dealKeys(4, 2, rand.Reader)
+	if err != nil {
+		t.Fatalf("Could not deal keys: %s", err)
+	}
+	pk := shares[0].public
+	h := coinPoint(1, 2, 3)
+
+	toss := func(ids ...uint64) bool {
+		valid := make(map[uint64]point)
+		for _, id := range ids {
+			share, proof, err := shares[id].coinShare(h, rand.Reader)
+			if err != nil {
+				t.Fatalf("Replica %d could not compute its coin share: %s", id, err)
+			}
+			p, err := pk.verifyShare(id, h, share, proof)
+			if err != nil {
+				t.Fatalf("The coin share of replica %d does not verify: %s", id, err)
+			}
+			valid[id] = p
+		}
+		coin, err := pk.coin(valid)
+		if err != nil {
+			t.Fatalf("Could not toss the coin: %s", err)
+		}
+		return coin
+	}
+	if toss(0, 1) != toss(2, 3) || toss(0, 3, 2) != toss(1, 2) {
+		t.Errorf("Different sets of shares tossed different coins")
+	}
+
+	share, _, _ := shares[0].coinShare(h, rand.Reader)
+	_, proof, _ := shares[0].coinShare(coinPoint(1, 2, 4), rand.Reader)
+	if _, err := pk.verifyShare(0, h, share, proof); err == nil {
+		t.Errorf("The proof of a coin share of another round verified")
+	}
+}
+
+func TestDealerSeed(t *testing.T) {
+	first, _ := dealKeys(4, 2, newSeedReader("seed"))
+	second, _ := dealKeys(4, 2, newSeedReader("seed"))
+	other, _ := dealKeys(4, 2, newSeedReader("other seed"))
+	if !bytes.Equal(first[0].public.master.bytes(), second[0].public.master.bytes()) {
+		t.Errorf("The same seed dealt different keys")
+	}
+	if bytes.Equal(first[0].public.master.bytes(), other[0].public.master.bytes()) {
+		t.Errorf("Different seeds dealt the same keys")
+	}
+}
+
+func TestKeyFiles(t *testing.T) {
+	dir, err := ioutil.TempDir("", "honeybadger")
+	if err != nil {
+		t.Fatalf("Could not create a temporary directory: %s", err)
+	}
+	defer os.RemoveAll(dir)
+	if err := DealKeyShares(4, dir); err != nil {
+		t.Fatalf("Could not deal key files: %s", err)
+	}
+
+	config := loadTestConfig()
+	config.Set("general.keys.file", filepath.Join(dir, "vp2.key"))
+	ks, err := loadKeyShare(2, 4, 1, config)
+	if err != nil {
+		t.Fatalf("Could not load the key file: %s", err)
+	}
+	if ks.id != 2 || ks.public.threshold != 2 || len(ks.public.shares) != 4 {
+		t.Errorf("Loaded the share of replica %d with threshold %d of %d keys", ks.id, ks.public.threshold, len(ks.public.shares))
+	}
+	if _, err := loadKeyShare(1, 4, 1, config); err == nil {
+		t.Errorf("Replica 1 loaded the key file of replica 2")
+	}
+
+	msg := ks.marshal()
+	msg.Secret[0] ^= 1
+	raw, _ := proto.Marshal(msg)
+	ioutil.WriteFile(filepath.Join(dir, "vp2.key"), raw, 0600)
+	if _, err := loadKeyShare(2, 4, 1, config); err == nil {
+		t.Errorf("Loaded a key share which does not match its public key")
+	}
+}
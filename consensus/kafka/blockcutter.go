@@ -0,0 +1,52 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package kafka
+
+import (
+	"github.com/hyperledger/fabric/consensus/util"
+)
+
+// cutBlock is a block of transactions, with the offset of the last one
+type cutBlock struct {
+	number       uint64
+	offset       int64
+	transactions [][]byte
+}
+
+// newCutBlock makes a block of the records a util.BlockCutter cut, nil if
+// there are none
+func newCutBlock(records []interface{}) *cutBlock {
+	if len(records) == 0 {
+		return nil
+	}
+	block := &cutBlock{offset: records[len(records)-1].(record).offset}
+	for _, rec := range records {
+		block.transactions = append(block.transactions, rec.(record).value)
+	}
+	return block
+}
+
+// ordered has the cutter cut the consumed transaction, and returns the blocks
+// it completed.  Every validator consumes the same messages, so cuts the same
+// blocks
+func ordered(cutter *util.BlockCutter, tx record) (blocks []*cutBlock, pending bool) {
+	cut, pending := cutter.Ordered(tx, len(tx.value))
+	for _, records := range cut {
+		blocks = append(blocks, newCutBlock(records))
+	}
+	return blocks, pending
+}
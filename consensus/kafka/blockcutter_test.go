@@ -0,0 +1,39 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package kafka
+
+import (
+	"testing"
+
+	"github.com/hyperledger/fabric/consensus/util"
+)
+
+func TestCutBlockOffsets(t *testing.T) {
+	bc := util.NewBlockCutter(0, 10)
+	ordered(bc, record{offset: 1, value: make([]byte, 6)})
+	blocks, _ := ordered(bc, record{offset: 3, value: make([]byte, 6)})
+	if len(blocks) != 1 || blocks[0].offset != 1 {
+		t.Fatalf("Expected a block up to the offset of the transaction before the one which did not fit, got %v", blocks)
+	}
+	blocks, pending := ordered(bc, record{offset: 4, value: make([]byte, 20)})
+	if len(blocks) != 2 || blocks[0].offset != 3 || blocks[1].offset != 4 || pending {
+		t.Fatalf("Expected the pending transaction and the oversized one in blocks of their own, got %v, pending %v", blocks, pending)
+	}
+	if block := newCutBlock(bc.Cut()); block != nil {
+		t.Errorf("Expected nothing to be pending, got %v", block)
+	}
+}
@@ -0,0 +1,506 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package kafka
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"net"
+	"strconv"
+	"time"
+)
+
+// The client speaks version 0 of the Kafka protocol, which every broker
+// since 0.8 understands, and only the requests the plugin needs: metadata to
+// find the leader of the partition, produce, fetch, and list offsets to
+// recover from an offset the broker no longer has.
+
+const (
+	apiProduce     int16 = 0
+	apiFetch       int16 = 1
+	apiListOffsets int16 = 2
+	apiMetadata    int16 = 3
+)
+
+const (
+	offsetEarliest int64 = -2
+	offsetLatest   int64 = -1
+)
+
+// errOffsetOutOfRange is returned when fetching an offset the broker does
+// not have, it was removed by retention or is beyond the end of the log
+var errOffsetOutOfRange = errors.New("offset out of range")
+
+// kafkaError is an error code returned by the broker
+type kafkaError int16
+
+func (e kafkaError) Error() string {
+	switch e {
+	case 3:
+		return "unknown topic or partition"
+	case 5:
+		return "leader not available"
+	case 6:
+		return "not leader for partition"
+	case 7:
+		return "request timed out"
+	default:
+		return fmt.Sprintf("kafka error code %d", int16(e))
+	}
+}
+
+// record is a message of the partition
+type record struct {
+	offset int64
+	value  []byte
+}
+
+// kafkaClient produces to or fetches from one partition of a topic, through
+// a connection to the leader of the partition
+type kafkaClient struct {
+	brokers   []string
+	clientID  string
+	topic     string
+	partition int32
+	timeout   time.Duration
+
+	conn          net.Conn
+	correlationID int32
+}
+
+func newKafkaClient(brokers []string, clientID, topic string, partition int32, timeout time.Duration) *kafkaClient {
+	return &kafkaClient{
+		brokers:   brokers,
+		clientID:  clientID,
+		topic:     topic,
+		partition: partition,
+		timeout:   timeout,
+	}
+}
+
+// connect connects to the leader of the partition, as reported by the first
+// bootstrap broker which answers
+func (c *kafkaClient) connect() error {
+	c.close()
+	var lastErr error
+	for _, addr := range c.brokers {
+		leader, err := c.lookupLeader(addr)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		conn, err := net.DialTimeout("tcp", leader, c.timeout)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		c.conn = conn
+		return nil
+	}
+	return fmt.Errorf("Cannot connect to the leader of %s/%d: %v", c.topic, c.partition, lastErr)
+}
+
+func (c *kafkaClient) close() {
+	if c.conn != nil {
+		c.conn.Close()
+		c.conn = nil
+	}
+}
+
+func (c *kafkaClient) lookupLeader(addr string) (string, error) {
+	conn, err := net.DialTimeout("tcp", addr, c.timeout)
+	if err != nil {
+		return "", err
+	}
+	defer conn.Close()
+
+	req := &encoder{}
+	req.putArrayLen(1)
+	req.putString(c.topic)
+	resp, err := c.roundTrip(conn, apiMetadata, req.Bytes(), c.timeout)
+	if err != nil {
+		return "", err
+	}
+
+	hosts := make(map[int32]string)
+	for n := resp.getArrayLen(); n > 0; n-- {
+		id := resp.getInt32()
+		host := resp.getString()
+		port := resp.getInt32()
+		hosts[id] = net.JoinHostPort(host, strconv.Itoa(int(port)))
+	}
+	for n := resp.getArrayLen(); n > 0; n-- {
+		topicErr := resp.getInt16()
+		topic := resp.getString()
+		for p := resp.getArrayLen(); p > 0; p-- {
+			partErr := resp.getInt16()
+			partition := resp.getInt32()
+			leader := resp.getInt32()
+			for r := resp.getArrayLen(); r > 0; r-- {
+				resp.getInt32() // replicas
+			}
+			for r := resp.getArrayLen(); r > 0; r-- {
+				resp.getInt32() // in-sync replicas
+			}
+			if topic != c.topic || partition != c.partition {
+				continue
+			}
+			if topicErr != 0 {
+				return "", kafkaError(topicErr)
+			}
+			if partErr != 0 {
+				return "", kafkaError(partErr)
+			}
+			if host, ok := hosts[leader]; ok && resp.err == nil {
+				return host, nil
+			}
+		}
+	}
+	if resp.err != nil {
+		return "", resp.err
+	}
+	return "", fmt.Errorf("Broker %s knows no leader of %s/%d", addr, c.topic, c.partition)
+}
+
+// produce appends a message to the partition, and returns its offset
+func (c *kafkaClient) produce(value []byte) (int64, error) {
+	set := &encoder{}
+	putMessage(set, 0, value)
+
+	req := &encoder{}
+	req.putInt16(1) // acks, the leader wrote the message
+	req.putInt32(int32(c.timeout / time.Millisecond))
+	req.putArrayLen(1)
+	req.putString(c.topic)
+	req.putArrayLen(1)
+	req.putInt32(c.partition)
+	req.putBytes(set.Bytes())
+
+	resp, err := c.request(apiProduce, req.Bytes(), c.timeout)
+	if err != nil {
+		return 0, err
+	}
+	for n := resp.getArrayLen(); n > 0; n-- {
+		resp.getString()
+		for p := resp.getArrayLen(); p > 0; p-- {
+			resp.getInt32()
+			code := resp.getInt16()
+			offset := resp.getInt64()
+			if resp.err != nil {
+				break
+			}
+			if code != 0 {
+				return 0, kafkaError(code)
+			}
+			return offset, nil
+		}
+	}
+	return 0, fmt.Errorf("Malformed produce response: %v", resp.err)
+}
+
+// fetch returns the messages of the partition from an offset on, waiting up
+// to maxWait for at least one
+func (c *kafkaClient) fetch(offset int64, maxBytes int32, maxWait time.Duration) ([]record, error) {
+	req := &encoder{}
+	req.putInt32(-1) // replica ID of a consumer
+	req.putInt32(int32(maxWait / time.Millisecond))
+	req.putInt32(1) // min bytes
+	req.putArrayLen(1)
+	req.putString(c.topic)
+	req.putArrayLen(1)
+	req.putInt32(c.partition)
+	req.putInt64(offset)
+	req.putInt32(maxBytes)
+
+	resp, err := c.request(apiFetch, req.Bytes(), c.timeout+maxWait)
+	if err != nil {
+		return nil, err
+	}
+	for n := resp.getArrayLen(); n > 0; n-- {
+		resp.getString()
+		for p := resp.getArrayLen(); p > 0; p-- {
+			resp.getInt32()
+			code := resp.getInt16()
+			resp.getInt64() // high watermark
+			set := resp.getBytes()
+			if resp.err != nil {
+				break
+			}
+			if code == 1 {
+				return nil, errOffsetOutOfRange
+			}
+			if code != 0 {
+				return nil, kafkaError(code)
+			}
+			return getMessages(set, offset)
+		}
+	}
+	return nil, fmt.Errorf("Malformed fetch response: %v", resp.err)
+}
+
+// offset returns the earliest or latest offset of the partition
+func (c *kafkaClient) offset(when int64) (int64, error) {
+	req := &encoder{}
+	req.putInt32(-1)
+	req.putArrayLen(1)
+	req.putString(c.topic)
+	req.putArrayLen(1)
+	req.putInt32(c.partition)
+	req.putInt64(when)
+	req.putInt32(1)
+
+	resp, err := c.request(apiListOffsets, req.Bytes(), c.timeout)
+	if err != nil {
+		return 0, err
+	}
+	for n := resp.getArrayLen(); n > 0; n-- {
+		resp.getString()
+		for p := resp.getArrayLen(); p > 0; p-- {
+			resp.getInt32()
+			code := resp.getInt16()
+			count := resp.getArrayLen()
+			if resp.err != nil {
+				break
+			}
+			if code != 0 {
+				return 0, kafkaError(code)
+			}
+			if count < 1 {
+				return 0, fmt.Errorf("Broker returned no offset for %s/%d", c.topic, c.partition)
+			}
+			return resp.getInt64(), resp.err
+		}
+	}
+	return 0, fmt.Errorf("Malformed list offsets response: %v", resp.err)
+}
+
+// request sends a request to the leader, connecting first if needed; the
+// connection is dropped on any error, so that the next request reconnects
+func (c *kafkaClient) request(apiKey int16, body []byte, timeout time.Duration) (*decoder, error) {
+	if c.conn == nil {
+		if err := c.connect(); err != nil {
+			return nil, err
+		}
+	}
+	resp, err := c.roundTrip(c.conn, apiKey, body, timeout)
+	if err != nil {
+		c.close()
+		return nil, err
+	}
+	return resp, nil
+}
+
+func (c *kafkaClient) roundTrip(conn net.Conn, apiKey int16, body []byte, timeout time.Duration) (*decoder, error) {
+	c.correlationID++
+	req := &encoder{}
+	req.putInt16(apiKey)
+	req.putInt16(0) // api version
+	req.putInt32(c.correlationID)
+	req.putString(c.clientID)
+	req.Write(body)
+
+	frame := make([]byte, 4, 4+req.Len())
+	binary.BigEndian.PutUint32(frame, uint32(req.Len()))
+	frame = append(frame, req.Bytes()...)
+
+	conn.SetDeadline(time.Now().Add(timeout))
+	if _, err := conn.Write(frame); err != nil {
+		return nil, err
+	}
+	var size int32
+	if err := binary.Read(conn, binary.BigEndian, &size); err != nil {
+		return nil, err
+	}
+	if size < 4 {
+		return nil, fmt.Errorf("Malformed response of %d bytes", size)
+	}
+	buf := make([]byte, size)
+	if _, err := io.ReadFull(conn, buf); err != nil {
+		return nil, err
+	}
+	resp := &decoder{buf: buf}
+	if id := resp.getInt32(); id != c.correlationID {
+		return nil, fmt.Errorf("Response to request %d received for request %d", id, c.correlationID)
+	}
+	return resp, nil
+}
+
+// putMessage encodes a message of a message set, with a null key
+func putMessage(e *encoder, offset int64, value []byte) {
+	msg := &encoder{}
+	msg.putInt8(0) // magic
+	msg.putInt8(0) // attributes, no compression
+	msg.putBytes(nil)
+	msg.putBytes(value)
+
+	e.putInt64(offset)
+	e.putInt32(int32(4 + msg.Len()))
+	e.putInt32(int32(crc32.ChecksumIEEE(msg.Bytes())))
+	e.Write(msg.Bytes())
+}
+
+// getMessages decodes a message set, skipping the messages below an offset
+// and ignoring the partial message the broker may end it with
+func getMessages(set []byte, from int64) ([]record, error) {
+	var records []record
+	d := &decoder{buf: set}
+	for len(d.buf)-d.off >= 12 {
+		offset := d.getInt64()
+		size := d.getInt32()
+		if size < 0 || int(size) > len(d.buf)-d.off {
+			break // partial message
+		}
+		msg := &decoder{buf: d.buf[d.off : d.off+int(size)]}
+		d.off += int(size)
+
+		crc := uint32(msg.getInt32())
+		if msg.err == nil && crc != crc32.ChecksumIEEE(msg.buf[msg.off:]) {
+			return records, fmt.Errorf("Message at offset %d is corrupted", offset)
+		}
+		msg.getInt8() // magic
+		if attributes := msg.getInt8(); attributes&0x07 != 0 {
+			return records, fmt.Errorf("Message at offset %d is compressed, which is not supported", offset)
+		}
+		msg.getBytes() // key
+		value := msg.getBytes()
+		if msg.err != nil {
+			return records, fmt.Errorf("Message at offset %d is malformed: %s", offset, msg.err)
+		}
+		if offset >= from {
+			records = append(records, record{offset: offset, value: value})
+		}
+	}
+	return records, nil
+}
+
+// encoder writes the big-endian primitives of the protocol
+type encoder struct {
+	bytes.Buffer
+}
+
+func (e *encoder) putInt8(v int8) {
+	e.WriteByte(byte(v))
+}
+
+func (e *encoder) putInt16(v int16) {
+	binary.Write(e, binary.BigEndian, v)
+}
+
+func (e *encoder) putInt32(v int32) {
+	binary.Write(e, binary.BigEndian, v)
+}
+
+func (e *encoder) putInt64(v int64) {
+	binary.Write(e, binary.BigEndian, v)
+}
+
+func (e *encoder) putArrayLen(n int) {
+	e.putInt32(int32(n))
+}
+
+func (e *encoder) putString(s string) {
+	e.putInt16(int16(len(s)))
+	e.WriteString(s)
+}
+
+// putBytes writes a byte array, nil as null
+func (e *encoder) putBytes(b []byte) {
+	if b == nil {
+		e.putInt32(-1)
+		return
+	}
+	e.putInt32(int32(len(b)))
+	e.Write(b)
+}
+
+// decoder reads the big-endian primitives of the protocol, after the first
+// error it returns zero values and keeps the error
+type decoder struct {
+	buf []byte
+	off int
+	err error
+}
+
+func (d *decoder) next(n int) []byte {
+	if d.err != nil {
+		return nil
+	}
+	if n < 0 || len(d.buf)-d.off < n {
+		d.err = io.ErrUnexpectedEOF
+		return nil
+	}
+	b := d.buf[d.off : d.off+n]
+	d.off += n
+	return b
+}
+
+func (d *decoder) getInt8() int8 {
+	if b := d.next(1); b != nil {
+		return int8(b[0])
+	}
+	return 0
+}
+
+func (d *decoder) getInt16() int16 {
+	if b := d.next(2); b != nil {
+		return int16(binary.BigEndian.Uint16(b))
+	}
+	return 0
+}
+
+func (d *decoder) getInt32() int32 {
+	if b := d.next(4); b != nil {
+		return int32(binary.BigEndian.Uint32(b))
+	}
+	return 0
+}
+
+func (d *decoder) getInt64() int64 {
+	if b := d.next(8); b != nil {
+		return int64(binary.BigEndian.Uint64(b))
+	}
+	return 0
+}
+
+func (d *decoder) getArrayLen() int {
+	n := int(d.getInt32())
+	if n < 0 || n > len(d.buf)-d.off {
+		// every element takes at least a byte
+		n = 0
+	}
+	return n
+}
+
+func (d *decoder) getString() string {
+	n := d.getInt16()
+	if n < 0 {
+		return ""
+	}
+	return string(d.next(int(n)))
+}
+
+func (d *decoder) getBytes() []byte {
+	n := d.getInt32()
+	if n < 0 {
+		return nil
+	}
+	return d.next(int(n))
+}
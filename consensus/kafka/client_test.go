@@ -0,0 +1,122 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package kafka
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func newTestClient(b *mockBroker) *kafkaClient {
+	return newKafkaClient([]string{b.addr()}, "test", "fabric", 0, time.Second)
+}
+
+func TestClientProduceFetch(t *testing.T) {
+	b := newMockBroker(t)
+	defer b.close()
+	c := newTestClient(b)
+	defer c.close()
+
+	for i := 0; i < 3; i++ {
+		offset, err := c.produce([]byte(fmt.Sprintf("msg%d", i)))
+		if err != nil || offset != int64(i) {
+			t.Fatalf("Expected message %d to be produced at offset %d, got %d: %v", i, i, offset, err)
+		}
+	}
+
+	records, err := c.fetch(1, 1024, 10*time.Millisecond)
+	if err != nil {
+		t.Fatalf("Could not fetch: %s", err)
+	}
+	if len(records) != 2 || records[0].offset != 1 || string(records[1].value) != "msg2" {
+		t.Errorf("Expected messages 1 and 2, got %v", records)
+	}
+
+	if records, err = c.fetch(3, 1024, 10*time.Millisecond); err != nil || len(records) != 0 {
+		t.Errorf("Expected no message past the end of the partition, got %v: %v", records, err)
+	}
+}
+
+func TestClientOffsetOutOfRange(t *testing.T) {
+	b := newMockBroker(t)
+	defer b.close()
+	c := newTestClient(b)
+	defer c.close()
+
+	for i := 0; i < 3; i++ {
+		c.produce([]byte("msg"))
+	}
+	b.truncate(2)
+
+	if _, err := c.fetch(0, 1024, 10*time.Millisecond); err != errOffsetOutOfRange {
+		t.Errorf("Expected fetching a removed offset to fail as out of range, got %v", err)
+	}
+	if earliest, err := c.offset(offsetEarliest); err != nil || earliest != 2 {
+		t.Errorf("Expected earliest offset 2, got %d: %v", earliest, err)
+	}
+	if latest, err := c.offset(offsetLatest); err != nil || latest != 3 {
+		t.Errorf("Expected latest offset 3, got %d: %v", latest, err)
+	}
+}
+
+func TestClientReconnects(t *testing.T) {
+	b := newMockBroker(t)
+	defer b.close()
+	c := newTestClient(b)
+	defer c.close()
+
+	if _, err := c.produce([]byte("msg0")); err != nil {
+		t.Fatalf("Could not produce: %s", err)
+	}
+	b.dropConnections()
+	c.produce([]byte("msg1")) // may fail on the dropped connection
+	if _, err := c.produce([]byte("msg2")); err != nil {
+		t.Fatalf("Expected the client to reconnect, got %s", err)
+	}
+}
+
+func TestClientUnknownTopic(t *testing.T) {
+	b := newMockBroker(t)
+	defer b.close()
+	c := newKafkaClient([]string{b.addr()}, "test", "other", 0, time.Second)
+	defer c.close()
+
+	if _, err := c.produce([]byte("msg")); err == nil {
+		t.Errorf("Expected producing to an unknown topic to fail")
+	}
+}
+
+func TestMessageSet(t *testing.T) {
+	set := &encoder{}
+	putMessage(set, 4, []byte("a"))
+	putMessage(set, 5, []byte("b"))
+	raw := set.Bytes()
+
+	records, err := getMessages(raw[:len(raw)-3], 4)
+	if err != nil || len(records) != 1 || string(records[0].value) != "a" {
+		t.Errorf("Expected the partial last message to be ignored, got %v: %v", records, err)
+	}
+	if records, _ = getMessages(raw, 5); len(records) != 1 || records[0].offset != 5 {
+		t.Errorf("Expected the messages below the offset to be skipped, got %v", records)
+	}
+
+	raw[len(raw)-1] ^= 0xff
+	if _, err = getMessages(raw, 4); err == nil {
+		t.Errorf("Expected a corrupted message to fail its checksum")
+	}
+}
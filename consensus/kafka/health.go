@@ -0,0 +1,62 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package kafka
+
+import (
+	"fmt"
+
+	"github.com/hyperledger/fabric/consensus"
+	"github.com/hyperledger/fabric/consensus/util/events"
+)
+
+// Health reports the replica unhealthy while it fails to produce to or
+// consume from the brokers, or if its main thread is stuck
+func (op *obcKafka) Health() consensus.Health {
+	op.errLock.Lock()
+	produceErr, consumeErr := op.produceErr, op.consumeErr
+	op.errLock.Unlock()
+	if consumeErr != nil {
+		return consensus.Health{Detail: fmt.Sprintf("cannot consume from the brokers: %s", consumeErr)}
+	}
+	if produceErr != nil {
+		return consensus.Health{Detail: fmt.Sprintf("cannot produce to the brokers: %s", produceErr)}
+	}
+
+	var health consensus.Health
+	if !events.OnMainThread(op.manager, func() {
+		health.Healthy = true
+		health.Detail = fmt.Sprintf("last block %d, consumed up to offset %d", op.blockNumber, op.lastOffset)
+	}) {
+		return consensus.Health{Detail: fmt.Sprintf("main thread unresponsive for %v", events.MainThreadTimeout)}
+	}
+	return health
+}
+
+// Metrics reports the progress of the replica
+func (op *obcKafka) Metrics() consensus.Metrics {
+	var metrics consensus.Metrics
+	events.OnMainThread(op.manager, func() {
+		metrics = consensus.Metrics{
+			"kafka.blockNumber":         float64(op.blockNumber),
+			"kafka.offset":              float64(op.lastOffset),
+			"kafka.queuedBlocks":        float64(len(op.blocks)),
+			"kafka.pendingTransactions": float64(op.cutter.Pending()),
+			"kafka.toProduce":           float64(len(op.toProduce)),
+		}
+	})
+	return metrics
+}
@@ -0,0 +1,510 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package kafka
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/op/go-logging"
+	"github.com/spf13/viper"
+
+	"github.com/hyperledger/fabric/consensus"
+	"github.com/hyperledger/fabric/consensus/util"
+	"github.com/hyperledger/fabric/consensus/util/events"
+	pb "github.com/hyperledger/fabric/protos"
+)
+
+// Kafka orders the transactions: every validator produces the transactions
+// it receives to the partition of the chain, and consumes the partition.
+// The validators cut the consumed transactions into blocks themselves, so
+// they must cut them deterministically: by message count and bytes, and on
+// a time-to-cut message a validator produces when its batch timer expires.
+// The block metadata holds the offset of the last message of the block,
+// from which a restarted validator consumes again.
+
+const configPrefix = "CORE_KAFKA"
+
+var logger *logging.Logger // package-level logger
+
+var pluginInstance consensus.Consenter // singleton service
+
+func init() {
+	logger = logging.MustGetLogger("consensus/kafka")
+}
+
+// GetPlugin returns the handle to the Consenter singleton
+func GetPlugin(c consensus.Stack) consensus.Consenter {
+	if pluginInstance == nil {
+		pluginInstance = New(c)
+	}
+	return pluginInstance
+}
+
+// New creates a new obcKafka instance that provides the Consenter interface
+func New(stack consensus.Stack) consensus.Consenter {
+	handle, _, _ := stack.GetNetworkHandles()
+	config := loadConfig()
+
+	var brokers []string
+	for _, broker := range strings.Split(config.GetString("general.brokers"), ",") {
+		if broker = strings.TrimSpace(broker); broker != "" {
+			brokers = append(brokers, broker)
+		}
+	}
+	topic := config.GetString("general.topic")
+	partitionID := int32(config.GetInt("general.partition"))
+	timeout, err := time.ParseDuration(config.GetString("general.timeout"))
+	if err != nil {
+		panic(fmt.Errorf("Cannot parse timeout: %s", err))
+	}
+	logger.Infof("Kafka brokers = %v, partition = %s/%d", brokers, topic, partitionID)
+
+	newPartition := func() partition {
+		return newKafkaClient(brokers, "fabric-"+handle.Name, topic, partitionID, timeout)
+	}
+	return newObcKafka(handle.Name, config, stack, newPartition)
+}
+
+func loadConfig() (config *viper.Viper) {
+	config = viper.New()
+
+	// for environment variables
+	config.SetEnvPrefix(configPrefix)
+	config.AutomaticEnv()
+	replacer := strings.NewReplacer(".", "_")
+	config.SetEnvKeyReplacer(replacer)
+
+	config.SetConfigName("config")
+	config.AddConfigPath("./")
+	config.AddConfigPath("../consensus/kafka/")
+	config.AddConfigPath("../../consensus/kafka")
+	// Path to look for the config file in based on GOPATH
+	gopath := os.Getenv("GOPATH")
+	for _, p := range filepath.SplitList(gopath) {
+		kafkapath := filepath.Join(p, "src/github.com/hyperledger/fabric/consensus/kafka")
+		config.AddConfigPath(kafkapath)
+	}
+
+	err := config.ReadInConfig()
+	if err != nil {
+		panic(fmt.Errorf("Error reading %s plugin config: %s", configPrefix, err))
+	}
+	return
+}
+
+// partition is the ordered stream of messages of the chain, a Kafka
+// partition through a kafkaClient
+type partition interface {
+	produce(value []byte) (int64, error)
+	fetch(offset int64, maxBytes int32, maxWait time.Duration) ([]record, error)
+	offset(when int64) (int64, error)
+	close()
+}
+
+type obcKafka struct {
+	name    string
+	stack   consensus.Stack
+	manager events.Manager
+
+	newPartition    func() partition
+	toProduce       chan []byte
+	fetchMaxBytes   int32
+	fetchMaxWait    time.Duration
+	retryBackoff    time.Duration
+	retryMaxBackoff time.Duration
+	exit            chan struct{}
+
+	errLock    sync.Mutex
+	produceErr error // last error producing, nil since a message was produced
+	consumeErr error // last error consuming, nil since a fetch succeeded
+
+	cutter       *util.BlockCutter
+	batchTimer   events.Timer
+	batchTimeout time.Duration
+
+	blockNumber uint64      // number of the last block cut
+	lastOffset  int64       // offset of the last message consumed, -1 if none
+	executing   bool        // whether a block is being executed
+	blocks      []*cutBlock // cut blocks waiting for execution
+}
+
+// Event types
+
+// consumedEvent is sent when a message of the partition was consumed
+type consumedEvent record
+
+// consumeEvent is sent to start consuming
+type consumeEvent struct{}
+
+// batchTimerEvent is sent when the batch timer expires
+type batchTimerEvent struct{}
+
+// executedEvent is sent when the transactions of a block were executed
+type executedEvent struct {
+	block *cutBlock
+}
+
+// committedEvent is sent when a block was committed
+type committedEvent struct {
+	block *cutBlock
+}
+
+func newObcKafka(name string, config *viper.Viper, stack consensus.Stack, newPartition func() partition) *obcKafka {
+	op := &obcKafka{
+		name:         name,
+		stack:        stack,
+		newPartition: newPartition,
+		exit:         make(chan struct{}),
+		lastOffset:   -1,
+	}
+
+	parseDuration := func(key string) time.Duration {
+		d, err := time.ParseDuration(config.GetString(key))
+		if err != nil {
+			panic(fmt.Errorf("Cannot parse %s: %s", key, err))
+		}
+		return d
+	}
+	op.cutter = util.NewBlockCutter(config.GetInt("general.batch.maxmessagecount"), config.GetInt("general.batch.maxbytes"))
+	op.batchTimeout = parseDuration("general.batch.timeout")
+	op.fetchMaxBytes = int32(config.GetInt("general.fetch.maxbytes"))
+	op.fetchMaxWait = parseDuration("general.fetch.maxwait")
+	op.retryBackoff = parseDuration("general.retry.backoff")
+	op.retryMaxBackoff = parseDuration("general.retry.maxbackoff")
+	op.toProduce = make(chan []byte, config.GetInt("general.queuesize"))
+
+	logger.Infof("Kafka batch max message count = %d", op.cutter.MaxMessageCount())
+	logger.Infof("Kafka batch max bytes = %d", op.cutter.MaxBytes())
+	logger.Infof("Kafka batch timeout = %v", op.batchTimeout)
+	logger.Infof("Kafka fetch max bytes = %d, max wait = %v", op.fetchMaxBytes, op.fetchMaxWait)
+	logger.Infof("Kafka retry backoff = %v, max backoff = %v", op.retryBackoff, op.retryMaxBackoff)
+
+	op.manager = events.NewManagerImpl()
+	op.manager.SetReceiver(op)
+	etf := events.NewTimerFactoryImpl(op.manager)
+	op.batchTimer = etf.CreateTimer()
+
+	op.restoreState()
+	op.manager.Start()
+	go op.produce()
+	// consume once the stack is set up to call us back, as executing the
+	// consumed blocks needs it
+	op.batchTimer.Reset(op.retryBackoff, consumeEvent{})
+
+	return op
+}
+
+// restoreState restores the number and offset of the last committed block,
+// the validator consumes again the messages after it
+func (op *obcKafka) restoreState() {
+	raw, err := op.stack.GetBlockHeadMetadata()
+	if err != nil {
+		logger.Warningf("Replica %s could not read the metadata of its last block: %s", op.name, err)
+		return
+	}
+	if raw == nil {
+		return
+	}
+	meta := &Metadata{}
+	if err := proto.Unmarshal(raw, meta); err != nil {
+		logger.Warningf("Replica %s could not unmarshal the metadata of its last block: %s", op.name, err)
+		return
+	}
+	op.blockNumber = meta.BlockNumber
+	op.lastOffset = meta.Offset
+	logger.Infof("Replica %s restored last block %d, consuming from offset %d", op.name, op.blockNumber, op.lastOffset+1)
+}
+
+// Close tells us to release resources we are holding
+func (op *obcKafka) Close() {
+	close(op.exit)
+	op.batchTimer.Halt()
+	op.manager.Halt()
+}
+
+// RecvMsg is called by the stack when a new message is received
+func (op *obcKafka) RecvMsg(ocMsg *pb.Message, senderHandle *pb.PeerID) error {
+	if ocMsg.Type != pb.Message_CHAIN_TRANSACTION {
+		return fmt.Errorf("Unexpected message type: %s", ocMsg.Type)
+	}
+	payload, err := proto.Marshal(&Message{Payload: &Message_Transaction{Transaction: ocMsg.Payload}})
+	if err != nil {
+		return err
+	}
+	select {
+	case op.toProduce <- payload:
+		return nil
+	default:
+		return consensus.ErrBusy
+	}
+}
+
+// Executed is called whenever Execute completes
+func (op *obcKafka) Executed(tag interface{}) {
+	op.manager.Queue() <- executedEvent{tag.(*cutBlock)}
+}
+
+// Committed is called whenever Commit completes
+func (op *obcKafka) Committed(tag interface{}, target *pb.BlockchainInfo) {
+	op.manager.Queue() <- committedEvent{tag.(*cutBlock)}
+}
+
+// RolledBack is called whenever a Rollback completes, kafka never rolls back
+func (op *obcKafka) RolledBack(tag interface{}) {
+	logger.Warningf("Replica %s unexpectedly rolled back an execution", op.name)
+}
+
+// StateUpdated is called when state transfer completes, kafka never transfers state
+func (op *obcKafka) StateUpdated(tag interface{}, target *pb.BlockchainInfo) {
+	logger.Warningf("Replica %s unexpectedly transferred state", op.name)
+}
+
+// ProcessEvent serially processes the events of the replica
+func (op *obcKafka) ProcessEvent(event events.Event) events.Event {
+	switch et := event.(type) {
+	case consumeEvent:
+		go op.consume(op.lastOffset + 1)
+	case consumedEvent:
+		op.recvRecord(record(et))
+	case batchTimerEvent:
+		logger.Debugf("Replica %s batch timer expired", op.name)
+		op.produceMsg(&Message{Payload: &Message_TimeToCut{TimeToCut: op.blockNumber + 1}})
+	case executedEvent:
+		meta, _ := proto.Marshal(&Metadata{BlockNumber: et.block.number, Offset: et.block.offset})
+		op.stack.Commit(et.block, meta)
+	case committedEvent:
+		logger.Debugf("Replica %s committed block %d", op.name, et.block.number)
+		op.executing = false
+		op.executeNext()
+	case events.WorkEvent:
+		et()
+	default:
+		logger.Warningf("Replica %s received an unknown event type (%T)", op.name, et)
+	}
+	return nil
+}
+
+// recvRecord cuts the consumed messages into blocks
+func (op *obcKafka) recvRecord(rec record) {
+	if rec.offset <= op.lastOffset {
+		return // consumed again after reconnecting
+	}
+	op.lastOffset = rec.offset
+
+	msg := &Message{}
+	if err := proto.Unmarshal(rec.value, msg); err != nil {
+		logger.Warningf("Replica %s could not unmarshal the message at offset %d: %s", op.name, rec.offset, err)
+		return
+	}
+
+	switch payload := msg.Payload.(type) {
+	case *Message_Transaction:
+		blocks, pending := ordered(op.cutter, record{offset: rec.offset, value: payload.Transaction})
+		for _, block := range blocks {
+			op.cut(block)
+		}
+		if !pending {
+			op.batchTimer.Stop()
+		} else if len(blocks) > 0 {
+			op.batchTimer.Reset(op.batchTimeout, batchTimerEvent{})
+		} else {
+			op.batchTimer.SoftReset(op.batchTimeout, batchTimerEvent{})
+		}
+	case *Message_TimeToCut:
+		if payload.TimeToCut != op.blockNumber+1 {
+			return // another validator's timer expired first
+		}
+		if block := newCutBlock(op.cutter.Cut()); block != nil {
+			op.cut(block)
+		}
+		op.batchTimer.Stop()
+	default:
+		logger.Warningf("Replica %s consumed an invalid message at offset %d", op.name, rec.offset)
+	}
+}
+
+// cut numbers a block and queues it for execution
+func (op *obcKafka) cut(block *cutBlock) {
+	op.blockNumber++
+	block.number = op.blockNumber
+	logger.Debugf("Replica %s cut block %d of %d transactions, up to offset %d", op.name, block.number, len(block.transactions), block.offset)
+	op.blocks = append(op.blocks, block)
+	op.executeNext()
+}
+
+// executeNext executes the next block, once the last one committed
+func (op *obcKafka) executeNext() {
+	if op.executing || len(op.blocks) == 0 {
+		return
+	}
+	block := op.blocks[0]
+	op.blocks = op.blocks[1:]
+	op.executing = true
+
+	var txs []*pb.Transaction
+	for _, raw := range block.transactions {
+		tx := &pb.Transaction{}
+		if err := proto.Unmarshal(raw, tx); err != nil {
+			logger.Warningf("Replica %s could not unmarshal transaction: %s", op.name, err)
+			continue
+		}
+		txs = append(txs, tx)
+	}
+	logger.Debugf("Replica %s executing block %d containing %d transactions", op.name, block.number, len(txs))
+	op.stack.Execute(block, txs)
+}
+
+func (op *obcKafka) produceMsg(msg *Message) {
+	payload, err := proto.Marshal(msg)
+	if err != nil {
+		logger.Errorf("Replica %s could not marshal message: %s", op.name, err)
+		return
+	}
+	select {
+	case op.toProduce <- payload:
+	default:
+		logger.Warningf("Replica %s could not queue message to produce, the queue is full", op.name)
+	}
+}
+
+// produce produces the queued messages in order, retrying each until the
+// broker acknowledges it.  A message whose acknowledgement was lost is
+// produced twice, the second copy of a transaction fails as a duplicate.
+func (op *obcKafka) produce() {
+	producer := op.newPartition()
+	defer producer.close()
+
+	for {
+		var payload []byte
+		select {
+		case payload = <-op.toProduce:
+		case <-op.exit:
+			return
+		}
+		for backoff := op.retryBackoff; ; backoff = op.nextBackoff(backoff) {
+			_, err := producer.produce(payload)
+			op.setBrokerErr(&op.produceErr, err)
+			if err == nil {
+				break
+			}
+			logger.Warningf("Replica %s could not produce, retrying in %v: %s", op.name, backoff, err)
+			if !op.sleep(backoff) {
+				return
+			}
+		}
+	}
+}
+
+// consume fetches the messages of the partition from an offset on, and
+// reconnects after the broker failed
+func (op *obcKafka) consume(offset int64) {
+	consumer := op.newPartition()
+	defer consumer.close()
+
+	backoff := op.retryBackoff
+	for {
+		select {
+		case <-op.exit:
+			return
+		default:
+		}
+
+		records, err := consumer.fetch(offset, op.fetchMaxBytes, op.fetchMaxWait)
+		if err == errOffsetOutOfRange {
+			offset, err = op.recoverOffset(consumer, offset)
+			if err == nil {
+				continue
+			}
+		}
+		op.setBrokerErr(&op.consumeErr, err)
+		if err != nil {
+			logger.Warningf("Replica %s could not consume from offset %d, retrying in %v: %s", op.name, offset, backoff, err)
+			if !op.sleep(backoff) {
+				return
+			}
+			backoff = op.nextBackoff(backoff)
+			continue
+		}
+		backoff = op.retryBackoff
+
+		for _, rec := range records {
+			select {
+			case op.manager.Queue() <- consumedEvent(rec):
+			case <-op.exit:
+				return
+			}
+			offset = rec.offset + 1
+		}
+	}
+}
+
+// recoverOffset returns the offset to consume from, when the partition does
+// not have the requested one.  A validator starting on an empty ledger
+// consumes from the earliest offset, one which lost messages to retention
+// cannot execute the blocks they were cut into, and diverges.
+func (op *obcKafka) recoverOffset(consumer partition, offset int64) (int64, error) {
+	earliest, err := consumer.offset(offsetEarliest)
+	if err != nil {
+		return offset, err
+	}
+	if offset >= earliest {
+		latest, err := consumer.offset(offsetLatest)
+		if err != nil {
+			return offset, err
+		}
+		if offset <= latest {
+			return offset, nil
+		}
+		logger.Errorf("Replica %s consumed up to offset %d, but partition ends at offset %d, was the topic recreated?", op.name, offset-1, latest)
+		return offset, fmt.Errorf("offset %d beyond the end of the partition", offset)
+	}
+	if offset > 0 {
+		logger.Errorf("Replica %s missed messages %d to %d, removed by the broker before it consumed them", op.name, offset, earliest-1)
+	} else {
+		logger.Infof("Replica %s consuming from the earliest offset %d", op.name, earliest)
+	}
+	return earliest, nil
+}
+
+func (op *obcKafka) setBrokerErr(last *error, err error) {
+	op.errLock.Lock()
+	defer op.errLock.Unlock()
+	*last = err
+}
+
+func (op *obcKafka) nextBackoff(backoff time.Duration) time.Duration {
+	if backoff *= 2; backoff > op.retryMaxBackoff {
+		backoff = op.retryMaxBackoff
+	}
+	return backoff
+}
+
+// sleep waits for a duration, and returns false if the replica closed first
+func (op *obcKafka) sleep(d time.Duration) bool {
+	select {
+	case <-time.After(d):
+		return true
+	case <-op.exit:
+		return false
+	}
+}
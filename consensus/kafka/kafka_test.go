@@ -0,0 +1,299 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package kafka
+
+import (
+	"fmt"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/spf13/viper"
+
+	"github.com/hyperledger/fabric/consensus"
+	pb "github.com/hyperledger/fabric/protos"
+)
+
+// testStack implements the parts of the stack kafka uses, the rest of
+// consensus.Stack panics if called
+type testStack struct {
+	consensus.Stack
+
+	op *obcKafka
+
+	mutex  sync.Mutex
+	ledger [][]string // transaction IDs of the committed blocks
+	meta   []byte
+	txs    []string // executed but not committed yet
+}
+
+type testNetwork struct {
+	broker *mockBroker
+	config *viper.Viper
+	stacks []*testStack
+}
+
+func newTestNetwork(t *testing.T, n int) *testNetwork {
+	config := loadConfig()
+	config.Set("general.batch.maxmessagecount", 2)
+	config.Set("general.batch.timeout", "1h")
+	config.Set("general.fetch.maxwait", "10ms")
+	config.Set("general.retry.backoff", "10ms")
+	net := &testNetwork{broker: newMockBroker(t), config: config}
+	for i := 0; i < n; i++ {
+		net.stacks = append(net.stacks, &testStack{})
+	}
+	return net
+}
+
+func (net *testNetwork) start() {
+	for i := range net.stacks {
+		net.restart(i)
+	}
+}
+
+// restart starts a validator again on its ledger
+func (net *testNetwork) restart(i int) {
+	s := net.stacks[i]
+	if s.op != nil {
+		s.op.Close()
+	}
+	newPartition := func() partition {
+		return newTestClient(net.broker)
+	}
+	s.op = newObcKafka(fmt.Sprintf("vp%d", i), net.config, s, newPartition)
+}
+
+func (net *testNetwork) stop() {
+	for _, s := range net.stacks {
+		s.op.Close()
+	}
+	net.broker.close()
+}
+
+func (net *testNetwork) submit(i int, tag int) {
+	tx, _ := proto.Marshal(&pb.Transaction{Uuid: fmt.Sprintf("tx%d", tag)})
+	net.stacks[i].op.RecvMsg(&pb.Message{Type: pb.Message_CHAIN_TRANSACTION, Payload: tx}, nil)
+}
+
+// waitFor polls until every stack committed the transactions
+func (net *testNetwork) waitFor(count int) bool {
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(time.Millisecond) {
+		done := true
+		for _, s := range net.stacks {
+			if len(s.txIDs()) < count {
+				done = false
+			}
+		}
+		if done {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *testStack) txIDs() []string {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	var ids []string
+	for _, block := range s.ledger {
+		ids = append(ids, block...)
+	}
+	return ids
+}
+
+func (s *testStack) blocks() [][]string {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return append([][]string(nil), s.ledger...)
+}
+
+func (s *testStack) metadata() *Metadata {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	meta := &Metadata{}
+	proto.Unmarshal(s.meta, meta)
+	return meta
+}
+
+func (s *testStack) Execute(tag interface{}, txs []*pb.Transaction) {
+	s.mutex.Lock()
+	for _, tx := range txs {
+		s.txs = append(s.txs, tx.Uuid)
+	}
+	op := s.op
+	s.mutex.Unlock()
+	go op.Executed(tag)
+}
+
+func (s *testStack) Commit(tag interface{}, metadata []byte) {
+	s.mutex.Lock()
+	s.ledger = append(s.ledger, s.txs)
+	s.txs = nil
+	s.meta = metadata
+	op := s.op
+	s.mutex.Unlock()
+	go op.Committed(tag, nil)
+}
+
+func (s *testStack) GetBlockHeadMetadata() ([]byte, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.meta, nil
+}
+
+func TestKafkaOrdering(t *testing.T) {
+	net := newTestNetwork(t, 3)
+	net.start()
+	defer net.stop()
+
+	for tag := 1; tag <= 4; tag++ {
+		net.submit(tag%3, tag)
+	}
+	if !net.waitFor(4) {
+		t.Fatalf("Transactions were not committed by every validator")
+	}
+
+	expected := net.stacks[0].blocks()
+	if len(expected) != 2 {
+		t.Errorf("Expected 4 transactions to be cut into 2 blocks, got %v", expected)
+	}
+	for i, s := range net.stacks {
+		if blocks := s.blocks(); !reflect.DeepEqual(blocks, expected) {
+			t.Errorf("Expected validator %d to commit %v, committed %v", i, expected, blocks)
+		}
+	}
+}
+
+func TestKafkaTimeToCut(t *testing.T) {
+	net := newTestNetwork(t, 3)
+	net.config.Set("general.batch.timeout", "10ms")
+	net.start()
+	defer net.stop()
+
+	net.submit(0, 1)
+	if !net.waitFor(1) {
+		t.Fatalf("Expected the timeout to cut a block of the single transaction")
+	}
+	net.submit(1, 2)
+	net.submit(1, 3)
+	if !net.waitFor(3) {
+		t.Fatalf("Transactions were not committed by every validator")
+	}
+	for i, s := range net.stacks {
+		if blocks := s.blocks(); !reflect.DeepEqual(blocks, [][]string{{"tx1"}, {"tx2", "tx3"}}) {
+			t.Errorf("Expected every validator to cut at the first time-to-cut only, validator %d committed %v", i, blocks)
+		}
+	}
+}
+
+func TestKafkaRestartResumesFromOffset(t *testing.T) {
+	net := newTestNetwork(t, 2)
+	net.start()
+	defer net.stop()
+
+	net.submit(0, 1)
+	net.submit(0, 2)
+	if !net.waitFor(2) {
+		t.Fatalf("Transactions were not committed by every validator")
+	}
+
+	net.restart(1)
+	net.submit(0, 3)
+	net.submit(0, 4)
+	if !net.waitFor(4) {
+		t.Fatalf("Expected the restarted validator to consume on")
+	}
+	if blocks := net.stacks[1].blocks(); !reflect.DeepEqual(blocks, [][]string{{"tx1", "tx2"}, {"tx3", "tx4"}}) {
+		t.Errorf("Expected the restarted validator not to execute its committed block again, committed %v", blocks)
+	}
+	if meta := net.stacks[1].metadata(); meta.BlockNumber != 2 || meta.Offset != 3 {
+		t.Errorf("Expected block 2 up to offset 3, got %v", meta)
+	}
+}
+
+func TestKafkaReconnects(t *testing.T) {
+	net := newTestNetwork(t, 2)
+	net.start()
+	defer net.stop()
+
+	net.submit(0, 1)
+	net.submit(1, 2)
+	if !net.waitFor(2) {
+		t.Fatalf("Transactions were not committed by every validator")
+	}
+
+	net.broker.dropConnections()
+	net.submit(0, 3)
+	net.submit(1, 4)
+	if !net.waitFor(4) {
+		t.Fatalf("Expected the validators to reconnect to the broker")
+	}
+}
+
+func TestKafkaConsumesFromEarliestOffset(t *testing.T) {
+	net := newTestNetwork(t, 1)
+	c := newTestClient(net.broker)
+	for tag := 1; tag <= 3; tag++ {
+		tx, _ := proto.Marshal(&pb.Transaction{Uuid: fmt.Sprintf("tx%d", tag)})
+		msg, _ := proto.Marshal(&Message{Payload: &Message_Transaction{Transaction: tx}})
+		c.produce(msg)
+	}
+	c.close()
+	net.broker.truncate(1)
+
+	net.start()
+	defer net.stop()
+
+	net.submit(0, 4)
+	net.submit(0, 5)
+	if !net.waitFor(4) {
+		t.Fatalf("Expected the validator to consume from the earliest offset")
+	}
+	if txs := net.stacks[0].txIDs(); !reflect.DeepEqual(txs, []string{"tx2", "tx3", "tx4", "tx5"}) {
+		t.Errorf("Expected the transactions from the earliest offset on, got %v", txs)
+	}
+}
+
+func TestKafkaHealth(t *testing.T) {
+	net := newTestNetwork(t, 1)
+	net.start()
+	defer net.stop()
+
+	net.submit(0, 1)
+	net.submit(0, 2)
+	if !net.waitFor(2) {
+		t.Fatalf("Transactions were not committed")
+	}
+	op := net.stacks[0].op
+	if health := op.Health(); !health.Healthy {
+		t.Errorf("Expected the replica to be healthy, got %v", health)
+	}
+	if metrics := op.Metrics(); metrics["kafka.blockNumber"] != 1 || metrics["kafka.offset"] != 1 {
+		t.Errorf("Expected block 1 up to offset 1, got %v", metrics)
+	}
+
+	net.broker.close()
+	for deadline := time.Now().Add(5 * time.Second); op.Health().Healthy && time.Now().Before(deadline); {
+		time.Sleep(time.Millisecond)
+	}
+	if health := op.Health(); health.Healthy {
+		t.Errorf("Expected the replica to be unhealthy once the broker is down")
+	}
+}
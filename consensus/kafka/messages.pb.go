@@ -0,0 +1,127 @@
+// Code generated by protoc-gen-go.
+// source: messages.proto
+// DO NOT EDIT!
+
+/*
+Package kafka is a generated protocol buffer package.
+
+It is generated from these files:
+	messages.proto
+
+It has these top-level messages:
+	Message
+	Metadata
+*/
+package kafka
+
+import proto "github.com/golang/protobuf/proto"
+import fmt "fmt"
+import math "math"
+
+// Reference imports to suppress errors if they are not otherwise used.
+var _ = proto.Marshal
+var _ = fmt.Errorf
+var _ = math.Inf
+
+// message is what the validators produce to the partition
+type Message struct {
+	// Types that are valid to be assigned to Payload:
+	//	*Message_Transaction
+	//	*Message_TimeToCut
+	Payload isMessage_Payload `protobuf_oneof:"payload"`
+}
+
+func (m *Message) Reset()         { *m = Message{} }
+func (m *Message) String() string { return proto.CompactTextString(m) }
+func (*Message) ProtoMessage()    {}
+
+type isMessage_Payload interface {
+	isMessage_Payload()
+}
+
+type Message_Transaction struct {
+	Transaction []byte `protobuf:"bytes,1,opt,name=transaction,proto3,oneof"`
+}
+type Message_TimeToCut struct {
+	TimeToCut uint64 `protobuf:"varint,2,opt,name=time_to_cut,oneof"`
+}
+
+func (*Message_Transaction) isMessage_Payload() {}
+func (*Message_TimeToCut) isMessage_Payload()   {}
+
+func (m *Message) GetPayload() isMessage_Payload {
+	if m != nil {
+		return m.Payload
+	}
+	return nil
+}
+
+func (m *Message) GetTransaction() []byte {
+	if x, ok := m.GetPayload().(*Message_Transaction); ok {
+		return x.Transaction
+	}
+	return nil
+}
+
+func (m *Message) GetTimeToCut() uint64 {
+	if x, ok := m.GetPayload().(*Message_TimeToCut); ok {
+		return x.TimeToCut
+	}
+	return 0
+}
+
+// XXX_OneofFuncs is for the internal use of the proto package.
+func (*Message) XXX_OneofFuncs() (func(msg proto.Message, b *proto.Buffer) error, func(msg proto.Message, tag, wire int, b *proto.Buffer) (bool, error), []interface{}) {
+	return _Message_OneofMarshaler, _Message_OneofUnmarshaler, []interface{}{
+		(*Message_Transaction)(nil),
+		(*Message_TimeToCut)(nil),
+	}
+}
+
+func _Message_OneofMarshaler(msg proto.Message, b *proto.Buffer) error {
+	m := msg.(*Message)
+	// payload
+	switch x := m.Payload.(type) {
+	case *Message_Transaction:
+		b.EncodeVarint(1<<3 | proto.WireBytes)
+		b.EncodeRawBytes(x.Transaction)
+	case *Message_TimeToCut:
+		b.EncodeVarint(2<<3 | proto.WireVarint)
+		b.EncodeVarint(uint64(x.TimeToCut))
+	case nil:
+	default:
+		return fmt.Errorf("Message.Payload has unexpected type %T", x)
+	}
+	return nil
+}
+
+func _Message_OneofUnmarshaler(msg proto.Message, tag, wire int, b *proto.Buffer) (bool, error) {
+	m := msg.(*Message)
+	switch tag {
+	case 1: // payload.transaction
+		if wire != proto.WireBytes {
+			return true, proto.ErrInternalBadWireType
+		}
+		x, err := b.DecodeRawBytes(true)
+		m.Payload = &Message_Transaction{x}
+		return true, err
+	case 2: // payload.time_to_cut
+		if wire != proto.WireVarint {
+			return true, proto.ErrInternalBadWireType
+		}
+		x, err := b.DecodeVarint()
+		m.Payload = &Message_TimeToCut{x}
+		return true, err
+	default:
+		return false, nil
+	}
+}
+
+type Metadata struct {
+	BlockNumber uint64 `protobuf:"varint,1,opt,name=block_number" json:"block_number,omitempty"`
+	Offset      int64  `protobuf:"varint,2,opt,name=offset" json:"offset,omitempty"`
+}
+
+func (m *Metadata) Reset()         { *m = Metadata{} }
+func (m *Metadata) String() string { return proto.CompactTextString(m) }
+func (*Metadata) ProtoMessage()    {}
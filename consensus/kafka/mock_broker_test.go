@@ -0,0 +1,246 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package kafka
+
+import (
+	"encoding/binary"
+	"io"
+	"net"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+// mockBroker serves the requests of kafkaClient from an in-memory log, the
+// single partition 0 of the topic "fabric" which it leads
+type mockBroker struct {
+	listener net.Listener
+
+	mutex    sync.Mutex
+	conns    map[net.Conn]struct{}
+	log      [][]byte // messages from the earliest offset on
+	earliest int64
+}
+
+func newMockBroker(t *testing.T) *mockBroker {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Could not listen: %s", err)
+	}
+	b := &mockBroker{listener: listener, conns: make(map[net.Conn]struct{})}
+	go b.accept()
+	return b
+}
+
+func (b *mockBroker) addr() string {
+	return b.listener.Addr().String()
+}
+
+func (b *mockBroker) close() {
+	b.listener.Close()
+	b.dropConnections()
+}
+
+// dropConnections closes the connections of the clients, as a broker
+// restarting would
+func (b *mockBroker) dropConnections() {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	for conn := range b.conns {
+		conn.Close()
+	}
+	b.conns = make(map[net.Conn]struct{})
+}
+
+// truncate removes the messages before an offset, as retention would
+func (b *mockBroker) truncate(earliest int64) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	b.log = b.log[earliest-b.earliest:]
+	b.earliest = earliest
+}
+
+func (b *mockBroker) accept() {
+	for {
+		conn, err := b.listener.Accept()
+		if err != nil {
+			return
+		}
+		b.mutex.Lock()
+		b.conns[conn] = struct{}{}
+		b.mutex.Unlock()
+		go b.serve(conn)
+	}
+}
+
+func (b *mockBroker) serve(conn net.Conn) {
+	defer conn.Close()
+	for {
+		var size int32
+		if err := binary.Read(conn, binary.BigEndian, &size); err != nil {
+			return
+		}
+		buf := make([]byte, size)
+		if _, err := io.ReadFull(conn, buf); err != nil {
+			return
+		}
+		req := &decoder{buf: buf}
+		apiKey := req.getInt16()
+		req.getInt16() // api version
+		correlationID := req.getInt32()
+		req.getString() // client ID
+
+		resp := &encoder{}
+		resp.putInt32(correlationID)
+		switch apiKey {
+		case apiMetadata:
+			b.metadata(req, resp)
+		case apiProduce:
+			b.produce(req, resp)
+		case apiFetch:
+			b.fetch(req, resp)
+		case apiListOffsets:
+			b.listOffsets(req, resp)
+		default:
+			return
+		}
+
+		frame := make([]byte, 4, 4+resp.Len())
+		binary.BigEndian.PutUint32(frame, uint32(resp.Len()))
+		if _, err := conn.Write(append(frame, resp.Bytes()...)); err != nil {
+			return
+		}
+	}
+}
+
+func (b *mockBroker) metadata(req *decoder, resp *encoder) {
+	host, port, _ := net.SplitHostPort(b.addr())
+	portNum, _ := strconv.Atoi(port)
+	resp.putArrayLen(1)
+	resp.putInt32(0)
+	resp.putString(host)
+	resp.putInt32(int32(portNum))
+
+	n := req.getArrayLen()
+	resp.putArrayLen(n)
+	for ; n > 0; n-- {
+		topic := req.getString()
+		if topic != "fabric" {
+			resp.putInt16(3)
+			resp.putString(topic)
+			resp.putArrayLen(0)
+			continue
+		}
+		resp.putInt16(0)
+		resp.putString(topic)
+		resp.putArrayLen(1)
+		resp.putInt16(0)
+		resp.putInt32(0) // partition
+		resp.putInt32(0) // leader
+		resp.putArrayLen(1)
+		resp.putInt32(0)
+		resp.putArrayLen(1)
+		resp.putInt32(0)
+	}
+}
+
+func (b *mockBroker) produce(req *decoder, resp *encoder) {
+	req.getInt16() // acks
+	req.getInt32() // timeout
+	req.getArrayLen()
+	topic := req.getString()
+	req.getArrayLen()
+	partition := req.getInt32()
+	records, _ := getMessages(req.getBytes(), 0)
+
+	b.mutex.Lock()
+	offset := b.earliest + int64(len(b.log))
+	for _, rec := range records {
+		b.log = append(b.log, rec.value)
+	}
+	b.mutex.Unlock()
+
+	resp.putArrayLen(1)
+	resp.putString(topic)
+	resp.putArrayLen(1)
+	resp.putInt32(partition)
+	resp.putInt16(0)
+	resp.putInt64(offset)
+}
+
+func (b *mockBroker) fetch(req *decoder, resp *encoder) {
+	req.getInt32() // replica ID
+	maxWait := time.Duration(req.getInt32()) * time.Millisecond
+	req.getInt32() // min bytes
+	req.getArrayLen()
+	topic := req.getString()
+	req.getArrayLen()
+	partition := req.getInt32()
+	offset := req.getInt64()
+	maxBytes := int(req.getInt32())
+
+	var code int16
+	set := &encoder{}
+	for deadline := time.Now().Add(maxWait); ; time.Sleep(time.Millisecond) {
+		b.mutex.Lock()
+		end := b.earliest + int64(len(b.log))
+		if offset < b.earliest || offset > end {
+			code = 1
+		} else {
+			for o := offset; o < end && set.Len() < maxBytes; o++ {
+				putMessage(set, o, b.log[o-b.earliest])
+			}
+		}
+		b.mutex.Unlock()
+		if code != 0 || set.Len() > 0 || time.Now().After(deadline) {
+			break
+		}
+	}
+
+	resp.putArrayLen(1)
+	resp.putString(topic)
+	resp.putArrayLen(1)
+	resp.putInt32(partition)
+	resp.putInt16(code)
+	resp.putInt64(0) // high watermark
+	resp.putBytes(set.Bytes())
+}
+
+func (b *mockBroker) listOffsets(req *decoder, resp *encoder) {
+	req.getInt32() // replica ID
+	req.getArrayLen()
+	topic := req.getString()
+	req.getArrayLen()
+	partition := req.getInt32()
+	when := req.getInt64()
+
+	b.mutex.Lock()
+	offset := b.earliest
+	if when == offsetLatest {
+		offset += int64(len(b.log))
+	}
+	b.mutex.Unlock()
+
+	resp.putArrayLen(1)
+	resp.putString(topic)
+	resp.putArrayLen(1)
+	resp.putInt32(partition)
+	resp.putInt16(0)
+	resp.putArrayLen(1)
+	resp.putInt64(offset)
+}
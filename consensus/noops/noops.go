@@ -25,6 +25,8 @@ import (
 	"github.com/op/go-logging"
 
 	"github.com/hyperledger/fabric/consensus"
+	cutil "github.com/hyperledger/fabric/consensus/util"
+	"github.com/hyperledger/fabric/consensus/util/events"
 	"github.com/hyperledger/fabric/core/ledger"
 	"github.com/hyperledger/fabric/core/ledger/statemgmt"
 	"github.com/hyperledger/fabric/core/util"
@@ -39,13 +41,23 @@ func init() {
 
 // Noops is a plugin object implementing the consensus.Consenter interface.
 type Noops struct {
-	stack    consensus.Stack
-	txQ      *txq
-	timer    *time.Timer
-	duration time.Duration
-	channel  chan *pb.Transaction
+	stack      consensus.Stack
+	manager    events.Manager
+	cutter     *cutil.BlockCutter
+	batchTimer events.Timer
+	duration   time.Duration
 }
 
+// Event types
+
+// txEvent is sent when a transaction is received for the next block
+type txEvent struct {
+	tx *pb.Transaction
+}
+
+// batchTimerEvent is sent when the block wait expires
+type batchTimerEvent struct{}
+
 // Setting up a singleton NOOPS consenter
 var iNoops consensus.Consenter
 
@@ -67,6 +79,9 @@ func newNoops(c consensus.Stack) consensus.Consenter {
 	i.stack = c
 	config := loadConfig()
 	blockSize := config.GetInt("block.size")
+	if blockSize < 1 {
+		blockSize = 1
+	}
 	blockWait := config.GetString("block.wait")
 	if _, err = strconv.Atoi(blockWait); err == nil {
 		blockWait = blockWait + "s" //if string does not have unit of measure, default to seconds
@@ -76,16 +91,18 @@ func newNoops(c consensus.Stack) consensus.Consenter {
 		panic(fmt.Errorf("Cannot parse block wait: %s", err))
 	}
 
+	i.cutter = cutil.NewBlockCutter(blockSize, config.GetInt("block.maxbytes"))
+
 	logger.Infof("NOOPS consensus type = %T", i)
-	logger.Infof("NOOPS block size = %v", blockSize)
+	logger.Infof("NOOPS block size = %v", i.cutter.MaxMessageCount())
+	logger.Infof("NOOPS block max bytes = %v", i.cutter.MaxBytes())
 	logger.Infof("NOOPS block wait = %v", i.duration)
 
-	i.txQ = newTXQ(blockSize)
-
-	i.channel = make(chan *pb.Transaction, 100)
-	i.timer = time.NewTimer(i.duration) // start timer now so we can just reset it
-	i.timer.Stop()
-	go i.handleChannels()
+	i.manager = events.NewManagerImpl()
+	i.manager.SetReceiver(i)
+	etf := events.NewTimerFactoryImpl(i.manager)
+	i.batchTimer = etf.CreateTimer()
+	i.manager.Start()
 	return i
 }
 
@@ -105,9 +122,9 @@ func (i *Noops) RecvMsg(msg *pb.Message, senderHandle *pb.PeerID) error {
 			return err
 		}
 		if logger.IsEnabledFor(logging.DEBUG) {
-			logger.Debugf("Sending to channel tx uuid: %s", tx.Uuid)
+			logger.Debugf("Queueing tx uuid: %s", tx.Uuid)
 		}
-		i.channel <- tx
+		i.manager.Queue() <- txEvent{tx}
 	}
 	return nil
 }
@@ -136,53 +153,54 @@ func (i *Noops) broadcastConsensusMsg(msg *pb.Message) error {
 	return nil
 }
 
-func (i *Noops) canProcessBlock(tx *pb.Transaction) bool {
-	// For NOOPS, if we have completed the sync since we last connected,
-	// we can assume that we are at the current state; otherwise, we need to
-	// wait for the sync process to complete before we can exec the transactions
-
-	// TODO: Ask coordinator if we need to start sync
-
-	i.txQ.append(tx)
-
-	// start timer if we get a tx
-	if i.txQ.size() == 1 {
-		i.timer.Reset(i.duration)
-	}
-	return i.txQ.isFull()
-}
-
-func (i *Noops) handleChannels() {
-	// Noops is a singleton object and only exits when peer exits, so we
-	// don't need a condition to exit this loop
-	for {
-		select {
-		case tx := <-i.channel:
-			if i.canProcessBlock(tx) {
-				if logger.IsEnabledFor(logging.DEBUG) {
-					logger.Debug("Process block due to size")
-				}
-				if err := i.processBlock(); nil != err {
-					logger.Error(err.Error())
-				}
-			}
-		case <-i.timer.C:
+// ProcessEvent serially processes the transactions and block wait expiries
+func (i *Noops) ProcessEvent(event events.Event) events.Event {
+	switch et := event.(type) {
+	case txEvent:
+		blocks, pending := i.cutter.Ordered(et.tx, proto.Size(et.tx))
+		for _, block := range blocks {
 			if logger.IsEnabledFor(logging.DEBUG) {
-				logger.Debug("Process block due to time")
+				logger.Debug("Process block due to size")
 			}
-			if err := i.processBlock(); nil != err {
+			if err := i.processBlock(transactions(block)); nil != err {
 				logger.Error(err.Error())
 			}
 		}
+		if !pending {
+			i.batchTimer.Stop()
+		} else if len(blocks) > 0 {
+			i.batchTimer.Reset(i.duration, batchTimerEvent{})
+		} else {
+			i.batchTimer.SoftReset(i.duration, batchTimerEvent{})
+		}
+	case batchTimerEvent:
+		if logger.IsEnabledFor(logging.DEBUG) {
+			logger.Debug("Process block due to time")
+		}
+		if err := i.processBlock(transactions(i.cutter.Cut())); nil != err {
+			logger.Error(err.Error())
+		}
+	case events.WorkEvent:
+		et()
+	default:
+		logger.Warningf("NOOPS received an unknown event type (%T)", et)
 	}
+	return nil
 }
 
-func (i *Noops) processBlock() error {
-	i.timer.Stop()
+// transactions returns the transactions of a block the cutter cut
+func transactions(block []interface{}) []*pb.Transaction {
+	txs := make([]*pb.Transaction, len(block))
+	for j, tx := range block {
+		txs[j] = tx.(*pb.Transaction)
+	}
+	return txs
+}
 
-	if i.txQ.size() < 1 {
+func (i *Noops) processBlock(txs []*pb.Transaction) error {
+	if len(txs) < 1 {
 		if logger.IsEnabledFor(logging.DEBUG) {
-			logger.Debug("processBlock() called but transaction Q is empty")
+			logger.Debug("processBlock() called but there are no transactions")
 		}
 		return nil
 	}
@@ -190,7 +208,7 @@ func (i *Noops) processBlock() error {
 	var delta *statemgmt.StateDelta
 	var err error
 
-	if err = i.processTransactions(); nil != err {
+	if err = i.processTransactions(txs); nil != err {
 		return err
 	}
 	if data, delta, err = i.getBlockData(); nil != err {
@@ -200,7 +218,7 @@ func (i *Noops) processBlock() error {
 	return nil
 }
 
-func (i *Noops) processTransactions() error {
+func (i *Noops) processTransactions(txarr []*pb.Transaction) error {
 	timestamp := util.CreateUtcTimestamp()
 	if logger.IsEnabledFor(logging.DEBUG) {
 		logger.Debugf("Starting TX batch with timestamp: %v", timestamp)
@@ -209,12 +227,11 @@ func (i *Noops) processTransactions() error {
 		return err
 	}
 
-	// Grab all transactions from the FIFO queue and run them in order
-	txarr := i.txQ.getTXs()
+	// Run the transactions of the block in order
 	if logger.IsEnabledFor(logging.DEBUG) {
 		logger.Debugf("Executing batch of %d transactions with timestamp %v", len(txarr), timestamp)
 	}
-	_, err := i.stack.ExecTxs(timestamp, txarr)
+	_, results, err := i.stack.ExecTxs(timestamp, txarr)
 
 	//consensus does not need to understand transaction errors, errors here are
 	//actual ledger errors, and often irrecoverable
@@ -224,6 +241,11 @@ func (i *Noops) processTransactions() error {
 		return fmt.Errorf("Fail to execute transactions: %v", err)
 	}
 	if logger.IsEnabledFor(logging.DEBUG) {
+		for _, result := range results {
+			if result.ErrorCode != 0 {
+				logger.Debugf("Transaction %s of batch with timestamp %v failed: %s", result.Uuid, timestamp, result.Error)
+			}
+		}
 		logger.Debugf("Committing TX batch with timestamp: %v", timestamp)
 	}
 	if _, err := i.stack.CommitTxBatch(timestamp, nil); err != nil {
@@ -313,3 +335,20 @@ func (i *Noops) RolledBack(tag interface{}) {
 func (i *Noops) StateUpdated(tag interface{}, target *pb.BlockchainInfo) {
 	// Never called
 }
+
+// Health reports noops healthy, it has no replicas to wait for
+func (i *Noops) Health() consensus.Health {
+	return consensus.Health{Healthy: true, Detail: "no consensus"}
+}
+
+// Metrics reports the transactions waiting for the next block
+func (i *Noops) Metrics() consensus.Metrics {
+	var metrics consensus.Metrics
+	events.OnMainThread(i.manager, func() {
+		metrics = consensus.Metrics{
+			"noops.pendingTransactions": float64(i.cutter.Pending()),
+			"noops.pendingBytes":        float64(i.cutter.PendingBytes()),
+		}
+	})
+	return metrics
+}
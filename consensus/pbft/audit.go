@@ -0,0 +1,216 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package pbft
+
+import (
+	"fmt"
+	"google/protobuf"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+)
+
+// auditTrail archives the consensus messages a replica sends and receives,
+// so that what each replica saw during a disputed view change can be
+// reconstructed afterwards.  Entries are appended to one series of files per
+// view, a file is rotated once it reaches maxSize bytes, and only the newest
+// maxFiles files are kept.  Unlike the message log, the audit trail is not
+// meant to be replayed, and lives outside of the consensus state.
+type auditTrail struct {
+	dir      string
+	maxSize  int64 // rotate files at this size, zero for no limit
+	maxFiles int   // files kept, zero for no limit
+
+	view uint64   // view of the open file
+	part int      // index of the open file within its view
+	file *os.File // nil until the first entry is recorded
+	size int64
+}
+
+func newAuditTrail(dir string, maxSize int64, maxFiles int) (*auditTrail, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("could not create audit trail directory %s: %s", dir, err)
+	}
+	return &auditTrail{
+		dir:      dir,
+		maxSize:  maxSize,
+		maxFiles: maxFiles,
+	}, nil
+}
+
+// auditDir returns the directory holding the audit trail of a replica, so
+// that replicas sharing a configuration do not share their files
+func auditDir(dir string, id uint64) string {
+	return filepath.Join(dir, fmt.Sprintf("replica-%d", id))
+}
+
+// auditFileName is zero padded, so that the files sort in the order they were written
+func auditFileName(view uint64, part int) string {
+	return fmt.Sprintf("view-%020d.%06d.audit", view, part)
+}
+
+// record appends an entry to the file of its view
+func (a *auditTrail) record(entry *AuditEntry) error {
+	buf := proto.NewBuffer(nil)
+	if err := buf.EncodeMessage(entry); err != nil {
+		return fmt.Errorf("could not marshal audit entry: %s", err)
+	}
+
+	if a.file == nil || entry.View != a.view {
+		if err := a.open(entry.View, a.lastPart(entry.View)); err != nil {
+			return err
+		}
+	}
+	if a.maxSize > 0 && a.size > 0 && a.size+int64(len(buf.Bytes())) > a.maxSize {
+		if err := a.open(a.view, a.part+1); err != nil {
+			return err
+		}
+	}
+
+	n, err := a.file.Write(buf.Bytes())
+	a.size += int64(n)
+	if err != nil {
+		return fmt.Errorf("could not write audit entry to %s: %s", a.file.Name(), err)
+	}
+	return nil
+}
+
+// lastPart returns the index of the newest file of a view, so that a
+// restarted replica appends to it
+func (a *auditTrail) lastPart(view uint64) int {
+	last := 0
+	names, _ := filepath.Glob(filepath.Join(a.dir, fmt.Sprintf("view-%020d.*.audit", view)))
+	for _, name := range names {
+		var v uint64
+		var part int
+		if _, err := fmt.Sscanf(filepath.Base(name), "view-%d.%d.audit", &v, &part); err == nil && part > last {
+			last = part
+		}
+	}
+	return last
+}
+
+// open closes the current file and opens the given one for appending
+func (a *auditTrail) open(view uint64, part int) error {
+	a.close()
+
+	name := filepath.Join(a.dir, auditFileName(view, part))
+	file, err := os.OpenFile(name, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		return fmt.Errorf("could not open audit file %s: %s", name, err)
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return fmt.Errorf("could not stat audit file %s: %s", name, err)
+	}
+
+	a.view = view
+	a.part = part
+	a.file = file
+	a.size = info.Size()
+	a.prune()
+	return nil
+}
+
+// prune removes the oldest files beyond maxFiles
+func (a *auditTrail) prune() {
+	if a.maxFiles <= 0 {
+		return
+	}
+	names, err := filepath.Glob(filepath.Join(a.dir, "view-*.audit"))
+	if err != nil {
+		return
+	}
+	sort.Strings(names)
+	for i := 0; i < len(names)-a.maxFiles; i++ {
+		if names[i] == a.file.Name() {
+			continue
+		}
+		if err := os.Remove(names[i]); err != nil {
+			logger.Warningf("Could not remove old audit file %s: %s", names[i], err)
+		}
+	}
+}
+
+func (a *auditTrail) close() {
+	if a.file == nil {
+		return
+	}
+	if err := a.file.Close(); err != nil {
+		logger.Warningf("Could not close audit file %s: %s", a.file.Name(), err)
+	}
+	a.file = nil
+}
+
+// audit records a message sent or received by this replica, broadcasts are
+// recorded once rather than per receiver
+func (instance *pbftCore) audit(direction AuditEntryDirection, replicaID uint64, broadcast bool, msg *Message) {
+	now := time.Now()
+	err := instance.auditTrail.record(&AuditEntry{
+		Direction: direction,
+		ReplicaId: replicaID,
+		Broadcast: broadcast,
+		View:      instance.view,
+		Epoch:     instance.epoch,
+		Timestamp: &google_protobuf.Timestamp{
+			Seconds: now.Unix(),
+			Nanos:   int32(now.UnixNano() % 1000000000),
+		},
+		Message: msg,
+	})
+	if err != nil {
+		logger.Warningf("Replica %d could not record audit entry: %s", instance.id, err)
+	}
+}
+
+// ReadAuditTrail returns the audit entries replica id recorded for a view in
+// the configured audit directory, in the order they were recorded.  Entries
+// which were rotated out are missing, and if the replica crashed while
+// writing an entry, the entries before it are returned together with an error.
+func ReadAuditTrail(dir string, id uint64, view uint64) ([]*AuditEntry, error) {
+	names, err := filepath.Glob(filepath.Join(auditDir(dir, id), fmt.Sprintf("view-%020d.*.audit", view)))
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(names)
+
+	var entries []*AuditEntry
+	for _, name := range names {
+		raw, err := ioutil.ReadFile(name)
+		if err != nil {
+			return entries, err
+		}
+		for len(raw) > 0 {
+			size, n := proto.DecodeVarint(raw)
+			if n == 0 || uint64(len(raw)-n) < size {
+				return entries, fmt.Errorf("audit file %s ends with a truncated entry", name)
+			}
+			entry := &AuditEntry{}
+			if err := proto.Unmarshal(raw[n:n+int(size)], entry); err != nil {
+				return entries, fmt.Errorf("could not unmarshal audit entry in %s: %s", name, err)
+			}
+			entries = append(entries, entry)
+			raw = raw[n+int(size):]
+		}
+	}
+	return entries, nil
+}
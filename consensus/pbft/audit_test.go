@@ -0,0 +1,144 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package pbft
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestAuditTrailRotation(t *testing.T) {
+	dir, err := ioutil.TempDir("", "pbft-audit")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	a, err := newAuditTrail(auditDir(dir, 1), 100, 3)
+	if err != nil {
+		t.Fatalf("Could not create audit trail: %s", err)
+	}
+	msg := &Message{Payload: &Message_Prepare{Prepare: &Prepare{View: 2, SequenceNumber: 5, BatchDigest: "foo", ReplicaId: 3}}}
+	for i := 0; i < 20; i++ {
+		if err := a.record(&AuditEntry{Direction: AuditEntry_RECEIVED, ReplicaId: 3, View: 2, Message: msg}); err != nil {
+			t.Fatalf("Could not record entry %d: %s", i, err)
+		}
+	}
+	a.close()
+
+	names, _ := filepath.Glob(filepath.Join(auditDir(dir, 1), "*.audit"))
+	if len(names) != 3 {
+		t.Fatalf("Expected 3 audit files to be kept, found %v", names)
+	}
+	for _, name := range names {
+		if info, _ := os.Stat(name); info.Size() > 100 {
+			t.Errorf("Audit file %s should have been rotated at 100 bytes, it has %d", name, info.Size())
+		}
+	}
+
+	entries, err := ReadAuditTrail(dir, 1, 2)
+	if err != nil {
+		t.Fatalf("Could not read audit trail: %s", err)
+	}
+	if len(entries) == 0 || len(entries) >= 20 {
+		t.Fatalf("Expected the oldest entries to have been rotated out, read %d entries", len(entries))
+	}
+	if entries[0].Message.GetPrepare().BatchDigest != "foo" {
+		t.Errorf("Audit entry did not survive the round trip: %v", entries[0])
+	}
+
+	// a restarted replica appends to the newest file rather than starting over
+	a, _ = newAuditTrail(auditDir(dir, 1), 100, 3)
+	if err := a.record(&AuditEntry{Direction: AuditEntry_SENT, Broadcast: true, View: 2, Message: msg}); err != nil {
+		t.Fatalf("Could not record entry after restart: %s", err)
+	}
+	a.close()
+	restarted, _ := ReadAuditTrail(dir, 1, 2)
+	if last := restarted[len(restarted)-1]; last.Direction != AuditEntry_SENT || !last.Broadcast {
+		t.Errorf("Expected the entry recorded after the restart to be appended, read %v", last)
+	}
+}
+
+func TestAuditTrailViewChange(t *testing.T) {
+	dir, err := ioutil.TempDir("", "pbft-audit")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	config := loadConfig()
+	config.Set("general.audit.dir", dir)
+	net := makeSimNetwork(4, 1, config)
+	defer net.stop()
+
+	executed := func(count int) func() bool {
+		return func() bool {
+			for _, r := range net.replicas[1:] {
+				if len(r.executions) != count {
+					return false
+				}
+			}
+			return true
+		}
+	}
+	net.submitAll(createPbftReqBatch(1, 0))
+	if !net.runUntil(time.Minute, executed(1)) {
+		t.Fatalf("First request batch was not executed")
+	}
+	net.isolate(0)
+	net.submitAll(createPbftReqBatch(2, 0))
+	if !net.runUntil(time.Minute, executed(2)) {
+		t.Fatalf("Second request batch was not executed by the replicas outside of the primary's partition")
+	}
+
+	entries, err := ReadAuditTrail(dir, 2, 0)
+	if err != nil {
+		t.Fatalf("Could not read audit trail of view 0: %s", err)
+	}
+	prePrepare := false
+	for _, entry := range entries {
+		if entry.Message.GetPrePrepare() != nil && entry.Direction == AuditEntry_RECEIVED && entry.ReplicaId == 0 {
+			prePrepare = true
+		}
+	}
+	if !prePrepare {
+		t.Errorf("Expected replica 2 to have recorded the pre-prepare of replica 0 in view 0")
+	}
+
+	entries, err = ReadAuditTrail(dir, 2, 1)
+	if err != nil {
+		t.Fatalf("Could not read audit trail of view 1: %s", err)
+	}
+	sentViewChange, receivedViewChanges, newView := false, make(map[uint64]bool), false
+	for _, entry := range entries {
+		switch {
+		case entry.Message.GetViewChange() != nil && entry.Direction == AuditEntry_SENT:
+			sentViewChange = entry.Broadcast
+		case entry.Message.GetViewChange() != nil && entry.Direction == AuditEntry_RECEIVED:
+			receivedViewChanges[entry.ReplicaId] = true
+		case entry.Message.GetNewView() != nil && entry.Direction == AuditEntry_RECEIVED:
+			newView = entry.ReplicaId == 1
+		}
+	}
+	if !sentViewChange || !receivedViewChanges[1] || !receivedViewChanges[3] || !newView {
+		t.Errorf("Expected replica 2 to have recorded the view change to view 1, found sent %v, received from %v, new-view %v",
+			sentViewChange, receivedViewChanges, newView)
+	}
+}
@@ -19,10 +19,12 @@ package pbft
 import (
 	"fmt"
 	"google/protobuf"
+	"sync/atomic"
 	"time"
 
 	"github.com/hyperledger/fabric/consensus"
 	"github.com/hyperledger/fabric/consensus/util/events"
+	"github.com/hyperledger/fabric/events/producer"
 	pb "github.com/hyperledger/fabric/protos"
 
 	"github.com/golang/protobuf/proto"
@@ -42,6 +44,11 @@ type obcBatch struct {
 	batchTimerActive bool
 	batchTimeout     time.Duration
 
+	config *viper.Viper // re-read when the configuration is reloaded
+
+	requestTTL   time.Duration // how long a request may stay outstanding before it is expired
+	requestSweep events.Timer  // periodically expires outstanding requests
+
 	manager events.Manager // TODO, remove eventually, the event manager
 
 	incomingChan chan *batchMessage // Queues messages for processing by main thread
@@ -50,6 +57,18 @@ type obcBatch struct {
 	reqStore *requestStore // Holds the outstanding and pending requests
 
 	deduplicator *deduplicator
+	txIDs        *txIDCache // Recently ordered transaction IDs, used to drop client retries
+	fragmenter   *fragmenter
+	speculation  *speculation // Request batch being executed before it committed, if any
+	verifier     *verifier    // Checks signatures of inbound messages off the main thread, nil if disabled
+	relayer      *relayer     // Spreads broadcasts through a fanout of replicas, nil if disabled
+
+	maxOutstandingBatches int   // Client requests are turned away while more request batches are outstanding, zero for no limit
+	busy                  int32 // Whether client requests are turned away, written by the main thread and read atomically by RecvMsg
+
+	limiter      *clientLimiter // Limits the rate at which each client submits transactions through this replica
+	batchShare   int            // Requests of a single client a batch may hold, zero for no limit
+	batchClients map[string]int // Requests of each client in the batch store, when the batch share is limited
 
 	persistForward
 }
@@ -64,14 +83,29 @@ type batchMessage struct {
 // batchMessageEvent is sent when a consensus message is received that is then to be sent to pbft
 type batchMessageEvent batchMessage
 
+// speculation tracks a request batch executed ahead of its commit, it is
+// also the tag of its execution so that late completions can be recognized
+type speculation struct {
+	seqNo     uint64
+	reqBatch  *RequestBatch
+	meta      []byte
+	executed  bool // the executor finished the transactions
+	promoted  bool // the batch committed, its execution may be committed as well
+	discarded bool // the batch may not commit at this sequence number, its execution is rolled back
+}
+
 // batchTimerEvent is sent when the batch timer expires
 type batchTimerEvent struct{}
 
+// requestSweepEvent is sent when outstanding requests should be checked for expiry
+type requestSweepEvent struct{}
+
 func newObcBatch(id uint64, config *viper.Viper, stack consensus.Stack) *obcBatch {
 	var err error
 
 	op := &obcBatch{
 		obcGeneric: obcGeneric{stack: stack},
+		config:     config,
 	}
 
 	op.persistForward.persistor = stack
@@ -109,10 +143,61 @@ func newObcBatch(id uint64, config *viper.Viper, stack consensus.Stack) *obcBatc
 
 	op.batchTimer = etf.CreateTimer()
 
-	op.reqStore = newRequestStore()
+	op.requestTTL, err = time.ParseDuration(config.GetString("general.timeout.requestttl"))
+	if err != nil {
+		op.requestTTL = 0
+	}
+	op.requestSweep = etf.CreateTimer()
+	if op.requestTTL > 0 {
+		logger.Infof("PBFT outstanding request TTL = %v", op.requestTTL)
+		op.requestSweep.Reset(op.requestTTL/2, requestSweepEvent{})
+	} else {
+		logger.Infof("PBFT outstanding request expiry disabled")
+	}
+
+	op.reqStore = newRequestStore(op.requestClient)
 
 	op.deduplicator = newDeduplicator()
 
+	op.txIDs = newTxIDCache(config.GetInt("general.txidcachesize"))
+	logger.Infof("PBFT transaction ID cache size = %d", op.txIDs.size)
+
+	op.fragmenter = newFragmenter(config.GetInt("general.maxmessagesize"), config.GetInt("general.maxreassembledsize"), op.pbft.requestTimeout)
+	logger.Infof("PBFT maximum message size = %d, reassembled up to %d fragments per replica", op.fragmenter.maxSize, op.fragmenter.maxCount)
+
+	if workers := config.GetInt("general.verifyworkers"); workers > 0 {
+		op.verifier = newVerifier(workers, op.verify, op.manager.Queue())
+		logger.Infof("PBFT signature verification workers = %d", workers)
+	} else {
+		logger.Infof("PBFT signature verification on the main thread")
+	}
+
+	if fanout := config.GetInt("general.relay.fanout"); fanout > 0 && fanout < op.pbft.N-1 {
+		op.relayer = newRelayer(id, op.pbft.N, fanout, op.txIDs.size)
+		logger.Infof("PBFT relaying broadcasts through a fanout of %d", fanout)
+	} else {
+		logger.Infof("PBFT broadcasting directly to all replicas")
+	}
+
+	op.maxOutstandingBatches = config.GetInt("general.maxoutstandingbatches")
+	if op.maxOutstandingBatches > 0 {
+		logger.Infof("PBFT rejecting client requests beyond %d outstanding request batches", op.maxOutstandingBatches)
+	}
+
+	rate, burst := config.GetFloat64("general.clientlimit.rate"), config.GetInt("general.clientlimit.burst")
+	if burst < 1 {
+		burst = 1
+	}
+	op.limiter = newClientLimiter(rate, burst)
+	if rate > 0 {
+		logger.Infof("PBFT limiting each client to %v transactions per second, bursts of %d", rate, burst)
+	}
+	op.batchShare = config.GetInt("general.clientlimit.batchshare")
+	if op.batchShare > 0 {
+		op.batchClients = make(map[string]int)
+		logger.Infof("PBFT limiting each client to %d requests per batch", op.batchShare)
+	}
+
 	op.idleChan = make(chan struct{})
 	close(op.idleChan) // TODO remove eventually
 
@@ -121,10 +206,63 @@ func newObcBatch(id uint64, config *viper.Viper, stack consensus.Stack) *obcBatc
 
 // Close tells us to release resources we are holding
 func (op *obcBatch) Close() {
+	if op.verifier != nil {
+		op.verifier.stop()
+	}
 	op.batchTimer.Halt()
+	op.requestSweep.Halt()
 	op.pbft.close()
 }
 
+// PhaseLatencies returns the latency histograms of the agreement phases, keyed by phase
+func (op *obcBatch) PhaseLatencies() map[string]LatencyHistogram {
+	return op.pbft.latencies.snapshot()
+}
+
+// RecvMsg is called by the stack when a new message is received, the
+// message is handed to the verifier before it reaches the main thread
+func (op *obcBatch) RecvMsg(ocMsg *pb.Message, senderHandle *pb.PeerID) error {
+	if ocMsg.Type == pb.Message_CHAIN_TRANSACTION {
+		if atomic.LoadInt32(&op.busy) != 0 {
+			return consensus.ErrBusy
+		}
+		if client := clientOf(ocMsg.Payload, op.pbft.id, op.stack.VerifyTransaction); !op.limiter.allow(client) {
+			logger.Debugf("Replica %d rejecting transaction as client %s exceeded its rate", op.pbft.id, client)
+			return consensus.ErrRateLimited
+		}
+	}
+	if op.verifier == nil {
+		return op.externalEventReceiver.RecvMsg(ocMsg, senderHandle)
+	}
+	op.verifier.submit(&batchMessage{
+		msg:    ocMsg,
+		sender: senderHandle,
+	})
+	return nil
+}
+
+// updateBusy records whether client requests should be turned away, so
+// that clients retry later rather than adding to a backlog which only
+// raises latency and memory use.  It is called on the main thread after
+// every event.
+func (op *obcBatch) updateBusy() {
+	if op.maxOutstandingBatches <= 0 {
+		return
+	}
+	var busy int32
+	if len(op.pbft.outstandingReqBatches) > op.maxOutstandingBatches {
+		busy = 1
+	}
+	if atomic.SwapInt32(&op.busy, busy) == busy {
+		return
+	}
+	if busy != 0 {
+		logger.Warningf("Replica %d has %d outstanding request batches, rejecting client requests", op.pbft.id, len(op.pbft.outstandingReqBatches))
+	} else {
+		logger.Infof("Replica %d accepting client requests again", op.pbft.id)
+	}
+}
+
 func (op *obcBatch) submitToLeader(req *Request) events.Event {
 	// Broadcast the request to the network, in case we're in the wrong view
 	op.broadcastMsg(&BatchMessage{Payload: &BatchMessage_Request{Request: req}})
@@ -138,22 +276,79 @@ func (op *obcBatch) submitToLeader(req *Request) events.Event {
 }
 
 func (op *obcBatch) broadcastMsg(msg *BatchMessage) {
-	msgPayload, _ := proto.Marshal(msg)
-	ocMsg := &pb.Message{
-		Type:    pb.Message_CONSENSUS,
-		Payload: msgPayload,
+	if op.relayer != nil {
+		msgPayload, _ := proto.Marshal(msg)
+		relay := op.relayer.originate(msgPayload)
+		if err := op.pbft.sign(relay); err != nil {
+			logger.Errorf("Replica %d could not sign relay: %s", op.pbft.id, err)
+			return
+		}
+		op.forwardRelay(relay)
+		return
+	}
+	for _, ocMsg := range op.packMessage(msg) {
+		op.broadcaster.Broadcast(ocMsg)
+	}
+}
+
+// forwardRelay passes a relay on to the next replicas
+func (op *obcBatch) forwardRelay(relay *Relay) {
+	targets := op.relayer.targets(relay.ReplicaId)
+	if len(targets) == 0 {
+		return
+	}
+	for _, ocMsg := range op.packMessage(&BatchMessage{Payload: &BatchMessage_Relay{Relay: relay}}) {
+		op.broadcaster.Multicast(ocMsg, targets)
+	}
+}
+
+// recvRelay forwards a relay seen for the first time, and returns the
+// event for the batch message it carries
+func (op *obcBatch) recvRelay(relay *Relay, senderID uint64) events.Event {
+	if op.relayer == nil {
+		logger.Warningf("Replica %d received relay from replica %d, but relaying is disabled", op.pbft.id, senderID)
+		return nil
+	}
+	if relay.ReplicaId == op.pbft.id || relay.ReplicaId >= uint64(op.pbft.N) || op.relayer.seen.has(relayKey(relay)) {
+		return nil
+	}
+	// verify before remembering, or a forged relay would suppress the real one
+	if err := op.pbft.verify(relay); err != nil {
+		logger.Warningf("Replica %d dropping relay from replica %d with an incorrect signature by replica %d: %s", op.pbft.id, senderID, relay.ReplicaId, err)
+		return nil
 	}
-	op.broadcaster.Broadcast(ocMsg)
+	op.relayer.receive(relay)
+	op.forwardRelay(relay)
+
+	originHandle, _ := getValidatorHandle(relay.ReplicaId)
+	return op.processMessage(&pb.Message{Type: pb.Message_CONSENSUS, Payload: relay.Payload}, originHandle)
 }
 
 // send a message to a specific replica
-func (op *obcBatch) unicastMsg(msg *BatchMessage, receiverID uint64) {
+func (op *obcBatch) unicastMsg(msg *BatchMessage, receiverID uint64) (err error) {
+	for _, ocMsg := range op.packMessage(msg) {
+		if err = op.broadcaster.Unicast(ocMsg, receiverID); err != nil {
+			return
+		}
+	}
+	return
+}
+
+// packMessage wraps a batch message into Fabric messages, splitting it
+// into fragments if it exceeds the maximum message size
+func (op *obcBatch) packMessage(msg *BatchMessage) []*pb.Message {
 	msgPayload, _ := proto.Marshal(msg)
-	ocMsg := &pb.Message{
-		Type:    pb.Message_CONSENSUS,
-		Payload: msgPayload,
+	fragments := op.fragmenter.split(msgPayload)
+	if fragments == nil {
+		return []*pb.Message{{Type: pb.Message_CONSENSUS, Payload: msgPayload}}
+	}
+	logger.Debugf("Batch replica %d splitting message of %d bytes into %d fragments", op.pbft.id, len(msgPayload), len(fragments))
+	ocMsgs := make([]*pb.Message, len(fragments))
+	for i, fragment := range fragments {
+		fragPayload, _ := proto.Marshal(&BatchMessage{Payload: &BatchMessage_Fragment{Fragment: fragment}})
+		ocMsgs[i] = &pb.Message{Type: pb.Message_CONSENSUS, Payload: fragPayload}
 	}
-	op.broadcaster.Unicast(ocMsg, receiverID)
+	return ocMsgs
 }
 
 // =============================================================================
@@ -162,12 +357,12 @@ func (op *obcBatch) unicastMsg(msg *BatchMessage, receiverID uint64) {
 
 // multicast a message to all replicas
 func (op *obcBatch) broadcast(msgPayload []byte) {
-	op.broadcaster.Broadcast(op.wrapMessage(msgPayload))
+	op.broadcastMsg(op.wrapMessage(msgPayload))
 }
 
 // send a message to a specific replica
 func (op *obcBatch) unicast(msgPayload []byte, receiverID uint64) (err error) {
-	return op.broadcaster.Unicast(op.wrapMessage(msgPayload), receiverID)
+	return op.unicastMsg(op.wrapMessage(msgPayload), receiverID)
 }
 
 func (op *obcBatch) sign(msg []byte) ([]byte, error) {
@@ -185,6 +380,15 @@ func (op *obcBatch) verify(senderID uint64, signature []byte, message []byte) er
 
 // execute an opaque request which corresponds to an OBC Transaction
 func (op *obcBatch) execute(seqNo uint64, reqBatch *RequestBatch) {
+	txs := op.batchTxs(seqNo, reqBatch)
+	op.markExecuted(reqBatch)
+	meta, _ := proto.Marshal(&Metadata{seqNo})
+	logger.Debugf("Batch replica %d received exec for seqNo %d containing %d transactions", op.pbft.id, seqNo, len(txs))
+	op.stack.Execute(meta, txs) // This executes in the background, we will receive an executedEvent once it completes
+}
+
+// batchTxs unmarshals the transactions of a request batch
+func (op *obcBatch) batchTxs(seqNo uint64, reqBatch *RequestBatch) []*pb.Transaction {
 	var txs []*pb.Transaction
 	for _, req := range reqBatch.GetBatch() {
 		tx := &pb.Transaction{}
@@ -193,15 +397,61 @@ func (op *obcBatch) execute(seqNo uint64, reqBatch *RequestBatch) {
 			continue
 		}
 		logger.Debugf("Batch replica %d executing request with transaction %s from outstandingReqs, seqNo=%d", op.pbft.id, tx.Uuid, seqNo)
+		txs = append(txs, tx)
+	}
+	return txs
+}
+
+// markExecuted records that the requests of a batch were ordered, so that they are neither resubmitted nor accepted again
+func (op *obcBatch) markExecuted(reqBatch *RequestBatch) {
+	for _, req := range reqBatch.GetBatch() {
 		if outstanding, pending := op.reqStore.remove(req); !outstanding || !pending {
-			logger.Debugf("Batch replica %d missing transaction %s outstanding=%v, pending=%v", op.pbft.id, tx.Uuid, outstanding, pending)
+			logger.Debugf("Batch replica %d missing request outstanding=%v, pending=%v", op.pbft.id, outstanding, pending)
 		}
-		txs = append(txs, tx)
 		op.deduplicator.Execute(req)
+		if txID, err := getTxID(req); err == nil {
+			op.txIDs.add(txID)
+		}
 	}
+}
+
+// executeSpeculatively executes a prepared request batch, the transactions
+// are only committed once the batch commits
+func (op *obcBatch) executeSpeculatively(seqNo uint64, reqBatch *RequestBatch) {
 	meta, _ := proto.Marshal(&Metadata{seqNo})
-	logger.Debugf("Batch replica %d received exec for seqNo %d containing %d transactions", op.pbft.id, seqNo, len(txs))
-	op.stack.Execute(meta, txs) // This executes in the background, we will receive an executedEvent once it completes
+	op.speculation = &speculation{
+		seqNo:    seqNo,
+		reqBatch: reqBatch,
+		meta:     meta,
+	}
+	txs := op.batchTxs(seqNo, reqBatch)
+	logger.Debugf("Batch replica %d speculatively executing seqNo %d containing %d transactions", op.pbft.id, seqNo, len(txs))
+	op.stack.Execute(op.speculation, txs)
+}
+
+func (op *obcBatch) promoteSpeculation(seqNo uint64) {
+	spec := op.speculation
+	op.speculation = nil
+	spec.promoted = true
+	op.markExecuted(spec.reqBatch)
+	if spec.executed {
+		op.stack.Commit(nil, spec.meta)
+	}
+}
+
+func (op *obcBatch) discardSpeculation(seqNo uint64) {
+	spec := op.speculation
+	op.speculation = nil
+	spec.discarded = true
+	op.stack.Rollback(nil)
+}
+
+// speculationExecuted commits a speculative execution if its batch has committed in the meantime
+func (op *obcBatch) speculationExecuted(spec *speculation) {
+	spec.executed = true
+	if spec.promoted {
+		op.stack.Commit(nil, spec.meta)
+	}
 }
 
 // =============================================================================
@@ -211,6 +461,24 @@ func (op *obcBatch) execute(seqNo uint64, reqBatch *RequestBatch) {
 func (op *obcBatch) leaderProcReq(req *Request) events.Event {
 	// XXX check req sig
 	digest := hash(req)
+	if op.isOrderedTx(req) {
+		logger.Debugf("Batch primary %d discarding request %s as its transaction was already ordered", op.pbft.id, digest)
+		op.reqStore.remove(req)
+		return nil
+	}
+
+	// A client which holds its share of the batch closes it, rather than
+	// taking the slots of the requests of other clients yet to arrive
+	var closed events.Event
+	if op.batchShare > 0 {
+		client := op.requestClient(req)
+		if op.batchClients[client] >= op.batchShare {
+			logger.Debugf("Batch primary %d closing the batch as client %s holds its share", op.pbft.id, client)
+			closed = op.sendBatch()
+		}
+		op.batchClients[client]++
+	}
+
 	logger.Debugf("Batch primary %d queueing new request %s", op.pbft.id, digest)
 	op.batchStore = append(op.batchStore, req)
 	op.reqStore.storePending(req)
@@ -219,6 +487,9 @@ func (op *obcBatch) leaderProcReq(req *Request) events.Event {
 		op.startBatchTimer()
 	}
 
+	if closed != nil {
+		return closed
+	}
 	if len(op.batchStore) >= op.batchSize {
 		return op.sendBatch()
 	}
@@ -234,11 +505,25 @@ func (op *obcBatch) sendBatch() events.Event {
 	}
 
 	reqBatch := &RequestBatch{Batch: op.batchStore}
-	op.batchStore = nil
+	op.clearBatchStore()
 	logger.Infof("Creating batch with %d requests", len(reqBatch.Batch))
 	return reqBatch
 }
 
+// clearBatchStore empties the batch store once its requests were batched or dropped
+func (op *obcBatch) clearBatchStore() {
+	op.batchStore = nil
+	if op.batchShare > 0 {
+		op.batchClients = make(map[string]int)
+	}
+}
+
+// SetClientLimit overrides the limits of a client until the replica restarts
+func (op *obcBatch) SetClientLimit(client string, rate float64, burst int) error {
+	op.limiter.setLimit(client, rate, burst)
+	return nil
+}
+
 func (op *obcBatch) txToReq(tx []byte) *Request {
 	now := time.Now()
 	req := &Request{
@@ -256,6 +541,10 @@ func (op *obcBatch) txToReq(tx []byte) *Request {
 func (op *obcBatch) processMessage(ocMsg *pb.Message, senderHandle *pb.PeerID) events.Event {
 	if ocMsg.Type == pb.Message_CHAIN_TRANSACTION {
 		req := op.txToReq(ocMsg.Payload)
+		if op.isOrderedTx(req) {
+			logger.Warningf("Replica %d ignoring transaction resubmission as it was already ordered", op.pbft.id)
+			return nil
+		}
 		return op.submitToLeader(req)
 	}
 
@@ -271,14 +560,47 @@ func (op *obcBatch) processMessage(ocMsg *pb.Message, senderHandle *pb.PeerID) e
 		return nil
 	}
 
+	if fragment := batchMsg.GetFragment(); fragment != nil {
+		senderID, err := getValidatorID(senderHandle)
+		if err != nil {
+			panic("Cannot map sender's PeerID to a valid replica ID")
+		}
+		msgPayload := op.fragmenter.add(senderID, fragment)
+		if msgPayload == nil {
+			return nil
+		}
+		batchMsg = &BatchMessage{}
+		if err := proto.Unmarshal(msgPayload, batchMsg); err != nil || batchMsg.GetFragment() != nil {
+			logger.Errorf("Error unmarshaling reassembled message from replica %d: %v", senderID, err)
+			return nil
+		}
+	}
+
+	if relay := batchMsg.GetRelay(); relay != nil {
+		senderID, err := getValidatorID(senderHandle)
+		if err != nil {
+			panic("Cannot map sender's PeerID to a valid replica ID")
+		}
+		return op.recvRelay(relay, senderID)
+	}
+
 	if req := batchMsg.GetRequest(); req != nil {
 		if !op.deduplicator.IsNew(req) {
 			logger.Warningf("Replica %d ignoring request as it is too old", op.pbft.id)
 			return nil
 		}
 
+		if op.isOrderedTx(req) {
+			logger.Warningf("Replica %d ignoring request as its transaction was already ordered", op.pbft.id)
+			return nil
+		}
+
 		op.logAddTxFromRequest(req)
 		op.reqStore.storeOutstanding(req)
+		if op.pbft.payloadThreshold > 0 && len(req.Payload) >= op.pbft.payloadThreshold {
+			// keep the payload, the primary's pre-prepare will only carry its digest
+			op.pbft.ProcessEvent(payloadEvent(req.Payload))
+		}
 		if (op.pbft.primary(op.pbft.view) == op.pbft.id) && op.pbft.activeView {
 			return op.leaderProcReq(req)
 		}
@@ -319,6 +641,15 @@ func (op *obcBatch) logAddTxFromRequest(req *Request) {
 	}
 }
 
+// isOrderedTx returns whether the transaction carried by the request was recently ordered
+func (op *obcBatch) isOrderedTx(req *Request) bool {
+	txID, err := getTxID(req)
+	if err != nil {
+		return false
+	}
+	return op.txIDs.has(txID)
+}
+
 func (op *obcBatch) resubmitOutstandingReqs() events.Event {
 	op.startTimerIfOutstandingRequests()
 
@@ -345,12 +676,19 @@ func (op *obcBatch) resubmitOutstandingReqs() events.Event {
 // allow the primary to send a batch when the timer expires
 func (op *obcBatch) ProcessEvent(event events.Event) events.Event {
 	logger.Debugf("Replica %d batch main thread looping", op.pbft.id)
+	defer op.updateBusy()
 	switch et := event.(type) {
 	case batchMessageEvent:
 		ocMsg := et
 		return op.processMessage(ocMsg.msg, ocMsg.sender)
 	case executedEvent:
+		if spec, ok := et.tag.(*speculation); ok {
+			op.speculationExecuted(spec)
+			return nil
+		}
 		op.stack.Commit(nil, et.tag.([]byte))
+	case rolledBackEvent:
+		logger.Debugf("Replica %d rolled back a discarded speculative execution", op.pbft.id)
 	case committedEvent:
 		logger.Debugf("Replica %d received committedEvent", op.pbft.id)
 		return execDoneEvent{}
@@ -360,6 +698,9 @@ func (op *obcBatch) ProcessEvent(event events.Event) events.Event {
 			return res
 		}
 		return op.resubmitOutstandingReqs()
+	case requestSweepEvent:
+		op.expireOutstandingReqs()
+		op.requestSweep.Reset(op.requestTTL/2, requestSweepEvent{})
 	case batchTimerEvent:
 		logger.Infof("Replica %d batch timer expired", op.pbft.id)
 		if op.pbft.activeView && (len(op.batchStore) > 0) {
@@ -371,7 +712,7 @@ func (op *obcBatch) ProcessEvent(event events.Event) events.Event {
 		op.startTimerIfOutstandingRequests()
 		return res
 	case viewChangedEvent:
-		op.batchStore = nil
+		op.clearBatchStore()
 		// Outstanding reqs doesn't make sense for batch, as all the requests in a batch may be processed
 		// in a different batch, but PBFT core can't see through the opaque structure to see this
 		// so, on view change, clear it out
@@ -408,13 +749,14 @@ func (op *obcBatch) ProcessEvent(event events.Event) events.Event {
 				continue
 			}
 
-			op.reqStore.storePendings(cert.prePrepare.RequestBatch.GetBatch())
+			reqBatch, _ := op.pbft.resolvePayloads(cert.prePrepare.RequestBatch)
+			op.reqStore.storePendings(reqBatch.GetBatch())
 		}
 
 		return op.resubmitOutstandingReqs()
 	case stateUpdatedEvent:
 		// When the state is updated, clear any outstanding requests, they may have been processed while we were gone
-		op.reqStore = newRequestStore()
+		op.reqStore = newRequestStore(op.requestClient)
 		return op.pbft.ProcessEvent(event)
 	default:
 		return op.pbft.ProcessEvent(event)
@@ -423,6 +765,28 @@ func (op *obcBatch) ProcessEvent(event events.Event) events.Event {
 	return nil
 }
 
+// expireOutstandingReqs drops the requests which have been outstanding for
+// longer than the TTL, and notifies the clients of the requests we submitted
+func (op *obcBatch) expireOutstandingReqs() {
+	expired := op.reqStore.expireNonPending(time.Now().Add(-op.requestTTL))
+	if len(expired) == 0 {
+		return
+	}
+	logger.Warningf("Replica %d expiring %d requests which were not ordered within %v", op.pbft.id, len(expired), op.requestTTL)
+	for _, req := range expired {
+		if req.ReplicaId != op.pbft.id {
+			// the replica which received the request from the client notifies it
+			continue
+		}
+		tx := &pb.Transaction{}
+		if err := proto.Unmarshal(req.Payload, tx); err != nil {
+			logger.Warningf("Replica %d could not unmarshal expired transaction: %s", op.pbft.id, err)
+			continue
+		}
+		producer.Send(producer.CreateRejectionEvent(tx, fmt.Sprintf("Transaction was not ordered within %v and has expired", op.requestTTL)))
+	}
+}
+
 func (op *obcBatch) startBatchTimer() {
 	op.batchTimer.Reset(op.batchTimeout, batchTimerEvent{})
 	logger.Debugf("Replica %d started the batch timer", op.pbft.id)
@@ -435,16 +799,9 @@ func (op *obcBatch) stopBatchTimer() {
 	op.batchTimerActive = false
 }
 
-// Wraps a payload into a batch message, packs it and wraps it into
-// a Fabric message. Called by broadcast before transmission.
-func (op *obcBatch) wrapMessage(msgPayload []byte) *pb.Message {
-	batchMsg := &BatchMessage{Payload: &BatchMessage_PbftMessage{PbftMessage: msgPayload}}
-	packedBatchMsg, _ := proto.Marshal(batchMsg)
-	ocMsg := &pb.Message{
-		Type:    pb.Message_CONSENSUS,
-		Payload: packedBatchMsg,
-	}
-	return ocMsg
+// Wraps a payload into a batch message. Called by broadcast before transmission.
+func (op *obcBatch) wrapMessage(msgPayload []byte) *BatchMessage {
+	return &BatchMessage{Payload: &BatchMessage_PbftMessage{PbftMessage: msgPayload}}
 }
 
 // Retrieve the idle channel, only used for testing
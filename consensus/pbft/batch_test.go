@@ -17,6 +17,9 @@ limitations under the License.
 package pbft
 
 import (
+	"bytes"
+	"encoding/json"
+	"fmt"
 	"testing"
 	"time"
 
@@ -24,6 +27,7 @@ import (
 	"github.com/hyperledger/fabric/consensus/util/events"
 	pb "github.com/hyperledger/fabric/protos"
 
+	"github.com/golang/protobuf/proto"
 	"github.com/spf13/viper"
 )
 
@@ -360,3 +364,340 @@ func TestClearBatchStoreOnViewChange(t *testing.T) {
 		t.Fatalf("Should have cleared the batch store on view change")
 	}
 }
+
+func TestDropAlreadyOrderedTx(t *testing.T) {
+	broadcasts := 0
+	b := newObcBatch(0, loadConfig(), &omniProto{
+		UnicastImpl: func(ocMsg *pb.Message, peer *pb.PeerID) error {
+			broadcasts++
+			return nil
+		},
+		ExecuteImpl: func(tag interface{}, txs []*pb.Transaction) {},
+	})
+	defer b.Close()
+
+	tx := createTx(1)
+	tx.Uuid = "retried"
+	b.manager.Queue() <- events.WorkEvent(func() {
+		b.execute(1, &RequestBatch{Batch: []*Request{b.txToReq(marshalTx(tx))}})
+	})
+	b.manager.Queue() <- nil
+
+	if !b.txIDs.has("retried") {
+		t.Fatalf("Executed transaction ID should have been recorded")
+	}
+
+	b.manager.Queue() <- batchMessageEvent{&pb.Message{Type: pb.Message_CHAIN_TRANSACTION, Payload: marshalTx(tx)}, &pb.PeerID{Name: "vp0"}}
+	b.manager.Queue() <- nil
+	b.broadcaster.Wait()
+
+	if broadcasts != 0 {
+		t.Errorf("Resubmitted transaction should not have been broadcast")
+	}
+	if len(b.batchStore) != 0 || b.reqStore.outstandingRequests.Len() != 0 {
+		t.Errorf("Resubmitted transaction should not have been queued for batching")
+	}
+
+	req := b.txToReq(marshalTx(tx))
+	req.ReplicaId = 2
+	msgPayload, _ := proto.Marshal(&BatchMessage{Payload: &BatchMessage_Request{Request: req}})
+	b.manager.Queue() <- batchMessageEvent{&pb.Message{Type: pb.Message_CONSENSUS, Payload: msgPayload}, &pb.PeerID{Name: "vp2"}}
+	b.manager.Queue() <- nil
+
+	if len(b.batchStore) != 0 || b.reqStore.outstandingRequests.Len() != 0 {
+		t.Errorf("Forwarded request for an ordered transaction should have been discarded")
+	}
+}
+
+func TestFragmentedBatch(t *testing.T) {
+	validatorCount := 4
+	net := makeConsumerNetwork(validatorCount, obcBatchHelper, func(ce *consumerEndpoint) {
+		ce.consumer.(*obcBatch).batchSize = 1
+		ce.consumer.(*obcBatch).fragmenter = newFragmenter(256, 1<<20, time.Minute)
+	})
+	defer net.stop()
+
+	tx := createTx(1)
+	tx.Payload = make([]byte, 2048)
+	msg := &pb.Message{Type: pb.Message_CHAIN_TRANSACTION, Payload: marshalTx(tx)}
+	broadcaster := net.endpoints[generateBroadcaster(validatorCount)].getHandle()
+	if err := net.endpoints[1].(*consumerEndpoint).consumer.RecvMsg(msg, broadcaster); err != nil {
+		t.Fatalf("External request was not processed by backup: %v", err)
+	}
+
+	net.process()
+
+	for _, ep := range net.endpoints {
+		ce := ep.(*consumerEndpoint)
+		block, err := ce.consumer.(*obcBatch).stack.GetBlock(1)
+		if err != nil {
+			t.Fatalf("Replica %d should have executed the large request, but has no new block: %s", ce.id, err)
+		}
+		if len(block.Transactions) != 1 || len(block.Transactions[0].Payload) != 2048 {
+			t.Errorf("Replica %d did not execute the large request intact", ce.id)
+		}
+	}
+}
+
+func TestExpireOutstandingReqs(t *testing.T) {
+	omni := &omniProto{
+		UnicastImpl:   func(ocMsg *pb.Message, peer *pb.PeerID) error { return nil },
+		BroadcastImpl: func(ocMsg *pb.Message, peerType pb.PeerEndpoint_Type) error { return nil },
+	}
+	b := newObcBatch(1, loadConfig(), omni)
+	defer b.Close()
+	b.requestTTL = time.Millisecond
+
+	b.reqStore.storeOutstanding(createPbftReq(1, 1))
+	time.Sleep(2 * time.Millisecond)
+	b.manager.Queue() <- requestSweepEvent{}
+	b.manager.Queue() <- nil
+
+	if b.reqStore.outstandingRequests.Len() != 0 {
+		t.Fatalf("Outstanding request should have expired")
+	}
+}
+
+func TestRejectClientRequestsWhenBusy(t *testing.T) {
+	omni := &omniProto{
+		UnicastImpl:   func(ocMsg *pb.Message, peer *pb.PeerID) error { return nil },
+		BroadcastImpl: func(ocMsg *pb.Message, peerType pb.PeerEndpoint_Type) error { return nil },
+	}
+	config := loadConfig()
+	config.Set("general.maxoutstandingbatches", 1)
+	b := newObcBatch(1, config, omni)
+	defer b.Close()
+
+	b.manager.Queue() <- events.WorkEvent(func() {
+		b.pbft.outstandingReqBatches["foo"] = createPbftReqBatch(1, 0)
+		b.pbft.outstandingReqBatches["bar"] = createPbftReqBatch(2, 0)
+	})
+	b.manager.Queue() <- nil
+	if err := b.RecvMsg(createTxMsg(3), &pb.PeerID{Name: "vp1"}); err != consensus.ErrBusy {
+		t.Fatalf("Expected client request to be rejected with more outstanding request batches than allowed, got %v", err)
+	}
+	if err := b.RecvMsg(&pb.Message{Type: pb.Message_CONSENSUS}, &pb.PeerID{Name: "vp2"}); err != nil {
+		t.Errorf("Consensus messages should still be accepted while busy, got %s", err)
+	}
+
+	b.manager.Queue() <- events.WorkEvent(func() { delete(b.pbft.outstandingReqBatches, "foo") })
+	b.manager.Queue() <- nil
+	if err := b.RecvMsg(createTxMsg(3), &pb.PeerID{Name: "vp1"}); err != nil {
+		t.Errorf("Expected client request to be accepted again, got %s", err)
+	}
+}
+
+func TestRejectClientRequestsOverRate(t *testing.T) {
+	omni := &omniProto{
+		UnicastImpl:   func(ocMsg *pb.Message, peer *pb.PeerID) error { return nil },
+		BroadcastImpl: func(ocMsg *pb.Message, peerType pb.PeerEndpoint_Type) error { return nil },
+	}
+	config := loadConfig()
+	config.Set("general.clientlimit.rate", 0.001)
+	config.Set("general.clientlimit.burst", 1)
+	b := newObcBatch(1, config, omni)
+	defer b.Close()
+
+	if err := b.RecvMsg(createTxMsg(1), &pb.PeerID{Name: "vp1"}); err != nil {
+		t.Fatalf("Expected the first client request to be accepted, got %v", err)
+	}
+	if err := b.RecvMsg(createTxMsg(2), &pb.PeerID{Name: "vp1"}); err != consensus.ErrRateLimited {
+		t.Fatalf("Expected the client request beyond the burst to be rejected, got %v", err)
+	}
+
+	b.SetClientLimit("replica 1", 0, 0)
+	if err := b.RecvMsg(createTxMsg(3), &pb.PeerID{Name: "vp1"}); err != nil {
+		t.Errorf("Expected client request to be accepted once the limit was lifted, got %s", err)
+	}
+	b.manager.Queue() <- nil
+}
+
+func TestRateLimitUnverifiedClients(t *testing.T) {
+	alice := createCert(t, "alice")
+	omni := &omniProto{
+		UnicastImpl:   func(ocMsg *pb.Message, peer *pb.PeerID) error { return nil },
+		BroadcastImpl: func(ocMsg *pb.Message, peerType pb.PeerEndpoint_Type) error { return nil },
+		VerifyTransactionImpl: func(tx *pb.Transaction) error {
+			if !bytes.Equal(tx.Cert, alice) {
+				return fmt.Errorf("certificate not issued by a trusted authority")
+			}
+			return nil
+		},
+	}
+	config := loadConfig()
+	config.Set("general.clientlimit.rate", 0.001)
+	config.Set("general.clientlimit.burst", 1)
+	b := newObcBatch(1, config, omni)
+	defer b.Close()
+
+	txMsg := func(tag int64, cert []byte) *pb.Message {
+		tx := createTx(tag)
+		tx.Cert = cert
+		return &pb.Message{Type: pb.Message_CHAIN_TRANSACTION, Payload: marshalTx(tx)}
+	}
+
+	// certificates naming alice, or a new client each time, which are not
+	// issued by a trusted authority count against the receiving replica
+	if err := b.RecvMsg(txMsg(1, createCert(t, "alice")), &pb.PeerID{Name: "vp1"}); err != nil {
+		t.Fatalf("Expected the first client request to be accepted, got %v", err)
+	}
+	if err := b.RecvMsg(txMsg(2, createCert(t, "mallory")), &pb.PeerID{Name: "vp1"}); err != consensus.ErrRateLimited {
+		t.Fatalf("Expected a request under a new unverified name to be rejected, got %v", err)
+	}
+	if err := b.RecvMsg(txMsg(3, alice), &pb.PeerID{Name: "vp1"}); err != nil {
+		t.Errorf("Expected the verified client not to be affected, got %v", err)
+	}
+	b.manager.Queue() <- nil
+}
+
+func TestBatchShare(t *testing.T) {
+	omni := &omniProto{
+		UnicastImpl:   func(ocMsg *pb.Message, peer *pb.PeerID) error { return nil },
+		BroadcastImpl: func(ocMsg *pb.Message, peerType pb.PeerEndpoint_Type) error { return nil },
+	}
+	config := loadConfig()
+	config.Set("general.batchsize", 10)
+	config.Set("general.clientlimit.batchshare", 2)
+	b := newObcBatch(0, config, omni)
+	defer b.Close()
+
+	var closed []events.Event
+	b.manager.Queue() <- events.WorkEvent(func() {
+		for i, req := range []*Request{createPbftReq(1, 1), createPbftReq(2, 2), createPbftReq(3, 1), createPbftReq(4, 1)} {
+			if event := b.leaderProcReq(req); event != nil {
+				closed = append(closed, event)
+				if i != 3 {
+					t.Errorf("Expected the batch to close when the chatty client exceeds its share, it closed at request %d", i)
+				}
+			}
+		}
+	})
+	b.manager.Queue() <- nil
+
+	if len(closed) != 1 {
+		t.Fatalf("Expected one batch to close, got %d", len(closed))
+	}
+	if reqBatch, ok := closed[0].(*RequestBatch); !ok || len(reqBatch.Batch) != 3 {
+		t.Errorf("Expected the closed batch to hold the first 3 requests, got %v", closed[0])
+	}
+	if len(b.batchStore) != 1 || b.batchClients["replica 1"] != 1 {
+		t.Errorf("Expected the request beyond the share to start the next batch, batch store holds %d", len(b.batchStore))
+	}
+}
+
+func TestSpeculativeBatchExecution(t *testing.T) {
+	validatorCount := 4
+	net := makeConsumerNetwork(validatorCount, obcBatchHelper, func(ce *consumerEndpoint) {
+		ce.consumer.(*obcBatch).batchSize = 1
+		ce.consumer.(*obcBatch).pbft.speculative = true
+	})
+	defer net.stop()
+
+	broadcaster := net.endpoints[generateBroadcaster(validatorCount)].getHandle()
+	for n := int64(1); n <= 3; n++ {
+		if err := net.endpoints[1].(*consumerEndpoint).consumer.RecvMsg(createTxMsg(n), broadcaster); err != nil {
+			t.Fatalf("External request was not processed by backup: %v", err)
+		}
+		net.process()
+	}
+
+	for _, ep := range net.endpoints {
+		ce := ep.(*consumerEndpoint)
+		op := ce.consumer.(*obcBatch)
+		if op.speculation != nil || op.pbft.specDigest != "" {
+			t.Errorf("Replica %d should have no speculation left", ce.id)
+		}
+		if size := op.stack.GetBlockchainSize(); size != 4 {
+			t.Errorf("Replica %d should have committed 3 blocks, blockchain size is %d", ce.id, size)
+		}
+		for n := uint64(1); n <= 3; n++ {
+			block, err := op.stack.GetBlock(n)
+			if err != nil || len(block.Transactions) != 1 {
+				t.Errorf("Replica %d should have committed one transaction in block %d", ce.id, n)
+			}
+		}
+	}
+}
+
+func TestSingleReplica(t *testing.T) {
+	net := makeConsumerNetwork(1, obcBatchHelper, func(ce *consumerEndpoint) {
+		ce.consumer.(*obcBatch).batchSize = 1
+		ce.consumer.(*obcBatch).pbft.K = 2
+	})
+	defer net.stop()
+
+	ce := net.endpoints[0].(*consumerEndpoint)
+	op := ce.consumer.(*obcBatch)
+	for n := int64(1); n <= 3; n++ {
+		if err := op.RecvMsg(createTxMsg(n), ce.getHandle()); err != nil {
+			t.Fatalf("External request was not processed: %v", err)
+		}
+		net.process()
+	}
+
+	if size := op.stack.GetBlockchainSize(); size != 4 {
+		t.Errorf("Single replica should have committed 3 blocks, blockchain size is %d", size)
+	}
+	if op.pbft.h != 2 {
+		t.Errorf("Single replica should have moved its low watermark to 2 on its own checkpoint, but it is %d", op.pbft.h)
+	}
+	if op.pbft.view != 0 || !op.pbft.activeView {
+		t.Errorf("Single replica should have stayed in view 0, it is in view %d", op.pbft.view)
+	}
+}
+
+func TestDumpState(t *testing.T) {
+	omni := &omniProto{
+		UnicastImpl: func(ocMsg *pb.Message, peer *pb.PeerID) error { return nil },
+	}
+	config := loadConfig()
+	config.Set("general.batchsize", 2)
+	b := newObcBatch(0, config, omni)
+	defer b.Close()
+
+	for n := int64(1); n <= 3; n++ {
+		if err := b.RecvMsg(createTxMsg(n), &pb.PeerID{Name: "vp0"}); err != nil {
+			t.Fatalf("External request was not processed: %v", err)
+		}
+	}
+	b.manager.Queue() <- nil
+
+	raw, err := b.DumpState()
+	if err != nil {
+		t.Fatalf("Could not dump the state: %s", err)
+	}
+	state := &batchState{pbftState: &pbftState{}}
+	if err := json.Unmarshal(raw, state); err != nil {
+		t.Fatalf("State dump is not valid JSON: %s\n%s", err, raw)
+	}
+
+	if state.ID != 0 || state.View != 0 || state.Primary != 0 || !state.ActiveView {
+		t.Errorf("Expected replica 0 to be the active primary of view 0, dumped %s", raw)
+	}
+	if state.SeqNo != 1 || state.High != state.Low+b.pbft.L {
+		t.Errorf("Expected seqNo 1 within the watermarks, dumped %s", raw)
+	}
+	if len(state.Certs) != 1 || state.Certs[0].SeqNo != 1 || !state.Certs[0].PrePrepared || state.Certs[0].Committed {
+		t.Errorf("Expected an uncommitted pre-prepare for seqNo 1, dumped %s", raw)
+	}
+	if len(state.Outstanding) != 1 || state.Outstanding[0] != state.Certs[0].Digest {
+		t.Errorf("Expected the pre-prepared batch to be outstanding, dumped %s", raw)
+	}
+	if state.OutstandingRequests != 3 || state.BatchStore != 1 {
+		t.Errorf("Expected 3 outstanding requests, one of which is not batched yet, dumped %s", raw)
+	}
+}
+
+func TestDumpStateWedged(t *testing.T) {
+	omni := &omniProto{}
+	b := newObcBatch(0, loadConfig(), omni)
+	defer b.Close()
+
+	wedged := make(chan struct{})
+	defer close(wedged)
+	b.manager.Queue() <- events.WorkEvent(func() { <-wedged })
+
+	if _, err := b.DumpState(); err == nil {
+		t.Errorf("Dumping the state of a replica whose main thread is stuck should have failed")
+	}
+}
@@ -0,0 +1,155 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package pbft
+
+import (
+	"encoding/base64"
+)
+
+// A replica which starts with an empty consensus store knows nothing of where
+// the network is, and would start at sequence number zero, drop the messages
+// of the network as out of its watermarks, and only skip ahead once it
+// observed f+1 checkpoints above them.  Instead, it asks the other replicas
+// for their latest stable checkpoint when it starts, and again every
+// bootstrap timeout until it has an answer.  A checkpoint which f+1 replicas
+// answer with was reached by a correct replica, so the replica moves its
+// watermarks to it and transfers the state of that checkpoint.  Once the
+// replicas of an intersection quorum answered without agreeing on a
+// checkpoint above its own, the replica starts where it is.
+
+// bootstrapTimerEvent is sent when the bootstrap timer expires
+type bootstrapTimerEvent struct{}
+
+// returnCheckpointEvent is sent when a replica answers with its latest stable checkpoint
+type returnCheckpointEvent *Checkpoint
+
+// startBootstrap has a replica with an empty consensus store discover the
+// latest stable checkpoint of the network
+func (instance *pbftCore) startBootstrap() {
+	if instance.bootstrapTimeout <= 0 || instance.N == 1 {
+		return
+	}
+	if instance.h != 0 || len(instance.pset) != 0 || len(instance.qset) != 0 || len(instance.reqBatchStore) != 0 {
+		return
+	}
+	logger.Infof("Replica %d starting with an empty consensus store, asking the network for its latest stable checkpoint", instance.id)
+	instance.fetchStableCheckpoint()
+}
+
+// fetchStableCheckpoint asks the other replicas for their latest stable
+// checkpoint, and transfers the state of the highest one f+1 of them agree on
+func (instance *pbftCore) fetchStableCheckpoint() {
+	instance.bootstrapping = true
+	instance.bootstrapAnswers = make(map[uint64]*Checkpoint)
+	instance.bootstrapTimer.Reset(0, bootstrapTimerEvent{})
+}
+
+// bootstrapTimerHandler asks the other replicas for their latest stable
+// checkpoint, until enough of them answered
+func (instance *pbftCore) bootstrapTimerHandler() {
+	if !instance.bootstrapping {
+		return
+	}
+	logger.Debugf("Replica %d asking the network for its latest stable checkpoint", instance.id)
+	instance.innerBroadcast(&Message{Payload: &Message_FetchCheckpoint{FetchCheckpoint: &FetchCheckpoint{ReplicaId: instance.id}}})
+	if instance.bootstrapTimeout > 0 {
+		instance.bootstrapTimer.Reset(instance.bootstrapTimeout, bootstrapTimerEvent{})
+	}
+}
+
+// recvFetchCheckpoint answers with the latest stable checkpoint a state
+// transfer can target
+func (instance *pbftCore) recvFetchCheckpoint(fc *FetchCheckpoint) error {
+	seqNo := instance.lastProofCheckpoint(instance.h)
+	id, ok := instance.chkpts[seqNo]
+	if !ok {
+		return nil
+	}
+	chkpt := &Checkpoint{SequenceNumber: seqNo, ReplicaId: instance.id, Id: id}
+	return instance.innerUnicast(&Message{Payload: &Message_ReturnCheckpoint{ReturnCheckpoint: chkpt}}, fc.ReplicaId)
+}
+
+// recvReturnCheckpoint collects the stable checkpoints the other replicas
+// answered with, and initializes the watermarks from the highest one f+1
+// of them agree on
+func (instance *pbftCore) recvReturnCheckpoint(chkpt *Checkpoint) {
+	if !instance.bootstrapping {
+		return
+	}
+	instance.bootstrapAnswers[chkpt.ReplicaId] = chkpt
+
+	var agreed *Checkpoint
+	var members []uint64
+	answered := make(map[uint64]bool)
+	for id, answer := range instance.bootstrapAnswers {
+		answered[id] = true
+		if agreed != nil && answer.SequenceNumber <= agreed.SequenceNumber {
+			continue
+		}
+		matching := make(map[uint64]bool)
+		for other, otherAnswer := range instance.bootstrapAnswers {
+			if otherAnswer.SequenceNumber == answer.SequenceNumber && otherAnswer.Id == answer.Id {
+				matching[other] = true
+			}
+		}
+		if instance.weightOf(matching) >= instance.weakQuorum() {
+			agreed = answer
+			members = nil
+			for other := range matching {
+				members = append(members, other)
+			}
+		}
+	}
+
+	if agreed == nil || agreed.SequenceNumber <= instance.h {
+		if instance.weightOf(answered) >= instance.intersectionQuorum() {
+			logger.Infof("Replica %d found no stable checkpoint of the network above its low watermark %d", instance.id, instance.h)
+			instance.stopBootstrap()
+		}
+		return
+	}
+	instance.stopBootstrap()
+
+	snapshotID, err := base64.StdEncoding.DecodeString(agreed.Id)
+	if err != nil {
+		logger.Errorf("Replica %d could not decode the stable checkpoint %d agreed on by replicas %v: %s", instance.id, agreed.SequenceNumber, members, err)
+		return
+	}
+	logger.Infof("Replica %d bootstrapping from stable checkpoint %d agreed on by replicas %v", instance.id, agreed.SequenceNumber, members)
+	instance.moveWatermarks(agreed.SequenceNumber)
+	if instance.lastExec >= agreed.SequenceNumber {
+		return
+	}
+
+	target := &stateUpdateTarget{
+		checkpointMessage: checkpointMessage{
+			seqNo: agreed.SequenceNumber,
+			id:    snapshotID,
+		},
+		replicas: members,
+	}
+	instance.skipInProgress = true
+	instance.consumer.invalidateState()
+	instance.updateHighStateTarget(target)
+	instance.retryStateTransfer(target)
+}
+
+func (instance *pbftCore) stopBootstrap() {
+	instance.bootstrapping = false
+	instance.bootstrapAnswers = nil
+	instance.bootstrapTimer.Stop()
+}
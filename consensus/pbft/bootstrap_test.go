@@ -0,0 +1,84 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package pbft
+
+import (
+	"testing"
+	"time"
+)
+
+func TestBootstrapWatermarks(t *testing.T) {
+	config := loadConfig()
+	config.Set("general.timeout.bootstrap", "1s")
+	net := makeSimNetwork(4, 19, config)
+	defer net.stop()
+
+	K := net.replicas[0].pbft.K
+	for tag := int64(1); uint64(tag) <= K+1; tag++ {
+		net.submitAll(createPbftReqBatch(tag, 0))
+	}
+	if !net.runUntil(time.Minute, func() bool {
+		for _, r := range net.replicas {
+			if r.pbft.h != K {
+				return false
+			}
+		}
+		return true
+	}) {
+		t.Fatalf("Network did not reach a stable checkpoint at %d", K)
+	}
+
+	// replica 3 loses its consensus store and restarts
+	cold := &simReplica{id: 3, net: net}
+	cold.initialize()
+	net.replicas[3].pbft.close()
+	cold.pbft = newPbftCore(3, config, cold, &simTimerFactory{net: net, replica: cold})
+	net.replicas[3] = cold
+	if !cold.pbft.bootstrapping {
+		t.Fatalf("Replica with an empty consensus store should ask for the latest stable checkpoint")
+	}
+
+	if !net.runUntil(time.Minute, func() bool { return cold.pbft.lastExec == K && !cold.pbft.skipInProgress }) {
+		t.Fatalf("Replica did not transfer the state of the stable checkpoint, lastExec %d", cold.pbft.lastExec)
+	}
+	if cold.pbft.h != K || cold.pbft.bootstrapping {
+		t.Errorf("Expected the watermarks to start from the stable checkpoint %d, low watermark is %d", K, cold.pbft.h)
+	}
+}
+
+func TestBootstrapFreshNetwork(t *testing.T) {
+	config := loadConfig()
+	config.Set("general.timeout.bootstrap", "1s")
+	net := makeSimNetwork(4, 20, config)
+	defer net.stop()
+
+	if !net.runUntil(time.Minute, func() bool {
+		for _, r := range net.replicas {
+			if r.pbft.bootstrapping {
+				return false
+			}
+		}
+		return true
+	}) {
+		t.Fatalf("Replicas of a fresh network should agree there is no checkpoint to start from")
+	}
+	for _, r := range net.replicas {
+		if r.pbft.h != 0 || r.pbft.skipInProgress {
+			t.Errorf("Replica %d should start from sequence number zero, low watermark %d", r.id, r.pbft.h)
+		}
+	}
+}
@@ -142,7 +142,7 @@ func (b *broadcaster) unicastOne(msg *pb.Message, dest uint64, wait chan bool) {
 	}
 }
 
-func (b *broadcaster) send(msg *pb.Message, dest *uint64) error {
+func (b *broadcaster) send(msg *pb.Message, dests []uint64) error {
 	select {
 	case <-b.closedCh:
 		return fmt.Errorf("broadcaster closed")
@@ -151,9 +151,9 @@ func (b *broadcaster) send(msg *pb.Message, dest *uint64) error {
 
 	var destCount int
 	var required int
-	if dest != nil {
-		destCount = 1
-		required = 1
+	if dests != nil {
+		destCount = len(dests)
+		required = destCount
 	} else {
 		destCount = len(b.msgChans)
 		required = destCount - b.f
@@ -161,9 +161,11 @@ func (b *broadcaster) send(msg *pb.Message, dest *uint64) error {
 
 	wait := make(chan bool, destCount)
 
-	if dest != nil {
-		b.closed.Add(1)
-		b.unicastOne(msg, *dest, wait)
+	if dests != nil {
+		b.closed.Add(len(dests))
+		for _, dest := range dests {
+			b.unicastOne(msg, dest, wait)
+		}
 	} else {
 		b.closed.Add(len(b.msgChans))
 		for i := range b.msgChans {
@@ -200,7 +202,12 @@ outer:
 }
 
 func (b *broadcaster) Unicast(msg *pb.Message, dest uint64) error {
-	return b.send(msg, &dest)
+	return b.send(msg, []uint64{dest})
+}
+
+// Multicast sends the message to the given replicas only
+func (b *broadcaster) Multicast(msg *pb.Message, dests []uint64) error {
+	return b.send(msg, dests)
 }
 
 func (b *broadcaster) Broadcast(msg *pb.Message) error {
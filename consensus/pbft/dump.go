@@ -0,0 +1,209 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package pbft
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/hyperledger/fabric/consensus/util/events"
+)
+
+// pbftState is a snapshot of the soft state of a replica, for debugging
+type pbftState struct {
+	ID                uint64            `json:"id"`
+	Epoch             uint64            `json:"epoch"`
+	View              uint64            `json:"view"`
+	Primary           uint64            `json:"primary"`
+	ActiveView        bool              `json:"activeView"`
+	Low               uint64            `json:"h"`
+	High              uint64            `json:"H"`
+	SeqNo             uint64            `json:"seqNo"`
+	LastExec          uint64            `json:"lastExec"`
+	Executing         bool              `json:"executing"`
+	SkipInProgress    bool              `json:"skipInProgress"`
+	StateTransferring bool              `json:"stateTransferring"`
+	Checkpoints       map[uint64]string `json:"checkpoints"`
+	Certs             []certState       `json:"certs"`
+	ViewChanges       []viewChangeState `json:"viewChanges"`
+	NewViews          []uint64          `json:"newViews"`
+	Outstanding       []string          `json:"outstandingReqBatches"`
+	Missing           []string          `json:"missingReqBatches"`
+	Health            []ReplicaHealth   `json:"health"`
+	ViewChangeCauses  []causeState      `json:"viewChangeCauses"`
+}
+
+// batchState adds the requests held by the batching layer to the pbft state
+type batchState struct {
+	*pbftState
+	BatchStore          int `json:"batchStore"`
+	OutstandingRequests int `json:"outstandingRequests"`
+	PendingRequests     int `json:"pendingRequests"`
+}
+
+// certState summarizes the quorum certificate of one sequence number
+type certState struct {
+	View        uint64 `json:"view"`
+	SeqNo       uint64 `json:"seqNo"`
+	Digest      string `json:"digest"`
+	PrePrepared bool   `json:"prePrepared"`
+	Prepares    int    `json:"prepares"`
+	Commits     int    `json:"commits"`
+	Prepared    bool   `json:"prepared"`
+	Committed   bool   `json:"committed"`
+}
+
+// viewChangeState summarizes a view-change message held by the replica
+type viewChangeState struct {
+	View        uint64 `json:"view"`
+	ReplicaID   uint64 `json:"replica"`
+	H           uint64 `json:"h"`
+	Checkpoints int    `json:"checkpoints"`
+	Pset        int    `json:"pset"`
+	Qset        int    `json:"qset"`
+}
+
+// causeState summarizes the cause of a view change this replica initiated
+type causeState struct {
+	View   uint64    `json:"view"`
+	Reason string    `json:"reason"`
+	Detail string    `json:"detail"`
+	Time   time.Time `json:"time"`
+}
+
+// dumpState captures the soft state of the replica, it must be called from
+// the main thread
+func (instance *pbftCore) dumpState() *pbftState {
+	state := &pbftState{
+		ID:                instance.id,
+		Epoch:             instance.epoch,
+		View:              instance.view,
+		Primary:           instance.primary(instance.view),
+		ActiveView:        instance.activeView,
+		Low:               instance.h,
+		High:              instance.h + instance.L,
+		SeqNo:             instance.seqNo,
+		LastExec:          instance.lastExec,
+		Executing:         instance.currentExec != nil,
+		SkipInProgress:    instance.skipInProgress,
+		StateTransferring: instance.stateTransferring,
+		Checkpoints:       make(map[uint64]string),
+		Certs:             []certState{},
+		ViewChanges:       []viewChangeState{},
+		NewViews:          []uint64{},
+		Outstanding:       []string{},
+		Missing:           []string{},
+		Health:            instance.health.snapshot(),
+		ViewChangeCauses:  []causeState{},
+	}
+
+	for n, id := range instance.chkpts {
+		state.Checkpoints[n] = id
+	}
+
+	for idx, cert := range instance.certStore {
+		state.Certs = append(state.Certs, certState{
+			View:        idx.v,
+			SeqNo:       idx.n,
+			Digest:      cert.digest,
+			PrePrepared: cert.prePrepare != nil,
+			Prepares:    len(cert.prepare),
+			Commits:     len(cert.commit),
+			Prepared:    instance.prepared(cert.digest, idx.v, idx.n),
+			Committed:   instance.committed(cert.digest, idx.v, idx.n),
+		})
+	}
+	sort.Sort(sortableCertStates(state.Certs))
+
+	for _, vc := range instance.viewChangeStore {
+		state.ViewChanges = append(state.ViewChanges, viewChangeState{
+			View:        vc.View,
+			ReplicaID:   vc.ReplicaId,
+			H:           vc.H,
+			Checkpoints: len(vc.Cset),
+			Pset:        len(vc.Pset),
+			Qset:        len(vc.Qset),
+		})
+	}
+	sort.Sort(sortableViewChangeStates(state.ViewChanges))
+
+	for _, cause := range instance.vcCauses {
+		cs := causeState{View: cause.View, Reason: cause.Reason.String(), Detail: cause.Detail}
+		if cause.Timestamp != nil {
+			cs.Time = time.Unix(cause.Timestamp.Seconds, int64(cause.Timestamp.Nanos))
+		}
+		state.ViewChangeCauses = append(state.ViewChangeCauses, cs)
+	}
+
+	for v := range instance.newViewStore {
+		state.NewViews = append(state.NewViews, v)
+	}
+	sort.Sort(sortableUint64Slice(state.NewViews))
+
+	for digest := range instance.outstandingReqBatches {
+		state.Outstanding = append(state.Outstanding, digest)
+	}
+	sort.Strings(state.Outstanding)
+
+	for digest := range instance.missingReqBatches {
+		state.Missing = append(state.Missing, digest)
+	}
+	sort.Strings(state.Missing)
+
+	return state
+}
+
+// DumpState returns the soft state of the replica serialized as JSON, the
+// state is captured on the main thread so that it is consistent
+func (op *obcBatch) DumpState() ([]byte, error) {
+	var state *batchState
+	if !events.OnMainThread(op.manager, func() {
+		state = &batchState{
+			pbftState:           op.pbft.dumpState(),
+			BatchStore:          len(op.batchStore),
+			OutstandingRequests: op.reqStore.outstandingRequests.Len(),
+			PendingRequests:     op.reqStore.pendingRequests.Len(),
+		}
+	}) {
+		return nil, fmt.Errorf("main thread unresponsive for %v", events.MainThreadTimeout)
+	}
+	return json.MarshalIndent(state, "", "  ")
+}
+
+type sortableCertStates []certState
+
+func (a sortableCertStates) Len() int      { return len(a) }
+func (a sortableCertStates) Swap(i, j int) { a[i], a[j] = a[j], a[i] }
+func (a sortableCertStates) Less(i, j int) bool {
+	if a[i].SeqNo != a[j].SeqNo {
+		return a[i].SeqNo < a[j].SeqNo
+	}
+	return a[i].View < a[j].View
+}
+
+type sortableViewChangeStates []viewChangeState
+
+func (a sortableViewChangeStates) Len() int      { return len(a) }
+func (a sortableViewChangeStates) Swap(i, j int) { a[i], a[j] = a[j], a[i] }
+func (a sortableViewChangeStates) Less(i, j int) bool {
+	if a[i].View != a[j].View {
+		return a[i].View < a[j].View
+	}
+	return a[i].ReplicaID < a[j].ReplicaID
+}
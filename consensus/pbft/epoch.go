@@ -0,0 +1,132 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package pbft
+
+import (
+	"fmt"
+
+	"github.com/golang/protobuf/proto"
+)
+
+// Views are numbered within an epoch, and the epoch increments whenever the
+// validator set is reconfigured, that is when a replica restarts with another
+// number of replicas, fault bound or voting weights than it last ran with.
+// Views restart at zero in a new epoch, certificates stored in an earlier
+// epoch are discarded, and every message carries the epoch of its sender so
+// that messages of another epoch are ignored.  A replica which restarts
+// without its persisted state, or joins after a reconfiguration, adopts the
+// epoch it hears of from f+1 other replicas.
+
+const epochKey = "epoch"
+
+// validatorSet describes the configured validator set, the epoch increments
+// when it changes
+func (instance *pbftCore) validatorSet() string {
+	return fmt.Sprintf("N=%d f=%d weights=%v", instance.N, instance.f, instance.weights)
+}
+
+// restoreEpoch restores the epoch of the replica, and enters the next epoch
+// if the validator set changed since it was persisted
+func (instance *pbftCore) restoreEpoch() {
+	validators := instance.validatorSet()
+	info := &EpochInfo{}
+	raw, err := instance.consumer.ReadState(epochKey)
+	if err != nil {
+		// persisted along with the first certificates
+		logger.Debugf("Replica %d has no persisted epoch, starting in epoch 0: %s", instance.id, err)
+		return
+	}
+	if err = proto.Unmarshal(raw, info); err != nil {
+		logger.Errorf("Replica %d could not unmarshal its epoch - local state is damaged: %s", instance.id, err)
+		return
+	}
+
+	instance.epoch = info.Epoch
+	instance.epochStored = true
+	if info.Validators != validators {
+		instance.epoch++
+		logger.Warningf("Replica %d validator set changed from %s to %s, entering epoch %d", instance.id, info.Validators, validators, instance.epoch)
+		instance.persistEpoch()
+	}
+}
+
+func (instance *pbftCore) persistEpoch() {
+	raw, err := proto.Marshal(&EpochInfo{Epoch: instance.epoch, Validators: instance.validatorSet()})
+	if err != nil {
+		logger.Warningf("Replica %d could not persist its epoch: %s", instance.id, err)
+		return
+	}
+	instance.consumer.StoreState(epochKey, raw)
+	instance.epochStored = true
+}
+
+// recvOtherEpoch handles a message of another epoch than the replica's own,
+// the replica adopts a later epoch once f+1 replicas sent messages of it
+func (instance *pbftCore) recvOtherEpoch(epoch uint64, senderID uint64) {
+	if epoch < instance.epoch {
+		logger.Debugf("Replica %d ignoring message of replica %d from epoch %d, it is in epoch %d", instance.id, senderID, epoch, instance.epoch)
+		return
+	}
+	logger.Infof("Replica %d ignoring message of replica %d from epoch %d, it is still in epoch %d", instance.id, senderID, epoch, instance.epoch)
+
+	if instance.epochReports[senderID] >= epoch {
+		return
+	}
+	instance.epochReports[senderID] = epoch
+
+	// the highest epoch reported by f+1 replicas was entered by a correct one
+	for target := epoch; target > instance.epoch; target-- {
+		replicas := make(map[uint64]bool)
+		for id, reported := range instance.epochReports {
+			if reported >= target {
+				replicas[id] = true
+			}
+		}
+		if instance.weightOf(replicas) >= instance.weakQuorum() {
+			instance.enterEpoch(target)
+			return
+		}
+	}
+}
+
+// enterEpoch moves the replica to view 0 of a later epoch, dropping the
+// certificates of its current one
+func (instance *pbftCore) enterEpoch(epoch uint64) {
+	logger.Warningf("Replica %d entering epoch %d, leaving epoch %d in view %d", instance.id, epoch, instance.epoch, instance.view)
+	instance.epoch = epoch
+	instance.view = 0
+	instance.activeView = true
+	instance.stopTimer()
+	instance.certStore = make(map[msgID]*msgCert)
+	instance.pset = make(map[uint64]*ViewChange_PQ)
+	instance.qset = make(map[qidx]*ViewChange_PQ)
+	instance.viewChangeStore = make(map[vcidx]*ViewChange)
+	instance.newViewStore = make(map[uint64]*NewView)
+	instance.heldCommits = nil
+	instance.rotationBacklog = nil
+	instance.peerViews = make(map[uint64]msgID)
+	for id, reported := range instance.epochReports {
+		if reported <= epoch {
+			delete(instance.epochReports, id)
+		}
+	}
+
+	instance.persistPSet()
+	instance.persistQSet()
+	instance.persistEpoch()
+	instance.updateViewChangeSeqNo()
+}
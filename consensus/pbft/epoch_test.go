@@ -0,0 +1,102 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package pbft
+
+import (
+	"testing"
+	"time"
+)
+
+func TestEpochOnValidatorSetChange(t *testing.T) {
+	config := loadConfig()
+	net := makeSimNetwork(4, 15, config)
+	defer net.stop()
+
+	net.submitAll(createPbftReqBatch(1, 0))
+	r := net.replicas[1]
+	if !net.runUntil(time.Minute, func() bool { return len(r.executions) == 1 }) {
+		t.Fatalf("Request batch was not executed")
+	}
+
+	same := newPbftCore(r.id, config, r, &simTimerFactory{net: net, replica: r})
+	defer same.close()
+	if same.epoch != 0 || len(same.qset) == 0 {
+		t.Errorf("Expected to restart in epoch 0 with the certificates of epoch 0, got epoch %d with %d certificates", same.epoch, len(same.qset))
+	}
+
+	reconfigured := loadConfig()
+	reconfigured.Set("general.weights", "3 1 1 1")
+	restarted := newPbftCore(r.id, reconfigured, r, &simTimerFactory{net: net, replica: r})
+	defer restarted.close()
+	if restarted.epoch != 1 || restarted.view != 0 {
+		t.Errorf("Expected to restart in view 0 of epoch 1 after the validator set changed, got view %d of epoch %d", restarted.view, restarted.epoch)
+	}
+	if len(restarted.pset) != 0 || len(restarted.qset) != 0 {
+		t.Errorf("Expected the certificates of epoch 0 to be discarded, got pset %d, qset %d", len(restarted.pset), len(restarted.qset))
+	}
+
+	again := newPbftCore(r.id, reconfigured, r, &simTimerFactory{net: net, replica: r})
+	defer again.close()
+	if again.epoch != 1 {
+		t.Errorf("Expected to stay in epoch 1 with the same validator set, got epoch %d", again.epoch)
+	}
+}
+
+func TestAdoptEpoch(t *testing.T) {
+	net := makeSimNetwork(4, 16, loadConfig())
+	defer net.stop()
+
+	for _, r := range net.replicas[:3] {
+		r.pbft.epoch = 2
+	}
+	behind := net.replicas[3]
+
+	net.submitAll(createPbftReqBatch(1, 0))
+	if !net.runUntil(time.Minute, func() bool { return len(net.replicas[0].executions) == 1 }) {
+		t.Fatalf("Replicas of epoch 2 did not execute the request batch")
+	}
+	if behind.pbft.epoch != 2 {
+		t.Fatalf("Expected replica 3 to adopt epoch 2 of f+1 replicas, it is in epoch %d", behind.pbft.epoch)
+	}
+
+	net.submitAll(createPbftReqBatch(2, 0))
+	if !net.runUntil(time.Minute, func() bool { return len(behind.executions) == 2 }) {
+		t.Errorf("Expected replica 3 to execute in epoch 2, executed %d request batches", len(behind.executions))
+	}
+}
+
+func TestIgnoreEarlierEpoch(t *testing.T) {
+	net := makeSimNetwork(4, 17, loadConfig())
+	defer net.stop()
+	instance := net.replicas[1].pbft
+	instance.epoch = 1
+
+	reqBatch := createPbftReqBatch(1, 0)
+	instance.ProcessEvent(pbftMessageEvent{
+		sender: 0,
+		msg: &Message{Epoch: 0, Payload: &Message_PrePrepare{PrePrepare: &PrePrepare{
+			View:           0,
+			SequenceNumber: 1,
+			BatchDigest:    hash(reqBatch),
+			RequestBatch:   reqBatch,
+			ReplicaId:      0,
+		}}},
+	})
+	if len(instance.certStore) != 0 {
+		t.Errorf("Expected a pre-prepare of an earlier epoch to be ignored")
+	}
+}
@@ -0,0 +1,164 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package pbft
+
+// With the fast path enabled, a request batch which every replica prepares
+// commits without waiting for the commit round, as in Zyzzyva.  Commits are
+// still sent, so replicas which do not see every prepare, because a replica
+// disagrees or is slow, fall back to the standard commit quorum.
+//
+// A fast commit leaves no commit certificate behind, the new view preserves
+// it because every correct replica pre-prepared the batch, so at least f+1
+// of the view-changes report it in their Q set.  f+1 view-changes may also
+// report a batch which faulty replicas pre-prepared with some correct ones,
+// so prepares are signed, and P set entries carry the prepares which certify
+// them: a certified entry in the same view rules out a fast commit of any
+// other batch.  This keeps the fast path safe with N = 3f+1 replicas.
+
+// fastCommitted returns whether every replica prepared the request batch
+func (instance *pbftCore) fastCommitted(digest string, v uint64, n uint64) bool {
+	if !instance.fastPath || !instance.prePrepared(digest, v, n) {
+		return false
+	}
+
+	cert := instance.certStore[msgID{v, n}]
+	if cert == nil {
+		return false
+	}
+
+	replicas := make(map[uint64]bool)
+	for _, p := range cert.prepare {
+		if p.View == v && p.SequenceNumber == n && p.BatchDigest == digest {
+			replicas[p.ReplicaId] = true
+		}
+	}
+
+	// the pre-prepare stands in for the prepare of the primary
+	return instance.weightOf(replicas)+instance.weight(instance.primary(v)) >= instance.totalWeight()
+}
+
+// prepareCertificate returns the signed prepares which prepared the request
+// batch, to certify its P set entry, or nil when the fast path is disabled
+func (instance *pbftCore) prepareCertificate(cert *msgCert, digest string, v uint64, n uint64) []*Prepare {
+	if !instance.fastPath {
+		return nil
+	}
+
+	var prepares []*Prepare
+	for _, p := range cert.prepare {
+		if p.View == v && p.SequenceNumber == n && p.BatchDigest == digest {
+			prepares = append(prepares, p)
+		}
+	}
+	return prepares
+}
+
+// certified returns whether the signed prepares of a P set entry show that
+// the request batch prepared, no other batch can then have been prepared or
+// fast committed in the same view
+func (instance *pbftCore) certified(p *ViewChange_PQ) bool {
+	replicas := make(map[uint64]bool)
+	for _, prep := range p.Prepares {
+		if prep.View != p.View || prep.SequenceNumber != p.SequenceNumber || prep.BatchDigest != p.BatchDigest {
+			continue
+		}
+		if prep.ReplicaId == instance.primary(p.View) || replicas[prep.ReplicaId] {
+			continue
+		}
+		if err := instance.verify(prep); err != nil {
+			logger.Warningf("Replica %d found an incorrect signature by replica %d certifying view=%d/seqNo=%d: %s",
+				instance.id, prep.ReplicaId, p.View, p.SequenceNumber, err)
+			continue
+		}
+		replicas[prep.ReplicaId] = true
+	}
+
+	return instance.weightOf(replicas)+instance.weight(instance.primary(p.View)) >= instance.intersectionQuorum()
+}
+
+type fastPathCandidate struct {
+	digest string
+	view   uint64
+}
+
+// fastPathDigest returns the request batch which may have committed at seqNo
+// n, and must therefore be selected for it by the new view.  A batch which
+// committed normally has a certified P set entry among the view-changes, and
+// one which fast committed was pre-prepared by all correct replicas, so f+1
+// view-changes report it in the highest view any batch has that support in.
+// When neither applies, nothing committed at n, and the standard rules pick
+// the batch.
+func (instance *pbftCore) fastPathDigest(vset []*ViewChange, n uint64) (string, bool) {
+	var certified *ViewChange_PQ
+	support := make(map[fastPathCandidate]map[uint64]bool)
+	for _, vc := range vset {
+		if vc.H >= n {
+			continue
+		}
+		for _, p := range vc.Pset {
+			if p.SequenceNumber == n && (certified == nil || p.View > certified.View) && instance.certified(p) {
+				certified = p
+			}
+		}
+		for _, q := range vc.Qset {
+			if q.SequenceNumber != n {
+				continue
+			}
+			c := fastPathCandidate{q.BatchDigest, q.View}
+			if support[c] == nil {
+				support[c] = make(map[uint64]bool)
+			}
+			support[c][vc.ReplicaId] = true
+		}
+	}
+
+	// a replica pre-preparing the batch again in a later view supports it too
+	for c, senders := range support {
+		for other, otherSenders := range support {
+			if other.digest == c.digest && other.view > c.view {
+				for id := range otherSenders {
+					senders[id] = true
+				}
+			}
+		}
+	}
+
+	// correct replicas pre-prepare a single batch per view, so two batches
+	// with f+1 support in the highest view mean neither fast committed
+	var best fastPathCandidate
+	found, ambiguous := false, false
+	for c, senders := range support {
+		if instance.weightOf(senders) < instance.weakQuorum() {
+			continue
+		}
+		switch {
+		case !found || c.view > best.view:
+			best = c
+			found, ambiguous = true, false
+		case c.view == best.view && c.digest != best.digest:
+			ambiguous = true
+		}
+	}
+
+	if certified != nil && (!found || certified.View >= best.view) {
+		return certified.BatchDigest, true
+	}
+	if !found || ambiguous {
+		return "", false
+	}
+	return best.digest, true
+}
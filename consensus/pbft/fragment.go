@@ -0,0 +1,169 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package pbft
+
+import (
+	"bytes"
+	"time"
+)
+
+// maxPendingAssemblies bounds the number of partially received messages
+// kept per sender, so that a faulty replica cannot exhaust our memory
+const maxPendingAssemblies = 8
+
+// fragmenter splits marshaled batch messages which exceed the maximum
+// message size into fragments, and reassembles the fragments received
+// from other replicas.  The digest of a fragmented message is computed
+// over the complete payload, and checked once it is reassembled.
+type fragmenter struct {
+	maxSize  int
+	maxCount uint64                          // most fragments the messages of a sender being reassembled may have together
+	timeout  time.Duration                   // how long an incomplete message is kept
+	pending  map[uint64]map[string]*assembly // sender to digest to reassembly in progress
+}
+
+type assembly struct {
+	parts    map[uint64][]byte // fragments received, by index
+	count    uint64            // fragments the message was announced with
+	received uint64
+	started  time.Time
+}
+
+// newFragmenter creates a fragmenter for payloads of at most maxSize bytes,
+// which reassembles at most maxTotal bytes of messages per sender at a time
+// and drops messages still incomplete after timeout.  A maxSize of zero
+// disables fragmentation
+func newFragmenter(maxSize int, maxTotal int, timeout time.Duration) *fragmenter {
+	f := &fragmenter{
+		maxSize: maxSize,
+		timeout: timeout,
+		pending: make(map[uint64]map[string]*assembly),
+	}
+	if maxSize > 0 && maxTotal > 0 {
+		f.maxCount = uint64((maxTotal + maxSize - 1) / maxSize)
+	}
+	return f
+}
+
+// split returns the fragments to send instead of the payload, or nil if
+// the payload is small enough to be sent as is
+func (f *fragmenter) split(payload []byte) []*Fragment {
+	if f.maxSize <= 0 || len(payload) <= f.maxSize {
+		return nil
+	}
+	digest := hash(payload)
+	count := uint64((len(payload) + f.maxSize - 1) / f.maxSize)
+	fragments := make([]*Fragment, 0, count)
+	for i := uint64(0); i < count; i++ {
+		end := int(i+1) * f.maxSize
+		if end > len(payload) {
+			end = len(payload)
+		}
+		fragments = append(fragments, &Fragment{
+			Digest: digest,
+			Index:  i,
+			Count:  count,
+			Data:   payload[int(i)*f.maxSize : end],
+		})
+	}
+	return fragments
+}
+
+// add stores a fragment received from sender, and returns the complete
+// payload once all fragments of the message have been received
+func (f *fragmenter) add(sender uint64, frag *Fragment) []byte {
+	if frag.Count == 0 || frag.Index >= frag.Count {
+		logger.Warningf("Received malformed fragment %d/%d from replica %d", frag.Index, frag.Count, sender)
+		return nil
+	}
+	if f.maxSize <= 0 || frag.Count > f.maxCount || len(frag.Data) > f.maxSize {
+		logger.Warningf("Replica %d sent fragment %d/%d of %d bytes exceeding the maximum message size, discarding", sender, frag.Index, frag.Count, len(frag.Data))
+		return nil
+	}
+
+	now := time.Now()
+	f.expire(now)
+
+	assemblies, ok := f.pending[sender]
+	if !ok {
+		assemblies = make(map[string]*assembly)
+		f.pending[sender] = assemblies
+	}
+
+	a, ok := assemblies[frag.Digest]
+	if !ok {
+		if len(assemblies) >= maxPendingAssemblies {
+			logger.Warningf("Replica %d has too many incomplete messages in flight, discarding fragment of %s", sender, frag.Digest)
+			return nil
+		}
+		// the announced sizes of the messages in flight count against the
+		// limit, rather than the fragments received so far
+		announced := frag.Count
+		for _, other := range assemblies {
+			announced += other.count
+		}
+		if announced > f.maxCount {
+			logger.Warningf("Replica %d announced %d fragments of incomplete messages, exceeding the limit of %d, discarding fragment of %s", sender, announced, f.maxCount, frag.Digest)
+			return nil
+		}
+		a = &assembly{parts: make(map[uint64][]byte), count: frag.Count, started: now}
+		assemblies[frag.Digest] = a
+	}
+
+	if a.count != frag.Count {
+		logger.Warningf("Replica %d sent fragment of %s with count %d, expected %d, discarding", sender, frag.Digest, frag.Count, a.count)
+		return nil
+	}
+	if _, ok := a.parts[frag.Index]; ok {
+		return nil
+	}
+	a.parts[frag.Index] = frag.Data
+	a.received++
+	if a.received < a.count {
+		return nil
+	}
+
+	delete(assemblies, frag.Digest)
+	parts := make([][]byte, a.count)
+	for i, part := range a.parts {
+		parts[i] = part
+	}
+	payload := bytes.Join(parts, nil)
+	if digest := hash(payload); digest != frag.Digest {
+		logger.Warningf("Reassembled message from replica %d has digest %s, expected %s, discarding", sender, digest, frag.Digest)
+		return nil
+	}
+	return payload
+}
+
+// expire drops the messages whose fragments did not all arrive in time
+func (f *fragmenter) expire(now time.Time) {
+	if f.timeout <= 0 {
+		return
+	}
+	for sender, assemblies := range f.pending {
+		for digest, a := range assemblies {
+			if now.Sub(a.started) > f.timeout {
+				logger.Warningf("Message %s from replica %d was not reassembled in %v, discarding %d/%d fragments", digest, sender, f.timeout, a.received, a.count)
+				delete(assemblies, digest)
+			}
+		}
+		if len(assemblies) == 0 {
+			delete(f.pending, sender)
+		}
+	}
+}
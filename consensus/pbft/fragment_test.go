@@ -0,0 +1,130 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package pbft
+
+import (
+	"bytes"
+	"testing"
+	"time"
+)
+
+func TestFragmentReassembly(t *testing.T) {
+	f := newFragmenter(10, 100, time.Minute)
+	payload := []byte("a payload which does not fit into a single fragment")
+
+	if f.split(payload[:10]) != nil {
+		t.Fatalf("Payload which fits should not be fragmented")
+	}
+
+	fragments := f.split(payload)
+	if len(fragments) != 6 {
+		t.Fatalf("Expected 6 fragments, got %d", len(fragments))
+	}
+
+	// deliver out of order, with a duplicate
+	order := []int{5, 0, 3, 3, 1, 4}
+	for _, i := range order {
+		if f.add(1, fragments[i]) != nil {
+			t.Fatalf("Message should not be complete before all fragments arrived")
+		}
+	}
+	if result := f.add(1, fragments[2]); !bytes.Equal(result, payload) {
+		t.Fatalf("Reassembled payload %q does not match %q", result, payload)
+	}
+	if len(f.pending[1]) != 0 {
+		t.Errorf("Completed message should no longer be pending")
+	}
+}
+
+func TestFragmentDigestMismatch(t *testing.T) {
+	f := newFragmenter(10, 100, time.Minute)
+	fragments := f.split([]byte("a payload which will be tampered with"))
+	fragments[1].Data = []byte("tampered!!")
+
+	var result []byte
+	for _, fragment := range fragments {
+		result = f.add(1, fragment)
+	}
+	if result != nil {
+		t.Fatalf("Tampered message should have been discarded")
+	}
+}
+
+func TestFragmentBounds(t *testing.T) {
+	f := newFragmenter(10, 100, time.Minute)
+
+	if f.add(1, &Fragment{Digest: "huge", Index: 0, Count: 1 << 40, Data: []byte("x")}) != nil || len(f.pending[1]) != 0 {
+		t.Fatalf("Fragment of a message exceeding the maximum size should have been discarded")
+	}
+	if f.add(1, &Fragment{Digest: "big", Index: 0, Count: 2, Data: make([]byte, 11)}) != nil || len(f.pending[1]) != 0 {
+		t.Fatalf("Fragment exceeding the fragment size should have been discarded")
+	}
+
+	fragments := f.split([]byte("a payload which does not fit into a single fragment"))
+	f.add(1, fragments[0])
+	if f.add(1, &Fragment{Digest: fragments[1].Digest, Index: 1, Count: 10, Data: fragments[1].Data}) != nil {
+		t.Fatalf("Fragment with an inconsistent count should have been discarded")
+	}
+	if a := f.pending[1][fragments[0].Digest]; a == nil || a.received != 1 {
+		t.Fatalf("Fragment with an inconsistent count should not affect the pending message")
+	}
+}
+
+func TestFragmentExpiry(t *testing.T) {
+	f := newFragmenter(10, 100, time.Minute)
+	fragments := f.split([]byte("a payload which does not fit into a single fragment"))
+	f.add(1, fragments[0])
+
+	f.expire(time.Now().Add(2 * time.Minute))
+	if len(f.pending) != 0 {
+		t.Fatalf("Incomplete message should have expired")
+	}
+
+	var result []byte
+	for _, fragment := range fragments[1:] {
+		result = f.add(1, fragment)
+	}
+	if result != nil {
+		t.Fatalf("Message should not be reassembled without its expired fragment")
+	}
+}
+
+func TestFragmentPendingLimit(t *testing.T) {
+	f := newFragmenter(10, 100, time.Minute)
+
+	// the announced size counts, however few fragments arrived
+	if f.add(1, &Fragment{Digest: "first", Index: 0, Count: 8, Data: []byte("x")}) != nil {
+		t.Fatalf("Message should not be complete before all fragments arrived")
+	}
+	if a := f.pending[1]["first"]; a == nil || len(a.parts) != 1 {
+		t.Fatalf("Only the received fragment should be stored, got %v", a)
+	}
+	if f.add(1, &Fragment{Digest: "second", Index: 0, Count: 3, Data: []byte("x")}); f.pending[1]["second"] != nil {
+		t.Fatalf("Fragment exceeding the bytes pending from the sender should have been discarded")
+	}
+	if f.add(1, &Fragment{Digest: "third", Index: 0, Count: 2, Data: []byte("x")}); f.pending[1]["third"] == nil {
+		t.Fatalf("Fragment within the bytes pending from the sender should have been kept")
+	}
+	if f.add(2, &Fragment{Digest: "second", Index: 0, Count: 3, Data: []byte("x")}); f.pending[2]["second"] == nil {
+		t.Fatalf("Fragments of another sender should not count against the limit")
+	}
+
+	f.expire(time.Now().Add(2 * time.Minute))
+	if f.add(1, &Fragment{Digest: "second", Index: 0, Count: 3, Data: []byte("x")}); f.pending[1]["second"] == nil {
+		t.Fatalf("Expired messages should no longer count against the limit")
+	}
+}
@@ -0,0 +1,120 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package pbft
+
+// A replica which lost some of the messages for a sequence number cannot
+// execute it, nor anything after it, even though later sequence numbers
+// commit.  Rather than waiting for the network to move its watermarks out of
+// reach and catching up by state transfer, the replica asks the other
+// replicas for the certificate it lacks once such a gap has lasted for the
+// gap repair timeout.  Each replica answers by sending its own pre-prepare,
+// prepare and commit for that sequence number again, so that the certificate
+// is rebuilt from messages authenticated as usual.  The request is repeated
+// every timeout until the gap closes.
+
+// gapRepairTimerEvent is sent when a gap in execution lasted for the gap repair timeout
+type gapRepairTimerEvent struct{}
+
+// gapEnd returns the highest sequence number which committed although the
+// next sequence number to execute did not
+func (instance *pbftCore) gapEnd() (uint64, bool) {
+	next := instance.lastExec + 1
+	var end uint64
+	for idx, cert := range instance.certStore {
+		if idx.n < next || !instance.committed(cert.digest, idx.v, idx.n) {
+			continue
+		}
+		if idx.n == next {
+			return 0, false // no gap, only waiting to execute
+		}
+		if idx.n > end {
+			end = idx.n
+		}
+	}
+	return end, end != 0
+}
+
+// checkGap starts the gap repair timer if execution is stuck on a gap
+func (instance *pbftCore) checkGap() {
+	if instance.gapRepairTimeout <= 0 || instance.gapTimerActive || instance.skipInProgress || !instance.activeView {
+		return
+	}
+	if _, ok := instance.gapEnd(); !ok {
+		return
+	}
+	logger.Debugf("Replica %d cannot execute seqNo=%d while later sequence numbers committed, starting gap repair timer", instance.id, instance.lastExec+1)
+	instance.gapTimerActive = true
+	instance.gapRepairTimer.Reset(instance.gapRepairTimeout, gapRepairTimerEvent{})
+}
+
+// gapRepairTimerHandler asks the other replicas for the certificates of the
+// sequence numbers missing below the highest committed one
+func (instance *pbftCore) gapRepairTimerHandler() {
+	instance.gapTimerActive = false
+	if instance.skipInProgress || !instance.activeView {
+		return
+	}
+	end, ok := instance.gapEnd()
+	if !ok {
+		return
+	}
+
+	for n := instance.lastExec + 1; n < end; n++ {
+		if cert, ok := instance.certStore[msgID{instance.view, n}]; ok && instance.committed(cert.digest, instance.view, n) {
+			continue
+		}
+		logger.Infof("Replica %d missing the certificate for view=%d/seqNo=%d although seqNo=%d committed, fetching it", instance.id, instance.view, n, end)
+		instance.innerBroadcast(&Message{Payload: &Message_FetchCert{FetchCert: &FetchCert{
+			View:           instance.view,
+			SequenceNumber: n,
+			ReplicaId:      instance.id,
+		}}})
+	}
+	instance.checkGap()
+}
+
+// recvFetchCert sends this replica's messages for a sequence number again
+// to the replica which lacks its certificate
+func (instance *pbftCore) recvFetchCert(fc *FetchCert) error {
+	if !instance.activeView || fc.View != instance.view {
+		return nil
+	}
+	cert, ok := instance.certStore[msgID{fc.View, fc.SequenceNumber}]
+	if !ok || cert.prePrepare == nil {
+		return nil // we can't help either
+	}
+
+	logger.Debugf("Replica %d sending its messages for view=%d/seqNo=%d again to replica %d", instance.id, fc.View, fc.SequenceNumber, fc.ReplicaId)
+	if instance.primary(fc.View) == instance.id {
+		if err := instance.innerUnicast(&Message{Payload: &Message_PrePrepare{PrePrepare: cert.prePrepare}}, fc.ReplicaId); err != nil {
+			return err
+		}
+	}
+	if cert.sentPrepare {
+		prep := &Prepare{View: fc.View, SequenceNumber: fc.SequenceNumber, BatchDigest: cert.digest, ReplicaId: instance.id}
+		if err := instance.innerUnicast(&Message{Payload: &Message_Prepare{Prepare: prep}}, fc.ReplicaId); err != nil {
+			return err
+		}
+	}
+	if cert.sentCommit {
+		commit := &Commit{View: fc.View, SequenceNumber: fc.SequenceNumber, BatchDigest: cert.digest, ReplicaId: instance.id}
+		if err := instance.innerUnicast(&Message{Payload: &Message_Commit{Commit: commit}}, fc.ReplicaId); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,91 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package pbft
+
+import (
+	"testing"
+	"time"
+)
+
+func TestGapRepair(t *testing.T) {
+	net := makeSimNetwork(4, 11, loadConfig())
+	defer net.stop()
+
+	// replica 3 loses every message for seqNo 1 until it asks for them
+	fetched := false
+	net.filterFn = func(src, dst uint64, msg *Message) (*Message, bool) {
+		if fc := msg.GetFetchCert(); fc != nil && src == 3 && fc.SequenceNumber == 1 {
+			fetched = true
+		}
+		if dst != 3 || fetched {
+			return msg, true
+		}
+		if preprep := msg.GetPrePrepare(); preprep != nil && preprep.SequenceNumber == 1 {
+			return nil, false
+		}
+		if prep := msg.GetPrepare(); prep != nil && prep.SequenceNumber == 1 {
+			return nil, false
+		}
+		if commit := msg.GetCommit(); commit != nil && commit.SequenceNumber == 1 {
+			return nil, false
+		}
+		return msg, true
+	}
+
+	net.submitAll(createPbftReqBatch(1, 0))
+	net.submitAll(createPbftReqBatch(2, 0))
+	r := net.replicas[3]
+	if !net.runUntil(time.Minute, func() bool { return len(r.executions) == 2 }) {
+		t.Fatalf("Replica 3 did not execute both request batches, executed %d", len(r.executions))
+	}
+	if !fetched {
+		t.Errorf("Expected replica 3 to fetch the certificate it missed")
+	}
+	if r.pbft.view != 0 || r.executions[0] != hash(createPbftReqBatch(1, 0)) {
+		t.Errorf("Expected replica 3 to execute the missed request batch first in view 0, it is in view %d", r.pbft.view)
+	}
+}
+
+func TestNoGapWhileWaitingToExecute(t *testing.T) {
+	net := makeSimNetwork(4, 12, loadConfig())
+	defer net.stop()
+	instance := net.replicas[0].pbft
+
+	instance.certStore[msgID{0, 2}] = &msgCert{}
+	if _, ok := instance.gapEnd(); ok {
+		t.Errorf("Uncommitted sequence numbers should not make a gap")
+	}
+
+	committed := func(n uint64) {
+		cert := instance.getCert(0, n)
+		cert.prePrepare = &PrePrepare{View: 0, SequenceNumber: n, ReplicaId: 0}
+		for id := uint64(0); id < 4; id++ {
+			if id != 0 {
+				cert.prepare = append(cert.prepare, &Prepare{View: 0, SequenceNumber: n, ReplicaId: id})
+			}
+			cert.commit = append(cert.commit, &Commit{View: 0, SequenceNumber: n, ReplicaId: id})
+		}
+	}
+	committed(3)
+	if end, ok := instance.gapEnd(); !ok || end != 3 {
+		t.Errorf("Expected a gap up to seqNo 3, got %d", end)
+	}
+	committed(1)
+	if _, ok := instance.gapEnd(); ok {
+		t.Errorf("A committed next sequence number should not make a gap")
+	}
+}
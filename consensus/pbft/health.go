@@ -0,0 +1,326 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package pbft
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/hyperledger/fabric/consensus"
+	"github.com/hyperledger/fabric/consensus/util/events"
+)
+
+// Kinds of lag tracked for every replica, each is measured from the moment
+// this replica could have expected the other replica's message
+const (
+	lagPrePrepare = iota // from a request batch reaching this replica until the primary pre-prepares it
+	lagPrepare           // from the pre-prepare until the replica's prepare arrives
+	lagCommit            // from prepared until the replica's commit arrives
+	lagCheckpoint        // from this replica's checkpoint until the replica's matching checkpoint arrives
+	lagKinds
+)
+
+// healthSmoothing is the inverse weight of a new sample in the smoothed lags
+const healthSmoothing = 4
+
+// ReplicaHealth is a snapshot of how responsive a replica has been, as seen
+// by this replica.  The lags are smoothed over recent samples.
+type ReplicaHealth struct {
+	ReplicaID     uint64        `json:"replica"`
+	Primary       bool          `json:"primary"`
+	PrePrepareLag time.Duration `json:"prePrepareLag"` // only sampled while the replica is primary
+	PrepareLag    time.Duration `json:"prepareLag"`
+	CommitLag     time.Duration `json:"commitLag"`
+	CheckpointLag time.Duration `json:"checkpointLag"`
+	Samples       uint64        `json:"samples"`
+	// Suspicion is the largest lag relative to the request timeout, from 0
+	// for a responsive replica up to 1 for a replica whose lag would expire
+	// the request timer.  A degrading primary shows a rising suspicion
+	// before it causes view changes.
+	Suspicion float64 `json:"suspicion"`
+}
+
+// healthTracker scores the responsiveness of the replicas, it is written by
+// the pbft thread and may be read from any other
+type healthTracker struct {
+	lock      sync.Mutex
+	lags      [][lagKinds]time.Duration // smoothed lags, by replica
+	samples   []uint64
+	suspected []bool        // whether the suspicion of each replica reached the threshold
+	primary   uint64        // the primary of the current view
+	timeout   time.Duration // lags are scored relative to the request timeout
+	threshold float64       // suspicion warranting a warning, zero for none
+
+	// only accessed by the pbft thread
+	requestSeen map[string]time.Time            // when request batches which are not pre-prepared yet reached this replica
+	chkptAt     map[uint64]time.Time            // when this replica checkpointed each sequence number
+	chkptSeen   map[uint64]map[uint64]time.Time // when the checkpoints of the other replicas arrived, by sequence number
+}
+
+func newHealthTracker(N int, threshold float64) *healthTracker {
+	return &healthTracker{
+		lags:        make([][lagKinds]time.Duration, N),
+		samples:     make([]uint64, N),
+		suspected:   make([]bool, N),
+		threshold:   threshold,
+		requestSeen: make(map[string]time.Time),
+		chkptAt:     make(map[uint64]time.Time),
+		chkptSeen:   make(map[uint64]map[uint64]time.Time),
+	}
+}
+
+// observe adds a lag sample for a replica, and returns its suspicion if it
+// just reached or dropped below the threshold
+func (ht *healthTracker) observe(replicaID uint64, kind int, lag time.Duration) (float64, bool) {
+	ht.lock.Lock()
+	defer ht.lock.Unlock()
+	if replicaID >= uint64(len(ht.lags)) {
+		return 0, false
+	}
+	if lag < 0 {
+		lag = 0
+	}
+
+	smoothed := &ht.lags[replicaID][kind]
+	*smoothed += (lag - *smoothed) / healthSmoothing
+	ht.samples[replicaID]++
+
+	if ht.threshold <= 0 {
+		return 0, false
+	}
+	suspicion := ht.suspicion(replicaID)
+	if (suspicion >= ht.threshold) == ht.suspected[replicaID] {
+		return suspicion, false
+	}
+	ht.suspected[replicaID] = !ht.suspected[replicaID]
+	return suspicion, true
+}
+
+// suspicion must be called with the lock held
+func (ht *healthTracker) suspicion(replicaID uint64) float64 {
+	if ht.timeout <= 0 {
+		return 0
+	}
+	var worst time.Duration
+	for _, lag := range ht.lags[replicaID] {
+		if lag > worst {
+			worst = lag
+		}
+	}
+	if s := float64(worst) / float64(ht.timeout); s < 1 {
+		return s
+	}
+	return 1
+}
+
+// update records the primary and the request timeout the scores refer to
+func (ht *healthTracker) update(primary uint64, timeout time.Duration) {
+	ht.lock.Lock()
+	defer ht.lock.Unlock()
+	ht.primary = primary
+	ht.timeout = timeout
+}
+
+// snapshot returns the health of every replica, by replica ID
+func (ht *healthTracker) snapshot() []ReplicaHealth {
+	ht.lock.Lock()
+	defer ht.lock.Unlock()
+	snap := make([]ReplicaHealth, len(ht.lags))
+	for id, lags := range ht.lags {
+		snap[id] = ReplicaHealth{
+			ReplicaID:     uint64(id),
+			Primary:       uint64(id) == ht.primary,
+			PrePrepareLag: lags[lagPrePrepare],
+			PrepareLag:    lags[lagPrepare],
+			CommitLag:     lags[lagCommit],
+			CheckpointLag: lags[lagCheckpoint],
+			Samples:       ht.samples[id],
+			Suspicion:     ht.suspicion(uint64(id)),
+		}
+	}
+	return snap
+}
+
+// observeLag records a lag sample for another replica
+func (instance *pbftCore) observeLag(replicaID uint64, kind int, lag time.Duration) {
+	if replicaID == instance.id {
+		return
+	}
+	primary := instance.primary(instance.view)
+	instance.health.update(primary, instance.requestTimeout)
+	suspicion, changed := instance.health.observe(replicaID, kind, lag)
+	if !changed {
+		return
+	}
+	role := "replica"
+	if replicaID == primary {
+		role = "primary"
+	}
+	if suspicion >= instance.health.threshold {
+		logger.Warningf("Replica %d suspects %s %d of degrading, its suspicion score is %.2f", instance.id, role, replicaID, suspicion)
+	} else {
+		logger.Infof("Replica %d no longer suspects %s %d, its suspicion score is %.2f", instance.id, role, replicaID, suspicion)
+	}
+}
+
+// observeSince records the time elapsed since start as a lag sample, a zero
+// start means the message arrived before it was expected, without lag
+func (instance *pbftCore) observeSince(replicaID uint64, kind int, start time.Time) {
+	var lag time.Duration
+	if !start.IsZero() {
+		lag = time.Since(start)
+	}
+	instance.observeLag(replicaID, kind, lag)
+}
+
+// observeCheckpoint records the lag of a checkpoint of another replica
+// behind this replica's own
+func (instance *pbftCore) observeCheckpoint(chkpt *Checkpoint) {
+	ht := instance.health
+	if chkpt.ReplicaId == instance.id {
+		ht.chkptAt[chkpt.SequenceNumber] = time.Now()
+		return
+	}
+	seen, ok := ht.chkptSeen[chkpt.SequenceNumber]
+	if !ok {
+		seen = make(map[uint64]time.Time)
+		ht.chkptSeen[chkpt.SequenceNumber] = seen
+	}
+	if _, ok := seen[chkpt.ReplicaId]; ok {
+		return
+	}
+	seen[chkpt.ReplicaId] = time.Now()
+	instance.observeSince(chkpt.ReplicaId, lagCheckpoint, ht.chkptAt[chkpt.SequenceNumber])
+}
+
+// observeMissingVotes charges the replicas which never prepared or
+// committed a certificate which is being discarded with the time they let
+// pass, so that a silent replica does not look healthy for lack of samples
+func (instance *pbftCore) observeMissingVotes(idx msgID, cert *msgCert) {
+	prepared := make(map[uint64]bool)
+	for _, prep := range cert.prepare {
+		prepared[prep.ReplicaId] = true
+	}
+	committed := make(map[uint64]bool)
+	for _, commit := range cert.commit {
+		committed[commit.ReplicaId] = true
+	}
+	for id := uint64(0); id < uint64(instance.N); id++ {
+		if !prepared[id] && id != instance.primary(idx.v) && !cert.prePrepareAt.IsZero() {
+			instance.observeSince(id, lagPrepare, cert.prePrepareAt)
+		}
+		if !committed[id] && !cert.preparedAt.IsZero() {
+			instance.observeSince(id, lagCommit, cert.preparedAt)
+		}
+	}
+}
+
+// collectHealth discards the health records up to the new low watermark,
+// charging the replicas whose checkpoints never arrived
+func (instance *pbftCore) collectHealth(h uint64) {
+	ht := instance.health
+	for n, at := range ht.chkptAt {
+		if n > h {
+			continue
+		}
+		for id := uint64(0); id < uint64(instance.N); id++ {
+			if _, ok := ht.chkptSeen[n][id]; !ok {
+				instance.observeSince(id, lagCheckpoint, at)
+			}
+		}
+		delete(ht.chkptAt, n)
+	}
+	for n := range ht.chkptSeen {
+		if n <= h {
+			delete(ht.chkptSeen, n)
+		}
+	}
+	for digest := range ht.requestSeen {
+		if _, ok := instance.outstandingReqBatches[digest]; !ok {
+			delete(ht.requestSeen, digest)
+		}
+	}
+}
+
+// suspicion returns the suspicion score of a replica, for policies which
+// want to move away from a degrading primary
+func (instance *pbftCore) suspicion(replicaID uint64) float64 {
+	instance.health.lock.Lock()
+	defer instance.health.lock.Unlock()
+	return instance.health.suspicion(replicaID)
+}
+
+// ReplicaHealth returns the responsiveness of every replica as seen by this
+// one, by replica ID
+func (op *obcBatch) ReplicaHealth() []ReplicaHealth {
+	return op.pbft.health.snapshot()
+}
+
+// Health reports the replica unhealthy while it changes views or transfers
+// state, or if its main thread is stuck
+func (op *obcBatch) Health() consensus.Health {
+	var health consensus.Health
+	if !events.OnMainThread(op.manager, func() { health = op.pbft.replicaHealth() }) {
+		return consensus.Health{Detail: fmt.Sprintf("main thread unresponsive for %v", events.MainThreadTimeout)}
+	}
+	return health
+}
+
+// replicaHealth reports the replica unhealthy while it changes views or
+// transfers state, it must be called on the main thread
+func (instance *pbftCore) replicaHealth() consensus.Health {
+	switch {
+	case !instance.activeView:
+		return consensus.Health{Detail: fmt.Sprintf("changing to view %d", instance.view)}
+	case instance.skipInProgress || instance.stateTransferring:
+		return consensus.Health{Detail: fmt.Sprintf("transferring state, last executed %d", instance.lastExec)}
+	default:
+		return consensus.Health{Healthy: true, Detail: fmt.Sprintf("view %d, primary %d", instance.view, instance.primary(instance.view))}
+	}
+}
+
+// Metrics reports the progress of the replica and the requests it holds
+func (op *obcBatch) Metrics() consensus.Metrics {
+	var metrics consensus.Metrics
+	events.OnMainThread(op.manager, func() {
+		instance := op.pbft
+		metrics = consensus.Metrics{
+			"pbft.epoch":                 float64(instance.epoch),
+			"pbft.view":                  float64(instance.view),
+			"pbft.seqNo":                 float64(instance.seqNo),
+			"pbft.lastExec":              float64(instance.lastExec),
+			"pbft.h":                     float64(instance.h),
+			"pbft.outstandingReqBatches": float64(len(instance.outstandingReqBatches)),
+			"pbft.batchStore":            float64(len(op.batchStore)),
+			"pbft.outstandingRequests":   float64(op.reqStore.outstandingRequests.Len()),
+			"pbft.pendingRequests":       float64(op.reqStore.pendingRequests.Len()),
+			"pbft.rotations":             float64(instance.rotations),
+		}
+	})
+	if metrics != nil {
+		var suspicion float64
+		for _, rh := range op.pbft.health.snapshot() {
+			if rh.Suspicion > suspicion {
+				suspicion = rh.Suspicion
+			}
+		}
+		metrics["pbft.maxSuspicion"] = suspicion
+		metrics["pbft.rateLimited"] = float64(op.limiter.rejectedCount())
+	}
+	return metrics
+}
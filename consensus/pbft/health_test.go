@@ -0,0 +1,100 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package pbft
+
+import (
+	"testing"
+	"time"
+
+	"github.com/hyperledger/fabric/consensus/util/events"
+)
+
+func TestHealthTrackerSuspicion(t *testing.T) {
+	ht := newHealthTracker(4, 0.5)
+	ht.update(1, time.Second)
+
+	crossed := 0
+	for i := 0; i < 10; i++ {
+		if _, changed := ht.observe(1, lagPrePrepare, 2*time.Second); changed {
+			crossed++
+		}
+		ht.observe(2, lagPrepare, 10*time.Millisecond)
+	}
+	snap := ht.snapshot()
+	if crossed != 1 || snap[1].Suspicion < 0.9 || !snap[1].Primary {
+		t.Fatalf("Expected the lagging primary to be suspected once, crossed the threshold %d times, health %+v", crossed, snap[1])
+	}
+	if snap[2].Suspicion > 0.1 || snap[2].Samples != 10 {
+		t.Errorf("Expected the responsive replica not to be suspected, health %+v", snap[2])
+	}
+
+	for i := 0; i < 20; i++ {
+		if suspicion, changed := ht.observe(1, lagPrePrepare, 0); changed && suspicion >= 0.5 {
+			t.Errorf("Suspicion should only change when it drops below the threshold, it is %v", suspicion)
+		}
+	}
+	if ht.snapshot()[1].Suspicion >= 0.5 {
+		t.Errorf("Expected the recovered primary to no longer be suspected")
+	}
+}
+
+func TestSilentReplicaCharged(t *testing.T) {
+	config := loadConfig()
+	config.Set("general.K", 2)
+	net := makeSimNetwork(4, 5, config)
+	defer net.stop()
+	net.isolate(3)
+
+	for tag := int64(1); tag <= 4; tag++ {
+		net.submitAll(createPbftReqBatch(tag, 0))
+	}
+	if !net.runUntil(time.Minute, func() bool { return net.replicas[0].pbft.h >= 4 }) {
+		t.Fatalf("Replicas did not reach a stable checkpoint")
+	}
+
+	health := net.replicas[0].pbft.health.snapshot()
+	if health[3].Samples == 0 {
+		t.Errorf("Expected the silent replica to be charged for its missing messages, health %+v", health[3])
+	}
+	if health[1].Samples == 0 || health[0].Samples != 0 {
+		t.Errorf("Expected samples for the other replicas only, health %+v", health)
+	}
+}
+
+func TestBatchHealthAndMetrics(t *testing.T) {
+	validatorCount := 4
+	net := makeConsumerNetwork(validatorCount, obcBatchSizeOneHelper)
+	defer net.stop()
+
+	broadcaster := net.endpoints[generateBroadcaster(validatorCount)].getHandle()
+	net.endpoints[1].(*consumerEndpoint).consumer.RecvMsg(createTxMsg(1), broadcaster)
+	net.process()
+
+	op := net.endpoints[1].(*consumerEndpoint).consumer.(*obcBatch)
+	if health := op.Health(); !health.Healthy {
+		t.Errorf("Expected the replica to be healthy, got %+v", health)
+	}
+	metrics := op.Metrics()
+	if metrics["pbft.lastExec"] != 1 || metrics["pbft.view"] != 0 || metrics["pbft.outstandingRequests"] != 0 {
+		t.Errorf("Expected the replica to have executed the request in view 0, got %v", metrics)
+	}
+
+	events.OnMainThread(op.manager, func() { op.pbft.activeView = false })
+	if health := op.Health(); health.Healthy {
+		t.Errorf("Expected the replica changing views to be unhealthy")
+	}
+}
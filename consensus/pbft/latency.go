@@ -0,0 +1,151 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package pbft
+
+import (
+	"bytes"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Phases of the agreement on a request batch, the latency of each phase is
+// recorded separately so that a slow network (prepare), a slow quorum
+// (commit) and a slow application (execute) can be told apart
+const (
+	PhasePrepare = "prepare" // from the pre-prepare until the batch is prepared
+	PhaseCommit  = "commit"  // from prepared until the batch is committed
+	PhaseExecute = "execute" // from committed until the execution completes
+)
+
+var latencyPhases = []string{PhasePrepare, PhaseCommit, PhaseExecute}
+
+// latencyBounds are the upper bounds of the histogram buckets, doubling
+// from 1ms to about a minute, larger observations go into a final bucket
+var latencyBounds = func() []time.Duration {
+	var bounds []time.Duration
+	for b := time.Millisecond; b <= time.Minute; b *= 2 {
+		bounds = append(bounds, b)
+	}
+	return bounds
+}()
+
+// LatencyHistogram is a snapshot of the latencies observed for one phase.
+// Counts[i] is the number of observations no larger than Bounds[i], and
+// above Bounds[i-1], the last count is for observations above all bounds.
+type LatencyHistogram struct {
+	Bounds []time.Duration
+	Counts []uint64
+	Count  uint64
+	Sum    time.Duration
+	Max    time.Duration
+}
+
+// Mean returns the average of the observed latencies
+func (h LatencyHistogram) Mean() time.Duration {
+	if h.Count == 0 {
+		return 0
+	}
+	return h.Sum / time.Duration(h.Count)
+}
+
+// Quantile returns the upper bound of the bucket holding the q quantile of
+// the observed latencies, or the maximum if it falls into the last bucket
+func (h LatencyHistogram) Quantile(q float64) time.Duration {
+	if h.Count == 0 {
+		return 0
+	}
+	rank := uint64(q * float64(h.Count))
+	var seen uint64
+	for i, c := range h.Counts {
+		seen += c
+		if seen > rank && i < len(h.Bounds) {
+			return h.Bounds[i]
+		}
+	}
+	return h.Max
+}
+
+func (h LatencyHistogram) String() string {
+	return fmt.Sprintf("n=%d mean=%v p50<=%v p99<=%v max=%v", h.Count, h.Mean(), h.Quantile(0.5), h.Quantile(0.99), h.Max)
+}
+
+// phaseLatencies records a latency histogram per phase, it is written by the
+// pbft thread and may be read from any other
+type phaseLatencies struct {
+	lock       sync.Mutex
+	histograms map[string]*LatencyHistogram
+}
+
+func newPhaseLatencies() *phaseLatencies {
+	pl := &phaseLatencies{histograms: make(map[string]*LatencyHistogram)}
+	for _, phase := range latencyPhases {
+		pl.histograms[phase] = &LatencyHistogram{
+			Bounds: latencyBounds,
+			Counts: make([]uint64, len(latencyBounds)+1),
+		}
+	}
+	return pl
+}
+
+// observe records the time elapsed since start for phase, a zero start means
+// the beginning of the phase was not witnessed and nothing is recorded
+func (pl *phaseLatencies) observe(phase string, start time.Time) {
+	if start.IsZero() {
+		return
+	}
+	d := time.Since(start)
+
+	pl.lock.Lock()
+	defer pl.lock.Unlock()
+	h := pl.histograms[phase]
+	i := 0
+	for i < len(h.Bounds) && d > h.Bounds[i] {
+		i++
+	}
+	h.Counts[i]++
+	h.Count++
+	h.Sum += d
+	if d > h.Max {
+		h.Max = d
+	}
+}
+
+// snapshot returns a copy of the histograms, keyed by phase
+func (pl *phaseLatencies) snapshot() map[string]LatencyHistogram {
+	pl.lock.Lock()
+	defer pl.lock.Unlock()
+	snap := make(map[string]LatencyHistogram, len(pl.histograms))
+	for phase, h := range pl.histograms {
+		c := *h
+		c.Counts = append([]uint64(nil), h.Counts...)
+		snap[phase] = c
+	}
+	return snap
+}
+
+func (pl *phaseLatencies) String() string {
+	snap := pl.snapshot()
+	var buf bytes.Buffer
+	for i, phase := range latencyPhases {
+		if i > 0 {
+			buf.WriteString(", ")
+		}
+		fmt.Fprintf(&buf, "%s: %s", phase, snap[phase])
+	}
+	return buf.String()
+}
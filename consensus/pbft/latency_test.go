@@ -0,0 +1,77 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package pbft
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLatencyHistogram(t *testing.T) {
+	pl := newPhaseLatencies()
+	now := time.Now()
+	pl.observe(PhasePrepare, now.Add(-3*time.Millisecond))
+	pl.observe(PhasePrepare, now.Add(-3*time.Millisecond))
+	pl.observe(PhasePrepare, now.Add(-2*time.Hour))
+	pl.observe(PhaseCommit, time.Time{})
+
+	snap := pl.snapshot()
+	h := snap[PhasePrepare]
+	if h.Count != 3 {
+		t.Fatalf("Expected 3 prepare observations, got %d", h.Count)
+	}
+	if h.Counts[2] != 2 {
+		t.Errorf("Expected the 3ms observations in the 4ms bucket, got counts %v", h.Counts)
+	}
+	if h.Counts[len(h.Counts)-1] != 1 {
+		t.Errorf("Expected the 2h observation in the overflow bucket, got counts %v", h.Counts)
+	}
+	if q := h.Quantile(0.5); q != 4*time.Millisecond {
+		t.Errorf("Expected the median to be bounded by 4ms, got %v", q)
+	}
+	if q := h.Quantile(0.99); q != h.Max || q < 2*time.Hour {
+		t.Errorf("Expected the 99th percentile to be the maximum, got %v", q)
+	}
+	if snap[PhaseCommit].Count != 0 {
+		t.Errorf("An unwitnessed phase start should not be recorded")
+	}
+
+	pl.observe(PhasePrepare, now)
+	if snap[PhasePrepare].Counts[0] != 0 {
+		t.Errorf("Snapshot should not change with later observations")
+	}
+}
+
+func TestPhaseLatenciesRecorded(t *testing.T) {
+	validatorCount := 4
+	net := makePBFTNetwork(validatorCount, nil)
+	defer net.stop()
+
+	net.pbftEndpoints[0].manager.Queue() <- createPbftReqBatch(1, uint64(generateBroadcaster(validatorCount)))
+	if err := net.process(); err != nil {
+		t.Fatalf("Processing failed: %s", err)
+	}
+
+	for _, pep := range net.pbftEndpoints {
+		snap := pep.pbft.latencies.snapshot()
+		for _, phase := range latencyPhases {
+			if snap[phase].Count != 1 {
+				t.Errorf("Replica %d should have recorded one %s latency, got %d", pep.id, phase, snap[phase].Count)
+			}
+		}
+	}
+}
@@ -0,0 +1,112 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package pbft
+
+import (
+	"bytes"
+	"testing"
+	"time"
+)
+
+// runFaultyLedgerNetwork orders transactions 1 to count on a network whose
+// replica 3 ledger injects faults until transaction clearAfter is ordered,
+// and checks every replica ends up with the same blockchain
+func runFaultyLedgerNetwork(t *testing.T, faults ledgerFaults, clearAfter, count int) {
+	validatorCount := 4
+	net := makeConsumerNetwork(validatorCount, obcBatchSizeOneHelper, func(ce *consumerEndpoint) {
+		ce.consumer.(*obcBatch).pbft.K = 2
+		ce.consumer.(*obcBatch).pbft.L = 4
+		ce.consumer.(*obcBatch).pbft.requestTimeout = time.Hour // We do not want any view changes
+	})
+	defer net.stop()
+
+	net.mockLedgers[3].injectFaults(faults)
+	broadcaster := net.endpoints[generateBroadcaster(validatorCount)].getHandle()
+	for n := 1; n <= count; n++ {
+		net.endpoints[1].(*consumerEndpoint).consumer.RecvMsg(createTxMsg(int64(n)), broadcaster)
+		net.process()
+		if n == clearAfter {
+			net.mockLedgers[3].injectFaults(ledgerFaults{})
+		}
+	}
+
+	expected := net.mockLedgers[0].GetBlockchainInfo()
+	if expected.Height != uint64(count+1) {
+		t.Fatalf("Expected replica 0 to have a blockchain of height %d, got %d", count+1, expected.Height)
+	}
+	for id, ml := range net.mockLedgers {
+		info := ml.GetBlockchainInfo()
+		if info.Height != expected.Height || !bytes.Equal(info.CurrentBlockHash, expected.CurrentBlockHash) {
+			t.Errorf("Replica %d has blockchain %+v, expected %+v", id, info, expected)
+		}
+		obc := net.endpoints[id].(*consumerEndpoint).consumer.(*obcBatch)
+		if !obc.pbft.activeView || obc.pbft.view != 0 {
+			t.Errorf("Replica %d not active in view 0, is %v %d", id, obc.pbft.activeView, obc.pbft.view)
+		}
+	}
+}
+
+func TestLedgerCommitFailure(t *testing.T) {
+	// Replica 3 misses blocks 3 and 6, its checkpoints disagree with the
+	// network's, which it must notice and repair by state transfer
+	runFaultyLedgerNetwork(t, ledgerFaults{commitFailEvery: 3}, 6, 10)
+}
+
+func TestLedgerCorruptStateHash(t *testing.T) {
+	// Replica 3 commits as many blocks as the others but not the same ones,
+	// state transfer must replace them
+	runFaultyLedgerNetwork(t, ledgerFaults{corruptStateHash: true}, 3, 8)
+}
+
+func TestLedgerSlowGetBlock(t *testing.T) {
+	validatorCount := 4
+	net := makeConsumerNetwork(validatorCount, obcBatchSizeOneHelper, func(ce *consumerEndpoint) {
+		ce.consumer.(*obcBatch).pbft.K = 2
+		ce.consumer.(*obcBatch).pbft.L = 4
+	})
+	defer net.stop()
+
+	for id := 0; id < 3; id++ {
+		net.mockLedgers[id].injectFaults(ledgerFaults{getBlockDelay: 20 * time.Millisecond})
+	}
+	filterMsg := true
+	net.filterFn = func(src int, dst int, msg []byte) []byte {
+		if filterMsg && dst == 3 {
+			return nil
+		}
+		return msg
+	}
+
+	// Leave replica 3 behind, it must fetch the missed blocks from the slow
+	// ledgers of the others
+	broadcaster := net.endpoints[generateBroadcaster(validatorCount)].getHandle()
+	net.endpoints[1].(*consumerEndpoint).consumer.RecvMsg(createTxMsg(1), broadcaster)
+	net.process()
+
+	filterMsg = false
+	for n := 2; n <= 9; n++ {
+		net.endpoints[1].(*consumerEndpoint).consumer.RecvMsg(createTxMsg(int64(n)), broadcaster)
+	}
+	net.process()
+
+	expected := net.mockLedgers[0].GetBlockchainInfo()
+	for id, ml := range net.mockLedgers {
+		if info := ml.GetBlockchainInfo(); info.Height != 10 || !bytes.Equal(info.CurrentBlockHash, expected.CurrentBlockHash) {
+			t.Errorf("Replica %d has blockchain %+v, expected %+v", id, info, expected)
+		}
+	}
+}
@@ -17,12 +17,25 @@ It has these top-level messages:
 	BlockInfo
 	Checkpoint
 	ViewChange
+	ViewChangeCause
 	PQset
 	NewView
 	FetchRequestBatch
+	FetchPayload
+	FetchCert
+	FetchCheckpoint
 	RequestBatch
 	BatchMessage
+	Fragment
+	Relay
+	SieveMessage
+	SieveExecute
+	SieveVerify
+	SieveDecision
 	Metadata
+	EpochInfo
+	LogEntry
+	AuditEntry
 */
 package pbft
 
@@ -36,6 +49,117 @@ var _ = proto.Marshal
 var _ = fmt.Errorf
 var _ = math.Inf
 
+type ViewChangeCauseReason int32
+
+const (
+	ViewChangeCause_REQUEST_TIMEOUT      ViewChangeCauseReason = 0
+	ViewChangeCause_NULL_REQUEST_TIMEOUT ViewChangeCauseReason = 1
+	ViewChangeCause_NEW_VIEW_TIMEOUT     ViewChangeCauseReason = 2
+	ViewChangeCause_ADMIN                ViewChangeCauseReason = 3
+	ViewChangeCause_GAP_DETECTED         ViewChangeCauseReason = 4
+	ViewChangeCause_VIEW_CHANGE_QUORUM   ViewChangeCauseReason = 5
+	ViewChangeCause_PERIODIC             ViewChangeCauseReason = 6
+	ViewChangeCause_PRIMARY_MISBEHAVED   ViewChangeCauseReason = 7
+	ViewChangeCause_INVALID_NEW_VIEW     ViewChangeCauseReason = 8
+)
+
+var ViewChangeCauseReason_name = map[int32]string{
+	0: "REQUEST_TIMEOUT",
+	1: "NULL_REQUEST_TIMEOUT",
+	2: "NEW_VIEW_TIMEOUT",
+	3: "ADMIN",
+	4: "GAP_DETECTED",
+	5: "VIEW_CHANGE_QUORUM",
+	6: "PERIODIC",
+	7: "PRIMARY_MISBEHAVED",
+	8: "INVALID_NEW_VIEW",
+}
+var ViewChangeCauseReason_value = map[string]int32{
+	"REQUEST_TIMEOUT":      0,
+	"NULL_REQUEST_TIMEOUT": 1,
+	"NEW_VIEW_TIMEOUT":     2,
+	"ADMIN":                3,
+	"GAP_DETECTED":         4,
+	"VIEW_CHANGE_QUORUM":   5,
+	"PERIODIC":             6,
+	"PRIMARY_MISBEHAVED":   7,
+	"INVALID_NEW_VIEW":     8,
+}
+
+func (x ViewChangeCauseReason) String() string {
+	return proto.EnumName(ViewChangeCauseReason_name, int32(x))
+}
+
+type LogEntryType int32
+
+const (
+	LogEntry_MESSAGE                  LogEntryType = 0
+	LogEntry_REQUEST_BATCH            LogEntryType = 1
+	LogEntry_EXEC_DONE                LogEntryType = 2
+	LogEntry_VIEW_CHANGE_TIMER        LogEntryType = 3
+	LogEntry_VIEW_CHANGE_RESEND_TIMER LogEntryType = 4
+	LogEntry_NULL_REQUEST_TIMER       LogEntryType = 5
+	LogEntry_DECISION                 LogEntryType = 6
+	LogEntry_CHECKPOINT_TIMER         LogEntryType = 7
+	LogEntry_PAYLOAD                  LogEntryType = 8
+	LogEntry_GAP_REPAIR_TIMER         LogEntryType = 9
+	LogEntry_PIGGYBACK_TIMER          LogEntryType = 10
+	LogEntry_BOOTSTRAP_TIMER          LogEntryType = 11
+)
+
+var LogEntryType_name = map[int32]string{
+	0:  "MESSAGE",
+	1:  "REQUEST_BATCH",
+	2:  "EXEC_DONE",
+	3:  "VIEW_CHANGE_TIMER",
+	4:  "VIEW_CHANGE_RESEND_TIMER",
+	5:  "NULL_REQUEST_TIMER",
+	6:  "DECISION",
+	7:  "CHECKPOINT_TIMER",
+	8:  "PAYLOAD",
+	9:  "GAP_REPAIR_TIMER",
+	10: "PIGGYBACK_TIMER",
+	11: "BOOTSTRAP_TIMER",
+}
+var LogEntryType_value = map[string]int32{
+	"MESSAGE":                  0,
+	"REQUEST_BATCH":            1,
+	"EXEC_DONE":                2,
+	"VIEW_CHANGE_TIMER":        3,
+	"VIEW_CHANGE_RESEND_TIMER": 4,
+	"NULL_REQUEST_TIMER":       5,
+	"DECISION":                 6,
+	"CHECKPOINT_TIMER":         7,
+	"PAYLOAD":                  8,
+	"GAP_REPAIR_TIMER":         9,
+	"PIGGYBACK_TIMER":          10,
+	"BOOTSTRAP_TIMER":          11,
+}
+
+func (x LogEntryType) String() string {
+	return proto.EnumName(LogEntryType_name, int32(x))
+}
+
+type AuditEntryDirection int32
+
+const (
+	AuditEntry_RECEIVED AuditEntryDirection = 0
+	AuditEntry_SENT     AuditEntryDirection = 1
+)
+
+var AuditEntryDirection_name = map[int32]string{
+	0: "RECEIVED",
+	1: "SENT",
+}
+var AuditEntryDirection_value = map[string]int32{
+	"RECEIVED": 0,
+	"SENT":     1,
+}
+
+func (x AuditEntryDirection) String() string {
+	return proto.EnumName(AuditEntryDirection_name, int32(x))
+}
+
 type Message struct {
 	// Types that are valid to be assigned to Payload:
 	//	*Message_RequestBatch
@@ -47,7 +171,13 @@ type Message struct {
 	//	*Message_NewView
 	//	*Message_FetchRequestBatch
 	//	*Message_ReturnRequestBatch
+	//	*Message_FetchPayload
+	//	*Message_ReturnPayload
+	//	*Message_FetchCert
+	//	*Message_FetchCheckpoint
+	//	*Message_ReturnCheckpoint
 	Payload isMessage_Payload `protobuf_oneof:"payload"`
+	Epoch   uint64            `protobuf:"varint,13,opt,name=epoch" json:"epoch,omitempty"`
 }
 
 func (m *Message) Reset()         { *m = Message{} }
@@ -85,6 +215,21 @@ type Message_FetchRequestBatch struct {
 type Message_ReturnRequestBatch struct {
 	ReturnRequestBatch *RequestBatch `protobuf:"bytes,9,opt,name=return_request_batch,oneof"`
 }
+type Message_FetchPayload struct {
+	FetchPayload *FetchPayload `protobuf:"bytes,10,opt,name=fetch_payload,oneof"`
+}
+type Message_ReturnPayload struct {
+	ReturnPayload []byte `protobuf:"bytes,11,opt,name=return_payload,proto3,oneof"`
+}
+type Message_FetchCert struct {
+	FetchCert *FetchCert `protobuf:"bytes,12,opt,name=fetch_cert,oneof"`
+}
+type Message_FetchCheckpoint struct {
+	FetchCheckpoint *FetchCheckpoint `protobuf:"bytes,14,opt,name=fetch_checkpoint,oneof"`
+}
+type Message_ReturnCheckpoint struct {
+	ReturnCheckpoint *Checkpoint `protobuf:"bytes,15,opt,name=return_checkpoint,oneof"`
+}
 
 func (*Message_RequestBatch) isMessage_Payload()       {}
 func (*Message_PrePrepare) isMessage_Payload()         {}
@@ -95,6 +240,11 @@ func (*Message_ViewChange) isMessage_Payload()         {}
 func (*Message_NewView) isMessage_Payload()            {}
 func (*Message_FetchRequestBatch) isMessage_Payload()  {}
 func (*Message_ReturnRequestBatch) isMessage_Payload() {}
+func (*Message_FetchPayload) isMessage_Payload()       {}
+func (*Message_ReturnPayload) isMessage_Payload()      {}
+func (*Message_FetchCert) isMessage_Payload()          {}
+func (*Message_FetchCheckpoint) isMessage_Payload()    {}
+func (*Message_ReturnCheckpoint) isMessage_Payload()   {}
 
 func (m *Message) GetPayload() isMessage_Payload {
 	if m != nil {
@@ -166,6 +316,41 @@ func (m *Message) GetReturnRequestBatch() *RequestBatch {
 	return nil
 }
 
+func (m *Message) GetFetchPayload() *FetchPayload {
+	if x, ok := m.GetPayload().(*Message_FetchPayload); ok {
+		return x.FetchPayload
+	}
+	return nil
+}
+
+func (m *Message) GetReturnPayload() []byte {
+	if x, ok := m.GetPayload().(*Message_ReturnPayload); ok {
+		return x.ReturnPayload
+	}
+	return nil
+}
+
+func (m *Message) GetFetchCert() *FetchCert {
+	if x, ok := m.GetPayload().(*Message_FetchCert); ok {
+		return x.FetchCert
+	}
+	return nil
+}
+
+func (m *Message) GetFetchCheckpoint() *FetchCheckpoint {
+	if x, ok := m.GetPayload().(*Message_FetchCheckpoint); ok {
+		return x.FetchCheckpoint
+	}
+	return nil
+}
+
+func (m *Message) GetReturnCheckpoint() *Checkpoint {
+	if x, ok := m.GetPayload().(*Message_ReturnCheckpoint); ok {
+		return x.ReturnCheckpoint
+	}
+	return nil
+}
+
 // XXX_OneofFuncs is for the internal use of the proto package.
 func (*Message) XXX_OneofFuncs() (func(msg proto.Message, b *proto.Buffer) error, func(msg proto.Message, tag, wire int, b *proto.Buffer) (bool, error), []interface{}) {
 	return _Message_OneofMarshaler, _Message_OneofUnmarshaler, []interface{}{
@@ -178,6 +363,11 @@ func (*Message) XXX_OneofFuncs() (func(msg proto.Message, b *proto.Buffer) error
 		(*Message_NewView)(nil),
 		(*Message_FetchRequestBatch)(nil),
 		(*Message_ReturnRequestBatch)(nil),
+		(*Message_FetchPayload)(nil),
+		(*Message_ReturnPayload)(nil),
+		(*Message_FetchCert)(nil),
+		(*Message_FetchCheckpoint)(nil),
+		(*Message_ReturnCheckpoint)(nil),
 	}
 }
 
@@ -230,6 +420,29 @@ func _Message_OneofMarshaler(msg proto.Message, b *proto.Buffer) error {
 		if err := b.EncodeMessage(x.ReturnRequestBatch); err != nil {
 			return err
 		}
+	case *Message_FetchPayload:
+		b.EncodeVarint(10<<3 | proto.WireBytes)
+		if err := b.EncodeMessage(x.FetchPayload); err != nil {
+			return err
+		}
+	case *Message_ReturnPayload:
+		b.EncodeVarint(11<<3 | proto.WireBytes)
+		b.EncodeRawBytes(x.ReturnPayload)
+	case *Message_FetchCert:
+		b.EncodeVarint(12<<3 | proto.WireBytes)
+		if err := b.EncodeMessage(x.FetchCert); err != nil {
+			return err
+		}
+	case *Message_FetchCheckpoint:
+		b.EncodeVarint(14<<3 | proto.WireBytes)
+		if err := b.EncodeMessage(x.FetchCheckpoint); err != nil {
+			return err
+		}
+	case *Message_ReturnCheckpoint:
+		b.EncodeVarint(15<<3 | proto.WireBytes)
+		if err := b.EncodeMessage(x.ReturnCheckpoint); err != nil {
+			return err
+		}
 	case nil:
 	default:
 		return fmt.Errorf("Message.Payload has unexpected type %T", x)
@@ -312,16 +525,56 @@ func _Message_OneofUnmarshaler(msg proto.Message, tag, wire int, b *proto.Buffer
 		err := b.DecodeMessage(msg)
 		m.Payload = &Message_ReturnRequestBatch{msg}
 		return true, err
+	case 10: // payload.fetch_payload
+		if wire != proto.WireBytes {
+			return true, proto.ErrInternalBadWireType
+		}
+		msg := new(FetchPayload)
+		err := b.DecodeMessage(msg)
+		m.Payload = &Message_FetchPayload{msg}
+		return true, err
+	case 11: // payload.return_payload
+		if wire != proto.WireBytes {
+			return true, proto.ErrInternalBadWireType
+		}
+		x, err := b.DecodeRawBytes(true)
+		m.Payload = &Message_ReturnPayload{x}
+		return true, err
+	case 12: // payload.fetch_cert
+		if wire != proto.WireBytes {
+			return true, proto.ErrInternalBadWireType
+		}
+		msg := new(FetchCert)
+		err := b.DecodeMessage(msg)
+		m.Payload = &Message_FetchCert{msg}
+		return true, err
+	case 14: // payload.fetch_checkpoint
+		if wire != proto.WireBytes {
+			return true, proto.ErrInternalBadWireType
+		}
+		msg := new(FetchCheckpoint)
+		err := b.DecodeMessage(msg)
+		m.Payload = &Message_FetchCheckpoint{msg}
+		return true, err
+	case 15: // payload.return_checkpoint
+		if wire != proto.WireBytes {
+			return true, proto.ErrInternalBadWireType
+		}
+		msg := new(Checkpoint)
+		err := b.DecodeMessage(msg)
+		m.Payload = &Message_ReturnCheckpoint{msg}
+		return true, err
 	default:
 		return false, nil
 	}
 }
 
 type Request struct {
-	Timestamp *google_protobuf.Timestamp `protobuf:"bytes,1,opt,name=timestamp" json:"timestamp,omitempty"`
-	Payload   []byte                     `protobuf:"bytes,2,opt,name=payload,proto3" json:"payload,omitempty"`
-	ReplicaId uint64                     `protobuf:"varint,3,opt,name=replica_id" json:"replica_id,omitempty"`
-	Signature []byte                     `protobuf:"bytes,4,opt,name=signature,proto3" json:"signature,omitempty"`
+	Timestamp     *google_protobuf.Timestamp `protobuf:"bytes,1,opt,name=timestamp" json:"timestamp,omitempty"`
+	Payload       []byte                     `protobuf:"bytes,2,opt,name=payload,proto3" json:"payload,omitempty"`
+	ReplicaId     uint64                     `protobuf:"varint,3,opt,name=replica_id" json:"replica_id,omitempty"`
+	Signature     []byte                     `protobuf:"bytes,4,opt,name=signature,proto3" json:"signature,omitempty"`
+	PayloadDigest string                     `protobuf:"bytes,5,opt,name=payload_digest" json:"payload_digest,omitempty"`
 }
 
 func (m *Request) Reset()         { *m = Request{} }
@@ -341,6 +594,7 @@ type PrePrepare struct {
 	BatchDigest    string        `protobuf:"bytes,3,opt,name=batch_digest" json:"batch_digest,omitempty"`
 	RequestBatch   *RequestBatch `protobuf:"bytes,4,opt,name=request_batch" json:"request_batch,omitempty"`
 	ReplicaId      uint64        `protobuf:"varint,5,opt,name=replica_id" json:"replica_id,omitempty"`
+	Commits        []*Commit     `protobuf:"bytes,6,rep,name=commits" json:"commits,omitempty"`
 }
 
 func (m *PrePrepare) Reset()         { *m = PrePrepare{} }
@@ -354,11 +608,19 @@ func (m *PrePrepare) GetRequestBatch() *RequestBatch {
 	return nil
 }
 
+func (m *PrePrepare) GetCommits() []*Commit {
+	if m != nil {
+		return m.Commits
+	}
+	return nil
+}
+
 type Prepare struct {
 	View           uint64 `protobuf:"varint,1,opt,name=view" json:"view,omitempty"`
 	SequenceNumber uint64 `protobuf:"varint,2,opt,name=sequence_number" json:"sequence_number,omitempty"`
 	BatchDigest    string `protobuf:"bytes,3,opt,name=batch_digest" json:"batch_digest,omitempty"`
 	ReplicaId      uint64 `protobuf:"varint,4,opt,name=replica_id" json:"replica_id,omitempty"`
+	Signature      []byte `protobuf:"bytes,5,opt,name=signature,proto3" json:"signature,omitempty"`
 }
 
 func (m *Prepare) Reset()         { *m = Prepare{} }
@@ -441,15 +703,43 @@ func (m *ViewChange_C) String() string { return proto.CompactTextString(m) }
 func (*ViewChange_C) ProtoMessage()    {}
 
 type ViewChange_PQ struct {
-	SequenceNumber uint64 `protobuf:"varint,1,opt,name=sequence_number" json:"sequence_number,omitempty"`
-	BatchDigest    string `protobuf:"bytes,2,opt,name=batch_digest" json:"batch_digest,omitempty"`
-	View           uint64 `protobuf:"varint,3,opt,name=view" json:"view,omitempty"`
+	SequenceNumber uint64     `protobuf:"varint,1,opt,name=sequence_number" json:"sequence_number,omitempty"`
+	BatchDigest    string     `protobuf:"bytes,2,opt,name=batch_digest" json:"batch_digest,omitempty"`
+	View           uint64     `protobuf:"varint,3,opt,name=view" json:"view,omitempty"`
+	Epoch          uint64     `protobuf:"varint,4,opt,name=epoch" json:"epoch,omitempty"`
+	Prepares       []*Prepare `protobuf:"bytes,5,rep,name=prepares" json:"prepares,omitempty"`
 }
 
 func (m *ViewChange_PQ) Reset()         { *m = ViewChange_PQ{} }
 func (m *ViewChange_PQ) String() string { return proto.CompactTextString(m) }
 func (*ViewChange_PQ) ProtoMessage()    {}
 
+func (m *ViewChange_PQ) GetPrepares() []*Prepare {
+	if m != nil {
+		return m.Prepares
+	}
+	return nil
+}
+
+// why a replica moved to a new view
+type ViewChangeCause struct {
+	Reason    ViewChangeCauseReason      `protobuf:"varint,1,opt,name=reason,enum=pbft.ViewChangeCauseReason" json:"reason,omitempty"`
+	View      uint64                     `protobuf:"varint,2,opt,name=view" json:"view,omitempty"`
+	Detail    string                     `protobuf:"bytes,3,opt,name=detail" json:"detail,omitempty"`
+	Timestamp *google_protobuf.Timestamp `protobuf:"bytes,4,opt,name=timestamp" json:"timestamp,omitempty"`
+}
+
+func (m *ViewChangeCause) Reset()         { *m = ViewChangeCause{} }
+func (m *ViewChangeCause) String() string { return proto.CompactTextString(m) }
+func (*ViewChangeCause) ProtoMessage()    {}
+
+func (m *ViewChangeCause) GetTimestamp() *google_protobuf.Timestamp {
+	if m != nil {
+		return m.Timestamp
+	}
+	return nil
+}
+
 type PQset struct {
 	Set []*ViewChange_PQ `protobuf:"bytes,1,rep,name=set" json:"set,omitempty"`
 }
@@ -499,6 +789,33 @@ func (m *FetchRequestBatch) Reset()         { *m = FetchRequestBatch{} }
 func (m *FetchRequestBatch) String() string { return proto.CompactTextString(m) }
 func (*FetchRequestBatch) ProtoMessage()    {}
 
+type FetchPayload struct {
+	PayloadDigest string `protobuf:"bytes,1,opt,name=payload_digest" json:"payload_digest,omitempty"`
+	ReplicaId     uint64 `protobuf:"varint,2,opt,name=replica_id" json:"replica_id,omitempty"`
+}
+
+func (m *FetchPayload) Reset()         { *m = FetchPayload{} }
+func (m *FetchPayload) String() string { return proto.CompactTextString(m) }
+func (*FetchPayload) ProtoMessage()    {}
+
+type FetchCert struct {
+	View           uint64 `protobuf:"varint,1,opt,name=view" json:"view,omitempty"`
+	SequenceNumber uint64 `protobuf:"varint,2,opt,name=sequence_number" json:"sequence_number,omitempty"`
+	ReplicaId      uint64 `protobuf:"varint,3,opt,name=replica_id" json:"replica_id,omitempty"`
+}
+
+func (m *FetchCert) Reset()         { *m = FetchCert{} }
+func (m *FetchCert) String() string { return proto.CompactTextString(m) }
+func (*FetchCert) ProtoMessage()    {}
+
+type FetchCheckpoint struct {
+	ReplicaId uint64 `protobuf:"varint,1,opt,name=replica_id" json:"replica_id,omitempty"`
+}
+
+func (m *FetchCheckpoint) Reset()         { *m = FetchCheckpoint{} }
+func (m *FetchCheckpoint) String() string { return proto.CompactTextString(m) }
+func (*FetchCheckpoint) ProtoMessage()    {}
+
 type RequestBatch struct {
 	Batch []*Request `protobuf:"bytes,1,rep,name=batch" json:"batch,omitempty"`
 }
@@ -520,6 +837,8 @@ type BatchMessage struct {
 	//	*BatchMessage_RequestBatch
 	//	*BatchMessage_PbftMessage
 	//	*BatchMessage_Complaint
+	//	*BatchMessage_Fragment
+	//	*BatchMessage_Relay
 	Payload isBatchMessage_Payload `protobuf_oneof:"payload"`
 }
 
@@ -543,11 +862,19 @@ type BatchMessage_PbftMessage struct {
 type BatchMessage_Complaint struct {
 	Complaint *Request `protobuf:"bytes,4,opt,name=complaint,oneof"`
 }
+type BatchMessage_Fragment struct {
+	Fragment *Fragment `protobuf:"bytes,5,opt,name=fragment,oneof"`
+}
+type BatchMessage_Relay struct {
+	Relay *Relay `protobuf:"bytes,6,opt,name=relay,oneof"`
+}
 
 func (*BatchMessage_Request) isBatchMessage_Payload()      {}
 func (*BatchMessage_RequestBatch) isBatchMessage_Payload() {}
 func (*BatchMessage_PbftMessage) isBatchMessage_Payload()  {}
 func (*BatchMessage_Complaint) isBatchMessage_Payload()    {}
+func (*BatchMessage_Fragment) isBatchMessage_Payload()     {}
+func (*BatchMessage_Relay) isBatchMessage_Payload()        {}
 
 func (m *BatchMessage) GetPayload() isBatchMessage_Payload {
 	if m != nil {
@@ -584,6 +911,20 @@ func (m *BatchMessage) GetComplaint() *Request {
 	return nil
 }
 
+func (m *BatchMessage) GetFragment() *Fragment {
+	if x, ok := m.GetPayload().(*BatchMessage_Fragment); ok {
+		return x.Fragment
+	}
+	return nil
+}
+
+func (m *BatchMessage) GetRelay() *Relay {
+	if x, ok := m.GetPayload().(*BatchMessage_Relay); ok {
+		return x.Relay
+	}
+	return nil
+}
+
 // XXX_OneofFuncs is for the internal use of the proto package.
 func (*BatchMessage) XXX_OneofFuncs() (func(msg proto.Message, b *proto.Buffer) error, func(msg proto.Message, tag, wire int, b *proto.Buffer) (bool, error), []interface{}) {
 	return _BatchMessage_OneofMarshaler, _BatchMessage_OneofUnmarshaler, []interface{}{
@@ -591,6 +932,8 @@ func (*BatchMessage) XXX_OneofFuncs() (func(msg proto.Message, b *proto.Buffer)
 		(*BatchMessage_RequestBatch)(nil),
 		(*BatchMessage_PbftMessage)(nil),
 		(*BatchMessage_Complaint)(nil),
+		(*BatchMessage_Fragment)(nil),
+		(*BatchMessage_Relay)(nil),
 	}
 }
 
@@ -616,6 +959,16 @@ func _BatchMessage_OneofMarshaler(msg proto.Message, b *proto.Buffer) error {
 		if err := b.EncodeMessage(x.Complaint); err != nil {
 			return err
 		}
+	case *BatchMessage_Fragment:
+		b.EncodeVarint(5<<3 | proto.WireBytes)
+		if err := b.EncodeMessage(x.Fragment); err != nil {
+			return err
+		}
+	case *BatchMessage_Relay:
+		b.EncodeVarint(6<<3 | proto.WireBytes)
+		if err := b.EncodeMessage(x.Relay); err != nil {
+			return err
+		}
 	case nil:
 	default:
 		return fmt.Errorf("BatchMessage.Payload has unexpected type %T", x)
@@ -657,11 +1010,253 @@ func _BatchMessage_OneofUnmarshaler(msg proto.Message, tag, wire int, b *proto.B
 		err := b.DecodeMessage(msg)
 		m.Payload = &BatchMessage_Complaint{msg}
 		return true, err
+	case 5: // payload.fragment
+		if wire != proto.WireBytes {
+			return true, proto.ErrInternalBadWireType
+		}
+		msg := new(Fragment)
+		err := b.DecodeMessage(msg)
+		m.Payload = &BatchMessage_Fragment{msg}
+		return true, err
+	case 6: // payload.relay
+		if wire != proto.WireBytes {
+			return true, proto.ErrInternalBadWireType
+		}
+		msg := new(Relay)
+		err := b.DecodeMessage(msg)
+		m.Payload = &BatchMessage_Relay{msg}
+		return true, err
 	default:
 		return false, nil
 	}
 }
 
+type Fragment struct {
+	Digest string `protobuf:"bytes,1,opt,name=digest" json:"digest,omitempty"`
+	Index  uint64 `protobuf:"varint,2,opt,name=index" json:"index,omitempty"`
+	Count  uint64 `protobuf:"varint,3,opt,name=count" json:"count,omitempty"`
+	Data   []byte `protobuf:"bytes,4,opt,name=data,proto3" json:"data,omitempty"`
+}
+
+func (m *Fragment) Reset()         { *m = Fragment{} }
+func (m *Fragment) String() string { return proto.CompactTextString(m) }
+func (*Fragment) ProtoMessage()    {}
+
+type Relay struct {
+	ReplicaId uint64 `protobuf:"varint,1,opt,name=replica_id" json:"replica_id,omitempty"`
+	Sequence  uint64 `protobuf:"varint,2,opt,name=sequence" json:"sequence,omitempty"`
+	Payload   []byte `protobuf:"bytes,3,opt,name=payload,proto3" json:"payload,omitempty"`
+	Signature []byte `protobuf:"bytes,4,opt,name=signature,proto3" json:"signature,omitempty"`
+}
+
+func (m *Relay) Reset()         { *m = Relay{} }
+func (m *Relay) String() string { return proto.CompactTextString(m) }
+func (*Relay) ProtoMessage()    {}
+
+type SieveMessage struct {
+	// Types that are valid to be assigned to Payload:
+	//	*SieveMessage_Request
+	//	*SieveMessage_Execute
+	//	*SieveMessage_Verify
+	//	*SieveMessage_PbftMessage
+	Payload isSieveMessage_Payload `protobuf_oneof:"payload"`
+}
+
+func (m *SieveMessage) Reset()         { *m = SieveMessage{} }
+func (m *SieveMessage) String() string { return proto.CompactTextString(m) }
+func (*SieveMessage) ProtoMessage()    {}
+
+type isSieveMessage_Payload interface {
+	isSieveMessage_Payload()
+}
+
+type SieveMessage_Request struct {
+	Request *Request `protobuf:"bytes,1,opt,name=request,oneof"`
+}
+type SieveMessage_Execute struct {
+	Execute *SieveExecute `protobuf:"bytes,2,opt,name=execute,oneof"`
+}
+type SieveMessage_Verify struct {
+	Verify *SieveVerify `protobuf:"bytes,3,opt,name=verify,oneof"`
+}
+type SieveMessage_PbftMessage struct {
+	PbftMessage []byte `protobuf:"bytes,4,opt,name=pbft_message,proto3,oneof"`
+}
+
+func (*SieveMessage_Request) isSieveMessage_Payload()     {}
+func (*SieveMessage_Execute) isSieveMessage_Payload()     {}
+func (*SieveMessage_Verify) isSieveMessage_Payload()      {}
+func (*SieveMessage_PbftMessage) isSieveMessage_Payload() {}
+
+func (m *SieveMessage) GetPayload() isSieveMessage_Payload {
+	if m != nil {
+		return m.Payload
+	}
+	return nil
+}
+
+func (m *SieveMessage) GetRequest() *Request {
+	if x, ok := m.GetPayload().(*SieveMessage_Request); ok {
+		return x.Request
+	}
+	return nil
+}
+
+func (m *SieveMessage) GetExecute() *SieveExecute {
+	if x, ok := m.GetPayload().(*SieveMessage_Execute); ok {
+		return x.Execute
+	}
+	return nil
+}
+
+func (m *SieveMessage) GetVerify() *SieveVerify {
+	if x, ok := m.GetPayload().(*SieveMessage_Verify); ok {
+		return x.Verify
+	}
+	return nil
+}
+
+func (m *SieveMessage) GetPbftMessage() []byte {
+	if x, ok := m.GetPayload().(*SieveMessage_PbftMessage); ok {
+		return x.PbftMessage
+	}
+	return nil
+}
+
+// XXX_OneofFuncs is for the internal use of the proto package.
+func (*SieveMessage) XXX_OneofFuncs() (func(msg proto.Message, b *proto.Buffer) error, func(msg proto.Message, tag, wire int, b *proto.Buffer) (bool, error), []interface{}) {
+	return _SieveMessage_OneofMarshaler, _SieveMessage_OneofUnmarshaler, []interface{}{
+		(*SieveMessage_Request)(nil),
+		(*SieveMessage_Execute)(nil),
+		(*SieveMessage_Verify)(nil),
+		(*SieveMessage_PbftMessage)(nil),
+	}
+}
+
+func _SieveMessage_OneofMarshaler(msg proto.Message, b *proto.Buffer) error {
+	m := msg.(*SieveMessage)
+	// payload
+	switch x := m.Payload.(type) {
+	case *SieveMessage_Request:
+		b.EncodeVarint(1<<3 | proto.WireBytes)
+		if err := b.EncodeMessage(x.Request); err != nil {
+			return err
+		}
+	case *SieveMessage_Execute:
+		b.EncodeVarint(2<<3 | proto.WireBytes)
+		if err := b.EncodeMessage(x.Execute); err != nil {
+			return err
+		}
+	case *SieveMessage_Verify:
+		b.EncodeVarint(3<<3 | proto.WireBytes)
+		if err := b.EncodeMessage(x.Verify); err != nil {
+			return err
+		}
+	case *SieveMessage_PbftMessage:
+		b.EncodeVarint(4<<3 | proto.WireBytes)
+		b.EncodeRawBytes(x.PbftMessage)
+	case nil:
+	default:
+		return fmt.Errorf("SieveMessage.Payload has unexpected type %T", x)
+	}
+	return nil
+}
+
+func _SieveMessage_OneofUnmarshaler(msg proto.Message, tag, wire int, b *proto.Buffer) (bool, error) {
+	m := msg.(*SieveMessage)
+	switch tag {
+	case 1: // payload.request
+		if wire != proto.WireBytes {
+			return true, proto.ErrInternalBadWireType
+		}
+		msg := new(Request)
+		err := b.DecodeMessage(msg)
+		m.Payload = &SieveMessage_Request{msg}
+		return true, err
+	case 2: // payload.execute
+		if wire != proto.WireBytes {
+			return true, proto.ErrInternalBadWireType
+		}
+		msg := new(SieveExecute)
+		err := b.DecodeMessage(msg)
+		m.Payload = &SieveMessage_Execute{msg}
+		return true, err
+	case 3: // payload.verify
+		if wire != proto.WireBytes {
+			return true, proto.ErrInternalBadWireType
+		}
+		msg := new(SieveVerify)
+		err := b.DecodeMessage(msg)
+		m.Payload = &SieveMessage_Verify{msg}
+		return true, err
+	case 4: // payload.pbft_message
+		if wire != proto.WireBytes {
+			return true, proto.ErrInternalBadWireType
+		}
+		x, err := b.DecodeRawBytes(true)
+		m.Payload = &SieveMessage_PbftMessage{x}
+		return true, err
+	default:
+		return false, nil
+	}
+}
+
+type SieveExecute struct {
+	View         uint64        `protobuf:"varint,1,opt,name=view" json:"view,omitempty"`
+	BlockNumber  uint64        `protobuf:"varint,2,opt,name=block_number" json:"block_number,omitempty"`
+	RequestBatch *RequestBatch `protobuf:"bytes,3,opt,name=request_batch" json:"request_batch,omitempty"`
+}
+
+func (m *SieveExecute) Reset()         { *m = SieveExecute{} }
+func (m *SieveExecute) String() string { return proto.CompactTextString(m) }
+func (*SieveExecute) ProtoMessage()    {}
+
+func (m *SieveExecute) GetRequestBatch() *RequestBatch {
+	if m != nil {
+		return m.RequestBatch
+	}
+	return nil
+}
+
+type SieveVerify struct {
+	View         uint64 `protobuf:"varint,1,opt,name=view" json:"view,omitempty"`
+	BlockNumber  uint64 `protobuf:"varint,2,opt,name=block_number" json:"block_number,omitempty"`
+	BatchDigest  string `protobuf:"bytes,3,opt,name=batch_digest" json:"batch_digest,omitempty"`
+	ResultDigest string `protobuf:"bytes,4,opt,name=result_digest" json:"result_digest,omitempty"`
+	ReplicaId    uint64 `protobuf:"varint,5,opt,name=replica_id" json:"replica_id,omitempty"`
+	Signature    []byte `protobuf:"bytes,6,opt,name=signature,proto3" json:"signature,omitempty"`
+}
+
+func (m *SieveVerify) Reset()         { *m = SieveVerify{} }
+func (m *SieveVerify) String() string { return proto.CompactTextString(m) }
+func (*SieveVerify) ProtoMessage()    {}
+
+// ordered through pbft as the payload of a request, the verifies decide
+// whether the request batch commits
+type SieveDecision struct {
+	BlockNumber  uint64         `protobuf:"varint,1,opt,name=block_number" json:"block_number,omitempty"`
+	RequestBatch *RequestBatch  `protobuf:"bytes,2,opt,name=request_batch" json:"request_batch,omitempty"`
+	Verifies     []*SieveVerify `protobuf:"bytes,3,rep,name=verifies" json:"verifies,omitempty"`
+}
+
+func (m *SieveDecision) Reset()         { *m = SieveDecision{} }
+func (m *SieveDecision) String() string { return proto.CompactTextString(m) }
+func (*SieveDecision) ProtoMessage()    {}
+
+func (m *SieveDecision) GetRequestBatch() *RequestBatch {
+	if m != nil {
+		return m.RequestBatch
+	}
+	return nil
+}
+
+func (m *SieveDecision) GetVerifies() []*SieveVerify {
+	if m != nil {
+		return m.Verifies
+	}
+	return nil
+}
+
 type Metadata struct {
 	SeqNo uint64 `protobuf:"varint,1,opt,name=seqNo" json:"seqNo,omitempty"`
 }
@@ -669,3 +1264,84 @@ type Metadata struct {
 func (m *Metadata) Reset()         { *m = Metadata{} }
 func (m *Metadata) String() string { return proto.CompactTextString(m) }
 func (*Metadata) ProtoMessage()    {}
+
+// epoch of a replica, persisted along with the validator set it numbers views for
+type EpochInfo struct {
+	Epoch      uint64 `protobuf:"varint,1,opt,name=epoch" json:"epoch,omitempty"`
+	Validators string `protobuf:"bytes,2,opt,name=validators" json:"validators,omitempty"`
+}
+
+func (m *EpochInfo) Reset()         { *m = EpochInfo{} }
+func (m *EpochInfo) String() string { return proto.CompactTextString(m) }
+func (*EpochInfo) ProtoMessage()    {}
+
+type LogEntry struct {
+	Type            LogEntryType     `protobuf:"varint,1,opt,name=type,enum=pbft.LogEntryType" json:"type,omitempty"`
+	Sender          uint64           `protobuf:"varint,2,opt,name=sender" json:"sender,omitempty"`
+	Message         *Message         `protobuf:"bytes,3,opt,name=message" json:"message,omitempty"`
+	RequestBatch    *RequestBatch    `protobuf:"bytes,4,opt,name=request_batch" json:"request_batch,omitempty"`
+	State           []byte           `protobuf:"bytes,5,opt,name=state,proto3" json:"state,omitempty"`
+	SequenceNumber  uint64           `protobuf:"varint,6,opt,name=sequence_number" json:"sequence_number,omitempty"`
+	BatchDigest     string           `protobuf:"bytes,7,opt,name=batch_digest" json:"batch_digest,omitempty"`
+	Payload         []byte           `protobuf:"bytes,8,opt,name=payload,proto3" json:"payload,omitempty"`
+	ViewChangeCause *ViewChangeCause `protobuf:"bytes,9,opt,name=view_change_cause" json:"view_change_cause,omitempty"`
+}
+
+func (m *LogEntry) Reset()         { *m = LogEntry{} }
+func (m *LogEntry) String() string { return proto.CompactTextString(m) }
+func (*LogEntry) ProtoMessage()    {}
+
+func (m *LogEntry) GetMessage() *Message {
+	if m != nil {
+		return m.Message
+	}
+	return nil
+}
+
+func (m *LogEntry) GetRequestBatch() *RequestBatch {
+	if m != nil {
+		return m.RequestBatch
+	}
+	return nil
+}
+
+func (m *LogEntry) GetViewChangeCause() *ViewChangeCause {
+	if m != nil {
+		return m.ViewChangeCause
+	}
+	return nil
+}
+
+type AuditEntry struct {
+	Direction AuditEntryDirection        `protobuf:"varint,1,opt,name=direction,enum=pbft.AuditEntryDirection" json:"direction,omitempty"`
+	ReplicaId uint64                     `protobuf:"varint,2,opt,name=replica_id" json:"replica_id,omitempty"`
+	Broadcast bool                       `protobuf:"varint,3,opt,name=broadcast" json:"broadcast,omitempty"`
+	View      uint64                     `protobuf:"varint,4,opt,name=view" json:"view,omitempty"`
+	Timestamp *google_protobuf.Timestamp `protobuf:"bytes,5,opt,name=timestamp" json:"timestamp,omitempty"`
+	Message   *Message                   `protobuf:"bytes,6,opt,name=message" json:"message,omitempty"`
+	Epoch     uint64                     `protobuf:"varint,7,opt,name=epoch" json:"epoch,omitempty"`
+}
+
+func (m *AuditEntry) Reset()         { *m = AuditEntry{} }
+func (m *AuditEntry) String() string { return proto.CompactTextString(m) }
+func (*AuditEntry) ProtoMessage()    {}
+
+func (m *AuditEntry) GetTimestamp() *google_protobuf.Timestamp {
+	if m != nil {
+		return m.Timestamp
+	}
+	return nil
+}
+
+func (m *AuditEntry) GetMessage() *Message {
+	if m != nil {
+		return m.Message
+	}
+	return nil
+}
+
+func init() {
+	proto.RegisterEnum("pbft.ViewChangeCauseReason", ViewChangeCauseReason_name, ViewChangeCauseReason_value)
+	proto.RegisterEnum("pbft.LogEntryType", LogEntryType_name, LogEntryType_value)
+	proto.RegisterEnum("pbft.AuditEntryDirection", AuditEntryDirection_name, AuditEntryDirection_value)
+}
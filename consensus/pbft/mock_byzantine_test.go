@@ -0,0 +1,89 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package pbft
+
+import (
+	"time"
+
+	"github.com/golang/protobuf/proto"
+)
+
+// byzantineBehavior tampers with a message a faulty replica sends to dst.  It
+// returns the message to deliver instead, an additional delivery delay, and
+// whether the message should be delivered at all.
+type byzantineBehavior func(dst uint64, msg *Message) (*Message, time.Duration, bool)
+
+// silentReplica never sends anything
+func silentReplica() byzantineBehavior {
+	return func(dst uint64, msg *Message) (*Message, time.Duration, bool) {
+		return msg, 0, false
+	}
+}
+
+// delayedCommitReplica holds back its commits for the given duration
+func delayedCommitReplica(delay time.Duration) byzantineBehavior {
+	return func(dst uint64, msg *Message) (*Message, time.Duration, bool) {
+		if msg.GetCommit() != nil {
+			return msg, delay, true
+		}
+		return msg, 0, true
+	}
+}
+
+// corruptDigestSender replaces the batch digest of every message which carries one
+func corruptDigestSender() byzantineBehavior {
+	const corrupt = "corrupted digest"
+	return func(dst uint64, msg *Message) (*Message, time.Duration, bool) {
+		msg = proto.Clone(msg).(*Message)
+		switch {
+		case msg.GetPrePrepare() != nil:
+			msg.GetPrePrepare().BatchDigest = corrupt
+		case msg.GetPrepare() != nil:
+			msg.GetPrepare().BatchDigest = corrupt
+		case msg.GetCommit() != nil:
+			msg.GetCommit().BatchDigest = corrupt
+		case msg.GetFetchRequestBatch() != nil:
+			msg.GetFetchRequestBatch().BatchDigest = corrupt
+		case msg.GetViewChange() != nil:
+			for _, pq := range append(msg.GetViewChange().Pset, msg.GetViewChange().Qset...) {
+				pq.BatchDigest = corrupt
+			}
+		case msg.GetNewView() != nil:
+			for n := range msg.GetNewView().Xset {
+				msg.GetNewView().Xset[n] = corrupt
+			}
+		}
+		return msg, 0, true
+	}
+}
+
+// equivocatingPrimary sends a different, but well formed, request batch in
+// the pre-prepares it sends to replicas with an odd ID
+func equivocatingPrimary() byzantineBehavior {
+	return func(dst uint64, msg *Message) (*Message, time.Duration, bool) {
+		preprep := msg.GetPrePrepare()
+		if preprep == nil || preprep.BatchDigest == "" || dst%2 == 0 {
+			return msg, 0, true
+		}
+		reqBatch := proto.Clone(preprep.RequestBatch).(*RequestBatch)
+		reqBatch.Batch = append(reqBatch.Batch, &Request{Payload: []byte("equivocation"), ReplicaId: preprep.ReplicaId})
+		preprep = proto.Clone(preprep).(*PrePrepare)
+		preprep.RequestBatch = reqBatch
+		preprep.BatchDigest = hash(reqBatch)
+		return &Message{Payload: &Message_PrePrepare{PrePrepare: preprep}}, 0, true
+	}
+}
@@ -81,6 +81,9 @@ func (cs *completeStack) InvalidateState() {}
 func (cs *completeStack) Start()           {}
 func (cs *completeStack) Halt()            {}
 
+func (cs *completeStack) Health() consensus.Health   { return consensus.Health{Healthy: true} }
+func (cs *completeStack) Metrics() consensus.Metrics { return nil }
+
 func (cs *completeStack) UpdateState(tag interface{}, target *pb.BlockchainInfo, peers []*pb.PeerID) {
 	select {
 	// This guarantees the first SkipTo call is the one that's queued, whereas a mutex can be raced for
@@ -139,9 +142,10 @@ func makeConsumerNetwork(N int, makeConsumer func(id uint64, config *viper.Viper
 			skipTarget:       make(chan struct{}, 1),
 		}
 
-		ce.consumer = makeConsumer(id, loadConfig(), cs)
-		ce.consumer.getPBFTCore().N = N
-		ce.consumer.getPBFTCore().f = (N - 1) / 3
+		config := loadConfig()
+		config.Set("general.N", N)
+		config.Set("general.f", (N-1)/3)
+		ce.consumer = makeConsumer(id, config, cs)
 
 		for _, fn := range initFNs {
 			fn(ce)
@@ -17,6 +17,7 @@ limitations under the License.
 package pbft
 
 import (
+	"bytes"
 	"fmt"
 	"reflect"
 	"sync"
@@ -87,6 +88,14 @@ func (hd *HashLedgerDirectory) GetNetworkHandles() (self *protos.PeerID, network
 	return
 }
 
+// ledgerFaults programs the failures a MockLedger injects, so that tests
+// exercise how plugins handle a misbehaving ledger, not only the happy path
+type ledgerFaults struct {
+	commitFailEvery  int           // CommitTxBatch fails on every commitFailEvery-th call, never if 0
+	getBlockDelay    time.Duration // GetBlock answers only after this long
+	corruptStateHash bool          // Blocks are committed with a state hash no correct ledger computes
+}
+
 type MockLedger struct {
 	cleanML       *MockLedger
 	blocks        map[uint64]*protos.Block
@@ -100,6 +109,9 @@ type MockLedger struct {
 	curResults    []byte
 	preBatchState uint64
 
+	faults      ledgerFaults // Guarded by mutex
+	commitCalls int          // Guarded by mutex
+
 	ce *consumerEndpoint // To support the ExecTx stuff
 }
 
@@ -114,6 +126,20 @@ func NewMockLedger(remoteLedgers LedgerDirectory) *MockLedger {
 	return mock
 }
 
+// injectFaults replaces the faults the ledger injects, the zero value
+// stopping any
+func (mock *MockLedger) injectFaults(faults ledgerFaults) {
+	mock.mutex.Lock()
+	defer mock.mutex.Unlock()
+	mock.faults = faults
+}
+
+func (mock *MockLedger) getFaults() ledgerFaults {
+	mock.mutex.Lock()
+	defer mock.mutex.Unlock()
+	return mock.faults
+}
+
 func (mock *MockLedger) BeginTxBatch(id interface{}) error {
 	if mock.txID != nil {
 		return fmt.Errorf("Tx batch is already active")
@@ -130,7 +156,7 @@ func (mock *MockLedger) Execute(tag interface{}, txs []*protos.Transaction) {
 			mock.BeginTxBatch(mock)
 		}
 
-		_, err := mock.ExecTxs(mock, txs)
+		_, _, err := mock.ExecTxs(mock, txs)
 		if err != nil {
 			panic(err)
 		}
@@ -142,7 +168,10 @@ func (mock *MockLedger) Commit(tag interface{}, meta []byte) {
 	go func() {
 		_, err := mock.CommitTxBatch(mock, meta)
 		if err != nil {
-			panic(err)
+			// Like the executor, do not tell the consumer, which only finds
+			// the block missing from the blockchain info
+			fmt.Printf("TEST LEDGER: Mock ledger failed to commit: %s\n", err)
+			mock.RollbackTxBatch(mock)
 		}
 		mock.ce.consumer.Committed(tag, mock.GetBlockchainInfo())
 	}()
@@ -155,9 +184,9 @@ func (mock *MockLedger) Rollback(tag interface{}) {
 	}()
 }
 
-func (mock *MockLedger) ExecTxs(id interface{}, txs []*protos.Transaction) ([]byte, error) {
+func (mock *MockLedger) ExecTxs(id interface{}, txs []*protos.Transaction) ([]byte, []*protos.TransactionResult, error) {
 	if !reflect.DeepEqual(mock.txID, id) {
-		return nil, fmt.Errorf("Invalid batch ID")
+		return nil, nil, fmt.Errorf("Invalid batch ID")
 	}
 
 	mock.curBatch = append(mock.curBatch, txs...)
@@ -183,10 +212,23 @@ func (mock *MockLedger) ExecTxs(id interface{}, txs []*protos.Transaction) ([]by
 
 	mock.curResults = append(mock.curResults, txResult...)
 
-	return txResult, err
+	results := make([]*protos.TransactionResult, len(txs))
+	for i, tx := range txs {
+		results[i] = &protos.TransactionResult{Uuid: tx.Uuid}
+	}
+	return txResult, results, err
 }
 
 func (mock *MockLedger) CommitTxBatch(id interface{}, metadata []byte) (*protos.Block, error) {
+	mock.mutex.Lock()
+	mock.commitCalls++
+	call := mock.commitCalls
+	fail := mock.faults.commitFailEvery > 0 && call%mock.faults.commitFailEvery == 0
+	mock.mutex.Unlock()
+	if fail {
+		return nil, fmt.Errorf("Injected failure of commit call %d", call)
+	}
+
 	block, err := mock.commonCommitTx(id, metadata, false)
 	if nil == err {
 		mock.txID = nil
@@ -196,6 +238,14 @@ func (mock *MockLedger) CommitTxBatch(id interface{}, metadata []byte) (*protos.
 	return block, err
 }
 
+func (mock *MockLedger) CommitTxBatchN(id interface{}, metadata []byte, n int) ([]*protos.Block, error) {
+	block, err := mock.CommitTxBatch(id, metadata)
+	if err != nil {
+		return nil, err
+	}
+	return []*protos.Block{block}, nil
+}
+
 func (mock *MockLedger) commonCommitTx(id interface{}, metadata []byte, preview bool) (*protos.Block, error) {
 	if !reflect.DeepEqual(mock.txID, id) {
 		return nil, fmt.Errorf("Invalid batch ID")
@@ -203,14 +253,19 @@ func (mock *MockLedger) commonCommitTx(id interface{}, metadata []byte, preview
 
 	previousBlockHash := []byte("Genesis")
 	if 0 < mock.blockHeight {
-		previousBlock, _ := mock.GetBlock(mock.blockHeight - 1)
+		previousBlock, _ := mock.getBlock(mock.blockHeight - 1)
 		previousBlockHash, _ = mock.HashBlock(previousBlock)
 	}
 
+	stateHash := mock.curResults // Use the current result output in the hash
+	if mock.getFaults().corruptStateHash {
+		stateHash = append([]byte("CORRUPT"), stateHash...)
+	}
+
 	block := &protos.Block{
 		ConsensusMetadata: metadata,
 		PreviousBlockHash: previousBlockHash,
-		StateHash:         mock.curResults, // Use the current result output in the hash
+		StateHash:         stateHash,
 		Transactions:      mock.curBatch,
 		NonHashData:       &protos.NonHashData{},
 	}
@@ -233,6 +288,20 @@ func (mock *MockLedger) PreviewCommitTxBatch(id interface{}, metadata []byte) ([
 	return mock.getBlockInfoBlob(mock.blockHeight+1, b), nil
 }
 
+func (mock *MockLedger) SetCommitCertificate(blockNumber uint64, cert *protos.CommitCertificate) error {
+	mock.mutex.Lock()
+	defer mock.mutex.Unlock()
+	block, ok := mock.blocks[blockNumber]
+	if !ok {
+		return fmt.Errorf("Block not found")
+	}
+	if block.NonHashData == nil {
+		block.NonHashData = &protos.NonHashData{}
+	}
+	block.NonHashData.CommitCertificate = cert
+	return nil
+}
+
 func (mock *MockLedger) RollbackTxBatch(id interface{}) error {
 	if !reflect.DeepEqual(mock.txID, id) {
 		return fmt.Errorf("Invalid batch ID")
@@ -252,6 +321,13 @@ func (mock *MockLedger) GetBlockchainSize() uint64 {
 }
 
 func (mock *MockLedger) GetBlock(id uint64) (*protos.Block, error) {
+	if delay := mock.getFaults().getBlockDelay; delay > 0 {
+		time.Sleep(delay)
+	}
+	return mock.getBlock(id)
+}
+
+func (mock *MockLedger) getBlock(id uint64) (*protos.Block, error) {
 	mock.mutex.Lock()
 	defer func() {
 		mock.mutex.Unlock()
@@ -268,12 +344,12 @@ func (mock *MockLedger) HashBlock(block *protos.Block) ([]byte, error) {
 }
 
 func (mock *MockLedger) GetBlockchainInfo() *protos.BlockchainInfo {
-	b, _ := mock.GetBlock(mock.blockHeight - 1)
+	b, _ := mock.getBlock(mock.blockHeight - 1)
 	return mock.getBlockInfo(mock.blockHeight, b)
 }
 
 func (mock *MockLedger) GetBlockchainInfoBlob() []byte {
-	b, _ := mock.GetBlock(mock.blockHeight - 1)
+	b, _ := mock.getBlock(mock.blockHeight - 1)
 	return mock.getBlockInfoBlob(mock.blockHeight, b)
 }
 
@@ -309,10 +385,20 @@ func (mock *MockLedger) simulateStateTransfer(info *protos.BlockchainInfo, peers
 	}
 	fmt.Printf("TEST LEDGER skipping to %+v", info)
 	p := 0
-	if mock.blockHeight >= info.Height {
-		panic(fmt.Sprintf("Asked to skip to a block (%d) which is lower than our current height of %d", info.Height, mock.blockHeight))
+	start := mock.blockHeight
+	if start >= info.Height {
+		block, _ := mock.getBlock(info.Height - 1)
+		if hash, _ := mock.HashBlock(block); bytes.Equal(hash, info.CurrentBlockHash) {
+			panic(fmt.Sprintf("Asked to skip to a block (%d) which is lower than our current height of %d", info.Height, mock.blockHeight))
+		}
+		// Our blockchain diverged, replace it whole
+		fmt.Printf("TEST LEDGER: Mock ledger diverged from the network, replacing blocks 1 to %d\n", mock.blockHeight-1)
+		for n := info.Height; n < mock.blockHeight; n++ {
+			delete(mock.blocks, n)
+		}
+		start = 1
 	}
-	for n := mock.blockHeight; n < info.Height; n++ {
+	for n := start; n < info.Height; n++ {
 		block, err := remoteLedger.GetBlock(n)
 
 		if nil != err {
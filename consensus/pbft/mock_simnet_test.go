@@ -0,0 +1,371 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package pbft
+
+import (
+	"container/heap"
+	"encoding/binary"
+	"fmt"
+	"hash/fnv"
+	"math/rand"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/spf13/viper"
+
+	"github.com/hyperledger/fabric/consensus/util/events"
+	pb "github.com/hyperledger/fabric/protos"
+)
+
+// simNetwork runs N pbft replicas on a single thread, connected by an
+// in-memory network.  Time is virtual: message deliveries and timer
+// expiries are scheduled on a shared clock which only advances when the
+// next scheduled action is taken.  The fate of each message is derived from
+// the seed and the message itself rather than from the order in which the
+// replicas send them, so runs are reproducible for a given seed.
+type simNetwork struct {
+	replicas []*simReplica
+	now      time.Duration
+	queue    simQueue
+	seq      uint64
+	seed     int64
+	sent     map[uint64]int64 // number of times each message was sent on a link
+
+	latency   time.Duration // base delivery delay of every message
+	jitter    time.Duration // additional random delay, which reorders messages
+	dropRate  float64       // probability that a message is lost
+	execDelay time.Duration // how long an execution takes
+
+	partition map[uint64]int                                       // replica to partition, replicas in different partitions cannot communicate
+	filterFn  func(src, dst uint64, msg *Message) (*Message, bool) // may alter or drop (false) individual messages
+	byzantine map[uint64]byzantineBehavior                         // faulty replicas, and how they misbehave
+
+	delivered uint64
+	dropped   uint64
+}
+
+type simAction struct {
+	at  time.Duration
+	seq uint64 // breaks ties in scheduling order
+	fn  func()
+}
+
+type simQueue []*simAction
+
+func (q simQueue) Len() int { return len(q) }
+func (q simQueue) Less(i, j int) bool {
+	if q[i].at == q[j].at {
+		return q[i].seq < q[j].seq
+	}
+	return q[i].at < q[j].at
+}
+func (q simQueue) Swap(i, j int)       { q[i], q[j] = q[j], q[i] }
+func (q *simQueue) Push(x interface{}) { *q = append(*q, x.(*simAction)) }
+func (q *simQueue) Pop() interface{} {
+	old := *q
+	a := old[len(old)-1]
+	*q = old[:len(old)-1]
+	return a
+}
+
+func makeSimNetwork(N int, seed int64, config *viper.Viper) *simNetwork {
+	if config == nil {
+		config = loadConfig()
+	}
+	config.Set("general.N", N)
+	config.Set("general.f", (N-1)/3)
+
+	net := &simNetwork{
+		seed:      seed,
+		sent:      make(map[uint64]int64),
+		byzantine: make(map[uint64]byzantineBehavior),
+		latency:   10 * time.Millisecond,
+		partition: make(map[uint64]int),
+	}
+	for id := uint64(0); id < uint64(N); id++ {
+		r := &simReplica{id: id, net: net}
+		r.initialize()
+		r.pbft = newPbftCore(id, config, r, &simTimerFactory{net: net, replica: r})
+		net.replicas = append(net.replicas, r)
+	}
+	return net
+}
+
+// schedule runs fn after delay has elapsed on the virtual clock
+func (net *simNetwork) schedule(delay time.Duration, fn func()) {
+	net.seq++
+	heap.Push(&net.queue, &simAction{at: net.now + delay, seq: net.seq, fn: fn})
+}
+
+// submit hands a request batch to a replica for ordering
+func (net *simNetwork) submit(id uint64, reqBatch *RequestBatch) {
+	r := net.replicas[id]
+	net.schedule(0, func() { r.deliver(reqBatch) })
+}
+
+// submitAll hands a request batch to every replica, as a client broadcast would
+func (net *simNetwork) submitAll(reqBatch *RequestBatch) {
+	for id := range net.replicas {
+		net.submit(uint64(id), reqBatch)
+	}
+}
+
+// isolate places the given replicas in a partition of their own
+func (net *simNetwork) isolate(ids ...uint64) {
+	for _, id := range ids {
+		net.partition[id] = 1
+	}
+}
+
+// heal removes all partitions
+func (net *simNetwork) heal() {
+	net.partition = make(map[uint64]int)
+}
+
+// fate returns the random source deciding how a message is delivered
+func (net *simNetwork) fate(src, dst uint64, msgPayload []byte) *rand.Rand {
+	h := fnv.New64a()
+	binary.Write(h, binary.BigEndian, []uint64{src, dst})
+	h.Write(msgPayload)
+	key := h.Sum64()
+	net.sent[key]++
+	return rand.New(rand.NewSource(net.seed ^ int64(key) ^ net.sent[key]))
+}
+
+func (net *simNetwork) send(src, dst uint64, msgPayload []byte) {
+	fate := net.fate(src, dst, msgPayload)
+	if net.partition[src] != net.partition[dst] || fate.Float64() < net.dropRate {
+		net.dropped++
+		return
+	}
+	msg := &Message{}
+	if err := proto.Unmarshal(msgPayload, msg); err != nil {
+		panic(fmt.Sprintf("replica %d sent a message which does not unmarshal: %s", src, err))
+	}
+	if net.filterFn != nil {
+		var ok bool
+		if msg, ok = net.filterFn(src, dst, msg); !ok {
+			net.dropped++
+			return
+		}
+	}
+	delay := net.latency
+	if behavior, ok := net.byzantine[src]; ok {
+		var extra time.Duration
+		if msg, extra, ok = behavior(dst, msg); !ok {
+			net.dropped++
+			return
+		}
+		delay += extra
+	}
+	if net.jitter > 0 {
+		delay += time.Duration(fate.Int63n(int64(net.jitter)))
+	}
+	r := net.replicas[dst]
+	net.schedule(delay, func() {
+		net.delivered++
+		r.deliver(pbftMessageEvent{msg: msg, sender: src})
+	})
+}
+
+// runFor processes scheduled actions until the virtual clock has advanced by d
+func (net *simNetwork) runFor(d time.Duration) {
+	end := net.now + d
+	for net.queue.Len() > 0 && net.queue[0].at <= end {
+		a := heap.Pop(&net.queue).(*simAction)
+		net.now = a.at
+		a.fn()
+	}
+	net.now = end
+}
+
+// runUntil processes scheduled actions until cond holds or the virtual
+// clock has advanced by limit, it returns whether cond holds
+func (net *simNetwork) runUntil(limit time.Duration, cond func() bool) bool {
+	end := net.now + limit
+	for !cond() {
+		if net.queue.Len() == 0 || net.queue[0].at > end {
+			net.now = end
+			return false
+		}
+		a := heap.Pop(&net.queue).(*simAction)
+		net.now = a.at
+		a.fn()
+	}
+	return true
+}
+
+func (net *simNetwork) stop() {
+	for _, r := range net.replicas {
+		r.pbft.close()
+	}
+}
+
+// simReplica is the innerStack of one replica of the simulated network
+type simReplica struct {
+	id         uint64
+	net        *simNetwork
+	pbft       *pbftCore
+	executions []string // digests of executed batches, in execution order
+	execSeqNos []uint64 // sequence number of each execution
+	lastSeqNo  uint64
+	mockPersist
+
+	speculation *RequestBatch // batch being executed speculatively
+	promoted    int           // speculative executions which were promoted
+	discarded   int           // speculative executions which were discarded
+}
+
+func (r *simReplica) deliver(event events.Event) {
+	events.SendEvent(r.pbft, event)
+}
+
+func (r *simReplica) broadcast(msgPayload []byte) {
+	for dst := range r.net.replicas {
+		if uint64(dst) != r.id {
+			r.net.send(r.id, uint64(dst), msgPayload)
+		}
+	}
+}
+
+func (r *simReplica) unicast(msgPayload []byte, receiverID uint64) error {
+	if receiverID >= uint64(len(r.net.replicas)) {
+		return fmt.Errorf("unknown replica %d", receiverID)
+	}
+	r.net.send(r.id, receiverID, msgPayload)
+	return nil
+}
+
+func (r *simReplica) execute(seqNo uint64, reqBatch *RequestBatch) {
+	r.executions = append(r.executions, hash(reqBatch))
+	r.execSeqNos = append(r.execSeqNos, seqNo)
+	r.lastSeqNo = seqNo
+	r.net.schedule(r.net.execDelay, func() { r.deliver(execDoneEvent{}) })
+}
+
+func (r *simReplica) executeSpeculatively(seqNo uint64, reqBatch *RequestBatch) {
+	r.speculation = reqBatch
+}
+
+func (r *simReplica) promoteSpeculation(seqNo uint64) {
+	reqBatch := r.speculation
+	r.speculation = nil
+	r.promoted++
+	r.execute(seqNo, reqBatch)
+}
+
+func (r *simReplica) discardSpeculation(seqNo uint64) {
+	r.speculation = nil
+	r.discarded++
+}
+
+func (r *simReplica) getState() []byte {
+	return []byte(fmt.Sprintf("%d", len(r.executions)))
+}
+
+func (r *simReplica) getLastSeqNo() (uint64, error) {
+	if len(r.executions) == 0 {
+		return 0, fmt.Errorf("no execution yet")
+	}
+	return r.lastSeqNo, nil
+}
+
+func (r *simReplica) skipTo(seqNo uint64, id []byte, replicas []uint64) {
+	// the replica copies the executions of the first replica of the
+	// checkpoint which got that far
+	r.net.schedule(r.net.latency, func() {
+		for _, peerID := range replicas {
+			peer := r.net.replicas[peerID]
+			if peer.lastSeqNo < seqNo {
+				continue
+			}
+			count := 0
+			for count < len(peer.execSeqNos) && peer.execSeqNos[count] <= seqNo {
+				count++
+			}
+			r.executions = append([]string(nil), peer.executions[:count]...)
+			r.execSeqNos = append([]uint64(nil), peer.execSeqNos[:count]...)
+			break
+		}
+		r.lastSeqNo = seqNo
+		r.deliver(stateUpdatedEvent{
+			chkpt:  &checkpointMessage{seqNo: seqNo, id: id},
+			target: &pb.BlockchainInfo{},
+		})
+	})
+}
+
+func (r *simReplica) sign(msg []byte) ([]byte, error) {
+	return msg, nil
+}
+
+func (r *simReplica) verify(senderID uint64, signature []byte, message []byte) error {
+	return nil
+}
+
+func (r *simReplica) invalidateState() {}
+func (r *simReplica) validateState()   {}
+
+// simTimer schedules its event on the virtual clock of the simulated network
+type simTimer struct {
+	net        *simNetwork
+	replica    *simReplica
+	generation uint64 // incremented whenever the timer is stopped or reset, to invalidate pending expiries
+	active     bool
+}
+
+func (st *simTimer) start(duration time.Duration, event events.Event) {
+	st.generation++
+	st.active = true
+	generation := st.generation
+	st.net.schedule(duration, func() {
+		if !st.active || st.generation != generation {
+			return
+		}
+		st.active = false
+		st.replica.deliver(event)
+	})
+}
+
+func (st *simTimer) SoftReset(duration time.Duration, event events.Event) {
+	if st.active {
+		return
+	}
+	st.start(duration, event)
+}
+
+func (st *simTimer) Reset(duration time.Duration, event events.Event) {
+	st.start(duration, event)
+}
+
+func (st *simTimer) Stop() {
+	st.generation++
+	st.active = false
+}
+
+func (st *simTimer) Halt() {
+	st.Stop()
+}
+
+type simTimerFactory struct {
+	net     *simNetwork
+	replica *simReplica
+}
+
+func (stf *simTimerFactory) CreateTimer() events.Timer {
+	return &simTimer{net: stf.net, replica: stf.replica}
+}
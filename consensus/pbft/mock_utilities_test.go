@@ -22,6 +22,8 @@ import (
 	"time"
 
 	"github.com/golang/protobuf/proto"
+	"github.com/hyperledger/fabric/consensus"
+	"github.com/hyperledger/fabric/consensus/util"
 	"github.com/hyperledger/fabric/consensus/util/events"
 	"github.com/hyperledger/fabric/core/ledger/statemgmt"
 
@@ -54,6 +56,10 @@ func (ns *noopSecurity) Verify(peerID *pb.PeerID, signature []byte, message []by
 	return nil
 }
 
+func (ns *noopSecurity) VerifyTransaction(tx *pb.Transaction) error {
+	return fmt.Errorf("security is disabled")
+}
+
 type mockPersist struct {
 	store map[string][]byte
 }
@@ -85,6 +91,15 @@ func (p *mockPersist) ReadStateSet(prefix string) (map[string][]byte, error) {
 	return ret, nil
 }
 
+func (p *mockPersist) IterateState(prefix string, visit func(key string, value []byte) bool) error {
+	state, err := p.ReadStateSet(prefix)
+	if err != nil {
+		return err
+	}
+	util.IterateStateSet(state, visit)
+	return nil
+}
+
 func (p *mockPersist) StoreState(key string, value []byte) error {
 	p.initialize()
 	p.store[key] = value
@@ -166,6 +181,7 @@ type omniProto struct {
 	UnicastImpl                func(msg *pb.Message, receiverHandle *pb.PeerID) error
 	SignImpl                   func(msg []byte) ([]byte, error)
 	VerifyImpl                 func(peerID *pb.PeerID, signature []byte, message []byte) error
+	VerifyTransactionImpl      func(tx *pb.Transaction) error
 	GetBlockImpl               func(id uint64) (block *pb.Block, err error)
 	GetCurrentStateHashImpl    func() (stateHash []byte, err error)
 	GetBlockchainSizeImpl      func() uint64
@@ -184,10 +200,12 @@ type omniProto struct {
 	RollbackImpl               func(id interface{})
 	UpdateStateImpl            func(id interface{}, target *pb.BlockchainInfo, peers []*pb.PeerID)
 	BeginTxBatchImpl           func(id interface{}) error
-	ExecTxsImpl                func(id interface{}, txs []*pb.Transaction) ([]byte, error)
+	ExecTxsImpl                func(id interface{}, txs []*pb.Transaction) ([]byte, []*pb.TransactionResult, error)
 	CommitTxBatchImpl          func(id interface{}, metadata []byte) (*pb.Block, error)
+	CommitTxBatchNImpl         func(id interface{}, metadata []byte, n int) ([]*pb.Block, error)
 	RollbackTxBatchImpl        func(id interface{}) error
 	PreviewCommitTxBatchImpl   func(id interface{}, metadata []byte) ([]byte, error)
+	SetCommitCertificateImpl   func(blockNumber uint64, cert *pb.CommitCertificate) error
 	GetRemoteBlocksImpl        func(replicaID *pb.PeerID, start, finish uint64) (<-chan *pb.SyncBlocks, error)
 	GetRemoteStateSnapshotImpl func(replicaID *pb.PeerID) (<-chan *pb.SyncStateSnapshot, error)
 	GetRemoteStateDeltasImpl   func(replicaID *pb.PeerID, start, finish uint64) (<-chan *pb.SyncStateDeltas, error)
@@ -197,6 +215,8 @@ type omniProto struct {
 	DelStateImpl               func(key string)
 	ValidateStateImpl          func()
 	InvalidateStateImpl        func()
+	HealthImpl                 func() consensus.Health
+	MetricsImpl                func() consensus.Metrics
 
 	// Inner Stack methods
 	broadcastImpl       func(msgPayload []byte)
@@ -263,6 +283,13 @@ func (op *omniProto) Verify(peerID *pb.PeerID, signature []byte, message []byte)
 
 	panic("Unimplemented")
 }
+func (op *omniProto) VerifyTransaction(tx *pb.Transaction) error {
+	if nil != op.VerifyTransactionImpl {
+		return op.VerifyTransactionImpl(tx)
+	}
+
+	panic("Unimplemented")
+}
 func (op *omniProto) GetBlock(id uint64) (block *pb.Block, err error) {
 	if nil != op.GetBlockImpl {
 		return op.GetBlockImpl(id)
@@ -361,7 +388,7 @@ func (op *omniProto) BeginTxBatch(id interface{}) error {
 
 	panic("Unimplemented")
 }
-func (op *omniProto) ExecTxs(id interface{}, txs []*pb.Transaction) ([]byte, error) {
+func (op *omniProto) ExecTxs(id interface{}, txs []*pb.Transaction) ([]byte, []*pb.TransactionResult, error) {
 	if nil != op.ExecTxsImpl {
 		return op.ExecTxsImpl(id, txs)
 	}
@@ -375,6 +402,13 @@ func (op *omniProto) CommitTxBatch(id interface{}, metadata []byte) (*pb.Block,
 
 	panic("Unimplemented")
 }
+func (op *omniProto) CommitTxBatchN(id interface{}, metadata []byte, n int) ([]*pb.Block, error) {
+	if nil != op.CommitTxBatchNImpl {
+		return op.CommitTxBatchNImpl(id, metadata, n)
+	}
+
+	panic("Unimplemented")
+}
 func (op *omniProto) RollbackTxBatch(id interface{}) error {
 	if nil != op.RollbackTxBatchImpl {
 		return op.RollbackTxBatchImpl(id)
@@ -389,6 +423,13 @@ func (op *omniProto) PreviewCommitTxBatch(id interface{}, metadata []byte) ([]by
 
 	panic("Unimplemented")
 }
+func (op *omniProto) SetCommitCertificate(blockNumber uint64, cert *pb.CommitCertificate) error {
+	if nil != op.SetCommitCertificateImpl {
+		return op.SetCommitCertificateImpl(blockNumber, cert)
+	}
+
+	panic("Unimplemented")
+}
 func (op *omniProto) GetRemoteBlocks(replicaID *pb.PeerID, start, finish uint64) (<-chan *pb.SyncBlocks, error) {
 	if nil != op.GetRemoteBlocksImpl {
 		return op.GetRemoteBlocksImpl(replicaID, start, finish)
@@ -538,6 +579,15 @@ func (op *omniProto) ReadStateSet(prefix string) (map[string][]byte, error) {
 	return nil, fmt.Errorf("unimplemented")
 }
 
+func (op *omniProto) IterateState(prefix string, visit func(key string, value []byte) bool) error {
+	state, err := op.ReadStateSet(prefix)
+	if err != nil {
+		return err
+	}
+	util.IterateStateSet(state, visit)
+	return nil
+}
+
 func (op *omniProto) DelState(key string) {
 	if nil != op.DelStateImpl {
 		op.DelStateImpl(key)
@@ -567,6 +617,20 @@ func (op *omniProto) InvalidateState() {
 	panic("unimplemented")
 }
 
+func (op *omniProto) Health() consensus.Health {
+	if nil != op.HealthImpl {
+		return op.HealthImpl()
+	}
+	panic("unimplemented")
+}
+
+func (op *omniProto) Metrics() consensus.Metrics {
+	if nil != op.MetricsImpl {
+		return op.MetricsImpl()
+	}
+	panic("unimplemented")
+}
+
 func (op *omniProto) validateState() {
 	if nil != op.validateStateImpl {
 		op.validateStateImpl()
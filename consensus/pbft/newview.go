@@ -0,0 +1,112 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package pbft
+
+import (
+	"fmt"
+	"sort"
+)
+
+// The functions in this file check new-view messages, they depend only on
+// the protocol parameters of the replica and never modify its state.  Each
+// returns an error describing why the message must be rejected.
+
+// verifyNewViewSignatures checks the signatures of the view-change messages
+// carried by a new-view message
+func (instance *pbftCore) verifyNewViewSignatures(nv *NewView) error {
+	for _, vc := range nv.Vset {
+		if err := instance.verify(vc); err != nil {
+			return fmt.Errorf("view-change from replica %d has an incorrect signature: %s", vc.ReplicaId, err)
+		}
+	}
+	return nil
+}
+
+// verifyNewViewProof checks that a new-view message was sent by the primary
+// of its view, and that it carries a quorum of correct view-change messages
+// for that view from distinct replicas, signatures are checked separately
+func (instance *pbftCore) verifyNewViewProof(nv *NewView) error {
+	if nv.View == 0 {
+		return fmt.Errorf("new-view for view 0")
+	}
+	if primary := instance.primary(nv.View); primary != nv.ReplicaId {
+		return fmt.Errorf("new-view for view %d sent by replica %d, but its primary is %d", nv.View, nv.ReplicaId, primary)
+	}
+
+	// the primary includes every view-change it holds, which may include
+	// view-changes for later views, only those for this view count
+	seen := make(map[vcidx]bool)
+	senders := make(map[uint64]bool)
+	for _, vc := range nv.Vset {
+		if vc.View < nv.View {
+			return fmt.Errorf("view-change from replica %d is for view %d, before %d", vc.ReplicaId, vc.View, nv.View)
+		}
+		idx := vcidx{vc.View, vc.ReplicaId}
+		if seen[idx] {
+			return fmt.Errorf("duplicate view-change from replica %d for view %d", vc.ReplicaId, vc.View)
+		}
+		seen[idx] = true
+		if vc.View == nv.View {
+			senders[vc.ReplicaId] = true
+		}
+		if !instance.correctViewChange(vc) {
+			return fmt.Errorf("view-change from replica %d is malformed", vc.ReplicaId)
+		}
+	}
+
+	if instance.weightOf(senders) < instance.intersectionQuorum() {
+		return fmt.Errorf("only %d view-changes, a quorum of %d is required", instance.weightOf(senders), instance.intersectionQuorum())
+	}
+
+	return nil
+}
+
+// verifyNewViewXset recomputes the pre-prepares the new primary must issue
+// from the view-changes of the new-view message, starting at checkpoint h,
+// and checks every entry of the primary's set against them
+func (instance *pbftCore) verifyNewViewXset(nv *NewView, h uint64) error {
+	msgList := instance.assignSequenceNumbers(nv.Vset, h)
+	if msgList == nil {
+		return fmt.Errorf("view-changes do not justify an assignment of sequence numbers")
+	}
+
+	var seqNos []uint64
+	for n := range nv.Xset {
+		seqNos = append(seqNos, n)
+	}
+	for n := range msgList {
+		if _, ok := nv.Xset[n]; !ok {
+			seqNos = append(seqNos, n)
+		}
+	}
+	sort.Sort(sortableUint64Slice(seqNos))
+
+	for _, n := range seqNos {
+		d, assigned := nv.Xset[n]
+		expected, justified := msgList[n]
+		switch {
+		case !justified:
+			return fmt.Errorf("seqNo %d is assigned batch %q, but the view-changes do not justify any assignment", n, d)
+		case !assigned:
+			return fmt.Errorf("seqNo %d is not assigned, but the view-changes require batch %q", n, expected)
+		case d != expected:
+			return fmt.Errorf("seqNo %d is assigned batch %q, but the view-changes require batch %q", n, d, expected)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,176 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package pbft
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func makeNewViewTestVset(view uint64, replicas ...uint64) []*ViewChange {
+	var vset []*ViewChange
+	for _, id := range replicas {
+		vset = append(vset, &ViewChange{
+			View:      view,
+			H:         0,
+			Cset:      []*ViewChange_C{{SequenceNumber: 0, Id: "genesis"}},
+			Pset:      []*ViewChange_PQ{{SequenceNumber: 1, BatchDigest: "a", View: view - 1}},
+			Qset:      []*ViewChange_PQ{{SequenceNumber: 1, BatchDigest: "a", View: view - 1}},
+			ReplicaId: id,
+		})
+	}
+	return vset
+}
+
+func TestVerifyNewViewProof(t *testing.T) {
+	mock := &omniProto{
+		verifyImpl: func(senderID uint64, signature []byte, message []byte) error { return nil },
+	}
+	instance := newPbftCore(0, loadConfig(), mock, &inertTimerFactory{})
+	defer instance.close()
+
+	duplicate := makeNewViewTestVset(1, 0, 2)
+	duplicate = append(duplicate, duplicate[1])
+	oldView := makeNewViewTestVset(2, 0, 1, 3)
+	oldView[2].View = 1
+	laterView := append(makeNewViewTestVset(1, 0, 2, 3), makeNewViewTestVset(2, 0)...)
+	laterViewNoQuorum := append(makeNewViewTestVset(1, 0, 2), makeNewViewTestVset(2, 3)...)
+	malformed := makeNewViewTestVset(1, 0, 2, 3)
+	malformed[0].Pset[0].SequenceNumber = instance.L + 1
+
+	tests := []struct {
+		name   string
+		nv     *NewView
+		reason string
+	}{
+		{"valid", &NewView{View: 1, ReplicaId: 1, Vset: makeNewViewTestVset(1, 0, 2, 3)}, ""},
+		{"view zero", &NewView{View: 0, ReplicaId: 0, Vset: makeNewViewTestVset(0, 1, 2, 3)}, "view 0"},
+		{"not primary", &NewView{View: 1, ReplicaId: 2, Vset: makeNewViewTestVset(1, 0, 2, 3)}, "its primary is 1"},
+		{"no quorum", &NewView{View: 1, ReplicaId: 1, Vset: makeNewViewTestVset(1, 0, 2)}, "quorum"},
+		{"duplicate", &NewView{View: 1, ReplicaId: 1, Vset: duplicate}, "duplicate"},
+		{"old view", &NewView{View: 2, ReplicaId: 2, Vset: oldView}, "for view 1, before 2"},
+		{"later view", &NewView{View: 1, ReplicaId: 1, Vset: laterView}, ""},
+		{"later view no quorum", &NewView{View: 1, ReplicaId: 1, Vset: laterViewNoQuorum}, "quorum"},
+		{"malformed", &NewView{View: 1, ReplicaId: 1, Vset: malformed}, "malformed"},
+	}
+
+	for _, test := range tests {
+		err := instance.verifyNewViewProof(test.nv)
+		if test.reason == "" {
+			if err != nil {
+				t.Errorf("%s: new-view should have been accepted, got: %s", test.name, err)
+			}
+			continue
+		}
+		if err == nil || !strings.Contains(err.Error(), test.reason) {
+			t.Errorf("%s: new-view should have been rejected because of %q, got: %v", test.name, test.reason, err)
+		}
+	}
+}
+
+func TestVerifyNewViewXset(t *testing.T) {
+	instance := newPbftCore(0, loadConfig(), &omniProto{}, &inertTimerFactory{})
+	defer instance.close()
+
+	vset := makeNewViewTestVset(1, 0, 2, 3)
+	tests := []struct {
+		name   string
+		xset   map[uint64]string
+		reason string
+	}{
+		{"valid", map[uint64]string{1: "a"}, ""},
+		{"wrong digest", map[uint64]string{1: "b"}, "seqNo 1 is assigned batch \"b\", but the view-changes require batch \"a\""},
+		{"missing", map[uint64]string{}, "seqNo 1 is not assigned"},
+		{"unjustified", map[uint64]string{1: "a", 2: "c"}, "seqNo 2 is assigned batch \"c\", but the view-changes do not justify"},
+	}
+
+	for _, test := range tests {
+		err := instance.verifyNewViewXset(&NewView{View: 1, ReplicaId: 1, Vset: vset, Xset: test.xset}, 0)
+		if test.reason == "" {
+			if err != nil {
+				t.Errorf("%s: xset should have been accepted, got: %s", test.name, err)
+			}
+			continue
+		}
+		if err == nil || !strings.Contains(err.Error(), test.reason) {
+			t.Errorf("%s: xset should have been rejected because of %q, got: %v", test.name, test.reason, err)
+		}
+	}
+}
+
+func TestFastPathAssignment(t *testing.T) {
+	config := loadConfig()
+	config.Set("general.N", 4)
+	config.Set("general.f", 1)
+	config.Set("general.fastpath", true)
+	mock := &omniProto{
+		signImpl: func(msg []byte) ([]byte, error) { return msg, nil },
+		verifyImpl: func(senderID uint64, signature []byte, message []byte) error {
+			if !bytes.Equal(signature, message) {
+				return fmt.Errorf("signature does not match")
+			}
+			return nil
+		},
+	}
+	instance := newPbftCore(1, config, mock, &inertTimerFactory{})
+	defer instance.close()
+
+	prepares := func(digest string, forged bool, replicas ...uint64) []*Prepare {
+		var preps []*Prepare
+		for _, id := range replicas {
+			prep := &Prepare{View: 0, SequenceNumber: 1, BatchDigest: digest, ReplicaId: id}
+			instance.sign(prep)
+			if forged {
+				prep.Signature = []byte("forged")
+			}
+			preps = append(preps, prep)
+		}
+		return preps
+	}
+
+	// every replica pre-prepared "a", which fast committed at a replica
+	// missing from the view-changes, while the faulty replica 3 claims to
+	// have prepared "b" with forged prepares
+	fast := makeNewViewTestVset(1, 1, 2, 3)
+	for _, vc := range fast {
+		vc.Pset = nil
+	}
+	fast[2].Pset = []*ViewChange_PQ{{SequenceNumber: 1, BatchDigest: "b", View: 0, Prepares: prepares("b", true, 1, 2)}}
+	fast[2].Qset = fast[2].Pset
+
+	// the faulty primary 0 sent "b" to replicas 1 and 2, which prepared and
+	// committed it, and "a" to replica 3, and claims to have pre-prepared "a"
+	normal := makeNewViewTestVset(1, 0, 1, 3)
+	normal[0].Pset = nil
+	normal[1].Pset = []*ViewChange_PQ{{SequenceNumber: 1, BatchDigest: "b", View: 0, Prepares: prepares("b", false, 1, 2)}}
+	normal[1].Qset = normal[1].Pset
+	normal[2].Pset = nil
+
+	if msgList := instance.assignSequenceNumbers(fast, 0); msgList[1] != "a" {
+		t.Errorf("Fast committed batch should have been selected, got %v", msgList)
+	}
+	if msgList := instance.assignSequenceNumbers(normal, 0); msgList[1] != "b" {
+		t.Errorf("Committed batch should have been selected, got %v", msgList)
+	}
+
+	normal[1].Pset[0].Prepares = prepares("b", true, 1, 2)
+	if d, ok := instance.fastPathDigest(normal, 1); !ok || d != "a" {
+		t.Errorf("Forged prepares should not certify a batch, got %q, %v", d, ok)
+	}
+}
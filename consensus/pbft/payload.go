@@ -0,0 +1,218 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package pbft
+
+// Request payloads of at least payloadThreshold bytes are kept once in a
+// content-addressed payload store, and the primary replaces them with their
+// digest in the request batches it pre-prepares.  The batches held in the
+// certificates, persisted, and recorded in the message log therefore stay
+// small, the payloads themselves are persisted once.
+//
+// Backups store the payloads of the requests broadcast to them, and fetch
+// missing payloads from the other replicas on demand.  A backup only prepares
+// a request batch once it holds all of its payloads, so that the f+1 correct
+// replicas among a prepared certificate can serve them to the others.  The
+// payloads are put back before a batch is handed to execution.
+
+const payloadPrefix = "payload."
+
+// payloadEvent is sent when this replica learns of a request payload
+type payloadEvent []byte
+
+// returnPayloadEvent is sent when a replica answers a fetch-payload message
+type returnPayloadEvent []byte
+
+type storedPayload struct {
+	data      []byte
+	persisted bool
+	added     uint64 // low watermark when the payload was stored
+}
+
+// storePayload adds a payload to the payload store and returns its digest
+func (instance *pbftCore) storePayload(payload []byte) string {
+	digest := hash(payload)
+	if _, ok := instance.payloads[digest]; !ok {
+		instance.payloads[digest] = &storedPayload{data: payload, added: instance.h}
+	}
+	return digest
+}
+
+// offloadPayloads moves the large payloads of a request batch into the
+// payload store, and returns the batch referencing them by digest
+func (instance *pbftCore) offloadPayloads(reqBatch *RequestBatch) *RequestBatch {
+	if instance.payloadThreshold <= 0 {
+		return reqBatch
+	}
+
+	var offloaded *RequestBatch
+	for i, req := range reqBatch.Batch {
+		if req.PayloadDigest != "" || len(req.Payload) < instance.payloadThreshold {
+			continue
+		}
+		if offloaded == nil {
+			offloaded = &RequestBatch{Batch: append([]*Request(nil), reqBatch.Batch...)}
+		}
+		ref := *req
+		ref.PayloadDigest = instance.storePayload(req.Payload)
+		ref.Payload = nil
+		offloaded.Batch[i] = &ref
+	}
+	if offloaded == nil {
+		return reqBatch
+	}
+	return offloaded
+}
+
+// resolvePayloads returns the request batch with the payloads put back from
+// the payload store, and the digests of the payloads it lacks
+func (instance *pbftCore) resolvePayloads(reqBatch *RequestBatch) (*RequestBatch, []string) {
+	var resolved *RequestBatch
+	var missing []string
+	for i, req := range reqBatch.Batch {
+		if req.PayloadDigest == "" {
+			continue
+		}
+		stored, ok := instance.payloads[req.PayloadDigest]
+		if !ok {
+			missing = append(missing, req.PayloadDigest)
+			continue
+		}
+		if resolved == nil {
+			resolved = &RequestBatch{Batch: append([]*Request(nil), reqBatch.Batch...)}
+		}
+		full := *req
+		full.Payload = stored.data
+		full.PayloadDigest = ""
+		resolved.Batch[i] = &full
+	}
+	if resolved == nil {
+		return reqBatch, missing
+	}
+	return resolved, missing
+}
+
+// fetchPayloads asks the other replicas for payloads this replica lacks,
+// each payload is only asked for once until the next view change
+func (instance *pbftCore) fetchPayloads(digests []string) {
+	for _, digest := range digests {
+		if instance.missingPayloads[digest] {
+			continue
+		}
+		logger.Debugf("Replica %d fetching request payload %s", instance.id, digest)
+		instance.missingPayloads[digest] = true
+		instance.innerBroadcast(&Message{Payload: &Message_FetchPayload{FetchPayload: &FetchPayload{
+			PayloadDigest: digest,
+			ReplicaId:     instance.id,
+		}}})
+	}
+}
+
+// payloadsMissing returns whether the payload store lacks payloads of a
+// stored request batch, and starts fetching them
+func (instance *pbftCore) payloadsMissing(digest string) bool {
+	reqBatch, ok := instance.reqBatchStore[digest]
+	if !ok {
+		return false
+	}
+	_, missing := instance.resolvePayloads(reqBatch)
+	instance.fetchPayloads(missing)
+	return len(missing) > 0
+}
+
+func (instance *pbftCore) recvFetchPayload(fp *FetchPayload) error {
+	stored, ok := instance.payloads[fp.PayloadDigest]
+	if !ok {
+		return nil // we don't have it either
+	}
+
+	msg := &Message{Payload: &Message_ReturnPayload{ReturnPayload: stored.data}}
+	return instance.innerUnicast(msg, fp.ReplicaId)
+}
+
+// recvPayload stores a payload, and resumes the request batches which
+// waited for it if it was missing
+func (instance *pbftCore) recvPayload(payload []byte) {
+	digest := instance.storePayload(payload)
+	if !instance.missingPayloads[digest] {
+		return
+	}
+	delete(instance.missingPayloads, digest)
+	logger.Debugf("Replica %d received missing request payload %s", instance.id, digest)
+
+	for d, reqBatch := range instance.reqBatchStore {
+		for _, req := range reqBatch.Batch {
+			if req.PayloadDigest == digest {
+				instance.persistRequestBatch(d)
+				break
+			}
+		}
+	}
+
+	for idx, cert := range instance.certStore {
+		if !instance.activeView || idx.v != instance.view || cert.sentPrepare || cert.prePrepare == nil || instance.primary(idx.v) == instance.id {
+			continue
+		}
+		if instance.prePrepared(cert.digest, idx.v, idx.n) && !instance.payloadsMissing(cert.digest) {
+			instance.sendPrepare(cert, cert.prePrepare)
+		}
+	}
+	instance.executeOutstanding()
+}
+
+func (instance *pbftCore) persistPayloads(reqBatch *RequestBatch) {
+	for _, req := range reqBatch.Batch {
+		if stored, ok := instance.payloads[req.PayloadDigest]; ok && !stored.persisted {
+			instance.consumer.StoreState(payloadPrefix+req.PayloadDigest, stored.data)
+			stored.persisted = true
+		}
+	}
+}
+
+// collectPayloads removes the payloads which no stored request batch
+// references, and which were stored before the previous stable checkpoint.
+// A payload which was removed too early is fetched again when needed.
+func (instance *pbftCore) collectPayloads(before uint64) {
+	referenced := make(map[string]bool)
+	for _, reqBatch := range instance.reqBatchStore {
+		for _, req := range reqBatch.Batch {
+			if req.PayloadDigest != "" {
+				referenced[req.PayloadDigest] = true
+			}
+		}
+	}
+
+	for digest, stored := range instance.payloads {
+		if referenced[digest] || stored.added >= before {
+			continue
+		}
+		if stored.persisted {
+			instance.consumer.DelState(payloadPrefix + digest)
+		}
+		delete(instance.payloads, digest)
+	}
+}
+
+func (instance *pbftCore) restorePayloads() {
+	payloads, err := instance.consumer.ReadStateSet(payloadPrefix)
+	if err != nil {
+		logger.Warningf("Replica %d could not restore request payloads: %s", instance.id, err)
+		return
+	}
+	for key, data := range payloads {
+		instance.payloads[key[len(payloadPrefix):]] = &storedPayload{data: data, persisted: true}
+	}
+}
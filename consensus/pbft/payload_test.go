@@ -0,0 +1,134 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package pbft
+
+import (
+	"bytes"
+	"testing"
+	"time"
+)
+
+func TestOffloadPayloads(t *testing.T) {
+	config := loadConfig()
+	config.Set("general.payloadoffloadsize", 16)
+	net := makeSimNetwork(4, 1, config)
+	defer net.stop()
+	instance := net.replicas[0].pbft
+
+	large := &Request{ReplicaId: 1, Payload: bytes.Repeat([]byte("x"), 32)}
+	small := &Request{ReplicaId: 1, Payload: []byte("y")}
+	reqBatch := &RequestBatch{Batch: []*Request{large, small}}
+
+	offloaded := instance.offloadPayloads(reqBatch)
+	if offloaded.Batch[0].Payload != nil || offloaded.Batch[0].PayloadDigest != hash(large.Payload) {
+		t.Fatalf("Expected the large payload to be replaced by its digest, got %v", offloaded.Batch[0])
+	}
+	if offloaded.Batch[1] != small {
+		t.Errorf("Expected the small payload to be carried inline")
+	}
+	if len(large.Payload) != 32 {
+		t.Errorf("Offloading should not modify the submitted request batch")
+	}
+
+	resolved, missing := instance.resolvePayloads(offloaded)
+	if len(missing) != 0 || hash(resolved) != hash(reqBatch) {
+		t.Errorf("Expected the payloads to be put back, missing %v", missing)
+	}
+	if _, missing = net.replicas[1].pbft.resolvePayloads(offloaded); len(missing) != 1 {
+		t.Errorf("Expected a replica which never saw the payload to miss it, missing %v", missing)
+	}
+}
+
+func TestFetchPayloads(t *testing.T) {
+	config := loadConfig()
+	config.Set("general.payloadoffloadsize", 1)
+	net := makeSimNetwork(4, 7, config)
+	defer net.stop()
+
+	reqBatch := createPbftReqBatch(1, 0)
+	// only the primary sees the request, the backups must fetch its payload
+	net.submit(0, reqBatch)
+	executed := func() bool {
+		for _, r := range net.replicas {
+			if len(r.executions) != 1 {
+				return false
+			}
+		}
+		return true
+	}
+	if !net.runUntil(time.Minute, executed) {
+		t.Fatalf("Request batch was not executed by every replica")
+	}
+	for _, r := range net.replicas {
+		if r.executions[0] != hash(reqBatch) {
+			t.Errorf("Replica %d should have executed the request batch with its payload", r.id)
+		}
+		if len(r.pbft.missingPayloads) != 0 {
+			t.Errorf("Replica %d should no longer be missing payloads: %v", r.id, r.pbft.missingPayloads)
+		}
+		for digest, stored := range r.pbft.reqBatchStore {
+			if stored.Batch[0].Payload != nil {
+				t.Errorf("Replica %d should store request batch %s without its payload", r.id, digest)
+			}
+		}
+	}
+}
+
+func TestPayloadsRestored(t *testing.T) {
+	config := loadConfig()
+	config.Set("general.payloadoffloadsize", 1)
+	net := makeSimNetwork(4, 3, config)
+	defer net.stop()
+
+	net.submitAll(createPbftReqBatch(1, 0))
+	if !net.runUntil(time.Minute, func() bool { return len(net.replicas[2].executions) == 1 }) {
+		t.Fatalf("Request batch was not executed")
+	}
+
+	r := net.replicas[2]
+	restarted := newPbftCore(r.id, config, r, &simTimerFactory{net: net, replica: r})
+	defer restarted.close()
+	if len(restarted.payloads) != len(r.pbft.payloads) || len(restarted.payloads) == 0 {
+		t.Errorf("Expected %d payloads to be restored, got %d", len(r.pbft.payloads), len(restarted.payloads))
+	}
+	for digest := range restarted.reqBatchStore {
+		if _, missing := restarted.resolvePayloads(restarted.reqBatchStore[digest]); len(missing) != 0 {
+			t.Errorf("Restored request batch %s misses payloads %v", digest, missing)
+		}
+	}
+}
+
+func TestReplayOffloadedPayloads(t *testing.T) {
+	validatorCount := 4
+	config := loadConfig()
+	config.Set("general.messagelog", true)
+	config.Set("general.payloadoffloadsize", 1)
+	net := makePBFTNetwork(validatorCount, config)
+	defer net.stop()
+
+	for tag := int64(1); tag <= 3; tag++ {
+		net.pbftEndpoints[0].manager.Queue() <- createPbftReqBatch(tag, uint64(generateBroadcaster(validatorCount)))
+		net.process()
+	}
+
+	for _, pep := range net.pbftEndpoints {
+		decisions, err := ReplayMessageLog(pep.id, config, &pep.sc.mockPersist)
+		if err != nil || decisions != 3 {
+			t.Errorf("Replay of replica %d should have reproduced 3 decisions, got %d: %v", pep.id, decisions, err)
+		}
+	}
+}
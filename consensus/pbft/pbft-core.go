@@ -21,10 +21,12 @@ import (
 	"fmt"
 	"math/rand"
 	"sort"
+	"strconv"
 	"sync"
 	"time"
 
 	"github.com/hyperledger/fabric/consensus"
+	"github.com/hyperledger/fabric/consensus/util/election"
 	"github.com/hyperledger/fabric/consensus/util/events"
 	_ "github.com/hyperledger/fabric/core" // Needed for logging format init
 	"github.com/op/go-logging"
@@ -54,11 +56,10 @@ const (
 
 // Event Types
 
-// workEvent is a temporary type, to inject work
-type workEvent func()
-
 // viewChangeTimerEvent is sent when the view change timer expires
-type viewChangeTimerEvent struct{}
+type viewChangeTimerEvent struct {
+	cause *ViewChangeCause // why the timer was started, and the view it leads to
+}
 
 // execDoneEvent is sent when an execution completes
 type execDoneEvent struct{}
@@ -78,6 +79,9 @@ type returnRequestBatchEvent *RequestBatch
 // nullRequestEvent provides "keep-alive" null requests
 type nullRequestEvent struct{}
 
+// checkpointTimerEvent is sent when no checkpoint was taken for the checkpoint interval
+type checkpointTimerEvent struct{}
+
 // Unless otherwise noted, all methods consume the PBFT thread, and should therefore
 // not rely on PBFT accomplishing any work while that thread is being held
 type innerStack interface {
@@ -99,8 +103,9 @@ type innerStack interface {
 
 // This structure is used for incoming PBFT bound messages
 type pbftMessage struct {
-	sender uint64
-	msg    *Message
+	sender   uint64
+	msg      *Message
+	verified bool // signatures were already checked off the main thread
 }
 
 type checkpointMessage struct {
@@ -133,10 +138,15 @@ type pbftCore struct {
 	K             uint64            // checkpoint period
 	logMultiplier uint64            // use this value to calculate log size : k*logMultiplier
 	L             uint64            // log size
+	proofInterval uint64            // checkpoints carry a state hash every proofInterval checkpoint periods
 	lastExec      uint64            // last request we executed
 	replicaCount  int               // number of replicas; PBFT `|R|`
+	weights       []int             // voting weight of each replica, nil when every replica counts once
 	seqNo         uint64            // PBFT "n", strictly monotonic increasing sequence number
 	view          uint64            // current view
+	epoch         uint64            // epoch the views are numbered in, see epoch.go
+	epochReports  map[uint64]uint64 // latest epoch of the replicas which sent messages of a later epoch
+	epochStored   bool              // is the epoch persisted for the certificates to be restored in?
 	chkpts        map[uint64]string // state checkpoints; map lastExec to global hash
 	pset          map[uint64]*ViewChange_PQ
 	qset          map[qidx]*ViewChange_PQ
@@ -146,14 +156,18 @@ type pbftCore struct {
 	highStateTarget   *stateUpdateTarget // Set to the highest weak checkpoint cert we have observed
 	hChkpts           map[uint64]uint64  // highest checkpoint sequence number observed for each replica
 
+	lagThreshold  uint64 // how far beyond our high watermark f+1 replicas may checkpoint before we skip to state transfer
+	lagHysteresis uint64 // added to the lag threshold after a state transfer, until we reach a stable checkpoint by execution
+	transferred   bool   // Set when we last caught up by state transfer rather than by execution
+
 	currentExec           *uint64                  // currently executing request
 	timerActive           bool                     // is the timer running?
 	vcResendTimer         events.Timer             // timer triggering resend of a view change
 	newViewTimer          events.Timer             // timeout triggering a view change
+	vcCauses              []*ViewChangeCause       // causes of the latest view changes, by view
 	requestTimeout        time.Duration            // progress timeout for requests
 	vcResendTimeout       time.Duration            // timeout before resending view change
 	newViewTimeout        time.Duration            // progress timeout for new views
-	newViewTimerReason    string                   // what triggered the timer
 	lastNewViewTimeout    time.Duration            // last timeout we used during this view change
 	outstandingReqBatches map[string]*RequestBatch // track whether we are waiting for request batches to execute
 
@@ -162,8 +176,52 @@ type pbftCore struct {
 	viewChangePeriod   uint64        // period between automatic view changes
 	viewChangeSeqNo    uint64        // next seqNo to perform view change
 
+	rotation        uint64           // batches each primary orders before the next takes over, zero to keep it until a view change
+	rotated         bool             // the primary rotated, the backlog still has to be replayed
+	rotationBacklog []events.Event   // messages for later views received before the primary rotated
+	rotations       uint64           // how many times the primary rotated
+	peerViews       map[uint64]msgID // highest view and seqNo each replica was seen in, if ahead of this one
+
+	checkpointTimer    events.Timer  // timeout triggering null requests up to the next checkpoint
+	checkpointInterval time.Duration // longest time between checkpoints, zero if only K bounds it
+	nullFillTarget     uint64        // sequence number the primary sends null requests up to, once the checkpoint timer expired
+
+	gapRepairTimer   events.Timer  // timeout triggering the fetch of certificates missing below committed sequence numbers
+	gapRepairTimeout time.Duration // how long a gap in execution may last before it is repaired, zero to leave it to state transfer
+	gapTimerActive   bool          // is the gap repair timer running?
+
+	piggybackTimer   events.Timer  // timeout triggering the broadcast of commits held for the next pre-prepare
+	piggybackTimeout time.Duration // how long the primary holds its commits for the next pre-prepare, zero to broadcast them at once
+	heldCommits      []*Commit     // commits of the primary waiting for the next pre-prepare
+
+	bootstrapTimer   events.Timer           // timeout repeating the query for the latest stable checkpoint of the network
+	bootstrapTimeout time.Duration          // how often a replica with an empty consensus store asks for it, zero not to ask
+	bootstrapping    bool                   // is the replica waiting for the latest stable checkpoint of the network?
+	bootstrapAnswers map[uint64]*Checkpoint // latest stable checkpoint answered by each replica
+
+	pendingConfig *reloadableConfig // reloaded settings to apply at the next stable checkpoint, nil if none
+
 	missingReqBatches map[string]bool // for all the assigned, non-checkpointed request batches we might be missing during view-change
 
+	payloadThreshold int                       // request payloads of at least this many bytes are carried by digest, zero to carry them inline
+	payloads         map[string]*storedPayload // request payloads carried by digest, by digest
+	missingPayloads  map[string]bool           // request payloads asked from the other replicas and not yet received
+
+	msgLog     bool   // record the inputs of this replica so that its decisions may be replayed
+	msgLogNext uint64 // index of the next message log entry
+
+	auditTrail *auditTrail // archives the messages sent and received, nil if disabled
+
+	speculative bool   // execute request batches once prepared, rather than once committed
+	specSeqNo   uint64 // sequence number of the speculative execution in progress
+	specDigest  string // digest of the speculatively executed batch, empty if there is none
+
+	fastPath bool // commit request batches prepared by every replica without waiting for the commit round
+
+	latencies       *phaseLatencies // how long request batches spend in each phase
+	health          *healthTracker  // how responsive the other replicas are
+	currentExecFrom time.Time       // when the batch being executed was committed
+
 	// implementation of PBFT `in`
 	reqBatchStore   map[string]*RequestBatch // track request batches
 	certStore       map[msgID]*msgCert       // track quorum certificates for requests
@@ -183,12 +241,15 @@ type msgID struct { // our index through certStore
 }
 
 type msgCert struct {
-	digest      string
-	prePrepare  *PrePrepare
-	sentPrepare bool
-	prepare     []*Prepare
-	sentCommit  bool
-	commit      []*Commit
+	digest       string
+	prePrepare   *PrePrepare
+	sentPrepare  bool
+	prepare      []*Prepare
+	sentCommit   bool
+	commit       []*Commit
+	prePrepareAt time.Time // when the pre-prepare was sent or received, for the latency histograms
+	preparedAt   time.Time
+	committedAt  time.Time
 }
 
 type vcidx struct {
@@ -221,10 +282,27 @@ func newPbftCore(id uint64, config *viper.Viper, consumer innerStack, etf events
 	instance.newViewTimer = etf.CreateTimer()
 	instance.vcResendTimer = etf.CreateTimer()
 	instance.nullRequestTimer = etf.CreateTimer()
+	instance.checkpointTimer = etf.CreateTimer()
+	instance.gapRepairTimer = etf.CreateTimer()
+	instance.piggybackTimer = etf.CreateTimer()
+	instance.bootstrapTimer = etf.CreateTimer()
 
 	instance.N = config.GetInt("general.N")
 	instance.f = config.GetInt("general.f")
-	if instance.f*3+1 > instance.N {
+	if weights := config.GetStringSlice("general.weights"); len(weights) > 0 {
+		if len(weights) != instance.N {
+			panic(fmt.Sprintf("need a voting weight for each of the %d replicas, but %d weights configured", instance.N, len(weights)))
+		}
+		instance.weights = make([]int, instance.N)
+		for i, w := range weights {
+			if instance.weights[i], err = strconv.Atoi(w); err != nil || instance.weights[i] < 0 {
+				panic(fmt.Sprintf("cannot parse voting weight %q of replica %d", w, i))
+			}
+		}
+		if instance.f*3+1 > instance.totalWeight() {
+			panic(fmt.Sprintf("need a voting weight of at least %d to tolerate faulty replicas of weight %d, but only %d configured", instance.f*3+1, instance.f, instance.totalWeight()))
+		}
+	} else if instance.f*3+1 > instance.N {
 		panic(fmt.Sprintf("need at least %d enough replicas to tolerate %d byzantine faults, but only %d replicas configured", instance.f*3+1, instance.f, instance.N))
 	}
 
@@ -235,9 +313,30 @@ func newPbftCore(id uint64, config *viper.Viper, consumer innerStack, etf events
 		panic("Log multiplier must be greater than or equal to 2")
 	}
 	instance.L = instance.logMultiplier * instance.K // log size
+	instance.proofInterval = uint64(config.GetInt("general.checkpointproofinterval"))
+	if instance.proofInterval < 1 {
+		instance.proofInterval = 1
+	}
 	instance.viewChangePeriod = uint64(config.GetInt("general.viewchangeperiod"))
+	instance.rotation = uint64(config.GetInt("general.rotation"))
+	if instance.rotation > 0 && instance.viewChangePeriod > 0 {
+		logger.Warningf("PBFT rotates the primary every %d batches, ignoring view change period %d", instance.rotation, instance.viewChangePeriod)
+		instance.viewChangePeriod = 0
+	}
+	instance.lagThreshold = uint64(config.GetInt("general.statetransfer.lagthreshold"))
+	instance.lagHysteresis = uint64(config.GetInt("general.statetransfer.hysteresis"))
 
 	instance.byzantine = config.GetBool("general.byzantine")
+	instance.msgLog = config.GetBool("general.messagelog")
+	if dir := config.GetString("general.audit.dir"); dir != "" {
+		instance.auditTrail, err = newAuditTrail(auditDir(dir, id), int64(config.GetSizeInBytes("general.audit.maxfilesize")), config.GetInt("general.audit.maxfiles"))
+		if err != nil {
+			logger.Warningf("PBFT audit trail disabled: %s", err)
+		}
+	}
+	instance.speculative = config.GetBool("general.speculativeexecution")
+	instance.payloadThreshold = config.GetInt("general.payloadoffloadsize")
+	instance.fastPath = config.GetBool("general.fastpath")
 
 	instance.requestTimeout, err = time.ParseDuration(config.GetString("general.timeout.request"))
 	if err != nil {
@@ -255,29 +354,91 @@ func newPbftCore(id uint64, config *viper.Viper, consumer innerStack, etf events
 	if err != nil {
 		instance.nullRequestTimeout = 0
 	}
+	instance.checkpointInterval, err = time.ParseDuration(config.GetString("general.timeout.checkpoint"))
+	if err != nil {
+		instance.checkpointInterval = 0
+	}
+	instance.gapRepairTimeout, err = time.ParseDuration(config.GetString("general.timeout.gaprepair"))
+	if err != nil {
+		instance.gapRepairTimeout = 0
+	}
+	instance.piggybackTimeout, err = time.ParseDuration(config.GetString("general.timeout.piggyback"))
+	if err != nil {
+		instance.piggybackTimeout = 0
+	}
+	instance.bootstrapTimeout, err = time.ParseDuration(config.GetString("general.timeout.bootstrap"))
+	if err != nil {
+		instance.bootstrapTimeout = 0
+	}
 
 	instance.activeView = true
 	instance.replicaCount = instance.N
 
+	if instance.N == 1 {
+		// a lone replica is always the primary, nobody needs to watch it
+		logger.Infof("PBFT running a single replica for development, requests are ordered as soon as they are batched")
+		instance.nullRequestTimeout = 0
+		instance.viewChangePeriod = 0
+		instance.rotation = 0
+	}
+
 	logger.Infof("PBFT type = %T", instance.consumer)
 	logger.Infof("PBFT Max number of validating peers (N) = %v", instance.N)
 	logger.Infof("PBFT Max number of failing peers (f) = %v", instance.f)
+	if instance.weights != nil {
+		logger.Infof("PBFT voting weights = %v, total %d", instance.weights, instance.totalWeight())
+	}
 	logger.Infof("PBFT byzantine flag = %v", instance.byzantine)
+	logger.Infof("PBFT message log = %v", instance.msgLog)
+	if instance.auditTrail != nil {
+		logger.Infof("PBFT audit trail = %s", instance.auditTrail.dir)
+	}
+	logger.Infof("PBFT speculative execution = %v", instance.speculative)
+	logger.Infof("PBFT fast path = %v", instance.fastPath)
+	if instance.payloadThreshold > 0 {
+		logger.Infof("PBFT request payloads carried by digest from %d bytes", instance.payloadThreshold)
+	}
 	logger.Infof("PBFT request timeout = %v", instance.requestTimeout)
 	logger.Infof("PBFT view change timeout = %v", instance.newViewTimeout)
 	logger.Infof("PBFT Checkpoint period (K) = %v", instance.K)
 	logger.Infof("PBFT Log multiplier = %v", instance.logMultiplier)
 	logger.Infof("PBFT log size (L) = %v", instance.L)
+	logger.Infof("PBFT checkpoint proof interval = %v", instance.proofInterval)
+	if instance.lagThreshold > 0 || instance.lagHysteresis > 0 {
+		logger.Infof("PBFT state transfer lag threshold = %v, hysteresis = %v", instance.lagThreshold, instance.lagHysteresis)
+	}
 	if instance.nullRequestTimeout > 0 {
 		logger.Infof("PBFT null requests timeout = %v", instance.nullRequestTimeout)
 	} else {
 		logger.Infof("PBFT null requests disabled")
 	}
-	if instance.viewChangePeriod > 0 {
+	if instance.rotation > 0 {
+		logger.Infof("PBFT primary rotation = every %v batches", instance.rotation)
+	} else if instance.viewChangePeriod > 0 {
 		logger.Infof("PBFT view change period = %v", instance.viewChangePeriod)
 	} else {
 		logger.Infof("PBFT automatic view change disabled")
 	}
+	if instance.checkpointInterval > 0 {
+		logger.Infof("PBFT checkpoint interval = %v", instance.checkpointInterval)
+		instance.checkpointTimer.Reset(instance.checkpointInterval, checkpointTimerEvent{})
+	} else {
+		logger.Infof("PBFT checkpoints only every K requests")
+	}
+	if instance.gapRepairTimeout > 0 {
+		logger.Infof("PBFT gap repair timeout = %v", instance.gapRepairTimeout)
+	} else {
+		logger.Infof("PBFT gap repair disabled")
+	}
+	if instance.piggybackTimeout > 0 {
+		logger.Infof("PBFT primary commits piggybacked on pre-prepares, held for at most %v", instance.piggybackTimeout)
+	}
+	if instance.bootstrapTimeout > 0 {
+		logger.Infof("PBFT bootstrap timeout = %v", instance.bootstrapTimeout)
+	}
+
+	instance.latencies = newPhaseLatencies()
+	instance.health = newHealthTracker(instance.N, config.GetFloat64("general.health.suspicionthreshold"))
 
 	// init the logs
 	instance.certStore = make(map[msgID]*msgCert)
@@ -288,6 +449,8 @@ func newPbftCore(id uint64, config *viper.Viper, consumer innerStack, etf events
 	instance.pset = make(map[uint64]*ViewChange_PQ)
 	instance.qset = make(map[qidx]*ViewChange_PQ)
 	instance.newViewStore = make(map[uint64]*NewView)
+	instance.epochReports = make(map[uint64]uint64)
+	instance.peerViews = make(map[uint64]msgID)
 
 	// initialize state transfer
 	instance.hChkpts = make(map[uint64]uint64)
@@ -297,8 +460,14 @@ func newPbftCore(id uint64, config *viper.Viper, consumer innerStack, etf events
 	instance.lastNewViewTimeout = instance.newViewTimeout
 	instance.outstandingReqBatches = make(map[string]*RequestBatch)
 	instance.missingReqBatches = make(map[string]bool)
+	instance.payloads = make(map[string]*storedPayload)
+	instance.missingPayloads = make(map[string]bool)
 
 	instance.restoreState()
+	instance.startBootstrap()
+	if instance.msgLog {
+		instance.restoreMsgLog()
+	}
 
 	instance.viewChangeSeqNo = ^uint64(0) // infinity
 	instance.updateViewChangeSeqNo()
@@ -310,26 +479,57 @@ func newPbftCore(id uint64, config *viper.Viper, consumer innerStack, etf events
 func (instance *pbftCore) close() {
 	instance.newViewTimer.Halt()
 	instance.nullRequestTimer.Halt()
+	instance.checkpointTimer.Halt()
+	instance.gapRepairTimer.Halt()
+	instance.piggybackTimer.Halt()
+	instance.bootstrapTimer.Halt()
+	if instance.auditTrail != nil {
+		instance.auditTrail.close()
+	}
 }
 
 // allow the view-change protocol to kick-off when the timer expires
 func (instance *pbftCore) ProcessEvent(e events.Event) events.Event {
 	var err error
 	logger.Debugf("Replica %d processing event", instance.id)
+	if instance.msgLog {
+		instance.logEvent(e)
+	}
 	switch et := e.(type) {
 	case viewChangeTimerEvent:
-		logger.Infof("Replica %d view change timer expired, sending view change: %s", instance.id, instance.newViewTimerReason)
+		cause := et.cause
+		if cause == nil {
+			cause = &ViewChangeCause{}
+		}
+		if cause.View != 0 && cause.View != instance.view+1 {
+			logger.Debugf("Replica %d view change timer was started for view %d, but it is now in view %d", instance.id, cause.View, instance.view)
+		}
 		instance.timerActive = false
-		instance.sendViewChange()
+		instance.changeView(instance.viewChangeTimerCause(cause))
 	case *pbftMessage:
 		return pbftMessageEvent(*et)
 	case pbftMessageEvent:
 		msg := et
 		logger.Debugf("Replica %d received incoming message from %v", instance.id, msg.sender)
+		if instance.auditTrail != nil {
+			instance.audit(AuditEntry_RECEIVED, msg.sender, false, msg.msg)
+		}
+		if msg.msg.Epoch != instance.epoch {
+			instance.recvOtherEpoch(msg.msg.Epoch, msg.sender)
+			break
+		}
 		next, err := instance.recvMsg(msg.msg, msg.sender)
 		if err != nil {
 			break
 		}
+		if msg.verified {
+			switch m := next.(type) {
+			case *ViewChange:
+				return instance.recvVerifiedViewChange(m)
+			case *NewView:
+				return instance.recvVerifiedNewView(m)
+			}
+		}
 		return next
 	case *RequestBatch:
 		err = instance.recvRequestBatch(et)
@@ -349,6 +549,12 @@ func (instance *pbftCore) ProcessEvent(e events.Event) events.Event {
 		err = instance.recvFetchRequestBatch(et)
 	case returnRequestBatchEvent:
 		return instance.recvReturnRequestBatch(et)
+	case *FetchPayload:
+		err = instance.recvFetchPayload(et)
+	case returnPayloadEvent:
+		instance.recvPayload(et)
+	case payloadEvent:
+		instance.recvPayload(et)
 	case stateUpdatedEvent:
 		update := et.chkpt
 		instance.stateTransferring = false
@@ -372,20 +578,44 @@ func (instance *pbftCore) ProcessEvent(e events.Event) events.Event {
 		logger.Infof("Replica %d application caught up via state transfer, lastExec now %d", instance.id, update.seqNo)
 		// XXX create checkpoint
 		instance.lastExec = update.seqNo
+		instance.transferred = true
 		instance.moveWatermarks(instance.lastExec) // The watermark movement handles moving this to a checkpoint boundary
 		instance.skipInProgress = false
 		instance.consumer.validateState()
 		instance.executeOutstanding()
+		instance.maybeRotate()
+		instance.maybeRejoinRotation()
+		instance.maybeTransferToSlot()
 	case execDoneEvent:
 		instance.execDoneSync()
 		if instance.skipInProgress {
 			instance.retryStateTransfer(nil)
 		}
+		if instance.rotated {
+			return instance.finishRotation()
+		}
 		// We will delay new view processing sometimes
 		return instance.processNewView()
 	case nullRequestEvent:
 		instance.nullRequestHandler()
-	case workEvent:
+	case checkpointTimerEvent:
+		instance.checkpointTimerHandler()
+	case gapRepairTimerEvent:
+		instance.gapRepairTimerHandler()
+	case piggybackTimerEvent:
+		instance.flushHeldCommits()
+	case bootstrapTimerEvent:
+		instance.bootstrapTimerHandler()
+	case *FetchCheckpoint:
+		err = instance.recvFetchCheckpoint(et)
+	case returnCheckpointEvent:
+		instance.recvReturnCheckpoint(et)
+	case *FetchCert:
+		err = instance.recvFetchCert(et)
+	case configReloadEvent:
+		logger.Infof("Replica %d reloaded its configuration, applying it at the next stable checkpoint", instance.id)
+		instance.pendingConfig = et.config
+	case events.WorkEvent:
 		et() // Used to allow the caller to steal use of the main thread, to be removed
 	case viewChangeQuorumEvent:
 		logger.Debugf("Replica %d received view change quorum, processing new view", instance.id)
@@ -411,6 +641,10 @@ func (instance *pbftCore) ProcessEvent(e events.Event) events.Event {
 		logger.Warning(err.Error())
 	}
 
+	if instance.rotated {
+		return instance.finishRotation()
+	}
+
 	return nil
 }
 
@@ -420,7 +654,7 @@ func (instance *pbftCore) ProcessEvent(e events.Event) events.Event {
 
 // Given a certain view n, what is the expected primary?
 func (instance *pbftCore) primary(n uint64) uint64 {
-	return n % uint64(instance.replicaCount)
+	return election.RoundRobin(n, instance.replicaCount)
 }
 
 // Is the sequence number between watermarks?
@@ -451,16 +685,57 @@ func (instance *pbftCore) getCert(v uint64, n uint64) (cert *msgCert) {
 // preprepare/prepare/commit quorum checks
 // =============================================================================
 
+// With voting weights configured, quorums are measured in weight rather
+// than in replicas, and f is the weight of the faulty replicas tolerated.
+
+// weight returns the voting weight of a replica
+func (instance *pbftCore) weight(id uint64) int {
+	if instance.weights == nil {
+		return 1
+	}
+	if id >= uint64(len(instance.weights)) {
+		return 0
+	}
+	return instance.weights[id]
+}
+
+// weightOf returns the combined voting weight of a set of replicas
+func (instance *pbftCore) weightOf(replicas map[uint64]bool) int {
+	weight := 0
+	for id := range replicas {
+		weight += instance.weight(id)
+	}
+	return weight
+}
+
+// totalWeight returns the combined voting weight of all replicas
+func (instance *pbftCore) totalWeight() int {
+	if instance.weights == nil {
+		return instance.N
+	}
+	weight := 0
+	for _, w := range instance.weights {
+		weight += w
+	}
+	return weight
+}
+
 // intersectionQuorum returns the number of replicas that have to
 // agree to guarantee that at least one correct replica is shared by
 // two intersection quora
 func (instance *pbftCore) intersectionQuorum() int {
-	return (instance.N + instance.f + 2) / 2
+	return (instance.totalWeight() + instance.f + 2) / 2
 }
 
 // allCorrectReplicasQuorum returns the number of correct replicas (N-f)
 func (instance *pbftCore) allCorrectReplicasQuorum() int {
-	return (instance.N - instance.f)
+	return (instance.totalWeight() - instance.f)
+}
+
+// weakQuorum returns the number of replicas that have to agree to
+// guarantee that at least one of them is correct (f+1)
+func (instance *pbftCore) weakQuorum() int {
+	return instance.f + 1
 }
 
 func (instance *pbftCore) prePrepared(digest string, v uint64, n uint64) bool {
@@ -503,17 +778,22 @@ func (instance *pbftCore) prepared(digest string, v uint64, n uint64) bool {
 
 	for _, p := range cert.prepare {
 		if p.View == v && p.SequenceNumber == n && p.BatchDigest == digest {
-			quorum++
+			quorum += instance.weight(p.ReplicaId)
 		}
 	}
 
 	logger.Debugf("Replica %d prepare count for view=%d/seqNo=%d: %d",
 		instance.id, v, n, quorum)
 
-	return quorum >= instance.intersectionQuorum()-1
+	// the pre-prepare stands in for the prepare of the primary
+	return quorum+instance.weight(instance.primary(v)) >= instance.intersectionQuorum()
 }
 
 func (instance *pbftCore) committed(digest string, v uint64, n uint64) bool {
+	if instance.fastCommitted(digest, v, n) {
+		return true
+	}
+
 	if !instance.prepared(digest, v, n) {
 		return false
 	}
@@ -526,7 +806,7 @@ func (instance *pbftCore) committed(digest string, v uint64, n uint64) bool {
 
 	for _, p := range cert.commit {
 		if p.View == v && p.SequenceNumber == n {
-			quorum++
+			quorum += instance.weight(p.ReplicaId)
 		}
 	}
 
@@ -547,8 +827,7 @@ func (instance *pbftCore) nullRequestHandler() {
 
 	if instance.primary(instance.view) != instance.id {
 		// backup expected a null request, but primary never sent one
-		logger.Info("Replica %d null request timer expired, sending view change", instance.id)
-		instance.sendViewChange()
+		instance.changeView(ViewChangeCause_NULL_REQUEST_TIMEOUT, fmt.Sprintf("primary %d sent no null request", instance.primary(instance.view)))
 	} else {
 		// time for the primary to send a null request
 		// pre-prepare with null digest
@@ -598,17 +877,75 @@ func (instance *pbftCore) recvMsg(msg *Message, senderID uint64) (interface{}, e
 	} else if reqBatch := msg.GetReturnRequestBatch(); reqBatch != nil {
 		// it's ok for sender ID and replica ID to differ; we're sending the original request message
 		return returnRequestBatchEvent(reqBatch), nil
+	} else if fp := msg.GetFetchPayload(); fp != nil {
+		if senderID != fp.ReplicaId {
+			return nil, fmt.Errorf("Sender ID included in fetch-payload message (%v) doesn't match ID corresponding to the receiving stream (%v)", fp.ReplicaId, senderID)
+		}
+		return fp, nil
+	} else if fc := msg.GetFetchCert(); fc != nil {
+		if senderID != fc.ReplicaId {
+			return nil, fmt.Errorf("Sender ID included in fetch-cert message (%v) doesn't match ID corresponding to the receiving stream (%v)", fc.ReplicaId, senderID)
+		}
+		return fc, nil
+	} else if fc := msg.GetFetchCheckpoint(); fc != nil {
+		if senderID != fc.ReplicaId {
+			return nil, fmt.Errorf("Sender ID included in fetch-checkpoint message (%v) doesn't match ID corresponding to the receiving stream (%v)", fc.ReplicaId, senderID)
+		}
+		return fc, nil
+	} else if chkpt := msg.GetReturnCheckpoint(); chkpt != nil {
+		if senderID != chkpt.ReplicaId {
+			return nil, fmt.Errorf("Sender ID included in return-checkpoint message (%v) doesn't match ID corresponding to the receiving stream (%v)", chkpt.ReplicaId, senderID)
+		}
+		return returnCheckpointEvent(chkpt), nil
+	} else if payload, ok := msg.Payload.(*Message_ReturnPayload); ok {
+		// payloads are identified by their digest, whoever returns them
+		return returnPayloadEvent(payload.ReturnPayload), nil
 	}
 	return nil, fmt.Errorf("Invalid message: %v", msg)
 }
 
+// checkpointTimerHandler has the primary fill the sequence numbers up to
+// the next checkpoint carrying a state hash with null requests, so that the
+// network checkpoints and garbage collects its log even when it receives few
+// requests
+func (instance *pbftCore) checkpointTimerHandler() {
+	instance.checkpointTimer.Reset(instance.checkpointInterval, checkpointTimerEvent{})
+
+	if !instance.activeView || instance.primary(instance.view) != instance.id || instance.isProofCheckpoint(instance.seqNo) {
+		return
+	}
+
+	logger.Infof("Primary %d has not checkpointed for %v, sending null requests up to the next checkpoint", instance.id, instance.checkpointInterval)
+	instance.nullFillTarget = instance.lastProofCheckpoint(instance.seqNo) + instance.K*instance.proofInterval
+	instance.sendNullFill()
+}
+
+// sendNullFill sends null requests up to the fill target of the checkpoint
+// timer.  With a proof interval above one the target may lie beyond the
+// watermarks, the primary then goes on once the checkpoints in between moved
+// them
+func (instance *pbftCore) sendNullFill() {
+	for instance.seqNo < instance.nullFillTarget {
+		seqNo := instance.seqNo
+		instance.sendPrePrepare(nil, "")
+		if instance.seqNo == seqNo {
+			// out of sequence numbers, or about to change views
+			return
+		}
+	}
+}
+
 func (instance *pbftCore) recvRequestBatch(reqBatch *RequestBatch) error {
+	reqBatch = instance.offloadPayloads(reqBatch)
 	digest := hash(reqBatch)
 	logger.Debugf("Replica %d received request batch %s", instance.id, digest)
 
 	instance.reqBatchStore[digest] = reqBatch
 	instance.outstandingReqBatches[digest] = reqBatch
 	instance.persistRequestBatch(digest)
+	if _, ok := instance.health.requestSeen[digest]; !ok {
+		instance.health.requestSeen[digest] = time.Now()
+	}
 	if instance.activeView {
 		instance.softStartTimer(instance.requestTimeout, fmt.Sprintf("new request batch %s", digest))
 	}
@@ -656,8 +993,9 @@ func (instance *pbftCore) sendPrePrepare(reqBatch *RequestBatch, digest string)
 	cert := instance.getCert(instance.view, n)
 	cert.prePrepare = preprep
 	cert.digest = digest
+	cert.prePrepareAt = time.Now()
 	instance.persistQSet()
-	instance.innerBroadcast(&Message{Payload: &Message_PrePrepare{PrePrepare: preprep}})
+	instance.innerBroadcast(&Message{Payload: &Message_PrePrepare{PrePrepare: instance.piggybackHeldCommits(preprep)}})
 	instance.maybeSendCommit(digest, instance.view, n)
 }
 
@@ -700,11 +1038,22 @@ func (instance *pbftCore) recvPrePrepare(preprep *PrePrepare) error {
 		return nil
 	}
 
+	if instance.deferUntilRotation(preprep.View, preprep.SequenceNumber, preprep.ReplicaId, preprep) {
+		return nil
+	}
+
 	if instance.primary(instance.view) != preprep.ReplicaId {
 		logger.Warningf("Pre-prepare from other than primary: got %d, should be %d", preprep.ReplicaId, instance.primary(instance.view))
 		return nil
 	}
 
+	if len(preprep.Commits) > 0 {
+		instance.recvPiggybackedCommits(preprep)
+		if !instance.activeView {
+			return nil
+		}
+	}
+
 	if !instance.inWV(preprep.View, preprep.SequenceNumber) {
 		if preprep.SequenceNumber != instance.h && !instance.skipInProgress {
 			logger.Warningf("Replica %d pre-prepare view different, or sequence number outside watermarks: preprep.View %d, expected.View %d, seqNo %d, low-mark %d", instance.id, preprep.View, instance.primary(instance.view), preprep.SequenceNumber, instance.h)
@@ -717,18 +1066,24 @@ func (instance *pbftCore) recvPrePrepare(preprep *PrePrepare) error {
 	}
 
 	if preprep.SequenceNumber > instance.viewChangeSeqNo {
-		logger.Info("Replica %d received pre-prepare for %d, which should be from the next primary", instance.id, preprep.SequenceNumber)
-		instance.sendViewChange()
+		instance.changeView(ViewChangeCause_PERIODIC, fmt.Sprintf("pre-prepare for seqNo=%d should be from the next primary", preprep.SequenceNumber))
 		return nil
 	}
 
 	cert := instance.getCert(preprep.View, preprep.SequenceNumber)
 	if cert.digest != "" && cert.digest != preprep.BatchDigest {
-		logger.Warningf("Pre-prepare found for same view/seqNo but different digest: received %s, stored %s", preprep.BatchDigest, cert.digest)
-		instance.sendViewChange()
+		instance.changeView(ViewChangeCause_PRIMARY_MISBEHAVED, fmt.Sprintf("pre-prepare for view=%d/seqNo=%d with digest %s, already pre-prepared with digest %s",
+			preprep.View, preprep.SequenceNumber, preprep.BatchDigest, cert.digest))
 		return nil
 	}
 
+	if cert.prePrepare == nil {
+		cert.prePrepareAt = time.Now()
+		if seen, ok := instance.health.requestSeen[preprep.BatchDigest]; ok {
+			instance.observeSince(preprep.ReplicaId, lagPrePrepare, seen)
+			delete(instance.health.requestSeen, preprep.BatchDigest)
+		}
+	}
 	cert.prePrepare = preprep
 	cert.digest = preprep.BatchDigest
 
@@ -749,31 +1104,56 @@ func (instance *pbftCore) recvPrePrepare(preprep *PrePrepare) error {
 	instance.nullRequestTimer.Stop()
 
 	if instance.primary(instance.view) != instance.id && instance.prePrepared(preprep.BatchDigest, preprep.View, preprep.SequenceNumber) && !cert.sentPrepare {
-		logger.Debugf("Backup %d broadcasting prepare for view=%d/seqNo=%d", instance.id, preprep.View, preprep.SequenceNumber)
-		prep := &Prepare{
-			View:           preprep.View,
-			SequenceNumber: preprep.SequenceNumber,
-			BatchDigest:    preprep.BatchDigest,
-			ReplicaId:      instance.id,
+		if instance.payloadsMissing(preprep.BatchDigest) {
+			logger.Debugf("Replica %d delaying prepare for view=%d/seqNo=%d until it holds the request payloads", instance.id, preprep.View, preprep.SequenceNumber)
+			return nil
 		}
-		cert.sentPrepare = true
-		instance.persistQSet()
-		instance.recvPrepare(prep)
-		return instance.innerBroadcast(&Message{Payload: &Message_Prepare{Prepare: prep}})
+		return instance.sendPrepare(cert, preprep)
 	}
 
 	return nil
 }
 
+func (instance *pbftCore) sendPrepare(cert *msgCert, preprep *PrePrepare) error {
+	logger.Debugf("Backup %d broadcasting prepare for view=%d/seqNo=%d", instance.id, preprep.View, preprep.SequenceNumber)
+	prep := &Prepare{
+		View:           preprep.View,
+		SequenceNumber: preprep.SequenceNumber,
+		BatchDigest:    preprep.BatchDigest,
+		ReplicaId:      instance.id,
+	}
+	if instance.fastPath {
+		if err := instance.sign(prep); err != nil {
+			return fmt.Errorf("could not sign prepare for view=%d/seqNo=%d: %s", prep.View, prep.SequenceNumber, err)
+		}
+	}
+	cert.sentPrepare = true
+	instance.persistQSet()
+	instance.recvPrepare(prep)
+	return instance.innerBroadcast(&Message{Payload: &Message_Prepare{Prepare: prep}})
+}
+
 func (instance *pbftCore) recvPrepare(prep *Prepare) error {
 	logger.Debugf("Replica %d received prepare from replica %d for view=%d/seqNo=%d",
 		instance.id, prep.ReplicaId, prep.View, prep.SequenceNumber)
 
+	if instance.deferUntilRotation(prep.View, prep.SequenceNumber, prep.ReplicaId, prep) {
+		return nil
+	}
+
 	if instance.primary(prep.View) == prep.ReplicaId {
 		logger.Warningf("Replica %d received prepare from primary, ignoring", instance.id)
 		return nil
 	}
 
+	// prepares certify P set entries of the view-changes on the fast path
+	if instance.fastPath {
+		if err := instance.verify(prep); err != nil {
+			logger.Warningf("Replica %d ignoring prepare from replica %d with an incorrect signature: %s", instance.id, prep.ReplicaId, err)
+			return nil
+		}
+	}
+
 	if !instance.inWV(prep.View, prep.SequenceNumber) {
 		if prep.SequenceNumber != instance.h && !instance.skipInProgress {
 			logger.Warningf("Replica %d ignoring prepare for view=%d/seqNo=%d: not in-wv, in view %d, low water mark %d", instance.id, prep.View, prep.SequenceNumber, instance.view, instance.h)
@@ -794,8 +1174,18 @@ func (instance *pbftCore) recvPrepare(prep *Prepare) error {
 	}
 	cert.prepare = append(cert.prepare, prep)
 	instance.persistPSet()
+	instance.observeSince(prep.ReplicaId, lagPrepare, cert.prePrepareAt)
+
+	if err := instance.maybeSendCommit(prep.BatchDigest, prep.View, prep.SequenceNumber); err != nil {
+		return err
+	}
 
-	return instance.maybeSendCommit(prep.BatchDigest, prep.View, prep.SequenceNumber)
+	if cert.committedAt.IsZero() && instance.fastCommitted(prep.BatchDigest, prep.View, prep.SequenceNumber) {
+		logger.Debugf("Replica %d fast committed view=%d/seqNo=%d, every replica prepared it",
+			instance.id, prep.View, prep.SequenceNumber)
+		instance.commitReached(cert, prep.BatchDigest, prep.SequenceNumber)
+	}
+	return nil
 }
 
 //
@@ -811,8 +1201,14 @@ func (instance *pbftCore) maybeSendCommit(digest string, v uint64, n uint64) err
 			ReplicaId:      instance.id,
 		}
 		cert.sentCommit = true
+		cert.preparedAt = time.Now()
+		instance.latencies.observe(PhasePrepare, cert.prePrepareAt)
 		instance.recvCommit(commit)
-		return instance.innerBroadcast(&Message{&Message_Commit{commit}})
+		instance.maybeSpeculate()
+		if instance.holdCommit(commit) {
+			return nil
+		}
+		return instance.innerBroadcast(&Message{Payload: &Message_Commit{Commit: commit}})
 	}
 	return nil
 }
@@ -821,6 +1217,10 @@ func (instance *pbftCore) recvCommit(commit *Commit) error {
 	logger.Debugf("Replica %d received commit from replica %d for view=%d/seqNo=%d",
 		instance.id, commit.ReplicaId, commit.View, commit.SequenceNumber)
 
+	if instance.deferUntilRotation(commit.View, commit.SequenceNumber, commit.ReplicaId, commit) {
+		return nil
+	}
+
 	if !instance.inWV(commit.View, commit.SequenceNumber) {
 		if commit.SequenceNumber != instance.h && !instance.skipInProgress {
 			logger.Warningf("Replica %d ignoring commit for view=%d/seqNo=%d: not in-wv, in view %d, high water mark %d", instance.id, commit.View, commit.SequenceNumber, instance.view, instance.h)
@@ -839,21 +1239,30 @@ func (instance *pbftCore) recvCommit(commit *Commit) error {
 		}
 	}
 	cert.commit = append(cert.commit, commit)
+	instance.observeSince(commit.ReplicaId, lagCommit, cert.preparedAt)
 
 	if instance.committed(commit.BatchDigest, commit.View, commit.SequenceNumber) {
-		instance.stopTimer()
-		instance.lastNewViewTimeout = instance.newViewTimeout
-		delete(instance.outstandingReqBatches, commit.BatchDigest)
+		instance.commitReached(cert, commit.BatchDigest, commit.SequenceNumber)
+	}
 
-		instance.executeOutstanding()
+	return nil
+}
 
-		if commit.SequenceNumber == instance.viewChangeSeqNo {
-			logger.Infof("Replica %d cycling view for seqNo=%d", instance.id, commit.SequenceNumber)
-			instance.sendViewChange()
-		}
+// commitReached executes a request batch once it has committed
+func (instance *pbftCore) commitReached(cert *msgCert, digest string, n uint64) {
+	if cert.committedAt.IsZero() {
+		cert.committedAt = time.Now()
+		instance.latencies.observe(PhaseCommit, cert.preparedAt)
 	}
+	instance.stopTimer()
+	instance.lastNewViewTimeout = instance.newViewTimeout
+	delete(instance.outstandingReqBatches, digest)
 
-	return nil
+	instance.executeOutstanding()
+
+	if n == instance.viewChangeSeqNo && instance.rotation == 0 {
+		instance.changeView(ViewChangeCause_PERIODIC, fmt.Sprintf("cycling view after seqNo=%d", n))
+	}
 }
 
 func (instance *pbftCore) updateHighStateTarget(target *stateUpdateTarget) {
@@ -896,6 +1305,7 @@ func (instance *pbftCore) retryStateTransfer(optional *stateUpdateTarget) {
 	}
 
 	instance.stateTransferring = true
+	instance.discardSpeculation()
 
 	logger.Debugf("Replica %d is initiating state transfer to seqNo %d", instance.id, target.seqNo)
 	instance.consumer.skipTo(target.seqNo, target.id, target.replicas)
@@ -917,6 +1327,9 @@ func (instance *pbftCore) executeOutstanding() {
 
 	logger.Debugf("Replica %d certstore %+v", instance.id, instance.certStore)
 
+	instance.maybeSpeculate()
+	instance.checkGap()
+
 	instance.startTimerIfOutstandingRequests()
 }
 
@@ -941,9 +1354,28 @@ func (instance *pbftCore) executeOne(idx msgID) bool {
 		return false
 	}
 
+	if digest != "" && reqBatch != nil {
+		var missing []string
+		if reqBatch, missing = instance.resolvePayloads(reqBatch); len(missing) > 0 {
+			logger.Debugf("Replica %d cannot execute seqNo=%d until it holds the request payloads", instance.id, idx.n)
+			instance.fetchPayloads(missing)
+			return false
+		}
+	}
+
 	// we have a commit certificate for this request batch
 	currentExec := idx.n
 	instance.currentExec = &currentExec
+	instance.currentExecFrom = cert.committedAt
+
+	if instance.promoteSpeculation(idx.n, digest) {
+		logger.Infof("Replica %d committing speculatively executed request batch for view=%d/seqNo=%d and digest %s",
+			instance.id, idx.v, idx.n, digest)
+		if instance.msgLog {
+			instance.logDecision(idx.n, digest)
+		}
+		return true
+	}
 
 	// null request
 	if digest == "" {
@@ -953,6 +1385,9 @@ func (instance *pbftCore) executeOne(idx msgID) bool {
 	} else {
 		logger.Infof("Replica %d executing/committing request batch for view=%d/seqNo=%d and digest %s",
 			instance.id, idx.v, idx.n, digest)
+		if instance.msgLog {
+			instance.logDecision(idx.n, digest)
+		}
 		// synchronously execute, it is the other side's responsibility to execute in the background if needed
 		instance.consumer.execute(idx.n, reqBatch)
 	}
@@ -982,12 +1417,57 @@ func (instance *pbftCore) Checkpoint(seqNo uint64, id []byte) {
 	instance.innerBroadcast(&Message{Payload: &Message_Checkpoint{Checkpoint: chkpt}})
 }
 
+// isProofCheckpoint returns whether the checkpoint for seqNo carries a hash
+// of the state, the checkpoints in between only acknowledge the sequence number
+func (instance *pbftCore) isProofCheckpoint(seqNo uint64) bool {
+	return seqNo%(instance.K*instance.proofInterval) == 0
+}
+
+// lastProofCheckpoint returns the highest sequence number not above seqNo
+// whose checkpoint carries a hash of the state
+func (instance *pbftCore) lastProofCheckpoint(seqNo uint64) uint64 {
+	period := instance.K * instance.proofInterval
+	return seqNo / period * period
+}
+
+// replayWindow is the number of sequence numbers after the last proof
+// checkpoint which a view change may have to carry over
+func (instance *pbftCore) replayWindow() uint64 {
+	return instance.L + (instance.proofInterval-1)*instance.K
+}
+
+// acknowledge is the lightweight form of Checkpoint, it attests that seqNo
+// was executed without computing the state hash, this is enough to move the
+// watermarks but cannot serve as a state transfer target
+func (instance *pbftCore) acknowledge(seqNo uint64) {
+	logger.Debugf("Replica %d acknowledging execution of view=%d/seqNo=%d",
+		instance.id, instance.view, seqNo)
+
+	chkpt := &Checkpoint{
+		SequenceNumber: seqNo,
+		ReplicaId:      instance.id,
+	}
+
+	instance.recvCheckpoint(chkpt)
+	instance.innerBroadcast(&Message{Payload: &Message_Checkpoint{Checkpoint: chkpt}})
+}
+
 func (instance *pbftCore) execDoneSync() {
 	if instance.currentExec != nil {
 		logger.Infof("Replica %d finished execution %d, trying next", instance.id, *instance.currentExec)
 		instance.lastExec = *instance.currentExec
-		if instance.lastExec%instance.K == 0 {
+		instance.latencies.observe(PhaseExecute, instance.currentExecFrom)
+		instance.currentExecFrom = time.Time{}
+		if instance.isProofCheckpoint(instance.lastExec) {
 			instance.Checkpoint(instance.lastExec, instance.consumer.getState())
+		} else if instance.lastExec%instance.K == 0 {
+			instance.acknowledge(instance.lastExec)
+		}
+		if instance.lastExec%instance.K == 0 {
+			logger.Debugf("Replica %d phase latencies, %s", instance.id, instance.latencies)
+		}
+		if instance.isProofCheckpoint(instance.lastExec) && instance.checkpointInterval > 0 {
+			instance.checkpointTimer.Reset(instance.checkpointInterval, checkpointTimerEvent{})
 		}
 
 	} else {
@@ -996,6 +1476,7 @@ func (instance *pbftCore) execDoneSync() {
 		instance.skipInProgress = true
 	}
 	instance.currentExec = nil
+	instance.maybeRotate()
 
 	instance.executeOutstanding()
 }
@@ -1003,11 +1484,15 @@ func (instance *pbftCore) execDoneSync() {
 func (instance *pbftCore) moveWatermarks(n uint64) {
 	// round down n to previous low watermark
 	h := n / instance.K * instance.K
+	previous := instance.h
+	// everything after the last proof checkpoint must be kept for view changes
+	stable := instance.lastProofCheckpoint(h)
 
 	for idx, cert := range instance.certStore {
-		if idx.n <= h {
+		if idx.n <= stable {
 			logger.Debugf("Replica %d cleaning quorum certificate for view=%d/seqNo=%d",
 				instance.id, idx.v, idx.n)
+			instance.observeMissingVotes(idx, cert)
 			instance.persistDelRequestBatch(cert.digest)
 			delete(instance.reqBatchStore, cert.digest)
 			delete(instance.certStore, idx)
@@ -1023,30 +1508,40 @@ func (instance *pbftCore) moveWatermarks(n uint64) {
 	}
 
 	for n := range instance.pset {
-		if n <= h {
+		if n <= stable {
 			delete(instance.pset, n)
 		}
 	}
 
 	for idx := range instance.qset {
-		if idx.n <= h {
+		if idx.n <= stable {
 			delete(instance.qset, idx)
 		}
 	}
 
 	for n := range instance.chkpts {
-		if n < h {
+		if n < stable {
 			delete(instance.chkpts, n)
 			instance.persistDelCheckpoint(n)
 		}
 	}
 
 	instance.h = h
+	instance.collectPayloads(previous)
+	instance.collectHealth(h)
 
 	logger.Debugf("Replica %d updated low watermark to %d",
 		instance.id, instance.h)
 
+	if instance.pendingConfig != nil {
+		instance.applyConfig(instance.pendingConfig)
+		instance.pendingConfig = nil
+	}
+
 	instance.resubmitRequestBatches()
+	if instance.primary(instance.view) == instance.id && instance.activeView {
+		instance.sendNullFill()
+	}
 }
 
 func (instance *pbftCore) weakCheckpointSetOutOfRange(chkpt *Checkpoint) bool {
@@ -1063,23 +1558,19 @@ func (instance *pbftCore) weakCheckpointSetOutOfRange(chkpt *Checkpoint) bool {
 
 		// If f+1 other replicas have reported checkpoints that were (at one time) outside our watermarks
 		// we need to check to see if we have fallen behind.
-		if len(instance.hChkpts) >= instance.f+1 {
-			chkptSeqNumArray := make([]uint64, len(instance.hChkpts))
-			index := 0
+		if m, ok := instance.weakCertSeqNo(instance.hChkpts); ok {
 			for replicaID, hChkpt := range instance.hChkpts {
-				chkptSeqNumArray[index] = hChkpt
-				index++
 				if hChkpt < H {
 					delete(instance.hChkpts, replicaID)
 				}
 			}
-			sort.Sort(sortableUint64Slice(chkptSeqNumArray))
 
 			// If f+1 nodes have issued checkpoints above our high water mark, then
 			// we will never record 2f+1 checkpoints for that sequence number, we are out of date
 			// (This is because all_replicas - missed - me = 3f+1 - f - 1 = 2f)
-			if m := chkptSeqNumArray[len(chkptSeqNumArray)-(instance.f+1)]; m > H {
-				logger.Warningf("Replica %d is out of date, f+1 nodes agree checkpoint with seqNo %d exists but our high water mark is %d", instance.id, chkpt.SequenceNumber, H)
+			// Short of the lag threshold, we keep executing and repairing gaps instead
+			if lag := instance.skipLag(); m > H+lag {
+				logger.Warningf("Replica %d is out of date, f+1 nodes agree checkpoint with seqNo %d exists but our high water mark is %d, tolerating a lag of %d", instance.id, chkpt.SequenceNumber, H, lag)
 				instance.reqBatchStore = make(map[string]*RequestBatch) // Discard all our requests, as we will never know which were executed, to be addressed in #394
 				instance.persistDelAllRequestBatches()
 				instance.moveWatermarks(m)
@@ -1098,12 +1589,47 @@ func (instance *pbftCore) weakCheckpointSetOutOfRange(chkpt *Checkpoint) bool {
 	return false
 }
 
+// skipLag returns how far beyond the high watermark f+1 replicas may
+// checkpoint before this replica skips ahead by state transfer.  Once it
+// caught up by state transfer, the hysteresis is added until the replica
+// keeps up by execution again, so that it does not bounce from one state
+// transfer into the next.
+func (instance *pbftCore) skipLag() uint64 {
+	if instance.transferred {
+		return instance.lagThreshold + instance.lagHysteresis
+	}
+	return instance.lagThreshold
+}
+
+// weakCertSeqNo returns the highest sequence number which replicas
+// reported reaching with at least the weight of a weak certificate
+func (instance *pbftCore) weakCertSeqNo(reports map[uint64]uint64) (uint64, bool) {
+	var seqNos []uint64
+	for _, seqNo := range reports {
+		seqNos = append(seqNos, seqNo)
+	}
+	sort.Sort(sortableUint64Slice(seqNos))
+
+	for i := len(seqNos) - 1; i >= 0; i-- {
+		weight := 0
+		for replicaID, seqNo := range reports {
+			if seqNo >= seqNos[i] {
+				weight += instance.weight(replicaID)
+			}
+		}
+		if weight >= instance.weakQuorum() {
+			return seqNos[i], true
+		}
+	}
+	return 0, false
+}
+
 func (instance *pbftCore) witnessCheckpointWeakCert(chkpt *Checkpoint) {
-	checkpointMembers := make([]uint64, instance.f+1) // Only ever invoked for the first weak cert, so guaranteed to be f+1
+	var checkpointMembers []uint64 // Only ever invoked for the first weak cert
 	i := 0
 	for testChkpt := range instance.checkpointStore {
 		if testChkpt.SequenceNumber == chkpt.SequenceNumber && testChkpt.Id == chkpt.Id {
-			checkpointMembers[i] = testChkpt.ReplicaId
+			checkpointMembers = append(checkpointMembers, testChkpt.ReplicaId)
 			logger.Debugf("Replica %d adding replica %d (handle %v) to weak cert", instance.id, testChkpt.ReplicaId, checkpointMembers[i])
 			i++
 		}
@@ -1151,19 +1677,26 @@ func (instance *pbftCore) recvCheckpoint(chkpt *Checkpoint) events.Event {
 		return nil
 	}
 
+	if (chkpt.Id == "") == instance.isProofCheckpoint(chkpt.SequenceNumber) {
+		logger.Warningf("Replica %d received checkpoint for seqNo %d from replica %d which does not match the checkpoint proof interval, digest %s",
+			instance.id, chkpt.SequenceNumber, chkpt.ReplicaId, chkpt.Id)
+		return nil
+	}
+
 	instance.checkpointStore[*chkpt] = true
+	instance.observeCheckpoint(chkpt)
 
 	matching := 0
 	for testChkpt := range instance.checkpointStore {
 		if testChkpt.SequenceNumber == chkpt.SequenceNumber && testChkpt.Id == chkpt.Id {
-			matching++
+			matching += instance.weight(testChkpt.ReplicaId)
 		}
 	}
 	logger.Debugf("Replica %d found %d matching checkpoints for seqNo %d, digest %s",
 		instance.id, matching, chkpt.SequenceNumber, chkpt.Id)
 
-	if matching == instance.f+1 {
-		// We do have a weak cert
+	if weak := instance.weakQuorum(); matching >= weak && matching-instance.weight(chkpt.ReplicaId) < weak && chkpt.Id != "" {
+		// We do have a weak cert, acknowledgments cannot be transferred to
 		instance.witnessCheckpointWeakCert(chkpt)
 	}
 
@@ -1181,6 +1714,9 @@ func (instance *pbftCore) recvCheckpoint(chkpt *Checkpoint) events.Event {
 	// Note, this is not divergent from the paper, as the paper requires that
 	// the quorum certificate must contain 2f+1 messages, including its own
 	chkptID, ok := instance.chkpts[chkpt.SequenceNumber]
+	if chkpt.Id == "" {
+		chkptID, ok = "", instance.lastExec >= chkpt.SequenceNumber
+	}
 	if !ok {
 		logger.Debugf("Replica %d found checkpoint quorum for seqNo %d, digest %s, but it has not reached this checkpoint itself yet",
 			instance.id, chkpt.SequenceNumber, chkpt.Id)
@@ -1203,6 +1739,9 @@ func (instance *pbftCore) recvCheckpoint(chkpt *Checkpoint) events.Event {
 		logger.Criticalf("Replica %d generated a checkpoint of %s, but a quorum of the network agrees on %s. This is almost definitely non-deterministic chaincode.",
 			instance.id, chkptID, chkpt.Id)
 		instance.stateTransfer(nil)
+	} else if instance.transferred {
+		logger.Debugf("Replica %d reached stable checkpoint %d by execution", instance.id, chkpt.SequenceNumber)
+		instance.transferred = false
 	}
 
 	instance.moveWatermarks(chkpt.SequenceNumber)
@@ -1232,15 +1771,7 @@ func (instance *pbftCore) recvFetchRequestBatch(fr *FetchRequestBatch) (err erro
 
 	reqBatch := instance.reqBatchStore[digest]
 	msg := &Message{Payload: &Message_ReturnRequestBatch{ReturnRequestBatch: reqBatch}}
-	msgPacked, err := proto.Marshal(msg)
-	if err != nil {
-		return fmt.Errorf("Error marshalling return-request-batch message: %v", err)
-	}
-
-	receiver := fr.ReplicaId
-	err = instance.consumer.unicast(msgPacked, receiver)
-
-	return
+	return instance.innerUnicast(msg, fr.ReplicaId)
 }
 
 func (instance *pbftCore) recvReturnRequestBatch(reqBatch *RequestBatch) events.Event {
@@ -1261,11 +1792,16 @@ func (instance *pbftCore) recvReturnRequestBatch(reqBatch *RequestBatch) events.
 // Marshals a Message and hands it to the Stack. If toSelf is true,
 // the message is also dispatched to the local instance's RecvMsgSync.
 func (instance *pbftCore) innerBroadcast(msg *Message) error {
+	msg.Epoch = instance.epoch
 	msgRaw, err := proto.Marshal(msg)
 	if err != nil {
 		return fmt.Errorf("Cannot marshal message %s", err)
 	}
 
+	if instance.auditTrail != nil {
+		instance.audit(AuditEntry_SENT, 0, true, msg)
+	}
+
 	doByzantine := false
 	if instance.byzantine {
 		rand1 := rand.New(rand.NewSource(time.Now().UnixNano()))
@@ -1292,7 +1828,24 @@ func (instance *pbftCore) innerBroadcast(msg *Message) error {
 	return nil
 }
 
+// innerUnicast marshals a message and sends it to a single replica
+func (instance *pbftCore) innerUnicast(msg *Message, receiverID uint64) error {
+	msg.Epoch = instance.epoch
+	msgRaw, err := proto.Marshal(msg)
+	if err != nil {
+		return fmt.Errorf("Cannot marshal message %s", err)
+	}
+	if instance.auditTrail != nil {
+		instance.audit(AuditEntry_SENT, receiverID, false, msg)
+	}
+	return instance.consumer.unicast(msgRaw, receiverID)
+}
+
 func (instance *pbftCore) updateViewChangeSeqNo() {
+	if instance.rotation > 0 {
+		instance.updateRotationSeqNo()
+		return
+	}
 	if instance.viewChangePeriod <= 0 {
 		return
 	}
@@ -1326,17 +1879,28 @@ func (instance *pbftCore) startTimerIfOutstandingRequests() {
 	}
 }
 
+// softStartTimer starts the view change timer for requests which should
+// execute in time, unless it is already running
 func (instance *pbftCore) softStartTimer(timeout time.Duration, reason string) {
 	logger.Debugf("Replica %d soft starting new view timer for %s: %s", instance.id, timeout, reason)
-	instance.newViewTimerReason = reason
 	instance.timerActive = true
-	instance.newViewTimer.SoftReset(timeout, viewChangeTimerEvent{})
+	instance.newViewTimer.SoftReset(timeout, viewChangeTimerEvent{&ViewChangeCause{
+		Reason: ViewChangeCause_REQUEST_TIMEOUT,
+		View:   instance.view + 1,
+		Detail: reason,
+	}})
 }
 
+// startTimer starts the view change timer for a view change which should
+// complete in time
 func (instance *pbftCore) startTimer(timeout time.Duration, reason string) {
 	logger.Debugf("Replica %d starting new view timer for %s: %s", instance.id, timeout, reason)
 	instance.timerActive = true
-	instance.newViewTimer.Reset(timeout, viewChangeTimerEvent{})
+	instance.newViewTimer.Reset(timeout, viewChangeTimerEvent{&ViewChangeCause{
+		Reason: ViewChangeCause_NEW_VIEW_TIMEOUT,
+		View:   instance.view + 1,
+		Detail: reason,
+	}})
 }
 
 func (instance *pbftCore) stopTimer() {
@@ -832,6 +832,43 @@ func TestFallBehind(t *testing.T) {
 	//}
 }
 
+func TestFallBehindLagThreshold(t *testing.T) {
+	net := makeSimNetwork(4, 18, loadConfig())
+	defer net.stop()
+
+	outOfRange := func(instance *pbftCore, seqNo uint64) bool {
+		skip := false
+		for id := uint64(0); id < 2; id++ {
+			if instance.weakCheckpointSetOutOfRange(&Checkpoint{SequenceNumber: seqNo, ReplicaId: id, Id: "state"}) {
+				skip = true
+			}
+		}
+		return skip
+	}
+
+	instance := net.replicas[3].pbft
+	instance.lagThreshold = 2 * instance.K
+	H := instance.h + instance.L
+	if outOfRange(instance, H+instance.K) || instance.skipInProgress {
+		t.Fatalf("Replica should keep executing while f+1 checkpoints are within the lag threshold")
+	}
+	if !outOfRange(instance, H+3*instance.K) || !instance.skipInProgress {
+		t.Fatalf("Replica should skip to state transfer once f+1 checkpoints are beyond the lag threshold")
+	}
+
+	instance = net.replicas[2].pbft
+	instance.lagHysteresis = 2 * instance.K
+	instance.transferred = true
+	H = instance.h + instance.L
+	if outOfRange(instance, H+instance.K) {
+		t.Fatalf("Replica should tolerate the hysteresis after it caught up by state transfer")
+	}
+	instance.transferred = false
+	if !outOfRange(instance, H+2*instance.K) {
+		t.Fatalf("Replica should skip to state transfer once it kept up by execution again")
+	}
+}
+
 func TestPbftF0(t *testing.T) {
 	net := makePBFTNetwork(1, nil)
 	defer net.stop()
@@ -1602,3 +1639,403 @@ func TestCheckpointDiffersFromQuorum(t *testing.T) {
 		t.Fatalf("Replica should have invalidated its state and skipped")
 	}
 }
+
+func checkSimAgreement(t *testing.T, replicas []*simReplica) {
+	var longest []string
+	for _, r := range replicas {
+		if len(r.executions) > len(longest) {
+			longest = r.executions
+		}
+	}
+	for _, r := range replicas {
+		for i, digest := range r.executions {
+			if digest != longest[i] {
+				t.Errorf("Replica %d executed %s as its request batch %d, but %s was executed elsewhere", r.id, digest, i, longest[i])
+			}
+		}
+	}
+}
+
+func TestSimNetworkReordering(t *testing.T) {
+	net := makeSimNetwork(4, 42, nil)
+	defer net.stop()
+	net.jitter = 100 * time.Millisecond
+	net.dropRate = 0.05
+
+	for tag := int64(1); tag <= 10; tag++ {
+		net.submitAll(createPbftReqBatch(tag, 0))
+		net.runFor(20 * time.Millisecond)
+	}
+	// lost messages may leave a single replica behind, but a quorum must make progress
+	executed := func() bool {
+		count := 0
+		for _, r := range net.replicas {
+			if len(r.executions) == 10 {
+				count++
+			}
+		}
+		return count >= 3
+	}
+	if !net.runUntil(time.Minute, executed) {
+		for _, r := range net.replicas {
+			t.Errorf("Replica %d executed %d of 10 request batches", r.id, len(r.executions))
+		}
+	}
+	checkSimAgreement(t, net.replicas)
+}
+
+func TestSimNetworkPartitionedPrimary(t *testing.T) {
+	net := makeSimNetwork(4, 1, nil)
+	defer net.stop()
+	net.isolate(0)
+
+	net.submitAll(createPbftReqBatch(1, 0))
+	executed := func() bool {
+		for _, r := range net.replicas[1:] {
+			if len(r.executions) != 1 {
+				return false
+			}
+		}
+		return true
+	}
+	if !net.runUntil(time.Minute, executed) {
+		t.Fatalf("Request batch was not executed by the replicas outside of the primary's partition")
+	}
+	for _, r := range net.replicas[1:] {
+		if r.pbft.view == 0 {
+			t.Errorf("Replica %d should have moved away from the partitioned primary's view", r.id)
+		}
+	}
+	if len(net.replicas[0].executions) != 0 {
+		t.Errorf("Partitioned primary should not have executed anything")
+	}
+
+	net.heal()
+	net.submitAll(createPbftReqBatch(2, 0))
+	executed = func() bool {
+		for _, r := range net.replicas[1:] {
+			if len(r.executions) != 2 {
+				return false
+			}
+		}
+		return true
+	}
+	if !net.runUntil(time.Minute, executed) {
+		t.Errorf("Second request batch was not executed after the partition healed")
+	}
+	checkSimAgreement(t, net.replicas)
+}
+
+func TestLazyCheckpoints(t *testing.T) {
+	config := loadConfig()
+	config.Set("general.K", 2)
+	config.Set("general.logmultiplier", 2)
+	config.Set("general.checkpointproofinterval", 3)
+	net := makeSimNetwork(4, 3, config)
+	defer net.stop()
+
+	submit := func(reqID, count int, replicas []*simReplica) {
+		net.submitAll(createPbftReqBatch(int64(reqID), 0))
+		executed := func() bool {
+			for _, r := range replicas {
+				if len(r.executions) != count {
+					return false
+				}
+			}
+			return true
+		}
+		if !net.runUntil(time.Minute, executed) {
+			t.Fatalf("Request batch %d was not executed", reqID)
+		}
+	}
+
+	for i := 1; i <= 9; i++ {
+		submit(i, i, net.replicas)
+	}
+	net.runFor(time.Second)
+
+	for _, r := range net.replicas {
+		if r.pbft.h != 8 {
+			t.Errorf("Replica %d should have moved its low watermark to 8 on acknowledgments, but it is %d", r.id, r.pbft.h)
+		}
+		for n := range r.pbft.chkpts {
+			if n%6 != 0 {
+				t.Errorf("Replica %d produced a checkpoint proof for seqNo %d, expected proofs only every 6", r.id, n)
+			}
+		}
+		if _, ok := r.pbft.chkpts[6]; !ok {
+			t.Errorf("Replica %d dropped the last checkpoint proof", r.id)
+		}
+	}
+
+	// the view change must carry over everything since the last proof
+	net.isolate(0)
+	submit(10, 10, net.replicas[1:])
+	for _, r := range net.replicas[1:] {
+		if r.pbft.view == 0 {
+			t.Errorf("Replica %d should have moved away from the partitioned primary's view", r.id)
+		}
+	}
+
+	net.heal()
+	submit(11, 11, net.replicas[1:])
+	checkSimAgreement(t, net.replicas)
+}
+
+func TestSpeculativeExecution(t *testing.T) {
+	config := loadConfig()
+	config.Set("general.speculativeexecution", true)
+	net := makeSimNetwork(4, 5, config)
+	defer net.stop()
+
+	// replica 3 prepares the first batch, but never sees it commit
+	net.filterFn = func(src, dst uint64, msg *Message) (*Message, bool) {
+		if commit := msg.GetCommit(); commit != nil && dst == 3 && commit.SequenceNumber == 1 {
+			return nil, false
+		}
+		return msg, true
+	}
+
+	net.submitAll(createPbftReqBatch(1, 0))
+	executed := func() bool {
+		for _, r := range net.replicas[:3] {
+			if len(r.executions) != 1 {
+				return false
+			}
+		}
+		return true
+	}
+	if !net.runUntil(time.Minute, executed) {
+		t.Fatalf("Request batch was not executed")
+	}
+	for _, r := range net.replicas[:3] {
+		if r.promoted != 1 || r.discarded != 0 {
+			t.Errorf("Replica %d should have executed the batch speculatively, promoted %d, discarded %d", r.id, r.promoted, r.discarded)
+		}
+	}
+
+	r := net.replicas[3]
+	if r.speculation == nil || len(r.executions) != 0 {
+		t.Fatalf("Replica 3 should be executing the uncommitted batch speculatively")
+	}
+	net.runFor(10 * time.Second)
+	if r.discarded != 1 || r.speculation != nil || len(r.executions) != 0 {
+		t.Errorf("Replica 3 should have discarded its speculation on view change, discarded %d", r.discarded)
+	}
+}
+
+func TestByzantineBehaviors(t *testing.T) {
+	behaviors := map[string]func() byzantineBehavior{
+		"silent":         silentReplica,
+		"delayed commit": func() byzantineBehavior { return delayedCommitReplica(5 * time.Second) },
+		"corrupt digest": corruptDigestSender,
+		"equivocating":   equivocatingPrimary,
+	}
+
+	for name, behavior := range behaviors {
+		for _, faulty := range []uint64{0, 2} {
+			net := makeSimNetwork(4, 7, nil)
+			net.byzantine[faulty] = behavior()
+
+			var correct []*simReplica
+			for _, r := range net.replicas {
+				if r.id != faulty {
+					correct = append(correct, r)
+				}
+			}
+
+			for tag := int64(1); tag <= 3; tag++ {
+				net.submitAll(createPbftReqBatch(tag, 0))
+				net.runFor(100 * time.Millisecond)
+			}
+			executed := func() bool {
+				for _, r := range correct {
+					if len(r.executions) < 3 {
+						return false
+					}
+				}
+				return true
+			}
+			if !net.runUntil(2*time.Minute, executed) {
+				for _, r := range correct {
+					t.Errorf("%s replica %d: correct replica %d executed %d of 3 request batches", name, faulty, r.id, len(r.executions))
+				}
+			}
+			checkSimAgreement(t, correct)
+			net.stop()
+		}
+	}
+}
+
+func TestFastPathCommit(t *testing.T) {
+	config := loadConfig()
+	config.Set("general.fastpath", true)
+	net := makeSimNetwork(4, 3, config)
+	defer net.stop()
+
+	// commits never arrive, only the fast path can commit
+	net.filterFn = func(src, dst uint64, msg *Message) (*Message, bool) {
+		return msg, msg.GetCommit() == nil
+	}
+
+	net.submitAll(createPbftReqBatch(1, 0))
+	executed := func() bool {
+		for _, r := range net.replicas {
+			if len(r.executions) != 1 {
+				return false
+			}
+		}
+		return true
+	}
+	if !net.runUntil(time.Second, executed) {
+		t.Fatalf("Request batch should have fast committed")
+	}
+
+	// with a replica down, the batch must wait for the commit round
+	net.isolate(3)
+	net.submitAll(createPbftReqBatch(2, 0))
+	net.runFor(time.Second)
+	for _, r := range net.replicas {
+		if len(r.executions) != 1 {
+			t.Fatalf("Replica %d executed a batch which was not prepared by every replica", r.id)
+		}
+	}
+
+	net.filterFn = nil
+	net.submitAll(createPbftReqBatch(3, 0))
+	if !net.runUntil(time.Minute, func() bool {
+		for _, r := range net.replicas[:3] {
+			if len(r.executions) < 2 {
+				return false
+			}
+		}
+		return true
+	}) {
+		t.Fatalf("Request batches should have committed through the commit round")
+	}
+}
+
+func TestFastPathViewChange(t *testing.T) {
+	config := loadConfig()
+	config.Set("general.fastpath", true)
+	net := makeSimNetwork(4, 3, config)
+	defer net.stop()
+
+	// only replica 1 sees every prepare, and commits are lost, so it alone
+	// fast commits the batch before the others time out
+	net.filterFn = func(src, dst uint64, msg *Message) (*Message, bool) {
+		return msg, msg.GetCommit() == nil && (msg.GetPrepare() == nil || dst == 1)
+	}
+
+	net.submitAll(createPbftReqBatch(1, 0))
+	if !net.runUntil(time.Second, func() bool { return len(net.replicas[1].executions) == 1 }) {
+		t.Fatalf("Replica 1 should have fast committed the request batch")
+	}
+
+	net.filterFn = nil
+	if !net.runUntil(time.Minute, func() bool {
+		for _, r := range net.replicas {
+			if len(r.executions) != 1 {
+				return false
+			}
+		}
+		return true
+	}) {
+		t.Fatalf("The new view should have preserved the fast committed request batch")
+	}
+	for _, r := range net.replicas {
+		if r.pbft.view == 0 {
+			t.Errorf("Replica %d should have moved to a new view", r.id)
+		}
+	}
+	checkSimAgreement(t, net.replicas)
+}
+
+func TestWeightedQuorums(t *testing.T) {
+	config := loadConfig()
+	config.Set("general.weights", "3 1 1 1")
+	net := makeSimNetwork(4, 9, config)
+	defer net.stop()
+
+	if q := net.replicas[0].pbft.intersectionQuorum(); q != 4 {
+		t.Fatalf("Expected a quorum weight of 4, got %d", q)
+	}
+
+	// the primary outweighs two replicas, so it needs only one backup
+	net.isolate(2, 3)
+	net.submitAll(createPbftReqBatch(1, 0))
+	if !net.runUntil(time.Second, func() bool {
+		return len(net.replicas[0].executions) == 1 && len(net.replicas[1].executions) == 1
+	}) {
+		t.Fatalf("Replicas holding a quorum of weight should have executed the batch")
+	}
+	for _, r := range net.replicas[2:] {
+		if len(r.executions) != 0 {
+			t.Errorf("Replica %d should not have executed the batch while isolated", r.id)
+		}
+	}
+
+	// without the primary, the other replicas lack the weight for a view change
+	net.heal()
+	net.isolate(0)
+	net.submitAll(createPbftReqBatch(2, 0))
+	net.runFor(time.Minute)
+	for _, r := range net.replicas[1:] {
+		if r.pbft.view != 0 && r.pbft.activeView {
+			t.Errorf("Replica %d should not have completed a view change to view %d", r.id, r.pbft.view)
+		}
+	}
+}
+
+func TestCheckpointInterval(t *testing.T) {
+	config := loadConfig()
+	config.Set("general.timeout.checkpoint", "5s")
+	net := makeSimNetwork(4, 11, config)
+	defer net.stop()
+
+	for i := int64(1); i <= 3; i++ {
+		net.submitAll(createPbftReqBatch(i, 0))
+	}
+	net.runFor(time.Second)
+	for _, r := range net.replicas {
+		if r.pbft.lastExec != 3 || r.pbft.h != 0 {
+			t.Fatalf("Replica %d should have executed 3 batches without checkpointing, executed %d, low watermark %d", r.id, r.pbft.lastExec, r.pbft.h)
+		}
+	}
+
+	net.runFor(5 * time.Second)
+	K := net.replicas[0].pbft.K
+	for _, r := range net.replicas {
+		if r.pbft.lastExec != K || r.pbft.h != K {
+			t.Errorf("Replica %d should have checkpointed at %d once the interval passed, executed %d, low watermark %d", r.id, K, r.pbft.lastExec, r.pbft.h)
+		}
+		if len(r.executions) != 3 {
+			t.Errorf("Replica %d should only have executed the 3 batches, executed %d", r.id, len(r.executions))
+		}
+	}
+}
+
+func TestCheckpointIntervalProofInterval(t *testing.T) {
+	config := loadConfig()
+	config.Set("general.timeout.checkpoint", "5s")
+	config.Set("general.checkpointproofinterval", 3)
+	net := makeSimNetwork(4, 11, config)
+	defer net.stop()
+
+	for i := int64(1); i <= 3; i++ {
+		net.submitAll(createPbftReqBatch(i, 0))
+	}
+	net.runFor(6 * time.Second)
+	period := net.replicas[0].pbft.K * 3
+	for _, r := range net.replicas {
+		if r.pbft.lastExec != period || r.pbft.h != period {
+			t.Errorf("Replica %d should have reached the checkpoint carrying a state hash at %d once the interval passed, executed %d, low watermark %d", r.id, period, r.pbft.lastExec, r.pbft.h)
+		}
+		if _, ok := r.pbft.chkpts[period]; !ok {
+			t.Errorf("Replica %d should have a state hash for its checkpoint at %d", r.id, period)
+		}
+		if len(r.executions) != 3 {
+			t.Errorf("Replica %d should only have executed the 3 batches, executed %d", r.id, len(r.executions))
+		}
+	}
+}
@@ -44,6 +44,9 @@ func (instance *pbftCore) persistPSet() {
 }
 
 func (instance *pbftCore) persistPQSet(key string, set []*ViewChange_PQ) {
+	if !instance.epochStored {
+		instance.persistEpoch()
+	}
 	raw, err := proto.Marshal(&PQset{set})
 	if err != nil {
 		logger.Warningf("Replica %d could not persist pqset: %s", instance.id, err)
@@ -75,6 +78,7 @@ func (instance *pbftCore) persistRequestBatch(digest string) {
 		return
 	}
 	instance.consumer.StoreState("reqBatch."+digest, reqBatchPacked)
+	instance.persistPayloads(reqBatch)
 }
 
 func (instance *pbftCore) persistDelRequestBatch(digest string) {
@@ -101,6 +105,18 @@ func (instance *pbftCore) persistDelCheckpoint(seqNo uint64) {
 }
 
 func (instance *pbftCore) restoreState() {
+	instance.restoreEpoch()
+
+	// certificates of an earlier epoch are of no use in this one
+	inEpoch := func(set []*ViewChange_PQ) []*ViewChange_PQ {
+		var kept []*ViewChange_PQ
+		for _, e := range set {
+			if e.Epoch == instance.epoch {
+				kept = append(kept, e)
+			}
+		}
+		return kept
+	}
 	updateSeqView := func(set []*ViewChange_PQ) {
 		for _, e := range set {
 			if instance.view < e.View {
@@ -112,18 +128,21 @@ func (instance *pbftCore) restoreState() {
 		}
 	}
 
-	set := instance.restorePQSet("pset")
+	set := inEpoch(instance.restorePQSet("pset"))
 	for _, e := range set {
 		instance.pset[e.SequenceNumber] = e
 	}
 	updateSeqView(set)
 
-	set = instance.restorePQSet("qset")
+	set = inEpoch(instance.restorePQSet("qset"))
 	for _, e := range set {
 		instance.qset[qidx{e.BatchDigest, e.SequenceNumber}] = e
 	}
 	updateSeqView(set)
 
+	instance.restorePayloads()
+	instance.restoreViewChangeCauses()
+
 	reqBatchesPacked, err := instance.consumer.ReadStateSet("reqBatch.")
 	if err == nil {
 		for k, v := range reqBatchesPacked {
@@ -162,8 +181,8 @@ func (instance *pbftCore) restoreState() {
 
 	instance.restoreLastSeqNo()
 
-	logger.Infof("Replica %d restored state: view: %d, seqNo: %d, pset: %d, qset: %d, reqBatches: %d, chkpts: %d",
-		instance.id, instance.view, instance.seqNo, len(instance.pset), len(instance.qset), len(instance.reqBatchStore), len(instance.chkpts))
+	logger.Infof("Replica %d restored state: epoch: %d, view: %d, seqNo: %d, pset: %d, qset: %d, reqBatches: %d, chkpts: %d",
+		instance.id, instance.epoch, instance.view, instance.seqNo, len(instance.pset), len(instance.qset), len(instance.reqBatchStore), len(instance.chkpts))
 }
 
 func (instance *pbftCore) restoreLastSeqNo() {
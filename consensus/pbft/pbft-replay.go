@@ -0,0 +1,308 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package pbft
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/hyperledger/fabric/consensus"
+	"github.com/hyperledger/fabric/consensus/util"
+	"github.com/hyperledger/fabric/consensus/util/events"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/spf13/viper"
+)
+
+const msgLogPrefix = "msglog."
+
+// =============================================================================
+// message log recording
+// =============================================================================
+
+func msgLogKey(index uint64) string {
+	// zero padded, so that the keys sort in log order
+	return fmt.Sprintf("%s%020d", msgLogPrefix, index)
+}
+
+// restoreMsgLog positions the message log after any entries persisted by a previous run
+func (instance *pbftCore) restoreMsgLog() {
+	entries, err := instance.consumer.ReadStateSet(msgLogPrefix)
+	if err != nil {
+		return
+	}
+	for key := range entries {
+		var index uint64
+		if _, err := fmt.Sscanf(key, msgLogPrefix+"%d", &index); err != nil {
+			continue
+		}
+		if index >= instance.msgLogNext {
+			instance.msgLogNext = index + 1
+		}
+	}
+	if instance.msgLogNext > 0 {
+		logger.Warningf("Replica %d appending to an existing message log of %d entries, replay is only meaningful for logs recorded from an empty replica", instance.id, instance.msgLogNext)
+	}
+}
+
+func (instance *pbftCore) persistLogEntry(entry *LogEntry) {
+	raw, err := proto.Marshal(entry)
+	if err != nil {
+		logger.Warningf("Replica %d could not persist message log entry: %s", instance.id, err)
+		return
+	}
+	instance.consumer.StoreState(msgLogKey(instance.msgLogNext), raw)
+	instance.msgLogNext++
+}
+
+// logEvent records the inputs of the state machine which originate outside of it
+func (instance *pbftCore) logEvent(e events.Event) {
+	var entry *LogEntry
+	switch et := e.(type) {
+	case pbftMessageEvent:
+		entry = &LogEntry{Type: LogEntry_MESSAGE, Sender: et.sender, Message: et.msg}
+	case *RequestBatch:
+		entry = &LogEntry{Type: LogEntry_REQUEST_BATCH, RequestBatch: et}
+	case execDoneEvent:
+		entry = &LogEntry{Type: LogEntry_EXEC_DONE}
+		if instance.currentExec != nil && instance.isProofCheckpoint(*instance.currentExec) {
+			entry.State = instance.consumer.getState()
+		}
+	case viewChangeTimerEvent:
+		entry = &LogEntry{Type: LogEntry_VIEW_CHANGE_TIMER, ViewChangeCause: et.cause}
+	case viewChangeResendTimerEvent:
+		entry = &LogEntry{Type: LogEntry_VIEW_CHANGE_RESEND_TIMER}
+	case nullRequestEvent:
+		entry = &LogEntry{Type: LogEntry_NULL_REQUEST_TIMER}
+	case checkpointTimerEvent:
+		entry = &LogEntry{Type: LogEntry_CHECKPOINT_TIMER}
+	case gapRepairTimerEvent:
+		entry = &LogEntry{Type: LogEntry_GAP_REPAIR_TIMER}
+	case piggybackTimerEvent:
+		entry = &LogEntry{Type: LogEntry_PIGGYBACK_TIMER}
+	case bootstrapTimerEvent:
+		entry = &LogEntry{Type: LogEntry_BOOTSTRAP_TIMER}
+	case payloadEvent:
+		entry = &LogEntry{Type: LogEntry_PAYLOAD, Payload: et}
+	case stateUpdatedEvent:
+		logger.Warningf("Replica %d completed state transfer, its message log can no longer be replayed past this point", instance.id)
+		return
+	default:
+		// derived from other events, or not relevant to the decisions
+		return
+	}
+	instance.persistLogEntry(entry)
+}
+
+// logDecision records that a request batch was handed to execution
+func (instance *pbftCore) logDecision(seqNo uint64, digest string) {
+	instance.persistLogEntry(&LogEntry{Type: LogEntry_DECISION, SequenceNumber: seqNo, BatchDigest: digest})
+}
+
+// =============================================================================
+// message log replay
+// =============================================================================
+
+// ReadMessageLog returns the message log persisted by a replica, in the order it was recorded
+func ReadMessageLog(persistor consensus.StatePersistor) ([]*LogEntry, error) {
+	raw, err := persistor.ReadStateSet(msgLogPrefix)
+	if err != nil {
+		return nil, err
+	}
+	var keys []string
+	for key := range raw {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	entries := make([]*LogEntry, len(keys))
+	for i, key := range keys {
+		entries[i] = &LogEntry{}
+		if err := proto.Unmarshal(raw[key], entries[i]); err != nil {
+			return nil, fmt.Errorf("could not unmarshal message log entry %s: %s", key, err)
+		}
+	}
+	return entries, nil
+}
+
+// ReplayMessageLog loads the message log persisted by replica id and replays it
+// against a fresh PBFT core.  It returns the number of decisions which were
+// reproduced, or an error describing the first decision which diverged from
+// the recorded one.  The config should be the one the replica was running with.
+func ReplayMessageLog(id uint64, config *viper.Viper, persistor consensus.StatePersistor) (int, error) {
+	entries, err := ReadMessageLog(persistor)
+	if err != nil {
+		return 0, err
+	}
+	return replayLogEntries(id, config, entries)
+}
+
+func replayLogEntries(id uint64, config *viper.Viper, entries []*LogEntry) (int, error) {
+	stack := &replayStack{persist: make(map[string][]byte)}
+	core := newPbftCore(id, config, stack, &replayTimerFactory{})
+	defer core.close()
+	stack.core = core
+	core.msgLog = false
+	core.byzantine = false
+
+	verified := 0
+	for i, entry := range entries {
+		var event events.Event
+		switch entry.Type {
+		case LogEntry_MESSAGE:
+			event = pbftMessageEvent{msg: entry.Message, sender: entry.Sender}
+		case LogEntry_REQUEST_BATCH:
+			event = entry.RequestBatch
+		case LogEntry_EXEC_DONE:
+			stack.state = entry.State
+			event = execDoneEvent{}
+		case LogEntry_VIEW_CHANGE_TIMER:
+			event = viewChangeTimerEvent{entry.ViewChangeCause}
+		case LogEntry_VIEW_CHANGE_RESEND_TIMER:
+			event = viewChangeResendTimerEvent{}
+		case LogEntry_NULL_REQUEST_TIMER:
+			event = nullRequestEvent{}
+		case LogEntry_CHECKPOINT_TIMER:
+			event = checkpointTimerEvent{}
+		case LogEntry_GAP_REPAIR_TIMER:
+			event = gapRepairTimerEvent{}
+		case LogEntry_PIGGYBACK_TIMER:
+			event = piggybackTimerEvent{}
+		case LogEntry_BOOTSTRAP_TIMER:
+			event = bootstrapTimerEvent{}
+		case LogEntry_PAYLOAD:
+			event = payloadEvent(entry.Payload)
+		case LogEntry_DECISION:
+			if verified >= len(stack.decisions) {
+				return verified, fmt.Errorf("entry %d: replica %d decided seqNo %d with digest %s, but replay did not decide it",
+					i, id, entry.SequenceNumber, entry.BatchDigest)
+			}
+			replayed := stack.decisions[verified]
+			if replayed.SequenceNumber != entry.SequenceNumber || replayed.BatchDigest != entry.BatchDigest {
+				return verified, fmt.Errorf("entry %d: replica %d decided seqNo %d with digest %s, but replay decided seqNo %d with digest %s",
+					i, id, entry.SequenceNumber, entry.BatchDigest, replayed.SequenceNumber, replayed.BatchDigest)
+			}
+			verified++
+			continue
+		default:
+			return verified, fmt.Errorf("entry %d: unknown message log entry type %v", i, entry.Type)
+		}
+		events.SendEvent(core, event)
+	}
+
+	if verified < len(stack.decisions) {
+		replayed := stack.decisions[verified]
+		return verified, fmt.Errorf("replay decided seqNo %d with digest %s, which replica %d did not record",
+			replayed.SequenceNumber, replayed.BatchDigest, id)
+	}
+
+	return verified, nil
+}
+
+// replayStack stands in for the rest of the system during a replay, all
+// outgoing traffic is dropped and executions are only recorded
+type replayStack struct {
+	decisions []*LogEntry
+	state     []byte
+	lastSeqNo uint64
+	persist   map[string][]byte
+	core      *pbftCore
+}
+
+func (rs *replayStack) broadcast(msgPayload []byte)                            {}
+func (rs *replayStack) unicast(msgPayload []byte, receiverID uint64) error     { return nil }
+func (rs *replayStack) skipTo(seqNo uint64, snapshotID []byte, peers []uint64) {}
+func (rs *replayStack) sign(msg []byte) ([]byte, error)                        { return msg, nil }
+func (rs *replayStack) verify(senderID uint64, signature []byte, message []byte) error {
+	// signatures were verified when the messages were originally received
+	return nil
+}
+func (rs *replayStack) invalidateState() {}
+func (rs *replayStack) validateState()   {}
+
+func (rs *replayStack) execute(seqNo uint64, reqBatch *RequestBatch) {
+	digest := hash(reqBatch)
+	// the recorded decision carries the digest agreed upon, which references
+	// offloaded payloads rather than covering the executed batch
+	for idx, cert := range rs.core.certStore {
+		if idx.n == seqNo && cert.prePrepare != nil && rs.core.committed(cert.digest, idx.v, idx.n) {
+			digest = cert.digest
+			break
+		}
+	}
+	rs.decisions = append(rs.decisions, &LogEntry{Type: LogEntry_DECISION, SequenceNumber: seqNo, BatchDigest: digest})
+	rs.lastSeqNo = seqNo
+}
+
+func (rs *replayStack) getState() []byte {
+	return rs.state
+}
+
+func (rs *replayStack) getLastSeqNo() (uint64, error) {
+	if len(rs.decisions) == 0 {
+		return 0, fmt.Errorf("no execution yet")
+	}
+	return rs.lastSeqNo, nil
+}
+
+func (rs *replayStack) ReadState(key string) ([]byte, error) {
+	if val, ok := rs.persist[key]; ok {
+		return val, nil
+	}
+	return nil, fmt.Errorf("cannot find key %s", key)
+}
+
+func (rs *replayStack) ReadStateSet(prefix string) (map[string][]byte, error) {
+	ret := make(map[string][]byte)
+	for k, v := range rs.persist {
+		if strings.HasPrefix(k, prefix) {
+			ret[k] = v
+		}
+	}
+	return ret, nil
+}
+
+func (rs *replayStack) IterateState(prefix string, visit func(key string, value []byte) bool) error {
+	state, _ := rs.ReadStateSet(prefix)
+	util.IterateStateSet(state, visit)
+	return nil
+}
+
+func (rs *replayStack) StoreState(key string, value []byte) error {
+	rs.persist[key] = value
+	return nil
+}
+
+func (rs *replayStack) DelState(key string) {
+	delete(rs.persist, key)
+}
+
+// replayTimer never fires, timer expiry is replayed from the log instead
+type replayTimer struct{}
+
+func (rt *replayTimer) Halt()                                                {}
+func (rt *replayTimer) Reset(duration time.Duration, event events.Event)     {}
+func (rt *replayTimer) SoftReset(duration time.Duration, event events.Event) {}
+func (rt *replayTimer) Stop()                                                {}
+
+type replayTimerFactory struct{}
+
+func (rtf *replayTimerFactory) CreateTimer() events.Timer {
+	return &replayTimer{}
+}
@@ -0,0 +1,71 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package pbft
+
+import (
+	"testing"
+)
+
+func TestReplayMessageLog(t *testing.T) {
+	validatorCount := 4
+	config := loadConfig()
+	config.Set("general.K", 2)
+	config.Set("general.logmultiplier", 2)
+	config.Set("general.messagelog", true)
+	net := makePBFTNetwork(validatorCount, config)
+	defer net.stop()
+
+	for tag := int64(1); tag <= 5; tag++ {
+		net.pbftEndpoints[0].manager.Queue() <- createPbftReqBatch(tag, uint64(generateBroadcaster(validatorCount)))
+		net.process()
+	}
+
+	for _, pep := range net.pbftEndpoints {
+		if pep.sc.executions != 5 {
+			t.Fatalf("Replica %d should have executed 5 requests, got %d", pep.id, pep.sc.executions)
+		}
+		decisions, err := ReplayMessageLog(pep.id, config, &pep.sc.mockPersist)
+		if err != nil {
+			t.Errorf("Replay of replica %d failed: %s", pep.id, err)
+		}
+		if decisions != 5 {
+			t.Errorf("Replay of replica %d should have reproduced 5 decisions, got %d", pep.id, decisions)
+		}
+	}
+
+	entries, err := ReadMessageLog(&net.pbftEndpoints[1].sc.mockPersist)
+	if err != nil {
+		t.Fatalf("Could not read message log: %s", err)
+	}
+	tampered := 0
+	for _, entry := range entries {
+		if entry.Type == LogEntry_DECISION && entry.SequenceNumber == 3 {
+			entry.BatchDigest = "diverged"
+			tampered++
+		}
+	}
+	if tampered != 1 {
+		t.Fatalf("Expected a single decision for seqNo 3, found %d", tampered)
+	}
+	decisions, err := replayLogEntries(1, config, entries)
+	if err == nil {
+		t.Fatalf("Replay should have detected the diverging decision")
+	}
+	if decisions != 2 {
+		t.Errorf("Replay should have verified 2 decisions before diverging, got %d", decisions)
+	}
+}
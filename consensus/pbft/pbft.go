@@ -56,6 +56,8 @@ func New(stack consensus.Stack) consensus.Consenter {
 	switch strings.ToLower(config.GetString("general.mode")) {
 	case "batch":
 		return newObcBatch(id, config, stack)
+	case "sieve":
+		return newObcSieve(id, config, stack)
 	default:
 		panic(fmt.Errorf("Invalid PBFT mode: %s", config.GetString("general.mode")))
 	}
@@ -126,6 +128,12 @@ type obcGeneric struct {
 	pbft  *pbftCore
 }
 
+// requestClient identifies the client which submitted the transaction of a
+// request, the replica which received it when the client cannot be verified
+func (op *obcGeneric) requestClient(req *Request) string {
+	return clientOf(req.Payload, req.ReplicaId, op.stack.VerifyTransaction)
+}
+
 func (op *obcGeneric) skipTo(seqNo uint64, id []byte, replicas []uint64) {
 	info := &pb.BlockchainInfo{}
 	err := proto.Unmarshal(id, info)
@@ -32,6 +32,10 @@ func (p persistForward) ReadStateSet(prefix string) (map[string][]byte, error) {
 	return p.persistor.ReadStateSet(prefix)
 }
 
+func (p persistForward) IterateState(prefix string, visit func(key string, value []byte) bool) error {
+	return p.persistor.IterateState(prefix, visit)
+}
+
 func (p persistForward) StoreState(key string, val []byte) error {
 	return p.persistor.StoreState(key, val)
 }
@@ -0,0 +1,95 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package pbft
+
+// In steady state the primary broadcasts a pre-prepare for every sequence
+// number, so rather than broadcasting its commit for a sequence number on its
+// own, the primary may hold it and attach it to the next pre-prepare.  This
+// saves a message per sequence number.  The backups process the attached
+// commits before the pre-prepare carrying them, as if they had been received
+// on their own.  Once the pipeline is idle, or no further pre-prepare can be
+// sent in this view, held commits are broadcast explicitly.
+
+// piggybackTimerEvent is sent when the primary held its commits for the piggyback timeout
+type piggybackTimerEvent struct{}
+
+// holdCommit keeps a commit of the primary for the next pre-prepare, and
+// returns whether it did so
+func (instance *pbftCore) holdCommit(commit *Commit) bool {
+	if instance.piggybackTimeout <= 0 || instance.primary(commit.View) != instance.id {
+		return false
+	}
+	n := instance.seqNo + 1
+	if !instance.inWV(instance.view, n) || n > instance.h+instance.L/2 || n > instance.viewChangeSeqNo {
+		return false // no pre-prepare will follow in this view
+	}
+
+	logger.Debugf("Primary %d holding its commit for view=%d/seqNo=%d for the next pre-prepare", instance.id, commit.View, commit.SequenceNumber)
+	if len(instance.heldCommits) == 0 {
+		instance.piggybackTimer.Reset(instance.piggybackTimeout, piggybackTimerEvent{})
+	}
+	instance.heldCommits = append(instance.heldCommits, commit)
+	return true
+}
+
+// piggybackHeldCommits returns the pre-prepare to broadcast, carrying the
+// commits held by the primary; the pre-prepare kept in the certificate does
+// not carry them
+func (instance *pbftCore) piggybackHeldCommits(preprep *PrePrepare) *PrePrepare {
+	if len(instance.heldCommits) == 0 {
+		return preprep
+	}
+	instance.piggybackTimer.Stop()
+
+	carrier := *preprep
+	for _, commit := range instance.heldCommits {
+		if commit.View == preprep.View {
+			carrier.Commits = append(carrier.Commits, commit)
+		}
+	}
+	instance.heldCommits = nil
+	logger.Debugf("Primary %d piggybacking %d commits on the pre-prepare for view=%d/seqNo=%d", instance.id, len(carrier.Commits), preprep.View, preprep.SequenceNumber)
+	return &carrier
+}
+
+// flushHeldCommits broadcasts the commits the primary held for a pre-prepare
+// which did not come
+func (instance *pbftCore) flushHeldCommits() {
+	held := instance.heldCommits
+	instance.heldCommits = nil
+	for _, commit := range held {
+		if !instance.activeView || commit.View != instance.view {
+			logger.Debugf("Replica %d dropping its held commit for view=%d/seqNo=%d, it is in view %d", instance.id, commit.View, commit.SequenceNumber, instance.view)
+			continue
+		}
+		logger.Debugf("Primary %d broadcasting its held commit for view=%d/seqNo=%d", instance.id, commit.View, commit.SequenceNumber)
+		instance.innerBroadcast(&Message{Payload: &Message_Commit{Commit: commit}})
+	}
+}
+
+// recvPiggybackedCommits processes the commits of the primary carried by its
+// pre-prepare
+func (instance *pbftCore) recvPiggybackedCommits(preprep *PrePrepare) {
+	for _, commit := range preprep.Commits {
+		if commit.ReplicaId != preprep.ReplicaId {
+			logger.Warningf("Replica %d ignoring commit of replica %d piggybacked on a pre-prepare from replica %d", instance.id, commit.ReplicaId, preprep.ReplicaId)
+			continue
+		}
+		instance.recvCommit(commit)
+	}
+	preprep.Commits = nil
+}
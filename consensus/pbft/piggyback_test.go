@@ -0,0 +1,101 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package pbft
+
+import (
+	"testing"
+	"time"
+)
+
+func TestPiggybackCommits(t *testing.T) {
+	config := loadConfig()
+	config.Set("general.timeout.piggyback", "1s")
+	net := makeSimNetwork(4, 13, config)
+	defer net.stop()
+
+	explicit := make(map[uint64]bool)
+	piggybacked := make(map[uint64]uint64)
+	net.filterFn = func(src, dst uint64, msg *Message) (*Message, bool) {
+		if src != 0 || dst != 1 {
+			return msg, true
+		}
+		if commit := msg.GetCommit(); commit != nil {
+			explicit[commit.SequenceNumber] = true
+		}
+		if preprep := msg.GetPrePrepare(); preprep != nil {
+			for _, commit := range preprep.Commits {
+				piggybacked[commit.SequenceNumber] = preprep.SequenceNumber
+			}
+		}
+		return msg, true
+	}
+
+	for tag := int64(1); tag <= 3; tag++ {
+		net.submitAll(createPbftReqBatch(tag, 0))
+		if !net.runUntil(time.Minute, func() bool {
+			for _, r := range net.replicas {
+				if len(r.executions) != int(tag) {
+					return false
+				}
+			}
+			return true
+		}) {
+			t.Fatalf("Request batch %d was not executed by every replica", tag)
+		}
+	}
+
+	for n := uint64(1); n <= 2; n++ {
+		if piggybacked[n] != n+1 || explicit[n] {
+			t.Errorf("Expected the primary's commit for seqNo %d on the pre-prepare for seqNo %d only, piggybacked on %d, explicit %v", n, n+1, piggybacked[n], explicit[n])
+		}
+	}
+	if explicit[3] {
+		t.Errorf("Expected the primary to hold its commit for seqNo 3")
+	}
+
+	net.runFor(2 * time.Second)
+	if !explicit[3] {
+		t.Errorf("Expected the primary to broadcast its commit for seqNo 3 once the pipeline stayed idle")
+	}
+	if cert := net.replicas[1].pbft.certStore[msgID{0, 2}]; cert == nil || len(cert.prePrepare.Commits) != 0 {
+		t.Errorf("Expected the stored pre-prepare to carry no commits")
+	}
+}
+
+func TestPiggybackedCommitOfOtherReplica(t *testing.T) {
+	net := makeSimNetwork(4, 14, loadConfig())
+	defer net.stop()
+	instance := net.replicas[1].pbft
+
+	reqBatch := createPbftReqBatch(2, 0)
+	instance.recvPrePrepare(&PrePrepare{
+		View:           0,
+		SequenceNumber: 2,
+		BatchDigest:    hash(reqBatch),
+		RequestBatch:   reqBatch,
+		ReplicaId:      0,
+		Commits: []*Commit{
+			{View: 0, SequenceNumber: 1, BatchDigest: "foo", ReplicaId: 2},
+			{View: 0, SequenceNumber: 1, BatchDigest: "foo", ReplicaId: 0},
+		},
+	})
+
+	cert := instance.certStore[msgID{0, 1}]
+	if cert == nil || len(cert.commit) != 1 || cert.commit[0].ReplicaId != 0 {
+		t.Errorf("Expected only the primary's piggybacked commit to be accepted, got %+v", cert)
+	}
+}
@@ -0,0 +1,176 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package pbft
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/hyperledger/fabric/core/crypto/primitives"
+	pb "github.com/hyperledger/fabric/protos"
+
+	"github.com/golang/protobuf/proto"
+)
+
+// tcertCommonName is the subject of transaction certificates, which do not
+// reveal the enrollment ID of the client
+const tcertCommonName = "Transaction Certificate"
+
+// clientOf identifies the client which submitted a transaction by the
+// enrollment ID in its certificate, once verify checked the certificate and
+// the signature of the transaction, or anyone could pose as any client.
+// Transactions without an enrollment ID, because security is disabled, the
+// client signs with transaction certificates or the transaction does not
+// verify, are told apart by the replica which received them only.
+func clientOf(txRaw []byte, replicaID uint64, verify func(tx *pb.Transaction) error) string {
+	tx := &pb.Transaction{}
+	if err := proto.Unmarshal(txRaw, tx); err == nil && len(tx.Cert) > 0 {
+		cert, err := primitives.DERToX509Certificate(tx.Cert)
+		if err == nil && cert.Subject.CommonName != "" && cert.Subject.CommonName != tcertCommonName && verify(tx) == nil {
+			return cert.Subject.CommonName
+		}
+	}
+	return fmt.Sprintf("replica %d", replicaID)
+}
+
+// clientLimit is the rate in transactions per second at which a client may
+// submit, zero for no limit, and how many it may submit at once beyond it
+type clientLimit struct {
+	rate  float64
+	burst int
+}
+
+// tokenBucket holds the transactions a client may still submit at once, it
+// refills at the rate of the client up to its burst
+type tokenBucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// clientLimiter limits the rate at which each client submits transactions
+// through this replica.  It is called from RecvMsg, concurrently with the
+// main thread, and from the admin service.
+type clientLimiter struct {
+	lock       sync.Mutex
+	configured clientLimit
+	overrides  map[string]clientLimit
+	buckets    map[string]*tokenBucket
+	sweepAt    int              // the buckets of idle clients are dropped when there are this many
+	rejected   uint64           // transactions turned away so far
+	now        func() time.Time // replaced under test
+}
+
+// minSweep is the number of buckets below which idle clients are kept
+const minSweep = 1024
+
+func newClientLimiter(rate float64, burst int) *clientLimiter {
+	return &clientLimiter{
+		configured: clientLimit{rate: rate, burst: burst},
+		overrides:  make(map[string]clientLimit),
+		buckets:    make(map[string]*tokenBucket),
+		sweepAt:    minSweep,
+		now:        time.Now,
+	}
+}
+
+// limitOf returns the limit of a client, the caller holds the lock
+func (cl *clientLimiter) limitOf(client string) clientLimit {
+	if limit, ok := cl.overrides[client]; ok {
+		return limit
+	}
+	return cl.configured
+}
+
+// refill adds the tokens the client earned since the bucket was last used
+func (b *tokenBucket) refill(limit clientLimit, now time.Time) {
+	b.tokens += limit.rate * now.Sub(b.last).Seconds()
+	if max := float64(limit.burst); b.tokens > max {
+		b.tokens = max
+	}
+	b.last = now
+}
+
+// allow takes a token from the bucket of the client, it returns whether the
+// client may submit a transaction
+func (cl *clientLimiter) allow(client string) bool {
+	cl.lock.Lock()
+	defer cl.lock.Unlock()
+
+	limit := cl.limitOf(client)
+	if limit.rate <= 0 {
+		return true
+	}
+
+	now := cl.now()
+	bucket, ok := cl.buckets[client]
+	if !ok {
+		if len(cl.buckets) >= cl.sweepAt {
+			cl.sweep(now)
+		}
+		bucket = &tokenBucket{tokens: float64(limit.burst), last: now}
+		cl.buckets[client] = bucket
+	}
+	bucket.refill(limit, now)
+
+	if bucket.tokens < 1 {
+		cl.rejected++
+		return false
+	}
+	bucket.tokens--
+	return true
+}
+
+// sweep drops the buckets which refilled to their burst, their clients are
+// idle and start over with a full bucket anyway, the caller holds the lock
+func (cl *clientLimiter) sweep(now time.Time) {
+	for client, bucket := range cl.buckets {
+		limit := cl.limitOf(client)
+		bucket.refill(limit, now)
+		if bucket.tokens >= float64(limit.burst) {
+			delete(cl.buckets, client)
+		}
+	}
+	cl.sweepAt = 2 * len(cl.buckets)
+	if cl.sweepAt < minSweep {
+		cl.sweepAt = minSweep
+	}
+}
+
+// setLimit overrides the limit of a client, a negative rate restores the
+// configured limit, a burst which is not positive keeps the configured one
+func (cl *clientLimiter) setLimit(client string, rate float64, burst int) {
+	cl.lock.Lock()
+	defer cl.lock.Unlock()
+
+	delete(cl.buckets, client)
+	if rate < 0 {
+		delete(cl.overrides, client)
+		return
+	}
+	if burst <= 0 {
+		burst = cl.configured.burst
+	}
+	cl.overrides[client] = clientLimit{rate: rate, burst: burst}
+}
+
+// rejectedCount returns how many transactions were turned away so far
+func (cl *clientLimiter) rejectedCount() uint64 {
+	cl.lock.Lock()
+	defer cl.lock.Unlock()
+	return cl.rejected
+}
@@ -0,0 +1,144 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package pbft
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"fmt"
+	"math/big"
+	"testing"
+	"time"
+
+	pb "github.com/hyperledger/fabric/protos"
+)
+
+func createCert(t *testing.T, commonName string) []byte {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("Could not generate key: %s", err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: commonName},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("Could not create certificate: %s", err)
+	}
+	return der
+}
+
+func TestClientOf(t *testing.T) {
+	alice := createCert(t, "alice")
+	verify := func(tx *pb.Transaction) error {
+		if !bytes.Equal(tx.Cert, alice) {
+			return fmt.Errorf("certificate not issued by a trusted authority")
+		}
+		return nil
+	}
+
+	tx := createTx(1)
+	if client := clientOf(marshalTx(tx), 2, verify); client != "replica 2" {
+		t.Errorf("Expected a transaction without certificate to be told apart by its replica, got %s", client)
+	}
+
+	tx.Cert = alice
+	if client := clientOf(marshalTx(tx), 2, verify); client != "alice" {
+		t.Errorf("Expected a transaction with an enrollment certificate to be told apart by its enrollment ID, got %s", client)
+	}
+
+	tx.Cert = createCert(t, "alice")
+	if client := clientOf(marshalTx(tx), 2, verify); client != "replica 2" {
+		t.Errorf("Expected a transaction with an untrusted certificate to be told apart by its replica, got %s", client)
+	}
+
+	tx.Cert = createCert(t, tcertCommonName)
+	if client := clientOf(marshalTx(tx), 2, func(*pb.Transaction) error { return nil }); client != "replica 2" {
+		t.Errorf("Expected a transaction with a transaction certificate to be told apart by its replica, got %s", client)
+	}
+}
+
+func TestClientLimiter(t *testing.T) {
+	now := time.Now()
+	cl := newClientLimiter(2, 3)
+	cl.now = func() time.Time { return now }
+
+	for i := 0; i < 3; i++ {
+		if !cl.allow("alice") {
+			t.Fatalf("Expected transaction %d of the burst to be allowed", i)
+		}
+	}
+	if cl.allow("alice") {
+		t.Fatalf("Expected the transaction beyond the burst to be rejected")
+	}
+	if !cl.allow("bob") {
+		t.Errorf("Expected another client not to be affected")
+	}
+
+	now = now.Add(500 * time.Millisecond)
+	if !cl.allow("alice") || cl.allow("alice") {
+		t.Errorf("Expected a single transaction to be allowed after half a second at 2 per second")
+	}
+	if cl.rejectedCount() != 2 {
+		t.Errorf("Expected 2 rejected transactions, got %d", cl.rejectedCount())
+	}
+
+	cl.setLimit("alice", 0, 0)
+	for i := 0; i < 10; i++ {
+		if !cl.allow("alice") {
+			t.Fatalf("Expected the client not to be limited once its limit was lifted")
+		}
+	}
+
+	cl.setLimit("alice", 1, 1)
+	if !cl.allow("alice") || cl.allow("alice") {
+		t.Errorf("Expected the client to be limited to its override")
+	}
+
+	cl.setLimit("alice", -1, 0)
+	for i := 0; i < 3; i++ {
+		if !cl.allow("alice") {
+			t.Fatalf("Expected the configured burst to be restored")
+		}
+	}
+	if cl.allow("alice") {
+		t.Errorf("Expected the configured rate to be restored")
+	}
+}
+
+func TestClientLimiterSweep(t *testing.T) {
+	now := time.Now()
+	cl := newClientLimiter(1, 1)
+	cl.now = func() time.Time { return now }
+
+	for i := 0; i < minSweep; i++ {
+		cl.allow(fmt.Sprintf("client %d", i))
+	}
+	now = now.Add(time.Second)
+	cl.allow("client 0")
+	cl.allow("new")
+	if len(cl.buckets) != 2 {
+		t.Errorf("Expected the buckets of the idle clients to be dropped, %d remain", len(cl.buckets))
+	}
+}
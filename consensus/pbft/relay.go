@@ -0,0 +1,99 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package pbft
+
+import (
+	"fmt"
+	"time"
+)
+
+// minRelayCacheSize bounds the relays remembered from below, as a relay
+// which is forgotten too early is forwarded around the ring once more
+const minRelayCacheSize = 1024
+
+// relayer spreads broadcasts by gossip rather than having their origin send
+// them to every replica.  The origin sends a message to the fanout replicas
+// which follow it in replica ID order, and each replica forwards a message it
+// has not seen before to the fanout replicas following itself, so that
+// every replica uploads each message at most fanout times.  Messages reach
+// every replica as long as fewer than fanout consecutive replicas are faulty.
+//
+// Relays are signed by their origin, as the replica handing them over is not
+// the one which sent them, and are identified by their origin and sequence
+// number, which the replay cache uses to suppress duplicates.
+type relayer struct {
+	id     uint64
+	N      int
+	fanout int
+	next   uint64     // sequence number of the next relay originated here
+	seen   *txIDCache // relays recently received, by origin and sequence number
+}
+
+// newRelayer creates a relayer for replica id in a network of N replicas,
+// remembering as many relays as the transaction ID cache holds
+func newRelayer(id uint64, N int, fanout int, cacheSize int) *relayer {
+	if cacheSize < minRelayCacheSize {
+		cacheSize = minRelayCacheSize
+	}
+	return &relayer{
+		id:     id,
+		N:      N,
+		fanout: fanout,
+		// start from the clock, so that relays sent after a restart are
+		// not mistaken for replays of the relays sent before it
+		next: uint64(time.Now().UnixNano()),
+		seen: newTxIDCache(cacheSize),
+	}
+}
+
+// originate wraps a marshaled batch message into a new relay
+func (r *relayer) originate(payload []byte) *Relay {
+	r.next++
+	relay := &Relay{
+		ReplicaId: r.id,
+		Sequence:  r.next,
+		Payload:   payload,
+	}
+	r.seen.add(relayKey(relay))
+	return relay
+}
+
+// receive returns whether the relay was not seen before, and remembers it
+func (r *relayer) receive(relay *Relay) bool {
+	key := relayKey(relay)
+	if r.seen.has(key) {
+		return false
+	}
+	r.seen.add(key)
+	return true
+}
+
+// targets returns the replicas a relay from origin is forwarded to
+func (r *relayer) targets(origin uint64) []uint64 {
+	var targets []uint64
+	for i := 1; i < r.N && len(targets) < r.fanout; i++ {
+		dest := (r.id + uint64(i)) % uint64(r.N)
+		if dest != origin {
+			targets = append(targets, dest)
+		}
+	}
+	return targets
+}
+
+func relayKey(relay *Relay) string {
+	return fmt.Sprintf("%d/%d", relay.ReplicaId, relay.Sequence)
+}
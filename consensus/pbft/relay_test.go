@@ -0,0 +1,92 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package pbft
+
+import (
+	"reflect"
+	"sync"
+	"testing"
+)
+
+func TestRelayTargets(t *testing.T) {
+	r := newRelayer(5, 7, 3, 0)
+	if targets := r.targets(2); !reflect.DeepEqual(targets, []uint64{6, 0, 1}) {
+		t.Errorf("Expected relay to be forwarded to the next replicas, got %v", targets)
+	}
+	if targets := r.targets(0); !reflect.DeepEqual(targets, []uint64{6, 1, 2}) {
+		t.Errorf("Expected relay not to be forwarded back to its origin, got %v", targets)
+	}
+}
+
+func TestRelayDuplicates(t *testing.T) {
+	origin := newRelayer(0, 4, 1, 0)
+	r := newRelayer(1, 4, 1, 0)
+
+	relay := origin.originate([]byte("message"))
+	if !r.receive(relay) {
+		t.Fatalf("First receipt of a relay should be new")
+	}
+	if r.receive(relay) {
+		t.Errorf("Second receipt of a relay should be suppressed")
+	}
+	if !r.receive(origin.originate([]byte("message"))) {
+		t.Errorf("Message relayed again should be new")
+	}
+	if restarted := newRelayer(0, 4, 1, 0); !r.receive(restarted.originate([]byte("message"))) {
+		t.Errorf("Relay sent after a restart of its origin should be new")
+	}
+}
+
+func TestRelayNetwork(t *testing.T) {
+	validatorCount := 7
+	net := makeConsumerNetwork(validatorCount, obcBatchHelper, func(ce *consumerEndpoint) {
+		op := ce.consumer.(*obcBatch)
+		op.batchSize = 1
+		op.relayer = newRelayer(ce.id, validatorCount, 2, 0)
+	})
+	defer net.stop()
+
+	var lock sync.Mutex
+	primaryDests := make(map[int]bool)
+	net.filterFn = func(src, dst int, payload []byte) []byte {
+		if src == 0 {
+			lock.Lock()
+			primaryDests[dst] = true
+			lock.Unlock()
+		}
+		return payload
+	}
+
+	broadcaster := net.endpoints[generateBroadcaster(validatorCount)].getHandle()
+	if err := net.endpoints[3].(*consumerEndpoint).consumer.RecvMsg(createTxMsg(1), broadcaster); err != nil {
+		t.Fatalf("External request was not processed by backup: %v", err)
+	}
+	net.process()
+
+	for _, ep := range net.endpoints {
+		ce := ep.(*consumerEndpoint)
+		if _, err := ce.consumer.(*obcBatch).stack.GetBlock(1); err != nil {
+			t.Errorf("Replica %d should have committed the request relayed to it: %s", ce.id, err)
+		}
+	}
+	// replica 3 follows the primary if the origin is among the first two
+	for dst := range primaryDests {
+		if dst < 1 || dst > 3 {
+			t.Errorf("Primary should only have sent to the replicas following it, sent to %v", primaryDests)
+		}
+	}
+}
@@ -0,0 +1,123 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package pbft
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+// reloadableConfig holds the settings which may be changed while the replica
+// runs.  They only affect how long the replica waits and how it batches, not
+// the outcome of the protocol, so replicas need not change them together.
+type reloadableConfig struct {
+	batchSize          int
+	batchTimeout       time.Duration
+	requestTimeout     time.Duration
+	vcResendTimeout    time.Duration
+	newViewTimeout     time.Duration
+	nullRequestTimeout time.Duration
+}
+
+// configReloadEvent is sent when new settings should be applied at the next stable checkpoint
+type configReloadEvent struct {
+	config *reloadableConfig
+}
+
+// configReloader may be implemented by an innerStack which keeps reloadable
+// settings of its own, they are handed over when the replica applies them
+type configReloader interface {
+	applyConfig(config *reloadableConfig)
+}
+
+// readReloadableConfig parses the reloadable settings, adjusting the
+// timeouts as the constructors do
+func readReloadableConfig(config *viper.Viper) (*reloadableConfig, error) {
+	var err error
+	rc := &reloadableConfig{}
+
+	rc.batchSize = config.GetInt("general.batchsize")
+	if rc.batchSize < 1 {
+		return nil, fmt.Errorf("batch size must be positive, not %d", rc.batchSize)
+	}
+	if rc.batchTimeout, err = time.ParseDuration(config.GetString("general.timeout.batch")); err != nil {
+		return nil, fmt.Errorf("cannot parse batch timeout: %s", err)
+	}
+	if rc.requestTimeout, err = time.ParseDuration(config.GetString("general.timeout.request")); err != nil {
+		return nil, fmt.Errorf("cannot parse request timeout: %s", err)
+	}
+	if rc.vcResendTimeout, err = time.ParseDuration(config.GetString("general.timeout.resendviewchange")); err != nil {
+		return nil, fmt.Errorf("cannot parse view change resend timeout: %s", err)
+	}
+	if rc.newViewTimeout, err = time.ParseDuration(config.GetString("general.timeout.viewchange")); err != nil {
+		return nil, fmt.Errorf("cannot parse new view timeout: %s", err)
+	}
+	if rc.nullRequestTimeout, err = time.ParseDuration(config.GetString("general.timeout.nullrequest")); err != nil {
+		rc.nullRequestTimeout = 0
+	}
+
+	if rc.batchTimeout >= rc.requestTimeout {
+		rc.requestTimeout = 3 * rc.batchTimeout / 2
+		logger.Warningf("Configured request timeout must be greater than batch timeout, setting to %v", rc.requestTimeout)
+	}
+	if rc.requestTimeout >= rc.nullRequestTimeout && rc.nullRequestTimeout != 0 {
+		rc.nullRequestTimeout = 3 * rc.requestTimeout / 2
+		logger.Warningf("Configured null request timeout must be greater than request timeout, setting to %v", rc.nullRequestTimeout)
+	}
+
+	return rc, nil
+}
+
+// applyConfig switches to the reloaded settings, timers which are running
+// keep their old timeout until they are restarted
+func (instance *pbftCore) applyConfig(config *reloadableConfig) {
+	instance.requestTimeout = config.requestTimeout
+	instance.vcResendTimeout = config.vcResendTimeout
+	instance.newViewTimeout = config.newViewTimeout
+	if instance.N > 1 {
+		instance.nullRequestTimeout = config.nullRequestTimeout
+	}
+	logger.Infof("Replica %d applied reloaded configuration at checkpoint %d: request timeout = %v, view change timeout = %v, view change resend timeout = %v, null request timeout = %v",
+		instance.id, instance.h, instance.requestTimeout, instance.newViewTimeout, instance.vcResendTimeout, instance.nullRequestTimeout)
+
+	if reloader, ok := instance.consumer.(configReloader); ok {
+		reloader.applyConfig(config)
+	}
+}
+
+// ReloadConfig re-reads the configuration file, and applies the settings
+// which may change at runtime, timeouts and batching, at the next stable
+// checkpoint.  Other settings are ignored until the replica restarts.
+func (op *obcBatch) ReloadConfig() error {
+	if err := op.config.ReadInConfig(); err != nil {
+		return fmt.Errorf("cannot read %s plugin config: %s", configPrefix, err)
+	}
+	rc, err := readReloadableConfig(op.config)
+	if err != nil {
+		return err
+	}
+	op.manager.Queue() <- configReloadEvent{rc}
+	return nil
+}
+
+func (op *obcBatch) applyConfig(config *reloadableConfig) {
+	op.batchSize = config.batchSize
+	op.batchTimeout = config.batchTimeout
+	logger.Infof("Replica %d applied reloaded configuration: batch size = %d, batch timeout = %v", op.pbft.id, op.batchSize, op.batchTimeout)
+}
@@ -0,0 +1,105 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package pbft
+
+import (
+	"testing"
+	"time"
+
+	"github.com/hyperledger/fabric/consensus/util/events"
+	pb "github.com/hyperledger/fabric/protos"
+)
+
+func TestReloadConfigAtCheckpoint(t *testing.T) {
+	config := loadConfig()
+	config.Set("general.K", 2)
+	net := makeSimNetwork(4, 13, config)
+	defer net.stop()
+
+	reloaded := loadConfig()
+	reloaded.Set("general.timeout.request", "5s")
+	reloaded.Set("general.timeout.nullrequest", "3s")
+	rc, err := readReloadableConfig(reloaded)
+	if err != nil {
+		t.Fatalf("Could not read reloadable config: %s", err)
+	}
+	if rc.nullRequestTimeout != 15*time.Second/2 {
+		t.Errorf("Null request timeout should have been raised above the request timeout, it is %v", rc.nullRequestTimeout)
+	}
+
+	for _, r := range net.replicas {
+		r.deliver(configReloadEvent{rc})
+	}
+	net.submitAll(createPbftReqBatch(1, 0))
+	if !net.runUntil(time.Minute, func() bool { return len(net.replicas[1].executions) == 1 }) {
+		t.Fatalf("First request batch was not executed")
+	}
+	for _, r := range net.replicas {
+		if r.pbft.requestTimeout != 2*time.Second {
+			t.Errorf("Replica %d should keep its request timeout until the next stable checkpoint, it is %v", r.id, r.pbft.requestTimeout)
+		}
+	}
+
+	net.submitAll(createPbftReqBatch(2, 0))
+	stable := func() bool {
+		for _, r := range net.replicas {
+			if r.pbft.h != 2 {
+				return false
+			}
+		}
+		return true
+	}
+	if !net.runUntil(time.Minute, stable) {
+		t.Fatalf("Replicas did not reach a stable checkpoint")
+	}
+	for _, r := range net.replicas {
+		if r.pbft.requestTimeout != 5*time.Second || r.pbft.nullRequestTimeout != 15*time.Second/2 || r.pbft.pendingConfig != nil {
+			t.Errorf("Replica %d should have applied the reloaded timeouts at the stable checkpoint, request timeout is %v, null request timeout is %v",
+				r.id, r.pbft.requestTimeout, r.pbft.nullRequestTimeout)
+		}
+	}
+}
+
+func TestObcBatchReloadConfig(t *testing.T) {
+	omni := &omniProto{
+		UnicastImpl: func(ocMsg *pb.Message, peer *pb.PeerID) error { return nil },
+	}
+	config := loadConfig()
+	b := newObcBatch(0, config, omni)
+	defer b.Close()
+
+	config.Set("general.batchsize", 7)
+	config.Set("general.timeout.batch", "300ms")
+	if err := b.ReloadConfig(); err != nil {
+		t.Fatalf("Could not reload config: %s", err)
+	}
+	b.manager.Queue() <- nil
+	if b.batchSize == 7 || b.pbft.pendingConfig == nil {
+		t.Fatalf("Reloaded batch size should be pending until the next stable checkpoint")
+	}
+
+	b.manager.Queue() <- events.WorkEvent(func() { b.pbft.moveWatermarks(b.pbft.K) })
+	b.manager.Queue() <- nil
+	if b.batchSize != 7 || b.batchTimeout != 300*time.Millisecond {
+		t.Errorf("Expected the reloaded batch size and timeout to apply at the checkpoint, they are %d and %v", b.batchSize, b.batchTimeout)
+	}
+
+	config.Set("general.timeout.batch", "soon")
+	if err := b.ReloadConfig(); err == nil {
+		t.Errorf("Reloading an unparsable batch timeout should fail")
+	}
+}
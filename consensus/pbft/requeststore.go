@@ -16,16 +16,22 @@ limitations under the License.
 
 package pbft
 
-import "container/list"
+import (
+	"container/list"
+	"time"
+)
 
 type requestContainer struct {
-	key string
-	req *Request
+	key    string
+	req    *Request
+	added  time.Time
+	client string
 }
 
 type orderedRequests struct {
 	order    list.List
 	presence map[string]*list.Element
+	clientOf func(req *Request) string // identifies the client of a request, nil if clients are not told apart
 }
 
 func (a *orderedRequests) Len() int {
@@ -47,6 +53,10 @@ func (a *orderedRequests) has(key string) bool {
 func (a *orderedRequests) add(request *Request) {
 	rc := a.wrapRequest(request)
 	if !a.has(rc.key) {
+		rc.added = time.Now()
+		if a.clientOf != nil {
+			rc.client = a.clientOf(request)
+		}
 		e := a.order.PushBack(rc)
 		a.presence[rc.key] = e
 	}
@@ -90,10 +100,11 @@ type requestStore struct {
 	pendingRequests     *orderedRequests
 }
 
-// newRequestStore creates a new requestStore.
-func newRequestStore() *requestStore {
+// newRequestStore creates a new requestStore, which takes the outstanding
+// requests of the clients identified by clientOf in turn
+func newRequestStore(clientOf func(req *Request) string) *requestStore {
 	rs := &requestStore{
-		outstandingRequests: &orderedRequests{},
+		outstandingRequests: &orderedRequests{clientOf: clientOf},
 		pendingRequests:     &orderedRequests{},
 	}
 	// initialize data structures
@@ -130,18 +141,59 @@ func (rs *requestStore) hasNonPending() bool {
 	return rs.outstandingRequests.Len() > rs.pendingRequests.Len()
 }
 
-// getNextNonPending returns up to the next n outstanding, but not pending requests
+// getNextNonPending returns up to the next n outstanding, but not pending
+// requests.  They are taken from the clients in turn, each client's in the
+// order they arrived, so that a client with many requests waiting does not
+// hold back the requests of the others.
 func (rs *requestStore) getNextNonPending(n int) (result []*Request) {
+	var clients []string
+	waiting := make(map[string][]*Request)
 	for oreqc := rs.outstandingRequests.order.Front(); oreqc != nil; oreqc = oreqc.Next() {
 		oreq := oreqc.Value.(requestContainer)
 		if rs.pendingRequests.has(oreq.key) {
 			continue
 		}
-		result = append(result, oreq.req)
-		if len(result) == n {
-			break
+		if _, ok := waiting[oreq.client]; !ok {
+			clients = append(clients, oreq.client)
+		}
+		waiting[oreq.client] = append(waiting[oreq.client], oreq.req)
+	}
+
+	for len(clients) > 0 && len(result) != n {
+		remaining := clients[:0]
+		for _, client := range clients {
+			if len(result) == n {
+				break
+			}
+			result = append(result, waiting[client][0])
+			if waiting[client] = waiting[client][1:]; len(waiting[client]) > 0 {
+				remaining = append(remaining, client)
+			}
 		}
+		clients = remaining
 	}
 
 	return result
 }
+
+// expireNonPending removes and returns the outstanding, but not pending
+// requests which were added before the deadline
+func (rs *requestStore) expireNonPending(deadline time.Time) (expired []*Request) {
+	var next *list.Element
+	for oreqc := rs.outstandingRequests.order.Front(); oreqc != nil; oreqc = next {
+		next = oreqc.Next()
+		oreq := oreqc.Value.(requestContainer)
+		if !oreq.added.Before(deadline) {
+			// requests are kept in the order they were added
+			break
+		}
+		if rs.pendingRequests.has(oreq.key) {
+			continue
+		}
+		rs.outstandingRequests.order.Remove(oreqc)
+		delete(rs.outstandingRequests.presence, oreq.key)
+		expired = append(expired, oreq.req)
+	}
+
+	return expired
+}
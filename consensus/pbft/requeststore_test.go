@@ -16,7 +16,11 @@ limitations under the License.
 
 package pbft
 
-import "testing"
+import (
+	"fmt"
+	"testing"
+	"time"
+)
 
 func TestOrderedRequests(t *testing.T) {
 	or := &orderedRequests{}
@@ -54,6 +58,51 @@ func TestOrderedRequests(t *testing.T) {
 	}
 }
 
+func TestExpireNonPending(t *testing.T) {
+	rs := newRequestStore(nil)
+
+	r1 := createPbftReq(1, 1)
+	r2 := createPbftReq(2, 1)
+	r3 := createPbftReq(3, 1)
+	rs.storeOutstanding(r1)
+	rs.storeOutstanding(r2)
+	rs.storePending(r2)
+	deadline := time.Now().Add(time.Millisecond)
+	time.Sleep(2 * time.Millisecond)
+	rs.storeOutstanding(r3)
+
+	expired := rs.expireNonPending(deadline)
+	if len(expired) != 1 || expired[0] != r1 {
+		t.Fatalf("Expected only the first request to expire, got %v", expired)
+	}
+	if !rs.outstandingRequests.has(hash(r2)) {
+		t.Errorf("Pending request should not have expired")
+	}
+	if !rs.outstandingRequests.has(hash(r3)) {
+		t.Errorf("Request added after the deadline should not have expired")
+	}
+}
+
+func TestNextNonPendingTakesClientsInTurn(t *testing.T) {
+	rs := newRequestStore(func(req *Request) string { return fmt.Sprintf("replica %d", req.ReplicaId) })
+
+	chatty := []*Request{createPbftReq(1, 1), createPbftReq(2, 1), createPbftReq(3, 1), createPbftReq(4, 1)}
+	quiet := createPbftReq(5, 2)
+	for _, req := range chatty {
+		rs.storeOutstanding(req)
+	}
+	rs.storeOutstanding(quiet)
+	rs.storePending(chatty[0])
+
+	next := rs.getNextNonPending(3)
+	if len(next) != 3 || next[0] != chatty[1] || next[1] != quiet || next[2] != chatty[2] {
+		t.Fatalf("Expected the requests of the clients in turn, got %v", next)
+	}
+	if next = rs.getNextNonPending(10); len(next) != 4 || next[3] != chatty[3] {
+		t.Errorf("Expected all non pending requests, got %v", next)
+	}
+}
+
 func BenchmarkOrderedRequests(b *testing.B) {
 	or := &orderedRequests{}
 	or.empty()
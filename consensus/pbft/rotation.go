@@ -0,0 +1,212 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package pbft
+
+import (
+	"time"
+
+	"github.com/hyperledger/fabric/consensus/util/events"
+)
+
+// With rotation enabled the primary changes every few batches instead of
+// only when it is suspected.  The sequence numbers are cut into slots of
+// rotation batches, and the primary of a view orders at most the rest of the
+// slot it started in.  Once a replica has executed the last sequence number
+// of the slot, every batch of the view is committed, so it moves to the next
+// view on its own, and the primary of that view carries on from the next
+// slot.  No view change messages are exchanged for this, the classic view
+// change is left for a primary which stalls within its slot, which limits
+// how long a slow primary may hold up the network to one slot.
+//
+// A replica which was cut off for longer than a slot does not know how many
+// views it skipped, the slots it caught up on by state transfer only give a
+// lower bound.  The other replicas do not change view for it, so it moves to
+// the highest view which f+1 replicas are seen ordering batches in, at least
+// one of them is correct.
+
+// updateRotationSeqNo sets the last sequence number the current primary may
+// order to the end of the slot the sequence number is in
+func (instance *pbftCore) updateRotationSeqNo() {
+	instance.viewChangeSeqNo = (instance.seqNo/instance.rotation + 1) * instance.rotation
+	logger.Debugf("Replica %d will rotate the primary after seqNo %d", instance.id, instance.viewChangeSeqNo)
+}
+
+// maybeRotate moves to the next view once the last batch of the primary's
+// slot has executed.  After a state transfer past the end of the slot, every
+// slot up to the new lastExec was ordered in a view of its own at least.
+func (instance *pbftCore) maybeRotate() {
+	if instance.rotation == 0 || !instance.activeView || instance.lastExec < instance.viewChangeSeqNo {
+		return
+	}
+
+	next := instance.view + (instance.lastExec-instance.viewChangeSeqNo)/instance.rotation + 1
+	logger.Infof("Replica %d rotating primary after seqNo=%d, from primary %d in view %d to primary %d in view %d",
+		instance.id, instance.lastExec, instance.primary(instance.view), instance.view, instance.primary(next), next)
+	instance.stopTimer()
+	instance.nullRequestTimer.Stop()
+	// the next primary is not to blame for the batches the current one left
+	instance.health.requestSeen = make(map[string]time.Time)
+
+	instance.rotations += next - instance.view
+	instance.view = next
+	instance.seqNo = instance.lastExec
+	instance.updateRotationSeqNo()
+	instance.rotated = true
+}
+
+// deferUntilRotation keeps a message for a later view until this replica
+// rotates to it, and returns whether it did so.  Messages are kept for as
+// many views as there are slots in the watermark window.
+func (instance *pbftCore) deferUntilRotation(v uint64, n uint64, replicaID uint64, msg events.Event) bool {
+	if instance.rotation == 0 || v <= instance.view {
+		return false
+	}
+	instance.notePeerView(replicaID, v, n)
+	if v <= instance.view {
+		// the replica rejoined the rotation in the view of the message, or past it
+		return false
+	}
+	if !instance.activeView || v > instance.view+instance.L/instance.rotation+1 {
+		return false
+	}
+	// three phases for every sequence number of the window, from every replica
+	if uint64(len(instance.rotationBacklog)) >= 3*instance.L*uint64(instance.replicaCount) {
+		logger.Warningf("Replica %d has too many messages for later views, dropping %T for view %d", instance.id, msg, v)
+		return true
+	}
+	logger.Debugf("Replica %d keeping %T for view %d until the primary rotates", instance.id, msg, v)
+	instance.rotationBacklog = append(instance.rotationBacklog, msg)
+	return true
+}
+
+// notePeerView records that a replica was seen in a view ahead of this one,
+// and rejoins the rotation if enough replicas were
+func (instance *pbftCore) notePeerView(replicaID uint64, v uint64, n uint64) {
+	if seen, ok := instance.peerViews[replicaID]; ok && (seen.v > v || seen.v == v && seen.n >= n) {
+		return
+	}
+	instance.peerViews[replicaID] = msgID{v: v, n: n}
+	instance.maybeRejoinRotation()
+}
+
+// maybeRejoinRotation moves this replica to the highest view f+1 replicas
+// were seen in, if it fell behind by more than the next rotation
+func (instance *pbftCore) maybeRejoinRotation() {
+	if instance.rotation == 0 {
+		return
+	}
+
+	var target msgID
+	for _, candidate := range instance.peerViews {
+		if candidate.v <= target.v {
+			continue
+		}
+		vouching := make(map[uint64]bool)
+		for id, seen := range instance.peerViews {
+			if seen.v >= candidate.v {
+				vouching[id] = true
+			}
+		}
+		if instance.weightOf(vouching) >= instance.weakQuorum() {
+			target = candidate
+		}
+	}
+	for _, seen := range instance.peerViews {
+		if seen.v == target.v && seen.n > target.n {
+			target.n = seen.n
+		}
+	}
+
+	if target.v <= instance.view {
+		return
+	}
+	if instance.activeView && target.v == instance.view+1 && instance.lastExec < instance.viewChangeSeqNo {
+		// this replica rotates on its own once the slot has executed
+		return
+	}
+
+	logger.Warningf("Replica %d fell behind the rotation in view %d, moving to view %d with primary %d",
+		instance.id, instance.view, target.v, instance.primary(target.v))
+	instance.stopTimer()
+	instance.nullRequestTimer.Stop()
+	instance.vcResendTimer.Stop()
+	instance.health.requestSeen = make(map[string]time.Time)
+
+	if instance.activeView {
+		instance.rotations += target.v - instance.view
+	}
+	instance.activeView = true
+	instance.view = target.v
+	// the slot of the view is the one its primary was seen ordering in
+	if slotStart := (target.n - 1) / instance.rotation * instance.rotation; target.n > 0 && slotStart > instance.seqNo {
+		instance.seqNo = slotStart
+	}
+	instance.updateRotationSeqNo()
+	instance.rotated = true
+	instance.maybeTransferToSlot()
+}
+
+// maybeTransferToSlot starts a state transfer if this replica has not
+// executed up to the slot of its view.  The batches in between were ordered
+// in views it skipped, and gap repair only fetches those of the current view.
+func (instance *pbftCore) maybeTransferToSlot() {
+	if instance.rotation == 0 || instance.skipInProgress || instance.bootstrapping || instance.lastExec+instance.rotation >= instance.viewChangeSeqNo {
+		return
+	}
+	logger.Infof("Replica %d executed up to seqNo %d, but its view %d orders from seqNo %d, catching up by state transfer",
+		instance.id, instance.lastExec, instance.view, instance.viewChangeSeqNo-instance.rotation+1)
+	if instance.highStateTarget != nil && instance.highStateTarget.seqNo > instance.lastExec {
+		instance.stateTransfer(nil)
+		return
+	}
+	// the checkpoints which would have been the target were sent while
+	// this replica was cut off
+	instance.fetchStableCheckpoint()
+}
+
+// finishRotation processes the messages which arrived for the new view
+// before this replica rotated to it, and lets the consumer know the primary
+// changed
+func (instance *pbftCore) finishRotation() events.Event {
+	for instance.rotated {
+		instance.rotated = false
+		backlog := instance.rotationBacklog
+		instance.rotationBacklog = nil
+		for _, msg := range backlog {
+			var err error
+			switch m := msg.(type) {
+			case *PrePrepare:
+				err = instance.recvPrePrepare(m)
+			case *Prepare:
+				err = instance.recvPrepare(m)
+			case *Commit:
+				err = instance.recvCommit(m)
+			}
+			if err != nil {
+				logger.Warning(err.Error())
+			}
+		}
+	}
+
+	if instance.primary(instance.view) == instance.id {
+		logger.Debugf("Replica %d is now primary, attempting to resubmit requests", instance.id)
+		instance.resubmitRequestBatches()
+	}
+	instance.startTimerIfOutstandingRequests()
+
+	return viewChangedEvent{}
+}
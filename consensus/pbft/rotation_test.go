@@ -0,0 +1,208 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package pbft
+
+import (
+	"testing"
+	"time"
+)
+
+func TestNetworkRotation(t *testing.T) {
+	validatorCount := 4
+	config := loadConfig()
+	config.Set("general.K", "2")
+	config.Set("general.logmultiplier", "2")
+	config.Set("general.rotation", "1")
+	net := makePBFTNetwork(validatorCount, config)
+	defer net.stop()
+
+	for n := 1; n < 6; n++ {
+		for _, pe := range net.pbftEndpoints {
+			pe.manager.Queue() <- createPbftReqBatch(int64(n), 0)
+		}
+		net.process()
+	}
+
+	for _, pep := range net.pbftEndpoints {
+		if pep.sc.executions != 5 {
+			t.Errorf("Instance %d executed incorrect number of transactions: %d", pep.id, pep.sc.executions)
+		}
+		// every batch was ordered by a different primary
+		if pep.pbft.view != 5 {
+			t.Errorf("Instance %d: expected view=5, got %d", pep.id, pep.pbft.view)
+		}
+		if pep.pbft.rotations != 5 {
+			t.Errorf("Instance %d: expected 5 rotations, got %d", pep.id, pep.pbft.rotations)
+		}
+		if len(pep.pbft.viewChangeStore) != 0 {
+			t.Errorf("Instance %d: expected no view change messages, got %d", pep.id, len(pep.pbft.viewChangeStore))
+		}
+	}
+}
+
+func TestRotationSlots(t *testing.T) {
+	instance := newPbftCore(1, loadConfig(), &omniProto{}, &inertTimerFactory{})
+	instance.rotation = 3
+	for seqNo, end := range map[uint64]uint64{0: 3, 1: 3, 2: 3, 3: 6, 7: 9} {
+		instance.seqNo = seqNo
+		instance.updateViewChangeSeqNo()
+		if instance.viewChangeSeqNo != end {
+			t.Errorf("Expected the slot of seqNo %d to end at %d, got %d", seqNo, end, instance.viewChangeSeqNo)
+		}
+	}
+}
+
+func TestRotationDefersNextView(t *testing.T) {
+	instance := newPbftCore(2, loadConfig(), &omniProto{
+		broadcastImpl: func(b []byte) {},
+		signImpl:      func(b []byte) ([]byte, error) { return b, nil },
+		verifyImpl:    func(senderID uint64, signature []byte, message []byte) error { return nil },
+	}, &inertTimerFactory{})
+	instance.rotation = 1
+	instance.updateViewChangeSeqNo()
+
+	reqBatch := createPbftReqBatch(1, 0)
+	digest := hash(reqBatch)
+	instance.recvPrePrepare(&PrePrepare{
+		View:           1,
+		SequenceNumber: 2,
+		BatchDigest:    digest,
+		RequestBatch:   reqBatch,
+		ReplicaId:      1,
+	})
+	if len(instance.rotationBacklog) != 1 {
+		t.Fatalf("Expected the pre-prepare of the next primary to be kept, backlog has %d messages", len(instance.rotationBacklog))
+	}
+	if _, ok := instance.certStore[msgID{v: 1, n: 2}]; ok {
+		t.Fatalf("Pre-prepare for the next view should not be processed before rotating")
+	}
+
+	n := uint64(1)
+	instance.currentExec = &n
+	instance.execDoneSync()
+	if instance.view != 1 || !instance.rotated {
+		t.Fatalf("Expected to rotate to view 1 after executing seqNo 1, in view %d", instance.view)
+	}
+
+	if _, ok := instance.finishRotation().(viewChangedEvent); !ok {
+		t.Errorf("Expected the consumer to learn of the new primary")
+	}
+	if len(instance.rotationBacklog) != 0 {
+		t.Errorf("Expected the backlog to be replayed, still has %d messages", len(instance.rotationBacklog))
+	}
+	cert, ok := instance.certStore[msgID{v: 1, n: 2}]
+	if !ok || cert.prePrepare == nil || !cert.sentPrepare {
+		t.Errorf("Expected the kept pre-prepare to be prepared in view 1")
+	}
+	if instance.viewChangeSeqNo != 2 {
+		t.Errorf("Expected the new primary to hand over after seqNo 2, got %d", instance.viewChangeSeqNo)
+	}
+}
+
+func TestNetworkBatchRotation(t *testing.T) {
+	validatorCount := 4
+	net := makeConsumerNetwork(validatorCount, obcBatchHelper, func(ce *consumerEndpoint) {
+		op := ce.consumer.(*obcBatch)
+		op.batchSize = 1
+		op.pbft.rotation = 2
+		op.pbft.updateViewChangeSeqNo()
+	})
+	defer net.stop()
+
+	broadcaster := net.endpoints[generateBroadcaster(validatorCount)].getHandle()
+	for n := int64(1); n <= 4; n++ {
+		if err := net.endpoints[3].(*consumerEndpoint).consumer.RecvMsg(createTxMsg(n), broadcaster); err != nil {
+			t.Fatalf("External request was not processed by backup: %v", err)
+		}
+		net.process()
+	}
+
+	for _, ep := range net.endpoints {
+		ce := ep.(*consumerEndpoint)
+		op := ce.consumer.(*obcBatch)
+		if size := op.stack.GetBlockchainSize(); size != 5 {
+			t.Errorf("Replica %d should have committed 4 blocks, blockchain size is %d", ce.id, size)
+		}
+		if op.pbft.view != 2 {
+			t.Errorf("Replica %d should be in view 2, is in view %d", ce.id, op.pbft.view)
+		}
+		if op.reqStore.outstandingRequests.Len() != 0 {
+			t.Errorf("Replica %d should have no outstanding requests, has %d", ce.id, op.reqStore.outstandingRequests.Len())
+		}
+	}
+}
+
+func TestSimRotationRejoinAfterPartition(t *testing.T) {
+	config := loadConfig()
+	config.Set("general.K", "2")
+	config.Set("general.logmultiplier", "4")
+	config.Set("general.rotation", "1")
+	net := makeSimNetwork(4, 5, config)
+	defer net.stop()
+
+	committed := func(replicas []*simReplica, count int) func() bool {
+		return func() bool {
+			for _, r := range replicas {
+				if len(r.executions) < count {
+					return false
+				}
+			}
+			return true
+		}
+	}
+
+	// the others rotate through two slots without replica 3
+	net.isolate(3)
+	others := net.replicas[:3]
+	for n := int64(1); n <= 2; n++ {
+		net.submitAll(createPbftReqBatch(n, 0))
+	}
+	if !net.runUntil(time.Minute, committed(others, 2)) {
+		t.Fatalf("Request batches should have committed without replica 3")
+	}
+	net.runFor(100 * time.Millisecond)
+	if lagging, ahead := net.replicas[3].pbft.view, net.replicas[0].pbft.view; ahead < lagging+2 {
+		t.Fatalf("Replica 3 should have fallen behind by at least two views, it is in view %d, the others in %d", lagging, ahead)
+	}
+
+	// the others do not change view for replica 3, it has to follow them,
+	// and order its own slots when the rotation comes to it
+	viewChanges := 0
+	net.filterFn = func(src, dst uint64, msg *Message) (*Message, bool) {
+		if msg.GetViewChange() != nil && src != 3 {
+			viewChanges++
+		}
+		return msg, true
+	}
+	net.heal()
+	for n := int64(3); n <= 10; n++ {
+		net.submitAll(createPbftReqBatch(n, 0))
+	}
+	if !net.runUntil(5*time.Minute, committed(net.replicas, 10)) {
+		t.Fatalf("Replica 3 should have rejoined the rotation, it executed %d batches in view %d, the others are in view %d",
+			len(net.replicas[3].executions), net.replicas[3].pbft.view, net.replicas[0].pbft.view)
+	}
+	checkSimAgreement(t, net.replicas)
+	if viewChanges != 0 {
+		t.Errorf("Replica 3 should have rejoined without a view change, the others sent %d view change messages", viewChanges)
+	}
+	for _, r := range net.replicas {
+		if r.pbft.view != net.replicas[0].pbft.view || !r.pbft.activeView {
+			t.Errorf("Replica %d should be active in view %d, is in view %d (active=%v)", r.id, net.replicas[0].pbft.view, r.pbft.view, r.pbft.activeView)
+		}
+	}
+}
@@ -0,0 +1,743 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package pbft
+
+import (
+	"fmt"
+	"google/protobuf"
+	"sort"
+	"time"
+
+	"github.com/hyperledger/fabric/consensus"
+	"github.com/hyperledger/fabric/consensus/util/events"
+	"github.com/hyperledger/fabric/events/producer"
+	pb "github.com/hyperledger/fabric/protos"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/spf13/viper"
+)
+
+// obcSieve executes request batches before ordering them.  The primary asks
+// every replica to execute a batch, the replicas return a signed hash of the
+// outputs, and the primary orders the verifies it collected through pbft.
+// Every replica derives the same decision from the ordered verifies: the
+// batch commits if enough replicas agree on its outputs for one of them to
+// be correct, and is aborted otherwise.  The transactions of an aborted
+// batch are executed one at a time, so only those with non-deterministic
+// outputs are filtered out.
+type obcSieve struct {
+	obcGeneric
+	externalEventReceiver
+	pbft        *pbftCore
+	broadcaster *broadcaster
+
+	batchSize        int
+	batchTimer       events.Timer
+	batchTimerActive bool
+	batchTimeout     time.Duration
+
+	manager events.Manager
+
+	reqStore *requestStore   // Holds the outstanding requests, and those of the primary's execution round as pending
+	txIDs    *txIDCache      // Recently committed transaction IDs, used to drop client retries
+	isolated map[string]bool // Requests of an aborted batch, by digest, each is executed on its own
+	round    *sieveRound     // Execution the primary collects verifies for, if any
+	exec     *sieveExecution // Request batch executed by this replica and awaiting its decision, if any
+	deferred *SieveExecute   // Execution requested before this replica could start it, if any
+	idleChan chan struct{}   // Idle channel, to be removed
+
+	persistForward
+}
+
+// sieveRound is the execution of a request batch as seen by the primary
+type sieveRound struct {
+	execute  *SieveExecute
+	digest   string
+	verifies map[uint64]*SieveVerify
+	decided  bool // the verifies were submitted for ordering
+}
+
+// sieveExecution is a request batch executed by this replica, its effects
+// remain uncommitted until the decision for the batch is executed
+type sieveExecution struct {
+	blockNumber uint64
+	digest      string
+	result      string
+}
+
+func newObcSieve(id uint64, config *viper.Viper, stack consensus.Stack) *obcSieve {
+	var err error
+
+	op := &obcSieve{
+		obcGeneric: obcGeneric{stack: stack},
+	}
+
+	op.persistForward.persistor = stack
+
+	op.manager = events.NewManagerImpl()
+	op.manager.SetReceiver(op)
+	etf := events.NewTimerFactoryImpl(op.manager)
+	op.pbft = newPbftCore(id, config, op, etf)
+	op.manager.Start()
+	op.externalEventReceiver.manager = op.manager
+	op.broadcaster = newBroadcaster(id, op.pbft.N, op.pbft.f, stack)
+
+	op.batchSize = config.GetInt("general.batchsize")
+	op.batchTimeout, err = time.ParseDuration(config.GetString("general.timeout.batch"))
+	if err != nil {
+		panic(fmt.Errorf("Cannot parse batch timeout: %s", err))
+	}
+	logger.Infof("PBFT Sieve batch size = %d", op.batchSize)
+	logger.Infof("PBFT Sieve batch timeout = %v", op.batchTimeout)
+
+	if op.batchTimeout >= op.pbft.requestTimeout {
+		op.pbft.requestTimeout = 3 * op.batchTimeout / 2
+		logger.Warningf("Configured request timeout must be greater than batch timeout, setting to %v", op.pbft.requestTimeout)
+	}
+
+	op.batchTimer = etf.CreateTimer()
+
+	op.reqStore = newRequestStore(op.requestClient)
+	op.txIDs = newTxIDCache(config.GetInt("general.txidcachesize"))
+	op.isolated = make(map[string]bool)
+
+	op.idleChan = make(chan struct{})
+	close(op.idleChan) // TODO remove eventually
+
+	return op
+}
+
+// Close tells us to release resources we are holding
+func (op *obcSieve) Close() {
+	op.batchTimer.Halt()
+	op.pbft.close()
+}
+
+// Health reports the replica unhealthy while it changes views or transfers
+// state, or if its main thread is stuck
+func (op *obcSieve) Health() consensus.Health {
+	var health consensus.Health
+	if !events.OnMainThread(op.manager, func() { health = op.pbft.replicaHealth() }) {
+		return consensus.Health{Detail: fmt.Sprintf("main thread unresponsive for %v", events.MainThreadTimeout)}
+	}
+	return health
+}
+
+// Metrics reports the progress of the replica and the requests it holds
+func (op *obcSieve) Metrics() consensus.Metrics {
+	var metrics consensus.Metrics
+	events.OnMainThread(op.manager, func() {
+		instance := op.pbft
+		metrics = consensus.Metrics{
+			"pbft.view":                float64(instance.view),
+			"pbft.seqNo":               float64(instance.seqNo),
+			"pbft.lastExec":            float64(instance.lastExec),
+			"pbft.h":                   float64(instance.h),
+			"pbft.outstandingRequests": float64(op.reqStore.outstandingRequests.Len()),
+			"pbft.isolatedRequests":    float64(len(op.isolated)),
+		}
+	})
+	return metrics
+}
+
+// =============================================================================
+// innerStack interface (functions called by pbft-core)
+// =============================================================================
+
+// multicast a message to all replicas
+func (op *obcSieve) broadcast(msgPayload []byte) {
+	op.broadcastMsg(&SieveMessage{Payload: &SieveMessage_PbftMessage{PbftMessage: msgPayload}})
+}
+
+// send a message to a specific replica
+func (op *obcSieve) unicast(msgPayload []byte, receiverID uint64) (err error) {
+	return op.unicastMsg(&SieveMessage{Payload: &SieveMessage_PbftMessage{PbftMessage: msgPayload}}, receiverID)
+}
+
+func (op *obcSieve) sign(msg []byte) ([]byte, error) {
+	return op.stack.Sign(msg)
+}
+
+// verify message signature
+func (op *obcSieve) verify(senderID uint64, signature []byte, message []byte) error {
+	senderHandle, err := getValidatorHandle(senderID)
+	if err != nil {
+		return err
+	}
+	return op.stack.Verify(senderHandle, signature, message)
+}
+
+// execute is called by pbft-core once the decisions for a request batch
+// are ordered, every decision carries the verifies of one execution
+func (op *obcSieve) execute(seqNo uint64, reqBatch *RequestBatch) {
+	meta, _ := proto.Marshal(&Metadata{seqNo})
+	for _, req := range reqBatch.GetBatch() {
+		decision := &SieveDecision{}
+		if err := proto.Unmarshal(req.Payload, decision); err != nil {
+			logger.Warningf("Sieve replica %d could not unmarshal decision at seqNo=%d: %s", op.pbft.id, seqNo, err)
+			continue
+		}
+		if !op.applyDecision(decision, meta) {
+			break
+		}
+	}
+	op.manager.Inject(execDoneEvent{})
+}
+
+// skipTo rolls back the execution awaiting its decision, the stack cannot
+// transfer state while it holds uncommitted transactions
+func (op *obcSieve) skipTo(seqNo uint64, id []byte, replicas []uint64) {
+	op.rollback()
+	op.obcGeneric.skipTo(seqNo, id, replicas)
+}
+
+// =============================================================================
+// functions specific to sieve mode
+// =============================================================================
+
+func (op *obcSieve) broadcastMsg(msg *SieveMessage) {
+	msgPayload, _ := proto.Marshal(msg)
+	op.broadcaster.Broadcast(&pb.Message{Type: pb.Message_CONSENSUS, Payload: msgPayload})
+}
+
+func (op *obcSieve) unicastMsg(msg *SieveMessage, receiverID uint64) error {
+	msgPayload, _ := proto.Marshal(msg)
+	return op.broadcaster.Unicast(&pb.Message{Type: pb.Message_CONSENSUS, Payload: msgPayload}, receiverID)
+}
+
+func (op *obcSieve) txToReq(tx []byte) *Request {
+	now := time.Now()
+	return &Request{
+		Timestamp: &google_protobuf.Timestamp{
+			Seconds: now.Unix(),
+			Nanos:   int32(now.UnixNano() % 1000000000),
+		},
+		Payload:   tx,
+		ReplicaId: op.pbft.id,
+	}
+}
+
+// isOrderedTx returns whether the transaction carried by the request was recently committed
+func (op *obcSieve) isOrderedTx(req *Request) bool {
+	txID, err := getTxID(req)
+	if err != nil {
+		return false
+	}
+	return op.txIDs.has(txID)
+}
+
+func (op *obcSieve) processMessage(ocMsg *pb.Message, senderHandle *pb.PeerID) events.Event {
+	if ocMsg.Type == pb.Message_CHAIN_TRANSACTION {
+		req := op.txToReq(ocMsg.Payload)
+		if op.isOrderedTx(req) {
+			logger.Warningf("Sieve replica %d ignoring transaction resubmission as it was already committed", op.pbft.id)
+			return nil
+		}
+		// Every replica learns of the request, in case the primary ignores it
+		op.broadcastMsg(&SieveMessage{Payload: &SieveMessage_Request{Request: req}})
+		return op.recvRequest(req)
+	}
+
+	if ocMsg.Type != pb.Message_CONSENSUS {
+		logger.Errorf("Unexpected message type: %s", ocMsg.Type)
+		return nil
+	}
+
+	senderID, err := getValidatorID(senderHandle)
+	if err != nil {
+		panic("Cannot map sender's PeerID to a valid replica ID")
+	}
+
+	msg := &SieveMessage{}
+	if err := proto.Unmarshal(ocMsg.Payload, msg); err != nil {
+		logger.Errorf("Error unmarshaling message from replica %d: %s", senderID, err)
+		return nil
+	}
+
+	switch payload := msg.Payload.(type) {
+	case *SieveMessage_Request:
+		return op.recvRequest(payload.Request)
+	case *SieveMessage_Execute:
+		return op.recvExecute(payload.Execute, senderID)
+	case *SieveMessage_Verify:
+		return op.recvVerify(payload.Verify, senderID)
+	case *SieveMessage_PbftMessage:
+		pbftMsg := &Message{}
+		if err := proto.Unmarshal(payload.PbftMessage, pbftMsg); err != nil {
+			logger.Errorf("Error unpacking payload from message: %s", err)
+			return nil
+		}
+		return pbftMessageEvent{
+			msg:    pbftMsg,
+			sender: senderID,
+		}
+	}
+
+	logger.Errorf("Unknown sieve message from replica %d: %+v", senderID, msg)
+	return nil
+}
+
+func (op *obcSieve) recvRequest(req *Request) events.Event {
+	if op.isOrderedTx(req) {
+		logger.Debugf("Sieve replica %d ignoring request as its transaction was already committed", op.pbft.id)
+		return nil
+	}
+	op.reqStore.storeOutstanding(req)
+	op.startTimerIfOutstandingRequests()
+	return op.maybeStartRound(false)
+}
+
+// maybeStartRound has the primary ask the replicas to execute the next
+// request batch, once it holds enough requests or force is set.  Only one
+// execution is in flight at a time, as each builds on the committed state.
+func (op *obcSieve) maybeStartRound(force bool) events.Event {
+	if op.pbft.primary(op.pbft.view) != op.pbft.id || !op.pbft.activeView || op.pbft.skipInProgress ||
+		op.pbft.currentExec != nil || op.round != nil || op.exec != nil {
+		return nil
+	}
+
+	var batch []*Request
+	for _, req := range op.reqStore.getNextNonPending(op.batchSize) {
+		if op.isOrderedTx(req) {
+			op.reqStore.remove(req)
+			continue
+		}
+		if op.isolated[hash(req)] {
+			if len(batch) == 0 {
+				batch = append(batch, req)
+			}
+			break
+		}
+		batch = append(batch, req)
+	}
+
+	if len(batch) == 0 {
+		if op.batchTimerActive {
+			op.stopBatchTimer()
+		}
+		return nil
+	}
+	if len(batch) < op.batchSize && !force && !op.isolated[hash(batch[0])] {
+		if !op.batchTimerActive {
+			op.startBatchTimer()
+		}
+		return nil
+	}
+	if op.batchTimerActive {
+		op.stopBatchTimer()
+	}
+
+	op.reqStore.storePendings(batch)
+	execute := &SieveExecute{
+		View:         op.pbft.view,
+		BlockNumber:  op.stack.GetBlockchainSize(),
+		RequestBatch: &RequestBatch{Batch: batch},
+	}
+	op.round = &sieveRound{
+		execute:  execute,
+		digest:   hash(execute.RequestBatch),
+		verifies: make(map[uint64]*SieveVerify),
+	}
+	logger.Infof("Sieve primary %d requesting execution of %d requests for block %d", op.pbft.id, len(batch), execute.BlockNumber)
+	op.broadcastMsg(&SieveMessage{Payload: &SieveMessage_Execute{Execute: execute}})
+	return op.recvExecute(execute, op.pbft.id)
+}
+
+// recvExecute executes the request batch on behalf of the primary, and
+// returns the hash of the outputs to it
+func (op *obcSieve) recvExecute(execute *SieveExecute, senderID uint64) events.Event {
+	if senderID != op.pbft.primary(op.pbft.view) || execute.View != op.pbft.view || !op.pbft.activeView {
+		logger.Warningf("Sieve replica %d ignoring execution request from replica %d for view %d, it is in view %d", op.pbft.id, senderID, execute.View, op.pbft.view)
+		return nil
+	}
+	if op.pbft.skipInProgress {
+		logger.Debugf("Sieve replica %d ignoring execution request while it is out of date", op.pbft.id)
+		return nil
+	}
+
+	height := op.stack.GetBlockchainSize()
+	if execute.BlockNumber < height {
+		logger.Debugf("Sieve replica %d ignoring execution request for block %d, it is at height %d", op.pbft.id, execute.BlockNumber, height)
+		return nil
+	}
+	if execute.BlockNumber > height || op.exec != nil || op.pbft.currentExec != nil {
+		// The decisions before this execution are yet to be applied
+		logger.Debugf("Sieve replica %d deferring execution request for block %d", op.pbft.id, execute.BlockNumber)
+		op.deferred = execute
+		return nil
+	}
+
+	for _, req := range execute.RequestBatch.GetBatch() {
+		op.reqStore.storeOutstanding(req)
+	}
+	if !op.executeBatch(execute.BlockNumber, execute.RequestBatch) {
+		return nil
+	}
+
+	verify := &SieveVerify{
+		View:         execute.View,
+		BlockNumber:  execute.BlockNumber,
+		BatchDigest:  op.exec.digest,
+		ResultDigest: op.exec.result,
+		ReplicaId:    op.pbft.id,
+	}
+	if err := op.pbft.sign(verify); err != nil {
+		logger.Errorf("Sieve replica %d could not sign verify for block %d: %s", op.pbft.id, execute.BlockNumber, err)
+		return nil
+	}
+	if senderID == op.pbft.id {
+		return op.recvVerify(verify, op.pbft.id)
+	}
+	if err := op.unicastMsg(&SieveMessage{Payload: &SieveMessage_Verify{Verify: verify}}, senderID); err != nil {
+		logger.Warningf("Sieve replica %d could not send verify to primary %d: %s", op.pbft.id, senderID, err)
+	}
+	return nil
+}
+
+// recvVerify collects the verifies for the primary's execution, and orders
+// them once every correct replica may have contributed
+func (op *obcSieve) recvVerify(verify *SieveVerify, senderID uint64) events.Event {
+	round := op.round
+	if round == nil || round.decided || verify.View != round.execute.View ||
+		verify.BlockNumber != round.execute.BlockNumber || verify.BatchDigest != round.digest {
+		logger.Debugf("Sieve replica %d ignoring verify from replica %d for block %d", op.pbft.id, senderID, verify.BlockNumber)
+		return nil
+	}
+	if verify.ReplicaId != senderID {
+		logger.Warningf("Sieve primary %d received verify from replica %d on behalf of replica %d", op.pbft.id, senderID, verify.ReplicaId)
+		return nil
+	}
+	if _, ok := round.verifies[senderID]; ok {
+		return nil
+	}
+	if err := op.pbft.verify(verify); err != nil {
+		logger.Warningf("Sieve primary %d received verify from replica %d with an incorrect signature: %s", op.pbft.id, senderID, err)
+		return nil
+	}
+	round.verifies[senderID] = verify
+
+	voters := make(map[uint64]bool)
+	for id := range round.verifies {
+		voters[id] = true
+	}
+	if op.pbft.weightOf(voters) < op.pbft.allCorrectReplicasQuorum() {
+		return nil
+	}
+
+	decision := &SieveDecision{
+		BlockNumber:  round.execute.BlockNumber,
+		RequestBatch: round.execute.RequestBatch,
+	}
+	for _, v := range round.verifies {
+		decision.Verifies = append(decision.Verifies, v)
+	}
+	sort.Sort(sortableVerifies(decision.Verifies))
+	round.decided = true
+
+	logger.Infof("Sieve primary %d ordering decision for block %d with %d verifies", op.pbft.id, decision.BlockNumber, len(decision.Verifies))
+	payload, _ := proto.Marshal(decision)
+	return &RequestBatch{Batch: []*Request{op.txToReq(payload)}}
+}
+
+// outcome derives the result digest a decision commits from its verifies,
+// it is empty if the batch is aborted and ok is false if the verifies do
+// not form a valid decision
+func (op *obcSieve) outcome(decision *SieveDecision, digest string) (result string, ok bool) {
+	voters := make(map[uint64]bool)
+	votes := make(map[string]map[uint64]bool)
+	for _, verify := range decision.Verifies {
+		if verify.ReplicaId >= uint64(op.pbft.replicaCount) || voters[verify.ReplicaId] ||
+			verify.BlockNumber != decision.BlockNumber || verify.BatchDigest != digest {
+			return "", false
+		}
+		if err := op.pbft.verify(verify); err != nil {
+			return "", false
+		}
+		voters[verify.ReplicaId] = true
+		if votes[verify.ResultDigest] == nil {
+			votes[verify.ResultDigest] = make(map[uint64]bool)
+		}
+		votes[verify.ResultDigest][verify.ReplicaId] = true
+	}
+	if op.pbft.weightOf(voters) < op.pbft.allCorrectReplicasQuorum() {
+		return "", false
+	}
+
+	for candidate, replicas := range votes {
+		if op.pbft.weightOf(replicas) < op.pbft.weakQuorum() {
+			continue
+		}
+		if result != "" {
+			// each of the outputs may come from a correct replica
+			return "", true
+		}
+		result = candidate
+	}
+	return result, true
+}
+
+// applyDecision commits or aborts the request batch of a decision, and
+// returns false if this replica diverged and must transfer state
+func (op *obcSieve) applyDecision(decision *SieveDecision, meta []byte) bool {
+	digest := hash(decision.RequestBatch)
+	if op.round != nil && op.round.digest == digest && op.round.execute.BlockNumber == decision.BlockNumber {
+		op.round = nil
+	}
+
+	height := op.stack.GetBlockchainSize()
+	if decision.BlockNumber != height {
+		logger.Warningf("Sieve replica %d ignoring decision for block %d, it is at height %d", op.pbft.id, decision.BlockNumber, height)
+		return true
+	}
+
+	result, ok := op.outcome(decision, digest)
+	if !ok {
+		logger.Warningf("Sieve replica %d ignoring decision for block %d with invalid verifies", op.pbft.id, decision.BlockNumber)
+		return true
+	}
+
+	if result == "" {
+		op.rollback()
+		op.abort(decision.RequestBatch)
+		return true
+	}
+
+	if op.exec == nil || op.exec.blockNumber != height || op.exec.digest != digest {
+		// this replica did not execute the batch yet
+		op.rollback()
+		op.executeBatch(height, decision.RequestBatch)
+	}
+	op.decided(decision.RequestBatch)
+
+	if op.exec == nil || op.exec.result != result {
+		logger.Warningf("Sieve replica %d diverged from the decision for block %d, transferring state", op.pbft.id, decision.BlockNumber)
+		op.rollback()
+		op.pbft.stateTransfer(nil)
+		return false
+	}
+
+	logger.Infof("Sieve replica %d committing block %d with %d requests", op.pbft.id, decision.BlockNumber, len(decision.RequestBatch.GetBatch()))
+	if _, err := op.stack.CommitTxBatch(op.exec.digest, meta); err != nil {
+		logger.Errorf("Sieve replica %d could not commit block %d: %s", op.pbft.id, decision.BlockNumber, err)
+		op.rollback()
+		op.pbft.stateTransfer(nil)
+		return false
+	}
+	op.exec = nil
+	return true
+}
+
+// abort drops a request batch whose outputs could not be agreed upon.  A
+// batch of several requests is executed again one request at a time, a
+// single request is non-deterministic and rejected.
+func (op *obcSieve) abort(reqBatch *RequestBatch) {
+	batch := reqBatch.GetBatch()
+	if len(batch) > 1 {
+		logger.Warningf("Sieve replica %d found the outputs of %d requests diverge, executing them one at a time", op.pbft.id, len(batch))
+		for _, req := range batch {
+			op.isolated[hash(req)] = true
+		}
+		op.reqStore.pendingRequests.removes(batch)
+		return
+	}
+
+	op.decided(reqBatch)
+	for _, req := range batch {
+		tx := &pb.Transaction{}
+		if err := proto.Unmarshal(req.Payload, tx); err != nil {
+			continue
+		}
+		logger.Warningf("Sieve replica %d dropping transaction %s as its outputs diverge", op.pbft.id, tx.Uuid)
+		if req.ReplicaId == op.pbft.id {
+			// the replica which received the request from the client notifies it
+			producer.Send(producer.CreateRejectionEvent(tx, "Transaction outputs are not deterministic"))
+		}
+	}
+}
+
+// decided forgets the requests of a batch which was decided upon
+func (op *obcSieve) decided(reqBatch *RequestBatch) {
+	for _, req := range reqBatch.GetBatch() {
+		op.reqStore.remove(req)
+		delete(op.isolated, hash(req))
+		if txID, err := getTxID(req); err == nil {
+			op.txIDs.add(txID)
+		}
+	}
+}
+
+// executeBatch executes a request batch without committing it, and
+// returns whether it could
+func (op *obcSieve) executeBatch(blockNumber uint64, reqBatch *RequestBatch) bool {
+	digest := hash(reqBatch)
+	var txs []*pb.Transaction
+	for _, req := range reqBatch.GetBatch() {
+		tx := &pb.Transaction{}
+		if err := proto.Unmarshal(req.Payload, tx); err != nil {
+			logger.Warningf("Sieve replica %d could not unmarshal transaction %s", op.pbft.id, err)
+			continue
+		}
+		txs = append(txs, tx)
+	}
+
+	if err := op.stack.BeginTxBatch(digest); err != nil {
+		logger.Errorf("Sieve replica %d could not begin executing block %d: %s", op.pbft.id, blockNumber, err)
+		return false
+	}
+	stateHash, results, err := op.stack.ExecTxs(digest, txs)
+	if err != nil {
+		logger.Errorf("Sieve replica %d could not execute block %d: %s", op.pbft.id, blockNumber, err)
+		op.stack.RollbackTxBatch(digest)
+		return false
+	}
+
+	op.exec = &sieveExecution{
+		blockNumber: blockNumber,
+		digest:      digest,
+		result:      resultDigest(stateHash, results),
+	}
+	logger.Debugf("Sieve replica %d executed %d transactions for block %d with result %s", op.pbft.id, len(txs), blockNumber, op.exec.result)
+	return true
+}
+
+// rollback discards the execution awaiting its decision, if any
+func (op *obcSieve) rollback() {
+	if op.exec == nil {
+		return
+	}
+	if err := op.stack.RollbackTxBatch(op.exec.digest); err != nil {
+		logger.Errorf("Sieve replica %d could not roll back block %d: %s", op.pbft.id, op.exec.blockNumber, err)
+	}
+	op.exec = nil
+}
+
+// resultDigest hashes the outputs of an execution, the state along with
+// the results of the individual transactions
+func resultDigest(stateHash []byte, results []*pb.TransactionResult) string {
+	raw, _ := proto.Marshal(&pb.NonHashData{TransactionResults: results})
+	return hash(append(append([]byte(nil), stateHash...), raw...))
+}
+
+// ProcessEvent handles the sieve events, and passes the others on to pbft
+func (op *obcSieve) ProcessEvent(event events.Event) events.Event {
+	logger.Debugf("Replica %d sieve main thread looping", op.pbft.id)
+	switch et := event.(type) {
+	case batchMessageEvent:
+		return op.processMessage(et.msg, et.sender)
+	case execDoneEvent:
+		if res := op.pbft.ProcessEvent(event); res != nil {
+			// This may trigger a view change, if so, process it, we will resume on new view
+			return res
+		}
+		if execute := op.deferred; execute != nil {
+			op.deferred = nil
+			if res := op.recvExecute(execute, op.pbft.primary(op.pbft.view)); res != nil {
+				return res
+			}
+		}
+		op.startTimerIfOutstandingRequests()
+		return op.maybeStartRound(false)
+	case batchTimerEvent:
+		logger.Infof("Replica %d batch timer expired", op.pbft.id)
+		op.batchTimerActive = false
+		return op.maybeStartRound(true)
+	case viewChangedEvent:
+		// The execution of the previous primary is abandoned, the decisions
+		// it ordered are applied even if this replica rolls back
+		op.round = nil
+		op.deferred = nil
+		op.rollback()
+		op.pbft.outstandingReqBatches = make(map[string]*RequestBatch)
+		if op.batchTimerActive {
+			op.stopBatchTimer()
+		}
+
+		op.reqStore.pendingRequests.empty()
+		for i := op.pbft.h + 1; i <= op.pbft.h+op.pbft.L; i++ {
+			if i <= op.pbft.lastExec {
+				continue
+			}
+			cert, ok := op.pbft.certStore[msgID{v: op.pbft.view, n: i}]
+			if !ok || cert.prePrepare == nil || cert.prePrepare.RequestBatch == nil {
+				continue
+			}
+			reqBatch, _ := op.pbft.resolvePayloads(cert.prePrepare.RequestBatch)
+			for _, req := range reqBatch.GetBatch() {
+				decision := &SieveDecision{}
+				if err := proto.Unmarshal(req.Payload, decision); err == nil {
+					op.reqStore.storePendings(decision.RequestBatch.GetBatch())
+				}
+			}
+		}
+
+		return op.maybeStartRound(false)
+	case stateUpdatedEvent:
+		// When the state is updated, clear any outstanding requests, they may have been processed while we were gone
+		op.round = nil
+		op.deferred = nil
+		op.reqStore = newRequestStore(op.requestClient)
+		return op.pbft.ProcessEvent(event)
+	default:
+		return op.pbft.ProcessEvent(event)
+	}
+}
+
+func (op *obcSieve) startBatchTimer() {
+	op.batchTimer.Reset(op.batchTimeout, batchTimerEvent{})
+	logger.Debugf("Replica %d started the batch timer", op.pbft.id)
+	op.batchTimerActive = true
+}
+
+func (op *obcSieve) stopBatchTimer() {
+	op.batchTimer.Stop()
+	logger.Debugf("Replica %d stopped the batch timer", op.pbft.id)
+	op.batchTimerActive = false
+}
+
+func (op *obcSieve) startTimerIfOutstandingRequests() {
+	if op.pbft.skipInProgress || op.pbft.currentExec != nil || !op.pbft.activeView {
+		return
+	}
+	if op.reqStore.outstandingRequests.Len() == 0 {
+		return
+	}
+	op.pbft.softStartTimer(op.pbft.requestTimeout, "Sieve outstanding requests")
+}
+
+// Retrieve the idle channel, only used for testing
+func (op *obcSieve) idleChannel() <-chan struct{} {
+	return op.idleChan
+}
+
+// TODO, temporary
+func (op *obcSieve) getManager() events.Manager {
+	return op.manager
+}
+
+type sortableVerifies []*SieveVerify
+
+func (a sortableVerifies) Len() int {
+	return len(a)
+}
+
+func (a sortableVerifies) Swap(i, j int) {
+	a[i], a[j] = a[j], a[i]
+}
+
+func (a sortableVerifies) Less(i, j int) bool {
+	return a[i].ReplicaId < a[j].ReplicaId
+}
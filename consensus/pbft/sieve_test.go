@@ -0,0 +1,143 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package pbft
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/hyperledger/fabric/consensus"
+	pb "github.com/hyperledger/fabric/protos"
+
+	"github.com/spf13/viper"
+)
+
+func (op *obcSieve) getPBFTCore() *pbftCore {
+	return op.pbft
+}
+
+func obcSieveHelper(id uint64, config *viper.Viper, stack consensus.Stack) pbftConsumer {
+	return newObcSieve(id, config, stack)
+}
+
+func TestNetworkSieve(t *testing.T) {
+	batchSize := 2
+	validatorCount := 4
+	net := makeConsumerNetwork(validatorCount, obcSieveHelper, func(ce *consumerEndpoint) {
+		ce.consumer.(*obcSieve).batchSize = batchSize
+	})
+	defer net.stop()
+
+	broadcaster := net.endpoints[generateBroadcaster(validatorCount)].getHandle()
+	net.endpoints[1].(*consumerEndpoint).consumer.RecvMsg(createTxMsg(1), broadcaster)
+	net.endpoints[2].(*consumerEndpoint).consumer.RecvMsg(createTxMsg(2), broadcaster)
+
+	net.process()
+
+	for _, ep := range net.endpoints {
+		ce := ep.(*consumerEndpoint)
+		block, err := ce.consumer.(*obcSieve).stack.GetBlock(1)
+		if err != nil {
+			t.Fatalf("Replica %d executed requests, expected a new block on the chain, but could not retrieve it : %s", ce.id, err)
+		}
+		if numTrans := len(block.Transactions); numTrans != batchSize {
+			t.Fatalf("Replica %d committed %d requests, expected %d", ce.id, numTrans, batchSize)
+		}
+		if l := ce.consumer.(*obcSieve).reqStore.outstandingRequests.Len(); l != 0 {
+			t.Errorf("Replica %d has %d requests outstanding, expected none", ce.id, l)
+		}
+	}
+}
+
+func TestSieveFiltersNonDeterministicTransactions(t *testing.T) {
+	validatorCount := 4
+	net := makeConsumerNetwork(validatorCount, obcSieveHelper, func(ce *consumerEndpoint) {
+		ce.consumer.(*obcSieve).batchSize = 2
+		ce.execTxResult = func(txs []*pb.Transaction) ([]byte, error) {
+			var result []byte
+			for _, tx := range txs {
+				result = append(result, tx.Payload...)
+				if string(tx.Payload) == "2" {
+					// every replica computes a different output
+					result = append(result, fmt.Sprintf("@%d", ce.id)...)
+				}
+			}
+			return result, nil
+		}
+	})
+	defer net.stop()
+
+	broadcaster := net.endpoints[generateBroadcaster(validatorCount)].getHandle()
+	net.endpoints[1].(*consumerEndpoint).consumer.RecvMsg(createTxMsg(1), broadcaster)
+	net.endpoints[2].(*consumerEndpoint).consumer.RecvMsg(createTxMsg(2), broadcaster)
+
+	net.process()
+
+	for _, ep := range net.endpoints {
+		ce := ep.(*consumerEndpoint)
+		op := ce.consumer.(*obcSieve)
+		if height := op.stack.GetBlockchainSize(); height != 2 {
+			t.Fatalf("Replica %d is at height %d, expected only the deterministic transaction to commit", ce.id, height)
+		}
+		block, _ := op.stack.GetBlock(1)
+		if len(block.Transactions) != 1 || string(block.Transactions[0].Payload) != "1" {
+			t.Fatalf("Replica %d committed %v, expected only the deterministic transaction", ce.id, block.Transactions)
+		}
+		if l := op.reqStore.outstandingRequests.Len(); l != 0 {
+			t.Errorf("Replica %d has %d requests outstanding, expected the non-deterministic one to be dropped", ce.id, l)
+		}
+		if l := len(op.isolated); l != 0 {
+			t.Errorf("Replica %d still isolates %d requests", ce.id, l)
+		}
+	}
+}
+
+func TestSieveOutcome(t *testing.T) {
+	op := newObcSieve(0, loadConfig(), &omniProto{
+		VerifyImpl: func(peerID *pb.PeerID, signature []byte, message []byte) error { return nil },
+	})
+	defer op.Close()
+
+	reqBatch := &RequestBatch{Batch: []*Request{createPbftReq(1, 0)}}
+	digest := hash(reqBatch)
+	decision := func(results ...string) *SieveDecision {
+		d := &SieveDecision{BlockNumber: 1, RequestBatch: reqBatch}
+		for i, result := range results {
+			d.Verifies = append(d.Verifies, &SieveVerify{BlockNumber: 1, BatchDigest: digest, ResultDigest: result, ReplicaId: uint64(i)})
+		}
+		return d
+	}
+
+	if result, ok := op.outcome(decision("a", "a", "b"), digest); !ok || result != "a" {
+		t.Errorf("Expected the batch to commit with result a, got %q (valid %v)", result, ok)
+	}
+	if result, ok := op.outcome(decision("a", "b", "c"), digest); !ok || result != "" {
+		t.Errorf("Expected the batch to abort, got %q (valid %v)", result, ok)
+	}
+	if result, ok := op.outcome(decision("a", "a", "b", "b"), digest); !ok || result != "" {
+		t.Errorf("Expected the batch to abort as two results are backed by a correct replica, got %q (valid %v)", result, ok)
+	}
+	if _, ok := op.outcome(decision("a", "a"), digest); ok {
+		t.Errorf("Expected a decision with too few verifies to be invalid")
+	}
+
+	duplicate := decision("a", "a", "a")
+	duplicate.Verifies[2].ReplicaId = 1
+	if _, ok := op.outcome(duplicate, digest); ok {
+		t.Errorf("Expected a decision counting a replica twice to be invalid")
+	}
+}
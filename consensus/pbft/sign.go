@@ -42,6 +42,10 @@ func (instance *pbftCore) sign(s signable) error {
 }
 
 func (instance *pbftCore) verify(s signable) error {
+	return verifySignable(s, instance.consumer.verify)
+}
+
+func verifySignable(s signable, verify func(senderID uint64, signature []byte, message []byte) error) error {
 	origSig := s.getSignature()
 	s.setSignature(nil)
 	raw, err := s.serialize()
@@ -49,7 +53,7 @@ func (instance *pbftCore) verify(s signable) error {
 	if err != nil {
 		return err
 	}
-	return instance.consumer.verify(s.getID(), origSig, raw)
+	return verify(s.getID(), origSig, raw)
 }
 
 func (vc *ViewChange) getSignature() []byte {
@@ -71,3 +75,63 @@ func (vc *ViewChange) setID(id uint64) {
 func (vc *ViewChange) serialize() ([]byte, error) {
 	return pb.Marshal(vc)
 }
+
+func (prep *Prepare) getSignature() []byte {
+	return prep.Signature
+}
+
+func (prep *Prepare) setSignature(sig []byte) {
+	prep.Signature = sig
+}
+
+func (prep *Prepare) getID() uint64 {
+	return prep.ReplicaId
+}
+
+func (prep *Prepare) setID(id uint64) {
+	prep.ReplicaId = id
+}
+
+func (prep *Prepare) serialize() ([]byte, error) {
+	return pb.Marshal(prep)
+}
+
+func (relay *Relay) getSignature() []byte {
+	return relay.Signature
+}
+
+func (relay *Relay) setSignature(sig []byte) {
+	relay.Signature = sig
+}
+
+func (relay *Relay) getID() uint64 {
+	return relay.ReplicaId
+}
+
+func (relay *Relay) setID(id uint64) {
+	relay.ReplicaId = id
+}
+
+func (relay *Relay) serialize() ([]byte, error) {
+	return pb.Marshal(relay)
+}
+
+func (verify *SieveVerify) getSignature() []byte {
+	return verify.Signature
+}
+
+func (verify *SieveVerify) setSignature(sig []byte) {
+	verify.Signature = sig
+}
+
+func (verify *SieveVerify) getID() uint64 {
+	return verify.ReplicaId
+}
+
+func (verify *SieveVerify) setID(id uint64) {
+	verify.ReplicaId = id
+}
+
+func (verify *SieveVerify) serialize() ([]byte, error) {
+	return pb.Marshal(verify)
+}
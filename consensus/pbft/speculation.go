@@ -0,0 +1,86 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package pbft
+
+// speculativeExecutor may be implemented by an innerStack which can execute
+// a request batch before it commits, so that execution overlaps with the
+// commit round.  A speculation is always followed by exactly one call to
+// promoteSpeculation, after which the stack continues as for execute, or to
+// discardSpeculation, after which the stack must roll back its effects.
+type speculativeExecutor interface {
+	executeSpeculatively(seqNo uint64, reqBatch *RequestBatch)
+	promoteSpeculation(seqNo uint64)
+	discardSpeculation(seqNo uint64)
+}
+
+// maybeSpeculate starts executing the next request batch as soon as it is
+// prepared, if nothing is being executed yet
+func (instance *pbftCore) maybeSpeculate() {
+	spec, ok := instance.consumer.(speculativeExecutor)
+	if !ok || !instance.speculative || instance.currentExec != nil || instance.specDigest != "" || instance.skipInProgress || !instance.activeView {
+		return
+	}
+
+	idx := msgID{v: instance.view, n: instance.lastExec + 1}
+	cert, ok := instance.certStore[idx]
+	if !ok || cert.digest == "" || !instance.prepared(cert.digest, idx.v, idx.n) || instance.committed(cert.digest, idx.v, idx.n) {
+		return
+	}
+	reqBatch, ok := instance.reqBatchStore[cert.digest]
+	if !ok {
+		return
+	}
+	reqBatch, missing := instance.resolvePayloads(reqBatch)
+	if len(missing) > 0 {
+		return
+	}
+
+	logger.Debugf("Replica %d speculatively executing request batch for view=%d/seqNo=%d and digest %s",
+		instance.id, idx.v, idx.n, cert.digest)
+	instance.specSeqNo = idx.n
+	instance.specDigest = cert.digest
+	spec.executeSpeculatively(idx.n, reqBatch)
+}
+
+// promoteSpeculation turns the speculative execution of a committed request
+// batch into its actual execution, and returns whether it could
+func (instance *pbftCore) promoteSpeculation(seqNo uint64, digest string) bool {
+	if instance.specDigest == "" {
+		return false
+	}
+	if instance.specSeqNo != seqNo || instance.specDigest != digest {
+		instance.discardSpeculation()
+		return false
+	}
+
+	logger.Debugf("Replica %d promoting speculative execution of seqNo=%d", instance.id, seqNo)
+	instance.specDigest = ""
+	instance.consumer.(speculativeExecutor).promoteSpeculation(seqNo)
+	return true
+}
+
+// discardSpeculation abandons the speculative execution in progress, if any
+func (instance *pbftCore) discardSpeculation() {
+	if instance.specDigest == "" {
+		return
+	}
+
+	logger.Infof("Replica %d discarding speculative execution of seqNo=%d with digest %s",
+		instance.id, instance.specSeqNo, instance.specDigest)
+	instance.specDigest = ""
+	instance.consumer.(speculativeExecutor).discardSpeculation(instance.specSeqNo)
+}
@@ -0,0 +1,84 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package pbft
+
+import (
+	"container/list"
+
+	pb "github.com/hyperledger/fabric/protos"
+
+	"github.com/golang/protobuf/proto"
+)
+
+// txIDCache remembers the transaction IDs of the most recently ordered
+// requests, up to a fixed capacity.  It is used to discard client
+// retries of a transaction which has already been ordered before they
+// are batched and executed a second time.  The oldest ID is evicted
+// once the capacity is reached.
+type txIDCache struct {
+	size  int
+	order list.List
+	ids   map[string]*list.Element
+}
+
+// newTxIDCache creates a new txIDCache holding up to size IDs, a size
+// of zero disables the cache.
+func newTxIDCache(size int) *txIDCache {
+	c := &txIDCache{size: size}
+	c.ids = make(map[string]*list.Element)
+	return c
+}
+
+// add records the ID as ordered, evicting the oldest entry if needed
+func (c *txIDCache) add(txID string) {
+	if c.size <= 0 || txID == "" {
+		return
+	}
+	if e, ok := c.ids[txID]; ok {
+		c.order.MoveToBack(e)
+		return
+	}
+	c.ids[txID] = c.order.PushBack(txID)
+	for c.order.Len() > c.size {
+		oldest := c.order.Front()
+		c.order.Remove(oldest)
+		delete(c.ids, oldest.Value.(string))
+	}
+}
+
+// has returns whether the ID was recently ordered
+func (c *txIDCache) has(txID string) bool {
+	if txID == "" {
+		return false
+	}
+	_, ok := c.ids[txID]
+	return ok
+}
+
+// Len returns the number of IDs currently remembered
+func (c *txIDCache) Len() int {
+	return c.order.Len()
+}
+
+// getTxID extracts the transaction ID from the opaque request payload
+func getTxID(req *Request) (string, error) {
+	tx := &pb.Transaction{}
+	if err := proto.Unmarshal(req.Payload, tx); err != nil {
+		return "", err
+	}
+	return tx.Uuid, nil
+}
@@ -0,0 +1,55 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package pbft
+
+import "testing"
+
+func TestTxIDCacheEviction(t *testing.T) {
+	c := newTxIDCache(2)
+
+	c.add("a")
+	c.add("b")
+	if !c.has("a") || !c.has("b") {
+		t.Fatalf("Cache should hold both IDs")
+	}
+
+	c.add("a") // refresh a, so b is now the oldest
+	c.add("c")
+	if c.has("b") {
+		t.Errorf("Oldest ID should have been evicted")
+	}
+	if !c.has("a") || !c.has("c") {
+		t.Errorf("Most recent IDs should be retained")
+	}
+	if c.Len() != 2 {
+		t.Errorf("Expected 2 entries, got %d", c.Len())
+	}
+}
+
+func TestTxIDCacheDisabled(t *testing.T) {
+	c := newTxIDCache(0)
+	c.add("a")
+	if c.has("a") || c.Len() != 0 {
+		t.Fatalf("A zero sized cache should not remember anything")
+	}
+
+	c = newTxIDCache(10)
+	c.add("")
+	if c.has("") || c.Len() != 0 {
+		t.Fatalf("Empty transaction IDs should never be tracked")
+	}
+}
@@ -33,6 +33,8 @@ func hash(msg interface{}) string {
 		raw, _ = proto.Marshal(converted)
 	case *RequestBatch:
 		raw, _ = proto.Marshal(converted)
+	case []byte:
+		raw = converted
 	default:
 		logger.Error("Asked to hash non-supported message type, ignoring")
 		return ""
@@ -0,0 +1,133 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package pbft
+
+import (
+	"github.com/golang/protobuf/proto"
+
+	"github.com/hyperledger/fabric/consensus/util/events"
+	pb "github.com/hyperledger/fabric/protos"
+)
+
+// verifier checks the authenticators of inbound consensus messages on a pool
+// of workers, before the messages are queued to the main thread, so that
+// only the mutation of the protocol state remains serialized.  Messages of
+// one sender are always checked by the same worker, which preserves their
+// order.  Messages which carry no authenticator are passed on untouched.
+type verifier struct {
+	verify func(senderID uint64, signature []byte, message []byte) error
+	queues []chan *batchMessage
+	out    chan<- events.Event
+	done   chan struct{}
+}
+
+// newVerifier starts workers goroutines which deliver the checked messages to out,
+// verify must be safe to call concurrently
+func newVerifier(workers int, verify func(senderID uint64, signature []byte, message []byte) error, out chan<- events.Event) *verifier {
+	v := &verifier{
+		verify: verify,
+		queues: make([]chan *batchMessage, workers),
+		out:    out,
+		done:   make(chan struct{}),
+	}
+	for i := range v.queues {
+		v.queues[i] = make(chan *batchMessage, 16)
+		go v.work(v.queues[i])
+	}
+	return v
+}
+
+// submit queues a message received from the network for checking
+func (v *verifier) submit(msg *batchMessage) {
+	queue := v.queues[0]
+	if id, err := getValidatorID(msg.sender); err == nil {
+		queue = v.queues[id%uint64(len(v.queues))]
+	}
+	select {
+	case queue <- msg:
+	case <-v.done:
+	}
+}
+
+func (v *verifier) stop() {
+	close(v.done)
+}
+
+func (v *verifier) work(queue chan *batchMessage) {
+	for {
+		select {
+		case msg := <-queue:
+			event := v.check(msg)
+			if event == nil {
+				continue
+			}
+			select {
+			case v.out <- event:
+			case <-v.done:
+				return
+			}
+		case <-v.done:
+			return
+		}
+	}
+}
+
+// check returns the event to queue for msg, or nil if msg must be dropped.
+// Messages the verifier cannot make sense of are left to the main thread,
+// which knows how to report them.
+func (v *verifier) check(msg *batchMessage) events.Event {
+	if msg.msg.Type != pb.Message_CONSENSUS {
+		return batchMessageEvent(*msg)
+	}
+	batchMsg := &BatchMessage{}
+	if err := proto.Unmarshal(msg.msg.Payload, batchMsg); err != nil {
+		return batchMessageEvent(*msg)
+	}
+	pbftPayload := batchMsg.GetPbftMessage()
+	if pbftPayload == nil {
+		return batchMessageEvent(*msg)
+	}
+	senderID, err := getValidatorID(msg.sender)
+	if err != nil {
+		return batchMessageEvent(*msg)
+	}
+	pbftMsg := &Message{}
+	if err := proto.Unmarshal(pbftPayload, pbftMsg); err != nil {
+		return batchMessageEvent(*msg)
+	}
+
+	var signed []signable
+	if vc := pbftMsg.GetViewChange(); vc != nil {
+		signed = append(signed, vc)
+	} else if nv := pbftMsg.GetNewView(); nv != nil {
+		for _, vc := range nv.Vset {
+			signed = append(signed, vc)
+		}
+	}
+	for _, s := range signed {
+		if err := verifySignable(s, v.verify); err != nil {
+			logger.Warningf("Dropping message from replica %d with an incorrect signature by replica %d: %s", senderID, s.getID(), err)
+			return nil
+		}
+	}
+
+	return pbftMessageEvent{
+		sender:   senderID,
+		msg:      pbftMsg,
+		verified: true,
+	}
+}
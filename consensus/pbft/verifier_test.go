@@ -0,0 +1,95 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package pbft
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+
+	"github.com/hyperledger/fabric/consensus/util/events"
+	pb "github.com/hyperledger/fabric/protos"
+)
+
+func makeVerifierTestMsg(msg *Message) *pb.Message {
+	msgPayload, _ := proto.Marshal(msg)
+	batchPayload, _ := proto.Marshal(&BatchMessage{Payload: &BatchMessage_PbftMessage{PbftMessage: msgPayload}})
+	return &pb.Message{Type: pb.Message_CONSENSUS, Payload: batchPayload}
+}
+
+func TestVerifier(t *testing.T) {
+	out := make(chan events.Event)
+	v := newVerifier(2, func(senderID uint64, signature []byte, message []byte) error {
+		if senderID == 3 {
+			return fmt.Errorf("bad signature")
+		}
+		return nil
+	}, out)
+	defer v.stop()
+
+	good := &ViewChange{View: 1, ReplicaId: 1}
+	bad := &ViewChange{View: 1, ReplicaId: 3}
+	v.submit(&batchMessage{msg: makeVerifierTestMsg(&Message{Payload: &Message_ViewChange{ViewChange: bad}}), sender: &pb.PeerID{Name: "vp3"}})
+	v.submit(&batchMessage{msg: makeVerifierTestMsg(&Message{Payload: &Message_NewView{NewView: &NewView{View: 1, ReplicaId: 1, Vset: []*ViewChange{good, bad}}}}), sender: &pb.PeerID{Name: "vp1"}})
+	for n := uint64(1); n <= 3; n++ {
+		v.submit(&batchMessage{msg: makeVerifierTestMsg(&Message{Payload: &Message_Prepare{Prepare: &Prepare{SequenceNumber: n, ReplicaId: 1}}}), sender: &pb.PeerID{Name: "vp1"}})
+	}
+	v.submit(&batchMessage{msg: makeVerifierTestMsg(&Message{Payload: &Message_ViewChange{ViewChange: good}}), sender: &pb.PeerID{Name: "vp1"}})
+	v.submit(&batchMessage{msg: createTxMsg(1), sender: &pb.PeerID{Name: "vp2"}})
+
+	var prepares []uint64
+	viewChanges, transactions := 0, 0
+	for i := 0; i < 5; i++ {
+		select {
+		case event := <-out:
+			switch et := event.(type) {
+			case pbftMessageEvent:
+				if !et.verified {
+					t.Errorf("Expected message from replica %d to be marked as verified", et.sender)
+				}
+				if prep := et.msg.GetPrepare(); prep != nil {
+					prepares = append(prepares, prep.SequenceNumber)
+				} else if vc := et.msg.GetViewChange(); vc != nil && vc.ReplicaId == 1 {
+					viewChanges++
+				} else {
+					t.Errorf("Unexpected message passed the verifier: %v", et.msg)
+				}
+			case batchMessageEvent:
+				transactions++
+			default:
+				t.Errorf("Unexpected event %T", event)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("Verifier did not deliver all messages")
+		}
+	}
+
+	select {
+	case event := <-out:
+		t.Errorf("Messages with incorrect signatures should have been dropped, got %v", event)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	if len(prepares) != 3 || prepares[0] != 1 || prepares[1] != 2 || prepares[2] != 3 {
+		t.Errorf("Expected the prepares of replica 1 in the order they were received, got %v", prepares)
+	}
+	if viewChanges != 1 || transactions != 1 {
+		t.Errorf("Expected 1 view-change and 1 transaction, got %d and %d", viewChanges, transactions)
+	}
+}
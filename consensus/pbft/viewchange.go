@@ -19,7 +19,7 @@ package pbft
 import (
 	"encoding/base64"
 	"fmt"
-	"reflect"
+	"time"
 
 	"github.com/hyperledger/fabric/consensus/util/events"
 )
@@ -29,7 +29,7 @@ type viewChangeQuorumEvent struct{}
 
 func (instance *pbftCore) correctViewChange(vc *ViewChange) bool {
 	for _, p := range append(vc.Pset, vc.Qset...) {
-		if !(p.View < vc.View && p.SequenceNumber > vc.H && p.SequenceNumber <= vc.H+instance.L) {
+		if !(p.View < vc.View && p.SequenceNumber > vc.H && p.SequenceNumber <= vc.H+instance.replayWindow()) {
 			logger.Debugf("Replica %d invalid p entry in view-change: vc(v:%d h:%d) p(v:%d n:%d)",
 				instance.id, vc.View, vc.H, p.View, p.SequenceNumber)
 			return false
@@ -38,7 +38,7 @@ func (instance *pbftCore) correctViewChange(vc *ViewChange) bool {
 
 	for _, c := range vc.Cset {
 		// PBFT: the paper says c.n > vc.h
-		if !(c.SequenceNumber >= vc.H && c.SequenceNumber <= vc.H+instance.L) {
+		if !(c.SequenceNumber >= vc.H && c.SequenceNumber <= vc.H+instance.replayWindow()) {
 			logger.Debugf("Replica %d invalid c entry in view-change: vc(v:%d h:%d) c(n:%d)",
 				instance.id, vc.View, vc.H, c.SequenceNumber)
 			return false
@@ -78,6 +78,8 @@ func (instance *pbftCore) calcPSet() map[uint64]*ViewChange_PQ {
 			SequenceNumber: idx.n,
 			BatchDigest:    digest,
 			View:           idx.v,
+			Epoch:          instance.epoch,
+			Prepares:       instance.prepareCertificate(cert, digest, idx.v, idx.n),
 		}
 	}
 
@@ -116,6 +118,7 @@ func (instance *pbftCore) calcQSet() map[qidx]*ViewChange_PQ {
 			SequenceNumber: idx.n,
 			BatchDigest:    digest,
 			View:           idx.v,
+			Epoch:          instance.epoch,
 		}
 	}
 
@@ -124,10 +127,18 @@ func (instance *pbftCore) calcQSet() map[qidx]*ViewChange_PQ {
 
 func (instance *pbftCore) sendViewChange() events.Event {
 	instance.stopTimer()
+	instance.discardSpeculation()
+	// ask for missing payloads again in the new view, the replicas asked
+	// before may not have had them
+	instance.missingPayloads = make(map[string]bool)
+	// the next primary is not to blame for the batches the current one left
+	instance.health.requestSeen = make(map[string]time.Time)
 
 	delete(instance.newViewStore, instance.view)
 	instance.view++
 	instance.activeView = false
+	instance.rotationBacklog = nil
+	instance.nullFillTarget = 0
 
 	instance.pset = instance.calcPSet()
 	instance.qset = instance.calcQSet()
@@ -144,9 +155,13 @@ func (instance *pbftCore) sendViewChange() events.Event {
 		}
 	}
 
+	// the watermarks may have moved past the last proof checkpoint on
+	// acknowledgments alone, the view change must start from a proof
+	stable := instance.lastProofCheckpoint(instance.h)
+
 	vc := &ViewChange{
 		View:      instance.view,
-		H:         instance.h,
+		H:         stable,
 		ReplicaId: instance.id,
 	}
 
@@ -158,14 +173,14 @@ func (instance *pbftCore) sendViewChange() events.Event {
 	}
 
 	for _, p := range instance.pset {
-		if p.SequenceNumber < instance.h {
+		if p.SequenceNumber < stable {
 			logger.Errorf("BUG! Replica %d should not have anything in our pset less than h, found %+v", instance.id, p)
 		}
 		vc.Pset = append(vc.Pset, p)
 	}
 
 	for _, q := range instance.qset {
-		if q.SequenceNumber < instance.h {
+		if q.SequenceNumber < stable {
 			logger.Errorf("BUG! Replica %d should not have anything in our qset less than h, found %+v", instance.id, q)
 		}
 		vc.Qset = append(vc.Qset, q)
@@ -184,14 +199,19 @@ func (instance *pbftCore) sendViewChange() events.Event {
 }
 
 func (instance *pbftCore) recvViewChange(vc *ViewChange) events.Event {
-	logger.Infof("Replica %d received view-change from replica %d, v:%d, h:%d, |C|:%d, |P|:%d, |Q|:%d",
-		instance.id, vc.ReplicaId, vc.View, vc.H, len(vc.Cset), len(vc.Pset), len(vc.Qset))
-
 	if err := instance.verify(vc); err != nil {
 		logger.Warningf("Replica %d found incorrect signature in view-change message: %s", instance.id, err)
 		return nil
 	}
 
+	return instance.recvVerifiedViewChange(vc)
+}
+
+// recvVerifiedViewChange processes a view-change whose signature has been checked
+func (instance *pbftCore) recvVerifiedViewChange(vc *ViewChange) events.Event {
+	logger.Infof("Replica %d received view-change from replica %d, v:%d, h:%d, |C|:%d, |P|:%d, |Q|:%d",
+		instance.id, vc.ReplicaId, vc.View, vc.H, len(vc.Cset), len(vc.Pset), len(vc.Qset))
+
 	if vc.View < instance.view {
 		logger.Warningf("Replica %d found view-change message for old view", instance.id)
 		return nil
@@ -228,7 +248,7 @@ func (instance *pbftCore) recvViewChange(vc *ViewChange) events.Event {
 	}
 
 	// We only enter this if there are enough view change messages _greater_ than our current view
-	if len(replicas) >= instance.f+1 {
+	if instance.weightOf(replicas) >= instance.weakQuorum() {
 		logger.Infof("Replica %d received f+1 view-change messages, triggering view-change to view %d",
 			instance.id, minView)
 		// subtract one, because sendViewChange() increments
@@ -239,7 +259,7 @@ func (instance *pbftCore) recvViewChange(vc *ViewChange) events.Event {
 	quorum := 0
 	for idx := range instance.viewChangeStore {
 		if idx.v == instance.view {
-			quorum++
+			quorum += instance.weight(idx.id)
 		}
 	}
 	logger.Debugf("Replica %d now has %d view change requests for view %d", instance.id, quorum, instance.view)
@@ -294,20 +314,30 @@ func (instance *pbftCore) sendNewView() events.Event {
 }
 
 func (instance *pbftCore) recvNewView(nv *NewView) events.Event {
+	if err := instance.verifyNewViewSignatures(nv); err != nil {
+		logger.Warningf("Replica %d rejecting new-view from %d, v:%d: %s",
+			instance.id, nv.ReplicaId, nv.View, err)
+		return nil
+	}
+
+	return instance.recvVerifiedNewView(nv)
+}
+
+// recvVerifiedNewView processes a new-view whose view-change signatures have been checked
+func (instance *pbftCore) recvVerifiedNewView(nv *NewView) events.Event {
 	logger.Infof("Replica %d received new-view %d",
 		instance.id, nv.View)
 
-	if !(nv.View > 0 && nv.View >= instance.view && instance.primary(nv.View) == nv.ReplicaId && instance.newViewStore[nv.View] == nil) {
-		logger.Infof("Replica %d rejecting invalid new-view from %d, v:%d",
+	if !(nv.View >= instance.view && instance.newViewStore[nv.View] == nil) {
+		logger.Infof("Replica %d rejecting new-view from %d, v:%d: stale or already received",
 			instance.id, nv.ReplicaId, nv.View)
 		return nil
 	}
 
-	for _, vc := range nv.Vset {
-		if err := instance.verify(vc); err != nil {
-			logger.Warningf("Replica %d found incorrect view-change signature in new-view message: %s", instance.id, err)
-			return nil
-		}
+	if err := instance.verifyNewViewProof(nv); err != nil {
+		logger.Warningf("Replica %d rejecting invalid new-view from %d, v:%d: %s",
+			instance.id, nv.ReplicaId, nv.View, err)
+		return nil
 	}
 
 	instance.newViewStore[nv.View] = nv
@@ -332,7 +362,7 @@ func (instance *pbftCore) processNewView() events.Event {
 	if !ok {
 		logger.Warningf("Replica %d could not determine initial checkpoint: %+v",
 			instance.id, instance.viewChangeStore)
-		return instance.sendViewChange()
+		return instance.changeView(ViewChangeCause_INVALID_NEW_VIEW, fmt.Sprintf("no initial checkpoint for the new view %d from replica %d", nv.View, nv.ReplicaId))
 	}
 
 	speculativeLastExec := instance.lastExec
@@ -356,11 +386,11 @@ func (instance *pbftCore) processNewView() events.Event {
 				for _, p := range cert.commit {
 					// Was this committed in the previous view
 					if p.View == idx.v && p.SequenceNumber == seqNo {
-						quorum++
+						quorum += instance.weight(p.ReplicaId)
 					}
 				}
 
-				if quorum < instance.intersectionQuorum() {
+				if quorum < instance.intersectionQuorum() && !instance.fastCommitted(cert.digest, idx.v, seqNo) {
 					logger.Debugf("Replica %d missing quorum of commit certificate for seqNo=%d, only has %d of %d", instance.id, quorum, instance.intersectionQuorum())
 					continue
 				}
@@ -385,17 +415,9 @@ func (instance *pbftCore) processNewView() events.Event {
 		logger.Infof("Replica %d cannot execute to the view change checkpoint with seqNo %d", instance.id, cp.SequenceNumber)
 	}
 
-	msgList := instance.assignSequenceNumbers(nv.Vset, cp.SequenceNumber)
-	if msgList == nil {
-		logger.Warningf("Replica %d could not assign sequence numbers: %+v",
-			instance.id, instance.viewChangeStore)
-		return instance.sendViewChange()
-	}
-
-	if !(len(msgList) == 0 && len(nv.Xset) == 0) && !reflect.DeepEqual(msgList, nv.Xset) {
-		logger.Warningf("Replica %d failed to verify new-view Xset: computed %+v, received %+v",
-			instance.id, msgList, nv.Xset)
-		return instance.sendViewChange()
+	if err := instance.verifyNewViewXset(nv, cp.SequenceNumber); err != nil {
+		logger.Warningf("Replica %d failed to verify new-view Xset: %s", instance.id, err)
+		return instance.changeView(ViewChangeCause_INVALID_NEW_VIEW, fmt.Sprintf("new view %d from replica %d failed verification: %s", nv.View, nv.ReplicaId, err))
 	}
 
 	if instance.h < cp.SequenceNumber {
@@ -546,7 +568,11 @@ func (instance *pbftCore) selectInitialCheckpoint(vset []*ViewChange) (checkpoin
 
 	for idx, vcList := range checkpoints {
 		// need weak certificate for the checkpoint
-		if len(vcList) <= instance.f { // type casting necessary to match types
+		weight := 0
+		for _, vc := range vcList {
+			weight += instance.weight(vc.ReplicaId)
+		}
+		if weight < instance.weakQuorum() {
 			logger.Debugf("Replica %d has no weak certificate for n:%d, vcList was %d long",
 				instance.id, idx.SequenceNumber, len(vcList))
 			continue
@@ -558,7 +584,7 @@ func (instance *pbftCore) selectInitialCheckpoint(vset []*ViewChange) (checkpoin
 		// We need f+1 matching checkpoints at this seqNo (S')
 		for _, vc := range vset {
 			if vc.H <= idx.SequenceNumber {
-				quorum++
+				quorum += instance.weight(vc.ReplicaId)
 			}
 		}
 
@@ -588,7 +614,16 @@ func (instance *pbftCore) assignSequenceNumbers(vset []*ViewChange, h uint64) (m
 
 	// "for all n such that h < n <= h + L"
 nLoop:
-	for n := h + 1; n <= h+instance.L; n++ {
+	for n := h + 1; n <= h+instance.replayWindow(); n++ {
+		// a batch which may have fast committed takes precedence
+		if instance.fastPath {
+			if d, ok := instance.fastPathDigest(vset, n); ok {
+				msgList[n] = d
+				maxN = n
+				continue nLoop
+			}
+		}
+
 		// "∃m ∈ S..."
 		for _, m := range vset {
 			// "...with <n,d,v> ∈ m.P"
@@ -606,7 +641,7 @@ nLoop:
 							continue mpLoop
 						}
 					}
-					quorum++
+					quorum += instance.weight(mp.ReplicaId)
 				}
 
 				if quorum < instance.intersectionQuorum() {
@@ -619,12 +654,12 @@ nLoop:
 					// "∃<n,d',v'> ∈ m'.Q"
 					for _, emp := range mp.Qset {
 						if n == emp.SequenceNumber && emp.View >= em.View && emp.BatchDigest == em.BatchDigest {
-							quorum++
+							quorum += instance.weight(mp.ReplicaId)
 						}
 					}
 				}
 
-				if quorum < instance.f+1 {
+				if quorum < instance.weakQuorum() {
 					continue
 				}
 
@@ -646,7 +681,7 @@ nLoop:
 					continue nullLoop
 				}
 			}
-			quorum++
+			quorum += instance.weight(m.ReplicaId)
 		}
 
 		if quorum >= instance.intersectionQuorum() {
@@ -0,0 +1,116 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package pbft
+
+import (
+	"fmt"
+	"google/protobuf"
+	"sort"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/hyperledger/fabric/consensus/util/events"
+)
+
+// Every view change this replica initiates is recorded with its cause, the
+// view it moved to, and when.  The most recent causes are persisted, so that
+// they survive a restart and explain the view changes of a replica after the
+// fact.  Resending a view change, or following the view changes of f+1 other
+// replicas, is not a new cause of its own.
+
+const (
+	vcCausePrefix          = "vcCause."
+	viewChangeCauseHistory = 16 // number of view change causes kept
+)
+
+func vcCauseKey(view uint64) string {
+	return fmt.Sprintf("%s%d", vcCausePrefix, view)
+}
+
+// changeView moves to the next view for the given reason
+func (instance *pbftCore) changeView(reason ViewChangeCauseReason, detail string) events.Event {
+	instance.recordViewChangeCause(&ViewChangeCause{Reason: reason, View: instance.view + 1, Detail: detail})
+	return instance.sendViewChange()
+}
+
+// recordViewChangeCause logs and persists the cause of a view change
+func (instance *pbftCore) recordViewChangeCause(cause *ViewChangeCause) {
+	now := time.Now()
+	cause.Timestamp = &google_protobuf.Timestamp{
+		Seconds: now.Unix(),
+		Nanos:   int32(now.UnixNano() % 1000000000),
+	}
+	logger.Warningf("Replica %d moving to view %d because of %s: %s", instance.id, cause.View, cause.Reason, cause.Detail)
+
+	instance.vcCauses = append(instance.vcCauses, cause)
+	if len(instance.vcCauses) > viewChangeCauseHistory {
+		instance.consumer.DelState(vcCauseKey(instance.vcCauses[0].View))
+		instance.vcCauses = instance.vcCauses[1:]
+	}
+
+	raw, err := proto.Marshal(cause)
+	if err != nil {
+		logger.Warningf("Replica %d could not persist view change cause: %s", instance.id, err)
+		return
+	}
+	instance.consumer.StoreState(vcCauseKey(cause.View), raw)
+}
+
+func (instance *pbftCore) restoreViewChangeCauses() {
+	packed, err := instance.consumer.ReadStateSet(vcCausePrefix)
+	if err != nil {
+		logger.Warningf("Replica %d could not restore view change causes: %s", instance.id, err)
+		return
+	}
+	for key, raw := range packed {
+		cause := &ViewChangeCause{}
+		if err := proto.Unmarshal(raw, cause); err != nil {
+			logger.Warningf("Replica %d could not restore view change cause %s: %s", instance.id, key, err)
+			continue
+		}
+		instance.vcCauses = append(instance.vcCauses, cause)
+	}
+	sort.Sort(sortableViewChangeCauses(instance.vcCauses))
+}
+
+// viewChangeTimerCause returns why the view change timer expired, a request
+// which timed out because this replica lacks the certificate of an earlier
+// sequence number is blamed on the gap
+func (instance *pbftCore) viewChangeTimerCause(cause *ViewChangeCause) (ViewChangeCauseReason, string) {
+	if cause.Reason != ViewChangeCause_REQUEST_TIMEOUT {
+		return cause.Reason, cause.Detail
+	}
+	if end, ok := instance.gapEnd(); ok && instance.activeView {
+		return ViewChangeCause_GAP_DETECTED, fmt.Sprintf("missing the certificate for seqNo=%d although seqNo=%d committed, %s", instance.lastExec+1, end, cause.Detail)
+	}
+	return cause.Reason, cause.Detail
+}
+
+// RequestViewChange has the replica move to the next view, the reason is
+// recorded as the cause of the view change
+func (op *obcBatch) RequestViewChange(reason string) {
+	op.manager.Queue() <- viewChangeTimerEvent{&ViewChangeCause{
+		Reason: ViewChangeCause_ADMIN,
+		Detail: reason,
+	}}
+}
+
+type sortableViewChangeCauses []*ViewChangeCause
+
+func (a sortableViewChangeCauses) Len() int           { return len(a) }
+func (a sortableViewChangeCauses) Swap(i, j int)      { a[i], a[j] = a[j], a[i] }
+func (a sortableViewChangeCauses) Less(i, j int) bool { return a[i].View < a[j].View }
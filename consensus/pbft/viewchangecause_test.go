@@ -0,0 +1,100 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package pbft
+
+import (
+	"testing"
+	"time"
+)
+
+func TestViewChangeCauseRecorded(t *testing.T) {
+	config := loadConfig()
+	net := makeSimNetwork(4, 5, config)
+	defer net.stop()
+
+	net.isolate(0)
+	net.submitAll(createPbftReqBatch(1, 0))
+	r := net.replicas[1]
+	if !net.runUntil(time.Minute, func() bool { return r.pbft.view == 1 && r.pbft.activeView }) {
+		t.Fatalf("Replica 1 did not move to view 1, it is in view %d", r.pbft.view)
+	}
+
+	if len(r.pbft.vcCauses) != 1 {
+		t.Fatalf("Expected one view change cause, got %+v", r.pbft.vcCauses)
+	}
+	cause := r.pbft.vcCauses[0]
+	if cause.Reason != ViewChangeCause_REQUEST_TIMEOUT || cause.View != 1 || cause.Timestamp == nil {
+		t.Errorf("Expected a request timeout leading to view 1, got %+v", cause)
+	}
+	if state := r.pbft.dumpState(); len(state.ViewChangeCauses) != 1 || state.ViewChangeCauses[0].Reason != "REQUEST_TIMEOUT" {
+		t.Errorf("Expected the view change cause in the dumped state, got %+v", state.ViewChangeCauses)
+	}
+
+	restarted := newPbftCore(r.id, config, r, &simTimerFactory{net: net, replica: r})
+	defer restarted.close()
+	if len(restarted.vcCauses) != 1 || restarted.vcCauses[0].Reason != ViewChangeCause_REQUEST_TIMEOUT || restarted.vcCauses[0].View != 1 {
+		t.Errorf("Expected the view change cause to be restored, got %+v", restarted.vcCauses)
+	}
+}
+
+func TestViewChangeCauseHistory(t *testing.T) {
+	config := loadConfig()
+	net := makeSimNetwork(4, 6, config)
+	defer net.stop()
+	r := net.replicas[1]
+
+	for v := uint64(1); v <= viewChangeCauseHistory+4; v++ {
+		r.pbft.recordViewChangeCause(&ViewChangeCause{Reason: ViewChangeCause_ADMIN, View: v})
+	}
+	if len(r.pbft.vcCauses) != viewChangeCauseHistory || r.pbft.vcCauses[0].View != 5 {
+		t.Fatalf("Expected the latest %d view change causes to be kept, got %d starting at view %d",
+			viewChangeCauseHistory, len(r.pbft.vcCauses), r.pbft.vcCauses[0].View)
+	}
+
+	restarted := newPbftCore(r.id, config, r, &simTimerFactory{net: net, replica: r})
+	defer restarted.close()
+	if len(restarted.vcCauses) != viewChangeCauseHistory {
+		t.Fatalf("Expected %d view change causes to be restored, got %d", viewChangeCauseHistory, len(restarted.vcCauses))
+	}
+	for i, cause := range restarted.vcCauses {
+		if cause.View != uint64(i+5) {
+			t.Errorf("Expected restored view change causes in view order, got view %d at %d", cause.View, i)
+		}
+	}
+}
+
+func TestViewChangeTimerCause(t *testing.T) {
+	net := makeSimNetwork(4, 7, loadConfig())
+	defer net.stop()
+	instance := net.replicas[0].pbft
+
+	if reason, _ := instance.viewChangeTimerCause(&ViewChangeCause{Reason: ViewChangeCause_ADMIN}); reason != ViewChangeCause_ADMIN {
+		t.Errorf("Expected an admin cause to be kept, got %s", reason)
+	}
+
+	cert := instance.getCert(0, 2)
+	cert.prePrepare = &PrePrepare{View: 0, SequenceNumber: 2, ReplicaId: 0}
+	for id := uint64(0); id < 4; id++ {
+		if id != 0 {
+			cert.prepare = append(cert.prepare, &Prepare{View: 0, SequenceNumber: 2, ReplicaId: id})
+		}
+		cert.commit = append(cert.commit, &Commit{View: 0, SequenceNumber: 2, ReplicaId: id})
+	}
+	if reason, _ := instance.viewChangeTimerCause(&ViewChangeCause{Reason: ViewChangeCause_REQUEST_TIMEOUT}); reason != ViewChangeCause_GAP_DETECTED {
+		t.Errorf("Expected a request timeout behind a gap to be blamed on the gap, got %s", reason)
+	}
+}
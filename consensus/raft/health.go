@@ -0,0 +1,69 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package raft
+
+import (
+	"fmt"
+
+	"github.com/hyperledger/fabric/consensus"
+	"github.com/hyperledger/fabric/consensus/util/election"
+	"github.com/hyperledger/fabric/consensus/util/events"
+)
+
+// Health reports the replica unhealthy while it knows no leader or installs
+// a snapshot, or if its main thread is stuck
+func (op *obcRaft) Health() consensus.Health {
+	var health consensus.Health
+	if !events.OnMainThread(op.manager, func() {
+		rc := op.raft
+		leader, ok := rc.term.Leader()
+		switch {
+		case !ok:
+			health.Detail = fmt.Sprintf("%s without a leader in term %d", rc.term.Role(), rc.term.Current())
+		case rc.transferring:
+			health.Detail = fmt.Sprintf("installing a snapshot, last applied %d", rc.lastApplied)
+		default:
+			health.Healthy = true
+			health.Detail = fmt.Sprintf("%s in term %d, leader %d", rc.term.Role(), rc.term.Current(), leader)
+		}
+	}) {
+		return consensus.Health{Detail: fmt.Sprintf("main thread unresponsive for %v", events.MainThreadTimeout)}
+	}
+	return health
+}
+
+// Metrics reports the progress of the replica
+func (op *obcRaft) Metrics() consensus.Metrics {
+	var metrics consensus.Metrics
+	events.OnMainThread(op.manager, func() {
+		rc := op.raft
+		isLeader := 0.0
+		if rc.term.Role() == election.Leader {
+			isLeader = 1
+		}
+		metrics = consensus.Metrics{
+			"raft.term":          float64(rc.term.Current()),
+			"raft.isLeader":      isLeader,
+			"raft.members":       float64(len(rc.members)),
+			"raft.lastIndex":     float64(rc.log.lastIndex()),
+			"raft.commitIndex":   float64(rc.commitIndex),
+			"raft.lastApplied":   float64(rc.lastApplied),
+			"raft.batchRequests": float64(len(rc.batch)),
+		}
+	})
+	return metrics
+}
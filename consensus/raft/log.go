@@ -0,0 +1,132 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package raft
+
+// raftLog holds the log entries following a snapshot, the snapshot stands
+// for the entries it compacted
+type raftLog struct {
+	snapshot *Snapshot
+	entries  []*Entry // entries[i].Index == snapshot.Index+1+i
+}
+
+func newRaftLog(snapshot *Snapshot) *raftLog {
+	return &raftLog{snapshot: snapshot}
+}
+
+func (l *raftLog) lastIndex() uint64 {
+	return l.snapshot.Index + uint64(len(l.entries))
+}
+
+func (l *raftLog) lastTerm() uint64 {
+	term, _ := l.term(l.lastIndex())
+	return term
+}
+
+// term returns the term of the entry at an index, and whether the log knows
+// it, which it does not for compacted entries other than the last one
+func (l *raftLog) term(index uint64) (uint64, bool) {
+	if index == l.snapshot.Index {
+		return l.snapshot.Term, true
+	}
+	if entry := l.entry(index); entry != nil {
+		return entry.Term, true
+	}
+	return 0, false
+}
+
+// entry returns the entry at an index, nil if it was compacted or does not
+// exist yet
+func (l *raftLog) entry(index uint64) *Entry {
+	if index <= l.snapshot.Index || index > l.lastIndex() {
+		return nil
+	}
+	return l.entries[index-l.snapshot.Index-1]
+}
+
+// slice returns up to max entries starting at an index
+func (l *raftLog) slice(from uint64, max int) []*Entry {
+	if from <= l.snapshot.Index || from > l.lastIndex() {
+		return nil
+	}
+	entries := l.entries[from-l.snapshot.Index-1:]
+	if max > 0 && len(entries) > max {
+		entries = entries[:max]
+	}
+	return entries
+}
+
+func (l *raftLog) append(entry *Entry) {
+	l.entries = append(l.entries, entry)
+}
+
+// truncate removes the entries from an index on, and returns them
+func (l *raftLog) truncate(from uint64) []*Entry {
+	if from <= l.snapshot.Index || from > l.lastIndex() {
+		return nil
+	}
+	i := from - l.snapshot.Index - 1
+	removed := l.entries[i:]
+	l.entries = l.entries[:i:i]
+	return removed
+}
+
+// compact replaces the entries up to the index of a snapshot by the snapshot,
+// later entries are kept if the log agrees with the snapshot, and returns the
+// entries it removed
+func (l *raftLog) compact(snapshot *Snapshot) []*Entry {
+	var removed []*Entry
+	if term, ok := l.term(snapshot.Index); ok && term == snapshot.Term {
+		i := snapshot.Index - l.snapshot.Index
+		removed = l.entries[:i]
+		l.entries = l.entries[i:]
+	} else {
+		removed = l.entries
+		l.entries = nil
+	}
+	l.snapshot = snapshot
+	return removed
+}
+
+// isUpToDate returns whether a log ending with the given index and term is
+// at least as up-to-date as this one
+func (l *raftLog) isUpToDate(lastIndex, lastTerm uint64) bool {
+	return lastTerm > l.lastTerm() || (lastTerm == l.lastTerm() && lastIndex >= l.lastIndex())
+}
+
+// configuration returns the latest configuration at or below an index
+func (l *raftLog) configuration(index uint64) *Configuration {
+	if index > l.lastIndex() {
+		index = l.lastIndex()
+	}
+	for i := index; i > l.snapshot.Index; i-- {
+		if entry := l.entry(i); entry.Type == Entry_CONFIGURATION {
+			return entry.Configuration
+		}
+	}
+	return l.snapshot.Configuration
+}
+
+// pendingConfiguration returns whether there is a configuration entry above
+// an index
+func (l *raftLog) pendingConfiguration(index uint64) bool {
+	for _, entry := range l.slice(index+1, 0) {
+		if entry.Type == Entry_CONFIGURATION {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,77 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package raft
+
+import (
+	"reflect"
+	"testing"
+)
+
+func makeTestLog(terms ...uint64) *raftLog {
+	l := newRaftLog(&Snapshot{Configuration: &Configuration{Members: []uint64{0, 1, 2}}})
+	for i, term := range terms {
+		l.append(&Entry{Index: uint64(i + 1), Term: term})
+	}
+	return l
+}
+
+func TestLogTruncate(t *testing.T) {
+	l := makeTestLog(1, 1, 2, 2)
+	removed := l.truncate(3)
+	if len(removed) != 2 || l.lastIndex() != 2 || l.lastTerm() != 1 {
+		t.Errorf("Expected entries 3 and 4 to be removed, removed %d, log ends at %d of term %d", len(removed), l.lastIndex(), l.lastTerm())
+	}
+	l.append(&Entry{Index: 3, Term: 3})
+	if removed[0].Term != 2 {
+		t.Errorf("Expected the removed entries not to be overwritten by later appends")
+	}
+}
+
+func TestLogCompact(t *testing.T) {
+	l := makeTestLog(1, 1, 2, 2)
+	removed := l.compact(&Snapshot{Index: 2, Term: 1})
+	if len(removed) != 2 || l.lastIndex() != 4 || l.entry(2) != nil || l.entry(3) == nil {
+		t.Errorf("Expected entries 1 and 2 to be compacted and 3 and 4 kept, removed %d, log ends at %d", len(removed), l.lastIndex())
+	}
+	if term, ok := l.term(2); !ok || term != 1 {
+		t.Errorf("Expected the term of the snapshot to be known")
+	}
+	if _, ok := l.term(1); ok {
+		t.Errorf("Expected the term of a compacted entry to be unknown")
+	}
+
+	removed = l.compact(&Snapshot{Index: 6, Term: 3})
+	if len(removed) != 2 || l.lastIndex() != 6 || len(l.entries) != 0 {
+		t.Errorf("Expected a snapshot beyond the log to replace it, removed %d, log ends at %d", len(removed), l.lastIndex())
+	}
+}
+
+func TestLogConfiguration(t *testing.T) {
+	l := makeTestLog(1, 1)
+	l.append(&Entry{Index: 3, Term: 1, Type: Entry_CONFIGURATION, Configuration: &Configuration{Members: []uint64{0, 1, 2, 3}}})
+	l.append(&Entry{Index: 4, Term: 1})
+
+	if members := l.configuration(2).Members; !reflect.DeepEqual(members, []uint64{0, 1, 2}) {
+		t.Errorf("Expected the configuration of the snapshot below the change, got %v", members)
+	}
+	if members := l.configuration(4).Members; !reflect.DeepEqual(members, []uint64{0, 1, 2, 3}) {
+		t.Errorf("Expected the changed configuration from its entry on, got %v", members)
+	}
+	if !l.pendingConfiguration(2) || l.pendingConfiguration(3) {
+		t.Errorf("Expected the change to be pending until entry 3 commits")
+	}
+}
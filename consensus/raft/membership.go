@@ -0,0 +1,85 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package raft
+
+import (
+	"sort"
+
+	"github.com/hyperledger/fabric/consensus/util/election"
+)
+
+// The membership changes one validator at a time, so that a majority of the
+// old members and one of the new members always intersect.  The leader
+// orders a change as a configuration entry, which every replica applies as
+// soon as it is in its log, and the leader orders no further change before
+// it committed.  A validator which is added starts with an empty log and
+// catches up from the leader, through the snapshot if the log was
+// compacted.  A leader which removed itself steps down once the change
+// committed, and a removed validator starts no further elections.
+
+// proposeMembership has the leader order adding or removing a validator
+func (instance *raftCore) proposeMembership(id uint64, add bool) {
+	if instance.term.Role() != election.Leader {
+		logger.Warningf("Replica %d is not the leader, ignoring membership change of replica %d", instance.id, id)
+		return
+	}
+	if instance.log.pendingConfiguration(instance.commitIndex) {
+		logger.Warningf("Leader %d ignoring membership change of replica %d, an earlier change has not committed yet", instance.id, id)
+		return
+	}
+
+	var members []uint64
+	if add {
+		if instance.isMember(id) {
+			logger.Warningf("Leader %d ignoring addition of replica %d, it is a member", instance.id, id)
+			return
+		}
+		members = append(append(members, instance.members...), id)
+	} else {
+		if !instance.isMember(id) {
+			logger.Warningf("Leader %d ignoring removal of replica %d, it is not a member", instance.id, id)
+			return
+		}
+		if len(instance.members) == 1 {
+			logger.Warningf("Leader %d ignoring removal of replica %d, it is the last member", instance.id, id)
+			return
+		}
+		for _, member := range instance.members {
+			if member != id {
+				members = append(members, member)
+			}
+		}
+	}
+	sort.Sort(replicaIDs(members))
+
+	logger.Infof("Leader %d changing the membership from %v to %v", instance.id, instance.members, members)
+	instance.appendEntry(&Entry{Type: Entry_CONFIGURATION, Configuration: &Configuration{Members: members}})
+	instance.broadcastAppend()
+	instance.maybeCommit()
+}
+
+type replicaIDs []uint64
+
+func (a replicaIDs) Len() int {
+	return len(a)
+}
+func (a replicaIDs) Swap(i, j int) {
+	a[i], a[j] = a[j], a[i]
+}
+func (a replicaIDs) Less(i, j int) bool {
+	return a[i] < a[j]
+}
@@ -0,0 +1,393 @@
+// Code generated by protoc-gen-go.
+// source: messages.proto
+// DO NOT EDIT!
+
+/*
+Package raft is a generated protocol buffer package.
+
+It is generated from these files:
+	messages.proto
+
+It has these top-level messages:
+	Message
+	Entry
+	Configuration
+	VoteRequest
+	VoteResponse
+	AppendEntries
+	AppendResponse
+	InstallSnapshot
+	Snapshot
+	HardState
+	Metadata
+*/
+package raft
+
+import proto "github.com/golang/protobuf/proto"
+import fmt "fmt"
+import math "math"
+
+// Reference imports to suppress errors if they are not otherwise used.
+var _ = proto.Marshal
+var _ = fmt.Errorf
+var _ = math.Inf
+
+type Entry_Type int32
+
+const (
+	Entry_BLOCK         Entry_Type = 0
+	Entry_CONFIGURATION Entry_Type = 1
+	Entry_NOOP          Entry_Type = 2
+)
+
+var Entry_Type_name = map[int32]string{
+	0: "BLOCK",
+	1: "CONFIGURATION",
+	2: "NOOP",
+}
+var Entry_Type_value = map[string]int32{
+	"BLOCK":         0,
+	"CONFIGURATION": 1,
+	"NOOP":          2,
+}
+
+func (x Entry_Type) String() string {
+	return proto.EnumName(Entry_Type_name, int32(x))
+}
+
+type Message struct {
+	// Types that are valid to be assigned to Payload:
+	//	*Message_VoteRequest
+	//	*Message_VoteResponse
+	//	*Message_AppendEntries
+	//	*Message_AppendResponse
+	//	*Message_InstallSnapshot
+	//	*Message_Request
+	Payload isMessage_Payload `protobuf_oneof:"payload"`
+}
+
+func (m *Message) Reset()         { *m = Message{} }
+func (m *Message) String() string { return proto.CompactTextString(m) }
+func (*Message) ProtoMessage()    {}
+
+type isMessage_Payload interface {
+	isMessage_Payload()
+}
+
+type Message_VoteRequest struct {
+	VoteRequest *VoteRequest `protobuf:"bytes,1,opt,name=vote_request,oneof"`
+}
+type Message_VoteResponse struct {
+	VoteResponse *VoteResponse `protobuf:"bytes,2,opt,name=vote_response,oneof"`
+}
+type Message_AppendEntries struct {
+	AppendEntries *AppendEntries `protobuf:"bytes,3,opt,name=append_entries,oneof"`
+}
+type Message_AppendResponse struct {
+	AppendResponse *AppendResponse `protobuf:"bytes,4,opt,name=append_response,oneof"`
+}
+type Message_InstallSnapshot struct {
+	InstallSnapshot *InstallSnapshot `protobuf:"bytes,5,opt,name=install_snapshot,oneof"`
+}
+type Message_Request struct {
+	Request []byte `protobuf:"bytes,6,opt,name=request,proto3,oneof"`
+}
+
+func (*Message_VoteRequest) isMessage_Payload()     {}
+func (*Message_VoteResponse) isMessage_Payload()    {}
+func (*Message_AppendEntries) isMessage_Payload()   {}
+func (*Message_AppendResponse) isMessage_Payload()  {}
+func (*Message_InstallSnapshot) isMessage_Payload() {}
+func (*Message_Request) isMessage_Payload()         {}
+
+func (m *Message) GetPayload() isMessage_Payload {
+	if m != nil {
+		return m.Payload
+	}
+	return nil
+}
+
+func (m *Message) GetVoteRequest() *VoteRequest {
+	if x, ok := m.GetPayload().(*Message_VoteRequest); ok {
+		return x.VoteRequest
+	}
+	return nil
+}
+
+func (m *Message) GetVoteResponse() *VoteResponse {
+	if x, ok := m.GetPayload().(*Message_VoteResponse); ok {
+		return x.VoteResponse
+	}
+	return nil
+}
+
+func (m *Message) GetAppendEntries() *AppendEntries {
+	if x, ok := m.GetPayload().(*Message_AppendEntries); ok {
+		return x.AppendEntries
+	}
+	return nil
+}
+
+func (m *Message) GetAppendResponse() *AppendResponse {
+	if x, ok := m.GetPayload().(*Message_AppendResponse); ok {
+		return x.AppendResponse
+	}
+	return nil
+}
+
+func (m *Message) GetInstallSnapshot() *InstallSnapshot {
+	if x, ok := m.GetPayload().(*Message_InstallSnapshot); ok {
+		return x.InstallSnapshot
+	}
+	return nil
+}
+
+func (m *Message) GetRequest() []byte {
+	if x, ok := m.GetPayload().(*Message_Request); ok {
+		return x.Request
+	}
+	return nil
+}
+
+// XXX_OneofFuncs is for the internal use of the proto package.
+func (*Message) XXX_OneofFuncs() (func(msg proto.Message, b *proto.Buffer) error, func(msg proto.Message, tag, wire int, b *proto.Buffer) (bool, error), []interface{}) {
+	return _Message_OneofMarshaler, _Message_OneofUnmarshaler, []interface{}{
+		(*Message_VoteRequest)(nil),
+		(*Message_VoteResponse)(nil),
+		(*Message_AppendEntries)(nil),
+		(*Message_AppendResponse)(nil),
+		(*Message_InstallSnapshot)(nil),
+		(*Message_Request)(nil),
+	}
+}
+
+func _Message_OneofMarshaler(msg proto.Message, b *proto.Buffer) error {
+	m := msg.(*Message)
+	// payload
+	switch x := m.Payload.(type) {
+	case *Message_VoteRequest:
+		b.EncodeVarint(1<<3 | proto.WireBytes)
+		if err := b.EncodeMessage(x.VoteRequest); err != nil {
+			return err
+		}
+	case *Message_VoteResponse:
+		b.EncodeVarint(2<<3 | proto.WireBytes)
+		if err := b.EncodeMessage(x.VoteResponse); err != nil {
+			return err
+		}
+	case *Message_AppendEntries:
+		b.EncodeVarint(3<<3 | proto.WireBytes)
+		if err := b.EncodeMessage(x.AppendEntries); err != nil {
+			return err
+		}
+	case *Message_AppendResponse:
+		b.EncodeVarint(4<<3 | proto.WireBytes)
+		if err := b.EncodeMessage(x.AppendResponse); err != nil {
+			return err
+		}
+	case *Message_InstallSnapshot:
+		b.EncodeVarint(5<<3 | proto.WireBytes)
+		if err := b.EncodeMessage(x.InstallSnapshot); err != nil {
+			return err
+		}
+	case *Message_Request:
+		b.EncodeVarint(6<<3 | proto.WireBytes)
+		b.EncodeRawBytes(x.Request)
+	case nil:
+	default:
+		return fmt.Errorf("Message.Payload has unexpected type %T", x)
+	}
+	return nil
+}
+
+func _Message_OneofUnmarshaler(msg proto.Message, tag, wire int, b *proto.Buffer) (bool, error) {
+	m := msg.(*Message)
+	switch tag {
+	case 1: // payload.vote_request
+		if wire != proto.WireBytes {
+			return true, proto.ErrInternalBadWireType
+		}
+		msg := new(VoteRequest)
+		err := b.DecodeMessage(msg)
+		m.Payload = &Message_VoteRequest{msg}
+		return true, err
+	case 2: // payload.vote_response
+		if wire != proto.WireBytes {
+			return true, proto.ErrInternalBadWireType
+		}
+		msg := new(VoteResponse)
+		err := b.DecodeMessage(msg)
+		m.Payload = &Message_VoteResponse{msg}
+		return true, err
+	case 3: // payload.append_entries
+		if wire != proto.WireBytes {
+			return true, proto.ErrInternalBadWireType
+		}
+		msg := new(AppendEntries)
+		err := b.DecodeMessage(msg)
+		m.Payload = &Message_AppendEntries{msg}
+		return true, err
+	case 4: // payload.append_response
+		if wire != proto.WireBytes {
+			return true, proto.ErrInternalBadWireType
+		}
+		msg := new(AppendResponse)
+		err := b.DecodeMessage(msg)
+		m.Payload = &Message_AppendResponse{msg}
+		return true, err
+	case 5: // payload.install_snapshot
+		if wire != proto.WireBytes {
+			return true, proto.ErrInternalBadWireType
+		}
+		msg := new(InstallSnapshot)
+		err := b.DecodeMessage(msg)
+		m.Payload = &Message_InstallSnapshot{msg}
+		return true, err
+	case 6: // payload.request
+		if wire != proto.WireBytes {
+			return true, proto.ErrInternalBadWireType
+		}
+		x, err := b.DecodeRawBytes(true)
+		m.Payload = &Message_Request{x}
+		return true, err
+	default:
+		return false, nil
+	}
+}
+
+type Entry struct {
+	Type          Entry_Type     `protobuf:"varint,1,opt,name=type,enum=raft.Entry_Type" json:"type,omitempty"`
+	Term          uint64         `protobuf:"varint,2,opt,name=term" json:"term,omitempty"`
+	Index         uint64         `protobuf:"varint,3,opt,name=index" json:"index,omitempty"`
+	Requests      [][]byte       `protobuf:"bytes,4,rep,name=requests,proto3" json:"requests,omitempty"`
+	Configuration *Configuration `protobuf:"bytes,5,opt,name=configuration" json:"configuration,omitempty"`
+}
+
+func (m *Entry) Reset()         { *m = Entry{} }
+func (m *Entry) String() string { return proto.CompactTextString(m) }
+func (*Entry) ProtoMessage()    {}
+
+func (m *Entry) GetConfiguration() *Configuration {
+	if m != nil {
+		return m.Configuration
+	}
+	return nil
+}
+
+type Configuration struct {
+	Members []uint64 `protobuf:"varint,1,rep,name=members" json:"members,omitempty"`
+}
+
+func (m *Configuration) Reset()         { *m = Configuration{} }
+func (m *Configuration) String() string { return proto.CompactTextString(m) }
+func (*Configuration) ProtoMessage()    {}
+
+type VoteRequest struct {
+	Term         uint64 `protobuf:"varint,1,opt,name=term" json:"term,omitempty"`
+	CandidateId  uint64 `protobuf:"varint,2,opt,name=candidate_id" json:"candidate_id,omitempty"`
+	LastLogIndex uint64 `protobuf:"varint,3,opt,name=last_log_index" json:"last_log_index,omitempty"`
+	LastLogTerm  uint64 `protobuf:"varint,4,opt,name=last_log_term" json:"last_log_term,omitempty"`
+}
+
+func (m *VoteRequest) Reset()         { *m = VoteRequest{} }
+func (m *VoteRequest) String() string { return proto.CompactTextString(m) }
+func (*VoteRequest) ProtoMessage()    {}
+
+type VoteResponse struct {
+	Term      uint64 `protobuf:"varint,1,opt,name=term" json:"term,omitempty"`
+	ReplicaId uint64 `protobuf:"varint,2,opt,name=replica_id" json:"replica_id,omitempty"`
+	Granted   bool   `protobuf:"varint,3,opt,name=granted" json:"granted,omitempty"`
+}
+
+func (m *VoteResponse) Reset()         { *m = VoteResponse{} }
+func (m *VoteResponse) String() string { return proto.CompactTextString(m) }
+func (*VoteResponse) ProtoMessage()    {}
+
+type AppendEntries struct {
+	Term         uint64   `protobuf:"varint,1,opt,name=term" json:"term,omitempty"`
+	LeaderId     uint64   `protobuf:"varint,2,opt,name=leader_id" json:"leader_id,omitempty"`
+	PrevLogIndex uint64   `protobuf:"varint,3,opt,name=prev_log_index" json:"prev_log_index,omitempty"`
+	PrevLogTerm  uint64   `protobuf:"varint,4,opt,name=prev_log_term" json:"prev_log_term,omitempty"`
+	Entries      []*Entry `protobuf:"bytes,5,rep,name=entries" json:"entries,omitempty"`
+	LeaderCommit uint64   `protobuf:"varint,6,opt,name=leader_commit" json:"leader_commit,omitempty"`
+}
+
+func (m *AppendEntries) Reset()         { *m = AppendEntries{} }
+func (m *AppendEntries) String() string { return proto.CompactTextString(m) }
+func (*AppendEntries) ProtoMessage()    {}
+
+func (m *AppendEntries) GetEntries() []*Entry {
+	if m != nil {
+		return m.Entries
+	}
+	return nil
+}
+
+type AppendResponse struct {
+	Term       uint64 `protobuf:"varint,1,opt,name=term" json:"term,omitempty"`
+	ReplicaId  uint64 `protobuf:"varint,2,opt,name=replica_id" json:"replica_id,omitempty"`
+	Success    bool   `protobuf:"varint,3,opt,name=success" json:"success,omitempty"`
+	MatchIndex uint64 `protobuf:"varint,4,opt,name=match_index" json:"match_index,omitempty"`
+}
+
+func (m *AppendResponse) Reset()         { *m = AppendResponse{} }
+func (m *AppendResponse) String() string { return proto.CompactTextString(m) }
+func (*AppendResponse) ProtoMessage()    {}
+
+type InstallSnapshot struct {
+	Term     uint64    `protobuf:"varint,1,opt,name=term" json:"term,omitempty"`
+	LeaderId uint64    `protobuf:"varint,2,opt,name=leader_id" json:"leader_id,omitempty"`
+	Snapshot *Snapshot `protobuf:"bytes,3,opt,name=snapshot" json:"snapshot,omitempty"`
+}
+
+func (m *InstallSnapshot) Reset()         { *m = InstallSnapshot{} }
+func (m *InstallSnapshot) String() string { return proto.CompactTextString(m) }
+func (*InstallSnapshot) ProtoMessage()    {}
+
+func (m *InstallSnapshot) GetSnapshot() *Snapshot {
+	if m != nil {
+		return m.Snapshot
+	}
+	return nil
+}
+
+type Snapshot struct {
+	Index          uint64         `protobuf:"varint,1,opt,name=index" json:"index,omitempty"`
+	Term           uint64         `protobuf:"varint,2,opt,name=term" json:"term,omitempty"`
+	Configuration  *Configuration `protobuf:"bytes,3,opt,name=configuration" json:"configuration,omitempty"`
+	BlockchainInfo []byte         `protobuf:"bytes,4,opt,name=blockchain_info,proto3" json:"blockchain_info,omitempty"`
+}
+
+func (m *Snapshot) Reset()         { *m = Snapshot{} }
+func (m *Snapshot) String() string { return proto.CompactTextString(m) }
+func (*Snapshot) ProtoMessage()    {}
+
+func (m *Snapshot) GetConfiguration() *Configuration {
+	if m != nil {
+		return m.Configuration
+	}
+	return nil
+}
+
+type HardState struct {
+	Term     uint64 `protobuf:"varint,1,opt,name=term" json:"term,omitempty"`
+	VotedFor uint64 `protobuf:"varint,2,opt,name=voted_for" json:"voted_for,omitempty"`
+	Voted    bool   `protobuf:"varint,3,opt,name=voted" json:"voted,omitempty"`
+}
+
+func (m *HardState) Reset()         { *m = HardState{} }
+func (m *HardState) String() string { return proto.CompactTextString(m) }
+func (*HardState) ProtoMessage()    {}
+
+type Metadata struct {
+	Index uint64 `protobuf:"varint,1,opt,name=index" json:"index,omitempty"`
+	Term  uint64 `protobuf:"varint,2,opt,name=term" json:"term,omitempty"`
+}
+
+func (m *Metadata) Reset()         { *m = Metadata{} }
+func (m *Metadata) String() string { return proto.CompactTextString(m) }
+func (*Metadata) ProtoMessage()    {}
+
+func init() {
+	proto.RegisterEnum("raft.Entry_Type", Entry_Type_name, Entry_Type_value)
+}
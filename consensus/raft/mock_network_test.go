@@ -0,0 +1,271 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package raft
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/spf13/viper"
+
+	"github.com/hyperledger/fabric/consensus/util"
+	"github.com/hyperledger/fabric/consensus/util/events"
+	pb "github.com/hyperledger/fabric/protos"
+)
+
+// testTimer only fires when a test fires it
+type testTimer struct {
+	armed bool
+	event events.Event
+}
+
+func (t *testTimer) SoftReset(duration time.Duration, event events.Event) {
+	if !t.armed {
+		t.Reset(duration, event)
+	}
+}
+
+func (t *testTimer) Reset(duration time.Duration, event events.Event) {
+	t.armed = true
+	t.event = event
+}
+
+func (t *testTimer) Stop() {
+	t.armed = false
+}
+
+func (t *testTimer) Halt() {}
+
+type testTimerFactory struct{}
+
+func (etf testTimerFactory) CreateTimer() events.Timer {
+	return &testTimer{}
+}
+
+// testReplica stands for the stack of a replica, its ledger holds the
+// entries it committed as blocks
+type testReplica struct {
+	id      uint64
+	net     *testNetwork
+	config  *viper.Viper
+	raft    *raftCore
+	state   map[string][]byte
+	ledger  []*Entry
+	meta    *Metadata
+	down    bool
+	skipped int // number of state transfers
+}
+
+type testEvent struct {
+	dst   uint64
+	event events.Event
+}
+
+// testNetwork delivers the messages of its replicas in order, until a test
+// fires a timer
+type testNetwork struct {
+	replicas map[uint64]*testReplica
+	queue    []testEvent
+	filterFn func(src, dst uint64, msg *Message) bool
+}
+
+func loadTestConfig() *viper.Viper {
+	config := loadConfig()
+	config.Set("general.batchsize", 1)
+	return config
+}
+
+func newTestNetwork(n int, config *viper.Viper) *testNetwork {
+	net := &testNetwork{replicas: make(map[uint64]*testReplica)}
+	for id := uint64(0); id < uint64(n); id++ {
+		net.addReplica(id, config)
+	}
+	return net
+}
+
+func (net *testNetwork) addReplica(id uint64, config *viper.Viper) *testReplica {
+	r := &testReplica{id: id, net: net, config: config, state: make(map[string][]byte)}
+	r.raft = newRaftCore(id, config, r, testTimerFactory{})
+	net.replicas[id] = r
+	return r
+}
+
+// restart replaces the raft-core of a replica, keeping its persisted state
+// and ledger
+func (net *testNetwork) restart(id uint64) *testReplica {
+	r := net.replicas[id]
+	r.raft = newRaftCore(id, r.config, r, testTimerFactory{})
+	r.down = false
+	return r
+}
+
+func (net *testNetwork) send(src, dst uint64, msg *Message) {
+	if net.filterFn != nil && !net.filterFn(src, dst, msg) {
+		return
+	}
+	// copy the message, as the network would
+	raw, _ := proto.Marshal(msg)
+	copied := &Message{}
+	proto.Unmarshal(raw, copied)
+	net.queue = append(net.queue, testEvent{dst, raftMessageEvent{msg: copied, sender: src}})
+}
+
+// process delivers the queued events until none are left
+func (net *testNetwork) process() {
+	for i := 0; len(net.queue) > 0; i++ {
+		if i > 100000 {
+			panic("the network did not settle")
+		}
+		next := net.queue[0]
+		net.queue = net.queue[1:]
+		r, ok := net.replicas[next.dst]
+		if !ok || r.down {
+			continue
+		}
+		r.raft.ProcessEvent(next.event)
+	}
+}
+
+// fire fires a timer of a replica if it is armed, and processes the events
+// which follow
+func (net *testNetwork) fire(r *testReplica, timer events.Timer) {
+	t := timer.(*testTimer)
+	if !t.armed || r.down {
+		return
+	}
+	t.armed = false
+	net.queue = append(net.queue, testEvent{r.id, t.event})
+	net.process()
+}
+
+// elect has a replica start an election
+func (net *testNetwork) elect(id uint64) {
+	r := net.replicas[id]
+	net.fire(r, r.raft.electionTimer)
+}
+
+// heartbeat has the leaders send their appends
+func (net *testNetwork) heartbeat() {
+	for _, r := range net.replicas {
+		net.fire(r, r.raft.heartbeatTimer)
+	}
+}
+
+// submit has a replica receive a client request
+func (net *testNetwork) submit(id uint64, tag int) {
+	tx, _ := proto.Marshal(&pb.Transaction{Uuid: fmt.Sprintf("tx%d", tag)})
+	net.queue = append(net.queue, testEvent{id, requestEvent(tx)})
+	net.process()
+}
+
+func (r *testReplica) txIDs() []string {
+	var ids []string
+	for _, entry := range r.ledger {
+		for _, req := range entry.Requests {
+			tx := &pb.Transaction{}
+			proto.Unmarshal(req, tx)
+			ids = append(ids, tx.Uuid)
+		}
+	}
+	return ids
+}
+
+// =============================================================================
+// innerStack interface
+// =============================================================================
+
+func (r *testReplica) broadcast(msg *Message) {
+	for id := range r.net.replicas {
+		if id != r.id {
+			r.net.send(r.id, id, msg)
+		}
+	}
+}
+
+func (r *testReplica) unicast(msg *Message, receiverID uint64) error {
+	r.net.send(r.id, receiverID, msg)
+	return nil
+}
+
+func (r *testReplica) execute(entry *Entry) {
+	r.ledger = append(r.ledger, entry)
+	r.meta = &Metadata{Index: entry.Index, Term: entry.Term}
+	r.net.queue = append(r.net.queue, testEvent{r.id, appliedEvent{entry.Index}})
+}
+
+func (r *testReplica) skipTo(snapshot *Snapshot, replicas []uint64) error {
+	height, err := strconv.Atoi(strings.TrimPrefix(string(snapshot.BlockchainInfo), "height="))
+	if err != nil {
+		return err
+	}
+	src := r.net.replicas[replicas[0]]
+	r.ledger = append([]*Entry(nil), src.ledger[:height]...)
+	r.meta = &Metadata{Index: snapshot.Index, Term: snapshot.Term}
+	r.skipped++
+	r.net.queue = append(r.net.queue, testEvent{r.id, stateUpdatedEvent{snapshot: snapshot, target: &pb.BlockchainInfo{Height: uint64(height)}}})
+	return nil
+}
+
+func (r *testReplica) invalidateState() {}
+
+func (r *testReplica) validateState() {}
+
+func (r *testReplica) getState() []byte {
+	return []byte(fmt.Sprintf("height=%d", len(r.ledger)))
+}
+
+func (r *testReplica) getLastApplied() (*Metadata, error) {
+	if r.meta == nil {
+		return &Metadata{}, nil
+	}
+	return r.meta, nil
+}
+
+func (r *testReplica) StoreState(key string, value []byte) error {
+	r.state[key] = value
+	return nil
+}
+
+func (r *testReplica) ReadState(key string) ([]byte, error) {
+	if val, ok := r.state[key]; ok {
+		return val, nil
+	}
+	return nil, fmt.Errorf("cannot find key %s", key)
+}
+
+func (r *testReplica) ReadStateSet(prefix string) (map[string][]byte, error) {
+	ret := make(map[string][]byte)
+	for key, val := range r.state {
+		if strings.HasPrefix(key, prefix) {
+			ret[key] = val
+		}
+	}
+	return ret, nil
+}
+
+func (r *testReplica) IterateState(prefix string, visit func(key string, value []byte) bool) error {
+	state, _ := r.ReadStateSet(prefix)
+	util.IterateStateSet(state, visit)
+	return nil
+}
+
+func (r *testReplica) DelState(key string) {
+	delete(r.state, key)
+}
@@ -0,0 +1,718 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package raft
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/hyperledger/fabric/consensus"
+	"github.com/hyperledger/fabric/consensus/util/election"
+	"github.com/hyperledger/fabric/consensus/util/events"
+	pb "github.com/hyperledger/fabric/protos"
+	"github.com/spf13/viper"
+)
+
+// =============================================================================
+// init
+// =============================================================================
+
+// The replicas elect a leader which orders the transactions: it batches them
+// into log entries and replicates the entries to the followers.  An entry is
+// committed once a majority of the members stored it, and every replica then
+// executes and commits it as a block.  The block carries the index of its
+// entry, so that a restarting replica knows which entries its ledger holds.
+// This is the Raft protocol of Ongaro and Ousterhout; it tolerates crashes of
+// fewer than half of the members, but not byzantine replicas.
+
+// =============================================================================
+// custom interfaces and structure definitions
+// =============================================================================
+
+type innerStack interface {
+	broadcast(msg *Message)
+	unicast(msg *Message, receiverID uint64) error
+	execute(entry *Entry)
+	skipTo(snapshot *Snapshot, replicas []uint64) error
+	invalidateState()
+	validateState()
+	getState() []byte
+	getLastApplied() (*Metadata, error)
+
+	consensus.StatePersistor
+}
+
+// raftMessageEvent is sent when a Raft message is received
+type raftMessageEvent struct {
+	msg    *Message
+	sender uint64
+}
+
+// requestEvent is sent when a client transaction is to be ordered
+type requestEvent []byte
+
+// heartbeatTimerEvent is sent when the leader should send its appends
+type heartbeatTimerEvent struct{}
+
+// batchTimerEvent is sent when the batch timer expires
+type batchTimerEvent struct{}
+
+// appliedEvent is sent when the block of an entry was committed
+type appliedEvent struct {
+	index uint64
+}
+
+// stateUpdatedEvent is sent when state transfer to a snapshot completes, the
+// target is nil if it failed
+type stateUpdatedEvent struct {
+	snapshot *Snapshot
+	target   *pb.BlockchainInfo
+}
+
+// membershipEvent is sent when a validator should be added to or removed
+// from the membership
+type membershipEvent struct {
+	id  uint64
+	add bool
+}
+
+type raftCore struct {
+	// internal data
+	id       uint64     // replica ID
+	consumer innerStack // execution and messaging
+
+	// persisted state
+	term *election.Term // current term, our vote in it, which are persisted, and our role and leader
+	log  *raftLog       // entries since the last snapshot
+
+	// volatile state
+	detector     *election.Detector // suspects the leader, or on the leader its contact to a majority
+	members      []uint64           // configuration of the latest configuration entry, sorted
+	commitIndex  uint64             // highest entry known to be committed
+	lastApplied  uint64             // highest entry committed to the ledger
+	applying     bool               // whether an entry is being executed
+	transferring bool               // whether the ledger is transferred to a snapshot
+
+	// leader state
+	nextIndex  map[uint64]uint64 // next entry to send to each member
+	matchIndex map[uint64]uint64 // highest entry known to be stored by each member
+	batch      [][]byte          // requests for the next entry
+
+	forward [][]byte // follower: requests held until a leader is known
+
+	// configuration
+	batchSize        int
+	snapshotInterval uint64
+	maxAppend        int
+	electionTimeout  time.Duration
+	heartbeatTimeout time.Duration
+	batchTimeout     time.Duration
+
+	electionTimer  events.Timer
+	heartbeatTimer events.Timer
+	batchTimer     events.Timer
+}
+
+// =============================================================================
+// constructors
+// =============================================================================
+
+func newRaftCore(id uint64, config *viper.Viper, consumer innerStack, etf events.TimerFactory) *raftCore {
+	var err error
+	instance := &raftCore{}
+	instance.id = id
+	instance.consumer = consumer
+
+	instance.electionTimer = etf.CreateTimer()
+	instance.heartbeatTimer = etf.CreateTimer()
+	instance.batchTimer = etf.CreateTimer()
+
+	instance.batchSize = config.GetInt("general.batchsize")
+	instance.snapshotInterval = uint64(config.GetInt("general.snapshotinterval"))
+	instance.maxAppend = config.GetInt("general.maxappendentries")
+	instance.electionTimeout, err = time.ParseDuration(config.GetString("general.timeout.election"))
+	if err != nil {
+		panic(fmt.Errorf("Cannot parse election timeout: %s", err))
+	}
+	instance.heartbeatTimeout, err = time.ParseDuration(config.GetString("general.timeout.heartbeat"))
+	if err != nil {
+		panic(fmt.Errorf("Cannot parse heartbeat timeout: %s", err))
+	}
+	instance.batchTimeout, err = time.ParseDuration(config.GetString("general.timeout.batch"))
+	if err != nil {
+		panic(fmt.Errorf("Cannot parse batch timeout: %s", err))
+	}
+	if instance.heartbeatTimeout >= instance.electionTimeout {
+		instance.heartbeatTimeout = instance.electionTimeout / 4
+		logger.Warningf("Configured heartbeat timeout must be below the election timeout, setting to %v", instance.heartbeatTimeout)
+	}
+	instance.term = election.NewTerm(id, instance.quorum)
+	instance.detector = election.NewDetector(instance.electionTimer, instance.electionTimeout, time.Now().UnixNano()+int64(id))
+
+	var initial []uint64
+	for i := uint64(0); i < uint64(config.GetInt("general.N")); i++ {
+		initial = append(initial, i)
+	}
+
+	logger.Infof("Raft replica %d initial members = %v", instance.id, initial)
+	logger.Infof("Raft batch size = %d", instance.batchSize)
+	logger.Infof("Raft snapshot interval = %d", instance.snapshotInterval)
+	logger.Infof("Raft election timeout = %v", instance.electionTimeout)
+	logger.Infof("Raft heartbeat timeout = %v", instance.heartbeatTimeout)
+	logger.Infof("Raft batch timeout = %v", instance.batchTimeout)
+
+	instance.restoreState(initial)
+	instance.detector.Reset()
+
+	return instance
+}
+
+// close tears down resources opened by newRaftCore
+func (instance *raftCore) close() {
+	instance.electionTimer.Halt()
+	instance.heartbeatTimer.Halt()
+	instance.batchTimer.Halt()
+}
+
+// =============================================================================
+// helper functions
+// =============================================================================
+
+func (instance *raftCore) isMember(id uint64) bool {
+	for _, member := range instance.members {
+		if member == id {
+			return true
+		}
+	}
+	return false
+}
+
+// quorum returns whether a majority of the members is in a set
+func (instance *raftCore) quorum(set map[uint64]bool) bool {
+	count := 0
+	for _, member := range instance.members {
+		if set[member] {
+			count++
+		}
+	}
+	return count > len(instance.members)/2
+}
+
+// setMembers makes a configuration current, it applies as soon as its entry
+// is in the log
+func (instance *raftCore) setMembers(configuration *Configuration) {
+	instance.members = append([]uint64(nil), configuration.Members...)
+	if instance.term.Role() != election.Leader {
+		return
+	}
+	for id := range instance.nextIndex {
+		if !instance.isMember(id) {
+			delete(instance.nextIndex, id)
+			delete(instance.matchIndex, id)
+		}
+	}
+	for _, id := range instance.members {
+		if _, ok := instance.nextIndex[id]; !ok && id != instance.id {
+			instance.nextIndex[id] = instance.log.lastIndex() + 1
+			instance.matchIndex[id] = 0
+		}
+	}
+}
+
+// =============================================================================
+// receive methods
+// =============================================================================
+
+// ProcessEvent serially processes the events of the replica
+func (instance *raftCore) ProcessEvent(e events.Event) events.Event {
+	switch et := e.(type) {
+	case raftMessageEvent:
+		if err := instance.recvMsg(et.msg, et.sender); err != nil {
+			logger.Warningf("Replica %d: %s", instance.id, err)
+		}
+	case requestEvent:
+		instance.recvRequest([]byte(et))
+	case election.TimeoutEvent:
+		instance.electionTimerHandler()
+	case heartbeatTimerEvent:
+		if instance.term.Role() == election.Leader {
+			instance.broadcastAppend()
+			instance.heartbeatTimer.Reset(instance.heartbeatTimeout, heartbeatTimerEvent{})
+		}
+	case batchTimerEvent:
+		instance.cutBatch()
+	case appliedEvent:
+		instance.entryApplied(et.index)
+	case stateUpdatedEvent:
+		instance.snapshotInstalled(et.snapshot, et.target != nil)
+	case membershipEvent:
+		instance.proposeMembership(et.id, et.add)
+	default:
+		logger.Warningf("Replica %d received an unknown message type (%T)", instance.id, et)
+	}
+	return nil
+}
+
+func (instance *raftCore) recvMsg(msg *Message, senderID uint64) error {
+	if req := msg.GetVoteRequest(); req != nil {
+		if senderID != req.CandidateId {
+			return fmt.Errorf("Sender ID included in vote request (%v) doesn't match ID corresponding to the receiving stream (%v)", req.CandidateId, senderID)
+		}
+		instance.recvVoteRequest(req)
+	} else if resp := msg.GetVoteResponse(); resp != nil {
+		if senderID != resp.ReplicaId {
+			return fmt.Errorf("Sender ID included in vote response (%v) doesn't match ID corresponding to the receiving stream (%v)", resp.ReplicaId, senderID)
+		}
+		instance.recvVoteResponse(resp)
+	} else if app := msg.GetAppendEntries(); app != nil {
+		if senderID != app.LeaderId {
+			return fmt.Errorf("Sender ID included in append entries (%v) doesn't match ID corresponding to the receiving stream (%v)", app.LeaderId, senderID)
+		}
+		instance.recvAppendEntries(app)
+	} else if resp := msg.GetAppendResponse(); resp != nil {
+		if senderID != resp.ReplicaId {
+			return fmt.Errorf("Sender ID included in append response (%v) doesn't match ID corresponding to the receiving stream (%v)", resp.ReplicaId, senderID)
+		}
+		instance.recvAppendResponse(resp)
+	} else if snap := msg.GetInstallSnapshot(); snap != nil {
+		if senderID != snap.LeaderId {
+			return fmt.Errorf("Sender ID included in install snapshot (%v) doesn't match ID corresponding to the receiving stream (%v)", snap.LeaderId, senderID)
+		}
+		instance.recvInstallSnapshot(snap)
+	} else if req := msg.GetRequest(); req != nil {
+		instance.recvRequest(req)
+	} else {
+		return fmt.Errorf("Invalid message from replica %d: %v", senderID, msg)
+	}
+	return nil
+}
+
+// becomeFollower moves the replica to a term, as a follower of a leader yet
+// to be learnt
+func (instance *raftCore) becomeFollower(term uint64) {
+	if instance.term.Role() == election.Leader {
+		logger.Infof("Replica %d stepping down as leader in term %d", instance.id, instance.term.Current())
+		instance.heartbeatTimer.Stop()
+		instance.batchTimer.Stop()
+		instance.forward = append(instance.batch, instance.forward...)
+		instance.batch = nil
+		instance.nextIndex = nil
+		instance.matchIndex = nil
+	}
+	if instance.term.Observe(term) {
+		instance.persistHardState()
+	}
+	instance.term.StepDown()
+	instance.detector.Reset()
+}
+
+// setLeader records the leader of the current term, and forwards it the
+// requests held until then
+func (instance *raftCore) setLeader(id uint64) {
+	instance.detector.HeardLeader()
+	if !instance.term.Follow(id) {
+		return
+	}
+	logger.Infof("Replica %d following leader %d in term %d", instance.id, id, instance.term.Current())
+
+	held := instance.forward
+	instance.forward = nil
+	for _, req := range held {
+		instance.recvRequest(req)
+	}
+}
+
+// =============================================================================
+// elections
+// =============================================================================
+
+// electionTimerHandler starts an election on a follower or candidate which
+// heard of no leader, and has a leader which lost the contact to a majority
+// step down
+func (instance *raftCore) electionTimerHandler() {
+	active := instance.detector.Active()
+	instance.detector.Expire()
+	if instance.term.Role() == election.Leader {
+		active[instance.id] = true
+		if !instance.quorum(active) {
+			logger.Warningf("Leader %d heard from no majority of %v within the election timeout", instance.id, instance.members)
+			instance.becomeFollower(instance.term.Current())
+			return
+		}
+		instance.detector.Reset()
+		return
+	}
+	instance.campaign()
+}
+
+func (instance *raftCore) campaign() {
+	instance.detector.Reset()
+	if !instance.isMember(instance.id) {
+		logger.Debugf("Replica %d is not a member of %v, not starting an election", instance.id, instance.members)
+		return
+	}
+
+	won := instance.term.Campaign()
+	instance.persistHardState()
+	logger.Infof("Replica %d starting an election for term %d", instance.id, instance.term.Current())
+
+	if won {
+		instance.becomeLeader()
+		return
+	}
+	instance.consumer.broadcast(&Message{Payload: &Message_VoteRequest{VoteRequest: &VoteRequest{
+		Term:         instance.term.Current(),
+		CandidateId:  instance.id,
+		LastLogIndex: instance.log.lastIndex(),
+		LastLogTerm:  instance.log.lastTerm(),
+	}}})
+}
+
+func (instance *raftCore) recvVoteRequest(req *VoteRequest) {
+	if req.Term > instance.term.Current() {
+		if instance.term.Role() == election.Leader || instance.detector.LeaderContact() {
+			// a removed or partitioned replica should not disrupt a working leader
+			logger.Debugf("Replica %d ignoring vote request of replica %d for term %d, it has a leader", instance.id, req.CandidateId, req.Term)
+			return
+		}
+		instance.becomeFollower(req.Term)
+	}
+
+	granted := instance.term.CanVote(req.CandidateId, req.Term) &&
+		instance.log.isUpToDate(req.LastLogIndex, req.LastLogTerm)
+	if granted {
+		logger.Debugf("Replica %d voting for replica %d in term %d", instance.id, req.CandidateId, req.Term)
+		instance.term.Vote(req.CandidateId)
+		instance.persistHardState()
+		instance.detector.Reset()
+	}
+	instance.consumer.unicast(&Message{Payload: &Message_VoteResponse{VoteResponse: &VoteResponse{
+		Term:      instance.term.Current(),
+		ReplicaId: instance.id,
+		Granted:   granted,
+	}}}, req.CandidateId)
+}
+
+func (instance *raftCore) recvVoteResponse(resp *VoteResponse) {
+	if resp.Term > instance.term.Current() {
+		instance.becomeFollower(resp.Term)
+		return
+	}
+	if resp.Granted && instance.term.Tally(resp.ReplicaId, resp.Term) {
+		instance.becomeLeader()
+	}
+}
+
+func (instance *raftCore) becomeLeader() {
+	logger.Infof("Replica %d elected leader for term %d by %v", instance.id, instance.term.Current(), instance.term.Voters())
+	instance.nextIndex = make(map[uint64]uint64)
+	instance.matchIndex = make(map[uint64]uint64)
+	instance.detector.Expire()
+	instance.setMembers(instance.log.configuration(instance.log.lastIndex()))
+
+	// entries of earlier terms only commit along with one of this term
+	instance.appendEntry(&Entry{Type: Entry_NOOP})
+	if len(instance.forward) > 0 {
+		instance.appendEntry(&Entry{Type: Entry_BLOCK, Requests: instance.forward})
+		instance.forward = nil
+	}
+
+	instance.broadcastAppend()
+	instance.maybeCommit()
+	instance.heartbeatTimer.Reset(instance.heartbeatTimeout, heartbeatTimerEvent{})
+}
+
+// =============================================================================
+// log replication
+// =============================================================================
+
+// recvRequest has the leader order a client request, other replicas forward
+// it to the leader
+func (instance *raftCore) recvRequest(req []byte) {
+	if instance.term.Role() == election.Leader {
+		instance.batch = append(instance.batch, req)
+		if len(instance.batch) >= instance.batchSize {
+			instance.cutBatch()
+			return
+		}
+		instance.batchTimer.SoftReset(instance.batchTimeout, batchTimerEvent{})
+		return
+	}
+	leader, ok := instance.term.Leader()
+	if !ok {
+		logger.Debugf("Replica %d holding request until it knows a leader", instance.id)
+		instance.forward = append(instance.forward, req)
+		return
+	}
+	logger.Debugf("Replica %d forwarding request to leader %d", instance.id, leader)
+	if err := instance.consumer.unicast(&Message{Payload: &Message_Request{Request: req}}, leader); err != nil {
+		logger.Warningf("Replica %d could not forward request to leader %d: %s", instance.id, leader, err)
+	}
+}
+
+// cutBatch has the leader order its batched requests as an entry
+func (instance *raftCore) cutBatch() {
+	instance.batchTimer.Stop()
+	if instance.term.Role() != election.Leader || len(instance.batch) == 0 {
+		return
+	}
+	logger.Debugf("Leader %d ordering %d requests", instance.id, len(instance.batch))
+	instance.appendEntry(&Entry{Type: Entry_BLOCK, Requests: instance.batch})
+	instance.batch = nil
+	instance.broadcastAppend()
+	instance.maybeCommit()
+}
+
+// appendEntry appends an entry to the leader's log
+func (instance *raftCore) appendEntry(entry *Entry) {
+	entry.Term = instance.term.Current()
+	entry.Index = instance.log.lastIndex() + 1
+	instance.log.append(entry)
+	instance.persistEntry(entry)
+	if entry.Type == Entry_CONFIGURATION {
+		instance.setMembers(entry.Configuration)
+	}
+}
+
+func (instance *raftCore) broadcastAppend() {
+	for _, id := range instance.members {
+		if id != instance.id {
+			instance.sendAppend(id)
+		}
+	}
+}
+
+// sendAppend sends the entries a member is missing, or the snapshot if they
+// were compacted
+func (instance *raftCore) sendAppend(id uint64) {
+	next := instance.nextIndex[id]
+	prevTerm, ok := instance.log.term(next - 1)
+	if !ok {
+		logger.Debugf("Leader %d sending snapshot %d to replica %d", instance.id, instance.log.snapshot.Index, id)
+		instance.consumer.unicast(&Message{Payload: &Message_InstallSnapshot{InstallSnapshot: &InstallSnapshot{
+			Term:     instance.term.Current(),
+			LeaderId: instance.id,
+			Snapshot: instance.log.snapshot,
+		}}}, id)
+		return
+	}
+
+	entries := instance.log.slice(next, instance.maxAppend)
+	instance.consumer.unicast(&Message{Payload: &Message_AppendEntries{AppendEntries: &AppendEntries{
+		Term:         instance.term.Current(),
+		LeaderId:     instance.id,
+		PrevLogIndex: next - 1,
+		PrevLogTerm:  prevTerm,
+		Entries:      entries,
+		LeaderCommit: instance.commitIndex,
+	}}}, id)
+	if len(entries) > 0 {
+		// pipeline the following entries, a lost append is answered by a rejection
+		instance.nextIndex[id] = entries[len(entries)-1].Index + 1
+	}
+}
+
+func (instance *raftCore) recvAppendEntries(app *AppendEntries) {
+	if app.Term < instance.term.Current() {
+		instance.sendAppendResponse(app.LeaderId, false, instance.log.lastIndex())
+		return
+	}
+	if app.Term > instance.term.Current() || instance.term.Role() != election.Follower {
+		instance.becomeFollower(app.Term)
+	}
+	instance.setLeader(app.LeaderId)
+	instance.detector.Reset()
+	if instance.transferring {
+		instance.sendAppendResponse(app.LeaderId, false, instance.log.lastIndex())
+		return
+	}
+
+	prevIndex, prevTerm, entries := app.PrevLogIndex, app.PrevLogTerm, app.Entries
+	if snapIndex := instance.log.snapshot.Index; prevIndex < snapIndex {
+		// the entries up to the snapshot committed, the leader has them as well
+		for len(entries) > 0 && entries[0].Index <= snapIndex {
+			entries = entries[1:]
+		}
+		prevIndex, prevTerm = snapIndex, instance.log.snapshot.Term
+	}
+
+	if term, ok := instance.log.term(prevIndex); !ok || term != prevTerm {
+		hint := instance.log.lastIndex()
+		if prevIndex <= hint {
+			hint = prevIndex - 1
+		}
+		logger.Debugf("Replica %d has no entry %d of term %d, rejecting append of leader %d", instance.id, prevIndex, prevTerm, app.LeaderId)
+		instance.sendAppendResponse(app.LeaderId, false, hint)
+		return
+	}
+
+	for _, entry := range entries {
+		if term, ok := instance.log.term(entry.Index); ok {
+			if term == entry.Term {
+				continue
+			}
+			if entry.Index <= instance.commitIndex {
+				logger.Errorf("Replica %d asked by leader %d to replace committed entry %d, ignoring", instance.id, app.LeaderId, entry.Index)
+				return
+			}
+			instance.truncateLog(entry.Index)
+		}
+		instance.log.append(entry)
+		instance.persistEntry(entry)
+		if entry.Type == Entry_CONFIGURATION {
+			instance.setMembers(entry.Configuration)
+		}
+	}
+
+	last := prevIndex + uint64(len(entries))
+	if app.LeaderCommit > instance.commitIndex && last > instance.commitIndex {
+		instance.commitIndex = app.LeaderCommit
+		if instance.commitIndex > last {
+			instance.commitIndex = last
+		}
+		instance.apply()
+	}
+	instance.sendAppendResponse(app.LeaderId, true, last)
+}
+
+// truncateLog removes the conflicting entries from an index on
+func (instance *raftCore) truncateLog(from uint64) {
+	removed := instance.log.truncate(from)
+	logger.Infof("Replica %d removing %d conflicting entries from index %d", instance.id, len(removed), from)
+	for _, entry := range removed {
+		instance.consumer.DelState(entryKey(entry.Index))
+	}
+	instance.setMembers(instance.log.configuration(instance.log.lastIndex()))
+}
+
+func (instance *raftCore) sendAppendResponse(leaderID uint64, success bool, matchIndex uint64) {
+	instance.consumer.unicast(&Message{Payload: &Message_AppendResponse{AppendResponse: &AppendResponse{
+		Term:       instance.term.Current(),
+		ReplicaId:  instance.id,
+		Success:    success,
+		MatchIndex: matchIndex,
+	}}}, leaderID)
+}
+
+func (instance *raftCore) recvAppendResponse(resp *AppendResponse) {
+	if resp.Term > instance.term.Current() {
+		instance.becomeFollower(resp.Term)
+		return
+	}
+	if instance.term.Role() != election.Leader || resp.Term != instance.term.Current() {
+		return
+	}
+	id := resp.ReplicaId
+	if _, ok := instance.nextIndex[id]; !ok {
+		return
+	}
+	instance.detector.Heard(id)
+
+	if resp.Success {
+		if resp.MatchIndex > instance.matchIndex[id] {
+			instance.matchIndex[id] = resp.MatchIndex
+		}
+		if instance.nextIndex[id] <= resp.MatchIndex {
+			instance.nextIndex[id] = resp.MatchIndex + 1
+		}
+		instance.maybeCommit()
+		if instance.nextIndex[id] <= instance.log.lastIndex() && instance.nextIndex[id] == resp.MatchIndex+1 {
+			instance.sendAppend(id)
+		}
+		return
+	}
+
+	// the hint is the last entry the member may have in common with us
+	if resp.MatchIndex+1 >= instance.nextIndex[id] {
+		return // stale rejection
+	}
+	instance.nextIndex[id] = resp.MatchIndex + 1
+	if instance.nextIndex[id] <= instance.matchIndex[id] {
+		instance.nextIndex[id] = instance.matchIndex[id] + 1
+	}
+	instance.sendAppend(id)
+}
+
+// maybeCommit has the leader commit the entries of its term which a majority
+// of the members stored
+func (instance *raftCore) maybeCommit() {
+	for n := instance.log.lastIndex(); n > instance.commitIndex; n-- {
+		if term, _ := instance.log.term(n); term != instance.term.Current() {
+			return
+		}
+		stored := map[uint64]bool{instance.id: true}
+		for id, match := range instance.matchIndex {
+			if match >= n {
+				stored[id] = true
+			}
+		}
+		if instance.quorum(stored) {
+			logger.Debugf("Leader %d committing entries %d to %d", instance.id, instance.commitIndex+1, n)
+			instance.commitIndex = n
+			instance.apply()
+			instance.broadcastAppend()
+			return
+		}
+	}
+}
+
+// =============================================================================
+// execution
+// =============================================================================
+
+// apply executes the committed entries in order, an entry with transactions
+// is committed as a block before the next is applied
+func (instance *raftCore) apply() {
+	for !instance.applying && !instance.transferring && instance.lastApplied < instance.commitIndex {
+		entry := instance.log.entry(instance.lastApplied + 1)
+		if entry == nil {
+			logger.Errorf("Replica %d is missing committed entry %d", instance.id, instance.lastApplied+1)
+			return
+		}
+		if entry.Type == Entry_BLOCK {
+			instance.applying = true
+			instance.consumer.execute(entry)
+			return
+		}
+		instance.lastApplied = entry.Index
+		instance.applied(entry)
+	}
+	instance.maybeSnapshot()
+}
+
+func (instance *raftCore) entryApplied(index uint64) {
+	if !instance.applying || index != instance.lastApplied+1 {
+		logger.Warningf("Replica %d ignoring unexpected completion of entry %d, it applied %d", instance.id, index, instance.lastApplied)
+		return
+	}
+	instance.applying = false
+	instance.lastApplied = index
+	instance.applied(instance.log.entry(index))
+	instance.apply()
+}
+
+// applied handles an entry which was committed and applied
+func (instance *raftCore) applied(entry *Entry) {
+	if entry == nil || entry.Type != Entry_CONFIGURATION {
+		return
+	}
+	logger.Infof("Replica %d committed configuration %v at entry %d", instance.id, entry.Configuration.Members, entry.Index)
+	if instance.term.Role() == election.Leader && !instance.isMember(instance.id) {
+		logger.Infof("Leader %d was removed from the membership", instance.id)
+		instance.becomeFollower(instance.term.Current())
+	}
+}
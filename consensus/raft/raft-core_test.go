@@ -0,0 +1,272 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package raft
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/hyperledger/fabric/consensus/util/election"
+)
+
+func TestElectLeader(t *testing.T) {
+	net := newTestNetwork(3, loadTestConfig())
+	net.elect(1)
+
+	for id, r := range net.replicas {
+		if leader, ok := r.raft.term.Leader(); r.raft.term.Current() != 1 || !ok || leader != 1 {
+			t.Errorf("Expected replica %d to know leader 1 in term 1, it is a %s in term %d", id, r.raft.term.Role(), r.raft.term.Current())
+		}
+	}
+	if net.replicas[1].raft.term.Role() != election.Leader {
+		t.Errorf("Expected replica 1 to be the leader, it is a %s", net.replicas[1].raft.term.Role())
+	}
+}
+
+func TestReplicateAndCommit(t *testing.T) {
+	net := newTestNetwork(3, loadTestConfig())
+	net.elect(0)
+
+	net.submit(0, 1)
+	net.submit(2, 2) // forwarded to the leader
+	net.submit(1, 3)
+
+	expected := []string{"tx1", "tx2", "tx3"}
+	for id, r := range net.replicas {
+		if txs := r.txIDs(); !reflect.DeepEqual(txs, expected) {
+			t.Errorf("Expected replica %d to commit %v, committed %v", id, expected, txs)
+		}
+	}
+}
+
+func TestHoldRequestsUntilLeader(t *testing.T) {
+	net := newTestNetwork(3, loadTestConfig())
+	net.submit(2, 1)
+	if len(net.replicas[2].raft.forward) != 1 {
+		t.Fatalf("Expected replica 2 to hold the request while it knows no leader")
+	}
+
+	net.elect(0)
+	for id, r := range net.replicas {
+		if txs := r.txIDs(); !reflect.DeepEqual(txs, []string{"tx1"}) {
+			t.Errorf("Expected replica %d to commit the held request, committed %v", id, txs)
+		}
+	}
+}
+
+func TestLeaderCrash(t *testing.T) {
+	net := newTestNetwork(3, loadTestConfig())
+	net.elect(0)
+	net.submit(0, 1)
+
+	net.replicas[0].down = true
+	for _, r := range net.replicas {
+		r.raft.detector.Expire() // the election timeout passed
+	}
+	net.elect(1)
+	if net.replicas[1].raft.term.Role() != election.Leader || net.replicas[1].raft.term.Current() != 2 {
+		t.Fatalf("Expected replica 1 to be elected by a majority for term 2, it is a %s in term %d", net.replicas[1].raft.term.Role(), net.replicas[1].raft.term.Current())
+	}
+	net.submit(2, 2)
+
+	net.restart(0)
+	net.heartbeat()
+	expected := []string{"tx1", "tx2"}
+	for id, r := range net.replicas {
+		if txs := r.txIDs(); !reflect.DeepEqual(txs, expected) {
+			t.Errorf("Expected replica %d to commit %v, committed %v", id, expected, txs)
+		}
+	}
+	if leader, _ := net.replicas[0].raft.term.Leader(); net.replicas[0].raft.term.Role() != election.Follower || leader != 1 {
+		t.Errorf("Expected the restarted replica 0 to follow leader 1, it is a %s following %d", net.replicas[0].raft.term.Role(), leader)
+	}
+}
+
+func TestStaleLogNotElected(t *testing.T) {
+	net := newTestNetwork(3, loadTestConfig())
+	net.elect(0)
+	net.filterFn = func(src, dst uint64, msg *Message) bool {
+		return src != 2 && dst != 2
+	}
+	net.submit(0, 1)
+	net.filterFn = nil
+
+	net.replicas[0].down = true
+	net.replicas[1].raft.detector.Expire()
+	net.elect(2)
+	if net.replicas[2].raft.term.Role() == election.Leader {
+		t.Fatalf("Expected replica 2 not to be elected without the committed entry")
+	}
+	net.elect(1)
+	if net.replicas[1].raft.term.Role() != election.Leader {
+		t.Fatalf("Expected replica 1 to be elected, it is a %s", net.replicas[1].raft.term.Role())
+	}
+	if txs := net.replicas[2].txIDs(); !reflect.DeepEqual(txs, []string{"tx1"}) {
+		t.Errorf("Expected replica 2 to commit the entry it missed, committed %v", txs)
+	}
+}
+
+func TestLeaderContactIgnoresVotes(t *testing.T) {
+	net := newTestNetwork(3, loadTestConfig())
+	net.elect(0)
+
+	// replica 2 missed the leader, it should not depose it
+	net.replicas[2].raft.detector.Expire()
+	net.elect(2)
+	if net.replicas[0].raft.term.Role() != election.Leader || net.replicas[0].raft.term.Current() != 1 {
+		t.Errorf("Expected replica 0 to stay leader of term 1, it is a %s in term %d", net.replicas[0].raft.term.Role(), net.replicas[0].raft.term.Current())
+	}
+	if net.replicas[1].raft.term.Current() != 1 {
+		t.Errorf("Expected replica 1 to stay in term 1, it is in term %d", net.replicas[1].raft.term.Current())
+	}
+}
+
+func TestLeaderStepsDownWithoutQuorum(t *testing.T) {
+	net := newTestNetwork(3, loadTestConfig())
+	net.elect(0)
+	net.replicas[1].down = true
+	net.replicas[2].down = true
+
+	l := net.replicas[0]
+	net.elect(0) // the election timer of the leader checks for a quorum
+	net.heartbeat()
+	net.elect(0)
+	if l.raft.term.Role() == election.Leader {
+		t.Errorf("Expected the leader to step down once it heard from no majority")
+	}
+}
+
+func TestRestartRestoresState(t *testing.T) {
+	net := newTestNetwork(3, loadTestConfig())
+	net.elect(0)
+	net.submit(0, 1)
+	net.submit(0, 2)
+
+	before := net.replicas[1].raft
+	after := net.restart(1).raft
+	if hard := after.term.HardState(); hard != before.term.HardState() || !hard.Voted {
+		t.Errorf("Expected term and vote %+v to be restored, got %+v", before.term.HardState(), hard)
+	}
+	if after.log.lastIndex() != before.log.lastIndex() || after.lastApplied != before.lastApplied {
+		t.Errorf("Expected log up to %d with %d applied, got log up to %d with %d applied",
+			before.log.lastIndex(), before.lastApplied, after.log.lastIndex(), after.lastApplied)
+	}
+
+	net.submit(0, 3)
+	if txs := net.replicas[1].txIDs(); !reflect.DeepEqual(txs, []string{"tx1", "tx2", "tx3"}) {
+		t.Errorf("Expected the restarted replica to apply each entry once, committed %v", txs)
+	}
+}
+
+func TestSnapshotCatchUp(t *testing.T) {
+	config := loadTestConfig()
+	config.Set("general.snapshotinterval", 2)
+	net := newTestNetwork(3, config)
+	net.elect(0)
+
+	net.replicas[2].down = true
+	for tag := 1; tag <= 5; tag++ {
+		net.submit(0, tag)
+	}
+	l := net.replicas[0]
+	if l.raft.log.snapshot.Index < 2 {
+		t.Fatalf("Expected the leader to compact its log, its snapshot is at %d", l.raft.log.snapshot.Index)
+	}
+	if _, err := l.ReadState(entryKey(1)); err == nil {
+		t.Errorf("Expected the compacted entries to be deleted")
+	}
+
+	r := net.restart(2)
+	net.heartbeat()
+	if r.skipped != 1 {
+		t.Errorf("Expected replica 2 to transfer state once, it did %d times", r.skipped)
+	}
+	if !reflect.DeepEqual(r.txIDs(), l.txIDs()) || r.raft.lastApplied != l.raft.lastApplied {
+		t.Errorf("Expected replica 2 to catch up to %v at entry %d, got %v at entry %d", l.txIDs(), l.raft.lastApplied, r.txIDs(), r.raft.lastApplied)
+	}
+
+	net.submit(0, 6)
+	if txs := r.txIDs(); len(txs) != 6 || txs[5] != "tx6" {
+		t.Errorf("Expected replica 2 to follow the log after the snapshot, committed %v", txs)
+	}
+}
+
+func TestAddAndRemoveMember(t *testing.T) {
+	config := loadTestConfig()
+	config.Set("general.snapshotinterval", 2)
+	net := newTestNetwork(3, config)
+	net.elect(0)
+	for tag := 1; tag <= 3; tag++ {
+		net.submit(0, tag)
+	}
+
+	joining := net.addReplica(3, config)
+	net.elect(3)
+	if joining.raft.term.Role() != election.Follower || joining.raft.term.Current() != 0 {
+		t.Fatalf("Expected replica 3 not to start an election before it is a member")
+	}
+
+	net.queue = append(net.queue, testEvent{0, membershipEvent{id: 3, add: true}})
+	net.process()
+	net.heartbeat()
+	for id, r := range net.replicas {
+		if !reflect.DeepEqual(r.raft.members, []uint64{0, 1, 2, 3}) {
+			t.Errorf("Expected replica %d to have members [0 1 2 3], got %v", id, r.raft.members)
+		}
+	}
+	net.submit(0, 4)
+	if txs := joining.txIDs(); len(txs) != 4 {
+		t.Errorf("Expected the new member to catch up to 4 transactions, committed %v", txs)
+	}
+
+	net.queue = append(net.queue, testEvent{0, membershipEvent{id: 0, add: false}})
+	net.process()
+	if net.replicas[0].raft.term.Role() == election.Leader {
+		t.Fatalf("Expected the leader to step down once its removal committed")
+	}
+	net.elect(0)
+	if net.replicas[0].raft.term.Role() != election.Follower {
+		t.Errorf("Expected the removed replica not to start an election")
+	}
+	for _, r := range net.replicas {
+		r.raft.detector.Expire()
+	}
+	net.elect(3)
+	if net.replicas[3].raft.term.Role() != election.Leader {
+		t.Fatalf("Expected replica 3 to be elected by the remaining members, it is a %s", net.replicas[3].raft.term.Role())
+	}
+	net.submit(1, 5)
+	for _, id := range []uint64{1, 2, 3} {
+		if txs := net.replicas[id].txIDs(); len(txs) != 5 {
+			t.Errorf("Expected replica %d to commit 5 transactions, committed %v", id, txs)
+		}
+	}
+}
+
+func TestOneMembershipChangeAtATime(t *testing.T) {
+	net := newTestNetwork(3, loadTestConfig())
+	net.elect(0)
+	net.replicas[1].down = true
+	net.replicas[2].down = true
+
+	l := net.replicas[0].raft
+	l.ProcessEvent(membershipEvent{id: 3, add: true})
+	l.ProcessEvent(membershipEvent{id: 4, add: true})
+	if !reflect.DeepEqual(l.members, []uint64{0, 1, 2, 3}) {
+		t.Errorf("Expected only the first change to be ordered before it commits, members are %v", l.members)
+	}
+}
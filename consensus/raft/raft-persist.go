@@ -0,0 +1,156 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package raft
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/hyperledger/fabric/consensus/util/election"
+
+	"github.com/golang/protobuf/proto"
+)
+
+// The term and vote are persisted before the replica acts on them, and
+// entries before they are acknowledged.  The state of the ledger stands for
+// the applied entries: the block of an entry carries its index, and the
+// snapshot refers to the ledger at its index.
+
+const (
+	hardStateKey   = "raft.hardState"
+	snapshotKey    = "raft.snapshot"
+	entryKeyPrefix = "raft.entry."
+)
+
+func entryKey(index uint64) string {
+	return fmt.Sprintf("%s%d", entryKeyPrefix, index)
+}
+
+func (instance *raftCore) persistHardState() {
+	hard := instance.term.HardState()
+	raw, err := proto.Marshal(&HardState{Term: hard.Term, Voted: hard.Voted, VotedFor: hard.VotedFor})
+	if err != nil {
+		logger.Warningf("Replica %d could not persist its term and vote: %s", instance.id, err)
+		return
+	}
+	instance.consumer.StoreState(hardStateKey, raw)
+}
+
+func (instance *raftCore) persistEntry(entry *Entry) {
+	raw, err := proto.Marshal(entry)
+	if err != nil {
+		logger.Warningf("Replica %d could not persist entry %d: %s", instance.id, entry.Index, err)
+		return
+	}
+	instance.consumer.StoreState(entryKey(entry.Index), raw)
+}
+
+func (instance *raftCore) persistSnapshot(snapshot *Snapshot) {
+	raw, err := proto.Marshal(snapshot)
+	if err != nil {
+		logger.Warningf("Replica %d could not persist snapshot %d: %s", instance.id, snapshot.Index, err)
+		return
+	}
+	instance.consumer.StoreState(snapshotKey, raw)
+}
+
+// restoreState restores the term, vote, snapshot and log entries of the
+// replica, and the index of the last entry its ledger holds
+func (instance *raftCore) restoreState(initial []uint64) {
+	hardState := &HardState{}
+	if raw, err := instance.consumer.ReadState(hardStateKey); err == nil {
+		if err = proto.Unmarshal(raw, hardState); err != nil {
+			logger.Errorf("Replica %d could not unmarshal its term and vote - local state is damaged: %s", instance.id, err)
+		}
+	}
+	instance.term.Restore(election.HardState{Term: hardState.Term, Voted: hardState.Voted, VotedFor: hardState.VotedFor})
+
+	snapshot := &Snapshot{Configuration: &Configuration{Members: initial}}
+	if raw, err := instance.consumer.ReadState(snapshotKey); err == nil {
+		restored := &Snapshot{}
+		if err = proto.Unmarshal(raw, restored); err != nil {
+			logger.Errorf("Replica %d could not unmarshal its snapshot - local state is damaged: %s", instance.id, err)
+		} else {
+			snapshot = restored
+		}
+	}
+	instance.log = newRaftLog(snapshot)
+
+	var entries []*Entry
+	raws, _ := instance.consumer.ReadStateSet(entryKeyPrefix)
+	for key, raw := range raws {
+		index, err := strconv.ParseUint(strings.TrimPrefix(key, entryKeyPrefix), 10, 64)
+		if err != nil || index <= snapshot.Index {
+			instance.consumer.DelState(key)
+			continue
+		}
+		entry := &Entry{}
+		if err = proto.Unmarshal(raw, entry); err != nil {
+			logger.Errorf("Replica %d could not unmarshal entry %d - local state is damaged: %s", instance.id, index, err)
+			continue
+		}
+		entries = append(entries, entry)
+	}
+	sort.Sort(entriesByIndex(entries))
+	for _, entry := range entries {
+		if entry.Index != instance.log.lastIndex()+1 {
+			logger.Warningf("Replica %d discarding persisted entries from %d, entry %d is missing", instance.id, entry.Index, instance.log.lastIndex()+1)
+			break
+		}
+		instance.log.append(entry)
+	}
+
+	instance.lastApplied = snapshot.Index
+	if meta, err := instance.consumer.getLastApplied(); err != nil {
+		logger.Warningf("Replica %d could not read the entry of its last block: %s", instance.id, err)
+	} else if meta.Index > instance.lastApplied {
+		instance.lastApplied = meta.Index
+		if term, ok := instance.log.term(meta.Index); !ok || term != meta.Term {
+			// the ledger is ahead of the persisted log, it stands for a snapshot
+			logger.Warningf("Replica %d ledger holds entry %d beyond its log, starting from there", instance.id, meta.Index)
+			snapshot = &Snapshot{
+				Index:          meta.Index,
+				Term:           meta.Term,
+				Configuration:  instance.log.configuration(meta.Index),
+				BlockchainInfo: instance.consumer.getState(),
+			}
+			instance.persistSnapshot(snapshot)
+			for _, entry := range instance.log.compact(snapshot) {
+				instance.consumer.DelState(entryKey(entry.Index))
+			}
+		}
+	}
+	instance.commitIndex = instance.lastApplied
+	instance.setMembers(instance.log.configuration(instance.log.lastIndex()))
+
+	logger.Infof("Replica %d restored term %d with snapshot %d, %d entries and entry %d applied, members %v",
+		instance.id, instance.term, instance.log.snapshot.Index, len(instance.log.entries), instance.lastApplied, instance.members)
+}
+
+type entriesByIndex []*Entry
+
+func (a entriesByIndex) Len() int {
+	return len(a)
+}
+func (a entriesByIndex) Swap(i, j int) {
+	a[i], a[j] = a[j], a[i]
+}
+func (a entriesByIndex) Less(i, j int) bool {
+	return a[i].Index < a[j].Index
+}
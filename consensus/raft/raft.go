@@ -0,0 +1,286 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package raft
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/op/go-logging"
+	"github.com/spf13/viper"
+
+	"github.com/hyperledger/fabric/consensus"
+	"github.com/hyperledger/fabric/consensus/util/events"
+	pb "github.com/hyperledger/fabric/protos"
+)
+
+const configPrefix = "CORE_RAFT"
+
+var logger *logging.Logger // package-level logger
+
+var pluginInstance consensus.Consenter // singleton service
+
+func init() {
+	logger = logging.MustGetLogger("consensus/raft")
+}
+
+// GetPlugin returns the handle to the Consenter singleton
+func GetPlugin(c consensus.Stack) consensus.Consenter {
+	if pluginInstance == nil {
+		pluginInstance = New(c)
+	}
+	return pluginInstance
+}
+
+// New creates a new obcRaft instance that provides the Consenter interface.
+// Internally, it uses an opaque raft-core instance.
+func New(stack consensus.Stack) consensus.Consenter {
+	handle, _, _ := stack.GetNetworkHandles()
+	id, err := getValidatorID(handle)
+	if err != nil {
+		panic(err)
+	}
+	return newObcRaft(id, loadConfig(), stack)
+}
+
+func loadConfig() (config *viper.Viper) {
+	config = viper.New()
+
+	// for environment variables
+	config.SetEnvPrefix(configPrefix)
+	config.AutomaticEnv()
+	replacer := strings.NewReplacer(".", "_")
+	config.SetEnvKeyReplacer(replacer)
+
+	config.SetConfigName("config")
+	config.AddConfigPath("./")
+	config.AddConfigPath("../consensus/raft/")
+	config.AddConfigPath("../../consensus/raft")
+	// Path to look for the config file in based on GOPATH
+	gopath := os.Getenv("GOPATH")
+	for _, p := range filepath.SplitList(gopath) {
+		raftpath := filepath.Join(p, "src/github.com/hyperledger/fabric/consensus/raft")
+		config.AddConfigPath(raftpath)
+	}
+
+	err := config.ReadInConfig()
+	if err != nil {
+		panic(fmt.Errorf("Error reading %s plugin config: %s", configPrefix, err))
+	}
+	return
+}
+
+// Returns the uint64 ID corresponding to a peer handle
+func getValidatorID(handle *pb.PeerID) (id uint64, err error) {
+	if startsWith := strings.HasPrefix(handle.Name, "vp"); startsWith {
+		id, err = strconv.ParseUint(handle.Name[2:], 10, 64)
+		if err != nil {
+			return id, fmt.Errorf("Error extracting ID from \"%s\" handle: %v", handle.Name, err)
+		}
+		return
+	}
+
+	err = fmt.Errorf(`For Raft, set the VP's peer.id to vpX,
+		where X is a unique integer, the initial members being 0 to N-1`)
+	return
+}
+
+// Returns the peer handle that corresponds to a validator ID
+func getValidatorHandle(id uint64) *pb.PeerID {
+	return &pb.PeerID{Name: "vp" + strconv.FormatUint(id, 10)}
+}
+
+// obcRaft connects a raft-core instance to the stack: it turns messages and
+// execution callbacks into events, and executes committed entries as blocks
+type obcRaft struct {
+	stack   consensus.Stack
+	raft    *raftCore
+	manager events.Manager
+
+	consensus.StatePersistor
+}
+
+// executedEvent is sent when the transactions of an entry were executed
+type executedEvent struct {
+	entry *Entry
+}
+
+func newObcRaft(id uint64, config *viper.Viper, stack consensus.Stack) *obcRaft {
+	op := &obcRaft{
+		stack:          stack,
+		StatePersistor: stack,
+	}
+
+	op.manager = events.NewManagerImpl()
+	op.manager.SetReceiver(op)
+	etf := events.NewTimerFactoryImpl(op.manager)
+	op.raft = newRaftCore(id, config, op, etf)
+	op.manager.Start()
+
+	return op
+}
+
+// Close tells us to release resources we are holding
+func (op *obcRaft) Close() {
+	op.raft.close()
+	op.manager.Halt()
+}
+
+// RecvMsg is called by the stack when a new message is received
+func (op *obcRaft) RecvMsg(ocMsg *pb.Message, senderHandle *pb.PeerID) error {
+	switch ocMsg.Type {
+	case pb.Message_CHAIN_TRANSACTION:
+		op.manager.Queue() <- requestEvent(ocMsg.Payload)
+	case pb.Message_CONSENSUS:
+		senderID, err := getValidatorID(senderHandle)
+		if err != nil {
+			return err
+		}
+		msg := &Message{}
+		if err := proto.Unmarshal(ocMsg.Payload, msg); err != nil {
+			return fmt.Errorf("Error unmarshaling Raft message from replica %d: %s", senderID, err)
+		}
+		op.manager.Queue() <- raftMessageEvent{msg: msg, sender: senderID}
+	default:
+		return fmt.Errorf("Unexpected message type: %s", ocMsg.Type)
+	}
+	return nil
+}
+
+// AddMember has the leader propose adding a validator to the membership,
+// the validator must be running with the same ID before it can catch up
+func (op *obcRaft) AddMember(id uint64) {
+	op.manager.Queue() <- membershipEvent{id: id, add: true}
+}
+
+// RemoveMember has the leader propose removing a validator from the membership
+func (op *obcRaft) RemoveMember(id uint64) {
+	op.manager.Queue() <- membershipEvent{id: id, add: false}
+}
+
+// Executed is called whenever Execute completes
+func (op *obcRaft) Executed(tag interface{}) {
+	op.manager.Queue() <- executedEvent{tag.(*Entry)}
+}
+
+// Committed is called whenever Commit completes
+func (op *obcRaft) Committed(tag interface{}, target *pb.BlockchainInfo) {
+	op.manager.Queue() <- appliedEvent{tag.(*Entry).Index}
+}
+
+// RolledBack is called whenever a Rollback completes, Raft never rolls back
+func (op *obcRaft) RolledBack(tag interface{}) {
+	logger.Warningf("Replica %d unexpectedly rolled back an execution", op.raft.id)
+}
+
+// StateUpdated is a signal from the stack that it has fast-forwarded its state
+func (op *obcRaft) StateUpdated(tag interface{}, target *pb.BlockchainInfo) {
+	op.manager.Queue() <- stateUpdatedEvent{snapshot: tag.(*Snapshot), target: target}
+}
+
+// ProcessEvent commits the executed entries, runs the work of other
+// threads, and passes any other event to the raft-core
+func (op *obcRaft) ProcessEvent(event events.Event) events.Event {
+	switch et := event.(type) {
+	case executedEvent:
+		meta, _ := proto.Marshal(&Metadata{Index: et.entry.Index, Term: et.entry.Term})
+		op.stack.Commit(et.entry, meta)
+		return nil
+	case events.WorkEvent:
+		et()
+		return nil
+	}
+	return op.raft.ProcessEvent(event)
+}
+
+// =============================================================================
+// innerStack interface (functions called by raft-core)
+// =============================================================================
+
+func (op *obcRaft) broadcast(msg *Message) {
+	payload, err := proto.Marshal(msg)
+	if err != nil {
+		logger.Errorf("Replica %d could not marshal message: %s", op.raft.id, err)
+		return
+	}
+	op.stack.Broadcast(&pb.Message{Type: pb.Message_CONSENSUS, Payload: payload}, pb.PeerEndpoint_VALIDATOR)
+}
+
+func (op *obcRaft) unicast(msg *Message, receiverID uint64) error {
+	payload, err := proto.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	return op.stack.Unicast(&pb.Message{Type: pb.Message_CONSENSUS, Payload: payload}, getValidatorHandle(receiverID))
+}
+
+// execute executes the transactions of an entry, the entry is committed as
+// a block once they executed
+func (op *obcRaft) execute(entry *Entry) {
+	var txs []*pb.Transaction
+	for _, req := range entry.Requests {
+		tx := &pb.Transaction{}
+		if err := proto.Unmarshal(req, tx); err != nil {
+			logger.Warningf("Replica %d could not unmarshal transaction: %s", op.raft.id, err)
+			continue
+		}
+		txs = append(txs, tx)
+	}
+	logger.Debugf("Replica %d executing entry %d containing %d transactions", op.raft.id, entry.Index, len(txs))
+	op.stack.Execute(entry, txs)
+}
+
+func (op *obcRaft) skipTo(snapshot *Snapshot, replicas []uint64) error {
+	info := &pb.BlockchainInfo{}
+	if err := proto.Unmarshal(snapshot.BlockchainInfo, info); err != nil {
+		return fmt.Errorf("Error unmarshaling the blockchain info of snapshot %d: %s", snapshot.Index, err)
+	}
+	peers := make([]*pb.PeerID, len(replicas))
+	for i, id := range replicas {
+		peers[i] = getValidatorHandle(id)
+	}
+	op.stack.UpdateState(snapshot, info, peers)
+	return nil
+}
+
+func (op *obcRaft) invalidateState() {
+	op.stack.InvalidateState()
+}
+
+func (op *obcRaft) validateState() {
+	op.stack.ValidateState()
+}
+
+func (op *obcRaft) getState() []byte {
+	return op.stack.GetBlockchainInfoBlob()
+}
+
+func (op *obcRaft) getLastApplied() (*Metadata, error) {
+	raw, err := op.stack.GetBlockHeadMetadata()
+	if err != nil {
+		return nil, err
+	}
+	meta := &Metadata{}
+	if err := proto.Unmarshal(raw, meta); err != nil {
+		return nil, err
+	}
+	return meta, nil
+}
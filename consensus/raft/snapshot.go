@@ -0,0 +1,115 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package raft
+
+import (
+	"github.com/hyperledger/fabric/consensus/util/election"
+)
+
+// The ledger is the state machine the log is applied to, so a snapshot is no
+// copy of the state but the blockchain info of the ledger once the entries up
+// to its index were applied, along with the configuration at that index.
+// Every snapshot interval a replica compacts the applied entries into such a
+// snapshot.  A follower which needs compacted entries is sent the snapshot
+// instead, and transfers the state of the ledger from the leader.
+
+// maybeSnapshot compacts the applied entries once there are snapshot
+// interval of them
+func (instance *raftCore) maybeSnapshot() {
+	if instance.snapshotInterval == 0 || instance.applying {
+		return
+	}
+	if instance.lastApplied < instance.log.snapshot.Index+instance.snapshotInterval {
+		return
+	}
+
+	term, _ := instance.log.term(instance.lastApplied)
+	snapshot := &Snapshot{
+		Index:          instance.lastApplied,
+		Term:           term,
+		Configuration:  instance.log.configuration(instance.lastApplied),
+		BlockchainInfo: instance.consumer.getState(),
+	}
+	logger.Infof("Replica %d compacting its log into snapshot %d", instance.id, snapshot.Index)
+	instance.persistSnapshot(snapshot)
+	for _, entry := range instance.log.compact(snapshot) {
+		instance.consumer.DelState(entryKey(entry.Index))
+	}
+}
+
+func (instance *raftCore) recvInstallSnapshot(install *InstallSnapshot) {
+	if install.Term < instance.term.Current() {
+		instance.sendAppendResponse(install.LeaderId, false, instance.log.lastIndex())
+		return
+	}
+	if install.Term > instance.term.Current() || instance.term.Role() != election.Follower {
+		instance.becomeFollower(install.Term)
+	}
+	instance.setLeader(install.LeaderId)
+	instance.detector.Reset()
+
+	snapshot := install.Snapshot
+	if snapshot == nil {
+		logger.Warningf("Replica %d received no snapshot from leader %d", instance.id, install.LeaderId)
+		return
+	}
+	if snapshot.Index <= instance.commitIndex {
+		// the committed entries agree with those of the leader
+		instance.sendAppendResponse(install.LeaderId, true, instance.commitIndex)
+		return
+	}
+	if instance.transferring || instance.applying {
+		// the leader sends the snapshot again with its next appends
+		return
+	}
+
+	logger.Infof("Replica %d transferring state to snapshot %d of leader %d", instance.id, snapshot.Index, install.LeaderId)
+	instance.transferring = true
+	instance.consumer.invalidateState()
+	if err := instance.consumer.skipTo(snapshot, []uint64{install.LeaderId}); err != nil {
+		logger.Errorf("Replica %d could not transfer state to snapshot %d: %s", instance.id, snapshot.Index, err)
+		instance.transferring = false
+		instance.consumer.validateState()
+	}
+}
+
+// snapshotInstalled replaces the log up to the snapshot the ledger was
+// transferred to
+func (instance *raftCore) snapshotInstalled(snapshot *Snapshot, ok bool) {
+	instance.transferring = false
+	if !ok {
+		logger.Warningf("Replica %d failed to transfer state to snapshot %d, waiting for the leader to send it again", instance.id, snapshot.Index)
+		return
+	}
+	instance.consumer.validateState()
+	logger.Infof("Replica %d transferred state to snapshot %d", instance.id, snapshot.Index)
+
+	instance.persistSnapshot(snapshot)
+	for _, entry := range instance.log.compact(snapshot) {
+		instance.consumer.DelState(entryKey(entry.Index))
+	}
+	instance.setMembers(instance.log.configuration(instance.log.lastIndex()))
+	if snapshot.Index > instance.commitIndex {
+		instance.commitIndex = snapshot.Index
+	}
+	instance.lastApplied = snapshot.Index
+
+	if leader, ok := instance.term.Leader(); ok {
+		instance.sendAppendResponse(leader, true, snapshot.Index)
+	}
+	instance.apply()
+}
@@ -0,0 +1,62 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package solo
+
+import (
+	"fmt"
+
+	"github.com/hyperledger/fabric/consensus"
+	"github.com/hyperledger/fabric/consensus/util/events"
+)
+
+// Health reports the replica unhealthy while it misses a block ordered
+// before the ones it received, or if its main thread is stuck
+func (op *obcSolo) Health() consensus.Health {
+	var health consensus.Health
+	if !events.OnMainThread(op.manager, func() {
+		next := op.lastExec + 1
+		if _, ok := op.blocks[next]; !ok && len(op.blocks) > 0 {
+			health.Detail = fmt.Sprintf("waiting for block %d from orderer %d", next, op.orderer)
+			return
+		}
+		health.Healthy = true
+		if op.id == op.orderer {
+			health.Detail = fmt.Sprintf("ordering, last block %d", op.seqNo)
+		} else {
+			health.Detail = fmt.Sprintf("following orderer %d, last executed %d", op.orderer, op.lastExec)
+		}
+	}) {
+		return consensus.Health{Detail: fmt.Sprintf("main thread unresponsive for %v", events.MainThreadTimeout)}
+	}
+	return health
+}
+
+// Metrics reports the progress of the replica
+func (op *obcSolo) Metrics() consensus.Metrics {
+	var metrics consensus.Metrics
+	events.OnMainThread(op.manager, func() {
+		metrics = consensus.Metrics{
+			"solo.lastExec":        float64(op.lastExec),
+			"solo.queuedBlocks":    float64(len(op.blocks)),
+			"solo.pendingRequests": float64(op.cutter.Pending()),
+		}
+		if op.id == op.orderer {
+			metrics["solo.seqNo"] = float64(op.seqNo)
+		}
+	})
+	return metrics
+}
@@ -0,0 +1,174 @@
+// Code generated by protoc-gen-go.
+// source: messages.proto
+// DO NOT EDIT!
+
+/*
+Package solo is a generated protocol buffer package.
+
+It is generated from these files:
+	messages.proto
+
+It has these top-level messages:
+	Message
+	Block
+	FetchBlock
+	Metadata
+*/
+package solo
+
+import proto "github.com/golang/protobuf/proto"
+import fmt "fmt"
+import math "math"
+
+// Reference imports to suppress errors if they are not otherwise used.
+var _ = proto.Marshal
+var _ = fmt.Errorf
+var _ = math.Inf
+
+type Message struct {
+	// Types that are valid to be assigned to Payload:
+	//	*Message_Request
+	//	*Message_Block
+	//	*Message_FetchBlock
+	Payload isMessage_Payload `protobuf_oneof:"payload"`
+}
+
+func (m *Message) Reset()         { *m = Message{} }
+func (m *Message) String() string { return proto.CompactTextString(m) }
+func (*Message) ProtoMessage()    {}
+
+type isMessage_Payload interface {
+	isMessage_Payload()
+}
+
+type Message_Request struct {
+	Request []byte `protobuf:"bytes,1,opt,name=request,proto3,oneof"`
+}
+type Message_Block struct {
+	Block *Block `protobuf:"bytes,2,opt,name=block,oneof"`
+}
+type Message_FetchBlock struct {
+	FetchBlock *FetchBlock `protobuf:"bytes,3,opt,name=fetch_block,oneof"`
+}
+
+func (*Message_Request) isMessage_Payload()    {}
+func (*Message_Block) isMessage_Payload()      {}
+func (*Message_FetchBlock) isMessage_Payload() {}
+
+func (m *Message) GetPayload() isMessage_Payload {
+	if m != nil {
+		return m.Payload
+	}
+	return nil
+}
+
+func (m *Message) GetRequest() []byte {
+	if x, ok := m.GetPayload().(*Message_Request); ok {
+		return x.Request
+	}
+	return nil
+}
+
+func (m *Message) GetBlock() *Block {
+	if x, ok := m.GetPayload().(*Message_Block); ok {
+		return x.Block
+	}
+	return nil
+}
+
+func (m *Message) GetFetchBlock() *FetchBlock {
+	if x, ok := m.GetPayload().(*Message_FetchBlock); ok {
+		return x.FetchBlock
+	}
+	return nil
+}
+
+// XXX_OneofFuncs is for the internal use of the proto package.
+func (*Message) XXX_OneofFuncs() (func(msg proto.Message, b *proto.Buffer) error, func(msg proto.Message, tag, wire int, b *proto.Buffer) (bool, error), []interface{}) {
+	return _Message_OneofMarshaler, _Message_OneofUnmarshaler, []interface{}{
+		(*Message_Request)(nil),
+		(*Message_Block)(nil),
+		(*Message_FetchBlock)(nil),
+	}
+}
+
+func _Message_OneofMarshaler(msg proto.Message, b *proto.Buffer) error {
+	m := msg.(*Message)
+	// payload
+	switch x := m.Payload.(type) {
+	case *Message_Request:
+		b.EncodeVarint(1<<3 | proto.WireBytes)
+		b.EncodeRawBytes(x.Request)
+	case *Message_Block:
+		b.EncodeVarint(2<<3 | proto.WireBytes)
+		if err := b.EncodeMessage(x.Block); err != nil {
+			return err
+		}
+	case *Message_FetchBlock:
+		b.EncodeVarint(3<<3 | proto.WireBytes)
+		if err := b.EncodeMessage(x.FetchBlock); err != nil {
+			return err
+		}
+	case nil:
+	default:
+		return fmt.Errorf("Message.Payload has unexpected type %T", x)
+	}
+	return nil
+}
+
+func _Message_OneofUnmarshaler(msg proto.Message, tag, wire int, b *proto.Buffer) (bool, error) {
+	m := msg.(*Message)
+	switch tag {
+	case 1: // payload.request
+		if wire != proto.WireBytes {
+			return true, proto.ErrInternalBadWireType
+		}
+		x, err := b.DecodeRawBytes(true)
+		m.Payload = &Message_Request{x}
+		return true, err
+	case 2: // payload.block
+		if wire != proto.WireBytes {
+			return true, proto.ErrInternalBadWireType
+		}
+		msg := new(Block)
+		err := b.DecodeMessage(msg)
+		m.Payload = &Message_Block{msg}
+		return true, err
+	case 3: // payload.fetch_block
+		if wire != proto.WireBytes {
+			return true, proto.ErrInternalBadWireType
+		}
+		msg := new(FetchBlock)
+		err := b.DecodeMessage(msg)
+		m.Payload = &Message_FetchBlock{msg}
+		return true, err
+	default:
+		return false, nil
+	}
+}
+
+type Block struct {
+	SeqNo    uint64   `protobuf:"varint,1,opt,name=seqNo" json:"seqNo,omitempty"`
+	Requests [][]byte `protobuf:"bytes,2,rep,name=requests,proto3" json:"requests,omitempty"`
+}
+
+func (m *Block) Reset()         { *m = Block{} }
+func (m *Block) String() string { return proto.CompactTextString(m) }
+func (*Block) ProtoMessage()    {}
+
+type FetchBlock struct {
+	SeqNo     uint64 `protobuf:"varint,1,opt,name=seqNo" json:"seqNo,omitempty"`
+	ReplicaId uint64 `protobuf:"varint,2,opt,name=replica_id" json:"replica_id,omitempty"`
+}
+
+func (m *FetchBlock) Reset()         { *m = FetchBlock{} }
+func (m *FetchBlock) String() string { return proto.CompactTextString(m) }
+func (*FetchBlock) ProtoMessage()    {}
+
+type Metadata struct {
+	SeqNo uint64 `protobuf:"varint,1,opt,name=seqNo" json:"seqNo,omitempty"`
+}
+
+func (m *Metadata) Reset()         { *m = Metadata{} }
+func (m *Metadata) String() string { return proto.CompactTextString(m) }
+func (*Metadata) ProtoMessage()    {}
@@ -0,0 +1,465 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package solo
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/op/go-logging"
+	"github.com/spf13/viper"
+
+	"github.com/hyperledger/fabric/consensus"
+	"github.com/hyperledger/fabric/consensus/util"
+	"github.com/hyperledger/fabric/consensus/util/events"
+	pb "github.com/hyperledger/fabric/protos"
+)
+
+// A single validator, the orderer, orders all transactions.  It cuts them
+// into blocks, numbers the blocks, and broadcasts them to the other
+// validators, which forward their transactions to it.  Every validator
+// executes the blocks in order through the executor, as pbft does, and the
+// block carries its sequence number.  Unlike noops, the validators thus agree
+// on the order of the transactions, as long as the orderer is up.
+
+const configPrefix = "CORE_SOLO"
+
+const blockKeyPrefix = "solo.block."
+
+var logger *logging.Logger // package-level logger
+
+var pluginInstance consensus.Consenter // singleton service
+
+func init() {
+	logger = logging.MustGetLogger("consensus/solo")
+}
+
+// GetPlugin returns the handle to the Consenter singleton
+func GetPlugin(c consensus.Stack) consensus.Consenter {
+	if pluginInstance == nil {
+		pluginInstance = New(c)
+	}
+	return pluginInstance
+}
+
+// New creates a new obcSolo instance that provides the Consenter interface
+func New(stack consensus.Stack) consensus.Consenter {
+	handle, _, _ := stack.GetNetworkHandles()
+	id, err := getValidatorID(handle)
+	if err != nil {
+		panic(err)
+	}
+	return newObcSolo(id, loadConfig(), stack)
+}
+
+func loadConfig() (config *viper.Viper) {
+	config = viper.New()
+
+	// for environment variables
+	config.SetEnvPrefix(configPrefix)
+	config.AutomaticEnv()
+	replacer := strings.NewReplacer(".", "_")
+	config.SetEnvKeyReplacer(replacer)
+
+	config.SetConfigName("config")
+	config.AddConfigPath("./")
+	config.AddConfigPath("../consensus/solo/")
+	config.AddConfigPath("../../consensus/solo")
+	// Path to look for the config file in based on GOPATH
+	gopath := os.Getenv("GOPATH")
+	for _, p := range filepath.SplitList(gopath) {
+		solopath := filepath.Join(p, "src/github.com/hyperledger/fabric/consensus/solo")
+		config.AddConfigPath(solopath)
+	}
+
+	err := config.ReadInConfig()
+	if err != nil {
+		panic(fmt.Errorf("Error reading %s plugin config: %s", configPrefix, err))
+	}
+	return
+}
+
+// Returns the uint64 ID corresponding to a peer handle
+func getValidatorID(handle *pb.PeerID) (id uint64, err error) {
+	if startsWith := strings.HasPrefix(handle.Name, "vp"); startsWith {
+		id, err = strconv.ParseUint(handle.Name[2:], 10, 64)
+		if err != nil {
+			return id, fmt.Errorf("Error extracting ID from \"%s\" handle: %v", handle.Name, err)
+		}
+		return
+	}
+
+	err = fmt.Errorf(`For solo, set the VP's peer.id to vpX,
+		where X is a unique integer, the orderer being the configured one`)
+	return
+}
+
+// Returns the peer handle that corresponds to a validator ID
+func getValidatorHandle(id uint64) *pb.PeerID {
+	return &pb.PeerID{Name: "vp" + strconv.FormatUint(id, 10)}
+}
+
+func blockKey(seqNo uint64) string {
+	return fmt.Sprintf("%s%d", blockKeyPrefix, seqNo)
+}
+
+type obcSolo struct {
+	id      uint64
+	orderer uint64
+	stack   consensus.Stack
+	manager events.Manager
+
+	cutter       *util.BlockCutter
+	batchTimer   events.Timer
+	batchTimeout time.Duration
+	retainBlocks uint64
+
+	seqNo     uint64            // orderer: sequence number of the last block it ordered
+	lastExec  uint64            // sequence number of the last block executed, or executing
+	executing bool              // whether a block is being executed
+	blocks    map[uint64]*Block // ordered blocks waiting for execution
+	fetching  uint64            // sequence number of the block last asked of the orderer
+}
+
+// Event types
+
+// soloMessageEvent is sent when a solo message is received
+type soloMessageEvent struct {
+	msg    *Message
+	sender uint64
+}
+
+// requestEvent is sent when a client transaction is to be ordered
+type requestEvent []byte
+
+// batchTimerEvent is sent when the batch timer expires
+type batchTimerEvent struct{}
+
+// executedEvent is sent when the transactions of a block were executed
+type executedEvent struct {
+	block *Block
+}
+
+// committedEvent is sent when a block was committed
+type committedEvent struct {
+	block *Block
+}
+
+func newObcSolo(id uint64, config *viper.Viper, stack consensus.Stack) *obcSolo {
+	var err error
+	op := &obcSolo{
+		id:     id,
+		stack:  stack,
+		blocks: make(map[uint64]*Block),
+	}
+
+	op.orderer = uint64(config.GetInt("general.orderer"))
+	op.cutter = util.NewBlockCutter(config.GetInt("general.batch.maxmessagecount"), config.GetInt("general.batch.maxbytes"))
+	op.batchTimeout, err = time.ParseDuration(config.GetString("general.batch.timeout"))
+	if err != nil {
+		panic(fmt.Errorf("Cannot parse batch timeout: %s", err))
+	}
+	op.retainBlocks = uint64(config.GetInt("general.retainblocks"))
+	if op.retainBlocks < 1 {
+		op.retainBlocks = 1
+	}
+
+	logger.Infof("Solo replica %d, orderer = %d", op.id, op.orderer)
+	logger.Infof("Solo batch max message count = %d", op.cutter.MaxMessageCount())
+	logger.Infof("Solo batch max bytes = %d", op.cutter.MaxBytes())
+	logger.Infof("Solo batch timeout = %v", op.batchTimeout)
+	logger.Infof("Solo retained blocks = %d", op.retainBlocks)
+
+	op.manager = events.NewManagerImpl()
+	op.manager.SetReceiver(op)
+	etf := events.NewTimerFactoryImpl(op.manager)
+	op.batchTimer = etf.CreateTimer()
+
+	op.restoreState()
+	op.manager.Start()
+	if len(op.blocks) > 0 {
+		// execute the restored blocks once the stack is set up to call us back
+		op.batchTimer.Reset(op.batchTimeout, batchTimerEvent{})
+	}
+
+	return op
+}
+
+// restoreState restores the sequence number of the last executed block, and
+// on the orderer the blocks it ordered but did not commit yet
+func (op *obcSolo) restoreState() {
+	if raw, err := op.stack.GetBlockHeadMetadata(); err != nil {
+		logger.Warningf("Replica %d could not read the metadata of its last block: %s", op.id, err)
+	} else {
+		meta := &Metadata{}
+		proto.Unmarshal(raw, meta)
+		op.lastExec = meta.SeqNo
+	}
+	op.seqNo = op.lastExec
+
+	if op.id != op.orderer {
+		return
+	}
+	raws, _ := op.stack.ReadStateSet(blockKeyPrefix)
+	for key, raw := range raws {
+		block := &Block{}
+		if err := proto.Unmarshal(raw, block); err != nil {
+			logger.Errorf("Replica %d could not unmarshal %s - local state is damaged: %s", op.id, key, err)
+			continue
+		}
+		if block.SeqNo > op.seqNo {
+			op.seqNo = block.SeqNo
+		}
+		if block.SeqNo > op.lastExec {
+			op.blocks[block.SeqNo] = block
+		}
+	}
+	logger.Infof("Replica %d restored last executed block %d, last ordered block %d", op.id, op.lastExec, op.seqNo)
+}
+
+// Close tells us to release resources we are holding
+func (op *obcSolo) Close() {
+	op.batchTimer.Halt()
+	op.manager.Halt()
+}
+
+// RecvMsg is called by the stack when a new message is received
+func (op *obcSolo) RecvMsg(ocMsg *pb.Message, senderHandle *pb.PeerID) error {
+	switch ocMsg.Type {
+	case pb.Message_CHAIN_TRANSACTION:
+		op.manager.Queue() <- requestEvent(ocMsg.Payload)
+	case pb.Message_CONSENSUS:
+		senderID, err := getValidatorID(senderHandle)
+		if err != nil {
+			return err
+		}
+		msg := &Message{}
+		if err := proto.Unmarshal(ocMsg.Payload, msg); err != nil {
+			return fmt.Errorf("Error unmarshaling solo message from replica %d: %s", senderID, err)
+		}
+		op.manager.Queue() <- soloMessageEvent{msg: msg, sender: senderID}
+	default:
+		return fmt.Errorf("Unexpected message type: %s", ocMsg.Type)
+	}
+	return nil
+}
+
+// Executed is called whenever Execute completes
+func (op *obcSolo) Executed(tag interface{}) {
+	op.manager.Queue() <- executedEvent{tag.(*Block)}
+}
+
+// Committed is called whenever Commit completes
+func (op *obcSolo) Committed(tag interface{}, target *pb.BlockchainInfo) {
+	op.manager.Queue() <- committedEvent{tag.(*Block)}
+}
+
+// RolledBack is called whenever a Rollback completes, solo never rolls back
+func (op *obcSolo) RolledBack(tag interface{}) {
+	logger.Warningf("Replica %d unexpectedly rolled back an execution", op.id)
+}
+
+// StateUpdated is called when state transfer completes, solo never transfers state
+func (op *obcSolo) StateUpdated(tag interface{}, target *pb.BlockchainInfo) {
+	logger.Warningf("Replica %d unexpectedly transferred state", op.id)
+}
+
+// ProcessEvent serially processes the events of the replica
+func (op *obcSolo) ProcessEvent(event events.Event) events.Event {
+	switch et := event.(type) {
+	case requestEvent:
+		op.recvRequest([]byte(et))
+	case soloMessageEvent:
+		op.recvMsg(et.msg, et.sender)
+	case batchTimerEvent:
+		logger.Debugf("Orderer %d batch timer expired", op.id)
+		if block := op.cutter.Cut(); block != nil {
+			op.orderBlock(requests(block))
+		}
+		op.executeNext()
+	case executedEvent:
+		meta, _ := proto.Marshal(&Metadata{SeqNo: et.block.SeqNo})
+		op.stack.Commit(et.block, meta)
+	case committedEvent:
+		logger.Debugf("Replica %d committed block %d", op.id, et.block.SeqNo)
+		op.executing = false
+		op.executeNext()
+	case events.WorkEvent:
+		et()
+	default:
+		logger.Warningf("Replica %d received an unknown event type (%T)", op.id, et)
+	}
+	return nil
+}
+
+func (op *obcSolo) recvMsg(msg *Message, senderID uint64) {
+	if req := msg.GetRequest(); req != nil {
+		op.recvRequest(req)
+	} else if block := msg.GetBlock(); block != nil {
+		if senderID != op.orderer {
+			logger.Warningf("Replica %d ignoring block %d from replica %d, which is not the orderer", op.id, block.SeqNo, senderID)
+			return
+		}
+		op.recvBlock(block)
+	} else if fetch := msg.GetFetchBlock(); fetch != nil {
+		if senderID != fetch.ReplicaId {
+			logger.Warningf("Sender ID included in fetch block message (%v) doesn't match ID corresponding to the receiving stream (%v)", fetch.ReplicaId, senderID)
+			return
+		}
+		op.recvFetchBlock(fetch)
+	} else {
+		logger.Errorf("Replica %d received an invalid message from replica %d", op.id, senderID)
+	}
+}
+
+// recvRequest has the orderer order a client request, other replicas
+// forward it to the orderer
+func (op *obcSolo) recvRequest(req []byte) {
+	if op.id != op.orderer {
+		logger.Debugf("Replica %d forwarding request to orderer %d", op.id, op.orderer)
+		op.unicast(&Message{Payload: &Message_Request{Request: req}}, op.orderer)
+		return
+	}
+
+	blocks, pending := op.cutter.Ordered(req, len(req))
+	for _, block := range blocks {
+		op.orderBlock(requests(block))
+	}
+	if !pending {
+		op.batchTimer.Stop()
+	} else if len(blocks) > 0 {
+		op.batchTimer.Reset(op.batchTimeout, batchTimerEvent{})
+	} else {
+		op.batchTimer.SoftReset(op.batchTimeout, batchTimerEvent{})
+	}
+}
+
+// requests returns the requests of a block the cutter cut
+func requests(block []interface{}) [][]byte {
+	reqs := make([][]byte, len(block))
+	for i, req := range block {
+		reqs[i] = req.([]byte)
+	}
+	return reqs
+}
+
+// orderBlock has the orderer number a block, keep it, and broadcast it
+func (op *obcSolo) orderBlock(requests [][]byte) {
+	op.seqNo++
+	block := &Block{SeqNo: op.seqNo, Requests: requests}
+	logger.Debugf("Orderer %d ordering block %d of %d requests", op.id, block.SeqNo, len(requests))
+
+	raw, err := proto.Marshal(block)
+	if err != nil {
+		logger.Errorf("Orderer %d could not marshal block %d: %s", op.id, block.SeqNo, err)
+		return
+	}
+	op.stack.StoreState(blockKey(block.SeqNo), raw)
+	if op.seqNo > op.retainBlocks {
+		op.stack.DelState(blockKey(op.seqNo - op.retainBlocks))
+	}
+
+	op.broadcast(&Message{Payload: &Message_Block{Block: block}})
+	op.recvBlock(block)
+}
+
+// recvBlock queues an ordered block for execution, and asks the orderer for
+// the blocks missed before it
+func (op *obcSolo) recvBlock(block *Block) {
+	if block.SeqNo <= op.lastExec {
+		return
+	}
+	op.blocks[block.SeqNo] = block
+	next := op.lastExec + 1
+	if _, ok := op.blocks[next]; !ok && op.id != op.orderer && op.fetching < next {
+		logger.Infof("Replica %d missed block %d, asking orderer %d for it", op.id, next, op.orderer)
+		op.fetching = next
+		op.unicast(&Message{Payload: &Message_FetchBlock{FetchBlock: &FetchBlock{SeqNo: next, ReplicaId: op.id}}}, op.orderer)
+	}
+	op.executeNext()
+}
+
+// recvFetchBlock has the orderer send the blocks from the requested one on
+// again
+func (op *obcSolo) recvFetchBlock(fetch *FetchBlock) {
+	if op.id != op.orderer {
+		return
+	}
+	for seqNo := fetch.SeqNo; seqNo <= op.seqNo; seqNo++ {
+		raw, err := op.stack.ReadState(blockKey(seqNo))
+		block := &Block{}
+		if err == nil {
+			err = proto.Unmarshal(raw, block)
+		}
+		if err != nil {
+			logger.Warningf("Orderer %d cannot send block %d to replica %d, it retains the last %d blocks only", op.id, seqNo, fetch.ReplicaId, op.retainBlocks)
+			return
+		}
+		op.unicast(&Message{Payload: &Message_Block{Block: block}}, fetch.ReplicaId)
+	}
+}
+
+// executeNext executes the next block, once the last one committed
+func (op *obcSolo) executeNext() {
+	if op.executing {
+		return
+	}
+	block, ok := op.blocks[op.lastExec+1]
+	if !ok {
+		return
+	}
+	delete(op.blocks, block.SeqNo)
+	op.executing = true
+	op.lastExec = block.SeqNo
+
+	var txs []*pb.Transaction
+	for _, req := range block.Requests {
+		tx := &pb.Transaction{}
+		if err := proto.Unmarshal(req, tx); err != nil {
+			logger.Warningf("Replica %d could not unmarshal transaction: %s", op.id, err)
+			continue
+		}
+		txs = append(txs, tx)
+	}
+	logger.Debugf("Replica %d executing block %d containing %d transactions", op.id, block.SeqNo, len(txs))
+	op.stack.Execute(block, txs)
+}
+
+func (op *obcSolo) broadcast(msg *Message) {
+	payload, err := proto.Marshal(msg)
+	if err != nil {
+		logger.Errorf("Replica %d could not marshal message: %s", op.id, err)
+		return
+	}
+	op.stack.Broadcast(&pb.Message{Type: pb.Message_CONSENSUS, Payload: payload}, pb.PeerEndpoint_VALIDATOR)
+}
+
+func (op *obcSolo) unicast(msg *Message, receiverID uint64) {
+	payload, err := proto.Marshal(msg)
+	if err != nil {
+		logger.Errorf("Replica %d could not marshal message: %s", op.id, err)
+		return
+	}
+	if err = op.stack.Unicast(&pb.Message{Type: pb.Message_CONSENSUS, Payload: payload}, getValidatorHandle(receiverID)); err != nil {
+		logger.Warningf("Replica %d could not send message to replica %d: %s", op.id, receiverID, err)
+	}
+}
@@ -0,0 +1,352 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package solo
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/spf13/viper"
+
+	"github.com/hyperledger/fabric/consensus"
+	"github.com/hyperledger/fabric/consensus/util"
+	pb "github.com/hyperledger/fabric/protos"
+)
+
+// testStack implements the parts of the stack solo uses, the rest of
+// consensus.Stack panics if called
+type testStack struct {
+	consensus.Stack
+
+	id        uint64
+	net       *testNetwork
+	op        *obcSolo
+	transport consensus.Transport
+
+	mutex  sync.Mutex
+	state  map[string][]byte
+	ledger [][]string // transaction IDs of the committed blocks
+	meta   []byte
+	txs    []string // executed but not committed yet
+}
+
+// testNetwork connects the stacks over an in-memory transport
+type testNetwork struct {
+	mutex    sync.Mutex
+	stacks   map[uint64]*testStack
+	filterFn func(src, dst uint64, msg *Message) bool
+	memory   *util.MemoryNetwork
+	done     chan struct{}
+}
+
+func newTestNetwork(n int) *testNetwork {
+	net := &testNetwork{
+		stacks: make(map[uint64]*testStack),
+		memory: util.NewMemoryNetwork(0),
+		done:   make(chan struct{}),
+	}
+	for id := uint64(0); id < uint64(n); id++ {
+		net.stacks[id] = &testStack{
+			id:        id,
+			net:       net,
+			state:     make(map[string][]byte),
+			transport: net.memory.Transport(getValidatorHandle(id)),
+		}
+	}
+	return net
+}
+
+func loadTestConfig() *viper.Viper {
+	config := loadConfig()
+	config.Set("general.batch.maxmessagecount", 2)
+	config.Set("general.batch.timeout", "10ms")
+	return config
+}
+
+func (net *testNetwork) start(config *viper.Viper, mutate func(id uint64, s *testStack)) {
+	for id, s := range net.stacks {
+		if mutate != nil {
+			mutate(id, s)
+		}
+		s.op = newObcSolo(id, config, s)
+	}
+	for _, s := range net.stacks {
+		go net.deliver(s)
+	}
+}
+
+func (net *testNetwork) stop() {
+	close(net.done)
+	net.memory.Close()
+	for _, s := range net.stacks {
+		s.op.Close()
+	}
+}
+
+// deliver hands the messages the stack receives to its consenter, unless
+// filterFn drops them
+func (net *testNetwork) deliver(s *testStack) {
+	for {
+		select {
+		case received := <-s.transport.Receive():
+			msg := &Message{}
+			proto.Unmarshal(received.Msg.Payload, msg)
+			src, _ := getValidatorID(received.Sender)
+			net.mutex.Lock()
+			filterFn := net.filterFn
+			net.mutex.Unlock()
+			if filterFn != nil && !filterFn(src, s.id, msg) {
+				continue
+			}
+			s.op.RecvMsg(received.Msg, received.Sender)
+		case <-net.done:
+			return
+		}
+	}
+}
+
+func (net *testNetwork) submit(id uint64, tag int) {
+	tx, _ := proto.Marshal(&pb.Transaction{Uuid: fmt.Sprintf("tx%d", tag)})
+	net.stacks[id].op.RecvMsg(&pb.Message{Type: pb.Message_CHAIN_TRANSACTION, Payload: tx}, nil)
+}
+
+// waitFor polls until every stack committed the transactions
+func (net *testNetwork) waitFor(count int) bool {
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(time.Millisecond) {
+		done := true
+		for _, s := range net.stacks {
+			if len(s.txIDs()) < count {
+				done = false
+			}
+		}
+		if done {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *testStack) txIDs() []string {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	var ids []string
+	for _, block := range s.ledger {
+		ids = append(ids, block...)
+	}
+	return ids
+}
+
+func (s *testStack) blocks() [][]string {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return append([][]string(nil), s.ledger...)
+}
+
+func (s *testStack) Broadcast(msg *pb.Message, peerType pb.PeerEndpoint_Type) error {
+	return s.transport.Broadcast(msg, peerType)
+}
+
+func (s *testStack) Unicast(msg *pb.Message, receiverHandle *pb.PeerID) error {
+	return s.transport.Send(msg, receiverHandle)
+}
+
+func (s *testStack) Execute(tag interface{}, txs []*pb.Transaction) {
+	s.mutex.Lock()
+	for _, tx := range txs {
+		s.txs = append(s.txs, tx.Uuid)
+	}
+	s.mutex.Unlock()
+	go s.op.Executed(tag)
+}
+
+func (s *testStack) Commit(tag interface{}, metadata []byte) {
+	s.mutex.Lock()
+	s.ledger = append(s.ledger, s.txs)
+	s.txs = nil
+	s.meta = metadata
+	s.mutex.Unlock()
+	go s.op.Committed(tag, nil)
+}
+
+func (s *testStack) GetBlockHeadMetadata() ([]byte, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.meta, nil
+}
+
+func (s *testStack) StoreState(key string, value []byte) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.state[key] = value
+	return nil
+}
+
+func (s *testStack) ReadState(key string) ([]byte, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if val, ok := s.state[key]; ok {
+		return val, nil
+	}
+	return nil, fmt.Errorf("cannot find key %s", key)
+}
+
+func (s *testStack) ReadStateSet(prefix string) (map[string][]byte, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	ret := make(map[string][]byte)
+	for key, val := range s.state {
+		if strings.HasPrefix(key, prefix) {
+			ret[key] = val
+		}
+	}
+	return ret, nil
+}
+
+func (s *testStack) IterateState(prefix string, visit func(key string, value []byte) bool) error {
+	state, _ := s.ReadStateSet(prefix)
+	util.IterateStateSet(state, visit)
+	return nil
+}
+
+func (s *testStack) DelState(key string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	delete(s.state, key)
+}
+
+func TestSoloOrdering(t *testing.T) {
+	config := loadTestConfig()
+	config.Set("general.batch.timeout", "1h")
+	net := newTestNetwork(3)
+	net.start(config, nil)
+	defer net.stop()
+
+	for tag := 1; tag <= 4; tag++ {
+		net.submit(uint64(tag%3), tag)
+	}
+	if !net.waitFor(4) {
+		t.Fatalf("Transactions were not committed by every validator")
+	}
+
+	expected := net.stacks[0].blocks()
+	if len(expected) != 2 {
+		t.Errorf("Expected 4 transactions to be cut into 2 blocks, got %v", expected)
+	}
+	for id, s := range net.stacks {
+		if blocks := s.blocks(); !reflect.DeepEqual(blocks, expected) {
+			t.Errorf("Expected validator %d to commit %v, committed %v", id, expected, blocks)
+		}
+	}
+}
+
+func TestSoloFetchMissedBlock(t *testing.T) {
+	net := newTestNetwork(3)
+	net.filterFn = func(src, dst uint64, msg *Message) bool {
+		block := msg.GetBlock()
+		return dst != 2 || block == nil || block.SeqNo != 1
+	}
+	net.start(loadTestConfig(), nil)
+	defer net.stop()
+
+	net.submit(0, 1)
+	for id := uint64(0); id < 2; id++ {
+		for deadline := time.Now().Add(5 * time.Second); len(net.stacks[id].txIDs()) < 1 && time.Now().Before(deadline); {
+			time.Sleep(time.Millisecond)
+		}
+	}
+	if len(net.stacks[2].txIDs()) != 0 {
+		t.Fatalf("Expected validator 2 to miss the first block")
+	}
+
+	net.mutex.Lock()
+	net.filterFn = nil
+	net.mutex.Unlock()
+	net.submit(0, 2)
+	if !net.waitFor(2) {
+		t.Fatalf("Expected validator 2 to fetch the block it missed, committed %v", net.stacks[2].txIDs())
+	}
+	if txs := net.stacks[2].txIDs(); !reflect.DeepEqual(txs, []string{"tx1", "tx2"}) {
+		t.Errorf("Expected validator 2 to commit the blocks in order, committed %v", txs)
+	}
+}
+
+func TestSoloOrdererExecutesRetainedBlocks(t *testing.T) {
+	net := newTestNetwork(1)
+	tx, _ := proto.Marshal(&pb.Transaction{Uuid: "tx1"})
+	raw, _ := proto.Marshal(&Block{SeqNo: 1, Requests: [][]byte{tx}})
+	net.start(loadTestConfig(), func(id uint64, s *testStack) {
+		s.state[blockKey(1)] = raw
+	})
+	defer net.stop()
+
+	if !net.waitFor(1) {
+		t.Fatalf("Expected the orderer to execute the block it ordered before it restarted")
+	}
+	net.submit(0, 2)
+	net.submit(0, 3)
+	if !net.waitFor(3) {
+		t.Fatalf("Expected the orderer to order on after the restored block")
+	}
+	if meta, _ := net.stacks[0].GetBlockHeadMetadata(); !reflect.DeepEqual(meta, mustMarshal(&Metadata{SeqNo: 2})) {
+		t.Errorf("Expected the block after the restored one to be numbered 2")
+	}
+}
+
+func mustMarshal(msg proto.Message) []byte {
+	raw, err := proto.Marshal(msg)
+	if err != nil {
+		panic(err)
+	}
+	return raw
+}
+
+func TestSoloHealthWhileMissingBlock(t *testing.T) {
+	net := newTestNetwork(2)
+	net.filterFn = func(src, dst uint64, msg *Message) bool {
+		return msg.GetBlock() == nil || msg.GetBlock().SeqNo != 1
+	}
+	net.start(loadTestConfig(), nil)
+	defer net.stop()
+
+	op := net.stacks[1].op
+	if health := op.Health(); !health.Healthy {
+		t.Errorf("Expected the replica to be healthy, got %v", health)
+	}
+
+	// the follower gets block 2 but neither block 1 nor its retransmission
+	net.submit(0, 1)
+	net.submit(0, 2)
+	net.submit(0, 3)
+	net.submit(0, 4)
+	for deadline := time.Now().Add(5 * time.Second); len(net.stacks[0].txIDs()) < 4 && time.Now().Before(deadline); {
+		time.Sleep(time.Millisecond)
+	}
+	for deadline := time.Now().Add(5 * time.Second); op.Health().Healthy && time.Now().Before(deadline); {
+		time.Sleep(time.Millisecond)
+	}
+	if health := op.Health(); health.Healthy {
+		t.Errorf("Expected the replica missing block 1 to be unhealthy")
+	}
+	if metrics := op.Metrics(); metrics["solo.lastExec"] != 0 || metrics["solo.queuedBlocks"] != 1 {
+		t.Errorf("Expected block 2 to wait for block 1, got %v", metrics)
+	}
+}
@@ -0,0 +1,91 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package util
+
+// BlockCutter cuts a stream of messages into blocks of at most
+// maxMessageCount messages and maxBytes bytes, zero meaning no limit. A
+// message which would exceed maxBytes starts the next block, and a message
+// larger than maxBytes is cut into a block of its own. The same messages
+// arriving in the same order are cut into the same blocks.
+type BlockCutter struct {
+	maxMessageCount int
+	maxBytes        int
+
+	pending      []interface{}
+	pendingBytes int
+}
+
+// NewBlockCutter creates a BlockCutter with no message pending
+func NewBlockCutter(maxMessageCount, maxBytes int) *BlockCutter {
+	return &BlockCutter{
+		maxMessageCount: maxMessageCount,
+		maxBytes:        maxBytes,
+	}
+}
+
+// MaxMessageCount returns the most messages a block holds, zero if unlimited
+func (bc *BlockCutter) MaxMessageCount() int {
+	return bc.maxMessageCount
+}
+
+// MaxBytes returns the most bytes the messages of a block hold, zero if
+// unlimited
+func (bc *BlockCutter) MaxBytes() int {
+	return bc.maxBytes
+}
+
+// Pending returns how many messages wait for the next block
+func (bc *BlockCutter) Pending() int {
+	return len(bc.pending)
+}
+
+// PendingBytes returns the size of the messages waiting for the next block
+func (bc *BlockCutter) PendingBytes() int {
+	return bc.pendingBytes
+}
+
+// Ordered adds the next message, of size bytes, and returns the blocks it
+// completed and whether messages are left pending for the next block
+func (bc *BlockCutter) Ordered(msg interface{}, size int) (blocks [][]interface{}, pending bool) {
+	if bc.maxBytes > 0 && size > bc.maxBytes {
+		// an oversized message goes into a block of its own
+		if len(bc.pending) > 0 {
+			blocks = append(blocks, bc.Cut())
+		}
+		return append(blocks, []interface{}{msg}), false
+	}
+
+	if bc.maxBytes > 0 && bc.pendingBytes+size > bc.maxBytes {
+		blocks = append(blocks, bc.Cut())
+	}
+
+	bc.pending = append(bc.pending, msg)
+	bc.pendingBytes += size
+
+	if bc.maxMessageCount > 0 && len(bc.pending) >= bc.maxMessageCount {
+		blocks = append(blocks, bc.Cut())
+	}
+	return blocks, len(bc.pending) > 0
+}
+
+// Cut returns the pending messages as a block, nil if there are none
+func (bc *BlockCutter) Cut() []interface{} {
+	block := bc.pending
+	bc.pending = nil
+	bc.pendingBytes = 0
+	return block
+}
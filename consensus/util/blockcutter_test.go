@@ -0,0 +1,60 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package util
+
+import (
+	"testing"
+)
+
+func TestCutByMessageCount(t *testing.T) {
+	bc := NewBlockCutter(2, 0)
+	if blocks, pending := bc.Ordered("a", 1); len(blocks) != 0 || !pending {
+		t.Fatalf("Expected the first message to be pending, got %d blocks", len(blocks))
+	}
+	blocks, pending := bc.Ordered("b", 1)
+	if len(blocks) != 1 || len(blocks[0]) != 2 || pending {
+		t.Fatalf("Expected a block of two messages, got %v, pending %v", blocks, pending)
+	}
+}
+
+func TestCutByBytes(t *testing.T) {
+	bc := NewBlockCutter(0, 10)
+	bc.Ordered("a", 6)
+	blocks, pending := bc.Ordered("b", 6)
+	if len(blocks) != 1 || len(blocks[0]) != 1 || !pending {
+		t.Fatalf("Expected the second message to start the next block, got %d blocks, pending %v", len(blocks), pending)
+	}
+	blocks, pending = bc.Ordered("c", 4)
+	if len(blocks) != 0 || !pending || bc.PendingBytes() != 10 {
+		t.Fatalf("Expected a message filling the block exactly to stay pending, got %d blocks", len(blocks))
+	}
+	if block := bc.Cut(); len(block) != 2 || block[0] != "b" || block[1] != "c" {
+		t.Errorf("Expected the pending block to hold the last two messages, it holds %v", block)
+	}
+}
+
+func TestCutOversizedMessage(t *testing.T) {
+	bc := NewBlockCutter(0, 10)
+	bc.Ordered("a", 4)
+	blocks, pending := bc.Ordered("b", 20)
+	if len(blocks) != 2 || len(blocks[0]) != 1 || len(blocks[1]) != 1 || blocks[1][0] != "b" || pending {
+		t.Fatalf("Expected the pending message and the oversized one in blocks of their own, got %v, pending %v", blocks, pending)
+	}
+	if block := bc.Cut(); block != nil {
+		t.Errorf("Expected nothing to be pending, got %d messages", len(block))
+	}
+}
@@ -0,0 +1,98 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package election
+
+import (
+	"math/rand"
+	"time"
+
+	"github.com/hyperledger/fabric/consensus/util/events"
+)
+
+// TimeoutEvent is delivered on the event manager of a plugin when the timeout
+// of its Detector expires
+type TimeoutEvent struct {
+	Detector *Detector
+}
+
+// Detector suspects the failure of the leader, or of the leader's contact to
+// the other replicas, when the plugin hears too little within a timeout.  The
+// timeout is randomized between once and twice its configured value, so that
+// replicas which lost their leader together do not campaign together.  The
+// plugin records what it hears, and on a TimeoutEvent it decides from that
+// whether to campaign or step down, then calls Expire and Reset.
+type Detector struct {
+	timer   events.Timer
+	timeout time.Duration
+	random  *rand.Rand
+
+	leaderContact bool            // whether a leader was heard from since the last expiry
+	heard         map[uint64]bool // replicas heard from since the last expiry
+}
+
+// NewDetector creates a Detector which delivers its TimeoutEvent through
+// timer, seed should differ between the replicas
+func NewDetector(timer events.Timer, timeout time.Duration, seed int64) *Detector {
+	return &Detector{
+		timer:   timer,
+		timeout: timeout,
+		random:  rand.New(rand.NewSource(seed)),
+		heard:   make(map[uint64]bool),
+	}
+}
+
+// Timeout returns the configured timeout, the least the detector waits
+func (d *Detector) Timeout() time.Duration {
+	return d.timeout
+}
+
+// Reset restarts the countdown with a new randomized timeout
+func (d *Detector) Reset() {
+	timeout := d.timeout + time.Duration(d.random.Int63n(int64(d.timeout)))
+	d.timer.Reset(timeout, TimeoutEvent{d})
+}
+
+// Halt stops the countdown for good
+func (d *Detector) Halt() {
+	d.timer.Halt()
+}
+
+// HeardLeader records that a leader was heard from
+func (d *Detector) HeardLeader() {
+	d.leaderContact = true
+}
+
+// LeaderContact returns whether a leader was heard from since the last expiry
+func (d *Detector) LeaderContact() bool {
+	return d.leaderContact
+}
+
+// Heard records that a replica was heard from
+func (d *Detector) Heard(id uint64) {
+	d.heard[id] = true
+}
+
+// Active returns the replicas heard from since the last expiry
+func (d *Detector) Active() map[uint64]bool {
+	return d.heard
+}
+
+// Expire forgets what was heard, once the plugin acted on a timeout
+func (d *Detector) Expire() {
+	d.leaderContact = false
+	d.heard = make(map[uint64]bool)
+}
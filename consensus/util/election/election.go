@@ -0,0 +1,218 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package election tracks the terms, votes and leaders of the consensus
+// plugins which have a single replica order the transactions, and detects the
+// failure of that replica with a timer on the plugin's event manager.
+//
+// Raft elects its leader with a Term and a Detector.  pbft rotates its
+// primary through the views instead of electing it, RoundRobin maps a view to
+// its primary.  Neither type is safe for concurrent use, a plugin calls them
+// from the thread of its event manager.
+package election
+
+import (
+	"sort"
+)
+
+// Role of a replica in a term
+type Role int
+
+// The roles of a replica: a follower learns the leader of the term, a
+// candidate asks the other replicas to elect it, and the leader orders
+const (
+	Follower Role = iota
+	Candidate
+	Leader
+)
+
+func (r Role) String() string {
+	switch r {
+	case Follower:
+		return "follower"
+	case Candidate:
+		return "candidate"
+	default:
+		return "leader"
+	}
+}
+
+// HardState is the part of a Term which must be persisted before the replica
+// acts on it, a replica which restarts may not vote twice in a term
+type HardState struct {
+	Term     uint64
+	Voted    bool
+	VotedFor uint64
+}
+
+// Quorum returns whether a set of replicas decides an election
+type Quorum func(set map[uint64]bool) bool
+
+// Majority is the quorum of more than half of the members, which may change
+// from one call to the next
+func Majority(members func() []uint64) Quorum {
+	return func(set map[uint64]bool) bool {
+		count := 0
+		all := members()
+		for _, member := range all {
+			if set[member] {
+				count++
+			}
+		}
+		return count > len(all)/2
+	}
+}
+
+// RoundRobin returns the leader of a term when the replicas take turns, as
+// the pbft primaries do through the views
+func RoundRobin(term uint64, replicaCount int) uint64 {
+	return term % uint64(replicaCount)
+}
+
+// Term tracks the current term of a replica, its role and vote in the term,
+// and the leader of the term once it is known
+type Term struct {
+	id        uint64
+	quorum    Quorum
+	hard      HardState
+	role      Role
+	leader    uint64
+	hasLeader bool
+	votes     map[uint64]bool
+}
+
+// NewTerm creates a follower in term 0, which elects its leaders by quorum
+func NewTerm(id uint64, quorum Quorum) *Term {
+	return &Term{id: id, quorum: quorum}
+}
+
+// Restore resumes the term and vote persisted before a restart, as a follower
+func (t *Term) Restore(hard HardState) {
+	t.hard = hard
+	t.StepDown()
+}
+
+// HardState returns the term and vote to persist
+func (t *Term) HardState() HardState {
+	return t.hard
+}
+
+// Current returns the current term
+func (t *Term) Current() uint64 {
+	return t.hard.Term
+}
+
+// Role returns the role of the replica in the current term
+func (t *Term) Role() Role {
+	return t.role
+}
+
+// Leader returns the leader of the current term, if it is known
+func (t *Term) Leader() (leader uint64, known bool) {
+	return t.leader, t.hasLeader
+}
+
+// Voters returns the replicas which voted for the replica in the current
+// term, while it is a candidate or the leader it made
+func (t *Term) Voters() []uint64 {
+	var voters []uint64
+	for id := range t.votes {
+		voters = append(voters, id)
+	}
+	sort.Sort(uint64Slice(voters))
+	return voters
+}
+
+// Observe moves the replica to a later term it learnt of, as a follower of a
+// leader yet to be learnt.  It returns whether the hard state changed.
+func (t *Term) Observe(term uint64) bool {
+	if term <= t.hard.Term {
+		return false
+	}
+	t.hard = HardState{Term: term}
+	t.StepDown()
+	return true
+}
+
+// StepDown makes the replica a follower in the current term, of a leader yet
+// to be learnt
+func (t *Term) StepDown() {
+	t.role = Follower
+	t.hasLeader = false
+	t.votes = nil
+}
+
+// Campaign moves the replica to the next term as a candidate which votes for
+// itself.  It returns whether it won already, its own vote being a quorum.
+// The hard state always changes.
+func (t *Term) Campaign() bool {
+	t.hard = HardState{Term: t.hard.Term + 1, Voted: true, VotedFor: t.id}
+	t.role = Candidate
+	t.hasLeader = false
+	t.votes = map[uint64]bool{t.id: true}
+	return t.tally()
+}
+
+// CanVote returns whether the replica may vote for a candidate in a term: the
+// term is the current one, and the replica voted for no other candidate in it
+func (t *Term) CanVote(candidate, term uint64) bool {
+	return term == t.hard.Term && (!t.hard.Voted || t.hard.VotedFor == candidate)
+}
+
+// Vote records the vote of the replica for a candidate in the current term,
+// the hard state changes
+func (t *Term) Vote(candidate uint64) {
+	t.hard.Voted = true
+	t.hard.VotedFor = candidate
+}
+
+// Tally counts a vote granted to the replica in a term, it returns whether
+// the vote won the replica the election
+func (t *Term) Tally(voter, term uint64) bool {
+	if t.role != Candidate || term != t.hard.Term {
+		return false
+	}
+	t.votes[voter] = true
+	return t.tally()
+}
+
+// tally makes a candidate with a quorum of votes the leader
+func (t *Term) tally() bool {
+	if !t.quorum(t.votes) {
+		return false
+	}
+	t.role = Leader
+	t.leader = t.id
+	t.hasLeader = true
+	return true
+}
+
+// Follow records the leader of the current term, it returns whether the
+// leader was not known before
+func (t *Term) Follow(leader uint64) bool {
+	if t.hasLeader && t.leader == leader {
+		return false
+	}
+	t.leader = leader
+	t.hasLeader = true
+	return true
+}
+
+type uint64Slice []uint64
+
+func (a uint64Slice) Len() int           { return len(a) }
+func (a uint64Slice) Swap(i, j int)      { a[i], a[j] = a[j], a[i] }
+func (a uint64Slice) Less(i, j int) bool { return a[i] < a[j] }
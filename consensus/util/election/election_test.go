@@ -0,0 +1,149 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package election
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/hyperledger/fabric/consensus/util/events"
+)
+
+func members(ids ...uint64) Quorum {
+	return Majority(func() []uint64 { return ids })
+}
+
+func TestMajority(t *testing.T) {
+	quorum := members(0, 1, 2, 3)
+	if quorum(map[uint64]bool{0: true, 1: true}) {
+		t.Errorf("Expected half of the members not to be a quorum")
+	}
+	if !quorum(map[uint64]bool{0: true, 1: true, 3: true}) {
+		t.Errorf("Expected more than half of the members to be a quorum")
+	}
+	if quorum(map[uint64]bool{0: true, 4: true, 5: true}) {
+		t.Errorf("Expected replicas which are no members not to count")
+	}
+}
+
+func TestRoundRobin(t *testing.T) {
+	for term, expected := range []uint64{0, 1, 2, 3, 0, 1} {
+		if leader := RoundRobin(uint64(term), 4); leader != expected {
+			t.Errorf("Expected replica %d to lead term %d, got %d", expected, term, leader)
+		}
+	}
+}
+
+func TestElection(t *testing.T) {
+	term := NewTerm(0, members(0, 1, 2))
+	if term.Campaign() {
+		t.Fatalf("Expected a single vote not to win")
+	}
+	if term.Current() != 1 || term.Role() != Candidate || term.HardState() != (HardState{Term: 1, Voted: true, VotedFor: 0}) {
+		t.Fatalf("Expected a candidate which voted for itself in term 1, got a %s with %+v", term.Role(), term.HardState())
+	}
+	if term.Tally(1, 0) {
+		t.Errorf("Expected a vote of an earlier term not to count")
+	}
+	if !term.Tally(2, 1) {
+		t.Fatalf("Expected a majority of votes to win")
+	}
+	if leader, ok := term.Leader(); term.Role() != Leader || !ok || leader != 0 {
+		t.Errorf("Expected the candidate to lead, it is a %s", term.Role())
+	}
+	if voters := term.Voters(); !reflect.DeepEqual(voters, []uint64{0, 2}) {
+		t.Errorf("Expected votes of 0 and 2, got %v", voters)
+	}
+
+	if !term.Observe(3) || term.Role() != Follower || term.HardState() != (HardState{Term: 3}) {
+		t.Fatalf("Expected a later term to make a follower which did not vote, got a %s with %+v", term.Role(), term.HardState())
+	}
+	if _, ok := term.Leader(); ok {
+		t.Errorf("Expected the leader of the later term to be unknown")
+	}
+	if term.Observe(2) {
+		t.Errorf("Expected an earlier term not to change the term")
+	}
+	if !term.Follow(1) || term.Follow(1) {
+		t.Errorf("Expected the leader to be new only once")
+	}
+}
+
+func TestVote(t *testing.T) {
+	term := NewTerm(0, members(0, 1, 2))
+	term.Observe(2)
+	if term.CanVote(1, 1) {
+		t.Errorf("Expected no vote in an earlier term")
+	}
+	if !term.CanVote(1, 2) {
+		t.Fatalf("Expected a vote in the current term")
+	}
+	term.Vote(1)
+	if !term.CanVote(1, 2) || term.CanVote(2, 2) {
+		t.Errorf("Expected a vote for the same candidate only")
+	}
+
+	restarted := NewTerm(0, members(0, 1, 2))
+	restarted.Restore(term.HardState())
+	if restarted.CanVote(2, 2) || restarted.Role() != Follower {
+		t.Errorf("Expected the vote to survive a restart")
+	}
+}
+
+func TestSingleMemberWins(t *testing.T) {
+	term := NewTerm(5, members(5))
+	if !term.Campaign() || term.Role() != Leader {
+		t.Errorf("Expected the only member to win with its own vote")
+	}
+}
+
+type testTimer struct {
+	duration time.Duration
+	event    events.Event
+}
+
+func (tt *testTimer) SoftReset(duration time.Duration, event events.Event) {}
+func (tt *testTimer) Reset(duration time.Duration, event events.Event) {
+	tt.duration, tt.event = duration, event
+}
+func (tt *testTimer) Stop() {}
+func (tt *testTimer) Halt() {}
+
+func TestDetector(t *testing.T) {
+	timer := &testTimer{}
+	d := NewDetector(timer, time.Second, 1)
+	for i := 0; i < 10; i++ {
+		d.Reset()
+		if timer.duration < time.Second || timer.duration >= 2*time.Second {
+			t.Fatalf("Expected a timeout between once and twice the configured one, got %v", timer.duration)
+		}
+	}
+	if event, ok := timer.event.(TimeoutEvent); !ok || event.Detector != d {
+		t.Errorf("Expected the timer to deliver a TimeoutEvent of the detector, got %v", timer.event)
+	}
+
+	d.HeardLeader()
+	d.Heard(2)
+	if !d.LeaderContact() || !d.Active()[2] {
+		t.Errorf("Expected the detector to record what it heard")
+	}
+	d.Expire()
+	if d.LeaderContact() || len(d.Active()) != 0 {
+		t.Errorf("Expected the detector to forget what it heard once expired")
+	}
+}
@@ -137,6 +137,32 @@ func (em *managerImpl) eventLoop() {
 	}
 }
 
+// WorkEvent is a function to run on the thread of a Manager, the Receiver
+// calls it when it is delivered
+type WorkEvent func()
+
+// MainThreadTimeout bounds how long OnMainThread waits for the thread of a
+// Manager, both to queue the work and for the work to run
+const MainThreadTimeout = time.Second
+
+// OnMainThread runs fn on the thread of the manager, whose Receiver must call
+// the WorkEvents it is delivered, and returns false if the thread did not run
+// fn within MainThreadTimeout
+func OnMainThread(manager Manager, fn func()) bool {
+	done := make(chan struct{})
+	select {
+	case manager.Queue() <- WorkEvent(func() { fn(); close(done) }):
+	case <-time.After(MainThreadTimeout):
+		return false
+	}
+	select {
+	case <-done:
+		return true
+	case <-time.After(MainThreadTimeout):
+		return false
+	}
+}
+
 // ------------------------------------------------------------
 //
 // Event Timer
@@ -170,3 +170,24 @@ func TestEventManagerLoop(t *testing.T) {
 		t.Fatalf("Did not succeed processing second event")
 	}
 }
+
+func TestOnMainThread(t *testing.T) {
+	mr := newMockManager(func(event Event) Event {
+		if work, ok := event.(WorkEvent); ok {
+			work()
+		}
+		return nil
+	})
+	mr.Start()
+	defer mr.Halt()
+
+	ran := false
+	if !OnMainThread(mr, func() { ran = true }) || !ran {
+		t.Fatalf("Expected the function to run on the thread of the manager")
+	}
+
+	stuck := newMockManager(nil)
+	if OnMainThread(stuck, func() {}) {
+		t.Errorf("Expected a manager whose thread does not run to time out")
+	}
+}
@@ -0,0 +1,153 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package util
+
+import (
+	"fmt"
+	"sync"
+
+	pb "github.com/hyperledger/fabric/protos"
+)
+
+// DefaultStreamSize is the number of messages a stream of a MemoryNetwork
+// buffers before the sender is rejected
+const DefaultStreamSize = 1000
+
+// MemoryNetwork connects MemoryTransports in process, so consensus plugins can
+// be run without core/peer, in unit tests in particular
+type MemoryNetwork struct {
+	lock       sync.Mutex
+	streamSize int
+	transports map[pb.PeerID]*MemoryTransport
+	closed     bool
+}
+
+// MemoryTransport is the consensus transport of one peer of a MemoryNetwork,
+// every other peer sends to it over a stream of its own
+type MemoryTransport struct {
+	id      *pb.PeerID
+	network *MemoryNetwork
+	fan     *MessageFan
+	streams map[pb.PeerID]chan *Message // Guarded by the network lock
+}
+
+// NewMemoryNetwork returns an empty MemoryNetwork, whose streams buffer
+// streamSize messages, DefaultStreamSize if not positive
+func NewMemoryNetwork(streamSize int) *MemoryNetwork {
+	if streamSize <= 0 {
+		streamSize = DefaultStreamSize
+	}
+	return &MemoryNetwork{
+		streamSize: streamSize,
+		transports: make(map[pb.PeerID]*MemoryTransport),
+	}
+}
+
+// Transport returns the transport of the peer id, connecting it to the network
+// on first use
+func (net *MemoryNetwork) Transport(id *pb.PeerID) *MemoryTransport {
+	net.lock.Lock()
+	defer net.lock.Unlock()
+	if t, ok := net.transports[*id]; ok {
+		return t
+	}
+	t := &MemoryTransport{
+		id:      id,
+		network: net,
+		fan:     NewMessageFan(),
+		streams: make(map[pb.PeerID]chan *Message),
+	}
+	net.transports[*id] = t
+	return t
+}
+
+// Close closes every stream of the network, the messages already sent are
+// still received, the later ones are rejected
+func (net *MemoryNetwork) Close() {
+	net.lock.Lock()
+	defer net.lock.Unlock()
+	if net.closed {
+		return
+	}
+	net.closed = true
+	for _, t := range net.transports {
+		for _, stream := range t.streams {
+			close(stream)
+		}
+	}
+}
+
+// Send sends a message to a single peer of the network
+func (t *MemoryTransport) Send(msg *pb.Message, receiverHandle *pb.PeerID) error {
+	t.network.lock.Lock()
+	defer t.network.lock.Unlock()
+	if t.network.closed {
+		return fmt.Errorf("Network closed, cannot send to %v", receiverHandle)
+	}
+	receiver, ok := t.network.transports[*receiverHandle]
+	if !ok {
+		return fmt.Errorf("Peer %v is not connected to the network", receiverHandle)
+	}
+	return receiver.deliver(t.id, msg, t.network.streamSize)
+}
+
+// Broadcast sends a message to every other peer of the network, the peers of
+// a MemoryNetwork being all validators peerType is not considered
+func (t *MemoryTransport) Broadcast(msg *pb.Message, peerType pb.PeerEndpoint_Type) error {
+	t.network.lock.Lock()
+	defer t.network.lock.Unlock()
+	if t.network.closed {
+		return fmt.Errorf("Network closed, cannot broadcast")
+	}
+	var failed bool
+	for id, receiver := range t.network.transports {
+		if id == *t.id {
+			continue
+		}
+		if err := receiver.deliver(t.id, msg, t.network.streamSize); err != nil {
+			logger.Warningf("Could not broadcast to %v: %s", receiver.id, err)
+			failed = true
+		}
+	}
+	if failed {
+		return fmt.Errorf("Couldn't broadcast successfully")
+	}
+	return nil
+}
+
+// Receive returns the messages of every peer, each peer's in the order it sent them
+func (t *MemoryTransport) Receive() <-chan *Message {
+	return t.fan.GetOutChannel()
+}
+
+// deliver queues a copy of msg on the stream from sender, it must be called
+// with the network lock held
+func (t *MemoryTransport) deliver(sender *pb.PeerID, msg *pb.Message, streamSize int) error {
+	stream, ok := t.streams[*sender]
+	if !ok {
+		stream = make(chan *Message, streamSize)
+		t.streams[*sender] = stream
+		t.fan.RegisterChannel(sender, stream)
+	}
+	copied := *msg
+	select {
+	case stream <- &Message{Msg: &copied, Sender: sender}:
+		return nil
+	default:
+		return fmt.Errorf("Stream from %v to %v full, rejecting", sender, t.id)
+	}
+}
@@ -0,0 +1,90 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package util
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	pb "github.com/hyperledger/fabric/protos"
+)
+
+func TestMemoryTransportOrderPerPeer(t *testing.T) {
+	net := NewMemoryNetwork(0)
+	defer net.Close()
+	ids := []*pb.PeerID{{Name: "vp0"}, {Name: "vp1"}, {Name: "vp2"}}
+	for _, id := range ids {
+		net.Transport(id)
+	}
+
+	const Messages = 100
+	for i := 0; i < Messages; i++ {
+		payload := []byte(fmt.Sprintf("%d", i))
+		if err := net.Transport(ids[0]).Broadcast(&pb.Message{Payload: payload}, pb.PeerEndpoint_VALIDATOR); err != nil {
+			t.Fatalf("Broadcast failed: %s", err)
+		}
+		if err := net.Transport(ids[1]).Send(&pb.Message{Payload: payload}, ids[2]); err != nil {
+			t.Fatalf("Send failed: %s", err)
+		}
+	}
+
+	next := make(map[string]int)
+	for count := 0; count < 2*Messages; count++ {
+		select {
+		case msg := <-net.Transport(ids[2]).Receive():
+			if expected := fmt.Sprintf("%d", next[msg.Sender.Name]); string(msg.Msg.Payload) != expected {
+				t.Fatalf("Expected message %s from %v, got %s", expected, msg.Sender, msg.Msg.Payload)
+			}
+			next[msg.Sender.Name]++
+		case <-time.After(time.Second):
+			t.Fatalf("Timed out waiting for message %d", count)
+		}
+	}
+
+	select {
+	case msg := <-net.Transport(ids[0]).Receive():
+		t.Fatalf("Expected the broadcaster not to receive its own message, got %v", msg)
+	default:
+	}
+}
+
+func TestMemoryTransportRejects(t *testing.T) {
+	net := NewMemoryNetwork(1)
+	src := net.Transport(&pb.PeerID{Name: "vp0"})
+	dst := &pb.PeerID{Name: "vp1"}
+
+	if err := src.Send(&pb.Message{}, dst); err == nil {
+		t.Errorf("Expected sending to an unknown peer to fail")
+	}
+
+	// Nothing drains vp1, the fan holds one message and the stream buffers another
+	net.Transport(dst)
+	var err error
+	for i := 0; i < 3 && err == nil; i++ {
+		err = src.Send(&pb.Message{}, dst)
+		time.Sleep(10 * time.Millisecond)
+	}
+	if err == nil {
+		t.Errorf("Expected sending to a full stream to fail")
+	}
+
+	net.Close()
+	if err := src.Send(&pb.Message{}, dst); err == nil {
+		t.Errorf("Expected sending over a closed network to fail")
+	}
+}
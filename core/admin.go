@@ -17,6 +17,7 @@ limitations under the License.
 package core
 
 import (
+	"fmt"
 	"os"
 	"runtime"
 
@@ -26,6 +27,8 @@ import (
 
 	"google/protobuf"
 
+	"github.com/hyperledger/fabric/core/db"
+	"github.com/hyperledger/fabric/core/ledger"
 	pb "github.com/hyperledger/fabric/protos"
 )
 
@@ -39,6 +42,16 @@ func NewAdminServer() *ServerAdmin {
 
 // ServerAdmin implementation of the Admin service for the Peer
 type ServerAdmin struct {
+	consensusState  func() ([]byte, error)
+	consensusReload func() error
+	consensusSwitch func(plugin string, height uint64) error
+	consensusHealth func() (*pb.ConsensusHealth, error)
+	clientLimit     func(client string, rate float64, burst int) error
+}
+
+// SetConsensusStateFunc sets the function which reports the state of the consensus plugin
+func (s *ServerAdmin) SetConsensusStateFunc(consensusState func() ([]byte, error)) {
+	s.consensusState = consensusState
 }
 
 func worker(id int, die chan struct{}) {
@@ -79,3 +92,141 @@ func (*ServerAdmin) StopServer(context.Context, *google_protobuf.Empty) (*pb.Ser
 	defer os.Exit(0)
 	return status, nil
 }
+
+// SetConsensusReloadFunc sets the function which reloads the configuration of the consensus plugin
+func (s *ServerAdmin) SetConsensusReloadFunc(consensusReload func() error) {
+	s.consensusReload = consensusReload
+}
+
+// SetConsensusSwitchFunc sets the function which switches the consensus plugin
+func (s *ServerAdmin) SetConsensusSwitchFunc(consensusSwitch func(plugin string, height uint64) error) {
+	s.consensusSwitch = consensusSwitch
+}
+
+// SetConsensusHealthFunc sets the function which polls the health of the consensus plugin
+func (s *ServerAdmin) SetConsensusHealthFunc(consensusHealth func() (*pb.ConsensusHealth, error)) {
+	s.consensusHealth = consensusHealth
+}
+
+// GetConsensusState reports the internal state of the consensus plugin
+func (s *ServerAdmin) GetConsensusState(context.Context, *google_protobuf.Empty) (*pb.ConsensusState, error) {
+	if s.consensusState == nil {
+		return nil, fmt.Errorf("Consensus is not running on this peer")
+	}
+	state, err := s.consensusState()
+	if err != nil {
+		return nil, fmt.Errorf("Error retrieving consensus state: %s", err)
+	}
+	log.Debugf("returning consensus state of %d bytes", len(state))
+	return &pb.ConsensusState{State: string(state)}, nil
+}
+
+// ReloadConsensusConfig reloads the configuration of the consensus plugin
+func (s *ServerAdmin) ReloadConsensusConfig(context.Context, *google_protobuf.Empty) (*google_protobuf.Empty, error) {
+	if s.consensusReload == nil {
+		return nil, fmt.Errorf("Consensus is not running on this peer")
+	}
+	if err := s.consensusReload(); err != nil {
+		return nil, fmt.Errorf("Error reloading consensus configuration: %s", err)
+	}
+	log.Info("Reloaded consensus configuration")
+	return &google_protobuf.Empty{}, nil
+}
+
+// SwitchConsensusPlugin switches the consensus plugin once the blockchain reaches the requested height
+func (s *ServerAdmin) SwitchConsensusPlugin(ctx context.Context, req *pb.ConsensusSwitch) (*google_protobuf.Empty, error) {
+	if s.consensusSwitch == nil {
+		return nil, fmt.Errorf("Consensus is not running on this peer")
+	}
+	if err := s.consensusSwitch(req.Plugin, req.Height); err != nil {
+		return nil, fmt.Errorf("Error switching consensus plugin: %s", err)
+	}
+	log.Infof("Consensus plugin %s scheduled to take over at block %d", req.Plugin, req.Height)
+	return &google_protobuf.Empty{}, nil
+}
+
+// SetClientLimitFunc sets the function which overrides the transaction rate limits of a client
+func (s *ServerAdmin) SetClientLimitFunc(clientLimit func(client string, rate float64, burst int) error) {
+	s.clientLimit = clientLimit
+}
+
+// SetClientLimit overrides the transaction rate limits of a client until the peer restarts
+func (s *ServerAdmin) SetClientLimit(ctx context.Context, req *pb.ClientLimit) (*google_protobuf.Empty, error) {
+	if s.clientLimit == nil {
+		return nil, fmt.Errorf("Consensus is not running on this peer")
+	}
+	if req.Client == "" {
+		return nil, fmt.Errorf("No client given")
+	}
+	if err := s.clientLimit(req.Client, req.Rate, int(req.Burst)); err != nil {
+		return nil, fmt.Errorf("Error setting client limit: %s", err)
+	}
+	if req.Rate < 0 {
+		log.Infof("Restored the configured transaction rate limits of client %s", req.Client)
+	} else {
+		log.Infof("Limited client %s to %v transactions per second, bursts of %d", req.Client, req.Rate, req.Burst)
+	}
+	return &google_protobuf.Empty{}, nil
+}
+
+// ExportLedgerSnapshot writes a snapshot of the ledger to a new file on the
+// host of the peer, which a new peer can be bootstrapped from
+func (s *ServerAdmin) ExportLedgerSnapshot(ctx context.Context, req *pb.LedgerSnapshot) (*pb.LedgerSnapshot, error) {
+	if req.Path == "" {
+		return nil, fmt.Errorf("No snapshot file given")
+	}
+	ledger, err := ledger.GetLedger()
+	if err != nil {
+		return nil, fmt.Errorf("Error getting ledger: %s", err)
+	}
+	file, err := os.OpenFile(req.Path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("Error creating snapshot file: %s", err)
+	}
+	info, err := ledger.ExportSnapshot(file)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(req.Path)
+		return nil, fmt.Errorf("Error exporting ledger snapshot: %s", err)
+	}
+	log.Infof("Exported a snapshot of the ledger at height %d to %s", info.Height, req.Path)
+	return &pb.LedgerSnapshot{Path: req.Path, Height: info.Height, BlockHash: info.BlockHash, StateHash: info.StateHash}, nil
+}
+
+// GetLedgerDBStats reports the statistics of the database the ledger is kept in
+func (s *ServerAdmin) GetLedgerDBStats(context.Context, *google_protobuf.Empty) (*pb.LedgerDBStats, error) {
+	backend, stats, err := db.GetDBHandle().GetStats()
+	if err != nil {
+		return nil, err
+	}
+	return &pb.LedgerDBStats{Backend: backend, Stats: stats}, nil
+}
+
+// CollectLedgerGarbage removes the rows of the ledger database no block refers
+// to any longer, and reports the space reclaimed
+func (s *ServerAdmin) CollectLedgerGarbage(context.Context, *google_protobuf.Empty) (*pb.LedgerGarbage, error) {
+	ledger, err := ledger.GetLedger()
+	if err != nil {
+		return nil, fmt.Errorf("Error getting ledger: %s", err)
+	}
+	garbage, err := ledger.CollectGarbage()
+	if err != nil {
+		return nil, fmt.Errorf("Error collecting ledger garbage: %s", err)
+	}
+	return garbage, nil
+}
+
+// GetConsensusHealth reports the health and metrics of the consensus plugin
+func (s *ServerAdmin) GetConsensusHealth(context.Context, *google_protobuf.Empty) (*pb.ConsensusHealth, error) {
+	if s.consensusHealth == nil {
+		return nil, fmt.Errorf("Consensus is not running on this peer")
+	}
+	health, err := s.consensusHealth()
+	if err != nil {
+		return nil, fmt.Errorf("Error polling consensus health: %s", err)
+	}
+	log.Debugf("returning consensus health: %s", health)
+	return health, nil
+}
@@ -0,0 +1,53 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package chaincode
+
+import (
+	"fmt"
+
+	"github.com/spf13/viper"
+
+	"github.com/hyperledger/fabric/core/container"
+	pb "github.com/hyperledger/fabric/protos"
+)
+
+// checkBuild verifies that the code package of the deployment has the build
+// digest the deploying peer recorded, if any, for every peer to build the
+// same chaincode. With reproducible builds, chaincodes must be deployed with
+// a build digest, and their containers from base images pinned by digest
+func checkBuild(cds *pb.ChaincodeDeploymentSpec) error {
+	if cds.ExecEnv == pb.ChaincodeDeploymentSpec_SYSTEM {
+		return nil
+	}
+	name := cds.ChaincodeSpec.ChaincodeID.Name
+	reproducible := viper.GetBool("chaincode.reproducible")
+	if cds.BuildDigest == "" {
+		if reproducible {
+			return fmt.Errorf("The deployment of chaincode %s records no build digest", name)
+		}
+		return nil
+	}
+	if err := container.VerifyBuildDigest(cds.CodePackage, cds.BuildDigest); err != nil {
+		return fmt.Errorf("Refusing to build chaincode %s: %s", name, err)
+	}
+	if reproducible && cds.ExecEnv == pb.ChaincodeDeploymentSpec_DOCKER {
+		if err := container.CheckPinnedBaseImages(cds.CodePackage); err != nil {
+			return fmt.Errorf("Refusing to build chaincode %s: %s", name, err)
+		}
+	}
+	return nil
+}
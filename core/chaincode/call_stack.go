@@ -0,0 +1,72 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package chaincode
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// maxCallDepthDefault is the number of nested chaincode calls allowed in a
+// transaction when chaincode.maxcalldepth is not set
+const maxCallDepthDefault = 8
+
+// callStacks keeps, for each transaction in which chaincodes call other
+// chaincodes, the chaincodes being called, the chaincode running the
+// transaction first
+type callStacks struct {
+	sync.Mutex
+	stacks map[string][]string
+}
+
+func newCallStacks() *callStacks {
+	return &callStacks{stacks: make(map[string][]string)}
+}
+
+// enter records the call of callee by caller in the transaction uuid. It
+// refuses a call which would loop back to a chaincode being called, or nest
+// more than maxDepth calls
+func (cs *callStacks) enter(uuid string, caller string, callee string, maxDepth int) error {
+	cs.Lock()
+	defer cs.Unlock()
+	stack := cs.stacks[uuid]
+	if len(stack) == 0 {
+		stack = []string{caller}
+	}
+	for _, chaincode := range stack {
+		if chaincode == callee {
+			return fmt.Errorf("Chaincode %s called in a loop (%s -> %s)", callee, strings.Join(stack, " -> "), callee)
+		}
+	}
+	if len(stack) > maxDepth {
+		return fmt.Errorf("Chaincode %s called beyond the maximum depth of %d calls (%s -> %s)", callee, maxDepth, strings.Join(stack, " -> "), callee)
+	}
+	cs.stacks[uuid] = append(stack, callee)
+	return nil
+}
+
+// exit records the end of the last call entered in the transaction uuid
+func (cs *callStacks) exit(uuid string) {
+	cs.Lock()
+	defer cs.Unlock()
+	stack := cs.stacks[uuid]
+	if len(stack) <= 2 {
+		delete(cs.stacks, uuid)
+		return
+	}
+	cs.stacks[uuid] = stack[:len(stack)-1]
+}
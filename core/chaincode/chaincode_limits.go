@@ -0,0 +1,157 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package chaincode
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/spf13/viper"
+
+	"github.com/hyperledger/fabric/core/ledger"
+	pb "github.com/hyperledger/fabric/protos"
+)
+
+// timeoutDefault is the timeout of a transaction or query, in milliseconds,
+// of the chaincodes which set none, unless chaincode.limits.timeout is set
+const timeoutDefault = 30000
+
+// getDefaultLimits returns the limits of the chaincodes which set none, read
+// from chaincode.limits
+func getDefaultLimits() *pb.ChaincodeLimits {
+	limits := &pb.ChaincodeLimits{
+		Timeout:         int32(viper.GetInt("chaincode.limits.timeout")),
+		Memory:          int64(viper.GetInt("chaincode.limits.memory")),
+		CpuShares:       int64(viper.GetInt("chaincode.limits.cpushares")),
+		MaxResponseSize: int32(viper.GetInt("chaincode.limits.maxresponsesize")),
+	}
+	if limits.Timeout <= 0 {
+		limits.Timeout = timeoutDefault
+	}
+	return limits
+}
+
+// effectiveLimits returns the limits, with those which are not set taken from
+// the defaults of the peer
+func (chaincodeSupport *ChaincodeSupport) effectiveLimits(limits *pb.ChaincodeLimits) *pb.ChaincodeLimits {
+	effective := *chaincodeSupport.defaultLimits
+	if limits == nil {
+		return &effective
+	}
+	if limits.Timeout > 0 {
+		effective.Timeout = limits.Timeout
+	}
+	if limits.Memory > 0 {
+		effective.Memory = limits.Memory
+	}
+	if limits.CpuShares > 0 {
+		effective.CpuShares = limits.CpuShares
+	}
+	if limits.MaxResponseSize > 0 {
+		effective.MaxResponseSize = limits.MaxResponseSize
+	}
+	return &effective
+}
+
+// getChaincodeLimits returns the effective limits of the chaincode, as seen by
+// the transaction txUUID. Queries only see the limits committed
+func (chaincodeSupport *ChaincodeSupport) getChaincodeLimits(txUUID string, chaincodeID string, committed bool) (*pb.ChaincodeLimits, error) {
+	lgr, err := ledger.GetLedger()
+	if err != nil {
+		return nil, fmt.Errorf("Failed to get handle to ledger (%s)", err)
+	}
+	limits, err := lgr.GetChaincodeLimits(txUUID, chaincodeID, committed)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to get the limits of chaincode %s(%s)", chaincodeID, err)
+	}
+	return chaincodeSupport.effectiveLimits(limits), nil
+}
+
+// withLimits returns a copy of the deployment spec whose chaincode spec
+// carries the limits, for the container layer to apply them
+func withLimits(cds *pb.ChaincodeDeploymentSpec, limits *pb.ChaincodeLimits) *pb.ChaincodeDeploymentSpec {
+	spec := *cds.ChaincodeSpec
+	spec.Limits = limits
+	withLimits := *cds
+	withLimits.ChaincodeSpec = &spec
+	return &withLimits
+}
+
+// deployLimits returns the limits set by the deployment spec, nil if there are
+// none. The timeout of the spec is the timeout of the limits, if they set none
+func deployLimits(spec *pb.ChaincodeSpec) *pb.ChaincodeLimits {
+	limits := spec.GetLimits()
+	if spec != nil && spec.Timeout > 0 && (limits == nil || limits.Timeout <= 0) {
+		withTimeout := pb.ChaincodeLimits{}
+		if limits != nil {
+			withTimeout = *limits
+		}
+		withTimeout.Timeout = spec.Timeout
+		limits = &withTimeout
+	}
+	return limits
+}
+
+// setDeployChaincodeLimits sets the limits of the chaincode deployed by the transaction t to the limits of its
+// deployment spec, if any
+func setDeployChaincodeLimits(lgr *ledger.Ledger, t *pb.Transaction, chaincodeID string) error {
+	cds := &pb.ChaincodeDeploymentSpec{}
+	if err := proto.Unmarshal(t.Payload, cds); err != nil {
+		return fmt.Errorf("Invalid deployment spec(%s)", err)
+	}
+	limits := deployLimits(cds.GetChaincodeSpec())
+	if limits == nil {
+		return nil
+	}
+	if err := lgr.SetChaincodeLimits(t.Uuid, chaincodeID, limits); err != nil {
+		return fmt.Errorf("Failed to set the limits of chaincode %s(%s)", chaincodeID, err)
+	}
+	return nil
+}
+
+// updateChaincodeLimits replaces the limits of the chaincode with limits, on behalf of the transaction t, if the
+// update policy of the invocation policy of the chaincode allows the caller. The containers already running keep
+// their memory and CPU until they are restarted
+func updateChaincodeLimits(lgr *ledger.Ledger, t *pb.Transaction, chaincodeID string, limits *pb.ChaincodeLimits) error {
+	current, err := lgr.GetInvocationPolicy(t.Uuid, chaincodeID, false)
+	if err != nil {
+		return fmt.Errorf("Failed to get the invocation policy of chaincode %s(%s)", chaincodeID, err)
+	}
+	if current.GetUpdatePolicy() == nil || !policyAllows(current.UpdatePolicy, t.Cert) {
+		return fmt.Errorf("The limits of chaincode %s cannot be updated by the caller", chaincodeID)
+	}
+	if *limits == (pb.ChaincodeLimits{}) {
+		limits = nil
+	}
+	return lgr.SetChaincodeLimits(t.Uuid, chaincodeID, limits)
+}
+
+// executionTimeout returns the time a transaction or query of the chaincode
+// may take
+func executionTimeout(limits *pb.ChaincodeLimits) time.Duration {
+	return time.Duration(limits.Timeout) * time.Millisecond
+}
+
+// checkResponseSize returns an error if the payload of the response of the
+// chaincode exceeds the response size of its limits
+func checkResponseSize(limits *pb.ChaincodeLimits, chaincodeID string, resp *pb.ChaincodeMessage) error {
+	if limits.MaxResponseSize > 0 && len(resp.Payload) > int(limits.MaxResponseSize) {
+		return fmt.Errorf("The response of chaincode %s exceeds %d bytes", chaincodeID, limits.MaxResponseSize)
+	}
+	return nil
+}
@@ -48,6 +48,8 @@ const (
 	chaincodeStartupTimeoutDefault int    = 5000
 	chaincodeInstallPathDefault    string = "/opt/gopath/bin/"
 	peerAddressDefault             string = "0.0.0.0:30303"
+	// keepalive periods without a message after which a chaincode stream is considered broken
+	keepaliveTolerance = 3
 )
 
 // chains is a map between different blockchains and their ChaincodeSupport.
@@ -147,6 +149,23 @@ func NewChaincodeSupport(chainname ChainName, getPeerEndpoint func() (*pb.PeerEn
 		s.keepalive = time.Duration(t) * time.Second
 	}
 
+	if rt := viper.GetInt("chaincode.resumetimeout"); rt > 0 {
+		s.resumeTimeout = time.Duration(rt) * time.Second
+	}
+
+	s.parallelism = viper.GetInt("chaincode.parallelism")
+
+	s.maxCallDepth = viper.GetInt("chaincode.maxcalldepth")
+	if s.maxCallDepth <= 0 {
+		s.maxCallDepth = maxCallDepthDefault
+	}
+	s.calls = newCallStacks()
+	s.execLocks = newExecutionLocks()
+
+	s.defaultLimits = getDefaultLimits()
+
+	s.shimStateCache = viper.GetBool("chaincode.shim.statecache")
+
 	return s
 }
 
@@ -172,6 +191,13 @@ type ChaincodeSupport struct {
 	peerTLSKeyFile       string
 	peerTLSSvrHostOrd    string
 	keepalive            time.Duration
+	resumeTimeout        time.Duration
+	parallelism          int
+	maxCallDepth         int
+	calls                *callStacks
+	execLocks            *executionLocks
+	defaultLimits        *pb.ChaincodeLimits
+	shimStateCache       bool
 }
 
 // DuplicateChaincodeHandlerError returned if attempt to register same chaincodeID while a stream already exists.
@@ -203,6 +229,11 @@ func (chaincodeSupport *ChaincodeSupport) registerHandler(chaincodehandler *Hand
 	//through via consensus. In this case we swap the handler and give it the notify channel
 	if chrte2 != nil {
 		chaincodehandler.readyNotify = chrte2.handler.readyNotify
+		//the placeholder of a disconnected chaincode carries what the chaincode was initialized with
+		if chrte2.handler.resuming != nil {
+			chaincodehandler.resuming = chrte2.handler.resuming
+			chaincodehandler.deployTXSecContext = chrte2.handler.deployTXSecContext
+		}
 		chrte2.handler = chaincodehandler
 	} else {
 		chaincodeSupport.runningChaincodes.chaincodeMap[key] = &chaincodeRTEnv{handler: chaincodehandler}
@@ -233,10 +264,15 @@ func (chaincodeSupport *ChaincodeSupport) deregisterHandler(chaincodehandler *Ha
 	chaincodeLogger.Debugf("Deregister handler: %s", key)
 	chaincodeSupport.runningChaincodes.Lock()
 	defer chaincodeSupport.runningChaincodes.Unlock()
-	if _, ok := chaincodeSupport.chaincodeHasBeenLaunched(key); !ok {
+	chrte, ok := chaincodeSupport.chaincodeHasBeenLaunched(key)
+	if !ok {
 		// Handler NOT found
 		return fmt.Errorf("Error deregistering handler, could not find handler with key: %s", key)
 	}
+	if chrte.handler == chaincodehandler && chaincodeSupport.preResumeSetup(chaincodehandler) {
+		chaincodeLogger.Infof("Chaincode %s disconnected, waiting up to %s for it to resume", key, chaincodeSupport.resumeTimeout)
+		return nil
+	}
 	delete(chaincodeSupport.runningChaincodes.chaincodeMap, key)
 	chaincodeLogger.Debugf("Deregistered handler with key: %s", key)
 	return nil
@@ -290,6 +326,19 @@ func (chaincodeSupport *ChaincodeSupport) getArgsAndEnv(cID *pb.ChaincodeID, cLa
 	} else {
 		envs = append(envs, "CORE_PEER_TLS_ENABLED=false")
 	}
+	//the peer address is also given in the env, for the run commands of chaincodes run as processes
+	envs = append(envs, "CORE_PEER_ADDRESS="+chaincodeSupport.peerAddress)
+	if chaincodeSupport.shimStateCache {
+		envs = append(envs, "CORE_CHAINCODE_SHIM_STATECACHE=true")
+	}
+	//the chaincode needs the keepalive period to detect a broken stream, and
+	//the resume timeout to know how long to try reconnecting
+	if chaincodeSupport.keepalive > 0 {
+		envs = append(envs, fmt.Sprintf("CORE_CHAINCODE_KEEPALIVE=%d", chaincodeSupport.keepalive/time.Second))
+	}
+	if chaincodeSupport.resumeTimeout > 0 {
+		envs = append(envs, fmt.Sprintf("CORE_CHAINCODE_RESUMETIMEOUT=%d", chaincodeSupport.resumeTimeout/time.Second))
+	}
 	switch cLang {
 	case pb.ChaincodeSpec_GOLANG, pb.ChaincodeSpec_CAR:
 		//chaincode executable will be same as the name of the chaincode
@@ -302,6 +351,10 @@ func (chaincodeSupport *ChaincodeSupport) getArgsAndEnv(cID *pb.ChaincodeID, cLa
 				" -x processResources -x classes", chaincodeSupport.peerAddress, cID.Name),
 			" ")
 		chaincodeLogger.Debugf("Executable is gradle run on chaincode ID %s", cID.Name)
+	case pb.ChaincodeSpec_NODE:
+		//node runs the main module of the package of the chaincode
+		args = []string{"node", "/root/chaincode", fmt.Sprintf("--peer.address=%s", chaincodeSupport.peerAddress)}
+		chaincodeLogger.Debugf("Executable is node on chaincode ID %s", cID.Name)
 	default:
 		return nil, nil, fmt.Errorf("Unknown chaincodeType: %s", cLang)
 	}
@@ -393,13 +446,16 @@ func (chaincodeSupport *ChaincodeSupport) Stop(context context.Context, cds *pb.
 	}
 
 	chaincodeSupport.runningChaincodes.Lock()
-	if _, ok := chaincodeSupport.chaincodeHasBeenLaunched(chaincode); !ok {
+	chrte, ok := chaincodeSupport.chaincodeHasBeenLaunched(chaincode)
+	if !ok {
 		//nothing to do
 		chaincodeSupport.runningChaincodes.Unlock()
 		return nil
 	}
 
 	delete(chaincodeSupport.runningChaincodes.chaincodeMap, chaincode)
+	//a stopped chaincode does not resume
+	chrte.handler.resumeDone()
 
 	chaincodeSupport.runningChaincodes.Unlock()
 
@@ -439,6 +495,7 @@ func (chaincodeSupport *ChaincodeSupport) Launch(context context.Context, t *pb.
 		return nil, nil, fmt.Errorf("invalid transaction type: %d", t.Type)
 	}
 	chaincode := cID.Name
+	chaincodeSupport.waitForResume(chaincode)
 	chaincodeSupport.runningChaincodes.Lock()
 	var chrte *chaincodeRTEnv
 	var ok bool
@@ -507,6 +564,15 @@ func (chaincodeSupport *ChaincodeSupport) Launch(context context.Context, t *pb.
 			return cID, cMsg, fmt.Errorf("failed to unmarshal deployment transactions for %s - %s", chaincode, err)
 		}
 		cLang = cds.ChaincodeSpec.Type
+
+		//the memory and CPU of the container are those committed
+		limits, err := ledger.GetChaincodeLimits(t.Uuid, chaincode, true)
+		if err != nil {
+			return cID, cMsg, fmt.Errorf("Failed to get the limits of chaincode %s - %s", chaincode, err)
+		}
+		cds = withLimits(cds, chaincodeSupport.effectiveLimits(limits))
+	} else {
+		cds = withLimits(cds, chaincodeSupport.effectiveLimits(deployLimits(cds.ChaincodeSpec)))
 	}
 
 	//from here on : if we launch the container and get an error, we need to stop the container
@@ -548,8 +614,11 @@ func (chaincodeSupport *ChaincodeSupport) getSecHelper() crypto.Peer {
 //getVMType - just returns a string for now. Another possibility is to use a factory method to
 //return a VM executor
 func (chaincodeSupport *ChaincodeSupport) getVMType(cds *pb.ChaincodeDeploymentSpec) (string, error) {
-	if cds.ExecEnv == pb.ChaincodeDeploymentSpec_SYSTEM {
+	switch cds.ExecEnv {
+	case pb.ChaincodeDeploymentSpec_SYSTEM:
 		return container.SYSTEM, nil
+	case pb.ChaincodeDeploymentSpec_PROCESS:
+		return container.PROCESS, nil
 	}
 	return container.DOCKER, nil
 }
@@ -569,11 +638,19 @@ func (chaincodeSupport *ChaincodeSupport) Deploy(context context.Context, t *pb.
 		return cds, err
 	}
 
+	if err = checkExecEnv(cds); err != nil {
+		return cds, err
+	}
+
 	if chaincodeSupport.userRunsCC {
 		chaincodeLogger.Debug("user runs chaincode, not deploying chaincode")
 		return nil, nil
 	}
 
+	if err = checkBuild(cds); err != nil {
+		return cds, err
+	}
+
 	chaincodeSupport.runningChaincodes.Lock()
 	//if its in the map, there must be a connected stream...and we are trying to build the code ?!
 	if _, ok := chaincodeSupport.chaincodeHasBeenLaunched(chaincode); ok {
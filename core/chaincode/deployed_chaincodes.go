@@ -0,0 +1,74 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package chaincode
+
+import (
+	"fmt"
+
+	"github.com/golang/protobuf/proto"
+
+	"github.com/hyperledger/fabric/core/ledger"
+	pb "github.com/hyperledger/fabric/protos"
+)
+
+// setDeployedChaincode records the deployment of the chaincode by the transaction t in the ledger, so that the
+// chaincodes deployed can be listed without scanning the chain
+func setDeployedChaincode(lgr *ledger.Ledger, t *pb.Transaction, chaincodeID string) error {
+	cds := &pb.ChaincodeDeploymentSpec{}
+	if err := proto.Unmarshal(t.Payload, cds); err != nil || cds.ChaincodeSpec == nil {
+		return fmt.Errorf("Invalid deployment spec(%s)", err)
+	}
+	deployed := &pb.DeployedChaincode{Type: cds.ChaincodeSpec.Type, Txid: t.Uuid, Timestamp: t.Timestamp, BuildDigest: cds.BuildDigest, ExecEnv: cds.ExecEnv}
+	deployed.ChaincodeID = &pb.ChaincodeID{Name: chaincodeID}
+	if cds.ChaincodeSpec.ChaincodeID != nil {
+		deployed.ChaincodeID.Path = cds.ChaincodeSpec.ChaincodeID.Path
+	}
+	if err := lgr.SetDeployedChaincode(t.Uuid, deployed); err != nil {
+		return fmt.Errorf("Failed to record the deployment of chaincode %s(%s)", chaincodeID, err)
+	}
+	return nil
+}
+
+// containerStatus returns the status of the container of the chaincode on this peer
+func (chaincodeSupport *ChaincodeSupport) containerStatus(chaincode string) pb.DeployedChaincode_ContainerStatus {
+	chaincodeSupport.runningChaincodes.RLock()
+	defer chaincodeSupport.runningChaincodes.RUnlock()
+	chrte, ok := chaincodeSupport.chaincodeHasBeenLaunched(chaincode)
+	if !ok {
+		return pb.DeployedChaincode_NOT_RUNNING
+	}
+	if !chrte.handler.registered {
+		return pb.DeployedChaincode_STARTING
+	}
+	return pb.DeployedChaincode_RUNNING
+}
+
+// GetDeployedChaincodes returns the chaincodes deployed to the chain, as recorded by their committed deploy
+// transactions, with the status of their containers on this peer
+func (chaincodeSupport *ChaincodeSupport) GetDeployedChaincodes() (*pb.DeployedChaincodes, error) {
+	lgr, err := ledger.GetLedger()
+	if err != nil {
+		return nil, fmt.Errorf("Failed to get handle to ledger (%s)", err)
+	}
+	deployed, err := lgr.GetDeployedChaincodes()
+	if err != nil {
+		return nil, fmt.Errorf("Failed to get the deployed chaincodes (%s)", err)
+	}
+	for _, chaincode := range deployed {
+		chaincode.Status = chaincodeSupport.containerStatus(chaincode.ChaincodeID.Name)
+	}
+	return &pb.DeployedChaincodes{Chaincodes: deployed}, nil
+}
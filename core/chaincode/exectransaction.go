@@ -17,20 +17,29 @@ limitations under the License.
 package chaincode
 
 import (
-	"errors"
 	"fmt"
-	"time"
+	"sync"
 
 	"github.com/golang/protobuf/proto"
 	"golang.org/x/net/context"
 
 	"github.com/hyperledger/fabric/core/ledger"
+	"github.com/hyperledger/fabric/core/ledger/statemgmt/state"
 	"github.com/hyperledger/fabric/events/producer"
 	pb "github.com/hyperledger/fabric/protos"
 )
 
-//Execute - execute transaction or a query
+//Execute - execute transaction or a query, returning the first event the
+//transaction emitted. ExecuteTransactions records all of them
 func Execute(ctxt context.Context, chain *ChaincodeSupport, t *pb.Transaction) ([]byte, *pb.ChaincodeEvent, error) {
+	result, ccevents, err := execute(ctxt, chain, t, false)
+	return result, firstEvent(ccevents), err
+}
+
+// execute runs a transaction or a query, returning the events it emitted. An
+// isolated transaction must have been begun by the caller, its state changes
+// are kept aside until the caller applies or discards them
+func execute(ctxt context.Context, chain *ChaincodeSupport, t *pb.Transaction, isolated bool) ([]byte, []*pb.ChaincodeEvent, error) {
 	var err error
 
 	// get a handle to ledger to mark the begin/finish of a tx
@@ -55,14 +64,65 @@ func Execute(ctxt context.Context, chain *ChaincodeSupport, t *pb.Transaction) (
 		}
 
 		//launch and wait for ready
-		markTxBegin(ledger, t)
-		_, _, err = chain.Launch(ctxt, t)
+		markTxBegin(ledger, t, isolated)
+		cID, _, err := chain.Launch(ctxt, t)
 		if err != nil {
-			markTxFinish(ledger, t, false)
+			markTxFinish(ledger, t, isolated, false)
 			return nil, nil, fmt.Errorf("%s", err)
 		}
-		markTxFinish(ledger, t, true)
+		if err = setDeployInvocationPolicy(ledger, t, cID.Name); err != nil {
+			markTxFinish(ledger, t, isolated, false)
+			return nil, nil, err
+		}
+		if err = setDeployChaincodeLimits(ledger, t, cID.Name); err != nil {
+			markTxFinish(ledger, t, isolated, false)
+			return nil, nil, err
+		}
+		if err = setDeployedChaincode(ledger, t, cID.Name); err != nil {
+			markTxFinish(ledger, t, isolated, false)
+			return nil, nil, err
+		}
+		markTxFinish(ledger, t, isolated, true)
 	} else if t.Type == pb.Transaction_CHAINCODE_INVOKE || t.Type == pb.Transaction_CHAINCODE_QUERY {
+		ci := &pb.ChaincodeInvocationSpec{}
+		if err = proto.Unmarshal(t.Payload, ci); err != nil || ci.ChaincodeSpec == nil || ci.ChaincodeSpec.ChaincodeID == nil {
+			return nil, nil, fmt.Errorf("Invalid invocation spec(%s)", err)
+		}
+		chaincodeID := ci.ChaincodeSpec.ChaincodeID.Name
+
+		// an invocation carrying a policy is a governed update of the policy,
+		// the chaincode itself is not invoked
+		if policy := ci.ChaincodeSpec.InvocationPolicy; policy != nil {
+			if t.Type != pb.Transaction_CHAINCODE_INVOKE {
+				return nil, nil, fmt.Errorf("The invocation policy of chaincode %s can only be updated by a transaction", chaincodeID)
+			}
+			markTxBegin(ledger, t, isolated)
+			if err = updateInvocationPolicy(ledger, t, chaincodeID, policy); err != nil {
+				markTxFinish(ledger, t, isolated, false)
+				return nil, nil, err
+			}
+			markTxFinish(ledger, t, isolated, true)
+			return nil, nil, nil
+		}
+
+		// likewise for an invocation carrying limits
+		if limits := ci.ChaincodeSpec.Limits; limits != nil {
+			if t.Type != pb.Transaction_CHAINCODE_INVOKE {
+				return nil, nil, fmt.Errorf("The limits of chaincode %s can only be updated by a transaction", chaincodeID)
+			}
+			markTxBegin(ledger, t, isolated)
+			if err = updateChaincodeLimits(ledger, t, chaincodeID, limits); err != nil {
+				markTxFinish(ledger, t, isolated, false)
+				return nil, nil, err
+			}
+			markTxFinish(ledger, t, isolated, true)
+			return nil, nil, nil
+		}
+
+		if err = checkInvocationPolicy(ledger, t.Uuid, chaincodeID, t.Cert, t.Type == pb.Transaction_CHAINCODE_QUERY); err != nil {
+			return nil, nil, err
+		}
+
 		//will launch if necessary (and wait for ready)
 		cID, cMsg, err := chain.Launch(ctxt, t)
 		if err != nil {
@@ -76,13 +136,11 @@ func Execute(ctxt context.Context, chain *ChaincodeSupport, t *pb.Transaction) (
 			return nil, nil, fmt.Errorf("Failed to stablish stream to container %s", chaincode)
 		}
 
-		// TODO: Need to comment next line and uncomment call to getTimeout, when transaction blocks are being created
-		timeout := time.Duration(30000) * time.Millisecond
-		//timeout, err := getTimeout(cID)
-
+		limits, err := chain.getChaincodeLimits(t.Uuid, chaincode, t.Type == pb.Transaction_CHAINCODE_QUERY)
 		if err != nil {
-			return nil, nil, fmt.Errorf("Failed to retrieve chaincode spec(%s)", err)
+			return nil, nil, err
 		}
+		timeout := executionTimeout(limits)
 
 		var ccMsg *pb.ChaincodeMessage
 		if t.Type == pb.Transaction_CHAINCODE_INVOKE {
@@ -97,32 +155,42 @@ func Execute(ctxt context.Context, chain *ChaincodeSupport, t *pb.Transaction) (
 			}
 		}
 
-		markTxBegin(ledger, t)
+		markTxBegin(ledger, t, isolated)
+		// a chaincode executes one transaction at a time, whichever lane of a
+		// parallel execution it comes from; queries execute alongside
+		if t.Type == pb.Transaction_CHAINCODE_INVOKE {
+			chain.execLocks.lock(chaincode)
+		}
 		resp, err := chain.Execute(ctxt, chaincode, ccMsg, timeout, t)
+		if t.Type == pb.Transaction_CHAINCODE_INVOKE {
+			chain.execLocks.unlock(chaincode)
+		}
 		if err != nil {
 			// Rollback transaction
-			markTxFinish(ledger, t, false)
+			markTxFinish(ledger, t, isolated, false)
 			return nil, nil, fmt.Errorf("Failed to execute transaction or query(%s)", err)
 		} else if resp == nil {
 			// Rollback transaction
-			markTxFinish(ledger, t, false)
+			markTxFinish(ledger, t, isolated, false)
 			return nil, nil, fmt.Errorf("Failed to receive a response for (%s)", t.Uuid)
 		} else {
-			if resp.ChaincodeEvent != nil {
-				resp.ChaincodeEvent.ChaincodeID = chaincode
-				resp.ChaincodeEvent.TxID = t.Uuid
-			}
+			ccevents := responseEvents(resp, chaincode, t.Uuid)
 
 			if resp.Type == pb.ChaincodeMessage_COMPLETED || resp.Type == pb.ChaincodeMessage_QUERY_COMPLETED {
+				if err = checkResponseSize(limits, chaincode, resp); err != nil {
+					// Rollback transaction
+					markTxFinish(ledger, t, isolated, false)
+					return nil, ccevents, err
+				}
 				// Success
-				markTxFinish(ledger, t, true)
-				return resp.Payload, resp.ChaincodeEvent, nil
+				markTxFinish(ledger, t, isolated, true)
+				return resp.Payload, ccevents, nil
 			} else if resp.Type == pb.ChaincodeMessage_ERROR || resp.Type == pb.ChaincodeMessage_QUERY_ERROR {
 				// Rollback transaction
-				markTxFinish(ledger, t, false)
-				return nil, resp.ChaincodeEvent, fmt.Errorf("Transaction or query returned with failure: %s", string(resp.Payload))
+				markTxFinish(ledger, t, isolated, false)
+				return nil, ccevents, fmt.Errorf("Transaction or query returned with failure: %s", string(resp.Payload))
 			}
-			markTxFinish(ledger, t, false)
+			markTxFinish(ledger, t, isolated, false)
 			return resp.Payload, nil, fmt.Errorf("receive a response for (%s) but in invalid state(%d)", t.Uuid, resp.Type)
 		}
 
@@ -133,24 +201,41 @@ func Execute(ctxt context.Context, chain *ChaincodeSupport, t *pb.Transaction) (
 }
 
 //ExecuteTransactions - will execute transactions on the array one by one
-//will return an array of errors one for each transaction. If the execution
-//succeeded, array element will be nil. returns []byte of state hash or
-//error
-func ExecuteTransactions(ctxt context.Context, cname ChainName, xacts []*pb.Transaction) (succeededTXs []*pb.Transaction, stateHash []byte, ccevents []*pb.ChaincodeEvent, txerrs []error, err error) {
+//will return a result for each transaction, carrying its error if the
+//execution failed, so one failure does not hide which transactions
+//succeeded. returns []byte of state hash or error
+func ExecuteTransactions(ctxt context.Context, cname ChainName, xacts []*pb.Transaction) (succeededTXs []*pb.Transaction, stateHash []byte, txresults []*pb.TransactionResult, err error) {
 	var chain = GetChain(cname)
 	if chain == nil {
 		// TODO: We should never get here, but otherwise a good reminder to better handle
 		panic(fmt.Sprintf("[ExecuteTransactions]Chain %s not found\n", cname))
 	}
 
-	txerrs = make([]error, len(xacts))
-	ccevents = make([]*pb.ChaincodeEvent, len(xacts))
+	results := make([][]byte, len(xacts))
+	txerrs := make([]error, len(xacts))
+	ccevents := make([][]*pb.ChaincodeEvent, len(xacts))
+	for start := 0; start < len(xacts); {
+		end := start + 1
+		if chain.parallelism > 1 {
+			end = parallelGroupEnd(xacts, start)
+		}
+		if end-start > 1 {
+			executeParallel(ctxt, chain, xacts[start:end], results[start:end], ccevents[start:end], txerrs[start:end])
+		} else {
+			results[start], ccevents[start], txerrs[start] = execute(ctxt, chain, xacts[start], false)
+		}
+		start = end
+	}
+
 	var succeededTxs = make([]*pb.Transaction, 0)
+	txresults = make([]*pb.TransactionResult, len(xacts))
 	for i, t := range xacts {
-		_, ccevents[i], txerrs[i] = Execute(ctxt, chain, t)
 		if txerrs[i] == nil {
 			succeededTxs = append(succeededTxs, t)
+			txresults[i] = &pb.TransactionResult{Uuid: t.Uuid, Result: results[i], ChaincodeEvent: firstEvent(ccevents[i]), ChaincodeEvents: ccevents[i]}
 		} else {
+			//NOTE- it'll be nice if we can have error values. For now success == 0, error == 1
+			txresults[i] = &pb.TransactionResult{Uuid: t.Uuid, Error: txerrs[i].Error(), ErrorCode: 1, ChaincodeEvent: firstEvent(ccevents[i]), ChaincodeEvents: ccevents[i]}
 			sendTxRejectedEvent(xacts[i], txerrs[i].Error())
 		}
 	}
@@ -161,7 +246,138 @@ func ExecuteTransactions(ctxt context.Context, cname ChainName, xacts []*pb.Tran
 		stateHash, err = lgr.GetTempStateHash()
 	}
 
-	return succeededTxs, stateHash, ccevents, txerrs, err
+	return succeededTxs, stateHash, txresults, err
+}
+
+// responseEvents returns the events of the response of a chaincode, with the
+// chaincode and transaction which emitted them. A shim which only sets the
+// first event of a transaction emits that one
+func responseEvents(resp *pb.ChaincodeMessage, chaincode string, uuid string) []*pb.ChaincodeEvent {
+	ccevents := resp.ChaincodeEvents
+	if len(ccevents) == 0 && resp.ChaincodeEvent != nil {
+		ccevents = []*pb.ChaincodeEvent{resp.ChaincodeEvent}
+	}
+	for _, ccevent := range ccevents {
+		ccevent.ChaincodeID = chaincode
+		ccevent.TxID = uuid
+	}
+	return ccevents
+}
+
+// firstEvent returns the first of the events of a transaction, nil if it
+// emitted none
+func firstEvent(ccevents []*pb.ChaincodeEvent) *pb.ChaincodeEvent {
+	if len(ccevents) == 0 {
+		return nil
+	}
+	return ccevents[0]
+}
+
+// parallelGroupEnd returns the end of the group of consecutive transactions
+// starting at start which may execute in parallel: invocations of chaincodes
+// known without decrypting them.  Other transactions execute on their own.
+func parallelGroupEnd(xacts []*pb.Transaction, start int) int {
+	uuids := make(map[string]bool)
+	end := start
+	for ; end < len(xacts); end++ {
+		t := xacts[end]
+		if uuids[t.Uuid] || invokedChaincode(t) == "" {
+			break
+		}
+		uuids[t.Uuid] = true
+	}
+	if end == start {
+		return start + 1
+	}
+	return end
+}
+
+// invokedChaincode returns the name of the chaincode a transaction invokes,
+// or an empty string if it is not a plain invocation
+func invokedChaincode(t *pb.Transaction) string {
+	if t.Type != pb.Transaction_CHAINCODE_INVOKE || t.ConfidentialityLevel == pb.ConfidentialityLevel_CONFIDENTIAL {
+		return ""
+	}
+	ci := &pb.ChaincodeInvocationSpec{}
+	if err := proto.Unmarshal(t.Payload, ci); err != nil || ci.ChaincodeSpec == nil || ci.ChaincodeSpec.ChaincodeID == nil {
+		return ""
+	}
+	return ci.ChaincodeSpec.ChaincodeID.Name
+}
+
+// executeParallel executes a group of transactions as if they executed one by
+// one, in order.  A chaincode handles one transaction at a time, so the
+// transactions of each chaincode execute in turn, while those of up to
+// chain.parallelism chaincodes execute in parallel.  Each transaction is
+// isolated, it sees the state as it was before the group.  The transactions
+// are then applied in order; one which failed, or which read a key written by
+// a transaction applied before it, is executed again on its own against the
+// state up to that point.  So is a transaction which called a chaincode busy
+// with a transaction of another lane, even if it went on to succeed, see
+// executionLocks.
+func executeParallel(ctxt context.Context, chain *ChaincodeSupport, xacts []*pb.Transaction, results [][]byte, ccevents [][]*pb.ChaincodeEvent, txerrs []error) {
+	lgr, err := ledger.GetLedger()
+	if err != nil {
+		for i, t := range xacts {
+			results[i], ccevents[i], txerrs[i] = execute(ctxt, chain, t, false)
+		}
+		return
+	}
+
+	var lanes [][]int
+	laneOf := make(map[string]int)
+	for i, t := range xacts {
+		name := invokedChaincode(t)
+		lane, ok := laneOf[name]
+		if !ok {
+			lane = len(lanes)
+			laneOf[name] = lane
+			lanes = append(lanes, nil)
+		}
+		lanes[lane] = append(lanes[lane], i)
+	}
+
+	sem := make(chan struct{}, chain.parallelism)
+	var wg sync.WaitGroup
+	for _, lane := range lanes {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(lane []int) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			for _, i := range lane {
+				lgr.TxBeginIsolated(xacts[i].Uuid)
+				results[i], ccevents[i], txerrs[i] = execute(ctxt, chain, xacts[i], true)
+			}
+		}(lane)
+	}
+	wg.Wait()
+
+	applied := state.NewTxReadWriteSet()
+	for i, t := range xacts {
+		rwset := lgr.GetTxReadWriteSet(t.Uuid)
+		refused := chain.execLocks.refused(t.Uuid)
+		if txerrs[i] == nil && !refused && !rwset.ConflictsWith(applied) {
+			lgr.TxApplyIsolated(t.Uuid)
+			applied.AddWrites(rwset)
+			continue
+		}
+
+		chaincodeLogger.Debugf("[%s]Executing transaction again after parallel execution", shortuuid(t.Uuid))
+		lgr.TxDiscardIsolated(t.Uuid)
+		lgr.TxBeginIsolated(t.Uuid)
+		results[i], ccevents[i], txerrs[i] = execute(ctxt, chain, t, true)
+		chain.execLocks.refused(t.Uuid)
+		rwset = lgr.GetTxReadWriteSet(t.Uuid)
+		if txerrs[i] == nil {
+			lgr.TxApplyIsolated(t.Uuid)
+			applied.AddWrites(rwset)
+		} else {
+			lgr.TxDiscardIsolated(t.Uuid)
+		}
+	}
 }
 
 // GetSecureContext returns the security context from the context object or error
@@ -178,39 +394,21 @@ func ExecuteTransactions(ctxt context.Context, cname ChainName, xacts []*pb.Tran
 // 	return nil, err
 // }
 
-var errFailedToGetChainCodeSpecForTransaction = errors.New("Failed to get ChainCodeSpec from Transaction")
-
-func getTimeout(cID *pb.ChaincodeID) (time.Duration, error) {
-	ledger, err := ledger.GetLedger()
-	if err == nil {
-		chaincodeID := cID.Name
-		txUUID, err := ledger.GetState(chaincodeID, "github.com_openblockchain_obc-peer_chaincode_id", true)
-		if err == nil {
-			tx, err := ledger.GetTransactionByUUID(string(txUUID))
-			if err == nil {
-				chaincodeDeploymentSpec := &pb.ChaincodeDeploymentSpec{}
-				proto.Unmarshal(tx.Payload, chaincodeDeploymentSpec)
-				chaincodeSpec := chaincodeDeploymentSpec.GetChaincodeSpec()
-				timeout := time.Duration(time.Duration(chaincodeSpec.Timeout) * time.Millisecond)
-				return timeout, nil
-			}
-		}
-	}
-
-	return -1, errFailedToGetChainCodeSpecForTransaction
-}
-
-func markTxBegin(ledger *ledger.Ledger, t *pb.Transaction) {
-	if t.Type == pb.Transaction_CHAINCODE_QUERY {
+func markTxBegin(ledger *ledger.Ledger, t *pb.Transaction, isolated bool) {
+	if t.Type == pb.Transaction_CHAINCODE_QUERY || isolated {
 		return
 	}
 	ledger.TxBegin(t.Uuid)
 }
 
-func markTxFinish(ledger *ledger.Ledger, t *pb.Transaction, successful bool) {
+func markTxFinish(ledger *ledger.Ledger, t *pb.Transaction, isolated bool, successful bool) {
 	if t.Type == pb.Transaction_CHAINCODE_QUERY {
 		return
 	}
+	if isolated {
+		ledger.TxFinishedIsolated(t.Uuid, successful)
+		return
+	}
 	ledger.TxFinished(t.Uuid, successful)
 }
 
@@ -17,6 +17,7 @@ limitations under the License.
 package chaincode
 
 import (
+	"encoding/pem"
 	"fmt"
 	"io/ioutil"
 	"net"
@@ -29,13 +30,16 @@ import (
 
 	"path/filepath"
 
+	"github.com/hyperledger/fabric/core/chaincode/shim"
 	"github.com/hyperledger/fabric/core/container"
 	"github.com/hyperledger/fabric/core/container/ccintf"
+	"github.com/hyperledger/fabric/core/container/inproccontroller"
 	"github.com/hyperledger/fabric/core/crypto"
 	"github.com/hyperledger/fabric/core/ledger"
 	"github.com/hyperledger/fabric/core/util"
 	"github.com/hyperledger/fabric/membersrvc/ca"
 	pb "github.com/hyperledger/fabric/protos"
+	"github.com/looplab/fsm"
 	"github.com/spf13/viper"
 	"golang.org/x/net/context"
 	"google.golang.org/grpc"
@@ -1433,7 +1437,380 @@ func TestGetEvent(t *testing.T) {
 	closeListenerAndSleep(lis)
 }
 
+func TestParallelGroups(t *testing.T) {
+	invoke := func(uuid string, name string) *pb.Transaction {
+		spec := &pb.ChaincodeInvocationSpec{ChaincodeSpec: &pb.ChaincodeSpec{ChaincodeID: &pb.ChaincodeID{Name: name}}}
+		tx, err := pb.NewChaincodeExecute(spec, uuid, pb.Transaction_CHAINCODE_INVOKE)
+		if err != nil {
+			t.Fatalf("Error creating transaction: %s", err)
+		}
+		return tx
+	}
+	deploy := &pb.Transaction{Type: pb.Transaction_CHAINCODE_DEPLOY, Uuid: "deploy"}
+	xacts := []*pb.Transaction{invoke("1", "a"), invoke("2", "b"), invoke("3", "a"), deploy, invoke("4", "a"), invoke("4", "b")}
+
+	var groups []int
+	for start := 0; start < len(xacts); {
+		end := parallelGroupEnd(xacts, start)
+		groups = append(groups, end-start)
+		start = end
+	}
+	if fmt.Sprint(groups) != "[3 1 1 1]" {
+		t.Errorf("Expected the deploy and the repeated transaction to break the groups, got groups of %v transactions", groups)
+	}
+	if invokedChaincode(xacts[1]) != "b" || invokedChaincode(deploy) != "" {
+		t.Errorf("Expected only invocations to name the chaincode they invoke")
+	}
+}
+
+func TestInvocationPolicyAllows(t *testing.T) {
+	certPEM, err := ioutil.ReadFile("./shim/crypto/attr/test_resources/tcert_clear.dump")
+	if err != nil {
+		t.Fatalf("Error reading the certificate: %s", err)
+	}
+	block, _ := pem.Decode(certPEM)
+	cert := block.Bytes
+
+	allowed := []*pb.InvocationPolicy{
+		nil,
+		{},
+		{EnrollmentIDs: []string{"alice", "diego"}},
+		{Attributes: []*pb.AttributePredicate{{Name: "position", Value: []byte("Software Engineer")}}},
+	}
+	for i, policy := range allowed {
+		if !policyAllows(policy, cert) {
+			t.Errorf("Expected policy %d to allow the caller", i)
+		}
+	}
+	denied := []*pb.InvocationPolicy{
+		{EnrollmentIDs: []string{"alice"}},
+		{Roles: []string{"admin"}},
+		{Attributes: []*pb.AttributePredicate{{Name: "position", Value: []byte("Software Engineer")}, {Name: "age", Value: []byte("18")}}},
+	}
+	for i, policy := range denied {
+		if policyAllows(policy, cert) {
+			t.Errorf("Expected policy %d to deny the caller", i)
+		}
+	}
+	if policyAllows(allowed[2], nil) {
+		t.Errorf("Expected a policy to deny a caller without certificate")
+	}
+}
+
+func TestCallStacks(t *testing.T) {
+	calls := newCallStacks()
+	if err := calls.enter("1", "a", "b", 2); err != nil {
+		t.Fatalf("Expected a to call b, got: %s", err)
+	}
+	if err := calls.enter("1", "b", "c", 2); err != nil {
+		t.Fatalf("Expected b to call c, got: %s", err)
+	}
+	if err := calls.enter("1", "c", "a", 2); err == nil {
+		t.Errorf("Expected c calling a to be refused as a loop")
+	}
+	if err := calls.enter("1", "c", "d", 2); err == nil {
+		t.Errorf("Expected c calling d to be refused beyond the maximum depth")
+	}
+	if err := calls.enter("2", "c", "a", 2); err != nil {
+		t.Errorf("Expected the calls of another transaction to be independent, got: %s", err)
+	}
+
+	calls.exit("1")
+	if err := calls.enter("1", "b", "d", 2); err != nil {
+		t.Errorf("Expected b to call d once c returned, got: %s", err)
+	}
+	calls.exit("1")
+	calls.exit("1")
+	calls.exit("2")
+	if len(calls.stacks) != 0 {
+		t.Errorf("Expected no call stack once all the calls returned, got %v", calls.stacks)
+	}
+}
+
+func TestExecutionLocks(t *testing.T) {
+	locks := newExecutionLocks()
+	locks.lock("a")
+	if locks.tryLock("a") {
+		t.Fatalf("Expected a chaincode executing a transaction not to be locked again")
+	}
+	if !locks.tryLock("b") {
+		t.Fatalf("Expected another chaincode to be locked")
+	}
+	locks.unlock("b")
+
+	locked := make(chan struct{})
+	go func() {
+		locks.lock("a")
+		close(locked)
+	}()
+	select {
+	case <-locked:
+		t.Fatalf("Expected the lock to wait for the transaction executing")
+	case <-time.After(10 * time.Millisecond):
+	}
+	locks.unlock("a")
+	select {
+	case <-locked:
+	case <-time.After(time.Second):
+		t.Fatalf("Expected the lock to be taken once the transaction executed")
+	}
+	locks.unlock("a")
+	if !locks.tryLock("a") {
+		t.Errorf("Expected the chaincode to be locked once unlocked")
+	}
+}
+
+// ignoringCaller calls busy_callee and ignores the error of the call
+type ignoringCaller struct {
+	executions int
+}
+
+func (cc *ignoringCaller) Init(stub *shim.ChaincodeStub, function string, args []string) ([]byte, error) {
+	return nil, nil
+}
+
+func (cc *ignoringCaller) Invoke(stub *shim.ChaincodeStub, function string, args []string) ([]byte, error) {
+	cc.executions++
+	stub.InvokeChaincode("busy_callee", "invoke", nil)
+	return nil, stub.PutState("executions", []byte(strconv.Itoa(cc.executions)))
+}
+
+func (cc *ignoringCaller) Query(stub *shim.ChaincodeStub, function string, args []string) ([]byte, error) {
+	return nil, nil
+}
+
+func TestBusyCalleeExecutesAgain(t *testing.T) {
+	viper.Set("peer.fileSystemPath", "/var/hyperledger/test/tmpdb")
+	lis, err := initPeer()
+	if err != nil {
+		t.Fatalf("Error creating peer: %s", err)
+	}
+	defer finitPeer(lis)
+
+	caller := &ignoringCaller{}
+	if err = inproccontroller.Register("busy_caller", caller); err != nil {
+		t.Fatalf("Error registering the caller: %s", err)
+	}
+	RegisterSystemChaincode("busy_caller")
+	ctxt := context.Background()
+	spec := &pb.ChaincodeSpec{Type: pb.ChaincodeSpec_GOLANG, ChaincodeID: &pb.ChaincodeID{Name: "busy_caller", Path: "busy_caller"}, CtorMsg: &pb.ChaincodeInput{}}
+	cds := &pb.ChaincodeDeploymentSpec{ExecEnv: pb.ChaincodeDeploymentSpec_SYSTEM, ChaincodeSpec: spec}
+	if _, err = deploy2(ctxt, cds); err != nil {
+		t.Fatalf("Error deploying the caller: %s", err)
+	}
+	chain := GetChain(DefaultChain)
+	defer chain.Stop(ctxt, cds)
+	parallelism := chain.parallelism
+	chain.parallelism = 2
+	defer func() { chain.parallelism = parallelism }()
+
+	// the callee is running, and executing a transaction of another lane
+	callee := &Handler{ChaincodeID: &pb.ChaincodeID{Name: "busy_callee"}, chaincodeSupport: chain}
+	if err = chain.registerHandler(callee); err != nil {
+		t.Fatalf("Error registering the callee: %s", err)
+	}
+	callee.FSM = fsm.NewFSM(readystate, fsm.Events{}, fsm.Callbacks{})
+	chain.execLocks.lock("busy_callee")
+	defer chain.execLocks.unlock("busy_callee")
+
+	tx, err := createTransaction(true, &pb.ChaincodeInvocationSpec{ChaincodeSpec: &pb.ChaincodeSpec{Type: pb.ChaincodeSpec_GOLANG, ChaincodeID: &pb.ChaincodeID{Name: "busy_caller"}, CtorMsg: &pb.ChaincodeInput{Function: "invoke"}}}, util.GenerateUUID())
+	if err != nil {
+		t.Fatalf("Error creating transaction: %s", err)
+	}
+	lgr, _ := ledger.GetLedger()
+	lgr.BeginTxBatch("busy")
+	defer lgr.RollbackTxBatch("busy")
+	txerrs := make([]error, 1)
+	executeParallel(ctxt, chain, []*pb.Transaction{tx}, make([][]byte, 1), make([][]*pb.ChaincodeEvent, 1), txerrs)
+	if txerrs[0] != nil {
+		t.Fatalf("Expected the caller to ignore the error of the call, got: %s", txerrs[0])
+	}
+	if caller.executions != 2 {
+		t.Fatalf("Expected the transaction whose call found the callee busy to execute again, it executed %d times", caller.executions)
+	}
+	executions, err := lgr.GetState("busy_caller", "executions", false)
+	if err != nil || string(executions) != "2" {
+		t.Errorf("Expected the state of the second execution, got %q (%v)", executions, err)
+	}
+	if chain.execLocks.refused(tx.Uuid) {
+		t.Errorf("Expected the refusal to be forgotten once the transaction executed again")
+	}
+}
+
+func TestResumeChaincode(t *testing.T) {
+	chaincodeSupport := &ChaincodeSupport{runningChaincodes: &runningChaincodes{chaincodeMap: make(map[string]*chaincodeRTEnv)}, resumeTimeout: 50 * time.Millisecond}
+	running := func() *Handler {
+		handler := &Handler{ChaincodeID: &pb.ChaincodeID{Name: "resumecc"}, chaincodeSupport: chaincodeSupport}
+		if err := chaincodeSupport.registerHandler(handler); err != nil {
+			t.Fatalf("Error registering handler: %s", err)
+		}
+		handler.FSM = fsm.NewFSM(readystate, fsm.Events{}, fsm.Callbacks{})
+		return handler
+	}
+
+	chaincodeSupport.deregisterHandler(running())
+	chrte, ok := chaincodeSupport.chaincodeHasBeenLaunched("resumecc")
+	if !ok || chrte.handler.registered || chrte.handler.resuming == nil {
+		t.Fatalf("Expected a placeholder for the disconnected chaincode")
+	}
+
+	resumed := running()
+	if resumed.resuming != chrte.handler.resuming {
+		t.Fatalf("Expected the chaincode registering again to resume")
+	}
+	waited := make(chan struct{})
+	go func() {
+		chaincodeSupport.waitForResume("resumecc")
+		close(waited)
+	}()
+	select {
+	case <-waited:
+		t.Fatalf("Expected transactions to wait for the chaincode to resume")
+	case <-time.After(10 * time.Millisecond):
+	}
+	resumed.resumeDone()
+	select {
+	case <-waited:
+	case <-time.After(time.Second):
+		t.Fatalf("Expected transactions to proceed once the chaincode resumed")
+	}
+
+	chaincodeSupport.deregisterHandler(resumed)
+	time.Sleep(100 * time.Millisecond)
+	if _, ok = chaincodeSupport.chaincodeHasBeenLaunched("resumecc"); ok {
+		t.Errorf("Expected the placeholder to be removed when the chaincode does not resume in time")
+	}
+}
+
+func TestCheckExecEnv(t *testing.T) {
+	RegisterSystemChaincode("test_syscc")
+	deployment := func(name string, execEnv pb.ChaincodeDeploymentSpec_ExecutionEnvironment) *pb.ChaincodeDeploymentSpec {
+		return &pb.ChaincodeDeploymentSpec{ExecEnv: execEnv, ChaincodeSpec: &pb.ChaincodeSpec{ChaincodeID: &pb.ChaincodeID{Name: name}}}
+	}
+	if err := checkExecEnv(deployment("test_syscc", pb.ChaincodeDeploymentSpec_SYSTEM)); err != nil {
+		t.Errorf("Expected the system chaincode to run in the peer, got: %s", err)
+	}
+	if err := checkExecEnv(deployment("user_cc", pb.ChaincodeDeploymentSpec_DOCKER)); err != nil {
+		t.Errorf("Expected the user chaincode to run in a container, got: %s", err)
+	}
+	if err := checkExecEnv(deployment("user_cc", pb.ChaincodeDeploymentSpec_SYSTEM)); err == nil {
+		t.Errorf("Expected a user chaincode to be refused to run in the peer")
+	}
+	if err := checkExecEnv(deployment("test_syscc", pb.ChaincodeDeploymentSpec_DOCKER)); err == nil {
+		t.Errorf("Expected a user chaincode to be refused the name of a system chaincode")
+	}
+
+	ReserveSystemChaincodeName("disabled_syscc")
+	if err := checkExecEnv(deployment("disabled_syscc", pb.ChaincodeDeploymentSpec_DOCKER)); err == nil {
+		t.Errorf("Expected a user chaincode to be refused the name of a disabled system chaincode")
+	}
+	if err := checkExecEnv(deployment("disabled_syscc", pb.ChaincodeDeploymentSpec_SYSTEM)); err == nil {
+		t.Errorf("Expected a disabled system chaincode to be refused to run in the peer")
+	}
+
+	defer viper.Set("chaincode.process.enabled", viper.GetBool("chaincode.process.enabled"))
+	viper.Set("chaincode.process.enabled", false)
+	if err := checkExecEnv(deployment("user_cc", pb.ChaincodeDeploymentSpec_PROCESS)); err == nil {
+		t.Errorf("Expected a user chaincode to be refused to run as a process unless the peer enables it")
+	}
+	viper.Set("chaincode.process.enabled", true)
+	if err := checkExecEnv(deployment("user_cc", pb.ChaincodeDeploymentSpec_PROCESS)); err != nil {
+		t.Errorf("Expected the user chaincode to run as a process, got: %s", err)
+	}
+}
+
+func TestCheckBuild(t *testing.T) {
+	spec := func() *pb.ChaincodeSpec {
+		return &pb.ChaincodeSpec{Type: pb.ChaincodeSpec_GOLANG, ChaincodeID: &pb.ChaincodeID{Path: "github.com/hyperledger/fabric/examples/chaincode/go/chaincode_example02"}, CtorMsg: &pb.ChaincodeInput{Function: "init", Args: []string{"a", "100"}}}
+	}
+	code, err := container.GetChaincodePackageBytes(spec())
+	if err != nil {
+		t.Fatalf("Error packaging the chaincode: %s", err)
+	}
+	deployment := func(digest string) *pb.ChaincodeDeploymentSpec {
+		return &pb.ChaincodeDeploymentSpec{ChaincodeSpec: &pb.ChaincodeSpec{ChaincodeID: &pb.ChaincodeID{Name: "example02"}}, CodePackage: code, BuildDigest: digest}
+	}
+
+	defer viper.Set("chaincode.reproducible", viper.GetBool("chaincode.reproducible"))
+	viper.Set("chaincode.reproducible", false)
+	if err = checkBuild(deployment("")); err != nil {
+		t.Errorf("Expected a deployment without build digest to be built, got: %s", err)
+	}
+	if err = checkBuild(deployment(container.GetBuildDigest(code))); err != nil {
+		t.Errorf("Expected a deployment with the digest of its package to be built, got: %s", err)
+	}
+	if err = checkBuild(deployment(container.GetBuildDigest([]byte("other")))); err == nil {
+		t.Errorf("Expected a deployment with the digest of another package to be refused")
+	}
+
+	viper.Set("chaincode.reproducible", true)
+	if err = checkBuild(deployment("")); err == nil {
+		t.Errorf("Expected a deployment without build digest to be refused with reproducible builds")
+	}
+	if err = checkBuild(deployment(container.GetBuildDigest(code))); err == nil {
+		t.Errorf("Expected a package whose base image is not pinned to be refused with reproducible builds")
+	}
+
+	// the same chaincode is packaged with the same digest
+	again, _ := container.GetChaincodePackageBytes(spec())
+	if container.GetBuildDigest(again) != container.GetBuildDigest(code) {
+		t.Errorf("Expected the chaincode to be packaged with the same digest")
+	}
+}
+
 func TestMain(m *testing.M) {
 	SetupTestConfig()
 	os.Exit(m.Run())
 }
+
+func TestChaincodeLimits(t *testing.T) {
+	chaincodeSupport := &ChaincodeSupport{defaultLimits: &pb.ChaincodeLimits{Timeout: timeoutDefault, Memory: 1024}}
+	limits := chaincodeSupport.effectiveLimits(nil)
+	if limits.Timeout != timeoutDefault || limits.Memory != 1024 || limits.MaxResponseSize != 0 {
+		t.Errorf("Expected the default limits without limits of the chaincode, got %v", limits)
+	}
+	limits = chaincodeSupport.effectiveLimits(&pb.ChaincodeLimits{Timeout: 100, MaxResponseSize: 4})
+	if limits.Timeout != 100 || limits.Memory != 1024 || limits.MaxResponseSize != 4 {
+		t.Errorf("Expected the limits of the chaincode over the defaults, got %v", limits)
+	}
+	if chaincodeSupport.defaultLimits.Timeout != timeoutDefault {
+		t.Errorf("Expected the default limits to be left as they are, got %v", chaincodeSupport.defaultLimits)
+	}
+	if executionTimeout(limits) != 100*time.Millisecond {
+		t.Errorf("Expected a timeout of 100ms, got %s", executionTimeout(limits))
+	}
+
+	if err := checkResponseSize(limits, "example", &pb.ChaincodeMessage{Payload: []byte("1234")}); err != nil {
+		t.Errorf("Expected a response of 4 bytes to be accepted, got: %s", err)
+	}
+	if err := checkResponseSize(limits, "example", &pb.ChaincodeMessage{Payload: []byte("12345")}); err == nil {
+		t.Errorf("Expected a response of 5 bytes to be refused")
+	}
+
+	if deployLimits(&pb.ChaincodeSpec{}) != nil {
+		t.Errorf("Expected no limits for a deployment setting none")
+	}
+	spec := &pb.ChaincodeSpec{Timeout: 200, Limits: &pb.ChaincodeLimits{Memory: 2048}}
+	if limits = deployLimits(spec); limits.Timeout != 200 || limits.Memory != 2048 || spec.Limits.Timeout != 0 {
+		t.Errorf("Expected the timeout of the spec to be the timeout of the limits, got %v", limits)
+	}
+	cds := &pb.ChaincodeDeploymentSpec{ChaincodeSpec: spec}
+	if withLimits(cds, limits).ChaincodeSpec.Limits != limits || cds.ChaincodeSpec.Limits.Timeout != 0 {
+		t.Errorf("Expected a copy of the deployment spec carrying the limits")
+	}
+}
+
+func TestDeployedChaincodeStatus(t *testing.T) {
+	chaincodeSupport := &ChaincodeSupport{runningChaincodes: &runningChaincodes{chaincodeMap: make(map[string]*chaincodeRTEnv)}}
+	if status := chaincodeSupport.containerStatus("example"); status != pb.DeployedChaincode_NOT_RUNNING {
+		t.Errorf("Expected a chaincode never launched not to be running, got %s", status)
+	}
+	chaincodeSupport.preLaunchSetup("example")
+	if status := chaincodeSupport.containerStatus("example"); status != pb.DeployedChaincode_STARTING {
+		t.Errorf("Expected a chaincode launched but not registered to be starting, got %s", status)
+	}
+	chaincodeSupport.runningChaincodes.chaincodeMap["example"].handler.registered = true
+	if status := chaincodeSupport.containerStatus("example"); status != pb.DeployedChaincode_RUNNING {
+		t.Errorf("Expected a registered chaincode to be running, got %s", status)
+	}
+}
@@ -0,0 +1,88 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package chaincode
+
+import "sync"
+
+// executionLocks keeps which chaincodes are executing a transaction. A
+// chaincode executes one transaction at a time, so the transactions of a batch
+// executing in parallel each lock the chaincode they invoke, waiting for it if
+// needed, while the calls they make to other chaincodes only try the lock of
+// the chaincode called: waiting there could deadlock with a transaction of the
+// other chaincode calling back. The call then fails, and its transaction
+// executes again on its own, after the parallel execution. The calling
+// chaincode may well ignore the failure, so the transaction is recorded as
+// refused rather than left to its result
+type executionLocks struct {
+	sync.Mutex
+	locks    map[string]chan struct{}
+	refusals map[string]bool
+}
+
+func newExecutionLocks() *executionLocks {
+	return &executionLocks{locks: make(map[string]chan struct{}), refusals: make(map[string]bool)}
+}
+
+func (el *executionLocks) get(chaincode string) chan struct{} {
+	el.Lock()
+	defer el.Unlock()
+	l, ok := el.locks[chaincode]
+	if !ok {
+		l = make(chan struct{}, 1)
+		el.locks[chaincode] = l
+	}
+	return l
+}
+
+// lock waits for the chaincode to be done with the transaction it executes, if
+// any, and locks it
+func (el *executionLocks) lock(chaincode string) {
+	el.get(chaincode) <- struct{}{}
+}
+
+// tryLock locks the chaincode if it is not executing a transaction, and
+// returns whether it did
+func (el *executionLocks) tryLock(chaincode string) bool {
+	select {
+	case el.get(chaincode) <- struct{}{}:
+		return true
+	default:
+		return false
+	}
+}
+
+func (el *executionLocks) unlock(chaincode string) {
+	<-el.get(chaincode)
+}
+
+// refuse records that a call of the transaction found the chaincode it called
+// busy
+func (el *executionLocks) refuse(uuid string) {
+	el.Lock()
+	defer el.Unlock()
+	el.refusals[uuid] = true
+}
+
+// refused returns whether a call of the transaction found the chaincode it
+// called busy, and forgets it
+func (el *executionLocks) refused(uuid string) bool {
+	el.Lock()
+	defer el.Unlock()
+	refused := el.refusals[uuid]
+	delete(el.refusals, uuid)
+	return refused
+}
@@ -26,6 +26,7 @@ import (
 	ccintf "github.com/hyperledger/fabric/core/container/ccintf"
 	"github.com/hyperledger/fabric/core/crypto"
 	"github.com/hyperledger/fabric/core/ledger/statemgmt"
+	"github.com/hyperledger/fabric/core/ledger/statemgmt/state"
 	"github.com/hyperledger/fabric/core/util"
 	pb "github.com/hyperledger/fabric/protos"
 	"github.com/looplab/fsm"
@@ -41,8 +42,8 @@ const (
 	initstate        = "init"        //in:ESTABLISHED, rcv:-, send: INIT
 	readystate       = "ready"       //in:ESTABLISHED,TRANSACTION, rcv:COMPLETED
 	transactionstate = "transaction" //in:READY, rcv: xact from consensus, send: TRANSACTION
-	busyinitstate    = "busyinit"    //in:INIT, rcv: PUT_STATE, DEL_STATE, INVOKE_CHAINCODE
-	busyxactstate    = "busyxact"    //in:TRANSACION, rcv: PUT_STATE, DEL_STATE, INVOKE_CHAINCODE
+	busyinitstate    = "busyinit"    //in:INIT, rcv: PUT_STATE, DEL_STATE, PUT_PRIVATE_DATA, DEL_PRIVATE_DATA, INVOKE_CHAINCODE
+	busyxactstate    = "busyxact"    //in:TRANSACION, rcv: PUT_STATE, DEL_STATE, PUT_PRIVATE_DATA, DEL_PRIVATE_DATA, INVOKE_CHAINCODE
 	endstate         = "end"         //in:INIT,ESTABLISHED, rcv: error, terminate container
 
 )
@@ -61,6 +62,9 @@ type transactionContext struct {
 
 	// tracks open iterators used for range queries
 	rangeQueryIteratorMap map[string]statemgmt.RangeScanIterator
+
+	// the state read by a query
+	queryLevel state.QueryLevel
 }
 
 type nextStateInfo struct {
@@ -83,6 +87,9 @@ type Handler struct {
 	chaincodeSupport *ChaincodeSupport
 	registered       bool
 	readyNotify      chan bool
+	// closed once a disconnected chaincode resumed or failed to, see resume.go
+	resuming chan struct{}
+	resumed  bool
 	// Map of tx uuid to either invoke or query tx (decrypted). Each tx will be
 	// added prior to execute and remove when done execute
 	txCtxs map[string]*transactionContext
@@ -124,10 +131,23 @@ func (handler *Handler) createTxContext(uuid string, tx *pb.Transaction) (*trans
 	}
 	txctx := &transactionContext{transactionSecContext: tx, responseNotifier: make(chan *pb.ChaincodeMessage, 1),
 		rangeQueryIteratorMap: make(map[string]statemgmt.RangeScanIterator)}
+	if tx != nil && tx.Type == pb.Transaction_CHAINCODE_QUERY {
+		txctx.queryLevel = getQueryLevel(tx)
+	}
 	handler.txCtxs[uuid] = txctx
 	return txctx, nil
 }
 
+// getQueryLevel returns the state read by a query transaction, its committed
+// state unless the invocation asks for the tentative one
+func getQueryLevel(tx *pb.Transaction) state.QueryLevel {
+	ci := &pb.ChaincodeInvocationSpec{}
+	if err := proto.Unmarshal(tx.Payload, ci); err == nil && ci.QueryLevel == pb.QueryLevel_TENTATIVE {
+		return state.QueryTentative
+	}
+	return state.QueryCommitted
+}
+
 func (handler *Handler) getTxContext(uuid string) *transactionContext {
 	handler.Lock()
 	defer handler.Unlock()
@@ -187,6 +207,38 @@ func (handler *Handler) canCallChaincode(uuid string) *pb.ChaincodeMessage {
 	return nil
 }
 
+// canInvokeChaincode checks the invocation policy of the chaincode called by the chaincode running the transaction
+// uuid, with the caller of the transaction. Returns an ERROR message if the policy does not allow the caller
+func (handler *Handler) canInvokeChaincode(uuid string, chaincodeID string) *pb.ChaincodeMessage {
+	var cert []byte
+	if txctx := handler.getTxContext(uuid); txctx != nil && txctx.transactionSecContext != nil {
+		cert = txctx.transactionSecContext.Cert
+	}
+	lgr, err := ledger.GetLedger()
+	if err == nil {
+		err = checkInvocationPolicy(lgr, uuid, chaincodeID, cert, !handler.getIsTransaction(uuid))
+	}
+	if err != nil {
+		chaincodeLogger.Errorf("[%s]Failed to check invocation policy. Sending %s", shortuuid(uuid), pb.ChaincodeMessage_ERROR)
+		return &pb.ChaincodeMessage{Type: pb.ChaincodeMessage_ERROR, Payload: []byte(err.Error()), Uuid: uuid}
+	}
+	return nil
+}
+
+// enterChaincodeCall records the call of chaincodeID by the chaincode of the handler in the transaction uuid. Returns
+// an ERROR message if the call loops back to a chaincode being called or nests too many calls
+func (handler *Handler) enterChaincodeCall(uuid string, chaincodeID string) *pb.ChaincodeMessage {
+	caller := ""
+	if handler.ChaincodeID != nil {
+		caller = handler.ChaincodeID.Name
+	}
+	if err := handler.chaincodeSupport.calls.enter(uuid, caller, chaincodeID, handler.chaincodeSupport.maxCallDepth); err != nil {
+		chaincodeLogger.Errorf("[%s]%s. Sending %s", shortuuid(uuid), err, pb.ChaincodeMessage_ERROR)
+		return &pb.ChaincodeMessage{Type: pb.ChaincodeMessage_ERROR, Payload: []byte(err.Error()), Uuid: uuid}
+	}
+	return nil
+}
+
 func (handler *Handler) encryptOrDecrypt(encrypt bool, uuid string, payload []byte) ([]byte, error) {
 	secHelper := handler.chaincodeSupport.getSecHelper()
 	if secHelper == nil {
@@ -257,6 +309,7 @@ func (handler *Handler) deregister() error {
 	if handler.registered {
 		handler.chaincodeSupport.deregisterHandler(handler)
 	}
+	handler.resumeDone()
 	return nil
 }
 
@@ -280,6 +333,7 @@ func (handler *Handler) processStream() error {
 	var nsInfo *nextStateInfo
 	var in *pb.ChaincodeMessage
 	var err error
+	lastRecv := time.Now()
 
 	//recv is used to spin Recv routine after previous received msg
 	//has been processed
@@ -317,6 +371,7 @@ func (handler *Handler) processStream() error {
 
 			// we can spin off another Recv again
 			recv = true
+			lastRecv = time.Now()
 
 			if in.Type == pb.ChaincodeMessage_KEEPALIVE {
 				chaincodeLogger.Debug("Received KEEPALIVE Response")
@@ -338,6 +393,14 @@ func (handler *Handler) processStream() error {
 				continue
 			}
 
+			//the chaincode answers every KEEPALIVE, so if it has been silent for a few
+			//keepalive periods the stream is broken even though Recv has not failed
+			if silence := time.Since(lastRecv); silence > keepaliveTolerance*handler.chaincodeSupport.keepalive {
+				err = fmt.Errorf("No message from chaincode for %s, ending chaincode support stream", silence)
+				chaincodeLogger.Errorf("%s", err)
+				return err
+			}
+
 			//TODO we could use this to hook into container lifecycle (kill the chaincode if not in use, etc)
 			kaerr := handler.serialSend(&pb.ChaincodeMessage{Type: pb.ChaincodeMessage_KEEPALIVE})
 			if kaerr != nil {
@@ -391,9 +454,19 @@ func newChaincodeSupportHandler(chaincodeSupport *ChaincodeSupport, peerChatStre
 			{Name: pb.ChaincodeMessage_TRANSACTION.String(), Src: []string{readystate}, Dst: transactionstate},
 			{Name: pb.ChaincodeMessage_PUT_STATE.String(), Src: []string{transactionstate}, Dst: busyxactstate},
 			{Name: pb.ChaincodeMessage_DEL_STATE.String(), Src: []string{transactionstate}, Dst: busyxactstate},
+			{Name: pb.ChaincodeMessage_PUT_PRIVATE_DATA.String(), Src: []string{transactionstate}, Dst: busyxactstate},
+			{Name: pb.ChaincodeMessage_DEL_PRIVATE_DATA.String(), Src: []string{transactionstate}, Dst: busyxactstate},
+			{Name: pb.ChaincodeMessage_PUT_NAMESPACE_STATE.String(), Src: []string{transactionstate}, Dst: busyxactstate},
+			{Name: pb.ChaincodeMessage_DEL_NAMESPACE_STATE.String(), Src: []string{transactionstate}, Dst: busyxactstate},
+			{Name: pb.ChaincodeMessage_GRANT_NAMESPACE_ACCESS.String(), Src: []string{transactionstate}, Dst: busyxactstate},
 			{Name: pb.ChaincodeMessage_INVOKE_CHAINCODE.String(), Src: []string{transactionstate}, Dst: busyxactstate},
 			{Name: pb.ChaincodeMessage_PUT_STATE.String(), Src: []string{initstate}, Dst: busyinitstate},
 			{Name: pb.ChaincodeMessage_DEL_STATE.String(), Src: []string{initstate}, Dst: busyinitstate},
+			{Name: pb.ChaincodeMessage_PUT_PRIVATE_DATA.String(), Src: []string{initstate}, Dst: busyinitstate},
+			{Name: pb.ChaincodeMessage_DEL_PRIVATE_DATA.String(), Src: []string{initstate}, Dst: busyinitstate},
+			{Name: pb.ChaincodeMessage_PUT_NAMESPACE_STATE.String(), Src: []string{initstate}, Dst: busyinitstate},
+			{Name: pb.ChaincodeMessage_DEL_NAMESPACE_STATE.String(), Src: []string{initstate}, Dst: busyinitstate},
+			{Name: pb.ChaincodeMessage_GRANT_NAMESPACE_ACCESS.String(), Src: []string{initstate}, Dst: busyinitstate},
 			{Name: pb.ChaincodeMessage_INVOKE_CHAINCODE.String(), Src: []string{initstate}, Dst: busyinitstate},
 			{Name: pb.ChaincodeMessage_COMPLETED.String(), Src: []string{initstate, readystate, transactionstate}, Dst: readystate},
 			{Name: pb.ChaincodeMessage_GET_STATE.String(), Src: []string{readystate}, Dst: readystate},
@@ -401,6 +474,26 @@ func newChaincodeSupportHandler(chaincodeSupport *ChaincodeSupport, peerChatStre
 			{Name: pb.ChaincodeMessage_GET_STATE.String(), Src: []string{busyinitstate}, Dst: busyinitstate},
 			{Name: pb.ChaincodeMessage_GET_STATE.String(), Src: []string{transactionstate}, Dst: transactionstate},
 			{Name: pb.ChaincodeMessage_GET_STATE.String(), Src: []string{busyxactstate}, Dst: busyxactstate},
+			{Name: pb.ChaincodeMessage_GET_PRIVATE_DATA.String(), Src: []string{readystate}, Dst: readystate},
+			{Name: pb.ChaincodeMessage_GET_PRIVATE_DATA.String(), Src: []string{initstate}, Dst: initstate},
+			{Name: pb.ChaincodeMessage_GET_PRIVATE_DATA.String(), Src: []string{busyinitstate}, Dst: busyinitstate},
+			{Name: pb.ChaincodeMessage_GET_PRIVATE_DATA.String(), Src: []string{transactionstate}, Dst: transactionstate},
+			{Name: pb.ChaincodeMessage_GET_PRIVATE_DATA.String(), Src: []string{busyxactstate}, Dst: busyxactstate},
+			{Name: pb.ChaincodeMessage_GET_NAMESPACE_STATE.String(), Src: []string{readystate}, Dst: readystate},
+			{Name: pb.ChaincodeMessage_GET_NAMESPACE_STATE.String(), Src: []string{initstate}, Dst: initstate},
+			{Name: pb.ChaincodeMessage_GET_NAMESPACE_STATE.String(), Src: []string{busyinitstate}, Dst: busyinitstate},
+			{Name: pb.ChaincodeMessage_GET_NAMESPACE_STATE.String(), Src: []string{transactionstate}, Dst: transactionstate},
+			{Name: pb.ChaincodeMessage_GET_NAMESPACE_STATE.String(), Src: []string{busyxactstate}, Dst: busyxactstate},
+			{Name: pb.ChaincodeMessage_GET_STATE_AT_BLOCK.String(), Src: []string{readystate}, Dst: readystate},
+			{Name: pb.ChaincodeMessage_GET_STATE_AT_BLOCK.String(), Src: []string{initstate}, Dst: initstate},
+			{Name: pb.ChaincodeMessage_GET_STATE_AT_BLOCK.String(), Src: []string{busyinitstate}, Dst: busyinitstate},
+			{Name: pb.ChaincodeMessage_GET_STATE_AT_BLOCK.String(), Src: []string{transactionstate}, Dst: transactionstate},
+			{Name: pb.ChaincodeMessage_GET_STATE_AT_BLOCK.String(), Src: []string{busyxactstate}, Dst: busyxactstate},
+			{Name: pb.ChaincodeMessage_QUERY_INDEX.String(), Src: []string{readystate}, Dst: readystate},
+			{Name: pb.ChaincodeMessage_QUERY_INDEX.String(), Src: []string{initstate}, Dst: initstate},
+			{Name: pb.ChaincodeMessage_QUERY_INDEX.String(), Src: []string{busyinitstate}, Dst: busyinitstate},
+			{Name: pb.ChaincodeMessage_QUERY_INDEX.String(), Src: []string{transactionstate}, Dst: transactionstate},
+			{Name: pb.ChaincodeMessage_QUERY_INDEX.String(), Src: []string{busyxactstate}, Dst: busyxactstate},
 			{Name: pb.ChaincodeMessage_RANGE_QUERY_STATE.String(), Src: []string{readystate}, Dst: readystate},
 			{Name: pb.ChaincodeMessage_RANGE_QUERY_STATE.String(), Src: []string{initstate}, Dst: initstate},
 			{Name: pb.ChaincodeMessage_RANGE_QUERY_STATE.String(), Src: []string{busyinitstate}, Dst: busyinitstate},
@@ -428,11 +521,20 @@ func newChaincodeSupportHandler(chaincodeSupport *ChaincodeSupport, peerChatStre
 			"before_" + pb.ChaincodeMessage_COMPLETED.String():              func(e *fsm.Event) { v.beforeCompletedEvent(e, v.FSM.Current()) },
 			"before_" + pb.ChaincodeMessage_INIT.String():                   func(e *fsm.Event) { v.beforeInitState(e, v.FSM.Current()) },
 			"after_" + pb.ChaincodeMessage_GET_STATE.String():               func(e *fsm.Event) { v.afterGetState(e, v.FSM.Current()) },
+			"after_" + pb.ChaincodeMessage_GET_PRIVATE_DATA.String():        func(e *fsm.Event) { v.afterGetPrivateData(e, v.FSM.Current()) },
+			"after_" + pb.ChaincodeMessage_GET_NAMESPACE_STATE.String():     func(e *fsm.Event) { v.afterGetNamespaceState(e, v.FSM.Current()) },
+			"after_" + pb.ChaincodeMessage_GET_STATE_AT_BLOCK.String():      func(e *fsm.Event) { v.afterGetStateAtBlock(e, v.FSM.Current()) },
+			"after_" + pb.ChaincodeMessage_QUERY_INDEX.String():             func(e *fsm.Event) { v.afterQueryIndex(e, v.FSM.Current()) },
 			"after_" + pb.ChaincodeMessage_RANGE_QUERY_STATE.String():       func(e *fsm.Event) { v.afterRangeQueryState(e, v.FSM.Current()) },
 			"after_" + pb.ChaincodeMessage_RANGE_QUERY_STATE_NEXT.String():  func(e *fsm.Event) { v.afterRangeQueryStateNext(e, v.FSM.Current()) },
 			"after_" + pb.ChaincodeMessage_RANGE_QUERY_STATE_CLOSE.String(): func(e *fsm.Event) { v.afterRangeQueryStateClose(e, v.FSM.Current()) },
 			"after_" + pb.ChaincodeMessage_PUT_STATE.String():               func(e *fsm.Event) { v.afterPutState(e, v.FSM.Current()) },
 			"after_" + pb.ChaincodeMessage_DEL_STATE.String():               func(e *fsm.Event) { v.afterDelState(e, v.FSM.Current()) },
+			"after_" + pb.ChaincodeMessage_PUT_PRIVATE_DATA.String():        func(e *fsm.Event) { v.afterPutPrivateData(e, v.FSM.Current()) },
+			"after_" + pb.ChaincodeMessage_DEL_PRIVATE_DATA.String():        func(e *fsm.Event) { v.afterDelPrivateData(e, v.FSM.Current()) },
+			"after_" + pb.ChaincodeMessage_PUT_NAMESPACE_STATE.String():     func(e *fsm.Event) { v.afterWriteNamespaceState(e, v.FSM.Current()) },
+			"after_" + pb.ChaincodeMessage_DEL_NAMESPACE_STATE.String():     func(e *fsm.Event) { v.afterWriteNamespaceState(e, v.FSM.Current()) },
+			"after_" + pb.ChaincodeMessage_GRANT_NAMESPACE_ACCESS.String():  func(e *fsm.Event) { v.afterWriteNamespaceState(e, v.FSM.Current()) },
 			"after_" + pb.ChaincodeMessage_INVOKE_CHAINCODE.String():        func(e *fsm.Event) { v.afterInvokeChaincode(e, v.FSM.Current()) },
 			"enter_" + establishedstate:                                     func(e *fsm.Event) { v.enterEstablishedState(e, v.FSM.Current()) },
 			"enter_" + initstate:                                            func(e *fsm.Event) { v.enterInitState(e, v.FSM.Current()) },
@@ -489,6 +591,31 @@ func (handler *Handler) getIsTransaction(uuid string) bool {
 	return handler.isTransaction[uuid]
 }
 
+// getTxQueryLevel returns the state read by the query uuid
+func (handler *Handler) getTxQueryLevel(uuid string) state.QueryLevel {
+	if txctx := handler.getTxContext(uuid); txctx != nil {
+		return txctx.queryLevel
+	}
+	return state.QueryCommitted
+}
+
+// getTxState reads a key of the state of the chaincode as seen by the
+// transaction or the query uuid
+func (handler *Handler) getTxState(ledgerObj *ledger.Ledger, uuid string, chaincodeID string, key string) ([]byte, error) {
+	if !handler.getIsTransaction(uuid) {
+		return ledgerObj.GetStateAtLevel(chaincodeID, key, handler.getTxQueryLevel(uuid))
+	}
+	return ledgerObj.GetNamespaceState(uuid, chaincodeID, chaincodeID, key, false)
+}
+
+// getTxStateRangeScanIterator is getTxState for a range of keys
+func (handler *Handler) getTxStateRangeScanIterator(ledgerObj *ledger.Ledger, uuid string, chaincodeID string, startKey string, endKey string) (statemgmt.RangeScanIterator, error) {
+	if !handler.getIsTransaction(uuid) {
+		return ledgerObj.GetStateRangeScanIteratorAtLevel(chaincodeID, startKey, endKey, handler.getTxQueryLevel(uuid))
+	}
+	return ledgerObj.GetNamespaceStateRangeScanIterator(uuid, chaincodeID, chaincodeID, startKey, endKey, false)
+}
+
 func (handler *Handler) deleteIsTransaction(uuid string) {
 	handler.Lock()
 	defer handler.Unlock()
@@ -537,6 +664,11 @@ func (handler *Handler) beforeRegisterEvent(e *fsm.Event, state string) {
 		handler.notifyDuringStartup(false)
 		return
 	}
+
+	//a chaincode reconnecting after a disconnect was already initialized
+	if handler.resuming != nil {
+		go handler.resume()
+	}
 }
 
 func (handler *Handler) notify(msg *pb.ChaincodeMessage) {
@@ -623,8 +755,7 @@ func (handler *Handler) handleGetState(msg *pb.ChaincodeMessage) {
 		// Invoke ledger to get state
 		chaincodeID := handler.ChaincodeID.Name
 
-		readCommittedState := !handler.getIsTransaction(msg.Uuid)
-		res, err := ledgerObj.GetState(chaincodeID, key, readCommittedState)
+		res, err := handler.getTxState(ledgerObj, msg.Uuid, chaincodeID, key)
 		if err != nil {
 			// Send error msg back to chaincode. GetState will not trigger event
 			payload := []byte(err.Error())
@@ -652,6 +783,254 @@ func (handler *Handler) handleGetState(msg *pb.ChaincodeMessage) {
 	}()
 }
 
+// afterGetPrivateData handles a GET_PRIVATE_DATA request from the chaincode.
+func (handler *Handler) afterGetPrivateData(e *fsm.Event, state string) {
+	msg, ok := e.Args[0].(*pb.ChaincodeMessage)
+	if !ok {
+		e.Cancel(fmt.Errorf("Received unexpected message type"))
+		return
+	}
+	chaincodeLogger.Debugf("[%s]Received %s, invoking get private data from ledger", shortuuid(msg.Uuid), pb.ChaincodeMessage_GET_PRIVATE_DATA)
+
+	// Query ledger for private data
+	handler.handleGetPrivateData(msg)
+}
+
+// Handles query to ledger to get private data
+func (handler *Handler) handleGetPrivateData(msg *pb.ChaincodeMessage) {
+	// The defer followed by triggering a go routine dance is needed to ensure that the previous state transition
+	// is completed before the next one is triggered. The previous state transition is deemed complete only when
+	// the afterGetPrivateData function is exited.
+	go func() {
+		// Check if this is the unique state request from this chaincode uuid
+		uniqueReq := handler.createUUIDEntry(msg.Uuid)
+		if !uniqueReq {
+			// Drop this request
+			chaincodeLogger.Error("Another state request pending for this Uuid. Cannot process.")
+			return
+		}
+
+		var serialSendMsg *pb.ChaincodeMessage
+
+		defer func() {
+			handler.deleteUUIDEntry(msg.Uuid)
+			chaincodeLogger.Debugf("[%s]handleGetPrivateData serial send %s", shortuuid(serialSendMsg.Uuid), serialSendMsg.Type)
+			handler.serialSend(serialSendMsg)
+		}()
+
+		privateDataInfo := &pb.PrivateDataInfo{}
+		unmarshalErr := proto.Unmarshal(msg.Payload, privateDataInfo)
+		if unmarshalErr != nil {
+			payload := []byte(unmarshalErr.Error())
+			chaincodeLogger.Errorf("Failed to unmarshall private data request. Sending %s", pb.ChaincodeMessage_ERROR)
+			serialSendMsg = &pb.ChaincodeMessage{Type: pb.ChaincodeMessage_ERROR, Payload: payload, Uuid: msg.Uuid}
+			return
+		}
+
+		ledgerObj, ledgerErr := ledger.GetLedger()
+		if ledgerErr != nil {
+			// Send error msg back to chaincode. GetPrivateData will not trigger event
+			payload := []byte(ledgerErr.Error())
+			chaincodeLogger.Errorf("Failed to get chaincode private data(%s). Sending %s", ledgerErr, pb.ChaincodeMessage_ERROR)
+			serialSendMsg = &pb.ChaincodeMessage{Type: pb.ChaincodeMessage_ERROR, Payload: payload, Uuid: msg.Uuid}
+			return
+		}
+
+		chaincodeID := handler.ChaincodeID.Name
+		readCommittedState := !handler.getIsTransaction(msg.Uuid)
+		res, err := ledgerObj.GetPrivateData(msg.Uuid, chaincodeID, privateDataInfo.Collection, privateDataInfo.Key, readCommittedState)
+		if err != nil {
+			// Send error msg back to chaincode. GetPrivateData will not trigger event
+			payload := []byte(err.Error())
+			chaincodeLogger.Errorf("[%s]Failed to get chaincode private data(%s). Sending %s", shortuuid(msg.Uuid), err, pb.ChaincodeMessage_ERROR)
+			serialSendMsg = &pb.ChaincodeMessage{Type: pb.ChaincodeMessage_ERROR, Payload: payload, Uuid: msg.Uuid}
+		} else if res == nil {
+			//The key has no private data, so don't attempt to decrypt it
+			chaincodeLogger.Debugf("[%s]No private data associated with key %s of collection %s. Sending %s with an empty payload", shortuuid(msg.Uuid), privateDataInfo.Key, privateDataInfo.Collection, pb.ChaincodeMessage_RESPONSE)
+			serialSendMsg = &pb.ChaincodeMessage{Type: pb.ChaincodeMessage_RESPONSE, Payload: res, Uuid: msg.Uuid}
+		} else if res, err = handler.decrypt(msg.Uuid, res); err == nil {
+			// Send response msg back to chaincode. GetPrivateData will not trigger event
+			chaincodeLogger.Debugf("[%s]Got private data. Sending %s", shortuuid(msg.Uuid), pb.ChaincodeMessage_RESPONSE)
+			serialSendMsg = &pb.ChaincodeMessage{Type: pb.ChaincodeMessage_RESPONSE, Payload: res, Uuid: msg.Uuid}
+		} else {
+			// Send err msg back to chaincode.
+			chaincodeLogger.Errorf("[%s]Got error (%s) while decrypting. Sending %s", shortuuid(msg.Uuid), err, pb.ChaincodeMessage_ERROR)
+			serialSendMsg = &pb.ChaincodeMessage{Type: pb.ChaincodeMessage_ERROR, Payload: []byte(err.Error()), Uuid: msg.Uuid}
+		}
+	}()
+}
+
+// afterGetNamespaceState handles a GET_NAMESPACE_STATE request from the chaincode.
+func (handler *Handler) afterGetNamespaceState(e *fsm.Event, state string) {
+	msg, ok := e.Args[0].(*pb.ChaincodeMessage)
+	if !ok {
+		e.Cancel(fmt.Errorf("Received unexpected message type"))
+		return
+	}
+	chaincodeLogger.Debugf("[%s]Received %s, invoking get state of another chaincode from ledger", shortuuid(msg.Uuid), pb.ChaincodeMessage_GET_NAMESPACE_STATE)
+
+	// Query ledger for the state of the other chaincode
+	handler.handleGetNamespaceState(msg)
+}
+
+// Handles query to ledger to get the state of another chaincode, which must have granted the read access
+func (handler *Handler) handleGetNamespaceState(msg *pb.ChaincodeMessage) {
+	// The defer followed by triggering a go routine dance is needed to ensure that the previous state transition
+	// is completed before the next one is triggered. The previous state transition is deemed complete only when
+	// the afterGetNamespaceState function is exited.
+	go func() {
+		// Check if this is the unique state request from this chaincode uuid
+		uniqueReq := handler.createUUIDEntry(msg.Uuid)
+		if !uniqueReq {
+			// Drop this request
+			chaincodeLogger.Error("Another state request pending for this Uuid. Cannot process.")
+			return
+		}
+
+		var serialSendMsg *pb.ChaincodeMessage
+
+		defer func() {
+			handler.deleteUUIDEntry(msg.Uuid)
+			chaincodeLogger.Debugf("[%s]handleGetNamespaceState serial send %s", shortuuid(serialSendMsg.Uuid), serialSendMsg.Type)
+			handler.serialSend(serialSendMsg)
+		}()
+
+		//the state of another chaincode is encrypted with its keys, prohibit reading it for CONFIDENTIAL txs
+		if serialSendMsg = handler.canCallChaincode(msg.Uuid); serialSendMsg != nil {
+			return
+		}
+
+		namespaceStateInfo := &pb.NamespaceStateInfo{}
+		unmarshalErr := proto.Unmarshal(msg.Payload, namespaceStateInfo)
+		if unmarshalErr != nil {
+			payload := []byte(unmarshalErr.Error())
+			chaincodeLogger.Errorf("Failed to unmarshall namespace state request. Sending %s", pb.ChaincodeMessage_ERROR)
+			serialSendMsg = &pb.ChaincodeMessage{Type: pb.ChaincodeMessage_ERROR, Payload: payload, Uuid: msg.Uuid}
+			return
+		}
+
+		ledgerObj, ledgerErr := ledger.GetLedger()
+		if ledgerErr != nil {
+			// Send error msg back to chaincode. GetNamespaceState will not trigger event
+			payload := []byte(ledgerErr.Error())
+			chaincodeLogger.Errorf("Failed to get chaincode state(%s). Sending %s", ledgerErr, pb.ChaincodeMessage_ERROR)
+			serialSendMsg = &pb.ChaincodeMessage{Type: pb.ChaincodeMessage_ERROR, Payload: payload, Uuid: msg.Uuid}
+			return
+		}
+
+		// The ledger checks that the chaincode was granted the read access
+		chaincodeID := handler.ChaincodeID.Name
+		readCommittedState := !handler.getIsTransaction(msg.Uuid)
+		res, err := ledgerObj.GetNamespaceState(msg.Uuid, chaincodeID, namespaceStateInfo.Namespace, namespaceStateInfo.Key, readCommittedState)
+		if err != nil {
+			// Send error msg back to chaincode. GetNamespaceState will not trigger event
+			payload := []byte(err.Error())
+			chaincodeLogger.Errorf("[%s]Failed to get the state of chaincode %s(%s). Sending %s", shortuuid(msg.Uuid), namespaceStateInfo.Namespace, err, pb.ChaincodeMessage_ERROR)
+			serialSendMsg = &pb.ChaincodeMessage{Type: pb.ChaincodeMessage_ERROR, Payload: payload, Uuid: msg.Uuid}
+			return
+		}
+		// Send response msg back to chaincode. GetNamespaceState will not trigger event
+		chaincodeLogger.Debugf("[%s]Got state of chaincode %s. Sending %s", shortuuid(msg.Uuid), namespaceStateInfo.Namespace, pb.ChaincodeMessage_RESPONSE)
+		serialSendMsg = &pb.ChaincodeMessage{Type: pb.ChaincodeMessage_RESPONSE, Payload: res, Uuid: msg.Uuid}
+	}()
+}
+
+// namespaceAccess returns the ledger access matching the one granted by a chaincode
+func namespaceAccess(access pb.NamespaceAccess) ledger.NamespaceAccess {
+	switch access {
+	case pb.NamespaceAccess_READ:
+		return ledger.NamespaceAccessRead
+	case pb.NamespaceAccess_READ_WRITE:
+		return ledger.NamespaceAccessReadWrite
+	}
+	return ledger.NamespaceAccessNone
+}
+
+// afterGetStateAtBlock handles a GET_STATE_AT_BLOCK request from the chaincode.
+func (handler *Handler) afterGetStateAtBlock(e *fsm.Event, state string) {
+	msg, ok := e.Args[0].(*pb.ChaincodeMessage)
+	if !ok {
+		e.Cancel(fmt.Errorf("Received unexpected message type"))
+		return
+	}
+	chaincodeLogger.Debugf("[%s]Received %s, invoking get state at block from ledger", shortuuid(msg.Uuid), pb.ChaincodeMessage_GET_STATE_AT_BLOCK)
+
+	// Query ledger for the historical state
+	handler.handleGetStateAtBlock(msg)
+}
+
+// Handles query to ledger to get the state a key had once a block was committed
+func (handler *Handler) handleGetStateAtBlock(msg *pb.ChaincodeMessage) {
+	// The defer followed by triggering a go routine dance is needed to ensure that the previous state transition
+	// is completed before the next one is triggered. The previous state transition is deemed complete only when
+	// the afterGetStateAtBlock function is exited.
+	go func() {
+		// Check if this is the unique state request from this chaincode uuid
+		uniqueReq := handler.createUUIDEntry(msg.Uuid)
+		if !uniqueReq {
+			// Drop this request
+			chaincodeLogger.Error("Another state request pending for this Uuid. Cannot process.")
+			return
+		}
+
+		var serialSendMsg *pb.ChaincodeMessage
+
+		defer func() {
+			handler.deleteUUIDEntry(msg.Uuid)
+			chaincodeLogger.Debugf("[%s]handleGetStateAtBlock serial send %s", shortuuid(serialSendMsg.Uuid), serialSendMsg.Type)
+			handler.serialSend(serialSendMsg)
+		}()
+
+		// The history kept differs between peers, transactions would not
+		// execute deterministically if they read it
+		if handler.getIsTransaction(msg.Uuid) {
+			payload := []byte("Historical state can only be read by queries")
+			chaincodeLogger.Errorf("[%s]Transaction read historical state. Sending %s", shortuuid(msg.Uuid), pb.ChaincodeMessage_ERROR)
+			serialSendMsg = &pb.ChaincodeMessage{Type: pb.ChaincodeMessage_ERROR, Payload: payload, Uuid: msg.Uuid}
+			return
+		}
+
+		getStateAtBlock := &pb.GetStateAtBlock{}
+		unmarshalErr := proto.Unmarshal(msg.Payload, getStateAtBlock)
+		if unmarshalErr != nil {
+			payload := []byte(unmarshalErr.Error())
+			chaincodeLogger.Errorf("Failed to unmarshall state at block request. Sending %s", pb.ChaincodeMessage_ERROR)
+			serialSendMsg = &pb.ChaincodeMessage{Type: pb.ChaincodeMessage_ERROR, Payload: payload, Uuid: msg.Uuid}
+			return
+		}
+
+		ledgerObj, ledgerErr := ledger.GetLedger()
+		if ledgerErr != nil {
+			// Send error msg back to chaincode. GetStateAtBlock will not trigger event
+			payload := []byte(ledgerErr.Error())
+			chaincodeLogger.Errorf("Failed to get chaincode state(%s). Sending %s", ledgerErr, pb.ChaincodeMessage_ERROR)
+			serialSendMsg = &pb.ChaincodeMessage{Type: pb.ChaincodeMessage_ERROR, Payload: payload, Uuid: msg.Uuid}
+			return
+		}
+
+		chaincodeID := handler.ChaincodeID.Name
+		res, err := ledgerObj.GetStateAtBlock(chaincodeID, getStateAtBlock.Key, getStateAtBlock.BlockNumber)
+		if err != nil {
+			// Send error msg back to chaincode. GetStateAtBlock will not trigger event
+			payload := []byte(err.Error())
+			chaincodeLogger.Errorf("[%s]Failed to get chaincode state at block %d(%s). Sending %s", shortuuid(msg.Uuid), getStateAtBlock.BlockNumber, err, pb.ChaincodeMessage_ERROR)
+			serialSendMsg = &pb.ChaincodeMessage{Type: pb.ChaincodeMessage_ERROR, Payload: payload, Uuid: msg.Uuid}
+		} else if res == nil {
+			//The key had no value, so don't attempt to decrypt it
+			chaincodeLogger.Debugf("[%s]No state associated with key %s at block %d. Sending %s with an empty payload", shortuuid(msg.Uuid), getStateAtBlock.Key, getStateAtBlock.BlockNumber, pb.ChaincodeMessage_RESPONSE)
+			serialSendMsg = &pb.ChaincodeMessage{Type: pb.ChaincodeMessage_RESPONSE, Payload: res, Uuid: msg.Uuid}
+		} else if res, err = handler.decrypt(msg.Uuid, res); err == nil {
+			// Send response msg back to chaincode. GetStateAtBlock will not trigger event
+			chaincodeLogger.Debugf("[%s]Got state at block %d. Sending %s", shortuuid(msg.Uuid), getStateAtBlock.BlockNumber, pb.ChaincodeMessage_RESPONSE)
+			serialSendMsg = &pb.ChaincodeMessage{Type: pb.ChaincodeMessage_RESPONSE, Payload: res, Uuid: msg.Uuid}
+		} else {
+			// Send err msg back to chaincode.
+			chaincodeLogger.Errorf("[%s]Got error (%s) while decrypting. Sending %s", shortuuid(msg.Uuid), err, pb.ChaincodeMessage_ERROR)
+			serialSendMsg = &pb.ChaincodeMessage{Type: pb.ChaincodeMessage_ERROR, Payload: []byte(err.Error()), Uuid: msg.Uuid}
+		}
+	}()
+}
+
 const maxRangeQueryStateLimit = 100
 
 // afterRangeQueryState handles a RANGE_QUERY_STATE request from the chaincode.
@@ -710,10 +1089,14 @@ func (handler *Handler) handleRangeQueryState(msg *pb.ChaincodeMessage) {
 			return
 		}
 
+		if rangeQueryState.PageSize > 0 {
+			serialSendMsg = handler.getRangeQueryStatePage(msg, ledger, rangeQueryState)
+			return
+		}
+
 		chaincodeID := handler.ChaincodeID.Name
 
-		readCommittedState := !handler.getIsTransaction(msg.Uuid)
-		rangeIter, err := ledger.GetStateRangeScanIterator(chaincodeID, rangeQueryState.StartKey, rangeQueryState.EndKey, readCommittedState)
+		rangeIter, err := handler.getTxStateRangeScanIterator(ledger, msg.Uuid, chaincodeID, rangeQueryState.StartKey, rangeQueryState.EndKey)
 		if err != nil {
 			// Send error msg back to chaincode. GetState will not trigger event
 			payload := []byte(err.Error())
@@ -774,6 +1157,178 @@ func (handler *Handler) handleRangeQueryState(msg *pb.ChaincodeMessage) {
 	}()
 }
 
+// afterQueryIndex handles a QUERY_INDEX request from the chaincode.
+func (handler *Handler) afterQueryIndex(e *fsm.Event, state string) {
+	msg, ok := e.Args[0].(*pb.ChaincodeMessage)
+	if !ok {
+		e.Cancel(fmt.Errorf("Received unexpected message type"))
+		return
+	}
+	chaincodeLogger.Debugf("Received %s, invoking query index from ledger", pb.ChaincodeMessage_QUERY_INDEX)
+
+	// Query ledger for the keys of the index
+	handler.handleQueryIndex(msg)
+	chaincodeLogger.Debug("Exiting QUERY_INDEX")
+}
+
+// Handles query to ledger for the keys of an index, the following pages being
+// read with RANGE_QUERY_STATE_NEXT
+func (handler *Handler) handleQueryIndex(msg *pb.ChaincodeMessage) {
+	// The defer followed by triggering a go routine dance is needed to ensure that the previous state transition
+	// is completed before the next one is triggered. The previous state transition is deemed complete only when
+	// the afterQueryIndex function is exited.
+	go func() {
+		// Check if this is the unique state request from this chaincode uuid
+		uniqueReq := handler.createUUIDEntry(msg.Uuid)
+		if !uniqueReq {
+			// Drop this request
+			chaincodeLogger.Error("Another state request pending for this Uuid. Cannot process.")
+			return
+		}
+
+		var serialSendMsg *pb.ChaincodeMessage
+
+		defer func() {
+			handler.deleteUUIDEntry(msg.Uuid)
+			chaincodeLogger.Debugf("[%s]handleQueryIndex serial send %s", shortuuid(serialSendMsg.Uuid), serialSendMsg.Type)
+			handler.serialSend(serialSendMsg)
+		}()
+
+		// Only the peers enabling them keep the indexes, transactions would
+		// not execute deterministically if they read them
+		if handler.getIsTransaction(msg.Uuid) {
+			payload := []byte("Indexes can only be read by queries")
+			chaincodeLogger.Errorf("[%s]Transaction read an index. Sending %s", shortuuid(msg.Uuid), pb.ChaincodeMessage_ERROR)
+			serialSendMsg = &pb.ChaincodeMessage{Type: pb.ChaincodeMessage_ERROR, Payload: payload, Uuid: msg.Uuid}
+			return
+		}
+
+		queryIndex := &pb.QueryIndex{}
+		unmarshalErr := proto.Unmarshal(msg.Payload, queryIndex)
+		if unmarshalErr != nil {
+			payload := []byte(unmarshalErr.Error())
+			chaincodeLogger.Errorf("Failed to unmarshall query index request. Sending %s", pb.ChaincodeMessage_ERROR)
+			serialSendMsg = &pb.ChaincodeMessage{Type: pb.ChaincodeMessage_ERROR, Payload: payload, Uuid: msg.Uuid}
+			return
+		}
+
+		ledgerObj, ledgerErr := ledger.GetLedger()
+		if ledgerErr != nil {
+			// Send error msg back to chaincode. QueryIndex will not trigger event
+			payload := []byte(ledgerErr.Error())
+			chaincodeLogger.Errorf("Failed to get ledger. Sending %s", pb.ChaincodeMessage_ERROR)
+			serialSendMsg = &pb.ChaincodeMessage{Type: pb.ChaincodeMessage_ERROR, Payload: payload, Uuid: msg.Uuid}
+			return
+		}
+
+		// An empty bound leaves the range open
+		start, end := queryIndex.Start, queryIndex.End
+		if len(start) == 0 {
+			start = nil
+		}
+		if len(end) == 0 {
+			end = nil
+		}
+
+		chaincodeID := handler.ChaincodeID.Name
+		indexIter, err := ledgerObj.GetStateIndexRangeScanIterator(chaincodeID, queryIndex.Index, start, end)
+		if err != nil {
+			// Send error msg back to chaincode. QueryIndex will not trigger event
+			payload := []byte(err.Error())
+			chaincodeLogger.Errorf("[%s]Failed to query index %s(%s). Sending %s", shortuuid(msg.Uuid), queryIndex.Index, err, pb.ChaincodeMessage_ERROR)
+			serialSendMsg = &pb.ChaincodeMessage{Type: pb.ChaincodeMessage_ERROR, Payload: payload, Uuid: msg.Uuid}
+			return
+		}
+
+		iterID := util.GenerateUUID()
+		txContext := handler.getTxContext(msg.Uuid)
+		handler.putRangeQueryIterator(txContext, iterID, indexIter)
+
+		hasNext := indexIter.Next()
+
+		var keysAndValues []*pb.RangeQueryStateKeyValue
+		var i = uint32(0)
+		for ; hasNext && i < maxRangeQueryStateLimit; i++ {
+			key, value := indexIter.GetKeyValue()
+			// Decrypt the data if the confidential is enabled
+			decryptedValue, decryptErr := handler.decrypt(msg.Uuid, value)
+			if decryptErr != nil {
+				payload := []byte(decryptErr.Error())
+				chaincodeLogger.Errorf("Failed decrypt value. Sending %s", pb.ChaincodeMessage_ERROR)
+				serialSendMsg = &pb.ChaincodeMessage{Type: pb.ChaincodeMessage_ERROR, Payload: payload, Uuid: msg.Uuid}
+
+				indexIter.Close()
+				handler.deleteRangeQueryIterator(txContext, iterID)
+
+				return
+			}
+			keyAndValue := pb.RangeQueryStateKeyValue{Key: key, Value: decryptedValue}
+			keysAndValues = append(keysAndValues, &keyAndValue)
+
+			hasNext = indexIter.Next()
+		}
+
+		if !hasNext {
+			indexIter.Close()
+			handler.deleteRangeQueryIterator(txContext, iterID)
+		}
+
+		payload := &pb.RangeQueryStateResponse{KeysAndValues: keysAndValues, HasMore: hasNext, ID: iterID}
+		payloadBytes, err := proto.Marshal(payload)
+		if err != nil {
+			indexIter.Close()
+			handler.deleteRangeQueryIterator(txContext, iterID)
+
+			// Send error msg back to chaincode. QueryIndex will not trigger event
+			payload := []byte(err.Error())
+			chaincodeLogger.Errorf("Failed marshall resopnse. Sending %s", pb.ChaincodeMessage_ERROR)
+			serialSendMsg = &pb.ChaincodeMessage{Type: pb.ChaincodeMessage_ERROR, Payload: payload, Uuid: msg.Uuid}
+			return
+		}
+
+		chaincodeLogger.Debugf("Got keys and values of index %s. Sending %s", queryIndex.Index, pb.ChaincodeMessage_RESPONSE)
+		serialSendMsg = &pb.ChaincodeMessage{Type: pb.ChaincodeMessage_RESPONSE, Payload: payloadBytes, Uuid: msg.Uuid}
+	}()
+}
+
+// getRangeQueryStatePage reads a page of a range of the committed state, returning the message to
+// send back to the chaincode. No iterator is kept between the pages, the bookmark resumes the range.
+func (handler *Handler) getRangeQueryStatePage(msg *pb.ChaincodeMessage, ledgerObj *ledger.Ledger, rangeQueryState *pb.RangeQueryState) *pb.ChaincodeMessage {
+	pageSize := int(rangeQueryState.PageSize)
+	if pageSize > maxRangeQueryStateLimit {
+		pageSize = maxRangeQueryStateLimit
+	}
+
+	chaincodeID := handler.ChaincodeID.Name
+	page, err := ledgerObj.GetStateRangeScanPage(chaincodeID, rangeQueryState.StartKey, rangeQueryState.EndKey, pageSize, rangeQueryState.Bookmark)
+	if err != nil {
+		// Send error msg back to chaincode. GetState will not trigger event
+		chaincodeLogger.Errorf("[%s]Failed to get range query page(%s). Sending %s", shortuuid(msg.Uuid), err, pb.ChaincodeMessage_ERROR)
+		return &pb.ChaincodeMessage{Type: pb.ChaincodeMessage_ERROR, Payload: []byte(err.Error()), Uuid: msg.Uuid}
+	}
+
+	var keysAndValues []*pb.RangeQueryStateKeyValue
+	for i, key := range page.Keys {
+		// Decrypt the data if the confidential is enabled
+		decryptedValue, decryptErr := handler.decrypt(msg.Uuid, page.Values[i])
+		if decryptErr != nil {
+			chaincodeLogger.Errorf("Failed decrypt value. Sending %s", pb.ChaincodeMessage_ERROR)
+			return &pb.ChaincodeMessage{Type: pb.ChaincodeMessage_ERROR, Payload: []byte(decryptErr.Error()), Uuid: msg.Uuid}
+		}
+		keysAndValues = append(keysAndValues, &pb.RangeQueryStateKeyValue{Key: key, Value: decryptedValue})
+	}
+
+	payload := &pb.RangeQueryStateResponse{KeysAndValues: keysAndValues, Bookmark: page.Bookmark}
+	payloadBytes, err := proto.Marshal(payload)
+	if err != nil {
+		chaincodeLogger.Errorf("Failed marshall resopnse. Sending %s", pb.ChaincodeMessage_ERROR)
+		return &pb.ChaincodeMessage{Type: pb.ChaincodeMessage_ERROR, Payload: []byte(err.Error()), Uuid: msg.Uuid}
+	}
+
+	chaincodeLogger.Debugf("Got page of keys and values. Sending %s", pb.ChaincodeMessage_RESPONSE)
+	return &pb.ChaincodeMessage{Type: pb.ChaincodeMessage_RESPONSE, Payload: payloadBytes, Uuid: msg.Uuid}
+}
+
 // afterRangeQueryState handles a RANGE_QUERY_STATE_NEXT request from the chaincode.
 func (handler *Handler) afterRangeQueryStateNext(e *fsm.Event, state string) {
 	msg, ok := e.Args[0].(*pb.ChaincodeMessage)
@@ -969,6 +1524,43 @@ func (handler *Handler) afterDelState(e *fsm.Event, state string) {
 	// Delete state from ledger handled within enterBusyState
 }
 
+// afterPutPrivateData handles a PUT_PRIVATE_DATA request from the chaincode.
+func (handler *Handler) afterPutPrivateData(e *fsm.Event, state string) {
+	_, ok := e.Args[0].(*pb.ChaincodeMessage)
+	if !ok {
+		e.Cancel(fmt.Errorf("Received unexpected message type"))
+		return
+	}
+	chaincodeLogger.Debugf("Received %s in state %s, invoking put private data to ledger", pb.ChaincodeMessage_PUT_PRIVATE_DATA, state)
+
+	// Put private data into ledger handled within enterBusyState
+}
+
+// afterDelPrivateData handles a DEL_PRIVATE_DATA request from the chaincode.
+func (handler *Handler) afterDelPrivateData(e *fsm.Event, state string) {
+	_, ok := e.Args[0].(*pb.ChaincodeMessage)
+	if !ok {
+		e.Cancel(fmt.Errorf("Received unexpected message type"))
+		return
+	}
+	chaincodeLogger.Debugf("Received %s, invoking delete private data from ledger", pb.ChaincodeMessage_DEL_PRIVATE_DATA)
+
+	// Delete private data from ledger handled within enterBusyState
+}
+
+// afterWriteNamespaceState handles a PUT_NAMESPACE_STATE, DEL_NAMESPACE_STATE
+// or GRANT_NAMESPACE_ACCESS request from the chaincode.
+func (handler *Handler) afterWriteNamespaceState(e *fsm.Event, state string) {
+	msg, ok := e.Args[0].(*pb.ChaincodeMessage)
+	if !ok {
+		e.Cancel(fmt.Errorf("Received unexpected message type"))
+		return
+	}
+	chaincodeLogger.Debugf("Received %s in state %s, invoking the ledger", msg.Type, state)
+
+	// Write to the ledger handled within enterBusyState
+}
+
 // afterInvokeChaincode handles an INVOKE_CHAINCODE request from the chaincode.
 func (handler *Handler) afterInvokeChaincode(e *fsm.Event, state string) {
 	_, ok := e.Args[0].(*pb.ChaincodeMessage)
@@ -1038,12 +1630,65 @@ func (handler *Handler) enterBusyState(e *fsm.Event, state string) {
 			// Encrypt the data if the confidential is enabled
 			if pVal, err = handler.encrypt(msg.Uuid, putStateInfo.Value); err == nil {
 				// Invoke ledger to put state
-				err = ledgerObj.SetState(chaincodeID, putStateInfo.Key, pVal)
+				err = ledgerObj.SetNamespaceState(msg.Uuid, chaincodeID, chaincodeID, putStateInfo.Key, pVal)
 			}
 		} else if msg.Type.String() == pb.ChaincodeMessage_DEL_STATE.String() {
 			// Invoke ledger to delete state
 			key := string(msg.Payload)
-			err = ledgerObj.DeleteState(chaincodeID, key)
+			err = ledgerObj.DeleteNamespaceState(msg.Uuid, chaincodeID, chaincodeID, key)
+		} else if msg.Type.String() == pb.ChaincodeMessage_PUT_PRIVATE_DATA.String() || msg.Type.String() == pb.ChaincodeMessage_DEL_PRIVATE_DATA.String() {
+			privateDataInfo := &pb.PrivateDataInfo{}
+			unmarshalErr := proto.Unmarshal(msg.Payload, privateDataInfo)
+			if unmarshalErr != nil {
+				payload := []byte(unmarshalErr.Error())
+				chaincodeLogger.Errorf("[%s]Unable to decipher payload. Sending %s", shortuuid(msg.Uuid), pb.ChaincodeMessage_ERROR)
+				triggerNextStateMsg = &pb.ChaincodeMessage{Type: pb.ChaincodeMessage_ERROR, Payload: payload, Uuid: msg.Uuid}
+				return
+			}
+
+			if msg.Type.String() == pb.ChaincodeMessage_DEL_PRIVATE_DATA.String() {
+				// Invoke ledger to delete private data
+				err = ledgerObj.DeletePrivateData(msg.Uuid, chaincodeID, privateDataInfo.Collection, privateDataInfo.Key)
+			} else {
+				var pVal []byte
+				// Encrypt the data if the confidential is enabled
+				if pVal, err = handler.encrypt(msg.Uuid, privateDataInfo.Value); err == nil {
+					// Invoke ledger to put private data
+					err = ledgerObj.SetPrivateData(msg.Uuid, chaincodeID, privateDataInfo.Collection, privateDataInfo.Key, pVal)
+				}
+			}
+		} else if msg.Type.String() == pb.ChaincodeMessage_PUT_NAMESPACE_STATE.String() || msg.Type.String() == pb.ChaincodeMessage_DEL_NAMESPACE_STATE.String() {
+			//the state of another chaincode is encrypted with its keys, prohibit accessing it for CONFIDENTIAL txs
+			if triggerNextStateMsg = handler.canCallChaincode(msg.Uuid); triggerNextStateMsg != nil {
+				return
+			}
+			namespaceStateInfo := &pb.NamespaceStateInfo{}
+			unmarshalErr := proto.Unmarshal(msg.Payload, namespaceStateInfo)
+			if unmarshalErr != nil {
+				payload := []byte(unmarshalErr.Error())
+				chaincodeLogger.Errorf("[%s]Unable to decipher payload. Sending %s", shortuuid(msg.Uuid), pb.ChaincodeMessage_ERROR)
+				triggerNextStateMsg = &pb.ChaincodeMessage{Type: pb.ChaincodeMessage_ERROR, Payload: payload, Uuid: msg.Uuid}
+				return
+			}
+
+			// The ledger checks that the chaincode was granted the write access
+			if msg.Type.String() == pb.ChaincodeMessage_DEL_NAMESPACE_STATE.String() {
+				err = ledgerObj.DeleteNamespaceState(msg.Uuid, chaincodeID, namespaceStateInfo.Namespace, namespaceStateInfo.Key)
+			} else {
+				err = ledgerObj.SetNamespaceState(msg.Uuid, chaincodeID, namespaceStateInfo.Namespace, namespaceStateInfo.Key, namespaceStateInfo.Value)
+			}
+		} else if msg.Type.String() == pb.ChaincodeMessage_GRANT_NAMESPACE_ACCESS.String() {
+			grant := &pb.NamespaceAccessGrant{}
+			unmarshalErr := proto.Unmarshal(msg.Payload, grant)
+			if unmarshalErr != nil {
+				payload := []byte(unmarshalErr.Error())
+				chaincodeLogger.Errorf("[%s]Unable to decipher payload. Sending %s", shortuuid(msg.Uuid), pb.ChaincodeMessage_ERROR)
+				triggerNextStateMsg = &pb.ChaincodeMessage{Type: pb.ChaincodeMessage_ERROR, Payload: payload, Uuid: msg.Uuid}
+				return
+			}
+
+			// A chaincode only grants the access to its own state
+			err = ledgerObj.GrantNamespaceAccess(msg.Uuid, chaincodeID, grant.Grantee, namespaceAccess(grant.Access))
 		} else if msg.Type.String() == pb.ChaincodeMessage_INVOKE_CHAINCODE.String() {
 			//check and prohibit C-call-C for CONFIDENTIAL txs
 			if triggerNextStateMsg = handler.canCallChaincode(msg.Uuid); triggerNextStateMsg != nil {
@@ -1060,6 +1705,13 @@ func (handler *Handler) enterBusyState(e *fsm.Event, state string) {
 
 			// Get the chaincodeID to invoke
 			newChaincodeID := chaincodeSpec.ChaincodeID.Name
+			if triggerNextStateMsg = handler.canInvokeChaincode(msg.Uuid, newChaincodeID); triggerNextStateMsg != nil {
+				return
+			}
+			if triggerNextStateMsg = handler.enterChaincodeCall(msg.Uuid, newChaincodeID); triggerNextStateMsg != nil {
+				return
+			}
+			defer handler.chaincodeSupport.calls.exit(msg.Uuid)
 
 			// Create the transaction object
 			chaincodeInvocationSpec := &pb.ChaincodeInvocationSpec{ChaincodeSpec: chaincodeSpec}
@@ -1074,21 +1726,37 @@ func (handler *Handler) enterBusyState(e *fsm.Event, state string) {
 				return
 			}
 
-			// TODO: Need to handle timeout correctly
-			timeout := time.Duration(30000) * time.Millisecond
+			limits, limitsErr := handler.chaincodeSupport.getChaincodeLimits(msg.Uuid, newChaincodeID, false)
+			if limitsErr != nil {
+				payload := []byte(limitsErr.Error())
+				chaincodeLogger.Errorf("[%s]Failed to get the limits of invoked chaincode. Sending %s", shortuuid(msg.Uuid), pb.ChaincodeMessage_ERROR)
+				triggerNextStateMsg = &pb.ChaincodeMessage{Type: pb.ChaincodeMessage_ERROR, Payload: payload, Uuid: msg.Uuid}
+				return
+			}
 
 			ccMsg, _ := createTransactionMessage(transaction.Uuid, chaincodeInput)
 
+			// The chaincode called may be executing a transaction of another lane of a parallel execution,
+			// the transaction then executes again on its own, whatever the calling chaincode makes of the error
+			if !handler.chaincodeSupport.execLocks.tryLock(newChaincodeID) {
+				handler.chaincodeSupport.execLocks.refuse(msg.Uuid)
+				payload := []byte(fmt.Sprintf("Chaincode %s is executing another transaction", newChaincodeID))
+				chaincodeLogger.Debugf("[%s]Invoked chaincode %s is busy. Sending %s", shortuuid(msg.Uuid), newChaincodeID, pb.ChaincodeMessage_ERROR)
+				triggerNextStateMsg = &pb.ChaincodeMessage{Type: pb.ChaincodeMessage_ERROR, Payload: payload, Uuid: msg.Uuid}
+				return
+			}
+			defer handler.chaincodeSupport.execLocks.unlock(newChaincodeID)
+
 			// Execute the chaincode
 			//NOTE: when confidential C-call-C is understood, transaction should have the correct sec context for enc/dec
-			response, execErr := handler.chaincodeSupport.Execute(context.Background(), newChaincodeID, ccMsg, timeout, transaction)
+			response, execErr := handler.chaincodeSupport.Execute(context.Background(), newChaincodeID, ccMsg, executionTimeout(limits), transaction)
 
 			//payload is marshalled and send to the calling chaincode's shim which unmarshals and
 			//sends it to chaincode
 			res = nil
 			if execErr != nil {
 				err = execErr
-			} else {
+			} else if err = checkResponseSize(limits, newChaincodeID, response); err == nil {
 				res, err = proto.Marshal(response)
 			}
 		}
@@ -1148,6 +1816,7 @@ func (handler *Handler) enterReadyState(e *fsm.Event, state string) {
 		return
 	}
 	chaincodeLogger.Debugf("[%s]Entered state %s", shortuuid(msg.Uuid), state)
+	handler.resumeDone()
 	handler.notify(msg)
 }
 
@@ -1338,6 +2007,13 @@ func (handler *Handler) handleQueryChaincode(msg *pb.ChaincodeMessage) {
 
 		// Get the chaincodeID to invoke
 		newChaincodeID := chaincodeSpec.ChaincodeID.Name
+		if serialSendMsg = handler.canInvokeChaincode(msg.Uuid, newChaincodeID); serialSendMsg != nil {
+			return
+		}
+		if serialSendMsg = handler.enterChaincodeCall(msg.Uuid, newChaincodeID); serialSendMsg != nil {
+			return
+		}
+		defer handler.chaincodeSupport.calls.exit(msg.Uuid)
 
 		// Create the transaction object
 		chaincodeInvocationSpec := &pb.ChaincodeInvocationSpec{ChaincodeSpec: chaincodeSpec}
@@ -1352,14 +2028,22 @@ func (handler *Handler) handleQueryChaincode(msg *pb.ChaincodeMessage) {
 			return
 		}
 
-		// TODO: Need to handle timeout correctly
-		timeout := time.Duration(30000) * time.Millisecond
+		limits, limitsErr := handler.chaincodeSupport.getChaincodeLimits(msg.Uuid, newChaincodeID, true)
+		if limitsErr != nil {
+			payload := []byte(limitsErr.Error())
+			chaincodeLogger.Errorf("[%s]Failed to get the limits of invoked chaincode. Sending %s", shortuuid(msg.Uuid), pb.ChaincodeMessage_ERROR)
+			serialSendMsg = &pb.ChaincodeMessage{Type: pb.ChaincodeMessage_ERROR, Payload: payload, Uuid: msg.Uuid}
+			return
+		}
 
 		ccMsg, _ := createQueryMessage(transaction.Uuid, chaincodeInput)
 
 		// Query the chaincode
 		//NOTE: when confidential C-call-C is understood, transaction should have the correct sec context for enc/dec
-		response, execErr := handler.chaincodeSupport.Execute(context.Background(), newChaincodeID, ccMsg, timeout, transaction)
+		response, execErr := handler.chaincodeSupport.Execute(context.Background(), newChaincodeID, ccMsg, executionTimeout(limits), transaction)
+		if execErr == nil {
+			execErr = checkResponseSize(limits, newChaincodeID, response)
+		}
 
 		if execErr != nil {
 			// Send error msg back to chaincode and trigger event
@@ -1413,7 +2097,7 @@ func (handler *Handler) HandleMessage(msg *pb.ChaincodeMessage) error {
 	}
 	if handler.FSM.Cannot(msg.Type.String()) {
 		// Check if this is a request from validator in query context
-		if msg.Type.String() == pb.ChaincodeMessage_PUT_STATE.String() || msg.Type.String() == pb.ChaincodeMessage_DEL_STATE.String() || msg.Type.String() == pb.ChaincodeMessage_INVOKE_CHAINCODE.String() {
+		if msg.Type.String() == pb.ChaincodeMessage_PUT_STATE.String() || msg.Type.String() == pb.ChaincodeMessage_DEL_STATE.String() || msg.Type.String() == pb.ChaincodeMessage_PUT_PRIVATE_DATA.String() || msg.Type.String() == pb.ChaincodeMessage_DEL_PRIVATE_DATA.String() || msg.Type.String() == pb.ChaincodeMessage_PUT_NAMESPACE_STATE.String() || msg.Type.String() == pb.ChaincodeMessage_DEL_NAMESPACE_STATE.String() || msg.Type.String() == pb.ChaincodeMessage_GRANT_NAMESPACE_ACCESS.String() || msg.Type.String() == pb.ChaincodeMessage_INVOKE_CHAINCODE.String() {
 			// Check if this UUID is a transaction
 			if !handler.getIsTransaction(msg.Uuid) {
 				payload := []byte(fmt.Sprintf("[%s]Cannot handle %s in query context", msg.Uuid, msg.Type.String()))
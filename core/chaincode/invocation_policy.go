@@ -0,0 +1,136 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package chaincode
+
+import (
+	"fmt"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/hyperledger/fabric/core/chaincode/shim/crypto/attr"
+	"github.com/hyperledger/fabric/core/crypto/primitives"
+	"github.com/hyperledger/fabric/core/ledger"
+	pb "github.com/hyperledger/fabric/protos"
+)
+
+// roleAttributeName is the certificate attribute matched against the roles of
+// an invocation policy
+const roleAttributeName = "role"
+
+// callerCertificate holds the certificate of the caller of a transaction for
+// reading its attributes
+type callerCertificate []byte
+
+func (cert callerCertificate) GetCallerCertificate() ([]byte, error) {
+	return cert, nil
+}
+
+// isEmptyPolicy returns true if the policy allows every caller
+func isEmptyPolicy(policy *pb.InvocationPolicy) bool {
+	return policy == nil || (len(policy.EnrollmentIDs) == 0 && len(policy.Roles) == 0 && len(policy.Attributes) == 0)
+}
+
+// policyAllows returns true if the caller with the certificate cert is allowed by the policy: its enrollment ID
+// (the common name of an enrollment certificate) or its role is listed, or it has all the attributes of the policy.
+// Without a certificate, as when security is disabled, only an empty policy allows the caller
+func policyAllows(policy *pb.InvocationPolicy, cert []byte) bool {
+	if isEmptyPolicy(policy) {
+		return true
+	}
+	if cert == nil {
+		return false
+	}
+	x509Cert, err := primitives.DERToX509Certificate(cert)
+	if err != nil {
+		chaincodeLogger.Debugf("Invalid caller certificate: %s", err)
+		return false
+	}
+	for _, enrollmentID := range policy.EnrollmentIDs {
+		if enrollmentID == x509Cert.Subject.CommonName {
+			return true
+		}
+	}
+	attributesHandler, err := attr.NewAttributesHandlerImpl(callerCertificate(cert))
+	if err != nil {
+		chaincodeLogger.Debugf("Failed reading the attributes of the caller certificate: %s", err)
+		return false
+	}
+	if len(policy.Roles) > 0 {
+		if role, err := attributesHandler.GetValue(roleAttributeName); err == nil {
+			for _, allowed := range policy.Roles {
+				if allowed == string(role) {
+					return true
+				}
+			}
+		}
+	}
+	if len(policy.Attributes) > 0 {
+		attrs := make([]*attr.Attribute, len(policy.Attributes))
+		for i, predicate := range policy.Attributes {
+			attrs[i] = &attr.Attribute{Name: predicate.Name, Value: predicate.Value}
+		}
+		if ok, err := attributesHandler.VerifyAttributes(attrs...); err == nil && ok {
+			return true
+		}
+	}
+	return false
+}
+
+// checkInvocationPolicy returns an error unless the invocation policy of the chaincode, as seen by the transaction
+// txUUID, allows the caller with the certificate cert. Queries only see the policies committed
+func checkInvocationPolicy(lgr *ledger.Ledger, txUUID string, chaincodeID string, cert []byte, committed bool) error {
+	policy, err := lgr.GetInvocationPolicy(txUUID, chaincodeID, committed)
+	if err != nil {
+		return fmt.Errorf("Failed to get the invocation policy of chaincode %s(%s)", chaincodeID, err)
+	}
+	if !policyAllows(policy, cert) {
+		return fmt.Errorf("The invocation policy of chaincode %s does not allow the caller", chaincodeID)
+	}
+	return nil
+}
+
+// setDeployInvocationPolicy sets the invocation policy of the chaincode deployed by the transaction t to the policy
+// of its deployment spec, if any
+func setDeployInvocationPolicy(lgr *ledger.Ledger, t *pb.Transaction, chaincodeID string) error {
+	cds := &pb.ChaincodeDeploymentSpec{}
+	if err := proto.Unmarshal(t.Payload, cds); err != nil {
+		return fmt.Errorf("Invalid deployment spec(%s)", err)
+	}
+	policy := cds.GetChaincodeSpec().GetInvocationPolicy()
+	if policy == nil {
+		return nil
+	}
+	if err := lgr.SetInvocationPolicy(t.Uuid, chaincodeID, policy); err != nil {
+		return fmt.Errorf("Failed to set the invocation policy of chaincode %s(%s)", chaincodeID, err)
+	}
+	return nil
+}
+
+// updateInvocationPolicy replaces the invocation policy of the chaincode with policy, on behalf of the transaction
+// t, if the update policy of the current policy allows the caller. A policy without an update policy is final
+func updateInvocationPolicy(lgr *ledger.Ledger, t *pb.Transaction, chaincodeID string, policy *pb.InvocationPolicy) error {
+	current, err := lgr.GetInvocationPolicy(t.Uuid, chaincodeID, false)
+	if err != nil {
+		return fmt.Errorf("Failed to get the invocation policy of chaincode %s(%s)", chaincodeID, err)
+	}
+	if current.GetUpdatePolicy() == nil || !policyAllows(current.UpdatePolicy, t.Cert) {
+		return fmt.Errorf("The invocation policy of chaincode %s cannot be updated by the caller", chaincodeID)
+	}
+	if isEmptyPolicy(policy) && policy.GetUpdatePolicy() == nil {
+		policy = nil
+	}
+	return lgr.SetInvocationPolicy(t.Uuid, chaincodeID, policy)
+}
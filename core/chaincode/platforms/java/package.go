@@ -8,6 +8,7 @@ import (
 
 	"github.com/spf13/viper"
 
+	cutil "github.com/hyperledger/fabric/core/container/util"
 	pb "github.com/hyperledger/fabric/protos"
 )
 
@@ -38,12 +39,13 @@ func writeChaincodePackage(spec *pb.ChaincodeSpec, tw *tar.Writer) error {
 	}
 	urlLocation = urlLocation[strings.LastIndex(urlLocation, "/")+1:]
 
-	var newRunLine string
-	if viper.GetBool("security.enabled") {
-		//todo
-	} else {
-		newRunLine = fmt.Sprintf("COPY %s /root/\n"+
-			"RUN cd /root/ && gradle build", urlLocation)
+	newRunLine := fmt.Sprintf("COPY %s /root/\n"+
+		"RUN cd /root/ && gradle build", urlLocation)
+
+	//the chaincode connects to the peer with the TLS certificate of the peer, copied
+	//in the container where the peer tells the chaincode to find it
+	if viper.GetBool("peer.tls.enabled") {
+		newRunLine = fmt.Sprintf("%s\nCOPY certs/cert.pem %s", newRunLine, viper.GetString("peer.tls.cert.file"))
 	}
 
 	dockerFileContents := fmt.Sprintf("%s\n%s", viper.GetString("chaincode.java.Dockerfile"), newRunLine)
@@ -53,5 +55,11 @@ func writeChaincodePackage(spec *pb.ChaincodeSpec, tw *tar.Writer) error {
 	var zeroTime time.Time
 	tw.WriteHeader(&tar.Header{Name: "Dockerfile", Size: dockerFileSize, ModTime: zeroTime, AccessTime: zeroTime, ChangeTime: zeroTime})
 	tw.Write([]byte(dockerFileContents))
+
+	if viper.GetBool("peer.tls.enabled") {
+		if err := cutil.WriteFileToPackage(viper.GetString("peer.tls.cert.file"), "certs/cert.pem", tw); err != nil {
+			return fmt.Errorf("Error writing the peer TLS certificate to the package: %s", err)
+		}
+	}
 	return nil
 }
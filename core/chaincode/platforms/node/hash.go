@@ -0,0 +1,127 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package node
+
+import (
+	"archive/tar"
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	cutil "github.com/hyperledger/fabric/core/container/util"
+	"github.com/hyperledger/fabric/core/util"
+	pb "github.com/hyperledger/fabric/protos"
+)
+
+// chaincodePackageDir is the directory of the chaincode in the package
+const chaincodePackageDir = "chaincode"
+
+// excludedDirs are not part of the chaincode: the dependencies are installed
+// when the container is built
+var excludedDirs = map[string]bool{
+	"node_modules": true,
+	".git":         true,
+}
+
+// getCodePath returns the local directory of the chaincode, relative paths
+// being relative to the working directory
+func getCodePath(spec *pb.ChaincodeSpec) (string, error) {
+	if spec.ChaincodeID == nil || spec.ChaincodeID.Path == "" {
+		return "", fmt.Errorf("Cannot get chaincode from empty path")
+	}
+	codepath, err := filepath.Abs(spec.ChaincodeID.Path)
+	if err != nil {
+		return "", fmt.Errorf("Error getting chaincode path %s", err)
+	}
+	fi, err := os.Stat(codepath)
+	if err != nil {
+		return "", fmt.Errorf("code does not exist %s", err)
+	}
+	if !fi.IsDir() {
+		return "", fmt.Errorf("file %s is not dir", codepath)
+	}
+	return codepath, nil
+}
+
+//hashFilesInDir computes h=hash(h,file bytes) for each file in a directory,
+//writing the files under packageDir in the package. Directory entries are
+//traversed recursively. In the end a single hash value is returned for the
+//entire directory structure
+func hashFilesInDir(dir string, packageDir string, hash []byte, tw *tar.Writer) ([]byte, error) {
+	//ReadDir returns sorted list of files in dir
+	fis, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return hash, fmt.Errorf("ReadDir failed %s", err)
+	}
+	for _, fi := range fis {
+		name := filepath.Join(dir, fi.Name())
+		packageName := packageDir + "/" + fi.Name()
+		if fi.IsDir() {
+			if excludedDirs[fi.Name()] {
+				continue
+			}
+			if hash, err = hashFilesInDir(name, packageName, hash, tw); err != nil {
+				return hash, err
+			}
+			continue
+		}
+		buf, err := ioutil.ReadFile(name)
+		if err != nil {
+			return hash, fmt.Errorf("Error reading %s", err)
+		}
+
+		newSlice := make([]byte, len(hash)+len(buf))
+		copy(newSlice[len(buf):], hash[:])
+		hash = util.ComputeCryptoHash(newSlice)
+
+		if tw != nil {
+			if err = cutil.WriteStreamToPackage(bytes.NewReader(buf), name, packageName, tw); err != nil {
+				return hash, fmt.Errorf("Error adding file to tar %s", err)
+			}
+		}
+	}
+	return hash, nil
+}
+
+//generateHashcode gets hashcode of the code under the path of the chaincode,
+//writing the code to the package
+func generateHashcode(spec *pb.ChaincodeSpec, tw *tar.Writer) (string, error) {
+	if spec == nil {
+		return "", fmt.Errorf("Cannot generate hashcode from nil spec")
+	}
+
+	ctor := spec.CtorMsg
+	if ctor == nil || ctor.Function == "" {
+		return "", fmt.Errorf("Cannot generate hashcode from empty ctor")
+	}
+
+	codepath, err := getCodePath(spec)
+	if err != nil {
+		return "", err
+	}
+
+	hash := util.GenerateHashFromSignature(codepath, ctor.Function, ctor.Args)
+
+	hash, err = hashFilesInDir(codepath, chaincodePackageDir, hash, tw)
+	if err != nil {
+		return "", fmt.Errorf("Could not get hashcode for %s - %s", codepath, err)
+	}
+
+	return hex.EncodeToString(hash[:]), nil
+}
@@ -0,0 +1,104 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package node
+
+import (
+	"archive/tar"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/spf13/viper"
+
+	cutil "github.com/hyperledger/fabric/core/container/util"
+	pb "github.com/hyperledger/fabric/protos"
+)
+
+// shimPackageDir is the directory of the shim in the package
+const shimPackageDir = "fabric-shim"
+
+// shimFiles are the files of the shim, relative to core/chaincode/shim/node in
+// the fabric sources
+var shimFiles = []string{
+	"package.json",
+	"lib/chaincode.js",
+	"lib/handler.js",
+	"lib/stub.js",
+	"lib/protos/google/protobuf/timestamp.proto",
+}
+
+// shimProtos are the protos the shim loads, copied from the fabric protos
+var shimProtos = []string{"chaincode.proto", "chaincodeevent.proto"}
+
+// getFabricPath returns the fabric sources, under the first element of GOPATH
+func getFabricPath() string {
+	gopath := filepath.SplitList(os.Getenv("GOPATH"))[0]
+	return filepath.Join(gopath, "src", "github.com", "hyperledger", "fabric")
+}
+
+// writeShim writes the shim the peer was built with to the package, so that
+// the chaincode runs the protocol of the peer
+func writeShim(tw *tar.Writer) error {
+	fabricPath := getFabricPath()
+	shimPath := filepath.Join(fabricPath, "core", "chaincode", "shim", "node")
+	for _, file := range shimFiles {
+		if err := cutil.WriteFileToPackage(filepath.Join(shimPath, file), shimPackageDir+"/"+file, tw); err != nil {
+			return fmt.Errorf("Error writing the shim to the package: %s", err)
+		}
+	}
+	for _, file := range shimProtos {
+		if err := cutil.WriteFileToPackage(filepath.Join(fabricPath, "protos", file), shimPackageDir+"/lib/protos/"+file, tw); err != nil {
+			return fmt.Errorf("Error writing the shim protos to the package: %s", err)
+		}
+	}
+	return nil
+}
+
+//tw is expected to have the chaincode in it from generateHashcode. This method
+//will package the shim, and the dockerfile installing the shim and the
+//dependencies of the chaincode
+func writeChaincodePackage(spec *pb.ChaincodeSpec, tw *tar.Writer) error {
+	newRunLine := fmt.Sprintf("COPY %s /root/%s\n"+
+		"COPY %s /root/%s\n"+
+		"RUN cd /root/%s && npm install /root/%s && npm install --production",
+		shimPackageDir, shimPackageDir, chaincodePackageDir, chaincodePackageDir, chaincodePackageDir, shimPackageDir)
+
+	//the chaincode connects to the peer with the TLS certificate of the peer, copied
+	//in the container where the peer tells the chaincode to find it
+	if viper.GetBool("peer.tls.enabled") {
+		newRunLine = fmt.Sprintf("%s\nCOPY certs/cert.pem %s", newRunLine, viper.GetString("peer.tls.cert.file"))
+	}
+
+	dockerFileContents := fmt.Sprintf("%s\n%s", viper.GetString("chaincode.node.Dockerfile"), newRunLine)
+	dockerFileSize := int64(len([]byte(dockerFileContents)))
+
+	//Make headers identical by using zero time
+	var zeroTime time.Time
+	tw.WriteHeader(&tar.Header{Name: "Dockerfile", Size: dockerFileSize, ModTime: zeroTime, AccessTime: zeroTime, ChangeTime: zeroTime})
+	tw.Write([]byte(dockerFileContents))
+
+	if err := writeShim(tw); err != nil {
+		return err
+	}
+
+	if viper.GetBool("peer.tls.enabled") {
+		if err := cutil.WriteFileToPackage(viper.GetString("peer.tls.cert.file"), "certs/cert.pem", tw); err != nil {
+			return fmt.Errorf("Error writing the peer TLS certificate to the package: %s", err)
+		}
+	}
+	return nil
+}
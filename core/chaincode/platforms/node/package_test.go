@@ -0,0 +1,79 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package node
+
+import (
+	"archive/tar"
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+
+	pb "github.com/hyperledger/fabric/protos"
+)
+
+func TestWritePackage(t *testing.T) {
+	platform := &Platform{}
+	spec := &pb.ChaincodeSpec{Type: pb.ChaincodeSpec_NODE, ChaincodeID: &pb.ChaincodeID{Path: "../../shim/node/example/map"}, CtorMsg: &pb.ChaincodeInput{Function: "init"}}
+	if err := platform.ValidateSpec(spec); err != nil {
+		t.Fatalf("Error validating the spec: %s", err)
+	}
+
+	buf := &bytes.Buffer{}
+	tw := tar.NewWriter(buf)
+	if err := platform.WritePackage(spec, tw); err != nil {
+		t.Fatalf("Error writing the package: %s", err)
+	}
+	tw.Close()
+	if spec.ChaincodeID.Name == "" {
+		t.Fatalf("Expected the name of the chaincode to be set")
+	}
+
+	files := make(map[string]string)
+	tr := tar.NewReader(buf)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			t.Fatalf("Error reading the package: %s", err)
+		}
+		content := &bytes.Buffer{}
+		io.Copy(content, tr)
+		files[header.Name] = content.String()
+	}
+	for _, name := range []string{"chaincode/index.js", "chaincode/package.json", "fabric-shim/lib/handler.js", "fabric-shim/lib/protos/chaincode.proto", "fabric-shim/lib/protos/google/protobuf/timestamp.proto"} {
+		if _, ok := files[name]; !ok {
+			t.Errorf("Expected %s in the package", name)
+		}
+	}
+	if !strings.Contains(files["Dockerfile"], "npm install /root/fabric-shim") {
+		t.Errorf("Expected the Dockerfile to install the shim, got %s", files["Dockerfile"])
+	}
+
+	// the name only depends on the chaincode and its constructor
+	spec2 := &pb.ChaincodeSpec{Type: pb.ChaincodeSpec_NODE, ChaincodeID: &pb.ChaincodeID{Path: "../../shim/node/example/map"}, CtorMsg: &pb.ChaincodeInput{Function: "init"}}
+	if err := platform.WritePackage(spec2, tar.NewWriter(&bytes.Buffer{})); err != nil || spec2.ChaincodeID.Name != spec.ChaincodeID.Name {
+		t.Errorf("Expected the same chaincode to get the same name")
+	}
+}
+
+func TestValidateSpec(t *testing.T) {
+	spec := &pb.ChaincodeSpec{Type: pb.ChaincodeSpec_NODE, ChaincodeID: &pb.ChaincodeID{Path: "../../shim/node/lib"}}
+	if err := (&Platform{}).ValidateSpec(spec); err == nil {
+		t.Errorf("Expected a directory without package.json to be refused")
+	}
+}
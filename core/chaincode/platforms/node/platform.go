@@ -0,0 +1,59 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package node
+
+import (
+	"archive/tar"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	pb "github.com/hyperledger/fabric/protos"
+)
+
+// Platform for chaincodes written in Node.js
+type Platform struct {
+}
+
+// ValidateSpec validates Node.js chaincodes: the path must be a local
+// directory holding the package.json of the chaincode
+func (nodePlatform *Platform) ValidateSpec(spec *pb.ChaincodeSpec) error {
+	codepath, err := getCodePath(spec)
+	if err != nil {
+		return err
+	}
+	if _, err = os.Stat(filepath.Join(codepath, "package.json")); err != nil {
+		return fmt.Errorf("Path to chaincode is not a Node.js package: %s", err)
+	}
+	return nil
+}
+
+// WritePackage writes the Node.js chaincode package
+func (nodePlatform *Platform) WritePackage(spec *pb.ChaincodeSpec, tw *tar.Writer) error {
+
+	var err error
+	spec.ChaincodeID.Name, err = generateHashcode(spec, tw)
+	if err != nil {
+		return err
+	}
+
+	err = writeChaincodePackage(spec, tw)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
@@ -0,0 +1,91 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package chaincode
+
+import (
+	"time"
+
+	pb "github.com/hyperledger/fabric/protos"
+)
+
+// A running chaincode whose stream with the peer ends, for example after a
+// transient network failure, may reconnect and register again. For
+// chaincode.resumetimeout the peer keeps a placeholder handler in its place,
+// and a REGISTER received meanwhile resumes the chaincode straight into the
+// ready state, without launching a new container or calling Init again.
+// Transactions for the chaincode wait for it to resume. When the timeout
+// expires the placeholder is removed and the next transaction launches the
+// chaincode afresh.
+
+//call this under lock
+func (chaincodeSupport *ChaincodeSupport) preResumeSetup(chaincodehandler *Handler) bool {
+	if chaincodeSupport.resumeTimeout <= 0 || !chaincodehandler.isRunning() {
+		return false
+	}
+	key := chaincodehandler.ChaincodeID.Name
+	placeholder := &Handler{ChaincodeID: chaincodehandler.ChaincodeID, deployTXSecContext: chaincodehandler.deployTXSecContext, resuming: make(chan struct{})}
+	chaincodeSupport.runningChaincodes.chaincodeMap[key] = &chaincodeRTEnv{handler: placeholder}
+	go chaincodeSupport.expireResume(key, placeholder)
+	return true
+}
+
+// expireResume removes the placeholder of a chaincode that did not resume in time
+func (chaincodeSupport *ChaincodeSupport) expireResume(chaincode string, placeholder *Handler) {
+	time.Sleep(chaincodeSupport.resumeTimeout)
+	chaincodeSupport.runningChaincodes.Lock()
+	defer chaincodeSupport.runningChaincodes.Unlock()
+	if chrte, ok := chaincodeSupport.chaincodeHasBeenLaunched(chaincode); ok && chrte.handler == placeholder {
+		chaincodeLogger.Warningf("chaincode %s did not resume within %s", chaincode, chaincodeSupport.resumeTimeout)
+		delete(chaincodeSupport.runningChaincodes.chaincodeMap, chaincode)
+		placeholder.resumeDone()
+	}
+}
+
+// waitForResume waits, up to chaincode.resumetimeout, for the chaincode to
+// resume if it is disconnected. It returns at once otherwise.
+func (chaincodeSupport *ChaincodeSupport) waitForResume(chaincode string) {
+	var resuming chan struct{}
+	chaincodeSupport.runningChaincodes.RLock()
+	if chrte, ok := chaincodeSupport.chaincodeHasBeenLaunched(chaincode); ok {
+		resuming = chrte.handler.resuming
+	}
+	chaincodeSupport.runningChaincodes.RUnlock()
+	if resuming == nil {
+		return
+	}
+	chaincodeLogger.Debugf("waiting for chaincode %s to resume", chaincode)
+	select {
+	case <-resuming:
+	case <-time.After(chaincodeSupport.resumeTimeout):
+	}
+}
+
+// resumeDone releases the transactions waiting for the chaincode to resume
+func (handler *Handler) resumeDone() {
+	handler.Lock()
+	defer handler.Unlock()
+	if handler.resuming != nil && !handler.resumed {
+		close(handler.resuming)
+		handler.resumed = true
+	}
+}
+
+// resume moves a resumed chaincode to the ready state, as sending READY to a
+// launched chaincode would
+func (handler *Handler) resume() {
+	chaincodeLogger.Infof("chaincode %s resumed, sending %s", handler.ChaincodeID.Name, pb.ChaincodeMessage_READY)
+	handler.triggerNextState(&pb.ChaincodeMessage{Type: pb.ChaincodeMessage_READY}, true)
+}
@@ -20,6 +20,7 @@ package shim
 
 import (
 	"bytes"
+	"encoding/json"
 	"errors"
 	"flag"
 	"fmt"
@@ -27,6 +28,8 @@ import (
 	"os"
 	"strconv"
 	"strings"
+	"time"
+	"unicode/utf8"
 
 	gp "google/protobuf"
 
@@ -68,12 +71,34 @@ type Chaincode interface {
 type ChaincodeStub struct {
 	UUID            string
 	securityContext *pb.ChaincodeSecurityContext
-	chaincodeEvent  *pb.ChaincodeEvent
+	chaincodeEvents []*pb.ChaincodeEvent
 }
 
 // Peer address derived from command line or env var
 var peerAddress string
 
+// Keepalive period of the peer, and time the chaincode has to reconnect to
+// the peer after its stream broke. Both are given by the peer in the env.
+var keepalive, resumeTimeout time.Duration
+
+const (
+	// keepalive periods without a message after which the stream is considered broken
+	keepaliveTolerance = 3
+	// bounds of the delay between two attempts to reconnect
+	reconnectBackoffMin = 500 * time.Millisecond
+	reconnectBackoffMax = 5 * time.Second
+)
+
+// disconnectError is returned by chatWithPeer when the stream with the peer
+// broke, as opposed to the chaincode failing to handle a message.
+type disconnectError struct {
+	err error
+}
+
+func (d *disconnectError) Error() string {
+	return fmt.Sprintf("Disconnected from peer: %s", d.err)
+}
+
 // Start is the entry point for chaincodes bootstrap. It is not an API for
 // chaincodes.
 func Start(cc Chaincode) error {
@@ -89,33 +114,83 @@ func Start(cc Chaincode) error {
 	replacer := strings.NewReplacer(".", "_")
 	viper.SetEnvKeyReplacer(replacer)
 
+	if viper.GetBool("chaincode.shim.statecache") {
+		shimStateCache = true
+	}
+
+	keepalive = time.Duration(viper.GetInt("chaincode.keepalive")) * time.Second
+	resumeTimeout = time.Duration(viper.GetInt("chaincode.resumetimeout")) * time.Second
+
 	flag.StringVar(&peerAddress, "peer.address", "", "peer address")
 
 	flag.Parse()
 
 	chaincodeLogger.Debugf("Peer address: %s", getPeerAddress())
 
-	// Establish connection with validating peer
+	chaincodeLogger.Debugf("os.Args returns: %s", os.Args)
+
+	// Establish connection and stream with validating peer
+	clientConn, stream, err := connectToPeer()
+	if err != nil {
+		return err
+	}
+
+	chaincodename := viper.GetString("chaincode.id.name")
+	var deadline time.Time
+	for {
+		err = chatWithPeer(chaincodename, stream, cc)
+		clientConn.Close()
+		if _, ok := err.(*disconnectError); !ok || resumeTimeout <= 0 {
+			return err
+		}
+		// The peer waits resumeTimeout for a registered chaincode to come
+		// back. Failed attempts to register again do not extend that time.
+		if handler.FSM.Current() != "created" {
+			deadline = time.Now().Add(resumeTimeout)
+		}
+		chaincodeLogger.Warningf("%s, reconnecting", err)
+		if clientConn, stream, err = reconnectToPeer(deadline); err != nil {
+			return err
+		}
+	}
+}
+
+// connectToPeer establishes a connection and a stream with the peer.
+func connectToPeer() (*grpc.ClientConn, PeerChaincodeStream, error) {
 	clientConn, err := newPeerClientConnection()
 	if err != nil {
 		chaincodeLogger.Errorf("Error trying to connect to local peer: %s", err)
-		return fmt.Errorf("Error trying to connect to local peer: %s", err)
+		return nil, nil, fmt.Errorf("Error trying to connect to local peer: %s", err)
 	}
 
-	chaincodeLogger.Debugf("os.Args returns: %s", os.Args)
-
 	chaincodeSupportClient := pb.NewChaincodeSupportClient(clientConn)
 
-	// Establish stream with validating peer
 	stream, err := chaincodeSupportClient.Register(context.Background())
 	if err != nil {
-		return fmt.Errorf("Error chatting with leader at address=%s:  %s", getPeerAddress(), err)
+		clientConn.Close()
+		return nil, nil, fmt.Errorf("Error chatting with leader at address=%s:  %s", getPeerAddress(), err)
 	}
+	return clientConn, stream, nil
+}
 
-	chaincodename := viper.GetString("chaincode.id.name")
-	err = chatWithPeer(chaincodename, stream, cc)
-
-	return err
+// reconnectToPeer tries to connect to the peer again, with a growing delay
+// between attempts, until the deadline.
+func reconnectToPeer(deadline time.Time) (*grpc.ClientConn, PeerChaincodeStream, error) {
+	backoff := reconnectBackoffMin
+	for {
+		clientConn, stream, err := connectToPeer()
+		if err == nil {
+			return clientConn, stream, nil
+		}
+		if time.Now().Add(backoff).After(deadline) {
+			return nil, nil, fmt.Errorf("Could not reconnect to peer in time: %s", err)
+		}
+		chaincodeLogger.Debugf("Reconnecting failed, retrying in %s: %s", backoff, err)
+		time.Sleep(backoff)
+		if backoff *= 2; backoff > reconnectBackoffMax {
+			backoff = reconnectBackoffMax
+		}
+	}
 }
 
 // StartInProc is an entry point for system chaincodes bootstrap. It is not an
@@ -179,10 +254,12 @@ func chatWithPeer(chaincodename string, stream PeerChaincodeStream, cc Chaincode
 	waitc := make(chan struct{})
 	go func() {
 		defer close(waitc)
-		msgAvail := make(chan *pb.ChaincodeMessage)
+		//buffered so that a Recv left pending when the stream breaks does not block
+		msgAvail := make(chan *pb.ChaincodeMessage, 1)
 		var nsInfo *nextStateInfo
 		var in *pb.ChaincodeMessage
 		recv := true
+		lastRecv := time.Now()
 		for {
 			in = nil
 			err = nil
@@ -195,13 +272,20 @@ func chatWithPeer(chaincodename string, stream PeerChaincodeStream, cc Chaincode
 					msgAvail <- in2
 				}()
 			}
+			//the peer sends KEEPALIVE when idle, so a silent peer means a broken stream
+			var keepaliveTimer <-chan time.Time
+			if keepalive > 0 {
+				keepaliveTimer = time.After(keepalive)
+			}
 			select {
 			case in = <-msgAvail:
 				if err == io.EOF {
 					chaincodeLogger.Debugf("Received EOF, ending chaincode stream, %s", err)
+					err = &disconnectError{err}
 					return
 				} else if err != nil {
 					chaincodeLogger.Errorf("Received error from server: %s, ending chaincode stream", err)
+					err = &disconnectError{err}
 					return
 				} else if in == nil {
 					err = fmt.Errorf("Received nil message, ending chaincode stream")
@@ -210,6 +294,14 @@ func chatWithPeer(chaincodename string, stream PeerChaincodeStream, cc Chaincode
 				}
 				chaincodeLogger.Debugf("[%s]Received message %s from shim", shortuuid(in.Uuid), in.Type.String())
 				recv = true
+				lastRecv = time.Now()
+			case <-keepaliveTimer:
+				if silence := time.Since(lastRecv); silence > keepaliveTolerance*keepalive {
+					chaincodeLogger.Errorf("No message from peer for %s, ending chaincode stream", silence)
+					err = &disconnectError{fmt.Errorf("no message for %s", silence)}
+					return
+				}
+				continue
 			case nsInfo = <-handler.nextState:
 				in = nsInfo.msg
 				if in == nil {
@@ -275,6 +367,13 @@ func (stub *ChaincodeStub) GetState(key string) ([]byte, error) {
 	return handler.handleGetState(key, stub.UUID)
 }
 
+// GetStateAtBlock returns the byte array value the `key` had once the block
+// `blockNumber` was committed. It can only be called by queries, for the last
+// ledger.state.historyQueryBlocks blocks the validator is configured to keep.
+func (stub *ChaincodeStub) GetStateAtBlock(key string, blockNumber uint64) ([]byte, error) {
+	return handler.handleGetStateAtBlock(key, blockNumber, stub.UUID)
+}
+
 // PutState writes the specified `value` and `key` into the ledger.
 func (stub *ChaincodeStub) PutState(key string, value []byte) error {
 	return handler.handlePutState(key, value, stub.UUID)
@@ -285,6 +384,64 @@ func (stub *ChaincodeStub) DelState(key string) error {
 	return handler.handleDelState(key, stub.UUID)
 }
 
+// GetPrivateData returns the private data of the `key` in `collection`. The
+// private data of a chaincode is kept by the validator out of the state: it is
+// neither part of the state hash nor synced to other peers.
+func (stub *ChaincodeStub) GetPrivateData(collection string, key string) ([]byte, error) {
+	return handler.handleGetPrivateData(collection, key, stub.UUID)
+}
+
+// PutPrivateData writes the specified `value` of the `key` in `collection`
+// into the private data of the chaincode.
+func (stub *ChaincodeStub) PutPrivateData(collection string, key string, value []byte) error {
+	return handler.handlePutPrivateData(collection, key, value, stub.UUID)
+}
+
+// DelPrivateData removes the `key` in `collection` from the private data of
+// the chaincode.
+func (stub *ChaincodeStub) DelPrivateData(collection string, key string) error {
+	return handler.handleDelPrivateData(collection, key, stub.UUID)
+}
+
+// NamespaceAccess is the access a chaincode grants another to its state
+type NamespaceAccess int32
+
+const (
+	// NoAccess revokes the access granted before
+	NoAccess = NamespaceAccess(pb.NamespaceAccess_NO_ACCESS)
+	// ReadAccess allows to read the state
+	ReadAccess = NamespaceAccess(pb.NamespaceAccess_READ)
+	// ReadWriteAccess allows to read and change the state
+	ReadWriteAccess = NamespaceAccess(pb.NamespaceAccess_READ_WRITE)
+)
+
+// GetNamespaceState returns the value of the `key` of the state of the
+// chaincode `namespace`, which must have granted the read access to this
+// chaincode. The validator refuses it otherwise.
+func (stub *ChaincodeStub) GetNamespaceState(namespace string, key string) ([]byte, error) {
+	return handler.handleGetNamespaceState(namespace, key, stub.UUID)
+}
+
+// PutNamespaceState writes the specified `value` of the `key` into the state
+// of the chaincode `namespace`, which must have granted the write access to
+// this chaincode.
+func (stub *ChaincodeStub) PutNamespaceState(namespace string, key string, value []byte) error {
+	return handler.handlePutNamespaceState(namespace, key, value, stub.UUID)
+}
+
+// DelNamespaceState removes the `key` from the state of the chaincode
+// `namespace`, which must have granted the write access to this chaincode.
+func (stub *ChaincodeStub) DelNamespaceState(namespace string, key string) error {
+	return handler.handleDelNamespaceState(namespace, key, stub.UUID)
+}
+
+// GrantNamespaceAccess grants the chaincode `grantee` the `access` to the
+// state of this chaincode, NoAccess revoking the access granted before. The
+// grant is part of the state, it is discarded if the transaction fails.
+func (stub *ChaincodeStub) GrantNamespaceAccess(grantee string, access NamespaceAccess) error {
+	return handler.handleGrantNamespaceAccess(grantee, pb.NamespaceAccess(access), stub.UUID)
+}
+
 //ReadCertAttribute is used to read an specific attribute from the transaction certificate, *attributeName* is passed as input parameter to this function.
 // Example:
 //  attrValue,error:=stub.ReadCertAttribute("position")
@@ -333,13 +490,30 @@ type StateRangeQueryIterator struct {
 // between the startKey and endKey, inclusive. The order in which keys are
 // returned by the iterator is random.
 func (stub *ChaincodeStub) RangeQueryState(startKey, endKey string) (*StateRangeQueryIterator, error) {
-	response, err := handler.handleRangeQueryState(startKey, endKey, stub.UUID)
+	response, err := handler.handleRangeQueryState(startKey, endKey, 0, "", stub.UUID)
 	if err != nil {
 		return nil, err
 	}
 	return &StateRangeQueryIterator{handler, stub.UUID, response, 0}, nil
 }
 
+// RangeQueryStatePage reads a page of at most pageSize keys of a range of
+// the committed state, in the order of RangeQueryState. The page starts after
+// the page bookmark was returned with, or at startKey if bookmark is empty;
+// the bookmark returned is empty once the range is exhausted. As no iterator
+// is kept open between the pages, each can be read by a different
+// invocation. The validator may return fewer keys than pageSize.
+func (stub *ChaincodeStub) RangeQueryStatePage(startKey, endKey string, pageSize int32, bookmark string) (*StateRangeQueryIterator, string, error) {
+	if pageSize <= 0 {
+		return nil, "", errors.New("Page size must be greater than 0")
+	}
+	response, err := handler.handleRangeQueryState(startKey, endKey, pageSize, bookmark, stub.UUID)
+	if err != nil {
+		return nil, "", err
+	}
+	return &StateRangeQueryIterator{handler, stub.UUID, response, 0}, response.Bookmark, nil
+}
+
 // HasNext returns true if the range query iterator contains additional keys
 // and values.
 func (iter *StateRangeQueryIterator) HasNext() bool {
@@ -380,6 +554,148 @@ func (iter *StateRangeQueryIterator) Close() error {
 	return err
 }
 
+// INDEX FUNCTIONALITY
+
+// indexKeyPrefix starts the keys of the state defining the indexes of the
+// chaincode, as read by the validators which keep the indexes
+const indexKeyPrefix = "\x00index\x00"
+
+// CreateIndex defines an index on a field of the values of the state, which
+// must be JSON objects. The field is the name of a member, or a path of names
+// separated by dots for nested objects. Numbers, strings and booleans are
+// indexed, other values and the keys whose value misses the field are left
+// out. The index is defined by a key of the state, which range queries also
+// return, and is built on the validators enabling ledger.state.indexes.
+func (stub *ChaincodeStub) CreateIndex(name string, field string) error {
+	if err := validateIndexName(name); err != nil {
+		return err
+	}
+	if field == "" {
+		return errors.New("Indexed field must not be empty")
+	}
+	return stub.PutState(indexKeyPrefix+name, []byte(field))
+}
+
+// DeleteIndex deletes an index defined with CreateIndex.
+func (stub *ChaincodeStub) DeleteIndex(name string) error {
+	if err := validateIndexName(name); err != nil {
+		return err
+	}
+	return stub.DelState(indexKeyPrefix + name)
+}
+
+// QueryIndex returns an iterator over the keys whose value has the field of
+// the index between start and end, inclusive, in the order of the field.
+// The bounds are marshalled to JSON, a nil bound leaving the range open on
+// its side; pass the same value as both bounds to look up a value. Indexes
+// can only be queried by queries, from the committed state.
+func (stub *ChaincodeStub) QueryIndex(name string, start, end interface{}) (*StateRangeQueryIterator, error) {
+	var startBytes, endBytes []byte
+	var err error
+	if start != nil {
+		if startBytes, err = json.Marshal(start); err != nil {
+			return nil, err
+		}
+	}
+	if end != nil {
+		if endBytes, err = json.Marshal(end); err != nil {
+			return nil, err
+		}
+	}
+	response, err := handler.handleQueryIndex(name, startBytes, endBytes, stub.UUID)
+	if err != nil {
+		return nil, err
+	}
+	return &StateRangeQueryIterator{handler, stub.UUID, response, 0}, nil
+}
+
+func validateIndexName(name string) error {
+	if name == "" {
+		return errors.New("Index name must not be empty")
+	}
+	if strings.IndexByte(name, 0) >= 0 {
+		return errors.New("Index name must not contain a zero byte")
+	}
+	return nil
+}
+
+// COMPOSITE KEY FUNCTIONALITY
+
+// compositeKeyNamespace starts the composite keys of the state, keeping them
+// apart from the other keys of the chaincode and from the index definitions
+const compositeKeyNamespace = "\x00composite\x00"
+
+// maxCompositeKeyRune ends the range of the keys starting with a partial
+// composite key, as the attributes cannot contain it
+const maxCompositeKeyRune = utf8.MaxRune
+
+// CreateCompositeKey combines an object type and the values of its
+// attributes into a key of the state. The keys of an object type sort by
+// their attributes, in order, so that GetStateByPartialCompositeKey can read
+// the objects sharing the values of their first attributes. The object type
+// must not be empty, and neither it nor the attributes may contain a zero
+// byte, the rune U+10FFFF or invalid UTF-8.
+func (stub *ChaincodeStub) CreateCompositeKey(objectType string, attributes []string) (string, error) {
+	return createCompositeKey(objectType, attributes)
+}
+
+// SplitCompositeKey returns the object type and the attributes a key was
+// created from by CreateCompositeKey.
+func (stub *ChaincodeStub) SplitCompositeKey(compositeKey string) (string, []string, error) {
+	return splitCompositeKey(compositeKey)
+}
+
+// GetStateByPartialCompositeKey returns an iterator over the keys of an
+// object type whose first attributes are the given ones, as
+// RangeQueryState does. All the keys of the object type are returned when
+// no attribute is given.
+func (stub *ChaincodeStub) GetStateByPartialCompositeKey(objectType string, attributes []string) (*StateRangeQueryIterator, error) {
+	partialCompositeKey, err := createCompositeKey(objectType, attributes)
+	if err != nil {
+		return nil, err
+	}
+	return stub.RangeQueryState(partialCompositeKey, partialCompositeKey+string(maxCompositeKeyRune))
+}
+
+func createCompositeKey(objectType string, attributes []string) (string, error) {
+	if objectType == "" {
+		return "", errors.New("Composite key object type must not be empty")
+	}
+	if err := validateCompositeKeyAttribute(objectType); err != nil {
+		return "", err
+	}
+	var keyBuffer bytes.Buffer
+	keyBuffer.WriteString(compositeKeyNamespace)
+	keyBuffer.WriteString(objectType)
+	keyBuffer.WriteByte(0)
+	for _, attribute := range attributes {
+		if err := validateCompositeKeyAttribute(attribute); err != nil {
+			return "", err
+		}
+		keyBuffer.WriteString(attribute)
+		keyBuffer.WriteByte(0)
+	}
+	return keyBuffer.String(), nil
+}
+
+func splitCompositeKey(compositeKey string) (string, []string, error) {
+	if !strings.HasPrefix(compositeKey, compositeKeyNamespace) || !strings.HasSuffix(compositeKey, "\x00") {
+		return "", nil, fmt.Errorf("Key [%q] is not a composite key", compositeKey)
+	}
+	components := strings.Split(compositeKey[len(compositeKeyNamespace):len(compositeKey)-1], "\x00")
+	return components[0], components[1:], nil
+}
+
+func validateCompositeKeyAttribute(attribute string) error {
+	if !utf8.ValidString(attribute) {
+		return fmt.Errorf("Composite key attribute [%q] is not valid UTF-8", attribute)
+	}
+	if strings.IndexByte(attribute, 0) >= 0 || strings.IndexRune(attribute, maxCompositeKeyRune) >= 0 {
+		return fmt.Errorf("Composite key attribute [%q] must not contain a zero byte or U+10FFFF", attribute)
+	}
+	return nil
+}
+
 // TABLE FUNCTIONALITY
 // TODO More comments here with documentation
 
@@ -839,12 +1155,79 @@ func (stub *ChaincodeStub) insertRowInternal(tableName string, row Row, update b
 
 // ------------- ChaincodeEvent API ----------------------
 
-// SetEvent saves the event to be sent when a transaction is made part of a block
+// SetEvent saves the event to be sent when a transaction is made part of a block. A transaction may emit several
+// events of different names, setting an event of a name set before replaces it
 func (stub *ChaincodeStub) SetEvent(name string, payload []byte) error {
-	stub.chaincodeEvent = &pb.ChaincodeEvent{EventName: name, Payload: payload}
+	return stub.SetEventWithAttributes(name, payload)
+}
+
+// SetEventWithAttributes is SetEvent for an event with attributes, made with StringAttribute, IntAttribute and
+// BoolAttribute. The ledger indexes the indexed attributes, and event hub consumers may register for the events with
+// given attributes
+func (stub *ChaincodeStub) SetEventWithAttributes(name string, payload []byte, attributes ...*pb.EventAttribute) error {
+	if name == "" {
+		return errors.New("Event name must not be an empty string")
+	}
+	names := make(map[string]bool)
+	for _, attribute := range attributes {
+		if attribute.Name == "" || names[attribute.Name] {
+			return fmt.Errorf("Attributes of event %s must have distinct non-empty names", name)
+		}
+		names[attribute.Name] = true
+	}
+
+	event := &pb.ChaincodeEvent{EventName: name, Payload: payload, Attributes: attributes}
+	for i, e := range stub.chaincodeEvents {
+		if e.EventName == name {
+			stub.chaincodeEvents[i] = event
+			return nil
+		}
+	}
+	stub.chaincodeEvents = append(stub.chaincodeEvents, event)
 	return nil
 }
 
+// firstEvent returns the first event set, which peers only reading one event of a transaction read
+func (stub *ChaincodeStub) firstEvent() *pb.ChaincodeEvent {
+	if len(stub.chaincodeEvents) == 0 {
+		return nil
+	}
+	return stub.chaincodeEvents[0]
+}
+
+// StringAttribute returns a string event attribute, indexed by the ledger if indexed is true
+func StringAttribute(name string, value string, indexed bool) *pb.EventAttribute {
+	return &pb.EventAttribute{Name: name, Type: pb.EventAttribute_STRING, Value: value, Indexed: indexed}
+}
+
+// IntAttribute returns an integer event attribute, indexed by the ledger if indexed is true
+func IntAttribute(name string, value int64, indexed bool) *pb.EventAttribute {
+	return &pb.EventAttribute{Name: name, Type: pb.EventAttribute_INTEGER, Value: strconv.FormatInt(value, 10), Indexed: indexed}
+}
+
+// BoolAttribute returns a boolean event attribute, indexed by the ledger if indexed is true
+func BoolAttribute(name string, value bool, indexed bool) *pb.EventAttribute {
+	return &pb.EventAttribute{Name: name, Type: pb.EventAttribute_BOOLEAN, Value: strconv.FormatBool(value), Indexed: indexed}
+}
+
+// ------------- State Cache Control ---------------
+
+// The shim can cache, for the duration of a transaction or query, the values
+// of the keys the chaincode read or wrote, so that reading a key again does
+// not round trip to the validating peer. Writes are still sent to the peer
+// immediately. The cache is dropped when the transaction completes and after
+// every InvokeChaincode, as the called chaincode may have changed our state.
+// It is disabled by default and enabled with the SetStateCache() API, or by
+// the peer through the CORE_CHAINCODE_SHIM_STATECACHE environment variable.
+
+var shimStateCache = false
+
+// SetStateCache allows a Go language chaincode to enable or disable the
+// state cache of its shim. It must be called before Start().
+func SetStateCache(enabled bool) {
+	shimStateCache = enabled
+}
+
 // ------------- Logging Control and Chaincode Loggers ---------------
 
 // As independent programs, Go language chaincodes can use any logging
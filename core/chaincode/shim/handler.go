@@ -57,6 +57,8 @@ type Handler struct {
 	// Track which UUIDs are transactions and which are queries, to decide whether get/put state and invoke chaincode are allowed.
 	isTransaction map[string]bool
 	nextState     chan *nextStateInfo
+	// stateCache serves repeated reads of a key within a transaction, nil when the cache is disabled.
+	stateCache *stateCache
 }
 
 func shortuuid(uuid string) string {
@@ -148,6 +150,9 @@ func newChaincodeHandler(peerChatStream PeerChaincodeStream, chaincode Chaincode
 	v.responseChannel = make(map[string]chan pb.ChaincodeMessage)
 	v.isTransaction = make(map[string]bool)
 	v.nextState = make(chan *nextStateInfo)
+	if shimStateCache {
+		v.stateCache = newStateCache()
+	}
 
 	// Create the shim side FSM
 	v.FSM = fsm.NewFSM(
@@ -172,7 +177,7 @@ func newChaincodeHandler(peerChatStream PeerChaincodeStream, chaincode Chaincode
 			//"after_" + pb.ChaincodeMessage_INIT.String(): func(e *fsm.Event) { v.beforeInit(e) },
 			//"after_" + pb.ChaincodeMessage_TRANSACTION.String(): func(e *fsm.Event) { v.beforeTransaction(e) },
 			"after_" + pb.ChaincodeMessage_RESPONSE.String(): func(e *fsm.Event) { v.afterResponse(e) },
-			"after_" + pb.ChaincodeMessage_ERROR.String():    func(e *fsm.Event) { v.afterError(e) },
+			"before_" + pb.ChaincodeMessage_ERROR.String():   func(e *fsm.Event) { v.beforeError(e) },
 			"enter_init":                                     func(e *fsm.Event) { v.enterInitState(e) },
 			"enter_transaction":                              func(e *fsm.Event) { v.enterTransactionState(e) },
 			//"enter_ready":                                     func(e *fsm.Event) { v.enterReadyState(e) },
@@ -225,19 +230,20 @@ func (handler *Handler) handleInit(msg *pb.ChaincodeMessage) {
 		stub.init(msg.Uuid, msg.SecurityContext)
 		res, err := handler.cc.Init(stub, input.Function, input.Args)
 
-		// delete isTransaction entry
+		// delete isTransaction entry and the values cached for the transaction
 		handler.deleteIsTransaction(msg.Uuid)
+		handler.stateCache.invalidate(msg.Uuid)
 
 		if err != nil {
 			payload := []byte(err.Error())
 			// Send ERROR message to chaincode support and change state
 			chaincodeLogger.Errorf("[%s]Init failed. Sending %s", shortuuid(msg.Uuid), pb.ChaincodeMessage_ERROR)
-			nextStateMsg = &pb.ChaincodeMessage{Type: pb.ChaincodeMessage_ERROR, Payload: payload, Uuid: msg.Uuid, ChaincodeEvent: stub.chaincodeEvent}
+			nextStateMsg = &pb.ChaincodeMessage{Type: pb.ChaincodeMessage_ERROR, Payload: payload, Uuid: msg.Uuid, ChaincodeEvent: stub.firstEvent(), ChaincodeEvents: stub.chaincodeEvents}
 			return
 		}
 
 		// Send COMPLETED message to chaincode support and change state
-		nextStateMsg = &pb.ChaincodeMessage{Type: pb.ChaincodeMessage_COMPLETED, Payload: res, Uuid: msg.Uuid, ChaincodeEvent: stub.chaincodeEvent}
+		nextStateMsg = &pb.ChaincodeMessage{Type: pb.ChaincodeMessage_COMPLETED, Payload: res, Uuid: msg.Uuid, ChaincodeEvent: stub.firstEvent(), ChaincodeEvents: stub.chaincodeEvents}
 		chaincodeLogger.Debugf("[%s]Init succeeded. Sending %s", shortuuid(msg.Uuid), pb.ChaincodeMessage_COMPLETED)
 	}()
 }
@@ -292,20 +298,21 @@ func (handler *Handler) handleTransaction(msg *pb.ChaincodeMessage) {
 		stub.init(msg.Uuid, msg.SecurityContext)
 		res, err := handler.cc.Invoke(stub, input.Function, input.Args)
 
-		// delete isTransaction entry
+		// delete isTransaction entry and the values cached for the transaction
 		handler.deleteIsTransaction(msg.Uuid)
+		handler.stateCache.invalidate(msg.Uuid)
 
 		if err != nil {
 			payload := []byte(err.Error())
 			// Send ERROR message to chaincode support and change state
 			chaincodeLogger.Errorf("[%s]Transaction execution failed. Sending %s", shortuuid(msg.Uuid), pb.ChaincodeMessage_ERROR)
-			nextStateMsg = &pb.ChaincodeMessage{Type: pb.ChaincodeMessage_ERROR, Payload: payload, Uuid: msg.Uuid, ChaincodeEvent: stub.chaincodeEvent}
+			nextStateMsg = &pb.ChaincodeMessage{Type: pb.ChaincodeMessage_ERROR, Payload: payload, Uuid: msg.Uuid, ChaincodeEvent: stub.firstEvent(), ChaincodeEvents: stub.chaincodeEvents}
 			return
 		}
 
 		// Send COMPLETED message to chaincode support and change state
 		chaincodeLogger.Debugf("[%s]Transaction completed. Sending %s", shortuuid(msg.Uuid), pb.ChaincodeMessage_COMPLETED)
-		nextStateMsg = &pb.ChaincodeMessage{Type: pb.ChaincodeMessage_COMPLETED, Payload: res, Uuid: msg.Uuid, ChaincodeEvent: stub.chaincodeEvent}
+		nextStateMsg = &pb.ChaincodeMessage{Type: pb.ChaincodeMessage_COMPLETED, Payload: res, Uuid: msg.Uuid, ChaincodeEvent: stub.firstEvent(), ChaincodeEvents: stub.chaincodeEvents}
 	}()
 }
 
@@ -339,8 +346,9 @@ func (handler *Handler) handleQuery(msg *pb.ChaincodeMessage) {
 		stub.init(msg.Uuid, msg.SecurityContext)
 		res, err := handler.cc.Query(stub, input.Function, input.Args)
 
-		// delete isTransaction entry
+		// delete isTransaction entry and the values cached for the transaction
 		handler.deleteIsTransaction(msg.Uuid)
+		handler.stateCache.invalidate(msg.Uuid)
 
 		if err != nil {
 			payload := []byte(err.Error())
@@ -413,7 +421,7 @@ func (handler *Handler) afterResponse(e *fsm.Event) {
 	}
 }
 
-func (handler *Handler) afterError(e *fsm.Event) {
+func (handler *Handler) beforeError(e *fsm.Event) {
 	msg, ok := e.Args[0].(*pb.ChaincodeMessage)
 	if !ok {
 		e.Cancel(fmt.Errorf("Received unexpected message type"))
@@ -424,15 +432,23 @@ func (handler *Handler) afterError(e *fsm.Event) {
 	 * There are two situations in which the ERROR event can be triggered:
 	 * 1. When an error is encountered within handleInit or handleTransaction - some issue at the chaincode side; In this case there will be no responseChannel and the message has been sent to the validator.
 	 * 2. The chaincode has initiated a request (get/put/del state) to the validator and is expecting a response on the responseChannel; If ERROR is received from validator, this needs to be notified on the responseChannel.
+	 * In the second situation the chaincode gets the error from its request and goes on with the transaction, which the ERROR then does not end.
 	 */
 	if err := handler.sendChannel(msg); err == nil {
 		chaincodeLogger.Debugf("[%s]Error received from validator %s, communicated(state:%s)", shortuuid(msg.Uuid), msg.Type, handler.FSM.Current())
+		e.Cancel()
 	}
 }
 
 // TODO: Implement method to get and put entire state map and not one key at a time?
 // handleGetState communicates with the validator to fetch the requested state information from the ledger.
 func (handler *Handler) handleGetState(key string, uuid string) ([]byte, error) {
+	// Serve the key from the values already read or written by the transaction, if cached
+	if value, ok := handler.stateCache.get(uuid, key); ok {
+		chaincodeLogger.Debugf("[%s]GetState served key %s from the state cache", shortuuid(uuid), key)
+		return value, nil
+	}
+
 	// Create the channel on which to communicate the response from validating peer
 	respChan, uniqueReqErr := handler.createChannel(uuid)
 	if uniqueReqErr != nil {
@@ -461,6 +477,7 @@ func (handler *Handler) handleGetState(key string, uuid string) ([]byte, error)
 	if responseMsg.Type.String() == pb.ChaincodeMessage_RESPONSE.String() {
 		// Success response
 		chaincodeLogger.Debugf("[%s]GetState received payload %s", shortuuid(responseMsg.Uuid), pb.ChaincodeMessage_RESPONSE)
+		handler.stateCache.put(uuid, key, responseMsg.Payload)
 		return responseMsg.Payload, nil
 	}
 	if responseMsg.Type.String() == pb.ChaincodeMessage_ERROR.String() {
@@ -474,6 +491,53 @@ func (handler *Handler) handleGetState(key string, uuid string) ([]byte, error)
 	return nil, errors.New("Incorrect chaincode message received")
 }
 
+// handleGetStateAtBlock communicates with the validator to fetch the value a key had once a block was committed.
+func (handler *Handler) handleGetStateAtBlock(key string, blockNumber uint64, uuid string) ([]byte, error) {
+	// Create the channel on which to communicate the response from validating peer
+	respChan, uniqueReqErr := handler.createChannel(uuid)
+	if uniqueReqErr != nil {
+		chaincodeLogger.Debug("Another state request pending for this Uuid. Cannot process.")
+		return nil, uniqueReqErr
+	}
+
+	defer handler.deleteChannel(uuid)
+
+	// Send GET_STATE_AT_BLOCK message to validator chaincode support
+	payload := &pb.GetStateAtBlock{Key: key, BlockNumber: blockNumber}
+	payloadBytes, err := proto.Marshal(payload)
+	if err != nil {
+		return nil, errors.New("Failed to process get state at block request")
+	}
+	msg := &pb.ChaincodeMessage{Type: pb.ChaincodeMessage_GET_STATE_AT_BLOCK, Payload: payloadBytes, Uuid: uuid}
+	chaincodeLogger.Debugf("[%s]Sending %s", shortuuid(msg.Uuid), pb.ChaincodeMessage_GET_STATE_AT_BLOCK)
+	if err := handler.serialSend(msg); err != nil {
+		chaincodeLogger.Errorf("[%s]error sending GET_STATE_AT_BLOCK %s", shortuuid(uuid), err)
+		return nil, errors.New("could not send msg")
+	}
+
+	// Wait on responseChannel for response
+	responseMsg, ok := handler.receiveChannel(respChan)
+	if !ok {
+		chaincodeLogger.Errorf("[%s]Received unexpected message type", shortuuid(responseMsg.Uuid))
+		return nil, errors.New("Received unexpected message type")
+	}
+
+	if responseMsg.Type.String() == pb.ChaincodeMessage_RESPONSE.String() {
+		// Success response
+		chaincodeLogger.Debugf("[%s]GetStateAtBlock received payload %s", shortuuid(responseMsg.Uuid), pb.ChaincodeMessage_RESPONSE)
+		return responseMsg.Payload, nil
+	}
+	if responseMsg.Type.String() == pb.ChaincodeMessage_ERROR.String() {
+		// Error response
+		chaincodeLogger.Errorf("[%s]GetStateAtBlock received error %s", shortuuid(responseMsg.Uuid), pb.ChaincodeMessage_ERROR)
+		return nil, errors.New(string(responseMsg.Payload[:]))
+	}
+
+	// Incorrect chaincode message received
+	chaincodeLogger.Errorf("[%s]Incorrect chaincode message %s received. Expecting %s or %s", shortuuid(responseMsg.Uuid), responseMsg.Type, pb.ChaincodeMessage_RESPONSE, pb.ChaincodeMessage_ERROR)
+	return nil, errors.New("Incorrect chaincode message received")
+}
+
 // handlePutState communicates with the validator to put state information into the ledger.
 func (handler *Handler) handlePutState(key string, value []byte, uuid string) error {
 	// Check if this is a transaction
@@ -515,6 +579,7 @@ func (handler *Handler) handlePutState(key string, value []byte, uuid string) er
 	if responseMsg.Type.String() == pb.ChaincodeMessage_RESPONSE.String() {
 		// Success response
 		chaincodeLogger.Debugf("[%s]Received %s. Successfully updated state", shortuuid(responseMsg.Uuid), pb.ChaincodeMessage_RESPONSE)
+		handler.stateCache.put(uuid, key, value)
 		return nil
 	}
 
@@ -564,6 +629,7 @@ func (handler *Handler) handleDelState(key string, uuid string) error {
 	if responseMsg.Type.String() == pb.ChaincodeMessage_RESPONSE.String() {
 		// Success response
 		chaincodeLogger.Debugf("[%s]Received %s. Successfully deleted state", msg.Uuid, pb.ChaincodeMessage_RESPONSE)
+		handler.stateCache.put(uuid, key, nil)
 		return nil
 	}
 	if responseMsg.Type.String() == pb.ChaincodeMessage_ERROR.String() {
@@ -577,7 +643,230 @@ func (handler *Handler) handleDelState(key string, uuid string) error {
 	return errors.New("Incorrect chaincode message received")
 }
 
-func (handler *Handler) handleRangeQueryState(startKey, endKey string, uuid string) (*pb.RangeQueryStateResponse, error) {
+// handleGetPrivateData communicates with the validator to fetch the private data of a key in a collection.
+func (handler *Handler) handleGetPrivateData(collection string, key string, uuid string) ([]byte, error) {
+	// Create the channel on which to communicate the response from validating peer
+	respChan, uniqueReqErr := handler.createChannel(uuid)
+	if uniqueReqErr != nil {
+		chaincodeLogger.Debug("Another state request pending for this Uuid. Cannot process.")
+		return nil, uniqueReqErr
+	}
+
+	defer handler.deleteChannel(uuid)
+
+	// Send GET_PRIVATE_DATA message to validator chaincode support
+	payload := &pb.PrivateDataInfo{Collection: collection, Key: key}
+	payloadBytes, err := proto.Marshal(payload)
+	if err != nil {
+		return nil, errors.New("Failed to process get private data request")
+	}
+	msg := &pb.ChaincodeMessage{Type: pb.ChaincodeMessage_GET_PRIVATE_DATA, Payload: payloadBytes, Uuid: uuid}
+	chaincodeLogger.Debugf("[%s]Sending %s", shortuuid(msg.Uuid), pb.ChaincodeMessage_GET_PRIVATE_DATA)
+	if err := handler.serialSend(msg); err != nil {
+		chaincodeLogger.Errorf("[%s]error sending GET_PRIVATE_DATA %s", shortuuid(uuid), err)
+		return nil, errors.New("could not send msg")
+	}
+
+	// Wait on responseChannel for response
+	responseMsg, ok := handler.receiveChannel(respChan)
+	if !ok {
+		chaincodeLogger.Errorf("[%s]Received unexpected message type", shortuuid(responseMsg.Uuid))
+		return nil, errors.New("Received unexpected message type")
+	}
+
+	if responseMsg.Type.String() == pb.ChaincodeMessage_RESPONSE.String() {
+		// Success response
+		chaincodeLogger.Debugf("[%s]GetPrivateData received payload %s", shortuuid(responseMsg.Uuid), pb.ChaincodeMessage_RESPONSE)
+		return responseMsg.Payload, nil
+	}
+	if responseMsg.Type.String() == pb.ChaincodeMessage_ERROR.String() {
+		// Error response
+		chaincodeLogger.Errorf("[%s]GetPrivateData received error %s", shortuuid(responseMsg.Uuid), pb.ChaincodeMessage_ERROR)
+		return nil, errors.New(string(responseMsg.Payload[:]))
+	}
+
+	// Incorrect chaincode message received
+	chaincodeLogger.Errorf("[%s]Incorrect chaincode message %s received. Expecting %s or %s", shortuuid(responseMsg.Uuid), responseMsg.Type, pb.ChaincodeMessage_RESPONSE, pb.ChaincodeMessage_ERROR)
+	return nil, errors.New("Incorrect chaincode message received")
+}
+
+// handlePutPrivateData communicates with the validator to put the private data of a key in a collection.
+func (handler *Handler) handlePutPrivateData(collection string, key string, value []byte, uuid string) error {
+	return handler.handleWritePrivateData(pb.ChaincodeMessage_PUT_PRIVATE_DATA, &pb.PrivateDataInfo{Collection: collection, Key: key, Value: value}, uuid)
+}
+
+// handleDelPrivateData communicates with the validator to delete the private data of a key in a collection.
+func (handler *Handler) handleDelPrivateData(collection string, key string, uuid string) error {
+	return handler.handleWritePrivateData(pb.ChaincodeMessage_DEL_PRIVATE_DATA, &pb.PrivateDataInfo{Collection: collection, Key: key}, uuid)
+}
+
+func (handler *Handler) handleWritePrivateData(msgType pb.ChaincodeMessage_Type, payload *pb.PrivateDataInfo, uuid string) error {
+	// Check if this is a transaction
+	if !handler.isTransaction[uuid] {
+		return errors.New("Cannot write private data in query context")
+	}
+
+	payloadBytes, err := proto.Marshal(payload)
+	if err != nil {
+		return errors.New("Failed to process private data request")
+	}
+
+	// Create the channel on which to communicate the response from validating peer
+	respChan, uniqueReqErr := handler.createChannel(uuid)
+	if uniqueReqErr != nil {
+		chaincodeLogger.Errorf("[%s]Another state request pending for this Uuid. Cannot process.", shortuuid(uuid))
+		return uniqueReqErr
+	}
+
+	defer handler.deleteChannel(uuid)
+
+	// Send PUT_PRIVATE_DATA or DEL_PRIVATE_DATA message to validator chaincode support
+	msg := &pb.ChaincodeMessage{Type: msgType, Payload: payloadBytes, Uuid: uuid}
+	chaincodeLogger.Debugf("[%s]Sending %s", shortuuid(msg.Uuid), msgType)
+	if err = handler.serialSend(msg); err != nil {
+		chaincodeLogger.Errorf("[%s]error sending %s %s", shortuuid(msg.Uuid), msgType, err)
+		return errors.New("could not send msg")
+	}
+
+	// Wait on responseChannel for response
+	responseMsg, ok := handler.receiveChannel(respChan)
+	if !ok {
+		chaincodeLogger.Errorf("[%s]Received unexpected message type", shortuuid(msg.Uuid))
+		return errors.New("Received unexpected message type")
+	}
+
+	if responseMsg.Type.String() == pb.ChaincodeMessage_RESPONSE.String() {
+		// Success response
+		chaincodeLogger.Debugf("[%s]Received %s. Successfully updated private data", shortuuid(responseMsg.Uuid), pb.ChaincodeMessage_RESPONSE)
+		return nil
+	}
+	if responseMsg.Type.String() == pb.ChaincodeMessage_ERROR.String() {
+		// Error response
+		chaincodeLogger.Errorf("[%s]Received %s. Payload: %s", shortuuid(responseMsg.Uuid), pb.ChaincodeMessage_ERROR, responseMsg.Payload)
+		return errors.New(string(responseMsg.Payload[:]))
+	}
+
+	// Incorrect chaincode message received
+	chaincodeLogger.Errorf("[%s]Incorrect chaincode message %s received. Expecting %s or %s", shortuuid(responseMsg.Uuid), responseMsg.Type, pb.ChaincodeMessage_RESPONSE, pb.ChaincodeMessage_ERROR)
+	return errors.New("Incorrect chaincode message received")
+}
+
+// handleGetNamespaceState communicates with the validator to fetch the state of a key of another chaincode.
+func (handler *Handler) handleGetNamespaceState(namespace string, key string, uuid string) ([]byte, error) {
+	// Create the channel on which to communicate the response from validating peer
+	respChan, uniqueReqErr := handler.createChannel(uuid)
+	if uniqueReqErr != nil {
+		chaincodeLogger.Debug("Another state request pending for this Uuid. Cannot process.")
+		return nil, uniqueReqErr
+	}
+
+	defer handler.deleteChannel(uuid)
+
+	// Send GET_NAMESPACE_STATE message to validator chaincode support
+	payload := &pb.NamespaceStateInfo{Namespace: namespace, Key: key}
+	payloadBytes, err := proto.Marshal(payload)
+	if err != nil {
+		return nil, errors.New("Failed to process get namespace state request")
+	}
+	msg := &pb.ChaincodeMessage{Type: pb.ChaincodeMessage_GET_NAMESPACE_STATE, Payload: payloadBytes, Uuid: uuid}
+	chaincodeLogger.Debugf("[%s]Sending %s", shortuuid(msg.Uuid), pb.ChaincodeMessage_GET_NAMESPACE_STATE)
+	if err := handler.serialSend(msg); err != nil {
+		chaincodeLogger.Errorf("[%s]error sending GET_NAMESPACE_STATE %s", shortuuid(uuid), err)
+		return nil, errors.New("could not send msg")
+	}
+
+	// Wait on responseChannel for response
+	responseMsg, ok := handler.receiveChannel(respChan)
+	if !ok {
+		chaincodeLogger.Errorf("[%s]Received unexpected message type", shortuuid(uuid))
+		return nil, errors.New("Received unexpected message type")
+	}
+
+	if responseMsg.Type.String() == pb.ChaincodeMessage_RESPONSE.String() {
+		// Success response
+		chaincodeLogger.Debugf("[%s]GetNamespaceState received payload %s", shortuuid(responseMsg.Uuid), pb.ChaincodeMessage_RESPONSE)
+		return responseMsg.Payload, nil
+	}
+	if responseMsg.Type.String() == pb.ChaincodeMessage_ERROR.String() {
+		// Error response
+		chaincodeLogger.Errorf("[%s]GetNamespaceState received error %s", shortuuid(responseMsg.Uuid), pb.ChaincodeMessage_ERROR)
+		return nil, errors.New(string(responseMsg.Payload[:]))
+	}
+
+	// Incorrect chaincode message received
+	chaincodeLogger.Errorf("[%s]Incorrect chaincode message %s received. Expecting %s or %s", shortuuid(responseMsg.Uuid), responseMsg.Type, pb.ChaincodeMessage_RESPONSE, pb.ChaincodeMessage_ERROR)
+	return nil, errors.New("Incorrect chaincode message received")
+}
+
+// handlePutNamespaceState communicates with the validator to put the state of a key of another chaincode.
+func (handler *Handler) handlePutNamespaceState(namespace string, key string, value []byte, uuid string) error {
+	return handler.handleWriteNamespaceState(pb.ChaincodeMessage_PUT_NAMESPACE_STATE, &pb.NamespaceStateInfo{Namespace: namespace, Key: key, Value: value}, uuid)
+}
+
+// handleDelNamespaceState communicates with the validator to delete the state of a key of another chaincode.
+func (handler *Handler) handleDelNamespaceState(namespace string, key string, uuid string) error {
+	return handler.handleWriteNamespaceState(pb.ChaincodeMessage_DEL_NAMESPACE_STATE, &pb.NamespaceStateInfo{Namespace: namespace, Key: key}, uuid)
+}
+
+// handleGrantNamespaceAccess communicates with the validator to grant another chaincode the access to the state.
+func (handler *Handler) handleGrantNamespaceAccess(grantee string, access pb.NamespaceAccess, uuid string) error {
+	return handler.handleWriteNamespaceState(pb.ChaincodeMessage_GRANT_NAMESPACE_ACCESS, &pb.NamespaceAccessGrant{Grantee: grantee, Access: access}, uuid)
+}
+
+func (handler *Handler) handleWriteNamespaceState(msgType pb.ChaincodeMessage_Type, payload proto.Message, uuid string) error {
+	// Check if this is a transaction
+	if !handler.isTransaction[uuid] {
+		return fmt.Errorf("Cannot handle %s in query context", msgType)
+	}
+
+	payloadBytes, err := proto.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("Failed to process %s request", msgType)
+	}
+
+	// Create the channel on which to communicate the response from validating peer
+	respChan, uniqueReqErr := handler.createChannel(uuid)
+	if uniqueReqErr != nil {
+		chaincodeLogger.Errorf("[%s]Another state request pending for this Uuid. Cannot process.", shortuuid(uuid))
+		return uniqueReqErr
+	}
+
+	defer handler.deleteChannel(uuid)
+
+	// Send PUT_NAMESPACE_STATE, DEL_NAMESPACE_STATE or GRANT_NAMESPACE_ACCESS message to validator chaincode support
+	msg := &pb.ChaincodeMessage{Type: msgType, Payload: payloadBytes, Uuid: uuid}
+	chaincodeLogger.Debugf("[%s]Sending %s", shortuuid(msg.Uuid), msgType)
+	if err = handler.serialSend(msg); err != nil {
+		chaincodeLogger.Errorf("[%s]error sending %s %s", shortuuid(msg.Uuid), msgType, err)
+		return errors.New("could not send msg")
+	}
+
+	// Wait on responseChannel for response
+	responseMsg, ok := handler.receiveChannel(respChan)
+	if !ok {
+		chaincodeLogger.Errorf("[%s]Received unexpected message type", shortuuid(msg.Uuid))
+		return errors.New("Received unexpected message type")
+	}
+
+	if responseMsg.Type.String() == pb.ChaincodeMessage_RESPONSE.String() {
+		// Success response
+		chaincodeLogger.Debugf("[%s]Received %s. Successfully handled %s", shortuuid(responseMsg.Uuid), pb.ChaincodeMessage_RESPONSE, msgType)
+		// The namespace written may be our own, so the cached values no longer hold
+		handler.stateCache.invalidate(uuid)
+		return nil
+	}
+	if responseMsg.Type.String() == pb.ChaincodeMessage_ERROR.String() {
+		// Error response
+		chaincodeLogger.Errorf("[%s]Received %s. Payload: %s", shortuuid(responseMsg.Uuid), pb.ChaincodeMessage_ERROR, responseMsg.Payload)
+		return errors.New(string(responseMsg.Payload[:]))
+	}
+
+	// Incorrect chaincode message received
+	chaincodeLogger.Errorf("[%s]Incorrect chaincode message %s received. Expecting %s or %s", shortuuid(responseMsg.Uuid), responseMsg.Type, pb.ChaincodeMessage_RESPONSE, pb.ChaincodeMessage_ERROR)
+	return errors.New("Incorrect chaincode message received")
+}
+
+func (handler *Handler) handleRangeQueryState(startKey, endKey string, pageSize int32, bookmark string, uuid string) (*pb.RangeQueryStateResponse, error) {
 	// Create the channel on which to communicate the response from validating peer
 	respChan, uniqueReqErr := handler.createChannel(uuid)
 	if uniqueReqErr != nil {
@@ -588,7 +877,7 @@ func (handler *Handler) handleRangeQueryState(startKey, endKey string, uuid stri
 	defer handler.deleteChannel(uuid)
 
 	// Send RANGE_QUERY_STATE message to validator chaincode support
-	payload := &pb.RangeQueryState{StartKey: startKey, EndKey: endKey}
+	payload := &pb.RangeQueryState{StartKey: startKey, EndKey: endKey, PageSize: pageSize, Bookmark: bookmark}
 	payloadBytes, err := proto.Marshal(payload)
 	if err != nil {
 		return nil, errors.New("Failed to process range query state request")
@@ -631,6 +920,60 @@ func (handler *Handler) handleRangeQueryState(startKey, endKey string, uuid stri
 	return nil, errors.New("Incorrect chaincode message received")
 }
 
+func (handler *Handler) handleQueryIndex(index string, start, end []byte, uuid string) (*pb.RangeQueryStateResponse, error) {
+	// Create the channel on which to communicate the response from validating peer
+	respChan, uniqueReqErr := handler.createChannel(uuid)
+	if uniqueReqErr != nil {
+		chaincodeLogger.Debugf("[%s]Another state request pending for this Uuid. Cannot process.", shortuuid(uuid))
+		return nil, uniqueReqErr
+	}
+
+	defer handler.deleteChannel(uuid)
+
+	// Send QUERY_INDEX message to validator chaincode support
+	payload := &pb.QueryIndex{Index: index, Start: start, End: end}
+	payloadBytes, err := proto.Marshal(payload)
+	if err != nil {
+		return nil, errors.New("Failed to process query index request")
+	}
+	msg := &pb.ChaincodeMessage{Type: pb.ChaincodeMessage_QUERY_INDEX, Payload: payloadBytes, Uuid: uuid}
+	chaincodeLogger.Debugf("[%s]Sending %s", shortuuid(msg.Uuid), pb.ChaincodeMessage_QUERY_INDEX)
+	if err = handler.serialSend(msg); err != nil {
+		chaincodeLogger.Errorf("[%s]error sending %s", shortuuid(msg.Uuid), pb.ChaincodeMessage_QUERY_INDEX)
+		return nil, errors.New("could not send msg")
+	}
+
+	// Wait on responseChannel for response
+	responseMsg, ok := handler.receiveChannel(respChan)
+	if !ok {
+		chaincodeLogger.Errorf("[%s]Received unexpected message type", uuid)
+		return nil, errors.New("Received unexpected message type")
+	}
+
+	if responseMsg.Type.String() == pb.ChaincodeMessage_RESPONSE.String() {
+		// Success response
+		chaincodeLogger.Debugf("[%s]Received %s. Successfully queried index", shortuuid(responseMsg.Uuid), pb.ChaincodeMessage_RESPONSE)
+
+		rangeQueryResponse := &pb.RangeQueryStateResponse{}
+		unmarshalErr := proto.Unmarshal(responseMsg.Payload, rangeQueryResponse)
+		if unmarshalErr != nil {
+			chaincodeLogger.Errorf("[%s]unmarshall error", shortuuid(responseMsg.Uuid))
+			return nil, errors.New("Error unmarshalling RangeQueryStateResponse.")
+		}
+
+		return rangeQueryResponse, nil
+	}
+	if responseMsg.Type.String() == pb.ChaincodeMessage_ERROR.String() {
+		// Error response
+		chaincodeLogger.Errorf("[%s]Received %s", shortuuid(responseMsg.Uuid), pb.ChaincodeMessage_ERROR)
+		return nil, errors.New(string(responseMsg.Payload[:]))
+	}
+
+	// Incorrect chaincode message received
+	chaincodeLogger.Errorf("Incorrect chaincode message %s recieved. Expecting %s or %s", responseMsg.Type, pb.ChaincodeMessage_RESPONSE, pb.ChaincodeMessage_ERROR)
+	return nil, errors.New("Incorrect chaincode message received")
+}
+
 func (handler *Handler) handleRangeQueryStateNext(id, uuid string) (*pb.RangeQueryStateResponse, error) {
 	// Create the channel on which to communicate the response from validating peer
 	respChan, uniqueReqErr := handler.createChannel(uuid)
@@ -773,6 +1116,8 @@ func (handler *Handler) handleInvokeChaincode(chaincodeName string, function str
 
 	// Wait on responseChannel for response
 	responseMsg, ok := handler.receiveChannel(respChan)
+	// The called chaincode may have written our state through a namespace grant
+	handler.stateCache.invalidate(uuid)
 	if !ok {
 		chaincodeLogger.Errorf("[%s]Received unexpected message type", shortuuid(msg.Uuid))
 		return nil, errors.New("Received unexpected message type")
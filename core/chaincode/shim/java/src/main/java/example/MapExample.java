@@ -16,6 +16,10 @@ limitations under the License.
 
 package example;
 
+import java.util.Map;
+
+import com.google.protobuf.ByteString;
+
 import org.hyperledger.java.shim.ChaincodeBase;
 import org.hyperledger.java.shim.ChaincodeStub;
 
@@ -33,19 +37,20 @@ public class MapExample extends ChaincodeBase {
 				stub.delState(arg);
 			break;
 		}
+		stub.setEvent(function, ByteString.copyFromUtf8(String.join(",", args)));
 		return null;
 	}
 
 	@Override
 	public String query(ChaincodeStub stub, String function, String[] args) {
-//		if ("range".equals(function)) {
-//			String build = "";
-//			HashMap<String, String> range = stub.rangeQueryState(args[0], args[1], 10);
-//			for (String s : range.keySet()) {
-//				build += s + ":" + range.get(s) + " ";
-//			}
-//			return build;
-//		}
+		if ("range".equals(function)) {
+			String build = "";
+			Map<String, String> range = stub.rangeQueryState(args[0], args[1]);
+			for (String s : range.keySet()) {
+				build += s + ":" + range.get(s) + " ";
+			}
+			return build;
+		}
 		return stub.getState(args[0]);
 	}
 
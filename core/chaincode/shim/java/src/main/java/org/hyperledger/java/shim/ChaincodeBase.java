@@ -96,13 +96,16 @@ public abstract class ChaincodeBase {
 
 	public ManagedChannel newPeerClientConnection() {
 		NettyChannelBuilder builder = NettyChannelBuilder.forAddress(host, port);
-		//TODO security
-		if (false) {//"true".equals(params.get("peer.tls.enabled"))) {
+		// The peer passes its TLS settings in the environment of the chaincode container
+		if ("true".equals(System.getenv("CORE_PEER_TLS_ENABLED"))) {
 			try {
 				SslContext sslContext = GrpcSslContexts.forClient().trustManager(
-						new File("pathToServerCertPemFile")).keyManager(new File("pathToOwnCertPemFile"),
-								new File("pathToOwnPrivateKeyPemFile")).build();
+						new File(System.getenv("CORE_PEER_TLS_CERT_FILE"))).build();
 				builder.negotiationType(NegotiationType.TLS);
+				String hostOverride = System.getenv("CORE_PEER_TLS_SERVERHOSTOVERRIDE");
+				if (hostOverride != null && !hostOverride.isEmpty()) {
+					builder.overrideAuthority(hostOverride);
+				}
 				builder.sslContext(sslContext);
 			} catch (SSLException e) {
 				logger.error("failed connect to peer with SSLException",e);
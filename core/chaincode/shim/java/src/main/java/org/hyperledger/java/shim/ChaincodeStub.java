@@ -16,12 +16,20 @@ limitations under the License.
 
 package org.hyperledger.java.shim;
 
+import java.util.LinkedHashMap;
+import java.util.Map;
+
 import com.google.protobuf.ByteString;
 
+import protos.Chaincode.RangeQueryStateKeyValue;
+import protos.Chaincode.RangeQueryStateResponse;
+import protos.Chaincodeevent.ChaincodeEvent;
+
 public class ChaincodeStub {
 
 	private final String uuid;
 	private final Handler handler;
+	private ChaincodeEvent chaincodeEvent;
 
 	public ChaincodeStub(String uuid, Handler handler) {
 		this.uuid = uuid;
@@ -63,20 +71,39 @@ public class ChaincodeStub {
 	}
 
 	/**
-	 * 
-	 * @param startKey
-	 * @param endKey
-	 * @param limit
-	 * @return
+	 * Gets the states of the keys between startKey and endKey from the ledger, as strings
+	 * @param startKey first key of the range
+	 * @param endKey last key of the range
+	 * @return the String values of the keys of the range, in the order of the keys
 	 */
-//	public HashMap<String, String> rangeQueryState(String startKey, String endKey, int limit) {
-//		HashMap<String, String> map = new HashMap<>();
-//		for (RangeQueryStateKeyValue mapping : handler.handleRangeQueryState(
-//				startKey, endKey, limit, uuid).getKeysAndValuesList()) {
-//			map.put(mapping.getKey(), mapping.getValue().toStringUtf8());
-//		}
-//		return map;
-//	}
+	public Map<String, String> rangeQueryState(String startKey, String endKey) {
+		Map<String, String> map = new LinkedHashMap<>();
+		for (Map.Entry<String, ByteString> entry : rangeQueryRawState(startKey, endKey).entrySet()) {
+			map.put(entry.getKey(), entry.getValue().toStringUtf8());
+		}
+		return map;
+	}
+
+	/**
+	 * Sets the event the transaction emits once it is made part of a block.
+	 * A later call replaces the event set before
+	 * @param name name of the event
+	 * @param payload payload of the event
+	 */
+	public void setEvent(String name, ByteString payload) {
+		chaincodeEvent = ChaincodeEvent.newBuilder()
+				.setEventName(name)
+				.setPayload(payload)
+				.build();
+	}
+
+	/**
+	 * Gets the event set by the chaincode
+	 * @return the event to emit, or null if none was set
+	 */
+	public ChaincodeEvent getEvent() {
+		return chaincodeEvent;
+	}
 
 	/**
 	 * 
@@ -121,15 +148,25 @@ public class ChaincodeStub {
 	}
 
 	/**
-	 * 
-	 * @param startKey
-	 * @param endKey
-	 * @param limit
-	 * @return
+	 * Gets the raw states of the keys between startKey and endKey from the ledger,
+	 * fetching the results from the validating peer as many times as needed
+	 * @param startKey first key of the range
+	 * @param endKey last key of the range
+	 * @return the values of the keys of the range, in the order of the keys
 	 */
-//	public RangeQueryStateResponse rangeQueryRawState(String startKey, String endKey, int limit) {
-//		return handler.handleRangeQueryState(startKey, endKey, limit, uuid);
-//	}
+	public Map<String, ByteString> rangeQueryRawState(String startKey, String endKey) {
+		Map<String, ByteString> map = new LinkedHashMap<>();
+		RangeQueryStateResponse response = handler.handleRangeQueryState(startKey, endKey, uuid);
+		while (true) {
+			for (RangeQueryStateKeyValue mapping : response.getKeysAndValuesList()) {
+				map.put(mapping.getKey(), mapping.getValue());
+			}
+			if (!response.getHasMore()) {
+				return map;
+			}
+			response = handler.handleRangeQueryStateNext(response.getID(), uuid);
+		}
+	}
 
 	/**
 	 * 
@@ -34,6 +34,7 @@ import static protos.Chaincode.ChaincodeMessage.Type.QUERY;
 import static protos.Chaincode.ChaincodeMessage.Type.QUERY_COMPLETED;
 import static protos.Chaincode.ChaincodeMessage.Type.QUERY_ERROR;
 import static protos.Chaincode.ChaincodeMessage.Type.RANGE_QUERY_STATE;
+import static protos.Chaincode.ChaincodeMessage.Type.RANGE_QUERY_STATE_NEXT;
 import static protos.Chaincode.ChaincodeMessage.Type.READY;
 import static protos.Chaincode.ChaincodeMessage.Type.REGISTERED;
 import static protos.Chaincode.ChaincodeMessage.Type.RESPONSE;
@@ -61,6 +62,9 @@ import protos.Chaincode.ChaincodeMessage;
 import protos.Chaincode.ChaincodeMessage.Builder;
 import protos.Chaincode.ChaincodeSpec;
 import protos.Chaincode.PutStateInfo;
+import protos.Chaincode.RangeQueryState;
+import protos.Chaincode.RangeQueryStateNext;
+import protos.Chaincode.RangeQueryStateResponse;
 
 public class Handler {
 
@@ -250,11 +254,12 @@ public class Handler {
 				}
 
 				// Send COMPLETED message to chaincode support and change state
-				nextStatemessage = ChaincodeMessage.newBuilder()
+				Builder builder = ChaincodeMessage.newBuilder()
 						.setType(COMPLETED)
 						.setPayload(result)
-						.setUuid(message.getUuid())
-						.build();
+						.setUuid(message.getUuid());
+				if (stub.getEvent() != null) builder.setChaincodeEvent(stub.getEvent());
+				nextStatemessage = builder.build();
 
 				logger.debug(String.format(String.format("[%s]Init succeeded. Sending %s",
 						shortUUID(message), COMPLETED)));
@@ -352,6 +357,7 @@ public class Handler {
 						.setType(COMPLETED)
 						.setUuid(message.getUuid());
 				if (response != null) builder.setPayload(response);
+				if (stub.getEvent() != null) builder.setChaincodeEvent(stub.getEvent());
 				nextStatemessage = builder.build();
 			} finally {
 				triggerNextState(nextStatemessage, send);
@@ -688,80 +694,90 @@ public class Handler {
 		}
 	}
 
-//	public RangeQueryStateResponse handleRangeQueryState(String startKey, String endKey, int limit, String uuid) {
-//		// Create the channel on which to communicate the response from validating peer
-//		Channel<ChaincodeMessage> responseChannel;
-//		try {
-//			responseChannel = createChannel(uuid);
-//		} catch (Exception e) {
-//			logger.debug(String.format("[%s]Another state request pending for this Uuid."
-//					+ " Cannot process.", shortUUID(uuid)));
-//			throw e;
-//		}
-//
-//		//Defer
-//		try {
-//			// Send RANGE_QUERY_STATE message to validator chaincode support
-//			RangeQueryStateInfo payload = RangeQueryStateInfo.newBuilder()
-//					.setStartKey(startKey)
-//					.setEndKey(endKey)
-//					.setLimit(limit)
-//					.build();
-//
-//			ChaincodeMessage message = ChaincodeMessage.newBuilder()
-//					.setType(RANGE_QUERY_STATE)
-//					.setPayload(payload.toByteString())
-//					.setUuid(uuid)
-//					.build();
-//
-//			logger.debug(String.format("[%s]Sending %s", shortUUID(message), RANGE_QUERY_STATE));
-//			try {
-//				serialSend(message);
-//			} catch (Exception e){
-//				logger.error(String.format("[%s]error sending %s", shortUUID(message), RANGE_QUERY_STATE));
-//				throw new RuntimeException("could not send message");
-//			}
-//
-//			// Wait on responseChannel for response
-//			ChaincodeMessage response;
-//			try {
-//				response = receiveChannel(responseChannel);
-//			} catch (Exception e) {
-//				logger.error(String.format("[%s]Received unexpected message type", uuid));
-//				throw new RuntimeException("Received unexpected message type");		
-//			}
-//
-//			if (response.getType() == RESPONSE) {
-//				// Success response
-//				logger.debug(String.format("[%s]Received %s. Successfully got range",
-//						shortUUID(response.getUuid()), RESPONSE));
-//
-//				RangeQueryStateResponse rangeQueryResponse;
-//				try {
-//					rangeQueryResponse = RangeQueryStateResponse.parseFrom(response.getPayload());
-//				} catch (Exception e) {					
-//					logger.error(String.format("[%s]unmarshall error", shortUUID(response.getUuid())));
-//					throw new RuntimeException("Error unmarshalling RangeQueryStateResponse.");
-//				}
-//
-//				return rangeQueryResponse;
-//			}
-//
-//			if (response.getType() == ERROR) {
-//				// Error response
-//				logger.error(String.format("[%s]Received %s",
-//						shortUUID(response.getUuid()), ERROR));
-//				throw new RuntimeException(response.getPayload().toStringUtf8());
-//			}
-//
-//			// Incorrect chaincode message received
-//			logger.error(String.format("Incorrect chaincode message %s recieved. Expecting %s or %s",
-//					response.getType(), RESPONSE, ERROR));
-//			throw new RuntimeException("Incorrect chaincode message received");
-//		} finally {
-//			deleteChannel(uuid);
-//		}
-//	}
+	// handleRangeQueryState communicates with the validator to open an iterator over the keys between
+	// startKey and endKey, and returns the first results
+	public RangeQueryStateResponse handleRangeQueryState(String startKey, String endKey, String uuid) {
+		RangeQueryState payload = RangeQueryState.newBuilder()
+				.setStartKey(startKey)
+				.setEndKey(endKey)
+				.build();
+		return handleRangeQueryMessage(RANGE_QUERY_STATE, payload.toByteString(), uuid);
+	}
+
+	// handleRangeQueryStateNext communicates with the validator to get the next results of the iterator id.
+	// The validator closes the iterator once it returned the last results
+	public RangeQueryStateResponse handleRangeQueryStateNext(String id, String uuid) {
+		RangeQueryStateNext payload = RangeQueryStateNext.newBuilder()
+				.setID(id)
+				.build();
+		return handleRangeQueryMessage(RANGE_QUERY_STATE_NEXT, payload.toByteString(), uuid);
+	}
+
+	private RangeQueryStateResponse handleRangeQueryMessage(ChaincodeMessage.Type type, ByteString payload, String uuid) {
+		// Create the channel on which to communicate the response from validating peer
+		Channel<ChaincodeMessage> responseChannel;
+		try {
+			responseChannel = createChannel(uuid);
+		} catch (Exception e) {
+			logger.debug(String.format("[%s]Another state request pending for this Uuid."
+					+ " Cannot process.", shortUUID(uuid)));
+			throw e;
+		}
+
+		//Defer
+		try {
+			// Send the range query message to validator chaincode support
+			ChaincodeMessage message = ChaincodeMessage.newBuilder()
+					.setType(type)
+					.setPayload(payload)
+					.setUuid(uuid)
+					.build();
+
+			logger.debug(String.format("[%s]Sending %s", shortUUID(message), type));
+			try {
+				serialSend(message);
+			} catch (Exception e){
+				logger.error(String.format("[%s]error sending %s", shortUUID(message), type));
+				throw new RuntimeException("could not send message");
+			}
+
+			// Wait on responseChannel for response
+			ChaincodeMessage response;
+			try {
+				response = receiveChannel(responseChannel);
+			} catch (Exception e) {
+				logger.error(String.format("[%s]Received unexpected message type", shortUUID(uuid)));
+				throw new RuntimeException("Received unexpected message type");
+			}
+
+			if (response.getType() == RESPONSE) {
+				// Success response
+				logger.debug(String.format("[%s]Received %s. Successfully got range",
+						shortUUID(response.getUuid()), RESPONSE));
+
+				try {
+					return RangeQueryStateResponse.parseFrom(response.getPayload());
+				} catch (Exception e) {
+					logger.error(String.format("[%s]unmarshall error", shortUUID(response.getUuid())));
+					throw new RuntimeException("Error unmarshalling RangeQueryStateResponse.");
+				}
+			}
+
+			if (response.getType() == ERROR) {
+				// Error response
+				logger.error(String.format("[%s]Received %s",
+						shortUUID(response.getUuid()), ERROR));
+				throw new RuntimeException(response.getPayload().toStringUtf8());
+			}
+
+			// Incorrect chaincode message received
+			logger.error(String.format("Incorrect chaincode message %s recieved. Expecting %s or %s",
+					response.getType(), RESPONSE, ERROR));
+			throw new RuntimeException("Incorrect chaincode message received");
+		} finally {
+			deleteChannel(uuid);
+		}
+	}
 
 	public ByteString handleInvokeChaincode(String chaincodeName, String function, String[] args, String uuid) {
 		// Check if this is a transaction
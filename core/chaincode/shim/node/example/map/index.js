@@ -0,0 +1,74 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+'use strict';
+
+// The peer installs the shim in the container of the chaincode
+var shim = require('fabric-shim');
+
+// putAll puts the pairs of keys and values of args one after the other
+function putAll(stub, args, i) {
+	if (i >= args.length) {
+		return Promise.resolve();
+	}
+	return stub.putState(args[i], args[i + 1]).then(function() {
+		return putAll(stub, args, i + 2);
+	});
+}
+
+// delAll deletes the keys of args one after the other
+function delAll(stub, args, i) {
+	if (i >= args.length) {
+		return Promise.resolve();
+	}
+	return stub.delState(args[i]).then(function() {
+		return delAll(stub, args, i + 1);
+	});
+}
+
+// Map keeps a map of keys to values
+var map = {
+	init: function(stub, fcn, args) {
+		return putAll(stub, args, 0);
+	},
+
+	invoke: function(stub, fcn, args) {
+		stub.setEvent(fcn, args.join(','));
+		switch (fcn) {
+		case 'put':
+			return putAll(stub, args, 0);
+		case 'del':
+			return delAll(stub, args, 0);
+		}
+		throw new Error('Unknown function ' + fcn);
+	},
+
+	query: function(stub, fcn, args) {
+		switch (fcn) {
+		case 'get':
+			return stub.getState(args[0]);
+		case 'range':
+			return stub.rangeQueryState(args[0], args[1]).then(function(results) {
+				return results.map(function(kv) {
+					return kv.key + ':' + kv.value.toString();
+				}).join(' ');
+			});
+		}
+		throw new Error('Unknown function ' + fcn);
+	}
+};
+
+shim.start(map);
@@ -0,0 +1,106 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+'use strict';
+
+// Instruct boringssl to use ECC for tls.
+process.env['GRPC_SSL_CIPHER_SUITES'] = 'HIGH+ECDSA';
+
+var debug = require('debug')('shim');
+var fs = require('fs');
+var grpc = require('grpc');
+
+var Handler = require('./handler');
+var ChaincodeStub = require('./stub');
+
+var _chaincodeProto = Handler.chaincodeProto;
+
+var DEFAULT_PEER_ADDRESS = '0.0.0.0:30303';
+
+// getPeerAddress returns the address of the peer, given to the chaincode with
+// the -peer.address flag, the peer.address environment variable, or the default
+function getPeerAddress() {
+	var args = process.argv.slice(2);
+	for (var i = 0; i < args.length; i++) {
+		var match = /^--?peer\.address(?:=(.*))?$/.exec(args[i]);
+		if (match) {
+			return match[1] !== undefined ? match[1] : args[i + 1];
+		}
+	}
+	return process.env.CORE_PEER_ADDRESS || DEFAULT_PEER_ADDRESS;
+}
+
+// getCredentials returns the credentials of the connection to the peer, which
+// passes its TLS settings in the environment of the chaincode container
+function getCredentials() {
+	if (process.env.CORE_PEER_TLS_ENABLED !== 'true') {
+		return { credentials: grpc.credentials.createInsecure(), options: {} };
+	}
+	var options = {};
+	if (process.env.CORE_PEER_TLS_SERVERHOSTOVERRIDE) {
+		options['grpc.ssl_target_name_override'] = process.env.CORE_PEER_TLS_SERVERHOSTOVERRIDE;
+		options['grpc.default_authority'] = process.env.CORE_PEER_TLS_SERVERHOSTOVERRIDE;
+	}
+	var cert = fs.readFileSync(process.env.CORE_PEER_TLS_CERT_FILE);
+	return { credentials: grpc.credentials.createSsl(cert), options: options };
+}
+
+// start connects the chaincode to the peer and registers it, then runs it on
+// the requests of the peer until the stream ends. chaincode implements
+//
+//	init(stub, function, args)
+//	invoke(stub, function, args)
+//	query(stub, function, args)
+//
+// each returning its result, a Buffer or a string, or a promise of it. A
+// thrown error or a rejected promise fails the request
+function start(chaincode) {
+	var chaincodeID = process.env.CORE_CHAINCODE_ID_NAME;
+	if (!chaincodeID) {
+		throw new Error('Error chaincode id must be provided with CORE_CHAINCODE_ID_NAME');
+	}
+	var peerAddress = getPeerAddress();
+	var creds = getCredentials();
+	var client = new _chaincodeProto.ChaincodeSupport(peerAddress, creds.credentials, creds.options);
+
+	var stream = client.register();
+	var handler = new Handler(stream, chaincode);
+	stream.on('data', function(msg) {
+		try {
+			handler.handleMessage(msg);
+		} catch (err) {
+			console.error('Error handling message: %s', err.message);
+			stream.end();
+		}
+	});
+	stream.on('end', function() {
+		debug('Received EOF, ending chaincode stream');
+		process.exit(0);
+	});
+	stream.on('error', function(err) {
+		console.error('Received error from server: %s, ending chaincode stream', err.message);
+		process.exit(1);
+	});
+
+	// Send the ChaincodeID during register.
+	var payload = new _chaincodeProto.ChaincodeID({ name: chaincodeID });
+	debug('Registering with peer %s as %s', peerAddress, chaincodeID);
+	handler.send({ type: _chaincodeProto.ChaincodeMessage.Type.REGISTER, payload: payload.toBuffer() });
+	return handler;
+}
+
+module.exports.start = start;
+module.exports.ChaincodeStub = ChaincodeStub;
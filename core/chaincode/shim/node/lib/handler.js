@@ -0,0 +1,293 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+'use strict';
+
+var debug = require('debug')('shim');
+var grpc = require('grpc');
+
+var ChaincodeStub = require('./stub');
+
+var _chaincodeProto = grpc.load(__dirname + '/protos/chaincode.proto').protos;
+var MsgType = _chaincodeProto.ChaincodeMessage.Type;
+
+// The state machine of the shim side of the chaincode/validator stream, the
+// same as the one of the Go shim: for each state, the messages it accepts and
+// the state each of them leads to
+var transitions = {
+	created: { REGISTERED: 'established' },
+	established: { INIT: 'init', READY: 'ready' },
+	init: { ERROR: 'established', RESPONSE: 'init', COMPLETED: 'ready' },
+	ready: { TRANSACTION: 'transaction', QUERY: 'ready', RESPONSE: 'ready' },
+	transaction: { COMPLETED: 'ready', ERROR: 'ready', RESPONSE: 'transaction', QUERY: 'transaction' }
+};
+
+function msgTypeName(type) {
+	if (typeof type === 'string') {
+		return type;
+	}
+	for (var name in MsgType) {
+		if (MsgType[name] === type) {
+			return name;
+		}
+	}
+	return 'UNDEFINED';
+}
+
+function shortUUID(uuid) {
+	return uuid ? uuid.substring(0, 8) : '';
+}
+
+// Handler handles the shim side of the chaincode/validator stream: it runs the
+// chaincode on the requests of the validator, and sends the requests of the
+// chaincode stubs to the validator. The requests of a stub are answered in the
+// order they are sent, one at a time for a transaction
+function Handler(stream, chaincode) {
+	this.stream = stream;
+	this.chaincode = chaincode;
+	this.state = 'created';
+	// uuid => callbacks waiting for the response of the validator
+	this.pending = {};
+	// uuid => true for a transaction, false for a query
+	this.isTransaction = {};
+}
+
+Handler.prototype.send = function(msg) {
+	debug('[%s]Sending %s', shortUUID(msg.uuid), msgTypeName(msg.type));
+	this.stream.write(msg);
+};
+
+// request sends the message of a stub to the validator and returns a promise of the payload of the RESPONSE
+Handler.prototype.request = function(type, payload, uuid) {
+	var self = this;
+	return new Promise(function(resolve, reject) {
+		if (self.pending[uuid]) {
+			reject(new Error('Another request is pending for this transaction. Cannot process.'));
+			return;
+		}
+		self.pending[uuid] = { resolve: resolve, reject: reject };
+		self.send({ type: type, payload: payload, uuid: uuid });
+	});
+};
+
+// requestMessage is request, decoding the payload of the RESPONSE with the message type given
+Handler.prototype.requestMessage = function(type, payload, uuid, responseType) {
+	return this.request(type, payload, uuid).then(function(response) {
+		return responseType.decode(response);
+	});
+};
+
+Handler.prototype.checkTransaction = function(uuid, operation) {
+	if (!this.isTransaction[uuid]) {
+		return Promise.reject(new Error('Cannot ' + operation + ' in query context'));
+	}
+	return null;
+};
+
+Handler.prototype.handleGetState = function(key, uuid) {
+	return this.request(MsgType.GET_STATE, new Buffer(key), uuid);
+};
+
+Handler.prototype.handlePutState = function(key, value, uuid) {
+	var payload = new _chaincodeProto.PutStateInfo({ key: key, value: value });
+	return this.checkTransaction(uuid, 'put state') || this.request(MsgType.PUT_STATE, payload.toBuffer(), uuid);
+};
+
+Handler.prototype.handleDelState = function(key, uuid) {
+	return this.checkTransaction(uuid, 'del state') || this.request(MsgType.DEL_STATE, new Buffer(key), uuid);
+};
+
+Handler.prototype.handleRangeQueryState = function(startKey, endKey, uuid) {
+	var payload = new _chaincodeProto.RangeQueryState({ startKey: startKey, endKey: endKey });
+	return this.requestMessage(MsgType.RANGE_QUERY_STATE, payload.toBuffer(), uuid, _chaincodeProto.RangeQueryStateResponse);
+};
+
+Handler.prototype.handleRangeQueryStateNext = function(id, uuid) {
+	var payload = new _chaincodeProto.RangeQueryStateNext({ ID: id });
+	return this.requestMessage(MsgType.RANGE_QUERY_STATE_NEXT, payload.toBuffer(), uuid, _chaincodeProto.RangeQueryStateResponse);
+};
+
+Handler.prototype.handleRangeQueryStateClose = function(id, uuid) {
+	var payload = new _chaincodeProto.RangeQueryStateClose({ ID: id });
+	return this.requestMessage(MsgType.RANGE_QUERY_STATE_CLOSE, payload.toBuffer(), uuid, _chaincodeProto.RangeQueryStateResponse);
+};
+
+Handler.prototype.handleInvokeChaincode = function(chaincodeName, fcn, args, uuid) {
+	var spec = new _chaincodeProto.ChaincodeSpec({
+		chaincodeID: { name: chaincodeName },
+		ctorMsg: { function: fcn, args: args }
+	});
+	return this.checkTransaction(uuid, 'invoke chaincode') || this.request(MsgType.INVOKE_CHAINCODE, spec.toBuffer(), uuid);
+};
+
+Handler.prototype.handleQueryChaincode = function(chaincodeName, fcn, args, uuid) {
+	var spec = new _chaincodeProto.ChaincodeSpec({
+		chaincodeID: { name: chaincodeName },
+		ctorMsg: { function: fcn, args: args }
+	});
+	return this.request(MsgType.INVOKE_QUERY, spec.toBuffer(), uuid);
+};
+
+// run calls the chaincode function for the INIT, TRANSACTION or QUERY msg, and returns the promise of its result
+Handler.prototype.run = function(msg, isTransaction, method) {
+	var input = _chaincodeProto.ChaincodeInput.decode(msg.payload);
+	var stub = new ChaincodeStub(this, msg.uuid, msg.securityContext);
+	var self = this;
+	this.isTransaction[msg.uuid] = isTransaction;
+	return Promise.resolve()
+		.then(function() {
+			return self.chaincode[method](stub, input.function, input.args);
+		})
+		.then(function(result) {
+			delete self.isTransaction[msg.uuid];
+			return { result: result, events: stub.chaincodeEvents };
+		}, function(err) {
+			delete self.isTransaction[msg.uuid];
+			throw err;
+		});
+};
+
+function toBuffer(result) {
+	if (result === undefined || result === null) {
+		return new Buffer(0);
+	}
+	return Buffer.isBuffer(result) ? result : new Buffer(String(result));
+}
+
+// completed returns the COMPLETED message of the outcome of an Init or Invoke, with the events the chaincode set
+function completed(msg, res) {
+	return { type: MsgType.COMPLETED, payload: toBuffer(res.result), uuid: msg.uuid, chaincodeEvent: res.events[0], chaincodeEvents: res.events };
+}
+
+function errorPayload(err) {
+	return new Buffer(err && err.message ? err.message : String(err));
+}
+
+// handleInit runs the Init of the chaincode, then moves the state machine on with its outcome
+Handler.prototype.handleInit = function(msg) {
+	var self = this;
+	this.run(msg, true, 'init').then(function(res) {
+		debug('[%s]Init succeeded. Sending COMPLETED', shortUUID(msg.uuid));
+		self.nextState(completed(msg, res));
+	}, function(err) {
+		debug('[%s]Init failed. Sending ERROR: %s', shortUUID(msg.uuid), err);
+		self.nextState({ type: MsgType.ERROR, payload: errorPayload(err), uuid: msg.uuid });
+	});
+};
+
+// handleTransaction runs the Invoke of the chaincode, then moves the state machine on with its outcome
+Handler.prototype.handleTransaction = function(msg) {
+	var self = this;
+	this.run(msg, true, 'invoke').then(function(res) {
+		debug('[%s]Transaction completed. Sending COMPLETED', shortUUID(msg.uuid));
+		self.nextState(completed(msg, res));
+	}, function(err) {
+		debug('[%s]Transaction execution failed. Sending ERROR: %s', shortUUID(msg.uuid), err);
+		self.nextState({ type: MsgType.ERROR, payload: errorPayload(err), uuid: msg.uuid });
+	});
+};
+
+// handleQuery runs the Query of the chaincode. A query does not change the state of the handler
+Handler.prototype.handleQuery = function(msg) {
+	var self = this;
+	this.run(msg, false, 'query').then(function(res) {
+		debug('[%s]Query completed. Sending QUERY_COMPLETED', shortUUID(msg.uuid));
+		self.send({ type: MsgType.QUERY_COMPLETED, payload: toBuffer(res.result), uuid: msg.uuid });
+	}, function(err) {
+		debug('[%s]Query execution failed. Sending QUERY_ERROR: %s', shortUUID(msg.uuid), err);
+		self.send({ type: MsgType.QUERY_ERROR, payload: errorPayload(err), uuid: msg.uuid });
+	});
+};
+
+// nextState applies the outcome of an Init or Invoke to the state machine, and sends it to the validator
+Handler.prototype.nextState = function(msg) {
+	this.transition(msg);
+	this.send(msg);
+};
+
+// transition moves the state machine on with msg, returning false if the current state does not accept it
+Handler.prototype.transition = function(msg) {
+	var name = msgTypeName(msg.type);
+	var dst = transitions[this.state][name];
+	if (!dst) {
+		return false;
+	}
+	debug('[%s]%s moves the handler from %s to %s', shortUUID(msg.uuid), name, this.state, dst);
+	this.state = dst;
+	return true;
+};
+
+// respond delivers a RESPONSE or ERROR of the validator to the stub waiting for it
+Handler.prototype.respond = function(msg) {
+	var pending = this.pending[msg.uuid];
+	if (!pending) {
+		debug('[%s]Received %s with no request pending', shortUUID(msg.uuid), msgTypeName(msg.type));
+		return;
+	}
+	delete this.pending[msg.uuid];
+	if (msgTypeName(msg.type) === 'RESPONSE') {
+		pending.resolve(msg.payload ? msg.payload.toBuffer() : new Buffer(0));
+	} else {
+		pending.reject(new Error(msg.payload ? msg.payload.toBuffer().toString() : 'Error from the validator'));
+	}
+};
+
+// handleMessage handles a message of the validator
+Handler.prototype.handleMessage = function(msg) {
+	var name = msgTypeName(msg.type);
+	if (name === 'KEEPALIVE') {
+		// keepalive messages are PONGs to the fabric's PINGs
+		this.send(msg);
+		return;
+	}
+	debug('[%s]Handling ChaincodeMessage of type: %s(state:%s)', shortUUID(msg.uuid), name, this.state);
+
+	// an ERROR answering a request of a stub does not concern the state machine
+	if (name === 'ERROR' && this.pending[msg.uuid]) {
+		this.respond(msg);
+		return;
+	}
+	var src = this.state;
+	if (!this.transition(msg)) {
+		var errStr = 'Chaincode handler FSM cannot handle message (' + name + ') while in state: ' + this.state;
+		this.send({ type: MsgType.ERROR, payload: new Buffer(errStr), uuid: msg.uuid });
+		throw new Error(errStr);
+	}
+
+	switch (name) {
+	case 'REGISTERED':
+		debug('Received REGISTERED, ready for invocations');
+		break;
+	case 'INIT':
+		this.handleInit(msg);
+		break;
+	case 'TRANSACTION':
+		this.handleTransaction(msg);
+		break;
+	case 'QUERY':
+		this.handleQuery(msg);
+		break;
+	case 'RESPONSE':
+	case 'ERROR':
+		this.respond(msg);
+		break;
+	default:
+		debug('[%s]%s moved the handler from %s to %s', shortUUID(msg.uuid), name, src, this.state);
+	}
+};
+
+module.exports = Handler;
+module.exports.chaincodeProto = _chaincodeProto;
@@ -0,0 +1,128 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+'use strict';
+
+function toBuffer(value) {
+	return Buffer.isBuffer(value) ? value : new Buffer(String(value));
+}
+
+// ChaincodeStub is the API the chaincode uses to access the ledger and to call
+// other chaincodes, for the transaction or query it runs. Its functions return
+// promises, and must be called one at a time: a function must only be called
+// once the promise of the previous one is settled
+function ChaincodeStub(handler, uuid, securityContext) {
+	this.handler = handler;
+	this.uuid = uuid;
+	this.securityContext = securityContext;
+	this.chaincodeEvents = [];
+}
+
+// getState returns the promise of the value of key as a Buffer, empty if the key has no value
+ChaincodeStub.prototype.getState = function(key) {
+	return this.handler.handleGetState(key, this.uuid);
+};
+
+// putState writes value, a Buffer or a string, to key. Only transactions can write the state
+ChaincodeStub.prototype.putState = function(key, value) {
+	return this.handler.handlePutState(key, toBuffer(value), this.uuid);
+};
+
+// delState deletes key. Only transactions can write the state
+ChaincodeStub.prototype.delState = function(key) {
+	return this.handler.handleDelState(key, this.uuid);
+};
+
+// rangeQueryState returns the promise of the keys between startKey and endKey with their values, as an array of
+// {key, value} in the order of the keys. The results are fetched from the validator as many times as needed
+ChaincodeStub.prototype.rangeQueryState = function(startKey, endKey) {
+	var handler = this.handler;
+	var uuid = this.uuid;
+	var results = [];
+	function collect(response) {
+		response.keysAndValues.forEach(function(kv) {
+			results.push({ key: kv.key, value: kv.value ? kv.value.toBuffer() : new Buffer(0) });
+		});
+		if (!response.hasMore) {
+			return results;
+		}
+		return handler.handleRangeQueryStateNext(response.ID, uuid).then(collect);
+	}
+	return handler.handleRangeQueryState(startKey, endKey, uuid).then(collect);
+};
+
+// invokeChaincode invokes the function of another chaincode in the transaction, and returns the promise of its
+// result as a Buffer
+ChaincodeStub.prototype.invokeChaincode = function(chaincodeName, fcn, args) {
+	return this.handler.handleInvokeChaincode(chaincodeName, fcn, args || [], this.uuid);
+};
+
+// queryChaincode queries another chaincode, and returns the promise of its result as a Buffer
+ChaincodeStub.prototype.queryChaincode = function(chaincodeName, fcn, args) {
+	return this.handler.handleQueryChaincode(chaincodeName, fcn, args || [], this.uuid);
+};
+
+// getCallerCertificate returns the certificate of the caller of the transaction, as a Buffer
+ChaincodeStub.prototype.getCallerCertificate = function() {
+	var cert = this.securityContext ? this.securityContext.callerCert : null;
+	return cert ? cert.toBuffer() : null;
+};
+
+// setEvent sets an event the transaction emits once it is made part of a block. A transaction may emit several
+// events of different names, setting an event of a name set before replaces it. attributes, optional, are made
+// with stringAttribute, intAttribute and boolAttribute
+ChaincodeStub.prototype.setEvent = function(name, payload, attributes) {
+	if (!name) {
+		throw new Error('Event name must not be an empty string');
+	}
+	attributes = attributes || [];
+	var names = {};
+	attributes.forEach(function(attribute) {
+		if (!attribute.name || names[attribute.name]) {
+			throw new Error('Attributes of event ' + name + ' must have distinct non-empty names');
+		}
+		names[attribute.name] = true;
+	});
+
+	var event = { eventName: name, payload: toBuffer(payload), attributes: attributes };
+	for (var i = 0; i < this.chaincodeEvents.length; i++) {
+		if (this.chaincodeEvents[i].eventName === name) {
+			this.chaincodeEvents[i] = event;
+			return;
+		}
+	}
+	this.chaincodeEvents.push(event);
+};
+
+// stringAttribute returns a string event attribute, indexed by the ledger if indexed is true
+ChaincodeStub.stringAttribute = function(name, value, indexed) {
+	return { name: name, type: 'STRING', value: String(value), indexed: !!indexed };
+};
+
+// intAttribute returns an integer event attribute, indexed by the ledger if indexed is true
+ChaincodeStub.intAttribute = function(name, value, indexed) {
+	if (!/^-?\d+$/.test(String(value))) {
+		throw new Error('Attribute ' + name + ' must be an integer');
+	}
+	return { name: name, type: 'INTEGER', value: String(value).replace(/^(-?)0+(?=\d)/, '$1'), indexed: !!indexed };
+};
+
+// boolAttribute returns a boolean event attribute, indexed by the ledger if indexed is true
+ChaincodeStub.boolAttribute = function(name, value, indexed) {
+	return { name: name, type: 'BOOLEAN', value: value ? 'true' : 'false', indexed: !!indexed };
+};
+
+module.exports = ChaincodeStub;
@@ -18,6 +18,7 @@ package shim
 
 import (
 	"os"
+	"reflect"
 	"testing"
 
 	"github.com/op/go-logging"
@@ -134,3 +135,110 @@ func TestChaincodeLogging(t *testing.T) {
 		t.Errorf("'bar' should be enabled for LogCritical")
 	}
 }
+
+// TestCompositeKey tests that composite keys are split back into their
+// attributes and that the keys of a partial composite key sort between it and
+// the end of its range.
+func TestCompositeKey(t *testing.T) {
+	stub := &ChaincodeStub{}
+	attributes := []string{"blue", "", "marbleé"}
+	compositeKey, err := stub.CreateCompositeKey("color~name", attributes)
+	if err != nil {
+		t.Fatalf("CreateCompositeKey failed: %s", err)
+	}
+	objectType, splitAttributes, err := stub.SplitCompositeKey(compositeKey)
+	if err != nil {
+		t.Fatalf("SplitCompositeKey failed: %s", err)
+	}
+	if objectType != "color~name" || !reflect.DeepEqual(splitAttributes, attributes) {
+		t.Errorf("SplitCompositeKey returned [%s] %q instead of [color~name] %q", objectType, splitAttributes, attributes)
+	}
+
+	partialKey, err := createCompositeKey("color~name", []string{"blue"})
+	if err != nil {
+		t.Fatalf("createCompositeKey failed: %s", err)
+	}
+	if compositeKey < partialKey || compositeKey > partialKey+string(maxCompositeKeyRune) {
+		t.Errorf("Composite key %q is not in the range of the partial composite key %q", compositeKey, partialKey)
+	}
+	otherKey, _ := createCompositeKey("color~name", []string{"blueish", "marble"})
+	if otherKey >= partialKey && otherKey <= partialKey+string(maxCompositeKeyRune) {
+		t.Errorf("Composite key %q is in the range of the partial composite key %q", otherKey, partialKey)
+	}
+
+	for _, invalid := range [][]string{{""}, {"color", "a\x00b"}, {"color", "\U0010FFFF"}, {"color", "\xff"}, {"a\x00"}} {
+		if _, err := stub.CreateCompositeKey(invalid[0], invalid[1:]); err == nil {
+			t.Errorf("CreateCompositeKey should fail for %q", invalid)
+		}
+	}
+	for _, invalid := range []string{"color\x00blue\x00", "\x00composite\x00color"} {
+		if _, _, err := stub.SplitCompositeKey(invalid); err == nil {
+			t.Errorf("SplitCompositeKey should fail for %q", invalid)
+		}
+	}
+}
+
+func TestSetEvents(t *testing.T) {
+	stub := &ChaincodeStub{}
+	if err := stub.SetEvent("", nil); err == nil {
+		t.Errorf("Expected an error setting a nameless event")
+	}
+	if err := stub.SetEventWithAttributes("transfer", nil, IntAttribute("amount", 10, true), StringAttribute("amount", "ten", false)); err == nil {
+		t.Errorf("Expected an error setting an event with two attributes of the same name")
+	}
+
+	stub.SetEvent("transfer", []byte("first"))
+	stub.SetEvent("audit", []byte("audit"))
+	stub.SetEventWithAttributes("transfer", []byte("second"), StringAttribute("owner", "alice", true), IntAttribute("amount", -10, true), BoolAttribute("urgent", true, false))
+	if len(stub.chaincodeEvents) != 2 {
+		t.Fatalf("Expected 2 events, got %d", len(stub.chaincodeEvents))
+	}
+	first := stub.firstEvent()
+	if first.EventName != "transfer" || string(first.Payload) != "second" {
+		t.Errorf("Expected the transfer event to be replaced in place, got %v", first)
+	}
+	var values []string
+	for _, attribute := range first.Attributes {
+		values = append(values, attribute.Type.String()+":"+attribute.Value)
+	}
+	if !reflect.DeepEqual(values, []string{"STRING:alice", "INTEGER:-10", "BOOLEAN:true"}) {
+		t.Errorf("Unexpected attribute values %v", values)
+	}
+}
+
+func TestStateCache(t *testing.T) {
+	SetStateCache(true)
+	defer SetStateCache(false)
+	h := newChaincodeHandler(nil, nil)
+	if h.stateCache == nil {
+		t.Fatalf("Expected the handler to have a state cache")
+	}
+
+	h.stateCache.put("tx1", "a", []byte("100"))
+	h.stateCache.put("tx1", "b", nil)
+	// Served from the cache, the handler has no stream to the peer
+	if value, err := h.handleGetState("a", "tx1"); err != nil || string(value) != "100" {
+		t.Errorf("Expected a to be served from the cache, got %q, %v", value, err)
+	}
+	if value, err := h.handleGetState("b", "tx1"); err != nil || value != nil {
+		t.Errorf("Expected deleted key b to be served from the cache, got %q, %v", value, err)
+	}
+	if _, ok := h.stateCache.get("tx2", "a"); ok {
+		t.Errorf("Expected values to be cached per transaction")
+	}
+
+	h.stateCache.invalidate("tx1")
+	if _, ok := h.stateCache.get("tx1", "a"); ok {
+		t.Errorf("Expected no cached value after invalidation")
+	}
+
+	SetStateCache(false)
+	if newChaincodeHandler(nil, nil).stateCache != nil {
+		t.Errorf("Expected no state cache when disabled")
+	}
+	var disabled *stateCache
+	disabled.put("tx1", "a", []byte("100"))
+	if _, ok := disabled.get("tx1", "a"); ok {
+		t.Errorf("Expected a disabled cache never to hit")
+	}
+}
@@ -0,0 +1,71 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package shim
+
+import "sync"
+
+// stateCache keeps, per transaction UUID, the values of the keys a chaincode
+// read or wrote during the execution of that transaction, so that repeated
+// GetState calls for a key do not each go back to the validating peer. Writes
+// are sent to the peer as before and then recorded here (write-through), a key
+// deleted or not found is recorded with a nil value.
+type stateCache struct {
+	sync.Mutex
+	txs map[string]map[string][]byte
+}
+
+func newStateCache() *stateCache {
+	return &stateCache{txs: make(map[string]map[string][]byte)}
+}
+
+// get returns the cached value of key for the transaction and whether the key
+// was cached at all. A nil cache never hits.
+func (c *stateCache) get(uuid string, key string) ([]byte, bool) {
+	if c == nil {
+		return nil, false
+	}
+	c.Lock()
+	defer c.Unlock()
+	value, ok := c.txs[uuid][key]
+	return value, ok
+}
+
+// put records the value of key for the transaction, nil for a deleted key.
+func (c *stateCache) put(uuid string, key string, value []byte) {
+	if c == nil {
+		return
+	}
+	c.Lock()
+	defer c.Unlock()
+	tx, ok := c.txs[uuid]
+	if !ok {
+		tx = make(map[string][]byte)
+		c.txs[uuid] = tx
+	}
+	tx[key] = value
+}
+
+// invalidate drops all the values cached for the transaction. It is called
+// when the transaction completes and whenever the state of the chaincode may
+// have been changed behind the shim, e.g. by another chaincode it invoked.
+func (c *stateCache) invalidate(uuid string) {
+	if c == nil {
+		return
+	}
+	c.Lock()
+	delete(c.txs, uuid)
+	c.Unlock()
+}
@@ -0,0 +1,86 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package chaincode
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/spf13/viper"
+
+	pb "github.com/hyperledger/fabric/protos"
+)
+
+// systemChaincodes are the names of the system chaincodes known to the peer,
+// mapped to whether they are registered with it. They run in the peer, and
+// only the registered ones may be deployed to run in it, but user chaincodes
+// may not take any of the names, whether the system chaincode is enabled or not
+var systemChaincodes = struct {
+	sync.RWMutex
+	names map[string]bool
+}{names: make(map[string]bool)}
+
+// ReserveSystemChaincodeName keeps user chaincodes from being deployed under
+// the name of a system chaincode, even one which is disabled
+func ReserveSystemChaincodeName(name string) {
+	systemChaincodes.Lock()
+	defer systemChaincodes.Unlock()
+	if _, ok := systemChaincodes.names[name]; !ok {
+		systemChaincodes.names[name] = false
+	}
+}
+
+// RegisterSystemChaincode reserves name to the system chaincode of that name,
+// which the peer may then deploy to run in the peer
+func RegisterSystemChaincode(name string) {
+	systemChaincodes.Lock()
+	defer systemChaincodes.Unlock()
+	systemChaincodes.names[name] = true
+}
+
+// IsSystemChaincode returns whether name is the name of a system chaincode
+// registered with the peer
+func IsSystemChaincode(name string) bool {
+	systemChaincodes.RLock()
+	defer systemChaincodes.RUnlock()
+	return systemChaincodes.names[name]
+}
+
+// isReservedName returns whether name is the name of a system chaincode known
+// to the peer, registered or not
+func isReservedName(name string) bool {
+	systemChaincodes.RLock()
+	defer systemChaincodes.RUnlock()
+	_, ok := systemChaincodes.names[name]
+	return ok
+}
+
+// checkExecEnv keeps user chaincodes out of the peer: only registered system
+// chaincodes may be deployed to run in the peer, and under their names. User
+// chaincodes run as processes of the host only if chaincode.process.enabled
+func checkExecEnv(cds *pb.ChaincodeDeploymentSpec) error {
+	name := cds.ChaincodeSpec.ChaincodeID.Name
+	if cds.ExecEnv == pb.ChaincodeDeploymentSpec_SYSTEM && !IsSystemChaincode(name) {
+		return fmt.Errorf("Chaincode %s is not a system chaincode registered with the peer and cannot run in the peer", name)
+	}
+	if cds.ExecEnv != pb.ChaincodeDeploymentSpec_SYSTEM && isReservedName(name) {
+		return fmt.Errorf("Chaincode name %s is reserved to a system chaincode", name)
+	}
+	if cds.ExecEnv == pb.ChaincodeDeploymentSpec_PROCESS && !viper.GetBool("chaincode.process.enabled") {
+		return fmt.Errorf("Chaincode %s cannot run as a process, the peer does not enable it", name)
+	}
+	return nil
+}
@@ -100,9 +100,31 @@ func getDockerHostConfig() *docker.HostConfig {
 	return hostConfig
 }
 
-func (vm *DockerVM) createContainer(ctxt context.Context, client *docker.Client, imageID string, containerID string, args []string, env []string, attachstdin bool, attachstdout bool) error {
+// getChaincodeHostConfig returns the docker host config of the container of
+// the chaincode, with the memory and CPU of its limits, if any, in place of
+// those of vm.docker.hostConfig
+func getChaincodeHostConfig(ccid ccintf.CCID) *docker.HostConfig {
+	limits := ccid.ChaincodeSpec.GetLimits()
+	if limits == nil || (limits.Memory <= 0 && limits.CpuShares <= 0) {
+		return getDockerHostConfig()
+	}
+	chaincodeHostConfig := *getDockerHostConfig()
+	if limits.Memory > 0 {
+		chaincodeHostConfig.Memory = limits.Memory
+		// the swap includes the memory, it cannot be less
+		if chaincodeHostConfig.MemorySwap > 0 && chaincodeHostConfig.MemorySwap < limits.Memory {
+			chaincodeHostConfig.MemorySwap = 0
+		}
+	}
+	if limits.CpuShares > 0 {
+		chaincodeHostConfig.CPUShares = limits.CpuShares
+	}
+	return &chaincodeHostConfig
+}
+
+func (vm *DockerVM) createContainer(ctxt context.Context, client *docker.Client, imageID string, containerID string, args []string, env []string, attachstdin bool, attachstdout bool, ccHostConfig *docker.HostConfig) error {
 	config := docker.Config{Cmd: args, Image: imageID, Env: env, AttachStdin: attachstdin, AttachStdout: attachstdout}
-	copts := docker.CreateContainerOptions{Name: containerID, Config: &config, HostConfig: getDockerHostConfig()}
+	copts := docker.CreateContainerOptions{Name: containerID, Config: &config, HostConfig: ccHostConfig}
 	dockerLogger.Debugf("Create container: %s", containerID)
 	_, err := client.CreateContainer(copts)
 	if err != nil {
@@ -128,7 +150,12 @@ func (vm *DockerVM) deployImage(client *docker.Client, ccid ccintf.CCID, args []
 		return err
 	}
 
-	dockerLogger.Debugf("Created image: %s", id)
+	//the ID of the image, for comparing the images the peers built
+	if image, err := client.InspectImage(id); err == nil {
+		dockerLogger.Infof("Created image: %s (%s)", id, image.ID)
+	} else {
+		dockerLogger.Debugf("Created image: %s", id)
+	}
 
 	return nil
 }
@@ -160,13 +187,14 @@ func (vm *DockerVM) Start(ctxt context.Context, ccid ccintf.CCID, args []string,
 	}
 
 	containerID := strings.Replace(imageID, ":", "_", -1)
+	ccHostConfig := getChaincodeHostConfig(ccid)
 
 	//stop,force remove if necessary
 	dockerLogger.Debugf("Cleanup container %s", containerID)
 	vm.stopInternal(ctxt, client, containerID, 0, false, false)
 
 	dockerLogger.Debugf("Start container %s", containerID)
-	err = vm.createContainer(ctxt, client, imageID, containerID, args, env, attachstdin, attachstdout)
+	err = vm.createContainer(ctxt, client, imageID, containerID, args, env, attachstdin, attachstdout, ccHostConfig)
 	if err != nil {
 		//if image not found try to create image and retry
 		if err == docker.ErrNoSuchImage {
@@ -177,7 +205,7 @@ func (vm *DockerVM) Start(ctxt context.Context, ccid ccintf.CCID, args []string,
 				}
 
 				dockerLogger.Debug("start-recreated image successfully")
-				if err = vm.createContainer(ctxt, client, imageID, containerID, args, env, attachstdin, attachstdout); err != nil {
+				if err = vm.createContainer(ctxt, client, imageID, containerID, args, env, attachstdin, attachstdout, ccHostConfig); err != nil {
 					dockerLogger.Errorf("start-could not recreate container post recreate image: %s", err)
 					return err
 				}
@@ -194,16 +222,30 @@ func (vm *DockerVM) Start(ctxt context.Context, ccid ccintf.CCID, args []string,
 	// Baohua: getDockerHostConfig() will be ignored when communicating with docker API 1.24+.
 	// I keep it here for a short-term compatibility.
 	// See https://goo.gl/ZvtkKm for more details.
-	err = client.StartContainer(containerID, getDockerHostConfig())
+	err = client.StartContainer(containerID, ccHostConfig)
 	if err != nil {
 		dockerLogger.Errorf("start-could not start container %s", err)
 		return err
 	}
 
 	dockerLogger.Debugf("Started container %s", containerID)
+	go followOutput(client, containerID, ccid.ChaincodeSpec.ChaincodeID.Name)
 	return nil
 }
 
+//followOutput captures the stdout and stderr of the container until it stops
+func followOutput(client *docker.Client, containerID string, chaincode string) {
+	r, w := io.Pipe()
+	go func() {
+		err := client.Logs(docker.LogsOptions{Container: containerID, OutputStream: w, ErrorStream: w, Follow: true, Stdout: true, Stderr: true})
+		if err != nil {
+			dockerLogger.Debugf("Output of container %s ended: %s", containerID, err)
+		}
+		w.CloseWithError(err)
+	}()
+	cutil.LogChaincodeOutput(chaincode, r)
+}
+
 //Stop stops a running chaincode
 func (vm *DockerVM) Stop(ctxt context.Context, ccid ccintf.CCID, timeout uint, dontkill bool, dontremove bool) error {
 	id, _ := vm.GetVMName(ccid)
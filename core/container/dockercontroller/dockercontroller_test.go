@@ -25,7 +25,9 @@ import (
 
 	"github.com/fsouza/go-dockerclient"
 	"github.com/hyperledger/fabric/core/config"
+	"github.com/hyperledger/fabric/core/container/ccintf"
 	"github.com/hyperledger/fabric/core/ledger/testutil"
+	pb "github.com/hyperledger/fabric/protos"
 )
 
 func TestHostConfig(t *testing.T) {
@@ -54,3 +56,18 @@ func TestGetDockerHostConfig(t *testing.T) {
 	testutil.AssertEquals(t, hostConfig.Memory, int64(1024*1024*1024*2))
 	testutil.AssertEquals(t, hostConfig.CPUShares, int64(1024*1024*1024*2))
 }
+
+func TestGetChaincodeHostConfig(t *testing.T) {
+	config.SetupTestConfig("./../../../peer")
+	base := getDockerHostConfig()
+	ccid := ccintf.CCID{ChaincodeSpec: &pb.ChaincodeSpec{ChaincodeID: &pb.ChaincodeID{Name: "simple"}}}
+	testutil.AssertSame(t, getChaincodeHostConfig(ccid), base)
+
+	ccid.ChaincodeSpec.Limits = &pb.ChaincodeLimits{Memory: 268435456, CpuShares: 512}
+	hostConfig := getChaincodeHostConfig(ccid)
+	testutil.AssertEquals(t, hostConfig.Memory, int64(268435456))
+	testutil.AssertEquals(t, hostConfig.CPUShares, int64(512))
+	testutil.AssertEquals(t, hostConfig.NetworkMode, base.NetworkMode)
+	// the host config of the other chaincodes is left as it is
+	testutil.AssertNotEquals(t, base.Memory, int64(268435456))
+}
@@ -0,0 +1,295 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package processcontroller
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/op/go-logging"
+	"github.com/spf13/viper"
+	"golang.org/x/net/context"
+
+	"github.com/hyperledger/fabric/core/container/ccintf"
+	cutil "github.com/hyperledger/fabric/core/container/util"
+	pb "github.com/hyperledger/fabric/protos"
+)
+
+var processLogger = logging.MustGetLogger("processcontroller")
+
+//chaincodeProcess is a chaincode running as a process of the host
+type chaincodeProcess struct {
+	cmd  *exec.Cmd
+	done chan struct{}
+}
+
+var (
+	processesLock sync.Mutex
+	processes     = make(map[string]*chaincodeProcess)
+)
+
+//ProcessVM is a vm running chaincodes as processes of the host of the peer,
+//without docker. The code package of a chaincode is unpacked and built in a
+//directory of its own, with the build command configured for its language
+//under chaincode.process.build, and launched from there with the command
+//configured under chaincode.process.run
+type ProcessVM struct {
+	id string
+}
+
+//getWorkDir returns the directory the chaincode is unpacked and built in
+func getWorkDir(vmName string) string {
+	return filepath.Join(viper.GetString("chaincode.process.dir"), vmName)
+}
+
+//getCommand returns the command of the kind, build or run, configured for the
+//language of the chaincode
+func getCommand(kind string, spec *pb.ChaincodeSpec) (string, error) {
+	lang := strings.ToLower(spec.Type.String())
+	command := viper.GetString("chaincode.process." + kind + "." + lang)
+	if command == "" {
+		return "", fmt.Errorf("No %s command configured for %s chaincodes under chaincode.process.%s", kind, lang, kind)
+	}
+	return command, nil
+}
+
+//getCommandEnv returns the environment of the commands: the environment of
+//the peer, the env given by the peer to the chaincode, the name of the
+//chaincode in CHAINCODE_NAME and its path, without the scheme, in CHAINCODE_PATH
+func getCommandEnv(spec *pb.ChaincodeSpec, env []string) []string {
+	path := spec.ChaincodeID.Path
+	for _, scheme := range []string{"http://", "https://"} {
+		path = strings.TrimPrefix(path, scheme)
+	}
+	path = strings.TrimSuffix(path, "/")
+	cmdEnv := append(os.Environ(), env...)
+	return append(cmdEnv, "CHAINCODE_NAME="+spec.ChaincodeID.Name, "CHAINCODE_PATH="+path)
+}
+
+//newCommand returns the command running the line with the shell in the
+//directory. The command runs in a process group of its own, for stopping the
+//group to stop whatever the line started
+func newCommand(line string, dir string, env []string) *exec.Cmd {
+	cmd := exec.Command("sh", "-c", line)
+	cmd.Dir = dir
+	cmd.Env = env
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	return cmd
+}
+
+//signal sends the signal to the process group of the chaincode
+func (process *chaincodeProcess) signal(sig syscall.Signal) error {
+	return syscall.Kill(-process.cmd.Process.Pid, sig)
+}
+
+//unpack extracts the gzipped tar of the code package to the directory
+func unpack(reader io.Reader, dir string) error {
+	gr, err := gzip.NewReader(reader)
+	if err != nil {
+		return fmt.Errorf("Error reading the code package: %s", err)
+	}
+	defer gr.Close()
+	tr := tar.NewReader(gr)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("Error reading the code package: %s", err)
+		}
+		target := filepath.Join(dir, header.Name)
+		if !strings.HasPrefix(target, filepath.Clean(dir)+string(os.PathSeparator)) {
+			return fmt.Errorf("Invalid file %s in the code package", header.Name)
+		}
+		if header.Typeflag == tar.TypeDir {
+			if err = os.MkdirAll(target, 0755); err != nil {
+				return err
+			}
+			continue
+		}
+		if header.Typeflag != tar.TypeReg && header.Typeflag != tar.TypeRegA {
+			continue
+		}
+		if err = os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+			return err
+		}
+		file, err := os.OpenFile(target, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, os.FileMode(header.Mode)|0600)
+		if err != nil {
+			return err
+		}
+		_, err = io.Copy(file, tr)
+		file.Close()
+		if err != nil {
+			return err
+		}
+	}
+}
+
+//Deploy unpacks the code package of the chaincode and builds it
+func (vm *ProcessVM) Deploy(ctxt context.Context, ccid ccintf.CCID, args []string, env []string, attachstdin bool, attachstdout bool, reader io.Reader) error {
+	if reader == nil {
+		return fmt.Errorf("No code package for %s", ccid.ChaincodeSpec.ChaincodeID.Name)
+	}
+	build, err := getCommand("build", ccid.ChaincodeSpec)
+	if err != nil {
+		return err
+	}
+	id, _ := vm.GetVMName(ccid)
+	dir := getWorkDir(id)
+	if err = os.RemoveAll(dir); err != nil {
+		return fmt.Errorf("Error cleaning %s: %s", dir, err)
+	}
+	if err = os.MkdirAll(dir, 0755); err != nil {
+		return fmt.Errorf("Error creating %s: %s", dir, err)
+	}
+	if err = unpack(reader, dir); err != nil {
+		os.RemoveAll(dir)
+		return err
+	}
+
+	output, err := newCommand(build, dir, getCommandEnv(ccid.ChaincodeSpec, nil)).CombinedOutput()
+	if err != nil {
+		processLogger.Errorf("Error building %s", id)
+		processLogger.Errorf("Build Output:\n********************\n%s\n********************", output)
+		os.RemoveAll(dir)
+		return fmt.Errorf("Error building chaincode %s: %s", id, err)
+	}
+
+	processLogger.Debugf("Built %s in %s", id, dir)
+	return nil
+}
+
+//Start launches the chaincode built before, building it first from the
+//reader if it is not
+func (vm *ProcessVM) Start(ctxt context.Context, ccid ccintf.CCID, args []string, env []string, attachstdin bool, attachstdout bool, reader io.Reader) error {
+	run, err := getCommand("run", ccid.ChaincodeSpec)
+	if err != nil {
+		return err
+	}
+	id, _ := vm.GetVMName(ccid)
+
+	//stop if necessary
+	vm.stopInternal(id, 0, false)
+
+	dir := getWorkDir(id)
+	if _, err = os.Stat(dir); os.IsNotExist(err) {
+		processLogger.Debugf("start-could not find %s ...attempt to build it", dir)
+		if err = vm.Deploy(ctxt, ccid, args, env, attachstdin, attachstdout, reader); err != nil {
+			return err
+		}
+	}
+
+	cmd := newCommand(run, dir, getCommandEnv(ccid.ChaincodeSpec, env))
+	output, err := cmd.StdoutPipe()
+	if err != nil {
+		return err
+	}
+	cmd.Stderr = cmd.Stdout
+	if err = cmd.Start(); err != nil {
+		processLogger.Errorf("start-could not start %s: %s", id, err)
+		return err
+	}
+
+	process := &chaincodeProcess{cmd: cmd, done: make(chan struct{})}
+	processesLock.Lock()
+	processes[id] = process
+	processesLock.Unlock()
+
+	go func() {
+		cutil.LogChaincodeOutput(ccid.ChaincodeSpec.ChaincodeID.Name, output)
+		err := cmd.Wait()
+		processLogger.Debugf("chaincode %s exited: %v", id, err)
+		processesLock.Lock()
+		if processes[id] == process {
+			delete(processes, id)
+		}
+		processesLock.Unlock()
+		close(process.done)
+	}()
+
+	processLogger.Debugf("Started %s", id)
+	return nil
+}
+
+//Stop stops the process of the chaincode. Unless dontkill is set, it is
+//killed right away, otherwise it is interrupted and killed only if it has
+//not exited after timeout seconds
+func (vm *ProcessVM) Stop(ctxt context.Context, ccid ccintf.CCID, timeout uint, dontkill bool, dontremove bool) error {
+	id, _ := vm.GetVMName(ccid)
+	return vm.stopInternal(id, timeout, dontkill)
+}
+
+func (vm *ProcessVM) stopInternal(id string, timeout uint, dontkill bool) error {
+	processesLock.Lock()
+	process := processes[id]
+	processesLock.Unlock()
+	if process == nil {
+		return fmt.Errorf("%s not running", id)
+	}
+
+	if dontkill {
+		if err := process.signal(syscall.SIGINT); err == nil {
+			select {
+			case <-process.done:
+				processLogger.Debugf("Stopped %s", id)
+				return nil
+			case <-time.After(time.Duration(timeout) * time.Second):
+			}
+		}
+	}
+	if err := process.signal(syscall.SIGKILL); err != nil {
+		processLogger.Debugf("Kill %s failed: %s", id, err)
+	}
+	<-process.done
+	processLogger.Debugf("Stopped %s", id)
+	return nil
+}
+
+//Destroy stops the chaincode, if it runs, and removes the directory it was
+//built in
+func (vm *ProcessVM) Destroy(ctxt context.Context, ccid ccintf.CCID, force bool, noprune bool) error {
+	id, _ := vm.GetVMName(ccid)
+	vm.stopInternal(id, 0, false)
+	if err := os.RemoveAll(getWorkDir(id)); err != nil {
+		processLogger.Errorf("error while destroying %s: %s", id, err)
+		return err
+	}
+	processLogger.Debugf("Destroyed %s", id)
+	return nil
+}
+
+//GetVMName generates the name of the chaincode from peer information given
+//the hashcode, like the name of its docker image, to keep the directories of
+//the chaincodes of the peers of a host apart
+func (vm *ProcessVM) GetVMName(ccid ccintf.CCID) (string, error) {
+	if ccid.NetworkID != "" {
+		return fmt.Sprintf("%s-%s-%s", ccid.NetworkID, ccid.PeerID, ccid.ChaincodeSpec.ChaincodeID.Name), nil
+	} else if ccid.PeerID != "" {
+		return fmt.Sprintf("%s-%s", ccid.PeerID, ccid.ChaincodeSpec.ChaincodeID.Name), nil
+	}
+	return ccid.ChaincodeSpec.ChaincodeID.Name, nil
+}
@@ -0,0 +1,168 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package processcontroller
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/spf13/viper"
+	"golang.org/x/net/context"
+
+	"github.com/hyperledger/fabric/core/container/ccintf"
+	cutil "github.com/hyperledger/fabric/core/container/util"
+	pb "github.com/hyperledger/fabric/protos"
+)
+
+// getCodePackage returns a code package holding the files
+func getCodePackage(t *testing.T, files map[string]string) *bytes.Buffer {
+	buf := bytes.NewBuffer(nil)
+	gw := gzip.NewWriter(buf)
+	tw := tar.NewWriter(gw)
+	for name, contents := range files {
+		if err := tw.WriteHeader(&tar.Header{Name: name, Mode: 0644, Size: int64(len(contents))}); err != nil {
+			t.Fatalf("Error writing the code package: %s", err)
+		}
+		tw.Write([]byte(contents))
+	}
+	tw.Close()
+	gw.Close()
+	return buf
+}
+
+func TestProcessVM(t *testing.T) {
+	dir, err := ioutil.TempDir("", "processcontroller")
+	if err != nil {
+		t.Fatalf("Error creating the chaincodes directory: %s", err)
+	}
+	defer os.RemoveAll(dir)
+	viper.Set("chaincode.process.dir", dir)
+	viper.Set("chaincode.process.build.golang", "cp src/run.sh run && chmod +x run")
+	viper.Set("chaincode.process.run.golang", "./run")
+
+	vm := &ProcessVM{}
+	ccid := ccintf.CCID{ChaincodeSpec: &pb.ChaincodeSpec{Type: pb.ChaincodeSpec_GOLANG, ChaincodeID: &pb.ChaincodeID{Name: "simple", Path: "example/simple"}}, PeerID: "vp0"}
+	code := getCodePackage(t, map[string]string{"src/run.sh": "#!/bin/sh\necho $CHAINCODE_NAME $CORE_CHAINCODE_ID_NAME > started\nsleep 60\n"})
+	if err = vm.Deploy(context.Background(), ccid, nil, nil, false, false, code); err != nil {
+		t.Fatalf("Error deploying the chaincode: %s", err)
+	}
+	workDir := filepath.Join(dir, "vp0-simple")
+	if _, err = os.Stat(filepath.Join(workDir, "run")); err != nil {
+		t.Fatalf("Expected the chaincode to be built in %s: %s", workDir, err)
+	}
+
+	if err = vm.Start(context.Background(), ccid, nil, []string{"CORE_CHAINCODE_ID_NAME=simple"}, false, false, nil); err != nil {
+		t.Fatalf("Error starting the chaincode: %s", err)
+	}
+	var started []byte
+	for i := 0; i < 50 && len(started) == 0; i++ {
+		time.Sleep(100 * time.Millisecond)
+		started, _ = ioutil.ReadFile(filepath.Join(workDir, "started"))
+	}
+	if string(started) != "simple simple\n" {
+		t.Fatalf("Expected the chaincode to run with its env, got %q", started)
+	}
+
+	if err = vm.Stop(context.Background(), ccid, 1, true, false); err != nil {
+		t.Fatalf("Error stopping the chaincode: %s", err)
+	}
+	if err = vm.Stop(context.Background(), ccid, 1, true, false); err == nil {
+		t.Errorf("Expected an error stopping a chaincode which does not run")
+	}
+	if err = vm.Destroy(context.Background(), ccid, false, false); err != nil {
+		t.Fatalf("Error destroying the chaincode: %s", err)
+	}
+	if _, err = os.Stat(workDir); !os.IsNotExist(err) {
+		t.Errorf("Expected %s to be removed", workDir)
+	}
+}
+
+func TestProcessVMOutput(t *testing.T) {
+	dir, err := ioutil.TempDir("", "processcontroller")
+	if err != nil {
+		t.Fatalf("Error creating the chaincodes directory: %s", err)
+	}
+	defer os.RemoveAll(dir)
+	viper.Set("chaincode.process.dir", dir)
+	viper.Set("chaincode.process.build.golang", "cp src/run.sh run && chmod +x run")
+	viper.Set("chaincode.process.run.golang", "./run")
+
+	vm := &ProcessVM{}
+	ccid := ccintf.CCID{ChaincodeSpec: &pb.ChaincodeSpec{Type: pb.ChaincodeSpec_GOLANG, ChaincodeID: &pb.ChaincodeID{Name: "verbose", Path: "example/verbose"}}, PeerID: "vp0"}
+	code := getCodePackage(t, map[string]string{"src/run.sh": "#!/bin/sh\necho to stdout\necho to stderr >&2\nsleep 60\n"})
+	if err = vm.Deploy(context.Background(), ccid, nil, nil, false, false, code); err != nil {
+		t.Fatalf("Error deploying the chaincode: %s", err)
+	}
+
+	lines, next, stop := cutil.FollowChaincodeOutput("verbose", 0)
+	defer stop()
+	if len(lines) != 0 {
+		t.Fatalf("Expected no output before the chaincode starts, got %v", lines)
+	}
+	if err = vm.Start(context.Background(), ccid, nil, nil, false, false, nil); err != nil {
+		t.Fatalf("Error starting the chaincode: %s", err)
+	}
+	defer vm.Stop(context.Background(), ccid, 1, false, false)
+	for _, expected := range []string{"to stdout", "to stderr"} {
+		select {
+		case entry := <-next:
+			if entry.Chaincode != "verbose" || entry.Line != expected {
+				t.Fatalf("Expected the line %q of verbose, got %v", expected, entry)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("Expected the chaincode to write %q", expected)
+		}
+	}
+
+	if lines = cutil.GetChaincodeOutput("verbose", 1); len(lines) != 1 || lines[0].Line != "to stderr" {
+		t.Errorf("Expected the last line of the output to be kept, got %v", lines)
+	}
+	if lines = cutil.GetChaincodeOutput("verbose", 0); len(lines) != 2 {
+		t.Errorf("Expected the whole output to be kept, got %v", lines)
+	}
+}
+
+func TestProcessVMBuildFailure(t *testing.T) {
+	dir, err := ioutil.TempDir("", "processcontroller")
+	if err != nil {
+		t.Fatalf("Error creating the chaincodes directory: %s", err)
+	}
+	defer os.RemoveAll(dir)
+	viper.Set("chaincode.process.dir", dir)
+	viper.Set("chaincode.process.build.golang", "exit 1")
+
+	vm := &ProcessVM{}
+	ccid := ccintf.CCID{ChaincodeSpec: &pb.ChaincodeSpec{Type: pb.ChaincodeSpec_GOLANG, ChaincodeID: &pb.ChaincodeID{Name: "broken"}}}
+	if err = vm.Deploy(context.Background(), ccid, nil, nil, false, false, getCodePackage(t, nil)); err == nil {
+		t.Fatalf("Expected the build to fail")
+	}
+	if _, err = os.Stat(filepath.Join(dir, "broken")); !os.IsNotExist(err) {
+		t.Errorf("Expected the directory of a failed build to be removed")
+	}
+
+	ccid.ChaincodeSpec.Type = pb.ChaincodeSpec_JAVA
+	viper.Set("chaincode.process.build.java", "")
+	if err = vm.Deploy(context.Background(), ccid, nil, nil, false, false, getCodePackage(t, nil)); err == nil {
+		t.Errorf("Expected a chaincode without build command to be refused")
+	}
+}
@@ -0,0 +1,92 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package container
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strings"
+)
+
+// GetBuildDigest returns the digest recorded in the deployment of the code
+// package, the hex encoded SHA-256 of the package. As the package carries
+// no timestamp, the same chaincode is packaged with the same digest by any
+// peer, and with base images pinned by digest, it builds the same image
+func GetBuildDigest(codePackage []byte) string {
+	digest := sha256.Sum256(codePackage)
+	return hex.EncodeToString(digest[:])
+}
+
+// VerifyBuildDigest returns an error unless digest is the build digest of
+// the code package
+func VerifyBuildDigest(codePackage []byte, digest string) error {
+	if actual := GetBuildDigest(codePackage); actual != digest {
+		return fmt.Errorf("The code package has digest %s instead of %s", actual, digest)
+	}
+	return nil
+}
+
+// getDockerfile returns the Dockerfile of the code package
+func getDockerfile(codePackage []byte) ([]byte, error) {
+	gr, err := gzip.NewReader(bytes.NewReader(codePackage))
+	if err != nil {
+		return nil, fmt.Errorf("Error reading the code package: %s", err)
+	}
+	defer gr.Close()
+	tr := tar.NewReader(gr)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			return nil, fmt.Errorf("No Dockerfile in the code package")
+		}
+		if err != nil {
+			return nil, fmt.Errorf("Error reading the code package: %s", err)
+		}
+		if header.Name == "Dockerfile" {
+			return ioutil.ReadAll(tr)
+		}
+	}
+}
+
+// CheckPinnedBaseImages returns an error unless every base image of the
+// Dockerfile of the code package is pinned by digest, as in
+// FROM hyperledger/fabric-baseimage@sha256:<digest>, so that the toolchain
+// building the chaincode is the same on every peer
+func CheckPinnedBaseImages(codePackage []byte) error {
+	dockerfile, err := getDockerfile(codePackage)
+	if err != nil {
+		return err
+	}
+	scanner := bufio.NewScanner(bytes.NewReader(dockerfile))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 2 || strings.ToUpper(fields[0]) != "FROM" {
+			continue
+		}
+		if !strings.Contains(fields[1], "@sha256:") {
+			return fmt.Errorf("The base image %s of the chaincode is not pinned by digest", fields[1])
+		}
+	}
+	return scanner.Err()
+}
@@ -0,0 +1,67 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package container
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"testing"
+)
+
+// getDockerfilePackage returns a code package holding the Dockerfile
+func getDockerfilePackage(t *testing.T, dockerfile string) []byte {
+	buf := bytes.NewBuffer(nil)
+	gw := gzip.NewWriter(buf)
+	tw := tar.NewWriter(gw)
+	if err := tw.WriteHeader(&tar.Header{Name: "Dockerfile", Size: int64(len(dockerfile))}); err != nil {
+		t.Fatalf("Error writing the code package: %s", err)
+	}
+	tw.Write([]byte(dockerfile))
+	tw.Close()
+	gw.Close()
+	return buf.Bytes()
+}
+
+func TestBuildDigest(t *testing.T) {
+	code := getDockerfilePackage(t, "from hyperledger/fabric-baseimage\n")
+	digest := GetBuildDigest(code)
+	if len(digest) != 64 {
+		t.Fatalf("Expected a hex encoded SHA-256, got %s", digest)
+	}
+	if err := VerifyBuildDigest(code, digest); err != nil {
+		t.Errorf("Expected the digest of the package to be verified, got: %s", err)
+	}
+	if err := VerifyBuildDigest(getDockerfilePackage(t, "from busybox\n"), digest); err == nil {
+		t.Errorf("Expected the digest of another package to be refused")
+	}
+}
+
+func TestCheckPinnedBaseImages(t *testing.T) {
+	pinned := "FROM hyperledger/fabric-baseimage@sha256:8f3b2a2c\nRUN go install example\n"
+	if err := CheckPinnedBaseImages(getDockerfilePackage(t, pinned)); err != nil {
+		t.Errorf("Expected a pinned base image to be accepted, got: %s", err)
+	}
+	for _, dockerfile := range []string{"from hyperledger/fabric-baseimage\n", "FROM node:6\n", pinned + "FROM busybox:latest\n"} {
+		if err := CheckPinnedBaseImages(getDockerfilePackage(t, dockerfile)); err == nil {
+			t.Errorf("Expected the base image of %q to be refused", dockerfile)
+		}
+	}
+	if err := CheckPinnedBaseImages([]byte("not a package")); err == nil {
+		t.Errorf("Expected an invalid package to be refused")
+	}
+}
@@ -0,0 +1,120 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package util
+
+import (
+	"bufio"
+	"io"
+	"sync"
+
+	"github.com/hyperledger/fabric/core/util"
+	pb "github.com/hyperledger/fabric/protos"
+	"github.com/op/go-logging"
+	"github.com/spf13/viper"
+)
+
+var outputLogger = logging.MustGetLogger("ccoutput")
+
+const (
+	outputLinesDefault = 1000
+	// lines a slow follower may lag behind before lines are dropped for it
+	followerBacklog = 100
+)
+
+// chaincodeOutputs keeps the latest lines of the output of each chaincode,
+// and the channels of those following it
+type chaincodeOutputs struct {
+	sync.Mutex
+	lines     map[string][]*pb.ChaincodeLogEntry
+	followers map[string]map[chan *pb.ChaincodeLogEntry]bool
+}
+
+var outputs = &chaincodeOutputs{lines: make(map[string][]*pb.ChaincodeLogEntry), followers: make(map[string]map[chan *pb.ChaincodeLogEntry]bool)}
+
+func outputLinesKept() int {
+	if n := viper.GetInt("chaincode.output.lines"); n > 0 {
+		return n
+	}
+	return outputLinesDefault
+}
+
+//LogChaincodeOutput logs the lines of output, the stdout and stderr of the
+//chaincode, tagged with its name, and keeps them for GetChaincodeOutput. It
+//returns once output is exhausted
+func LogChaincodeOutput(chaincode string, output io.Reader) {
+	scanner := bufio.NewScanner(output)
+	for scanner.Scan() {
+		outputLogger.Infof("[%s] %s", chaincode, scanner.Text())
+		outputs.add(&pb.ChaincodeLogEntry{Chaincode: chaincode, Timestamp: util.CreateUtcTimestamp(), Line: scanner.Text()})
+	}
+}
+
+func (o *chaincodeOutputs) add(entry *pb.ChaincodeLogEntry) {
+	o.Lock()
+	defer o.Unlock()
+	lines := append(o.lines[entry.Chaincode], entry)
+	if max := outputLinesKept(); len(lines) > max {
+		lines = append([]*pb.ChaincodeLogEntry(nil), lines[len(lines)-max:]...)
+	}
+	o.lines[entry.Chaincode] = lines
+	for c := range o.followers[entry.Chaincode] {
+		select {
+		case c <- entry:
+		default:
+			//never hold the chaincode up for a slow follower
+		}
+	}
+}
+
+//GetChaincodeOutput returns the last tail lines kept of the output of the
+//chaincode, all of them if tail is 0
+func GetChaincodeOutput(chaincode string, tail int) []*pb.ChaincodeLogEntry {
+	outputs.Lock()
+	defer outputs.Unlock()
+	return outputs.tail(chaincode, tail)
+}
+
+//call this under lock
+func (o *chaincodeOutputs) tail(chaincode string, tail int) []*pb.ChaincodeLogEntry {
+	lines := o.lines[chaincode]
+	if tail > 0 && tail < len(lines) {
+		lines = lines[len(lines)-tail:]
+	}
+	result := make([]*pb.ChaincodeLogEntry, len(lines))
+	copy(result, lines)
+	return result
+}
+
+//FollowChaincodeOutput is GetChaincodeOutput also returning a channel
+//receiving the lines the chaincode writes next, until stop is called
+func FollowChaincodeOutput(chaincode string, tail int) (lines []*pb.ChaincodeLogEntry, next <-chan *pb.ChaincodeLogEntry, stop func()) {
+	outputs.Lock()
+	defer outputs.Unlock()
+	c := make(chan *pb.ChaincodeLogEntry, followerBacklog)
+	if outputs.followers[chaincode] == nil {
+		outputs.followers[chaincode] = make(map[chan *pb.ChaincodeLogEntry]bool)
+	}
+	outputs.followers[chaincode][c] = true
+	stop = func() {
+		outputs.Lock()
+		defer outputs.Unlock()
+		delete(outputs.followers[chaincode], c)
+		if len(outputs.followers[chaincode]) == 0 {
+			delete(outputs.followers, chaincode)
+		}
+	}
+	return outputs.tail(chaincode, tail), c, stop
+}
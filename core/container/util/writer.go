@@ -144,6 +144,11 @@ func WriteStreamToPackage(is io.Reader, localpath string, packagepath string, tw
 	header.AccessTime = zeroTime
 	header.ModTime = zeroTime
 	header.ChangeTime = zeroTime
+	//nor the owner, which differs from host to host
+	header.Uid = 0
+	header.Gid = 0
+	header.Uname = ""
+	header.Gname = ""
 	header.Name = packagepath
 
 	if err = tw.WriteHeader(header); err != nil {
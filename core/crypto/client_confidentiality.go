@@ -21,6 +21,7 @@ import (
 	"encoding/asn1"
 	"errors"
 
+	"github.com/golang/protobuf/proto"
 	"github.com/hyperledger/fabric/core/crypto/primitives"
 	"github.com/hyperledger/fabric/core/crypto/utils"
 	obc "github.com/hyperledger/fabric/protos"
@@ -170,3 +171,35 @@ func (client *clientImpl) encryptTxVersion1_2(tx *obc.Transaction) error {
 
 	return nil
 }
+
+// encryptCtorMsg returns a copy of the deployment spec whose constructor
+// message is encrypted under the chain key, so that only the validators can
+// read the init arguments, whatever the confidentiality level of the tx.
+func (client *clientImpl) encryptCtorMsg(spec *obc.ChaincodeDeploymentSpec) (*obc.ChaincodeDeploymentSpec, error) {
+	raw, err := proto.Marshal(spec.ChaincodeSpec.CtorMsg)
+	if err != nil {
+		client.Errorf("Failed marshalling constructor message: [%s]", err)
+
+		return nil, err
+	}
+
+	cipher, err := client.eciesSPI.NewAsymmetricCipherFromPublicKey(client.chainPublicKey)
+	if err != nil {
+		client.Errorf("Failed creating new encryption scheme: [%s]", err)
+
+		return nil, err
+	}
+
+	encCtorMsg, err := cipher.Process(raw)
+	if err != nil {
+		client.Errorf("Failed encrypting constructor message: [%s]", err)
+
+		return nil, err
+	}
+
+	clone := proto.Clone(spec).(*obc.ChaincodeDeploymentSpec)
+	clone.ChaincodeSpec.CtorMsg = nil
+	clone.EncryptedCtorMsg = encCtorMsg
+
+	return clone, nil
+}
@@ -36,6 +36,16 @@ func (client *clientImpl) createTransactionNonce() ([]byte, error) {
 }
 
 func (client *clientImpl) createDeployTx(chaincodeDeploymentSpec *obc.ChaincodeDeploymentSpec, uuid string, nonce []byte, tCert tCert, attrs ...string) (*obc.Transaction, error) {
+	// Encrypt the init arguments for the validators
+	if chaincodeDeploymentSpec.ChaincodeSpec.EncryptCtorMsg {
+		var err error
+		chaincodeDeploymentSpec, err = client.encryptCtorMsg(chaincodeDeploymentSpec)
+		if err != nil {
+			client.Errorf("Failed encrypting constructor message [%s].", err.Error())
+			return nil, err
+		}
+	}
+
 	// Create a new transaction
 	tx, err := obc.NewChaincodeDeployTransaction(chaincodeDeploymentSpec, uuid)
 	if err != nil {
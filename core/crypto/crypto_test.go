@@ -34,6 +34,7 @@ import (
 	"runtime"
 	"time"
 
+	"github.com/golang/protobuf/proto"
 	"github.com/hyperledger/fabric/core/crypto/attributes"
 	"github.com/hyperledger/fabric/core/crypto/primitives"
 	"github.com/hyperledger/fabric/core/crypto/utils"
@@ -1092,6 +1093,64 @@ func TestValidatorDeployTransaction(t *testing.T) {
 	}
 }
 
+func TestValidatorEncryptedCtorMsg(t *testing.T) {
+	initNodes()
+	defer closeNodes()
+
+	ctorMsg := &obc.ChaincodeInput{Function: "init", Args: []string{"secret"}}
+
+	for _, level := range []obc.ConfidentialityLevel{obc.ConfidentialityLevel_PUBLIC, obc.ConfidentialityLevel_CONFIDENTIAL} {
+		t.Logf("TestValidatorEncryptedCtorMsg with [%s]\n", level)
+
+		cds := &obc.ChaincodeDeploymentSpec{
+			ChaincodeSpec: &obc.ChaincodeSpec{
+				Type:                 obc.ChaincodeSpec_GOLANG,
+				ChaincodeID:          &obc.ChaincodeID{Path: "Contract001"},
+				CtorMsg:              ctorMsg,
+				ConfidentialityLevel: level,
+				EncryptCtorMsg:       true,
+			},
+		}
+
+		tx, err := deployer.NewChaincodeDeployTransaction(cds, util.GenerateUUID(), attrs...)
+		if err != nil {
+			t.Fatalf("Failed creating deploy transaction [%s].", err)
+		}
+		if cds.ChaincodeSpec.CtorMsg != ctorMsg {
+			t.Fatalf("The deployment spec of the caller must not be modified")
+		}
+
+		if level == obc.ConfidentialityLevel_PUBLIC {
+			onChain := &obc.ChaincodeDeploymentSpec{}
+			if err := proto.Unmarshal(tx.Payload, onChain); err != nil {
+				t.Fatalf("Failed unmarshalling payload [%s].", err)
+			}
+			if onChain.ChaincodeSpec.CtorMsg != nil {
+				t.Fatalf("Constructor message must not be in plaintext")
+			}
+			if len(onChain.EncryptedCtorMsg) == 0 {
+				t.Fatalf("Encrypted constructor message must be set")
+			}
+		}
+
+		res, err := validator.TransactionPreExecution(tx)
+		if err != nil {
+			t.Fatalf("Error must be nil [%s].", err)
+		}
+
+		decrypted := &obc.ChaincodeDeploymentSpec{}
+		if err := proto.Unmarshal(res.Payload, decrypted); err != nil {
+			t.Fatalf("Failed unmarshalling payload [%s].", err)
+		}
+		if !reflect.DeepEqual(decrypted.ChaincodeSpec.CtorMsg, ctorMsg) {
+			t.Fatalf("Decrypted constructor message differs from the original: [%v]", decrypted.ChaincodeSpec.CtorMsg)
+		}
+		if len(decrypted.EncryptedCtorMsg) != 0 {
+			t.Fatalf("Encrypted constructor message must be cleared")
+		}
+	}
+}
+
 func TestValidatorExecuteTransaction(t *testing.T) {
 	initNodes()
 	defer closeNodes()
@@ -133,3 +133,59 @@ func (validator *validatorImpl) deepCloneAndDecryptTx1_2(tx *obc.Transaction) (*
 
 	return clone, nil
 }
+
+// decryptCtorMsg returns a copy of a deploy transaction whose constructor
+// message was encrypted under the chain key, with the init arguments restored.
+// Any other transaction is returned untouched.
+func (validator *validatorImpl) decryptCtorMsg(tx *obc.Transaction) (*obc.Transaction, error) {
+	if tx.Type != obc.Transaction_CHAINCODE_DEPLOY {
+		return tx, nil
+	}
+
+	cds := &obc.ChaincodeDeploymentSpec{}
+	err := proto.Unmarshal(tx.Payload, cds)
+	if err != nil {
+		validator.Errorf("Failed unmarshalling deployment spec [%s].", err.Error())
+		return nil, err
+	}
+	if len(cds.EncryptedCtorMsg) == 0 {
+		return tx, nil
+	}
+	if cds.ChaincodeSpec == nil {
+		return nil, errors.New("Failed decrypting constructor message. Missing chaincode spec.")
+	}
+
+	cipher, err := validator.eciesSPI.NewAsymmetricCipherFromPrivateKey(validator.chainPrivateKey)
+	if err != nil {
+		validator.Errorf("Failed init decryption engine [%s].", err.Error())
+		return nil, err
+	}
+
+	raw, err := cipher.Process(cds.EncryptedCtorMsg)
+	if err != nil {
+		validator.Errorf("Failed decrypting constructor message [%s].", err.Error())
+		return nil, err
+	}
+
+	ctorMsg := &obc.ChaincodeInput{}
+	err = proto.Unmarshal(raw, ctorMsg)
+	if err != nil {
+		validator.Errorf("Failed unmarshalling constructor message [%s].", err.Error())
+		return nil, err
+	}
+	cds.ChaincodeSpec.CtorMsg = ctorMsg
+	cds.EncryptedCtorMsg = nil
+
+	clone, err := validator.deepCloneTransaction(tx)
+	if err != nil {
+		validator.Errorf("Failed deep cloning [%s].", err.Error())
+		return nil, err
+	}
+	clone.Payload, err = proto.Marshal(cds)
+	if err != nil {
+		validator.Errorf("Failed marshalling deployment spec [%s].", err.Error())
+		return nil, err
+	}
+
+	return clone, nil
+}
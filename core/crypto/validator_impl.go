@@ -60,9 +60,9 @@ func (validator *validatorImpl) TransactionPreExecution(tx *obc.Transaction) (*o
 
 	switch tx.ConfidentialityLevel {
 	case obc.ConfidentialityLevel_PUBLIC:
-		// Nothing to do here!
+		// Only the init arguments may need decrypting
 
-		return tx, nil
+		return validator.decryptCtorMsg(tx)
 	case obc.ConfidentialityLevel_CONFIDENTIAL:
 		validator.Debug("Clone and Decrypt.")
 
@@ -74,7 +74,7 @@ func (validator *validatorImpl) TransactionPreExecution(tx *obc.Transaction) (*o
 			return nil, err
 		}
 
-		return newTx, nil
+		return validator.decryptCtorMsg(newTx)
 	default:
 		return nil, utils.ErrInvalidConfidentialityLevel
 	}
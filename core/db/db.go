@@ -20,7 +20,8 @@ import (
 	"fmt"
 	"io"
 	"os"
-	"path"
+	"path/filepath"
+	"sort"
 	"strings"
 	"sync"
 
@@ -31,18 +32,23 @@ import (
 
 var dbLogger = logging.MustGetLogger("db")
 
+// DefaultCF is the column family every store has, which the ledger does not use
+const DefaultCF ColumnFamily = "default"
+
 const blockchainCF = "blockchainCF"
 const stateCF = "stateCF"
 const stateDeltaCF = "stateDeltaCF"
 const indexesCF = "indexesCF"
 const persistCF = "persistCF"
+const privateDataCF = "privateDataCF"
 
 var columnfamilies = []string{
-	blockchainCF, // blocks of the block chain
-	stateCF,      // world state
-	stateDeltaCF, // open transaction state
-	indexesCF,    // tx uuid -> blockno
-	persistCF,    // persistent per-peer state (consensus)
+	blockchainCF,  // blocks of the block chain
+	stateCF,       // world state
+	stateDeltaCF,  // open transaction state
+	indexesCF,     // tx uuid -> blockno
+	persistCF,     // persistent per-peer state (consensus)
+	privateDataCF, // private data of the chaincodes, out of the world state
 }
 
 type dbState int32
@@ -52,23 +58,41 @@ const (
 	opened
 )
 
-// OpenchainDB encapsulates rocksdb's structures
+// OpenchainDB encapsulates the store the ledger is kept in, which is RocksDB
+// unless 'peer.db.backend' selects another one
 type OpenchainDB struct {
-	DB           *gorocksdb.DB
-	BlockchainCF *gorocksdb.ColumnFamilyHandle
-	StateCF      *gorocksdb.ColumnFamilyHandle
-	StateDeltaCF *gorocksdb.ColumnFamilyHandle
-	IndexesCF    *gorocksdb.ColumnFamilyHandle
-	PersistCF    *gorocksdb.ColumnFamilyHandle
-	dbState      dbState
-	mux          sync.Mutex
+	store         Store
+	backend       string
+	BlockchainCF  ColumnFamily
+	StateCF       ColumnFamily
+	StateDeltaCF  ColumnFamily
+	IndexesCF     ColumnFamily
+	PersistCF     ColumnFamily
+	PrivateDataCF ColumnFamily
+	dbState       dbState
+	mux           sync.Mutex
+	path          string // the path of the store, that of the default chain if empty
 }
 
 var openchainDB = Create()
 
+// DefaultChainID is the ID of the chain kept in the DB of GetDBHandle
+const DefaultChainID = ""
+
+var chainDBs = make(map[string]*OpenchainDB)
+var chainDBsLock sync.Mutex
+
 // Create create an openchainDB instance
 func Create() *OpenchainDB {
-	return &OpenchainDB{dbState: closed}
+	return &OpenchainDB{
+		BlockchainCF:  blockchainCF,
+		StateCF:       stateCF,
+		StateDeltaCF:  stateDeltaCF,
+		IndexesCF:     indexesCF,
+		PersistCF:     persistCF,
+		PrivateDataCF: privateDataCF,
+		dbState:       closed,
+	}
 }
 
 // GetDBHandle get an opened openchainDB singleton
@@ -77,14 +101,63 @@ func GetDBHandle() *OpenchainDB {
 	return openchainDB
 }
 
+// GetChainDBHandle returns the opened openchainDB a chain is kept in. The default chain is kept in the
+// openchainDB singleton of GetDBHandle, each of the others in its own store under 'peer.fileSystemPath'/chains,
+// so that the chains share no blocks, state nor indexes. The chain ID must be usable as a directory name
+func GetChainDBHandle(chainID string) *OpenchainDB {
+	if chainID == DefaultChainID {
+		return GetDBHandle()
+	}
+	chainDBsLock.Lock()
+	chainDB, ok := chainDBs[chainID]
+	if !ok {
+		chainDB = Create()
+		chainDB.path = getChainDBPath(chainID)
+		chainDBs[chainID] = chainDB
+	}
+	chainDBsLock.Unlock()
+	chainDB.Open()
+	return chainDB
+}
+
+// GetChainIDs returns the IDs of the chains other than the default one which have been opened or have
+// a store under 'peer.fileSystemPath'/chains
+func GetChainIDs() ([]string, error) {
+	chainIDs := make(map[string]bool)
+	chainDBsLock.Lock()
+	for chainID := range chainDBs {
+		chainIDs[chainID] = true
+	}
+	chainDBsLock.Unlock()
+	dir, err := os.Open(getChainsDirPath())
+	if err == nil {
+		names, err := dir.Readdirnames(-1)
+		dir.Close()
+		if err != nil {
+			return nil, err
+		}
+		for _, name := range names {
+			chainIDs[name] = true
+		}
+	} else if !os.IsNotExist(err) {
+		return nil, err
+	}
+	var result []string
+	for chainID := range chainIDs {
+		result = append(result, chainID)
+	}
+	sort.Strings(result)
+	return result, nil
+}
+
 // GetFromBlockchainCF get value for given key from column family - blockchainCF
 func (openchainDB *OpenchainDB) GetFromBlockchainCF(key []byte) ([]byte, error) {
 	return openchainDB.Get(openchainDB.BlockchainCF, key)
 }
 
 // GetFromBlockchainCFSnapshot get value for given key from column family in a DB snapshot - blockchainCF
-func (openchainDB *OpenchainDB) GetFromBlockchainCFSnapshot(snapshot *gorocksdb.Snapshot, key []byte) ([]byte, error) {
-	return openchainDB.getFromSnapshot(snapshot, openchainDB.BlockchainCF, key)
+func (openchainDB *OpenchainDB) GetFromBlockchainCFSnapshot(snapshot Snapshot, key []byte) ([]byte, error) {
+	return snapshot.Get(openchainDB.BlockchainCF, key)
 }
 
 // GetFromStateCF get value for given key from column family - stateCF
@@ -102,32 +175,65 @@ func (openchainDB *OpenchainDB) GetFromIndexesCF(key []byte) ([]byte, error) {
 	return openchainDB.Get(openchainDB.IndexesCF, key)
 }
 
+// GetFromPrivateDataCF get value for given key from column family - privateDataCF
+func (openchainDB *OpenchainDB) GetFromPrivateDataCF(key []byte) ([]byte, error) {
+	return openchainDB.Get(openchainDB.PrivateDataCF, key)
+}
+
 // GetBlockchainCFIterator get iterator for column family - blockchainCF
-func (openchainDB *OpenchainDB) GetBlockchainCFIterator() *gorocksdb.Iterator {
+func (openchainDB *OpenchainDB) GetBlockchainCFIterator() Iterator {
 	return openchainDB.GetIterator(openchainDB.BlockchainCF)
 }
 
 // GetStateCFIterator get iterator for column family - stateCF
-func (openchainDB *OpenchainDB) GetStateCFIterator() *gorocksdb.Iterator {
+func (openchainDB *OpenchainDB) GetStateCFIterator() Iterator {
 	return openchainDB.GetIterator(openchainDB.StateCF)
 }
 
 // GetStateCFSnapshotIterator get iterator for column family - stateCF. This iterator
 // is based on a snapshot and should be used for long running scans, such as
 // reading the entire state. Remember to call iterator.Close() when you are done.
-func (openchainDB *OpenchainDB) GetStateCFSnapshotIterator(snapshot *gorocksdb.Snapshot) *gorocksdb.Iterator {
-	return openchainDB.getSnapshotIterator(snapshot, openchainDB.StateCF)
+func (openchainDB *OpenchainDB) GetStateCFSnapshotIterator(snapshot Snapshot) Iterator {
+	return openchainDB.GetSnapshotIterator(snapshot, openchainDB.StateCF)
 }
 
 // GetStateDeltaCFIterator get iterator for column family - stateDeltaCF
-func (openchainDB *OpenchainDB) GetStateDeltaCFIterator() *gorocksdb.Iterator {
+func (openchainDB *OpenchainDB) GetStateDeltaCFIterator() Iterator {
 	return openchainDB.GetIterator(openchainDB.StateDeltaCF)
 }
 
 // GetSnapshot returns a point-in-time view of the DB. You MUST call snapshot.Release()
 // when you are done with the snapshot.
-func (openchainDB *OpenchainDB) GetSnapshot() *gorocksdb.Snapshot {
-	return openchainDB.DB.NewSnapshot()
+func (openchainDB *OpenchainDB) GetSnapshot() Snapshot {
+	return openchainDB.store.NewSnapshot()
+}
+
+// RocksDB returns the RocksDB database the ledger is kept in, or nil if it is kept in
+// another store. This is only meant for tools which inspect RocksDB itself.
+func (openchainDB *OpenchainDB) RocksDB() *gorocksdb.DB {
+	if store, ok := openchainDB.store.(*rocksDBStore); ok {
+		return store.db
+	}
+	return nil
+}
+
+// RocksDBColumnFamily returns the handle of a column family of the RocksDB database
+// the ledger is kept in, or nil if it is kept in another store
+func (openchainDB *OpenchainDB) RocksDBColumnFamily(cf ColumnFamily) *gorocksdb.ColumnFamilyHandle {
+	if store, ok := openchainDB.store.(*rocksDBStore); ok {
+		return store.cfHandles[cf]
+	}
+	return nil
+}
+
+// GetStats returns the backend of the store and its current statistics, by name,
+// for diagnosing the I/O of the ledger
+func (openchainDB *OpenchainDB) GetStats() (string, map[string]float64, error) {
+	statsStore, ok := openchainDB.store.(StatsStore)
+	if !ok {
+		return openchainDB.backend, nil, fmt.Errorf("The %s DB backend does not report statistics", openchainDB.backend)
+	}
+	return openchainDB.backend, statsStore.Stats(), nil
 }
 
 func getDBPath() string {
@@ -141,7 +247,15 @@ func getDBPath() string {
 	return dbPath + "db"
 }
 
-// Open open underlying rocksdb
+func getChainsDirPath() string {
+	return filepath.Join(filepath.Dir(getDBPath()), "chains")
+}
+
+func getChainDBPath(chainID string) string {
+	return filepath.Join(getChainsDirPath(), chainID, "db")
+}
+
+// Open open underlying store
 func (openchainDB *OpenchainDB) Open() {
 	openchainDB.mux.Lock()
 	if openchainDB.dbState == opened {
@@ -151,49 +265,34 @@ func (openchainDB *OpenchainDB) Open() {
 
 	defer openchainDB.mux.Unlock()
 
-	dbPath := getDBPath()
-	missing, err := dirMissingOrEmpty(dbPath)
-	if err != nil {
-		panic(fmt.Sprintf("Error while trying to open DB: %s", err))
+	dbPath := openchainDB.path
+	if dbPath == "" {
+		dbPath = getDBPath()
 	}
-	dbLogger.Debugf("Is db path [%s] empty [%t]", dbPath, missing)
-
-	if missing {
-		err = os.MkdirAll(path.Dir(dbPath), 0755)
-		if err != nil {
-			panic(fmt.Sprintf("Error making directory path [%s]: %s", dbPath, err))
-		}
+	backend := viper.GetString("peer.db.backend")
+	store, err := newStore(backend)
+	if err != nil {
+		panic(err.Error())
 	}
-
-	opts := gorocksdb.NewDefaultOptions()
-	defer opts.Destroy()
-
-	opts.SetCreateIfMissing(missing)
-	opts.SetCreateIfMissingColumnFamilies(true)
-
-	cfNames := []string{"default"}
-	cfNames = append(cfNames, columnfamilies...)
-	var cfOpts []*gorocksdb.Options
-	for range cfNames {
-		cfOpts = append(cfOpts, opts)
+	var cfs []ColumnFamily
+	for _, cf := range columnfamilies {
+		cfs = append(cfs, ColumnFamily(cf))
 	}
-
-	db, cfHandlers, err := gorocksdb.OpenDbColumnFamilies(opts, dbPath, cfNames, cfOpts)
-
+	err = store.Open(dbPath, cfs)
 	if err != nil {
-		panic(fmt.Sprintf("Error opening DB: %s", err))
+		panic(err.Error())
 	}
+	dbLogger.Debugf("Opened DB at [%s] with backend [%s]", dbPath, backend)
 
-	openchainDB.DB = db
-	openchainDB.BlockchainCF = cfHandlers[1]
-	openchainDB.StateCF = cfHandlers[2]
-	openchainDB.StateDeltaCF = cfHandlers[3]
-	openchainDB.IndexesCF = cfHandlers[4]
-	openchainDB.PersistCF = cfHandlers[5]
+	openchainDB.store = store
+	openchainDB.backend = backend
+	if openchainDB.backend == "" {
+		openchainDB.backend = "rocksdb"
+	}
 	openchainDB.dbState = opened
 }
 
-// Close releases all column family handles and closes rocksdb
+// Close closes the underlying store
 func (openchainDB *OpenchainDB) Close() {
 	openchainDB.mux.Lock()
 	if openchainDB.dbState == closed {
@@ -202,12 +301,7 @@ func (openchainDB *OpenchainDB) Close() {
 	}
 
 	defer openchainDB.mux.Unlock()
-	openchainDB.BlockchainCF.Destroy()
-	openchainDB.StateCF.Destroy()
-	openchainDB.StateDeltaCF.Destroy()
-	openchainDB.IndexesCF.Destroy()
-	openchainDB.PersistCF.Destroy()
-	openchainDB.DB.Close()
+	openchainDB.store.Close()
 	openchainDB.dbState = closed
 }
 
@@ -215,100 +309,60 @@ func (openchainDB *OpenchainDB) Close() {
 // only used during state synchronization when creating a new state from
 // a snapshot.
 func (openchainDB *OpenchainDB) DeleteState() error {
-	err := openchainDB.DB.DropColumnFamily(openchainDB.StateCF)
+	err := openchainDB.store.DeleteColumnFamily(openchainDB.StateCF)
 	if err != nil {
-		dbLogger.Errorf("Error dropping state CF: %s", err)
+		dbLogger.Errorf("Error deleting state CF: %s", err)
 		return err
 	}
-	err = openchainDB.DB.DropColumnFamily(openchainDB.StateDeltaCF)
+	err = openchainDB.store.DeleteColumnFamily(openchainDB.StateDeltaCF)
 	if err != nil {
-		dbLogger.Errorf("Error dropping state delta CF: %s", err)
-		return err
-	}
-	opts := gorocksdb.NewDefaultOptions()
-	defer opts.Destroy()
-	openchainDB.StateCF, err = openchainDB.DB.CreateColumnFamily(opts, stateCF)
-	if err != nil {
-		dbLogger.Errorf("Error creating state CF: %s", err)
-		return err
-	}
-	openchainDB.StateDeltaCF, err = openchainDB.DB.CreateColumnFamily(opts, stateDeltaCF)
-	if err != nil {
-		dbLogger.Errorf("Error creating state delta CF: %s", err)
+		dbLogger.Errorf("Error deleting state delta CF: %s", err)
 		return err
 	}
 	return nil
 }
 
 // Get returns the valud for the given column family and key
-func (openchainDB *OpenchainDB) Get(cfHandler *gorocksdb.ColumnFamilyHandle, key []byte) ([]byte, error) {
-	opt := gorocksdb.NewDefaultReadOptions()
-	defer opt.Destroy()
-	slice, err := openchainDB.DB.GetCF(opt, cfHandler, key)
-	if err != nil {
-		fmt.Println("Error while trying to retrieve key:", key)
-		return nil, err
-	}
-	defer slice.Free()
-	if slice.Data() == nil {
-		return nil, nil
-	}
-	data := makeCopy(slice.Data())
-	return data, nil
+func (openchainDB *OpenchainDB) Get(cf ColumnFamily, key []byte) ([]byte, error) {
+	return openchainDB.store.Get(cf, key)
 }
 
 // Put saves the key/value in the given column family
-func (openchainDB *OpenchainDB) Put(cfHandler *gorocksdb.ColumnFamilyHandle, key []byte, value []byte) error {
-	opt := gorocksdb.NewDefaultWriteOptions()
-	defer opt.Destroy()
-	err := openchainDB.DB.PutCF(opt, cfHandler, key, value)
-	if err != nil {
-		fmt.Println("Error while trying to write key:", key)
-		return err
-	}
-	return nil
+func (openchainDB *OpenchainDB) Put(cf ColumnFamily, key []byte, value []byte) error {
+	return openchainDB.store.Put(cf, key, value)
 }
 
 // Delete delets the given key in the specified column family
-func (openchainDB *OpenchainDB) Delete(cfHandler *gorocksdb.ColumnFamilyHandle, key []byte) error {
-	opt := gorocksdb.NewDefaultWriteOptions()
-	defer opt.Destroy()
-	err := openchainDB.DB.DeleteCF(opt, cfHandler, key)
-	if err != nil {
-		fmt.Println("Error while trying to delete key:", key)
-		return err
-	}
-	return nil
+func (openchainDB *OpenchainDB) Delete(cf ColumnFamily, key []byte) error {
+	return openchainDB.store.Delete(cf, key)
 }
 
-func (openchainDB *OpenchainDB) getFromSnapshot(snapshot *gorocksdb.Snapshot, cfHandler *gorocksdb.ColumnFamilyHandle, key []byte) ([]byte, error) {
-	opt := gorocksdb.NewDefaultReadOptions()
-	defer opt.Destroy()
-	opt.SetSnapshot(snapshot)
-	slice, err := openchainDB.DB.GetCF(opt, cfHandler, key)
-	if err != nil {
-		fmt.Println("Error while trying to retrieve key:", key)
-		return nil, err
-	}
-	defer slice.Free()
-	data := append([]byte(nil), slice.Data()...)
-	return data, nil
+// NewWriteBatch returns a batch of changes to be written together by Write. You MUST
+// call writeBatch.Destroy() when you are done with the batch.
+func (openchainDB *OpenchainDB) NewWriteBatch() WriteBatch {
+	return openchainDB.store.NewWriteBatch()
+}
+
+// Write writes all the changes of the batch atomically
+func (openchainDB *OpenchainDB) Write(writeBatch WriteBatch) error {
+	return openchainDB.store.Write(writeBatch)
+}
+
+// WriteSync writes all the changes of the batch atomically, and returns once they are
+// durable. The ledger commits the blocks this way, along with their state and indexes
+func (openchainDB *OpenchainDB) WriteSync(writeBatch WriteBatch) error {
+	return openchainDB.store.WriteSync(writeBatch)
 }
 
 // GetIterator returns an iterator for the given column family
-func (openchainDB *OpenchainDB) GetIterator(cfHandler *gorocksdb.ColumnFamilyHandle) *gorocksdb.Iterator {
-	opt := gorocksdb.NewDefaultReadOptions()
-	opt.SetFillCache(true)
-	defer opt.Destroy()
-	return openchainDB.DB.NewIteratorCF(opt, cfHandler)
-}
-
-func (openchainDB *OpenchainDB) getSnapshotIterator(snapshot *gorocksdb.Snapshot, cfHandler *gorocksdb.ColumnFamilyHandle) *gorocksdb.Iterator {
-	opt := gorocksdb.NewDefaultReadOptions()
-	defer opt.Destroy()
-	opt.SetSnapshot(snapshot)
-	iter := openchainDB.DB.NewIteratorCF(opt, cfHandler)
-	return iter
+func (openchainDB *OpenchainDB) GetIterator(cf ColumnFamily) Iterator {
+	return openchainDB.store.NewIterator(cf)
+}
+
+// GetSnapshotIterator returns an iterator for the given column family as of
+// the snapshot. Remember to call iterator.Close() when you are done.
+func (openchainDB *OpenchainDB) GetSnapshotIterator(snapshot Snapshot, cf ColumnFamily) Iterator {
+	return snapshot.NewIterator(cf)
 }
 
 func dirMissingOrEmpty(path string) (bool, error) {
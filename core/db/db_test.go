@@ -23,7 +23,6 @@ import (
 	"testing"
 
 	"github.com/spf13/viper"
-	"github.com/tecbot/gorocksdb"
 )
 
 func TestMain(m *testing.M) {
@@ -134,6 +133,37 @@ func TestDeleteState(t *testing.T) {
 	}
 }
 
+func TestChainDBs(t *testing.T) {
+	testDBWrapper := NewTestDBWrapper()
+	testDBWrapper.CleanDB(t)
+	defer testDBWrapper.removeDBPath()
+	defer testDBWrapper.cleanup()
+	if GetChainDBHandle(DefaultChainID) != GetDBHandle() {
+		t.Fatalf("Expected the default chain to be kept in the DB singleton")
+	}
+	chainDB := GetChainDBHandle("chain1")
+	if GetChainDBHandle("chain1") != chainDB {
+		t.Fatalf("Expected the same DB for the same chain")
+	}
+	chainDB.Put(chainDB.StateCF, []byte("key1"), []byte("value1"))
+	if value, _ := GetChainDBHandle("chain2").GetFromStateCF([]byte("key1")); value != nil {
+		t.Fatalf("Expected the key of chain1 not to be in chain2. Found [%s]", value)
+	}
+	if value, _ := GetDBHandle().GetFromStateCF([]byte("key1")); value != nil {
+		t.Fatalf("Expected the key of chain1 not to be in the default chain. Found [%s]", value)
+	}
+	if value, _ := chainDB.GetFromStateCF([]byte("key1")); !bytes.Equal(value, []byte("value1")) {
+		t.Fatalf("Expected [value1] in chain1. Found [%s]", value)
+	}
+	chainIDs, err := GetChainIDs()
+	if err != nil {
+		t.Fatalf("Error listing the chains: %s", err)
+	}
+	if len(chainIDs) != 2 || chainIDs[0] != "chain1" || chainIDs[1] != "chain2" {
+		t.Fatalf("Expected the chains [chain1 chain2]. Found %v", chainIDs)
+	}
+}
+
 func TestDBSnapshot(t *testing.T) {
 	testDBWrapper := NewTestDBWrapper()
 	testDBWrapper.CleanDB(t)
@@ -229,14 +259,12 @@ func TestDBIteratorAndSnapshotIterator(t *testing.T) {
 }
 
 // db helper functions
-func testIterator(t *testing.T, itr *gorocksdb.Iterator, expectedValues map[string][]byte) {
+func testIterator(t *testing.T, itr Iterator, expectedValues map[string][]byte) {
 	itrResults := make(map[string][]byte)
 	itr.SeekToFirst()
 	for ; itr.Valid(); itr.Next() {
-		key := itr.Key()
-		value := itr.Value()
-		k := makeCopy(key.Data())
-		v := makeCopy(value.Data())
+		k := makeCopy(itr.Key())
+		v := makeCopy(itr.Value())
 		itrResults[string(k)] = v
 	}
 	if len(itrResults) != len(expectedValues) {
@@ -269,15 +297,13 @@ func setupTestConfig() {
 }
 
 func performBasicReadWrite(openchainDB *OpenchainDB, t *testing.T) {
-	opt := gorocksdb.NewDefaultWriteOptions()
-	defer opt.Destroy()
-	writeBatch := gorocksdb.NewWriteBatch()
+	writeBatch := openchainDB.NewWriteBatch()
 	defer writeBatch.Destroy()
 	writeBatch.PutCF(openchainDB.BlockchainCF, []byte("dummyKey"), []byte("dummyValue"))
 	writeBatch.PutCF(openchainDB.StateCF, []byte("dummyKey1"), []byte("dummyValue1"))
 	writeBatch.PutCF(openchainDB.StateDeltaCF, []byte("dummyKey2"), []byte("dummyValue2"))
 	writeBatch.PutCF(openchainDB.IndexesCF, []byte("dummyKey3"), []byte("dummyValue3"))
-	err := openchainDB.DB.Write(opt, writeBatch)
+	err := openchainDB.Write(writeBatch)
 	if err != nil {
 		t.Fatalf("Error while writing to db: %s", err)
 	}
@@ -313,3 +339,52 @@ func performBasicReadWrite(openchainDB *OpenchainDB, t *testing.T) {
 		t.Fatalf("read error. Bytes not equal. Expected [%s], found [%s]", "dummyValue3", value)
 	}
 }
+
+func TestRocksDBOptions(t *testing.T) {
+	viper.Set("peer.db.rocksdb.blockCacheSize", 8)
+	viper.Set("peer.db.rocksdb.bloomFilterBitsPerKey", 10)
+	viper.Set("peer.db.rocksdb.compactionStyle", "universal")
+	viper.Set("peer.db.rocksdb.statistics", true)
+	defer func() {
+		viper.Set("peer.db.rocksdb.blockCacheSize", 0)
+		viper.Set("peer.db.rocksdb.bloomFilterBitsPerKey", 0)
+		viper.Set("peer.db.rocksdb.compactionStyle", "")
+		viper.Set("peer.db.rocksdb.statistics", false)
+	}()
+	testDBWrapper := NewTestDBWrapper()
+	testDBWrapper.CleanDB(t)
+	openchainDB := GetDBHandle()
+	defer testDBWrapper.cleanup()
+	performBasicReadWrite(openchainDB, t)
+
+	backend, stats, err := openchainDB.GetStats()
+	if err != nil {
+		t.Fatalf("Error getting stats: %s", err)
+	}
+	if backend != "rocksdb" {
+		t.Fatalf("Expected backend [%s], found [%s]", "rocksdb", backend)
+	}
+	if _, ok := stats["stateCF.numKeys"]; !ok {
+		t.Fatalf("Expected the number of keys of stateCF in the stats, found %v", stats)
+	}
+}
+
+func TestRocksDBInvalidCompactionStyle(t *testing.T) {
+	viper.Set("peer.db.rocksdb.compactionStyle", "sideways")
+	defer viper.Set("peer.db.rocksdb.compactionStyle", "")
+	store := newRocksDBStore()
+	if err := store.Open(getDBPath(), nil); err == nil {
+		store.Close()
+		t.Fatalf("An error expected for an invalid compaction style")
+	}
+}
+
+func TestParseRocksDBTickers(t *testing.T) {
+	tickers := parseRocksDBTickers(`rocksdb.block.cache.miss COUNT : 25
+rocksdb.block.cache.hit COUNT : 75
+rocksdb.db.get.micros statistics Percentiles :=> 50 : 1.5 95 : 3.0
+`)
+	if len(tickers) != 2 || tickers["rocksdb.block.cache.hit"] != 75 || tickers["rocksdb.block.cache.miss"] != 25 {
+		t.Fatalf("Unexpected tickers %v", tickers)
+	}
+}
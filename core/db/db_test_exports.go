@@ -18,10 +18,10 @@ package db
 
 import (
 	"os"
+	"strconv"
 	"testing"
 
 	"github.com/spf13/viper"
-	"github.com/tecbot/gorocksdb"
 )
 
 // TestDBWrapper wraps the db. Can be used by other modules for testing
@@ -66,15 +66,28 @@ func (testDB *TestDBWrapper) cleanup() {
 }
 
 func (testDB *TestDBWrapper) removeDBPath() {
+	closeChainDBs()
 	dbPath := viper.GetString("peer.fileSystemPath")
 	os.RemoveAll(dbPath)
+	if dbPath != "" {
+		deleteMemoryStore(getDBPath())
+	}
+}
+
+// closeChainDBs closes the DBs of the chains other than the default one, and forgets them
+func closeChainDBs() {
+	chainDBsLock.Lock()
+	defer chainDBsLock.Unlock()
+	for chainID, chainDB := range chainDBs {
+		chainDB.Close()
+		deleteMemoryStore(chainDB.path)
+		delete(chainDBs, chainID)
+	}
 }
 
 // WriteToDB tests can use this method for persisting a given batch to db
-func (testDB *TestDBWrapper) WriteToDB(t testing.TB, writeBatch *gorocksdb.WriteBatch) {
-	opt := gorocksdb.NewDefaultWriteOptions()
-	defer opt.Destroy()
-	err := GetDBHandle().DB.Write(opt, writeBatch)
+func (testDB *TestDBWrapper) WriteToDB(t testing.TB, writeBatch WriteBatch) {
+	err := GetDBHandle().Write(writeBatch)
 	if err != nil {
 		t.Fatalf("Error while writing to db. Error:%s", err)
 	}
@@ -82,15 +95,10 @@ func (testDB *TestDBWrapper) WriteToDB(t testing.TB, writeBatch *gorocksdb.Write
 
 // GetFromDB gets the value for the given key from default column-family
 func (testDB *TestDBWrapper) GetFromDB(t testing.TB, key []byte) []byte {
-	db := GetDBHandle().DB
-	opt := gorocksdb.NewDefaultReadOptions()
-	defer opt.Destroy()
-	slice, err := db.Get(opt, key)
-	defer slice.Free()
+	value, err := GetDBHandle().Get(DefaultCF, key)
 	if err != nil {
 		t.Fatalf("Error while getting key-value from DB: %s", err)
 	}
-	value := append([]byte(nil), slice.Data()...)
 	return value
 }
 
@@ -124,15 +132,28 @@ func (testDB *TestDBWrapper) CloseDB(t testing.TB) {
 func (testDB *TestDBWrapper) GetEstimatedNumKeys(t testing.TB) map[string]string {
 	openchainDB := GetDBHandle()
 	result := make(map[string]string, 5)
-	result["stateCF"] = openchainDB.DB.GetPropertyCF("rocksdb.estimate-num-keys", openchainDB.StateCF)
-	result["stateDeltaCF"] = openchainDB.DB.GetPropertyCF("rocksdb.estimate-num-keys", openchainDB.StateDeltaCF)
-	result["blockchainCF"] = openchainDB.DB.GetPropertyCF("rocksdb.estimate-num-keys", openchainDB.BlockchainCF)
-	result["indexCF"] = openchainDB.DB.GetPropertyCF("rocksdb.estimate-num-keys", openchainDB.IndexesCF)
+	cfs := map[string]ColumnFamily{"stateCF": openchainDB.StateCF, "stateDeltaCF": openchainDB.StateDeltaCF,
+		"blockchainCF": openchainDB.BlockchainCF, "indexCF": openchainDB.IndexesCF}
+	for name, cf := range cfs {
+		if rocksDB := openchainDB.RocksDB(); rocksDB != nil {
+			result[name] = rocksDB.GetPropertyCF("rocksdb.estimate-num-keys", openchainDB.RocksDBColumnFamily(cf))
+			continue
+		}
+		numKeys := 0
+		itr := openchainDB.GetIterator(cf)
+		for itr.SeekToFirst(); itr.Valid(); itr.Next() {
+			numKeys++
+		}
+		itr.Close()
+		result[name] = strconv.Itoa(numKeys)
+	}
 	return result
 }
 
 // GetDBStats returns statistics for the database
 func (testDB *TestDBWrapper) GetDBStats() string {
-	openchainDB := GetDBHandle()
-	return openchainDB.DB.GetProperty("rocksdb.stats")
+	if rocksDB := GetDBHandle().RocksDB(); rocksDB != nil {
+		return rocksDB.GetProperty("rocksdb.stats")
+	}
+	return ""
 }
@@ -0,0 +1,325 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package db
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// memoryStore keeps the column families in memory. They are kept by path when the
+// store is closed, so that it can be opened again, and are lost when the process exits.
+// It is meant for tests, which need not write to the file system.
+type memoryStore struct {
+	lock sync.RWMutex
+	path string
+	cfs  map[ColumnFamily]*memoryColumnFamily
+}
+
+// The column families of the closed memory stores, by path
+var closedMemoryStores = make(map[string]map[ColumnFamily]*memoryColumnFamily)
+var closedMemoryStoresLock sync.Mutex
+
+// memoryColumnFamily is a column family of a memoryStore. The values and
+// sorted keys handed to iterators and snapshots are copied before being changed.
+type memoryColumnFamily struct {
+	values map[string][]byte
+	keys   []string
+	shared bool
+}
+
+// memoryView is the content of a column family at some point in time
+type memoryView struct {
+	values map[string][]byte
+	keys   []string
+}
+
+func newMemoryStore() *memoryStore {
+	return &memoryStore{}
+}
+
+func newMemoryColumnFamily() *memoryColumnFamily {
+	return &memoryColumnFamily{values: make(map[string][]byte)}
+}
+
+func (cf *memoryColumnFamily) view() *memoryView {
+	if cf.keys == nil {
+		cf.keys = make([]string, 0, len(cf.values))
+		for key := range cf.values {
+			cf.keys = append(cf.keys, key)
+		}
+		sort.Strings(cf.keys)
+	}
+	cf.shared = true
+	return &memoryView{cf.values, cf.keys}
+}
+
+func (cf *memoryColumnFamily) update(key []byte, value []byte) {
+	if cf.shared {
+		values := make(map[string][]byte, len(cf.values))
+		for k, v := range cf.values {
+			values[k] = v
+		}
+		cf.values = values
+		cf.shared = false
+	}
+	if value == nil {
+		delete(cf.values, string(key))
+	} else {
+		cf.values[string(key)] = makeCopy(value)
+	}
+	cf.keys = nil
+}
+
+func (store *memoryStore) Open(dbPath string, columnFamilies []ColumnFamily) error {
+	store.lock.Lock()
+	defer store.lock.Unlock()
+	closedMemoryStoresLock.Lock()
+	defer closedMemoryStoresLock.Unlock()
+	store.path = dbPath
+	store.cfs = closedMemoryStores[dbPath]
+	delete(closedMemoryStores, dbPath)
+	if store.cfs == nil {
+		store.cfs = make(map[ColumnFamily]*memoryColumnFamily)
+	}
+	for _, cf := range append([]ColumnFamily{DefaultCF}, columnFamilies...) {
+		if _, ok := store.cfs[cf]; !ok {
+			store.cfs[cf] = newMemoryColumnFamily()
+		}
+	}
+	return nil
+}
+
+func (store *memoryStore) Close() {
+	store.lock.Lock()
+	defer store.lock.Unlock()
+	closedMemoryStoresLock.Lock()
+	defer closedMemoryStoresLock.Unlock()
+	closedMemoryStores[store.path] = store.cfs
+	store.cfs = nil
+}
+
+// deleteMemoryStore deletes the column families of the closed memory store at dbPath
+func deleteMemoryStore(dbPath string) {
+	closedMemoryStoresLock.Lock()
+	defer closedMemoryStoresLock.Unlock()
+	delete(closedMemoryStores, dbPath)
+}
+
+func (store *memoryStore) columnFamily(cf ColumnFamily) (*memoryColumnFamily, error) {
+	memoryCF, ok := store.cfs[cf]
+	if !ok {
+		return nil, fmt.Errorf("Unknown column family %s", cf)
+	}
+	return memoryCF, nil
+}
+
+func (store *memoryStore) Get(cf ColumnFamily, key []byte) ([]byte, error) {
+	store.lock.RLock()
+	defer store.lock.RUnlock()
+	memoryCF, err := store.columnFamily(cf)
+	if err != nil {
+		return nil, err
+	}
+	if value, ok := memoryCF.values[string(key)]; ok {
+		return makeCopy(value), nil
+	}
+	return nil, nil
+}
+
+func (store *memoryStore) Put(cf ColumnFamily, key []byte, value []byte) error {
+	writeBatch := store.NewWriteBatch()
+	writeBatch.PutCF(cf, key, value)
+	return store.Write(writeBatch)
+}
+
+func (store *memoryStore) Delete(cf ColumnFamily, key []byte) error {
+	writeBatch := store.NewWriteBatch()
+	writeBatch.DeleteCF(cf, key)
+	return store.Write(writeBatch)
+}
+
+func (store *memoryStore) NewIterator(cf ColumnFamily) Iterator {
+	store.lock.Lock()
+	defer store.lock.Unlock()
+	memoryCF, err := store.columnFamily(cf)
+	if err != nil {
+		return newMemoryIterator(&memoryView{}, err)
+	}
+	return newMemoryIterator(memoryCF.view(), nil)
+}
+
+func (store *memoryStore) NewSnapshot() Snapshot {
+	store.lock.Lock()
+	defer store.lock.Unlock()
+	snapshot := &memorySnapshot{make(map[ColumnFamily]*memoryView)}
+	for cf, memoryCF := range store.cfs {
+		snapshot.views[cf] = memoryCF.view()
+	}
+	return snapshot
+}
+
+func (store *memoryStore) NewWriteBatch() WriteBatch {
+	return &memoryWriteBatch{}
+}
+
+func (store *memoryStore) Write(writeBatch WriteBatch) error {
+	store.lock.Lock()
+	defer store.lock.Unlock()
+	changes := writeBatch.(*memoryWriteBatch).changes
+	for _, change := range changes {
+		if _, err := store.columnFamily(change.cf); err != nil {
+			return err
+		}
+	}
+	for _, change := range changes {
+		store.cfs[change.cf].update(change.key, change.value)
+	}
+	return nil
+}
+
+// WriteSync is Write, the store not being durable anyway
+func (store *memoryStore) WriteSync(writeBatch WriteBatch) error {
+	return store.Write(writeBatch)
+}
+
+func (store *memoryStore) DeleteColumnFamily(cf ColumnFamily) error {
+	store.lock.Lock()
+	defer store.lock.Unlock()
+	if _, err := store.columnFamily(cf); err != nil {
+		return err
+	}
+	store.cfs[cf] = newMemoryColumnFamily()
+	return nil
+}
+
+// Stats - method implementation for interface 'StatsStore'
+func (store *memoryStore) Stats() map[string]float64 {
+	store.lock.RLock()
+	defer store.lock.RUnlock()
+	stats := make(map[string]float64)
+	for cf, memoryCF := range store.cfs {
+		if cf != DefaultCF {
+			stats[string(cf)+".numKeys"] = float64(len(memoryCF.values))
+		}
+	}
+	return stats
+}
+
+type memorySnapshot struct {
+	views map[ColumnFamily]*memoryView
+}
+
+func (snapshot *memorySnapshot) Get(cf ColumnFamily, key []byte) ([]byte, error) {
+	view, ok := snapshot.views[cf]
+	if !ok {
+		return nil, fmt.Errorf("Unknown column family %s", cf)
+	}
+	if value, ok := view.values[string(key)]; ok {
+		return makeCopy(value), nil
+	}
+	return nil, nil
+}
+
+func (snapshot *memorySnapshot) NewIterator(cf ColumnFamily) Iterator {
+	view, ok := snapshot.views[cf]
+	if !ok {
+		return newMemoryIterator(&memoryView{}, fmt.Errorf("Unknown column family %s", cf))
+	}
+	return newMemoryIterator(view, nil)
+}
+
+func (snapshot *memorySnapshot) Release() {
+}
+
+type memoryChange struct {
+	cf    ColumnFamily
+	key   []byte
+	value []byte
+}
+
+type memoryWriteBatch struct {
+	changes []memoryChange
+}
+
+func (writeBatch *memoryWriteBatch) PutCF(cf ColumnFamily, key []byte, value []byte) {
+	if value == nil {
+		value = []byte{}
+	}
+	writeBatch.changes = append(writeBatch.changes, memoryChange{cf, makeCopy(key), makeCopy(value)})
+}
+
+func (writeBatch *memoryWriteBatch) DeleteCF(cf ColumnFamily, key []byte) {
+	writeBatch.changes = append(writeBatch.changes, memoryChange{cf, makeCopy(key), nil})
+}
+
+func (writeBatch *memoryWriteBatch) Destroy() {
+	writeBatch.changes = nil
+}
+
+// memoryIterator starts out invalid, as RocksDB iterators do, until it is positioned
+type memoryIterator struct {
+	view *memoryView
+	pos  int
+	err  error
+}
+
+func newMemoryIterator(view *memoryView, err error) *memoryIterator {
+	return &memoryIterator{view, -1, err}
+}
+
+func (itr *memoryIterator) Seek(key []byte) {
+	itr.pos = sort.SearchStrings(itr.view.keys, string(key))
+}
+
+func (itr *memoryIterator) SeekToFirst() {
+	itr.pos = 0
+}
+
+func (itr *memoryIterator) Valid() bool {
+	return itr.pos >= 0 && itr.pos < len(itr.view.keys)
+}
+
+func (itr *memoryIterator) Next() {
+	itr.pos++
+}
+
+func (itr *memoryIterator) Prev() {
+	itr.pos--
+}
+
+func (itr *memoryIterator) Key() []byte {
+	if !itr.Valid() {
+		return nil
+	}
+	return []byte(itr.view.keys[itr.pos])
+}
+
+func (itr *memoryIterator) Value() []byte {
+	if !itr.Valid() {
+		return nil
+	}
+	return itr.view.values[itr.view.keys[itr.pos]]
+}
+
+func (itr *memoryIterator) Err() error {
+	return itr.err
+}
+
+func (itr *memoryIterator) Close() {
+}
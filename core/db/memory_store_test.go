@@ -0,0 +1,123 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package db
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/spf13/viper"
+)
+
+func TestMemoryStoreSnapshotAndIterator(t *testing.T) {
+	store := newMemoryStore()
+	store.Open("testpath", []ColumnFamily{stateCF})
+	defer deleteMemoryStore("testpath")
+	defer store.Close()
+
+	store.Put(stateCF, []byte("key1"), []byte("value1"))
+	store.Put(stateCF, []byte("key2"), []byte("value2"))
+	snapshot := store.NewSnapshot()
+	defer snapshot.Release()
+	itr := store.NewIterator(stateCF)
+	defer itr.Close()
+
+	writeBatch := store.NewWriteBatch()
+	writeBatch.DeleteCF(stateCF, []byte("key1"))
+	writeBatch.PutCF(stateCF, []byte("key2"), []byte("value2_new"))
+	writeBatch.PutCF(stateCF, []byte("key3"), []byte("value3"))
+	if err := store.Write(writeBatch); err != nil {
+		t.Fatalf("Error while writing batch: %s", err)
+	}
+
+	value, _ := snapshot.Get(stateCF, []byte("key2"))
+	if !bytes.Equal(value, []byte("value2")) {
+		t.Fatalf("Expected value from snapshot [%s], found [%s]", "value2", value)
+	}
+	value, _ = store.Get(stateCF, []byte("key2"))
+	if !bytes.Equal(value, []byte("value2_new")) {
+		t.Fatalf("Expected value from store [%s], found [%s]", "value2_new", value)
+	}
+	testIterator(t, itr, map[string][]byte{"key1": []byte("value1"), "key2": []byte("value2")})
+	snapshotItr := snapshot.NewIterator(stateCF)
+	defer snapshotItr.Close()
+	testIterator(t, snapshotItr, map[string][]byte{"key1": []byte("value1"), "key2": []byte("value2")})
+	latestItr := store.NewIterator(stateCF)
+	defer latestItr.Close()
+	testIterator(t, latestItr, map[string][]byte{"key2": []byte("value2_new"), "key3": []byte("value3")})
+
+	latestItr.Seek([]byte("key25"))
+	if !latestItr.Valid() || !bytes.Equal(latestItr.Key(), []byte("key3")) {
+		t.Fatalf("Expected iterator at [%s] after seek", "key3")
+	}
+	latestItr.Prev()
+	if !latestItr.Valid() || !bytes.Equal(latestItr.Key(), []byte("key2")) {
+		t.Fatalf("Expected iterator at [%s] after prev", "key2")
+	}
+
+	if err := store.Put("unknownCF", []byte("key"), []byte("value")); err == nil {
+		t.Fatalf("An error expected for an unknown column family")
+	}
+}
+
+func TestMemoryStoreReopen(t *testing.T) {
+	store := newMemoryStore()
+	store.Open("testpath", []ColumnFamily{stateCF})
+	defer deleteMemoryStore("testpath")
+	store.Put(stateCF, []byte("key1"), []byte("value1"))
+	store.Close()
+
+	store = newMemoryStore()
+	store.Open("testpath", []ColumnFamily{stateCF})
+	value, _ := store.Get(stateCF, []byte("key1"))
+	if !bytes.Equal(value, []byte("value1")) {
+		t.Fatalf("Expected value after reopening [%s], found [%s]", "value1", value)
+	}
+	store.DeleteColumnFamily(stateCF)
+	value, _ = store.Get(stateCF, []byte("key1"))
+	if value != nil {
+		t.Fatalf("A nil value expected. Found [%s]", value)
+	}
+	store.Close()
+}
+
+func TestMemoryBackend(t *testing.T) {
+	viper.Set("peer.db.backend", "memory")
+	defer viper.Set("peer.db.backend", "")
+	testDBWrapper := NewTestDBWrapper()
+	testDBWrapper.CleanDB(t)
+	openchainDB := GetDBHandle()
+	defer testDBWrapper.cleanup()
+	if openchainDB.RocksDB() != nil {
+		t.Fatalf("The DB should not be kept in RocksDB")
+	}
+	performBasicReadWrite(openchainDB, t)
+
+	backend, stats, err := openchainDB.GetStats()
+	if err != nil {
+		t.Fatalf("Error getting stats: %s", err)
+	}
+	if backend != "memory" || stats["stateCF.numKeys"] != 1 || stats["blockchainCF.numKeys"] != 1 {
+		t.Fatalf("Unexpected stats of backend [%s]: %v", backend, stats)
+	}
+}
+
+func TestUnknownBackend(t *testing.T) {
+	if _, err := newStore("unknown"); err == nil {
+		t.Fatalf("An error expected for an unknown backend")
+	}
+}
@@ -0,0 +1,365 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package db
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/spf13/viper"
+	"github.com/tecbot/gorocksdb"
+)
+
+// rocksDBStore keeps the column families in those of a RocksDB database
+type rocksDBStore struct {
+	db           *gorocksdb.DB
+	cfHandles    map[ColumnFamily]*gorocksdb.ColumnFamilyHandle
+	options      *gorocksdb.Options
+	blockCache   *gorocksdb.Cache
+	tableOptions *gorocksdb.BlockBasedTableOptions
+}
+
+func newRocksDBStore() *rocksDBStore {
+	return &rocksDBStore{}
+}
+
+func (store *rocksDBStore) Open(dbPath string, columnFamilies []ColumnFamily) error {
+	missing, err := dirMissingOrEmpty(dbPath)
+	if err != nil {
+		return fmt.Errorf("Error while trying to open DB: %s", err)
+	}
+	dbLogger.Debugf("Is db path [%s] empty [%t]", dbPath, missing)
+
+	if missing {
+		err = os.MkdirAll(path.Dir(dbPath), 0755)
+		if err != nil {
+			return fmt.Errorf("Error making directory path [%s]: %s", dbPath, err)
+		}
+	}
+
+	opts, err := store.newOptions()
+	if err != nil {
+		return err
+	}
+	store.options = opts
+
+	opts.SetCreateIfMissing(missing)
+	opts.SetCreateIfMissingColumnFamilies(true)
+
+	cfNames := []string{string(DefaultCF)}
+	for _, cf := range columnFamilies {
+		cfNames = append(cfNames, string(cf))
+	}
+	var cfOpts []*gorocksdb.Options
+	for range cfNames {
+		cfOpts = append(cfOpts, opts)
+	}
+
+	db, cfHandlers, err := gorocksdb.OpenDbColumnFamilies(opts, dbPath, cfNames, cfOpts)
+	if err != nil {
+		store.destroyOptions()
+		return fmt.Errorf("Error opening DB: %s", err)
+	}
+
+	store.db = db
+	store.cfHandles = make(map[ColumnFamily]*gorocksdb.ColumnFamilyHandle)
+	for i, cfName := range cfNames {
+		store.cfHandles[ColumnFamily(cfName)] = cfHandlers[i]
+	}
+	return nil
+}
+
+// newOptions returns the options of the database and its column families, tuned
+// by the 'peer.db.rocksdb' configs. Those not set are left to the RocksDB defaults.
+// The options are kept until the store is closed.
+func (store *rocksDBStore) newOptions() (*gorocksdb.Options, error) {
+	opts := gorocksdb.NewDefaultOptions()
+
+	if writeBufferSize := viper.GetInt("peer.db.rocksdb.writeBufferSize"); writeBufferSize > 0 {
+		opts.SetWriteBufferSize(writeBufferSize * 1024 * 1024)
+	}
+	if maxWriteBufferNumber := viper.GetInt("peer.db.rocksdb.maxWriteBufferNumber"); maxWriteBufferNumber > 0 {
+		opts.SetMaxWriteBufferNumber(maxWriteBufferNumber)
+	}
+	switch compactionStyle := viper.GetString("peer.db.rocksdb.compactionStyle"); compactionStyle {
+	case "", "level":
+		opts.SetCompactionStyle(gorocksdb.LevelCompactionStyle)
+	case "universal":
+		opts.SetCompactionStyle(gorocksdb.UniversalCompactionStyle)
+	case "fifo":
+		opts.SetCompactionStyle(gorocksdb.FIFOCompactionStyle)
+	default:
+		opts.Destroy()
+		return nil, fmt.Errorf("Invalid RocksDB compaction style '%s'. Supported styles are 'level', 'universal' and 'fifo'", compactionStyle)
+	}
+	if viper.GetBool("peer.db.rocksdb.statistics") {
+		opts.EnableStatistics()
+	}
+
+	blockCacheSize := viper.GetInt("peer.db.rocksdb.blockCacheSize")
+	bloomFilterBitsPerKey := viper.GetInt("peer.db.rocksdb.bloomFilterBitsPerKey")
+	if blockCacheSize > 0 || bloomFilterBitsPerKey > 0 {
+		store.tableOptions = gorocksdb.NewDefaultBlockBasedTableOptions()
+		if blockCacheSize > 0 {
+			store.blockCache = gorocksdb.NewLRUCache(blockCacheSize * 1024 * 1024)
+			store.tableOptions.SetBlockCache(store.blockCache)
+		}
+		if bloomFilterBitsPerKey > 0 {
+			store.tableOptions.SetFilterPolicy(gorocksdb.NewBloomFilter(bloomFilterBitsPerKey))
+		}
+		opts.SetBlockBasedTableFactory(store.tableOptions)
+	}
+	dbLogger.Infof("RocksDB options: blockCacheSize=[%dMB], writeBufferSize=[%dMB], maxWriteBufferNumber=[%d], compactionStyle=[%s], bloomFilterBitsPerKey=[%d], statistics=[%t]",
+		blockCacheSize, viper.GetInt("peer.db.rocksdb.writeBufferSize"), viper.GetInt("peer.db.rocksdb.maxWriteBufferNumber"),
+		viper.GetString("peer.db.rocksdb.compactionStyle"), bloomFilterBitsPerKey, viper.GetBool("peer.db.rocksdb.statistics"))
+	return opts, nil
+}
+
+func (store *rocksDBStore) Close() {
+	for cf, cfHandle := range store.cfHandles {
+		if cf != DefaultCF {
+			cfHandle.Destroy()
+		}
+	}
+	store.db.Close()
+	store.destroyOptions()
+}
+
+func (store *rocksDBStore) destroyOptions() {
+	store.options.Destroy()
+	store.options = nil
+	if store.tableOptions != nil {
+		store.tableOptions.Destroy()
+		store.tableOptions = nil
+	}
+	if store.blockCache != nil {
+		store.blockCache.Destroy()
+		store.blockCache = nil
+	}
+}
+
+// Stats - method implementation for interface 'StatsStore'
+// The compaction backlog and the state of the memtables tell whether writes are
+// stalled, and the block cache hits whether reads go to disk. The hits are only
+// counted when 'peer.db.rocksdb.statistics' is enabled.
+func (store *rocksDBStore) Stats() map[string]float64 {
+	stats := make(map[string]float64)
+	addProperty := func(name string, cfHandle *gorocksdb.ColumnFamilyHandle, property string) {
+		value, err := strconv.ParseFloat(strings.TrimSpace(store.db.GetPropertyCF(property, cfHandle)), 64)
+		if err == nil {
+			stats[name] += value
+		}
+	}
+	for cf, cfHandle := range store.cfHandles {
+		if cf == DefaultCF {
+			continue
+		}
+		addProperty(string(cf)+".numKeys", cfHandle, "rocksdb.estimate-num-keys")
+		addProperty(string(cf)+".liveDataSize", cfHandle, "rocksdb.estimate-live-data-size")
+		addProperty(string(cf)+".pendingCompactionBytes", cfHandle, "rocksdb.estimate-pending-compaction-bytes")
+		addProperty("pendingCompactionBytes", cfHandle, "rocksdb.estimate-pending-compaction-bytes")
+		addProperty("compactionPending", cfHandle, "rocksdb.compaction-pending")
+		addProperty("memtableFlushPending", cfHandle, "rocksdb.mem-table-flush-pending")
+		addProperty("immutableMemtables", cfHandle, "rocksdb.num-immutable-mem-table")
+		addProperty("memtableSize", cfHandle, "rocksdb.cur-size-all-mem-tables")
+	}
+	addProperty("runningCompactions", nil, "rocksdb.num-running-compactions")
+	addProperty("runningFlushes", nil, "rocksdb.num-running-flushes")
+	addProperty("writeStopped", nil, "rocksdb.is-write-stopped")
+	addProperty("delayedWriteRate", nil, "rocksdb.actual-delayed-write-rate")
+	addProperty("blockCacheUsage", nil, "rocksdb.block-cache-usage")
+
+	tickers := parseRocksDBTickers(store.db.GetProperty("rocksdb.options-statistics"))
+	if hits, ok := tickers["rocksdb.block.cache.hit"]; ok {
+		misses := tickers["rocksdb.block.cache.miss"]
+		stats["blockCacheHits"] = hits
+		stats["blockCacheMisses"] = misses
+		if hits+misses > 0 {
+			stats["blockCacheHitRate"] = hits / (hits + misses)
+		}
+	}
+	if stalls, ok := tickers["rocksdb.stall.micros"]; ok {
+		stats["stallMicros"] = stalls
+	}
+	return stats
+}
+
+// parseRocksDBTickers returns the counters of the statistics of RocksDB, whose
+// lines read '<name> COUNT : <value>'
+func parseRocksDBTickers(statistics string) map[string]float64 {
+	tickers := make(map[string]float64)
+	scanner := bufio.NewScanner(strings.NewReader(statistics))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) != 4 || fields[1] != "COUNT" || fields[2] != ":" {
+			continue
+		}
+		if value, err := strconv.ParseFloat(fields[3], 64); err == nil {
+			tickers[fields[0]] = value
+		}
+	}
+	return tickers
+}
+
+func (store *rocksDBStore) Get(cf ColumnFamily, key []byte) ([]byte, error) {
+	opt := gorocksdb.NewDefaultReadOptions()
+	defer opt.Destroy()
+	return store.get(opt, cf, key)
+}
+
+func (store *rocksDBStore) get(opt *gorocksdb.ReadOptions, cf ColumnFamily, key []byte) ([]byte, error) {
+	slice, err := store.db.GetCF(opt, store.cfHandles[cf], key)
+	if err != nil {
+		fmt.Println("Error while trying to retrieve key:", key)
+		return nil, err
+	}
+	defer slice.Free()
+	if slice.Data() == nil {
+		return nil, nil
+	}
+	return makeCopy(slice.Data()), nil
+}
+
+func (store *rocksDBStore) Put(cf ColumnFamily, key []byte, value []byte) error {
+	opt := gorocksdb.NewDefaultWriteOptions()
+	defer opt.Destroy()
+	err := store.db.PutCF(opt, store.cfHandles[cf], key, value)
+	if err != nil {
+		fmt.Println("Error while trying to write key:", key)
+		return err
+	}
+	return nil
+}
+
+func (store *rocksDBStore) Delete(cf ColumnFamily, key []byte) error {
+	opt := gorocksdb.NewDefaultWriteOptions()
+	defer opt.Destroy()
+	err := store.db.DeleteCF(opt, store.cfHandles[cf], key)
+	if err != nil {
+		fmt.Println("Error while trying to delete key:", key)
+		return err
+	}
+	return nil
+}
+
+func (store *rocksDBStore) NewIterator(cf ColumnFamily) Iterator {
+	opt := gorocksdb.NewDefaultReadOptions()
+	opt.SetFillCache(true)
+	defer opt.Destroy()
+	return &rocksDBIterator{store.db.NewIteratorCF(opt, store.cfHandles[cf])}
+}
+
+func (store *rocksDBStore) NewSnapshot() Snapshot {
+	return &rocksDBSnapshot{store, store.db.NewSnapshot()}
+}
+
+func (store *rocksDBStore) NewWriteBatch() WriteBatch {
+	return &rocksDBWriteBatch{store, gorocksdb.NewWriteBatch()}
+}
+
+func (store *rocksDBStore) Write(writeBatch WriteBatch) error {
+	opt := gorocksdb.NewDefaultWriteOptions()
+	defer opt.Destroy()
+	return store.db.Write(opt, writeBatch.(*rocksDBWriteBatch).writeBatch)
+}
+
+func (store *rocksDBStore) WriteSync(writeBatch WriteBatch) error {
+	opt := gorocksdb.NewDefaultWriteOptions()
+	defer opt.Destroy()
+	// the write-ahead log is synced before the write returns
+	opt.SetSync(true)
+	return store.db.Write(opt, writeBatch.(*rocksDBWriteBatch).writeBatch)
+}
+
+func (store *rocksDBStore) DeleteColumnFamily(cf ColumnFamily) error {
+	err := store.db.DropColumnFamily(store.cfHandles[cf])
+	if err != nil {
+		dbLogger.Errorf("Error dropping %s: %s", cf, err)
+		return err
+	}
+	cfHandle, err := store.db.CreateColumnFamily(store.options, string(cf))
+	if err != nil {
+		dbLogger.Errorf("Error creating %s: %s", cf, err)
+		return err
+	}
+	store.cfHandles[cf] = cfHandle
+	return nil
+}
+
+type rocksDBSnapshot struct {
+	store    *rocksDBStore
+	snapshot *gorocksdb.Snapshot
+}
+
+func (snapshot *rocksDBSnapshot) Get(cf ColumnFamily, key []byte) ([]byte, error) {
+	opt := gorocksdb.NewDefaultReadOptions()
+	defer opt.Destroy()
+	opt.SetSnapshot(snapshot.snapshot)
+	return snapshot.store.get(opt, cf, key)
+}
+
+func (snapshot *rocksDBSnapshot) NewIterator(cf ColumnFamily) Iterator {
+	opt := gorocksdb.NewDefaultReadOptions()
+	defer opt.Destroy()
+	opt.SetSnapshot(snapshot.snapshot)
+	return &rocksDBIterator{snapshot.store.db.NewIteratorCF(opt, snapshot.store.cfHandles[cf])}
+}
+
+func (snapshot *rocksDBSnapshot) Release() {
+	snapshot.snapshot.Release()
+}
+
+type rocksDBWriteBatch struct {
+	store      *rocksDBStore
+	writeBatch *gorocksdb.WriteBatch
+}
+
+func (writeBatch *rocksDBWriteBatch) PutCF(cf ColumnFamily, key []byte, value []byte) {
+	writeBatch.writeBatch.PutCF(writeBatch.store.cfHandles[cf], key, value)
+}
+
+func (writeBatch *rocksDBWriteBatch) DeleteCF(cf ColumnFamily, key []byte) {
+	writeBatch.writeBatch.DeleteCF(writeBatch.store.cfHandles[cf], key)
+}
+
+func (writeBatch *rocksDBWriteBatch) Destroy() {
+	writeBatch.writeBatch.Destroy()
+}
+
+// rocksDBIterator returns the keys and values of a RocksDB iterator, which are
+// owned by it and need not be freed
+type rocksDBIterator struct {
+	*gorocksdb.Iterator
+}
+
+func (itr *rocksDBIterator) Key() []byte {
+	if key := itr.Iterator.Key(); key != nil {
+		return key.Data()
+	}
+	return nil
+}
+
+func (itr *rocksDBIterator) Value() []byte {
+	if value := itr.Iterator.Value(); value != nil {
+		return value.Data()
+	}
+	return nil
+}
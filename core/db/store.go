@@ -0,0 +1,148 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package db
+
+import (
+	"fmt"
+)
+
+// ColumnFamily names a column family of a Store. The keys of a column family
+// are kept apart from those of the others.
+type ColumnFamily string
+
+// Store is the interface a key-value store is to implement for the ledger to be
+// kept in it. The keys of a column family are kept sorted and its iterators
+// return them in bytewise order.
+type Store interface {
+
+	// Open opens the store at dbPath, creating it along with the column families
+	// which do not exist yet
+	Open(dbPath string, columnFamilies []ColumnFamily) error
+
+	// Close closes the store
+	Close()
+
+	// Get returns the value of a key, or nil if the key does not exist
+	Get(cf ColumnFamily, key []byte) ([]byte, error)
+
+	// Put saves the value of a key
+	Put(cf ColumnFamily, key []byte, value []byte) error
+
+	// Delete deletes a key
+	Delete(cf ColumnFamily, key []byte) error
+
+	// NewIterator returns an iterator over the keys of a column family as they
+	// are when the iterator is created
+	NewIterator(cf ColumnFamily) Iterator
+
+	// NewSnapshot returns a point-in-time view of the store
+	NewSnapshot() Snapshot
+
+	// NewWriteBatch returns a batch of changes to be written together by Write
+	NewWriteBatch() WriteBatch
+
+	// Write writes all the changes of a batch atomically
+	Write(writeBatch WriteBatch) error
+
+	// WriteSync writes all the changes of a batch atomically, and returns once
+	// they are durable, so that a crash of the host does not lose them
+	WriteSync(writeBatch WriteBatch) error
+
+	// DeleteColumnFamily deletes all the keys of a column family
+	DeleteColumnFamily(cf ColumnFamily) error
+}
+
+// Snapshot is a point-in-time view of a Store. Release must be called when the
+// snapshot is no longer used.
+type Snapshot interface {
+
+	// Get returns the value of a key as of the snapshot, or nil if the key did not exist
+	Get(cf ColumnFamily, key []byte) ([]byte, error)
+
+	// NewIterator returns an iterator over the keys of a column family as of the snapshot
+	NewIterator(cf ColumnFamily) Iterator
+
+	// Release releases the snapshot
+	Release()
+}
+
+// WriteBatch is a batch of changes to a Store. Destroy must be called when the
+// batch is no longer used.
+type WriteBatch interface {
+
+	// PutCF adds the saving of the value of a key to the batch
+	PutCF(cf ColumnFamily, key []byte, value []byte)
+
+	// DeleteCF adds the deletion of a key to the batch
+	DeleteCF(cf ColumnFamily, key []byte)
+
+	// Destroy releases the batch
+	Destroy()
+}
+
+// Iterator iterates over the keys of a column family in bytewise order. The key and
+// value it returns are only valid until it is moved, and must be copied to be kept.
+// Close must be called when the iterator is no longer used.
+type Iterator interface {
+
+	// Seek moves to the first key which is greater than or equal to key
+	Seek(key []byte)
+
+	// SeekToFirst moves to the first key
+	SeekToFirst()
+
+	// Valid returns whether the iterator is at a key
+	Valid() bool
+
+	// Next moves to the next key
+	Next()
+
+	// Prev moves to the previous key
+	Prev()
+
+	// Key returns the key the iterator is at
+	Key() []byte
+
+	// Value returns the value of the key the iterator is at
+	Value() []byte
+
+	// Err returns the error which stopped the iteration, if any
+	Err() error
+
+	// Close releases the iterator
+	Close()
+}
+
+// StatsStore - Interface that may be implemented along with Store by the stores
+// which report statistics of their operation
+type StatsStore interface {
+
+	// Stats returns the current statistics of the store, by name
+	Stats() map[string]float64
+}
+
+// newStore returns a new store of a backend
+func newStore(backend string) (Store, error) {
+	switch backend {
+	case "", "rocksdb":
+		return newRocksDBStore(), nil
+	case "memory":
+		return newMemoryStore(), nil
+	default:
+		return nil, fmt.Errorf("Unknown DB backend '%s'. Supported backends are 'rocksdb' and 'memory'", backend)
+	}
+}
@@ -34,6 +34,7 @@ import (
 	"github.com/hyperledger/fabric/core/chaincode/platforms"
 	"github.com/hyperledger/fabric/core/container"
 	crypto "github.com/hyperledger/fabric/core/crypto"
+	"github.com/hyperledger/fabric/core/ledger"
 	"github.com/hyperledger/fabric/core/peer"
 	"github.com/hyperledger/fabric/core/util"
 	pb "github.com/hyperledger/fabric/protos"
@@ -41,6 +42,10 @@ import (
 
 var devopsLogger = logging.MustGetLogger("devops")
 
+// ErrBusy is returned when the validator is too busy to accept a transaction,
+// the transaction was not submitted and may be submitted again later
+var ErrBusy = errors.New("Validator is busy, retry later")
+
 // NewDevopsServer creates and returns a new Devops server instance.
 func NewDevopsServer(coord peer.MessageHandlerCoordinator) *Devops {
 	d := new(Devops)
@@ -106,19 +111,39 @@ func (*Devops) Build(context context.Context, spec *pb.ChaincodeSpec) (*pb.Chain
 			return nil, err
 		}
 
-		vm, err := container.NewVM()
-		if err != nil {
-			return nil, fmt.Errorf("Error getting vm")
+		var err error
+		if spec.ExecEnv == pb.ChaincodeDeploymentSpec_PROCESS {
+			//chaincodes run as processes are built by the peer running them, without docker
+			codePackageBytes, err = container.GetChaincodePackageBytes(spec)
+		} else {
+			var vm *container.VM
+			if vm, err = container.NewVM(); err != nil {
+				return nil, fmt.Errorf("Error getting vm")
+			}
+			codePackageBytes, err = vm.BuildChaincodeContainer(spec)
 		}
-
-		codePackageBytes, err = vm.BuildChaincodeContainer(spec)
 		if err != nil {
 			err = fmt.Errorf("Error getting chaincode package bytes: %s", err)
 			devopsLogger.Error(fmt.Sprintf("%s", err))
 			return nil, err
 		}
 	}
-	chaincodeDeploymentSpec := &pb.ChaincodeDeploymentSpec{ChaincodeSpec: spec, CodePackage: codePackageBytes}
+	return newDeploymentSpec(spec, codePackageBytes)
+}
+
+// newDeploymentSpec returns the deployment spec of the chaincode packaged in
+// codePackageBytes. With reproducible builds, the base images of the package
+// must be pinned by digest, and the deployment records its build digest
+func newDeploymentSpec(spec *pb.ChaincodeSpec, codePackageBytes []byte) (*pb.ChaincodeDeploymentSpec, error) {
+	chaincodeDeploymentSpec := &pb.ChaincodeDeploymentSpec{ChaincodeSpec: spec, CodePackage: codePackageBytes, ExecEnv: spec.ExecEnv}
+	if codePackageBytes != nil && viper.GetBool("chaincode.reproducible") {
+		if spec.ExecEnv == pb.ChaincodeDeploymentSpec_DOCKER {
+			if err := container.CheckPinnedBaseImages(codePackageBytes); err != nil {
+				return nil, err
+			}
+		}
+		chaincodeDeploymentSpec.BuildDigest = container.GetBuildDigest(codePackageBytes)
+	}
 	return chaincodeDeploymentSpec, nil
 }
 
@@ -140,12 +165,16 @@ func (*Devops) getChaincodeBytes(context context.Context, spec *pb.ChaincodeSpec
 			return nil, err
 		}
 	}
-	chaincodeDeploymentSpec := &pb.ChaincodeDeploymentSpec{ChaincodeSpec: spec, CodePackage: codePackageBytes}
-	return chaincodeDeploymentSpec, nil
+	return newDeploymentSpec(spec, codePackageBytes)
 }
 
 // Deploy deploys the supplied chaincode image to the validators through a transaction
 func (d *Devops) Deploy(ctx context.Context, spec *pb.ChaincodeSpec) (*pb.ChaincodeDeploymentSpec, error) {
+	// the init arguments are encrypted under the chain key by the crypto client
+	if spec.EncryptCtorMsg && !peer.SecurityEnabled() {
+		return nil, fmt.Errorf("Encrypting the init arguments requires security to be enabled")
+	}
+
 	// get the deployment spec
 	chaincodeDeploymentSpec, err := d.getChaincodeBytes(ctx, spec)
 
@@ -196,7 +225,9 @@ func (d *Devops) Deploy(ctx context.Context, spec *pb.ChaincodeSpec) (*pb.Chainc
 		devopsLogger.Debugf("Sending deploy transaction (%s) to validator", tx.Uuid)
 	}
 	resp := d.coord.ExecuteTransaction(tx)
-	if resp.Status == pb.Response_FAILURE {
+	if resp.Status == pb.Response_BUSY {
+		err = ErrBusy
+	} else if resp.Status == pb.Response_FAILURE {
 		err = fmt.Errorf(string(resp.Msg))
 	}
 
@@ -246,7 +277,9 @@ func (d *Devops) invokeOrQuery(ctx context.Context, chaincodeInvocationSpec *pb.
 		devopsLogger.Debugf("Sending invocation transaction (%s) to validator", transaction.Uuid)
 	}
 	resp := d.coord.ExecuteTransaction(transaction)
-	if resp.Status == pb.Response_FAILURE {
+	if resp.Status == pb.Response_BUSY {
+		err = ErrBusy
+	} else if resp.Status == pb.Response_FAILURE {
 		err = fmt.Errorf(string(resp.Msg))
 	} else {
 		if !invoke && nil != sec && viper.GetBool("security.privacy") {
@@ -463,3 +496,29 @@ func (d *Devops) EXP_ExecuteWithBinding(ctx context.Context, executeWithBinding
 	devopsLogger.Warning("Security NOT enabled")
 	return &pb.Response{Status: pb.Response_FAILURE, Msg: []byte("Security NOT enabled")}, nil
 }
+
+// VerifyChain verifies the hash chain and the state hashes of the blocks
+// between req.From and req.To, stopping at the first divergence
+func (d *Devops) VerifyChain(ctx context.Context, req *pb.VerifyChainRequest) (*pb.ChainVerification, error) {
+	ledger, err := ledger.GetLedger()
+	if err != nil {
+		return nil, fmt.Errorf("Error getting ledger: %s", err)
+	}
+	size := ledger.GetBlockchainSize()
+	if size == 0 {
+		return nil, fmt.Errorf("The blockchain has no blocks")
+	}
+	to := req.To
+	if to >= size {
+		to = size - 1
+	}
+	if req.From > to {
+		return nil, fmt.Errorf("Invalid range of blocks %d to %d, the blockchain has %d blocks", req.From, req.To, size)
+	}
+	devopsLogger.Infof("Verifying blocks %d to %d", req.From, to)
+	verification, err := ledger.VerifyChainIntegrity(req.From, to)
+	if err != nil {
+		return nil, fmt.Errorf("Error verifying the blockchain: %s", err)
+	}
+	return verification, nil
+}
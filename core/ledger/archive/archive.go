@@ -0,0 +1,65 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package archive provides the cold storage the ledger ships the blocks of
+// the blockchain to, so that they can be pruned locally and still be read
+package archive
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+// ErrNotFound is returned if an object is not in the store
+var ErrNotFound = errors.New("archive: object not found")
+
+// Store is an object store which archived data is put to and read from
+type Store interface {
+	// Put stores data under key, replacing any object stored under it
+	Put(key string, data []byte) error
+	// Get returns the data stored under key, or ErrNotFound
+	Get(key string) ([]byte, error)
+}
+
+// NewStore returns the store configured under ledger.blockchain.archive,
+// or nil if archival is disabled
+func NewStore() (Store, error) {
+	switch store := viper.GetString("ledger.blockchain.archive.store"); store {
+	case "":
+		return nil, nil
+	case "file":
+		return NewFileStore(viper.GetString("ledger.blockchain.archive.file.path"))
+	case "s3":
+		timeout := viper.GetDuration("ledger.blockchain.archive.s3.timeout")
+		if timeout <= 0 {
+			timeout = 30 * time.Second
+		}
+		return NewS3Store(&S3Config{
+			Endpoint:  viper.GetString("ledger.blockchain.archive.s3.endpoint"),
+			Region:    viper.GetString("ledger.blockchain.archive.s3.region"),
+			Bucket:    viper.GetString("ledger.blockchain.archive.s3.bucket"),
+			Prefix:    viper.GetString("ledger.blockchain.archive.s3.prefix"),
+			AccessKey: viper.GetString("ledger.blockchain.archive.s3.accessKey"),
+			SecretKey: viper.GetString("ledger.blockchain.archive.s3.secretKey"),
+			Timeout:   timeout,
+		})
+	default:
+		return nil, fmt.Errorf("Unknown archive store %q, expected file or s3", store)
+	}
+}
@@ -19,22 +19,36 @@ package ledger
 import (
 	"bytes"
 	"encoding/binary"
+	"fmt"
 	"strconv"
 
 	"github.com/hyperledger/fabric/core/db"
+	"github.com/hyperledger/fabric/core/ledger/statemgmt"
 	"github.com/hyperledger/fabric/core/util"
 	"github.com/hyperledger/fabric/protos"
-	"github.com/tecbot/gorocksdb"
+	"github.com/spf13/viper"
 	"golang.org/x/net/context"
 )
 
 // Blockchain holds basic information in memory. Operations on Blockchain are not thread-safe
 // TODO synchronize access to in-memory variables
 type blockchain struct {
-	size               uint64
-	previousBlockHash  []byte
-	indexer            blockchainIndexer
-	lastProcessedBlock *lastProcessedBlock
+	size                uint64
+	txCount             uint64 // Transactions committed to the blockchain, those of pruned blocks included
+	previousBlockHash   []byte
+	indexer             blockchainIndexer
+	lastProcessedBlocks []*lastProcessedBlock
+	pruning             *blockPruning
+	archiver            *blockArchiver // nil if archival is disabled
+	openchainDB         *db.OpenchainDB
+	pendingRawBlocks    *rawBlocksChanges // raw blocks added to a write batch not written yet
+}
+
+// rawBlocksChanges is what the raw blocks added to a write batch change in the blockchain
+type rawBlocksChanges struct {
+	size              uint64
+	txCount           uint64
+	previousBlockHash []byte
 }
 
 type lastProcessedBlock struct {
@@ -43,21 +57,33 @@ type lastProcessedBlock struct {
 	blockHash   []byte
 }
 
+// indexBlockDataSynchronously is overridden by ledger.commit.asyncIndexes
 var indexBlockDataSynchronously = true
 
-func newBlockchain() (*blockchain, error) {
-	size, err := fetchBlockchainSizeFromDB()
+func newBlockchain(openchainDB *db.OpenchainDB) (*blockchain, error) {
+	size, err := fetchBlockchainSizeFromDB(openchainDB)
+	if err != nil {
+		return nil, err
+	}
+	pruning, err := loadBlockPruning(openchainDB)
+	if err != nil {
+		return nil, err
+	}
+	archiver, err := loadBlockArchiver(openchainDB)
 	if err != nil {
 		return nil, err
 	}
-	blockchain := &blockchain{0, nil, nil, nil}
+	blockchain := &blockchain{0, 0, nil, nil, nil, pruning, archiver, openchainDB, nil}
 	blockchain.size = size
+	if blockchain.txCount, err = blockchain.fetchTransactionCount(); err != nil {
+		return nil, err
+	}
 	if size > 0 {
-		previousBlock, err := fetchBlockFromDB(size - 1)
+		previousBlock, err := fetchBlockFromDB(openchainDB, size-1)
 		if err != nil {
 			return nil, err
 		}
-		previousBlockHash, err := previousBlock.GetHash()
+		previousBlockHash, err := committedBlockHash(previousBlock)
 		if err != nil {
 			return nil, err
 		}
@@ -68,11 +94,14 @@ func newBlockchain() (*blockchain, error) {
 	if err != nil {
 		return nil, err
 	}
+	if archiver != nil {
+		archiver.committed(size)
+	}
 	return blockchain, nil
 }
 
 func (blockchain *blockchain) startIndexer() (err error) {
-	if indexBlockDataSynchronously {
+	if indexBlockDataSynchronously && !viper.GetBool("ledger.commit.asyncIndexes") {
 		blockchain.indexer = newBlockchainIndexerSync()
 	} else {
 		blockchain.indexer = newBlockchainIndexerAsync()
@@ -94,9 +123,67 @@ func (blockchain *blockchain) getSize() uint64 {
 	return blockchain.size
 }
 
-// getBlock get block at arbitrary height in block chain
+// getBlock get block at arbitrary height in block chain, reading pruned blocks back from the archive
 func (blockchain *blockchain) getBlock(blockNumber uint64) (*protos.Block, error) {
-	return fetchBlockFromDB(blockNumber)
+	block, err := fetchBlockFromDB(blockchain.openchainDB, blockNumber)
+	if err != nil || !block.IsPruned() || blockchain.archiver == nil {
+		return block, err
+	}
+	archived, err := blockchain.archiver.archivedBlock(blockNumber, block.NonHashData.PrunedBlockHash)
+	if err != nil {
+		ledgerLogger.Warningf("Failed reading block %d from the archive, returning it pruned: %s", blockNumber, err)
+		return block, nil
+	}
+	if archived == nil {
+		return block, nil
+	}
+	// the commit certificate may have been attached after the block was archived
+	if cert := block.NonHashData.CommitCertificate; cert != nil {
+		if archived.NonHashData == nil {
+			archived.NonHashData = &protos.NonHashData{}
+		}
+		archived.NonHashData.CommitCertificate = cert
+	}
+	return archived, nil
+}
+
+// getBlocksByRange calls fn on the blocks from startBlock to endBlock, in this order (which may be decreasing),
+// until fn returns an error. The blocks are read with a single iterator rather than one by one, the pruned ones
+// being read back from the archive as by getBlock
+func (blockchain *blockchain) getBlocksByRange(startBlock uint64, endBlock uint64, fn func(blockNumber uint64, block *protos.Block) error) error {
+	itr := blockchain.openchainDB.GetBlockchainCFIterator()
+	defer itr.Close()
+	itr.Seek(encodeBlockNumberDBKey(startBlock))
+	for blockNumber := startBlock; ; {
+		if !itr.Valid() || !bytes.Equal(itr.Key(), encodeBlockNumberDBKey(blockNumber)) {
+			if err := itr.Err(); err != nil {
+				return err
+			}
+			return newLedgerError(ErrorTypeBlockNotFound, fmt.Sprintf("No block with number [%d]", blockNumber))
+		}
+		block, err := protos.UnmarshallBlock(statemgmt.Copy(itr.Value()))
+		if err != nil {
+			return err
+		}
+		if block.IsPruned() && blockchain.archiver != nil {
+			if block, err = blockchain.getBlock(blockNumber); err != nil {
+				return err
+			}
+		}
+		if err := fn(blockNumber, block); err != nil {
+			return err
+		}
+		if blockNumber == endBlock {
+			return nil
+		}
+		if startBlock < endBlock {
+			blockNumber++
+			itr.Next()
+		} else {
+			blockNumber--
+			itr.Prev()
+		}
+	}
 }
 
 // getBlockByHash get block by block hash
@@ -117,8 +204,11 @@ func (blockchain *blockchain) getTransactionByUUID(txUUID string) (*protos.Trans
 	if err != nil {
 		return nil, err
 	}
-	transaction := block.GetTransactions()[txIndex]
-	return transaction, nil
+	return blockTransaction(block, txIndex)
+}
+
+func (blockchain *blockchain) getTransactionReceipt(txUUID string) (*protos.TransactionReceipt, error) {
+	return blockchain.indexer.fetchTransactionReceipt(txUUID)
 }
 
 // getTransactions get all transactions in a block identified by block number
@@ -127,6 +217,9 @@ func (blockchain *blockchain) getTransactions(blockNumber uint64) ([]*protos.Tra
 	if err != nil {
 		return nil, err
 	}
+	if block.IsPruned() {
+		return nil, ErrPruned
+	}
 	return block.GetTransactions(), nil
 }
 
@@ -136,6 +229,9 @@ func (blockchain *blockchain) getTransactionsByBlockHash(blockHash []byte) ([]*p
 	if err != nil {
 		return nil, err
 	}
+	if block.IsPruned() {
+		return nil, ErrPruned
+	}
 	return block.GetTransactions(), nil
 }
 
@@ -145,7 +241,7 @@ func (blockchain *blockchain) getTransaction(blockNumber uint64, txIndex uint64)
 	if err != nil {
 		return nil, err
 	}
-	return block.GetTransactions()[txIndex], nil
+	return blockTransaction(block, txIndex)
 }
 
 // getTransactionByBlockHash get a transaction identified by block hash and index within the block
@@ -154,7 +250,57 @@ func (blockchain *blockchain) getTransactionByBlockHash(blockHash []byte, txInde
 	if err != nil {
 		return nil, err
 	}
-	return block.GetTransactions()[txIndex], nil
+	return blockTransaction(block, txIndex)
+}
+
+// getTransactionsByChaincodeID get the transactions deploying or invoking a chaincode in the blocks from startBlock to endBlock
+func (blockchain *blockchain) getTransactionsByChaincodeID(chaincodeID string, startBlock uint64, endBlock uint64) ([]*protos.Transaction, error) {
+	blocksTxIndexes, err := blockchain.indexer.fetchTransactionIndexesByChaincodeID(chaincodeID, startBlock, endBlock)
+	if err != nil {
+		return nil, err
+	}
+	transactions := []*protos.Transaction{}
+	for _, blockTxIndexes := range blocksTxIndexes {
+		block, err := blockchain.getBlock(blockTxIndexes.blockNumber)
+		if err != nil {
+			return nil, err
+		}
+		for _, txIndex := range blockTxIndexes.txIndexes {
+			tx, err := blockTransaction(block, txIndex)
+			if err != nil {
+				return nil, err
+			}
+			transactions = append(transactions, tx)
+		}
+	}
+	return transactions, nil
+}
+
+// getBlockNumbersByEventName get the numbers of the blocks from startBlock to endBlock with a transaction which emitted an event
+func (blockchain *blockchain) getBlockNumbersByEventName(eventName string, startBlock uint64, endBlock uint64) ([]uint64, error) {
+	blocksTxIndexes, err := blockchain.indexer.fetchTransactionIndexesByEventName(eventName, startBlock, endBlock)
+	if err != nil {
+		return nil, err
+	}
+	return blockNumbersOf(blocksTxIndexes), nil
+}
+
+// getBlockNumbersByEventAttribute get the numbers of the blocks from startBlock to endBlock with a transaction which
+// emitted an event with an indexed attribute
+func (blockchain *blockchain) getBlockNumbersByEventAttribute(eventName string, attribute *protos.EventAttribute, startBlock uint64, endBlock uint64) ([]uint64, error) {
+	blocksTxIndexes, err := blockchain.indexer.fetchTransactionIndexesByEventAttribute(eventName, attribute, startBlock, endBlock)
+	if err != nil {
+		return nil, err
+	}
+	return blockNumbersOf(blocksTxIndexes), nil
+}
+
+func blockNumbersOf(blocksTxIndexes []*blockTxIndexes) []uint64 {
+	blockNumbers := []uint64{}
+	for _, blockTxIndexes := range blocksTxIndexes {
+		blockNumbers = append(blockNumbers, blockTxIndexes.blockNumber)
+	}
+	return blockNumbers
 }
 
 func (blockchain *blockchain) getBlockchainInfo() (*protos.BlockchainInfo, error) {
@@ -172,7 +318,7 @@ func (blockchain *blockchain) getBlockchainInfo() (*protos.BlockchainInfo, error
 }
 
 func (blockchain *blockchain) getBlockchainInfoForBlock(height uint64, block *protos.Block) *protos.BlockchainInfo {
-	hash, _ := block.GetHash()
+	hash, _ := committedBlockHash(block)
 	info := &protos.BlockchainInfo{
 		Height:            height,
 		CurrentBlockHash:  hash,
@@ -188,14 +334,19 @@ func (blockchain *blockchain) buildBlock(block *protos.Block, stateHash []byte)
 }
 
 func (blockchain *blockchain) addPersistenceChangesForNewBlock(ctx context.Context,
-	block *protos.Block, stateHash []byte, writeBatch *gorocksdb.WriteBatch) (uint64, error) {
+	block *protos.Block, stateHash []byte, writeBatch db.WriteBatch) (uint64, error) {
 	block = blockchain.buildBlock(block, stateHash)
+	blockNumber := blockchain.size
+	if n := len(blockchain.lastProcessedBlocks); n > 0 {
+		// the block follows those added to the same write batch
+		block.SetPreviousBlockHash(blockchain.lastProcessedBlocks[n-1].blockHash)
+		blockNumber += uint64(n)
+	}
 	if block.NonHashData == nil {
 		block.NonHashData = &protos.NonHashData{LocalLedgerCommitTimestamp: util.CreateUtcTimestamp()}
 	} else {
 		block.NonHashData.LocalLedgerCommitTimestamp = util.CreateUtcTimestamp()
 	}
-	blockNumber := blockchain.size
 	blockHash, err := block.GetHash()
 	if err != nil {
 		return 0, err
@@ -204,65 +355,112 @@ func (blockchain *blockchain) addPersistenceChangesForNewBlock(ctx context.Conte
 	if blockBytesErr != nil {
 		return 0, blockBytesErr
 	}
-	writeBatch.PutCF(db.GetDBHandle().BlockchainCF, encodeBlockNumberDBKey(blockNumber), blockBytes)
-	writeBatch.PutCF(db.GetDBHandle().BlockchainCF, blockCountKey, encodeUint64(blockNumber+1))
+	writeBatch.PutCF(blockchain.openchainDB.BlockchainCF, encodeBlockNumberDBKey(blockNumber), blockBytes)
+	writeBatch.PutCF(blockchain.openchainDB.BlockchainCF, blockCountKey, encodeUint64(blockNumber+1))
+	txCount := blockchain.txCount + uint64(len(block.GetTransactions()))
+	for _, lastProcessedBlock := range blockchain.lastProcessedBlocks {
+		txCount += uint64(len(lastProcessedBlock.block.GetTransactions()))
+	}
+	writeBatch.PutCF(blockchain.openchainDB.BlockchainCF, txCountKey, encodeUint64(txCount))
 	if blockchain.indexer.isSynchronous() {
 		blockchain.indexer.createIndexesSync(block, blockNumber, blockHash, writeBatch)
 	}
-	blockchain.lastProcessedBlock = &lastProcessedBlock{block, blockNumber, blockHash}
+	blockchain.lastProcessedBlocks = append(blockchain.lastProcessedBlocks, &lastProcessedBlock{block, blockNumber, blockHash})
 	return blockNumber, nil
 }
 
 func (blockchain *blockchain) blockPersistenceStatus(success bool) {
 	if success {
-		blockchain.size++
-		blockchain.previousBlockHash = blockchain.lastProcessedBlock.blockHash
-		if !blockchain.indexer.isSynchronous() {
-			blockchain.indexer.createIndexesAsync(blockchain.lastProcessedBlock.block,
-				blockchain.lastProcessedBlock.blockNumber, blockchain.lastProcessedBlock.blockHash)
+		for _, lastProcessedBlock := range blockchain.lastProcessedBlocks {
+			blockchain.size++
+			blockchain.txCount += uint64(len(lastProcessedBlock.block.GetTransactions()))
+			blockchain.previousBlockHash = lastProcessedBlock.blockHash
+			if !blockchain.indexer.isSynchronous() {
+				blockchain.indexer.createIndexesAsync(lastProcessedBlock.block,
+					lastProcessedBlock.blockNumber, lastProcessedBlock.blockHash)
+			}
 		}
 	}
-	blockchain.lastProcessedBlock = nil
+	blockchain.lastProcessedBlocks = nil
+	blockchain.pruning.pruningStatus(success)
+	if success && blockchain.archiver != nil {
+		blockchain.archiver.committed(blockchain.size)
+	}
 }
 
 func (blockchain *blockchain) persistRawBlock(block *protos.Block, blockNumber uint64) error {
+	writeBatch := blockchain.openchainDB.NewWriteBatch()
+	defer writeBatch.Destroy()
+	if err := blockchain.addRawBlockForPersistence(block, blockNumber, writeBatch); err != nil {
+		blockchain.rawBlocksPersistenceStatus(false)
+		return err
+	}
+	err := blockchain.openchainDB.WriteSync(writeBatch)
+	blockchain.rawBlocksPersistenceStatus(err == nil)
+	return err
+}
+
+// addRawBlockForPersistence adds to writeBatch a block synchronized from another peer, accounting for the
+// blocks added to the same write batch before it. The blockchain is only updated in memory by
+// rawBlocksPersistenceStatus, once the batch is written
+func (blockchain *blockchain) addRawBlockForPersistence(block *protos.Block, blockNumber uint64, writeBatch db.WriteBatch) error {
 	blockBytes, blockBytesErr := block.Bytes()
 	if blockBytesErr != nil {
 		return blockBytesErr
 	}
-	writeBatch := gorocksdb.NewWriteBatch()
-	defer writeBatch.Destroy()
-	writeBatch.PutCF(db.GetDBHandle().BlockchainCF, encodeBlockNumberDBKey(blockNumber), blockBytes)
-
 	blockHash, err := block.GetHash()
 	if err != nil {
 		return err
 	}
+	pending := blockchain.pendingRawBlocks
+	if pending == nil {
+		pending = &rawBlocksChanges{blockchain.size, blockchain.txCount, blockchain.previousBlockHash}
+	}
+
+	// The block may replace one synchronized before
+	txCount := pending.txCount + uint64(len(block.GetTransactions()))
+	previousBlock, err := fetchBlockFromDB(blockchain.openchainDB, blockNumber)
+	if err != nil {
+		return err
+	}
+	if previousBlock != nil {
+		txCount -= uint64(len(previousBlock.GetTransactions()))
+	}
+	writeBatch.PutCF(blockchain.openchainDB.BlockchainCF, encodeBlockNumberDBKey(blockNumber), blockBytes)
+	writeBatch.PutCF(blockchain.openchainDB.BlockchainCF, txCountKey, encodeUint64(txCount))
+	pending.txCount = txCount
 
 	// Need to check as we support out of order blocks in cases such as block/state synchronization. This is
 	// real blockchain height, not size.
-	if blockchain.getSize() < blockNumber+1 {
-		sizeBytes := encodeUint64(blockNumber + 1)
-		writeBatch.PutCF(db.GetDBHandle().BlockchainCF, blockCountKey, sizeBytes)
-		blockchain.size = blockNumber + 1
-		blockchain.previousBlockHash = blockHash
+	if pending.size < blockNumber+1 {
+		writeBatch.PutCF(blockchain.openchainDB.BlockchainCF, blockCountKey, encodeUint64(blockNumber+1))
+		pending.size = blockNumber + 1
+		pending.previousBlockHash = blockHash
 	}
 
 	if blockchain.indexer.isSynchronous() {
 		blockchain.indexer.createIndexesSync(block, blockNumber, blockHash, writeBatch)
 	}
+	blockchain.pendingRawBlocks = pending
+	return nil
+}
 
-	opt := gorocksdb.NewDefaultWriteOptions()
-	defer opt.Destroy()
-	err = db.GetDBHandle().DB.Write(opt, writeBatch)
-	if err != nil {
-		return err
+func (blockchain *blockchain) rawBlocksPersistenceStatus(success bool) {
+	pending := blockchain.pendingRawBlocks
+	blockchain.pendingRawBlocks = nil
+	if !success || pending == nil {
+		return
+	}
+	blockchain.size = pending.size
+	blockchain.txCount = pending.txCount
+	blockchain.previousBlockHash = pending.previousBlockHash
+	if blockchain.archiver != nil {
+		blockchain.archiver.committed(blockchain.size)
 	}
-	return nil
 }
 
-func fetchBlockFromDB(blockNumber uint64) (*protos.Block, error) {
-	blockBytes, err := db.GetDBHandle().GetFromBlockchainCF(encodeBlockNumberDBKey(blockNumber))
+func fetchBlockFromDB(openchainDB *db.OpenchainDB, blockNumber uint64) (*protos.Block, error) {
+	blockBytes, err := openchainDB.GetFromBlockchainCF(encodeBlockNumberDBKey(blockNumber))
 	if err != nil {
 		return nil, err
 	}
@@ -272,8 +470,36 @@ func fetchBlockFromDB(blockNumber uint64) (*protos.Block, error) {
 	return protos.UnmarshallBlock(blockBytes)
 }
 
-func fetchBlockchainSizeFromDB() (uint64, error) {
-	bytes, err := db.GetDBHandle().GetFromBlockchainCF(blockCountKey)
+// fetchTransactionCount returns the number of transactions committed to the blockchain, counting them
+// in the blocks if the blockchain was committed to before the count was persisted
+func (blockchain *blockchain) fetchTransactionCount() (uint64, error) {
+	txCountBytes, err := blockchain.openchainDB.GetFromBlockchainCF(txCountKey)
+	if err != nil {
+		return 0, err
+	}
+	if txCountBytes != nil {
+		return decodeToUint64(txCountBytes), nil
+	}
+	txCount := uint64(0)
+	if blockchain.size > 0 {
+		ledgerLogger.Infof("Counting the transactions of the %d blocks of the blockchain", blockchain.size)
+	}
+	for blockNumber := uint64(0); blockNumber < blockchain.size; blockNumber++ {
+		// Blocks may be missing if they were not all synchronized yet
+		block, err := blockchain.getBlock(blockNumber)
+		if err != nil {
+			return 0, err
+		}
+		if block.IsPruned() {
+			ledgerLogger.Warningf("Not counting the pruned transactions of block %d", blockNumber)
+		}
+		txCount += uint64(len(block.GetTransactions()))
+	}
+	return txCount, nil
+}
+
+func fetchBlockchainSizeFromDB(openchainDB *db.OpenchainDB) (uint64, error) {
+	bytes, err := openchainDB.GetFromBlockchainCF(blockCountKey)
 	if err != nil {
 		return 0, err
 	}
@@ -283,8 +509,8 @@ func fetchBlockchainSizeFromDB() (uint64, error) {
 	return decodeToUint64(bytes), nil
 }
 
-func fetchBlockchainSizeFromSnapshot(snapshot *gorocksdb.Snapshot) (uint64, error) {
-	blockNumberBytes, err := db.GetDBHandle().GetFromBlockchainCFSnapshot(snapshot, blockCountKey)
+func fetchBlockchainSizeFromSnapshot(openchainDB *db.OpenchainDB, snapshot db.Snapshot) (uint64, error) {
+	blockNumberBytes, err := openchainDB.GetFromBlockchainCFSnapshot(snapshot, blockCountKey)
 	if err != nil {
 		return 0, err
 	}
@@ -296,6 +522,7 @@ func fetchBlockchainSizeFromSnapshot(snapshot *gorocksdb.Snapshot) (uint64, erro
 }
 
 var blockCountKey = []byte("blockCount")
+var txCountKey = []byte("txCount")
 
 func encodeBlockNumberDBKey(blockNumber uint64) []byte {
 	return encodeUint64(blockNumber)
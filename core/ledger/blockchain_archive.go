@@ -0,0 +1,229 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ledger
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"sync/atomic"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/hyperledger/fabric/core/db"
+	"github.com/hyperledger/fabric/core/ledger/archive"
+	"github.com/hyperledger/fabric/protos"
+	"github.com/spf13/viper"
+)
+
+var archiveHeightKey = []byte("archiveHeight")
+var archiveSegmentSizeKey = []byte("archiveSegmentSize")
+
+// archiveIndexKey is the key of the index of the archive, which describes
+// its segments so that they can be read without the ledger of the peer, the
+// segment starting at block n being keyed by archiveSegmentKey(n)
+const archiveIndexKey = "index"
+
+type archiveIndex struct {
+	SegmentSize uint64 `json:"segmentSize"`
+	Height      uint64 `json:"height"` // Blocks below height were archived
+}
+
+// blockArchiver ships the blocks of the blockchain to cold storage in
+// segments of segmentSize consecutive blocks, once all of them are
+// committed.  Blocks are only pruned once archived, and the archived copy of
+// a pruned block is read back in its place, after checking it hashes to the
+// hash the block was committed with.
+type blockArchiver struct {
+	openchainDB *db.OpenchainDB
+	store       archive.Store
+	segmentSize uint64
+	height      uint64 // Blocks below height were archived, accessed atomically
+	size        uint64 // Size of the blockchain last committed, accessed atomically
+	notify      chan struct{}
+
+	lock   sync.Mutex
+	cached *protos.SyncBlocks // Segment read last, as blocks are mostly read in order
+}
+
+func loadBlockArchiver(openchainDB *db.OpenchainDB) (*blockArchiver, error) {
+	store, err := archive.NewStore()
+	if err != nil || store == nil {
+		return nil, err
+	}
+	segmentSize := viper.GetInt("ledger.blockchain.archive.segmentSize")
+	if segmentSize <= 0 {
+		return nil, fmt.Errorf("Blocks per archive segment must be greater than 0. Current value is %d.", segmentSize)
+	}
+
+	var height uint64
+	heightBytes, err := openchainDB.GetFromBlockchainCF(archiveHeightKey)
+	if err != nil {
+		return nil, err
+	}
+	if heightBytes != nil {
+		height = decodeToUint64(heightBytes)
+	}
+	// The segments already archived are keyed by the segment size they were
+	// archived with
+	segmentSizeBytes, err := openchainDB.GetFromBlockchainCF(archiveSegmentSizeKey)
+	if err != nil {
+		return nil, err
+	}
+	if segmentSizeBytes != nil && height > 0 {
+		if archived := decodeToUint64(segmentSizeBytes); archived != uint64(segmentSize) {
+			ledgerLogger.Warningf("Archiving segments of %d blocks rather than the configured %d, the segment size blocks were archived with", archived, segmentSize)
+			segmentSize = int(archived)
+		}
+	} else if err := openchainDB.Put(openchainDB.BlockchainCF, archiveSegmentSizeKey, encodeUint64(uint64(segmentSize))); err != nil {
+		return nil, err
+	}
+
+	ledgerLogger.Infof("Archiving blocks in segments of %d, archived below block %d so far", segmentSize, height)
+	archiver := newBlockArchiver(openchainDB, store, uint64(segmentSize), height)
+	go archiver.run()
+	return archiver, nil
+}
+
+func newBlockArchiver(openchainDB *db.OpenchainDB, store archive.Store, segmentSize uint64, height uint64) *blockArchiver {
+	return &blockArchiver{
+		openchainDB: openchainDB,
+		store:       store,
+		segmentSize: segmentSize,
+		height:      height,
+		notify:      make(chan struct{}, 1),
+	}
+}
+
+func (archiver *blockArchiver) run() {
+	for range archiver.notify {
+		if err := archiver.archive(); err != nil {
+			ledgerLogger.Warningf("Failed archiving blocks, retrying after the next commit: %s", err)
+		}
+	}
+}
+
+// committed notifies the archiver of the size of the blockchain once blocks
+// were persisted, the archiving happens in the background
+func (archiver *blockArchiver) committed(size uint64) {
+	atomic.StoreUint64(&archiver.size, size)
+	select {
+	case archiver.notify <- struct{}{}:
+	default:
+	}
+}
+
+// archivedHeight returns the height below which blocks were archived
+func (archiver *blockArchiver) archivedHeight() uint64 {
+	return atomic.LoadUint64(&archiver.height)
+}
+
+// archive ships the segments whose blocks were all committed
+func (archiver *blockArchiver) archive() error {
+	size := atomic.LoadUint64(&archiver.size)
+	for height := archiver.archivedHeight(); height+archiver.segmentSize <= size; height += archiver.segmentSize {
+		segment := &protos.SyncBlocks{Range: &protos.SyncBlockRange{Start: height, End: height + archiver.segmentSize - 1}}
+		for n := segment.Range.Start; n <= segment.Range.End; n++ {
+			block, err := fetchBlockFromDB(archiver.openchainDB, n)
+			if err != nil {
+				return err
+			}
+			if block == nil {
+				// State transfer persists blocks out of order
+				ledgerLogger.Debugf("Not archiving blocks from %d yet, block %d was not persisted", height, n)
+				return nil
+			}
+			if block.IsPruned() {
+				ledgerLogger.Warningf("Archiving block %d without its transactions, it was pruned before archival was enabled", n)
+			}
+			segment.Blocks = append(segment.Blocks, block)
+		}
+		segmentBytes, err := proto.Marshal(segment)
+		if err != nil {
+			return err
+		}
+		if err := archiver.store.Put(archiveSegmentKey(height), segmentBytes); err != nil {
+			return err
+		}
+
+		next := height + archiver.segmentSize
+		indexBytes, err := json.Marshal(&archiveIndex{
+			SegmentSize: archiver.segmentSize,
+			Height:      next,
+		})
+		if err != nil {
+			return err
+		}
+		if err := archiver.store.Put(archiveIndexKey, indexBytes); err != nil {
+			return err
+		}
+		if err := archiver.openchainDB.Put(archiver.openchainDB.BlockchainCF, archiveHeightKey, encodeUint64(next)); err != nil {
+			return err
+		}
+		atomic.StoreUint64(&archiver.height, next)
+		ledgerLogger.Debugf("Archived blocks %d to %d", segment.Range.Start, segment.Range.End)
+	}
+	return nil
+}
+
+// archivedBlock reads a block back from the archive, checking it hashes to
+// hash.  It returns nil if the block was not archived.
+func (archiver *blockArchiver) archivedBlock(blockNumber uint64, hash []byte) (*protos.Block, error) {
+	if blockNumber >= archiver.archivedHeight() {
+		return nil, nil
+	}
+	segment, err := archiver.segment(blockNumber - blockNumber%archiver.segmentSize)
+	if err != nil {
+		return nil, err
+	}
+	block := segment.Blocks[blockNumber-segment.Range.Start]
+	blockHash, err := block.GetHash()
+	if err != nil {
+		return nil, err
+	}
+	if !bytes.Equal(blockHash, hash) {
+		return nil, fmt.Errorf("Archived block %d does not hash to the hash it was committed with", blockNumber)
+	}
+	return block, nil
+}
+
+func (archiver *blockArchiver) segment(start uint64) (*protos.SyncBlocks, error) {
+	archiver.lock.Lock()
+	defer archiver.lock.Unlock()
+	if archiver.cached != nil && archiver.cached.Range.Start == start {
+		return archiver.cached, nil
+	}
+	segmentBytes, err := archiver.store.Get(archiveSegmentKey(start))
+	if err != nil {
+		return nil, err
+	}
+	segment := &protos.SyncBlocks{}
+	if err := proto.Unmarshal(segmentBytes, segment); err != nil {
+		return nil, err
+	}
+	if segment.Range == nil || segment.Range.Start != start || uint64(len(segment.Blocks)) != archiver.segmentSize {
+		return nil, fmt.Errorf("Archived segment %s does not hold blocks %d to %d", archiveSegmentKey(start), start, start+archiver.segmentSize-1)
+	}
+	archiver.cached = segment
+	return segment, nil
+}
+
+// archiveSegmentKey returns the key of the segment starting at block start,
+// padded so that the keys list in order
+func archiveSegmentKey(start uint64) string {
+	return fmt.Sprintf("blocks/%020d", start)
+}
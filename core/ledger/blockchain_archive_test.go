@@ -0,0 +1,139 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ledger
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/hyperledger/fabric/core/db"
+	"github.com/hyperledger/fabric/core/ledger/archive"
+	"github.com/hyperledger/fabric/core/ledger/testutil"
+	"github.com/hyperledger/fabric/protos"
+	"github.com/spf13/viper"
+)
+
+func createTestArchiveStore(t *testing.T) (archive.Store, func()) {
+	dir, err := ioutil.TempDir("", "archive")
+	testutil.AssertNoError(t, err, "Error creating archive directory")
+	store, err := archive.NewFileStore(dir)
+	testutil.AssertNoError(t, err, "Error creating archive store")
+	return store, func() { os.RemoveAll(dir) }
+}
+
+func TestBlockchainArchive(t *testing.T) {
+	ledgerTestWrapper := createFreshDBAndTestLedgerWrapper(t)
+	ledger := ledgerTestWrapper.ledger
+	store, cleanup := createTestArchiveStore(t)
+	defer cleanup()
+	archiver := newBlockArchiver(db.GetDBHandle(), store, 2, 0)
+	ledger.blockchain.archiver = archiver
+	ledger.blockchain.pruning.retainBlocks = 3
+
+	// Blocks are not pruned before they are archived
+	uuids := commitTestBlocks(t, ledger, 7)
+	testutil.AssertEquals(t, ledger.GetPruneHeight(), uint64(0))
+
+	// Only whole segments are archived
+	testutil.AssertNoError(t, archiver.archive(), "Error archiving blocks")
+	testutil.AssertEquals(t, archiver.archivedHeight(), uint64(6))
+	indexBytes, err := store.Get(archiveIndexKey)
+	testutil.AssertNoError(t, err, "Error reading the archive index")
+	index := &archiveIndex{}
+	testutil.AssertNoError(t, json.Unmarshal(indexBytes, index), "Error decoding the archive index")
+	testutil.AssertEquals(t, *index, archiveIndex{SegmentSize: 2, Height: 6})
+
+	uuids = append(uuids, commitTestBlocks(t, ledger, 1)...)
+	testutil.AssertEquals(t, ledger.GetPruneHeight(), uint64(5))
+
+	// Pruned blocks are read back whole from the archive
+	for n := uint64(1); n < 5; n++ {
+		stored, err := fetchBlockFromDB(db.GetDBHandle(), n)
+		testutil.AssertNoError(t, err, "Error fetching block")
+		testutil.AssertEquals(t, stored.IsPruned(), true)
+
+		block := ledgerTestWrapper.GetBlockByNumber(n)
+		testutil.AssertEquals(t, block.IsPruned(), false)
+		testutil.AssertEquals(t, len(block.Transactions), 1)
+		tx, err := ledger.GetTransactionByUUID(uuids[n])
+		testutil.AssertNoError(t, err, "Error fetching a transaction of an archived block")
+		testutil.AssertEquals(t, tx.Uuid, uuids[n])
+	}
+	testutil.AssertEquals(t, ledgerTestWrapper.VerifyChain(7, 0), uint64(0))
+}
+
+func TestBlockchainArchiveCorrupt(t *testing.T) {
+	ledgerTestWrapper := createFreshDBAndTestLedgerWrapper(t)
+	ledger := ledgerTestWrapper.ledger
+	store, cleanup := createTestArchiveStore(t)
+	defer cleanup()
+	archiver := newBlockArchiver(db.GetDBHandle(), store, 4, 0)
+	ledger.blockchain.archiver = archiver
+	ledger.blockchain.pruning.retainBlocks = 2
+
+	commitTestBlocks(t, ledger, 4)
+	testutil.AssertNoError(t, archiver.archive(), "Error archiving blocks")
+	commitTestBlocks(t, ledger, 1)
+	testutil.AssertEquals(t, ledger.GetPruneHeight(), uint64(3))
+
+	// Tamper with a block of the archived segment
+	segmentBytes, err := store.Get(archiveSegmentKey(0))
+	testutil.AssertNoError(t, err, "Error reading archived segment")
+	segment := &protos.SyncBlocks{}
+	testutil.AssertNoError(t, proto.Unmarshal(segmentBytes, segment), "Error decoding archived segment")
+	segment.Blocks[1].ConsensusMetadata = []byte("tampered")
+	segmentBytes, _ = proto.Marshal(segment)
+	testutil.AssertNoError(t, store.Put(archiveSegmentKey(0), segmentBytes), "Error writing archived segment")
+
+	// The archived copy does not hash to the committed hash, the pruned
+	// block is returned instead
+	testutil.AssertEquals(t, ledgerTestWrapper.GetBlockByNumber(1).IsPruned(), true)
+	testutil.AssertEquals(t, ledgerTestWrapper.GetBlockByNumber(2).IsPruned(), false)
+}
+
+func TestBlockchainArchiveRestart(t *testing.T) {
+	dir, err := ioutil.TempDir("", "archive")
+	testutil.AssertNoError(t, err, "Error creating archive directory")
+	defer os.RemoveAll(dir)
+	viper.Set("ledger.blockchain.archive.store", "file")
+	viper.Set("ledger.blockchain.archive.file.path", dir)
+	viper.Set("ledger.blockchain.archive.segmentSize", 2)
+	defer viper.Set("ledger.blockchain.archive.store", "")
+
+	ledger := createFreshDBAndTestLedgerWrapper(t).ledger
+	commitTestBlocks(t, ledger, 5)
+	// The blocks are archived in the background
+	for i := 0; ledger.blockchain.archiver.archivedHeight() < 4; i++ {
+		if i == 100 {
+			t.Fatalf("Expected blocks to be archived, archived below block %d", ledger.blockchain.archiver.archivedHeight())
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	// The segment size blocks were archived with is kept
+	viper.Set("ledger.blockchain.archive.segmentSize", 3)
+	restarted, err := GetNewLedger()
+	testutil.AssertNoError(t, err, "Error while constructing ledger")
+	testutil.AssertEquals(t, restarted.blockchain.archiver.segmentSize, uint64(2))
+	if height := restarted.blockchain.archiver.archivedHeight(); height < 4 {
+		t.Fatalf("Expected the archive height to survive a restart, archived below block %d", height)
+	}
+}
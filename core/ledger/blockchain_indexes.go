@@ -17,32 +17,47 @@ limitations under the License.
 package ledger
 
 import (
+	"bytes"
 	"fmt"
 
 	"github.com/golang/protobuf/proto"
 	"github.com/hyperledger/fabric/core/db"
 	"github.com/hyperledger/fabric/protos"
 	"github.com/op/go-logging"
-	"github.com/tecbot/gorocksdb"
 )
 
 var indexLogger = logging.MustGetLogger("indexes")
 var prefixBlockHashKey = byte(1)
 var prefixTxUUIDKey = byte(2)
 var prefixAddressBlockNumCompositeKey = byte(3)
+var prefixChaincodeBlockNumCompositeKey = byte(5)
+var prefixEventBlockNumCompositeKey = byte(6)
+var prefixTxReceiptKey = byte(7)
+var prefixEventAttributeBlockNumCompositeKey = byte(8)
+
+// blockTxIndexes holds the indexes within a block of the transactions matching an index entry
+type blockTxIndexes struct {
+	blockNumber uint64
+	txIndexes   []uint64
+}
 
 type blockchainIndexer interface {
 	isSynchronous() bool
 	start(blockchain *blockchain) error
-	createIndexesSync(block *protos.Block, blockNumber uint64, blockHash []byte, writeBatch *gorocksdb.WriteBatch) error
+	createIndexesSync(block *protos.Block, blockNumber uint64, blockHash []byte, writeBatch db.WriteBatch) error
 	createIndexesAsync(block *protos.Block, blockNumber uint64, blockHash []byte) error
 	fetchBlockNumberByBlockHash(blockHash []byte) (uint64, error)
 	fetchTransactionIndexByUUID(txUUID string) (uint64, uint64, error)
+	fetchTransactionIndexesByChaincodeID(chaincodeID string, startBlock uint64, endBlock uint64) ([]*blockTxIndexes, error)
+	fetchTransactionIndexesByEventName(eventName string, startBlock uint64, endBlock uint64) ([]*blockTxIndexes, error)
+	fetchTransactionIndexesByEventAttribute(eventName string, attribute *protos.EventAttribute, startBlock uint64, endBlock uint64) ([]*blockTxIndexes, error)
+	fetchTransactionReceipt(txUUID string) (*protos.TransactionReceipt, error)
 	stop()
 }
 
 // Implementation for sync indexer
 type blockchainIndexerSync struct {
+	openchainDB *db.OpenchainDB
 }
 
 func newBlockchainIndexerSync() *blockchainIndexerSync {
@@ -54,12 +69,13 @@ func (indexer *blockchainIndexerSync) isSynchronous() bool {
 }
 
 func (indexer *blockchainIndexerSync) start(blockchain *blockchain) error {
+	indexer.openchainDB = blockchain.openchainDB
 	return nil
 }
 
 func (indexer *blockchainIndexerSync) createIndexesSync(
-	block *protos.Block, blockNumber uint64, blockHash []byte, writeBatch *gorocksdb.WriteBatch) error {
-	return addIndexDataForPersistence(block, blockNumber, blockHash, writeBatch)
+	block *protos.Block, blockNumber uint64, blockHash []byte, writeBatch db.WriteBatch) error {
+	return addIndexDataForPersistence(indexer.openchainDB, block, blockNumber, blockHash, writeBatch)
 }
 
 func (indexer *blockchainIndexerSync) createIndexesAsync(block *protos.Block, blockNumber uint64, blockHash []byte) error {
@@ -67,11 +83,27 @@ func (indexer *blockchainIndexerSync) createIndexesAsync(block *protos.Block, bl
 }
 
 func (indexer *blockchainIndexerSync) fetchBlockNumberByBlockHash(blockHash []byte) (uint64, error) {
-	return fetchBlockNumberByBlockHashFromDB(blockHash)
+	return fetchBlockNumberByBlockHashFromDB(indexer.openchainDB, blockHash)
 }
 
 func (indexer *blockchainIndexerSync) fetchTransactionIndexByUUID(txUUID string) (uint64, uint64, error) {
-	return fetchTransactionIndexByUUIDFromDB(txUUID)
+	return fetchTransactionIndexByUUIDFromDB(indexer.openchainDB, txUUID)
+}
+
+func (indexer *blockchainIndexerSync) fetchTransactionIndexesByChaincodeID(chaincodeID string, startBlock uint64, endBlock uint64) ([]*blockTxIndexes, error) {
+	return fetchBlockTxIndexesFromDB(indexer.openchainDB, prefixChaincodeBlockNumCompositeKey, chaincodeID, startBlock, endBlock)
+}
+
+func (indexer *blockchainIndexerSync) fetchTransactionIndexesByEventName(eventName string, startBlock uint64, endBlock uint64) ([]*blockTxIndexes, error) {
+	return fetchBlockTxIndexesFromDB(indexer.openchainDB, prefixEventBlockNumCompositeKey, eventName, startBlock, endBlock)
+}
+
+func (indexer *blockchainIndexerSync) fetchTransactionIndexesByEventAttribute(eventName string, attribute *protos.EventAttribute, startBlock uint64, endBlock uint64) ([]*blockTxIndexes, error) {
+	return fetchBlockTxIndexesFromDB(indexer.openchainDB, prefixEventAttributeBlockNumCompositeKey, eventAttributeIndexName(eventName, attribute), startBlock, endBlock)
+}
+
+func (indexer *blockchainIndexerSync) fetchTransactionReceipt(txUUID string) (*protos.TransactionReceipt, error) {
+	return fetchTransactionReceiptFromDB(indexer.openchainDB, txUUID)
 }
 
 func (indexer *blockchainIndexerSync) stop() {
@@ -79,8 +111,7 @@ func (indexer *blockchainIndexerSync) stop() {
 }
 
 // Functions for persisting and retrieving index data
-func addIndexDataForPersistence(block *protos.Block, blockNumber uint64, blockHash []byte, writeBatch *gorocksdb.WriteBatch) error {
-	openchainDB := db.GetDBHandle()
+func addIndexDataForPersistence(openchainDB *db.OpenchainDB, block *protos.Block, blockNumber uint64, blockHash []byte, writeBatch db.WriteBatch) error {
 	cf := openchainDB.IndexesCF
 
 	// add blockhash -> blockNumber
@@ -89,11 +120,20 @@ func addIndexDataForPersistence(block *protos.Block, blockNumber uint64, blockHa
 
 	addressToTxIndexesMap := make(map[string][]uint64)
 	addressToChaincodeIDsMap := make(map[string][]*protos.ChaincodeID)
+	chaincodeToTxIndexesMap := make(map[string][]uint64)
+	eventToTxIndexesMap := make(map[string][]uint64)
+	eventAttributeToTxIndexesMap := make(map[string][]uint64)
+	txUUIDToTxIndexMap := make(map[string]uint64)
 
 	transactions := block.GetTransactions()
 	for txIndex, tx := range transactions {
 		// add TxUUID -> (blockNumber,indexWithinBlock)
 		writeBatch.PutCF(cf, encodeTxUUIDKey(tx.Uuid), encodeBlockNumTxIndex(blockNumber, uint64(txIndex)))
+		txUUIDToTxIndexMap[tx.Uuid] = uint64(txIndex)
+
+		if chaincodeName := getTxChaincodeName(tx); chaincodeName != "" {
+			chaincodeToTxIndexesMap[chaincodeName] = append(chaincodeToTxIndexesMap[chaincodeName], uint64(txIndex))
+		}
 
 		txExecutingAddress := getTxExecutingAddress(tx)
 		addressToTxIndexesMap[txExecutingAddress] = append(addressToTxIndexesMap[txExecutingAddress], uint64(txIndex))
@@ -109,12 +149,104 @@ func addIndexDataForPersistence(block *protos.Block, blockNumber uint64, blockHa
 	for address, txsIndexes := range addressToTxIndexesMap {
 		writeBatch.PutCF(cf, encodeAddressBlockNumCompositeKey(address, blockNumber), encodeListTxIndexes(txsIndexes))
 	}
+
+	// add (chaincodeName,blockNumber) -> txIndexes of the transactions deploying or invoking the chaincode
+	for chaincodeName, txsIndexes := range chaincodeToTxIndexesMap {
+		writeBatch.PutCF(cf, encodeNameBlockNumCompositeKey(prefixChaincodeBlockNumCompositeKey, chaincodeName, blockNumber), encodeListTxIndexes(txsIndexes))
+	}
+
+	// add (eventName,blockNumber) -> txIndexes of the transactions which emitted the event, and
+	// (eventName,attribute,blockNumber) -> txIndexes of those which emitted it with an indexed attribute
+	if block.NonHashData != nil {
+		for _, txResult := range block.NonHashData.TransactionResults {
+			txIndex, ok := txUUIDToTxIndexMap[txResult.Uuid]
+			if !ok {
+				continue
+			}
+			for _, event := range txResultEvents(txResult) {
+				if event.EventName == "" {
+					continue
+				}
+				eventToTxIndexesMap[event.EventName] = appendTxIndex(eventToTxIndexesMap[event.EventName], txIndex)
+				for _, attribute := range event.Attributes {
+					if !attribute.Indexed {
+						continue
+					}
+					name := eventAttributeIndexName(event.EventName, attribute)
+					eventAttributeToTxIndexesMap[name] = appendTxIndex(eventAttributeToTxIndexesMap[name], txIndex)
+				}
+			}
+		}
+	}
+	for eventName, txsIndexes := range eventToTxIndexesMap {
+		writeBatch.PutCF(cf, encodeNameBlockNumCompositeKey(prefixEventBlockNumCompositeKey, eventName, blockNumber), encodeListTxIndexes(txsIndexes))
+	}
+	for name, txsIndexes := range eventAttributeToTxIndexesMap {
+		writeBatch.PutCF(cf, encodeNameBlockNumCompositeKey(prefixEventAttributeBlockNumCompositeKey, name, blockNumber), encodeListTxIndexes(txsIndexes))
+	}
+
+	// add TxUUID -> receipt, for the transactions of the block and those which failed
+	for _, receipt := range buildTransactionReceipts(block, blockNumber) {
+		receiptBytes, err := proto.Marshal(receipt)
+		if err != nil {
+			return err
+		}
+		writeBatch.PutCF(cf, encodeTxReceiptKey(receipt.Uuid), receiptBytes)
+	}
+	return nil
+}
+
+// buildTransactionReceipts returns the receipts of the transactions executed for block, from the results recorded
+// in its NonHashData. A transaction of the block without a result succeeded, one with a result which is not in the
+// block failed
+func buildTransactionReceipts(block *protos.Block, blockNumber uint64) []*protos.TransactionReceipt {
+	receipts := []*protos.TransactionReceipt{}
+	receiptsByUUID := make(map[string]*protos.TransactionReceipt)
+	for _, tx := range block.GetTransactions() {
+		receipt := &protos.TransactionReceipt{Uuid: tx.Uuid, BlockNumber: blockNumber}
+		receipts = append(receipts, receipt)
+		receiptsByUUID[tx.Uuid] = receipt
+	}
+	for _, txResult := range block.GetNonHashData().GetTransactionResults() {
+		receipt, ok := receiptsByUUID[txResult.Uuid]
+		if !ok {
+			receipt = &protos.TransactionReceipt{Uuid: txResult.Uuid, BlockNumber: blockNumber, Status: protos.TransactionReceipt_FAILURE}
+			receipts = append(receipts, receipt)
+			receiptsByUUID[txResult.Uuid] = receipt
+		}
+		receipt.ErrorCode = txResult.ErrorCode
+		receipt.Error = txResult.Error
+		receipt.Result = txResult.Result
+		receipt.ChaincodeEvent = txResult.ChaincodeEvent
+		receipt.ReadWriteSet = txResult.ReadWriteSet
+		receipt.ChaincodeEvents = txResult.ChaincodeEvents
+	}
+	return receipts
+}
+
+// txResultEvents returns the events emitted by a transaction. The results recorded before a transaction could emit
+// several events only have chaincodeEvent set
+func txResultEvents(txResult *protos.TransactionResult) []*protos.ChaincodeEvent {
+	if len(txResult.ChaincodeEvents) > 0 {
+		return txResult.ChaincodeEvents
+	}
+	if txResult.ChaincodeEvent != nil {
+		return []*protos.ChaincodeEvent{txResult.ChaincodeEvent}
+	}
 	return nil
 }
 
-func fetchBlockNumberByBlockHashFromDB(blockHash []byte) (uint64, error) {
+// appendTxIndex appends txIndex to the transaction indexes of an index entry, unless it was appended last
+func appendTxIndex(txIndexes []uint64, txIndex uint64) []uint64 {
+	if len(txIndexes) > 0 && txIndexes[len(txIndexes)-1] == txIndex {
+		return txIndexes
+	}
+	return append(txIndexes, txIndex)
+}
+
+func fetchBlockNumberByBlockHashFromDB(openchainDB *db.OpenchainDB, blockHash []byte) (uint64, error) {
 	indexLogger.Debugf("fetchBlockNumberByBlockHashFromDB() for blockhash [%x]", blockHash)
-	blockNumberBytes, err := db.GetDBHandle().GetFromIndexesCF(encodeBlockHashKey(blockHash))
+	blockNumberBytes, err := openchainDB.GetFromIndexesCF(encodeBlockHashKey(blockHash))
 	if err != nil {
 		return 0, err
 	}
@@ -126,8 +258,8 @@ func fetchBlockNumberByBlockHashFromDB(blockHash []byte) (uint64, error) {
 	return blockNumber, nil
 }
 
-func fetchTransactionIndexByUUIDFromDB(txUUID string) (uint64, uint64, error) {
-	blockNumTxIndexBytes, err := db.GetDBHandle().GetFromIndexesCF(encodeTxUUIDKey(txUUID))
+func fetchTransactionIndexByUUIDFromDB(openchainDB *db.OpenchainDB, txUUID string) (uint64, uint64, error) {
+	blockNumTxIndexBytes, err := openchainDB.GetFromIndexesCF(encodeTxUUIDKey(txUUID))
 	if err != nil {
 		return 0, 0, err
 	}
@@ -137,6 +269,47 @@ func fetchTransactionIndexByUUIDFromDB(txUUID string) (uint64, uint64, error) {
 	return decodeBlockNumTxIndex(blockNumTxIndexBytes)
 }
 
+func fetchTransactionReceiptFromDB(openchainDB *db.OpenchainDB, txUUID string) (*protos.TransactionReceipt, error) {
+	receiptBytes, err := openchainDB.GetFromIndexesCF(encodeTxReceiptKey(txUUID))
+	if err != nil {
+		return nil, err
+	}
+	if receiptBytes == nil {
+		return nil, ErrResourceNotFound
+	}
+	receipt := &protos.TransactionReceipt{}
+	if err := proto.Unmarshal(receiptBytes, receipt); err != nil {
+		return nil, err
+	}
+	return receipt, nil
+}
+
+// fetchBlockTxIndexesFromDB returns, in the order of the blocks, the transaction indexes stored under the
+// composite keys of name for the blocks from startBlock to endBlock (inclusive)
+func fetchBlockTxIndexesFromDB(openchainDB *db.OpenchainDB, prefix byte, name string, startBlock uint64, endBlock uint64) ([]*blockTxIndexes, error) {
+	itr := openchainDB.GetIterator(openchainDB.IndexesCF)
+	defer itr.Close()
+	startKey := encodeNameBlockNumCompositeKey(prefix, name, startBlock)
+	keyPrefix := startKey[:len(startKey)-8]
+	results := []*blockTxIndexes{}
+	for itr.Seek(startKey); itr.Valid(); itr.Next() {
+		key := itr.Key()
+		if !bytes.HasPrefix(key, keyPrefix) || len(key) != len(startKey) {
+			break
+		}
+		blockNumber := decodeToUint64(key[len(keyPrefix):])
+		if blockNumber > endBlock {
+			break
+		}
+		txIndexes, err := decodeListTxIndexes(itr.Value())
+		if err != nil {
+			return nil, err
+		}
+		results = append(results, &blockTxIndexes{blockNumber, txIndexes})
+	}
+	return results, nil
+}
+
 func getTxExecutingAddress(tx *protos.Transaction) string {
 	// TODO Fetch address form tx
 	return "address1"
@@ -154,6 +327,19 @@ func getAuthorisedAddresses(tx *protos.Transaction) ([]string, *protos.Chaincode
 	return []string{"address1", "address2"}, cID
 }
 
+// getTxChaincodeName returns the name of the chaincode a transaction deploys or invokes, "" if it cannot be read
+// (e.g., for a confidential transaction)
+func getTxChaincodeName(tx *protos.Transaction) string {
+	if len(tx.ChaincodeID) == 0 {
+		return ""
+	}
+	cID := &protos.ChaincodeID{}
+	if err := proto.Unmarshal(tx.ChaincodeID, cID); err != nil {
+		return ""
+	}
+	return cID.Name
+}
+
 // functions for encoding/decoding db keys/values for index data
 // encode / decode BlockNumber
 func encodeBlockNumber(blockNumber uint64) []byte {
@@ -196,6 +382,10 @@ func encodeTxUUIDKey(txUUID string) []byte {
 	return prependKeyPrefix(prefixTxUUIDKey, []byte(txUUID))
 }
 
+func encodeTxReceiptKey(txUUID string) []byte {
+	return prependKeyPrefix(prefixTxReceiptKey, []byte(txUUID))
+}
+
 func encodeAddressBlockNumCompositeKey(address string, blockNumber uint64) []byte {
 	b := proto.NewBuffer([]byte{prefixAddressBlockNumCompositeKey})
 	b.EncodeRawBytes([]byte(address))
@@ -203,6 +393,24 @@ func encodeAddressBlockNumCompositeKey(address string, blockNumber uint64) []byt
 	return b.Bytes()
 }
 
+// encodeNameBlockNumCompositeKey encodes the block number big-endian, so that the keys of a name sort by block
+func encodeNameBlockNumCompositeKey(prefix byte, name string, blockNumber uint64) []byte {
+	b := proto.NewBuffer([]byte{prefix})
+	b.EncodeRawBytes([]byte(name))
+	return append(b.Bytes(), encodeUint64(blockNumber)...)
+}
+
+// eventAttributeIndexName returns the name the transactions which emitted an event of eventName with attribute are
+// indexed under, which tells apart the values of different types
+func eventAttributeIndexName(eventName string, attribute *protos.EventAttribute) string {
+	b := proto.NewBuffer([]byte{})
+	b.EncodeRawBytes([]byte(eventName))
+	b.EncodeRawBytes([]byte(attribute.Name))
+	b.EncodeVarint(uint64(attribute.Type))
+	b.EncodeRawBytes([]byte(attribute.Value))
+	return string(b.Bytes())
+}
+
 func encodeListTxIndexes(listTx []uint64) []byte {
 	b := proto.NewBuffer([]byte{})
 	for i := range listTx {
@@ -211,6 +419,19 @@ func encodeListTxIndexes(listTx []uint64) []byte {
 	return b.Bytes()
 }
 
+func decodeListTxIndexes(listTxBytes []byte) ([]uint64, error) {
+	listTx := []uint64{}
+	for len(listTxBytes) > 0 {
+		txIndex, n := proto.DecodeVarint(listTxBytes)
+		if n == 0 {
+			return nil, fmt.Errorf("Invalid list of transaction indexes [%x]", listTxBytes)
+		}
+		listTx = append(listTx, txIndex)
+		listTxBytes = listTxBytes[n:]
+	}
+	return listTx, nil
+}
+
 func prependKeyPrefix(prefix byte, key []byte) []byte {
 	modifiedKey := []byte{}
 	modifiedKey = append(modifiedKey, prefix)
@@ -22,7 +22,6 @@ import (
 
 	"github.com/hyperledger/fabric/core/db"
 	"github.com/hyperledger/fabric/protos"
-	"github.com/tecbot/gorocksdb"
 )
 
 var lastIndexedBlockKey = []byte{byte(0)}
@@ -100,7 +99,7 @@ func (indexer *blockchainIndexerAsync) start(blockchain *blockchain) error {
 }
 
 func (indexer *blockchainIndexerAsync) createIndexesSync(
-	block *protos.Block, blockNumber uint64, blockHash []byte, writeBatch *gorocksdb.WriteBatch) error {
+	block *protos.Block, blockNumber uint64, blockHash []byte, writeBatch db.WriteBatch) error {
 	return fmt.Errorf("Method not applicable")
 }
 
@@ -111,14 +110,12 @@ func (indexer *blockchainIndexerAsync) createIndexesAsync(block *protos.Block, b
 
 // createIndexes adds entries into db for creating indexes on various attributes
 func (indexer *blockchainIndexerAsync) createIndexesInternal(block *protos.Block, blockNumber uint64, blockHash []byte) error {
-	openchainDB := db.GetDBHandle()
-	writeBatch := gorocksdb.NewWriteBatch()
+	openchainDB := indexer.blockchain.openchainDB
+	writeBatch := openchainDB.NewWriteBatch()
 	defer writeBatch.Destroy()
-	addIndexDataForPersistence(block, blockNumber, blockHash, writeBatch)
+	addIndexDataForPersistence(openchainDB, block, blockNumber, blockHash, writeBatch)
 	writeBatch.PutCF(openchainDB.IndexesCF, lastIndexedBlockKey, encodeBlockNumber(blockNumber))
-	opt := gorocksdb.NewDefaultWriteOptions()
-	defer opt.Destroy()
-	err := openchainDB.DB.Write(opt, writeBatch)
+	err := openchainDB.Write(writeBatch)
 	if err != nil {
 		return err
 	}
@@ -133,7 +130,7 @@ func (indexer *blockchainIndexerAsync) fetchBlockNumberByBlockHash(blockHash []b
 		return 0, err
 	}
 	indexer.indexerState.waitForLastCommittedBlock()
-	return fetchBlockNumberByBlockHashFromDB(blockHash)
+	return fetchBlockNumberByBlockHashFromDB(indexer.blockchain.openchainDB, blockHash)
 }
 
 func (indexer *blockchainIndexerAsync) fetchTransactionIndexByUUID(txUUID string) (uint64, uint64, error) {
@@ -142,7 +139,43 @@ func (indexer *blockchainIndexerAsync) fetchTransactionIndexByUUID(txUUID string
 		return 0, 0, err
 	}
 	indexer.indexerState.waitForLastCommittedBlock()
-	return fetchTransactionIndexByUUIDFromDB(txUUID)
+	return fetchTransactionIndexByUUIDFromDB(indexer.blockchain.openchainDB, txUUID)
+}
+
+func (indexer *blockchainIndexerAsync) fetchTransactionIndexesByChaincodeID(chaincodeID string, startBlock uint64, endBlock uint64) ([]*blockTxIndexes, error) {
+	err := indexer.indexerState.checkError()
+	if err != nil {
+		return nil, err
+	}
+	indexer.indexerState.waitForLastCommittedBlock()
+	return fetchBlockTxIndexesFromDB(indexer.blockchain.openchainDB, prefixChaincodeBlockNumCompositeKey, chaincodeID, startBlock, endBlock)
+}
+
+func (indexer *blockchainIndexerAsync) fetchTransactionIndexesByEventName(eventName string, startBlock uint64, endBlock uint64) ([]*blockTxIndexes, error) {
+	err := indexer.indexerState.checkError()
+	if err != nil {
+		return nil, err
+	}
+	indexer.indexerState.waitForLastCommittedBlock()
+	return fetchBlockTxIndexesFromDB(indexer.blockchain.openchainDB, prefixEventBlockNumCompositeKey, eventName, startBlock, endBlock)
+}
+
+func (indexer *blockchainIndexerAsync) fetchTransactionIndexesByEventAttribute(eventName string, attribute *protos.EventAttribute, startBlock uint64, endBlock uint64) ([]*blockTxIndexes, error) {
+	err := indexer.indexerState.checkError()
+	if err != nil {
+		return nil, err
+	}
+	indexer.indexerState.waitForLastCommittedBlock()
+	return fetchBlockTxIndexesFromDB(indexer.blockchain.openchainDB, prefixEventAttributeBlockNumCompositeKey, eventAttributeIndexName(eventName, attribute), startBlock, endBlock)
+}
+
+func (indexer *blockchainIndexerAsync) fetchTransactionReceipt(txUUID string) (*protos.TransactionReceipt, error) {
+	err := indexer.indexerState.checkError()
+	if err != nil {
+		return nil, err
+	}
+	indexer.indexerState.waitForLastCommittedBlock()
+	return fetchTransactionReceiptFromDB(indexer.blockchain.openchainDB, txUUID)
 }
 
 func (indexer *blockchainIndexerAsync) indexPendingBlocks() error {
@@ -226,7 +259,7 @@ type blockchainIndexerState struct {
 
 func newBlockchainIndexerState(indexer *blockchainIndexerAsync) (*blockchainIndexerState, error) {
 	var lock sync.RWMutex
-	zerothBlockIndexed, lastIndexedBlockNum, err := fetchLastIndexedBlockNumFromDB()
+	zerothBlockIndexed, lastIndexedBlockNum, err := fetchLastIndexedBlockNumFromDB(indexer.blockchain.openchainDB)
 	if err != nil {
 		return nil, err
 	}
@@ -315,8 +348,8 @@ func (indexerState *blockchainIndexerState) checkError() error {
 	return indexerState.err
 }
 
-func fetchLastIndexedBlockNumFromDB() (zerothBlockIndexed bool, lastIndexedBlockNum uint64, err error) {
-	lastIndexedBlockNumberBytes, err := db.GetDBHandle().GetFromIndexesCF(lastIndexedBlockKey)
+func fetchLastIndexedBlockNumFromDB(openchainDB *db.OpenchainDB) (zerothBlockIndexed bool, lastIndexedBlockNum uint64, err error) {
+	lastIndexedBlockNumberBytes, err := openchainDB.GetFromIndexesCF(lastIndexedBlockKey)
 	if err != nil {
 		return
 	}
@@ -22,9 +22,9 @@ import (
 	"testing"
 	"time"
 
+	"github.com/hyperledger/fabric/core/db"
 	"github.com/hyperledger/fabric/core/ledger/testutil"
 	"github.com/hyperledger/fabric/protos"
-	"github.com/tecbot/gorocksdb"
 )
 
 func TestIndexesAsync_GetBlockByBlockNumber(t *testing.T) {
@@ -69,6 +69,27 @@ func TestIndexesAsync_GetTransactionByUUID(t *testing.T) {
 	testIndexesGetTransactionByUUID(t)
 }
 
+func TestIndexesAsync_GetTransactionsByChaincodeIDAndEventName(t *testing.T) {
+	defaultSetting := indexBlockDataSynchronously
+	indexBlockDataSynchronously = false
+	defer func() { indexBlockDataSynchronously = defaultSetting }()
+	testIndexesGetTransactionsByChaincodeIDAndEventName(t)
+}
+
+func TestIndexesAsync_GetBlockNumbersByEventAttribute(t *testing.T) {
+	defaultSetting := indexBlockDataSynchronously
+	indexBlockDataSynchronously = false
+	defer func() { indexBlockDataSynchronously = defaultSetting }()
+	testIndexesGetBlockNumbersByEventAttribute(t)
+}
+
+func TestIndexesAsync_GetTransactionReceipt(t *testing.T) {
+	defaultSetting := indexBlockDataSynchronously
+	indexBlockDataSynchronously = false
+	defer func() { indexBlockDataSynchronously = defaultSetting }()
+	testIndexesGetTransactionReceipt(t)
+}
+
 func TestIndexesAsync_IndexingErrorScenario(t *testing.T) {
 	defaultSetting := indexBlockDataSynchronously
 	indexBlockDataSynchronously = false
@@ -155,7 +176,7 @@ func (noop *NoopIndexer) isSynchronous() bool {
 func (noop *NoopIndexer) start(blockchain *blockchain) error {
 	return nil
 }
-func (noop *NoopIndexer) createIndexesSync(block *protos.Block, blockNumber uint64, blockHash []byte, writeBatch *gorocksdb.WriteBatch) error {
+func (noop *NoopIndexer) createIndexesSync(block *protos.Block, blockNumber uint64, blockHash []byte, writeBatch db.WriteBatch) error {
 	return nil
 }
 func (noop *NoopIndexer) createIndexesAsync(block *protos.Block, blockNumber uint64, blockHash []byte) error {
@@ -167,6 +188,19 @@ func (noop *NoopIndexer) fetchBlockNumberByBlockHash(blockHash []byte) (uint64,
 func (noop *NoopIndexer) fetchTransactionIndexByUUID(txUUID string) (uint64, uint64, error) {
 	return 0, 0, nil
 }
+func (noop *NoopIndexer) fetchTransactionIndexesByChaincodeID(chaincodeID string, startBlock uint64, endBlock uint64) ([]*blockTxIndexes, error) {
+	return nil, nil
+}
+func (noop *NoopIndexer) fetchTransactionIndexesByEventName(eventName string, startBlock uint64, endBlock uint64) ([]*blockTxIndexes, error) {
+	return nil, nil
+}
+
+func (noop *NoopIndexer) fetchTransactionIndexesByEventAttribute(eventName string, attribute *protos.EventAttribute, startBlock uint64, endBlock uint64) ([]*blockTxIndexes, error) {
+	return nil, nil
+}
+func (noop *NoopIndexer) fetchTransactionReceipt(txUUID string) (*protos.TransactionReceipt, error) {
+	return nil, nil
+}
 func (noop *NoopIndexer) stop() {
 }
 
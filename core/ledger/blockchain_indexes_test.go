@@ -65,6 +65,27 @@ func TestIndexes_GetTransactionByUUID(t *testing.T) {
 	testIndexesGetTransactionByUUID(t)
 }
 
+func TestIndexes_GetTransactionsByChaincodeIDAndEventName(t *testing.T) {
+	defaultSetting := indexBlockDataSynchronously
+	indexBlockDataSynchronously = true
+	defer func() { indexBlockDataSynchronously = defaultSetting }()
+	testIndexesGetTransactionsByChaincodeIDAndEventName(t)
+}
+
+func TestIndexes_GetBlockNumbersByEventAttribute(t *testing.T) {
+	defaultSetting := indexBlockDataSynchronously
+	indexBlockDataSynchronously = true
+	defer func() { indexBlockDataSynchronously = defaultSetting }()
+	testIndexesGetBlockNumbersByEventAttribute(t)
+}
+
+func TestIndexes_GetTransactionReceipt(t *testing.T) {
+	defaultSetting := indexBlockDataSynchronously
+	indexBlockDataSynchronously = true
+	defer func() { indexBlockDataSynchronously = defaultSetting }()
+	testIndexesGetTransactionReceipt(t)
+}
+
 func testIndexesGetBlockByBlockNumber(t *testing.T) {
 	testDBWrapper.CleanDB(t)
 	testBlockchainWrapper := newTestBlockchainWrapper(t)
@@ -159,3 +180,154 @@ func testIndexesGetTransactionByUUID(t *testing.T) {
 	testutil.AssertEquals(t, testBlockchainWrapper.getTransactionByUUID(uuid3), tx3)
 	testutil.AssertEquals(t, testBlockchainWrapper.getTransactionByUUID(uuid4), tx4)
 }
+
+func testIndexesGetTransactionsByChaincodeIDAndEventName(t *testing.T) {
+	testDBWrapper.CleanDB(t)
+	testBlockchainWrapper := newTestBlockchainWrapper(t)
+	defer func() { testBlockchainWrapper.blockchain.indexer.stop() }()
+	buildTx := func(chaincodeName string) *protos.Transaction {
+		tx, err := protos.NewTransaction(protos.ChaincodeID{Name: chaincodeName}, testutil.GenerateUUID(t), "anyfunction", []string{"param1"})
+		testutil.AssertNoError(t, err, "Error while building a transaction")
+		return tx
+	}
+	eventResult := func(tx *protos.Transaction, eventName string) *protos.TransactionResult {
+		return &protos.TransactionResult{Uuid: tx.Uuid, ChaincodeEvent: &protos.ChaincodeEvent{TxID: tx.Uuid, EventName: eventName}}
+	}
+
+	// block 0 - no transaction
+	testBlockchainWrapper.addNewBlock(protos.NewBlock(nil, nil), []byte("stateHash0"))
+	// block 1 - chaincode1 twice (emitting event1 once), chaincode2 once (emitting event2)
+	tx1, tx2, tx3 := buildTx("chaincode1"), buildTx("chaincode2"), buildTx("chaincode1")
+	block1 := protos.NewBlock([]*protos.Transaction{tx1, tx2, tx3}, nil)
+	block1.NonHashData = &protos.NonHashData{TransactionResults: []*protos.TransactionResult{eventResult(tx2, "event2"), eventResult(tx3, "event1")}}
+	testBlockchainWrapper.addNewBlock(block1, []byte("stateHash1"))
+	// block 2 - chaincode2 once, no event
+	tx4 := buildTx("chaincode2")
+	testBlockchainWrapper.addNewBlock(protos.NewBlock([]*protos.Transaction{tx4}, nil), []byte("stateHash2"))
+	// block 3 - chaincode1 once (emitting event1)
+	tx5 := buildTx("chaincode1")
+	block3 := protos.NewBlock([]*protos.Transaction{tx5}, nil)
+	block3.NonHashData = &protos.NonHashData{TransactionResults: []*protos.TransactionResult{eventResult(tx5, "event1")}}
+	testBlockchainWrapper.addNewBlock(block3, []byte("stateHash3"))
+
+	chain := testBlockchainWrapper.blockchain
+	transactions, err := chain.getTransactionsByChaincodeID("chaincode1", 0, 3)
+	testutil.AssertNoError(t, err, "Error while getting transactions by chaincode ID")
+	testutil.AssertEquals(t, transactions, []*protos.Transaction{tx1, tx3, tx5})
+	transactions, err = chain.getTransactionsByChaincodeID("chaincode1", 2, 3)
+	testutil.AssertNoError(t, err, "Error while getting transactions by chaincode ID")
+	testutil.AssertEquals(t, transactions, []*protos.Transaction{tx5})
+	transactions, err = chain.getTransactionsByChaincodeID("chaincode2", 0, 1)
+	testutil.AssertNoError(t, err, "Error while getting transactions by chaincode ID")
+	testutil.AssertEquals(t, transactions, []*protos.Transaction{tx2})
+	transactions, err = chain.getTransactionsByChaincodeID("chaincode", 0, 3)
+	testutil.AssertNoError(t, err, "Error while getting transactions by chaincode ID")
+	testutil.AssertEquals(t, len(transactions), 0)
+
+	blockNumbers, err := chain.getBlockNumbersByEventName("event1", 0, 3)
+	testutil.AssertNoError(t, err, "Error while getting block numbers by event name")
+	testutil.AssertEquals(t, blockNumbers, []uint64{1, 3})
+	blockNumbers, err = chain.getBlockNumbersByEventName("event1", 2, 2)
+	testutil.AssertNoError(t, err, "Error while getting block numbers by event name")
+	testutil.AssertEquals(t, blockNumbers, []uint64{})
+	blockNumbers, err = chain.getBlockNumbersByEventName("event2", 0, 3)
+	testutil.AssertNoError(t, err, "Error while getting block numbers by event name")
+	testutil.AssertEquals(t, blockNumbers, []uint64{1})
+}
+
+func testIndexesGetBlockNumbersByEventAttribute(t *testing.T) {
+	testDBWrapper.CleanDB(t)
+	testBlockchainWrapper := newTestBlockchainWrapper(t)
+	defer func() { testBlockchainWrapper.blockchain.indexer.stop() }()
+	buildTx := func() *protos.Transaction {
+		tx, err := protos.NewTransaction(protos.ChaincodeID{Name: "chaincode1"}, testutil.GenerateUUID(t), "anyfunction", []string{"param1"})
+		testutil.AssertNoError(t, err, "Error while building a transaction")
+		return tx
+	}
+	owner := func(name string) *protos.EventAttribute {
+		return &protos.EventAttribute{Name: "owner", Type: protos.EventAttribute_STRING, Value: name, Indexed: true}
+	}
+	amount := &protos.EventAttribute{Name: "amount", Type: protos.EventAttribute_INTEGER, Value: "10", Indexed: true}
+	unindexed := &protos.EventAttribute{Name: "memo", Type: protos.EventAttribute_STRING, Value: "rent"}
+
+	// block 0 - a transaction emitting transfer (owner alice, amount 10) and audit (owner alice)
+	tx1 := buildTx()
+	block0 := protos.NewBlock([]*protos.Transaction{tx1}, nil)
+	block0.NonHashData = &protos.NonHashData{TransactionResults: []*protos.TransactionResult{{Uuid: tx1.Uuid, ChaincodeEvents: []*protos.ChaincodeEvent{
+		{EventName: "transfer", Attributes: []*protos.EventAttribute{owner("alice"), amount, unindexed}},
+		{EventName: "audit", Attributes: []*protos.EventAttribute{owner("alice")}},
+	}}}}
+	testBlockchainWrapper.addNewBlock(block0, []byte("stateHash0"))
+	// block 1 - a transaction emitting transfer (owner bob)
+	tx2 := buildTx()
+	block1 := protos.NewBlock([]*protos.Transaction{tx2}, nil)
+	block1.NonHashData = &protos.NonHashData{TransactionResults: []*protos.TransactionResult{{Uuid: tx2.Uuid, ChaincodeEvents: []*protos.ChaincodeEvent{
+		{EventName: "transfer", Attributes: []*protos.EventAttribute{owner("bob")}},
+	}}}}
+	testBlockchainWrapper.addNewBlock(block1, []byte("stateHash1"))
+
+	chain := testBlockchainWrapper.blockchain
+	blockNumbers, err := chain.getBlockNumbersByEventName("audit", 0, 1)
+	testutil.AssertNoError(t, err, "Error while getting block numbers by event name")
+	testutil.AssertEquals(t, blockNumbers, []uint64{0})
+	blockNumbers, err = chain.getBlockNumbersByEventName("transfer", 0, 1)
+	testutil.AssertNoError(t, err, "Error while getting block numbers by event name")
+	testutil.AssertEquals(t, blockNumbers, []uint64{0, 1})
+
+	blockNumbers, err = chain.getBlockNumbersByEventAttribute("transfer", owner("bob"), 0, 1)
+	testutil.AssertNoError(t, err, "Error while getting block numbers by event attribute")
+	testutil.AssertEquals(t, blockNumbers, []uint64{1})
+	blockNumbers, err = chain.getBlockNumbersByEventAttribute("transfer", amount, 0, 1)
+	testutil.AssertNoError(t, err, "Error while getting block numbers by event attribute")
+	testutil.AssertEquals(t, blockNumbers, []uint64{0})
+	blockNumbers, err = chain.getBlockNumbersByEventAttribute("audit", owner("bob"), 0, 1)
+	testutil.AssertNoError(t, err, "Error while getting block numbers by event attribute")
+	testutil.AssertEquals(t, blockNumbers, []uint64{})
+	// a value of another type or an attribute which is not indexed is not found
+	blockNumbers, err = chain.getBlockNumbersByEventAttribute("transfer", &protos.EventAttribute{Name: "amount", Type: protos.EventAttribute_STRING, Value: "10"}, 0, 1)
+	testutil.AssertNoError(t, err, "Error while getting block numbers by event attribute")
+	testutil.AssertEquals(t, blockNumbers, []uint64{})
+	blockNumbers, err = chain.getBlockNumbersByEventAttribute("transfer", unindexed, 0, 1)
+	testutil.AssertNoError(t, err, "Error while getting block numbers by event attribute")
+	testutil.AssertEquals(t, blockNumbers, []uint64{})
+
+	receipt, err := chain.getTransactionReceipt(tx1.Uuid)
+	testutil.AssertNoError(t, err, "Error while getting a transaction receipt")
+	testutil.AssertEquals(t, len(receipt.ChaincodeEvents), 2)
+}
+
+func testIndexesGetTransactionReceipt(t *testing.T) {
+	testDBWrapper.CleanDB(t)
+	testBlockchainWrapper := newTestBlockchainWrapper(t)
+	defer func() { testBlockchainWrapper.blockchain.indexer.stop() }()
+	buildTx := func() *protos.Transaction {
+		tx, err := protos.NewTransaction(protos.ChaincodeID{Name: "chaincode1"}, testutil.GenerateUUID(t), "anyfunction", []string{"param1"})
+		testutil.AssertNoError(t, err, "Error while building a transaction")
+		return tx
+	}
+
+	// block 1 - tx1 with a result and an event, tx2 without a result, failedTx not in the block
+	testBlockchainWrapper.addNewBlock(protos.NewBlock(nil, nil), []byte("stateHash0"))
+	tx1, tx2, failedTx := buildTx(), buildTx(), buildTx()
+	event := &protos.ChaincodeEvent{TxID: tx1.Uuid, EventName: "event1"}
+	block1 := protos.NewBlock([]*protos.Transaction{tx1, tx2}, nil)
+	block1.NonHashData = &protos.NonHashData{TransactionResults: []*protos.TransactionResult{
+		{Uuid: tx1.Uuid, Result: []byte("result1"), ChaincodeEvent: event},
+		{Uuid: failedTx.Uuid, ErrorCode: 1, Error: "failure"},
+	}}
+	testBlockchainWrapper.addNewBlock(block1, []byte("stateHash1"))
+
+	chain := testBlockchainWrapper.blockchain
+	receipt, err := chain.getTransactionReceipt(tx1.Uuid)
+	testutil.AssertNoError(t, err, "Error while getting transaction receipt")
+	testutil.AssertEquals(t, receipt, &protos.TransactionReceipt{Uuid: tx1.Uuid, BlockNumber: 1, Result: []byte("result1"), ChaincodeEvent: event})
+	receipt, err = chain.getTransactionReceipt(tx2.Uuid)
+	testutil.AssertNoError(t, err, "Error while getting transaction receipt")
+	testutil.AssertEquals(t, receipt, &protos.TransactionReceipt{Uuid: tx2.Uuid, BlockNumber: 1})
+	receipt, err = chain.getTransactionReceipt(failedTx.Uuid)
+	testutil.AssertNoError(t, err, "Error while getting transaction receipt")
+	testutil.AssertEquals(t, receipt, &protos.TransactionReceipt{Uuid: failedTx.Uuid, Status: protos.TransactionReceipt_FAILURE, BlockNumber: 1, ErrorCode: 1, Error: "failure"})
+
+	_, err = chain.getTransactionReceipt(testutil.GenerateUUID(t))
+	testutil.AssertEquals(t, err, ErrResourceNotFound)
+}
@@ -0,0 +1,183 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ledger
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/hyperledger/fabric/core/db"
+	"github.com/hyperledger/fabric/protos"
+	"github.com/spf13/viper"
+)
+
+// maxBlocksPrunedPerCommit bounds the blocks pruned along with a commit, so
+// that enabling pruning on a long blockchain does not stall the commit which
+// follows, the backlog is worked off over the next commits instead
+const maxBlocksPrunedPerCommit = 100
+
+var pruneHeightKey = []byte("pruneHeight")
+
+// ErrPruned is returned if the transactions of a block were pruned
+var ErrPruned = newLedgerError(ErrorTypeResourceNotFound, "ledger: the transactions of the block were pruned")
+
+// blockPruning removes the transactions of the blocks which fell out of the
+// retention window, keeping their headers.  A pruned block records the hash
+// it was committed with, so that the hash chain can still be followed through
+// it, but as its content no longer hashes to it, peers never serve it to
+// state transfer, which only syncs blocks above the prune height of a peer,
+// unless the block is read back whole from the archive.
+type blockPruning struct {
+	retainBlocks uint64        // Blocks below the head kept whole, pruning is disabled if 0
+	retainAge    time.Duration // Age a block must reach before it is pruned, ignored if 0
+	height       uint64        // Blocks below height were pruned, the genesis block excepted
+	pending      uint64        // Height once the write batch being built is persisted
+}
+
+func loadBlockPruning(openchainDB *db.OpenchainDB) (*blockPruning, error) {
+	pruning := &blockPruning{}
+	if retainBlocks := viper.GetInt("ledger.blockchain.pruning.retainBlocks"); retainBlocks > 0 {
+		pruning.retainBlocks = uint64(retainBlocks)
+		// Lagging peers sync the blocks above their height from the peers
+		// which serve them the state deltas, these must have the blocks too
+		deltas := viper.GetInt("ledger.state.deltaHistorySize")
+		if historyQueryBlocks := viper.GetInt("ledger.state.historyQueryBlocks"); deltas < historyQueryBlocks {
+			deltas = historyQueryBlocks
+		}
+		if retainBlocks < deltas {
+			ledgerLogger.Warningf("Retaining %d blocks rather than the configured %d, as many as the state deltas kept for state transfer", deltas, retainBlocks)
+			pruning.retainBlocks = uint64(deltas)
+		}
+	} else if retainBlocks < 0 {
+		return nil, fmt.Errorf("Blocks retained by pruning must be greater than or equal to 0. Current value is %d.", retainBlocks)
+	}
+	pruning.retainAge = viper.GetDuration("ledger.blockchain.pruning.retainAge")
+
+	heightBytes, err := openchainDB.GetFromBlockchainCF(pruneHeightKey)
+	if err != nil {
+		return nil, err
+	}
+	if heightBytes != nil {
+		pruning.height = decodeToUint64(heightBytes)
+	}
+	if pruning.retainBlocks > 0 {
+		ledgerLogger.Infof("Pruning the transactions of blocks %d below the head and older than %v, pruned below block %d so far", pruning.retainBlocks, pruning.retainAge, pruning.height)
+	}
+	return pruning, nil
+}
+
+// addPruningChanges adds the pruning of the blocks which fell out of the
+// retention window to writeBatch, size being the size of the blockchain once
+// it is written
+func (blockchain *blockchain) addPruningChanges(size uint64, writeBatch db.WriteBatch) error {
+	pruning := blockchain.pruning
+	if pruning.retainBlocks == 0 || size <= pruning.retainBlocks {
+		return nil
+	}
+	// Blocks added by the same write batch cannot be read back yet
+	limit := size - pruning.retainBlocks
+	if limit > blockchain.size {
+		limit = blockchain.size
+	}
+	// Blocks are only pruned once archived, if archival is enabled
+	if blockchain.archiver != nil && limit > blockchain.archiver.archivedHeight() {
+		limit = blockchain.archiver.archivedHeight()
+	}
+	next := pruning.height
+	if next == 0 {
+		next = 1 // The genesis block is kept whole
+	}
+	first := next
+	for ; next < limit && next-first < maxBlocksPrunedPerCommit; next++ {
+		block, err := fetchBlockFromDB(blockchain.openchainDB, next)
+		if err != nil {
+			return err
+		}
+		if block == nil || block.IsPruned() {
+			continue
+		}
+		if pruning.retainAge > 0 && block.NonHashData != nil && block.NonHashData.LocalLedgerCommitTimestamp != nil {
+			committed := block.NonHashData.LocalLedgerCommitTimestamp
+			if time.Since(time.Unix(committed.Seconds, int64(committed.Nanos))) < pruning.retainAge {
+				break
+			}
+		}
+		pruned, err := pruneBlock(block)
+		if err != nil {
+			return err
+		}
+		prunedBytes, err := pruned.Bytes()
+		if err != nil {
+			return err
+		}
+		writeBatch.PutCF(blockchain.openchainDB.BlockchainCF, encodeBlockNumberDBKey(next), prunedBytes)
+	}
+	if next > first {
+		ledgerLogger.Debugf("Pruning the transactions of blocks %d to %d", first, next-1)
+		writeBatch.PutCF(blockchain.openchainDB.BlockchainCF, pruneHeightKey, encodeUint64(next))
+		pruning.pending = next
+	}
+	return nil
+}
+
+// pruningStatus applies the pruning added to a write batch once it is known
+// whether the batch was persisted
+func (pruning *blockPruning) pruningStatus(success bool) {
+	if success && pruning.pending > pruning.height {
+		pruning.height = pruning.pending
+	}
+	pruning.pending = 0
+}
+
+// pruneBlock returns a copy of block without its transactions and their
+// results, recording the hash block had. The commit certificate is kept
+func pruneBlock(block *protos.Block) (*protos.Block, error) {
+	hash, err := block.GetHash()
+	if err != nil {
+		return nil, err
+	}
+	pruned := *block
+	pruned.Transactions = nil
+	pruned.NonHashData = &protos.NonHashData{PrunedBlockHash: hash}
+	if block.NonHashData != nil {
+		pruned.NonHashData.LocalLedgerCommitTimestamp = block.NonHashData.LocalLedgerCommitTimestamp
+		pruned.NonHashData.CommitCertificate = block.NonHashData.CommitCertificate
+	}
+	return &pruned, nil
+}
+
+// committedBlockHash returns the hash block was committed with, which a
+// pruned block only records
+func committedBlockHash(block *protos.Block) ([]byte, error) {
+	if block.IsPruned() {
+		return block.NonHashData.PrunedBlockHash, nil
+	}
+	return block.GetHash()
+}
+
+// blockTransaction returns a transaction of a block, unless the transactions
+// of the block were pruned
+func blockTransaction(block *protos.Block, txIndex uint64) (*protos.Transaction, error) {
+	if block.IsPruned() {
+		return nil, ErrPruned
+	}
+	transactions := block.GetTransactions()
+	if txIndex >= uint64(len(transactions)) {
+		return nil, ErrOutOfBounds
+	}
+	return transactions[txIndex], nil
+}
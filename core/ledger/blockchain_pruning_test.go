@@ -0,0 +1,120 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ledger
+
+import (
+	"testing"
+	"time"
+
+	"github.com/hyperledger/fabric/core/db"
+	"github.com/hyperledger/fabric/core/ledger/testutil"
+	"github.com/hyperledger/fabric/protos"
+	"github.com/spf13/viper"
+)
+
+// commitTestBlocks commits count blocks of one transaction each, returning
+// the UUIDs of the transactions
+func commitTestBlocks(t *testing.T, ledger *Ledger, count int) []string {
+	var uuids []string
+	for i := 0; i < count; i++ {
+		ledger.BeginTxBatch(i)
+		transaction, uuid := buildTestTx(t)
+		err := ledger.CommitTxBatch(i, []*protos.Transaction{transaction}, nil, []byte("proof"))
+		testutil.AssertNoError(t, err, "Error committing block")
+		uuids = append(uuids, uuid)
+	}
+	return uuids
+}
+
+func TestBlockchainPruning(t *testing.T) {
+	ledgerTestWrapper := createFreshDBAndTestLedgerWrapper(t)
+	ledger := ledgerTestWrapper.ledger
+	ledger.blockchain.pruning.retainBlocks = 3
+
+	uuids := commitTestBlocks(t, ledger, 6)
+	info, _ := ledger.GetBlockchainInfo()
+	testutil.AssertEquals(t, info.Height, uint64(6))
+	testutil.AssertEquals(t, ledger.GetPruneHeight(), uint64(3))
+
+	for n := uint64(0); n < 6; n++ {
+		block := ledgerTestWrapper.GetBlockByNumber(n)
+		if pruned := n > 0 && n < 3; block.IsPruned() != pruned {
+			t.Fatalf("Expected block %d pruned to be %v", n, pruned)
+		}
+		tx, err := ledger.GetTransactionByUUID(uuids[n])
+		if block.IsPruned() {
+			testutil.AssertEquals(t, err, ErrPruned)
+			testutil.AssertNil(t, tx)
+			testutil.AssertEquals(t, len(block.Transactions), 0)
+			testutil.AssertEquals(t, block.ConsensusMetadata, []byte("proof"))
+		} else {
+			testutil.AssertNoError(t, err, "Error fetching transaction of a block which was not pruned")
+			testutil.AssertEquals(t, tx.Uuid, uuids[n])
+		}
+	}
+
+	// The hash chain is kept through the pruned blocks
+	testutil.AssertEquals(t, ledgerTestWrapper.VerifyChain(5, 0), uint64(0))
+	pruned := ledgerTestWrapper.GetBlockByNumber(2)
+	next := ledgerTestWrapper.GetBlockByNumber(3)
+	testutil.AssertEquals(t, pruned.NonHashData.PrunedBlockHash, next.PreviousBlockHash)
+
+	// The prune height survives a restart
+	restarted, err := GetNewLedger()
+	testutil.AssertNoError(t, err, "Error while constructing ledger")
+	testutil.AssertEquals(t, restarted.GetPruneHeight(), uint64(3))
+}
+
+func TestBlockchainPruningBacklog(t *testing.T) {
+	ledgerTestWrapper := createFreshDBAndTestLedgerWrapper(t)
+	ledger := ledgerTestWrapper.ledger
+
+	commitTestBlocks(t, ledger, maxBlocksPrunedPerCommit+10)
+	testutil.AssertEquals(t, ledger.GetPruneHeight(), uint64(0))
+
+	// Enabling pruning on a long blockchain works the backlog off gradually
+	ledger.blockchain.pruning.retainBlocks = 5
+	commitTestBlocks(t, ledger, 1)
+	testutil.AssertEquals(t, ledger.GetPruneHeight(), uint64(maxBlocksPrunedPerCommit+1))
+	commitTestBlocks(t, ledger, 1)
+	testutil.AssertEquals(t, ledger.GetPruneHeight(), uint64(maxBlocksPrunedPerCommit+7))
+}
+
+func TestBlockchainPruningAge(t *testing.T) {
+	ledgerTestWrapper := createFreshDBAndTestLedgerWrapper(t)
+	ledger := ledgerTestWrapper.ledger
+	ledger.blockchain.pruning.retainBlocks = 1
+	ledger.blockchain.pruning.retainAge = time.Hour
+
+	commitTestBlocks(t, ledger, 5)
+	testutil.AssertEquals(t, ledger.GetPruneHeight(), uint64(0))
+	for n := uint64(0); n < 5; n++ {
+		if ledgerTestWrapper.GetBlockByNumber(n).IsPruned() {
+			t.Fatalf("Expected block %d not to be pruned before it is an hour old", n)
+		}
+	}
+}
+
+func TestBlockchainPruningRetainsStateDeltaBlocks(t *testing.T) {
+	testDBWrapper.CleanDB(t)
+	viper.Set("ledger.blockchain.pruning.retainBlocks", 10)
+	defer viper.Set("ledger.blockchain.pruning.retainBlocks", 0)
+
+	pruning, err := loadBlockPruning(db.GetDBHandle())
+	testutil.AssertNoError(t, err, "Error loading the pruning configuration")
+	testutil.AssertEquals(t, pruning.retainBlocks, uint64(viper.GetInt("ledger.state.deltaHistorySize")))
+}
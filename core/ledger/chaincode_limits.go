@@ -0,0 +1,62 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ledger
+
+import (
+	"fmt"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/hyperledger/fabric/protos"
+)
+
+// chaincodeLimitsChaincodeID is the namespace of the state keeping the
+// resource limits of each chaincode, keyed by chaincode ID. No chaincode can
+// access it. Being kept in the state, the limits are the same on every peer
+const chaincodeLimitsChaincodeID = "__chaincode_limits"
+
+// SetChaincodeLimits sets the resource limits of the chaincode, on behalf of the transaction txUUID. Nil limits
+// remove the limits of the chaincode, which then runs with the defaults of the peer
+func (ledger *Ledger) SetChaincodeLimits(txUUID string, chaincodeID string, limits *protos.ChaincodeLimits) error {
+	if err := validateNamespace(chaincodeID); err != nil {
+		return err
+	}
+	if limits == nil {
+		return ledger.state.DeleteForTx(txUUID, chaincodeLimitsChaincodeID, chaincodeID)
+	}
+	limitsBytes, err := proto.Marshal(limits)
+	if err != nil {
+		return newLedgerError(ErrorTypeInvalidArgument, fmt.Sprintf("Error marshalling the chaincode limits: %s", err))
+	}
+	return ledger.state.SetForTx(txUUID, chaincodeLimitsChaincodeID, chaincodeID, limitsBytes)
+}
+
+// GetChaincodeLimits returns the resource limits of the chaincode, as seen by the transaction txUUID, or nil if the
+// chaincode has none. If committed is true, only the limits committed are read
+func (ledger *Ledger) GetChaincodeLimits(txUUID string, chaincodeID string, committed bool) (*protos.ChaincodeLimits, error) {
+	if err := validateNamespace(chaincodeID); err != nil {
+		return nil, err
+	}
+	limitsBytes, err := ledger.state.GetForTx(txUUID, chaincodeLimitsChaincodeID, chaincodeID, committed)
+	if err != nil || limitsBytes == nil {
+		return nil, err
+	}
+	limits := &protos.ChaincodeLimits{}
+	if err = proto.Unmarshal(limitsBytes, limits); err != nil {
+		return nil, fmt.Errorf("Error unmarshalling the limits of chaincode [%s]: %s", chaincodeID, err)
+	}
+	return limits, nil
+}
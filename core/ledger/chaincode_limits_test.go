@@ -0,0 +1,61 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ledger
+
+import (
+	"testing"
+
+	"github.com/hyperledger/fabric/core/ledger/testutil"
+	"github.com/hyperledger/fabric/protos"
+)
+
+func TestLedgerChaincodeLimits(t *testing.T) {
+	ledgerTestWrapper := createFreshDBAndTestLedgerWrapper(t)
+	testLedger := ledgerTestWrapper.ledger
+
+	limits := &protos.ChaincodeLimits{Timeout: 5000, Memory: 268435456, MaxResponseSize: 1024}
+	testLedger.BeginTxBatch(1)
+	transaction, uuid := buildTestTx(t)
+	testLedger.TxBegin(uuid)
+	testutil.AssertNoError(t, testLedger.SetChaincodeLimits(uuid, "chaincode1", limits), "Error while setting the limits")
+	readLimits, err := testLedger.GetChaincodeLimits(uuid, "chaincode1", false)
+	testutil.AssertNoError(t, err, "Error while getting the limits")
+	testutil.AssertEquals(t, readLimits, limits)
+	readLimits, _ = testLedger.GetChaincodeLimits(uuid, "chaincode1", true)
+	testutil.AssertNil(t, readLimits)
+	testLedger.TxFinished(uuid, true)
+	testutil.AssertNoError(t, testLedger.CommitTxBatch(1, []*protos.Transaction{transaction}, nil, nil), "Error while committing")
+
+	readLimits, _ = testLedger.GetChaincodeLimits("", "chaincode1", true)
+	testutil.AssertEquals(t, readLimits, limits)
+	readLimits, _ = testLedger.GetChaincodeLimits("", "chaincode2", true)
+	testutil.AssertNil(t, readLimits)
+
+	// nil limits remove the limits of the chaincode
+	testLedger.BeginTxBatch(2)
+	transaction, uuid = buildTestTx(t)
+	testLedger.TxBegin(uuid)
+	testutil.AssertNoError(t, testLedger.SetChaincodeLimits(uuid, "chaincode1", nil), "Error while removing the limits")
+	testLedger.TxFinished(uuid, true)
+	testutil.AssertNoError(t, testLedger.CommitTxBatch(2, []*protos.Transaction{transaction}, nil, nil), "Error while committing")
+	readLimits, _ = testLedger.GetChaincodeLimits("", "chaincode1", true)
+	testutil.AssertNil(t, readLimits)
+
+	// the limits are out of the reach of the chaincodes
+	_, err = testLedger.GetNamespaceState("", "chaincode1", chaincodeLimitsChaincodeID, "chaincode1", true)
+	assertAccessDenied(t, err)
+}
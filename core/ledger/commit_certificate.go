@@ -0,0 +1,68 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ledger
+
+import (
+	"github.com/hyperledger/fabric/protos"
+)
+
+// SetCommitCertificate attaches to a committed block the certificate given by the consensus plugin, the proof
+// that the block was properly ordered, replacing the one attached before if any. The certificate is recorded in
+// the NonHashData of the block, so the hash of the block does not change
+func (ledger *Ledger) SetCommitCertificate(blockNumber uint64, cert *protos.CommitCertificate) error {
+	// blocks are rewritten by the pruning of commits, which must not undo the certificate
+	ledger.gcLock.Lock()
+	defer ledger.gcLock.Unlock()
+
+	if blockNumber >= ledger.blockchain.getSize() {
+		return ErrOutOfBounds
+	}
+	block, err := fetchBlockFromDB(ledger.openchainDB, blockNumber)
+	if err != nil {
+		return err
+	}
+	if block == nil {
+		return ErrResourceNotFound
+	}
+	if block.NonHashData == nil {
+		block.NonHashData = &protos.NonHashData{}
+	}
+	block.NonHashData.CommitCertificate = cert
+	blockBytes, err := block.Bytes()
+	if err != nil {
+		return err
+	}
+	writeBatch := ledger.openchainDB.NewWriteBatch()
+	defer writeBatch.Destroy()
+	writeBatch.PutCF(ledger.openchainDB.BlockchainCF, encodeBlockNumberDBKey(blockNumber), blockBytes)
+	return ledger.openchainDB.WriteSync(writeBatch)
+}
+
+// GetCommitCertificate returns the certificate attached to a block by the consensus plugin, nil if none was
+func (ledger *Ledger) GetCommitCertificate(blockNumber uint64) (*protos.CommitCertificate, error) {
+	if blockNumber >= ledger.GetBlockchainSize() {
+		return nil, ErrOutOfBounds
+	}
+	block, err := fetchBlockFromDB(ledger.openchainDB, blockNumber)
+	if err != nil {
+		return nil, err
+	}
+	if block == nil {
+		return nil, ErrResourceNotFound
+	}
+	return block.GetNonHashData().GetCommitCertificate(), nil
+}
@@ -0,0 +1,69 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ledger
+
+import (
+	"testing"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/hyperledger/fabric/core/ledger/testutil"
+	"github.com/hyperledger/fabric/protos"
+)
+
+func TestLedgerCommitCertificate(t *testing.T) {
+	ledgerTestWrapper := createFreshDBAndTestLedgerWrapper(t)
+	ledger := ledgerTestWrapper.ledger
+	ledger.blockchain.pruning.retainBlocks = 2
+	commitTestBlocks(t, ledger, 2)
+
+	cert := &protos.CommitCertificate{
+		SignedData: []byte("batch digest"),
+		Signatures: []*protos.CommitSignature{
+			{Signer: &protos.PeerID{Name: "vp0"}, Signature: []byte("signature0")},
+			{Signer: &protos.PeerID{Name: "vp1"}, Signature: []byte("signature1")},
+		},
+	}
+	hash, err := ledgerTestWrapper.GetBlockByNumber(1).GetHash()
+	testutil.AssertNoError(t, err, "Error while hashing block")
+	testutil.AssertNoError(t, ledger.SetCommitCertificate(1, cert), "Error while setting commit certificate")
+
+	committed, err := ledger.GetCommitCertificate(1)
+	testutil.AssertNoError(t, err, "Error while getting commit certificate")
+	testutil.AssertEquals(t, proto.Equal(committed, cert), true)
+	block := ledgerTestWrapper.GetBlockByNumber(1)
+	testutil.AssertEquals(t, proto.Equal(block.NonHashData.CommitCertificate, cert), true)
+
+	// the certificate is kept out of the block hash
+	certifiedHash, err := block.GetHash()
+	testutil.AssertNoError(t, err, "Error while hashing block")
+	testutil.AssertEquals(t, certifiedHash, hash)
+	testutil.AssertEquals(t, ledgerTestWrapper.VerifyChain(1, 0), uint64(0))
+
+	committed, err = ledger.GetCommitCertificate(0)
+	testutil.AssertNoError(t, err, "Error while getting commit certificate")
+	testutil.AssertNil(t, committed)
+	testutil.AssertEquals(t, ledger.SetCommitCertificate(2, cert), ErrOutOfBounds)
+	_, err = ledger.GetCommitCertificate(2)
+	testutil.AssertEquals(t, err, ErrOutOfBounds)
+
+	// the certificate survives the pruning of the block
+	commitTestBlocks(t, ledger, 2)
+	testutil.AssertEquals(t, ledgerTestWrapper.GetBlockByNumber(1).IsPruned(), true)
+	committed, err = ledger.GetCommitCertificate(1)
+	testutil.AssertNoError(t, err, "Error while getting commit certificate")
+	testutil.AssertEquals(t, proto.Equal(committed, cert), true)
+}
@@ -0,0 +1,75 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ledger
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/hyperledger/fabric/core/ledger/statemgmt"
+)
+
+// compositeKeyNamespace starts the composite keys of the state of a chaincode, the rest of the key being the
+// object type and the attributes, each followed by a zero byte. It must match what the shim's CreateCompositeKey writes
+const compositeKeyNamespace = "\x00composite\x00"
+
+// maxCompositeKeyRune ends the range of the keys starting with a partial composite key
+const maxCompositeKeyRune = utf8.MaxRune
+
+// CreateCompositeKey returns the key of the state of a chaincode for an object type and the values of its attributes,
+// as the shim's CreateCompositeKey does. The keys of an object type sort by their attributes, in order
+func CreateCompositeKey(objectType string, attributes []string) (string, error) {
+	if objectType == "" {
+		return "", errors.New("Composite key object type must not be empty")
+	}
+	var keyBuffer bytes.Buffer
+	keyBuffer.WriteString(compositeKeyNamespace)
+	for _, component := range append([]string{objectType}, attributes...) {
+		if !utf8.ValidString(component) {
+			return "", fmt.Errorf("Composite key attribute [%q] is not valid UTF-8", component)
+		}
+		if strings.IndexByte(component, 0) >= 0 || strings.IndexRune(component, maxCompositeKeyRune) >= 0 {
+			return "", fmt.Errorf("Composite key attribute [%q] must not contain a zero byte or U+10FFFF", component)
+		}
+		keyBuffer.WriteString(component)
+		keyBuffer.WriteByte(0)
+	}
+	return keyBuffer.String(), nil
+}
+
+// SplitCompositeKey returns the object type and the attributes a key was created from by CreateCompositeKey
+func SplitCompositeKey(compositeKey string) (string, []string, error) {
+	if !strings.HasPrefix(compositeKey, compositeKeyNamespace) || !strings.HasSuffix(compositeKey, "\x00") {
+		return "", nil, fmt.Errorf("Key [%q] is not a composite key", compositeKey)
+	}
+	components := strings.Split(compositeKey[len(compositeKeyNamespace):len(compositeKey)-1], "\x00")
+	return components[0], components[1:], nil
+}
+
+// GetStateByPartialCompositeKey returns an iterator to get the keys (and values) of a chaincodeID created by
+// CreateCompositeKey for the objectType with the given first attributes, all of its keys if none is given.
+// committed is as for GetStateRangeScanIterator, and the key-values are not guaranteed to be in any specific order
+func (ledger *Ledger) GetStateByPartialCompositeKey(chaincodeID string, objectType string, attributes []string, committed bool) (statemgmt.RangeScanIterator, error) {
+	partialCompositeKey, err := CreateCompositeKey(objectType, attributes)
+	if err != nil {
+		return nil, err
+	}
+	return ledger.GetStateRangeScanIterator(chaincodeID, partialCompositeKey, partialCompositeKey+string(maxCompositeKeyRune), committed)
+}
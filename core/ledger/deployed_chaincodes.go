@@ -0,0 +1,74 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package ledger
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/hyperledger/fabric/protos"
+)
+
+// deployedChaincodesChaincodeID is the namespace of the state keeping the
+// record of the deploy transaction of each chaincode, keyed by chaincode ID.
+// No chaincode can access it
+const deployedChaincodesChaincodeID = "__deployed_chaincodes"
+
+// SetDeployedChaincode records the deployment of a chaincode by the transaction txUUID. The record replaces the
+// one of an earlier deployment of the chaincode
+func (ledger *Ledger) SetDeployedChaincode(txUUID string, deployed *protos.DeployedChaincode) error {
+	if deployed.ChaincodeID == nil {
+		return newLedgerError(ErrorTypeInvalidArgument, "The deployed chaincode has no chaincode ID")
+	}
+	chaincodeID := deployed.ChaincodeID.Name
+	if err := validateNamespace(chaincodeID); err != nil {
+		return err
+	}
+	deployedBytes, err := proto.Marshal(deployed)
+	if err != nil {
+		return newLedgerError(ErrorTypeInvalidArgument, fmt.Sprintf("Error marshalling the deployed chaincode: %s", err))
+	}
+	return ledger.state.SetForTx(txUUID, deployedChaincodesChaincodeID, chaincodeID, deployedBytes)
+}
+
+// GetDeployedChaincodes returns the committed records of the chaincodes deployed, sorted by chaincode ID
+func (ledger *Ledger) GetDeployedChaincodes() ([]*protos.DeployedChaincode, error) {
+	itr, err := ledger.state.GetRangeScanIterator(deployedChaincodesChaincodeID, "", "", true)
+	if err != nil {
+		return nil, err
+	}
+	defer itr.Close()
+	var deployed []*protos.DeployedChaincode
+	for itr.Next() {
+		chaincodeID, deployedBytes := itr.GetKeyValue()
+		chaincode := &protos.DeployedChaincode{}
+		if err = proto.Unmarshal(deployedBytes, chaincode); err != nil {
+			return nil, fmt.Errorf("Error unmarshalling the record of chaincode [%s]: %s", chaincodeID, err)
+		}
+		deployed = append(deployed, chaincode)
+	}
+	sort.Sort(byChaincodeID(deployed))
+	return deployed, nil
+}
+
+// byChaincodeID sorts deployed chaincodes by chaincode ID, the order of the keys of a range scan
+// depending on the state implementation
+type byChaincodeID []*protos.DeployedChaincode
+
+func (c byChaincodeID) Len() int           { return len(c) }
+func (c byChaincodeID) Less(i, j int) bool { return c[i].ChaincodeID.Name < c[j].ChaincodeID.Name }
+func (c byChaincodeID) Swap(i, j int)      { c[i], c[j] = c[j], c[i] }
@@ -0,0 +1,60 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package ledger
+
+import (
+	"testing"
+
+	"github.com/hyperledger/fabric/core/ledger/testutil"
+	"github.com/hyperledger/fabric/protos"
+)
+
+func TestLedgerDeployedChaincodes(t *testing.T) {
+	ledgerTestWrapper := createFreshDBAndTestLedgerWrapper(t)
+	testLedger := ledgerTestWrapper.ledger
+
+	deployed2 := &protos.DeployedChaincode{ChaincodeID: &protos.ChaincodeID{Name: "chaincode2"}, Type: protos.ChaincodeSpec_GOLANG, Txid: "tx2"}
+	deployed1 := &protos.DeployedChaincode{ChaincodeID: &protos.ChaincodeID{Name: "chaincode1", Path: "github.com/example/chaincode1"}, Type: protos.ChaincodeSpec_NODE, Txid: "tx1", BuildDigest: "digest1", ExecEnv: protos.ChaincodeDeploymentSpec_PROCESS}
+	testLedger.BeginTxBatch(1)
+	transaction, uuid := buildTestTx(t)
+	testLedger.TxBegin(uuid)
+	testutil.AssertNoError(t, testLedger.SetDeployedChaincode(uuid, deployed2), "Error while recording the deployment")
+	testutil.AssertNoError(t, testLedger.SetDeployedChaincode(uuid, deployed1), "Error while recording the deployment")
+	deployed, err := testLedger.GetDeployedChaincodes()
+	testutil.AssertNoError(t, err, "Error while getting the deployed chaincodes")
+	testutil.AssertEquals(t, len(deployed), 0)
+	testLedger.TxFinished(uuid, true)
+	testutil.AssertNoError(t, testLedger.CommitTxBatch(1, []*protos.Transaction{transaction}, nil, nil), "Error while committing")
+
+	deployed, err = testLedger.GetDeployedChaincodes()
+	testutil.AssertNoError(t, err, "Error while getting the deployed chaincodes")
+	testutil.AssertEquals(t, deployed, []*protos.DeployedChaincode{deployed1, deployed2})
+
+	// a redeployment replaces the record
+	redeployed1 := &protos.DeployedChaincode{ChaincodeID: &protos.ChaincodeID{Name: "chaincode1"}, Type: protos.ChaincodeSpec_NODE, Txid: "tx3", BuildDigest: "digest3"}
+	testLedger.BeginTxBatch(2)
+	transaction, uuid = buildTestTx(t)
+	testLedger.TxBegin(uuid)
+	testutil.AssertNoError(t, testLedger.SetDeployedChaincode(uuid, redeployed1), "Error while recording the deployment")
+	testLedger.TxFinished(uuid, true)
+	testutil.AssertNoError(t, testLedger.CommitTxBatch(2, []*protos.Transaction{transaction}, nil, nil), "Error while committing")
+	deployed, _ = testLedger.GetDeployedChaincodes()
+	testutil.AssertEquals(t, deployed, []*protos.DeployedChaincode{redeployed1, deployed2})
+
+	// the records are out of the reach of the chaincodes
+	_, err = testLedger.GetNamespaceState("", "chaincode1", deployedChaincodesChaincodeID, "chaincode1", true)
+	assertAccessDenied(t, err)
+}
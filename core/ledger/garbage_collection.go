@@ -0,0 +1,147 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ledger
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/hyperledger/fabric/core/db"
+	"github.com/hyperledger/fabric/core/ledger/statemgmt"
+	"github.com/hyperledger/fabric/protos"
+	"github.com/spf13/viper"
+)
+
+// CollectGarbage removes the rows of the database of the ledger which no block refers to any longer: the blocks,
+// state deltas and blockchain indexes of blocks above the head, left behind by aborted commits and state
+// transfers, and the state deltas older than those kept, left behind if ledger.state.deltaHistorySize was
+// lowered. It reports the rows removed and the bytes they took, by column family. Commits wait for it to finish
+func (ledger *Ledger) CollectGarbage() (*protos.LedgerGarbage, error) {
+	ledger.gcLock.Lock()
+	defer ledger.gcLock.Unlock()
+
+	garbage := &protos.LedgerGarbage{Rows: make(map[string]uint64), Bytes: make(map[string]uint64)}
+	collected := func(cf string) func(key []byte, value []byte) {
+		return func(key []byte, value []byte) {
+			garbage.Rows[cf]++
+			garbage.Bytes[cf] += uint64(len(key) + len(value))
+		}
+	}
+	size := ledger.blockchain.getSize()
+	writeBatch := ledger.openchainDB.NewWriteBatch()
+	defer writeBatch.Destroy()
+
+	ledger.addOrphanedBlocksForDeletion(size, writeBatch, collected("blockchainCF"))
+	ledger.state.AddOrphanedStateDeltasForDeletion(size, writeBatch, collected("stateDeltaCF"))
+	if err := ledger.addOrphanedIndexesForDeletion(size, writeBatch, collected("indexesCF")); err != nil {
+		return nil, err
+	}
+	if err := ledger.openchainDB.Write(writeBatch); err != nil {
+		return nil, err
+	}
+	ledgerLogger.Infof("Collected the garbage of the ledger at height %d: rows %v, bytes %v", size, garbage.Rows, garbage.Bytes)
+	return garbage, nil
+}
+
+// startGarbageCollection collects the garbage of the ledger every ledger.gc.interval, if not 0
+func (ledger *Ledger) startGarbageCollection() error {
+	interval := viper.GetDuration("ledger.gc.interval")
+	if interval < 0 {
+		return fmt.Errorf("Interval between garbage collections must be greater than or equal to 0. Current value is %v.", interval)
+	}
+	if interval == 0 {
+		return nil
+	}
+	go func() {
+		for range time.NewTicker(interval).C {
+			if _, err := ledger.CollectGarbage(); err != nil {
+				ledgerLogger.Errorf("Could not collect the garbage of the ledger: %s", err)
+			}
+		}
+	}()
+	return nil
+}
+
+// addOrphanedBlocksForDeletion adds to writeBatch the deletion of the blocks numbered size or higher
+func (ledger *Ledger) addOrphanedBlocksForDeletion(size uint64, writeBatch db.WriteBatch, deleted func(key []byte, value []byte)) {
+	cf := ledger.openchainDB.BlockchainCF
+	itr := ledger.openchainDB.GetBlockchainCFIterator()
+	defer itr.Close()
+	for itr.Seek(encodeBlockNumberDBKey(size)); itr.Valid(); itr.Next() {
+		// the other keys of the column family, such as blockCountKey, are
+		// not 8 bytes long
+		if len(itr.Key()) != 8 {
+			continue
+		}
+		key := statemgmt.Copy(itr.Key())
+		writeBatch.DeleteCF(cf, key)
+		deleted(key, itr.Value())
+	}
+}
+
+// addOrphanedIndexesForDeletion adds to writeBatch the deletion of the blockchain indexes of the blocks numbered
+// size or higher. The indexes of the state are left alone
+func (ledger *Ledger) addOrphanedIndexesForDeletion(size uint64, writeBatch db.WriteBatch, deleted func(key []byte, value []byte)) error {
+	cf := ledger.openchainDB.IndexesCF
+	itr := ledger.openchainDB.GetIterator(cf)
+	defer itr.Close()
+	for itr.SeekToFirst(); itr.Valid(); itr.Next() {
+		key := itr.Key()
+		if len(key) < 2 {
+			continue
+		}
+		var blockNumber uint64
+		switch key[0] {
+		case prefixBlockHashKey:
+			blockNumber = decodeBlockNumber(itr.Value())
+		case prefixTxUUIDKey:
+			var err error
+			if blockNumber, _, err = decodeBlockNumTxIndex(itr.Value()); err != nil {
+				return fmt.Errorf("Invalid transaction index [%x]: %s", key, err)
+			}
+		case prefixTxReceiptKey:
+			receipt := &protos.TransactionReceipt{}
+			if err := proto.Unmarshal(itr.Value(), receipt); err != nil {
+				return fmt.Errorf("Invalid transaction receipt [%x]: %s", key, err)
+			}
+			blockNumber = receipt.BlockNumber
+		case prefixAddressBlockNumCompositeKey:
+			b := proto.NewBuffer(key[1:])
+			if _, err := b.DecodeRawBytes(false); err != nil {
+				return fmt.Errorf("Invalid address index [%x]: %s", key, err)
+			}
+			var err error
+			if blockNumber, err = b.DecodeVarint(); err != nil {
+				return fmt.Errorf("Invalid address index [%x]: %s", key, err)
+			}
+		case prefixChaincodeBlockNumCompositeKey, prefixEventBlockNumCompositeKey:
+			if len(key) < 9 {
+				return fmt.Errorf("Invalid composite index [%x]", key)
+			}
+			blockNumber = decodeToUint64(key[len(key)-8:])
+		default:
+			continue
+		}
+		if blockNumber >= size {
+			key = statemgmt.Copy(key)
+			writeBatch.DeleteCF(cf, key)
+			deleted(key, itr.Value())
+		}
+	}
+	return nil
+}
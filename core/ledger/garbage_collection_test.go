@@ -0,0 +1,82 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ledger
+
+import (
+	"testing"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/hyperledger/fabric/core/ledger/statemgmt"
+	"github.com/hyperledger/fabric/core/ledger/testutil"
+	"github.com/hyperledger/fabric/protos"
+)
+
+func TestLedgerCollectGarbage(t *testing.T) {
+	ledgerTestWrapper := createFreshDBAndTestLedgerWrapper(t)
+	ledger := ledgerTestWrapper.ledger
+	openchainDB := ledger.openchainDB
+
+	var uuids []string
+	for i := 0; i < 2; i++ {
+		ledger.BeginTxBatch(i)
+		transaction, uuid := buildTestTx(t)
+		ledger.TxBegin(uuid)
+		ledger.SetState("chaincode1", "key1", []byte{byte(i)})
+		ledger.TxFinished(uuid, true)
+		testutil.AssertNoError(t, ledger.CommitTxBatch(i, []*protos.Transaction{transaction}, nil, nil), "Error while committing")
+		uuids = append(uuids, uuid)
+	}
+
+	// rows of the blocks above the head
+	blockBytes, err := ledgerTestWrapper.GetBlockByNumber(1).Bytes()
+	testutil.AssertNoError(t, err, "Error while marshalling block")
+	openchainDB.Put(openchainDB.BlockchainCF, encodeBlockNumberDBKey(5), blockBytes)
+	openchainDB.Put(openchainDB.StateDeltaCF, encodeUint64(4), statemgmt.NewStateDelta().Marshal())
+	receiptBytes, err := proto.Marshal(&protos.TransactionReceipt{Uuid: "orphanTx", BlockNumber: 3})
+	testutil.AssertNoError(t, err, "Error while marshalling receipt")
+	openchainDB.Put(openchainDB.IndexesCF, encodeTxUUIDKey("orphanTx"), encodeBlockNumTxIndex(2, 0))
+	openchainDB.Put(openchainDB.IndexesCF, encodeTxReceiptKey("orphanTx"), receiptBytes)
+	openchainDB.Put(openchainDB.IndexesCF, encodeBlockHashKey([]byte("orphanHash")), encodeBlockNumber(2))
+	openchainDB.Put(openchainDB.IndexesCF, encodeNameBlockNumCompositeKey(prefixEventBlockNumCompositeKey, "event1", 2), encodeListTxIndexes([]uint64{0}))
+
+	garbage, err := ledger.CollectGarbage()
+	testutil.AssertNoError(t, err, "Error while collecting garbage")
+	testutil.AssertEquals(t, garbage.Rows, map[string]uint64{"blockchainCF": 1, "stateDeltaCF": 1, "indexesCF": 4})
+	testutil.AssertEquals(t, garbage.Bytes["blockchainCF"], uint64(8+len(blockBytes)))
+
+	block, err := ledger.GetBlockByNumber(5)
+	testutil.AssertNil(t, block)
+	_, err = ledger.GetTransactionByUUID("orphanTx")
+	testutil.AssertEquals(t, err, ErrResourceNotFound)
+	_, err = ledger.GetTransactionReceipt("orphanTx")
+	testutil.AssertEquals(t, err, ErrResourceNotFound)
+
+	// the rows of the blocks committed are kept
+	testutil.AssertEquals(t, ledger.GetBlockchainSize(), uint64(2))
+	testutil.AssertEquals(t, ledgerTestWrapper.VerifyChain(1, 0), uint64(0))
+	testutil.AssertNotNil(t, ledgerTestWrapper.GetStateDelta(1))
+	for _, uuid := range uuids {
+		_, err = ledger.GetTransactionByUUID(uuid)
+		testutil.AssertNoError(t, err, "Error while getting transaction")
+		_, err = ledger.GetTransactionReceipt(uuid)
+		testutil.AssertNoError(t, err, "Error while getting transaction receipt")
+	}
+
+	garbage, err = ledger.CollectGarbage()
+	testutil.AssertNoError(t, err, "Error while collecting garbage")
+	testutil.AssertEquals(t, len(garbage.Rows), 0)
+}
@@ -17,8 +17,13 @@ limitations under the License.
 package genesis
 
 import (
+	"fmt"
+	"io/ioutil"
+	"os"
 	"sync"
 
+	"github.com/golang/protobuf/jsonpb"
+	"github.com/hyperledger/fabric/protos"
 	"github.com/spf13/viper"
 )
 
@@ -40,3 +45,30 @@ func getGenesis() map[string]interface{} {
 	initConfigs()
 	return genesis
 }
+
+// getSpec returns the spec of the genesis block configured: the spec read from
+// the file ledger.blockchain.genesisBlock.spec if set, otherwise the spec built
+// from the parameters and the consensus configuration file configured
+func getSpec() (*protos.GenesisSpec, error) {
+	if specFile := viper.GetString("ledger.blockchain.genesisBlock.spec"); specFile != "" {
+		file, err := os.Open(specFile)
+		if err != nil {
+			return nil, fmt.Errorf("Could not open genesis block spec file: %s", err)
+		}
+		defer file.Close()
+		spec := &protos.GenesisSpec{}
+		if err = jsonpb.Unmarshal(file, spec); err != nil {
+			return nil, fmt.Errorf("Could not read genesis block spec file %s: %s", specFile, err)
+		}
+		return spec, nil
+	}
+
+	var consensusConfig []byte
+	if configFile := viper.GetString("ledger.blockchain.genesisBlock.consensusConfig"); configFile != "" {
+		var err error
+		if consensusConfig, err = ioutil.ReadFile(configFile); err != nil {
+			return nil, fmt.Errorf("Could not read consensus configuration file: %s", err)
+		}
+	}
+	return BuildSpec(nil, viper.GetStringMapString("ledger.blockchain.genesisBlock.parameters"), consensusConfig), nil
+}
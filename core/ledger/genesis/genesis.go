@@ -17,10 +17,17 @@ limitations under the License.
 package genesis
 
 import (
+	"fmt"
+	"sort"
 	"sync"
 
+	"github.com/golang/protobuf/proto"
+	"github.com/hyperledger/fabric/core/chaincode"
 	"github.com/hyperledger/fabric/core/ledger"
+	"github.com/hyperledger/fabric/core/util"
+	"github.com/hyperledger/fabric/protos"
 	"github.com/op/go-logging"
+	"golang.org/x/net/context"
 )
 
 var genesisLogger = logging.MustGetLogger("genesis")
@@ -32,18 +39,131 @@ var once sync.Once
 // and adds it to the blockchain.
 func MakeGenesis() error {
 	once.Do(func() {
-		ledger, err := ledger.GetLedger()
+		spec, err := getSpec()
 		if err != nil {
 			makeGenesisError = err
 			return
 		}
+		makeGenesisError = MakeGenesisFromSpec(spec)
+	})
+	return makeGenesisError
+}
+
+// BuildSpec returns the spec of a genesis block deploying the chaincodes of
+// deployments, in order, and setting the parameters of the network. Only the
+// hash of the configuration of the consensus is recorded.
+func BuildSpec(deployments []*protos.ChaincodeDeploymentSpec, parameters map[string]string, consensusConfig []byte) *protos.GenesisSpec {
+	spec := &protos.GenesisSpec{Deployments: deployments}
+	for name, value := range parameters {
+		spec.Parameters = append(spec.Parameters, &protos.NetworkParameter{Name: name, Value: value})
+	}
+	sort.Sort(parametersByName(spec.Parameters))
+	if consensusConfig != nil {
+		spec.ConsensusConfigHash = util.ComputeCryptoHash(consensusConfig)
+	}
+	return spec
+}
+
+// GetSpecHash returns the hash of a genesis block spec, which validators can
+// compare to check they start from the same genesis block
+func GetSpecHash(spec *protos.GenesisSpec) ([]byte, error) {
+	data, err := proto.Marshal(spec)
+	if err != nil {
+		return nil, fmt.Errorf("Could not marshal genesis block spec: %s", err)
+	}
+	return util.ComputeCryptoHash(data), nil
+}
+
+// MakeGenesisFromSpec creates the genesis block from spec and adds it to the
+// blockchain. The block has no timestamp and the deploy transactions have the
+// names of the chaincodes as UUIDs and no timestamp, so that all validators
+// building it from the same spec get the same block. If the blockchain already
+// has a genesis block, it checks that it was built from spec.
+func MakeGenesisFromSpec(spec *protos.GenesisSpec) error {
+	ledger, err := ledger.GetLedger()
+	if err != nil {
+		return err
+	}
+	if ledger.GetBlockchainSize() > 0 {
+		return verifyGenesis(ledger, spec)
+	}
 
-		if ledger.GetBlockchainSize() == 0 {
-			genesisLogger.Info("Creating genesis block.")
-			if makeGenesisError = ledger.BeginTxBatch(0); makeGenesisError == nil {
-				makeGenesisError = ledger.CommitTxBatch(0, nil, nil, nil)
+	genesisLogger.Info("Creating genesis block.")
+	transactions, err := buildDeployTransactions(spec)
+	if err != nil {
+		return err
+	}
+	if err = ledger.BeginTxBatch(0); err != nil {
+		return err
+	}
+	var txResults []*protos.TransactionResult
+	if len(transactions) > 0 {
+		_, _, txResults, err = chaincode.ExecuteTransactions(context.Background(), chaincode.DefaultChain, transactions)
+		if err != nil {
+			ledger.RollbackTxBatch(0)
+			return fmt.Errorf("Could not execute the transactions of the genesis block: %s", err)
+		}
+		for _, txResult := range txResults {
+			if txResult.ErrorCode != 0 {
+				ledger.RollbackTxBatch(0)
+				return fmt.Errorf("Could not deploy chaincode %s in the genesis block: %s", txResult.Uuid, txResult.Error)
 			}
 		}
-	})
-	return makeGenesisError
+	}
+	// an empty spec is not recorded, so that the genesis block of a
+	// blockchain created without a spec keeps its hash
+	if isEmpty(spec) {
+		spec = nil
+	}
+	return ledger.CommitGenesisTxBatch(0, transactions, txResults, spec)
 }
+
+// verifyGenesis checks that the genesis block of the blockchain was built
+// from spec
+func verifyGenesis(ledger *ledger.Ledger, spec *protos.GenesisSpec) error {
+	block, err := ledger.GetBlockByNumber(0)
+	if err != nil {
+		return fmt.Errorf("Could not get the genesis block: %s", err)
+	}
+	committed := block.GetGenesisSpec()
+	if committed == nil {
+		committed = &protos.GenesisSpec{}
+	}
+	if spec == nil {
+		spec = &protos.GenesisSpec{}
+	}
+	if !proto.Equal(committed, spec) {
+		return fmt.Errorf("The genesis block was not built from the genesis block spec configured, it was built from [%s]", committed)
+	}
+	return nil
+}
+
+func buildDeployTransactions(spec *protos.GenesisSpec) ([]*protos.Transaction, error) {
+	var transactions []*protos.Transaction
+	for _, deployment := range spec.GetDeployments() {
+		var name string
+		if chaincodeID := deployment.GetChaincodeSpec().GetChaincodeID(); chaincodeID != nil {
+			name = chaincodeID.Name
+		}
+		if name == "" {
+			return nil, fmt.Errorf("Chaincodes deployed by the genesis block must be named: %s", deployment)
+		}
+		transaction, err := protos.NewChaincodeDeployTransaction(deployment, name)
+		if err != nil {
+			return nil, err
+		}
+		transaction.Timestamp = nil
+		transactions = append(transactions, transaction)
+	}
+	return transactions, nil
+}
+
+func isEmpty(spec *protos.GenesisSpec) bool {
+	return spec == nil || len(spec.Deployments) == 0 && len(spec.Parameters) == 0 && len(spec.ConsensusConfigHash) == 0
+}
+
+type parametersByName []*protos.NetworkParameter
+
+func (p parametersByName) Len() int           { return len(p) }
+func (p parametersByName) Swap(i, j int)      { p[i], p[j] = p[j], p[i] }
+func (p parametersByName) Less(i, j int) bool { return p[i].Name < p[j].Name }
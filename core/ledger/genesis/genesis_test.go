@@ -17,6 +17,7 @@ limitations under the License.
 package genesis
 
 import (
+	"bytes"
 	"fmt"
 	"net"
 	"os"
@@ -27,8 +28,10 @@ import (
 	"google.golang.org/grpc/credentials"
 	"google.golang.org/grpc/grpclog"
 
+	"github.com/golang/protobuf/proto"
 	"github.com/hyperledger/fabric/core/chaincode"
 	"github.com/hyperledger/fabric/core/ledger"
+	"github.com/hyperledger/fabric/core/util"
 	"github.com/hyperledger/fabric/protos"
 	"github.com/spf13/viper"
 )
@@ -85,6 +88,66 @@ func TestGenesis(t *testing.T) {
 	}
 }
 
+func TestBuildSpec(t *testing.T) {
+	spec := BuildSpec(nil, map[string]string{"b": "2", "a": "1", "c": "3"}, []byte("consensus config"))
+	other := BuildSpec(nil, map[string]string{"c": "3", "b": "2", "a": "1"}, []byte("consensus config"))
+	hash, err := GetSpecHash(spec)
+	if err != nil {
+		t.Fatalf("Error hashing genesis block spec, %s", err)
+	}
+	otherHash, err := GetSpecHash(other)
+	if err != nil {
+		t.Fatalf("Error hashing genesis block spec, %s", err)
+	}
+	if !bytes.Equal(hash, otherHash) {
+		t.Fatalf("Expected the specs built from the same parameters to have the same hash")
+	}
+	if spec.Parameters[0].Name != "a" || spec.Parameters[2].Name != "c" {
+		t.Fatalf("Expected the parameters to be sorted by name, but got %s", spec.Parameters)
+	}
+	if !bytes.Equal(spec.ConsensusConfigHash, util.ComputeCryptoHash([]byte("consensus config"))) {
+		t.Fatalf("Expected the hash of the consensus config to be recorded")
+	}
+}
+
+func TestMakeGenesisFromSpec(t *testing.T) {
+	testLedger := ledger.InitTestLedger(t)
+	spec := BuildSpec(nil, map[string]string{"network": "test"}, []byte("consensus config"))
+	if err := MakeGenesisFromSpec(spec); err != nil {
+		t.Fatalf("Error creating genesis block, %s", err)
+	}
+	block, err := testLedger.GetBlockByNumber(0)
+	if err != nil {
+		t.Fatalf("Error getting genesis block, %s", err)
+	}
+	if !proto.Equal(block.GenesisSpec, spec) {
+		t.Fatalf("Expected the genesis block to record its spec, but got %s", block.GenesisSpec)
+	}
+
+	// the genesis block is checked against the spec once created
+	if err = MakeGenesisFromSpec(BuildSpec(nil, map[string]string{"network": "test"}, []byte("consensus config"))); err != nil {
+		t.Fatalf("Error checking genesis block, %s", err)
+	}
+	if err = MakeGenesisFromSpec(BuildSpec(nil, map[string]string{"network": "other"}, []byte("consensus config"))); err == nil {
+		t.Fatalf("Expected a genesis block built from another spec to fail")
+	}
+	if testLedger.GetBlockchainSize() != 1 {
+		t.Fatalf("Expected blockchain size of 1, but got %d", testLedger.GetBlockchainSize())
+	}
+
+	// a genesis block built without spec does not record it
+	testLedger = ledger.InitTestLedger(t)
+	if err = MakeGenesisFromSpec(&protos.GenesisSpec{}); err != nil {
+		t.Fatalf("Error creating genesis block, %s", err)
+	}
+	if block, _ = testLedger.GetBlockByNumber(0); block.GenesisSpec != nil {
+		t.Fatalf("Expected the genesis block not to record an empty spec, but got %s", block.GenesisSpec)
+	}
+	if err = MakeGenesisFromSpec(spec); err == nil {
+		t.Fatalf("Expected a genesis block built without spec to fail against a spec")
+	}
+}
+
 func setupTestConfig() {
 	viper.AddConfigPath(".")
 	viper.SetConfigName("genesis_test")
@@ -0,0 +1,62 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ledger
+
+import (
+	"fmt"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/hyperledger/fabric/protos"
+)
+
+// invocationPoliciesChaincodeID is the namespace of the state keeping the
+// invocation policy of each chaincode, keyed by chaincode ID. No chaincode can
+// access it. Like the namespace grants, the policies are part of the state hash
+const invocationPoliciesChaincodeID = "__invocation_policies"
+
+// SetInvocationPolicy sets the policy of the callers allowed to invoke the chaincode, on behalf of the transaction
+// txUUID. A nil policy removes the policy of the chaincode, which allows every caller
+func (ledger *Ledger) SetInvocationPolicy(txUUID string, chaincodeID string, policy *protos.InvocationPolicy) error {
+	if err := validateNamespace(chaincodeID); err != nil {
+		return err
+	}
+	if policy == nil {
+		return ledger.state.DeleteForTx(txUUID, invocationPoliciesChaincodeID, chaincodeID)
+	}
+	policyBytes, err := proto.Marshal(policy)
+	if err != nil {
+		return newLedgerError(ErrorTypeInvalidArgument, fmt.Sprintf("Error marshalling the invocation policy: %s", err))
+	}
+	return ledger.state.SetForTx(txUUID, invocationPoliciesChaincodeID, chaincodeID, policyBytes)
+}
+
+// GetInvocationPolicy returns the invocation policy of the chaincode, as seen by the transaction txUUID, or nil if
+// the chaincode has none. If committed is true, only the policies committed are read
+func (ledger *Ledger) GetInvocationPolicy(txUUID string, chaincodeID string, committed bool) (*protos.InvocationPolicy, error) {
+	if err := validateNamespace(chaincodeID); err != nil {
+		return nil, err
+	}
+	policyBytes, err := ledger.state.GetForTx(txUUID, invocationPoliciesChaincodeID, chaincodeID, committed)
+	if err != nil || policyBytes == nil {
+		return nil, err
+	}
+	policy := &protos.InvocationPolicy{}
+	if err = proto.Unmarshal(policyBytes, policy); err != nil {
+		return nil, fmt.Errorf("Error unmarshalling the invocation policy of chaincode [%s]: %s", chaincodeID, err)
+	}
+	return policy, nil
+}
@@ -0,0 +1,67 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ledger
+
+import (
+	"testing"
+
+	"github.com/hyperledger/fabric/core/ledger/testutil"
+	"github.com/hyperledger/fabric/protos"
+)
+
+func TestLedgerInvocationPolicy(t *testing.T) {
+	ledgerTestWrapper := createFreshDBAndTestLedgerWrapper(t)
+	testLedger := ledgerTestWrapper.ledger
+
+	policy := &protos.InvocationPolicy{EnrollmentIDs: []string{"alice"}, UpdatePolicy: &protos.InvocationPolicy{Roles: []string{"admin"}}}
+	testLedger.BeginTxBatch(1)
+	transaction, uuid := buildTestTx(t)
+	testLedger.TxBegin(uuid)
+	testutil.AssertNoError(t, testLedger.SetInvocationPolicy(uuid, "chaincode1", policy), "Error while setting the policy")
+	readPolicy, err := testLedger.GetInvocationPolicy(uuid, "chaincode1", false)
+	testutil.AssertNoError(t, err, "Error while getting the policy")
+	testutil.AssertEquals(t, readPolicy, policy)
+	readPolicy, _ = testLedger.GetInvocationPolicy(uuid, "chaincode1", true)
+	testutil.AssertNil(t, readPolicy)
+	testLedger.TxFinished(uuid, true)
+	testutil.AssertNoError(t, testLedger.CommitTxBatch(1, []*protos.Transaction{transaction}, nil, nil), "Error while committing")
+
+	readPolicy, _ = testLedger.GetInvocationPolicy("", "chaincode1", true)
+	testutil.AssertEquals(t, readPolicy, policy)
+	readPolicy, _ = testLedger.GetInvocationPolicy("", "chaincode2", true)
+	testutil.AssertNil(t, readPolicy)
+
+	// a failed transaction leaves the policy unchanged, a nil policy removes it
+	testLedger.BeginTxBatch(2)
+	transaction1, uuid1 := buildTestTx(t)
+	testLedger.TxBegin(uuid1)
+	testutil.AssertNoError(t, testLedger.SetInvocationPolicy(uuid1, "chaincode1", &protos.InvocationPolicy{}), "Error while setting the policy")
+	testLedger.TxFinished(uuid1, false)
+	readPolicy, _ = testLedger.GetInvocationPolicy("", "chaincode1", false)
+	testutil.AssertEquals(t, readPolicy, policy)
+	transaction2, uuid2 := buildTestTx(t)
+	testLedger.TxBegin(uuid2)
+	testutil.AssertNoError(t, testLedger.SetInvocationPolicy(uuid2, "chaincode1", nil), "Error while removing the policy")
+	testLedger.TxFinished(uuid2, true)
+	testutil.AssertNoError(t, testLedger.CommitTxBatch(2, []*protos.Transaction{transaction1, transaction2}, nil, nil), "Error while committing")
+	readPolicy, _ = testLedger.GetInvocationPolicy("", "chaincode1", true)
+	testutil.AssertNil(t, readPolicy)
+
+	// the policies are out of the reach of the chaincodes
+	_, err = testLedger.GetNamespaceState("", "chaincode1", invocationPoliciesChaincodeID, "chaincode1", true)
+	assertAccessDenied(t, err)
+}
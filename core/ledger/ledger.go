@@ -20,6 +20,8 @@ import (
 	"bytes"
 	"fmt"
 	"reflect"
+	"regexp"
+	"sort"
 	"sync"
 
 	"github.com/golang/protobuf/proto"
@@ -28,7 +30,6 @@ import (
 	"github.com/hyperledger/fabric/core/ledger/statemgmt/state"
 	"github.com/hyperledger/fabric/events/producer"
 	"github.com/op/go-logging"
-	"github.com/tecbot/gorocksdb"
 
 	"github.com/hyperledger/fabric/protos"
 	"golang.org/x/net/context"
@@ -48,6 +49,8 @@ const (
 	ErrorTypeResourceNotFound = ErrorType("ResourceNotFound")
 	//ErrorTypeBlockNotFound used to indicate if a block is not found when looked up by it's hash
 	ErrorTypeBlockNotFound = ErrorType("ErrorTypeBlockNotFound")
+	//ErrorTypeAccessDenied used to indicate that a chaincode accessed the state of another without a grant
+	ErrorTypeAccessDenied = ErrorType("AccessDenied")
 )
 
 //Error can be used for throwing an error from ledger code.
@@ -79,16 +82,29 @@ var (
 
 // Ledger - the struct for openchain ledger
 type Ledger struct {
-	blockchain *blockchain
-	state      *state.State
-	currentID  interface{}
+	blockchain  *blockchain
+	state       *state.State
+	currentID   interface{}
+	staged      []*protos.Block // blocks of the ongoing batch not written yet
+	chainID     string
+	openchainDB *db.OpenchainDB
+	checkpoints *snapshotCheckpoints // nil if checkpoint snapshots are disabled
+	privateData *privateData
+	gcLock      sync.Mutex // held by commits and garbage collections, which must not see each other's writes
 }
 
 var ledger *Ledger
 var ledgerError error
 var once sync.Once
 
-// GetLedger - gives a reference to a 'singleton' ledger
+var chainLedgers = make(map[string]*Ledger)
+var chainLedgersLock sync.Mutex
+
+// chainIDPattern restricts chain IDs to names which are safe to use in the paths of their
+// databases and in the names of their CouchDB databases
+var chainIDPattern = regexp.MustCompile("^[a-z0-9][a-z0-9_-]*$")
+
+// GetLedger - gives a reference to a 'singleton' ledger, that of the default chain
 func GetLedger() (*Ledger, error) {
 	once.Do(func() {
 		ledger, ledgerError = GetNewLedger()
@@ -96,15 +112,64 @@ func GetLedger() (*Ledger, error) {
 	return ledger, ledgerError
 }
 
+// GetChainLedger gives a reference to the 'singleton' ledger of a chain. Each chain has blocks,
+// indexes and a state of its own, the ledger of the default chain being the one GetLedger returns
+func GetChainLedger(chainID string) (*Ledger, error) {
+	if chainID == db.DefaultChainID {
+		return GetLedger()
+	}
+	chainLedgersLock.Lock()
+	defer chainLedgersLock.Unlock()
+	if chainLedger, ok := chainLedgers[chainID]; ok {
+		return chainLedger, nil
+	}
+	chainLedger, err := GetNewChainLedger(chainID)
+	if err != nil {
+		return nil, err
+	}
+	chainLedgers[chainID] = chainLedger
+	return chainLedger, nil
+}
+
+// GetChainIDs returns the IDs of the chains other than the default one, those not opened yet included
+func GetChainIDs() ([]string, error) {
+	return db.GetChainIDs()
+}
+
 // GetNewLedger - gives a reference to a new ledger TODO need better approach
 func GetNewLedger() (*Ledger, error) {
-	blockchain, err := newBlockchain()
+	return GetNewChainLedger(db.DefaultChainID)
+}
+
+// GetNewChainLedger gives a reference to a new ledger of a chain
+func GetNewChainLedger(chainID string) (*Ledger, error) {
+	if chainID != db.DefaultChainID && !chainIDPattern.MatchString(chainID) {
+		return nil, newLedgerError(ErrorTypeInvalidArgument,
+			fmt.Sprintf("ledger: invalid chain ID [%s], it must consist of lowercase letters, digits, '_' and '-' and start with a letter or a digit", chainID))
+	}
+	openchainDB := db.GetChainDBHandle(chainID)
+	blockchain, err := newBlockchain(openchainDB)
 	if err != nil {
 		return nil, err
 	}
 
-	state := state.NewState()
-	return &Ledger{blockchain, state, nil}, nil
+	state := state.NewChainState(chainID)
+	ledger := &Ledger{blockchain, state, nil, nil, chainID, openchainDB, nil, newPrivateData(openchainDB), sync.Mutex{}}
+	if ledger.checkpoints, err = loadSnapshotCheckpoints(ledger); err != nil {
+		return nil, err
+	}
+	if err = ledger.startGarbageCollection(); err != nil {
+		return nil, err
+	}
+	if ledger.checkpoints != nil {
+		ledger.checkpoints.committed(blockchain.getSize())
+	}
+	return ledger, nil
+}
+
+// GetChainID returns the ID of the chain of the ledger, db.DefaultChainID for the default chain
+func (ledger *Ledger) GetChainID() string {
+	return ledger.chainID
 }
 
 /////////////////// Transaction-batch related methods ///////////////////////////////
@@ -112,6 +177,10 @@ func GetNewLedger() (*Ledger, error) {
 
 // BeginTxBatch - gets invoked when next round of transaction-batch execution begins
 func (ledger *Ledger) BeginTxBatch(id interface{}) error {
+	if len(ledger.staged) > 0 && reflect.DeepEqual(ledger.currentID, id) {
+		// continues after the staged blocks
+		return nil
+	}
 	err := ledger.checkValidIDBegin()
 	if err != nil {
 		return err
@@ -135,15 +204,69 @@ func (ledger *Ledger) GetTXBatchPreviewBlockInfo(id interface{},
 	if err != nil {
 		return nil, err
 	}
-	block := ledger.blockchain.buildBlock(protos.NewBlock(transactions, metadata), stateHash)
-	info := ledger.blockchain.getBlockchainInfoForBlock(ledger.blockchain.getSize()+1, block)
+	block := ledger.buildBlock(transactions, metadata, stateHash)
+	info := ledger.blockchain.getBlockchainInfoForBlock(ledger.blockchain.getSize()+uint64(len(ledger.staged))+1, block)
 	return info, nil
 }
 
+// StageTxBatch ends the current transaction-batch as a block which is not
+// written yet. The next transaction-batch, begun with the same id, executes
+// against its state, and CommitTxBatch writes the staged blocks along with
+// its own in a single write batch. RollbackTxBatch discards them
+func (ledger *Ledger) StageTxBatch(id interface{}, transactions []*protos.Transaction, transactionResults []*protos.TransactionResult, metadata []byte) error {
+	err := ledger.checkValidIDCommitORRollback(id)
+	if err != nil {
+		return err
+	}
+	stateHash, err := ledger.state.GetHash()
+	if err != nil {
+		return err
+	}
+	block := ledger.buildBlock(transactions, metadata, stateHash)
+	ledger.addReadWriteSets(transactionResults)
+	block.NonHashData = &protos.NonHashData{TransactionResults: transactionResults}
+	ledger.staged = append(ledger.staged, block)
+	ledger.state.StageBlock()
+	ledger.privateData.stageBlock()
+	return nil
+}
+
+// buildBlock builds the block which follows the staged ones
+func (ledger *Ledger) buildBlock(transactions []*protos.Transaction, metadata []byte, stateHash []byte) *protos.Block {
+	block := ledger.blockchain.buildBlock(protos.NewBlock(transactions, metadata), stateHash)
+	block.PrivateDataHash = ledger.privateData.hash()
+	if n := len(ledger.staged); n > 0 {
+		previousBlockHash, _ := ledger.staged[n-1].GetHash()
+		block.SetPreviousBlockHash(previousBlockHash)
+	}
+	return block
+}
+
 // CommitTxBatch - gets invoked when the current transaction-batch needs to be committed
 // This function returns successfully iff the transactions details and state changes (that
 // may have happened during execution of this transaction-batch) have been committed to permanent storage
+// The results of the transactions, the failed ones included, are recorded in the block's NonHashData, along with
+// the read-write sets of those which succeeded
+//
+// The commit goes through stages: the state hash is computed, the blocks are serialized and added to the
+// write batch for the blockchain column family, the state changes and deltas are added, and the batch is
+// written. The indexes of the blockchain and of the state are updated in the same batch or, with
+// ledger.commit.asyncIndexes, in the background once it is written, so that the commit does not wait for them
 func (ledger *Ledger) CommitTxBatch(id interface{}, transactions []*protos.Transaction, transactionResults []*protos.TransactionResult, metadata []byte) error {
+	return ledger.commitTxBatch(id, transactions, transactionResults, metadata, nil)
+}
+
+// CommitGenesisTxBatch commits the current transaction-batch as the genesis block, recording in it the spec
+// the genesis block was built from. It fails if the blockchain already has blocks
+func (ledger *Ledger) CommitGenesisTxBatch(id interface{}, transactions []*protos.Transaction, transactionResults []*protos.TransactionResult, spec *protos.GenesisSpec) error {
+	if size := ledger.GetBlockchainSize(); size != 0 {
+		ledger.RollbackTxBatch(id)
+		return fmt.Errorf("Cannot commit the genesis block, the blockchain already has %d blocks", size)
+	}
+	return ledger.commitTxBatch(id, transactions, transactionResults, nil, spec)
+}
+
+func (ledger *Ledger) commitTxBatch(id interface{}, transactions []*protos.Transaction, transactionResults []*protos.TransactionResult, metadata []byte, genesisSpec *protos.GenesisSpec) error {
 	err := ledger.checkValidIDCommitORRollback(id)
 	if err != nil {
 		return err
@@ -156,36 +279,66 @@ func (ledger *Ledger) CommitTxBatch(id interface{}, transactions []*protos.Trans
 		return err
 	}
 
-	writeBatch := gorocksdb.NewWriteBatch()
+	ledger.gcLock.Lock()
+	defer ledger.gcLock.Unlock()
+	writeBatch := ledger.openchainDB.NewWriteBatch()
 	defer writeBatch.Destroy()
 	block := protos.NewBlock(transactions, metadata)
-	block.NonHashData = &protos.NonHashData{}
-	newBlockNumber, err := ledger.blockchain.addPersistenceChangesForNewBlock(context.TODO(), block, stateHash, writeBatch)
+	block.StateHash = stateHash
+	block.PrivateDataHash = ledger.privateData.hash()
+	block.GenesisSpec = genesisSpec
+	ledger.addReadWriteSets(transactionResults)
+	block.NonHashData = &protos.NonHashData{TransactionResults: transactionResults}
+	blocks := append(ledger.staged, block)
+	newBlockNumber, err := ledger.addBlocksForPersistence(blocks, writeBatch)
 	if err != nil {
 		ledger.resetForNextTxGroup(false)
 		ledger.blockchain.blockPersistenceStatus(false)
 		return err
 	}
 	ledger.state.AddChangesForPersistence(newBlockNumber, writeBatch)
-	opt := gorocksdb.NewDefaultWriteOptions()
-	defer opt.Destroy()
-	dbErr := db.GetDBHandle().DB.Write(opt, writeBatch)
+	ledger.privateData.addChangesForPersistence(writeBatch)
+	// the blocks, the changes of the state and its deltas, the pruning, the private data and the synchronous
+	// indexes are written in a single synced batch, so that a crash leaves the ledger either before or after
+	// the commit, never in between
+	dbErr := ledger.openchainDB.WriteSync(writeBatch)
 	if dbErr != nil {
 		ledger.resetForNextTxGroup(false)
 		ledger.blockchain.blockPersistenceStatus(false)
 		return dbErr
 	}
 
+	// the committed changes are handed to the indexers updating the indexes asynchronously
 	ledger.resetForNextTxGroup(true)
 	ledger.blockchain.blockPersistenceStatus(true)
 
-	sendProducerBlockEvent(block)
-	if len(transactionResults) != 0 {
-		ledgerLogger.Debug("There were some erroneous transactions. We need to send a 'TX rejected' message here.")
+	for _, block := range blocks {
+		ledger.sendProducerBlockEvent(block)
+	}
+	if ledger.checkpoints != nil {
+		ledger.checkpoints.committed(ledger.blockchain.getSize())
 	}
 	return nil
 }
 
+// addBlocksForPersistence adds to writeBatch the blocks, the first ones being staged, and the pruning of the
+// blocks they push out of the blocks retained, returning the number of the last block
+func (ledger *Ledger) addBlocksForPersistence(blocks []*protos.Block, writeBatch db.WriteBatch) (uint64, error) {
+	var newBlockNumber uint64
+	var err error
+	for _, block := range blocks {
+		newBlockNumber, err = ledger.blockchain.addPersistenceChangesForNewBlock(context.TODO(), block, block.StateHash, writeBatch)
+		if err != nil {
+			return 0, err
+		}
+	}
+	if err = ledger.blockchain.addPruningChanges(newBlockNumber+1, writeBatch); err != nil {
+		// pruning is retried along with the next commit, which it must not hold up
+		ledgerLogger.Warningf("Could not prune blocks: %s", err)
+	}
+	return newBlockNumber, nil
+}
+
 // RollbackTxBatch - Discards all the state changes that may have taken place during the execution of
 // current transaction-batch
 func (ledger *Ledger) RollbackTxBatch(id interface{}) error {
@@ -207,6 +360,40 @@ func (ledger *Ledger) TxBegin(txUUID string) {
 // If txSuccessful is false, the state changes made by the transaction are discarded
 func (ledger *Ledger) TxFinished(txUUID string, txSuccessful bool) {
 	ledger.state.TxFinish(txUUID, txSuccessful)
+	ledger.privateData.txFinished(txUUID, txSuccessful)
+}
+
+// TxBeginIsolated - Marks the begin of a transaction which executes in isolation, concurrently with other
+// isolated transactions of the ongoing batch. Its state changes are kept aside until TxApplyIsolated is called
+func (ledger *Ledger) TxBeginIsolated(txUUID string) {
+	ledger.state.TxBeginIsolated(txUUID)
+}
+
+// TxFinishedIsolated - Marks the finish of an isolated transaction
+func (ledger *Ledger) TxFinishedIsolated(txUUID string, txSuccessful bool) {
+	ledger.state.TxFinishIsolated(txUUID, txSuccessful)
+	if !txSuccessful {
+		ledger.privateData.txFinished(txUUID, false)
+	}
+}
+
+// GetTxReadWriteSet - Returns the keys read and written by a finished isolated transaction
+func (ledger *Ledger) GetTxReadWriteSet(txUUID string) *state.TxReadWriteSet {
+	return ledger.state.GetTxReadWriteSet(txUUID)
+}
+
+// TxApplyIsolated - Merges the state changes of a finished isolated transaction into the ongoing batch,
+// returns whether the transaction was successful
+func (ledger *Ledger) TxApplyIsolated(txUUID string) bool {
+	applied := ledger.state.TxApplyIsolated(txUUID)
+	ledger.privateData.txFinished(txUUID, applied)
+	return applied
+}
+
+// TxDiscardIsolated - Discards an isolated transaction and its state changes
+func (ledger *Ledger) TxDiscardIsolated(txUUID string) {
+	ledger.state.TxDiscardIsolated(txUUID)
+	ledger.privateData.txFinished(txUUID, false)
 }
 
 /////////////////// world-state related methods /////////////////////////////////////
@@ -232,6 +419,23 @@ func (ledger *Ledger) GetState(chaincodeID string, key string, committed bool) (
 	return ledger.state.Get(chaincodeID, key, committed)
 }
 
+// GetStateAtBlock get the value a key had once the block blockNumber was committed,
+// only the state of the last ledger.state.historyQueryBlocks blocks can be read
+func (ledger *Ledger) GetStateAtBlock(chaincodeID string, key string, blockNumber uint64) ([]byte, error) {
+	size := ledger.GetBlockchainSize()
+	if blockNumber >= size {
+		return nil, ErrOutOfBounds
+	}
+	return ledger.state.GetAtBlock(chaincodeID, key, blockNumber, size)
+}
+
+// GetStateProof returns the committed value for chaincodeID and key (nil if the key does not exist), and a proof
+// that the state has this value. buckettree.VerifyStateProof, or trie.VerifyStateProof for the 'trie' data
+// structure, checks the proof against the StateHash of the last block, so that light clients do not need to trust the peer
+func (ledger *Ledger) GetStateProof(chaincodeID string, key string) ([]byte, []byte, error) {
+	return ledger.state.GetProof(chaincodeID, key)
+}
+
 // GetStateRangeScanIterator returns an iterator to get all the keys (and values) between startKey and endKey
 // (assuming lexical order of the keys) for a chaincodeID.
 // If committed is true, the key-values are retrieved only from the db. If committed is false, the results from db
@@ -241,6 +445,29 @@ func (ledger *Ledger) GetStateRangeScanIterator(chaincodeID string, startKey str
 	return ledger.state.GetRangeScanIterator(chaincodeID, startKey, endKey, committed)
 }
 
+// GetStateRangeScanPage returns at most pageSize key-values of the committed state of a chaincodeID between
+// startKey and endKey, starting after the page bookmark was returned with, or at startKey if bookmark is empty.
+// The bookmark of the page returned is empty once the range is exhausted
+func (ledger *Ledger) GetStateRangeScanPage(chaincodeID string, startKey string, endKey string, pageSize int, bookmark string) (*state.RangeScanPage, error) {
+	return ledger.state.GetRangeScanPage(chaincodeID, startKey, endKey, pageSize, bookmark)
+}
+
+// GetStateFilteredRangeScanIterator returns an iterator to get the keys (and values) of the committed state of a
+// chaincodeID between startKey and endKey which pass the filter: starting with a prefix, set by the blocks committed
+// since a block, or with a value not larger than a size. The key-values in the returned iterator are not guaranteed
+// to be in any specific order
+func (ledger *Ledger) GetStateFilteredRangeScanIterator(chaincodeID string, startKey string, endKey string, filter *state.RangeScanFilter) (statemgmt.RangeScanIterator, error) {
+	return ledger.state.GetFilteredRangeScanIterator(chaincodeID, startKey, endKey, filter, ledger.GetBlockchainSize())
+}
+
+// GetStateIndexRangeScanIterator returns an iterator to get the keys (and values) of the committed state of a
+// chaincodeID whose value has the field indexed by the index between start and end, inclusive. The bounds are JSON
+// values, nil leaving the range open on its side. Indexes are enabled by ledger.state.indexes.enabled
+// The key-values in the returned iterator are in the order of the indexed field
+func (ledger *Ledger) GetStateIndexRangeScanIterator(chaincodeID string, index string, start []byte, end []byte) (statemgmt.RangeScanIterator, error) {
+	return ledger.state.GetIndexRangeScanIterator(chaincodeID, index, start, end)
+}
+
 // SetState sets state to given value for chaincodeID and key. Does not immideatly writes to DB
 func (ledger *Ledger) SetState(chaincodeID string, key string, value []byte) error {
 	if key == "" || value == nil {
@@ -255,6 +482,44 @@ func (ledger *Ledger) DeleteState(chaincodeID string, key string) error {
 	return ledger.state.Delete(chaincodeID, key)
 }
 
+// GetTxState is GetState as seen by the transaction txUUID, which may be an isolated transaction
+func (ledger *Ledger) GetTxState(txUUID string, chaincodeID string, key string, committed bool) ([]byte, error) {
+	return ledger.state.GetForTx(txUUID, chaincodeID, key, committed)
+}
+
+// GetTxStateRangeScanIterator is GetStateRangeScanIterator as seen by the transaction txUUID, which may be
+// an isolated transaction
+func (ledger *Ledger) GetTxStateRangeScanIterator(txUUID string, chaincodeID string, startKey string, endKey string, committed bool) (statemgmt.RangeScanIterator, error) {
+	return ledger.state.GetRangeScanIteratorForTx(txUUID, chaincodeID, startKey, endKey, committed)
+}
+
+// GetStateAtLevel gets state for chaincodeID and key as seen by a query of the given level. A tentative query
+// reads through the changes of the transactions of the batch in progress which finished successfully, so that
+// speculative execution sees the effects of the earlier transactions of a batch before it is committed
+func (ledger *Ledger) GetStateAtLevel(chaincodeID string, key string, level state.QueryLevel) ([]byte, error) {
+	return ledger.state.GetAtLevel(chaincodeID, key, level)
+}
+
+// GetStateRangeScanIteratorAtLevel is GetStateRangeScanIterator as seen by a query of the given level, see
+// GetStateAtLevel
+func (ledger *Ledger) GetStateRangeScanIteratorAtLevel(chaincodeID string, startKey string, endKey string, level state.QueryLevel) (statemgmt.RangeScanIterator, error) {
+	return ledger.state.GetRangeScanIteratorAtLevel(chaincodeID, startKey, endKey, level)
+}
+
+// SetTxState is SetState on behalf of the transaction txUUID, which may be an isolated transaction
+func (ledger *Ledger) SetTxState(txUUID string, chaincodeID string, key string, value []byte) error {
+	if key == "" || value == nil {
+		return newLedgerError(ErrorTypeInvalidArgument,
+			fmt.Sprintf("An empty string key or a nil value is not supported. Method invoked with key='%s', value='%#v'", key, value))
+	}
+	return ledger.state.SetForTx(txUUID, chaincodeID, key, value)
+}
+
+// DeleteTxState is DeleteState on behalf of the transaction txUUID, which may be an isolated transaction
+func (ledger *Ledger) DeleteTxState(txUUID string, chaincodeID string, key string) error {
+	return ledger.state.DeleteForTx(txUUID, chaincodeID, key)
+}
+
 // CopyState copies all the key-values from sourceChaincodeID to destChaincodeID
 func (ledger *Ledger) CopyState(sourceChaincodeID string, destChaincodeID string) error {
 	return ledger.state.CopyState(sourceChaincodeID, destChaincodeID)
@@ -272,12 +537,19 @@ func (ledger *Ledger) SetStateMultipleKeys(chaincodeID string, kvs map[string][]
 	return ledger.state.SetMultipleKeys(chaincodeID, kvs)
 }
 
+// GetStateView opens a read-only view of the committed state, which queries can read while blocks are
+// committed, without seeing the changes of the blocks committed since the view was opened. You must call
+// stateView.Release() once you are done with the view
+func (ledger *Ledger) GetStateView() *state.StateView {
+	return ledger.state.OpenView()
+}
+
 // GetStateSnapshot returns a point-in-time view of the global state for the current block. This
 // should be used when transferring the state from one peer to another peer. You must call
 // stateSnapshot.Release() once you are done with the snapshot to free up resources.
 func (ledger *Ledger) GetStateSnapshot() (*state.StateSnapshot, error) {
-	dbSnapshot := db.GetDBHandle().GetSnapshot()
-	blockHeight, err := fetchBlockchainSizeFromSnapshot(dbSnapshot)
+	dbSnapshot := ledger.openchainDB.GetSnapshot()
+	blockHeight, err := fetchBlockchainSizeFromSnapshot(ledger.openchainDB, dbSnapshot)
 	if err != nil {
 		dbSnapshot.Release()
 		return nil, err
@@ -326,6 +598,28 @@ func (ledger *Ledger) ApplyStateDelta(id interface{}, delta *statemgmt.StateDelt
 	return nil
 }
 
+// ApplyStateDeltas applies the state deltas of consecutive blocks, given in the
+// order of the blocks, as a single state delta. This makes a catch up over many
+// blocks compute the state hash once, with ledger.GetTempStateHash, and write
+// the state to the DB in a single batch, with ledger.CommitStateDelta, rather
+// than once per block. The deltas must all roll the state in the same direction.
+// Unlike ledger.ApplyStateDelta, the state can only be checked against the state
+// hash of the last block rolled forward to (or of the block before the first one
+// rolled back).
+func (ledger *Ledger) ApplyStateDeltas(id interface{}, deltas []*statemgmt.StateDelta) error {
+	err := ledger.checkValidIDBegin()
+	if err != nil {
+		return err
+	}
+	delta, err := statemgmt.MergeStateDeltas(deltas...)
+	if err != nil {
+		return err
+	}
+	ledger.currentID = id
+	ledger.state.ApplyStateDelta(delta)
+	return nil
+}
+
 // CommitStateDelta will commit the state delta passed to ledger.ApplyStateDelta
 // to the DB
 func (ledger *Ledger) CommitStateDelta(id interface{}) error {
@@ -337,6 +631,46 @@ func (ledger *Ledger) CommitStateDelta(id interface{}) error {
 	return ledger.state.CommitStateDelta()
 }
 
+// CommitStateDeltaWithBlocks will commit the state delta passed to
+// ledger.ApplyStateDelta along with raw blocks, keyed by their number, in a
+// single synced batch. State synchronization commits the blocks the delta
+// brings the state to this way, so that a crash never leaves blocks on the
+// chain which the state does not reflect. Like ledger.PutRawBlock, this
+// function should only be used for synchronization between peers.
+func (ledger *Ledger) CommitStateDeltaWithBlocks(id interface{}, blocks map[uint64]*protos.Block) error {
+	err := ledger.checkValidIDCommitORRollback(id)
+	if err != nil {
+		return err
+	}
+	defer func() { ledger.resetForNextTxGroup(err == nil) }()
+	blockNumbers := make([]uint64, 0, len(blocks))
+	for blockNumber := range blocks {
+		blockNumbers = append(blockNumbers, blockNumber)
+	}
+	sort.Sort(uint64Slice(blockNumbers))
+
+	ledger.gcLock.Lock()
+	writeBatch := ledger.openchainDB.NewWriteBatch()
+	defer writeBatch.Destroy()
+	for _, blockNumber := range blockNumbers {
+		if err = ledger.blockchain.addRawBlockForPersistence(blocks[blockNumber], blockNumber, writeBatch); err != nil {
+			break
+		}
+	}
+	if err == nil {
+		err = ledger.state.CommitStateDeltaWith(writeBatch)
+	}
+	ledger.blockchain.rawBlocksPersistenceStatus(err == nil)
+	ledger.gcLock.Unlock()
+	if err != nil {
+		return err
+	}
+	for _, blockNumber := range blockNumbers {
+		ledger.sendProducerBlockEvent(blocks[blockNumber])
+	}
+	return nil
+}
+
 // RollbackStateDelta will discard the state delta passed
 // to ledger.ApplyStateDelta
 func (ledger *Ledger) RollbackStateDelta(id interface{}) error {
@@ -373,24 +707,81 @@ func (ledger *Ledger) GetBlockByNumber(blockNumber uint64) (*protos.Block, error
 	return ledger.blockchain.getBlock(blockNumber)
 }
 
+// GetBlocksByRange calls fn on the blocks from startBlock to endBlock (inclusive), in this order (which may be
+// decreasing), until fn returns an error, which is then returned. The blocks are read sequentially, which is
+// cheaper than calling GetBlockByNumber for each of them
+func (ledger *Ledger) GetBlocksByRange(startBlock uint64, endBlock uint64, fn func(blockNumber uint64, block *protos.Block) error) error {
+	size := ledger.GetBlockchainSize()
+	if startBlock >= size || endBlock >= size {
+		return ErrOutOfBounds
+	}
+	return ledger.blockchain.getBlocksByRange(startBlock, endBlock, fn)
+}
+
 // GetBlockchainSize returns number of blocks in blockchain
 func (ledger *Ledger) GetBlockchainSize() uint64 {
 	return ledger.blockchain.getSize()
 }
 
+// GetPruneHeight returns the height below which the transactions of the
+// blocks were pruned, but for the genesis block's, 0 if none were
+func (ledger *Ledger) GetPruneHeight() uint64 {
+	return ledger.blockchain.pruning.height
+}
+
 // GetTransactionByUUID return transaction by it's uuid
 func (ledger *Ledger) GetTransactionByUUID(txUUID string) (*protos.Transaction, error) {
 	return ledger.blockchain.getTransactionByUUID(txUUID)
 }
 
+// GetTransactionReceipt returns the receipt of the transaction with txUUID, recording whether it succeeded, with its
+// result or error and the chaincode event it emitted. Receipts are kept for the transactions which failed, which are
+// not in the blockchain, and for those of the blocks pruned. ErrResourceNotFound is returned if there is no receipt
+func (ledger *Ledger) GetTransactionReceipt(txUUID string) (*protos.TransactionReceipt, error) {
+	return ledger.blockchain.getTransactionReceipt(txUUID)
+}
+
+// GetTransactionsByChaincodeID returns, in the order of the blockchain, the transactions deploying or invoking the
+// chaincode named chaincodeID in the blocks from startBlock to endBlock (inclusive). Only the blocks committed since
+// the peer indexes the transactions by chaincode are searched. ErrPruned is returned if one of the blocks was pruned
+func (ledger *Ledger) GetTransactionsByChaincodeID(chaincodeID string, startBlock uint64, endBlock uint64) ([]*protos.Transaction, error) {
+	if startBlock > endBlock {
+		return nil, ErrOutOfBounds
+	}
+	return ledger.blockchain.getTransactionsByChaincodeID(chaincodeID, startBlock, endBlock)
+}
+
+// GetBlockNumbersByEventName returns, in increasing order, the numbers of the blocks from startBlock to endBlock
+// (inclusive) with a transaction which emitted a chaincode event named eventName. As for
+// GetTransactionsByChaincodeID, only the blocks committed since the peer indexes the events are searched
+func (ledger *Ledger) GetBlockNumbersByEventName(eventName string, startBlock uint64, endBlock uint64) ([]uint64, error) {
+	if startBlock > endBlock {
+		return nil, ErrOutOfBounds
+	}
+	return ledger.blockchain.getBlockNumbersByEventName(eventName, startBlock, endBlock)
+}
+
+// GetBlockNumbersByEventAttribute returns, in increasing order, the numbers of the blocks from startBlock to
+// endBlock (inclusive) with a transaction which emitted a chaincode event named eventName with the indexed attribute
+// of the name, type and value of attribute. As for GetBlockNumbersByEventName, only the blocks committed since the
+// peer indexes the attributes are searched
+func (ledger *Ledger) GetBlockNumbersByEventAttribute(eventName string, attribute *protos.EventAttribute, startBlock uint64, endBlock uint64) ([]uint64, error) {
+	if startBlock > endBlock {
+		return nil, ErrOutOfBounds
+	}
+	return ledger.blockchain.getBlockNumbersByEventAttribute(eventName, attribute, startBlock, endBlock)
+}
+
 // PutRawBlock puts a raw block on the chain. This function should only be
 // used for synchronization between peers.
 func (ledger *Ledger) PutRawBlock(block *protos.Block, blockNumber uint64) error {
+	ledger.gcLock.Lock()
 	err := ledger.blockchain.persistRawBlock(block, blockNumber)
+	ledger.gcLock.Unlock()
 	if err != nil {
 		return err
 	}
-	sendProducerBlockEvent(block)
+	ledger.sendProducerBlockEvent(block)
 	return nil
 }
 
@@ -432,7 +823,8 @@ func (ledger *Ledger) VerifyChain(highBlock, lowBlock uint64) (uint64, error) {
 		if previousBlock == nil {
 			return i, nil
 		}
-		previousBlockHash, err := previousBlock.GetHash()
+		// a pruned block is verified by the hash it recorded
+		previousBlockHash, err := committedBlockHash(previousBlock)
 		if err != nil {
 			return i, nil
 		}
@@ -462,10 +854,17 @@ func (ledger *Ledger) checkValidIDCommitORRollback(id interface{}) error {
 func (ledger *Ledger) resetForNextTxGroup(txCommited bool) {
 	ledgerLogger.Debug("resetting ledger state for next transaction batch")
 	ledger.currentID = nil
+	ledger.staged = nil
 	ledger.state.ClearInMemoryChanges(txCommited)
+	ledger.privateData.clear()
 }
 
-func sendProducerBlockEvent(block *protos.Block) {
+// sendProducerBlockEvent sends the block event of a block, then the chaincode events emitted by its transactions,
+// only for the default chain as events do not tell the chain of their block
+func (ledger *Ledger) sendProducerBlockEvent(block *protos.Block) {
+	if ledger.chainID != db.DefaultChainID {
+		return
+	}
 
 	// Remove payload from deploy transactions. This is done to make block
 	// events more lightweight as the payload for these types of transactions
@@ -490,4 +889,18 @@ func sendProducerBlockEvent(block *protos.Block) {
 	}
 
 	producer.Send(producer.CreateBlockEvent(block))
+
+	// the events of the transactions which failed are recorded in the block, but not sent
+	inBlock := make(map[string]bool)
+	for _, transaction := range blockTransactions {
+		inBlock[transaction.Uuid] = true
+	}
+	for _, txResult := range block.GetNonHashData().GetTransactionResults() {
+		if !inBlock[txResult.Uuid] {
+			continue
+		}
+		for _, event := range txResultEvents(txResult) {
+			producer.Send(producer.CreateChaincodeEvent(event))
+		}
+	}
 }
@@ -0,0 +1,88 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ledger
+
+import (
+	"strings"
+
+	"github.com/hyperledger/fabric/core/ledger/statemgmt"
+)
+
+// LedgerStats holds the statistics of the ledger used for capacity planning
+type LedgerStats struct {
+	// Height is the number of blocks in the blockchain
+	Height uint64 `json:"height"`
+	// TransactionCount is the number of transactions committed to the blockchain, those of pruned blocks included
+	TransactionCount uint64 `json:"transactionCount"`
+	// StateKeyCount is the number of keys in the committed state
+	StateKeyCount uint64 `json:"stateKeyCount"`
+	// StateSize is the size in bytes of the keys and values of the committed state, leaving out what the
+	// state data structure and the database add to it
+	StateSize uint64 `json:"stateSize"`
+	// Chaincodes holds the footprint in the state of each chaincode, by chaincode ID
+	Chaincodes map[string]*ChaincodeStateStats `json:"chaincodes"`
+	// DBSizeEstimates holds the size in bytes of the live data of each column family of the database,
+	// as estimated by the database. It is empty if the database backend does not estimate it
+	DBSizeEstimates map[string]uint64 `json:"dbSizeEstimates"`
+}
+
+// ChaincodeStateStats holds the footprint of a chaincode in the state
+type ChaincodeStateStats struct {
+	KeyCount uint64 `json:"keyCount"`
+	Size     uint64 `json:"size"`
+}
+
+// GetLedgerStats returns the statistics of the ledger. The state is scanned to count its keys, which takes
+// time in proportion to the size of the state, so that the statistics are not meant to be polled often
+func (ledger *Ledger) GetLedgerStats() (*LedgerStats, error) {
+	stats := &LedgerStats{
+		Height:           ledger.blockchain.getSize(),
+		TransactionCount: ledger.blockchain.txCount,
+		Chaincodes:       make(map[string]*ChaincodeStateStats),
+		DBSizeEstimates:  make(map[string]uint64),
+	}
+	if stats.Height > 0 {
+		stateSnapshot, err := ledger.GetStateSnapshot()
+		if err != nil {
+			return nil, err
+		}
+		defer stateSnapshot.Release()
+		for stateSnapshot.Next() {
+			key, value := stateSnapshot.GetRawKeyValue()
+			chaincodeID, _ := statemgmt.DecodeCompositeKey(key)
+			chaincodeStats, ok := stats.Chaincodes[chaincodeID]
+			if !ok {
+				chaincodeStats = &ChaincodeStateStats{}
+				stats.Chaincodes[chaincodeID] = chaincodeStats
+			}
+			// the composite key holds the chaincode ID and a separator along with the key
+			size := uint64(len(key) - len(chaincodeID) - 1 + len(value))
+			chaincodeStats.KeyCount++
+			chaincodeStats.Size += size
+			stats.StateKeyCount++
+			stats.StateSize += size
+		}
+	}
+	if _, dbStats, err := ledger.openchainDB.GetStats(); err == nil {
+		for name, value := range dbStats {
+			if strings.HasSuffix(name, ".liveDataSize") {
+				stats.DBSizeEstimates[strings.TrimSuffix(name, ".liveDataSize")] = uint64(value)
+			}
+		}
+	}
+	return stats, nil
+}
@@ -21,7 +21,9 @@ import (
 	"strconv"
 	"testing"
 
+	"github.com/hyperledger/fabric/core/db"
 	"github.com/hyperledger/fabric/core/ledger/statemgmt"
+	"github.com/hyperledger/fabric/core/ledger/statemgmt/state"
 	"github.com/hyperledger/fabric/core/ledger/testutil"
 	"github.com/hyperledger/fabric/protos"
 )
@@ -41,6 +43,24 @@ func TestLedgerCommit(t *testing.T) {
 	testutil.AssertEquals(t, ledgerTestWrapper.GetState("chaincode1", "key1", true), []byte("value1"))
 }
 
+func TestLedgerCommitTransactionResults(t *testing.T) {
+	ledgerTestWrapper := createFreshDBAndTestLedgerWrapper(t)
+	ledger := ledgerTestWrapper.ledger
+	transaction, _ := buildTestTx(t)
+	results := []*protos.TransactionResult{
+		{Uuid: transaction.Uuid, Result: []byte("result")},
+		{Uuid: "failedUuid", ErrorCode: 1, Error: "failed"},
+	}
+
+	ledger.BeginTxBatch(1)
+	ledger.StageTxBatch(1, []*protos.Transaction{transaction}, results[:1], nil)
+	ledger.BeginTxBatch(1)
+	ledger.CommitTxBatch(1, []*protos.Transaction{transaction}, results, nil)
+
+	testutil.AssertEquals(t, ledgerTestWrapper.GetBlockByNumber(0).NonHashData.TransactionResults, results[:1])
+	testutil.AssertEquals(t, ledgerTestWrapper.GetBlockByNumber(1).NonHashData.TransactionResults, results)
+}
+
 func TestLedgerRollback(t *testing.T) {
 	ledgerTestWrapper := createFreshDBAndTestLedgerWrapper(t)
 	ledger := ledgerTestWrapper.ledger
@@ -54,6 +74,81 @@ func TestLedgerRollback(t *testing.T) {
 	testutil.AssertNil(t, ledgerTestWrapper.GetState("chaincode1", "key1", false))
 }
 
+func TestLedgerStageTxBatch(t *testing.T) {
+	// executes three batches, the second overwriting and deleting what the first set
+	executeBatches := func(ledger *Ledger, end func(id int, metadata []byte)) {
+		for id := 1; id <= 3; id++ {
+			ledger.BeginTxBatch(1)
+			ledger.TxBegin("txUuid")
+			switch id {
+			case 1:
+				ledger.SetState("chaincode1", "key1", []byte("value1"))
+				ledger.SetState("chaincode1", "key2", []byte("value2"))
+			case 2:
+				ledger.SetState("chaincode1", "key1", []byte("value1a"))
+				ledger.DeleteState("chaincode1", "key2")
+			case 3:
+				ledger.SetState("chaincode2", "key3", []byte("value3"))
+			}
+			ledger.TxFinished("txUuid", true)
+			end(id, []byte{byte(id)})
+		}
+	}
+
+	serialWrapper := createFreshDBAndTestLedgerWrapper(t)
+	executeBatches(serialWrapper.ledger, func(id int, metadata []byte) {
+		serialWrapper.ledger.CommitTxBatch(1, nil, nil, metadata)
+	})
+	var serialHashes [][]byte
+	var serialDeltas []*statemgmt.StateDelta
+	for blockNumber := uint64(0); blockNumber < 3; blockNumber++ {
+		hash, _ := serialWrapper.GetBlockByNumber(blockNumber).GetHash()
+		serialHashes = append(serialHashes, hash)
+		serialDeltas = append(serialDeltas, serialWrapper.GetStateDelta(blockNumber))
+	}
+
+	ledgerTestWrapper := createFreshDBAndTestLedgerWrapper(t)
+	ledger := ledgerTestWrapper.ledger
+	executeBatches(ledger, func(id int, metadata []byte) {
+		if id < 3 {
+			testutil.AssertNoError(t, ledger.StageTxBatch(1, nil, nil, metadata), "Error staging the batch")
+			testutil.AssertEquals(t, ledger.GetBlockchainSize(), uint64(0))
+			return
+		}
+		previewInfo, _ := ledger.GetTXBatchPreviewBlockInfo(1, nil, metadata)
+		testutil.AssertEquals(t, previewInfo.Height, uint64(3))
+		testutil.AssertEquals(t, previewInfo.CurrentBlockHash, serialHashes[2])
+		testutil.AssertNoError(t, ledger.CommitTxBatch(1, nil, nil, metadata), "Error committing the batches")
+	})
+
+	testutil.AssertEquals(t, ledger.GetBlockchainSize(), uint64(3))
+	for blockNumber := uint64(0); blockNumber < 3; blockNumber++ {
+		hash, _ := ledgerTestWrapper.GetBlockByNumber(blockNumber).GetHash()
+		testutil.AssertEquals(t, hash, serialHashes[blockNumber])
+		testutil.AssertEquals(t, ledgerTestWrapper.GetStateDelta(blockNumber), serialDeltas[blockNumber])
+	}
+	testutil.AssertEquals(t, ledgerTestWrapper.GetState("chaincode1", "key1", true), []byte("value1a"))
+	testutil.AssertNil(t, ledgerTestWrapper.GetState("chaincode1", "key2", true))
+}
+
+func TestLedgerRollbackStagedTxBatch(t *testing.T) {
+	ledgerTestWrapper := createFreshDBAndTestLedgerWrapper(t)
+	ledger := ledgerTestWrapper.ledger
+	hash0 := ledgerTestWrapper.GetTempStateHash()
+	ledger.BeginTxBatch(1)
+	ledger.TxBegin("txUuid")
+	ledger.SetState("chaincode1", "key1", []byte("value1"))
+	ledger.TxFinished("txUuid", true)
+	ledger.StageTxBatch(1, nil, nil, nil)
+
+	testutil.AssertError(t, ledger.BeginTxBatch(2), "Expected another batch not to begin while blocks are staged")
+	testutil.AssertNoError(t, ledger.BeginTxBatch(1), "Error continuing after the staged block")
+	ledger.RollbackTxBatch(1)
+	testutil.AssertNil(t, ledgerTestWrapper.GetState("chaincode1", "key1", false))
+	testutil.AssertEquals(t, ledgerTestWrapper.GetTempStateHash(), hash0)
+	testutil.AssertEquals(t, ledger.GetBlockchainSize(), uint64(0))
+}
+
 func TestLedgerRollbackWithHash(t *testing.T) {
 	ledgerTestWrapper := createFreshDBAndTestLedgerWrapper(t)
 	ledger := ledgerTestWrapper.ledger
@@ -439,6 +534,45 @@ func TestBlockNumberOutOfBoundsError(t *testing.T) {
 
 }
 
+func TestGetBlocksByRange(t *testing.T) {
+	ledgerTestWrapper := createFreshDBAndTestLedgerWrapper(t)
+	ledger := ledgerTestWrapper.ledger
+	for i := 0; i < 5; i++ {
+		ledger.BeginTxBatch(i)
+		transaction, _ := buildTestTx(t)
+		ledger.CommitTxBatch(i, []*protos.Transaction{transaction}, nil, []byte("proof"))
+	}
+
+	getBlocksByRange := func(startBlock uint64, endBlock uint64) []uint64 {
+		blockNumbers := []uint64{}
+		err := ledger.GetBlocksByRange(startBlock, endBlock, func(blockNumber uint64, block *protos.Block) error {
+			testutil.AssertEquals(t, block, ledgerTestWrapper.GetBlockByNumber(blockNumber))
+			blockNumbers = append(blockNumbers, blockNumber)
+			return nil
+		})
+		testutil.AssertNoError(t, err, "Error while getting blocks by range")
+		return blockNumbers
+	}
+	testutil.AssertEquals(t, getBlocksByRange(0, 4), []uint64{0, 1, 2, 3, 4})
+	testutil.AssertEquals(t, getBlocksByRange(3, 1), []uint64{3, 2, 1})
+	testutil.AssertEquals(t, getBlocksByRange(2, 2), []uint64{2})
+
+	// an error of fn stops the iteration
+	blocks := 0
+	err := ledger.GetBlocksByRange(0, 4, func(blockNumber uint64, block *protos.Block) error {
+		if blocks++; blockNumber == 1 {
+			return ErrResourceNotFound
+		}
+		return nil
+	})
+	testutil.AssertEquals(t, err, ErrResourceNotFound)
+	testutil.AssertEquals(t, blocks, 2)
+
+	noop := func(blockNumber uint64, block *protos.Block) error { return nil }
+	testutil.AssertEquals(t, ledger.GetBlocksByRange(0, 5, noop), ErrOutOfBounds)
+	testutil.AssertEquals(t, ledger.GetBlocksByRange(5, 0, noop), ErrOutOfBounds)
+}
+
 func TestRollBackwardsAndForwards(t *testing.T) {
 
 	ledgerTestWrapper := createFreshDBAndTestLedgerWrapper(t)
@@ -660,6 +794,110 @@ func TestApplyDeltaHash(t *testing.T) {
 
 }
 
+func TestApplyStateDeltas(t *testing.T) {
+	ledgerTestWrapper := createFreshDBAndTestLedgerWrapper(t)
+	ledger := ledgerTestWrapper.ledger
+	commitTestStateBlocks(t, ledger, 5)
+
+	deltas := []*statemgmt.StateDelta{}
+	for blockNumber := uint64(2); blockNumber < 5; blockNumber++ {
+		delta := ledgerTestWrapper.GetStateDelta(blockNumber)
+		delta.RollBackwards = true
+		deltas = append(deltas, delta)
+	}
+
+	// Roll backwards from block 4 to block 1 at once
+	err := ledger.ApplyStateDeltas(1, deltas)
+	testutil.AssertNoError(t, err, "Error applying state deltas")
+	testutil.AssertEquals(t, ledgerTestWrapper.GetTempStateHash(), ledgerTestWrapper.GetBlockByNumber(1).StateHash)
+	ledgerTestWrapper.CommitStateDelta(1)
+	testutil.AssertEquals(t, ledgerTestWrapper.GetState("chaincode2", "key", true), []byte("value1"))
+	testutil.AssertEquals(t, ledgerTestWrapper.GetState("chaincode1", "key1", true), []byte("value1"))
+	testutil.AssertNil(t, ledgerTestWrapper.GetState("chaincode1", "key4", true))
+
+	// Roll forwards from block 1 to block 4 at once
+	for _, delta := range deltas {
+		delta.RollBackwards = false
+	}
+	err = ledger.ApplyStateDeltas(2, deltas)
+	testutil.AssertNoError(t, err, "Error applying state deltas")
+	testutil.AssertEquals(t, ledgerTestWrapper.GetTempStateHash(), ledgerTestWrapper.GetBlockByNumber(4).StateHash)
+	ledgerTestWrapper.CommitStateDelta(2)
+	testutil.AssertEquals(t, ledgerTestWrapper.GetState("chaincode2", "key", true), []byte("value4"))
+	testutil.AssertNil(t, ledgerTestWrapper.GetState("chaincode1", "key1", true))
+	testutil.AssertEquals(t, ledgerTestWrapper.GetState("chaincode1", "key4", true), []byte("value4"))
+
+	deltas[0].RollBackwards = true
+	err = ledger.ApplyStateDeltas(3, deltas)
+	testutil.AssertError(t, err, "Expected an error applying state deltas rolling in different directions")
+}
+
+func TestCommitStateDeltaWithBlocksCrashConsistency(t *testing.T) {
+	ledgerTestWrapper := createFreshDBAndTestLedgerWrapper(t)
+	commitTestStateBlocks(t, ledgerTestWrapper.ledger, 5)
+	blocks := make(map[uint64]*protos.Block)
+	deltas := []*statemgmt.StateDelta{}
+	for blockNumber := uint64(0); blockNumber < 5; blockNumber++ {
+		blocks[blockNumber] = ledgerTestWrapper.GetBlockByNumber(blockNumber)
+		deltas = append(deltas, ledgerTestWrapper.GetStateDelta(blockNumber))
+	}
+
+	// A peer with the state and the chain at block 0 catches up to block 4
+	ledgerTestWrapper = createFreshDBAndTestLedgerWrapper(t)
+	ledger := ledgerTestWrapper.ledger
+	ledgerTestWrapper.ApplyStateDelta(0, deltas[0])
+	err := ledger.CommitStateDeltaWithBlocks(0, map[uint64]*protos.Block{0: blocks[0]})
+	testutil.AssertNoError(t, err, "Error committing state delta with blocks")
+
+	assertCaughtUpTo := func(ledger *Ledger, blockNumber uint64) {
+		testutil.AssertEquals(t, ledger.GetBlockchainSize(), blockNumber+1)
+		stateHash, err := ledger.GetTempStateHash()
+		testutil.AssertNoError(t, err, "Error computing state hash")
+		testutil.AssertEquals(t, stateHash, blocks[blockNumber].StateHash)
+	}
+	assertCaughtUpTo(ledger, 0)
+
+	// A crash before the commit leaves neither the blocks nor the state
+	err = ledger.ApplyStateDeltas(1, deltas[1:])
+	testutil.AssertNoError(t, err, "Error applying state deltas")
+	restarted, err := GetNewLedger()
+	testutil.AssertNoError(t, err, "Error while constructing ledger")
+	assertCaughtUpTo(restarted, 0)
+
+	// Nor does a commit failing after some of the blocks are added to the batch
+	writeBatch := ledger.openchainDB.NewWriteBatch()
+	writeBatch.PutCF(ledger.openchainDB.BlockchainCF, encodeBlockNumberDBKey(4), []byte("corrupt"))
+	testDBWrapper.WriteToDB(t, writeBatch)
+	writeBatch.Destroy()
+	ledger = restarted
+	err = ledger.ApplyStateDeltas(2, deltas[1:])
+	testutil.AssertNoError(t, err, "Error applying state deltas")
+	err = ledger.CommitStateDeltaWithBlocks(2, map[uint64]*protos.Block{1: blocks[1], 2: blocks[2], 3: blocks[3], 4: blocks[4]})
+	testutil.AssertError(t, err, "Expected an error committing over a corrupt block")
+	assertCaughtUpTo(ledger, 0)
+	restarted, err = GetNewLedger()
+	testutil.AssertNoError(t, err, "Error while constructing ledger")
+	assertCaughtUpTo(restarted, 0)
+
+	// Once committed, the blocks and the state survive a restart together
+	writeBatch = ledger.openchainDB.NewWriteBatch()
+	writeBatch.DeleteCF(ledger.openchainDB.BlockchainCF, encodeBlockNumberDBKey(4))
+	testDBWrapper.WriteToDB(t, writeBatch)
+	writeBatch.Destroy()
+	ledger = restarted
+	err = ledger.ApplyStateDeltas(3, deltas[1:])
+	testutil.AssertNoError(t, err, "Error applying state deltas")
+	err = ledger.CommitStateDeltaWithBlocks(3, map[uint64]*protos.Block{1: blocks[1], 2: blocks[2], 3: blocks[3], 4: blocks[4]})
+	testutil.AssertNoError(t, err, "Error committing state delta with blocks")
+	assertCaughtUpTo(ledger, 4)
+	restarted, err = GetNewLedger()
+	testutil.AssertNoError(t, err, "Error while constructing ledger")
+	assertCaughtUpTo(restarted, 4)
+	lowBlock, err := restarted.VerifyChain(4, 0)
+	testutil.AssertNoError(t, err, "Error verifying chain")
+	testutil.AssertEquals(t, lowBlock, uint64(0))
+}
+
 func TestPreviewTXBatchBlock(t *testing.T) {
 	ledgerTestWrapper := createFreshDBAndTestLedgerWrapper(t)
 	ledger := ledgerTestWrapper.ledger
@@ -683,6 +921,54 @@ func TestPreviewTXBatchBlock(t *testing.T) {
 	testutil.AssertEquals(t, previewBlockInfo, committedBlockInfo)
 }
 
+func TestGetLedgerStats(t *testing.T) {
+	ledgerTestWrapper := createFreshDBAndTestLedgerWrapper(t)
+	ledger := ledgerTestWrapper.ledger
+	stats, err := ledger.GetLedgerStats()
+	testutil.AssertNoError(t, err, "Error while getting ledger stats")
+	testutil.AssertEquals(t, stats.Height, uint64(0))
+	testutil.AssertEquals(t, stats.TransactionCount, uint64(0))
+	testutil.AssertEquals(t, stats.StateKeyCount, uint64(0))
+
+	// Block 0
+	ledger.BeginTxBatch(0)
+	ledger.TxBegin("txUuid1")
+	ledger.SetState("chaincode1", "key1", []byte("value1"))
+	ledger.SetState("chaincode2", "key2", []byte("value22"))
+	ledger.TxFinished("txUuid1", true)
+	transaction1, _ := buildTestTx(t)
+	transaction2, _ := buildTestTx(t)
+	ledger.CommitTxBatch(0, []*protos.Transaction{transaction1, transaction2}, nil, []byte("proof"))
+
+	// Block 1
+	ledger.BeginTxBatch(1)
+	ledger.TxBegin("txUuid2")
+	ledger.SetState("chaincode1", "key3", []byte("value3"))
+	ledger.SetState("chaincode3", "key4", []byte("value4"))
+	ledger.DeleteState("chaincode2", "key2")
+	ledger.TxFinished("txUuid2", true)
+	transaction3, _ := buildTestTx(t)
+	ledger.CommitTxBatch(1, []*protos.Transaction{transaction3}, nil, []byte("proof"))
+
+	stats, err = ledger.GetLedgerStats()
+	testutil.AssertNoError(t, err, "Error while getting ledger stats")
+	testutil.AssertEquals(t, stats.Height, uint64(2))
+	testutil.AssertEquals(t, stats.TransactionCount, uint64(3))
+	testutil.AssertEquals(t, stats.StateKeyCount, uint64(3))
+	testutil.AssertEquals(t, stats.StateSize, uint64(30))
+	testutil.AssertEquals(t, stats.Chaincodes, map[string]*ChaincodeStateStats{
+		"chaincode1": {KeyCount: 2, Size: 20},
+		"chaincode3": {KeyCount: 1, Size: 10},
+	})
+
+	// the transaction count is counted in the blocks if it was not persisted
+	testutil.AssertNoError(t, db.GetDBHandle().Delete(db.GetDBHandle().BlockchainCF, txCountKey), "Error while deleting the transaction count")
+	blockchain, err := newBlockchain(db.GetDBHandle())
+	testutil.AssertNoError(t, err, "Error while loading the blockchain")
+	defer blockchain.indexer.stop()
+	testutil.AssertEquals(t, blockchain.txCount, uint64(3))
+}
+
 func TestGetTransactionByUUID(t *testing.T) {
 	ledgerTestWrapper := createFreshDBAndTestLedgerWrapper(t)
 	ledger := ledgerTestWrapper.ledger
@@ -830,6 +1116,98 @@ func TestRangeScanIterator(t *testing.T) {
 	itr.Close()
 }
 
+func TestFilteredRangeScanIterator(t *testing.T) {
+	ledgerTestWrapper := createFreshDBAndTestLedgerWrapper(t)
+	ledger := ledgerTestWrapper.ledger
+
+	ledger.BeginTxBatch(0)
+	ledger.TxBegin("txUuid1")
+	ledger.SetState("chaincodeID1", "account1", []byte("value1"))
+	ledger.SetState("chaincodeID1", "account2", []byte("value2"))
+	ledger.SetState("chaincodeID1", "asset1", []byte("a large value"))
+	ledger.SetState("chaincodeID1", "asset2", []byte("value4"))
+	ledger.TxFinished("txUuid1", true)
+	transaction, _ := buildTestTx(t)
+	ledger.CommitTxBatch(0, []*protos.Transaction{transaction}, nil, nil)
+
+	ledger.BeginTxBatch(1)
+	ledger.TxBegin("txUuid2")
+	ledger.SetState("chaincodeID1", "account2", []byte("value5"))
+	ledger.SetState("chaincodeID1", "asset2", []byte("value6"))
+	ledger.TxFinished("txUuid2", true)
+	transaction, _ = buildTestTx(t)
+	ledger.CommitTxBatch(1, []*protos.Transaction{transaction}, nil, nil)
+
+	itr, err := ledger.GetStateFilteredRangeScanIterator("chaincodeID1", "", "", &state.RangeScanFilter{KeyPrefix: "asset", MaxValueSize: 6})
+	testutil.AssertNoError(t, err, "Error getting filtered range scan iterator")
+	statemgmt.AssertIteratorContains(t, itr, map[string][]byte{"asset2": []byte("value6")})
+	itr.Close()
+
+	itr, err = ledger.GetStateFilteredRangeScanIterator("chaincodeID1", "", "", &state.RangeScanFilter{KeyPrefix: "account", ModifiedSinceBlock: 1})
+	testutil.AssertNoError(t, err, "Error getting filtered range scan iterator")
+	statemgmt.AssertIteratorContains(t, itr, map[string][]byte{"account2": []byte("value5")})
+	itr.Close()
+
+	_, err = ledger.GetStateFilteredRangeScanIterator("chaincodeID1", "", "", &state.RangeScanFilter{ModifiedSinceBlock: 3})
+	testutil.AssertError(t, err, "Expected a block not committed to fail")
+}
+
+func TestGetStateByPartialCompositeKey(t *testing.T) {
+	ledgerTestWrapper := createFreshDBAndTestLedgerWrapper(t)
+	ledger := ledgerTestWrapper.ledger
+	compositeKey := func(objectType string, attributes ...string) string {
+		key, err := CreateCompositeKey(objectType, attributes)
+		testutil.AssertNoError(t, err, "Error while creating composite key")
+		return key
+	}
+
+	ledger.BeginTxBatch(0)
+	ledger.TxBegin("txUuid1")
+	ledger.SetState("chaincodeID1", compositeKey("color~name", "blue", "marble1"), []byte("value1"))
+	ledger.SetState("chaincodeID1", compositeKey("color~name", "blue", "marble2"), []byte("value2"))
+	ledger.SetState("chaincodeID1", compositeKey("color~name", "blueish", "marble3"), []byte("value3"))
+	ledger.SetState("chaincodeID1", compositeKey("color~name", "red", "marble4"), []byte("value4"))
+	ledger.SetState("chaincodeID1", compositeKey("color", "blue"), []byte("value5"))
+	ledger.SetState("chaincodeID1", "blue", []byte("value6"))
+	ledger.SetState("chaincodeID2", compositeKey("color~name", "blue", "marble1"), []byte("value7"))
+	ledger.TxFinished("txUuid1", true)
+	tx, _ := buildTestTx(t)
+	ledger.CommitTxBatch(0, []*protos.Transaction{tx}, nil, []byte("proof"))
+
+	itr, err := ledger.GetStateByPartialCompositeKey("chaincodeID1", "color~name", []string{"blue"}, true)
+	testutil.AssertNoError(t, err, "Error while getting iterator")
+	statemgmt.AssertIteratorContains(t, itr,
+		map[string][]byte{
+			compositeKey("color~name", "blue", "marble1"): []byte("value1"),
+			compositeKey("color~name", "blue", "marble2"): []byte("value2"),
+		})
+	itr.Close()
+
+	ledger.BeginTxBatch(1)
+	ledger.TxBegin("txUuid2")
+	ledger.DeleteState("chaincodeID1", compositeKey("color~name", "blue", "marble1"))
+	ledger.SetState("chaincodeID1", compositeKey("color~name", "blue", "marble5"), []byte("value8"))
+	ledger.TxFinished("txUuid2", true)
+	itr, _ = ledger.GetStateByPartialCompositeKey("chaincodeID1", "color~name", nil, false)
+	statemgmt.AssertIteratorContains(t, itr,
+		map[string][]byte{
+			compositeKey("color~name", "blue", "marble2"):    []byte("value2"),
+			compositeKey("color~name", "blue", "marble5"):    []byte("value8"),
+			compositeKey("color~name", "blueish", "marble3"): []byte("value3"),
+			compositeKey("color~name", "red", "marble4"):     []byte("value4"),
+		})
+	itr.Close()
+
+	objectType, attributes, err := SplitCompositeKey(compositeKey("color~name", "blue", "marble1"))
+	testutil.AssertNoError(t, err, "Error while splitting composite key")
+	testutil.AssertEquals(t, objectType, "color~name")
+	testutil.AssertEquals(t, attributes, []string{"blue", "marble1"})
+	_, _, err = SplitCompositeKey("blue")
+	testutil.AssertError(t, err, "Expected an error for a key which is not a composite key")
+	_, err = ledger.GetStateByPartialCompositeKey("chaincodeID1", "color~name", []string{"blue\x00"}, true)
+	testutil.AssertError(t, err, "Expected an error for an attribute with a zero byte")
+}
+
 func TestGetSetMultipleKeys(t *testing.T) {
 	ledgerTestWrapper := createFreshDBAndTestLedgerWrapper(t)
 	l := ledgerTestWrapper.ledger
@@ -866,6 +1244,40 @@ func TestCopyState(t *testing.T) {
 	testutil.AssertEquals(t, values, [][]byte{[]byte("value1"), []byte("value2"), []byte("value3")})
 }
 
+func TestLedgerGetStateAtLevel(t *testing.T) {
+	ledgerTestWrapper := createFreshDBAndTestLedgerWrapper(t)
+	l := ledgerTestWrapper.ledger
+	l.BeginTxBatch(1)
+	l.TxBegin("txUUID1")
+	l.SetState("chaincodeID1", "key1", []byte("value1"))
+	l.TxFinished("txUUID1", true)
+	tx, _ := buildTestTx(t)
+	l.CommitTxBatch(1, []*protos.Transaction{tx}, nil, nil)
+
+	l.BeginTxBatch(2)
+	l.TxBegin("txUUID2")
+	l.SetState("chaincodeID1", "key1", []byte("value1_tx2"))
+	l.SetState("chaincodeID1", "key2", []byte("value2_tx2"))
+	l.TxFinished("txUUID2", true)
+
+	value, _ := l.GetStateAtLevel("chaincodeID1", "key1", state.QueryCommitted)
+	testutil.AssertEquals(t, value, []byte("value1"))
+	value, _ = l.GetStateAtLevel("chaincodeID1", "key1", state.QueryTentative)
+	testutil.AssertEquals(t, value, []byte("value1_tx2"))
+	itr, _ := l.GetStateRangeScanIteratorAtLevel("chaincodeID1", "", "", state.QueryTentative)
+	count := 0
+	for itr.Next() {
+		count++
+	}
+	itr.Close()
+	testutil.AssertEquals(t, count, 2)
+
+	// the tentative state goes away along with the batch
+	l.RollbackTxBatch(2)
+	value, _ = l.GetStateAtLevel("chaincodeID1", "key2", state.QueryTentative)
+	testutil.AssertNil(t, value)
+}
+
 func TestLedgerEmptyArrayValue(t *testing.T) {
 	ledgerTestWrapper := createFreshDBAndTestLedgerWrapper(t)
 	l := ledgerTestWrapper.ledger
@@ -916,3 +1328,53 @@ func TestLedgerInvalidInput(t *testing.T) {
 	value, _ := l.GetState("chaincodeID1", "key1", true)
 	testutil.AssertEquals(t, value, []byte("value1"))
 }
+
+func TestLedgerChains(t *testing.T) {
+	ledgerTestWrapper := createFreshDBAndTestLedgerWrapper(t)
+	defaultLedger := ledgerTestWrapper.ledger
+	chainLedger, err := GetNewChainLedger("chain1")
+	testutil.AssertNoError(t, err, "Error while constructing the ledger of a chain")
+	testutil.AssertEquals(t, defaultLedger.GetChainID(), db.DefaultChainID)
+	testutil.AssertEquals(t, chainLedger.GetChainID(), "chain1")
+
+	commit := func(l *Ledger, key string, value string) {
+		l.BeginTxBatch(1)
+		l.TxBegin("txUuid")
+		l.SetState("chaincode1", key, []byte(value))
+		l.TxFinished("txUuid", true)
+		tx, _ := buildTestTx(t)
+		testutil.AssertNoError(t, l.CommitTxBatch(1, []*protos.Transaction{tx}, nil, nil), "Error while committing")
+	}
+	commit(defaultLedger, "key1", "value1")
+	commit(chainLedger, "key2", "value2")
+	commit(chainLedger, "key3", "value3")
+
+	// the chains have blocks and a state of their own
+	testutil.AssertEquals(t, defaultLedger.GetBlockchainSize(), uint64(1))
+	testutil.AssertEquals(t, chainLedger.GetBlockchainSize(), uint64(2))
+	value, _ := chainLedger.GetState("chaincode1", "key1", true)
+	testutil.AssertNil(t, value)
+	value, _ = defaultLedger.GetState("chaincode1", "key2", true)
+	testutil.AssertNil(t, value)
+	value, _ = chainLedger.GetState("chaincode1", "key3", true)
+	testutil.AssertEquals(t, value, []byte("value3"))
+	defaultHash, _ := defaultLedger.GetTempStateHash()
+	chainHash, _ := chainLedger.GetTempStateHash()
+	testutil.AssertNotEquals(t, defaultHash, chainHash)
+
+	// the ledger of a chain is loaded back from its database
+	reloaded, err := GetNewChainLedger("chain1")
+	testutil.AssertNoError(t, err, "Error while reloading the ledger of a chain")
+	testutil.AssertEquals(t, reloaded.GetBlockchainSize(), uint64(2))
+	chainIDs, err := GetChainIDs()
+	testutil.AssertNoError(t, err, "Error while listing the chains")
+	testutil.AssertEquals(t, chainIDs, []string{"chain1"})
+
+	for _, chainID := range []string{"Chain1", "_chain", "chain/1", "../chain"} {
+		_, err = GetChainLedger(chainID)
+		ledgerErr, ok := err.(*Error)
+		if !(ok && ledgerErr.Type() == ErrorTypeInvalidArgument) {
+			t.Fatalf("A 'LedgerError' of type 'ErrorTypeInvalidArgument' should have been thrown for chain ID [%s]", chainID)
+		}
+	}
+}
@@ -0,0 +1,162 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ledger
+
+import (
+	"fmt"
+
+	"github.com/hyperledger/fabric/core/ledger/statemgmt"
+)
+
+// NamespaceAccess is the access a chaincode has to the state of a chaincode ID
+// namespace. A chaincode has full access to its own namespace, and no access to
+// the namespace of another chaincode unless that chaincode granted it
+type NamespaceAccess int
+
+const (
+	// NamespaceAccessNone does not allow to access the namespace
+	NamespaceAccessNone NamespaceAccess = iota
+	// NamespaceAccessRead allows to read the namespace
+	NamespaceAccessRead
+	// NamespaceAccessReadWrite allows to read and change the namespace
+	NamespaceAccessReadWrite
+)
+
+func (access NamespaceAccess) String() string {
+	switch access {
+	case NamespaceAccessRead:
+		return "read"
+	case NamespaceAccessReadWrite:
+		return "write"
+	}
+	return "no"
+}
+
+// namespaceGrantsChaincodeID is the namespace of the state keeping the access
+// granted by the chaincodes to their namespace. No chaincode can access it.
+// Being kept in the state, the grants are part of the state hash, and are
+// synced along with the rest of the state
+const namespaceGrantsChaincodeID = "__namespace_grants"
+
+// encodeNamespaceGrantKey encodes the key of the access granted to grantee to
+// namespace, the two being separated by a zero byte
+func encodeNamespaceGrantKey(namespace string, grantee string) string {
+	return namespace + "\x00" + grantee
+}
+
+func validateNamespace(chaincodeID string) error {
+	if chaincodeID == "" {
+		return newLedgerError(ErrorTypeInvalidArgument, "An empty chaincode ID is not supported")
+	}
+	if chaincodeID == namespaceGrantsChaincodeID || chaincodeID == invocationPoliciesChaincodeID || chaincodeID == chaincodeLimitsChaincodeID ||
+		chaincodeID == deployedChaincodesChaincodeID {
+		return newLedgerError(ErrorTypeAccessDenied, fmt.Sprintf("The namespace [%s] is reserved", chaincodeID))
+	}
+	return nil
+}
+
+// GrantNamespaceAccess grants grantee the access to the state of the chaincode namespace, on behalf of the
+// transaction txUUID, which the chaincode namespace runs. NamespaceAccessNone revokes the access granted before.
+// Grants are part of the state: they take effect for the transactions which follow, and go away if the
+// transaction fails
+func (ledger *Ledger) GrantNamespaceAccess(txUUID string, namespace string, grantee string, access NamespaceAccess) error {
+	if err := validateNamespace(namespace); err != nil {
+		return err
+	}
+	if err := validateNamespace(grantee); err != nil {
+		return err
+	}
+	if grantee == namespace {
+		return newLedgerError(ErrorTypeInvalidArgument, fmt.Sprintf("Chaincode [%s] cannot grant access to itself", namespace))
+	}
+	key := encodeNamespaceGrantKey(namespace, grantee)
+	if access == NamespaceAccessNone {
+		return ledger.state.DeleteForTx(txUUID, namespaceGrantsChaincodeID, key)
+	}
+	if access != NamespaceAccessRead && access != NamespaceAccessReadWrite {
+		return newLedgerError(ErrorTypeInvalidArgument, fmt.Sprintf("Unknown namespace access [%d]", access))
+	}
+	return ledger.state.SetForTx(txUUID, namespaceGrantsChaincodeID, key, []byte{byte(access)})
+}
+
+// GetNamespaceAccess returns the access grantee has to the state of the chaincode namespace, as seen by the
+// transaction txUUID. If committed is true, only the grants committed are read
+func (ledger *Ledger) GetNamespaceAccess(txUUID string, namespace string, grantee string, committed bool) (NamespaceAccess, error) {
+	if validateNamespace(namespace) != nil || validateNamespace(grantee) != nil {
+		return NamespaceAccessNone, nil
+	}
+	if grantee == namespace {
+		return NamespaceAccessReadWrite, nil
+	}
+	value, err := ledger.state.GetForTx(txUUID, namespaceGrantsChaincodeID, encodeNamespaceGrantKey(namespace, grantee), committed)
+	if err != nil || len(value) != 1 {
+		return NamespaceAccessNone, err
+	}
+	return NamespaceAccess(value[0]), nil
+}
+
+// checkNamespaceAccess returns an error unless caller has the access required to the state of namespace
+func (ledger *Ledger) checkNamespaceAccess(txUUID string, caller string, namespace string, required NamespaceAccess, committed bool) error {
+	if err := validateNamespace(namespace); err != nil {
+		return err
+	}
+	access, err := ledger.GetNamespaceAccess(txUUID, namespace, caller, committed)
+	if err != nil {
+		return err
+	}
+	if access < required {
+		return newLedgerError(ErrorTypeAccessDenied,
+			fmt.Sprintf("Chaincode [%s] has no %s access to the state of chaincode [%s]", caller, required, namespace))
+	}
+	return nil
+}
+
+// GetNamespaceState is GetTxState on behalf of the chaincode caller, which must have been granted the read access
+// to namespace unless it is its own
+func (ledger *Ledger) GetNamespaceState(txUUID string, caller string, namespace string, key string, committed bool) ([]byte, error) {
+	if err := ledger.checkNamespaceAccess(txUUID, caller, namespace, NamespaceAccessRead, committed); err != nil {
+		return nil, err
+	}
+	return ledger.state.GetForTx(txUUID, namespace, key, committed)
+}
+
+// GetNamespaceStateRangeScanIterator is GetTxStateRangeScanIterator on behalf of the chaincode caller, which must
+// have been granted the read access to namespace unless it is its own
+func (ledger *Ledger) GetNamespaceStateRangeScanIterator(txUUID string, caller string, namespace string, startKey string, endKey string, committed bool) (statemgmt.RangeScanIterator, error) {
+	if err := ledger.checkNamespaceAccess(txUUID, caller, namespace, NamespaceAccessRead, committed); err != nil {
+		return nil, err
+	}
+	return ledger.state.GetRangeScanIteratorForTx(txUUID, namespace, startKey, endKey, committed)
+}
+
+// SetNamespaceState is SetTxState on behalf of the chaincode caller, which must have been granted the write
+// access to namespace unless it is its own
+func (ledger *Ledger) SetNamespaceState(txUUID string, caller string, namespace string, key string, value []byte) error {
+	if err := ledger.checkNamespaceAccess(txUUID, caller, namespace, NamespaceAccessReadWrite, false); err != nil {
+		return err
+	}
+	return ledger.SetTxState(txUUID, namespace, key, value)
+}
+
+// DeleteNamespaceState is DeleteTxState on behalf of the chaincode caller, which must have been granted the write
+// access to namespace unless it is its own
+func (ledger *Ledger) DeleteNamespaceState(txUUID string, caller string, namespace string, key string) error {
+	if err := ledger.checkNamespaceAccess(txUUID, caller, namespace, NamespaceAccessReadWrite, false); err != nil {
+		return err
+	}
+	return ledger.state.DeleteForTx(txUUID, namespace, key)
+}
@@ -0,0 +1,84 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ledger
+
+import (
+	"testing"
+
+	"github.com/hyperledger/fabric/core/ledger/testutil"
+	"github.com/hyperledger/fabric/protos"
+)
+
+func assertAccessDenied(t *testing.T, err error) {
+	ledgerErr, ok := err.(*Error)
+	if !ok || ledgerErr.Type() != ErrorTypeAccessDenied {
+		t.Fatalf("Expected an access denied error, got %v", err)
+	}
+}
+
+func TestLedgerNamespaceAccess(t *testing.T) {
+	ledgerTestWrapper := createFreshDBAndTestLedgerWrapper(t)
+	testLedger := ledgerTestWrapper.ledger
+
+	testLedger.BeginTxBatch(1)
+	transaction, uuid := buildTestTx(t)
+	testLedger.TxBegin(uuid)
+	testutil.AssertNoError(t, testLedger.SetNamespaceState(uuid, "chaincode1", "chaincode1", "key1", []byte("value1")), "Error while setting own state")
+	value, err := testLedger.GetNamespaceState(uuid, "chaincode1", "chaincode1", "key1", false)
+	testutil.AssertNoError(t, err, "Error while getting own state")
+	testutil.AssertEquals(t, value, []byte("value1"))
+
+	// no access to the state of another chaincode without a grant
+	_, err = testLedger.GetNamespaceState(uuid, "chaincode2", "chaincode1", "key1", false)
+	assertAccessDenied(t, err)
+	assertAccessDenied(t, testLedger.SetNamespaceState(uuid, "chaincode2", "chaincode1", "key1", []byte("value2")))
+	assertAccessDenied(t, testLedger.DeleteNamespaceState(uuid, "chaincode2", "chaincode1", "key1"))
+	_, err = testLedger.GetNamespaceStateRangeScanIterator(uuid, "chaincode2", "chaincode1", "", "", false)
+	assertAccessDenied(t, err)
+
+	// a read grant lets read, but not write
+	testutil.AssertNoError(t, testLedger.GrantNamespaceAccess(uuid, "chaincode1", "chaincode2", NamespaceAccessRead), "Error while granting access")
+	value, err = testLedger.GetNamespaceState(uuid, "chaincode2", "chaincode1", "key1", false)
+	testutil.AssertNoError(t, err, "Error while getting granted state")
+	testutil.AssertEquals(t, value, []byte("value1"))
+	assertAccessDenied(t, testLedger.SetNamespaceState(uuid, "chaincode2", "chaincode1", "key1", []byte("value2")))
+	testLedger.TxFinished(uuid, true)
+	testutil.AssertNoError(t, testLedger.CommitTxBatch(1, []*protos.Transaction{transaction}, nil, nil), "Error while committing")
+
+	access, _ := testLedger.GetNamespaceAccess("", "chaincode1", "chaincode2", true)
+	testutil.AssertEquals(t, access, NamespaceAccessRead)
+	access, _ = testLedger.GetNamespaceAccess("", "chaincode2", "chaincode1", true)
+	testutil.AssertEquals(t, access, NamespaceAccessNone)
+
+	// a write grant lets write, a revoked grant no longer lets read
+	testLedger.BeginTxBatch(2)
+	transaction, uuid = buildTestTx(t)
+	testLedger.TxBegin(uuid)
+	testutil.AssertNoError(t, testLedger.GrantNamespaceAccess(uuid, "chaincode1", "chaincode2", NamespaceAccessReadWrite), "Error while granting access")
+	testutil.AssertNoError(t, testLedger.SetNamespaceState(uuid, "chaincode2", "chaincode1", "key1", []byte("value2")), "Error while setting granted state")
+	testutil.AssertNoError(t, testLedger.GrantNamespaceAccess(uuid, "chaincode1", "chaincode2", NamespaceAccessNone), "Error while revoking access")
+	_, err = testLedger.GetNamespaceState(uuid, "chaincode2", "chaincode1", "key1", false)
+	assertAccessDenied(t, err)
+	testLedger.TxFinished(uuid, true)
+	testutil.AssertNoError(t, testLedger.CommitTxBatch(2, []*protos.Transaction{transaction}, nil, nil), "Error while committing")
+	testutil.AssertEquals(t, ledgerTestWrapper.GetState("chaincode1", "key1", true), []byte("value2"))
+
+	// the grants are out of the reach of the chaincodes
+	_, err = testLedger.GetNamespaceState("", "chaincode1", namespaceGrantsChaincodeID, encodeNamespaceGrantKey("chaincode1", "chaincode2"), true)
+	assertAccessDenied(t, err)
+	testutil.AssertError(t, testLedger.GrantNamespaceAccess("", "chaincode1", "chaincode1", NamespaceAccessRead), "Expected an error granting access to itself")
+}
@@ -0,0 +1,208 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ledger
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/hyperledger/fabric/core/db"
+	"github.com/hyperledger/fabric/core/util"
+)
+
+// privateData keeps the private data of the chaincodes, values in named
+// collections of keys which are kept in the privateDataCF rather than in the
+// state, so that they are neither part of the state hash nor of the state
+// synced or exported to other peers.  Instead, each block records the hash of
+// the private data written by its transactions, against which a peer holding
+// the data checks it.
+//
+// The private data written by a transaction is kept aside until the
+// transaction finishes, then with the changes of the ongoing batch until the
+// batch is committed or rolled back, as the state changes are.
+type privateData struct {
+	openchainDB *db.OpenchainDB
+	lock        sync.RWMutex
+	txUpdates   map[string]privateDataUpdates // by the UUID of the transactions not finished yet
+	batch       privateDataUpdates            // of the block being built
+	staged      privateDataUpdates            // of the staged blocks of the batch
+}
+
+// privateDataUpdates maps the keys encoded by encodePrivateDataKey to their
+// new value, nil if deleted
+type privateDataUpdates map[string][]byte
+
+func newPrivateData(openchainDB *db.OpenchainDB) *privateData {
+	return &privateData{
+		openchainDB: openchainDB,
+		txUpdates:   make(map[string]privateDataUpdates),
+		batch:       make(privateDataUpdates),
+		staged:      make(privateDataUpdates),
+	}
+}
+
+// encodePrivateDataKey encodes a key of a collection of a chaincode, the
+// chaincode ID and the collection name being separated by a zero byte
+func encodePrivateDataKey(chaincodeID string, collection string, key string) string {
+	return strings.Join([]string{chaincodeID, collection, key}, "\x00")
+}
+
+func (pd *privateData) get(txUUID string, chaincodeID string, collection string, key string, committed bool) ([]byte, error) {
+	encodedKey := encodePrivateDataKey(chaincodeID, collection, key)
+	if !committed {
+		pd.lock.RLock()
+		for _, updates := range []privateDataUpdates{pd.txUpdates[txUUID], pd.batch, pd.staged} {
+			if value, ok := updates[encodedKey]; ok {
+				pd.lock.RUnlock()
+				return value, nil
+			}
+		}
+		pd.lock.RUnlock()
+	}
+	return pd.openchainDB.GetFromPrivateDataCF([]byte(encodedKey))
+}
+
+func (pd *privateData) set(txUUID string, chaincodeID string, collection string, key string, value []byte) {
+	pd.lock.Lock()
+	defer pd.lock.Unlock()
+	updates, ok := pd.txUpdates[txUUID]
+	if !ok {
+		updates = make(privateDataUpdates)
+		pd.txUpdates[txUUID] = updates
+	}
+	updates[encodePrivateDataKey(chaincodeID, collection, key)] = value
+}
+
+// txFinished adds the private data written by the transaction to the batch
+// if it succeeded, discards it otherwise
+func (pd *privateData) txFinished(txUUID string, txSuccessful bool) {
+	pd.lock.Lock()
+	defer pd.lock.Unlock()
+	if txSuccessful {
+		for key, value := range pd.txUpdates[txUUID] {
+			pd.batch[key] = value
+		}
+	}
+	delete(pd.txUpdates, txUUID)
+}
+
+// hash returns the hash of the private data written by the transactions of
+// the block being built, nil if none was
+func (pd *privateData) hash() []byte {
+	pd.lock.RLock()
+	defer pd.lock.RUnlock()
+	if len(pd.batch) == 0 {
+		return nil
+	}
+	keys := make([]string, 0, len(pd.batch))
+	for key := range pd.batch {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	buffer := proto.NewBuffer(nil)
+	for _, key := range keys {
+		value := pd.batch[key]
+		buffer.EncodeStringBytes(key)
+		if value == nil {
+			buffer.EncodeVarint(0)
+		} else {
+			buffer.EncodeVarint(1)
+			buffer.EncodeRawBytes(value)
+		}
+	}
+	return util.ComputeCryptoHash(buffer.Bytes())
+}
+
+// stageBlock keeps the private data of the block being built along with the
+// staged blocks
+func (pd *privateData) stageBlock() {
+	pd.lock.Lock()
+	defer pd.lock.Unlock()
+	for key, value := range pd.batch {
+		pd.staged[key] = value
+	}
+	pd.batch = make(privateDataUpdates)
+}
+
+// addChangesForPersistence adds the private data of the batch to writeBatch
+func (pd *privateData) addChangesForPersistence(writeBatch db.WriteBatch) {
+	pd.lock.RLock()
+	defer pd.lock.RUnlock()
+	for _, updates := range []privateDataUpdates{pd.staged, pd.batch} {
+		for key, value := range updates {
+			if value == nil {
+				writeBatch.DeleteCF(pd.openchainDB.PrivateDataCF, []byte(key))
+			} else {
+				writeBatch.PutCF(pd.openchainDB.PrivateDataCF, []byte(key), value)
+			}
+		}
+	}
+}
+
+// clear discards the private data of the batch, once committed or rolled back
+func (pd *privateData) clear() {
+	pd.lock.Lock()
+	defer pd.lock.Unlock()
+	pd.txUpdates = make(map[string]privateDataUpdates)
+	pd.batch = make(privateDataUpdates)
+	pd.staged = make(privateDataUpdates)
+}
+
+func validatePrivateDataKey(collection string, key string) error {
+	if collection == "" || key == "" {
+		return newLedgerError(ErrorTypeInvalidArgument,
+			fmt.Sprintf("An empty collection name or key is not supported. Method invoked with collection='%s', key='%s'", collection, key))
+	}
+	if strings.Contains(collection, "\x00") {
+		return newLedgerError(ErrorTypeInvalidArgument, "A collection name may not contain a zero byte")
+	}
+	return nil
+}
+
+// GetPrivateData returns the private data of chaincodeID for key in collection as seen by the transaction
+// txUUID. If committed is true, only the private data committed is read. The private data of the chaincodes is
+// kept out of the state: it is not part of the state hash, and is neither synced nor exported to other peers
+func (ledger *Ledger) GetPrivateData(txUUID string, chaincodeID string, collection string, key string, committed bool) ([]byte, error) {
+	return ledger.privateData.get(txUUID, chaincodeID, collection, key, committed)
+}
+
+// SetPrivateData sets the private data of chaincodeID for key in collection to value, on behalf of the
+// transaction txUUID. The block the transaction is committed in records the hash of the private data written
+func (ledger *Ledger) SetPrivateData(txUUID string, chaincodeID string, collection string, key string, value []byte) error {
+	if err := validatePrivateDataKey(collection, key); err != nil {
+		return err
+	}
+	if value == nil {
+		return newLedgerError(ErrorTypeInvalidArgument,
+			fmt.Sprintf("A nil value is not supported. Method invoked with collection='%s', key='%s'", collection, key))
+	}
+	ledger.privateData.set(txUUID, chaincodeID, collection, key, value)
+	return nil
+}
+
+// DeletePrivateData deletes the private data of chaincodeID for key in collection, on behalf of the
+// transaction txUUID
+func (ledger *Ledger) DeletePrivateData(txUUID string, chaincodeID string, collection string, key string) error {
+	if err := validatePrivateDataKey(collection, key); err != nil {
+		return err
+	}
+	ledger.privateData.set(txUUID, chaincodeID, collection, key, nil)
+	return nil
+}
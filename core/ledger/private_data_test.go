@@ -0,0 +1,98 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ledger
+
+import (
+	"testing"
+
+	"github.com/hyperledger/fabric/core/ledger/testutil"
+	"github.com/hyperledger/fabric/protos"
+)
+
+func TestLedgerPrivateData(t *testing.T) {
+	ledgerTestWrapper := createFreshDBAndTestLedgerWrapper(t)
+	ledger := ledgerTestWrapper.ledger
+	getPrivateData := func(txUUID string, collection string, key string, committed bool) []byte {
+		value, err := ledger.GetPrivateData(txUUID, "chaincode1", collection, key, committed)
+		testutil.AssertNoError(t, err, "Error while getting private data")
+		return value
+	}
+
+	ledger.BeginTxBatch(1)
+	transaction, uuid := buildTestTx(t)
+	ledger.TxBegin(uuid)
+	ledger.SetState("chaincode1", "key1", []byte("value1"))
+	testutil.AssertNoError(t, ledger.SetPrivateData(uuid, "chaincode1", "collection1", "key1", []byte("private1")), "Error while setting private data")
+	testutil.AssertNoError(t, ledger.SetPrivateData(uuid, "chaincode1", "collection2", "key1", []byte("private2")), "Error while setting private data")
+	testutil.AssertEquals(t, getPrivateData(uuid, "collection1", "key1", false), []byte("private1"))
+	testutil.AssertNil(t, getPrivateData(uuid, "collection1", "key1", true))
+	ledger.TxFinished(uuid, true)
+	stateHash := ledgerTestWrapper.GetTempStateHash()
+
+	// the private data written by a failed transaction is discarded
+	_, failedUUID := buildTestTx(t)
+	ledger.TxBegin(failedUUID)
+	testutil.AssertNoError(t, ledger.SetPrivateData(failedUUID, "chaincode1", "collection1", "key2", []byte("private3")), "Error while setting private data")
+	ledger.TxFinished(failedUUID, false)
+
+	preview, err := ledger.GetTXBatchPreviewBlockInfo(1, []*protos.Transaction{transaction}, nil)
+	testutil.AssertNoError(t, err, "Error while previewing the block")
+	testutil.AssertNoError(t, ledger.CommitTxBatch(1, []*protos.Transaction{transaction}, nil, nil), "Error while committing")
+	info, _ := ledger.GetBlockchainInfo()
+	testutil.AssertEquals(t, info, preview)
+
+	// the private data is out of the state hash, the block records its hash
+	block := ledgerTestWrapper.GetBlockByNumber(0)
+	testutil.AssertEquals(t, block.StateHash, stateHash)
+	testutil.AssertNotNil(t, block.PrivateDataHash)
+	testutil.AssertEquals(t, getPrivateData("", "collection1", "key1", true), []byte("private1"))
+	testutil.AssertEquals(t, getPrivateData("", "collection2", "key1", true), []byte("private2"))
+	testutil.AssertNil(t, getPrivateData("", "collection1", "key2", true))
+	testutil.AssertNil(t, ledgerTestWrapper.GetState("chaincode1", "collection1", true))
+
+	// a block without private data records no hash
+	ledger.BeginTxBatch(2)
+	transaction, uuid = buildTestTx(t)
+	ledger.TxBegin(uuid)
+	ledger.SetState("chaincode1", "key1", []byte("value2"))
+	ledger.TxFinished(uuid, true)
+	testutil.AssertNoError(t, ledger.CommitTxBatch(2, []*protos.Transaction{transaction}, nil, nil), "Error while committing")
+	testutil.AssertNil(t, ledgerTestWrapper.GetBlockByNumber(1).PrivateDataHash)
+
+	// the private data deleted is committed, that of a batch rolled back is discarded
+	ledger.BeginTxBatch(3)
+	transaction, uuid = buildTestTx(t)
+	ledger.TxBegin(uuid)
+	testutil.AssertNoError(t, ledger.DeletePrivateData(uuid, "chaincode1", "collection1", "key1"), "Error while deleting private data")
+	testutil.AssertNoError(t, ledger.SetPrivateData(uuid, "chaincode1", "collection2", "key1", []byte("private4")), "Error while setting private data")
+	ledger.TxFinished(uuid, true)
+	testutil.AssertNoError(t, ledger.RollbackTxBatch(3), "Error while rolling back")
+	testutil.AssertEquals(t, getPrivateData("", "collection1", "key1", false), []byte("private1"))
+
+	ledger.BeginTxBatch(4)
+	ledger.TxBegin(uuid)
+	testutil.AssertNoError(t, ledger.DeletePrivateData(uuid, "chaincode1", "collection1", "key1"), "Error while deleting private data")
+	ledger.TxFinished(uuid, true)
+	testutil.AssertNoError(t, ledger.CommitTxBatch(4, []*protos.Transaction{transaction}, nil, nil), "Error while committing")
+	testutil.AssertNil(t, getPrivateData("", "collection1", "key1", true))
+	testutil.AssertEquals(t, getPrivateData("", "collection2", "key1", true), []byte("private2"))
+	testutil.AssertNotNil(t, ledgerTestWrapper.GetBlockByNumber(2).PrivateDataHash)
+	testutil.AssertEquals(t, ledgerTestWrapper.VerifyChain(2, 0), uint64(0))
+
+	testutil.AssertError(t, ledger.SetPrivateData(uuid, "chaincode1", "", "key1", []byte("value")), "Expected an empty collection name to be rejected")
+	testutil.AssertError(t, ledger.SetPrivateData(uuid, "chaincode1", "collection1", "key1", nil), "Expected a nil value to be rejected")
+}
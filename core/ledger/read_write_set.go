@@ -0,0 +1,97 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ledger
+
+import (
+	"sort"
+
+	"github.com/hyperledger/fabric/core/ledger/statemgmt/state"
+	"github.com/hyperledger/fabric/protos"
+)
+
+// GetTransactionReadWriteSet returns the keys the transaction with txUUID read and wrote, with their versions, as
+// recorded by its receipt. ErrResourceNotFound is returned if there is no receipt, nil if the transaction failed
+func (ledger *Ledger) GetTransactionReadWriteSet(txUUID string) (*protos.TxReadWriteSet, error) {
+	receipt, err := ledger.GetTransactionReceipt(txUUID)
+	if err != nil {
+		return nil, err
+	}
+	return receipt.ReadWriteSet, nil
+}
+
+// addReadWriteSets records in the results of the transactions of the batch the read-write sets of those which
+// finished successfully
+func (ledger *Ledger) addReadWriteSets(transactionResults []*protos.TransactionResult) {
+	for _, txResult := range transactionResults {
+		if txResult == nil || txResult.ReadWriteSet != nil {
+			continue
+		}
+		if rwset := ledger.state.GetFinishedTxReadWriteSet(txResult.Uuid); rwset != nil {
+			txResult.ReadWriteSet = buildTxReadWriteSet(rwset)
+		}
+	}
+}
+
+// buildTxReadWriteSet returns the read-write set recorded by the state, sorted so that it marshals the same on
+// every peer
+func buildTxReadWriteSet(rwset *state.TxReadWriteSet) *protos.TxReadWriteSet {
+	chaincodeIDs := make(map[string]bool)
+	for chaincodeID := range rwset.ReadVersions {
+		chaincodeIDs[chaincodeID] = true
+	}
+	for chaincodeID := range rwset.Ranges {
+		chaincodeIDs[chaincodeID] = true
+	}
+	for chaincodeID := range rwset.WriteVersions {
+		chaincodeIDs[chaincodeID] = true
+	}
+	txRWSet := &protos.TxReadWriteSet{}
+	for _, chaincodeID := range sortedKeys(chaincodeIDs) {
+		ccRWSet := &protos.ChaincodeReadWriteSet{
+			ChaincodeID: chaincodeID,
+			Reads:       buildKeyVersions(rwset.ReadVersions[chaincodeID]),
+			Writes:      buildKeyVersions(rwset.WriteVersions[chaincodeID]),
+		}
+		for _, r := range rwset.Ranges[chaincodeID] {
+			ccRWSet.RangeReads = append(ccRWSet.RangeReads, &protos.KeyRange{StartKey: r.StartKey, EndKey: r.EndKey})
+		}
+		txRWSet.Chaincodes = append(txRWSet.Chaincodes, ccRWSet)
+	}
+	return txRWSet
+}
+
+func buildKeyVersions(versions map[string][]byte) []*protos.KeyVersion {
+	var keyVersions []*protos.KeyVersion
+	keys := make([]string, 0, len(versions))
+	for key := range versions {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		keyVersions = append(keyVersions, &protos.KeyVersion{Key: key, Version: versions[key]})
+	}
+	return keyVersions
+}
+
+func sortedKeys(set map[string]bool) []string {
+	keys := make([]string, 0, len(set))
+	for key := range set {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,80 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ledger
+
+import (
+	"testing"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/hyperledger/fabric/core/ledger/testutil"
+	"github.com/hyperledger/fabric/core/util"
+	"github.com/hyperledger/fabric/protos"
+)
+
+func TestLedgerTransactionReadWriteSet(t *testing.T) {
+	ledgerTestWrapper := createFreshDBAndTestLedgerWrapper(t)
+	ledger := ledgerTestWrapper.ledger
+
+	ledger.BeginTxBatch(0)
+	transaction1, uuid1 := buildTestTx(t)
+	ledger.TxBegin(uuid1)
+	ledger.SetTxState(uuid1, "chaincode1", "key1", []byte("value1"))
+	ledger.TxFinished(uuid1, true)
+	transaction2, uuid2 := buildTestTx(t)
+	ledger.TxBegin(uuid2)
+	ledger.GetTxState(uuid2, "chaincode1", "key1", false)
+	ledger.SetTxState(uuid2, "chaincode2", "key2", []byte("value2"))
+	ledger.DeleteTxState(uuid2, "chaincode1", "key1")
+	ledger.TxFinished(uuid2, true)
+	_, uuid3 := buildTestTx(t)
+	ledger.TxBegin(uuid3)
+	ledger.GetTxState(uuid3, "chaincode1", "key1", false)
+	ledger.TxFinished(uuid3, false)
+	txResults := []*protos.TransactionResult{{Uuid: uuid1}, {Uuid: uuid2}, {Uuid: uuid3, ErrorCode: 1}}
+	err := ledger.CommitTxBatch(0, []*protos.Transaction{transaction1, transaction2}, txResults, nil)
+	testutil.AssertNoError(t, err, "Error while committing")
+
+	rwset, err := ledger.GetTransactionReadWriteSet(uuid2)
+	testutil.AssertNoError(t, err, "Error while getting read-write set")
+	expected := &protos.TxReadWriteSet{Chaincodes: []*protos.ChaincodeReadWriteSet{
+		{
+			ChaincodeID: "chaincode1",
+			Reads:       []*protos.KeyVersion{{Key: "key1", Version: util.ComputeCryptoHash([]byte("value1"))}},
+			Writes:      []*protos.KeyVersion{{Key: "key1"}},
+		},
+		{
+			ChaincodeID: "chaincode2",
+			Writes:      []*protos.KeyVersion{{Key: "key2", Version: util.ComputeCryptoHash([]byte("value2"))}},
+		},
+	}}
+	testutil.AssertEquals(t, proto.Equal(rwset, expected), true)
+
+	// the read-write sets are kept with the results of the transactions in the block
+	block := ledgerTestWrapper.GetBlockByNumber(0)
+	testutil.AssertEquals(t, proto.Equal(block.NonHashData.TransactionResults[1].ReadWriteSet, expected), true)
+	rwset, err = ledger.GetTransactionReadWriteSet(uuid1)
+	testutil.AssertNoError(t, err, "Error while getting read-write set")
+	testutil.AssertEquals(t, len(rwset.Chaincodes), 1)
+	testutil.AssertEquals(t, len(rwset.Chaincodes[0].Reads), 0)
+
+	// failed transactions have none
+	rwset, err = ledger.GetTransactionReadWriteSet(uuid3)
+	testutil.AssertNoError(t, err, "Error while getting read-write set")
+	testutil.AssertNil(t, rwset)
+	_, err = ledger.GetTransactionReadWriteSet("unknown")
+	testutil.AssertEquals(t, err, ErrResourceNotFound)
+}
@@ -0,0 +1,81 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ledger
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+
+	"github.com/hyperledger/fabric/protos"
+)
+
+// TxBatchExecutor executes transactions on a ledger, in the transaction batch begun by the caller, marking the
+// begin and the finish of each of them, and returns their results
+type TxBatchExecutor func(ledger *Ledger, transactions []*protos.Transaction) ([]*protos.TransactionResult, error)
+
+// ReplayChain replays the transactions of the blocks from the genesis block to block to on scratch, an empty
+// ledger such as that of a chain created for the replay, executing them with execute and committing them block
+// by block. The state hash of each block replayed is compared with the one committed, the replay stopping at the
+// first block whose state hash differs, where the ledger diverged from the transactions it committed. Pruned
+// blocks cannot be replayed unless they were archived.
+// An error is only returned if a ledger could not be read or written, or if the transactions of a block could
+// not be executed as a whole.
+func (ledger *Ledger) ReplayChain(scratch *Ledger, to uint64, execute TxBatchExecutor) (*protos.ChainReplay, error) {
+	if to >= ledger.GetBlockchainSize() {
+		return nil, ErrOutOfBounds
+	}
+	if size := scratch.GetBlockchainSize(); size != 0 {
+		return nil, fmt.Errorf("The ledger to replay the blockchain on must be empty, it has %d blocks", size)
+	}
+	replay := &protos.ChainReplay{To: to}
+	err := ledger.GetBlocksByRange(0, to, func(blockNumber uint64, block *protos.Block) error {
+		if block.IsPruned() {
+			return fmt.Errorf("The transactions of block %d were pruned, it cannot be replayed", blockNumber)
+		}
+		if err := scratch.BeginTxBatch(blockNumber); err != nil {
+			return err
+		}
+		txResults, err := execute(scratch, block.Transactions)
+		if err != nil {
+			scratch.RollbackTxBatch(blockNumber)
+			return fmt.Errorf("Error executing the transactions of block %d: %s", blockNumber, err)
+		}
+		stateHash, err := scratch.GetTempStateHash()
+		if err != nil {
+			scratch.RollbackTxBatch(blockNumber)
+			return err
+		}
+		if !bytes.Equal(stateHash, block.StateHash) {
+			scratch.RollbackTxBatch(blockNumber)
+			ledgerLogger.Warningf("The state hash of block %d is not the hash of the state its transactions replayed to", blockNumber)
+			replay.Diverged = true
+			replay.DivergentBlock = blockNumber
+			replay.ExpectedHash = block.StateHash
+			replay.ActualHash = stateHash
+			return errReplayDiverged
+		}
+		return scratch.commitTxBatch(blockNumber, block.Transactions, txResults, block.ConsensusMetadata, block.GenesisSpec)
+	})
+	if err != nil && err != errReplayDiverged {
+		return nil, err
+	}
+	return replay, nil
+}
+
+// errReplayDiverged stops the replay of the blocks at the first divergence
+var errReplayDiverged = errors.New("The replay diverged")
@@ -0,0 +1,87 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ledger
+
+import (
+	"testing"
+
+	"github.com/hyperledger/fabric/core/ledger/testutil"
+	"github.com/hyperledger/fabric/protos"
+)
+
+func TestLedgerReplayChain(t *testing.T) {
+	ledgerTestWrapper := createFreshDBAndTestLedgerWrapper(t)
+	ledger := ledgerTestWrapper.ledger
+
+	// each transaction sets the key in its payload to its UUID
+	execute := func(ledger *Ledger, transactions []*protos.Transaction) ([]*protos.TransactionResult, error) {
+		var txResults []*protos.TransactionResult
+		for _, transaction := range transactions {
+			ledger.TxBegin(transaction.Uuid)
+			ledger.SetState("chaincode1", string(transaction.Payload), []byte(transaction.Uuid))
+			ledger.TxFinished(transaction.Uuid, true)
+			txResults = append(txResults, &protos.TransactionResult{Uuid: transaction.Uuid})
+		}
+		return txResults, nil
+	}
+	for i := 0; i < 4; i++ {
+		ledger.BeginTxBatch(i)
+		transaction, _ := buildTestTx(t)
+		transaction.Payload = []byte{byte('a' + i%2)}
+		txResults, err := execute(ledger, []*protos.Transaction{transaction})
+		testutil.AssertNoError(t, err, "Error while executing")
+		testutil.AssertNoError(t, ledger.CommitTxBatch(i, []*protos.Transaction{transaction}, txResults, nil), "Error while committing")
+	}
+
+	scratch, err := GetNewChainLedger("replay1")
+	testutil.AssertNoError(t, err, "Error while constructing ledger")
+	replay, err := ledger.ReplayChain(scratch, 3, execute)
+	testutil.AssertNoError(t, err, "Error while replaying")
+	testutil.AssertEquals(t, replay.Diverged, false)
+	testutil.AssertEquals(t, replay.To, uint64(3))
+	testutil.AssertEquals(t, scratch.GetBlockchainSize(), uint64(4))
+	stateHash, err := ledger.GetTempStateHash()
+	testutil.AssertNoError(t, err, "Error while getting state hash")
+	replayedStateHash, err := scratch.GetTempStateHash()
+	testutil.AssertNoError(t, err, "Error while getting state hash")
+	testutil.AssertEquals(t, replayedStateHash, stateHash)
+
+	// the ledger must be empty
+	_, err = ledger.ReplayChain(scratch, 3, execute)
+	testutil.AssertError(t, err, "Expected a replay on a ledger with blocks to fail")
+	_, err = ledger.ReplayChain(scratch, 4, execute)
+	testutil.AssertEquals(t, err, ErrOutOfBounds)
+
+	// a peer whose state diverged at block 2
+	diverging := func(ledger *Ledger, transactions []*protos.Transaction) ([]*protos.TransactionResult, error) {
+		if ledger.GetBlockchainSize() == 2 {
+			ledger.TxBegin("divergence")
+			ledger.SetState("chaincode1", "c", []byte("divergence"))
+			ledger.TxFinished("divergence", true)
+		}
+		return execute(ledger, transactions)
+	}
+	scratch, err = GetNewChainLedger("replay2")
+	testutil.AssertNoError(t, err, "Error while constructing ledger")
+	replay, err = ledger.ReplayChain(scratch, 3, diverging)
+	testutil.AssertNoError(t, err, "Error while replaying")
+	testutil.AssertEquals(t, replay.Diverged, true)
+	testutil.AssertEquals(t, replay.DivergentBlock, uint64(2))
+	testutil.AssertEquals(t, replay.ExpectedHash, ledgerTestWrapper.GetBlockByNumber(2).StateHash)
+	testutil.AssertNotEquals(t, replay.ActualHash, replay.ExpectedHash)
+	testutil.AssertEquals(t, scratch.GetBlockchainSize(), uint64(2))
+}
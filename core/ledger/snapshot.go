@@ -0,0 +1,411 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ledger
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"hash"
+	"io"
+
+	"github.com/hyperledger/fabric/core/db"
+	"github.com/hyperledger/fabric/core/ledger/statemgmt"
+	"github.com/hyperledger/fabric/protos"
+)
+
+// snapshotMagic starts a ledger snapshot, versioning its format.  The magic
+// is followed by the length-prefixed JSON of the SnapshotInfo, then by the
+// records, each a kind byte and a length-prefixed key and value, and ends
+// with an end record and the SHA-256 of everything before the hash.
+var snapshotMagic = []byte("fabric ledger snapshot 1\n")
+
+const (
+	snapshotRecordEnd byte = iota
+	snapshotRecordState
+	snapshotRecordStateDelta
+	snapshotRecordIndex
+	snapshotRecordBlockchain
+)
+
+// snapshotImportID identifies the state changes of an import to the ledger
+const snapshotImportID = "snapshot import"
+
+// snapshotBatchSize bounds the records imported in a single write
+const snapshotBatchSize = 1000
+
+// maxSnapshotFieldSize bounds the keys and values read from a snapshot, so
+// that a corrupt length does not exhaust the memory
+const maxSnapshotFieldSize = 1 << 30
+
+// SnapshotInfo describes the checkpoint a ledger snapshot was taken at
+type SnapshotInfo struct {
+	Height    uint64 `json:"height"`    // Size of the blockchain
+	BlockHash []byte `json:"blockHash"` // Hash of the last block
+	StateHash []byte `json:"stateHash"` // Hash of the state as of the last block
+}
+
+// ExportSnapshot writes a snapshot of the ledger to w, holding the blocks,
+// their indexes, the state deltas kept for state transfer and the state, as
+// of the last block committed.  The snapshot is read from a point-in-time
+// view of the database, so blocks may be committed meanwhile.
+func (ledger *Ledger) ExportSnapshot(w io.Writer) (*SnapshotInfo, error) {
+	dbSnapshot := ledger.openchainDB.GetSnapshot()
+	height, err := fetchBlockchainSizeFromSnapshot(ledger.openchainDB, dbSnapshot)
+	if err != nil {
+		dbSnapshot.Release()
+		return nil, err
+	}
+	if height == 0 {
+		dbSnapshot.Release()
+		return nil, fmt.Errorf("Blockchain has no blocks, there is nothing to export")
+	}
+	stateSnapshot, err := ledger.state.GetSnapshot(height-1, dbSnapshot)
+	if err != nil {
+		dbSnapshot.Release()
+		return nil, err
+	}
+	defer stateSnapshot.Release()
+
+	blockBytes, err := ledger.openchainDB.GetFromBlockchainCFSnapshot(dbSnapshot, encodeBlockNumberDBKey(height-1))
+	if err != nil {
+		return nil, err
+	}
+	block, err := protos.UnmarshallBlock(blockBytes)
+	if err != nil {
+		return nil, err
+	}
+	blockHash, err := committedBlockHash(block)
+	if err != nil {
+		return nil, err
+	}
+	info := &SnapshotInfo{Height: height, BlockHash: blockHash, StateHash: block.StateHash}
+
+	writer := newSnapshotWriter(w)
+	writer.writeHeader(info)
+	for stateSnapshot.Next() {
+		key, value := stateSnapshot.GetRawKeyValue()
+		writer.writeRecord(snapshotRecordState, key, value)
+	}
+	// The blocks go last, so that an import cut short leaves an empty
+	// blockchain behind
+	for _, cf := range []struct {
+		kind   byte
+		handle db.ColumnFamily
+	}{
+		{snapshotRecordStateDelta, ledger.openchainDB.StateDeltaCF},
+		{snapshotRecordIndex, ledger.openchainDB.IndexesCF},
+		{snapshotRecordBlockchain, ledger.openchainDB.BlockchainCF},
+	} {
+		itr := ledger.openchainDB.GetSnapshotIterator(dbSnapshot, cf.handle)
+		for itr.SeekToFirst(); itr.Valid() && writer.err == nil; itr.Next() {
+			writer.writeRecord(cf.kind, itr.Key(), itr.Value())
+		}
+		itr.Close()
+	}
+	if err := writer.finish(); err != nil {
+		return nil, err
+	}
+	ledgerLogger.Infof("Exported a snapshot of the ledger at height %d", height)
+	return info, nil
+}
+
+// ImportSnapshot bootstraps an empty ledger from a snapshot written by
+// ExportSnapshot.  The state is rebuilt by the state implementation of this
+// peer and must hash to the state hash of the last block, and the hash chain
+// must verify down to the genesis block, otherwise the imported data is
+// deleted again.
+func (ledger *Ledger) ImportSnapshot(r io.Reader) (*SnapshotInfo, error) {
+	if size := ledger.GetBlockchainSize(); size > 0 {
+		return nil, fmt.Errorf("The ledger has %d blocks, a snapshot can only be imported into an empty ledger", size)
+	}
+	reader := newSnapshotReader(r)
+	info, err := reader.readHeader()
+	if err != nil {
+		return nil, err
+	}
+	if err = ledger.importSnapshotRecords(reader); err == nil {
+		err = ledger.verifySnapshot(info)
+	}
+	if err != nil {
+		if deleteErr := ledger.deleteSnapshot(); deleteErr != nil {
+			ledgerLogger.Errorf("Error deleting the snapshot which failed to import, the database must be deleted: %s", deleteErr)
+		}
+		return nil, fmt.Errorf("Error importing snapshot: %s", err)
+	}
+	ledgerLogger.Infof("Imported a snapshot of the ledger at height %d", info.Height)
+	return info, nil
+}
+
+func (ledger *Ledger) importSnapshotRecords(reader *snapshotReader) error {
+	writeBatch := ledger.openchainDB.NewWriteBatch()
+	delta := statemgmt.NewStateDelta()
+	defer func() { writeBatch.Destroy() }()
+	flush := func() error {
+		if !delta.IsEmpty() {
+			if err := ledger.ApplyStateDelta(snapshotImportID, delta); err != nil {
+				return err
+			}
+			if err := ledger.CommitStateDelta(snapshotImportID); err != nil {
+				return err
+			}
+			delta = statemgmt.NewStateDelta()
+		}
+		if err := ledger.openchainDB.Write(writeBatch); err != nil {
+			return err
+		}
+		writeBatch.Destroy()
+		writeBatch = ledger.openchainDB.NewWriteBatch()
+		return nil
+	}
+
+	for pending := 0; ; pending++ {
+		if pending == snapshotBatchSize {
+			if err := flush(); err != nil {
+				return err
+			}
+			pending = 0
+		}
+		kind, key, value, err := reader.readRecord()
+		if err != nil {
+			return err
+		}
+		switch kind {
+		case snapshotRecordEnd:
+			if err := reader.verifyChecksum(); err != nil {
+				return err
+			}
+			return flush()
+		case snapshotRecordState:
+			if bytes.IndexByte(key, 0) < 0 {
+				return fmt.Errorf("Invalid state key %x", key)
+			}
+			chaincodeID, stateKey := statemgmt.DecodeCompositeKey(key)
+			delta.Set(chaincodeID, stateKey, value, nil)
+		case snapshotRecordStateDelta:
+			writeBatch.PutCF(ledger.openchainDB.StateDeltaCF, key, value)
+		case snapshotRecordIndex:
+			writeBatch.PutCF(ledger.openchainDB.IndexesCF, key, value)
+		case snapshotRecordBlockchain:
+			writeBatch.PutCF(ledger.openchainDB.BlockchainCF, key, value)
+		default:
+			return fmt.Errorf("Unknown snapshot record kind %d", kind)
+		}
+	}
+}
+
+// verifySnapshot loads the imported blockchain and checks it against the
+// imported state
+func (ledger *Ledger) verifySnapshot(info *SnapshotInfo) error {
+	blockchain, err := newBlockchain(ledger.openchainDB)
+	if err != nil {
+		return err
+	}
+	ledger.blockchain = blockchain
+	if size := ledger.GetBlockchainSize(); size != info.Height || size == 0 {
+		return fmt.Errorf("Snapshot of height %d holds %d blocks", info.Height, size)
+	}
+	block, err := ledger.GetBlockByNumber(info.Height - 1)
+	if err != nil {
+		return err
+	}
+	blockHash, err := committedBlockHash(block)
+	if err != nil {
+		return err
+	}
+	if !bytes.Equal(blockHash, info.BlockHash) {
+		return fmt.Errorf("Last block hashes to %x, the snapshot was taken at block hash %x", blockHash, info.BlockHash)
+	}
+	stateHash, err := ledger.state.GetHash()
+	if err != nil {
+		return err
+	}
+	if !bytes.Equal(stateHash, block.StateHash) || !bytes.Equal(stateHash, info.StateHash) {
+		return fmt.Errorf("State hashes to %x, the last block has state hash %x", stateHash, block.StateHash)
+	}
+	if low, err := ledger.VerifyChain(info.Height-1, 0); err != nil || low != 0 {
+		return fmt.Errorf("Hash chain is broken at block %d: %v", low, err)
+	}
+	return nil
+}
+
+// deleteSnapshot deletes what was imported of a snapshot, leaving the ledger
+// empty
+func (ledger *Ledger) deleteSnapshot() error {
+	ledger.resetForNextTxGroup(false)
+	if err := ledger.DeleteALLStateKeysAndValues(); err != nil {
+		return err
+	}
+	for _, cf := range []db.ColumnFamily{ledger.openchainDB.IndexesCF, ledger.openchainDB.BlockchainCF} {
+		writeBatch := ledger.openchainDB.NewWriteBatch()
+		itr := ledger.openchainDB.GetIterator(cf)
+		for itr.SeekToFirst(); itr.Valid(); itr.Next() {
+			writeBatch.DeleteCF(cf, statemgmt.Copy(itr.Key()))
+		}
+		itr.Close()
+		err := ledger.openchainDB.Write(writeBatch)
+		writeBatch.Destroy()
+		if err != nil {
+			return err
+		}
+	}
+	blockchain, err := newBlockchain(ledger.openchainDB)
+	if err != nil {
+		return err
+	}
+	ledger.blockchain = blockchain
+	return nil
+}
+
+type snapshotWriter struct {
+	w    *bufio.Writer
+	hash hash.Hash
+	err  error
+}
+
+func newSnapshotWriter(w io.Writer) *snapshotWriter {
+	return &snapshotWriter{w: bufio.NewWriter(w), hash: sha256.New()}
+}
+
+func (writer *snapshotWriter) write(p []byte) {
+	if writer.err != nil {
+		return
+	}
+	writer.hash.Write(p)
+	_, writer.err = writer.w.Write(p)
+}
+
+func (writer *snapshotWriter) writeBytes(p []byte) {
+	length := make([]byte, binary.MaxVarintLen64)
+	writer.write(length[:binary.PutUvarint(length, uint64(len(p)))])
+	writer.write(p)
+}
+
+func (writer *snapshotWriter) writeHeader(info *SnapshotInfo) {
+	infoBytes, err := json.Marshal(info)
+	if err != nil {
+		writer.err = err
+		return
+	}
+	writer.write(snapshotMagic)
+	writer.writeBytes(infoBytes)
+}
+
+func (writer *snapshotWriter) writeRecord(kind byte, key, value []byte) {
+	writer.write([]byte{kind})
+	writer.writeBytes(key)
+	writer.writeBytes(value)
+}
+
+func (writer *snapshotWriter) finish() error {
+	writer.write([]byte{snapshotRecordEnd})
+	if writer.err == nil {
+		_, writer.err = writer.w.Write(writer.hash.Sum(nil))
+	}
+	if writer.err == nil {
+		writer.err = writer.w.Flush()
+	}
+	return writer.err
+}
+
+type snapshotReader struct {
+	r    *bufio.Reader
+	hash hash.Hash
+}
+
+func newSnapshotReader(r io.Reader) *snapshotReader {
+	return &snapshotReader{r: bufio.NewReader(r), hash: sha256.New()}
+}
+
+// ReadByte implements io.ByteReader, for reading the lengths
+func (reader *snapshotReader) ReadByte() (byte, error) {
+	b, err := reader.r.ReadByte()
+	if err != nil {
+		return 0, unexpectedEOF(err)
+	}
+	reader.hash.Write([]byte{b})
+	return b, nil
+}
+
+func (reader *snapshotReader) read(n uint64) ([]byte, error) {
+	if n > maxSnapshotFieldSize {
+		return nil, fmt.Errorf("Snapshot field of %d bytes exceeds the maximum of %d bytes", n, maxSnapshotFieldSize)
+	}
+	p := make([]byte, n)
+	if _, err := io.ReadFull(reader.r, p); err != nil {
+		return nil, unexpectedEOF(err)
+	}
+	reader.hash.Write(p)
+	return p, nil
+}
+
+func (reader *snapshotReader) readBytes() ([]byte, error) {
+	length, err := binary.ReadUvarint(reader)
+	if err != nil {
+		return nil, err
+	}
+	return reader.read(length)
+}
+
+func (reader *snapshotReader) readHeader() (*SnapshotInfo, error) {
+	magic, err := reader.read(uint64(len(snapshotMagic)))
+	if err != nil || !bytes.Equal(magic, snapshotMagic) {
+		return nil, fmt.Errorf("Not a ledger snapshot")
+	}
+	infoBytes, err := reader.readBytes()
+	if err != nil {
+		return nil, err
+	}
+	info := &SnapshotInfo{}
+	if err := json.Unmarshal(infoBytes, info); err != nil {
+		return nil, fmt.Errorf("Invalid snapshot header: %s", err)
+	}
+	return info, nil
+}
+
+func (reader *snapshotReader) readRecord() (kind byte, key []byte, value []byte, err error) {
+	if kind, err = reader.ReadByte(); err != nil || kind == snapshotRecordEnd {
+		return
+	}
+	if key, err = reader.readBytes(); err != nil {
+		return
+	}
+	value, err = reader.readBytes()
+	return
+}
+
+func (reader *snapshotReader) verifyChecksum() error {
+	sum := reader.hash.Sum(nil)
+	checksum := make([]byte, len(sum))
+	if _, err := io.ReadFull(reader.r, checksum); err != nil {
+		return unexpectedEOF(err)
+	}
+	if !bytes.Equal(checksum, sum) {
+		return fmt.Errorf("Snapshot checksum does not match, it is corrupt")
+	}
+	return nil
+}
+
+func unexpectedEOF(err error) error {
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		return fmt.Errorf("Snapshot is truncated")
+	}
+	return err
+}
@@ -0,0 +1,203 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ledger
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync/atomic"
+
+	"github.com/hyperledger/fabric/core/db"
+	"github.com/spf13/viper"
+)
+
+const snapshotCheckpointPrefix = "snapshot-"
+
+// snapshotCheckpoints writes snapshots of the ledger, as exported by
+// ExportSnapshot, once the blockchain reaches checkpoint heights, multiples of
+// interval blocks, and keeps the last retain of them.  A peer joining the
+// network bootstraps its ledger from a checkpoint snapshot served by another
+// peer, and then only syncs the blocks committed since, rather than every
+// block from the genesis block.  A snapshot is written in the background and
+// taken at the height the blockchain reached by then, which may be above the
+// checkpoint height.
+type snapshotCheckpoints struct {
+	ledger   *Ledger
+	dir      string
+	interval uint64
+	retain   int
+	size     uint64 // Size of the blockchain last committed, accessed atomically
+	notify   chan struct{}
+}
+
+func loadSnapshotCheckpoints(ledger *Ledger) (*snapshotCheckpoints, error) {
+	interval := viper.GetInt("ledger.snapshots.interval")
+	if interval <= 0 {
+		return nil, nil
+	}
+	retain := viper.GetInt("ledger.snapshots.retain")
+	if retain <= 0 {
+		return nil, fmt.Errorf("Checkpoint snapshots retained must be greater than 0. Current value is %d.", retain)
+	}
+	dir := viper.GetString("ledger.snapshots.path")
+	if ledger.chainID != db.DefaultChainID {
+		dir = filepath.Join(dir, ledger.chainID)
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("Error creating the directory of the checkpoint snapshots: %s", err)
+	}
+
+	ledgerLogger.Infof("Writing a snapshot of the ledger every %d blocks to %s, retaining the last %d", interval, dir, retain)
+	checkpoints := &snapshotCheckpoints{
+		ledger:   ledger,
+		dir:      dir,
+		interval: uint64(interval),
+		retain:   retain,
+		notify:   make(chan struct{}, 1),
+	}
+	go checkpoints.run()
+	return checkpoints, nil
+}
+
+func (checkpoints *snapshotCheckpoints) run() {
+	for range checkpoints.notify {
+		if err := checkpoints.checkpoint(); err != nil {
+			ledgerLogger.Warningf("Failed writing a checkpoint snapshot of the ledger, retrying after the next commit: %s", err)
+		}
+	}
+}
+
+// committed notifies the checkpoints of the size of the blockchain once blocks
+// were committed, the snapshots are written in the background
+func (checkpoints *snapshotCheckpoints) committed(size uint64) {
+	atomic.StoreUint64(&checkpoints.size, size)
+	select {
+	case checkpoints.notify <- struct{}{}:
+	default:
+	}
+}
+
+// checkpoint writes a snapshot if the blockchain reached a checkpoint height
+// above that of the last snapshot, and deletes the snapshots no longer retained
+func (checkpoints *snapshotCheckpoints) checkpoint() error {
+	size := atomic.LoadUint64(&checkpoints.size)
+	target := size - size%checkpoints.interval
+	heights, err := checkpoints.heights()
+	if err != nil {
+		return err
+	}
+	if target == 0 || (len(heights) > 0 && heights[len(heights)-1] >= target) {
+		return nil
+	}
+
+	file, err := ioutil.TempFile(checkpoints.dir, ".tmp-"+snapshotCheckpointPrefix)
+	if err != nil {
+		return err
+	}
+	info, err := checkpoints.ledger.ExportSnapshot(file)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(file.Name(), checkpoints.path(info.Height))
+	}
+	if err != nil {
+		os.Remove(file.Name())
+		return err
+	}
+	ledgerLogger.Infof("Wrote a checkpoint snapshot of the ledger at height %d", info.Height)
+
+	heights = append(heights, info.Height)
+	for len(heights) > checkpoints.retain {
+		if err := os.Remove(checkpoints.path(heights[0])); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		heights = heights[1:]
+	}
+	return nil
+}
+
+// heights returns the heights of the snapshots written, in increasing order
+func (checkpoints *snapshotCheckpoints) heights() ([]uint64, error) {
+	files, err := ioutil.ReadDir(checkpoints.dir)
+	if err != nil {
+		return nil, err
+	}
+	heights := []uint64{}
+	for _, file := range files {
+		if !strings.HasPrefix(file.Name(), snapshotCheckpointPrefix) {
+			continue
+		}
+		height, err := strconv.ParseUint(strings.TrimPrefix(file.Name(), snapshotCheckpointPrefix), 10, 64)
+		if err != nil {
+			continue
+		}
+		heights = append(heights, height)
+	}
+	sort.Sort(uint64Slice(heights))
+	return heights, nil
+}
+
+func (checkpoints *snapshotCheckpoints) path(height uint64) string {
+	return filepath.Join(checkpoints.dir, fmt.Sprintf("%s%020d", snapshotCheckpointPrefix, height))
+}
+
+type uint64Slice []uint64
+
+func (s uint64Slice) Len() int           { return len(s) }
+func (s uint64Slice) Less(i, j int) bool { return s[i] < s[j] }
+func (s uint64Slice) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
+
+// GetSnapshotCheckpoints returns the heights of the checkpoint snapshots of the ledger, in increasing order,
+// none if they are disabled by ledger.snapshots.interval
+func (ledger *Ledger) GetSnapshotCheckpoints() ([]uint64, error) {
+	if ledger.checkpoints == nil {
+		return []uint64{}, nil
+	}
+	return ledger.checkpoints.heights()
+}
+
+// OpenSnapshotCheckpoint opens the checkpoint snapshot of the ledger at height, the last one if height is 0,
+// returning the snapshot, to be read by ImportSnapshot, and its height. ErrResourceNotFound is returned if
+// there is no such snapshot
+func (ledger *Ledger) OpenSnapshotCheckpoint(height uint64) (io.ReadCloser, uint64, error) {
+	heights, err := ledger.GetSnapshotCheckpoints()
+	if err != nil {
+		return nil, 0, err
+	}
+	if height == 0 && len(heights) > 0 {
+		height = heights[len(heights)-1]
+	}
+	if ledger.checkpoints == nil || height == 0 {
+		return nil, 0, ErrResourceNotFound
+	}
+	// a snapshot deleted meanwhile is still read whole once opened
+	file, err := os.Open(ledger.checkpoints.path(height))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, 0, ErrResourceNotFound
+		}
+		return nil, 0, err
+	}
+	return file, height, nil
+}
@@ -0,0 +1,101 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ledger
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/hyperledger/fabric/core/ledger/testutil"
+	"github.com/spf13/viper"
+)
+
+func TestSnapshotCheckpoints(t *testing.T) {
+	dir, err := ioutil.TempDir("", "snapshots")
+	testutil.AssertNoError(t, err, "Error creating snapshots directory")
+	defer os.RemoveAll(dir)
+
+	ledgerTestWrapper := createFreshDBAndTestLedgerWrapper(t)
+	ledger := ledgerTestWrapper.ledger
+	heights, err := ledger.GetSnapshotCheckpoints()
+	testutil.AssertNoError(t, err, "Error listing checkpoint snapshots")
+	testutil.AssertEquals(t, len(heights), 0)
+	if _, _, err := ledger.OpenSnapshotCheckpoint(0); err != ErrResourceNotFound {
+		t.Fatalf("Expected ErrResourceNotFound with checkpoint snapshots disabled, got %v", err)
+	}
+
+	// The snapshots are written directly rather than in the background
+	ledger.checkpoints = &snapshotCheckpoints{ledger: ledger, dir: dir, interval: 2, retain: 2, notify: make(chan struct{}, 1)}
+	checkpoint := func(count int) {
+		commitTestBlocks(t, ledger, count)
+		testutil.AssertNoError(t, ledger.checkpoints.checkpoint(), "Error writing checkpoint snapshot")
+	}
+	checkpoint(1)
+	heights, _ = ledger.GetSnapshotCheckpoints()
+	testutil.AssertEquals(t, heights, []uint64{})
+
+	checkpoint(1)
+	checkpoint(1)
+	heights, _ = ledger.GetSnapshotCheckpoints()
+	testutil.AssertEquals(t, heights, []uint64{2})
+
+	// The snapshot is taken at the height reached, the last retain are kept
+	checkpoint(2)
+	checkpoint(2)
+	heights, _ = ledger.GetSnapshotCheckpoints()
+	testutil.AssertEquals(t, heights, []uint64{5, 7})
+	if _, _, err := ledger.OpenSnapshotCheckpoint(2); err != ErrResourceNotFound {
+		t.Fatalf("Expected ErrResourceNotFound for a snapshot no longer retained, got %v", err)
+	}
+
+	// The last snapshot bootstraps a new ledger
+	snapshot, height, err := ledger.OpenSnapshotCheckpoint(0)
+	testutil.AssertNoError(t, err, "Error opening checkpoint snapshot")
+	defer snapshot.Close()
+	testutil.AssertEquals(t, height, uint64(7))
+	exportedInfo, _ := ledger.GetBlockchainInfo()
+
+	imported := createFreshDBAndTestLedgerWrapper(t).ledger
+	info, err := imported.ImportSnapshot(snapshot)
+	testutil.AssertNoError(t, err, "Error importing checkpoint snapshot")
+	testutil.AssertEquals(t, info.Height, uint64(7))
+	importedInfo, _ := imported.GetBlockchainInfo()
+	testutil.AssertEquals(t, importedInfo, exportedInfo)
+}
+
+func TestSnapshotCheckpointsConfig(t *testing.T) {
+	dir, err := ioutil.TempDir("", "snapshots")
+	testutil.AssertNoError(t, err, "Error creating snapshots directory")
+	defer os.RemoveAll(dir)
+	testDBWrapper.CleanDB(t)
+	viper.Set("ledger.snapshots.interval", 10)
+	viper.Set("ledger.snapshots.retain", 0)
+	viper.Set("ledger.snapshots.path", dir)
+	defer viper.Set("ledger.snapshots.interval", 0)
+
+	_, err = GetNewLedger()
+	testutil.AssertError(t, err, "Expected retaining no checkpoint snapshot to be rejected")
+
+	// The snapshots of the other chains are kept apart
+	viper.Set("ledger.snapshots.retain", 2)
+	chainLedger, err := GetNewChainLedger("chain1")
+	testutil.AssertNoError(t, err, "Error while constructing chain ledger")
+	testutil.AssertEquals(t, chainLedger.checkpoints.dir, filepath.Join(dir, "chain1"))
+	testutil.AssertEquals(t, chainLedger.checkpoints.interval, uint64(10))
+}
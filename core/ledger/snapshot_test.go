@@ -0,0 +1,138 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ledger
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/hyperledger/fabric/core/ledger/testutil"
+	"github.com/hyperledger/fabric/protos"
+)
+
+// exportTestSnapshot commits blocks setting state and exports the ledger,
+// returning the snapshot and the UUIDs of the transactions
+func exportTestSnapshot(t *testing.T) (*ledgerTestWrapper, []byte, *SnapshotInfo, []string) {
+	ledgerTestWrapper := createFreshDBAndTestLedgerWrapper(t)
+	ledger := ledgerTestWrapper.ledger
+	var uuids []string
+	for i := 0; i < 5; i++ {
+		ledger.BeginTxBatch(i)
+		transaction, uuid := buildTestTx(t)
+		ledger.TxBegin(uuid)
+		ledger.SetState("chaincode1", fmt.Sprintf("key%d", i), []byte(fmt.Sprintf("value%d", i)))
+		ledger.SetState("chaincode2", "key", []byte(fmt.Sprintf("value%d", i)))
+		ledger.TxFinished(uuid, true)
+		err := ledger.CommitTxBatch(i, []*protos.Transaction{transaction}, nil, []byte("proof"))
+		testutil.AssertNoError(t, err, "Error committing block")
+		uuids = append(uuids, uuid)
+	}
+
+	var snapshot bytes.Buffer
+	info, err := ledger.ExportSnapshot(&snapshot)
+	testutil.AssertNoError(t, err, "Error exporting snapshot")
+	return ledgerTestWrapper, snapshot.Bytes(), info, uuids
+}
+
+func TestLedgerSnapshot(t *testing.T) {
+	exported, snapshot, info, uuids := exportTestSnapshot(t)
+	exportedInfo, _ := exported.ledger.GetBlockchainInfo()
+	testutil.AssertEquals(t, info.Height, uint64(5))
+	testutil.AssertEquals(t, info.BlockHash, exportedInfo.CurrentBlockHash)
+	stateHash, _ := exported.ledger.state.GetHash()
+	testutil.AssertEquals(t, info.StateHash, stateHash)
+
+	ledgerTestWrapper := createFreshDBAndTestLedgerWrapper(t)
+	ledger := ledgerTestWrapper.ledger
+	imported, err := ledger.ImportSnapshot(bytes.NewReader(snapshot))
+	testutil.AssertNoError(t, err, "Error importing snapshot")
+	testutil.AssertEquals(t, imported, info)
+
+	importedInfo, _ := ledger.GetBlockchainInfo()
+	testutil.AssertEquals(t, importedInfo, exportedInfo)
+	for i := 0; i < 5; i++ {
+		testutil.AssertEquals(t, ledgerTestWrapper.GetState("chaincode1", fmt.Sprintf("key%d", i), true), []byte(fmt.Sprintf("value%d", i)))
+		tx, err := ledger.GetTransactionByUUID(uuids[i])
+		testutil.AssertNoError(t, err, "Error fetching transaction through the imported indexes")
+		testutil.AssertEquals(t, tx.Uuid, uuids[i])
+	}
+	testutil.AssertEquals(t, ledgerTestWrapper.GetState("chaincode2", "key", true), []byte("value4"))
+	testutil.AssertNotNil(t, ledgerTestWrapper.GetStateDelta(4))
+
+	// The imported ledger goes on committing blocks
+	commitTestBlocks(t, ledger, 1)
+	testutil.AssertEquals(t, ledgerTestWrapper.VerifyChain(5, 0), uint64(0))
+
+	_, err = ledger.ImportSnapshot(bytes.NewReader(snapshot))
+	if err == nil || !strings.Contains(err.Error(), "empty ledger") {
+		t.Fatalf("Expected importing into a ledger with blocks to fail, got %v", err)
+	}
+}
+
+func TestLedgerSnapshotCorrupt(t *testing.T) {
+	_, snapshot, _, _ := exportTestSnapshot(t)
+
+	truncated := snapshot[:len(snapshot)-10]
+	corrupt := append([]byte{}, snapshot...)
+	corrupt[len(corrupt)/2] ^= 0xff
+	for name, data := range map[string][]byte{"truncated": truncated, "corrupt": corrupt, "garbage": []byte("garbage")} {
+		ledgerTestWrapper := createFreshDBAndTestLedgerWrapper(t)
+		ledger := ledgerTestWrapper.ledger
+		if _, err := ledger.ImportSnapshot(bytes.NewReader(data)); err == nil {
+			t.Fatalf("Expected importing a %s snapshot to fail", name)
+		}
+		// Nothing of the snapshot is left behind
+		testutil.AssertEquals(t, ledger.GetBlockchainSize(), uint64(0))
+		testutil.AssertNil(t, ledgerTestWrapper.GetState("chaincode2", "key", true))
+		restarted, err := GetNewLedger()
+		testutil.AssertNoError(t, err, "Error while constructing ledger")
+		testutil.AssertEquals(t, restarted.GetBlockchainSize(), uint64(0))
+	}
+}
+
+func TestLedgerSnapshotStateHash(t *testing.T) {
+	_, snapshot, _, _ := exportTestSnapshot(t)
+
+	// Rewrite the snapshot with a state value changed, and a valid checksum
+	reader := newSnapshotReader(bytes.NewReader(snapshot))
+	info, err := reader.readHeader()
+	testutil.AssertNoError(t, err, "Error reading snapshot header")
+	var tampered bytes.Buffer
+	writer := newSnapshotWriter(&tampered)
+	writer.writeHeader(info)
+	for {
+		kind, key, value, err := reader.readRecord()
+		testutil.AssertNoError(t, err, "Error reading snapshot record")
+		if kind == snapshotRecordEnd {
+			break
+		}
+		if kind == snapshotRecordState && bytes.HasPrefix(key, []byte("chaincode2")) {
+			value = []byte("tampered")
+		}
+		writer.writeRecord(kind, key, value)
+	}
+	testutil.AssertNoError(t, writer.finish(), "Error writing snapshot")
+
+	ledger := createFreshDBAndTestLedgerWrapper(t).ledger
+	_, err = ledger.ImportSnapshot(&tampered)
+	if err == nil || !strings.Contains(err.Error(), "State hashes") {
+		t.Fatalf("Expected the tampered state to fail verification, got %v", err)
+	}
+	testutil.AssertEquals(t, ledger.GetBlockchainSize(), uint64(0))
+}
@@ -34,43 +34,41 @@ var defaultBucketCacheMaxSize = 100 // MBs
 // be controlled - by keeping seletive buckets in the cache (most likely first few levels of the bucket tree - because,
 // higher the level of the bucket, more are the chances that the bucket would be required for recomputation of hash)
 type bucketCache struct {
-	isEnabled bool
-	c         map[bucketKey]*bucketNode
-	lock      sync.RWMutex
-	size      uint64
-	maxSize   uint64
+	openchainDB *db.OpenchainDB
+	isEnabled   bool
+	c           map[bucketKey]*bucketNode
+	lock        sync.RWMutex
+	size        uint64
+	maxSize     uint64
 }
 
-func newBucketCache(maxSizeMBs int) *bucketCache {
+func newBucketCache(openchainDB *db.OpenchainDB, maxSizeMBs int) *bucketCache {
 	isEnabled := true
 	if maxSizeMBs <= 0 {
 		isEnabled = false
 	} else {
 		logger.Infof("Constructing bucket-cache with max bucket cache size = [%d] MBs", maxSizeMBs)
 	}
-	return &bucketCache{c: make(map[bucketKey]*bucketNode), maxSize: uint64(maxSizeMBs * 1024 * 1024), isEnabled: isEnabled}
+	return &bucketCache{openchainDB: openchainDB, c: make(map[bucketKey]*bucketNode), maxSize: uint64(maxSizeMBs * 1024 * 1024), isEnabled: isEnabled}
 }
 
 func (cache *bucketCache) loadAllBucketNodesFromDB() {
 	if !cache.isEnabled {
 		return
 	}
-	openchainDB := db.GetDBHandle()
-	itr := openchainDB.GetStateCFIterator()
+	itr := cache.openchainDB.GetStateCFIterator()
 	defer itr.Close()
 	itr.Seek([]byte{byte(0)})
 	count := 0
 	cache.lock.Lock()
 	defer cache.lock.Unlock()
 	for ; itr.Valid(); itr.Next() {
-		key := itr.Key().Data()
+		key := itr.Key()
 		if key[0] != byte(0) {
-			itr.Key().Free()
-			itr.Value().Free()
 			break
 		}
-		bKey := decodeBucketKey(statemgmt.Copy(itr.Key().Data()))
-		nodeBytes := statemgmt.Copy(itr.Value().Data())
+		bKey := decodeBucketKey(statemgmt.Copy(itr.Key()))
+		nodeBytes := statemgmt.Copy(itr.Value())
 		bucketNode := unmarshalBucketNode(&bKey, nodeBytes)
 		size := bKey.size() + bucketNode.size()
 		cache.size += size
@@ -79,8 +77,6 @@ func (cache *bucketCache) loadAllBucketNodesFromDB() {
 			break
 		}
 		cache.c[bKey] = bucketNode
-		itr.Key().Free()
-		itr.Value().Free()
 		count++
 	}
 	logger.Infof("Loaded buckets data in cache. Total buckets in DB = [%d]. Total cache size:=%d", count, cache.size)
@@ -116,13 +112,13 @@ func (cache *bucketCache) putWithoutLock(key bucketKey, node *bucketNode) {
 func (cache *bucketCache) get(key bucketKey) (*bucketNode, error) {
 	defer perfstat.UpdateTimeStat("timeSpent", time.Now())
 	if !cache.isEnabled {
-		return fetchBucketNodeFromDB(&key)
+		return fetchBucketNodeFromDB(cache.openchainDB, &key)
 	}
 	cache.lock.RLock()
 	defer cache.lock.RUnlock()
 	bucketNode := cache.c[key]
 	if bucketNode == nil {
-		return fetchBucketNodeFromDB(&key)
+		return fetchBucketNodeFromDB(cache.openchainDB, &key)
 	}
 	return bucketNode, nil
 }
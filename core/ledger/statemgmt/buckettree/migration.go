@@ -0,0 +1,155 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package buckettree
+
+import (
+	"bytes"
+	"fmt"
+
+	"github.com/hyperledger/fabric/core/db"
+	"github.com/hyperledger/fabric/core/ledger/statemgmt"
+)
+
+// migrationBatchSize is the number of keys moved at once into the rebuilt bucket tree
+const migrationBatchSize = 1000
+
+// Migrate rebuilds the bucket tree of the state in openchainDB, built with the configuration fromConfigs,
+// for the configuration toConfigs, which may have a different numBuckets or maxGroupingAtEachLevel.
+// The keys and values are kept but the crypto-hash of the state changes, the new one is returned.
+//
+// The migration is offline: no state implementation may use the db meanwhile, and the state must be
+// initialized with toConfigs afterwards. The keys are added to the new bucket tree by batches, as they
+// are when blocks are committed, and the resulting crypto-hash is checked against the one recomputed
+// from all the data nodes of the db at once. A failed migration leaves the state incomplete, so the
+// db should be backed up beforehand.
+func Migrate(openchainDB *db.OpenchainDB, fromConfigs map[string]interface{}, toConfigs map[string]interface{}) ([]byte, error) {
+	initConfig(fromConfigs)
+	snapshot := openchainDB.GetSnapshot()
+	defer snapshot.Release()
+	// the data nodes are read without decoding their bucket, which is checked
+	// against the configuration and the configuration is toConfigs from now on
+	itr := openchainDB.GetStateCFSnapshotIterator(snapshot)
+	defer itr.Close()
+
+	if err := deleteBucketTree(openchainDB); err != nil {
+		return nil, err
+	}
+	stateImpl := NewStateImpl(openchainDB)
+	if err := stateImpl.Initialize(toConfigs); err != nil {
+		return nil, err
+	}
+
+	numKeys := 0
+	stateDelta := statemgmt.NewStateDelta()
+	for itr.Seek([]byte{0x01}); itr.Valid(); itr.Next() {
+		_, bucketNumberLength := decodeBucketNumber(itr.Key())
+		chaincodeID, key := statemgmt.DecodeCompositeKey(itr.Key()[bucketNumberLength:])
+		stateDelta.Set(chaincodeID, key, statemgmt.Copy(itr.Value()), nil)
+		numKeys++
+		if numKeys%migrationBatchSize == 0 {
+			if err := stateImpl.persistMigrationBatch(stateDelta); err != nil {
+				return nil, err
+			}
+			stateDelta = statemgmt.NewStateDelta()
+		}
+	}
+	if err := stateImpl.persistMigrationBatch(stateDelta); err != nil {
+		return nil, err
+	}
+
+	stateHash, err := stateImpl.ComputeCryptoHash()
+	if err != nil {
+		return nil, err
+	}
+	canonicalStateHash, err := computeCryptoHashFromDB(openchainDB)
+	if err != nil {
+		return nil, err
+	}
+	if !bytes.Equal(stateHash, canonicalStateHash) {
+		return nil, fmt.Errorf("The crypto-hash [%x] of the rebuilt bucket tree is not the crypto-hash [%x] of its data nodes", stateHash, canonicalStateHash)
+	}
+	logger.Infof("Migrated [%d] keys to bucket tree configuration %+v, crypto-hash of the state is [%x]", numKeys, conf, stateHash)
+	return stateHash, nil
+}
+
+func (stateImpl *StateImpl) persistMigrationBatch(stateDelta *statemgmt.StateDelta) error {
+	if err := stateImpl.PrepareWorkingSet(stateDelta); err != nil {
+		return err
+	}
+	if _, err := stateImpl.ComputeCryptoHash(); err != nil {
+		return err
+	}
+	writeBatch := stateImpl.openchainDB.NewWriteBatch()
+	defer writeBatch.Destroy()
+	if err := stateImpl.AddChangesForPersistence(writeBatch); err != nil {
+		return err
+	}
+	if err := stateImpl.openchainDB.Write(writeBatch); err != nil {
+		return err
+	}
+	stateImpl.ClearWorkingSet(true)
+	return nil
+}
+
+// deleteBucketTree deletes the data nodes and bucket nodes from the db, leaving the other column families
+func deleteBucketTree(openchainDB *db.OpenchainDB) error {
+	itr := openchainDB.GetStateCFIterator()
+	defer itr.Close()
+	writeBatch := openchainDB.NewWriteBatch()
+	defer writeBatch.Destroy()
+	for itr.SeekToFirst(); itr.Valid(); itr.Next() {
+		writeBatch.DeleteCF(openchainDB.StateCF, statemgmt.Copy(itr.Key()))
+	}
+	return openchainDB.Write(writeBatch)
+}
+
+// computeCryptoHashFromDB recomputes the crypto-hash of the state from all the data nodes in the db,
+// without reading the bucket nodes
+func computeCryptoHashFromDB(openchainDB *db.OpenchainDB) ([]byte, error) {
+	itr := openchainDB.GetStateCFIterator()
+	defer itr.Close()
+	bucketTreeDelta := newBucketTreeDelta()
+	var bucketHashCalculator *bucketHashCalculator
+	addBucketCryptoHash := func() {
+		bucketKey := bucketHashCalculator.bucketKey
+		parentBucket := bucketTreeDelta.getOrCreateBucketNode(bucketKey.getParentKey())
+		parentBucket.setChildCryptoHash(bucketKey, bucketHashCalculator.computeCryptoHash())
+	}
+	// the data nodes are sorted by bucket, after the bucket nodes
+	for itr.Seek([]byte{0x01}); itr.Valid(); itr.Next() {
+		dataNode := unmarshalDataNodeFromBytes(statemgmt.Copy(itr.Key()), statemgmt.Copy(itr.Value()))
+		if bucketHashCalculator == nil || !dataNode.dataKey.getBucketKey().equals(bucketHashCalculator.bucketKey) {
+			if bucketHashCalculator != nil {
+				addBucketCryptoHash()
+			}
+			bucketHashCalculator = newBucketHashCalculator(dataNode.dataKey.getBucketKey())
+		}
+		bucketHashCalculator.addNextNode(dataNode)
+	}
+	if bucketHashCalculator == nil {
+		return nil, nil
+	}
+	addBucketCryptoHash()
+
+	for level := conf.getLowestLevel() - 1; level > 0; level-- {
+		for _, bucketNode := range bucketTreeDelta.getBucketNodesAt(level) {
+			parentBucket := bucketTreeDelta.getOrCreateBucketNode(bucketNode.bucketKey.getParentKey())
+			parentBucket.setChildCryptoHash(bucketNode.bucketKey, bucketNode.computeCryptoHash())
+		}
+	}
+	return bucketTreeDelta.getRootNode().computeCryptoHash(), nil
+}
@@ -0,0 +1,80 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package buckettree
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/hyperledger/fabric/core/db"
+	"github.com/hyperledger/fabric/core/ledger/statemgmt"
+	"github.com/hyperledger/fabric/core/ledger/testutil"
+)
+
+func TestMigrate(t *testing.T) {
+	fromConfigs := map[string]interface{}{ConfigNumBuckets: 26, ConfigMaxGroupingAtEachLevel: 3}
+	toConfigs := map[string]interface{}{ConfigNumBuckets: 47, ConfigMaxGroupingAtEachLevel: 4}
+	// more keys than migrated at once
+	stateDelta := statemgmt.NewStateDelta()
+	for i := 0; i < migrationBatchSize+100; i++ {
+		stateDelta.Set(fmt.Sprintf("chaincodeID%d", i%3), fmt.Sprintf("key%d", i), []byte(fmt.Sprintf("value%d", i)), nil)
+	}
+
+	// the crypto-hash of a bucket tree built with the new configuration from the start
+	testDBWrapper.CleanDB(t)
+	stateImplTestWrapper := newStateImplTestWrapperWithCustomConfig(t, 47, 4)
+	expectedHash := stateImplTestWrapper.prepareWorkingSetAndComputeCryptoHash(stateDelta)
+
+	testDBWrapper.CleanDB(t)
+	stateImplTestWrapper = newStateImplTestWrapperWithCustomConfig(t, 26, 3)
+	stateHash := stateImplTestWrapper.prepareWorkingSetAndComputeCryptoHash(stateDelta)
+	stateImplTestWrapper.persistChangesAndResetInMemoryChanges()
+	testutil.AssertNotEquals(t, stateHash, expectedHash)
+
+	migratedHash, err := Migrate(db.GetDBHandle(), fromConfigs, toConfigs)
+	testutil.AssertNoError(t, err, "Error while migrating")
+	testutil.AssertEquals(t, migratedHash, expectedHash)
+
+	stateImplTestWrapper = newStateImplTestWrapperWithCustomConfig(t, 47, 4)
+	testutil.AssertEquals(t, stateImplTestWrapper.computeCryptoHash(), expectedHash)
+	for i := 0; i < migrationBatchSize+100; i++ {
+		testutil.AssertEquals(t, stateImplTestWrapper.get(fmt.Sprintf("chaincodeID%d", i%3), fmt.Sprintf("key%d", i)), []byte(fmt.Sprintf("value%d", i)))
+	}
+
+	// the state is changed as usual once migrated
+	stateDelta = statemgmt.NewStateDelta()
+	stateDelta.Delete("chaincodeID0", "key0", nil)
+	stateImplTestWrapper.prepareWorkingSetAndComputeCryptoHash(stateDelta)
+	stateImplTestWrapper.persistChangesAndResetInMemoryChanges()
+	stateHash = stateImplTestWrapper.computeCryptoHash()
+
+	// and migrated back
+	_, err = Migrate(db.GetDBHandle(), toConfigs, fromConfigs)
+	testutil.AssertNoError(t, err, "Error while migrating")
+	migratedHash, err = Migrate(db.GetDBHandle(), fromConfigs, toConfigs)
+	testutil.AssertNoError(t, err, "Error while migrating")
+	testutil.AssertEquals(t, migratedHash, stateHash)
+}
+
+func TestMigrateEmptyState(t *testing.T) {
+	testDBWrapper.CleanDB(t)
+	newStateImplTestWrapperWithCustomConfig(t, 26, 3)
+	migratedHash, err := Migrate(db.GetDBHandle(), map[string]interface{}{ConfigNumBuckets: 26, ConfigMaxGroupingAtEachLevel: 3},
+		map[string]interface{}{ConfigNumBuckets: 47, ConfigMaxGroupingAtEachLevel: 4})
+	testutil.AssertNoError(t, err, "Error while migrating")
+	testutil.AssertNil(t, migratedHash)
+}
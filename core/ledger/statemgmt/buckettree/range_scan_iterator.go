@@ -17,14 +17,15 @@ limitations under the License.
 package buckettree
 
 import (
+	"bytes"
+
 	"github.com/hyperledger/fabric/core/db"
 	"github.com/hyperledger/fabric/core/ledger/statemgmt"
-	"github.com/tecbot/gorocksdb"
 )
 
 // RangeScanIterator implements the interface 'statemgmt.RangeScanIterator'
 type RangeScanIterator struct {
-	dbItr               *gorocksdb.Iterator
+	dbItr               db.Iterator
 	chaincodeID         string
 	startKey            string
 	endKey              string
@@ -34,8 +35,8 @@ type RangeScanIterator struct {
 	done                bool
 }
 
-func newRangeScanIterator(chaincodeID string, startKey string, endKey string) (*RangeScanIterator, error) {
-	dbItr := db.GetDBHandle().GetStateCFIterator()
+func newRangeScanIterator(openchainDB *db.OpenchainDB, chaincodeID string, startKey string, endKey string) (*RangeScanIterator, error) {
+	dbItr := openchainDB.GetStateCFIterator()
 	itr := &RangeScanIterator{
 		dbItr:       dbItr,
 		chaincodeID: chaincodeID,
@@ -46,6 +47,26 @@ func newRangeScanIterator(chaincodeID string, startKey string, endKey string) (*
 	return itr, nil
 }
 
+// newRangeScanIteratorAfter returns an iterator resuming after lastKey. As the keys are
+// scanned bucket after bucket, the scan resumes in the bucket of lastKey
+func newRangeScanIteratorAfter(openchainDB *db.OpenchainDB, chaincodeID string, startKey string, endKey string, lastKey string) (*RangeScanIterator, error) {
+	dbItr := openchainDB.GetStateCFIterator()
+	itr := &RangeScanIterator{
+		dbItr:       dbItr,
+		chaincodeID: chaincodeID,
+		startKey:    startKey,
+		endKey:      endKey,
+	}
+	lastDataKey := newDataKey(chaincodeID, lastKey)
+	lastDataKeyBytes := lastDataKey.getEncodedBytes()
+	itr.currentBucketNumber = lastDataKey.bucketKey.bucketNumber
+	itr.dbItr.Seek(lastDataKeyBytes)
+	if itr.dbItr.Valid() && bytes.Equal(itr.dbItr.Key(), lastDataKeyBytes) {
+		itr.dbItr.Next()
+	}
+	return itr, nil
+}
+
 // Next - see interface 'statemgmt.RangeScanIterator' for details
 func (itr *RangeScanIterator) Next() bool {
 	if itr.done {
@@ -56,8 +77,8 @@ func (itr *RangeScanIterator) Next() bool {
 
 		// making a copy of key-value bytes because, underlying key bytes are reused by itr.
 		// no need to free slices as iterator frees memory when closed.
-		keyBytes := statemgmt.Copy(itr.dbItr.Key().Data())
-		valueBytes := statemgmt.Copy(itr.dbItr.Value().Data())
+		keyBytes := statemgmt.Copy(itr.dbItr.Key())
+		valueBytes := statemgmt.Copy(itr.dbItr.Value())
 
 		dataNode := unmarshalDataNodeFromBytes(keyBytes, valueBytes)
 		dataKey := dataNode.dataKey
@@ -17,6 +17,7 @@ limitations under the License.
 package buckettree
 
 import (
+	"fmt"
 	"testing"
 
 	"github.com/hyperledger/fabric/core/ledger/statemgmt"
@@ -147,3 +148,34 @@ func TestRangeScanIteratorEmptyArray(t *testing.T) {
 	testutil.AssertEquals(t, results["key3"], []byte{})
 	rangeScanItr.Close()
 }
+
+func TestRangeScanIteratorAfter(t *testing.T) {
+	testDBWrapper.CleanDB(t)
+	stateImplTestWrapper := newStateImplTestWrapper(t)
+	stateDelta := statemgmt.NewStateDelta()
+	for i := 0; i < 20; i++ {
+		stateDelta.Set("chaincodeID1", fmt.Sprintf("key%02d", i), []byte(fmt.Sprintf("value%02d", i)), nil)
+		stateDelta.Set("chaincodeID2", fmt.Sprintf("key%02d", i), []byte(fmt.Sprintf("value%02d", i)), nil)
+	}
+	stateImplTestWrapper.prepareWorkingSet(stateDelta)
+	stateImplTestWrapper.persistChangesAndResetInMemoryChanges()
+
+	scan := func(rangeScanItr statemgmt.RangeScanIterator) []string {
+		defer rangeScanItr.Close()
+		keys := []string{}
+		for rangeScanItr.Next() {
+			key, _ := rangeScanItr.GetKeyValue()
+			keys = append(keys, key)
+		}
+		return keys
+	}
+	keys := scan(stateImplTestWrapper.getRangeScanIterator("chaincodeID1", "key03", "key16"))
+	testutil.AssertEquals(t, len(keys), 14)
+
+	// Resuming after each key gives the keys which followed it
+	for i, lastKey := range keys {
+		rangeScanItr, err := stateImplTestWrapper.stateImpl.GetRangeScanIteratorAfter("chaincodeID1", "key03", "key16", lastKey)
+		testutil.AssertNoError(t, err, "Error while getting iterator")
+		testutil.AssertEquals(t, scan(rangeScanItr), keys[i+1:])
+	}
+}
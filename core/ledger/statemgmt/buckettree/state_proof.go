@@ -0,0 +1,188 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package buckettree
+
+import (
+	"bytes"
+	"fmt"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/hyperledger/fabric/core/ledger/statemgmt"
+)
+
+// A proof for a key consists of the tree configuration, the bucket number of the key,
+// all the data nodes of that bucket (needed for recomputing the crypto-hash of the bucket)
+// followed by the children crypto-hashes of each bucket node on the path from the bucket
+// to the root, lowest level first
+type stateProof struct {
+	numBuckets             int
+	maxGroupingAtEachLevel int
+	bucketNumber           int
+	dataNodes              dataNodes
+	bucketNodesHashes      [][][]byte
+}
+
+// GetStateProof - method implementation for interface 'statemgmt.StateProver'
+func (stateImpl *StateImpl) GetStateProof(chaincodeID string, key string) ([]byte, []byte, error) {
+	dataKey := newDataKey(chaincodeID, key)
+	dataNodes, err := fetchDataNodesFromDBFor(stateImpl.openchainDB, dataKey.bucketKey)
+	if err != nil {
+		return nil, nil, err
+	}
+	var value []byte
+	for _, dataNode := range dataNodes {
+		if bytes.Equal(dataNode.getCompositeKey(), dataKey.compositeKey) {
+			value = dataNode.getValue()
+		}
+	}
+
+	proof := &stateProof{conf.getNumBucketsAtLowestLevel(), conf.getMaxGroupingAtEachLevel(), dataKey.bucketKey.bucketNumber, dataNodes, nil}
+	for bucketKey := dataKey.bucketKey; bucketKey.level > 0; {
+		bucketKey = bucketKey.getParentKey()
+		bucketNode, err := fetchBucketNodeFromDB(stateImpl.openchainDB, bucketKey)
+		if err != nil {
+			return nil, nil, err
+		}
+		if bucketNode == nil {
+			bucketNode = newBucketNode(bucketKey)
+		}
+		proof.bucketNodesHashes = append(proof.bucketNodesHashes, bucketNode.childrenCryptoHash)
+	}
+	logger.Debugf("Proof for chaincodeID=[%s], key=[%s] spans [%d] data nodes and [%d] bucket nodes", chaincodeID, key, len(dataNodes), len(proof.bucketNodesHashes))
+	return value, proof.marshal(), nil
+}
+
+// VerifyStateProof checks that a state whose crypto-hash is stateHash has the value for the key of a
+// chaincodeID, a nil value meaning the key is not in the state. The proof is the one returned by
+// GetStateProof, for a state using the default hash function. The verification only depends on its
+// arguments, so the state hash of a block is enough to check a value without trusting the peer
+func VerifyStateProof(stateHash []byte, chaincodeID string, key string, value []byte, proofBytes []byte) error {
+	proof, proofConf, err := unmarshalStateProof(proofBytes)
+	if err != nil {
+		return err
+	}
+	compositeKey := statemgmt.ConstructCompositeKey(chaincodeID, key)
+	if int(proofConf.computeBucketHash(compositeKey))%proof.numBuckets+1 != proof.bucketNumber {
+		return fmt.Errorf("Invalid proof: the key does not belong to bucket [%d]", proof.bucketNumber)
+	}
+
+	var provenValue []byte
+	bucketHashCalculator := newBucketHashCalculator(&bucketKey{proofConf.getLowestLevel(), proof.bucketNumber})
+	for i, dataNode := range proof.dataNodes {
+		if i > 0 && bytes.Compare(proof.dataNodes[i-1].getCompositeKey(), dataNode.getCompositeKey()) >= 0 {
+			return fmt.Errorf("Invalid proof: data nodes are not in increasing order of the keys")
+		}
+		if bytes.Equal(dataNode.getCompositeKey(), compositeKey) {
+			provenValue = dataNode.getValue()
+		}
+		bucketHashCalculator.addNextNode(dataNode)
+	}
+	if !bytes.Equal(provenValue, value) || (provenValue == nil) != (value == nil) {
+		return fmt.Errorf("Invalid proof: the proven value [%x] is not the value [%x]", provenValue, value)
+	}
+
+	cryptoHash := bucketHashCalculator.computeCryptoHash()
+	bucketNumber := proof.bucketNumber
+	for i, childrenCryptoHash := range proof.bucketNodesHashes {
+		level := proofConf.getLowestLevel() - i - 1
+		childIndex := (bucketNumber - 1) % proof.maxGroupingAtEachLevel
+		bucketNumber = proofConf.computeParentBucketNumber(bucketNumber)
+		if !bytes.Equal(childrenCryptoHash[childIndex], cryptoHash) {
+			return fmt.Errorf("Invalid proof: the crypto-hash of child [%d] of bucket [%d] at level [%d] is not the proven one", childIndex, bucketNumber, level)
+		}
+		bucketNode := &bucketNode{bucketKey: &bucketKey{level, bucketNumber}, childrenCryptoHash: childrenCryptoHash}
+		cryptoHash = bucketNode.computeCryptoHash()
+	}
+	if !bytes.Equal(cryptoHash, stateHash) {
+		return fmt.Errorf("Invalid proof: the proven state hash [%x] is not the state hash [%x]", cryptoHash, stateHash)
+	}
+	return nil
+}
+
+func (proof *stateProof) marshal() []byte {
+	buffer := proto.NewBuffer([]byte{})
+	buffer.EncodeVarint(uint64(proof.numBuckets))
+	buffer.EncodeVarint(uint64(proof.maxGroupingAtEachLevel))
+	buffer.EncodeVarint(uint64(proof.bucketNumber))
+	buffer.EncodeVarint(uint64(len(proof.dataNodes)))
+	for _, dataNode := range proof.dataNodes {
+		buffer.EncodeRawBytes(dataNode.getCompositeKey())
+		buffer.EncodeRawBytes(dataNode.getValue())
+	}
+	for _, childrenCryptoHash := range proof.bucketNodesHashes {
+		for _, childCryptoHash := range childrenCryptoHash {
+			buffer.EncodeRawBytes(childCryptoHash)
+		}
+	}
+	return buffer.Bytes()
+}
+
+func unmarshalStateProof(serializedBytes []byte) (*stateProof, *config, error) {
+	buffer := proto.NewBuffer(serializedBytes)
+	var header [4]uint64
+	for i := range header {
+		n, err := buffer.DecodeVarint()
+		if err != nil {
+			return nil, nil, fmt.Errorf("Invalid proof: %s", err)
+		}
+		header[i] = n
+	}
+	proof := &stateProof{numBuckets: int(header[0]), maxGroupingAtEachLevel: int(header[1]), bucketNumber: int(header[2])}
+	numDataNodes := header[3]
+	// every encoded data node and child crypto-hash takes at least one byte, which bounds the allocations below
+	if proof.numBuckets < 2 || proof.maxGroupingAtEachLevel < 2 || proof.maxGroupingAtEachLevel > len(serializedBytes) {
+		return nil, nil, fmt.Errorf("Invalid proof: unsupported tree configuration numBuckets=[%d], maxGroupingAtEachLevel=[%d]", proof.numBuckets, proof.maxGroupingAtEachLevel)
+	}
+	if numDataNodes > uint64(len(serializedBytes)) {
+		return nil, nil, fmt.Errorf("Invalid proof: [%d] data nodes can not fit in [%d] bytes", numDataNodes, len(serializedBytes))
+	}
+	proofConf := newConfig(proof.numBuckets, proof.maxGroupingAtEachLevel, fnvHash)
+	if proof.bucketNumber < 1 || proof.bucketNumber > proof.numBuckets {
+		return nil, nil, fmt.Errorf("Invalid proof: bucket number [%d] is not between 1 and [%d]", proof.bucketNumber, proof.numBuckets)
+	}
+
+	for i := uint64(0); i < numDataNodes; i++ {
+		compositeKey, err := buffer.DecodeRawBytes(true)
+		if err != nil {
+			return nil, nil, fmt.Errorf("Invalid proof: %s", err)
+		}
+		// a composite key always holds the delimiter between the chaincodeID and the key
+		if bytes.IndexByte(compositeKey, 0x00) < 0 {
+			return nil, nil, fmt.Errorf("Invalid proof: [%x] is not a composite key", compositeKey)
+		}
+		value, err := buffer.DecodeRawBytes(true)
+		if err != nil {
+			return nil, nil, fmt.Errorf("Invalid proof: %s", err)
+		}
+		proof.dataNodes = append(proof.dataNodes, newDataNode(&dataKey{compositeKey: compositeKey}, value))
+	}
+	for level := proofConf.getLowestLevel() - 1; level >= 0; level-- {
+		childrenCryptoHash := make([][]byte, proof.maxGroupingAtEachLevel)
+		for i := range childrenCryptoHash {
+			childCryptoHash, err := buffer.DecodeRawBytes(true)
+			if err != nil {
+				return nil, nil, fmt.Errorf("Invalid proof: %s", err)
+			}
+			//protobuf's buffer.EncodeRawBytes/buffer.DecodeRawBytes convert a nil into a zero length byte-array, so nil check would not work
+			if len(childCryptoHash) != 0 {
+				childrenCryptoHash[i] = childCryptoHash
+			}
+		}
+		proof.bucketNodesHashes = append(proof.bucketNodesHashes, childrenCryptoHash)
+	}
+	return proof, proofConf, nil
+}
@@ -0,0 +1,79 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package buckettree
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/hyperledger/fabric/core/ledger/statemgmt"
+	"github.com/hyperledger/fabric/core/ledger/testutil"
+)
+
+func TestStateProof(t *testing.T) {
+	testDBWrapper.CleanDB(t)
+	stateImplTestWrapper := newStateImplTestWrapperWithCustomConfig(t, 26, 3)
+	stateDelta := statemgmt.NewStateDelta()
+	for i := 0; i < 20; i++ {
+		stateDelta.Set(fmt.Sprintf("chaincodeID%d", i%3), fmt.Sprintf("key%d", i), []byte(fmt.Sprintf("value%d", i)), nil)
+	}
+	stateHash := stateImplTestWrapper.prepareWorkingSetAndComputeCryptoHash(stateDelta)
+	stateImplTestWrapper.persistChangesAndResetInMemoryChanges()
+
+	for i := 0; i < 20; i++ {
+		chaincodeID, key := fmt.Sprintf("chaincodeID%d", i%3), fmt.Sprintf("key%d", i)
+		value, proof, err := stateImplTestWrapper.stateImpl.GetStateProof(chaincodeID, key)
+		testutil.AssertNoError(t, err, "Error while getting proof")
+		testutil.AssertEquals(t, value, []byte(fmt.Sprintf("value%d", i)))
+		testutil.AssertNoError(t, VerifyStateProof(stateHash, chaincodeID, key, value, proof), "Error while verifying proof")
+		testutil.AssertError(t, VerifyStateProof(stateHash, chaincodeID, key, []byte("wrongValue"), proof), "Expected an error for a wrong value")
+		testutil.AssertError(t, VerifyStateProof(stateHash, chaincodeID, key, nil, proof), "Expected an error for a wrong absence")
+		testutil.AssertError(t, VerifyStateProof([]byte("wrongHash"), chaincodeID, key, value, proof), "Expected an error for a wrong state hash")
+	}
+
+	// absence of a key
+	value, proof, err := stateImplTestWrapper.stateImpl.GetStateProof("chaincodeID1", "missingKey")
+	testutil.AssertNoError(t, err, "Error while getting proof")
+	testutil.AssertNil(t, value)
+	testutil.AssertNoError(t, VerifyStateProof(stateHash, "chaincodeID1", "missingKey", nil, proof), "Error while verifying proof")
+	testutil.AssertError(t, VerifyStateProof(stateHash, "chaincodeID1", "missingKey", []byte("value"), proof), "Expected an error for a wrong presence")
+
+	// a proof is only valid for the key it was returned for
+	_, proof, err = stateImplTestWrapper.stateImpl.GetStateProof("chaincodeID0", "key0")
+	testutil.AssertNoError(t, err, "Error while getting proof")
+	testutil.AssertError(t, VerifyStateProof(stateHash, "chaincodeID1", "key1", []byte("value1"), proof), "Expected an error for a proof of another key")
+}
+
+func TestStateProof_Tampered(t *testing.T) {
+	testDBWrapper.CleanDB(t)
+	stateImplTestWrapper := newStateImplTestWrapperWithCustomConfig(t, 26, 3)
+	stateDelta := statemgmt.NewStateDelta()
+	stateDelta.Set("chaincodeID1", "key1", []byte("value1"), nil)
+	stateDelta.Set("chaincodeID2", "key2", []byte("value2"), nil)
+	stateHash := stateImplTestWrapper.prepareWorkingSetAndComputeCryptoHash(stateDelta)
+	stateImplTestWrapper.persistChangesAndResetInMemoryChanges()
+
+	value, proof, err := stateImplTestWrapper.stateImpl.GetStateProof("chaincodeID1", "key1")
+	testutil.AssertNoError(t, err, "Error while getting proof")
+	for i := range proof {
+		tamperedProof := append([]byte{}, proof...)
+		tamperedProof[i] ^= 0x01
+		testutil.AssertError(t, VerifyStateProof(stateHash, "chaincodeID1", "key1", value, tamperedProof), fmt.Sprintf("Expected an error for a proof tampered at byte [%d]", i))
+	}
+	testutil.AssertError(t, VerifyStateProof(stateHash, "chaincodeID1", "key1", value, proof[:len(proof)-1]), "Expected an error for a truncated proof")
+	testutil.AssertError(t, VerifyStateProof(stateHash, "chaincodeID1", "key1", value, nil), "Expected an error for an empty proof")
+}
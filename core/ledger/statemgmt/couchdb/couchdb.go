@@ -0,0 +1,177 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package couchdb
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// stateDocument is the document of a key of the state in CouchDB. Values
+// which are JSON are stored as they are, the others are stored in base64
+type stateDocument struct {
+	ID          string          `json:"_id"`
+	Rev         string          `json:"_rev,omitempty"`
+	Deleted     bool            `json:"_deleted,omitempty"`
+	ChaincodeID string          `json:"chaincodeID,omitempty"`
+	Key         string          `json:"key,omitempty"`
+	Value       json.RawMessage `json:"value,omitempty"`
+	Data        []byte          `json:"data,omitempty"`
+}
+
+// couchDB is a client of a database of a CouchDB server
+type couchDB struct {
+	dbURL    *url.URL
+	username string
+	password string
+	client   *http.Client
+}
+
+func newCouchDB(address string, name string, username string, password string, timeout time.Duration) (*couchDB, error) {
+	serverURL, err := url.Parse(address)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid CouchDB address %q: %s", address, err)
+	}
+	if serverURL.Scheme != "http" && serverURL.Scheme != "https" || serverURL.Host == "" {
+		return nil, fmt.Errorf("Invalid CouchDB address %q, expected an http or https URL", address)
+	}
+	if name == "" {
+		return nil, fmt.Errorf("The name of the CouchDB database is not set")
+	}
+	dbURL := *serverURL
+	dbURL.Path = strings.TrimSuffix(dbURL.Path, "/") + "/" + name
+	return &couchDB{&dbURL, username, password, &http.Client{Timeout: timeout}}, nil
+}
+
+// String returns the URL of the database, which identifies it
+func (couch *couchDB) String() string {
+	return couch.dbURL.String()
+}
+
+// createDatabase creates the database, returning false if it already exists
+func (couch *couchDB) createDatabase() (bool, error) {
+	resp, err := couch.do("PUT", "", nil, http.StatusCreated, http.StatusPreconditionFailed)
+	if err != nil {
+		return false, err
+	}
+	resp.Body.Close()
+	return resp.StatusCode == http.StatusCreated, nil
+}
+
+// deleteDatabase deletes the database and all its documents, if it exists
+func (couch *couchDB) deleteDatabase() error {
+	resp, err := couch.do("DELETE", "", nil, http.StatusOK, http.StatusNotFound)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+// revisions returns the current revisions of the documents which exist
+// among ids
+func (couch *couchDB) revisions(ids []string) (map[string]string, error) {
+	request := struct {
+		Keys []string `json:"keys"`
+	}{ids}
+	var response struct {
+		Rows []struct {
+			ID    string `json:"id"`
+			Value struct {
+				Rev     string `json:"rev"`
+				Deleted bool   `json:"deleted"`
+			} `json:"value"`
+		} `json:"rows"`
+	}
+	if err := couch.post("/_all_docs", request, &response); err != nil {
+		return nil, err
+	}
+	revisions := make(map[string]string)
+	for _, row := range response.Rows {
+		if row.ID != "" && !row.Value.Deleted {
+			revisions[row.ID] = row.Value.Rev
+		}
+	}
+	return revisions, nil
+}
+
+// bulkDocs writes documents in a single request, failing if any is not
+// written
+func (couch *couchDB) bulkDocs(docs []*stateDocument) error {
+	request := struct {
+		Docs []*stateDocument `json:"docs"`
+	}{docs}
+	var response []struct {
+		ID     string `json:"id"`
+		Error  string `json:"error"`
+		Reason string `json:"reason"`
+	}
+	if err := couch.post("/_bulk_docs", request, &response); err != nil {
+		return err
+	}
+	for _, result := range response {
+		if result.Error != "" {
+			return fmt.Errorf("Writing document %s to CouchDB failed: %s %s", result.ID, result.Error, result.Reason)
+		}
+	}
+	return nil
+}
+
+func (couch *couchDB) post(path string, request interface{}, response interface{}) error {
+	body, err := json.Marshal(request)
+	if err != nil {
+		return err
+	}
+	resp, err := couch.do("POST", path, body, http.StatusOK, http.StatusCreated)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	return json.NewDecoder(resp.Body).Decode(response)
+}
+
+func (couch *couchDB) do(method string, path string, body []byte, expected ...int) (*http.Response, error) {
+	req, err := http.NewRequest(method, couch.dbURL.String()+path, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if couch.username != "" {
+		req.SetBasicAuth(couch.username, couch.password)
+	}
+	resp, err := couch.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	for _, status := range expected {
+		if resp.StatusCode == status {
+			return resp, nil
+		}
+	}
+	defer resp.Body.Close()
+	msg, _ := ioutil.ReadAll(&io.LimitedReader{R: resp.Body, N: 1024})
+	return nil, fmt.Errorf("%s %s of CouchDB database failed: %s %s", method, path, resp.Status, msg)
+}
@@ -0,0 +1,178 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package couchdb
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/hyperledger/fabric/core/db"
+	"github.com/hyperledger/fabric/core/ledger/statemgmt"
+	"github.com/hyperledger/fabric/core/ledger/testutil"
+)
+
+var testDBWrapper = db.NewTestDBWrapper()
+
+func TestMain(m *testing.M) {
+	testutil.SetupTestConfig()
+	os.Exit(m.Run())
+}
+
+// fakeCouchDB serves the part of the CouchDB API used by the state
+type fakeCouchDB struct {
+	lock      sync.Mutex
+	server    *httptest.Server
+	databases map[string]map[string]map[string]interface{}
+	revision  int
+	down      bool
+}
+
+func newFakeCouchDB() *fakeCouchDB {
+	couch := &fakeCouchDB{databases: make(map[string]map[string]map[string]interface{})}
+	couch.server = httptest.NewServer(couch)
+	return couch
+}
+
+func (couch *fakeCouchDB) close() {
+	couch.server.Close()
+}
+
+func (couch *fakeCouchDB) setDown(down bool) {
+	couch.lock.Lock()
+	defer couch.lock.Unlock()
+	couch.down = down
+}
+
+// document returns the document of a key in a database, or nil if none exists
+func (couch *fakeCouchDB) document(database string, chaincodeID string, key string) map[string]interface{} {
+	couch.lock.Lock()
+	defer couch.lock.Unlock()
+	return couch.databases[database][documentID(chaincodeID, key)]
+}
+
+func (couch *fakeCouchDB) numDocuments(database string) int {
+	couch.lock.Lock()
+	defer couch.lock.Unlock()
+	return len(couch.databases[database])
+}
+
+func (couch *fakeCouchDB) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	couch.lock.Lock()
+	defer couch.lock.Unlock()
+	if couch.down {
+		http.Error(w, `{"error":"unavailable"}`, http.StatusServiceUnavailable)
+		return
+	}
+	parts := strings.SplitN(strings.TrimPrefix(r.URL.Path, "/"), "/", 2)
+	database, docs := parts[0], couch.databases[parts[0]]
+	switch {
+	case len(parts) == 1 && r.Method == "PUT":
+		if docs != nil {
+			http.Error(w, `{"error":"file_exists"}`, http.StatusPreconditionFailed)
+			return
+		}
+		couch.databases[database] = make(map[string]map[string]interface{})
+		w.WriteHeader(http.StatusCreated)
+	case len(parts) == 1 && r.Method == "DELETE":
+		if docs == nil {
+			http.Error(w, `{"error":"not_found"}`, http.StatusNotFound)
+			return
+		}
+		delete(couch.databases, database)
+	case docs == nil:
+		http.Error(w, `{"error":"not_found"}`, http.StatusNotFound)
+	case parts[1] == "_all_docs" && r.Method == "POST":
+		var request struct {
+			Keys []string `json:"keys"`
+		}
+		json.NewDecoder(r.Body).Decode(&request)
+		var rows []interface{}
+		for _, id := range request.Keys {
+			if doc, ok := docs[id]; ok {
+				rows = append(rows, map[string]interface{}{"id": id, "key": id, "value": map[string]interface{}{"rev": doc["_rev"]}})
+			} else {
+				rows = append(rows, map[string]interface{}{"key": id, "error": "not_found"})
+			}
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"rows": rows})
+	case parts[1] == "_bulk_docs" && r.Method == "POST":
+		var request struct {
+			Docs []map[string]interface{} `json:"docs"`
+		}
+		json.NewDecoder(r.Body).Decode(&request)
+		var results []interface{}
+		for _, doc := range request.Docs {
+			id := doc["_id"].(string)
+			current, exists := docs[id]
+			if exists && doc["_rev"] != current["_rev"] || !exists && doc["_rev"] != nil {
+				results = append(results, map[string]interface{}{"id": id, "error": "conflict", "reason": "Document update conflict."})
+				continue
+			}
+			if doc["_deleted"] == true {
+				delete(docs, id)
+			} else {
+				couch.revision++
+				doc["_rev"] = fmt.Sprintf("%d-rev", couch.revision)
+				docs[id] = doc
+			}
+			results = append(results, map[string]interface{}{"id": id, "ok": true})
+		}
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(results)
+	default:
+		http.Error(w, `{"error":"not_found"}`, http.StatusNotFound)
+	}
+}
+
+type stateImplTestWrapper struct {
+	configMap map[string]interface{}
+	stateImpl *StateImpl
+	t         testing.TB
+}
+
+func newStateImplTestWrapper(t testing.TB, couch *fakeCouchDB, database string) *stateImplTestWrapper {
+	configMap := map[string]interface{}{ConfigAddress: couch.server.URL, ConfigDatabase: database}
+	stateImpl := NewStateImpl(db.GetDBHandle())
+	err := stateImpl.Initialize(configMap)
+	testutil.AssertNoError(t, err, "Error while constructing stateImpl")
+	return &stateImplTestWrapper{configMap, stateImpl, t}
+}
+
+func (testWrapper *stateImplTestWrapper) persistChangesAndResetInMemoryChanges(stateDelta *statemgmt.StateDelta) {
+	err := testWrapper.stateImpl.PrepareWorkingSet(stateDelta)
+	testutil.AssertNoError(testWrapper.t, err, "Error while PrepareWorkingSet")
+	_, err = testWrapper.stateImpl.ComputeCryptoHash()
+	testutil.AssertNoError(testWrapper.t, err, "Error while computing crypto hash")
+	writeBatch := db.GetDBHandle().NewWriteBatch()
+	defer writeBatch.Destroy()
+	err = testWrapper.stateImpl.AddChangesForPersistence(writeBatch)
+	testutil.AssertNoError(testWrapper.t, err, "Error while adding changes to db write-batch")
+	testDBWrapper.WriteToDB(testWrapper.t, writeBatch)
+	testWrapper.stateImpl.ClearWorkingSet(true)
+}
+
+func getPersisted(t testing.TB, key []byte) []byte {
+	value, err := db.GetDBHandle().Get(db.GetDBHandle().PersistCF, key)
+	testutil.AssertNoError(t, err, "Error while getting value from persist column family")
+	return value
+}
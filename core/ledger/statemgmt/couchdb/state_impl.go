@@ -0,0 +1,349 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package couchdb
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/hyperledger/fabric/core/db"
+	"github.com/hyperledger/fabric/core/ledger/statemgmt"
+	"github.com/hyperledger/fabric/core/ledger/statemgmt/buckettree"
+	"github.com/op/go-logging"
+)
+
+var logger = logging.MustGetLogger("couchdb")
+
+// ConfigAddress - config name 'couchDBAddress' as it appears in yaml file
+const ConfigAddress = "couchDBAddress"
+
+// ConfigDatabase - config name 'couchDBDatabase' as it appears in yaml file
+const ConfigDatabase = "couchDBDatabase"
+
+// ConfigUsername - config name 'couchDBUsername' as it appears in yaml file
+const ConfigUsername = "couchDBUsername"
+
+// ConfigPassword - config name 'couchDBPassword' as it appears in yaml file
+const ConfigPassword = "couchDBPassword"
+
+// ConfigRequestTimeout - config name 'couchDBRequestTimeout' as it appears in yaml file
+const ConfigRequestTimeout = "couchDBRequestTimeout"
+
+// DefaultAddress - address of the CouchDB server
+const DefaultAddress = "http://127.0.0.1:5984"
+
+// DefaultDatabase - name of the database of the state
+const DefaultDatabase = "fabric_state"
+
+// DefaultRequestTimeout - timeout of the requests to CouchDB
+const DefaultRequestTimeout = 30 * time.Second
+
+// The changes committed but not copied to CouchDB yet, and the database the
+// state was copied to, are kept in the persist column family
+var pendingDeltaKey = []byte("couchDBPendingDelta")
+var copiedDatabaseKey = []byte("couchDBDatabase")
+
+// Documents written to CouchDB in a single request
+const bulkSize = 500
+
+// StateImpl - implements the interface - 'statemgmt.HashableState'
+// The state is kept, and its crypto-hash computed, by the bucket tree. Once committed,
+// the changes are copied to CouchDB, where each key of the state is a document which
+// external tools can query. The ledger itself reads the state from the bucket tree.
+type StateImpl struct {
+	*buckettree.StateImpl
+	couch        *couchDB
+	stateDelta   *statemgmt.StateDelta
+	pendingDelta *statemgmt.StateDelta // committed but not copied to CouchDB yet
+	mergedDelta  *statemgmt.StateDelta // pendingDelta along with stateDelta, once persisted
+	openchainDB  *db.OpenchainDB
+}
+
+// NewStateImpl constructs a new StateImpl kept in openchainDB
+func NewStateImpl(openchainDB *db.OpenchainDB) *StateImpl {
+	return &StateImpl{StateImpl: buckettree.NewStateImpl(openchainDB), openchainDB: openchainDB}
+}
+
+// Initialize - method implementation for interface 'statemgmt.HashableState'
+// The whole state is copied to the database the first time it is used. Otherwise the
+// changes which could not be copied before the peer stopped are copied again.
+func (stateImpl *StateImpl) Initialize(configs map[string]interface{}) error {
+	err := stateImpl.StateImpl.Initialize(configs)
+	if err != nil {
+		return err
+	}
+	stateImpl.couch, err = newCouchDBFromConfigs(configs)
+	if err != nil {
+		return err
+	}
+	logger.Infof("Initializing CouchDB state implementation with database %s", stateImpl.couch)
+
+	created, err := stateImpl.couch.createDatabase()
+	if err != nil {
+		return err
+	}
+	copiedDatabase, err := stateImpl.openchainDB.Get(stateImpl.openchainDB.PersistCF, copiedDatabaseKey)
+	if err != nil {
+		return err
+	}
+	if created || string(copiedDatabase) != stateImpl.couch.String() {
+		return stateImpl.copyState()
+	}
+
+	pendingDeltaBytes, err := stateImpl.openchainDB.Get(stateImpl.openchainDB.PersistCF, pendingDeltaKey)
+	if err != nil {
+		return err
+	}
+	if pendingDeltaBytes != nil {
+		stateImpl.pendingDelta = statemgmt.NewStateDelta()
+		if err = stateImpl.pendingDelta.Unmarshal(pendingDeltaBytes); err != nil {
+			return err
+		}
+		stateImpl.copyPendingDelta()
+	}
+	return nil
+}
+
+func newCouchDBFromConfigs(configs map[string]interface{}) (*couchDB, error) {
+	address, ok := configs[ConfigAddress].(string)
+	if !ok {
+		address = DefaultAddress
+	}
+	database, ok := configs[ConfigDatabase].(string)
+	if !ok {
+		database = DefaultDatabase
+	}
+	username, _ := configs[ConfigUsername].(string)
+	password, _ := configs[ConfigPassword].(string)
+	timeout := DefaultRequestTimeout
+	if timeoutConfig, ok := configs[ConfigRequestTimeout].(string); ok {
+		var err error
+		if timeout, err = time.ParseDuration(timeoutConfig); err != nil {
+			return nil, fmt.Errorf("Invalid %s %q: %s", ConfigRequestTimeout, timeoutConfig, err)
+		}
+	}
+	return newCouchDB(address, database, username, password, timeout)
+}
+
+// PrepareWorkingSet - method implementation for interface 'statemgmt.HashableState'
+func (stateImpl *StateImpl) PrepareWorkingSet(stateDelta *statemgmt.StateDelta) error {
+	stateImpl.stateDelta = stateDelta
+	return stateImpl.StateImpl.PrepareWorkingSet(stateDelta)
+}
+
+// AddChangesForPersistence - method implementation for interface 'statemgmt.HashableState'
+// The changes are recorded as pending along with the state, until they are copied to CouchDB
+func (stateImpl *StateImpl) AddChangesForPersistence(writeBatch db.WriteBatch) error {
+	err := stateImpl.StateImpl.AddChangesForPersistence(writeBatch)
+	if err != nil {
+		return err
+	}
+	mergedDelta := statemgmt.NewStateDelta()
+	if stateImpl.pendingDelta != nil {
+		mergedDelta.ApplyChanges(stateImpl.pendingDelta)
+	}
+	if stateImpl.stateDelta != nil {
+		mergedDelta.ApplyChanges(forwardDelta(stateImpl.stateDelta))
+	}
+	if !mergedDelta.IsEmpty() {
+		writeBatch.PutCF(stateImpl.openchainDB.PersistCF, pendingDeltaKey, mergedDelta.Marshal())
+		stateImpl.mergedDelta = mergedDelta
+	}
+	return nil
+}
+
+// ClearWorkingSet - method implementation for interface 'statemgmt.HashableState'
+// The changes persisted are copied to CouchDB. If this fails, they are copied again
+// along with the changes of the next commit, or when the peer restarts.
+func (stateImpl *StateImpl) ClearWorkingSet(changesPersisted bool) {
+	stateImpl.StateImpl.ClearWorkingSet(changesPersisted)
+	if changesPersisted && stateImpl.mergedDelta != nil {
+		stateImpl.pendingDelta = stateImpl.mergedDelta
+		stateImpl.copyPendingDelta()
+	}
+	stateImpl.stateDelta = nil
+	stateImpl.mergedDelta = nil
+}
+
+// DeleteExternalState - method implementation for interface 'statemgmt.ExternalState'
+func (stateImpl *StateImpl) DeleteExternalState() error {
+	if err := stateImpl.couch.deleteDatabase(); err != nil {
+		return err
+	}
+	if _, err := stateImpl.couch.createDatabase(); err != nil {
+		return err
+	}
+	stateImpl.pendingDelta = nil
+	return stateImpl.openchainDB.Delete(stateImpl.openchainDB.PersistCF, pendingDeltaKey)
+}
+
+func (stateImpl *StateImpl) copyPendingDelta() {
+	if err := stateImpl.writeDelta(stateImpl.pendingDelta); err != nil {
+		logger.Warningf("Could not copy the state to CouchDB, retrying with the next commit: %s", err)
+		return
+	}
+	if err := stateImpl.openchainDB.Delete(stateImpl.openchainDB.PersistCF, pendingDeltaKey); err != nil {
+		logger.Warningf("Could not delete the changes copied to CouchDB: %s", err)
+		return
+	}
+	stateImpl.pendingDelta = nil
+}
+
+// writeDelta writes the changes of a delta to CouchDB
+func (stateImpl *StateImpl) writeDelta(delta *statemgmt.StateDelta) error {
+	type update struct {
+		chaincodeID string
+		key         string
+		value       []byte
+	}
+	var updates []update
+	for _, chaincodeID := range delta.GetUpdatedChaincodeIds(true) {
+		var keys []string
+		updatedValues := delta.GetUpdates(chaincodeID)
+		for key := range updatedValues {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			updates = append(updates, update{chaincodeID, key, updatedValues[key].GetValue()})
+		}
+	}
+
+	for start := 0; start < len(updates); start += bulkSize {
+		end := start + bulkSize
+		if end > len(updates) {
+			end = len(updates)
+		}
+		ids := make([]string, 0, end-start)
+		for _, u := range updates[start:end] {
+			ids = append(ids, documentID(u.chaincodeID, u.key))
+		}
+		revisions, err := stateImpl.couch.revisions(ids)
+		if err != nil {
+			return err
+		}
+		var docs []*stateDocument
+		for i, u := range updates[start:end] {
+			rev, exists := revisions[ids[i]]
+			if u.value == nil {
+				if exists {
+					docs = append(docs, &stateDocument{ID: ids[i], Rev: rev, Deleted: true})
+				}
+				continue
+			}
+			doc := newStateDocument(u.chaincodeID, u.key, u.value)
+			doc.Rev = rev
+			docs = append(docs, doc)
+		}
+		if len(docs) == 0 {
+			continue
+		}
+		if err = stateImpl.couch.bulkDocs(docs); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// copyState copies the whole state to a new database
+func (stateImpl *StateImpl) copyState() error {
+	logger.Infof("Copying the state to CouchDB database %s", stateImpl.couch)
+	err := stateImpl.couch.deleteDatabase()
+	if err != nil {
+		return err
+	}
+	if _, err = stateImpl.couch.createDatabase(); err != nil {
+		return err
+	}
+
+	dbSnapshot := stateImpl.openchainDB.GetSnapshot()
+	defer dbSnapshot.Release()
+	itr, err := stateImpl.StateImpl.GetStateSnapshotIterator(dbSnapshot)
+	if err != nil {
+		return err
+	}
+	defer itr.Close()
+	var docs []*stateDocument
+	count := 0
+	for itr.Next() {
+		compositeKey, value := itr.GetRawKeyValue()
+		chaincodeID, key := statemgmt.DecodeCompositeKey(compositeKey)
+		docs = append(docs, newStateDocument(chaincodeID, key, value))
+		if len(docs) == bulkSize {
+			if err = stateImpl.couch.bulkDocs(docs); err != nil {
+				return err
+			}
+			count += len(docs)
+			docs = nil
+		}
+	}
+	if len(docs) > 0 {
+		if err = stateImpl.couch.bulkDocs(docs); err != nil {
+			return err
+		}
+		count += len(docs)
+	}
+
+	writeBatch := stateImpl.openchainDB.NewWriteBatch()
+	defer writeBatch.Destroy()
+	writeBatch.PutCF(stateImpl.openchainDB.PersistCF, copiedDatabaseKey, []byte(stateImpl.couch.String()))
+	writeBatch.DeleteCF(stateImpl.openchainDB.PersistCF, pendingDeltaKey)
+	if err = stateImpl.openchainDB.Write(writeBatch); err != nil {
+		return err
+	}
+	stateImpl.pendingDelta = nil
+	logger.Infof("Copied %d keys of the state to CouchDB", count)
+	return nil
+}
+
+// forwardDelta returns the changes of a delta as they apply, whether it rolls
+// the state forwards or backwards
+func forwardDelta(delta *statemgmt.StateDelta) *statemgmt.StateDelta {
+	if !delta.RollBackwards {
+		return delta
+	}
+	forward := statemgmt.NewStateDelta()
+	for _, chaincodeID := range delta.GetUpdatedChaincodeIds(false) {
+		for key, updatedValue := range delta.GetUpdates(chaincodeID) {
+			if previousValue := updatedValue.GetPreviousValue(); previousValue != nil {
+				forward.Set(chaincodeID, key, previousValue, nil)
+			} else {
+				forward.Delete(chaincodeID, key, nil)
+			}
+		}
+	}
+	return forward
+}
+
+// documentID returns the ID of the document of a key. The composite key is
+// hex encoded, as it is not always valid UTF-8.
+func documentID(chaincodeID string, key string) string {
+	return hex.EncodeToString(statemgmt.ConstructCompositeKey(chaincodeID, key))
+}
+
+func newStateDocument(chaincodeID string, key string, value []byte) *stateDocument {
+	doc := &stateDocument{ID: documentID(chaincodeID, key), ChaincodeID: chaincodeID, Key: key}
+	if json.Valid(value) {
+		doc.Value = json.RawMessage(value)
+	} else {
+		doc.Data = value
+	}
+	return doc
+}
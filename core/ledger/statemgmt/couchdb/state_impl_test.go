@@ -0,0 +1,168 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package couchdb
+
+import (
+	"encoding/base64"
+	"testing"
+
+	"github.com/hyperledger/fabric/core/db"
+	"github.com/hyperledger/fabric/core/ledger/statemgmt"
+	"github.com/hyperledger/fabric/core/ledger/testutil"
+)
+
+func TestStateImplCopiesChanges(t *testing.T) {
+	testDBWrapper.CleanDB(t)
+	couch := newFakeCouchDB()
+	defer couch.close()
+	stateImplTestWrapper := newStateImplTestWrapper(t, couch, "state")
+
+	stateDelta := statemgmt.NewStateDelta()
+	stateDelta.Set("chaincodeID1", "key1", []byte(`{"color":"red"}`), nil)
+	stateDelta.Set("chaincodeID1", "key2", []byte("value2"), nil)
+	stateDelta.Set("chaincodeID2", "key1", []byte("12"), nil)
+	stateImplTestWrapper.persistChangesAndResetInMemoryChanges(stateDelta)
+
+	doc := couch.document("state", "chaincodeID1", "key1")
+	testutil.AssertEquals(t, doc["chaincodeID"], "chaincodeID1")
+	testutil.AssertEquals(t, doc["key"], "key1")
+	testutil.AssertEquals(t, doc["value"], map[string]interface{}{"color": "red"})
+	doc = couch.document("state", "chaincodeID1", "key2")
+	testutil.AssertEquals(t, doc["data"], base64.StdEncoding.EncodeToString([]byte("value2")))
+	testutil.AssertNil(t, doc["value"])
+	testutil.AssertEquals(t, couch.document("state", "chaincodeID2", "key1")["value"], float64(12))
+
+	stateDelta = statemgmt.NewStateDelta()
+	stateDelta.Set("chaincodeID1", "key1", []byte(`{"color":"blue"}`), nil)
+	stateDelta.Delete("chaincodeID1", "key2", nil)
+	stateDelta.Delete("chaincodeID1", "key3", nil)
+	stateImplTestWrapper.persistChangesAndResetInMemoryChanges(stateDelta)
+	testutil.AssertEquals(t, couch.document("state", "chaincodeID1", "key1")["value"], map[string]interface{}{"color": "blue"})
+	testutil.AssertNil(t, couch.document("state", "chaincodeID1", "key2"))
+	testutil.AssertEquals(t, couch.numDocuments("state"), 2)
+
+	// the state itself is still read from the bucket tree
+	value, err := stateImplTestWrapper.stateImpl.Get("chaincodeID1", "key1")
+	testutil.AssertNoError(t, err, "Error while getting value")
+	testutil.AssertEquals(t, value, []byte(`{"color":"blue"}`))
+}
+
+func TestStateImplRollBackwards(t *testing.T) {
+	testDBWrapper.CleanDB(t)
+	couch := newFakeCouchDB()
+	defer couch.close()
+	stateImplTestWrapper := newStateImplTestWrapper(t, couch, "state")
+
+	stateDelta := statemgmt.NewStateDelta()
+	stateDelta.Set("chaincodeID1", "key1", []byte("1"), nil)
+	stateImplTestWrapper.persistChangesAndResetInMemoryChanges(stateDelta)
+
+	stateDelta = statemgmt.NewStateDelta()
+	stateDelta.Set("chaincodeID1", "key1", []byte("2"), []byte("1"))
+	stateDelta.Set("chaincodeID1", "key2", []byte("3"), nil)
+	stateImplTestWrapper.persistChangesAndResetInMemoryChanges(stateDelta)
+	testutil.AssertEquals(t, couch.numDocuments("state"), 2)
+
+	stateDelta.RollBackwards = true
+	stateImplTestWrapper.persistChangesAndResetInMemoryChanges(stateDelta)
+	testutil.AssertEquals(t, couch.document("state", "chaincodeID1", "key1")["value"], float64(1))
+	testutil.AssertNil(t, couch.document("state", "chaincodeID1", "key2"))
+}
+
+func TestStateImplRetriesWhenCouchDBIsDown(t *testing.T) {
+	testDBWrapper.CleanDB(t)
+	couch := newFakeCouchDB()
+	defer couch.close()
+	stateImplTestWrapper := newStateImplTestWrapper(t, couch, "state")
+
+	couch.setDown(true)
+	stateDelta := statemgmt.NewStateDelta()
+	stateDelta.Set("chaincodeID1", "key1", []byte("value1"), nil)
+	stateImplTestWrapper.persistChangesAndResetInMemoryChanges(stateDelta)
+	testutil.AssertNotNil(t, getPersisted(t, pendingDeltaKey))
+
+	// the changes which were not copied are copied along with the next ones
+	couch.setDown(false)
+	stateDelta = statemgmt.NewStateDelta()
+	stateDelta.Set("chaincodeID1", "key2", []byte("value2"), nil)
+	stateImplTestWrapper.persistChangesAndResetInMemoryChanges(stateDelta)
+	testutil.AssertEquals(t, couch.numDocuments("state"), 2)
+	testutil.AssertNil(t, getPersisted(t, pendingDeltaKey))
+
+	// or when the peer restarts
+	couch.setDown(true)
+	stateDelta = statemgmt.NewStateDelta()
+	stateDelta.Delete("chaincodeID1", "key1", nil)
+	stateImplTestWrapper.persistChangesAndResetInMemoryChanges(stateDelta)
+	couch.setDown(false)
+	testutil.AssertEquals(t, couch.numDocuments("state"), 2)
+	newStateImplTestWrapper(t, couch, "state")
+	testutil.AssertNil(t, couch.document("state", "chaincodeID1", "key1"))
+	testutil.AssertEquals(t, couch.numDocuments("state"), 1)
+	testutil.AssertNil(t, getPersisted(t, pendingDeltaKey))
+}
+
+func TestStateImplCopiesState(t *testing.T) {
+	testDBWrapper.CleanDB(t)
+	couch := newFakeCouchDB()
+	defer couch.close()
+	stateImplTestWrapper := newStateImplTestWrapper(t, couch, "state")
+	stateDelta := statemgmt.NewStateDelta()
+	for i := 0; i < bulkSize+10; i++ {
+		stateDelta.Set("chaincodeID1", string(rune('a'+i%26))+string(rune('a'+i/26)), []byte("value"), nil)
+	}
+	stateImplTestWrapper.persistChangesAndResetInMemoryChanges(stateDelta)
+	testutil.AssertEquals(t, couch.numDocuments("state"), bulkSize+10)
+
+	// a database not used before gets the whole state
+	newStateImplTestWrapper(t, couch, "otherstate")
+	testutil.AssertEquals(t, couch.numDocuments("otherstate"), bulkSize+10)
+	testutil.AssertEquals(t, string(getPersisted(t, copiedDatabaseKey)), couch.server.URL+"/otherstate")
+
+	// as does a database which was deleted
+	couch.lock.Lock()
+	delete(couch.databases, "otherstate")
+	couch.lock.Unlock()
+	newStateImplTestWrapper(t, couch, "otherstate")
+	testutil.AssertEquals(t, couch.numDocuments("otherstate"), bulkSize+10)
+}
+
+func TestStateImplDeleteExternalState(t *testing.T) {
+	testDBWrapper.CleanDB(t)
+	couch := newFakeCouchDB()
+	defer couch.close()
+	stateImplTestWrapper := newStateImplTestWrapper(t, couch, "state")
+	stateDelta := statemgmt.NewStateDelta()
+	stateDelta.Set("chaincodeID1", "key1", []byte("value1"), nil)
+	stateImplTestWrapper.persistChangesAndResetInMemoryChanges(stateDelta)
+
+	var externalState statemgmt.ExternalState = stateImplTestWrapper.stateImpl
+	err := externalState.DeleteExternalState()
+	testutil.AssertNoError(t, err, "Error while deleting the copy of the state")
+	testutil.AssertEquals(t, couch.numDocuments("state"), 0)
+	_, ok := couch.databases["state"]
+	testutil.AssertEquals(t, ok, true)
+}
+
+func TestStateImplInvalidConfig(t *testing.T) {
+	testDBWrapper.CleanDB(t)
+	stateImpl := NewStateImpl(db.GetDBHandle())
+	err := stateImpl.Initialize(map[string]interface{}{ConfigAddress: "localhost:5984"})
+	testutil.AssertError(t, err, "Expected an error for an address which is not a URL")
+	err = stateImpl.Initialize(map[string]interface{}{ConfigAddress: "http://localhost:5984", ConfigRequestTimeout: "soon"})
+	testutil.AssertError(t, err, "Expected an error for an invalid timeout")
+}
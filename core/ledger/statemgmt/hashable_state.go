@@ -17,7 +17,7 @@ limitations under the License.
 package statemgmt
 
 import (
-	"github.com/tecbot/gorocksdb"
+	"github.com/hyperledger/fabric/core/db"
 )
 
 // HashableState - Interface that is be implemented by state management
@@ -42,7 +42,7 @@ type HashableState interface {
 	// to persist for committing the  stateDelta (passed in PrepareWorkingSet method) to DB.
 	// In addition to the information in the StateDelta, the implementation may also want to
 	// persist intermediate results for faster crypto-hash computation
-	AddChangesForPersistence(writeBatch *gorocksdb.WriteBatch) error
+	AddChangesForPersistence(writeBatch db.WriteBatch) error
 
 	// ClearWorkingSet state implementation may clear any data structures that it may have constructed
 	// for computing cryptoHash and persisting the changes for the stateDelta (passed in PrepareWorkingSet method)
@@ -52,7 +52,7 @@ type HashableState interface {
 	// All the key-value of global state. A particular implementation may need to remove additional information
 	// that the implementation keeps for faster crypto-hash computation. For instance, filter a few of the
 	// key-values or remove some data from particular key-values.
-	GetStateSnapshotIterator(snapshot *gorocksdb.Snapshot) (StateSnapshotIterator, error)
+	GetStateSnapshotIterator(snapshot db.Snapshot) (StateSnapshotIterator, error)
 
 	// GetRangeScanIterator - state implementation to provide an iterator that is supposed to give
 	// All the key-values for a given chaincodeID such that a return key should be lexically greater than or
@@ -68,6 +68,33 @@ type HashableState interface {
 	PerfHintKeyChanged(chaincodeID string, key string)
 }
 
+// RangeScanResumer - Interface that may be implemented along with HashableState by the state
+// implementations whose range scans return the keys in an order which only depends on the keys,
+// so that a scan can resume after the last key returned by a previous one
+type RangeScanResumer interface {
+
+	// GetRangeScanIteratorAfter returns an iterator over the key-values which an iterator of
+	// GetRangeScanIterator for the same range gives after lastKey, lastKey being in the range
+	GetRangeScanIteratorAfter(chaincodeID string, startKey string, endKey string, lastKey string) (RangeScanIterator, error)
+}
+
+// StateProver - Interface that may be implemented along with HashableState by the state
+// implementations which can prove the value of a key against the crypto-hash of the state
+type StateProver interface {
+
+	// GetStateProof returns the committed value for the key (nil if the key does not exist) and
+	// a proof that the state whose crypto-hash was last persisted has this value for the key
+	GetStateProof(chaincodeID string, key string) ([]byte, []byte, error)
+}
+
+// ExternalState - Interface that may be implemented along with HashableState by the state
+// implementations which also copy the state outside of the peer's database
+type ExternalState interface {
+
+	// DeleteExternalState deletes the copy of the state, when the state itself is deleted
+	DeleteExternalState() error
+}
+
 // StateSnapshotIterator An interface that is to be implemented by the return value of
 // GetStateSnapshotIterator method in the implementation of HashableState interface
 type StateSnapshotIterator interface {
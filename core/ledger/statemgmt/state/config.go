@@ -20,6 +20,8 @@ import (
 	"fmt"
 	"sync"
 
+	"github.com/hyperledger/fabric/core/db"
+	"github.com/hyperledger/fabric/core/ledger/statemgmt/couchdb"
 	"github.com/spf13/viper"
 )
 
@@ -28,6 +30,11 @@ var loadConfigOnce sync.Once
 var stateImplName string
 var stateImplConfigs map[string]interface{}
 var deltaHistorySize int
+var historyQueryBlocks int
+var indexesEnabled bool
+var asyncIndexes bool
+var deltaCompression bool
+var readCacheSize int
 
 func initConfig() {
 	loadConfigOnce.Do(func() { loadConfig() })
@@ -44,11 +51,44 @@ func loadConfig() {
 	if len(stateImplName) == 0 {
 		stateImplName = detaultStateImpl
 		stateImplConfigs = nil
-	} else if stateImplName != "buckettree" && stateImplName != "trie" && stateImplName != "raw" {
+	} else if stateImplName != "buckettree" && stateImplName != "trie" && stateImplName != "raw" && stateImplName != "couchdb" {
 		panic(fmt.Errorf("Error during initialization of state implementation. State data structure '%s' is not valid.", stateImplName))
 	}
 
 	if deltaHistorySize < 0 {
 		panic(fmt.Errorf("Delta history size must be greater than or equal to 0. Current value is %d.", deltaHistorySize))
 	}
+
+	historyQueryBlocks = viper.GetInt("ledger.state.historyQueryBlocks")
+	if historyQueryBlocks < 0 {
+		panic(fmt.Errorf("Blocks whose state can be queried must be greater than or equal to 0. Current value is %d.", historyQueryBlocks))
+	}
+	// The state of a block is read by rolling back the deltas of the blocks committed since
+	if deltaHistorySize < historyQueryBlocks {
+		logger.Infof("Keeping the state deltas of %d blocks rather than %d, as many as the blocks whose state can be queried", historyQueryBlocks, deltaHistorySize)
+		deltaHistorySize = historyQueryBlocks
+	}
+
+	indexesEnabled = viper.GetBool("ledger.state.indexes.enabled")
+	asyncIndexes = viper.GetBool("ledger.commit.asyncIndexes")
+	deltaCompression = viper.GetBool("ledger.state.deltaCompression")
+	readCacheSize = viper.GetInt("ledger.state.readCacheSize")
+}
+
+// chainStateImplConfigs returns the configs of the state implementation of a chain. The state of
+// each chain other than the default one is copied to a CouchDB database of its own
+func chainStateImplConfigs(chainID string) map[string]interface{} {
+	if chainID == db.DefaultChainID || stateImplName != "couchdb" {
+		return stateImplConfigs
+	}
+	configs := make(map[string]interface{}, len(stateImplConfigs)+1)
+	for name, value := range stateImplConfigs {
+		configs[name] = value
+	}
+	database, ok := configs[couchdb.ConfigDatabase].(string)
+	if !ok {
+		database = couchdb.DefaultDatabase
+	}
+	configs[couchdb.ConfigDatabase] = database + "_" + chainID
+	return configs
 }
@@ -0,0 +1,191 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package state
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/hyperledger/fabric/core/ledger/statemgmt"
+)
+
+// RangeScanFilter selects the key-values returned by a filtered range scan,
+// so that the tools scanning the state do not have to pull the key-values
+// they would discard
+type RangeScanFilter struct {
+	// KeyPrefix, if not empty, selects the keys starting with it
+	KeyPrefix string
+	// ModifiedSinceBlock, if greater than 0, selects the keys set by the
+	// blocks numbered ModifiedSinceBlock or higher. The state deltas of these
+	// blocks must still be kept, see ledger.state.deltaHistorySize
+	ModifiedSinceBlock uint64
+	// MaxValueSize, if greater than 0, skips the keys whose value is larger
+	MaxValueSize int
+}
+
+// GetFilteredRangeScanIterator returns an iterator over the key-values of the
+// committed state of a chaincodeID between startKey and endKey which pass the
+// filter, size being the size of the blockchain. As the iterator returned by
+// GetRangeScanIterator, it returns the key-values in no specific order.
+func (state *State) GetFilteredRangeScanIterator(chaincodeID string, startKey string, endKey string, filter *RangeScanFilter, size uint64) (statemgmt.RangeScanIterator, error) {
+	if filter.MaxValueSize < 0 {
+		return nil, fmt.Errorf("Maximum value size must be greater than or equal to 0. Current value is %d.", filter.MaxValueSize)
+	}
+	if filter.KeyPrefix != "" {
+		startKey, endKey = narrowRangeToPrefix(startKey, endKey, filter.KeyPrefix)
+	}
+
+	var itr statemgmt.RangeScanIterator
+	if filter.ModifiedSinceBlock > 0 {
+		keys, err := state.getKeysModifiedSince(chaincodeID, startKey, endKey, filter, size)
+		if err != nil {
+			return nil, err
+		}
+		itr = &keysRangeScanIterator{stateImpl: state.stateImpl, chaincodeID: chaincodeID, keys: keys}
+	} else {
+		var err error
+		if itr, err = state.stateImpl.GetRangeScanIterator(chaincodeID, startKey, endKey); err != nil {
+			return nil, err
+		}
+	}
+	return &filteredRangeScanIterator{itr: itr, filter: filter}, nil
+}
+
+// getKeysModifiedSince returns the sorted keys between startKey and endKey set
+// or deleted by the blocks numbered filter.ModifiedSinceBlock or higher
+func (state *State) getKeysModifiedSince(chaincodeID string, startKey string, endKey string, filter *RangeScanFilter, size uint64) ([]string, error) {
+	if filter.ModifiedSinceBlock > size {
+		return nil, fmt.Errorf("Block %d was not committed, the blockchain has %d blocks", filter.ModifiedSinceBlock, size)
+	}
+	modified := make(map[string]bool)
+	for blockNumber := filter.ModifiedSinceBlock; blockNumber < size; blockNumber++ {
+		delta, err := state.FetchStateDeltaFromDB(blockNumber)
+		if err != nil {
+			return nil, err
+		}
+		if delta == nil {
+			return nil, fmt.Errorf("The state delta of block %d is no longer kept, the keys modified since block %d cannot be found", blockNumber, filter.ModifiedSinceBlock)
+		}
+		for key := range delta.GetUpdates(chaincodeID) {
+			if key >= startKey && (endKey == "" || key <= endKey) && strings.HasPrefix(key, filter.KeyPrefix) {
+				modified[key] = true
+			}
+		}
+	}
+	keys := make([]string, 0, len(modified))
+	for key := range modified {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys, nil
+}
+
+// narrowRangeToPrefix returns the range between startKey and endKey of the
+// keys starting with prefix, which may still include some keys without it
+func narrowRangeToPrefix(startKey string, endKey string, prefix string) (string, string) {
+	if prefix > startKey {
+		startKey = prefix
+	}
+	// the keys starting with the prefix are lower than the prefix with its
+	// last byte not equal to 0xff incremented
+	end := []byte(prefix)
+	for len(end) > 0 && end[len(end)-1] == 0xff {
+		end = end[:len(end)-1]
+	}
+	if len(end) > 0 {
+		end[len(end)-1]++
+		if endKey == "" || string(end) < endKey {
+			endKey = string(end)
+		}
+	}
+	return startKey, endKey
+}
+
+// filteredRangeScanIterator skips the key-values of another iterator which do
+// not pass the filter
+type filteredRangeScanIterator struct {
+	itr          statemgmt.RangeScanIterator
+	filter       *RangeScanFilter
+	currentKey   string
+	currentValue []byte
+}
+
+// Next - see interface 'statemgmt.RangeScanIterator' for details
+func (itr *filteredRangeScanIterator) Next() bool {
+	for itr.itr.Next() {
+		key, value := itr.itr.GetKeyValue()
+		if !strings.HasPrefix(key, itr.filter.KeyPrefix) {
+			continue
+		}
+		if itr.filter.MaxValueSize > 0 && len(value) > itr.filter.MaxValueSize {
+			continue
+		}
+		itr.currentKey, itr.currentValue = key, value
+		return true
+	}
+	return false
+}
+
+// GetKeyValue - see interface 'statemgmt.RangeScanIterator' for details
+func (itr *filteredRangeScanIterator) GetKeyValue() (string, []byte) {
+	return itr.currentKey, itr.currentValue
+}
+
+// Close - see interface 'statemgmt.RangeScanIterator' for details
+func (itr *filteredRangeScanIterator) Close() {
+	itr.itr.Close()
+}
+
+// keysRangeScanIterator reads the committed values of a list of keys, skipping
+// those deleted
+type keysRangeScanIterator struct {
+	stateImpl    statemgmt.HashableState
+	chaincodeID  string
+	keys         []string
+	currentKey   string
+	currentValue []byte
+}
+
+// Next - see interface 'statemgmt.RangeScanIterator' for details
+func (itr *keysRangeScanIterator) Next() bool {
+	for len(itr.keys) > 0 {
+		key := itr.keys[0]
+		itr.keys = itr.keys[1:]
+		value, err := itr.stateImpl.Get(itr.chaincodeID, key)
+		if err != nil {
+			logger.Errorf("Error reading the value of key [%s] of chaincode [%s]: %s", key, itr.chaincodeID, err)
+			return false
+		}
+		if value == nil {
+			continue
+		}
+		itr.currentKey, itr.currentValue = key, value
+		return true
+	}
+	return false
+}
+
+// GetKeyValue - see interface 'statemgmt.RangeScanIterator' for details
+func (itr *keysRangeScanIterator) GetKeyValue() (string, []byte) {
+	return itr.currentKey, itr.currentValue
+}
+
+// Close - see interface 'statemgmt.RangeScanIterator' for details
+func (itr *keysRangeScanIterator) Close() {
+	itr.keys = nil
+}
@@ -0,0 +1,96 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package state
+
+import (
+	"testing"
+
+	"github.com/hyperledger/fabric/core/ledger/testutil"
+)
+
+func TestStateFilteredRangeScanIterator(t *testing.T) {
+	stateTestWrapper, state := createFreshDBAndConstructState(t)
+	state.TxBegin("txUuid")
+	state.Set("chaincode1", "a1", []byte("value"))
+	state.Set("chaincode1", "b1", []byte("value"))
+	state.Set("chaincode1", "b2", []byte("a larger value"))
+	state.Set("chaincode1", "b3", []byte("value"))
+	state.Set("chaincode1", "c1", []byte("value"))
+	state.Set("chaincode2", "b4", []byte("value"))
+	state.TxFinish("txUuid", true)
+	stateTestWrapper.persistAndClearInMemoryChanges(0)
+
+	state.TxBegin("txUuid")
+	state.Set("chaincode1", "b1", []byte("updated"))
+	state.Delete("chaincode1", "b3")
+	state.Set("chaincode1", "c1", []byte("updated"))
+	state.TxFinish("txUuid", true)
+	stateTestWrapper.persistAndClearInMemoryChanges(1)
+
+	scan := func(startKey string, endKey string, filter *RangeScanFilter) map[string][]byte {
+		itr, err := state.GetFilteredRangeScanIterator("chaincode1", startKey, endKey, filter, 2)
+		testutil.AssertNoError(t, err, "Error getting filtered range scan iterator")
+		defer itr.Close()
+		results := make(map[string][]byte)
+		for itr.Next() {
+			key, value := itr.GetKeyValue()
+			results[key] = value
+		}
+		return results
+	}
+
+	testutil.AssertEquals(t, scan("", "", &RangeScanFilter{KeyPrefix: "b"}),
+		map[string][]byte{"b1": []byte("updated"), "b2": []byte("a larger value")})
+	testutil.AssertEquals(t, scan("b2", "", &RangeScanFilter{KeyPrefix: "b"}),
+		map[string][]byte{"b2": []byte("a larger value")})
+	testutil.AssertEquals(t, scan("", "", &RangeScanFilter{MaxValueSize: 7}),
+		map[string][]byte{"a1": []byte("value"), "b1": []byte("updated"), "c1": []byte("updated")})
+
+	// the keys deleted since the block are not returned
+	testutil.AssertEquals(t, scan("", "", &RangeScanFilter{ModifiedSinceBlock: 1}),
+		map[string][]byte{"b1": []byte("updated"), "c1": []byte("updated")})
+	testutil.AssertEquals(t, scan("", "b9", &RangeScanFilter{ModifiedSinceBlock: 1}),
+		map[string][]byte{"b1": []byte("updated")})
+	testutil.AssertEquals(t, scan("", "", &RangeScanFilter{KeyPrefix: "c", ModifiedSinceBlock: 1}),
+		map[string][]byte{"c1": []byte("updated")})
+	testutil.AssertEquals(t, len(scan("", "", &RangeScanFilter{ModifiedSinceBlock: 2})), 0)
+
+	_, err := state.GetFilteredRangeScanIterator("chaincode1", "", "", &RangeScanFilter{ModifiedSinceBlock: 3}, 2)
+	testutil.AssertError(t, err, "Expected a block not committed to fail")
+	_, err = state.GetFilteredRangeScanIterator("chaincode1", "", "", &RangeScanFilter{MaxValueSize: -1}, 2)
+	testutil.AssertError(t, err, "Expected a negative value size to fail")
+
+	// the keys modified since a block whose state delta is no longer kept cannot be found
+	stateTestWrapper.persistAndClearInMemoryChanges(2)
+	state.openchainDB.Delete(state.openchainDB.StateDeltaCF, encodeStateDeltaKey(1))
+	_, err = state.GetFilteredRangeScanIterator("chaincode1", "", "", &RangeScanFilter{ModifiedSinceBlock: 1}, 3)
+	testutil.AssertError(t, err, "Expected a block whose state delta is missing to fail")
+}
+
+func TestNarrowRangeToPrefix(t *testing.T) {
+	startKey, endKey := narrowRangeToPrefix("", "", "ab")
+	testutil.AssertEquals(t, startKey, "ab")
+	testutil.AssertEquals(t, endKey, "ac")
+	startKey, endKey = narrowRangeToPrefix("ab5", "ab7", "ab")
+	testutil.AssertEquals(t, startKey, "ab5")
+	testutil.AssertEquals(t, endKey, "ab7")
+	startKey, endKey = narrowRangeToPrefix("", "", "a\xff")
+	testutil.AssertEquals(t, startKey, "a\xff")
+	testutil.AssertEquals(t, endKey, "b")
+	_, endKey = narrowRangeToPrefix("", "", "\xff")
+	testutil.AssertEquals(t, endKey, "")
+}
@@ -0,0 +1,70 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package state
+
+import (
+	"fmt"
+)
+
+// GetAtBlock returns the committed value of a key as of the commit of block
+// blockNumber, size being the size of the blockchain.  The value is found by
+// rolling back the state deltas of the blocks committed since, so only the
+// state of the last ledger.state.historyQueryBlocks blocks can be read.
+func (state *State) GetAtBlock(chaincodeID string, key string, blockNumber uint64, size uint64) ([]byte, error) {
+	if historyQueryBlocks == 0 {
+		return nil, fmt.Errorf("Historical state queries are disabled")
+	}
+	if blockNumber >= size {
+		return nil, fmt.Errorf("Block %d was not committed, the blockchain has %d blocks", blockNumber, size)
+	}
+	if blockNumber+uint64(historyQueryBlocks) < size {
+		return nil, fmt.Errorf("The state of block %d can no longer be queried, only that of the last %d blocks", blockNumber, historyQueryBlocks)
+	}
+
+	next := blockNumber + 1
+	for {
+		delta, err := state.FetchStateDeltaFromDB(next)
+		if err != nil {
+			return nil, err
+		}
+		if delta != nil {
+			if updated := delta.Get(chaincodeID, key); updated != nil {
+				return updated.GetPreviousValue(), nil
+			}
+			next++
+			continue
+		}
+		if next < size {
+			return nil, fmt.Errorf("The state delta of block %d is missing, it was not kept when the block was synced", next)
+		}
+
+		// None of the blocks committed since changed the key.  A block
+		// committed meanwhile writes its delta along with the state, so the
+		// value read is only that of the last block if no delta appeared.
+		value, err := state.stateImpl.Get(chaincodeID, key)
+		if err != nil {
+			return nil, err
+		}
+		deltaBytes, err := state.openchainDB.GetFromStateDeltaCF(encodeStateDeltaKey(next))
+		if err != nil {
+			return nil, err
+		}
+		if deltaBytes == nil {
+			return value, nil
+		}
+	}
+}
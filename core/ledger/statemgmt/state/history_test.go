@@ -0,0 +1,90 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package state
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/hyperledger/fabric/core/ledger/testutil"
+)
+
+func TestStateGetAtBlock(t *testing.T) {
+	stateTestWrapper, state := createFreshDBAndConstructState(t)
+	defer func(blocks int) { historyQueryBlocks = blocks }(historyQueryBlocks)
+	historyQueryBlocks = 4
+
+	// key1 changes in every block, key2 is set in block 1 and deleted in 3
+	for blockNumber := uint64(0); blockNumber < 5; blockNumber++ {
+		state.TxBegin("txUuid")
+		state.Set("chaincode1", "key1", []byte(fmt.Sprintf("value%d", blockNumber)))
+		switch blockNumber {
+		case 1:
+			state.Set("chaincode1", "key2", []byte("value"))
+		case 3:
+			state.Delete("chaincode1", "key2")
+		}
+		state.TxFinish("txUuid", true)
+		stateTestWrapper.persistAndClearInMemoryChanges(blockNumber)
+	}
+
+	getAtBlock := func(key string, blockNumber uint64) []byte {
+		value, err := state.GetAtBlock("chaincode1", key, blockNumber, 5)
+		testutil.AssertNoError(t, err, fmt.Sprintf("Error getting the state of block %d", blockNumber))
+		return value
+	}
+	for blockNumber := uint64(1); blockNumber < 5; blockNumber++ {
+		testutil.AssertEquals(t, getAtBlock("key1", blockNumber), []byte(fmt.Sprintf("value%d", blockNumber)))
+	}
+	testutil.AssertNil(t, getAtBlock("key2", 4))
+	testutil.AssertNil(t, getAtBlock("key2", 3))
+	testutil.AssertEquals(t, getAtBlock("key2", 2), []byte("value"))
+	testutil.AssertEquals(t, getAtBlock("key2", 1), []byte("value"))
+	testutil.AssertNil(t, getAtBlock("key3", 1))
+
+	// Only the state of the last historyQueryBlocks blocks can be read
+	if _, err := state.GetAtBlock("chaincode1", "key1", 0, 5); err == nil {
+		t.Fatal("Expected reading the state of a block older than historyQueryBlocks to fail")
+	}
+	if _, err := state.GetAtBlock("chaincode1", "key1", 5, 5); err == nil {
+		t.Fatal("Expected reading the state of a block not committed to fail")
+	}
+	historyQueryBlocks = 0
+	if _, err := state.GetAtBlock("chaincode1", "key1", 4, 5); err == nil {
+		t.Fatal("Expected reading historical state to fail when disabled")
+	}
+}
+
+func TestStateGetAtBlockMissingDelta(t *testing.T) {
+	stateTestWrapper, state := createFreshDBAndConstructState(t)
+	defer func(blocks int) { historyQueryBlocks = blocks }(historyQueryBlocks)
+	historyQueryBlocks = 10
+
+	// Blocks synced by state transfer have no deltas
+	for _, blockNumber := range []uint64{0, 2} {
+		state.TxBegin("txUuid")
+		state.Set("chaincode1", "key1", []byte(fmt.Sprintf("value%d", blockNumber)))
+		state.TxFinish("txUuid", true)
+		stateTestWrapper.persistAndClearInMemoryChanges(blockNumber)
+	}
+	if _, err := state.GetAtBlock("chaincode1", "key1", 0, 3); err == nil {
+		t.Fatal("Expected reading the state of a block followed by a block without delta to fail")
+	}
+	value, err := state.GetAtBlock("chaincode1", "key1", 1, 3)
+	testutil.AssertNoError(t, err, "Error getting the state of block 1")
+	testutil.AssertEquals(t, value, []byte("value0"))
+}
@@ -0,0 +1,590 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package state
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"math"
+	"strings"
+
+	"github.com/hyperledger/fabric/core/db"
+	"github.com/hyperledger/fabric/core/ledger/statemgmt"
+)
+
+// The indexes of the state are kept in the indexes column family, after the
+// prefixes of the blockchain indexes
+var prefixStateIndexKey = byte(4)
+
+// stateIndexesBuiltKey is present while the indexes are up to date with the state
+var stateIndexesBuiltKey = []byte{prefixStateIndexKey}
+
+const (
+	stateIndexDefinitionKind = byte(1)
+	stateIndexEntryKind      = byte(2)
+)
+
+// indexDefinitionKeyPrefix starts the keys of the state of a chaincode which
+// define its indexes, the rest of the key being the name of the index and the
+// value the field indexed. It must match what the shim's CreateIndex writes.
+const indexDefinitionKeyPrefix = "\x00index\x00"
+
+// Tags of the encoded values of the fields, the values of a type sorting
+// before those of the next one
+const (
+	indexValueNumber = byte(1)
+	indexValueString = byte(2)
+	indexValueBool   = byte(3)
+)
+
+const indexRebuildBatchSize = 1000
+
+// initIndexes brings the indexes up to date with the state when they are
+// enabled, forgetting them otherwise as they will not follow the state anymore
+func (state *State) initIndexes() error {
+	openchainDB := state.openchainDB
+	built, err := openchainDB.GetFromIndexesCF(stateIndexesBuiltKey)
+	if err != nil {
+		return err
+	}
+	if !indexesEnabled {
+		if built != nil {
+			return openchainDB.Delete(openchainDB.IndexesCF, stateIndexesBuiltKey)
+		}
+		return nil
+	}
+	if built == nil {
+		return state.rebuildIndexes()
+	}
+	return nil
+}
+
+// rebuildIndexes builds all the indexes again from the committed state
+func (state *State) rebuildIndexes() error {
+	logger.Info("Building the indexes of the state")
+	if err := state.deleteIndexes(); err != nil {
+		return err
+	}
+
+	definitions := make(map[string]map[string]string)
+	err := state.forEachStateKeyValue(func(chaincodeID, key string, value []byte) {
+		if name, field, ok := parseIndexDefinition(chaincodeID, key, value); ok {
+			if definitions[chaincodeID] == nil {
+				definitions[chaincodeID] = make(map[string]string)
+			}
+			definitions[chaincodeID][name] = field
+		}
+	})
+	if err != nil {
+		return err
+	}
+
+	writeBatch := state.openchainDB.NewWriteBatch()
+	defer func() { writeBatch.Destroy() }()
+	cf := state.openchainDB.IndexesCF
+	for chaincodeID, chaincodeDefinitions := range definitions {
+		for name, field := range chaincodeDefinitions {
+			writeBatch.PutCF(cf, encodeIndexDefinitionKey(chaincodeID, name), []byte(field))
+		}
+	}
+	entries := 0
+	var writeErr error
+	err = state.forEachStateKeyValue(func(chaincodeID, key string, value []byte) {
+		if strings.HasPrefix(key, indexDefinitionKeyPrefix) {
+			return
+		}
+		for name, field := range definitions[chaincodeID] {
+			if indexed, ok := indexedValue(value, field); ok {
+				writeBatch.PutCF(cf, encodeIndexEntryKey(chaincodeID, name, indexed, key), nil)
+				entries++
+			}
+		}
+		if entries >= indexRebuildBatchSize && writeErr == nil {
+			writeErr = state.writeIndexBatch(writeBatch)
+			writeBatch.Destroy()
+			writeBatch = state.openchainDB.NewWriteBatch()
+			entries = 0
+		}
+	})
+	if err != nil {
+		return err
+	}
+	if writeErr != nil {
+		return writeErr
+	}
+	writeBatch.PutCF(cf, stateIndexesBuiltKey, []byte{})
+	if err = state.writeIndexBatch(writeBatch); err != nil {
+		return err
+	}
+	state.indexesReady = true
+	logger.Info("Built the indexes of the state")
+	return nil
+}
+
+// forEachStateKeyValue calls f with every key of the committed state
+func (state *State) forEachStateKeyValue(f func(chaincodeID, key string, value []byte)) error {
+	dbSnapshot := state.openchainDB.GetSnapshot()
+	defer dbSnapshot.Release()
+	itr, err := state.stateImpl.GetStateSnapshotIterator(dbSnapshot)
+	if err != nil {
+		return err
+	}
+	defer itr.Close()
+	for itr.Next() {
+		compositeKey, value := itr.GetRawKeyValue()
+		chaincodeID, key := statemgmt.DecodeCompositeKey(compositeKey)
+		f(chaincodeID, key, value)
+	}
+	return nil
+}
+
+// deleteIndexes deletes the definitions and entries of all the indexes
+func (state *State) deleteIndexes() error {
+	writeBatch := state.openchainDB.NewWriteBatch()
+	defer writeBatch.Destroy()
+	for _, kind := range []byte{stateIndexDefinitionKind, stateIndexEntryKind} {
+		state.deleteIndexRange(writeBatch, []byte{prefixStateIndexKey, kind})
+	}
+	return state.writeIndexBatch(writeBatch)
+}
+
+func (state *State) deleteIndexRange(writeBatch db.WriteBatch, prefix []byte) {
+	cf := state.openchainDB.IndexesCF
+	itr := state.openchainDB.GetIterator(cf)
+	defer itr.Close()
+	for itr.Seek(prefix); itr.Valid(); itr.Next() {
+		key := itr.Key()
+		if !bytes.HasPrefix(key, prefix) {
+			break
+		}
+		writeBatch.DeleteCF(cf, statemgmt.Copy(key))
+	}
+}
+
+func (state *State) writeIndexBatch(writeBatch db.WriteBatch) error {
+	return state.openchainDB.Write(writeBatch)
+}
+
+// addIndexChangesForPersistence adds to writeBatch the changes delta brings
+// to the indexes, delta being about to be persisted in the same batch. The
+// committed state must not include delta yet. With asynchronous indexes, the
+// changes are left to the indexer once delta is persisted.
+func (state *State) addIndexChangesForPersistence(delta *statemgmt.StateDelta, writeBatch db.WriteBatch) {
+	if !indexesEnabled {
+		return
+	}
+	if state.indexer != nil {
+		state.indexer.committing(state, writeBatch)
+		state.indexDelta = delta
+		return
+	}
+	if !state.indexesReady {
+		return
+	}
+	if err := state.addIndexChanges(delta, writeBatch, false); err != nil {
+		// The indexes are not used until they are rebuilt, when the peer restarts
+		logger.Errorf("%s, they will be rebuilt at restart", err)
+		writeBatch.DeleteCF(state.openchainDB.IndexesCF, stateIndexesBuiltKey)
+		state.indexesReady = false
+	}
+}
+
+// addIndexChanges adds to writeBatch the changes delta brings to the indexes.
+// If committed, the committed state includes delta already and the previous
+// values of the keys are read from delta
+func (state *State) addIndexChanges(delta *statemgmt.StateDelta, writeBatch db.WriteBatch, committed bool) error {
+	for _, chaincodeID := range delta.GetUpdatedChaincodeIds(true) {
+		if err := state.addChaincodeIndexChanges(chaincodeID, delta, writeBatch, committed); err != nil {
+			return fmt.Errorf("Error updating the indexes of chaincode [%s]: %s", chaincodeID, err)
+		}
+	}
+	return nil
+}
+
+func (state *State) addChaincodeIndexChanges(chaincodeID string, delta *statemgmt.StateDelta, writeBatch db.WriteBatch, committed bool) error {
+	definitions, err := state.getIndexDefinitions(chaincodeID)
+	if err != nil {
+		return err
+	}
+	cf := state.openchainDB.IndexesCF
+	updates := delta.GetUpdates(chaincodeID)
+
+	// Indexes whose definition changes are built again from scratch
+	rebuilt := make(map[string]string)
+	for key, updatedValue := range updates {
+		if !strings.HasPrefix(key, indexDefinitionKeyPrefix) {
+			continue
+		}
+		name := strings.TrimPrefix(key, indexDefinitionKeyPrefix)
+		if _, ok := definitions[name]; ok {
+			state.deleteIndexRange(writeBatch, encodeIndexEntryPrefix(chaincodeID, name))
+			writeBatch.DeleteCF(cf, encodeIndexDefinitionKey(chaincodeID, name))
+			delete(definitions, name)
+		}
+		if name, field, ok := parseIndexDefinition(chaincodeID, key, newValue(delta, updatedValue)); ok {
+			writeBatch.PutCF(cf, encodeIndexDefinitionKey(chaincodeID, name), []byte(field))
+			rebuilt[name] = field
+		}
+	}
+
+	if len(definitions) > 0 {
+		for key, updatedValue := range updates {
+			if strings.HasPrefix(key, indexDefinitionKeyPrefix) {
+				continue
+			}
+			previous := previousValue(delta, updatedValue)
+			if !committed {
+				var err error
+				if previous, err = state.stateImpl.Get(chaincodeID, key); err != nil {
+					return err
+				}
+			}
+			value := newValue(delta, updatedValue)
+			for name, field := range definitions {
+				previousIndexed, wasIndexed := indexedValue(previous, field)
+				indexed, isIndexed := indexedValue(value, field)
+				if wasIndexed && isIndexed && bytes.Equal(previousIndexed, indexed) {
+					continue
+				}
+				if wasIndexed {
+					writeBatch.DeleteCF(cf, encodeIndexEntryKey(chaincodeID, name, previousIndexed, key))
+				}
+				if isIndexed {
+					writeBatch.PutCF(cf, encodeIndexEntryKey(chaincodeID, name, indexed, key), nil)
+				}
+			}
+		}
+	}
+
+	if len(rebuilt) == 0 {
+		return nil
+	}
+	itr, err := state.stateImpl.GetRangeScanIterator(chaincodeID, "", "")
+	if err != nil {
+		return err
+	}
+	defer itr.Close()
+	addEntries := func(key string, value []byte) {
+		if strings.HasPrefix(key, indexDefinitionKeyPrefix) {
+			return
+		}
+		for name, field := range rebuilt {
+			if indexed, ok := indexedValue(value, field); ok {
+				writeBatch.PutCF(cf, encodeIndexEntryKey(chaincodeID, name, indexed, key), nil)
+			}
+		}
+	}
+	for itr.Next() {
+		key, value := itr.GetKeyValue()
+		if _, ok := updates[key]; !ok {
+			addEntries(key, value)
+		}
+	}
+	for key, updatedValue := range updates {
+		addEntries(key, newValue(delta, updatedValue))
+	}
+	return nil
+}
+
+// newValue returns the value a key has once delta is applied, nil if deleted
+func newValue(delta *statemgmt.StateDelta, updatedValue *statemgmt.UpdatedValue) []byte {
+	if delta.RollBackwards {
+		return updatedValue.GetPreviousValue()
+	}
+	return updatedValue.GetValue()
+}
+
+// previousValue returns the value a key has before delta is applied, nil if absent
+func previousValue(delta *statemgmt.StateDelta, updatedValue *statemgmt.UpdatedValue) []byte {
+	if delta.RollBackwards {
+		return updatedValue.GetValue()
+	}
+	return updatedValue.GetPreviousValue()
+}
+
+// getIndexDefinitions returns the fields indexed by the indexes of a chaincode
+func (state *State) getIndexDefinitions(chaincodeID string) (map[string]string, error) {
+	definitions := make(map[string]string)
+	prefix := encodeIndexDefinitionKey(chaincodeID, "")
+	itr := state.openchainDB.GetIterator(state.openchainDB.IndexesCF)
+	defer itr.Close()
+	for itr.Seek(prefix); itr.Valid(); itr.Next() {
+		key := itr.Key()
+		if !bytes.HasPrefix(key, prefix) {
+			break
+		}
+		definitions[string(key[len(prefix):])] = string(itr.Value())
+	}
+	if err := itr.Err(); err != nil {
+		return nil, err
+	}
+	return definitions, nil
+}
+
+// parseIndexDefinition returns the index a key of the state of a chaincode
+// defines, if any
+func parseIndexDefinition(chaincodeID, key string, value []byte) (string, string, bool) {
+	if !strings.HasPrefix(key, indexDefinitionKeyPrefix) || value == nil {
+		return "", "", false
+	}
+	name := strings.TrimPrefix(key, indexDefinitionKeyPrefix)
+	if name == "" || strings.IndexByte(name, 0) >= 0 || len(value) == 0 {
+		logger.Warningf("Ignoring invalid definition of index [%q] of chaincode [%s]", name, chaincodeID)
+		return "", "", false
+	}
+	return name, string(value), true
+}
+
+// GetIndexRangeScanIterator returns an iterator over the keys of the committed
+// state of a chaincode whose value has the field indexed by the index between
+// start and end, inclusive. The bounds are JSON values, either of which can be
+// nil to leave the range open on its side, and both of the same type.
+func (state *State) GetIndexRangeScanIterator(chaincodeID string, index string, start []byte, end []byte) (statemgmt.RangeScanIterator, error) {
+	if !indexesEnabled {
+		return nil, fmt.Errorf("The indexes of the state are not enabled")
+	}
+	if state.indexer != nil {
+		if !state.indexer.waitForCommittedBlocks(state) {
+			return nil, fmt.Errorf("The indexes of the state are out of date until the peer restarts")
+		}
+	} else if !state.indexesReady {
+		return nil, fmt.Errorf("The indexes of the state are out of date until the peer restarts")
+	}
+	definitions, err := state.getIndexDefinitions(chaincodeID)
+	if err != nil {
+		return nil, err
+	}
+	field, ok := definitions[index]
+	if !ok {
+		return nil, fmt.Errorf("Index [%s] of chaincode [%s] is not defined", index, chaincodeID)
+	}
+
+	prefix := encodeIndexEntryPrefix(chaincodeID, index)
+	lower := prefix
+	upper := prefixEnd(prefix)
+	var startValue, endValue []byte
+	if start != nil {
+		if startValue, err = decodeIndexBound(start); err != nil {
+			return nil, err
+		}
+		lower = append(statemgmt.Copy(prefix), startValue...)
+		upper = append(statemgmt.Copy(prefix), startValue[0]+1)
+	}
+	if end != nil {
+		if endValue, err = decodeIndexBound(end); err != nil {
+			return nil, err
+		}
+		if startValue != nil && startValue[0] != endValue[0] {
+			return nil, fmt.Errorf("The bounds of the range are of different types")
+		}
+		if startValue == nil {
+			lower = append(statemgmt.Copy(prefix), endValue[0])
+		}
+		upper = prefixEnd(append(statemgmt.Copy(prefix), endValue...))
+	}
+
+	dbItr := state.openchainDB.GetIterator(state.openchainDB.IndexesCF)
+	dbItr.Seek(lower)
+	return &indexRangeScanIterator{state.stateImpl, dbItr, chaincodeID, field, prefix, lower, upper, "", nil}, nil
+}
+
+func decodeIndexBound(bound []byte) ([]byte, error) {
+	var value interface{}
+	if err := json.Unmarshal(bound, &value); err != nil {
+		return nil, fmt.Errorf("Invalid bound of the range: %s", err)
+	}
+	encoded, ok := encodeIndexValue(value)
+	if !ok {
+		return nil, fmt.Errorf("Invalid bound of the range: only numbers, strings and booleans are indexed")
+	}
+	return encoded, nil
+}
+
+// indexRangeScanIterator - an implementation of interface 'statemgmt.RangeScanIterator'
+// over the entries of an index
+type indexRangeScanIterator struct {
+	stateImpl    statemgmt.HashableState
+	dbItr        db.Iterator
+	chaincodeID  string
+	field        string
+	prefix       []byte
+	lower        []byte
+	upper        []byte
+	currentKey   string
+	currentValue []byte
+}
+
+// Next - see interface 'statemgmt.RangeScanIterator' for details
+func (itr *indexRangeScanIterator) Next() bool {
+	for ; itr.dbItr.Valid(); itr.dbItr.Next() {
+		entry := itr.dbItr.Key()
+		if bytes.Compare(entry, itr.upper) >= 0 {
+			return false
+		}
+		_, key, ok := decodeIndexEntry(entry[len(itr.prefix):])
+		if !ok {
+			logger.Warningf("Skipping malformed entry [%x] of the indexes of the state", entry)
+			continue
+		}
+		value, err := itr.stateImpl.Get(itr.chaincodeID, key)
+		if err != nil {
+			logger.Errorf("Error reading key [%s] of the index: %s", key, err)
+			return false
+		}
+		// The state may have changed since the entry was read
+		indexed, ok := indexedValue(value, itr.field)
+		if !ok {
+			continue
+		}
+		indexed = append(statemgmt.Copy(itr.prefix), indexed...)
+		if bytes.Compare(indexed, itr.lower) < 0 || bytes.Compare(indexed, itr.upper) >= 0 {
+			continue
+		}
+		itr.currentKey = key
+		itr.currentValue = value
+		itr.dbItr.Next()
+		return true
+	}
+	return false
+}
+
+// GetKeyValue - see interface 'statemgmt.RangeScanIterator' for details
+func (itr *indexRangeScanIterator) GetKeyValue() (string, []byte) {
+	return itr.currentKey, itr.currentValue
+}
+
+// Close - see interface 'statemgmt.RangeScanIterator' for details
+func (itr *indexRangeScanIterator) Close() {
+	itr.dbItr.Close()
+}
+
+// indexedValue returns the encoded value of the field of a JSON value, the
+// field being a path of names of members separated by dots. Values which are
+// not JSON objects, or whose field is missing or neither a number, a string
+// nor a boolean, are not indexed.
+func indexedValue(value []byte, field string) ([]byte, bool) {
+	if value == nil {
+		return nil, false
+	}
+	var fieldValue interface{}
+	if err := json.Unmarshal(value, &fieldValue); err != nil {
+		return nil, false
+	}
+	for _, name := range strings.Split(field, ".") {
+		object, ok := fieldValue.(map[string]interface{})
+		if !ok {
+			return nil, false
+		}
+		if fieldValue, ok = object[name]; !ok {
+			return nil, false
+		}
+	}
+	return encodeIndexValue(fieldValue)
+}
+
+// encodeIndexValue encodes a value decoded from JSON so that the encoded
+// values sort like the values
+func encodeIndexValue(value interface{}) ([]byte, bool) {
+	switch v := value.(type) {
+	case float64:
+		bits := math.Float64bits(v)
+		if bits&(1<<63) != 0 {
+			bits = ^bits
+		} else {
+			bits |= 1 << 63
+		}
+		encoded := make([]byte, 9)
+		encoded[0] = indexValueNumber
+		binary.BigEndian.PutUint64(encoded[1:], bits)
+		return encoded, true
+	case string:
+		// 0x00 is escaped so that 0x00 0x01 terminates the string
+		encoded := []byte{indexValueString}
+		encoded = append(encoded, bytes.Replace([]byte(v), []byte{0x00}, []byte{0x00, 0xff}, -1)...)
+		return append(encoded, 0x00, 0x01), true
+	case bool:
+		if v {
+			return []byte{indexValueBool, 1}, true
+		}
+		return []byte{indexValueBool, 0}, true
+	}
+	return nil, false
+}
+
+// decodeIndexEntry splits the end of the key of an entry of an index into
+// the encoded value and the key of the state
+func decodeIndexEntry(entry []byte) ([]byte, string, bool) {
+	if len(entry) == 0 {
+		return nil, "", false
+	}
+	length := 0
+	switch entry[0] {
+	case indexValueNumber:
+		length = 9
+	case indexValueBool:
+		length = 2
+	case indexValueString:
+		for i := 1; i < len(entry)-1; i++ {
+			if entry[i] == 0x00 {
+				if entry[i+1] == 0x01 {
+					length = i + 2
+					break
+				}
+				i++
+			}
+		}
+	}
+	if length == 0 || length > len(entry) {
+		return nil, "", false
+	}
+	return entry[:length], string(entry[length:]), true
+}
+
+func encodeIndexDefinitionKey(chaincodeID string, name string) []byte {
+	key := []byte{prefixStateIndexKey, stateIndexDefinitionKind}
+	key = append(key, chaincodeID...)
+	key = append(key, 0x00)
+	return append(key, name...)
+}
+
+func encodeIndexEntryPrefix(chaincodeID string, name string) []byte {
+	key := []byte{prefixStateIndexKey, stateIndexEntryKind}
+	key = append(key, chaincodeID...)
+	key = append(key, 0x00)
+	key = append(key, name...)
+	return append(key, 0x00)
+}
+
+func encodeIndexEntryKey(chaincodeID string, name string, indexed []byte, key string) []byte {
+	entry := encodeIndexEntryPrefix(chaincodeID, name)
+	entry = append(entry, indexed...)
+	return append(entry, key...)
+}
+
+// prefixEnd returns the smallest key greater than all those starting with prefix
+func prefixEnd(prefix []byte) []byte {
+	end := statemgmt.Copy(prefix)
+	for i := len(end) - 1; i >= 0; i-- {
+		if end[i] < 0xff {
+			end[i]++
+			return end[:i+1]
+		}
+	}
+	return nil
+}
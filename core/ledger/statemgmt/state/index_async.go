@@ -0,0 +1,124 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package state
+
+import (
+	"sync"
+
+	"github.com/hyperledger/fabric/core/db"
+	"github.com/hyperledger/fabric/core/ledger/statemgmt"
+)
+
+// stateIndexerQueueSize is the number of committed blocks the indexer may
+// fall behind before the commits wait for it
+const stateIndexerQueueSize = 100
+
+// stateIndexer updates the indexes of the state in the background, in the
+// order of the blocks, once their changes are committed, so that committing
+// a block does not wait for the indexes. The indexes are only read by the
+// queries, which wait for the indexer to catch up with the committed blocks.
+//
+// The commits delete the key marking the indexes as built, which the indexer
+// puts back once it has caught up, so that the indexes are rebuilt at restart
+// if the peer stops in between.
+type stateIndexer struct {
+	deltas   chan *statemgmt.StateDelta
+	lock     sync.Mutex
+	caughtUp *sync.Cond
+	// the blocks being committed, or committed and not indexed yet
+	pending int
+}
+
+func newStateIndexer(state *State) *stateIndexer {
+	indexer := &stateIndexer{deltas: make(chan *statemgmt.StateDelta, stateIndexerQueueSize)}
+	indexer.caughtUp = sync.NewCond(&indexer.lock)
+	go indexer.run(state)
+	return indexer
+}
+
+// committing adds to the writeBatch of a block being committed the deletion
+// of the key marking the indexes as built
+func (indexer *stateIndexer) committing(state *State, writeBatch db.WriteBatch) {
+	indexer.lock.Lock()
+	indexer.pending++
+	indexer.lock.Unlock()
+	writeBatch.DeleteCF(state.openchainDB.IndexesCF, stateIndexesBuiltKey)
+}
+
+// committed hands the delta of the block whose commit started with committing
+// to the indexer, nil if the block was not persisted
+func (indexer *stateIndexer) committed(delta *statemgmt.StateDelta) {
+	indexer.deltas <- delta
+}
+
+func (indexer *stateIndexer) run(state *State) {
+	for delta := range indexer.deltas {
+		writeBatch := state.openchainDB.NewWriteBatch()
+		var err error
+		if delta != nil && indexer.ready(state) {
+			err = state.addIndexChanges(delta, writeBatch, true)
+		}
+
+		indexer.lock.Lock()
+		indexer.pending--
+		if err == nil && state.indexesReady {
+			if indexer.pending == 0 {
+				writeBatch.PutCF(state.openchainDB.IndexesCF, stateIndexesBuiltKey, []byte{})
+			}
+			err = state.writeIndexBatch(writeBatch)
+		}
+		if err != nil {
+			// The indexes are not used until they are rebuilt, when the peer restarts
+			logger.Errorf("Error updating the indexes of the state, they will be rebuilt at restart: %s", err)
+			state.indexesReady = false
+		}
+		indexer.caughtUp.Broadcast()
+		indexer.lock.Unlock()
+		writeBatch.Destroy()
+	}
+}
+
+// waitForCommittedBlocks waits for the indexes to be updated with the blocks
+// committed, returning whether they are up to date
+func (indexer *stateIndexer) waitForCommittedBlocks(state *State) bool {
+	indexer.lock.Lock()
+	defer indexer.lock.Unlock()
+	for indexer.pending > 0 {
+		indexer.caughtUp.Wait()
+	}
+	return state.indexesReady
+}
+
+func (indexer *stateIndexer) ready(state *State) bool {
+	indexer.lock.Lock()
+	defer indexer.lock.Unlock()
+	return state.indexesReady
+}
+
+// indexDeltaPersisted hands the changes whose persistence started with
+// addIndexChangesForPersistence to the indexer, once they are persisted or not
+func (state *State) indexDeltaPersisted(persisted bool) {
+	if state.indexDelta == nil {
+		return
+	}
+	if persisted {
+		state.indexer.committed(state.indexDelta)
+	} else {
+		state.indexer.committed(nil)
+	}
+	state.indexDelta = nil
+}
@@ -0,0 +1,263 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package state
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+
+	"github.com/hyperledger/fabric/core/db"
+	"github.com/hyperledger/fabric/core/ledger/statemgmt"
+	"github.com/hyperledger/fabric/core/ledger/testutil"
+)
+
+func queryIndex(t *testing.T, state *State, index string, start, end string) []string {
+	var startBytes, endBytes []byte
+	if start != "" {
+		startBytes = []byte(start)
+	}
+	if end != "" {
+		endBytes = []byte(end)
+	}
+	itr, err := state.GetIndexRangeScanIterator("chaincode1", index, startBytes, endBytes)
+	testutil.AssertNoError(t, err, "Error querying index "+index)
+	defer itr.Close()
+	keys := []string{}
+	for itr.Next() {
+		key, _ := itr.GetKeyValue()
+		keys = append(keys, key)
+	}
+	return keys
+}
+
+func setIndexedState(state *State, kvs map[string]string) {
+	state.TxBegin("txUuid")
+	for key, value := range kvs {
+		if value == "" {
+			state.Delete("chaincode1", key)
+		} else {
+			state.Set("chaincode1", key, []byte(value))
+		}
+	}
+	state.TxFinish("txUuid", true)
+}
+
+func TestStateIndexes(t *testing.T) {
+	defer func(enabled bool) { indexesEnabled = enabled }(indexesEnabled)
+	indexesEnabled = true
+	stateTestWrapper, state := createFreshDBAndConstructState(t)
+
+	setIndexedState(state, map[string]string{
+		indexDefinitionKeyPrefix + "owner": "owner",
+		indexDefinitionKeyPrefix + "price": "details.price",
+		"key1":                             `{"owner":"alice","details":{"price":10}}`,
+		"key2":                             `{"owner":"bob","details":{"price":-2.5}}`,
+		"key3":                             `{"owner":"alice","details":{"price":100}}`,
+		"key4":                             "not json",
+		"key5":                             `{"owner":["alice"]}`,
+	})
+	stateTestWrapper.persistAndClearInMemoryChanges(0)
+
+	testutil.AssertEquals(t, queryIndex(t, state, "owner", `"alice"`, `"alice"`), []string{"key1", "key3"})
+	testutil.AssertEquals(t, queryIndex(t, state, "owner", "", ""), []string{"key1", "key3", "key2"})
+	testutil.AssertEquals(t, queryIndex(t, state, "price", "0", "50"), []string{"key1"})
+	testutil.AssertEquals(t, queryIndex(t, state, "price", "", "10"), []string{"key2", "key1"})
+	testutil.AssertEquals(t, queryIndex(t, state, "price", "-10", ""), []string{"key2", "key1", "key3"})
+	testutil.AssertEquals(t, queryIndex(t, state, "price", "100.5", ""), []string{})
+
+	// Uncommitted changes are not indexed
+	setIndexedState(state, map[string]string{
+		"key1": `{"owner":"bob","details":{"price":10}}`,
+		"key3": "",
+	})
+	testutil.AssertEquals(t, queryIndex(t, state, "owner", `"alice"`, `"alice"`), []string{"key1", "key3"})
+	stateTestWrapper.persistAndClearInMemoryChanges(1)
+	testutil.AssertEquals(t, queryIndex(t, state, "owner", `"alice"`, `"alice"`), []string{})
+	testutil.AssertEquals(t, queryIndex(t, state, "owner", `"bob"`, `"bob"`), []string{"key1", "key2"})
+	testutil.AssertEquals(t, queryIndex(t, state, "price", "", ""), []string{"key2", "key1"})
+
+	_, err := state.GetIndexRangeScanIterator("chaincode1", "missing", nil, nil)
+	testutil.AssertError(t, err, "Expected querying an undefined index to fail")
+	_, err = state.GetIndexRangeScanIterator("chaincode2", "owner", nil, nil)
+	testutil.AssertError(t, err, "Expected querying the index of another chaincode to fail")
+	_, err = state.GetIndexRangeScanIterator("chaincode1", "price", []byte("1"), []byte(`"a"`))
+	testutil.AssertError(t, err, "Expected bounds of different types to fail")
+	_, err = state.GetIndexRangeScanIterator("chaincode1", "price", []byte("{}"), nil)
+	testutil.AssertError(t, err, "Expected a bound which is not indexed to fail")
+
+	indexesEnabled = false
+	_, err = state.GetIndexRangeScanIterator("chaincode1", "owner", nil, nil)
+	testutil.AssertError(t, err, "Expected querying an index to fail when disabled")
+}
+
+func TestStateIndexDefinitions(t *testing.T) {
+	defer func(enabled bool) { indexesEnabled = enabled }(indexesEnabled)
+	indexesEnabled = true
+	stateTestWrapper, state := createFreshDBAndConstructState(t)
+
+	setIndexedState(state, map[string]string{
+		"key1": `{"owner":"alice","price":3}`,
+		"key2": `{"owner":"bob","price":2}`,
+	})
+	stateTestWrapper.persistAndClearInMemoryChanges(0)
+
+	// Indexes defined later index the state committed before
+	setIndexedState(state, map[string]string{
+		indexDefinitionKeyPrefix + "owner": "owner",
+		"key2":                             `{"owner":"alice","price":2}`,
+		"key3":                             `{"owner":"alice","price":1}`,
+	})
+	stateTestWrapper.persistAndClearInMemoryChanges(1)
+	testutil.AssertEquals(t, queryIndex(t, state, "owner", `"alice"`, `"alice"`), []string{"key1", "key2", "key3"})
+
+	// Redefining an index builds it again
+	setIndexedState(state, map[string]string{indexDefinitionKeyPrefix + "owner": "price"})
+	stateTestWrapper.persistAndClearInMemoryChanges(2)
+	testutil.AssertEquals(t, queryIndex(t, state, "owner", "", ""), []string{"key3", "key2", "key1"})
+
+	setIndexedState(state, map[string]string{indexDefinitionKeyPrefix + "owner": ""})
+	stateTestWrapper.persistAndClearInMemoryChanges(3)
+	_, err := state.GetIndexRangeScanIterator("chaincode1", "owner", nil, nil)
+	testutil.AssertError(t, err, "Expected querying a deleted index to fail")
+	testutil.AssertEquals(t, countIndexKeys(), 0)
+}
+
+func TestStateIndexesRebuild(t *testing.T) {
+	defer func(enabled bool) { indexesEnabled = enabled }(indexesEnabled)
+	indexesEnabled = false
+	stateTestWrapper, state := createFreshDBAndConstructState(t)
+
+	setIndexedState(state, map[string]string{
+		indexDefinitionKeyPrefix + "owner": "owner",
+		"key1":                             `{"owner":"alice"}`,
+		"key2":                             `{"owner":"bob"}`,
+	})
+	stateTestWrapper.persistAndClearInMemoryChanges(0)
+	testutil.AssertEquals(t, countIndexKeys(), 0)
+
+	// Enabling the indexes builds them when the state is loaded
+	indexesEnabled = true
+	stateTestWrapper = newStateTestWrapper(t)
+	state = stateTestWrapper.state
+	testutil.AssertEquals(t, queryIndex(t, state, "owner", `"bob"`, ""), []string{"key2"})
+
+	// State transfer deletes the state and applies deltas
+	testutil.AssertNoError(t, state.DeleteState(), "Error deleting state")
+	testutil.AssertEquals(t, countIndexKeys(), 0)
+	delta := statemgmt.NewStateDelta()
+	delta.Set("chaincode1", indexDefinitionKeyPrefix+"owner", []byte("owner"), nil)
+	delta.Set("chaincode1", "key3", []byte(`{"owner":"bob"}`), nil)
+	state.ApplyStateDelta(delta)
+	testutil.AssertNoError(t, state.CommitStateDelta(), "Error committing state delta")
+	state.ClearInMemoryChanges(true)
+	testutil.AssertEquals(t, queryIndex(t, state, "owner", `"bob"`, ""), []string{"key3"})
+
+	// Disabling the indexes forgets them, they are rebuilt once enabled again
+	indexesEnabled = false
+	stateTestWrapper = newStateTestWrapper(t)
+	state = stateTestWrapper.state
+	setIndexedState(state, map[string]string{"key4": `{"owner":"bob"}`})
+	stateTestWrapper.persistAndClearInMemoryChanges(1)
+	indexesEnabled = true
+	stateTestWrapper = newStateTestWrapper(t)
+	state = stateTestWrapper.state
+	testutil.AssertEquals(t, queryIndex(t, state, "owner", `"bob"`, ""), []string{"key3", "key4"})
+}
+
+func TestStateIndexesAsync(t *testing.T) {
+	defer func(enabled, async bool) { indexesEnabled, asyncIndexes = enabled, async }(indexesEnabled, asyncIndexes)
+	indexesEnabled, asyncIndexes = true, true
+	stateTestWrapper, state := createFreshDBAndConstructState(t)
+
+	setIndexedState(state, map[string]string{
+		indexDefinitionKeyPrefix + "owner": "owner",
+		"key1":                             `{"owner":"alice","price":3}`,
+		"key2":                             `{"owner":"bob","price":2}`,
+	})
+	stateTestWrapper.persistAndClearInMemoryChanges(0)
+	testutil.AssertEquals(t, queryIndex(t, state, "owner", `"alice"`, `"alice"`), []string{"key1"})
+
+	// The previous values of the keys come from the deltas, the committed state being ahead of the indexes
+	for blockNumber := uint64(1); blockNumber < 10; blockNumber++ {
+		setIndexedState(state, map[string]string{
+			"key1": fmt.Sprintf(`{"owner":"alice%d","price":3}`, blockNumber),
+			"key3": fmt.Sprintf(`{"owner":"carol","price":%d}`, blockNumber),
+		})
+		stateTestWrapper.persistAndClearInMemoryChanges(blockNumber)
+	}
+	setIndexedState(state, map[string]string{
+		indexDefinitionKeyPrefix + "price": "price",
+		"key2":                             "",
+	})
+	stateTestWrapper.persistAndClearInMemoryChanges(10)
+	testutil.AssertEquals(t, queryIndex(t, state, "owner", "", ""), []string{"key1", "key3"})
+	testutil.AssertEquals(t, queryIndex(t, state, "owner", `"alice9"`, `"alice9"`), []string{"key1"})
+	testutil.AssertEquals(t, queryIndex(t, state, "price", "", ""), []string{"key1", "key3"})
+
+	// The indexes are marked as built once caught up
+	built, err := db.GetDBHandle().GetFromIndexesCF(stateIndexesBuiltKey)
+	testutil.AssertNoError(t, err, "Error reading the indexes")
+	testutil.AssertEquals(t, built != nil, true)
+
+	// Changes which are not persisted are not indexed
+	setIndexedState(state, map[string]string{"key4": `{"owner":"dave"}`})
+	writeBatch := db.GetDBHandle().NewWriteBatch()
+	state.AddChangesForPersistence(11, writeBatch)
+	writeBatch.Destroy()
+	state.ClearInMemoryChanges(false)
+	testutil.AssertEquals(t, queryIndex(t, state, "owner", `"dave"`, `"dave"`), []string{})
+	built, _ = db.GetDBHandle().GetFromIndexesCF(stateIndexesBuiltKey)
+	testutil.AssertEquals(t, built != nil, true)
+}
+
+func TestStateIndexValueEncoding(t *testing.T) {
+	values := []interface{}{-1e10, -1.0, -0.5, 0.0, 0.5, 1.0, 1e10, "", "\x00", "\x00a", "a", "a\x00", "ab", "b", false, true}
+	var previous []byte
+	for _, value := range values {
+		encoded, ok := encodeIndexValue(value)
+		if !ok {
+			t.Fatalf("Expected %#v to be indexed", value)
+		}
+		if bytes.Compare(previous, encoded) >= 0 {
+			t.Fatalf("Expected the encoding of %#v to sort after the one of the previous value", value)
+		}
+		previous = encoded
+
+		decoded, key, ok := decodeIndexEntry(append(statemgmt.Copy(encoded), "key\x00\x01"...))
+		if !ok {
+			t.Fatalf("Could not decode the entry of %#v", value)
+		}
+		testutil.AssertEquals(t, decoded, encoded)
+		testutil.AssertEquals(t, key, "key\x00\x01")
+	}
+	if _, ok := encodeIndexValue(nil); ok {
+		t.Fatal("Expected null not to be indexed")
+	}
+}
+
+func countIndexKeys() int {
+	count := 0
+	itr := db.GetDBHandle().GetIterator(db.GetDBHandle().IndexesCF)
+	defer itr.Close()
+	for itr.Seek([]byte{prefixStateIndexKey, stateIndexDefinitionKind}); itr.Valid(); itr.Next() {
+		if itr.Key()[0] == prefixStateIndexKey {
+			count++
+		}
+	}
+	return count
+}
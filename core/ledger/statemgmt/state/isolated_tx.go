@@ -0,0 +1,351 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package state
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/hyperledger/fabric/core/ledger/statemgmt"
+	"github.com/hyperledger/fabric/core/util"
+)
+
+// An isolated tx executes against the state as it was when the tx began, and
+// keeps its changes to itself until they are applied.  Several isolated txs
+// may execute concurrently; the caller applies them one at a time, in the
+// order in which they would have executed serially.  The read-write set
+// recorded for each isolated tx tells whether its reads are still valid once
+// the txs ordered before it are applied.  Read-write sets are recorded for the
+// txs which are not isolated too, through the calls made on their behalf.
+//
+// The state must not be changed by other means while isolated txs execute.
+
+// KeyRange is a range of keys read by a range scan, an empty EndKey leaves
+// the range open
+type KeyRange struct {
+	StartKey string
+	EndKey   string
+}
+
+func (r KeyRange) contains(key string) bool {
+	return key >= r.StartKey && (r.EndKey == "" || key <= r.EndKey)
+}
+
+// TxReadWriteSet records the keys a tx read and wrote, by chaincodeID. The
+// version of a key is the hash of its value, nil if the key does not exist
+type TxReadWriteSet struct {
+	Reads  map[string]map[string]bool
+	Ranges map[string][]KeyRange
+	Writes map[string]map[string]bool
+	// ReadVersions are the versions of the keys read, as first read
+	ReadVersions map[string]map[string][]byte
+	// WriteVersions are the versions of the keys written, set once the tx
+	// finished successfully
+	WriteVersions map[string]map[string][]byte
+}
+
+// NewTxReadWriteSet constructs an empty read-write set
+func NewTxReadWriteSet() *TxReadWriteSet {
+	return &TxReadWriteSet{
+		Reads:         make(map[string]map[string]bool),
+		Ranges:        make(map[string][]KeyRange),
+		Writes:        make(map[string]map[string]bool),
+		ReadVersions:  make(map[string]map[string][]byte),
+		WriteVersions: make(map[string]map[string][]byte),
+	}
+}
+
+// keyVersion returns the version of a key whose value is value
+func keyVersion(value []byte) []byte {
+	if value == nil {
+		return nil
+	}
+	return util.ComputeCryptoHash(value)
+}
+
+func addKeyVersion(versions map[string]map[string][]byte, chaincodeID string, key string, version []byte) {
+	ccVersions, ok := versions[chaincodeID]
+	if !ok {
+		ccVersions = make(map[string][]byte)
+		versions[chaincodeID] = ccVersions
+	}
+	ccVersions[key] = version
+}
+
+// addRead records the read of key, whose value read is value, keeping the
+// version of the first read
+func (rwset *TxReadWriteSet) addRead(chaincodeID string, key string, value []byte) {
+	addKey(rwset.Reads, chaincodeID, key)
+	if _, ok := rwset.ReadVersions[chaincodeID][key]; !ok {
+		addKeyVersion(rwset.ReadVersions, chaincodeID, key, keyVersion(value))
+	}
+}
+
+// addWrites records the keys written by the changes of the tx, with the
+// versions they are written at
+func (rwset *TxReadWriteSet) addWrites(delta *statemgmt.StateDelta) {
+	for _, chaincodeID := range delta.GetUpdatedChaincodeIds(false) {
+		for key, updatedValue := range delta.GetUpdates(chaincodeID) {
+			addKey(rwset.Writes, chaincodeID, key)
+			addKeyVersion(rwset.WriteVersions, chaincodeID, key, keyVersion(updatedValue.GetValue()))
+		}
+	}
+}
+
+func addKey(keys map[string]map[string]bool, chaincodeID string, key string) {
+	ccKeys, ok := keys[chaincodeID]
+	if !ok {
+		ccKeys = make(map[string]bool)
+		keys[chaincodeID] = ccKeys
+	}
+	ccKeys[key] = true
+}
+
+// AddWrites adds the writes of another read-write set to this one's
+func (rwset *TxReadWriteSet) AddWrites(other *TxReadWriteSet) {
+	for chaincodeID, keys := range other.Writes {
+		for key := range keys {
+			addKey(rwset.Writes, chaincodeID, key)
+		}
+	}
+}
+
+// ConflictsWith returns whether any key read by this read-write set, either
+// directly or by a range scan, is written by the other one
+func (rwset *TxReadWriteSet) ConflictsWith(other *TxReadWriteSet) bool {
+	for chaincodeID, writes := range other.Writes {
+		reads := rwset.Reads[chaincodeID]
+		ranges := rwset.Ranges[chaincodeID]
+		for key := range writes {
+			if reads[key] {
+				return true
+			}
+			for _, r := range ranges {
+				if r.contains(key) {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
+
+type isolatedTx struct {
+	lock       sync.Mutex
+	delta      *statemgmt.StateDelta
+	rwset      *TxReadWriteSet
+	finished   bool
+	successful bool
+}
+
+// TxBeginIsolated marks the begin of an isolated tx. Unlike TxBegin, this may
+// be called while other isolated txs are in progress
+func (state *State) TxBeginIsolated(txUUID string) {
+	logger.Debugf("txBeginIsolated() for txUuid [%s]", txUUID)
+	state.isolatedLock.Lock()
+	defer state.isolatedLock.Unlock()
+	if _, ok := state.isolatedTxs[txUUID]; ok {
+		panic(fmt.Errorf("An isolated tx [%s] is already in progress", txUUID))
+	}
+	state.isolatedTxs[txUUID] = &isolatedTx{delta: statemgmt.NewStateDelta(), rwset: NewTxReadWriteSet()}
+}
+
+// TxFinishIsolated marks the completion of an isolated tx. Its changes are
+// kept aside until TxApplyIsolated or TxDiscardIsolated is called
+func (state *State) TxFinishIsolated(txUUID string, txSuccessful bool) {
+	logger.Debugf("txFinishIsolated() for txUuid [%s], txSuccessful=[%t]", txUUID, txSuccessful)
+	tx := state.mustGetIsolatedTx(txUUID)
+	tx.lock.Lock()
+	defer tx.lock.Unlock()
+	tx.finished = true
+	tx.successful = txSuccessful
+}
+
+// GetTxReadWriteSet returns the read-write set of a finished isolated tx
+func (state *State) GetTxReadWriteSet(txUUID string) *TxReadWriteSet {
+	tx := state.mustGetIsolatedTx(txUUID)
+	tx.lock.Lock()
+	defer tx.lock.Unlock()
+	return tx.rwset
+}
+
+// TxApplyIsolated merges the changes of a finished isolated tx into the state,
+// as TxFinish does for a tx which executed serially, and returns whether the
+// tx was successful
+func (state *State) TxApplyIsolated(txUUID string) bool {
+	logger.Debugf("txApplyIsolated() for txUuid [%s]", txUUID)
+	tx := state.removeIsolatedTx(txUUID)
+	if !tx.finished {
+		panic(fmt.Errorf("Isolated tx [%s] applied before it finished", txUUID))
+	}
+	if !tx.successful {
+		return false
+	}
+	if !tx.delta.IsEmpty() {
+		state.stateDelta.ApplyChanges(tx.delta)
+		state.txStateDeltaHash[txUUID] = tx.delta.ComputeCryptoHash()
+		state.updateStateImpl = true
+	} else {
+		state.txStateDeltaHash[txUUID] = nil
+	}
+	tx.rwset.addWrites(tx.delta)
+	state.txReadWriteSets[txUUID] = tx.rwset
+	return true
+}
+
+// TxDiscardIsolated drops an isolated tx along with its changes
+func (state *State) TxDiscardIsolated(txUUID string) {
+	logger.Debugf("txDiscardIsolated() for txUuid [%s]", txUUID)
+	state.removeIsolatedTx(txUUID)
+}
+
+// isCurrentTx returns whether txUUID is the tx in progress which is not
+// isolated
+func (state *State) isCurrentTx(txUUID string) bool {
+	return state.txInProgress() && state.currentTxUUID == txUUID && state.currentTxRWSet != nil
+}
+
+func (state *State) getIsolatedTx(txUUID string) *isolatedTx {
+	state.isolatedLock.RLock()
+	defer state.isolatedLock.RUnlock()
+	return state.isolatedTxs[txUUID]
+}
+
+func (state *State) mustGetIsolatedTx(txUUID string) *isolatedTx {
+	tx := state.getIsolatedTx(txUUID)
+	if tx == nil {
+		panic(fmt.Errorf("No isolated tx [%s] in progress", txUUID))
+	}
+	return tx
+}
+
+func (state *State) removeIsolatedTx(txUUID string) *isolatedTx {
+	state.isolatedLock.Lock()
+	defer state.isolatedLock.Unlock()
+	tx, ok := state.isolatedTxs[txUUID]
+	if !ok {
+		panic(fmt.Errorf("No isolated tx [%s] in progress", txUUID))
+	}
+	delete(state.isolatedTxs, txUUID)
+	return tx
+}
+
+// GetForTx returns state for chaincodeID and key as seen by the given tx. For
+// an isolated tx, this looks at its own changes and then at the state as it
+// was when the tx began, and records the read. Otherwise this is the same as Get
+func (state *State) GetForTx(txUUID string, chaincodeID string, key string, committed bool) ([]byte, error) {
+	tx := state.getIsolatedTx(txUUID)
+	if tx == nil || committed {
+		value, err := state.Get(chaincodeID, key, committed)
+		if err == nil && !committed && state.isCurrentTx(txUUID) && state.currentTxStateDelta.Get(chaincodeID, key) == nil {
+			state.currentTxRWSet.addRead(chaincodeID, key, value)
+		}
+		return value, err
+	}
+	tx.lock.Lock()
+	defer tx.lock.Unlock()
+	if valueHolder := tx.delta.Get(chaincodeID, key); valueHolder != nil {
+		return valueHolder.GetValue(), nil
+	}
+	var value []byte
+	if valueHolder := state.stateDelta.Get(chaincodeID, key); valueHolder != nil {
+		value = valueHolder.GetValue()
+	} else {
+		var err error
+		if value, err = state.getCommitted(chaincodeID, key); err != nil {
+			return nil, err
+		}
+	}
+	tx.rwset.addRead(chaincodeID, key, value)
+	return value, nil
+}
+
+// GetFinishedTxReadWriteSet returns the read-write set of a tx of the batch
+// which finished successfully, isolated or not, nil if there is none. The
+// read-write sets are dropped along with the changes of the batch
+func (state *State) GetFinishedTxReadWriteSet(txUUID string) *TxReadWriteSet {
+	return state.txReadWriteSets[txUUID]
+}
+
+// GetRangeScanIteratorForTx returns a range scan iterator as seen by the given
+// tx, see GetForTx
+func (state *State) GetRangeScanIteratorForTx(txUUID string, chaincodeID string, startKey string, endKey string, committed bool) (statemgmt.RangeScanIterator, error) {
+	tx := state.getIsolatedTx(txUUID)
+	if tx == nil || committed {
+		if !committed && state.isCurrentTx(txUUID) {
+			state.currentTxRWSet.Ranges[chaincodeID] = append(state.currentTxRWSet.Ranges[chaincodeID], KeyRange{startKey, endKey})
+		}
+		return state.GetRangeScanIterator(chaincodeID, startKey, endKey, committed)
+	}
+	stateImplItr, err := state.stateImpl.GetRangeScanIterator(chaincodeID, startKey, endKey)
+	if err != nil {
+		return nil, err
+	}
+	tx.lock.Lock()
+	defer tx.lock.Unlock()
+	tx.rwset.Ranges[chaincodeID] = append(tx.rwset.Ranges[chaincodeID], KeyRange{startKey, endKey})
+	return newCompositeRangeScanIterator(
+		statemgmt.NewStateDeltaRangeScanIterator(tx.delta, chaincodeID, startKey, endKey),
+		statemgmt.NewStateDeltaRangeScanIterator(state.stateDelta, chaincodeID, startKey, endKey),
+		stateImplItr), nil
+}
+
+// SetForTx sets state for chaincodeID and key on behalf of the given tx. For
+// an isolated tx, the change is kept with the tx. Otherwise this is the same as Set
+func (state *State) SetForTx(txUUID string, chaincodeID string, key string, value []byte) error {
+	tx := state.getIsolatedTx(txUUID)
+	if tx == nil {
+		return state.Set(chaincodeID, key, value)
+	}
+	logger.Debugf("setForTx() txUuid=[%s], chaincodeID=[%s], key=[%s], value=[%#v]", txUUID, chaincodeID, key, value)
+	tx.lock.Lock()
+	defer tx.lock.Unlock()
+	if tx.delta.IsUpdatedValueSet(chaincodeID, key) {
+		tx.delta.Set(chaincodeID, key, value, nil)
+	} else {
+		previousValue, err := state.Get(chaincodeID, key, true)
+		if err != nil {
+			return err
+		}
+		tx.delta.Set(chaincodeID, key, value, previousValue)
+	}
+	addKey(tx.rwset.Writes, chaincodeID, key)
+	return nil
+}
+
+// DeleteForTx tracks the deletion of state for chaincodeID and key on behalf
+// of the given tx, see SetForTx
+func (state *State) DeleteForTx(txUUID string, chaincodeID string, key string) error {
+	tx := state.getIsolatedTx(txUUID)
+	if tx == nil {
+		return state.Delete(chaincodeID, key)
+	}
+	logger.Debugf("deleteForTx() txUuid=[%s], chaincodeID=[%s], key=[%s]", txUUID, chaincodeID, key)
+	tx.lock.Lock()
+	defer tx.lock.Unlock()
+	if tx.delta.IsUpdatedValueSet(chaincodeID, key) {
+		tx.delta.Delete(chaincodeID, key, nil)
+	} else {
+		previousValue, err := state.Get(chaincodeID, key, true)
+		if err != nil {
+			return err
+		}
+		tx.delta.Delete(chaincodeID, key, previousValue)
+	}
+	addKey(tx.rwset.Writes, chaincodeID, key)
+	return nil
+}
@@ -0,0 +1,134 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package state
+
+import (
+	"testing"
+
+	"github.com/hyperledger/fabric/core/ledger/testutil"
+	"github.com/hyperledger/fabric/core/util"
+)
+
+func TestIsolatedTxs(t *testing.T) {
+	stateTestWrapper, state := createFreshDBAndConstructState(t)
+	state.TxBegin("txUuid")
+	state.Set("chaincode1", "key1", []byte("value1"))
+	state.TxFinish("txUuid", true)
+
+	state.TxBeginIsolated("tx1")
+	state.TxBeginIsolated("tx2")
+	state.SetForTx("tx1", "chaincode1", "key1", []byte("value1_tx1"))
+	value, _ := state.GetForTx("tx2", "chaincode1", "key1", false)
+	testutil.AssertEquals(t, value, []byte("value1"))
+	value, _ = state.GetForTx("tx1", "chaincode1", "key1", false)
+	testutil.AssertEquals(t, value, []byte("value1_tx1"))
+	state.SetForTx("tx2", "chaincode2", "key2", []byte("value2_tx2"))
+	state.TxFinishIsolated("tx1", true)
+	state.TxFinishIsolated("tx2", true)
+
+	// isolated changes are not visible until applied
+	testutil.AssertEquals(t, stateTestWrapper.get("chaincode1", "key1", false), []byte("value1"))
+
+	rwset1 := state.GetTxReadWriteSet("tx1")
+	rwset2 := state.GetTxReadWriteSet("tx2")
+	testutil.AssertEquals(t, rwset2.ConflictsWith(rwset1), true)
+	testutil.AssertEquals(t, rwset1.ConflictsWith(rwset2), false)
+
+	testutil.AssertEquals(t, state.TxApplyIsolated("tx1"), true)
+	state.TxDiscardIsolated("tx2")
+	testutil.AssertEquals(t, stateTestWrapper.get("chaincode1", "key1", false), []byte("value1_tx1"))
+	testutil.AssertNil(t, stateTestWrapper.get("chaincode2", "key2", false))
+	testutil.AssertNotNil(t, state.GetTxStateDeltaHash()["tx1"])
+	_, ok := state.GetTxStateDeltaHash()["tx2"]
+	testutil.AssertEquals(t, ok, false)
+
+	// an unsuccessful tx leaves no trace
+	state.TxBeginIsolated("tx3")
+	state.DeleteForTx("tx3", "chaincode1", "key1")
+	state.TxFinishIsolated("tx3", false)
+	testutil.AssertEquals(t, state.TxApplyIsolated("tx3"), false)
+	testutil.AssertEquals(t, stateTestWrapper.get("chaincode1", "key1", false), []byte("value1_tx1"))
+}
+
+func TestIsolatedTxRangeConflicts(t *testing.T) {
+	_, state := createFreshDBAndConstructState(t)
+	state.TxBeginIsolated("tx1")
+	state.TxBeginIsolated("tx2")
+	itr, _ := state.GetRangeScanIteratorForTx("tx1", "chaincode1", "key1", "key5", false)
+	itr.Close()
+	state.SetForTx("tx2", "chaincode1", "key3", []byte("value3"))
+	state.TxFinishIsolated("tx1", true)
+	state.TxFinishIsolated("tx2", true)
+
+	rwset1 := state.GetTxReadWriteSet("tx1")
+	rwset2 := state.GetTxReadWriteSet("tx2")
+	testutil.AssertEquals(t, rwset1.ConflictsWith(rwset2), true)
+
+	other := NewTxReadWriteSet()
+	other.Writes["chaincode1"] = map[string]bool{"key6": true}
+	other.Writes["chaincode2"] = map[string]bool{"key3": true}
+	testutil.AssertEquals(t, rwset1.ConflictsWith(other), false)
+}
+
+func TestTxReadWriteSetVersions(t *testing.T) {
+	stateTestWrapper, state := createFreshDBAndConstructState(t)
+	state.TxBegin("txUuid")
+	state.Set("chaincode1", "key1", []byte("value1"))
+	state.Set("chaincode1", "key2", []byte("value2"))
+	state.TxFinish("txUuid", true)
+	stateTestWrapper.persistAndClearInMemoryChanges(0)
+
+	// a tx which is not isolated
+	state.TxBegin("tx1")
+	state.GetForTx("tx1", "chaincode1", "key1", false)
+	state.GetForTx("tx1", "chaincode1", "missing", false)
+	state.GetForTx("tx1", "chaincode1", "key2", true)
+	state.SetForTx("tx1", "chaincode1", "key3", []byte("value3"))
+	state.GetForTx("tx1", "chaincode1", "key3", false)
+	state.DeleteForTx("tx1", "chaincode1", "key2")
+	itr, _ := state.GetRangeScanIteratorForTx("tx1", "chaincode2", "a", "b", false)
+	itr.Close()
+	state.TxFinish("tx1", true)
+
+	rwset := state.GetFinishedTxReadWriteSet("tx1")
+	testutil.AssertEquals(t, rwset.ReadVersions, map[string]map[string][]byte{
+		"chaincode1": {"key1": util.ComputeCryptoHash([]byte("value1")), "missing": nil}})
+	testutil.AssertEquals(t, rwset.Ranges, map[string][]KeyRange{"chaincode2": {{"a", "b"}}})
+	testutil.AssertEquals(t, rwset.WriteVersions, map[string]map[string][]byte{
+		"chaincode1": {"key2": nil, "key3": util.ComputeCryptoHash([]byte("value3"))}})
+
+	// an isolated tx reads the changes of the txs of the batch
+	state.TxBeginIsolated("tx2")
+	state.GetForTx("tx2", "chaincode1", "key3", false)
+	state.SetForTx("tx2", "chaincode1", "key1", []byte("value1_tx2"))
+	state.TxFinishIsolated("tx2", true)
+	state.TxApplyIsolated("tx2")
+	rwset = state.GetFinishedTxReadWriteSet("tx2")
+	testutil.AssertEquals(t, rwset.ReadVersions, map[string]map[string][]byte{
+		"chaincode1": {"key3": util.ComputeCryptoHash([]byte("value3"))}})
+	testutil.AssertEquals(t, rwset.WriteVersions, map[string]map[string][]byte{
+		"chaincode1": {"key1": util.ComputeCryptoHash([]byte("value1_tx2"))}})
+
+	// the read-write sets of failed txs are not kept, nor those of the batches
+	// committed
+	state.TxBegin("tx3")
+	state.GetForTx("tx3", "chaincode1", "key1", false)
+	state.TxFinish("tx3", false)
+	testutil.AssertNil(t, state.GetFinishedTxReadWriteSet("tx3"))
+	stateTestWrapper.persistAndClearInMemoryChanges(1)
+	testutil.AssertNil(t, state.GetFinishedTxReadWriteSet("tx1"))
+}
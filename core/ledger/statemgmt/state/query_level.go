@@ -0,0 +1,64 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package state
+
+import (
+	"github.com/hyperledger/fabric/core/ledger/statemgmt"
+)
+
+// QueryLevel is the state read by a query, which runs outside of any tx
+type QueryLevel int
+
+const (
+	// QueryCommitted reads the state committed to the DB
+	QueryCommitted QueryLevel = iota
+	// QueryTentative reads through the changes of the txs of the batch in
+	// progress which finished successfully, and those of the blocks staged
+	// but not persisted yet. The changes of the tx in progress, if any, are
+	// not seen since it may still fail. This lets speculative execution see
+	// the effects of the earlier txs of a batch before it is committed
+	QueryTentative
+)
+
+// GetAtLevel returns the value of chaincodeID and key as seen by a query of
+// the given level. Like the other reads of the in-memory changes, this must
+// not run concurrently with the txs of the batch
+func (state *State) GetAtLevel(chaincodeID string, key string, level QueryLevel) ([]byte, error) {
+	if level == QueryTentative {
+		if valueHolder := state.stateDelta.Get(chaincodeID, key); valueHolder != nil {
+			return valueHolder.GetValue(), nil
+		}
+	}
+	return state.getCommitted(chaincodeID, key)
+}
+
+// GetRangeScanIteratorAtLevel returns a range scan iterator as seen by a
+// query of the given level, see GetAtLevel
+func (state *State) GetRangeScanIteratorAtLevel(chaincodeID string, startKey string, endKey string, level QueryLevel) (statemgmt.RangeScanIterator, error) {
+	stateImplItr, err := state.stateImpl.GetRangeScanIterator(chaincodeID, startKey, endKey)
+	if err != nil {
+		return nil, err
+	}
+	if level != QueryTentative {
+		return stateImplItr, nil
+	}
+	// no tx changes are seen
+	return newCompositeRangeScanIterator(
+		statemgmt.NewStateDeltaRangeScanIterator(statemgmt.NewStateDelta(), chaincodeID, startKey, endKey),
+		statemgmt.NewStateDeltaRangeScanIterator(state.stateDelta, chaincodeID, startKey, endKey),
+		stateImplItr), nil
+}
@@ -0,0 +1,73 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package state
+
+import (
+	"testing"
+
+	"github.com/hyperledger/fabric/core/ledger/statemgmt"
+	"github.com/hyperledger/fabric/core/ledger/testutil"
+)
+
+func TestQueryLevels(t *testing.T) {
+	stateTestWrapper, state := createFreshDBAndConstructState(t)
+	state.TxBegin("txUuid1")
+	state.Set("chaincode1", "key1", []byte("value1"))
+	state.Set("chaincode1", "key2", []byte("value2"))
+	state.TxFinish("txUuid1", true)
+	stateTestWrapper.persistAndClearInMemoryChanges(0)
+
+	state.TxBegin("txUuid2")
+	state.Set("chaincode1", "key1", []byte("value1_tx2"))
+	state.Delete("chaincode1", "key2")
+	state.Set("chaincode1", "key3", []byte("value3_tx2"))
+	state.TxFinish("txUuid2", true)
+
+	// the tx in progress is not seen
+	state.TxBegin("txUuid3")
+	state.Set("chaincode1", "key4", []byte("value4_tx3"))
+
+	value, _ := state.GetAtLevel("chaincode1", "key1", QueryCommitted)
+	testutil.AssertEquals(t, value, []byte("value1"))
+	value, _ = state.GetAtLevel("chaincode1", "key1", QueryTentative)
+	testutil.AssertEquals(t, value, []byte("value1_tx2"))
+	value, _ = state.GetAtLevel("chaincode1", "key2", QueryTentative)
+	testutil.AssertNil(t, value)
+	value, _ = state.GetAtLevel("chaincode1", "key4", QueryTentative)
+	testutil.AssertNil(t, value)
+
+	itr, _ := state.GetRangeScanIteratorAtLevel("chaincode1", "", "", QueryCommitted)
+	testutil.AssertEquals(t, rangeScanResults(itr), map[string][]byte{"key1": []byte("value1"), "key2": []byte("value2")})
+	itr, _ = state.GetRangeScanIteratorAtLevel("chaincode1", "", "", QueryTentative)
+	testutil.AssertEquals(t, rangeScanResults(itr), map[string][]byte{"key1": []byte("value1_tx2"), "key3": []byte("value3_tx2")})
+	state.TxFinish("txUuid3", false)
+
+	// the changes of the staged blocks are seen
+	state.StageBlock()
+	value, _ = state.GetAtLevel("chaincode1", "key3", QueryTentative)
+	testutil.AssertEquals(t, value, []byte("value3_tx2"))
+}
+
+func rangeScanResults(itr statemgmt.RangeScanIterator) map[string][]byte {
+	defer itr.Close()
+	results := make(map[string][]byte)
+	for itr.Next() {
+		k, v := itr.GetKeyValue()
+		results[k] = v
+	}
+	return results
+}
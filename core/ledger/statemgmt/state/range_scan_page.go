@@ -0,0 +1,77 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package state
+
+import (
+	"encoding/base64"
+	"fmt"
+
+	"github.com/hyperledger/fabric/core/ledger/statemgmt"
+)
+
+// RangeScanPage holds a page of the key-values of a range of the state
+type RangeScanPage struct {
+	Keys   []string
+	Values [][]byte
+	// Bookmark resumes the range scan after the page, it is empty once the
+	// range is exhausted
+	Bookmark string
+}
+
+// GetRangeScanPage returns at most pageSize key-values of the committed state
+// of a chaincodeID between startKey and endKey, in the order of
+// GetRangeScanIterator. The scan starts after the page bookmark was returned
+// with, or at the beginning of the range if bookmark is empty. No resources
+// are held between pages, which see the changes committed in between.
+func (state *State) GetRangeScanPage(chaincodeID string, startKey string, endKey string, pageSize int, bookmark string) (*RangeScanPage, error) {
+	if pageSize <= 0 {
+		return nil, fmt.Errorf("Page size must be greater than 0. Current value is %d.", pageSize)
+	}
+	var itr statemgmt.RangeScanIterator
+	var err error
+	if bookmark == "" {
+		itr, err = state.stateImpl.GetRangeScanIterator(chaincodeID, startKey, endKey)
+	} else {
+		resumer, ok := state.stateImpl.(statemgmt.RangeScanResumer)
+		if !ok {
+			return nil, fmt.Errorf("State data structure '%s' does not support resuming range scans", stateImplName)
+		}
+		lastKey, decodeErr := base64.RawURLEncoding.DecodeString(bookmark)
+		if decodeErr != nil {
+			return nil, fmt.Errorf("Invalid bookmark: %s", decodeErr)
+		}
+		if string(lastKey) < startKey || (endKey != "" && string(lastKey) > endKey) {
+			return nil, fmt.Errorf("Invalid bookmark: it is out of the range")
+		}
+		itr, err = resumer.GetRangeScanIteratorAfter(chaincodeID, startKey, endKey, string(lastKey))
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer itr.Close()
+
+	page := &RangeScanPage{}
+	for len(page.Keys) < pageSize && itr.Next() {
+		key, value := itr.GetKeyValue()
+		page.Keys = append(page.Keys, key)
+		page.Values = append(page.Values, value)
+	}
+	if len(page.Keys) == pageSize && itr.Next() {
+		page.Bookmark = base64.RawURLEncoding.EncodeToString([]byte(page.Keys[pageSize-1]))
+	}
+	return page, nil
+}
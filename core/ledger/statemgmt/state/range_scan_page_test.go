@@ -0,0 +1,84 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package state
+
+import (
+	"encoding/base64"
+	"fmt"
+	"testing"
+
+	"github.com/hyperledger/fabric/core/ledger/testutil"
+)
+
+func TestStateRangeScanPage(t *testing.T) {
+	stateTestWrapper, state := createFreshDBAndConstructState(t)
+	state.TxBegin("txUuid")
+	for i := 0; i < 25; i++ {
+		state.Set("chaincode1", fmt.Sprintf("key%02d", i), []byte(fmt.Sprintf("value%02d", i)))
+		state.Set("chaincode2", fmt.Sprintf("key%02d", i), []byte(fmt.Sprintf("value%02d", i)))
+	}
+	state.TxFinish("txUuid", true)
+	stateTestWrapper.persistAndClearInMemoryChanges(0)
+
+	expected := make(map[string][]byte)
+	for i := 2; i < 23; i++ {
+		expected[fmt.Sprintf("key%02d", i)] = []byte(fmt.Sprintf("value%02d", i))
+	}
+	results := make(map[string][]byte)
+	pages := 0
+	bookmark := ""
+	for {
+		page, err := state.GetRangeScanPage("chaincode1", "key02", "key22", 4, bookmark)
+		testutil.AssertNoError(t, err, "Error getting page")
+		for i, key := range page.Keys {
+			if _, ok := results[key]; ok {
+				t.Fatalf("Key %s returned twice", key)
+			}
+			results[key] = page.Values[i]
+		}
+		pages++
+		if page.Bookmark == "" {
+			break
+		}
+		testutil.AssertEquals(t, len(page.Keys), 4)
+		bookmark = page.Bookmark
+
+		// Pages see the changes committed in between
+		if pages == 2 {
+			state.TxBegin("txUuid")
+			state.Set("chaincode1", "key22", []byte("updated"))
+			state.TxFinish("txUuid", true)
+			stateTestWrapper.persistAndClearInMemoryChanges(1)
+			expected["key22"] = []byte("updated")
+		}
+	}
+	testutil.AssertEquals(t, pages, 6)
+	testutil.AssertEquals(t, results, expected)
+
+	// A range filling the last page exactly has no bookmark
+	page, err := state.GetRangeScanPage("chaincode1", "key00", "key03", 4, "")
+	testutil.AssertNoError(t, err, "Error getting page")
+	testutil.AssertEquals(t, len(page.Keys), 4)
+	testutil.AssertEquals(t, page.Bookmark, "")
+
+	_, err = state.GetRangeScanPage("chaincode1", "key02", "key22", 4, "not a bookmark!")
+	testutil.AssertError(t, err, "Expected an invalid bookmark to fail")
+	_, err = state.GetRangeScanPage("chaincode1", "key10", "key22", 4, base64.RawURLEncoding.EncodeToString([]byte("key05")))
+	testutil.AssertError(t, err, "Expected a bookmark out of the range to fail")
+	_, err = state.GetRangeScanPage("chaincode1", "key02", "key22", 0, "")
+	testutil.AssertError(t, err, "Expected a page size of 0 to fail")
+}
@@ -0,0 +1,139 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package state
+
+import (
+	"container/list"
+	"sync"
+
+	"github.com/hyperledger/fabric/core/ledger/statemgmt"
+)
+
+// readCache keeps the committed values of the keys read last in memory, in
+// front of the state implementation, evicting the least recently used ones
+// once their keys and values add up to its size.  Keys which are not in the
+// state are cached too.  The keys changed by a commit are dropped once it is
+// persisted; a read of the state implementation racing with a commit is not
+// cached, as it may have read the value of either side of it.
+type readCache struct {
+	lock       sync.Mutex
+	maxSize    uint64
+	size       uint64
+	entries    map[string]*list.Element
+	lru        *list.List // of *readCacheEntry, most recently used first
+	generation uint64     // incremented by each invalidation
+}
+
+type readCacheEntry struct {
+	key   string
+	value []byte
+}
+
+// newReadCache returns a cache of maxSizeMBs, nil if maxSizeMBs is not greater than 0
+func newReadCache(maxSizeMBs int) *readCache {
+	if maxSizeMBs <= 0 {
+		return nil
+	}
+	return &readCache{
+		maxSize: uint64(maxSizeMBs) * 1024 * 1024,
+		entries: make(map[string]*list.Element),
+		lru:     list.New(),
+	}
+}
+
+// get returns the cached value of key, if any, and the generation to pass to
+// add if the value is read from the state implementation instead
+func (cache *readCache) get(key string) ([]byte, bool, uint64) {
+	cache.lock.Lock()
+	defer cache.lock.Unlock()
+	element, ok := cache.entries[key]
+	if !ok {
+		return nil, false, cache.generation
+	}
+	cache.lru.MoveToFront(element)
+	return element.Value.(*readCacheEntry).value, true, cache.generation
+}
+
+// add caches the value of key read from the state implementation, unless
+// the cache was invalidated since generation was returned by get
+func (cache *readCache) add(key string, value []byte, generation uint64) {
+	cache.lock.Lock()
+	defer cache.lock.Unlock()
+	if generation != cache.generation {
+		return
+	}
+	if _, ok := cache.entries[key]; ok {
+		return
+	}
+	entrySize := uint64(len(key) + len(value))
+	if entrySize > cache.maxSize {
+		return
+	}
+	cache.entries[key] = cache.lru.PushFront(&readCacheEntry{key, value})
+	cache.size += entrySize
+	for cache.size > cache.maxSize {
+		cache.remove(cache.lru.Back())
+	}
+}
+
+// invalidate drops the keys changed by delta
+func (cache *readCache) invalidate(delta *statemgmt.StateDelta) {
+	cache.lock.Lock()
+	defer cache.lock.Unlock()
+	cache.generation++
+	for _, chaincodeID := range delta.GetUpdatedChaincodeIds(false) {
+		for key := range delta.GetUpdates(chaincodeID) {
+			if element, ok := cache.entries[string(statemgmt.ConstructCompositeKey(chaincodeID, key))]; ok {
+				cache.remove(element)
+			}
+		}
+	}
+}
+
+// clear drops all the keys
+func (cache *readCache) clear() {
+	cache.lock.Lock()
+	defer cache.lock.Unlock()
+	cache.generation++
+	cache.entries = make(map[string]*list.Element)
+	cache.lru.Init()
+	cache.size = 0
+}
+
+func (cache *readCache) remove(element *list.Element) {
+	entry := cache.lru.Remove(element).(*readCacheEntry)
+	delete(cache.entries, entry.key)
+	cache.size -= uint64(len(entry.key) + len(entry.value))
+}
+
+// getCommitted returns the committed value of chaincodeID and key, through the read cache if enabled
+func (state *State) getCommitted(chaincodeID string, key string) ([]byte, error) {
+	if state.readCache == nil {
+		return state.stateImpl.Get(chaincodeID, key)
+	}
+	cacheKey := string(statemgmt.ConstructCompositeKey(chaincodeID, key))
+	value, ok, generation := state.readCache.get(cacheKey)
+	if ok {
+		return value, nil
+	}
+	value, err := state.stateImpl.Get(chaincodeID, key)
+	if err != nil {
+		return nil, err
+	}
+	state.readCache.add(cacheKey, value, generation)
+	return value, nil
+}
@@ -0,0 +1,102 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package state
+
+import (
+	"testing"
+
+	"github.com/hyperledger/fabric/core/ledger/statemgmt"
+	"github.com/hyperledger/fabric/core/ledger/testutil"
+)
+
+func TestReadCacheEviction(t *testing.T) {
+	testutil.AssertNil(t, newReadCache(0))
+	cache := newReadCache(1)
+	cache.maxSize = 10
+
+	_, _, generation := cache.get("k1")
+	cache.add("k1", []byte("v1"), generation)
+	cache.add("k2", []byte("v2"), generation)
+	cache.add("k3", nil, generation)
+	testutil.AssertEquals(t, cache.size, uint64(10))
+
+	// k1 is used last, k2 is evicted first
+	value, ok, _ := cache.get("k1")
+	testutil.AssertEquals(t, ok, true)
+	testutil.AssertEquals(t, value, []byte("v1"))
+	cache.add("k4", []byte("v4"), generation)
+	_, ok, _ = cache.get("k2")
+	testutil.AssertEquals(t, ok, false)
+	value, ok, _ = cache.get("k3")
+	testutil.AssertEquals(t, ok, true)
+	testutil.AssertNil(t, value)
+	testutil.AssertEquals(t, cache.size, uint64(10))
+
+	// a value bigger than the cache is not cached
+	cache.add("k5", []byte("0123456789"), generation)
+	_, ok, _ = cache.get("k5")
+	testutil.AssertEquals(t, ok, false)
+
+	// a value read before an invalidation is not cached
+	delta := statemgmt.NewStateDelta()
+	delta.Set("chaincode1", "key1", []byte("value1"), nil)
+	cache.invalidate(delta)
+	cache.add("k6", []byte("v6"), generation)
+	_, ok, _ = cache.get("k6")
+	testutil.AssertEquals(t, ok, false)
+
+	cache.clear()
+	testutil.AssertEquals(t, cache.size, uint64(0))
+	_, ok, _ = cache.get("k1")
+	testutil.AssertEquals(t, ok, false)
+}
+
+func TestStateReadCache(t *testing.T) {
+	stateTestWrapper, state := createFreshDBAndConstructState(t)
+	state.readCache = newReadCache(1)
+	state.TxBegin("txUuid")
+	state.Set("chaincode1", "key1", []byte("value1"))
+	state.Set("chaincode1", "key2", []byte("value2"))
+	state.TxFinish("txUuid", true)
+	stateTestWrapper.persistAndClearInMemoryChanges(0)
+
+	testutil.AssertEquals(t, stateTestWrapper.get("chaincode1", "key1", true), []byte("value1"))
+	testutil.AssertEquals(t, stateTestWrapper.get("chaincode1", "key2", true), []byte("value2"))
+	testutil.AssertNil(t, stateTestWrapper.get("chaincode1", "key3", true))
+	testutil.AssertEquals(t, len(state.readCache.entries), 3)
+
+	// the keys changed by a commit are dropped once it is persisted
+	state.TxBegin("txUuid")
+	state.Set("chaincode1", "key1", []byte("value1_new"))
+	state.Set("chaincode1", "key3", []byte("value3"))
+	state.TxFinish("txUuid", true)
+	stateTestWrapper.persistAndClearInMemoryChanges(1)
+	testutil.AssertEquals(t, len(state.readCache.entries), 1)
+	testutil.AssertEquals(t, stateTestWrapper.get("chaincode1", "key1", true), []byte("value1_new"))
+	testutil.AssertEquals(t, stateTestWrapper.get("chaincode1", "key3", true), []byte("value3"))
+
+	// the changes rolled back are not dropped
+	state.TxBegin("txUuid")
+	state.Delete("chaincode1", "key2")
+	state.TxFinish("txUuid", true)
+	state.ClearInMemoryChanges(false)
+	testutil.AssertEquals(t, len(state.readCache.entries), 3)
+
+	testutil.AssertNoError(t, state.DeleteState(), "Error while deleting the state")
+	testutil.AssertEquals(t, len(state.readCache.entries), 0)
+	testutil.AssertNil(t, stateTestWrapper.get("chaincode1", "key2", true))
+}
@@ -17,24 +17,25 @@ limitations under the License.
 package state
 
 import (
+	"bytes"
 	"encoding/binary"
 	"fmt"
+	"sync"
 
 	"github.com/hyperledger/fabric/core/db"
 	"github.com/hyperledger/fabric/core/ledger/statemgmt"
 	"github.com/hyperledger/fabric/core/ledger/statemgmt/buckettree"
+	"github.com/hyperledger/fabric/core/ledger/statemgmt/couchdb"
 	"github.com/hyperledger/fabric/core/ledger/statemgmt/raw"
 	"github.com/hyperledger/fabric/core/ledger/statemgmt/trie"
+	"github.com/hyperledger/fabric/core/util"
 	"github.com/op/go-logging"
-	"github.com/tecbot/gorocksdb"
 )
 
 var logger = logging.MustGetLogger("state")
 
 const detaultStateImpl = "buckettree"
 
-var stateImpl statemgmt.HashableState
-
 // State structure for maintaining world state.
 // This encapsulates a particular implementation for managing the state persistence
 // This is not thread safe
@@ -46,28 +47,59 @@ type State struct {
 	txStateDeltaHash      map[string][]byte
 	updateStateImpl       bool
 	historyStateDeltaSize uint64
+	isolatedTxs           map[string]*isolatedTx
+	isolatedLock          sync.RWMutex
+	stagedDeltas          []*statemgmt.StateDelta
+	indexesReady          bool
+	indexer               *stateIndexer         // nil unless the indexes are updated asynchronously
+	indexDelta            *statemgmt.StateDelta // the changes being persisted, for the indexer
+	openchainDB           *db.OpenchainDB
+	views                 map[*StateView]struct{}
+	viewsLock             sync.Mutex
+	persistingDelta       *statemgmt.StateDelta // the changes being persisted, for the views opened meanwhile
+	readCache             *readCache            // nil if disabled
+	currentTxRWSet        *TxReadWriteSet
+	txReadWriteSets       map[string]*TxReadWriteSet // of the txs of the batch which finished successfully
 }
 
-// NewState constructs a new State. This Initializes encapsulated state implementation
+// NewState constructs a new State of the default chain. This Initializes encapsulated state implementation
 func NewState() *State {
+	return NewChainState(db.DefaultChainID)
+}
+
+// NewChainState constructs a new State of a chain, kept in the DB of the chain. This Initializes
+// encapsulated state implementation
+func NewChainState(chainID string) *State {
 	initConfig()
-	logger.Infof("Initializing state implementation [%s]", stateImplName)
+	logger.Infof("Initializing state implementation [%s] of chain [%s]", stateImplName, chainID)
+	openchainDB := db.GetChainDBHandle(chainID)
+	var stateImpl statemgmt.HashableState
 	switch stateImplName {
 	case "buckettree":
-		stateImpl = buckettree.NewStateImpl()
+		stateImpl = buckettree.NewStateImpl(openchainDB)
 	case "trie":
-		stateImpl = trie.NewStateTrie()
+		stateImpl = trie.NewStateTrie(openchainDB)
 	case "raw":
-		stateImpl = raw.NewRawState()
+		stateImpl = raw.NewRawState(openchainDB)
+	case "couchdb":
+		stateImpl = couchdb.NewStateImpl(openchainDB)
 	default:
 		panic("Should not reach here. Configs should have checked for the stateImplName being a valid names ")
 	}
-	err := stateImpl.Initialize(stateImplConfigs)
+	err := stateImpl.Initialize(chainStateImplConfigs(chainID))
 	if err != nil {
 		panic(fmt.Errorf("Error during initialization of state implementation: %s", err))
 	}
-	return &State{stateImpl, statemgmt.NewStateDelta(), statemgmt.NewStateDelta(), "", make(map[string][]byte),
-		false, uint64(deltaHistorySize)}
+	state := &State{stateImpl, statemgmt.NewStateDelta(), statemgmt.NewStateDelta(), "", make(map[string][]byte),
+		false, uint64(deltaHistorySize), make(map[string]*isolatedTx), sync.RWMutex{}, nil, true, nil, nil, openchainDB,
+		make(map[*StateView]struct{}), sync.Mutex{}, nil, newReadCache(readCacheSize), nil, make(map[string]*TxReadWriteSet)}
+	if err = state.initIndexes(); err != nil {
+		panic(fmt.Errorf("Error during initialization of the indexes of the state: %s", err))
+	}
+	if indexesEnabled && asyncIndexes {
+		state.indexer = newStateIndexer(state)
+	}
+	return state
 }
 
 // TxBegin marks begin of a new tx. If a tx is already in progress, this call panics
@@ -77,6 +109,7 @@ func (state *State) TxBegin(txUUID string) {
 		panic(fmt.Errorf("A tx [%s] is already in progress. Received call for begin of another tx [%s]", state.currentTxUUID, txUUID))
 	}
 	state.currentTxUUID = txUUID
+	state.currentTxRWSet = NewTxReadWriteSet()
 }
 
 // TxFinish marks the completion of on-going tx. If txUUID is not same as of the on-going tx, this call panics
@@ -94,9 +127,12 @@ func (state *State) TxFinish(txUUID string, txSuccessful bool) {
 		} else {
 			state.txStateDeltaHash[txUUID] = nil
 		}
+		state.currentTxRWSet.addWrites(state.currentTxStateDelta)
+		state.txReadWriteSets[txUUID] = state.currentTxRWSet
 	}
 	state.currentTxStateDelta = statemgmt.NewStateDelta()
 	state.currentTxUUID = ""
+	state.currentTxRWSet = nil
 }
 
 func (state *State) txInProgress() bool {
@@ -116,7 +152,7 @@ func (state *State) Get(chaincodeID string, key string, committed bool) ([]byte,
 			return valueHolder.GetValue(), nil
 		}
 	}
-	return state.stateImpl.Get(chaincodeID, key)
+	return state.getCommitted(chaincodeID, key)
 }
 
 // GetRangeScanIterator returns an iterator to get all the keys (and values) between startKey and endKey
@@ -136,6 +172,16 @@ func (state *State) GetRangeScanIterator(chaincodeID string, startKey string, en
 		stateImplItr), nil
 }
 
+// GetProof returns the committed value for chaincodeID and key, and a proof that the committed state has this
+// value. The proof can be verified against the state hash of the last block by the state data structure
+func (state *State) GetProof(chaincodeID string, key string) ([]byte, []byte, error) {
+	prover, ok := state.stateImpl.(statemgmt.StateProver)
+	if !ok {
+		return nil, nil, fmt.Errorf("State data structure '%s' does not support proofs", stateImplName)
+	}
+	return prover.GetStateProof(chaincodeID, key)
+}
+
 // Set sets state to given value for chaincodeID and key. Does not immideatly writes to DB
 func (state *State) Set(chaincodeID string, key string, value []byte) error {
 	logger.Debugf("set() chaincodeID=[%s], key=[%s], value=[%#v]", chaincodeID, key, value)
@@ -249,11 +295,54 @@ func (state *State) GetTxStateDeltaHash() map[string][]byte {
 
 // ClearInMemoryChanges remove from memory all the changes to state
 func (state *State) ClearInMemoryChanges(changesPersisted bool) {
+	state.indexDeltaPersisted(changesPersisted)
+	state.persistedToViews()
+	if changesPersisted && state.readCache != nil {
+		state.readCache.invalidate(state.stateDelta)
+	}
 	state.stateDelta = statemgmt.NewStateDelta()
 	state.txStateDeltaHash = make(map[string][]byte)
+	state.txReadWriteSets = make(map[string]*TxReadWriteSet)
+	state.stagedDeltas = nil
 	state.stateImpl.ClearWorkingSet(changesPersisted)
 }
 
+// StageBlock marks the end of the changes of a block which is not persisted
+// yet. Its changes stay in memory, visible to the blocks which follow, until
+// AddChangesForPersistence persists them along with those of the last block
+func (state *State) StageBlock() {
+	state.stagedDeltas = append(state.stagedDeltas, state.unstagedDelta())
+	state.txStateDeltaHash = make(map[string][]byte)
+	state.txReadWriteSets = make(map[string]*TxReadWriteSet)
+}
+
+// unstagedDelta returns the changes made since the last staged block, with the
+// previous values as they were at the end of that block
+func (state *State) unstagedDelta() *statemgmt.StateDelta {
+	staged := statemgmt.NewStateDelta()
+	for _, delta := range state.stagedDeltas {
+		staged.ApplyChanges(delta)
+	}
+	unstaged := statemgmt.NewStateDelta()
+	for _, chaincodeID := range state.stateDelta.GetUpdatedChaincodeIds(false) {
+		for key, updatedValue := range state.stateDelta.GetUpdates(chaincodeID) {
+			previousValue := updatedValue.GetPreviousValue()
+			if stagedValue := staged.Get(chaincodeID, key); stagedValue != nil {
+				if stagedValue.IsDelete() == updatedValue.IsDelete() && bytes.Equal(stagedValue.GetValue(), updatedValue.GetValue()) {
+					continue
+				}
+				previousValue = stagedValue.GetValue()
+			}
+			if updatedValue.IsDelete() {
+				unstaged.Delete(chaincodeID, key, previousValue)
+			} else {
+				unstaged.Set(chaincodeID, key, updatedValue.GetValue(), previousValue)
+			}
+		}
+	}
+	return unstaged
+}
+
 // getStateDelta get changes in state after most recent call to method clearInMemoryChanges
 func (state *State) getStateDelta() *statemgmt.StateDelta {
 	return state.stateDelta
@@ -261,35 +350,64 @@ func (state *State) getStateDelta() *statemgmt.StateDelta {
 
 // GetSnapshot returns a snapshot of the global state for the current block. stateSnapshot.Release()
 // must be called once you are done.
-func (state *State) GetSnapshot(blockNumber uint64, dbSnapshot *gorocksdb.Snapshot) (*StateSnapshot, error) {
-	return newStateSnapshot(blockNumber, dbSnapshot)
+func (state *State) GetSnapshot(blockNumber uint64, dbSnapshot db.Snapshot) (*StateSnapshot, error) {
+	return newStateSnapshot(state.stateImpl, blockNumber, dbSnapshot)
 }
 
 // FetchStateDeltaFromDB fetches the StateDelta corrsponding to given blockNumber
 func (state *State) FetchStateDeltaFromDB(blockNumber uint64) (*statemgmt.StateDelta, error) {
-	stateDeltaBytes, err := db.GetDBHandle().GetFromStateDeltaCF(encodeStateDeltaKey(blockNumber))
+	stateDeltaBytes, err := state.openchainDB.GetFromStateDeltaCF(encodeStateDeltaKey(blockNumber))
 	if err != nil {
 		return nil, err
 	}
 	if stateDeltaBytes == nil {
 		return nil, nil
 	}
+	// the state deltas written with ledger.state.deltaCompression enabled are
+	// compressed, whatever the setting is now
+	if util.IsGzipCompressed(stateDeltaBytes) {
+		if stateDeltaBytes, err = util.GzipDecompress(stateDeltaBytes); err != nil {
+			return nil, fmt.Errorf("Error decompressing the state delta of block %d: %s", blockNumber, err)
+		}
+	}
 	stateDelta := statemgmt.NewStateDelta()
 	stateDelta.Unmarshal(stateDeltaBytes)
 	return stateDelta, nil
 }
 
 // AddChangesForPersistence adds key-value pairs to writeBatch
-func (state *State) AddChangesForPersistence(blockNumber uint64, writeBatch *gorocksdb.WriteBatch) {
+func (state *State) AddChangesForPersistence(blockNumber uint64, writeBatch db.WriteBatch) {
 	logger.Debug("state.addChangesForPersistence()...start")
 	if state.updateStateImpl {
 		state.stateImpl.PrepareWorkingSet(state.stateDelta)
 		state.updateStateImpl = false
 	}
+	state.copyToViews(state.stateDelta)
 	state.stateImpl.AddChangesForPersistence(writeBatch)
+	state.addIndexChangesForPersistence(state.stateDelta, writeBatch)
 
-	serializedStateDelta := state.stateDelta.Marshal()
-	cf := db.GetDBHandle().StateDeltaCF
+	deltas := []*statemgmt.StateDelta{state.stateDelta}
+	if len(state.stagedDeltas) > 0 {
+		// the staged blocks precede blockNumber
+		deltas = append(state.stagedDeltas, state.unstagedDelta())
+	}
+	for i, delta := range deltas {
+		state.addStateDeltaForPersistence(blockNumber+uint64(i+1)-uint64(len(deltas)), delta, writeBatch)
+	}
+	logger.Debug("state.addChangesForPersistence()...finished")
+}
+
+func (state *State) addStateDeltaForPersistence(blockNumber uint64, stateDelta *statemgmt.StateDelta, writeBatch db.WriteBatch) {
+	serializedStateDelta := stateDelta.Marshal()
+	if deltaCompression {
+		compressedStateDelta, err := util.GzipCompress(serializedStateDelta)
+		if err != nil {
+			logger.Warningf("Storing the state-delta of block number[%d] uncompressed, as it could not be compressed: %s", blockNumber, err)
+		} else {
+			serializedStateDelta = compressedStateDelta
+		}
+	}
+	cf := state.openchainDB.StateDeltaCF
 	logger.Debugf("Adding state-delta corresponding to block number[%d]", blockNumber)
 	writeBatch.PutCF(cf, encodeStateDeltaKey(blockNumber), serializedStateDelta)
 	if blockNumber >= state.historyStateDeltaSize {
@@ -300,7 +418,27 @@ func (state *State) AddChangesForPersistence(blockNumber uint64, writeBatch *gor
 		logger.Debugf("Not deleting previous state-delta. Block number [%d] is smaller than historyStateDeltaSize [%d]",
 			blockNumber, state.historyStateDeltaSize)
 	}
-	logger.Debug("state.addChangesForPersistence()...finished")
+}
+
+// AddOrphanedStateDeltasForDeletion adds to writeBatch the deletion of the state deltas kept for no block of a
+// blockchain of size blocks: those of the blocks not committed, and those of the blocks older than the last
+// historyStateDeltaSize ones, left behind if ledger.state.deltaHistorySize was lowered. deleted is called with
+// the key and value of each state delta deleted
+func (state *State) AddOrphanedStateDeltasForDeletion(size uint64, writeBatch db.WriteBatch, deleted func(key []byte, value []byte)) {
+	var oldest uint64
+	if size > state.historyStateDeltaSize {
+		oldest = size - state.historyStateDeltaSize
+	}
+	cf := state.openchainDB.StateDeltaCF
+	itr := state.openchainDB.GetStateDeltaCFIterator()
+	defer itr.Close()
+	for itr.SeekToFirst(); itr.Valid(); itr.Next() {
+		if blockNumber := decodeStateDeltaKey(itr.Key()); blockNumber < oldest || blockNumber >= size {
+			key := statemgmt.Copy(itr.Key())
+			writeBatch.DeleteCF(cf, key)
+			deleted(key, itr.Value())
+		}
+	}
 }
 
 // ApplyStateDelta applies already prepared stateDelta to the existing state.
@@ -314,17 +452,31 @@ func (state *State) ApplyStateDelta(delta *statemgmt.StateDelta) {
 // CommitStateDelta commits the changes from state.ApplyStateDelta to the
 // DB.
 func (state *State) CommitStateDelta() error {
+	writeBatch := state.openchainDB.NewWriteBatch()
+	defer writeBatch.Destroy()
+	return state.CommitStateDeltaWith(writeBatch)
+}
+
+// CommitStateDeltaWith commits the changes from state.ApplyStateDelta to the
+// DB along with the changes already added to writeBatch, in a single synced
+// write
+func (state *State) CommitStateDeltaWith(writeBatch db.WriteBatch) error {
 	if state.updateStateImpl {
 		state.stateImpl.PrepareWorkingSet(state.stateDelta)
 		state.updateStateImpl = false
 	}
 
-	writeBatch := gorocksdb.NewWriteBatch()
-	defer writeBatch.Destroy()
 	state.stateImpl.AddChangesForPersistence(writeBatch)
-	opt := gorocksdb.NewDefaultWriteOptions()
-	defer opt.Destroy()
-	return db.GetDBHandle().DB.Write(opt, writeBatch)
+	state.addIndexChangesForPersistence(state.stateDelta, writeBatch)
+	state.copyToViews(state.stateDelta)
+	defer state.persistedToViews()
+	err := state.openchainDB.WriteSync(writeBatch)
+	if err != nil {
+		state.indexDeltaPersisted(false)
+	} else if state.readCache != nil {
+		state.readCache.invalidate(state.stateDelta)
+	}
+	return err
 }
 
 // DeleteState deletes ALL state keys/values from the DB. This is generally
@@ -332,9 +484,25 @@ func (state *State) CommitStateDelta() error {
 // a snapshot.
 func (state *State) DeleteState() error {
 	state.ClearInMemoryChanges(false)
-	err := db.GetDBHandle().DeleteState()
+	state.invalidateViews()
+	if state.readCache != nil {
+		state.readCache.clear()
+	}
+	err := state.openchainDB.DeleteState()
 	if err != nil {
 		logger.Errorf("Error deleting state: %s", err)
+		return err
+	}
+	err = state.deleteIndexes()
+	if err != nil {
+		logger.Errorf("Error deleting the indexes of the state: %s", err)
+		return err
+	}
+	if externalState, ok := state.stateImpl.(statemgmt.ExternalState); ok {
+		err = externalState.DeleteExternalState()
+		if err != nil {
+			logger.Errorf("Error deleting the copy of the state: %s", err)
+		}
 	}
 	return err
 }
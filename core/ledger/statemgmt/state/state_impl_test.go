@@ -0,0 +1,115 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package state
+
+import (
+	"fmt"
+	"sort"
+	"testing"
+
+	"github.com/hyperledger/fabric/core/ledger/statemgmt/buckettree"
+	"github.com/hyperledger/fabric/core/ledger/statemgmt/trie"
+	"github.com/hyperledger/fabric/core/ledger/testutil"
+)
+
+// stateImplQueryResults holds the committed values and range scans of a state, which do not depend
+// on the state data structure, and the crypto-hash of the state, which does
+type stateImplQueryResults struct {
+	values     map[string][]byte
+	rangeScans map[string][]string
+	stateHash  []byte
+}
+
+func TestStateImplsConsistency(t *testing.T) {
+	initConfig()
+	defer func(name string, configs map[string]interface{}) {
+		stateImplName, stateImplConfigs = name, configs
+	}(stateImplName, stateImplConfigs)
+
+	stateImplName, stateImplConfigs = "buckettree", map[string]interface{}{buckettree.ConfigNumBuckets: 19, buckettree.ConfigMaxGroupingAtEachLevel: 3}
+	bucketTreeResults := commitAndQueryStateForTest(t)
+	stateImplName, stateImplConfigs = "trie", nil
+	trieResults := commitAndQueryStateForTest(t)
+	stateImplName, stateImplConfigs = "trie", map[string]interface{}{trie.ConfigHashFunction: "sha256"}
+	sha256TrieResults := commitAndQueryStateForTest(t)
+
+	testutil.AssertEquals(t, trieResults.values, bucketTreeResults.values)
+	testutil.AssertEquals(t, trieResults.rangeScans, bucketTreeResults.rangeScans)
+	testutil.AssertEquals(t, sha256TrieResults.values, bucketTreeResults.values)
+	testutil.AssertEquals(t, sha256TrieResults.rangeScans, bucketTreeResults.rangeScans)
+	testutil.AssertNotEquals(t, trieResults.stateHash, bucketTreeResults.stateHash)
+	testutil.AssertNotEquals(t, sha256TrieResults.stateHash, trieResults.stateHash)
+}
+
+// commitAndQueryStateForTest commits the same blocks to a fresh state of the configured data structure,
+// checks a proof for every key against the state hash and returns the results of querying the state
+func commitAndQueryStateForTest(t *testing.T) *stateImplQueryResults {
+	stateTestWrapper, state := createFreshDBAndConstructState(t)
+	chaincodeIDs := []string{"chaincode1", "chaincode2", "chaincode3"}
+	for blockNumber := uint64(0); blockNumber < 4; blockNumber++ {
+		state.TxBegin("txUuid")
+		for i := 0; i < 30; i++ {
+			chaincodeID, key := chaincodeIDs[i%len(chaincodeIDs)], fmt.Sprintf("key%02d", i)
+			switch {
+			case blockNumber > 0 && i%4 == int(blockNumber):
+				state.Delete(chaincodeID, key)
+			case i%2 == int(blockNumber%2):
+				state.Set(chaincodeID, key, []byte(fmt.Sprintf("value%d_%d", i, blockNumber)))
+			}
+		}
+		state.TxFinish("txUuid", true)
+		stateTestWrapper.persistAndClearInMemoryChanges(blockNumber)
+	}
+
+	stateHash, err := state.GetHash()
+	testutil.AssertNoError(t, err, "Error while computing the state hash")
+	results := &stateImplQueryResults{make(map[string][]byte), make(map[string][]string), stateHash}
+	for i := 0; i < 30; i++ {
+		chaincodeID, key := chaincodeIDs[i%len(chaincodeIDs)], fmt.Sprintf("key%02d", i)
+		value := stateTestWrapper.get(chaincodeID, key, true)
+		if value != nil {
+			results.values[chaincodeID+"/"+key] = value
+		}
+
+		provenValue, proof, err := state.GetProof(chaincodeID, key)
+		testutil.AssertNoError(t, err, "Error while getting a proof")
+		testutil.AssertEquals(t, provenValue, value)
+		if stateImplName == "trie" {
+			err = trie.VerifyStateProof(stateHash, chaincodeID, key, value, proof)
+		} else {
+			err = buckettree.VerifyStateProof(stateHash, chaincodeID, key, value, proof)
+		}
+		testutil.AssertNoError(t, err, fmt.Sprintf("Error while verifying the proof of key [%s] of chaincode [%s]", key, chaincodeID))
+	}
+
+	for _, chaincodeID := range chaincodeIDs {
+		for _, keyRange := range [][]string{{"", ""}, {"key05", "key20"}, {"key10", ""}, {"key99", ""}} {
+			itr, err := state.GetRangeScanIterator(chaincodeID, keyRange[0], keyRange[1], true)
+			testutil.AssertNoError(t, err, "Error while getting a range scan iterator")
+			rangeScan := []string{}
+			for itr.Next() {
+				key, value := itr.GetKeyValue()
+				rangeScan = append(rangeScan, fmt.Sprintf("%s=%s", key, value))
+			}
+			itr.Close()
+			// the bucket tree scans the keys by bucket
+			sort.Strings(rangeScan)
+			results.rangeScans[fmt.Sprintf("%s[%s,%s]", chaincodeID, keyRange[0], keyRange[1])] = rangeScan
+		}
+	}
+	return results
+}
@@ -17,9 +17,12 @@ limitations under the License.
 package state
 
 import (
+	"fmt"
 	"testing"
 
+	"github.com/hyperledger/fabric/core/db"
 	"github.com/hyperledger/fabric/core/ledger/testutil"
+	"github.com/hyperledger/fabric/core/util"
 )
 
 func TestStateChanges(t *testing.T) {
@@ -169,3 +172,54 @@ func TestStateDeltaSizeSetting(t *testing.T) {
 		t.Fatalf("Error reading historyStateDeltaSize. Expected 500, but got %d", state.historyStateDeltaSize)
 	}
 }
+
+func TestStateDeltaCompression(t *testing.T) {
+	stateTestWrapper, state := createFreshDBAndConstructState(t)
+	defer func(compression bool) { deltaCompression = compression }(deltaCompression)
+
+	// block 0 is kept uncompressed and block 1 compressed
+	for blockNumber := uint64(0); blockNumber < 2; blockNumber++ {
+		deltaCompression = blockNumber == 1
+		state.TxBegin("txUuid")
+		state.Set("chaincode1", "key1", []byte(fmt.Sprintf(`{"block":%d}`, blockNumber)))
+		state.TxFinish("txUuid", true)
+		stateTestWrapper.persistAndClearInMemoryChanges(blockNumber)
+	}
+
+	deltaBytes, err := db.GetDBHandle().GetFromStateDeltaCF(encodeStateDeltaKey(1))
+	testutil.AssertNoError(t, err, "Error reading the state delta of block 1")
+	testutil.AssertEquals(t, util.IsGzipCompressed(deltaBytes), true)
+
+	deltaCompression = false
+	for blockNumber := uint64(0); blockNumber < 2; blockNumber++ {
+		delta, err := state.FetchStateDeltaFromDB(blockNumber)
+		testutil.AssertNoError(t, err, "Error fetching the state delta")
+		testutil.AssertEquals(t, delta.Get("chaincode1", "key1").GetValue(), []byte(fmt.Sprintf(`{"block":%d}`, blockNumber)))
+	}
+}
+
+func TestStateAddOrphanedStateDeltasForDeletion(t *testing.T) {
+	stateTestWrapper, state := createFreshDBAndConstructState(t)
+	for blockNumber := uint64(0); blockNumber < 6; blockNumber++ {
+		state.TxBegin("txUuid")
+		state.Set("chaincode1", "key1", []byte(fmt.Sprintf("value%d", blockNumber)))
+		state.TxFinish("txUuid", true)
+		stateTestWrapper.persistAndClearInMemoryChanges(blockNumber)
+	}
+
+	// the deltas of blocks 0 and 1 are older than the last 3 kept, that of block 5 above the head
+	state.historyStateDeltaSize = 3
+	writeBatch := db.GetDBHandle().NewWriteBatch()
+	defer writeBatch.Destroy()
+	deleted := []uint64{}
+	state.AddOrphanedStateDeltasForDeletion(5, writeBatch, func(key []byte, value []byte) {
+		deleted = append(deleted, decodeStateDeltaKey(key))
+	})
+	testDBWrapper.WriteToDB(t, writeBatch)
+	testutil.AssertEquals(t, deleted, []uint64{0, 1, 5})
+	for blockNumber := uint64(0); blockNumber < 6; blockNumber++ {
+		delta, err := state.FetchStateDeltaFromDB(blockNumber)
+		testutil.AssertNoError(t, err, "Error fetching the state delta")
+		testutil.AssertEquals(t, delta != nil, blockNumber >= 2 && blockNumber < 5)
+	}
+}
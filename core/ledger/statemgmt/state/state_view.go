@@ -0,0 +1,174 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package state
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/hyperledger/fabric/core/ledger/statemgmt"
+)
+
+// A state view is a read-only view of the committed state as it was when the
+// view was opened, which stays consistent while blocks are committed.  Rather
+// than the whole state, a view holds the values as of its opening of the keys
+// changed since: they are copied to the open views from the state delta being
+// persisted, before it is written.  A point read looks the key up in the copy
+// and otherwise reads the state implementation.  A range scan reads the state
+// implementation through a DB iterator, which sees the DB as it was when the
+// iterator was created, overlaid with the copy as it was then.
+//
+// The values are copied to a view until it is released, so views are meant to
+// be short lived, for the duration of a query.  The views of the state are
+// invalidated if the state is deleted.
+
+// StateView is a consistent read-only view of the committed state
+type StateView struct {
+	state    *State
+	lock     sync.RWMutex
+	previous *statemgmt.StateDelta // values of the keys changed since the view was opened, deleted if absent
+	err      error                 // set once the view can no longer be read
+}
+
+// errViewInvalidated is returned by the views open when the state is deleted
+var errViewInvalidated = fmt.Errorf("The state was deleted while the view was open")
+
+// OpenView opens a view of the committed state. StateView.Release() must be
+// called once you are done
+func (state *State) OpenView() *StateView {
+	state.viewsLock.Lock()
+	defer state.viewsLock.Unlock()
+	view := &StateView{state: state, previous: statemgmt.NewStateDelta()}
+	if state.persistingDelta != nil {
+		// the changes being persisted may be written already
+		view.copyPrevious(state.persistingDelta)
+	}
+	state.views[view] = struct{}{}
+	return view
+}
+
+// Get returns the value of chaincodeID and key as of the opening of the view
+func (view *StateView) Get(chaincodeID string, key string) ([]byte, error) {
+	view.lock.RLock()
+	defer view.lock.RUnlock()
+	if view.err != nil {
+		return nil, view.err
+	}
+	if previous := view.previous.Get(chaincodeID, key); previous != nil {
+		return previous.GetValue(), nil
+	}
+	return view.state.stateImpl.Get(chaincodeID, key)
+}
+
+// GetMultipleKeys returns the values of the keys as of the opening of the view
+func (view *StateView) GetMultipleKeys(chaincodeID string, keys []string) ([][]byte, error) {
+	var values [][]byte
+	for _, k := range keys {
+		v, err := view.Get(chaincodeID, k)
+		if err != nil {
+			return nil, err
+		}
+		values = append(values, v)
+	}
+	return values, nil
+}
+
+// GetRangeScanIterator returns an iterator to get all the keys (and values) between startKey and endKey
+// (assuming lexical order of the keys) for a chaincodeID, as of the opening of the view
+func (view *StateView) GetRangeScanIterator(chaincodeID string, startKey string, endKey string) (statemgmt.RangeScanIterator, error) {
+	view.lock.RLock()
+	defer view.lock.RUnlock()
+	if view.err != nil {
+		return nil, view.err
+	}
+	// the copy is taken along with the DB iterator, the values copied later
+	// being those of changes the DB iterator does not see
+	previous := statemgmt.NewStateDelta()
+	for key, updatedValue := range view.previous.GetUpdates(chaincodeID) {
+		if updatedValue.IsDelete() {
+			previous.Delete(chaincodeID, key, nil)
+		} else {
+			previous.Set(chaincodeID, key, updatedValue.GetValue(), nil)
+		}
+	}
+	stateImplItr, err := view.state.stateImpl.GetRangeScanIterator(chaincodeID, startKey, endKey)
+	if err != nil {
+		return nil, err
+	}
+	return newCompositeRangeScanIterator(
+		statemgmt.NewStateDeltaRangeScanIterator(statemgmt.NewStateDelta(), chaincodeID, startKey, endKey),
+		statemgmt.NewStateDeltaRangeScanIterator(previous, chaincodeID, startKey, endKey),
+		stateImplItr), nil
+}
+
+// Release the view. This MUST be called when you are done with it
+func (view *StateView) Release() {
+	view.state.viewsLock.Lock()
+	defer view.state.viewsLock.Unlock()
+	delete(view.state.views, view)
+}
+
+// copyPrevious copies the previous values of the keys changed by delta which
+// were not changed since the view was opened
+func (view *StateView) copyPrevious(delta *statemgmt.StateDelta) {
+	view.lock.Lock()
+	defer view.lock.Unlock()
+	for _, chaincodeID := range delta.GetUpdatedChaincodeIds(false) {
+		for key, updatedValue := range delta.GetUpdates(chaincodeID) {
+			if view.previous.IsUpdatedValueSet(chaincodeID, key) {
+				continue
+			}
+			if previousValue := updatedValue.GetPreviousValue(); previousValue != nil {
+				view.previous.Set(chaincodeID, key, previousValue, nil)
+			} else {
+				view.previous.Delete(chaincodeID, key, nil)
+			}
+		}
+	}
+}
+
+// copyToViews copies the previous values of the keys changed by delta, which
+// is about to be persisted, to the open views. The views opened until the
+// changes are cleared from memory get them too
+func (state *State) copyToViews(delta *statemgmt.StateDelta) {
+	state.viewsLock.Lock()
+	defer state.viewsLock.Unlock()
+	state.persistingDelta = delta
+	for view := range state.views {
+		view.copyPrevious(delta)
+	}
+}
+
+// persistedToViews marks the end of the persistence of the changes copied to the views
+func (state *State) persistedToViews() {
+	state.viewsLock.Lock()
+	defer state.viewsLock.Unlock()
+	state.persistingDelta = nil
+}
+
+// invalidateViews invalidates the open views, once the state was deleted
+func (state *State) invalidateViews() {
+	state.viewsLock.Lock()
+	defer state.viewsLock.Unlock()
+	for view := range state.views {
+		view.lock.Lock()
+		view.err = errViewInvalidated
+		view.lock.Unlock()
+	}
+	state.views = make(map[*StateView]struct{})
+	state.persistingDelta = nil
+}
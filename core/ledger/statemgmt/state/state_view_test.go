@@ -0,0 +1,115 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package state
+
+import (
+	"testing"
+
+	"github.com/hyperledger/fabric/core/db"
+	"github.com/hyperledger/fabric/core/ledger/testutil"
+)
+
+func TestStateView(t *testing.T) {
+	stateTestWrapper, state := createFreshDBAndConstructState(t)
+	state.TxBegin("txUuid")
+	state.Set("chaincode1", "key1", []byte("value1"))
+	state.Set("chaincode1", "key2", []byte("value2"))
+	state.TxFinish("txUuid", true)
+	stateTestWrapper.persistAndClearInMemoryChanges(0)
+
+	view := state.OpenView()
+	defer view.Release()
+	state.TxBegin("txUuid")
+	state.Set("chaincode1", "key1", []byte("value1_new"))
+	state.Delete("chaincode1", "key2")
+	state.Set("chaincode1", "key3", []byte("value3"))
+	state.TxFinish("txUuid", true)
+	stateTestWrapper.persistAndClearInMemoryChanges(1)
+	testutil.AssertEquals(t, stateTestWrapper.get("chaincode1", "key1", true), []byte("value1_new"))
+
+	// the view reads the state as of its opening
+	getFromView := func(view *StateView, key string) []byte {
+		value, err := view.Get("chaincode1", key)
+		testutil.AssertNoError(t, err, "Error while reading the view")
+		return value
+	}
+	testutil.AssertEquals(t, getFromView(view, "key1"), []byte("value1"))
+	testutil.AssertEquals(t, getFromView(view, "key2"), []byte("value2"))
+	testutil.AssertNil(t, getFromView(view, "key3"))
+
+	itr, err := view.GetRangeScanIterator("chaincode1", "", "")
+	testutil.AssertNoError(t, err, "Error while scanning the view")
+	scanned := make(map[string][]byte)
+	for itr.Next() {
+		key, value := itr.GetKeyValue()
+		scanned[key] = value
+	}
+	itr.Close()
+	testutil.AssertEquals(t, scanned, map[string][]byte{"key1": []byte("value1"), "key2": []byte("value2")})
+}
+
+func TestStateViewOpenedDuringCommit(t *testing.T) {
+	_, state := createFreshDBAndConstructState(t)
+	state.TxBegin("txUuid")
+	state.Set("chaincode1", "key1", []byte("value1"))
+	state.TxFinish("txUuid", true)
+
+	// a view opened once the changes are added to the write batch does not
+	// see them, whether they are written yet or not
+	writeBatch := db.GetDBHandle().NewWriteBatch()
+	defer writeBatch.Destroy()
+	state.AddChangesForPersistence(0, writeBatch)
+	viewBeforeWrite := state.OpenView()
+	defer viewBeforeWrite.Release()
+	testDBWrapper.WriteToDB(t, writeBatch)
+	viewAfterWrite := state.OpenView()
+	defer viewAfterWrite.Release()
+	state.ClearInMemoryChanges(true)
+	viewAfterCommit := state.OpenView()
+	defer viewAfterCommit.Release()
+
+	for _, view := range []*StateView{viewBeforeWrite, viewAfterWrite} {
+		value, err := view.Get("chaincode1", "key1")
+		testutil.AssertNoError(t, err, "Error while reading the view")
+		testutil.AssertNil(t, value)
+	}
+	value, err := viewAfterCommit.Get("chaincode1", "key1")
+	testutil.AssertNoError(t, err, "Error while reading the view")
+	testutil.AssertEquals(t, value, []byte("value1"))
+}
+
+func TestStateViewRelease(t *testing.T) {
+	stateTestWrapper, state := createFreshDBAndConstructState(t)
+	view := state.OpenView()
+	released := state.OpenView()
+	released.Release()
+	testutil.AssertEquals(t, len(state.views), 1)
+
+	state.TxBegin("txUuid")
+	state.Set("chaincode1", "key1", []byte("value1"))
+	state.TxFinish("txUuid", true)
+	stateTestWrapper.persistAndClearInMemoryChanges(0)
+	testutil.AssertNil(t, released.previous.Get("chaincode1", "key1"))
+	testutil.AssertNotNil(t, view.previous.Get("chaincode1", "key1"))
+
+	// the views are invalidated once the state is deleted
+	testutil.AssertNoError(t, state.DeleteState(), "Error while deleting the state")
+	_, err := view.Get("chaincode1", "key1")
+	testutil.AssertEquals(t, err, errViewInvalidated)
+	testutil.AssertEquals(t, len(state.views), 0)
+	view.Release()
+}
@@ -105,6 +105,21 @@ func (stateDelta *StateDelta) ApplyChanges(anotherStateDelta *StateDelta) {
 	}
 }
 
+// MergeStateDeltas merges the deltas of consecutive blocks, given in the order of the blocks,
+// into a single delta with the value of each key after the last block and its previous
+// value before the first one. The deltas must all roll the state in the same direction
+func MergeStateDeltas(deltas ...*StateDelta) (*StateDelta, error) {
+	merged := NewStateDelta()
+	for i, delta := range deltas {
+		if i > 0 && delta.RollBackwards != merged.RollBackwards {
+			return nil, fmt.Errorf("Can not merge state deltas rolling the state in different directions")
+		}
+		merged.RollBackwards = delta.RollBackwards
+		merged.ApplyChanges(delta)
+	}
+	return merged, nil
+}
+
 // IsEmpty checks whether StateDelta contains any data
 func (stateDelta *StateDelta) IsEmpty() bool {
 	return len(stateDelta.ChaincodeStateDeltas) == 0
@@ -76,3 +76,31 @@ func TestStateDeltaEmptyArrayValue(t *testing.T) {
 	v = stateDelta1.Get("chaincode4", "")
 	testutil.AssertEquals(t, v.GetValue(), []byte("value4"))
 }
+
+func TestMergeStateDeltas(t *testing.T) {
+	stateDelta1 := NewStateDelta()
+	stateDelta1.Set("chaincode1", "key1", []byte("value1_1"), []byte("value1_0"))
+	stateDelta1.Set("chaincode1", "key2", []byte("value2_1"), nil)
+	stateDelta2 := NewStateDelta()
+	stateDelta2.Set("chaincode1", "key1", []byte("value1_2"), []byte("value1_1"))
+	stateDelta2.Delete("chaincode1", "key2", []byte("value2_1"))
+	stateDelta2.Set("chaincode2", "key3", []byte("value3_2"), nil)
+
+	merged, err := MergeStateDeltas(stateDelta1, stateDelta2)
+	testutil.AssertNoError(t, err, "Error while merging state deltas")
+	testutil.AssertEquals(t, merged.Get("chaincode1", "key1").GetValue(), []byte("value1_2"))
+	testutil.AssertEquals(t, merged.Get("chaincode1", "key1").GetPreviousValue(), []byte("value1_0"))
+	testutil.AssertEquals(t, merged.Get("chaincode1", "key2").IsDelete(), true)
+	testutil.AssertNil(t, merged.Get("chaincode1", "key2").GetPreviousValue())
+	testutil.AssertEquals(t, merged.Get("chaincode2", "key3").GetValue(), []byte("value3_2"))
+	testutil.AssertEquals(t, merged.RollBackwards, false)
+
+	stateDelta1.RollBackwards = true
+	_, err = MergeStateDeltas(stateDelta1, stateDelta2)
+	testutil.AssertError(t, err, "Expected an error merging state deltas rolling in different directions")
+	stateDelta2.RollBackwards = true
+	merged, err = MergeStateDeltas(stateDelta1, stateDelta2)
+	testutil.AssertNoError(t, err, "Error while merging state deltas")
+	testutil.AssertEquals(t, merged.RollBackwards, true)
+	testutil.AssertEquals(t, merged.Get("chaincode1", "key1").GetPreviousValue(), []byte("value1_0"))
+}
@@ -0,0 +1,65 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package trie
+
+import (
+	"crypto/sha256"
+	"fmt"
+
+	"github.com/hyperledger/fabric/core/util"
+)
+
+// ConfigHashFunction - config name 'hashFunction' as it appears in yaml file. The value is the name of one of
+// the hash functions in 'hashFunctions', or a function of type HashFunc when the trie is configured in code
+const ConfigHashFunction = "hashFunction"
+
+// DefaultHashFunction - the hash function used when none is configured
+const DefaultHashFunction = "sha3"
+
+// HashFunc computes the crypto-hash of the nodes of the trie
+type HashFunc func(data []byte) []byte
+
+var hashFunctions = map[string]HashFunc{
+	"sha3":   util.ComputeCryptoHash,
+	"sha256": sha256Hash,
+}
+
+var computeCryptoHash HashFunc = util.ComputeCryptoHash
+
+func initConfig(configs map[string]interface{}) error {
+	stateTrieLogger.Infof("configs passed during initialization = %#v", configs)
+	switch hashFunction := configs[ConfigHashFunction].(type) {
+	case nil:
+		computeCryptoHash = hashFunctions[DefaultHashFunction]
+	case HashFunc:
+		computeCryptoHash = hashFunction
+	case string:
+		hashFunc, ok := hashFunctions[hashFunction]
+		if !ok {
+			return fmt.Errorf("Hash function '%s' is not valid for the state trie", hashFunction)
+		}
+		computeCryptoHash = hashFunc
+	default:
+		return fmt.Errorf("Hash function %#v is not valid for the state trie", hashFunction)
+	}
+	return nil
+}
+
+func sha256Hash(data []byte) []byte {
+	hash := sha256.Sum256(data)
+	return hash[:]
+}
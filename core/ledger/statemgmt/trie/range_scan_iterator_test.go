@@ -121,3 +121,36 @@ func TestRangeScanIterator(t *testing.T) {
 	testutil.AssertEquals(t, results["key7"], []byte("value7"))
 	rangeScanItr.Close()
 }
+
+func TestRangeScanIteratorAfter(t *testing.T) {
+	testDBWrapper.CleanDB(t)
+	stateTrieTestWrapper := newStateTrieTestWrapper(t)
+	stateTrie := stateTrieTestWrapper.stateTrie
+	stateDelta := statemgmt.NewStateDelta()
+	for _, key := range []string{"a", "ab", "abc", "b", "ba", "c"} {
+		stateDelta.Set("chaincodeID1", key, []byte("value"+key), nil)
+		stateDelta.Set("chaincodeID2", key, []byte("value"+key), nil)
+	}
+	stateTrie.PrepareWorkingSet(stateDelta)
+	stateTrieTestWrapper.PersistChangesAndResetInMemoryChanges()
+
+	scan := func(rangeScanItr statemgmt.RangeScanIterator) []string {
+		defer rangeScanItr.Close()
+		keys := []string{}
+		for rangeScanItr.Next() {
+			key, _ := rangeScanItr.GetKeyValue()
+			keys = append(keys, key)
+		}
+		return keys
+	}
+	rangeScanItr, _ := stateTrie.GetRangeScanIterator("chaincodeID1", "", "ba")
+	keys := scan(rangeScanItr)
+	testutil.AssertEquals(t, keys, []string{"a", "ab", "abc", "b", "ba"})
+
+	// Resuming after each key gives the keys which followed it
+	for i, lastKey := range keys {
+		rangeScanItr, err := stateTrie.GetRangeScanIteratorAfter("chaincodeID1", "", "ba", lastKey)
+		testutil.AssertNoError(t, err, "Error while getting iterator")
+		testutil.AssertEquals(t, scan(rangeScanItr), keys[i+1:])
+	}
+}
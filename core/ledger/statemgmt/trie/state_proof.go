@@ -0,0 +1,185 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package trie
+
+import (
+	"bytes"
+	"fmt"
+
+	"github.com/golang/protobuf/proto"
+)
+
+// A proof for a key consists of the trie nodes on the path from the root to the node of the key,
+// or to the deepest node of that path if the key is not in the trie, each serialized as it is
+// persisted. Unlike a proof of the bucket tree, its size does not depend on the number of keys
+// sharing a bucket with the key, only on the length of the key
+
+// GetStateProof - method implementation for interface 'statemgmt.StateProver'
+func (stateTrie *StateTrie) GetStateProof(chaincodeID string, key string) ([]byte, []byte, error) {
+	path := getTrieKeyPath(newTrieKey(chaincodeID, key))
+	var value []byte
+	var serializedNodes [][]byte
+	for i, trieKey := range path {
+		trieNode, err := fetchTrieNodeFromDB(stateTrie.openchainDB, trieKey)
+		if err != nil {
+			return nil, nil, err
+		}
+		if trieNode == nil {
+			break
+		}
+		if i == len(path)-1 {
+			value = trieNode.value
+		}
+		serializedNode, err := trieNode.marshal()
+		if err != nil {
+			return nil, nil, err
+		}
+		serializedNodes = append(serializedNodes, serializedNode)
+	}
+
+	buffer := proto.NewBuffer([]byte{})
+	buffer.EncodeVarint(uint64(len(serializedNodes)))
+	for _, serializedNode := range serializedNodes {
+		buffer.EncodeRawBytes(serializedNode)
+	}
+	stateTrieLogger.Debugf("Proof for chaincodeID=[%s], key=[%s] spans [%d] of the [%d] trie nodes on its path", chaincodeID, key, len(serializedNodes), len(path))
+	return value, buffer.Bytes(), nil
+}
+
+// VerifyStateProof checks that a state whose crypto-hash is stateHash has the value for the key of a
+// chaincodeID, a nil value meaning the key is not in the state. The proof is the one returned by
+// GetStateProof, for a trie using the hash function the state trie is configured with
+func VerifyStateProof(stateHash []byte, chaincodeID string, key string, value []byte, proofBytes []byte) error {
+	path := getTrieKeyPath(newTrieKey(chaincodeID, key))
+	buffer := proto.NewBuffer(proofBytes)
+	numNodes, err := buffer.DecodeVarint()
+	if err != nil {
+		return fmt.Errorf("Invalid proof: %s", err)
+	}
+	if numNodes > uint64(len(path)) {
+		return fmt.Errorf("Invalid proof: [%d] trie nodes for a path of [%d]", numNodes, len(path))
+	}
+	proofSize := varintSize(numNodes)
+	trieNodes := make([]*trieNode, numNodes)
+	for i := range trieNodes {
+		serializedNode, err := buffer.DecodeRawBytes(true)
+		if err != nil {
+			return fmt.Errorf("Invalid proof: %s", err)
+		}
+		proofSize += varintSize(uint64(len(serializedNode))) + len(serializedNode)
+		if trieNodes[i], err = unmarshalProofTrieNode(path[i], serializedNode); err != nil {
+			return err
+		}
+	}
+	if proofSize != len(proofBytes) {
+		return fmt.Errorf("Invalid proof: [%d] bytes after the trie nodes", len(proofBytes)-proofSize)
+	}
+
+	var provenValue []byte
+	if len(trieNodes) == len(path) {
+		provenValue = trieNodes[len(trieNodes)-1].value
+	} else if len(trieNodes) > 0 {
+		if _, ok := trieNodes[len(trieNodes)-1].childrenCryptoHashes[path[len(trieNodes)].getIndexInParent()]; ok {
+			return fmt.Errorf("Invalid proof: the path stops at trie node [%s] which has the next node as child", path[len(trieNodes)-1])
+		}
+	}
+	if !bytes.Equal(provenValue, value) || (provenValue == nil) != (value == nil) {
+		return fmt.Errorf("Invalid proof: the proven value [%x] is not the value [%x]", provenValue, value)
+	}
+
+	var cryptoHash []byte
+	for i := len(trieNodes) - 1; i >= 0; i-- {
+		if i < len(trieNodes)-1 && !bytes.Equal(trieNodes[i].childrenCryptoHashes[path[i+1].getIndexInParent()], cryptoHash) {
+			return fmt.Errorf("Invalid proof: the crypto-hash of trie node [%s] is not the proven one", path[i+1])
+		}
+		if cryptoHash = trieNodes[i].computeCryptoHash(); cryptoHash == nil {
+			return fmt.Errorf("Invalid proof: trie node [%s] is empty", path[i])
+		}
+	}
+	if !bytes.Equal(cryptoHash, stateHash) {
+		return fmt.Errorf("Invalid proof: the proven state hash [%x] is not the state hash [%x]", cryptoHash, stateHash)
+	}
+	return nil
+}
+
+// getTrieKeyPath returns the trie keys from the root to key
+func getTrieKeyPath(key *trieKey) []*trieKey {
+	path := []*trieKey{key}
+	for !key.isRootKey() {
+		key = key.getParentTrieKey()
+		path = append([]*trieKey{key}, path...)
+	}
+	return path
+}
+
+// unmarshalProofTrieNode is unmarshalTrieNode for the untrusted bytes of a proof, which are
+// checked rather than assumed to have been marshalled by a trie node
+func unmarshalProofTrieNode(key *trieKey, serializedContent []byte) (*trieNode, error) {
+	trieNode := newTrieNode(key, nil, false)
+	buffer := proto.NewBuffer(serializedContent)
+	valueMarker, err := buffer.DecodeVarint()
+	if err != nil {
+		return nil, fmt.Errorf("Invalid proof: %s", err)
+	}
+	size := varintSize(valueMarker)
+	switch valueMarker {
+	case 0:
+	case 1:
+		if trieNode.value, err = buffer.DecodeRawBytes(true); err != nil {
+			return nil, fmt.Errorf("Invalid proof: %s", err)
+		}
+		size += varintSize(uint64(len(trieNode.value))) + len(trieNode.value)
+	default:
+		return nil, fmt.Errorf("Invalid proof: invalid value marker [%d] for trie node [%s]", valueMarker, key)
+	}
+
+	numCryptoHashes, err := buffer.DecodeVarint()
+	if err != nil {
+		return nil, fmt.Errorf("Invalid proof: %s", err)
+	}
+	size += varintSize(numCryptoHashes)
+	maxTrieWidth := uint64(trieKeyEncoderImpl.getMaxTrieWidth())
+	if numCryptoHashes > maxTrieWidth {
+		return nil, fmt.Errorf("Invalid proof: [%d] children for trie node [%s]", numCryptoHashes, key)
+	}
+	for i := uint64(0); i < numCryptoHashes; i++ {
+		index, err := buffer.DecodeVarint()
+		if err != nil {
+			return nil, fmt.Errorf("Invalid proof: %s", err)
+		}
+		if _, ok := trieNode.childrenCryptoHashes[int(index)]; ok || index >= maxTrieWidth {
+			return nil, fmt.Errorf("Invalid proof: invalid child [%d] for trie node [%s]", index, key)
+		}
+		cryptoHash, err := buffer.DecodeRawBytes(true)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid proof: %s", err)
+		}
+		if len(cryptoHash) == 0 {
+			return nil, fmt.Errorf("Invalid proof: empty crypto-hash for child [%d] of trie node [%s]", index, key)
+		}
+		size += varintSize(index) + varintSize(uint64(len(cryptoHash))) + len(cryptoHash)
+		trieNode.childrenCryptoHashes[int(index)] = cryptoHash
+	}
+	if size != len(serializedContent) {
+		return nil, fmt.Errorf("Invalid proof: [%d] bytes after trie node [%s]", len(serializedContent)-size, key)
+	}
+	return trieNode, nil
+}
+
+func varintSize(x uint64) int {
+	return len(proto.EncodeVarint(x))
+}
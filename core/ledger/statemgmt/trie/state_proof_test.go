@@ -0,0 +1,127 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package trie
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+
+	"github.com/hyperledger/fabric/core/db"
+	"github.com/hyperledger/fabric/core/ledger/statemgmt"
+	"github.com/hyperledger/fabric/core/ledger/testutil"
+)
+
+func TestStateTrie_Proof(t *testing.T) {
+	testDBWrapper.CleanDB(t)
+	stateTrieTestWrapper := newStateTrieTestWrapper(t)
+	stateDelta := statemgmt.NewStateDelta()
+	for i := 0; i < 20; i++ {
+		stateDelta.Set(fmt.Sprintf("chaincodeID%d", i%3), fmt.Sprintf("key%d", i), []byte(fmt.Sprintf("value%d", i)), nil)
+	}
+	// a key which is a prefix of others
+	stateDelta.Set("chaincodeID1", "key", []byte("value"), nil)
+	stateHash := stateTrieTestWrapper.PrepareWorkingSetAndComputeCryptoHash(stateDelta)
+	stateTrieTestWrapper.PersistChangesAndResetInMemoryChanges()
+
+	for i := 0; i < 20; i++ {
+		chaincodeID, key := fmt.Sprintf("chaincodeID%d", i%3), fmt.Sprintf("key%d", i)
+		value, proof, err := stateTrieTestWrapper.stateTrie.GetStateProof(chaincodeID, key)
+		testutil.AssertNoError(t, err, "Error while getting proof")
+		testutil.AssertEquals(t, value, []byte(fmt.Sprintf("value%d", i)))
+		testutil.AssertNoError(t, VerifyStateProof(stateHash, chaincodeID, key, value, proof), "Error while verifying proof")
+		testutil.AssertError(t, VerifyStateProof(stateHash, chaincodeID, key, []byte("wrongValue"), proof), "Expected an error for a wrong value")
+		testutil.AssertError(t, VerifyStateProof(stateHash, chaincodeID, key, nil, proof), "Expected an error for a wrong absence")
+		testutil.AssertError(t, VerifyStateProof([]byte("wrongHash"), chaincodeID, key, value, proof), "Expected an error for a wrong state hash")
+	}
+	value, proof, err := stateTrieTestWrapper.stateTrie.GetStateProof("chaincodeID1", "key")
+	testutil.AssertNoError(t, err, "Error while getting proof")
+	testutil.AssertNoError(t, VerifyStateProof(stateHash, "chaincodeID1", "key", value, proof), "Error while verifying proof")
+
+	// absence of a key, whose path ends in the trie or at a trie node
+	for _, key := range []string{"missingKey", "key2", "ke"} {
+		value, proof, err := stateTrieTestWrapper.stateTrie.GetStateProof("chaincodeID0", key)
+		testutil.AssertNoError(t, err, "Error while getting proof")
+		testutil.AssertNil(t, value)
+		testutil.AssertNoError(t, VerifyStateProof(stateHash, "chaincodeID0", key, nil, proof), "Error while verifying proof")
+		testutil.AssertError(t, VerifyStateProof(stateHash, "chaincodeID0", key, []byte("value"), proof), "Expected an error for a wrong presence")
+	}
+
+	// a proof is only valid for the key it was returned for
+	_, proof, err = stateTrieTestWrapper.stateTrie.GetStateProof("chaincodeID0", "key0")
+	testutil.AssertNoError(t, err, "Error while getting proof")
+	testutil.AssertError(t, VerifyStateProof(stateHash, "chaincodeID1", "key1", []byte("value1"), proof), "Expected an error for a proof of another key")
+	testutil.AssertError(t, VerifyStateProof(stateHash, "chaincodeID0", "key3", nil, proof), "Expected an error for a proof of another key")
+}
+
+func TestStateTrie_Proof_Tampered(t *testing.T) {
+	testDBWrapper.CleanDB(t)
+	stateTrieTestWrapper := newStateTrieTestWrapper(t)
+	stateDelta := statemgmt.NewStateDelta()
+	stateDelta.Set("chaincodeID1", "key1", []byte("value1"), nil)
+	stateDelta.Set("chaincodeID1", "key2", []byte("value2"), nil)
+	stateDelta.Set("chaincodeID2", "key3", []byte("value3"), nil)
+	stateHash := stateTrieTestWrapper.PrepareWorkingSetAndComputeCryptoHash(stateDelta)
+	stateTrieTestWrapper.PersistChangesAndResetInMemoryChanges()
+
+	value, proof, err := stateTrieTestWrapper.stateTrie.GetStateProof("chaincodeID1", "key1")
+	testutil.AssertNoError(t, err, "Error while getting proof")
+	// tamper with the value and with the crypto-hashes of both children of the node where the keys branch
+	branchNode, err := fetchTrieNodeFromDB(db.GetDBHandle(), newTrieKey("chaincodeID1", "key"))
+	testutil.AssertNoError(t, err, "Error while fetching trie node")
+	testutil.AssertEquals(t, branchNode.getNumChildren(), 2)
+	tamperedBytes := [][]byte{value}
+	for _, cryptoHash := range branchNode.childrenCryptoHashes {
+		tamperedBytes = append(tamperedBytes, cryptoHash)
+	}
+	for _, b := range tamperedBytes {
+		offset := bytes.Index(proof, b)
+		testutil.AssertNotEquals(t, offset, -1)
+		for i := offset; i < offset+len(b); i++ {
+			tamperedProof := append([]byte{}, proof...)
+			tamperedProof[i] ^= 0x01
+			testutil.AssertError(t, VerifyStateProof(stateHash, "chaincodeID1", "key1", value, tamperedProof), fmt.Sprintf("Expected an error for a proof tampered at byte [%d]", i))
+		}
+	}
+	testutil.AssertError(t, VerifyStateProof(stateHash, "chaincodeID1", "key1", value, append(proof, 0x00)), "Expected an error for trailing bytes")
+	testutil.AssertError(t, VerifyStateProof(stateHash, "chaincodeID1", "key1", value, proof[:len(proof)-1]), "Expected an error for a truncated proof")
+	testutil.AssertError(t, VerifyStateProof(stateHash, "chaincodeID1", "key1", value, nil), "Expected an error for an empty proof")
+	testutil.AssertError(t, VerifyStateProof(stateHash, "chaincodeID1", "key1", value, []byte{0x01, 0x03, 0x07, 0x00, 0x00}), "Expected an error for an invalid trie node")
+}
+
+func TestStateTrie_HashFunction(t *testing.T) {
+	defer initConfig(nil)
+	stateDelta := statemgmt.NewStateDelta()
+	stateDelta.Set("chaincodeID1", "key1", []byte("value1"), nil)
+	stateDelta.Set("chaincodeID2", "key2", []byte("value2"), nil)
+
+	testDBWrapper.CleanDB(t)
+	defaultHash := newStateTrieTestWrapper(t).PrepareWorkingSetAndComputeCryptoHash(stateDelta)
+
+	testutil.AssertNoError(t, initConfig(map[string]interface{}{ConfigHashFunction: "sha256"}), "Error while configuring the hash function")
+	sha256Hash := newStateTrieTestWrapper(t).PrepareWorkingSetAndComputeCryptoHash(stateDelta)
+	testutil.AssertEquals(t, len(sha256Hash), 32)
+	testutil.AssertNotEquals(t, sha256Hash, defaultHash)
+
+	testutil.AssertNoError(t, initConfig(map[string]interface{}{ConfigHashFunction: HashFunc(func(data []byte) []byte { return []byte("hash") })}), "Error while configuring the hash function")
+	testutil.AssertEquals(t, newStateTrieTestWrapper(t).PrepareWorkingSetAndComputeCryptoHash(stateDelta), []byte("hash"))
+
+	testutil.AssertError(t, initConfig(map[string]interface{}{ConfigHashFunction: "md5"}), "Expected an error for an unknown hash function")
+
+	testutil.AssertNoError(t, initConfig(nil), "Error while configuring the hash function")
+	testutil.AssertEquals(t, newStateTrieTestWrapper(t).PrepareWorkingSetAndComputeCryptoHash(stateDelta), defaultHash)
+}
@@ -19,13 +19,14 @@ package trie
 import (
 	"testing"
 
+	"github.com/hyperledger/fabric/core/db"
 	"github.com/hyperledger/fabric/core/ledger/statemgmt"
 	"github.com/hyperledger/fabric/core/ledger/testutil"
 )
 
 func TestStateTrie_ComputeHash_AllInMemory_NoContents(t *testing.T) {
 	testDBWrapper.CleanDB(t)
-	stateTrie := NewStateTrie()
+	stateTrie := NewStateTrie(db.GetDBHandle())
 	stateTrieTestWrapper := &stateTrieTestWrapper{stateTrie, t}
 	hash := stateTrieTestWrapper.PrepareWorkingSetAndComputeCryptoHash(statemgmt.NewStateDelta())
 	testutil.AssertEquals(t, hash, nil)
@@ -33,7 +34,7 @@ func TestStateTrie_ComputeHash_AllInMemory_NoContents(t *testing.T) {
 
 func TestStateTrie_ComputeHash_AllInMemory(t *testing.T) {
 	testDBWrapper.CleanDB(t)
-	stateTrie := NewStateTrie()
+	stateTrie := NewStateTrie(db.GetDBHandle())
 	stateTrieTestWrapper := &stateTrieTestWrapper{stateTrie, t}
 	stateDelta := statemgmt.NewStateDelta()
 
@@ -76,7 +77,7 @@ func TestStateTrie_ComputeHash_AllInMemory(t *testing.T) {
 
 func TestStateTrie_GetSet_WithDB(t *testing.T) {
 	testDBWrapper.CleanDB(t)
-	stateTrie := NewStateTrie()
+	stateTrie := NewStateTrie(db.GetDBHandle())
 	stateTrieTestWrapper := &stateTrieTestWrapper{stateTrie, t}
 	stateDelta := statemgmt.NewStateDelta()
 	stateDelta.Set("chaincodeID1", "key1", []byte("value1"), nil)
@@ -100,7 +101,7 @@ func TestStateTrie_GetSet_WithDB(t *testing.T) {
 
 func TestStateTrie_ComputeHash_WithDB_Spread_Keys(t *testing.T) {
 	testDBWrapper.CleanDB(t)
-	stateTrie := NewStateTrie()
+	stateTrie := NewStateTrie(db.GetDBHandle())
 	stateTrieTestWrapper := &stateTrieTestWrapper{stateTrie, t}
 
 	// Add a few keys and write to DB
@@ -180,7 +181,7 @@ func TestStateTrie_ComputeHash_WithDB_Spread_Keys(t *testing.T) {
 
 func TestStateTrie_ComputeHash_WithDB_Staggered_Keys(t *testing.T) {
 	testDBWrapper.CleanDB(t)
-	stateTrie := NewStateTrie()
+	stateTrie := NewStateTrie(db.GetDBHandle())
 	stateTrieTestWrapper := &stateTrieTestWrapper{stateTrie, t}
 
 	/////////////////////////////////////////////////////////
@@ -21,7 +21,6 @@ import (
 	"sort"
 
 	"github.com/golang/protobuf/proto"
-	"github.com/hyperledger/fabric/core/util"
 )
 
 type trieNode struct {
@@ -120,7 +119,7 @@ func (trieNode *trieNode) computeCryptoHash() []byte {
 	}
 
 	stateTrieLogger.Debugf("Recomputing hash for trieKey = [%s]", trieNode)
-	return util.ComputeCryptoHash(cryptoHashContent)
+	return computeCryptoHash(cryptoHashContent)
 }
 
 func (trieNode *trieNode) containsValue() bool {
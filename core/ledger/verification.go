@@ -0,0 +1,143 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ledger
+
+import (
+	"bytes"
+	"fmt"
+
+	"github.com/hyperledger/fabric/core/ledger/statemgmt"
+	"github.com/hyperledger/fabric/protos"
+)
+
+// verificationID is the id of the tx group the state hashes are recomputed in,
+// which keeps transaction batches from starting meanwhile
+const verificationID = "ledgerVerification"
+
+// VerifyChainIntegrity re-validates the blocks from down to to. Walking from
+// block to down, it checks that the hash of each block is the previous block
+// hash recorded by the next one, and that the state hash recorded in each
+// block is that of the state rolled back to the block by replaying the state
+// deltas of the blocks committed since, as long as these deltas are kept.
+// The first divergence found stops the verification, as the blocks below it
+// can no longer be checked against a trusted block or state. The state of the
+// last block is the one in the db, so that a corrupted state shows up as a
+// divergence of the state hash of every block.
+// An error is only returned if the ledger could not be read, or if a
+// transaction batch is in progress.
+func (ledger *Ledger) VerifyChainIntegrity(from, to uint64) (*protos.ChainVerification, error) {
+	size := ledger.GetBlockchainSize()
+	if to >= size || from > to {
+		return nil, ErrOutOfBounds
+	}
+	verification := &protos.ChainVerification{From: from, To: to, StateVerifiedFrom: to + 1}
+
+	rollback := statemgmt.NewStateDelta()
+	stateVerifiable := true
+	for blockNumber := size - 1; blockNumber > to && stateVerifiable; blockNumber-- {
+		var err error
+		stateVerifiable, err = ledger.addStateRollback(rollback, blockNumber)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var next *protos.Block
+	for blockNumber := to; ; blockNumber-- {
+		block, err := ledger.GetBlockByNumber(blockNumber)
+		if err != nil {
+			return nil, fmt.Errorf("Error fetching block %d: %s", blockNumber, err)
+		}
+		if next != nil {
+			// a pruned block is verified by the hash it recorded
+			blockHash, err := committedBlockHash(block)
+			if err != nil {
+				return nil, fmt.Errorf("Error hashing block %d: %s", blockNumber, err)
+			}
+			if !bytes.Equal(blockHash, next.PreviousBlockHash) {
+				ledgerLogger.Warningf("The hash of block %d is not the previous block hash recorded by block %d", blockNumber, blockNumber+1)
+				verification.Divergence = protos.ChainVerification_BLOCK_HASH
+				verification.DivergentBlock = blockNumber
+				verification.ExpectedHash = next.PreviousBlockHash
+				verification.ActualHash = blockHash
+				return verification, nil
+			}
+		}
+		if stateVerifiable {
+			stateHash, err := ledger.rolledBackStateHash(rollback)
+			if err != nil {
+				return nil, err
+			}
+			if !bytes.Equal(stateHash, block.StateHash) {
+				ledgerLogger.Warningf("The state hash of block %d is not the hash of the state rolled back to it", blockNumber)
+				verification.Divergence = protos.ChainVerification_STATE_HASH
+				verification.DivergentBlock = blockNumber
+				verification.ExpectedHash = block.StateHash
+				verification.ActualHash = stateHash
+				return verification, nil
+			}
+			verification.StateVerifiedFrom = blockNumber
+			if blockNumber > from {
+				stateVerifiable, err = ledger.addStateRollback(rollback, blockNumber)
+				if err != nil {
+					return nil, err
+				}
+			}
+		}
+		if blockNumber == from {
+			return verification, nil
+		}
+		next = block
+	}
+}
+
+// addStateRollback adds to rollback the changes rolling back the state of
+// block blockNumber to that of the block before, returning false if the state
+// delta of the block is no longer kept
+func (ledger *Ledger) addStateRollback(rollback *statemgmt.StateDelta, blockNumber uint64) (bool, error) {
+	delta, err := ledger.GetStateDelta(blockNumber)
+	if err != nil {
+		return false, fmt.Errorf("Error fetching the state delta of block %d: %s", blockNumber, err)
+	}
+	if delta == nil {
+		ledgerLogger.Infof("The state delta of block %d is no longer kept, the state hashes of the blocks below are not verified", blockNumber)
+		return false, nil
+	}
+	for _, chaincodeID := range delta.GetUpdatedChaincodeIds(false) {
+		for key, updatedValue := range delta.GetUpdates(chaincodeID) {
+			// the rollback of a key changed by several blocks keeps the value of
+			// the first block rolled back as previous value, and takes the
+			// previous value of the oldest one
+			if updatedValue.GetPreviousValue() == nil {
+				rollback.Delete(chaincodeID, key, updatedValue.GetValue())
+			} else {
+				rollback.Set(chaincodeID, key, updatedValue.GetPreviousValue(), updatedValue.GetValue())
+			}
+		}
+	}
+	return true, nil
+}
+
+// rolledBackStateHash returns the hash of the state of the last block once
+// rollback is applied to it, leaving the state unchanged
+func (ledger *Ledger) rolledBackStateHash(rollback *statemgmt.StateDelta) ([]byte, error) {
+	if err := ledger.ApplyStateDelta(verificationID, rollback); err != nil {
+		return nil, fmt.Errorf("Error rolling back the state: %s", err)
+	}
+	defer ledger.RollbackStateDelta(verificationID)
+	return ledger.GetTempStateHash()
+}
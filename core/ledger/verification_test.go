@@ -0,0 +1,117 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ledger
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/hyperledger/fabric/core/ledger/statemgmt"
+	"github.com/hyperledger/fabric/core/ledger/testutil"
+	"github.com/hyperledger/fabric/protos"
+)
+
+// commitTestStateBlocks commits count blocks which add a key, update a key
+// set by every block and delete the key added by the block before
+func commitTestStateBlocks(t *testing.T, ledger *Ledger, count int) {
+	for i := 0; i < count; i++ {
+		ledger.BeginTxBatch(i)
+		transaction, uuid := buildTestTx(t)
+		ledger.TxBegin(uuid)
+		ledger.SetState("chaincode1", fmt.Sprintf("key%d", i), []byte(fmt.Sprintf("value%d", i)))
+		ledger.SetState("chaincode2", "key", []byte(fmt.Sprintf("value%d", i)))
+		if i > 0 {
+			ledger.DeleteState("chaincode1", fmt.Sprintf("key%d", i-1))
+		}
+		ledger.TxFinished(uuid, true)
+		err := ledger.CommitTxBatch(i, []*protos.Transaction{transaction}, nil, []byte("proof"))
+		testutil.AssertNoError(t, err, "Error committing block")
+	}
+}
+
+func TestVerifyChainIntegrity(t *testing.T) {
+	ledgerTestWrapper := createFreshDBAndTestLedgerWrapper(t)
+	ledger := ledgerTestWrapper.ledger
+	commitTestStateBlocks(t, ledger, 5)
+	stateHash := ledgerTestWrapper.GetTempStateHash()
+
+	verification, err := ledger.VerifyChainIntegrity(0, 4)
+	testutil.AssertNoError(t, err, "Error verifying the blockchain")
+	testutil.AssertEquals(t, verification, &protos.ChainVerification{From: 0, To: 4, StateVerifiedFrom: 0})
+
+	verification, err = ledger.VerifyChainIntegrity(1, 3)
+	testutil.AssertNoError(t, err, "Error verifying the blockchain")
+	testutil.AssertEquals(t, verification, &protos.ChainVerification{From: 1, To: 3, StateVerifiedFrom: 1})
+
+	// the state is left as it was
+	testutil.AssertEquals(t, ledgerTestWrapper.GetTempStateHash(), stateHash)
+	testutil.AssertEquals(t, ledgerTestWrapper.GetState("chaincode2", "key", true), []byte("value4"))
+
+	_, err = ledger.VerifyChainIntegrity(0, 5)
+	testutil.AssertError(t, err, "Expected an error verifying blocks beyond the last block")
+	_, err = ledger.VerifyChainIntegrity(3, 2)
+	testutil.AssertError(t, err, "Expected an error verifying an empty range of blocks")
+
+	ledger.BeginTxBatch(5)
+	_, err = ledger.VerifyChainIntegrity(0, 4)
+	testutil.AssertError(t, err, "Expected an error verifying the blockchain while a batch is in progress")
+	ledger.RollbackTxBatch(5)
+}
+
+func TestVerifyChainIntegrityStateDivergence(t *testing.T) {
+	ledgerTestWrapper := createFreshDBAndTestLedgerWrapper(t)
+	ledger := ledgerTestWrapper.ledger
+	commitTestStateBlocks(t, ledger, 5)
+
+	// a change of the state outside of a block
+	delta := statemgmt.NewStateDelta()
+	delta.Set("chaincode2", "key", []byte("tampered"), []byte("value4"))
+	ledgerTestWrapper.ApplyStateDelta(1, delta)
+	ledgerTestWrapper.CommitStateDelta(1)
+
+	verification, err := ledger.VerifyChainIntegrity(0, 4)
+	testutil.AssertNoError(t, err, "Error verifying the blockchain")
+	testutil.AssertEquals(t, verification.Divergence, protos.ChainVerification_STATE_HASH)
+	testutil.AssertEquals(t, verification.DivergentBlock, uint64(4))
+	testutil.AssertEquals(t, verification.ExpectedHash, ledgerTestWrapper.GetBlockByNumber(4).StateHash)
+	testutil.AssertEquals(t, verification.ActualHash, ledgerTestWrapper.GetTempStateHash())
+	testutil.AssertEquals(t, verification.StateVerifiedFrom, uint64(5))
+}
+
+func TestVerifyChainIntegrityBlockHashDivergence(t *testing.T) {
+	ledgerTestWrapper := createFreshDBAndTestLedgerWrapper(t)
+	ledger := ledgerTestWrapper.ledger
+	commitTestStateBlocks(t, ledger, 5)
+
+	block := ledgerTestWrapper.GetBlockByNumber(2)
+	block.ConsensusMetadata = []byte("tampered")
+	ledgerTestWrapper.PutRawBlock(block, 2)
+
+	verification, err := ledger.VerifyChainIntegrity(0, 4)
+	testutil.AssertNoError(t, err, "Error verifying the blockchain")
+	testutil.AssertEquals(t, verification.Divergence, protos.ChainVerification_BLOCK_HASH)
+	testutil.AssertEquals(t, verification.DivergentBlock, uint64(2))
+	testutil.AssertEquals(t, verification.ExpectedHash, ledgerTestWrapper.GetBlockByNumber(3).PreviousBlockHash)
+	blockHash, _ := block.GetHash()
+	testutil.AssertEquals(t, verification.ActualHash, blockHash)
+	testutil.AssertEquals(t, verification.StateVerifiedFrom, uint64(3))
+
+	// the blocks above the divergence verify
+	verification, err = ledger.VerifyChainIntegrity(3, 4)
+	testutil.AssertNoError(t, err, "Error verifying the blockchain")
+	testutil.AssertEquals(t, verification.Divergence, protos.ChainVerification_NONE)
+}
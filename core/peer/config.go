@@ -32,6 +32,7 @@ package peer
 import (
 	"fmt"
 	"net"
+	"strings"
 
 	"github.com/spf13/viper"
 
@@ -51,6 +52,7 @@ var peerEndpointError error
 // Cached values of commonly used configuration constants.
 var syncStateSnapshotChannelSize int
 var syncStateDeltasChannelSize int
+var syncStateDeltasCompression pb.SyncStateDeltas_Compression
 var syncBlocksChannelSize int
 var validatorEnabled bool
 
@@ -103,6 +105,15 @@ func CacheConfiguration() (err error) {
 
 	syncStateSnapshotChannelSize = viper.GetInt("peer.sync.state.snapshot.channelSize")
 	syncStateDeltasChannelSize = viper.GetInt("peer.sync.state.deltas.channelSize")
+	compression := strings.ToUpper(viper.GetString("peer.sync.state.deltas.compression"))
+	if value, ok := pb.SyncStateDeltas_Compression_value[compression]; ok {
+		syncStateDeltasCompression = pb.SyncStateDeltas_Compression(value)
+	} else {
+		if compression != "" {
+			peerLogger.Warningf("Unknown state delta compression %s, state deltas are sent uncompressed", compression)
+		}
+		syncStateDeltasCompression = pb.SyncStateDeltas_NONE
+	}
 	syncBlocksChannelSize = viper.GetInt("peer.sync.blocks.channelSize")
 	validatorEnabled = viper.GetBool("peer.validator.enabled")
 
@@ -158,6 +169,14 @@ func SyncStateDeltasChannelSize() int {
 	return syncStateDeltasChannelSize
 }
 
+// SyncStateDeltasCompression returns the peer.sync.state.deltas.compression property
+func SyncStateDeltasCompression() pb.SyncStateDeltas_Compression {
+	if !configurationCached {
+		cacheConfiguration()
+	}
+	return syncStateDeltasCompression
+}
+
 // SyncBlocksChannelSize returns the peer.sync.blocks.channelSize property
 func SyncBlocksChannelSize() int {
 	if !configurationCached {
@@ -43,6 +43,7 @@ type Handler struct {
 	snapshotRequestHandler        *syncStateSnapshotRequestHandler
 	syncStateDeltasRequestHandler *syncStateDeltasHandler
 	syncBlocksRequestHandler      *syncBlocksRequestHandler
+	stateDeltaCompression         pb.SyncStateDeltas_Compression // of the state deltas sent to the peer
 }
 
 // NewPeerHandler returns a new Peer handler
@@ -153,6 +154,7 @@ func (d *Handler) beforeHello(e *fsm.Event) {
 	}
 	// Store the PeerEndpoint
 	d.ToPeerEndpoint = helloMessage.PeerEndpoint
+	d.stateDeltaCompression = pb.NegotiateStateDeltaCompression(SyncStateDeltasCompression(), helloMessage.StateDeltaCompressions)
 	peerLogger.Debugf("Received %s from endpoint=%s", e.Event, helloMessage)
 
 	// If security enabled, need to verify the signature on the hello message
@@ -409,6 +411,11 @@ func (d *Handler) sendBlocks(syncBlockRange *pb.SyncBlockRange) {
 			peerLogger.Errorf("Error sending blockNum %d: %s", currBlockNum, err)
 			break
 		}
+		if block.IsPruned() {
+			// It would not hash as the requester expects, which must sync it from a peer retaining it
+			peerLogger.Warningf("Not sending blockNum %d, its transactions were pruned", currBlockNum)
+			break
+		}
 		// Encode a SyncBlocks into the payload
 		syncBlocks := &pb.SyncBlocks{Range: &pb.SyncBlockRange{Start: currBlockNum, End: currBlockNum, CorrelationId: syncBlockRange.CorrelationId}, Blocks: []*pb.Block{block}}
 		syncBlocksBytes, err := proto.Marshal(syncBlocks)
@@ -645,6 +652,10 @@ func (d *Handler) sendStateDeltas(syncStateDeltasRequest *pb.SyncStateDeltasRequ
 		// Encode a SyncStateDeltas into the payload
 		stateDeltaBytes := stateDelta.Marshal()
 		syncStateDeltas := &pb.SyncStateDeltas{Range: &pb.SyncBlockRange{Start: currBlockNum, End: currBlockNum, CorrelationId: syncBlockRange.CorrelationId}, Deltas: [][]byte{stateDeltaBytes}}
+		if err := syncStateDeltas.Compress(d.stateDeltaCompression); err != nil {
+			peerLogger.Errorf("Error compressing stateDeltas for blockNum %d: %s", currBlockNum, err)
+			break
+		}
 		syncStateDeltasBytes, err := proto.Marshal(syncStateDeltas)
 		if err != nil {
 			peerLogger.Errorf("Error marshalling syncStateDeltas for BlockNum = %d: %s", currBlockNum, err)
@@ -671,6 +682,10 @@ func (d *Handler) beforeSyncStateDeltas(e *fsm.Event) {
 		e.Cancel(fmt.Errorf("Error unmarshalling SyncStateDeltas in beforeSyncStateDeltas: %s", err))
 		return
 	}
+	if err := syncStateDeltas.Decompress(); err != nil {
+		e.Cancel(fmt.Errorf("Error decompressing SyncStateDeltas in beforeSyncStateDeltas: %s", err))
+		return
+	}
 	peerLogger.Debugf("Sending state delta onto channel for start = %d and end = %d", syncStateDeltas.Range.Start, syncStateDeltas.Range.End)
 
 	// Send the message onto the channel, allow for the fact that channel may be closed on send attempt.
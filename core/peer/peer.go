@@ -77,8 +77,10 @@ type BlockChainAccessor interface {
 // BlockChainModifier interface for applying changes to the block chain
 type BlockChainModifier interface {
 	ApplyStateDelta(id interface{}, delta *statemgmt.StateDelta) error
+	ApplyStateDeltas(id interface{}, deltas []*statemgmt.StateDelta) error
 	RollbackStateDelta(id interface{}) error
 	CommitStateDelta(id interface{}) error
+	CommitStateDeltaWithBlocks(id interface{}, blocks map[uint64]*pb.Block) error
 	EmptyState() error
 	PutBlock(blockNumber uint64, block *pb.Block) error
 }
@@ -654,7 +656,8 @@ func (p *PeerImpl) newHelloMessage() (*pb.HelloMessage, error) {
 	if err != nil {
 		return nil, fmt.Errorf("Error creating hello message, error getting block chain info: %s", err)
 	}
-	return &pb.HelloMessage{PeerEndpoint: endpoint, BlockchainInfo: blockChainInfo}, nil
+	return &pb.HelloMessage{PeerEndpoint: endpoint, BlockchainInfo: blockChainInfo, ConsensusEnvelopeVersion: pb.ConsensusEnvelopeVersion,
+		StateDeltaCompressions: pb.StateDeltaCompressions}, nil
 }
 
 // GetBlockByNumber return a block by block number
@@ -701,6 +704,14 @@ func (p *PeerImpl) ApplyStateDelta(id interface{}, delta *statemgmt.StateDelta)
 	return p.ledgerWrapper.ledger.ApplyStateDelta(id, delta)
 }
 
+// ApplyStateDeltas applies the state deltas of consecutive blocks as a single
+// state delta, to be committed or rolled back like one applied by ApplyStateDelta
+func (p *PeerImpl) ApplyStateDeltas(id interface{}, deltas []*statemgmt.StateDelta) error {
+	p.ledgerWrapper.Lock()
+	defer p.ledgerWrapper.Unlock()
+	return p.ledgerWrapper.ledger.ApplyStateDeltas(id, deltas)
+}
+
 // CommitStateDelta makes the result of ApplyStateDelta permanent
 // and releases the resources necessary to rollback the delta
 func (p *PeerImpl) CommitStateDelta(id interface{}) error {
@@ -709,6 +720,14 @@ func (p *PeerImpl) CommitStateDelta(id interface{}) error {
 	return p.ledgerWrapper.ledger.CommitStateDelta(id)
 }
 
+// CommitStateDeltaWithBlocks makes the result of ApplyStateDelta permanent
+// along with the given raw blocks, atomically
+func (p *PeerImpl) CommitStateDeltaWithBlocks(id interface{}, blocks map[uint64]*pb.Block) error {
+	p.ledgerWrapper.Lock()
+	defer p.ledgerWrapper.Unlock()
+	return p.ledgerWrapper.ledger.CommitStateDeltaWithBlocks(id, blocks)
+}
+
 // RollbackStateDelta undoes the results of ApplyStateDelta to revert
 // the current state back to the state before ApplyStateDelta was invoked
 func (p *PeerImpl) RollbackStateDelta(id interface{}) error {
@@ -76,6 +76,7 @@ type coordinatorImpl struct {
 
 	blockVerifyChunkSize uint64        // The max block length to attempt to sync at once, this prevents state transfer from being delayed while the blockchain is validated
 	validBlockRanges     []*blockRange // Used by the block thread to track which pieces of the blockchain have already been hashed
+	pendingBlocks        map[uint64]*pb.Block // Blocks above the state, verified by the block thread, to be committed with the state deltas which reach them
 	RecoverDamage        bool          // Whether state transfer should ever modify or delete existing blocks if they are determined to be corrupted
 
 	blockSyncReq chan *blockSyncReq // Used to request a block sync, new requests cause the existing request to abort, write only from the state thread
@@ -143,6 +144,7 @@ func NewCoordinatorImpl(stack PartialStack) Coordinator {
 	sts.stateValid = true // Assume our starting state is correct unless told otherwise
 
 	sts.validBlockRanges = make([]*blockRange, 0)
+	sts.pendingBlocks = make(map[uint64]*pb.Block)
 	sts.blockVerifyChunkSize = uint64(viper.GetInt("statetransfer.blocksperrequest"))
 	if sts.blockVerifyChunkSize == 0 {
 		panic(fmt.Errorf("Must set statetransfer.blocksperrequest to be nonzero"))
@@ -288,7 +290,9 @@ func (sts *coordinatorImpl) tryOverPeers(passedPeerIDs []*pb.PeerID, do func(pee
 // Attempts to complete a blockSyncReq using the supplied peers
 // Will return the last block number attempted to sync, and the last block successfully synced (or nil) and error on failure
 // This means on failure, the returned block corresponds to 1 higher than the returned block number
-func (sts *coordinatorImpl) syncBlocks(highBlock, lowBlock uint64, highHash []byte, peerIDs []*pb.PeerID) (uint64, *pb.Block, error) {
+// syncBlocks retrieves the blocks from highBlock down to lowBlock. The blocks above pendingAbove are not put on
+// the chain but kept in sts.pendingBlocks, to be committed along with the state deltas which reach them
+func (sts *coordinatorImpl) syncBlocks(highBlock, lowBlock, pendingAbove uint64, highHash []byte, peerIDs []*pb.PeerID) (uint64, *pb.Block, error) {
 	logger.Debugf("Syncing blocks from %d to %d with head hash of %x", highBlock, lowBlock, highHash)
 	validBlockHash := highHash
 	blockCursor := highBlock
@@ -365,10 +369,10 @@ func (sts *coordinatorImpl) syncBlocks(highBlock, lowBlock uint64, highHash []by
 								}
 								logger.Debugf("Not actually putting block %d to with PreviousBlockHash %x and StateHash %x, as it already exists", blockCursor, block.PreviousBlockHash, block.StateHash)
 							} else {
-								sts.stack.PutBlock(blockCursor, block)
+								sts.putBlock(blockCursor, block, pendingAbove)
 							}
 						} else {
-							sts.stack.PutBlock(blockCursor, block)
+							sts.putBlock(blockCursor, block, pendingAbove)
 						}
 
 						goodRange = &blockRange{
@@ -408,6 +412,23 @@ func (sts *coordinatorImpl) syncBlocks(highBlock, lowBlock uint64, highHash []by
 
 }
 
+// putBlock puts a block on the chain, unless it is above pendingAbove, in which case it is kept in sts.pendingBlocks
+func (sts *coordinatorImpl) putBlock(blockNumber uint64, block *pb.Block, pendingAbove uint64) {
+	if blockNumber > pendingAbove {
+		sts.pendingBlocks[blockNumber] = block
+		return
+	}
+	sts.stack.PutBlock(blockNumber, block)
+}
+
+// getBlock returns a block retrieved by syncBlocks, whether it is on the chain or still pending
+func (sts *coordinatorImpl) getBlock(blockNumber uint64) (*pb.Block, error) {
+	if block, ok := sts.pendingBlocks[blockNumber]; ok {
+		return block, nil
+	}
+	return sts.stack.GetBlockByNumber(blockNumber)
+}
+
 func (sts *coordinatorImpl) syncBlockchainToTarget(blockSyncReq *blockSyncReq) {
 
 	logger.Debugf("Processing a blockSyncReq to block %d", blockSyncReq.blockNumber)
@@ -423,7 +444,10 @@ func (sts *coordinatorImpl) syncBlockchainToTarget(blockSyncReq *blockSyncReq) {
 		}
 	} else {
 
-		_, _, err := sts.syncBlocks(blockSyncReq.blockNumber, blockSyncReq.reportOnBlock, blockSyncReq.firstBlockHash, blockSyncReq.peerIDs)
+		// The blocks above the state are only committed with the state deltas which reach them, so that a
+		// crash cannot leave them on the chain without the state reflecting them
+		sts.pendingBlocks = make(map[uint64]*pb.Block)
+		_, _, err := sts.syncBlocks(blockSyncReq.blockNumber, blockSyncReq.reportOnBlock, blockSyncReq.reportOnBlock, blockSyncReq.firstBlockHash, blockSyncReq.peerIDs)
 
 		if nil != blockSyncReq.replyChan {
 			logger.Debugf("Replying to blockSyncReq on reply channel with : %s", err)
@@ -535,7 +559,7 @@ func (sts *coordinatorImpl) verifyAndRecoverBlockchain() bool {
 	sts.validBlockRanges[0].lowNextHash = lastGoodBlock.PreviousBlockHash
 
 	if targetBlock < lastGoodBlockNumber {
-		sts.syncBlocks(lastGoodBlockNumber-1, targetBlock, lastGoodBlock.PreviousBlockHash, nil)
+		sts.syncBlocks(lastGoodBlockNumber-1, targetBlock, lastGoodBlockNumber-1, lastGoodBlock.PreviousBlockHash, nil)
 	}
 
 	return false
@@ -679,14 +703,17 @@ func (sts *coordinatorImpl) playStateUpToBlockNumber(toBlockNumber uint64, peerI
 				return fmt.Errorf("Received an error while trying to get the state deltas for blocks %d through %d from %v", sts.currentStateBlockNumber+1, intermediateBlock, peerID)
 			}
 
-			for sts.currentStateBlockNumber < intermediateBlock {
+			// The deltas of the range are applied at once, so the state hash is
+			// only computed and checked for the last block of the range
+			var deltas []*statemgmt.StateDelta
+			for sts.currentStateBlockNumber+uint64(len(deltas)) < intermediateBlock {
 				select {
 				case deltaMessage, ok := <-deltaMessages:
 					if !ok {
 						return fmt.Errorf("Was only able to recover to block number %d when desired to recover to %d", sts.currentStateBlockNumber, toBlockNumber)
 					}
 
-					if deltaMessage.Range.Start != sts.currentStateBlockNumber+1 || deltaMessage.Range.End < deltaMessage.Range.Start || deltaMessage.Range.End > toBlockNumber {
+					if deltaMessage.Range.Start != sts.currentStateBlockNumber+uint64(len(deltas))+1 || deltaMessage.Range.End < deltaMessage.Range.Start || deltaMessage.Range.End > intermediateBlock {
 						return fmt.Errorf("Received a state delta from %v either in the wrong order (backwards) or not next in sequence, aborting, start=%d, end=%d", peerID, deltaMessage.Range.Start, deltaMessage.Range.End)
 					}
 
@@ -695,54 +722,68 @@ func (sts *coordinatorImpl) playStateUpToBlockNumber(toBlockNumber uint64, peerI
 						if err := umDelta.Unmarshal(delta); nil != err {
 							return fmt.Errorf("Received a corrupt state delta from %v : %s", peerID, err)
 						}
-						sts.stack.ApplyStateDelta(deltaMessage, umDelta)
-
-						success := false
+						deltas = append(deltas, umDelta)
+					}
 
-						testBlock, err := sts.stack.GetBlockByNumber(sts.currentStateBlockNumber + 1)
+				case <-time.After(sts.StateDeltaRequestTimeout):
+					logger.Warningf("Timed out during state delta recovery from %v", peerID)
+					return fmt.Errorf("timed out during state delta recovery from %v", peerID)
+				}
+			}
 
-						if err != nil {
-							logger.Warningf("Could not retrieve block %d, though it should be present", deltaMessage.Range.End)
-						} else {
+			if err := sts.stack.ApplyStateDeltas(peerID, deltas); err != nil {
+				return fmt.Errorf("Could not apply the state deltas received from %v: %s", peerID, err)
+			}
 
-							stateHash, err = sts.stack.GetCurrentStateHash()
-							if err != nil {
-								logger.Warningf("Could not compute state hash for some reason: %s", err)
-							}
-							logger.Debugf("Played state forward from %v to block %d with StateHash (%x), block has StateHash (%x)", peerID, deltaMessage.Range.End, stateHash, testBlock.StateHash)
-							if bytes.Equal(testBlock.StateHash, stateHash) {
-								success = true
-							}
-						}
+			success := false
 
-						if !success {
-							if sts.stack.RollbackStateDelta(deltaMessage) != nil {
-								sts.stateValid = false
-								return fmt.Errorf("played state forward according to %v, but the state hash did not match, failed to roll back, invalidated state", peerID)
-							}
-							return fmt.Errorf("Played state forward according to %v, but the state hash did not match, rolled back", peerID)
+			testBlock, err := sts.getBlock(intermediateBlock)
 
-						}
+			if err != nil {
+				logger.Warningf("Could not retrieve block %d, though it should be present", intermediateBlock)
+			} else {
 
-						if sts.stack.CommitStateDelta(deltaMessage) != nil {
-							sts.stateValid = false
-							return fmt.Errorf("Played state forward according to %v, hashes matched, but failed to commit, invalidated state", peerID)
-						}
+				stateHash, err = sts.stack.GetCurrentStateHash()
+				if err != nil {
+					logger.Warningf("Could not compute state hash for some reason: %s", err)
+				}
+				logger.Debugf("Played state forward from %v to block %d with StateHash (%x), block has StateHash (%x)", peerID, intermediateBlock, stateHash, testBlock.StateHash)
+				if bytes.Equal(testBlock.StateHash, stateHash) {
+					success = true
+				}
+			}
 
-						logger.Debugf("Moved state from %d to %d", sts.currentStateBlockNumber, sts.currentStateBlockNumber+1)
-						sts.currentStateBlockNumber++
+			if !success {
+				if sts.stack.RollbackStateDelta(peerID) != nil {
+					sts.stateValid = false
+					return fmt.Errorf("played state forward according to %v, but the state hash did not match, failed to roll back, invalidated state", peerID)
+				}
+				return fmt.Errorf("Played state forward according to %v, but the state hash did not match, rolled back", peerID)
 
-						if sts.currentStateBlockNumber == toBlockNumber {
-							logger.Debugf("Caught up to block %d", sts.currentStateBlockNumber)
-							return nil
-						}
-					}
+			}
 
-				case <-time.After(sts.StateDeltaRequestTimeout):
-					logger.Warningf("Timed out during state delta recovery from %v", peerID)
-					return fmt.Errorf("timed out during state delta recovery from %v", peerID)
+			// The blocks the state is played forward to are committed along with it
+			blocks := make(map[uint64]*pb.Block)
+			for blockNumber := sts.currentStateBlockNumber + 1; blockNumber <= intermediateBlock; blockNumber++ {
+				if block, ok := sts.pendingBlocks[blockNumber]; ok {
+					blocks[blockNumber] = block
 				}
 			}
+			if sts.stack.CommitStateDeltaWithBlocks(peerID, blocks) != nil {
+				sts.stateValid = false
+				return fmt.Errorf("Played state forward according to %v, hashes matched, but failed to commit, invalidated state", peerID)
+			}
+			for blockNumber := range blocks {
+				delete(sts.pendingBlocks, blockNumber)
+			}
+
+			logger.Debugf("Moved state from %d to %d", sts.currentStateBlockNumber, intermediateBlock)
+			sts.currentStateBlockNumber = intermediateBlock
+
+			if sts.currentStateBlockNumber == toBlockNumber {
+				logger.Debugf("Caught up to block %d", sts.currentStateBlockNumber)
+				return nil
+			}
 		}
 
 	})
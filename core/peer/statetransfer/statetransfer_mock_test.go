@@ -511,6 +511,15 @@ func (mock *MockLedger) ApplyStateDelta(id interface{}, delta *statemgmt.StateDe
 	return nil
 }
 
+func (mock *MockLedger) ApplyStateDeltas(id interface{}, deltas []*statemgmt.StateDelta) error {
+	for _, delta := range deltas {
+		if err := mock.ApplyStateDelta(id, delta); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 func (mock *MockLedger) CommitStateDelta(id interface{}) error {
 	mock.mutex.Lock()
 	defer func() {
@@ -521,6 +530,22 @@ func (mock *MockLedger) CommitStateDelta(id interface{}) error {
 	return nil
 }
 
+func (mock *MockLedger) CommitStateDeltaWithBlocks(id interface{}, blocks map[uint64]*protos.Block) error {
+	mock.mutex.Lock()
+	defer func() {
+		mock.mutex.Unlock()
+	}()
+
+	for blockNumber, block := range blocks {
+		mock.blocks[blockNumber] = block
+		if blockNumber >= mock.blockHeight {
+			mock.blockHeight = blockNumber + 1
+		}
+	}
+	mock.deltaID = nil
+	return nil
+}
+
 func (mock *MockLedger) RollbackStateDelta(id interface{}) error {
 	mock.mutex.Lock()
 	defer func() {
@@ -408,6 +408,36 @@ func TestCatchupSyncDeltasError(t *testing.T) {
 	}
 }
 
+func TestCatchupBlocksCommittedWithState(t *testing.T) {
+	mrls := createRemoteLedgers(1, 3)
+
+	// Test from blockheight of 5, with no peer able to send valid state deltas
+	ml := NewMockLedger(mrls, func(request mockRequest, peerID *protos.PeerID) mockResponse {
+		if request == SyncDeltas {
+			return Timeout
+		}
+		return Normal
+	}, t)
+	ml.PutBlock(4, SimpleGetBlock(4))
+	ml.state = SimpleGetState(4)
+	sts := newTestStateTransfer(ml, mrls)
+	defer sts.Stop()
+	sts.StateDeltaRequestTimeout = 10 * time.Millisecond
+
+	blockNumber := uint64(7)
+	for peerID := range mrls.remoteLedgers {
+		mrls.GetMockRemoteLedgerByPeerID(&peerID).blockHeight = blockNumber + 1
+	}
+	if err, _ := sts.SyncToTarget(blockNumber, SimpleGetBlockHash(blockNumber), nil); err == nil {
+		t.Fatalf("State transfer should not have completed without the state deltas")
+	}
+
+	// The blocks the state could not be played forward to are not on the chain
+	if size := ml.GetBlockchainSize(); size != 5 {
+		t.Fatalf("Blockchain should have stayed 5 tall with the state, but is %d tall", size)
+	}
+}
+
 func executeBlockRecovery(ml *MockLedger, millisTimeout int, mrls *MockRemoteHashLedgerDirectory) error {
 
 	sts := newTestThreadlessStateTransfer(ml, mrls)
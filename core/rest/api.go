@@ -20,10 +20,13 @@ import (
 	"errors"
 	"fmt"
 	"google/protobuf"
+	"io"
 
 	"golang.org/x/net/context"
 
 	"github.com/golang/protobuf/proto"
+	"github.com/hyperledger/fabric/core/chaincode"
+	cutil "github.com/hyperledger/fabric/core/container/util"
 	"github.com/hyperledger/fabric/core/ledger"
 	pb "github.com/hyperledger/fabric/protos"
 	"github.com/spf13/viper"
@@ -126,6 +129,62 @@ func (s *ServerOpenchain) GetBlockByNumber(ctx context.Context, num *pb.BlockNum
 	return block, nil
 }
 
+// GetBlocksByRange streams the blocks of a range of the blockchain, reading
+// them sequentially. This is much cheaper than calling GetBlockByNumber for
+// each block of the range, e.g. for explorers and backup tools.
+func (s *ServerOpenchain) GetBlocksByRange(blockRange *pb.BlockRange, stream pb.Openchain_GetBlocksByRangeServer) error {
+	err := s.ledger.GetBlocksByRange(blockRange.Start, blockRange.End, func(blockNumber uint64, block *pb.Block) error {
+		// Remove the payloads of the transactions if the caller does not need
+		// them, as they can be very large.
+		if blockRange.OmitPayloads {
+			for _, transaction := range block.GetTransactions() {
+				transaction.Payload = nil
+			}
+		}
+		return stream.Send(block)
+	})
+	if err == ledger.ErrOutOfBounds {
+		return ErrNotFound
+	}
+	return err
+}
+
+// snapshotChunkSize is the size of the chunks GetLedgerSnapshot streams a
+// snapshot in, below the default maximum size of a gRPC message.
+const snapshotChunkSize = 1024 * 1024
+
+// GetLedgerSnapshot streams a checkpoint snapshot of the ledger, the last one
+// if the height requested is 0, for a joining peer to import rather than sync
+// every block from the genesis block.
+func (s *ServerOpenchain) GetLedgerSnapshot(req *pb.LedgerSnapshotRequest, stream pb.Openchain_GetLedgerSnapshotServer) error {
+	snapshot, height, err := s.ledger.OpenSnapshotCheckpoint(req.Height)
+	if err == ledger.ErrResourceNotFound {
+		return ErrNotFound
+	}
+	if err != nil {
+		return err
+	}
+	defer snapshot.Close()
+
+	buf := make([]byte, snapshotChunkSize)
+	for {
+		n, err := io.ReadFull(snapshot, buf)
+		if n > 0 {
+			data := make([]byte, n)
+			copy(data, buf[:n])
+			if err := stream.Send(&pb.LedgerSnapshotChunk{Height: height, Data: data}); err != nil {
+				return err
+			}
+		}
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
 // GetBlockCount returns the current number of blocks in the blockchain data
 // structure.
 func (s *ServerOpenchain) GetBlockCount(ctx context.Context, e *google_protobuf.Empty) (*pb.BlockCount, error) {
@@ -143,6 +202,16 @@ func (s *ServerOpenchain) GetBlockCount(ctx context.Context, e *google_protobuf.
 	return nil, fmt.Errorf("No blocks in blockchain.")
 }
 
+// GetLedgerStats returns the statistics of the ledger, such as the number of
+// transactions and the footprint of each chaincode in the state.
+func (s *ServerOpenchain) GetLedgerStats(ctx context.Context) (*ledger.LedgerStats, error) {
+	stats, err := s.ledger.GetLedgerStats()
+	if err != nil {
+		return nil, fmt.Errorf("Error retrieving ledger statistics: %s", err)
+	}
+	return stats, nil
+}
+
 // GetState returns the value for a particular chaincode ID and key
 func (s *ServerOpenchain) GetState(ctx context.Context, chaincodeID, key string) ([]byte, error) {
 	return s.ledger.GetState(chaincodeID, key, true)
@@ -162,11 +231,104 @@ func (s *ServerOpenchain) GetTransactionByUUID(ctx context.Context, txUUID strin
 	return transaction, nil
 }
 
+// GetTransactionReceipt returns the receipt of the transaction matching the
+// specified UUID, whether the transaction succeeded or failed
+func (s *ServerOpenchain) GetTransactionReceipt(ctx context.Context, txUUID string) (*pb.TransactionReceipt, error) {
+	receipt, err := s.ledger.GetTransactionReceipt(txUUID)
+	if err != nil {
+		switch err {
+		case ledger.ErrResourceNotFound:
+			return nil, ErrNotFound
+		default:
+			return nil, fmt.Errorf("Error retrieving transaction receipt from blockchain: %s", err)
+		}
+	}
+	return receipt, nil
+}
+
+// GetTransactionsByChaincodeID returns the transactions deploying or invoking
+// a chaincode in the blocks from startBlock to endBlock
+func (s *ServerOpenchain) GetTransactionsByChaincodeID(ctx context.Context, chaincodeID string, startBlock, endBlock uint64) ([]*pb.Transaction, error) {
+	transactions, err := s.ledger.GetTransactionsByChaincodeID(chaincodeID, startBlock, endBlock)
+	if err != nil {
+		return nil, fmt.Errorf("Error retrieving transactions from blockchain: %s", err)
+	}
+	return transactions, nil
+}
+
+// GetBlockNumbersByEventName returns the numbers of the blocks from startBlock
+// to endBlock with a transaction which emitted a chaincode event
+func (s *ServerOpenchain) GetBlockNumbersByEventName(ctx context.Context, eventName string, startBlock, endBlock uint64) ([]uint64, error) {
+	blockNumbers, err := s.ledger.GetBlockNumbersByEventName(eventName, startBlock, endBlock)
+	if err != nil {
+		return nil, fmt.Errorf("Error retrieving blocks from blockchain: %s", err)
+	}
+	return blockNumbers, nil
+}
+
+// GetBlockNumbersByEventAttribute returns the numbers of the blocks from
+// startBlock to endBlock with a transaction which emitted a chaincode event
+// with an indexed attribute
+func (s *ServerOpenchain) GetBlockNumbersByEventAttribute(ctx context.Context, eventName string, attribute *pb.EventAttribute, startBlock, endBlock uint64) ([]uint64, error) {
+	blockNumbers, err := s.ledger.GetBlockNumbersByEventAttribute(eventName, attribute, startBlock, endBlock)
+	if err != nil {
+		return nil, fmt.Errorf("Error retrieving blocks from blockchain: %s", err)
+	}
+	return blockNumbers, nil
+}
+
 // GetPeers returns a list of all peer nodes currently connected to the target peer.
 func (s *ServerOpenchain) GetPeers(ctx context.Context, e *google_protobuf.Empty) (*pb.PeersMessage, error) {
 	return s.peerInfo.GetPeers()
 }
 
+// GetDeployedChaincodes returns the chaincodes deployed to the chain, with the
+// status of their containers on the target peer.
+func (s *ServerOpenchain) GetDeployedChaincodes(ctx context.Context, e *google_protobuf.Empty) (*pb.DeployedChaincodes, error) {
+	chain := chaincode.GetChain(chaincode.DefaultChain)
+	if chain == nil {
+		return nil, fmt.Errorf("The chaincode support of the peer is not running")
+	}
+	return chain.GetDeployedChaincodes()
+}
+
+// GetChaincodeLogs streams the output of a chaincode run by the target peer,
+// the last lines kept of it then, if requested, the lines it writes until the
+// client cancels the request.
+func (s *ServerOpenchain) GetChaincodeLogs(req *pb.ChaincodeLogsRequest, stream pb.Openchain_GetChaincodeLogsServer) error {
+	if req.ChaincodeID == nil || req.ChaincodeID.Name == "" {
+		return fmt.Errorf("Chaincode name not set")
+	}
+	name := req.ChaincodeID.Name
+
+	if !req.Follow {
+		for _, entry := range cutil.GetChaincodeOutput(name, int(req.Tail)) {
+			if err := stream.Send(entry); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	lines, next, stop := cutil.FollowChaincodeOutput(name, int(req.Tail))
+	defer stop()
+	for _, entry := range lines {
+		if err := stream.Send(entry); err != nil {
+			return err
+		}
+	}
+	for {
+		select {
+		case entry := <-next:
+			if err := stream.Send(entry); err != nil {
+				return err
+			}
+		case <-stream.Context().Done():
+			return nil
+		}
+	}
+}
+
 // GetPeerEndpoint returns PeerEndpoint info of target peer.
 func (s *ServerOpenchain) GetPeerEndpoint(ctx context.Context, e *google_protobuf.Empty) (*pb.PeersMessage, error) {
 	peers := []*pb.PeerEndpoint{}
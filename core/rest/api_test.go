@@ -20,14 +20,17 @@ import (
 	"bytes"
 	"fmt"
 	"google/protobuf"
+	"io/ioutil"
 	"os"
 	"testing"
+	"time"
 
 	"github.com/hyperledger/fabric/core/ledger"
 	"github.com/hyperledger/fabric/core/util"
 	"github.com/hyperledger/fabric/protos"
 	"github.com/spf13/viper"
 	"golang.org/x/net/context"
+	"google.golang.org/grpc"
 )
 
 func TestMain(m *testing.M) {
@@ -175,6 +178,154 @@ func TestServerOpenchain_API_GetBlockByNumber(t *testing.T) {
 	}
 }
 
+// mockBlocksByRangeStream collects the blocks sent by GetBlocksByRange
+type mockBlocksByRangeStream struct {
+	grpc.ServerStream
+	blocks []*protos.Block
+}
+
+func (stream *mockBlocksByRangeStream) Send(block *protos.Block) error {
+	stream.blocks = append(stream.blocks, block)
+	return nil
+}
+
+func TestServerOpenchain_API_GetBlocksByRange(t *testing.T) {
+	// Construct a ledger with 3 blocks, and a 4th one whose transaction has a payload.
+	ledger1 := ledger.InitTestLedger(t)
+	buildTestLedger1(ledger1, t)
+	transaction, err := protos.NewTransaction(protos.ChaincodeID{Path: "MyContract"}, generateUUID(t), "setX", []string{"{x: \"hello\"}"})
+	if err != nil {
+		t.Fatalf("Error creating NewTransaction: %s", err)
+	}
+	transaction.Payload = []byte("payload")
+	ledger1.BeginTxBatch(3)
+	if err := ledger1.CommitTxBatch(3, []*protos.Transaction{transaction}, nil, []byte("dummy-proof")); err != nil {
+		t.Fatalf("Error committing block: %s", err)
+	}
+
+	// Initialize the OpenchainServer object.
+	server, err := NewOpenchainServerWithPeerInfo(new(peerInfo))
+	if err != nil {
+		t.Fatalf("Error creating OpenchainServer: %s", err)
+	}
+	server.ledger = ledger1
+
+	// Retrieve the blocks 3 to 0, with their payloads.
+	stream := &mockBlocksByRangeStream{}
+	if err := server.GetBlocksByRange(&protos.BlockRange{Start: 3, End: 0}, stream); err != nil {
+		t.Fatalf("Error retrieving blocks from blockchain: %s", err)
+	}
+	if len(stream.blocks) != 4 {
+		t.Fatalf("Expected 4 blocks but got %d", len(stream.blocks))
+	}
+	if !bytes.Equal(stream.blocks[0].Transactions[0].Payload, transaction.Payload) {
+		t.Errorf("Expected the first block to be block #3 with the payloads of its transactions")
+	}
+
+	// Retrieve the blocks 1 to 3, omitting the payloads.
+	stream = &mockBlocksByRangeStream{}
+	if err := server.GetBlocksByRange(&protos.BlockRange{Start: 1, End: 3, OmitPayloads: true}, stream); err != nil {
+		t.Fatalf("Error retrieving blocks from blockchain: %s", err)
+	}
+	if len(stream.blocks) != 3 {
+		t.Fatalf("Expected 3 blocks but got %d", len(stream.blocks))
+	}
+	for _, block := range stream.blocks {
+		for _, transaction := range block.Transactions {
+			if transaction.Payload != nil {
+				t.Errorf("Expected the payloads of the transactions to be omitted: %v", transaction)
+			}
+		}
+	}
+
+	// The blockchain has only 4 blocks.
+	if err := server.GetBlocksByRange(&protos.BlockRange{Start: 0, End: 4}, &mockBlocksByRangeStream{}); err != ErrNotFound {
+		t.Errorf("Expected ErrNotFound when retrieving non-existent blocks, but got %v", err)
+	}
+}
+
+// mockLedgerSnapshotStream collects the chunks sent by GetLedgerSnapshot
+type mockLedgerSnapshotStream struct {
+	grpc.ServerStream
+	chunks []*protos.LedgerSnapshotChunk
+}
+
+func (stream *mockLedgerSnapshotStream) Send(chunk *protos.LedgerSnapshotChunk) error {
+	stream.chunks = append(stream.chunks, chunk)
+	return nil
+}
+
+func TestServerOpenchain_API_GetLedgerSnapshot(t *testing.T) {
+	// Write a checkpoint snapshot of the ledger every 2 blocks.
+	dir, err := ioutil.TempDir("", "snapshots")
+	if err != nil {
+		t.Fatalf("Error creating the directory of the snapshots: %s", err)
+	}
+	defer os.RemoveAll(dir)
+	viper.Set("ledger.snapshots.interval", 2)
+	viper.Set("ledger.snapshots.retain", 1)
+	viper.Set("ledger.snapshots.path", dir)
+	defer viper.Set("ledger.snapshots.interval", 0)
+
+	// Construct a ledger with 3 blocks.
+	ledger1 := ledger.InitTestLedger(t)
+	buildTestLedger1(ledger1, t)
+
+	// Initialize the OpenchainServer object.
+	server, err := NewOpenchainServerWithPeerInfo(new(peerInfo))
+	if err != nil {
+		t.Fatalf("Error creating OpenchainServer: %s", err)
+	}
+	server.ledger = ledger1
+
+	// The snapshot is written in the background.
+	for i := 0; i < 100; i++ {
+		heights, err := ledger1.GetSnapshotCheckpoints()
+		if err != nil {
+			t.Fatalf("Error retrieving the checkpoint snapshots: %s", err)
+		}
+		if len(heights) > 0 {
+			break
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+
+	stream := &mockLedgerSnapshotStream{}
+	if err := server.GetLedgerSnapshot(&protos.LedgerSnapshotRequest{}, stream); err != nil {
+		t.Fatalf("Error retrieving the snapshot of the ledger: %s", err)
+	}
+	if len(stream.chunks) == 0 {
+		t.Fatalf("Expected the snapshot to be streamed")
+	}
+	height := stream.chunks[0].Height
+	if height < 2 {
+		t.Errorf("Expected a snapshot at a height of at least 2 but got %d", height)
+	}
+
+	// The snapshot streamed is the snapshot written.
+	var streamed bytes.Buffer
+	for _, chunk := range stream.chunks {
+		streamed.Write(chunk.Data)
+	}
+	snapshot, _, err := ledger1.OpenSnapshotCheckpoint(height)
+	if err != nil {
+		t.Fatalf("Error opening the checkpoint snapshot: %s", err)
+	}
+	defer snapshot.Close()
+	written, err := ioutil.ReadAll(snapshot)
+	if err != nil {
+		t.Fatalf("Error reading the checkpoint snapshot: %s", err)
+	}
+	if !bytes.Equal(streamed.Bytes(), written) {
+		t.Errorf("Expected the snapshot streamed to be the checkpoint snapshot")
+	}
+
+	// There is no snapshot at a height which is not a checkpoint.
+	if err := server.GetLedgerSnapshot(&protos.LedgerSnapshotRequest{Height: 1}, &mockLedgerSnapshotStream{}); err != ErrNotFound {
+		t.Errorf("Expected ErrNotFound when retrieving a non-existent snapshot, but got %v", err)
+	}
+}
+
 func TestServerOpenchain_API_GetBlockCount(t *testing.T) {
 	// Must initialize the ledger singleton before initializing the
 	// OpenchainServer, as it needs that pointer.
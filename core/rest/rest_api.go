@@ -40,6 +40,7 @@ import (
 	core "github.com/hyperledger/fabric/core"
 	"github.com/hyperledger/fabric/core/chaincode"
 	"github.com/hyperledger/fabric/core/comm"
+	cutil "github.com/hyperledger/fabric/core/container/util"
 	"github.com/hyperledger/fabric/core/crypto"
 	"github.com/hyperledger/fabric/core/crypto/primitives"
 	pb "github.com/hyperledger/fabric/protos"
@@ -154,6 +155,7 @@ var (
 	ChaincodeDeployError     = &rpcError{Code: -32001, Message: "Deployment failure", Data: "Chaincode deployment has failed."}
 	ChaincodeInvokeError     = &rpcError{Code: -32002, Message: "Invocation failure", Data: "Chaincode invocation has failed."}
 	ChaincodeQueryError      = &rpcError{Code: -32003, Message: "Query failure", Data: "Chaincode query has failed."}
+	ValidatorBusyError       = &rpcError{Code: -32004, Message: "Validator busy", Data: "The transaction was not submitted because the validator is overloaded, it may be submitted again later."}
 )
 
 // SetOpenchainServer is a middleware function that sets the pointer to the
@@ -220,6 +222,14 @@ func validateEnrollmentIDParameter(rw web.ResponseWriter, enrollmentID string) b
 	return true
 }
 
+// writeBusy writes the HTTP error response for a transaction the validator
+// was too busy to accept, telling the client when to submit it again.
+func writeBusy(rw web.ResponseWriter) {
+	rw.Header().Set("Retry-After", "1")
+	rw.WriteHeader(http.StatusServiceUnavailable)
+	json.NewEncoder(rw).Encode(restResult{Error: core.ErrBusy.Error()})
+}
+
 // Register confirms the enrollmentID and secret password of the client with the
 // CA and stores the enrollment certificate and key in the Devops server.
 func (s *ServerOpenchainREST) Register(rw web.ResponseWriter, req *web.Request) {
@@ -653,6 +663,46 @@ func (s *ServerOpenchainREST) GetBlockchainInfo(rw web.ResponseWriter, req *web.
 	}
 }
 
+// GetDeployedChaincodes returns the chaincodes deployed to the chain, with
+// their deploy transaction, build digest and the status of their containers.
+func (s *ServerOpenchainREST) GetDeployedChaincodes(rw web.ResponseWriter, req *web.Request) {
+	deployed, err := s.server.GetDeployedChaincodes(context.Background(), &google_protobuf.Empty{})
+
+	encoder := json.NewEncoder(rw)
+
+	// Check for error
+	if err != nil {
+		// Failure
+		rw.WriteHeader(http.StatusInternalServerError)
+		encoder.Encode(restResult{Error: err.Error()})
+		restLogger.Errorf("Error retrieving the deployed chaincodes: %s", err)
+	} else {
+		// Success
+		rw.WriteHeader(http.StatusOK)
+		encoder.Encode(deployed)
+	}
+}
+
+// GetLedgerStats returns the statistics of the ledger for capacity planning,
+// such as the number of transactions and the size of the state.
+func (s *ServerOpenchainREST) GetLedgerStats(rw web.ResponseWriter, req *web.Request) {
+	stats, err := s.server.GetLedgerStats(context.Background())
+
+	encoder := json.NewEncoder(rw)
+
+	// Check for error
+	if err != nil {
+		// Failure
+		rw.WriteHeader(http.StatusInternalServerError)
+		encoder.Encode(restResult{Error: err.Error()})
+		restLogger.Errorf("Error retrieving ledger statistics: %s", err)
+	} else {
+		// Success
+		rw.WriteHeader(http.StatusOK)
+		encoder.Encode(stats)
+	}
+}
+
 // GetBlockByNumber returns the data contained within a specific block in the
 // blockchain. The genesis block is block zero.
 func (s *ServerOpenchainREST) GetBlockByNumber(rw web.ResponseWriter, req *web.Request) {
@@ -718,6 +768,203 @@ func (s *ServerOpenchainREST) GetTransactionByUUID(rw web.ResponseWriter, req *w
 	}
 }
 
+// GetTransactionReceipt returns the receipt of a transaction matching the
+// specified UUID, with its result or error, whether it succeeded or failed.
+func (s *ServerOpenchainREST) GetTransactionReceipt(rw web.ResponseWriter, req *web.Request) {
+	// Parse out the transaction UUID
+	txUUID := req.PathParams["uuid"]
+
+	// Retrieve the receipt of the transaction matching the UUID
+	receipt, err := s.server.GetTransactionReceipt(context.Background(), txUUID)
+
+	encoder := json.NewEncoder(rw)
+
+	// Check for Error
+	if err != nil {
+		switch err {
+		case ErrNotFound:
+			rw.WriteHeader(http.StatusNotFound)
+			encoder.Encode(restResult{Error: fmt.Sprintf("Receipt of transaction %s is not found.", txUUID)})
+		default:
+			rw.WriteHeader(http.StatusInternalServerError)
+			encoder.Encode(restResult{Error: fmt.Sprintf("Error retrieving receipt of transaction %s: %s.", txUUID, err)})
+			restLogger.Errorf("Error retrieving receipt of transaction %s: %s", txUUID, err)
+		}
+	} else {
+		// Return existing receipt
+		rw.WriteHeader(http.StatusOK)
+		encoder.Encode(receipt)
+		restLogger.Infof("Successfully retrieved receipt of transaction: %s", txUUID)
+	}
+}
+
+// parseBlockRange returns the range of blocks given by the startBlock and
+// endBlock query parameters, from the genesis block to the last block by default
+func (s *ServerOpenchainREST) parseBlockRange(req *web.Request) (uint64, uint64, error) {
+	req.ParseForm()
+	queryParams := req.Form
+
+	var startBlock, endBlock uint64
+	if count, err := s.server.GetBlockCount(context.Background(), nil); err == nil {
+		endBlock = count.Count - 1
+	}
+	if queryParams["startBlock"] != nil {
+		qParam, err := strconv.ParseUint(queryParams["startBlock"][0], 10, 64)
+		if err != nil {
+			return 0, 0, errors.New("startBlock query parameter must be an integer (uint64).")
+		}
+		startBlock = qParam
+	}
+	if queryParams["endBlock"] != nil {
+		qParam, err := strconv.ParseUint(queryParams["endBlock"][0], 10, 64)
+		if err != nil {
+			return 0, 0, errors.New("endBlock query parameter must be an integer (uint64).")
+		}
+		endBlock = qParam
+	}
+	if startBlock > endBlock {
+		return 0, 0, errors.New("startBlock query parameter must not be greater than endBlock.")
+	}
+	return startBlock, endBlock, nil
+}
+
+// parseEventAttribute returns the event attribute given by the attribute, type
+// and value query parameters, nil if there is no attribute query parameter
+func parseEventAttribute(req *web.Request) (*pb.EventAttribute, error) {
+	req.ParseForm()
+	queryParams := req.Form
+
+	if queryParams["attribute"] == nil {
+		return nil, nil
+	}
+	attribute := &pb.EventAttribute{Name: queryParams["attribute"][0], Indexed: true}
+	if queryParams["value"] == nil {
+		return nil, errors.New("value query parameter must be given with the attribute query parameter.")
+	}
+	attribute.Value = queryParams["value"][0]
+	if queryParams["type"] != nil {
+		attributeType, ok := pb.EventAttribute_Type_value[queryParams["type"][0]]
+		if !ok {
+			return nil, errors.New("type query parameter must be STRING, INTEGER or BOOLEAN.")
+		}
+		attribute.Type = pb.EventAttribute_Type(attributeType)
+	}
+	return attribute, nil
+}
+
+// GetTransactionsByChaincodeID returns the transactions deploying or invoking
+// a chaincode, in the blocks given by the startBlock and endBlock query parameters.
+func (s *ServerOpenchainREST) GetTransactionsByChaincodeID(rw web.ResponseWriter, req *web.Request) {
+	chaincodeID := req.PathParams["id"]
+
+	encoder := json.NewEncoder(rw)
+
+	startBlock, endBlock, err := s.parseBlockRange(req)
+	if err != nil {
+		rw.WriteHeader(http.StatusBadRequest)
+		encoder.Encode(restResult{Error: err.Error()})
+		return
+	}
+
+	transactions, err := s.server.GetTransactionsByChaincodeID(context.Background(), chaincodeID, startBlock, endBlock)
+	if err != nil {
+		rw.WriteHeader(http.StatusInternalServerError)
+		encoder.Encode(restResult{Error: err.Error()})
+		restLogger.Errorf("Error retrieving transactions of chaincode %s: %s", chaincodeID, err)
+		return
+	}
+
+	rw.WriteHeader(http.StatusOK)
+	encoder.Encode(transactions)
+}
+
+// GetChaincodeLogs returns the last lines the peer kept of the output of a
+// chaincode, as many as the tail query parameter, all of them if not set. With
+// the follow query parameter set to true, the response goes on with the lines
+// the chaincode writes, one JSON object per line, until the client disconnects.
+func (s *ServerOpenchainREST) GetChaincodeLogs(rw web.ResponseWriter, req *web.Request) {
+	chaincodeID := req.PathParams["id"]
+
+	encoder := json.NewEncoder(rw)
+
+	req.ParseForm()
+	queryParams := req.Form
+	tail := 0
+	if queryParams["tail"] != nil {
+		qParam, err := strconv.ParseUint(queryParams["tail"][0], 10, 31)
+		if err != nil {
+			rw.WriteHeader(http.StatusBadRequest)
+			encoder.Encode(restResult{Error: "tail query parameter must be a positive integer."})
+			return
+		}
+		tail = int(qParam)
+	}
+
+	if queryParams.Get("follow") != "true" {
+		rw.WriteHeader(http.StatusOK)
+		encoder.Encode(cutil.GetChaincodeOutput(chaincodeID, tail))
+		return
+	}
+
+	lines, next, stop := cutil.FollowChaincodeOutput(chaincodeID, tail)
+	defer stop()
+	rw.WriteHeader(http.StatusOK)
+	for _, entry := range lines {
+		encoder.Encode(entry)
+	}
+	rw.Flush()
+	closed := rw.CloseNotify()
+	for {
+		select {
+		case entry := <-next:
+			encoder.Encode(entry)
+			rw.Flush()
+		case <-closed:
+			return
+		}
+	}
+}
+
+// GetBlockNumbersByEventName returns the numbers of the blocks with a
+// transaction which emitted a chaincode event, among the blocks given by the
+// startBlock and endBlock query parameters. With the attribute and value query
+// parameters, and the type one (STRING by default), only the events with that
+// indexed attribute are searched.
+func (s *ServerOpenchainREST) GetBlockNumbersByEventName(rw web.ResponseWriter, req *web.Request) {
+	eventName := req.PathParams["name"]
+
+	encoder := json.NewEncoder(rw)
+
+	startBlock, endBlock, err := s.parseBlockRange(req)
+	if err != nil {
+		rw.WriteHeader(http.StatusBadRequest)
+		encoder.Encode(restResult{Error: err.Error()})
+		return
+	}
+	attribute, err := parseEventAttribute(req)
+	if err != nil {
+		rw.WriteHeader(http.StatusBadRequest)
+		encoder.Encode(restResult{Error: err.Error()})
+		return
+	}
+
+	var blockNumbers []uint64
+	if attribute == nil {
+		blockNumbers, err = s.server.GetBlockNumbersByEventName(context.Background(), eventName, startBlock, endBlock)
+	} else {
+		blockNumbers, err = s.server.GetBlockNumbersByEventAttribute(context.Background(), eventName, attribute, startBlock, endBlock)
+	}
+	if err != nil {
+		rw.WriteHeader(http.StatusInternalServerError)
+		encoder.Encode(restResult{Error: err.Error()})
+		restLogger.Errorf("Error retrieving blocks with event %s: %s", eventName, err)
+		return
+	}
+
+	rw.WriteHeader(http.StatusOK)
+	encoder.Encode(blockNumbers)
+}
+
 // Deploy first builds the chaincode package and subsequently deploys it to the
 // blockchain.
 //
@@ -848,6 +1095,12 @@ func (s *ServerOpenchainREST) Deploy(rw web.ResponseWriter, req *web.Request) {
 
 	// Deploy the ChaincodeSpec
 	chaincodeDeploymentSpec, err := s.devops.Deploy(context.Background(), &spec)
+	if err == core.ErrBusy {
+		writeBusy(rw)
+		restLogger.Warningf("Deploying Chaincode -- %s", err)
+
+		return
+	}
 	if err != nil {
 		// Replace " characters with '
 		errVal := strings.Replace(err.Error(), "\"", "'", -1)
@@ -989,6 +1242,12 @@ func (s *ServerOpenchainREST) Invoke(rw web.ResponseWriter, req *web.Request) {
 
 	// Invoke the chainCode
 	resp, err := s.devops.Invoke(context.Background(), &spec)
+	if err == core.ErrBusy {
+		writeBusy(rw)
+		restLogger.Warningf("Invoking Chaincode -- %s", err)
+
+		return
+	}
 	if err != nil {
 		// Replace " characters with '
 		errVal := strings.Replace(err.Error(), "\"", "'", -1)
@@ -1476,6 +1735,11 @@ func (s *ServerOpenchainREST) processChaincodeDeploy(spec *pb.ChaincodeSpec) rpc
 	// Deployment failed
 	//
 
+	if err == core.ErrBusy {
+		restLogger.Warningf("Error when deploying chaincode: %s", err)
+
+		return formatRPCError(ValidatorBusyError.Code, ValidatorBusyError.Message, ValidatorBusyError.Data)
+	}
 	if err != nil {
 		// Format the error appropriately for further processing
 		error := formatRPCError(ChaincodeDeployError.Code, ChaincodeDeployError.Message, fmt.Sprintf("Error when deploying chaincode: %s", err))
@@ -1609,6 +1873,11 @@ func (s *ServerOpenchainREST) processChaincodeInvokeOrQuery(method string, spec
 		// Invocation failed
 		//
 
+		if err == core.ErrBusy {
+			restLogger.Warningf("Error when invoking chaincode: %s", err)
+
+			return formatRPCError(ValidatorBusyError.Code, ValidatorBusyError.Message, ValidatorBusyError.Data)
+		}
 		if err != nil {
 			// Format the error appropriately for further processing
 			error := formatRPCError(ChaincodeInvokeError.Code, ChaincodeInvokeError.Message, fmt.Sprintf("Error when invoking chaincode: %s", err))
@@ -1731,7 +2000,12 @@ func buildOpenchainRESTRouter() *web.Router {
 	router.Get("/registrar/:id/tcert", (*ServerOpenchainREST).GetTransactionCert)
 
 	router.Get("/chain", (*ServerOpenchainREST).GetBlockchainInfo)
+	router.Get("/chain/stats", (*ServerOpenchainREST).GetLedgerStats)
 	router.Get("/chain/blocks/:id", (*ServerOpenchainREST).GetBlockByNumber)
+	router.Get("/chain/chaincodes", (*ServerOpenchainREST).GetDeployedChaincodes)
+	router.Get("/chain/chaincodes/:id/transactions", (*ServerOpenchainREST).GetTransactionsByChaincodeID)
+	router.Get("/chain/chaincodes/:id/logs", (*ServerOpenchainREST).GetChaincodeLogs)
+	router.Get("/chain/events/:name/blocks", (*ServerOpenchainREST).GetBlockNumbersByEventName)
 
 	// The /devops endpoint is now considered deprecated and superseded by the /chaincode endpoint
 	router.Post("/devops/deploy", (*ServerOpenchainREST).Deploy)
@@ -1742,6 +2016,7 @@ func buildOpenchainRESTRouter() *web.Router {
 	router.Post("/chaincode", (*ServerOpenchainREST).ProcessChaincode)
 
 	router.Get("/transactions/:uuid", (*ServerOpenchainREST).GetTransactionByUUID)
+	router.Get("/transactions/:uuid/receipt", (*ServerOpenchainREST).GetTransactionReceipt)
 
 	router.Get("/network/peers", (*ServerOpenchainREST).GetPeers)
 
@@ -24,11 +24,15 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"os"
+	"strings"
 	"testing"
 	"time"
 
 	"golang.org/x/net/context"
 
+	"github.com/hyperledger/fabric/core"
+	"github.com/hyperledger/fabric/core/chaincode"
+	cutil "github.com/hyperledger/fabric/core/container/util"
 	"github.com/hyperledger/fabric/core/ledger"
 	"github.com/hyperledger/fabric/protos"
 )
@@ -120,6 +124,8 @@ func (d *mockDevops) Invoke(c context.Context, cis *protos.ChaincodeInvocationSp
 	switch cis.ChaincodeSpec.CtorMsg.Function {
 	case "fail":
 		return nil, fmt.Errorf("Invoke failure")
+	case "busy":
+		return nil, core.ErrBusy
 	case "change_owner":
 		return &protos.Response{Status: protos.Response_SUCCESS, Msg: []byte("change_owner_invoke_result")}, nil
 	}
@@ -152,6 +158,10 @@ func (d *mockDevops) EXP_ExecuteWithBinding(ctx context.Context, executeWithBind
 	return nil, nil
 }
 
+func (d *mockDevops) VerifyChain(ctx context.Context, req *protos.VerifyChainRequest) (*protos.ChainVerification, error) {
+	return nil, nil
+}
+
 func initGlobalServerOpenchain(t *testing.T) {
 	var err error
 	serverOpenchain, err = NewOpenchainServerWithPeerInfo(new(peerInfo))
@@ -204,6 +214,104 @@ func TestServerOpenchainREST_API_GetBlockchainInfo(t *testing.T) {
 	}
 }
 
+func TestServerOpenchainREST_API_GetLedgerStats(t *testing.T) {
+	// Construct a ledger with 3 blocks.
+	ledger1 := ledger.InitTestLedger(t)
+	buildTestLedger1(ledger1, t)
+
+	initGlobalServerOpenchain(t)
+
+	// Start the HTTP REST test server
+	httpServer := httptest.NewServer(buildOpenchainRESTRouter())
+	defer httpServer.Close()
+
+	body := performHTTPGet(t, httpServer.URL+"/chain/stats")
+	var stats ledger.LedgerStats
+	err := json.Unmarshal(body, &stats)
+	if err != nil {
+		t.Fatalf("Invalid JSON response: %v", err)
+	}
+	if stats.Height != 3 || stats.TransactionCount != 3 {
+		t.Errorf("Expected 3 blocks and 3 transactions but got %d blocks and %d transactions", stats.Height, stats.TransactionCount)
+	}
+	if stats.StateKeyCount != 3 || stats.StateSize != 30 {
+		t.Errorf("Expected 3 state keys of 30 bytes but got %d state keys of %d bytes", stats.StateKeyCount, stats.StateSize)
+	}
+	if chaincodeStats := stats.Chaincodes["MyContract1"]; chaincodeStats == nil || chaincodeStats.KeyCount != 1 || chaincodeStats.Size != 16 {
+		t.Errorf("Expected chaincode MyContract1 to have 1 state key of 16 bytes but got %v", chaincodeStats)
+	}
+}
+
+func TestServerOpenchainREST_API_GetDeployedChaincodes(t *testing.T) {
+	// Construct a ledger with 3 blocks, and record a deployment in a 4th.
+	ledger1 := ledger.InitTestLedger(t)
+	buildTestLedger1(ledger1, t)
+	transaction, err := protos.NewChaincodeDeployTransaction(&protos.ChaincodeDeploymentSpec{}, generateUUID(t))
+	if err != nil {
+		t.Fatalf("Error creating the deploy transaction: %s", err)
+	}
+	ledger1.BeginTxBatch(3)
+	ledger1.TxBegin(transaction.Uuid)
+	deployed := &protos.DeployedChaincode{ChaincodeID: &protos.ChaincodeID{Path: "Contracts", Name: "MyContract1"}, Type: protos.ChaincodeSpec_GOLANG, Txid: transaction.Uuid}
+	if err = ledger1.SetDeployedChaincode(transaction.Uuid, deployed); err != nil {
+		t.Fatalf("Error recording the deployment: %s", err)
+	}
+	ledger1.TxFinished(transaction.Uuid, true)
+	ledger1.CommitTxBatch(3, []*protos.Transaction{transaction}, nil, []byte("dummy-proof"))
+
+	initGlobalServerOpenchain(t)
+
+	// Start the HTTP REST test server
+	httpServer := httptest.NewServer(buildOpenchainRESTRouter())
+	defer httpServer.Close()
+
+	// The chaincode support of the peer is needed for the status of the containers
+	getPeerEndpoint := func() (*protos.PeerEndpoint, error) {
+		return &protos.PeerEndpoint{ID: &protos.PeerID{Name: "testpeer"}, Address: "localhost:30303"}, nil
+	}
+	chaincode.NewChaincodeSupport(chaincode.DefaultChain, getPeerEndpoint, true, time.Second, nil)
+
+	body := performHTTPGet(t, httpServer.URL+"/chain/chaincodes")
+	var res protos.DeployedChaincodes
+	if err = json.Unmarshal(body, &res); err != nil {
+		t.Fatalf("Invalid JSON response: %v", err)
+	}
+	if len(res.Chaincodes) != 1 {
+		t.Fatalf("Expected 1 deployed chaincode but got %d", len(res.Chaincodes))
+	}
+	if res.Chaincodes[0].ChaincodeID.Name != "MyContract1" || res.Chaincodes[0].Txid != transaction.Uuid {
+		t.Errorf("Expected chaincode MyContract1 deployed by transaction %s but got %v", transaction.Uuid, res.Chaincodes[0])
+	}
+	if res.Chaincodes[0].Status != protos.DeployedChaincode_NOT_RUNNING {
+		t.Errorf("Expected the container of MyContract1 not to be running but got %s", res.Chaincodes[0].Status)
+	}
+}
+
+func TestServerOpenchainREST_API_GetChaincodeLogs(t *testing.T) {
+	initGlobalServerOpenchain(t)
+
+	// Start the HTTP REST test server
+	httpServer := httptest.NewServer(buildOpenchainRESTRouter())
+	defer httpServer.Close()
+
+	cutil.LogChaincodeOutput("MyLoggingContract", strings.NewReader("starting\nready\nserving\n"))
+
+	var lines []*protos.ChaincodeLogEntry
+	body := performHTTPGet(t, httpServer.URL+"/chain/chaincodes/MyLoggingContract/logs?tail=2")
+	if err := json.Unmarshal(body, &lines); err != nil {
+		t.Fatalf("Invalid JSON response: %v", err)
+	}
+	if len(lines) != 2 || lines[0].Line != "ready" || lines[1].Line != "serving" {
+		t.Errorf("Expected the last 2 lines of output of MyLoggingContract, but got %v", lines)
+	}
+
+	body = performHTTPGet(t, httpServer.URL+"/chain/chaincodes/MyLoggingContract/logs?tail=x")
+	res := parseRESTResult(t, body)
+	if res.Error == "" {
+		t.Errorf("Expected an error with an invalid tail, but got none")
+	}
+}
+
 func TestServerOpenchainREST_API_GetBlockByNumber(t *testing.T) {
 	// Construct a ledger with 0 blocks.
 	ledger := ledger.InitTestLedger(t)
@@ -311,6 +419,113 @@ func TestServerOpenchainREST_API_GetTransactionByUUID(t *testing.T) {
 	}
 }
 
+func TestServerOpenchainREST_API_GetTransactionReceipt(t *testing.T) {
+	// Construct a ledger with 3 blocks, and a 4th one for which a transaction failed
+	ledger := ledger.InitTestLedger(t)
+	buildTestLedger1(ledger, t)
+	tx, err := protos.NewTransaction(protos.ChaincodeID{Name: "MyChaincode"}, generateUUID(t), "setX", []string{"{x: \"hello\"}"})
+	if err != nil {
+		t.Fatalf("Error creating NewTransaction: %s", err)
+	}
+	txResult := &protos.TransactionResult{Uuid: tx.Uuid, ErrorCode: 1, Error: "x is read-only"}
+	ledger.BeginTxBatch(3)
+	if err := ledger.CommitTxBatch(3, []*protos.Transaction{}, []*protos.TransactionResult{txResult}, []byte("dummy-proof")); err != nil {
+		t.Fatalf("Error in commit: %s", err)
+	}
+
+	initGlobalServerOpenchain(t)
+
+	// Start the HTTP REST test server
+	httpServer := httptest.NewServer(buildOpenchainRESTRouter())
+	defer httpServer.Close()
+
+	body := performHTTPGet(t, httpServer.URL+"/transactions/NON-EXISTING-UUID/receipt")
+	res := parseRESTResult(t, body)
+	if res.Error == "" {
+		t.Errorf("Expected an error when retrieving the receipt of a non-existing transaction, but got none")
+	}
+
+	body = performHTTPGet(t, httpServer.URL+"/transactions/"+tx.Uuid+"/receipt")
+	var receipt protos.TransactionReceipt
+	if err := json.Unmarshal(body, &receipt); err != nil {
+		t.Fatalf("Invalid JSON response: %v", err)
+	}
+	if receipt.Uuid != tx.Uuid || receipt.Status != protos.TransactionReceipt_FAILURE || receipt.BlockNumber != 3 || receipt.Error != txResult.Error {
+		t.Errorf("Expected the receipt of the failed transaction, but got %v", &receipt)
+	}
+}
+
+func TestServerOpenchainREST_API_GetTransactionsByChaincodeIDAndBlocksByEventName(t *testing.T) {
+	// Construct a ledger with 3 blocks, and a 4th one invoking a named chaincode which emits an event
+	ledger := ledger.InitTestLedger(t)
+	buildTestLedger1(ledger, t)
+	tx, err := protos.NewTransaction(protos.ChaincodeID{Name: "MyChaincode"}, generateUUID(t), "setX", []string{"{x: \"hello\"}"})
+	if err != nil {
+		t.Fatalf("Error creating NewTransaction: %s", err)
+	}
+	event := &protos.ChaincodeEvent{ChaincodeID: "MyChaincode", TxID: tx.Uuid, EventName: "XChanged", Attributes: []*protos.EventAttribute{{Name: "x", Value: "hello", Indexed: true}}}
+	txResult := &protos.TransactionResult{Uuid: tx.Uuid, ChaincodeEvent: event, ChaincodeEvents: []*protos.ChaincodeEvent{event}}
+	ledger.BeginTxBatch(3)
+	if err := ledger.CommitTxBatch(3, []*protos.Transaction{tx}, []*protos.TransactionResult{txResult}, []byte("dummy-proof")); err != nil {
+		t.Fatalf("Error in commit: %s", err)
+	}
+
+	initGlobalServerOpenchain(t)
+
+	// Start the HTTP REST test server
+	httpServer := httptest.NewServer(buildOpenchainRESTRouter())
+	defer httpServer.Close()
+
+	var transactions []*protos.Transaction
+	body := performHTTPGet(t, httpServer.URL+"/chain/chaincodes/MyChaincode/transactions")
+	if err := json.Unmarshal(body, &transactions); err != nil {
+		t.Fatalf("Invalid JSON response: %v", err)
+	}
+	if len(transactions) != 1 || transactions[0].Uuid != tx.Uuid {
+		t.Errorf("Expected the transaction %s of chaincode MyChaincode, but got %v", tx.Uuid, transactions)
+	}
+
+	body = performHTTPGet(t, httpServer.URL+"/chain/chaincodes/MyChaincode/transactions?startBlock=1&endBlock=2")
+	if err := json.Unmarshal(body, &transactions); err != nil {
+		t.Fatalf("Invalid JSON response: %v", err)
+	}
+	if len(transactions) != 0 {
+		t.Errorf("Expected no transaction of chaincode MyChaincode in blocks 1 to 2, but got %v", transactions)
+	}
+
+	var blockNumbers []uint64
+	body = performHTTPGet(t, httpServer.URL+"/chain/events/XChanged/blocks?startBlock=2")
+	if err := json.Unmarshal(body, &blockNumbers); err != nil {
+		t.Fatalf("Invalid JSON response: %v", err)
+	}
+	if len(blockNumbers) != 1 || blockNumbers[0] != 3 {
+		t.Errorf("Expected block 3 to have event XChanged, but got %v", blockNumbers)
+	}
+
+	body = performHTTPGet(t, httpServer.URL+"/chain/events/XChanged/blocks?attribute=x&value=hello&type=STRING")
+	if err := json.Unmarshal(body, &blockNumbers); err != nil {
+		t.Fatalf("Invalid JSON response: %v", err)
+	}
+	if len(blockNumbers) != 1 || blockNumbers[0] != 3 {
+		t.Errorf("Expected block 3 to have event XChanged with x hello, but got %v", blockNumbers)
+	}
+
+	body = performHTTPGet(t, httpServer.URL+"/chain/events/XChanged/blocks?attribute=x&value=bye")
+	if err := json.Unmarshal(body, &blockNumbers); err != nil {
+		t.Fatalf("Invalid JSON response: %v", err)
+	}
+	if len(blockNumbers) != 0 {
+		t.Errorf("Expected no block to have event XChanged with x bye, but got %v", blockNumbers)
+	}
+
+	for _, query := range []string{"?startBlock=-1", "?endBlock=x", "?startBlock=3&endBlock=2", "?attribute=x", "?attribute=x&value=1&type=FLOAT"} {
+		res := parseRESTResult(t, performHTTPGet(t, httpServer.URL+"/chain/events/XChanged/blocks"+query))
+		if res.Error == "" {
+			t.Errorf("Expected an error for the query %s, but got none", query)
+		}
+	}
+}
+
 func TestServerOpenchainREST_API_Register(t *testing.T) {
 	os.RemoveAll(getRESTFilePath())
 	initGlobalServerOpenchain(t)
@@ -685,6 +900,16 @@ func TestServerOpenchainREST_API_Chaincode_Invoke(t *testing.T) {
 		t.Errorf("Expected an error when sending non-existing chaincode path, but got %#v", res.Error)
 	}
 
+	// Test invoke while the validator is busy
+	httpResponse, body = performHTTPPost(t, httpServer.URL+"/chaincode", []byte(`{"jsonrpc":"2.0","ID":123,"method":"invoke","params":{"type":1,"chaincodeID":{"name":"dummy"},"ctorMsg":{"function":"busy","args":[]},"secureContext":"myuser"}}`))
+	if httpResponse.StatusCode != http.StatusOK {
+		t.Errorf("Expected an HTTP status code %#v but got %#v", http.StatusOK, httpResponse.StatusCode)
+	}
+	res = parseRPCResponse(t, body)
+	if res.Error == nil || res.Error.Code != ValidatorBusyError.Code {
+		t.Errorf("Expected a busy error when the validator is busy, but got %#v", res.Error)
+	}
+
 	// Test invoke with "change_owner" function
 	httpResponse, body = performHTTPPost(t, httpServer.URL+"/chaincode", []byte(`{"jsonrpc":"2.0","ID":123,"method":"invoke","params":{"type":1,"chaincodeID":{"name":"dummy"},"ctorMsg":{"function":"change_owner","args":[]},"secureContext":"myuser"}}`))
 	if httpResponse.StatusCode != http.StatusOK {
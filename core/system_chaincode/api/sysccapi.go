@@ -55,6 +55,7 @@ type SystemChaincode struct {
 
 // RegisterSysCC registers the given system chaincode with the peer
 func RegisterSysCC(syscc *SystemChaincode) error {
+	chaincode.ReserveSystemChaincodeName(syscc.Name)
 	if peer.SecurityEnabled() {
 		sysccLogger.Warning(fmt.Sprintf("Currently system chaincode does support security(%s,%s)", syscc.Name, syscc.Path))
 		return nil
@@ -70,6 +71,7 @@ func RegisterSysCC(syscc *SystemChaincode) error {
 		sysccLogger.Error(errStr)
 		return fmt.Errorf(errStr)
 	}
+	chaincode.RegisterSystemChaincode(syscc.Name)
 
 	chaincodeID := &protos.ChaincodeID{Path: syscc.Path, Name: syscc.Name}
 	spec := protos.ChaincodeSpec{Type: protos.ChaincodeSpec_Type(protos.ChaincodeSpec_Type_value["GOLANG"]), ChaincodeID: chaincodeID, CtorMsg: &protos.ChaincodeInput{Args: syscc.InitArgs}}
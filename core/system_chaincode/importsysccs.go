@@ -20,6 +20,7 @@ import (
 	"github.com/hyperledger/fabric/core/system_chaincode/api"
 	//import system chain codes here
 	"github.com/hyperledger/fabric/bddtests/syschaincode/noop"
+	"github.com/hyperledger/fabric/core/system_chaincode/ledgerinfo"
 )
 
 //see systemchaincode_test.go for an example using "sample_syscc"
@@ -30,6 +31,13 @@ var systemChaincodes = []*api.SystemChaincode{
 		Path:      "github.com/hyperledger/fabric/bddtests/syschaincode/noop",
 		InitArgs:  []string{},
 		Chaincode: &noop.SystemChaincode{},
+	},
+	{
+		Enabled:   true,
+		Name:      "ledgerinfo",
+		Path:      "github.com/hyperledger/fabric/core/system_chaincode/ledgerinfo",
+		InitArgs:  []string{},
+		Chaincode: &ledgerinfo.LedgerInfo{},
 	}}
 
 //RegisterSysCCs is the hook for system chaincodes where system chaincodes are registered with the fabric
@@ -0,0 +1,96 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package ledgerinfo
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	"github.com/hyperledger/fabric/core/ledger"
+	"github.com/hyperledger/fabric/protos"
+)
+
+type ledgerHandler interface {
+	GetBlockchainInfo() (*protos.BlockchainInfo, error)
+	GetBlockByNumber(blockNumber uint64) (*protos.Block, error)
+	GetTransactionByUUID(txUUID string) (*protos.Transaction, error)
+}
+
+// LedgerInfo is the system chaincode answering queries on the metadata of the
+// ledger of the peer: the blockchain, its blocks and their transactions. It
+// runs in the peer and reads the ledger directly, which user chaincodes cannot
+type LedgerInfo struct {
+	// ledgerH is only set by tests, the ledger of the peer is used otherwise
+	ledgerH ledgerHandler
+}
+
+func (t *LedgerInfo) getLedger() (ledgerHandler, error) {
+	if t.ledgerH != nil {
+		return t.ledgerH, nil
+	}
+	return ledger.GetLedger()
+}
+
+// Init does nothing, the chaincode keeps no state
+func (t *LedgerInfo) Init(stub *shim.ChaincodeStub, function string, args []string) ([]byte, error) {
+	return nil, nil
+}
+
+// Invoke is not supported, the chaincode only answers queries
+func (t *LedgerInfo) Invoke(stub *shim.ChaincodeStub, function string, args []string) ([]byte, error) {
+	return nil, errors.New("ledgerinfo only supports queries")
+}
+
+// Query answers, as JSON
+//
+//	getBlockchainInfo: the height of the blockchain and the hashes of its last blocks
+//	getBlock <number>: the block of that number
+//	getTransaction <uuid>: the transaction of that uuid
+func (t *LedgerInfo) Query(stub *shim.ChaincodeStub, function string, args []string) ([]byte, error) {
+	lgr, err := t.getLedger()
+	if err != nil {
+		return nil, fmt.Errorf("Unable to get the ledger: %s", err)
+	}
+
+	var result interface{}
+	switch function {
+	case "getBlockchainInfo":
+		result, err = lgr.GetBlockchainInfo()
+	case "getBlock":
+		if len(args) != 1 {
+			return nil, errors.New("getBlock expects the block number as argument")
+		}
+		blockNumber, parseErr := strconv.ParseUint(args[0], 10, 64)
+		if parseErr != nil {
+			return nil, fmt.Errorf("Invalid block number %s: %s", args[0], parseErr)
+		}
+		result, err = lgr.GetBlockByNumber(blockNumber)
+	case "getTransaction":
+		if len(args) != 1 {
+			return nil, errors.New("getTransaction expects the transaction uuid as argument")
+		}
+		result, err = lgr.GetTransactionByUUID(args[0])
+	default:
+		return nil, fmt.Errorf("Unsupported query function %s", function)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(result)
+}
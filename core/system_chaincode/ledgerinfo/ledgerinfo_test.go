@@ -0,0 +1,106 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package ledgerinfo
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+
+	"github.com/hyperledger/fabric/protos"
+)
+
+type mockLedger struct {
+	blocks []*protos.Block
+}
+
+func (ml mockLedger) GetBlockchainInfo() (*protos.BlockchainInfo, error) {
+	return &protos.BlockchainInfo{Height: uint64(len(ml.blocks)), CurrentBlockHash: []byte("hash")}, nil
+}
+
+func (ml mockLedger) GetBlockByNumber(blockNumber uint64) (*protos.Block, error) {
+	if blockNumber >= uint64(len(ml.blocks)) {
+		return nil, fmt.Errorf("No block %d", blockNumber)
+	}
+	return ml.blocks[blockNumber], nil
+}
+
+func (ml mockLedger) GetTransactionByUUID(txUUID string) (*protos.Transaction, error) {
+	for _, block := range ml.blocks {
+		for _, tx := range block.Transactions {
+			if tx.Uuid == txUUID {
+				return tx, nil
+			}
+		}
+	}
+	return nil, fmt.Errorf("No transaction %s", txUUID)
+}
+
+func newLedgerInfo() *LedgerInfo {
+	tx := &protos.Transaction{Uuid: "tx1"}
+	return &LedgerInfo{mockLedger{[]*protos.Block{{}, {Transactions: []*protos.Transaction{tx}}}}}
+}
+
+func TestQueryBlockchainInfo(t *testing.T) {
+	res, err := newLedgerInfo().Query(nil, "getBlockchainInfo", nil)
+	if err != nil {
+		t.Fatalf("Error querying the blockchain info: %s", err)
+	}
+	info := &protos.BlockchainInfo{}
+	if err = json.Unmarshal(res, info); err != nil {
+		t.Fatalf("Error unmarshalling the blockchain info: %s", err)
+	}
+	if info.Height != 2 || string(info.CurrentBlockHash) != "hash" {
+		t.Errorf("Unexpected blockchain info %v", info)
+	}
+}
+
+func TestQueryBlockAndTransaction(t *testing.T) {
+	li := newLedgerInfo()
+	res, err := li.Query(nil, "getBlock", []string{"1"})
+	if err != nil {
+		t.Fatalf("Error querying block 1: %s", err)
+	}
+	block := &protos.Block{}
+	if err = json.Unmarshal(res, block); err != nil || len(block.Transactions) != 1 {
+		t.Errorf("Expected block 1 with one transaction, got %s (%v)", res, err)
+	}
+	if _, err = li.Query(nil, "getBlock", []string{"one"}); err == nil {
+		t.Errorf("Expected an error querying a block with an invalid number")
+	}
+	if _, err = li.Query(nil, "getBlock", []string{"2"}); err == nil {
+		t.Errorf("Expected an error querying a block beyond the blockchain")
+	}
+
+	res, err = li.Query(nil, "getTransaction", []string{"tx1"})
+	if err != nil {
+		t.Fatalf("Error querying transaction tx1: %s", err)
+	}
+	tx := &protos.Transaction{}
+	if err = json.Unmarshal(res, tx); err != nil || tx.Uuid != "tx1" {
+		t.Errorf("Expected transaction tx1, got %s (%v)", res, err)
+	}
+}
+
+func TestUnsupported(t *testing.T) {
+	li := newLedgerInfo()
+	if _, err := li.Invoke(nil, "getBlockchainInfo", nil); err == nil {
+		t.Errorf("Expected invocations to be refused")
+	}
+	if _, err := li.Query(nil, "getState", nil); err == nil {
+		t.Errorf("Expected an error querying an unsupported function")
+	}
+}
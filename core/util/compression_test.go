@@ -0,0 +1,49 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package util
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestGzipCompression(t *testing.T) {
+	data := bytes.Repeat([]byte(`{"owner":"alice","amount":100}`), 100)
+	compressed, err := GzipCompress(data)
+	if err != nil {
+		t.Fatalf("Error compressing: %s", err)
+	}
+	if len(compressed) >= len(data) {
+		t.Fatalf("Expected the data to be compressed, got %d bytes from %d", len(compressed), len(data))
+	}
+	if !IsGzipCompressed(compressed) {
+		t.Fatalf("Expected the compressed data to be recognized as compressed")
+	}
+	if IsGzipCompressed(data) {
+		t.Fatalf("Expected the data not to be recognized as compressed")
+	}
+	decompressed, err := GzipDecompress(compressed)
+	if err != nil {
+		t.Fatalf("Error decompressing: %s", err)
+	}
+	if !bytes.Equal(decompressed, data) {
+		t.Fatalf("Decompressed data differs from the original data")
+	}
+	if _, err := GzipDecompress(data); err == nil {
+		t.Fatalf("Expected an error decompressing data which is not compressed")
+	}
+}
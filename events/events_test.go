@@ -48,6 +48,7 @@ func (a *Adapter) GetInterestedEvents() ([]*ehpb.Interest, error) {
 		&ehpb.Interest{EventType: ehpb.EventType_BLOCK},
 		&ehpb.Interest{EventType: ehpb.EventType_CHAINCODE, RegInfo: &ehpb.Interest_ChaincodeRegInfo{ChaincodeRegInfo: &ehpb.ChaincodeReg{ChaincodeID: "0xffffffff", EventName: "event1"}}},
 		&ehpb.Interest{EventType: ehpb.EventType_CHAINCODE, RegInfo: &ehpb.Interest_ChaincodeRegInfo{ChaincodeRegInfo: &ehpb.ChaincodeReg{ChaincodeID: "0xffffffff", EventName: ""}}},
+		&ehpb.Interest{EventType: ehpb.EventType_CHAINCODE, RegInfo: &ehpb.Interest_ChaincodeRegInfo{ChaincodeRegInfo: &ehpb.ChaincodeReg{ChaincodeID: "0xeeeeeeee", EventName: "transfer", Attributes: []*ehpb.EventAttribute{ownerAttribute("alice")}}}},
 	}, nil
 	//return []*ehpb.Interest{&ehpb.Interest{EventType: ehpb.EventType_BLOCK}}, nil
 }
@@ -90,6 +91,10 @@ func createTestChaincodeEvent(tid string, typ string) *ehpb.Event {
 	return emsg
 }
 
+func ownerAttribute(owner string) *ehpb.EventAttribute {
+	return &ehpb.EventAttribute{Name: "owner", Type: ehpb.EventAttribute_STRING, Value: owner, Indexed: true}
+}
+
 func closeListenerAndSleep(l net.Listener) {
 	l.Close()
 	time.Sleep(2 * time.Second)
@@ -163,6 +168,38 @@ func TestFailReceive(t *testing.T) {
 	}
 }
 
+func TestReceiveFilteredByAttributes(t *testing.T) {
+	var err error
+
+	adapter.count = 1
+	emsg := producer.CreateChaincodeEvent(&ehpb.ChaincodeEvent{ChaincodeID: "0xeeeeeeee", EventName: "transfer", Attributes: []*ehpb.EventAttribute{ownerAttribute("bob")}})
+	if err = producer.Send(emsg); err != nil {
+		t.Fail()
+		t.Logf("Error sending message %s", err)
+	}
+
+	select {
+	case <-adapter.notfy:
+		t.Fail()
+		t.Logf("should NOT have received the event of another owner")
+	case <-time.After(2 * time.Second):
+	}
+
+	amount := &ehpb.EventAttribute{Name: "amount", Type: ehpb.EventAttribute_INTEGER, Value: "10"}
+	emsg = producer.CreateChaincodeEvent(&ehpb.ChaincodeEvent{ChaincodeID: "0xeeeeeeee", EventName: "transfer", Attributes: []*ehpb.EventAttribute{amount, ownerAttribute("alice")}})
+	if err = producer.Send(emsg); err != nil {
+		t.Fail()
+		t.Logf("Error sending message %s", err)
+	}
+
+	select {
+	case <-adapter.notfy:
+	case <-time.After(5 * time.Second):
+		t.Fail()
+		t.Logf("timed out on messge")
+	}
+}
+
 func BenchmarkMessages(b *testing.B) {
 	numMessages := 10000
 
@@ -34,3 +34,8 @@ func CreateChaincodeEvent(te *ehpb.ChaincodeEvent) *ehpb.Event {
 func CreateRejectionEvent(tx *ehpb.Transaction, errorMsg string) *ehpb.Event {
 	return &ehpb.Event{Event: &ehpb.Event_Rejection{Rejection: &ehpb.Rejection{Tx: tx, ErrorMsg: errorMsg}}}
 }
+
+//CreateAlertEvent creates an Event alerting that a component of the peer stalled
+func CreateAlertEvent(source string, message string) *ehpb.Event {
+	return &ehpb.Event{Event: &ehpb.Event_Alert{Alert: &ehpb.Alert{Source: source, Message: message}}}
+}
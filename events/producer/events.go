@@ -48,8 +48,9 @@ type genericHandlerList struct {
 
 type chaincodeHandlerList struct {
 	sync.RWMutex
-	// this map used as a list - add/del/iterate
-	handlers map[string]map[string]map[*handler]bool
+	// this map used as a list - add/del/iterate. A handler maps to the
+	// attributes the events it registered for must have
+	handlers map[string]map[string]map[*handler][]*pb.EventAttribute
 }
 
 func (hl *chaincodeHandlerList) add(ie *pb.Interest, h *handler) (bool, error) {
@@ -67,21 +68,21 @@ func (hl *chaincodeHandlerList) add(ie *pb.Interest, h *handler) (bool, error) {
 	//is there a event type map for the chaincode
 	emap, ok := hl.handlers[ie.GetChaincodeRegInfo().ChaincodeID]
 	if !ok {
-		emap = make(map[string]map[*handler]bool)
+		emap = make(map[string]map[*handler][]*pb.EventAttribute)
 		hl.handlers[ie.GetChaincodeRegInfo().ChaincodeID] = emap
 	}
 
 	//create handler map if this is the first handler for the type
-	var handlerMap map[*handler]bool
+	var handlerMap map[*handler][]*pb.EventAttribute
 	if handlerMap, _ = emap[ie.GetChaincodeRegInfo().EventName]; handlerMap == nil {
-		handlerMap = make(map[*handler]bool)
+		handlerMap = make(map[*handler][]*pb.EventAttribute)
 		emap[ie.GetChaincodeRegInfo().EventName] = handlerMap
 	} else if _, ok = handlerMap[h]; ok {
 		return false, fmt.Errorf("handler exists for event type")
 	}
 
-	//the handler is added to the map
-	handlerMap[h] = true
+	//the handler is added to the map, with the attributes it filters the events by
+	handlerMap[h] = ie.GetChaincodeRegInfo().Attributes
 
 	return true, nil
 }
@@ -106,7 +107,7 @@ func (hl *chaincodeHandlerList) del(ie *pb.Interest, h *handler) (bool, error) {
 	}
 
 	//if there are no handlers for the event type, nothing to do
-	var handlerMap map[*handler]bool
+	var handlerMap map[*handler][]*pb.EventAttribute
 	if handlerMap, _ = emap[ie.GetChaincodeRegInfo().EventName]; handlerMap == nil {
 		return false, fmt.Errorf("event name %s not registered for chaincode ID %s", ie.GetChaincodeRegInfo().EventName, ie.GetChaincodeRegInfo().ChaincodeID)
 	} else if _, ok = handlerMap[h]; !ok {
@@ -144,22 +145,44 @@ func (hl *chaincodeHandlerList) foreach(e *pb.Event, action func(h *handler)) {
 	if emap := hl.handlers[e.GetChaincodeEvent().ChaincodeID]; emap != nil {
 		//get the handler map for the event
 		if handlerMap := emap[e.GetChaincodeEvent().EventName]; handlerMap != nil {
-			for h := range handlerMap {
-				action(h)
+			for h, filter := range handlerMap {
+				if hasAttributes(e.GetChaincodeEvent(), filter) {
+					action(h)
+				}
 			}
 		}
 		//send to handlers who want all events from the chaincode, but only if
 		//EventName is not already "" (chaincode should NOT send nameless events though)
 		if e.GetChaincodeEvent().EventName != "" {
 			if handlerMap := emap[""]; handlerMap != nil {
-				for h := range handlerMap {
-					action(h)
+				for h, filter := range handlerMap {
+					if hasAttributes(e.GetChaincodeEvent(), filter) {
+						action(h)
+					}
 				}
 			}
 		}
 	}
 }
 
+//hasAttributes returns whether the event has each of the attributes, of the
+//same type and value
+func hasAttributes(ccevent *pb.ChaincodeEvent, attributes []*pb.EventAttribute) bool {
+	for _, attribute := range attributes {
+		found := false
+		for _, a := range ccevent.Attributes {
+			if a.Name == attribute.Name && a.Type == attribute.Type && a.Value == attribute.Value {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
 func (hl *genericHandlerList) add(ie *pb.Interest, h *handler) (bool, error) {
 	hl.Lock()
 	if _, ok := hl.handlers[h]; ok {
@@ -266,9 +289,11 @@ func AddEventType(eventType pb.EventType) error {
 	case pb.EventType_BLOCK:
 		gEventProcessor.eventConsumers[eventType] = &genericHandlerList{handlers: make(map[*handler]bool)}
 	case pb.EventType_CHAINCODE:
-		gEventProcessor.eventConsumers[eventType] = &chaincodeHandlerList{handlers: make(map[string]map[string]map[*handler]bool)}
+		gEventProcessor.eventConsumers[eventType] = &chaincodeHandlerList{handlers: make(map[string]map[string]map[*handler][]*pb.EventAttribute)}
 	case pb.EventType_REJECTION:
 		gEventProcessor.eventConsumers[eventType] = &genericHandlerList{handlers: make(map[*handler]bool)}
+	case pb.EventType_ALERT:
+		gEventProcessor.eventConsumers[eventType] = &genericHandlerList{handlers: make(map[*handler]bool)}
 	}
 	gEventProcessor.Unlock()
 
@@ -22,12 +22,15 @@ import (
 	"errors"
 	"fmt"
 	"google/protobuf"
+	"io"
 	"io/ioutil"
+	"math"
 	"net"
 	"os"
 	"os/signal"
 	"path/filepath"
 	"runtime"
+	"sort"
 	"strconv"
 	"strings"
 	"sync"
@@ -47,12 +50,16 @@ import (
 	"net/http"
 	_ "net/http/pprof"
 
+	"github.com/hyperledger/fabric/consensus/bench"
 	"github.com/hyperledger/fabric/consensus/helper"
 	"github.com/hyperledger/fabric/core"
 	"github.com/hyperledger/fabric/core/chaincode"
 	"github.com/hyperledger/fabric/core/comm"
 	"github.com/hyperledger/fabric/core/crypto"
+	"github.com/hyperledger/fabric/core/db"
+	"github.com/hyperledger/fabric/core/ledger"
 	"github.com/hyperledger/fabric/core/ledger/genesis"
+	"github.com/hyperledger/fabric/core/ledger/statemgmt/buckettree"
 	"github.com/hyperledger/fabric/core/peer"
 	"github.com/hyperledger/fabric/core/rest"
 	"github.com/hyperledger/fabric/core/system_chaincode"
@@ -131,6 +138,127 @@ var nodeStatusCmd = &cobra.Command{
 	},
 }
 
+var nodeConsensusStateCmd = &cobra.Command{
+	Use:   "consensus",
+	Short: "Returns the consensus state of the node.",
+	Long:  `Returns the internal state of the consensus plugin of the running validating node, for debugging.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		consensusState()
+	},
+}
+
+var nodeHealthCmd = &cobra.Command{
+	Use:   "health",
+	Short: "Returns the consensus health of the node.",
+	Long:  `Returns the health and metrics of the consensus plugin of the running validating node.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return consensusHealth()
+	},
+}
+
+var nodeDBStatsCmd = &cobra.Command{
+	Use:   "dbstats",
+	Short: "Returns the statistics of the ledger database of the node.",
+	Long:  `Returns the statistics of the database the running node keeps its ledger in, such as the compaction backlog and the block cache hit rate of RocksDB, to diagnose stalls of the ledger I/O.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return dbStats()
+	},
+}
+
+var nodeGCCmd = &cobra.Command{
+	Use:   "gc",
+	Short: "Collects the garbage of the ledger database of the node.",
+	Long:  `Removes the rows of the ledger database of the running node which no block refers to any longer, such as the blocks and indexes left above the head by aborted commits and the state deltas older than those kept, and reports the space reclaimed by column family.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return collectGarbage()
+	},
+}
+
+var nodeSwitchConsensusCmd = &cobra.Command{
+	Use:   "switch-consensus <plugin> <height>",
+	Short: "Switches the consensus plugin of the node.",
+	Long:  `Switches the running validating node to another consensus plugin once the blockchain reaches a height. Run it on every validator with the same height.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return switchConsensus(args)
+	},
+}
+
+var nodeClientLimitCmd = &cobra.Command{
+	Use:   "client-limit <client> <rate|default> [burst]",
+	Short: "Limits the transaction rate of a client.",
+	Long:  `Overrides the transactions per second a client may submit to the running validating node, and the burst it may submit at once, until the node restarts. A rate of 0 lifts the limit, default restores the configured limits.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return clientLimit(args)
+	},
+}
+
+var nodeExportCmd = &cobra.Command{
+	Use:   "export <file>",
+	Short: "Exports a snapshot of the ledger.",
+	Long:  `Writes a snapshot of the ledger of the running node to a new file on its host, holding the blocks, their indexes, the state deltas and the state as of the last block committed. A new node is bootstrapped from it with import.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return exportSnapshot(args)
+	},
+}
+
+var nodeImportCmd = &cobra.Command{
+	Use:   "import <file>",
+	Short: "Bootstraps the ledger from a snapshot.",
+	Long:  `Imports a snapshot written by export into the empty ledger of this node, which must not be running. The state must hash to the state hash of the last block and the hash chain of the blocks must verify, otherwise nothing is imported. The node syncs the blocks committed since the snapshot once started.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return importSnapshot(args)
+	},
+}
+
+var nodeFetchCmd = &cobra.Command{
+	Use:   "fetch <peerAddress> [height]",
+	Short: "Bootstraps the ledger from a checkpoint snapshot of another peer.",
+	Long:  `Imports the checkpoint snapshot at height, the last one by default, of the peer at peerAddress into the empty ledger of this node, which must not be running, as import does. The peer must write checkpoint snapshots, see ledger.snapshots in core.yaml. The node syncs the blocks committed since the snapshot once started.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return fetchSnapshot(args)
+	},
+}
+
+var nodeVerifyCmd = &cobra.Command{
+	Use:   "verify [from] [to]",
+	Short: "Verifies the integrity of the ledger.",
+	Long:  `Verifies that the hash of each block between from and to of the running node is recorded by the next block, and that its state hash is that of the state rolled back to it by the state deltas kept. The whole blockchain is verified by default. The first divergence found from to down is reported.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return verifyChain(args)
+	},
+}
+
+var nodeMigrateStateCmd = &cobra.Command{
+	Use:   "migrate-state <numBuckets> <maxGroupingAtEachLevel>",
+	Short: "Migrates the state to another bucket tree configuration.",
+	Long:  `Rebuilds the bucket tree of the state of this node, which must not be running, for the numBuckets and maxGroupingAtEachLevel given, and checks its hash against the one recomputed from all the keys. ledger.state.dataStructure.configs must be set to them before starting the node. As the state hash changes, all the validating peers of the network must migrate, and the state hashes recorded by the blocks committed before no longer verify. Back up the database beforehand, a failed migration leaves the state incomplete.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return migrateState(args)
+	},
+}
+
+var (
+	benchPlugin        string
+	benchN             []int
+	benchBatchSizes    []int
+	benchBatchTimeouts []string
+	benchTransactions  int
+	benchWarmup        int
+	benchRate          float64
+	benchWindow        int
+	benchPayloadSize   int
+	benchTimeout       time.Duration
+)
+
+var nodeBenchCmd = &cobra.Command{
+	Use:   "bench",
+	Short: "Benchmarks a consensus plugin.",
+	Long:  `Runs a cluster of validators in process for every combination of the cluster sizes, batch sizes and batch timeouts given, drives transactions against it and reports the throughput and the commit latency percentiles of each.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return benchmark(args)
+	},
+}
+
 var (
 	stopPidFile string
 )
@@ -205,7 +333,13 @@ var (
 	chaincodeUsr            string
 	chaincodeQueryRaw       bool
 	chaincodeQueryHex       bool
+	chaincodeQueryTentative bool
 	chaincodeAttributesJSON string
+	chaincodePolicyJSON     string
+	chaincodeExecEnv        string
+	chaincodeEncryptCtor    bool
+	chaincodeLogsTail       int
+	chaincodeLogsFollow     bool
 	customIDGenAlg          string
 )
 
@@ -253,6 +387,24 @@ var chaincodeQueryCmd = &cobra.Command{
 	},
 }
 
+var chaincodeListCmd = &cobra.Command{
+	Use:   "list",
+	Short: fmt.Sprintf("List the %ss deployed.", chainFuncName),
+	Long:  fmt.Sprintf(`List the %ss deployed to the chain, one per line, with their deploy transaction, the status of their container on the running node, their type, execution environment, build digest and path.`, chainFuncName),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return chaincodeList()
+	},
+}
+
+var chaincodeLogsCmd = &cobra.Command{
+	Use:   "logs",
+	Short: fmt.Sprintf("Show the output of the specified %s.", chainFuncName),
+	Long:  fmt.Sprintf(`Show the lines the running node kept of the stdout and stderr of the specified %s and, with --follow, the lines it writes next.`, chainFuncName),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return chaincodeLogs()
+	},
+}
+
 func main() {
 	// For environment variables.
 	viper.SetEnvPrefix(cmdRoot)
@@ -298,6 +450,29 @@ func main() {
 
 	nodeCmd.AddCommand(nodeStartCmd)
 	nodeCmd.AddCommand(nodeStatusCmd)
+	nodeCmd.AddCommand(nodeConsensusStateCmd)
+	nodeCmd.AddCommand(nodeHealthCmd)
+	nodeCmd.AddCommand(nodeDBStatsCmd)
+	nodeCmd.AddCommand(nodeGCCmd)
+	nodeCmd.AddCommand(nodeSwitchConsensusCmd)
+	nodeCmd.AddCommand(nodeClientLimitCmd)
+	nodeCmd.AddCommand(nodeExportCmd)
+	nodeCmd.AddCommand(nodeImportCmd)
+	nodeCmd.AddCommand(nodeFetchCmd)
+	nodeCmd.AddCommand(nodeVerifyCmd)
+	nodeCmd.AddCommand(nodeMigrateStateCmd)
+
+	nodeBenchCmd.Flags().StringVar(&benchPlugin, "plugin", "pbft", fmt.Sprintf("Consensus plugin to benchmark, one of %s", strings.Join(bench.Plugins(), ", ")))
+	nodeBenchCmd.Flags().IntSliceVar(&benchN, "n", []int{4}, "Cluster sizes to sweep")
+	nodeBenchCmd.Flags().IntSliceVar(&benchBatchSizes, "batchsize", []int{10, 100, 500}, "Batch sizes to sweep")
+	nodeBenchCmd.Flags().StringSliceVar(&benchBatchTimeouts, "batchtimeout", []string{"10ms", "100ms"}, "Batch timeouts to sweep, for the plugins which have one")
+	nodeBenchCmd.Flags().IntVar(&benchTransactions, "transactions", 5000, "Transactions measured per run")
+	nodeBenchCmd.Flags().IntVar(&benchWarmup, "warmup", 500, "Transactions committed before measuring")
+	nodeBenchCmd.Flags().Float64Var(&benchRate, "rate", 0, "Transactions submitted per second, 0 to keep --window transactions outstanding")
+	nodeBenchCmd.Flags().IntVar(&benchWindow, "window", 1000, "Transactions outstanding at most when --rate is 0")
+	nodeBenchCmd.Flags().IntVar(&benchPayloadSize, "payload", 100, "Bytes of payload of each transaction")
+	nodeBenchCmd.Flags().DurationVar(&benchTimeout, "timeout", time.Minute, "Time a run may take before the benchmark is given up")
+	nodeCmd.AddCommand(nodeBenchCmd)
 
 	nodeStopCmd.Flags().StringVar(&stopPidFile, "stop-peer-pid-file", viper.GetString("peer.fileSystemPath"), "Location of peer pid local file, for forces kill")
 	nodeCmd.AddCommand(nodeStopCmd)
@@ -319,17 +494,25 @@ func main() {
 	chaincodeCmd.PersistentFlags().StringVarP(&chaincodeLang, "lang", "l", "golang", fmt.Sprintf("Language the %s is written in", chainFuncName))
 	chaincodeCmd.PersistentFlags().StringVarP(&chaincodeCtorJSON, "ctor", "c", "{}", fmt.Sprintf("Constructor message for the %s in JSON format", chainFuncName))
 	chaincodeCmd.PersistentFlags().StringVarP(&chaincodeAttributesJSON, "attributes", "a", "[]", fmt.Sprintf("User attributes for the %s in JSON format", chainFuncName))
+	chaincodeCmd.PersistentFlags().StringVarP(&chaincodePolicyJSON, "policy", "", "", fmt.Sprintf("Invocation policy of the %s in JSON format, set on deploy, or replacing the current policy on invoke", chainFuncName))
+	chaincodeCmd.PersistentFlags().StringVarP(&chaincodeExecEnv, "execenv", "", "docker", fmt.Sprintf("Environment the %s runs in, docker or process, set on deploy", chainFuncName))
 	chaincodeCmd.PersistentFlags().StringVarP(&chaincodePath, "path", "p", undefinedParamValue, fmt.Sprintf("Path to %s", chainFuncName))
 	chaincodeCmd.PersistentFlags().StringVarP(&chaincodeName, "name", "n", undefinedParamValue, fmt.Sprintf("Name of the chaincode returned by the deploy transaction"))
 	chaincodeCmd.PersistentFlags().StringVarP(&chaincodeUsr, "username", "u", undefinedParamValue, fmt.Sprintf("Username for chaincode operations when security is enabled"))
 	chaincodeCmd.PersistentFlags().StringVarP(&customIDGenAlg, "tid", "t", undefinedParamValue, fmt.Sprintf("Name of a custom ID generation algorithm (hashing and decoding) e.g. sha256base64"))
 
+	chaincodeDeployCmd.Flags().BoolVarP(&chaincodeEncryptCtor, "encryptctor", "", false, "If true, encrypt the constructor message so only the validators can read it. Requires security to be enabled")
 	chaincodeQueryCmd.Flags().BoolVarP(&chaincodeQueryRaw, "raw", "r", false, "If true, output the query value as raw bytes, otherwise format as a printable string")
 	chaincodeQueryCmd.Flags().BoolVarP(&chaincodeQueryHex, "hex", "x", false, "If true, output the query value byte array in hexadecimal. Incompatible with --raw")
+	chaincodeQueryCmd.Flags().BoolVarP(&chaincodeQueryTentative, "tentative", "", false, "If true, the query also reads the changes of the transactions of the batch in progress, before they are committed")
+	chaincodeLogsCmd.Flags().IntVarP(&chaincodeLogsTail, "tail", "", 0, "Number of the last lines to show, all the lines kept if 0")
+	chaincodeLogsCmd.Flags().BoolVarP(&chaincodeLogsFollow, "follow", "f", false, "If true, keep showing the lines the chaincode writes")
 
 	chaincodeCmd.AddCommand(chaincodeDeployCmd)
 	chaincodeCmd.AddCommand(chaincodeInvokeCmd)
 	chaincodeCmd.AddCommand(chaincodeQueryCmd)
+	chaincodeCmd.AddCommand(chaincodeListCmd)
+	chaincodeCmd.AddCommand(chaincodeLogsCmd)
 
 	mainCmd.AddCommand(chaincodeCmd)
 
@@ -518,7 +701,16 @@ func serve(args []string) error {
 	pb.RegisterPeerServer(grpcServer, peerServer)
 
 	// Register the Admin server
-	pb.RegisterAdminServer(grpcServer, core.NewAdminServer())
+	serverAdmin := core.NewAdminServer()
+	if peer.ValidatorEnabled() {
+		serverAdmin.SetConsensusStateFunc(helper.DumpConsensusState)
+		serverAdmin.SetConsensusReloadFunc(helper.ReloadConsensusConfig)
+		serverAdmin.SetConsensusSwitchFunc(helper.SwitchConsensusPlugin)
+		serverAdmin.SetConsensusHealthFunc(helper.GetConsensusHealth)
+		serverAdmin.SetClientLimitFunc(helper.SetClientLimit)
+		go reloadConsensusOnHangup()
+	}
+	pb.RegisterAdminServer(grpcServer, serverAdmin)
 
 	// Register Devops server
 	serverDevops := core.NewDevopsServer(peerServer)
@@ -587,6 +779,18 @@ func serve(args []string) error {
 	return <-serve
 }
 
+// reloadConsensusOnHangup reloads the consensus configuration whenever the peer receives SIGHUP
+func reloadConsensusOnHangup() {
+	hangup := make(chan os.Signal, 1)
+	signal.Notify(hangup, syscall.SIGHUP)
+	for range hangup {
+		logger.Info("Received SIGHUP, reloading consensus configuration")
+		if err := helper.ReloadConsensusConfig(); err != nil {
+			logger.Errorf("Error reloading consensus configuration: %s", err)
+		}
+	}
+}
+
 func status() (err error) {
 	clientConn, err := peer.NewPeerClientConnection()
 	if err != nil {
@@ -609,6 +813,403 @@ func status() (err error) {
 	return nil
 }
 
+func consensusState() (err error) {
+	clientConn, err := peer.NewPeerClientConnection()
+	if err != nil {
+		logger.Infof("Error trying to connect to local peer: %s", err)
+		err = fmt.Errorf("Error trying to connect to local peer: %s", err)
+		return err
+	}
+
+	serverClient := pb.NewAdminClient(clientConn)
+
+	state, err := serverClient.GetConsensusState(context.Background(), &google_protobuf.Empty{})
+	if err != nil {
+		logger.Infof("Error trying to get consensus state from local peer: %s", err)
+		err = fmt.Errorf("Error trying to get consensus state from local peer: %s", err)
+		return err
+	}
+	fmt.Println(state.State)
+	return nil
+}
+
+func consensusHealth() (err error) {
+	clientConn, err := peer.NewPeerClientConnection()
+	if err != nil {
+		logger.Infof("Error trying to connect to local peer: %s", err)
+		err = fmt.Errorf("Error trying to connect to local peer: %s", err)
+		return err
+	}
+
+	serverClient := pb.NewAdminClient(clientConn)
+
+	health, err := serverClient.GetConsensusHealth(context.Background(), &google_protobuf.Empty{})
+	if err != nil {
+		logger.Infof("Error trying to get consensus health from local peer: %s", err)
+		err = fmt.Errorf("Error trying to get consensus health from local peer: %s", err)
+		return err
+	}
+	fmt.Printf("healthy: %t\ndetail: %s\n", health.Healthy, health.Detail)
+	names := make([]string, 0, len(health.Metrics))
+	for name := range health.Metrics {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Printf("%s: %g\n", name, health.Metrics[name])
+	}
+	return nil
+}
+
+func dbStats() (err error) {
+	clientConn, err := peer.NewPeerClientConnection()
+	if err != nil {
+		logger.Infof("Error trying to connect to local peer: %s", err)
+		err = fmt.Errorf("Error trying to connect to local peer: %s", err)
+		return err
+	}
+
+	serverClient := pb.NewAdminClient(clientConn)
+
+	stats, err := serverClient.GetLedgerDBStats(context.Background(), &google_protobuf.Empty{})
+	if err != nil {
+		logger.Infof("Error trying to get ledger database statistics from local peer: %s", err)
+		err = fmt.Errorf("Error trying to get ledger database statistics from local peer: %s", err)
+		return err
+	}
+	fmt.Printf("backend: %s\n", stats.Backend)
+	names := make([]string, 0, len(stats.Stats))
+	for name := range stats.Stats {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Printf("%s: %g\n", name, stats.Stats[name])
+	}
+	return nil
+}
+
+func collectGarbage() (err error) {
+	clientConn, err := peer.NewPeerClientConnection()
+	if err != nil {
+		logger.Infof("Error trying to connect to local peer: %s", err)
+		err = fmt.Errorf("Error trying to connect to local peer: %s", err)
+		return err
+	}
+
+	serverClient := pb.NewAdminClient(clientConn)
+
+	garbage, err := serverClient.CollectLedgerGarbage(context.Background(), &google_protobuf.Empty{})
+	if err != nil {
+		logger.Infof("Error trying to collect the ledger garbage of local peer: %s", err)
+		err = fmt.Errorf("Error trying to collect the ledger garbage of local peer: %s", err)
+		return err
+	}
+	cfs := make([]string, 0, len(garbage.Rows))
+	for cf := range garbage.Rows {
+		cfs = append(cfs, cf)
+	}
+	sort.Strings(cfs)
+	for _, cf := range cfs {
+		fmt.Printf("%s: %d rows, %d bytes\n", cf, garbage.Rows[cf], garbage.Bytes[cf])
+	}
+	if len(cfs) == 0 {
+		fmt.Println("No garbage found")
+	}
+	return nil
+}
+
+func switchConsensus(args []string) (err error) {
+	if len(args) != 2 {
+		return fmt.Errorf("Expected the plugin to switch to and the height of the blockchain to switch at")
+	}
+	height, err := strconv.ParseUint(args[1], 10, 64)
+	if err != nil {
+		return fmt.Errorf("Error parsing height %s: %s", args[1], err)
+	}
+
+	clientConn, err := peer.NewPeerClientConnection()
+	if err != nil {
+		logger.Infof("Error trying to connect to local peer: %s", err)
+		err = fmt.Errorf("Error trying to connect to local peer: %s", err)
+		return err
+	}
+
+	serverClient := pb.NewAdminClient(clientConn)
+
+	_, err = serverClient.SwitchConsensusPlugin(context.Background(), &pb.ConsensusSwitch{Plugin: args[0], Height: height})
+	if err != nil {
+		logger.Infof("Error trying to switch consensus plugin of local peer: %s", err)
+		err = fmt.Errorf("Error trying to switch consensus plugin of local peer: %s", err)
+		return err
+	}
+	fmt.Printf("Consensus plugin %s will take over at block %d\n", args[0], height)
+	return nil
+}
+
+func exportSnapshot(args []string) (err error) {
+	if len(args) != 1 {
+		return fmt.Errorf("Expected the file to export the snapshot to")
+	}
+	// the file is written by the peer, relative to its working directory
+	path, err := filepath.Abs(args[0])
+	if err != nil {
+		return fmt.Errorf("Error resolving %s: %s", args[0], err)
+	}
+
+	clientConn, err := peer.NewPeerClientConnection()
+	if err != nil {
+		logger.Infof("Error trying to connect to local peer: %s", err)
+		err = fmt.Errorf("Error trying to connect to local peer: %s", err)
+		return err
+	}
+
+	serverClient := pb.NewAdminClient(clientConn)
+
+	snapshot, err := serverClient.ExportLedgerSnapshot(context.Background(), &pb.LedgerSnapshot{Path: path})
+	if err != nil {
+		logger.Infof("Error trying to export the ledger of local peer: %s", err)
+		err = fmt.Errorf("Error trying to export the ledger of local peer: %s", err)
+		return err
+	}
+	fmt.Printf("Exported the ledger at height %d to %s\nBlock hash %x\nState hash %x\n", snapshot.Height, snapshot.Path, snapshot.BlockHash, snapshot.StateHash)
+	return nil
+}
+
+func importSnapshot(args []string) error {
+	if len(args) != 1 {
+		return fmt.Errorf("Expected the file to import the snapshot from")
+	}
+	file, err := os.Open(args[0])
+	if err != nil {
+		return fmt.Errorf("Error opening snapshot: %s", err)
+	}
+	defer file.Close()
+
+	ledger, err := ledger.GetLedger()
+	if err != nil {
+		return fmt.Errorf("Error getting ledger: %s", err)
+	}
+	defer db.GetDBHandle().Close()
+	info, err := ledger.ImportSnapshot(file)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Imported the ledger at height %d\nBlock hash %x\nState hash %x\n", info.Height, info.BlockHash, info.StateHash)
+	return nil
+}
+
+func fetchSnapshot(args []string) (err error) {
+	if len(args) < 1 || len(args) > 2 {
+		return fmt.Errorf("Expected the address of the peer to fetch the snapshot from, and optionally its height")
+	}
+	req := &pb.LedgerSnapshotRequest{}
+	if len(args) > 1 {
+		if req.Height, err = strconv.ParseUint(args[1], 10, 64); err != nil {
+			return fmt.Errorf("Invalid height %s", args[1])
+		}
+	}
+
+	clientConn, err := peer.NewPeerClientConnectionWithAddress(args[0])
+	if err != nil {
+		return fmt.Errorf("Error trying to connect to peer %s: %s", args[0], err)
+	}
+	defer clientConn.Close()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	stream, err := pb.NewOpenchainClient(clientConn).GetLedgerSnapshot(ctx, req)
+	if err != nil {
+		return fmt.Errorf("Error trying to fetch the snapshot of peer %s: %s", args[0], err)
+	}
+
+	// the chunks are imported as they are received
+	reader, writer := io.Pipe()
+	go func() {
+		for {
+			chunk, err := stream.Recv()
+			if err == io.EOF {
+				writer.Close()
+				return
+			}
+			if err != nil {
+				writer.CloseWithError(fmt.Errorf("Error receiving the snapshot of peer %s: %s", args[0], err))
+				return
+			}
+			if _, err := writer.Write(chunk.Data); err != nil {
+				return
+			}
+		}
+	}()
+	defer reader.Close()
+
+	ledger, err := ledger.GetLedger()
+	if err != nil {
+		return fmt.Errorf("Error getting ledger: %s", err)
+	}
+	defer db.GetDBHandle().Close()
+	info, err := ledger.ImportSnapshot(reader)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Imported the ledger at height %d\nBlock hash %x\nState hash %x\n", info.Height, info.BlockHash, info.StateHash)
+	return nil
+}
+
+func verifyChain(args []string) (err error) {
+	if len(args) > 2 {
+		return fmt.Errorf("Expected at most the blocks to verify from and to")
+	}
+	req := &pb.VerifyChainRequest{To: math.MaxUint64}
+	if len(args) > 0 {
+		if req.From, err = strconv.ParseUint(args[0], 10, 64); err != nil {
+			return fmt.Errorf("Invalid block number %s", args[0])
+		}
+	}
+	if len(args) > 1 {
+		if req.To, err = strconv.ParseUint(args[1], 10, 64); err != nil {
+			return fmt.Errorf("Invalid block number %s", args[1])
+		}
+	}
+
+	clientConn, err := peer.NewPeerClientConnection()
+	if err != nil {
+		logger.Infof("Error trying to connect to local peer: %s", err)
+		err = fmt.Errorf("Error trying to connect to local peer: %s", err)
+		return err
+	}
+
+	devopsClient := pb.NewDevopsClient(clientConn)
+
+	verification, err := devopsClient.VerifyChain(context.Background(), req)
+	if err != nil {
+		logger.Infof("Error trying to verify the ledger of local peer: %s", err)
+		err = fmt.Errorf("Error trying to verify the ledger of local peer: %s", err)
+		return err
+	}
+	switch verification.Divergence {
+	case pb.ChainVerification_BLOCK_HASH:
+		fmt.Printf("The hash of block %d is not the previous block hash recorded by the next block\nRecorded hash %x\nBlock hash %x\n", verification.DivergentBlock, verification.ExpectedHash, verification.ActualHash)
+	case pb.ChainVerification_STATE_HASH:
+		fmt.Printf("The state hash recorded by block %d is not the hash of the state rolled back to it\nRecorded hash %x\nState hash %x\n", verification.DivergentBlock, verification.ExpectedHash, verification.ActualHash)
+	default:
+		fmt.Printf("Verified blocks %d to %d\n", verification.From, verification.To)
+		if verification.StateVerifiedFrom <= verification.To {
+			fmt.Printf("Verified the state hashes of blocks %d to %d\n", verification.StateVerifiedFrom, verification.To)
+		} else {
+			fmt.Printf("The state deltas needed to verify the state hashes are no longer kept\n")
+		}
+		return nil
+	}
+	return fmt.Errorf("The ledger diverges at block %d", verification.DivergentBlock)
+}
+
+func migrateState(args []string) error {
+	if len(args) != 2 {
+		return fmt.Errorf("Expected the numBuckets and maxGroupingAtEachLevel to migrate the state to")
+	}
+	numBuckets, err := strconv.Atoi(args[0])
+	if err != nil || numBuckets < 2 {
+		return fmt.Errorf("Invalid numBuckets %s", args[0])
+	}
+	maxGroupingAtEachLevel, err := strconv.Atoi(args[1])
+	if err != nil || maxGroupingAtEachLevel < 2 {
+		return fmt.Errorf("Invalid maxGroupingAtEachLevel %s", args[1])
+	}
+	if name := viper.GetString("ledger.state.dataStructure.name"); name != "" && name != "buckettree" {
+		return fmt.Errorf("Only a buckettree state can be migrated, the state data structure is %s", name)
+	}
+
+	fromConfigs := viper.GetStringMap("ledger.state.dataStructure.configs")
+	toConfigs := make(map[string]interface{})
+	for name, value := range fromConfigs {
+		toConfigs[name] = value
+	}
+	toConfigs[buckettree.ConfigNumBuckets] = numBuckets
+	toConfigs[buckettree.ConfigMaxGroupingAtEachLevel] = maxGroupingAtEachLevel
+
+	openchainDB := db.GetDBHandle()
+	defer openchainDB.Close()
+	stateHash, err := buckettree.Migrate(openchainDB, fromConfigs, toConfigs)
+	if err != nil {
+		return fmt.Errorf("Error migrating the state: %s", err)
+	}
+	fmt.Printf("Migrated the state to numBuckets %d and maxGroupingAtEachLevel %d\nState hash %x\n", numBuckets, maxGroupingAtEachLevel, stateHash)
+	return nil
+}
+
+func benchmark(args []string) error {
+	if len(args) != 0 {
+		return fmt.Errorf("Expected no arguments, the benchmark is configured with flags")
+	}
+	config := bench.Config{
+		Plugin:       benchPlugin,
+		N:            benchN,
+		BatchSizes:   benchBatchSizes,
+		Transactions: benchTransactions,
+		Warmup:       benchWarmup,
+		Rate:         benchRate,
+		Window:       benchWindow,
+		PayloadSize:  benchPayloadSize,
+		Timeout:      benchTimeout,
+	}
+	for _, raw := range benchBatchTimeouts {
+		timeout, err := time.ParseDuration(raw)
+		if err != nil {
+			return fmt.Errorf("Error parsing batch timeout %s: %s", raw, err)
+		}
+		config.BatchTimeouts = append(config.BatchTimeouts, timeout)
+	}
+
+	// the replicas would otherwise log every batch they order
+	logging.SetLevel(logging.WARNING, "")
+	results, err := bench.Run(config)
+	if len(results) > 0 {
+		bench.WriteResults(os.Stdout, results)
+	}
+	return err
+}
+
+func clientLimit(args []string) (err error) {
+	if len(args) < 2 || len(args) > 3 {
+		return fmt.Errorf("Expected the client, its rate and optionally its burst")
+	}
+	limit := &pb.ClientLimit{Client: args[0], Rate: -1}
+	if args[1] != "default" {
+		if limit.Rate, err = strconv.ParseFloat(args[1], 64); err != nil || limit.Rate < 0 {
+			return fmt.Errorf("Error parsing rate %s, expected a non-negative number or default", args[1])
+		}
+	}
+	if len(args) == 3 {
+		burst, err := strconv.ParseInt(args[2], 10, 32)
+		if err != nil || burst < 0 {
+			return fmt.Errorf("Error parsing burst %s, expected a non-negative number", args[2])
+		}
+		limit.Burst = int32(burst)
+	}
+
+	clientConn, err := peer.NewPeerClientConnection()
+	if err != nil {
+		logger.Infof("Error trying to connect to local peer: %s", err)
+		err = fmt.Errorf("Error trying to connect to local peer: %s", err)
+		return err
+	}
+
+	serverClient := pb.NewAdminClient(clientConn)
+
+	_, err = serverClient.SetClientLimit(context.Background(), limit)
+	if err != nil {
+		logger.Infof("Error trying to set the client limit of local peer: %s", err)
+		err = fmt.Errorf("Error trying to set the client limit of local peer: %s", err)
+		return err
+	}
+	if limit.Rate < 0 {
+		fmt.Printf("Client %s is limited as configured\n", limit.Client)
+	} else {
+		fmt.Printf("Client %s is limited to %g transactions per second\n", limit.Client, limit.Rate)
+	}
+	return nil
+}
+
 func stop() (err error) {
 	clientConn, err := peer.NewPeerClientConnection()
 	if err != nil {
@@ -811,9 +1412,33 @@ func checkChaincodeCmdParams(cmd *cobra.Command) (err error) {
 		}
 	}
 
+	_, err = getInvocationPolicy()
+
 	return
 }
 
+// getExecEnv returns the execution environment given with the execenv flag
+func getExecEnv() (pb.ChaincodeDeploymentSpec_ExecutionEnvironment, error) {
+	execEnv, ok := pb.ChaincodeDeploymentSpec_ExecutionEnvironment_value[strings.ToUpper(chaincodeExecEnv)]
+	if !ok || execEnv == int32(pb.ChaincodeDeploymentSpec_SYSTEM) {
+		return pb.ChaincodeDeploymentSpec_DOCKER, fmt.Errorf("Unknown execution environment %s, expected docker or process", chaincodeExecEnv)
+	}
+	return pb.ChaincodeDeploymentSpec_ExecutionEnvironment(execEnv), nil
+}
+
+// getInvocationPolicy returns the invocation policy given with the policy
+// flag, or nil if none was given
+func getInvocationPolicy() (*pb.InvocationPolicy, error) {
+	if chaincodePolicyJSON == "" {
+		return nil, nil
+	}
+	policy := &pb.InvocationPolicy{}
+	if err := json.Unmarshal([]byte(chaincodePolicyJSON), policy); err != nil {
+		return nil, fmt.Errorf("Chaincode policy error: %s", err)
+	}
+	return policy, nil
+}
+
 func getDevopsClient(cmd *cobra.Command) (pb.DevopsClient, error) {
 	clientConn, err := peer.NewPeerClientConnection()
 	if err != nil {
@@ -850,7 +1475,14 @@ func chaincodeDeploy(cmd *cobra.Command, args []string) (err error) {
 
 	chaincodeLang = strings.ToUpper(chaincodeLang)
 	spec := &pb.ChaincodeSpec{Type: pb.ChaincodeSpec_Type(pb.ChaincodeSpec_Type_value[chaincodeLang]),
-		ChaincodeID: &pb.ChaincodeID{Path: chaincodePath, Name: chaincodeName}, CtorMsg: input, Attributes: attributes}
+		ChaincodeID: &pb.ChaincodeID{Path: chaincodePath, Name: chaincodeName}, CtorMsg: input, Attributes: attributes,
+		EncryptCtorMsg: chaincodeEncryptCtor}
+	if spec.InvocationPolicy, err = getInvocationPolicy(); err != nil {
+		return
+	}
+	if spec.ExecEnv, err = getExecEnv(); err != nil {
+		return
+	}
 
 	// If security is enabled, add client login token
 	if core.SecurityEnabled() {
@@ -956,6 +1588,11 @@ func chaincodeInvokeOrQuery(cmd *cobra.Command, args []string, invoke bool) (err
 	chaincodeLang = strings.ToUpper(chaincodeLang)
 	spec := &pb.ChaincodeSpec{Type: pb.ChaincodeSpec_Type(pb.ChaincodeSpec_Type_value[chaincodeLang]),
 		ChaincodeID: &pb.ChaincodeID{Name: chaincodeName}, CtorMsg: input, Attributes: attributes}
+	if invoke {
+		if spec.InvocationPolicy, err = getInvocationPolicy(); err != nil {
+			return
+		}
+	}
 
 	// If security is enabled, add client login token
 	if core.SecurityEnabled() {
@@ -1009,6 +1646,9 @@ func chaincodeInvokeOrQuery(cmd *cobra.Command, args []string, invoke bool) (err
 	if customIDGenAlg != undefinedParamValue {
 		invocation.IdGenerationAlg = customIDGenAlg
 	}
+	if !invoke && chaincodeQueryTentative {
+		invocation.QueryLevel = pb.QueryLevel_TENTATIVE
+	}
 
 	var resp *pb.Response
 	if invoke {
@@ -1052,6 +1692,64 @@ func chaincodeInvokeOrQuery(cmd *cobra.Command, args []string, invoke bool) (err
 
 // Show a list of all existing network connections for the target peer node,
 // includes both validating and non-validating peers
+func chaincodeList() (err error) {
+	clientConn, err := peer.NewPeerClientConnection()
+	if err != nil {
+		err = fmt.Errorf("Error trying to connect to local peer: %s", err)
+		return
+	}
+	openchainClient := pb.NewOpenchainClient(clientConn)
+	deployed, err := openchainClient.GetDeployedChaincodes(context.Background(), &google_protobuf.Empty{})
+	if err != nil {
+		err = fmt.Errorf("Error trying to get the deployed chaincodes: %s", err)
+		return
+	}
+
+	for _, cc := range deployed.Chaincodes {
+		digest := cc.BuildDigest
+		if digest == "" {
+			digest = "-"
+		}
+		fmt.Printf("%s %s %s %s %s %s %s\n", cc.ChaincodeID.Name, cc.Txid, cc.Status, cc.Type, cc.ExecEnv, digest, cc.ChaincodeID.Path)
+	}
+	return nil
+}
+
+func chaincodeLogs() (err error) {
+	if chaincodeName == undefinedParamValue || chaincodeName == "" {
+		err = errors.New("Name not given for logs")
+		return
+	}
+	if chaincodeLogsTail < 0 {
+		err = fmt.Errorf("Invalid --tail %d", chaincodeLogsTail)
+		return
+	}
+
+	clientConn, err := peer.NewPeerClientConnection()
+	if err != nil {
+		err = fmt.Errorf("Error trying to connect to local peer: %s", err)
+		return
+	}
+	openchainClient := pb.NewOpenchainClient(clientConn)
+	req := &pb.ChaincodeLogsRequest{ChaincodeID: &pb.ChaincodeID{Name: chaincodeName}, Tail: uint32(chaincodeLogsTail), Follow: chaincodeLogsFollow}
+	stream, err := openchainClient.GetChaincodeLogs(context.Background(), req)
+	if err != nil {
+		err = fmt.Errorf("Error trying to get the output of %s: %s", chaincodeName, err)
+		return
+	}
+
+	for {
+		entry, err := stream.Recv()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("Error receiving the output of %s: %s", chaincodeName, err)
+		}
+		fmt.Println(entry.Line)
+	}
+}
+
 func networkList() (err error) {
 	clientConn, err := peer.NewPeerClientConnection()
 	if err != nil {
@@ -16,12 +16,21 @@ It is generated from these files:
 
 It has these top-level messages:
 	BlockNumber
+	BlockRange
 	BlockCount
+	LedgerSnapshotRequest
+	LedgerSnapshotChunk
 	ChaincodeEvent
+	EventAttribute
 	ChaincodeID
 	ChaincodeInput
 	ChaincodeSpec
+	ChaincodeLimits
 	ChaincodeDeploymentSpec
+	DeployedChaincode
+	DeployedChaincodes
+	ChaincodeLogsRequest
+	ChaincodeLogEntry
 	ChaincodeInvocationSpec
 	ChaincodeSecurityContext
 	ChaincodeMessage
@@ -45,9 +54,18 @@ It has these top-level messages:
 	Transaction
 	TransactionBlock
 	TransactionResult
+	TxReadWriteSet
+	ChaincodeReadWriteSet
+	KeyVersion
+	KeyRange
+	TransactionReceipt
 	Block
+	GenesisSpec
+	NetworkParameter
 	BlockchainInfo
 	NonHashData
+	CommitCertificate
+	CommitSignature
 	PeerAddress
 	PeerID
 	PeerEndpoint
@@ -90,6 +108,19 @@ func (m *BlockNumber) Reset()         { *m = BlockNumber{} }
 func (m *BlockNumber) String() string { return proto.CompactTextString(m) }
 func (*BlockNumber) ProtoMessage()    {}
 
+// Specifies the range of blocks to be returned from the blockchain, from start
+// to end (inclusive). If omitPayloads is set, the payloads of the transactions
+// are left out of the blocks.
+type BlockRange struct {
+	Start        uint64 `protobuf:"varint,1,opt,name=start" json:"start,omitempty"`
+	End          uint64 `protobuf:"varint,2,opt,name=end" json:"end,omitempty"`
+	OmitPayloads bool   `protobuf:"varint,3,opt,name=omitPayloads" json:"omitPayloads,omitempty"`
+}
+
+func (m *BlockRange) Reset()         { *m = BlockRange{} }
+func (m *BlockRange) String() string { return proto.CompactTextString(m) }
+func (*BlockRange) ProtoMessage()    {}
+
 // Specifies the current number of blocks in the blockchain.
 type BlockCount struct {
 	Count uint64 `protobuf:"varint,1,opt,name=count" json:"count,omitempty"`
@@ -99,6 +130,28 @@ func (m *BlockCount) Reset()         { *m = BlockCount{} }
 func (m *BlockCount) String() string { return proto.CompactTextString(m) }
 func (*BlockCount) ProtoMessage()    {}
 
+// Specifies the height of the checkpoint snapshot of the ledger to be
+// returned, the last one if 0.
+type LedgerSnapshotRequest struct {
+	Height uint64 `protobuf:"varint,1,opt,name=height" json:"height,omitempty"`
+}
+
+func (m *LedgerSnapshotRequest) Reset()         { *m = LedgerSnapshotRequest{} }
+func (m *LedgerSnapshotRequest) String() string { return proto.CompactTextString(m) }
+func (*LedgerSnapshotRequest) ProtoMessage()    {}
+
+// A chunk of a checkpoint snapshot of the ledger, the chunks making up the
+// snapshot in the order they are streamed. Each chunk holds the height of the
+// snapshot.
+type LedgerSnapshotChunk struct {
+	Height uint64 `protobuf:"varint,1,opt,name=height" json:"height,omitempty"`
+	Data   []byte `protobuf:"bytes,2,opt,name=data,proto3" json:"data,omitempty"`
+}
+
+func (m *LedgerSnapshotChunk) Reset()         { *m = LedgerSnapshotChunk{} }
+func (m *LedgerSnapshotChunk) String() string { return proto.CompactTextString(m) }
+func (*LedgerSnapshotChunk) ProtoMessage()    {}
+
 // Reference imports to suppress errors if they are not otherwise used.
 var _ context.Context
 var _ grpc.ClientConn
@@ -112,12 +165,24 @@ type OpenchainClient interface {
 	// GetBlockByNumber returns the data contained within a specific block in the
 	// blockchain. The genesis block is block zero.
 	GetBlockByNumber(ctx context.Context, in *BlockNumber, opts ...grpc.CallOption) (*Block, error)
+	// GetBlocksByRange streams the blocks of a range of the blockchain, in the
+	// order of the range, which may be decreasing.
+	GetBlocksByRange(ctx context.Context, in *BlockRange, opts ...grpc.CallOption) (Openchain_GetBlocksByRangeClient, error)
 	// GetBlockCount returns the current number of blocks in the blockchain data
 	// structure.
 	GetBlockCount(ctx context.Context, in *google_protobuf1.Empty, opts ...grpc.CallOption) (*BlockCount, error)
 	// GetPeers returns a list of all peer nodes currently connected to the target
 	// peer.
 	GetPeers(ctx context.Context, in *google_protobuf1.Empty, opts ...grpc.CallOption) (*PeersMessage, error)
+	// GetDeployedChaincodes returns the chaincodes deployed to the chain, with
+	// the status of their containers on the target peer.
+	GetDeployedChaincodes(ctx context.Context, in *google_protobuf1.Empty, opts ...grpc.CallOption) (*DeployedChaincodes, error)
+	// GetChaincodeLogs streams the output of a chaincode run by the target
+	// peer, its recent lines then, if requested, the lines it writes next.
+	GetChaincodeLogs(ctx context.Context, in *ChaincodeLogsRequest, opts ...grpc.CallOption) (Openchain_GetChaincodeLogsClient, error)
+	// GetLedgerSnapshot streams a checkpoint snapshot of the ledger, for a
+	// joining peer to bootstrap its ledger from.
+	GetLedgerSnapshot(ctx context.Context, in *LedgerSnapshotRequest, opts ...grpc.CallOption) (Openchain_GetLedgerSnapshotClient, error)
 }
 
 type openchainClient struct {
@@ -146,6 +211,38 @@ func (c *openchainClient) GetBlockByNumber(ctx context.Context, in *BlockNumber,
 	return out, nil
 }
 
+func (c *openchainClient) GetBlocksByRange(ctx context.Context, in *BlockRange, opts ...grpc.CallOption) (Openchain_GetBlocksByRangeClient, error) {
+	stream, err := grpc.NewClientStream(ctx, &_Openchain_serviceDesc.Streams[0], c.cc, "/protos.Openchain/GetBlocksByRange", opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &openchainGetBlocksByRangeClient{stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type Openchain_GetBlocksByRangeClient interface {
+	Recv() (*Block, error)
+	grpc.ClientStream
+}
+
+type openchainGetBlocksByRangeClient struct {
+	grpc.ClientStream
+}
+
+func (x *openchainGetBlocksByRangeClient) Recv() (*Block, error) {
+	m := new(Block)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
 func (c *openchainClient) GetBlockCount(ctx context.Context, in *google_protobuf1.Empty, opts ...grpc.CallOption) (*BlockCount, error) {
 	out := new(BlockCount)
 	err := grpc.Invoke(ctx, "/protos.Openchain/GetBlockCount", in, out, c.cc, opts...)
@@ -164,6 +261,79 @@ func (c *openchainClient) GetPeers(ctx context.Context, in *google_protobuf1.Emp
 	return out, nil
 }
 
+func (c *openchainClient) GetDeployedChaincodes(ctx context.Context, in *google_protobuf1.Empty, opts ...grpc.CallOption) (*DeployedChaincodes, error) {
+	out := new(DeployedChaincodes)
+	err := grpc.Invoke(ctx, "/protos.Openchain/GetDeployedChaincodes", in, out, c.cc, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *openchainClient) GetChaincodeLogs(ctx context.Context, in *ChaincodeLogsRequest, opts ...grpc.CallOption) (Openchain_GetChaincodeLogsClient, error) {
+	stream, err := grpc.NewClientStream(ctx, &_Openchain_serviceDesc.Streams[1], c.cc, "/protos.Openchain/GetChaincodeLogs", opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &openchainGetChaincodeLogsClient{stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type Openchain_GetChaincodeLogsClient interface {
+	Recv() (*ChaincodeLogEntry, error)
+	grpc.ClientStream
+}
+
+type openchainGetChaincodeLogsClient struct {
+	grpc.ClientStream
+}
+
+func (x *openchainGetChaincodeLogsClient) Recv() (*ChaincodeLogEntry, error) {
+	m := new(ChaincodeLogEntry)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (c *openchainClient) GetLedgerSnapshot(ctx context.Context, in *LedgerSnapshotRequest, opts ...grpc.CallOption) (Openchain_GetLedgerSnapshotClient, error) {
+	stream, err := grpc.NewClientStream(ctx, &_Openchain_serviceDesc.Streams[2], c.cc, "/protos.Openchain/GetLedgerSnapshot", opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &openchainGetLedgerSnapshotClient{stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type Openchain_GetLedgerSnapshotClient interface {
+	Recv() (*LedgerSnapshotChunk, error)
+	grpc.ClientStream
+}
+
+type openchainGetLedgerSnapshotClient struct {
+	grpc.ClientStream
+}
+
+func (x *openchainGetLedgerSnapshotClient) Recv() (*LedgerSnapshotChunk, error) {
+	m := new(LedgerSnapshotChunk)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
 // Server API for Openchain service
 
 type OpenchainServer interface {
@@ -173,12 +343,24 @@ type OpenchainServer interface {
 	// GetBlockByNumber returns the data contained within a specific block in the
 	// blockchain. The genesis block is block zero.
 	GetBlockByNumber(context.Context, *BlockNumber) (*Block, error)
+	// GetBlocksByRange streams the blocks of a range of the blockchain, in the
+	// order of the range, which may be decreasing.
+	GetBlocksByRange(*BlockRange, Openchain_GetBlocksByRangeServer) error
 	// GetBlockCount returns the current number of blocks in the blockchain data
 	// structure.
 	GetBlockCount(context.Context, *google_protobuf1.Empty) (*BlockCount, error)
 	// GetPeers returns a list of all peer nodes currently connected to the target
 	// peer.
 	GetPeers(context.Context, *google_protobuf1.Empty) (*PeersMessage, error)
+	// GetDeployedChaincodes returns the chaincodes deployed to the chain, with
+	// the status of their containers on the target peer.
+	GetDeployedChaincodes(context.Context, *google_protobuf1.Empty) (*DeployedChaincodes, error)
+	// GetChaincodeLogs streams the output of a chaincode run by the target
+	// peer, its recent lines then, if requested, the lines it writes next.
+	GetChaincodeLogs(*ChaincodeLogsRequest, Openchain_GetChaincodeLogsServer) error
+	// GetLedgerSnapshot streams a checkpoint snapshot of the ledger, for a
+	// joining peer to bootstrap its ledger from.
+	GetLedgerSnapshot(*LedgerSnapshotRequest, Openchain_GetLedgerSnapshotServer) error
 }
 
 func RegisterOpenchainServer(s *grpc.Server, srv OpenchainServer) {
@@ -209,6 +391,27 @@ func _Openchain_GetBlockByNumber_Handler(srv interface{}, ctx context.Context, d
 	return out, nil
 }
 
+func _Openchain_GetBlocksByRange_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(BlockRange)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(OpenchainServer).GetBlocksByRange(m, &openchainGetBlocksByRangeServer{stream})
+}
+
+type Openchain_GetBlocksByRangeServer interface {
+	Send(*Block) error
+	grpc.ServerStream
+}
+
+type openchainGetBlocksByRangeServer struct {
+	grpc.ServerStream
+}
+
+func (x *openchainGetBlocksByRangeServer) Send(m *Block) error {
+	return x.ServerStream.SendMsg(m)
+}
+
 func _Openchain_GetBlockCount_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error) (interface{}, error) {
 	in := new(google_protobuf1.Empty)
 	if err := dec(in); err != nil {
@@ -233,6 +436,60 @@ func _Openchain_GetPeers_Handler(srv interface{}, ctx context.Context, dec func(
 	return out, nil
 }
 
+func _Openchain_GetDeployedChaincodes_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error) (interface{}, error) {
+	in := new(google_protobuf1.Empty)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	out, err := srv.(OpenchainServer).GetDeployedChaincodes(ctx, in)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func _Openchain_GetChaincodeLogs_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(ChaincodeLogsRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(OpenchainServer).GetChaincodeLogs(m, &openchainGetChaincodeLogsServer{stream})
+}
+
+type Openchain_GetChaincodeLogsServer interface {
+	Send(*ChaincodeLogEntry) error
+	grpc.ServerStream
+}
+
+type openchainGetChaincodeLogsServer struct {
+	grpc.ServerStream
+}
+
+func (x *openchainGetChaincodeLogsServer) Send(m *ChaincodeLogEntry) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func _Openchain_GetLedgerSnapshot_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(LedgerSnapshotRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(OpenchainServer).GetLedgerSnapshot(m, &openchainGetLedgerSnapshotServer{stream})
+}
+
+type Openchain_GetLedgerSnapshotServer interface {
+	Send(*LedgerSnapshotChunk) error
+	grpc.ServerStream
+}
+
+type openchainGetLedgerSnapshotServer struct {
+	grpc.ServerStream
+}
+
+func (x *openchainGetLedgerSnapshotServer) Send(m *LedgerSnapshotChunk) error {
+	return x.ServerStream.SendMsg(m)
+}
+
 var _Openchain_serviceDesc = grpc.ServiceDesc{
 	ServiceName: "protos.Openchain",
 	HandlerType: (*OpenchainServer)(nil),
@@ -253,6 +510,26 @@ var _Openchain_serviceDesc = grpc.ServiceDesc{
 			MethodName: "GetPeers",
 			Handler:    _Openchain_GetPeers_Handler,
 		},
+		{
+			MethodName: "GetDeployedChaincodes",
+			Handler:    _Openchain_GetDeployedChaincodes_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "GetBlocksByRange",
+			Handler:       _Openchain_GetBlocksByRange_Handler,
+			ServerStreams: true,
+		},
+		{
+			StreamName:    "GetChaincodeLogs",
+			Handler:       _Openchain_GetChaincodeLogs_Handler,
+			ServerStreams: true,
+		},
+		{
+			StreamName:    "GetLedgerSnapshot",
+			Handler:       _Openchain_GetLedgerSnapshot_Handler,
+			ServerStreams: true,
+		},
 	},
-	Streams: []grpc.StreamDesc{},
 }
@@ -81,6 +81,12 @@ func (block *Block) GetHash() ([]byte, error) {
 	return hash, nil
 }
 
+// IsPruned returns whether the transactions of this block were pruned from the
+// ledger, in which case it no longer hashes to the hash it was committed with.
+func (block *Block) IsPruned() bool {
+	return block != nil && block.NonHashData != nil && len(block.NonHashData.PrunedBlockHash) > 0
+}
+
 // GetStateHash returns the stateHash stored in this block. The stateHash
 // is the value returned by state.GetHash() after running all transactions in
 // the block.
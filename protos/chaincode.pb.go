@@ -40,6 +40,53 @@ func (x ConfidentialityLevel) String() string {
 	return proto.EnumName(ConfidentialityLevel_name, int32(x))
 }
 
+// Query Levels: the state a query reads. A TENTATIVE query also sees the
+// changes of the transactions of the batch in progress which finished
+// successfully, before they are committed
+type QueryLevel int32
+
+const (
+	QueryLevel_COMMITTED QueryLevel = 0
+	QueryLevel_TENTATIVE QueryLevel = 1
+)
+
+var QueryLevel_name = map[int32]string{
+	0: "COMMITTED",
+	1: "TENTATIVE",
+}
+var QueryLevel_value = map[string]int32{
+	"COMMITTED": 0,
+	"TENTATIVE": 1,
+}
+
+func (x QueryLevel) String() string {
+	return proto.EnumName(QueryLevel_name, int32(x))
+}
+
+// Access a chaincode grants another to its state
+type NamespaceAccess int32
+
+const (
+	NamespaceAccess_NO_ACCESS  NamespaceAccess = 0
+	NamespaceAccess_READ       NamespaceAccess = 1
+	NamespaceAccess_READ_WRITE NamespaceAccess = 2
+)
+
+var NamespaceAccess_name = map[int32]string{
+	0: "NO_ACCESS",
+	1: "READ",
+	2: "READ_WRITE",
+}
+var NamespaceAccess_value = map[string]int32{
+	"NO_ACCESS":  0,
+	"READ":       1,
+	"READ_WRITE": 2,
+}
+
+func (x NamespaceAccess) String() string {
+	return proto.EnumName(NamespaceAccess_name, int32(x))
+}
+
 type ChaincodeSpec_Type int32
 
 const (
@@ -74,21 +121,49 @@ type ChaincodeDeploymentSpec_ExecutionEnvironment int32
 const (
 	ChaincodeDeploymentSpec_DOCKER ChaincodeDeploymentSpec_ExecutionEnvironment = 0
 	ChaincodeDeploymentSpec_SYSTEM ChaincodeDeploymentSpec_ExecutionEnvironment = 1
+	// A process of the host of the peer, built and launched by the peer.
+	ChaincodeDeploymentSpec_PROCESS ChaincodeDeploymentSpec_ExecutionEnvironment = 2
 )
 
 var ChaincodeDeploymentSpec_ExecutionEnvironment_name = map[int32]string{
 	0: "DOCKER",
 	1: "SYSTEM",
+	2: "PROCESS",
 }
 var ChaincodeDeploymentSpec_ExecutionEnvironment_value = map[string]int32{
-	"DOCKER": 0,
-	"SYSTEM": 1,
+	"DOCKER":  0,
+	"SYSTEM":  1,
+	"PROCESS": 2,
 }
 
 func (x ChaincodeDeploymentSpec_ExecutionEnvironment) String() string {
 	return proto.EnumName(ChaincodeDeploymentSpec_ExecutionEnvironment_name, int32(x))
 }
 
+type DeployedChaincode_ContainerStatus int32
+
+const (
+	DeployedChaincode_NOT_RUNNING DeployedChaincode_ContainerStatus = 0
+	// Launched, not yet registered with the peer.
+	DeployedChaincode_STARTING DeployedChaincode_ContainerStatus = 1
+	DeployedChaincode_RUNNING  DeployedChaincode_ContainerStatus = 2
+)
+
+var DeployedChaincode_ContainerStatus_name = map[int32]string{
+	0: "NOT_RUNNING",
+	1: "STARTING",
+	2: "RUNNING",
+}
+var DeployedChaincode_ContainerStatus_value = map[string]int32{
+	"NOT_RUNNING": 0,
+	"STARTING":    1,
+	"RUNNING":     2,
+}
+
+func (x DeployedChaincode_ContainerStatus) String() string {
+	return proto.EnumName(DeployedChaincode_ContainerStatus_name, int32(x))
+}
+
 type ChaincodeMessage_Type int32
 
 const (
@@ -113,6 +188,15 @@ const (
 	ChaincodeMessage_RANGE_QUERY_STATE_NEXT  ChaincodeMessage_Type = 18
 	ChaincodeMessage_RANGE_QUERY_STATE_CLOSE ChaincodeMessage_Type = 19
 	ChaincodeMessage_KEEPALIVE               ChaincodeMessage_Type = 20
+	ChaincodeMessage_GET_STATE_AT_BLOCK      ChaincodeMessage_Type = 21
+	ChaincodeMessage_QUERY_INDEX             ChaincodeMessage_Type = 22
+	ChaincodeMessage_GET_PRIVATE_DATA        ChaincodeMessage_Type = 23
+	ChaincodeMessage_PUT_PRIVATE_DATA        ChaincodeMessage_Type = 24
+	ChaincodeMessage_DEL_PRIVATE_DATA        ChaincodeMessage_Type = 25
+	ChaincodeMessage_GET_NAMESPACE_STATE     ChaincodeMessage_Type = 26
+	ChaincodeMessage_PUT_NAMESPACE_STATE     ChaincodeMessage_Type = 27
+	ChaincodeMessage_DEL_NAMESPACE_STATE     ChaincodeMessage_Type = 28
+	ChaincodeMessage_GRANT_NAMESPACE_ACCESS  ChaincodeMessage_Type = 29
 )
 
 var ChaincodeMessage_Type_name = map[int32]string{
@@ -137,6 +221,15 @@ var ChaincodeMessage_Type_name = map[int32]string{
 	18: "RANGE_QUERY_STATE_NEXT",
 	19: "RANGE_QUERY_STATE_CLOSE",
 	20: "KEEPALIVE",
+	21: "GET_STATE_AT_BLOCK",
+	22: "QUERY_INDEX",
+	23: "GET_PRIVATE_DATA",
+	24: "PUT_PRIVATE_DATA",
+	25: "DEL_PRIVATE_DATA",
+	26: "GET_NAMESPACE_STATE",
+	27: "PUT_NAMESPACE_STATE",
+	28: "DEL_NAMESPACE_STATE",
+	29: "GRANT_NAMESPACE_ACCESS",
 }
 var ChaincodeMessage_Type_value = map[string]int32{
 	"UNDEFINED":               0,
@@ -160,6 +253,15 @@ var ChaincodeMessage_Type_value = map[string]int32{
 	"RANGE_QUERY_STATE_NEXT":  18,
 	"RANGE_QUERY_STATE_CLOSE": 19,
 	"KEEPALIVE":               20,
+	"GET_STATE_AT_BLOCK":      21,
+	"QUERY_INDEX":             22,
+	"GET_PRIVATE_DATA":        23,
+	"PUT_PRIVATE_DATA":        24,
+	"DEL_PRIVATE_DATA":        25,
+	"GET_NAMESPACE_STATE":     26,
+	"PUT_NAMESPACE_STATE":     27,
+	"DEL_NAMESPACE_STATE":     28,
+	"GRANT_NAMESPACE_ACCESS":  29,
 }
 
 func (x ChaincodeMessage_Type) String() string {
@@ -206,6 +308,19 @@ type ChaincodeSpec struct {
 	ConfidentialityLevel ConfidentialityLevel `protobuf:"varint,6,opt,name=confidentialityLevel,enum=protos.ConfidentialityLevel" json:"confidentialityLevel,omitempty"`
 	Metadata             []byte               `protobuf:"bytes,7,opt,name=metadata,proto3" json:"metadata,omitempty"`
 	Attributes           []string             `protobuf:"bytes,8,rep,name=attributes" json:"attributes,omitempty"`
+	// Set on deploy, the policy of the callers allowed to invoke and query the
+	// chaincode. Set on invoke, replaces the policy of the chaincode instead of
+	// invoking it, if the updatePolicy of the current policy allows the caller.
+	InvocationPolicy *InvocationPolicy `protobuf:"bytes,9,opt,name=invocationPolicy" json:"invocationPolicy,omitempty"`
+	// Set on deploy, the resource limits of the chaincode. Set on invoke,
+	// replaces the limits of the chaincode instead of invoking it, if the
+	// updatePolicy of its invocation policy allows the caller.
+	Limits *ChaincodeLimits `protobuf:"bytes,10,opt,name=limits" json:"limits,omitempty"`
+	// Set on deploy, the environment the chaincode runs in.
+	ExecEnv ChaincodeDeploymentSpec_ExecutionEnvironment `protobuf:"varint,11,opt,name=execEnv,enum=protos.ChaincodeDeploymentSpec_ExecutionEnvironment" json:"execEnv,omitempty"`
+	// Set on deploy, whether the ctorMsg is encrypted for the validators, to
+	// keep the init arguments secret even in a public deploy transaction.
+	EncryptCtorMsg bool `protobuf:"varint,12,opt,name=encryptCtorMsg" json:"encryptCtorMsg,omitempty"`
 }
 
 func (m *ChaincodeSpec) Reset()         { *m = ChaincodeSpec{} }
@@ -226,6 +341,77 @@ func (m *ChaincodeSpec) GetCtorMsg() *ChaincodeInput {
 	return nil
 }
 
+func (m *ChaincodeSpec) GetInvocationPolicy() *InvocationPolicy {
+	if m != nil {
+		return m.InvocationPolicy
+	}
+	return nil
+}
+
+func (m *ChaincodeSpec) GetLimits() *ChaincodeLimits {
+	if m != nil {
+		return m.Limits
+	}
+	return nil
+}
+
+// Limits of the resources a chaincode may use. A limit which is not set falls
+// back to the default of the peer.
+type ChaincodeLimits struct {
+	// Timeout of a transaction or query, in milliseconds.
+	Timeout int32 `protobuf:"varint,1,opt,name=timeout" json:"timeout,omitempty"`
+	// Memory of the chaincode container, in bytes.
+	Memory int64 `protobuf:"varint,2,opt,name=memory" json:"memory,omitempty"`
+	// Relative CPU weight of the chaincode container.
+	CpuShares int64 `protobuf:"varint,3,opt,name=cpuShares" json:"cpuShares,omitempty"`
+	// Size of the response payload, in bytes.
+	MaxResponseSize int32 `protobuf:"varint,4,opt,name=maxResponseSize" json:"maxResponseSize,omitempty"`
+}
+
+func (m *ChaincodeLimits) Reset()         { *m = ChaincodeLimits{} }
+func (m *ChaincodeLimits) String() string { return proto.CompactTextString(m) }
+func (*ChaincodeLimits) ProtoMessage()    {}
+
+// Policy of the callers allowed to invoke or query a chaincode. A caller is
+// allowed if its enrollment ID is listed, its role is listed, or it has all
+// the attributes. An empty policy allows every caller.
+type InvocationPolicy struct {
+	EnrollmentIDs []string              `protobuf:"bytes,1,rep,name=enrollmentIDs" json:"enrollmentIDs,omitempty"`
+	Roles         []string              `protobuf:"bytes,2,rep,name=roles" json:"roles,omitempty"`
+	Attributes    []*AttributePredicate `protobuf:"bytes,3,rep,name=attributes" json:"attributes,omitempty"`
+	// Policy of the callers allowed to replace this policy. If it is not set,
+	// the policy cannot be replaced.
+	UpdatePolicy *InvocationPolicy `protobuf:"bytes,4,opt,name=updatePolicy" json:"updatePolicy,omitempty"`
+}
+
+func (m *InvocationPolicy) Reset()         { *m = InvocationPolicy{} }
+func (m *InvocationPolicy) String() string { return proto.CompactTextString(m) }
+func (*InvocationPolicy) ProtoMessage()    {}
+
+func (m *InvocationPolicy) GetAttributes() []*AttributePredicate {
+	if m != nil {
+		return m.Attributes
+	}
+	return nil
+}
+
+func (m *InvocationPolicy) GetUpdatePolicy() *InvocationPolicy {
+	if m != nil {
+		return m.UpdatePolicy
+	}
+	return nil
+}
+
+// Attribute a caller must have in its certificate, with the value given.
+type AttributePredicate struct {
+	Name  string `protobuf:"bytes,1,opt,name=name" json:"name,omitempty"`
+	Value []byte `protobuf:"bytes,2,opt,name=value,proto3" json:"value,omitempty"`
+}
+
+func (m *AttributePredicate) Reset()         { *m = AttributePredicate{} }
+func (m *AttributePredicate) String() string { return proto.CompactTextString(m) }
+func (*AttributePredicate) ProtoMessage()    {}
+
 // Specify the deployment of a chaincode.
 // TODO: Define `codePackage`.
 type ChaincodeDeploymentSpec struct {
@@ -234,6 +420,12 @@ type ChaincodeDeploymentSpec struct {
 	EffectiveDate *google_protobuf.Timestamp                   `protobuf:"bytes,2,opt,name=effectiveDate" json:"effectiveDate,omitempty"`
 	CodePackage   []byte                                       `protobuf:"bytes,3,opt,name=codePackage,proto3" json:"codePackage,omitempty"`
 	ExecEnv       ChaincodeDeploymentSpec_ExecutionEnvironment `protobuf:"varint,4,opt,name=execEnv,enum=protos.ChaincodeDeploymentSpec_ExecutionEnvironment" json:"execEnv,omitempty"`
+	// SHA-256 of the code package, set by the deploying peer when the builds
+	// are reproducible. The peers verify it before building the chaincode.
+	BuildDigest string `protobuf:"bytes,5,opt,name=buildDigest" json:"buildDigest,omitempty"`
+	// The ctorMsg of the chaincodeSpec encrypted under the chain key, which
+	// only the validators hold, when encryptCtorMsg is set.
+	EncryptedCtorMsg []byte `protobuf:"bytes,6,opt,name=encryptedCtorMsg,proto3" json:"encryptedCtorMsg,omitempty"`
 }
 
 func (m *ChaincodeDeploymentSpec) Reset()         { *m = ChaincodeDeploymentSpec{} }
@@ -254,6 +446,91 @@ func (m *ChaincodeDeploymentSpec) GetEffectiveDate() *google_protobuf.Timestamp
 	return nil
 }
 
+// A chaincode deployed to the chain, as recorded by its deploy transaction,
+// with the status of its container on the peer queried.
+// buildDigest - SHA-256 of the code package deployed, which tells the
+// versions of a chaincode apart, set when the builds are reproducible.
+type DeployedChaincode struct {
+	ChaincodeID *ChaincodeID                                 `protobuf:"bytes,1,opt,name=chaincodeID" json:"chaincodeID,omitempty"`
+	Type        ChaincodeSpec_Type                           `protobuf:"varint,2,opt,name=type,enum=protos.ChaincodeSpec_Type" json:"type,omitempty"`
+	Txid        string                                       `protobuf:"bytes,3,opt,name=txid" json:"txid,omitempty"`
+	Timestamp   *google_protobuf.Timestamp                   `protobuf:"bytes,4,opt,name=timestamp" json:"timestamp,omitempty"`
+	BuildDigest string                                       `protobuf:"bytes,5,opt,name=buildDigest" json:"buildDigest,omitempty"`
+	ExecEnv     ChaincodeDeploymentSpec_ExecutionEnvironment `protobuf:"varint,6,opt,name=execEnv,enum=protos.ChaincodeDeploymentSpec_ExecutionEnvironment" json:"execEnv,omitempty"`
+	Status      DeployedChaincode_ContainerStatus            `protobuf:"varint,7,opt,name=status,enum=protos.DeployedChaincode_ContainerStatus" json:"status,omitempty"`
+}
+
+func (m *DeployedChaincode) Reset()         { *m = DeployedChaincode{} }
+func (m *DeployedChaincode) String() string { return proto.CompactTextString(m) }
+func (*DeployedChaincode) ProtoMessage()    {}
+
+func (m *DeployedChaincode) GetChaincodeID() *ChaincodeID {
+	if m != nil {
+		return m.ChaincodeID
+	}
+	return nil
+}
+
+func (m *DeployedChaincode) GetTimestamp() *google_protobuf.Timestamp {
+	if m != nil {
+		return m.Timestamp
+	}
+	return nil
+}
+
+type DeployedChaincodes struct {
+	Chaincodes []*DeployedChaincode `protobuf:"bytes,1,rep,name=chaincodes" json:"chaincodes,omitempty"`
+}
+
+func (m *DeployedChaincodes) Reset()         { *m = DeployedChaincodes{} }
+func (m *DeployedChaincodes) String() string { return proto.CompactTextString(m) }
+func (*DeployedChaincodes) ProtoMessage()    {}
+
+func (m *DeployedChaincodes) GetChaincodes() []*DeployedChaincode {
+	if m != nil {
+		return m.Chaincodes
+	}
+	return nil
+}
+
+// Selects the output of a chaincode to return: the last tail lines the peer
+// kept of it, all of them if 0, then, if follow is set, the lines the
+// chaincode writes until the request is cancelled.
+type ChaincodeLogsRequest struct {
+	ChaincodeID *ChaincodeID `protobuf:"bytes,1,opt,name=chaincodeID" json:"chaincodeID,omitempty"`
+	Tail        uint32       `protobuf:"varint,2,opt,name=tail" json:"tail,omitempty"`
+	Follow      bool         `protobuf:"varint,3,opt,name=follow" json:"follow,omitempty"`
+}
+
+func (m *ChaincodeLogsRequest) Reset()         { *m = ChaincodeLogsRequest{} }
+func (m *ChaincodeLogsRequest) String() string { return proto.CompactTextString(m) }
+func (*ChaincodeLogsRequest) ProtoMessage()    {}
+
+func (m *ChaincodeLogsRequest) GetChaincodeID() *ChaincodeID {
+	if m != nil {
+		return m.ChaincodeID
+	}
+	return nil
+}
+
+// A line a chaincode wrote to its stdout or stderr.
+type ChaincodeLogEntry struct {
+	Chaincode string                     `protobuf:"bytes,1,opt,name=chaincode" json:"chaincode,omitempty"`
+	Timestamp *google_protobuf.Timestamp `protobuf:"bytes,2,opt,name=timestamp" json:"timestamp,omitempty"`
+	Line      string                     `protobuf:"bytes,3,opt,name=line" json:"line,omitempty"`
+}
+
+func (m *ChaincodeLogEntry) Reset()         { *m = ChaincodeLogEntry{} }
+func (m *ChaincodeLogEntry) String() string { return proto.CompactTextString(m) }
+func (*ChaincodeLogEntry) ProtoMessage()    {}
+
+func (m *ChaincodeLogEntry) GetTimestamp() *google_protobuf.Timestamp {
+	if m != nil {
+		return m.Timestamp
+	}
+	return nil
+}
+
 // Carries the chaincode function and its arguments.
 type ChaincodeInvocationSpec struct {
 	ChaincodeSpec *ChaincodeSpec `protobuf:"bytes,1,opt,name=chaincodeSpec" json:"chaincodeSpec,omitempty"`
@@ -265,6 +542,8 @@ type ChaincodeInvocationSpec struct {
 	//  2, a decoding used to decode user (string) input to bytes
 	// Currently, SHA256 with BASE64 is supported (e.g. idGenerationAlg='sha256base64')
 	IdGenerationAlg string `protobuf:"bytes,2,opt,name=idGenerationAlg" json:"idGenerationAlg,omitempty"`
+	// The state read by a query; ignored by the other transactions
+	QueryLevel QueryLevel `protobuf:"varint,3,opt,name=queryLevel,enum=protos.QueryLevel" json:"queryLevel,omitempty"`
 }
 
 func (m *ChaincodeInvocationSpec) Reset()         { *m = ChaincodeInvocationSpec{} }
@@ -313,6 +592,8 @@ type ChaincodeMessage struct {
 	// This event is then stored (currently)
 	// with Block.NonHashData.TransactionResult
 	ChaincodeEvent *ChaincodeEvent `protobuf:"bytes,6,opt,name=chaincodeEvent" json:"chaincodeEvent,omitempty"`
+	// all the events emitted by the chaincode, chaincodeEvent being the first
+	ChaincodeEvents []*ChaincodeEvent `protobuf:"bytes,7,rep,name=chaincodeEvents" json:"chaincodeEvents,omitempty"`
 }
 
 func (m *ChaincodeMessage) Reset()         { *m = ChaincodeMessage{} }
@@ -340,6 +621,13 @@ func (m *ChaincodeMessage) GetChaincodeEvent() *ChaincodeEvent {
 	return nil
 }
 
+func (m *ChaincodeMessage) GetChaincodeEvents() []*ChaincodeEvent {
+	if m != nil {
+		return m.ChaincodeEvents
+	}
+	return nil
+}
+
 type PutStateInfo struct {
 	Key   string `protobuf:"bytes,1,opt,name=key" json:"key,omitempty"`
 	Value []byte `protobuf:"bytes,2,opt,name=value,proto3" json:"value,omitempty"`
@@ -349,15 +637,80 @@ func (m *PutStateInfo) Reset()         { *m = PutStateInfo{} }
 func (m *PutStateInfo) String() string { return proto.CompactTextString(m) }
 func (*PutStateInfo) ProtoMessage()    {}
 
+// A pageSize greater than 0 reads a page of the committed state, starting
+// after the page bookmark was returned with, instead of opening an iterator
 type RangeQueryState struct {
 	StartKey string `protobuf:"bytes,1,opt,name=startKey" json:"startKey,omitempty"`
 	EndKey   string `protobuf:"bytes,2,opt,name=endKey" json:"endKey,omitempty"`
+	PageSize int32  `protobuf:"varint,3,opt,name=pageSize" json:"pageSize,omitempty"`
+	Bookmark string `protobuf:"bytes,4,opt,name=bookmark" json:"bookmark,omitempty"`
 }
 
 func (m *RangeQueryState) Reset()         { *m = RangeQueryState{} }
 func (m *RangeQueryState) String() string { return proto.CompactTextString(m) }
 func (*RangeQueryState) ProtoMessage()    {}
 
+// Payload of GET_STATE_AT_BLOCK, reading the value a key had once a block
+// was committed
+type GetStateAtBlock struct {
+	Key         string `protobuf:"bytes,1,opt,name=key" json:"key,omitempty"`
+	BlockNumber uint64 `protobuf:"varint,2,opt,name=blockNumber" json:"blockNumber,omitempty"`
+}
+
+func (m *GetStateAtBlock) Reset()         { *m = GetStateAtBlock{} }
+func (m *GetStateAtBlock) String() string { return proto.CompactTextString(m) }
+func (*GetStateAtBlock) ProtoMessage()    {}
+
+// Payload of QUERY_INDEX, reading the keys whose value has the field of an
+// index between start and end, inclusive. The bounds are JSON values, an
+// empty bound leaving the range open on its side.
+type QueryIndex struct {
+	Index string `protobuf:"bytes,1,opt,name=index" json:"index,omitempty"`
+	Start []byte `protobuf:"bytes,2,opt,name=start,proto3" json:"start,omitempty"`
+	End   []byte `protobuf:"bytes,3,opt,name=end,proto3" json:"end,omitempty"`
+}
+
+func (m *QueryIndex) Reset()         { *m = QueryIndex{} }
+func (m *QueryIndex) String() string { return proto.CompactTextString(m) }
+func (*QueryIndex) ProtoMessage()    {}
+
+// Payload of GET_PRIVATE_DATA, PUT_PRIVATE_DATA and DEL_PRIVATE_DATA, the
+// private data of a chaincode being kept in collections of keys out of the
+// state. The value is only set by PUT_PRIVATE_DATA.
+type PrivateDataInfo struct {
+	Collection string `protobuf:"bytes,1,opt,name=collection" json:"collection,omitempty"`
+	Key        string `protobuf:"bytes,2,opt,name=key" json:"key,omitempty"`
+	Value      []byte `protobuf:"bytes,3,opt,name=value,proto3" json:"value,omitempty"`
+}
+
+func (m *PrivateDataInfo) Reset()         { *m = PrivateDataInfo{} }
+func (m *PrivateDataInfo) String() string { return proto.CompactTextString(m) }
+func (*PrivateDataInfo) ProtoMessage()    {}
+
+// Payload of GET_NAMESPACE_STATE, PUT_NAMESPACE_STATE and DEL_NAMESPACE_STATE,
+// accessing the state of another chaincode, which must have granted the access.
+// The value is only set by PUT_NAMESPACE_STATE.
+type NamespaceStateInfo struct {
+	Namespace string `protobuf:"bytes,1,opt,name=namespace" json:"namespace,omitempty"`
+	Key       string `protobuf:"bytes,2,opt,name=key" json:"key,omitempty"`
+	Value     []byte `protobuf:"bytes,3,opt,name=value,proto3" json:"value,omitempty"`
+}
+
+func (m *NamespaceStateInfo) Reset()         { *m = NamespaceStateInfo{} }
+func (m *NamespaceStateInfo) String() string { return proto.CompactTextString(m) }
+func (*NamespaceStateInfo) ProtoMessage()    {}
+
+// Payload of GRANT_NAMESPACE_ACCESS, granting the access of a chaincode to
+// the state of the chaincode sending it. NO_ACCESS revokes the access granted.
+type NamespaceAccessGrant struct {
+	Grantee string          `protobuf:"bytes,1,opt,name=grantee" json:"grantee,omitempty"`
+	Access  NamespaceAccess `protobuf:"varint,2,opt,name=access,enum=protos.NamespaceAccess" json:"access,omitempty"`
+}
+
+func (m *NamespaceAccessGrant) Reset()         { *m = NamespaceAccessGrant{} }
+func (m *NamespaceAccessGrant) String() string { return proto.CompactTextString(m) }
+func (*NamespaceAccessGrant) ProtoMessage()    {}
+
 type RangeQueryStateNext struct {
 	ID string `protobuf:"bytes,1,opt,name=ID" json:"ID,omitempty"`
 }
@@ -387,6 +740,7 @@ type RangeQueryStateResponse struct {
 	KeysAndValues []*RangeQueryStateKeyValue `protobuf:"bytes,1,rep,name=keysAndValues" json:"keysAndValues,omitempty"`
 	HasMore       bool                       `protobuf:"varint,2,opt,name=hasMore" json:"hasMore,omitempty"`
 	ID            string                     `protobuf:"bytes,3,opt,name=ID" json:"ID,omitempty"`
+	Bookmark      string                     `protobuf:"bytes,4,opt,name=bookmark" json:"bookmark,omitempty"`
 }
 
 func (m *RangeQueryStateResponse) Reset()         { *m = RangeQueryStateResponse{} }
@@ -402,8 +756,11 @@ func (m *RangeQueryStateResponse) GetKeysAndValues() []*RangeQueryStateKeyValue
 
 func init() {
 	proto.RegisterEnum("protos.ConfidentialityLevel", ConfidentialityLevel_name, ConfidentialityLevel_value)
+	proto.RegisterEnum("protos.QueryLevel", QueryLevel_name, QueryLevel_value)
+	proto.RegisterEnum("protos.NamespaceAccess", NamespaceAccess_name, NamespaceAccess_value)
 	proto.RegisterEnum("protos.ChaincodeSpec_Type", ChaincodeSpec_Type_name, ChaincodeSpec_Type_value)
 	proto.RegisterEnum("protos.ChaincodeDeploymentSpec_ExecutionEnvironment", ChaincodeDeploymentSpec_ExecutionEnvironment_name, ChaincodeDeploymentSpec_ExecutionEnvironment_value)
+	proto.RegisterEnum("protos.DeployedChaincode_ContainerStatus", DeployedChaincode_ContainerStatus_name, DeployedChaincode_ContainerStatus_value)
 	proto.RegisterEnum("protos.ChaincodeMessage_Type", ChaincodeMessage_Type_name, ChaincodeMessage_Type_value)
 }
 
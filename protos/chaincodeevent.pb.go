@@ -15,13 +15,64 @@ var _ = math.Inf
 
 // Chaincode is used for events and registrations that are specific to chaincode
 // string type - "chaincode"
+// A transaction may emit several events, of different names
 type ChaincodeEvent struct {
-	ChaincodeID string `protobuf:"bytes,1,opt,name=chaincodeID" json:"chaincodeID,omitempty"`
-	TxID        string `protobuf:"bytes,2,opt,name=txID" json:"txID,omitempty"`
-	EventName   string `protobuf:"bytes,3,opt,name=eventName" json:"eventName,omitempty"`
-	Payload     []byte `protobuf:"bytes,4,opt,name=payload,proto3" json:"payload,omitempty"`
+	ChaincodeID string            `protobuf:"bytes,1,opt,name=chaincodeID" json:"chaincodeID,omitempty"`
+	TxID        string            `protobuf:"bytes,2,opt,name=txID" json:"txID,omitempty"`
+	EventName   string            `protobuf:"bytes,3,opt,name=eventName" json:"eventName,omitempty"`
+	Payload     []byte            `protobuf:"bytes,4,opt,name=payload,proto3" json:"payload,omitempty"`
+	Attributes  []*EventAttribute `protobuf:"bytes,5,rep,name=attributes" json:"attributes,omitempty"`
 }
 
 func (m *ChaincodeEvent) Reset()         { *m = ChaincodeEvent{} }
 func (m *ChaincodeEvent) String() string { return proto.CompactTextString(m) }
 func (*ChaincodeEvent) ProtoMessage()    {}
+
+func (m *ChaincodeEvent) GetAttributes() []*EventAttribute {
+	if m != nil {
+		return m.Attributes
+	}
+	return nil
+}
+
+// EventAttribute is a typed attribute of a chaincode event. value is the
+// canonical text of the value of its type: the decimal integer for INTEGER,
+// "true" or "false" for BOOLEAN. The ledger indexes the indexed attributes,
+// to find the blocks with events of a name with an attribute of a value
+type EventAttribute struct {
+	Name    string              `protobuf:"bytes,1,opt,name=name" json:"name,omitempty"`
+	Type    EventAttribute_Type `protobuf:"varint,2,opt,name=type,enum=protos.EventAttribute_Type" json:"type,omitempty"`
+	Value   string              `protobuf:"bytes,3,opt,name=value" json:"value,omitempty"`
+	Indexed bool                `protobuf:"varint,4,opt,name=indexed" json:"indexed,omitempty"`
+}
+
+func (m *EventAttribute) Reset()         { *m = EventAttribute{} }
+func (m *EventAttribute) String() string { return proto.CompactTextString(m) }
+func (*EventAttribute) ProtoMessage()    {}
+
+type EventAttribute_Type int32
+
+const (
+	EventAttribute_STRING  EventAttribute_Type = 0
+	EventAttribute_INTEGER EventAttribute_Type = 1
+	EventAttribute_BOOLEAN EventAttribute_Type = 2
+)
+
+var EventAttribute_Type_name = map[int32]string{
+	0: "STRING",
+	1: "INTEGER",
+	2: "BOOLEAN",
+}
+var EventAttribute_Type_value = map[string]int32{
+	"STRING":  0,
+	"INTEGER": 1,
+	"BOOLEAN": 2,
+}
+
+func (x EventAttribute_Type) String() string {
+	return proto.EnumName(EventAttribute_Type_name, int32(x))
+}
+
+func init() {
+	proto.RegisterEnum("protos.EventAttribute_Type", EventAttribute_Type_name, EventAttribute_Type_value)
+}
@@ -0,0 +1,66 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package protos
+
+import (
+	"fmt"
+
+	"github.com/golang/protobuf/proto"
+)
+
+// ConsensusEnvelopeVersion is the highest ConsensusEnvelope version this peer
+// understands, it is advertised to the other peers in the HelloMessage
+const ConsensusEnvelopeVersion uint32 = 1
+
+// NegotiateConsensusEnvelopeVersion returns the envelope version to exchange
+// consensus messages with a peer advertising remote, 0 meaning the payloads
+// are exchanged unwrapped as peers predating the envelope expect
+func NegotiateConsensusEnvelopeVersion(remote uint32) uint32 {
+	if remote < ConsensusEnvelopeVersion {
+		return remote
+	}
+	return ConsensusEnvelopeVersion
+}
+
+// WrapConsensusPayload wraps the payload of a consensus message into an
+// envelope of the given version, version 0 leaves the payload as is
+func WrapConsensusPayload(version uint32, payload []byte) ([]byte, error) {
+	if version == 0 {
+		return payload, nil
+	}
+	if version > ConsensusEnvelopeVersion {
+		return nil, fmt.Errorf("Cannot wrap consensus payload in envelope version %d, this peer supports up to version %d", version, ConsensusEnvelopeVersion)
+	}
+	data, err := proto.Marshal(&ConsensusEnvelope{Version: version, Payload: payload})
+	if err != nil {
+		return nil, fmt.Errorf("Could not marshal consensus envelope: %s", err)
+	}
+	return data, nil
+}
+
+// UnwrapConsensusPayload returns the payload of a consensus envelope, it
+// rejects the envelope versions this peer does not understand
+func UnwrapConsensusPayload(data []byte) ([]byte, error) {
+	envelope := &ConsensusEnvelope{}
+	if err := proto.Unmarshal(data, envelope); err != nil {
+		return nil, fmt.Errorf("Could not unmarshal consensus envelope: %s", err)
+	}
+	if envelope.Version == 0 || envelope.Version > ConsensusEnvelopeVersion {
+		return nil, fmt.Errorf("Consensus envelope version %d is not supported, this peer supports versions 1 to %d", envelope.Version, ConsensusEnvelopeVersion)
+	}
+	return envelope.Payload, nil
+}
@@ -0,0 +1,64 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package protos
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/golang/protobuf/proto"
+)
+
+func TestConsensusEnvelopeRoundTrip(t *testing.T) {
+	payload := []byte("consensus payload")
+	data, err := WrapConsensusPayload(ConsensusEnvelopeVersion, payload)
+	if err != nil {
+		t.Fatalf("Could not wrap payload: %s", err)
+	}
+	unwrapped, err := UnwrapConsensusPayload(data)
+	if err != nil {
+		t.Fatalf("Could not unwrap payload: %s", err)
+	}
+	if !bytes.Equal(unwrapped, payload) {
+		t.Errorf("Expected payload %q, got %q", payload, unwrapped)
+	}
+
+	if data, _ := WrapConsensusPayload(0, payload); !bytes.Equal(data, payload) {
+		t.Errorf("Expected version 0 to leave the payload unwrapped, got %q", data)
+	}
+}
+
+func TestConsensusEnvelopeUnknownVersion(t *testing.T) {
+	for _, version := range []uint32{0, ConsensusEnvelopeVersion + 1} {
+		data, _ := proto.Marshal(&ConsensusEnvelope{Version: version, Payload: []byte("payload")})
+		if _, err := UnwrapConsensusPayload(data); err == nil {
+			t.Errorf("Expected envelope version %d to be rejected", version)
+		}
+	}
+	if _, err := WrapConsensusPayload(ConsensusEnvelopeVersion+1, nil); err == nil {
+		t.Errorf("Expected wrapping in an unknown envelope version to fail")
+	}
+}
+
+func TestNegotiateConsensusEnvelopeVersion(t *testing.T) {
+	if version := NegotiateConsensusEnvelopeVersion(0); version != 0 {
+		t.Errorf("Expected peers predating the envelope to be sent unwrapped payloads, negotiated %d", version)
+	}
+	if version := NegotiateConsensusEnvelopeVersion(ConsensusEnvelopeVersion + 1); version != ConsensusEnvelopeVersion {
+		t.Errorf("Expected a newer peer to be sent version %d, negotiated %d", ConsensusEnvelopeVersion, version)
+	}
+}
@@ -120,6 +120,17 @@ func (m *TransactionRequest) Reset()         { *m = TransactionRequest{} }
 func (m *TransactionRequest) String() string { return proto.CompactTextString(m) }
 func (*TransactionRequest) ProtoMessage()    {}
 
+type VerifyChainRequest struct {
+	// lowest block to verify
+	From uint64 `protobuf:"varint,1,opt,name=from" json:"from,omitempty"`
+	// highest block to verify, the last block if beyond it
+	To uint64 `protobuf:"varint,2,opt,name=to" json:"to,omitempty"`
+}
+
+func (m *VerifyChainRequest) Reset()         { *m = VerifyChainRequest{} }
+func (m *VerifyChainRequest) String() string { return proto.CompactTextString(m) }
+func (*VerifyChainRequest) ProtoMessage()    {}
+
 func init() {
 	proto.RegisterEnum("protos.BuildResult_StatusCode", BuildResult_StatusCode_name, BuildResult_StatusCode_value)
 }
@@ -150,6 +161,8 @@ type DevopsClient interface {
 	EXP_ProduceSigma(ctx context.Context, in *SigmaInput, opts ...grpc.CallOption) (*Response, error)
 	// Execute a transaction with a specific binding
 	EXP_ExecuteWithBinding(ctx context.Context, in *ExecuteWithBinding, opts ...grpc.CallOption) (*Response, error)
+	// Verify the hash chain and the state hashes of a range of blocks.
+	VerifyChain(ctx context.Context, in *VerifyChainRequest, opts ...grpc.CallOption) (*ChainVerification, error)
 }
 
 type devopsClient struct {
@@ -241,6 +254,15 @@ func (c *devopsClient) EXP_ExecuteWithBinding(ctx context.Context, in *ExecuteWi
 	return out, nil
 }
 
+func (c *devopsClient) VerifyChain(ctx context.Context, in *VerifyChainRequest, opts ...grpc.CallOption) (*ChainVerification, error) {
+	out := new(ChainVerification)
+	err := grpc.Invoke(ctx, "/protos.Devops/VerifyChain", in, out, c.cc, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
 // Server API for Devops service
 
 type DevopsServer interface {
@@ -263,6 +285,8 @@ type DevopsServer interface {
 	EXP_ProduceSigma(context.Context, *SigmaInput) (*Response, error)
 	// Execute a transaction with a specific binding
 	EXP_ExecuteWithBinding(context.Context, *ExecuteWithBinding) (*Response, error)
+	// Verify the hash chain and the state hashes of a range of blocks.
+	VerifyChain(context.Context, *VerifyChainRequest) (*ChainVerification, error)
 }
 
 func RegisterDevopsServer(s *grpc.Server, srv DevopsServer) {
@@ -377,6 +401,18 @@ func _Devops_EXP_ExecuteWithBinding_Handler(srv interface{}, ctx context.Context
 	return out, nil
 }
 
+func _Devops_VerifyChain_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error) (interface{}, error) {
+	in := new(VerifyChainRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	out, err := srv.(DevopsServer).VerifyChain(ctx, in)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
 var _Devops_serviceDesc = grpc.ServiceDesc{
 	ServiceName: "protos.Devops",
 	HandlerType: (*DevopsServer)(nil),
@@ -417,6 +453,10 @@ var _Devops_serviceDesc = grpc.ServiceDesc{
 			MethodName: "EXP_ExecuteWithBinding",
 			Handler:    _Devops_EXP_ExecuteWithBinding_Handler,
 		},
+		{
+			MethodName: "VerifyChain",
+			Handler:    _Devops_VerifyChain_Handler,
+		},
 	},
 	Streams: []grpc.StreamDesc{},
 }
@@ -25,6 +25,7 @@ const (
 	EventType_BLOCK     EventType = 1
 	EventType_CHAINCODE EventType = 2
 	EventType_REJECTION EventType = 3
+	EventType_ALERT     EventType = 4
 )
 
 var EventType_name = map[int32]string{
@@ -32,12 +33,14 @@ var EventType_name = map[int32]string{
 	1: "BLOCK",
 	2: "CHAINCODE",
 	3: "REJECTION",
+	4: "ALERT",
 }
 var EventType_value = map[string]int32{
 	"REGISTER":  0,
 	"BLOCK":     1,
 	"CHAINCODE": 2,
 	"REJECTION": 3,
+	"ALERT":     4,
 }
 
 func (x EventType) String() string {
@@ -45,16 +48,25 @@ func (x EventType) String() string {
 }
 
 // ChaincodeReg is used for registering chaincode Interests
-// when EventType is CHAINCODE
+// when EventType is CHAINCODE. When attributes are given, only the events
+// with all these attributes, of the same type and value, are sent
 type ChaincodeReg struct {
-	ChaincodeID string `protobuf:"bytes,1,opt,name=chaincodeID" json:"chaincodeID,omitempty"`
-	EventName   string `protobuf:"bytes,2,opt,name=eventName" json:"eventName,omitempty"`
+	ChaincodeID string            `protobuf:"bytes,1,opt,name=chaincodeID" json:"chaincodeID,omitempty"`
+	EventName   string            `protobuf:"bytes,2,opt,name=eventName" json:"eventName,omitempty"`
+	Attributes  []*EventAttribute `protobuf:"bytes,3,rep,name=attributes" json:"attributes,omitempty"`
 }
 
 func (m *ChaincodeReg) Reset()         { *m = ChaincodeReg{} }
 func (m *ChaincodeReg) String() string { return proto.CompactTextString(m) }
 func (*ChaincodeReg) ProtoMessage()    {}
 
+func (m *ChaincodeReg) GetAttributes() []*EventAttribute {
+	if m != nil {
+		return m.Attributes
+	}
+	return nil
+}
+
 type Interest struct {
 	EventType EventType `protobuf:"varint,1,opt,name=eventType,enum=protos.EventType" json:"eventType,omitempty"`
 	// Ideally we should just have the following oneof for different
@@ -171,6 +183,17 @@ func (m *Rejection) GetTx() *Transaction {
 }
 
 // ---------- producer events ---------
+// Alert is sent when a component of the peer detects it is not making
+// progress, e.g. a stalled execution of transactions
+type Alert struct {
+	Source  string `protobuf:"bytes,1,opt,name=source" json:"source,omitempty"`
+	Message string `protobuf:"bytes,2,opt,name=message" json:"message,omitempty"`
+}
+
+func (m *Alert) Reset()         { *m = Alert{} }
+func (m *Alert) String() string { return proto.CompactTextString(m) }
+func (*Alert) ProtoMessage()    {}
+
 // Event is used by
 //  - consumers (adapters) to send Register
 //  - producer to advertise supported types and events
@@ -180,6 +203,7 @@ type Event struct {
 	//	*Event_Block
 	//	*Event_ChaincodeEvent
 	//	*Event_Rejection
+	//	*Event_Alert
 	Event isEvent_Event `protobuf_oneof:"Event"`
 }
 
@@ -203,11 +227,15 @@ type Event_ChaincodeEvent struct {
 type Event_Rejection struct {
 	Rejection *Rejection `protobuf:"bytes,4,opt,name=rejection,oneof"`
 }
+type Event_Alert struct {
+	Alert *Alert `protobuf:"bytes,5,opt,name=alert,oneof"`
+}
 
 func (*Event_Register) isEvent_Event()       {}
 func (*Event_Block) isEvent_Event()          {}
 func (*Event_ChaincodeEvent) isEvent_Event() {}
 func (*Event_Rejection) isEvent_Event()      {}
+func (*Event_Alert) isEvent_Event()          {}
 
 func (m *Event) GetEvent() isEvent_Event {
 	if m != nil {
@@ -244,6 +272,13 @@ func (m *Event) GetRejection() *Rejection {
 	return nil
 }
 
+func (m *Event) GetAlert() *Alert {
+	if x, ok := m.GetEvent().(*Event_Alert); ok {
+		return x.Alert
+	}
+	return nil
+}
+
 // XXX_OneofFuncs is for the internal use of the proto package.
 func (*Event) XXX_OneofFuncs() (func(msg proto.Message, b *proto.Buffer) error, func(msg proto.Message, tag, wire int, b *proto.Buffer) (bool, error), []interface{}) {
 	return _Event_OneofMarshaler, _Event_OneofUnmarshaler, []interface{}{
@@ -251,6 +286,7 @@ func (*Event) XXX_OneofFuncs() (func(msg proto.Message, b *proto.Buffer) error,
 		(*Event_Block)(nil),
 		(*Event_ChaincodeEvent)(nil),
 		(*Event_Rejection)(nil),
+		(*Event_Alert)(nil),
 	}
 }
 
@@ -278,6 +314,11 @@ func _Event_OneofMarshaler(msg proto.Message, b *proto.Buffer) error {
 		if err := b.EncodeMessage(x.Rejection); err != nil {
 			return err
 		}
+	case *Event_Alert:
+		b.EncodeVarint(5<<3 | proto.WireBytes)
+		if err := b.EncodeMessage(x.Alert); err != nil {
+			return err
+		}
 	case nil:
 	default:
 		return fmt.Errorf("Event.Event has unexpected type %T", x)
@@ -320,6 +361,14 @@ func _Event_OneofUnmarshaler(msg proto.Message, tag, wire int, b *proto.Buffer)
 		err := b.DecodeMessage(msg)
 		m.Event = &Event_Rejection{msg}
 		return true, err
+	case 5: // Event.alert
+		if wire != proto.WireBytes {
+			return true, proto.ErrInternalBadWireType
+		}
+		msg := new(Alert)
+		err := b.DecodeMessage(msg)
+		m.Event = &Event_Alert{msg}
+		return true, err
 	default:
 		return false, nil
 	}
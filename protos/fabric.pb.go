@@ -75,6 +75,54 @@ func (x PeerEndpoint_Type) String() string {
 	return proto.EnumName(PeerEndpoint_Type_name, int32(x))
 }
 
+type ChainVerification_DivergenceType int32
+
+const (
+	ChainVerification_NONE ChainVerification_DivergenceType = 0
+	// the hash of the block is not the previous block hash recorded by
+	// the next block
+	ChainVerification_BLOCK_HASH ChainVerification_DivergenceType = 1
+	// the state hash recorded by the block is not the hash of the state
+	// rolled back to the block
+	ChainVerification_STATE_HASH ChainVerification_DivergenceType = 2
+)
+
+var ChainVerification_DivergenceType_name = map[int32]string{
+	0: "NONE",
+	1: "BLOCK_HASH",
+	2: "STATE_HASH",
+}
+var ChainVerification_DivergenceType_value = map[string]int32{
+	"NONE":       0,
+	"BLOCK_HASH": 1,
+	"STATE_HASH": 2,
+}
+
+func (x ChainVerification_DivergenceType) String() string {
+	return proto.EnumName(ChainVerification_DivergenceType_name, int32(x))
+}
+
+type TransactionReceipt_Status int32
+
+const (
+	TransactionReceipt_SUCCESS TransactionReceipt_Status = 0
+	// the transaction failed, it is not in the block
+	TransactionReceipt_FAILURE TransactionReceipt_Status = 1
+)
+
+var TransactionReceipt_Status_name = map[int32]string{
+	0: "SUCCESS",
+	1: "FAILURE",
+}
+var TransactionReceipt_Status_value = map[string]int32{
+	"SUCCESS": 0,
+	"FAILURE": 1,
+}
+
+func (x TransactionReceipt_Status) String() string {
+	return proto.EnumName(TransactionReceipt_Status_name, int32(x))
+}
+
 type Message_Type int32
 
 const (
@@ -143,23 +191,47 @@ const (
 	Response_UNDEFINED Response_StatusCode = 0
 	Response_SUCCESS   Response_StatusCode = 200
 	Response_FAILURE   Response_StatusCode = 500
+	// the request was not accepted because the validator is overloaded, it may be retried later
+	Response_BUSY Response_StatusCode = 503
 )
 
 var Response_StatusCode_name = map[int32]string{
 	0:   "UNDEFINED",
 	200: "SUCCESS",
 	500: "FAILURE",
+	503: "BUSY",
 }
 var Response_StatusCode_value = map[string]int32{
 	"UNDEFINED": 0,
 	"SUCCESS":   200,
 	"FAILURE":   500,
+	"BUSY":      503,
 }
 
 func (x Response_StatusCode) String() string {
 	return proto.EnumName(Response_StatusCode_name, int32(x))
 }
 
+type SyncStateDeltas_Compression int32
+
+const (
+	SyncStateDeltas_NONE SyncStateDeltas_Compression = 0
+	SyncStateDeltas_GZIP SyncStateDeltas_Compression = 1
+)
+
+var SyncStateDeltas_Compression_name = map[int32]string{
+	0: "NONE",
+	1: "GZIP",
+}
+var SyncStateDeltas_Compression_value = map[string]int32{
+	"NONE": 0,
+	"GZIP": 1,
+}
+
+func (x SyncStateDeltas_Compression) String() string {
+	return proto.EnumName(SyncStateDeltas_Compression_name, int32(x))
+}
+
 // Transaction defines a function call to a contract.
 // `args` is an array of type string so that the chaincode writer can choose
 // whatever format they wish for the arguments for their chaincode.
@@ -214,13 +286,17 @@ func (m *TransactionBlock) GetTransactions() []*Transaction {
 // result - The return value of the transaction.
 // errorCode - An error code. 5xx will be logged as a failure in the dashboard.
 // error - An error string for logging an issue.
-// chaincodeEvent - any event emitted by a transaction
+// chaincodeEvent - the first event emitted by a transaction, if any
+// readWriteSet - The keys the transaction read and wrote, if it succeeded.
+// chaincodeEvents - all the events emitted by the transaction.
 type TransactionResult struct {
-	Uuid           string          `protobuf:"bytes,1,opt,name=uuid" json:"uuid,omitempty"`
-	Result         []byte          `protobuf:"bytes,2,opt,name=result,proto3" json:"result,omitempty"`
-	ErrorCode      uint32          `protobuf:"varint,3,opt,name=errorCode" json:"errorCode,omitempty"`
-	Error          string          `protobuf:"bytes,4,opt,name=error" json:"error,omitempty"`
-	ChaincodeEvent *ChaincodeEvent `protobuf:"bytes,5,opt,name=chaincodeEvent" json:"chaincodeEvent,omitempty"`
+	Uuid            string            `protobuf:"bytes,1,opt,name=uuid" json:"uuid,omitempty"`
+	Result          []byte            `protobuf:"bytes,2,opt,name=result,proto3" json:"result,omitempty"`
+	ErrorCode       uint32            `protobuf:"varint,3,opt,name=errorCode" json:"errorCode,omitempty"`
+	Error           string            `protobuf:"bytes,4,opt,name=error" json:"error,omitempty"`
+	ChaincodeEvent  *ChaincodeEvent   `protobuf:"bytes,5,opt,name=chaincodeEvent" json:"chaincodeEvent,omitempty"`
+	ReadWriteSet    *TxReadWriteSet   `protobuf:"bytes,6,opt,name=readWriteSet" json:"readWriteSet,omitempty"`
+	ChaincodeEvents []*ChaincodeEvent `protobuf:"bytes,7,rep,name=chaincodeEvents" json:"chaincodeEvents,omitempty"`
 }
 
 func (m *TransactionResult) Reset()         { *m = TransactionResult{} }
@@ -234,6 +310,142 @@ func (m *TransactionResult) GetChaincodeEvent() *ChaincodeEvent {
 	return nil
 }
 
+func (m *TransactionResult) GetReadWriteSet() *TxReadWriteSet {
+	if m != nil {
+		return m.ReadWriteSet
+	}
+	return nil
+}
+
+func (m *TransactionResult) GetChaincodeEvents() []*ChaincodeEvent {
+	if m != nil {
+		return m.ChaincodeEvents
+	}
+	return nil
+}
+
+// TxReadWriteSet records the keys a transaction read and wrote during its
+// execution, by chaincode, sorted by chaincode ID. The version of a key is the
+// hash of its value, empty if the key does not exist.
+type TxReadWriteSet struct {
+	Chaincodes []*ChaincodeReadWriteSet `protobuf:"bytes,1,rep,name=chaincodes" json:"chaincodes,omitempty"`
+}
+
+func (m *TxReadWriteSet) Reset()         { *m = TxReadWriteSet{} }
+func (m *TxReadWriteSet) String() string { return proto.CompactTextString(m) }
+func (*TxReadWriteSet) ProtoMessage()    {}
+
+func (m *TxReadWriteSet) GetChaincodes() []*ChaincodeReadWriteSet {
+	if m != nil {
+		return m.Chaincodes
+	}
+	return nil
+}
+
+// ChaincodeReadWriteSet is the part of a TxReadWriteSet of a chaincode, the
+// keys sorted.
+// reads - The keys read, with the version first read. The keys the
+// transaction wrote before reading them are not read from the state.
+// rangeReads - The ranges of keys read by range scans.
+// writes - The keys written, with the version written.
+type ChaincodeReadWriteSet struct {
+	ChaincodeID string        `protobuf:"bytes,1,opt,name=chaincodeID" json:"chaincodeID,omitempty"`
+	Reads       []*KeyVersion `protobuf:"bytes,2,rep,name=reads" json:"reads,omitempty"`
+	RangeReads  []*KeyRange   `protobuf:"bytes,3,rep,name=rangeReads" json:"rangeReads,omitempty"`
+	Writes      []*KeyVersion `protobuf:"bytes,4,rep,name=writes" json:"writes,omitempty"`
+}
+
+func (m *ChaincodeReadWriteSet) Reset()         { *m = ChaincodeReadWriteSet{} }
+func (m *ChaincodeReadWriteSet) String() string { return proto.CompactTextString(m) }
+func (*ChaincodeReadWriteSet) ProtoMessage()    {}
+
+func (m *ChaincodeReadWriteSet) GetReads() []*KeyVersion {
+	if m != nil {
+		return m.Reads
+	}
+	return nil
+}
+
+func (m *ChaincodeReadWriteSet) GetRangeReads() []*KeyRange {
+	if m != nil {
+		return m.RangeReads
+	}
+	return nil
+}
+
+func (m *ChaincodeReadWriteSet) GetWrites() []*KeyVersion {
+	if m != nil {
+		return m.Writes
+	}
+	return nil
+}
+
+// KeyVersion is a key of a TxReadWriteSet with its version.
+type KeyVersion struct {
+	Key     string `protobuf:"bytes,1,opt,name=key" json:"key,omitempty"`
+	Version []byte `protobuf:"bytes,2,opt,name=version,proto3" json:"version,omitempty"`
+}
+
+func (m *KeyVersion) Reset()         { *m = KeyVersion{} }
+func (m *KeyVersion) String() string { return proto.CompactTextString(m) }
+func (*KeyVersion) ProtoMessage()    {}
+
+// KeyRange is a range of keys read by a range scan, an empty endKey leaving
+// the range open.
+type KeyRange struct {
+	StartKey string `protobuf:"bytes,1,opt,name=startKey" json:"startKey,omitempty"`
+	EndKey   string `protobuf:"bytes,2,opt,name=endKey" json:"endKey,omitempty"`
+}
+
+func (m *KeyRange) Reset()         { *m = KeyRange{} }
+func (m *KeyRange) String() string { return proto.CompactTextString(m) }
+func (*KeyRange) ProtoMessage()    {}
+
+// TransactionReceipt records the outcome of a transaction once the block it
+// was executed for is committed, whether the transaction succeeded or failed,
+// and is kept after the block is pruned.
+// uuid - The unique identifier of the transaction.
+// status - Whether the transaction succeeded, and is in the block.
+// blockNumber - The number of the block the transaction was executed for.
+// errorCode, error, result, chaincodeEvent, readWriteSet, chaincodeEvents - As
+// in its TransactionResult.
+type TransactionReceipt struct {
+	Uuid            string                    `protobuf:"bytes,1,opt,name=uuid" json:"uuid,omitempty"`
+	Status          TransactionReceipt_Status `protobuf:"varint,2,opt,name=status,enum=protos.TransactionReceipt_Status" json:"status,omitempty"`
+	BlockNumber     uint64                    `protobuf:"varint,3,opt,name=blockNumber" json:"blockNumber,omitempty"`
+	ErrorCode       uint32                    `protobuf:"varint,4,opt,name=errorCode" json:"errorCode,omitempty"`
+	Error           string                    `protobuf:"bytes,5,opt,name=error" json:"error,omitempty"`
+	Result          []byte                    `protobuf:"bytes,6,opt,name=result,proto3" json:"result,omitempty"`
+	ChaincodeEvent  *ChaincodeEvent           `protobuf:"bytes,7,opt,name=chaincodeEvent" json:"chaincodeEvent,omitempty"`
+	ReadWriteSet    *TxReadWriteSet           `protobuf:"bytes,8,opt,name=readWriteSet" json:"readWriteSet,omitempty"`
+	ChaincodeEvents []*ChaincodeEvent         `protobuf:"bytes,9,rep,name=chaincodeEvents" json:"chaincodeEvents,omitempty"`
+}
+
+func (m *TransactionReceipt) Reset()         { *m = TransactionReceipt{} }
+func (m *TransactionReceipt) String() string { return proto.CompactTextString(m) }
+func (*TransactionReceipt) ProtoMessage()    {}
+
+func (m *TransactionReceipt) GetChaincodeEvent() *ChaincodeEvent {
+	if m != nil {
+		return m.ChaincodeEvent
+	}
+	return nil
+}
+
+func (m *TransactionReceipt) GetReadWriteSet() *TxReadWriteSet {
+	if m != nil {
+		return m.ReadWriteSet
+	}
+	return nil
+}
+
+func (m *TransactionReceipt) GetChaincodeEvents() []*ChaincodeEvent {
+	if m != nil {
+		return m.ChaincodeEvents
+	}
+	return nil
+}
+
 // Block carries The data that describes a block in the blockchain.
 // version - Version used to track any protocol changes.
 // timestamp - The time at which the block or transaction order
@@ -246,6 +458,11 @@ func (m *TransactionResult) GetChaincodeEvent() *ChaincodeEvent {
 // nonHashData - Data stored with the block, but not included in the blocks
 // hash. This allows this data to be different per peer or discarded without
 // impacting the blockchain.
+// privateDataHash - The hash of the private data of the chaincodes written by
+// the transactions in this block, which is kept out of the state hash. Not set
+// if no private data was written.
+// genesisSpec - The spec the genesis block was built from. Only set on the
+// genesis block, if built from a spec.
 type Block struct {
 	Version           uint32                     `protobuf:"varint,1,opt,name=version" json:"version,omitempty"`
 	Timestamp         *google_protobuf.Timestamp `protobuf:"bytes,2,opt,name=timestamp" json:"timestamp,omitempty"`
@@ -254,6 +471,8 @@ type Block struct {
 	PreviousBlockHash []byte                     `protobuf:"bytes,5,opt,name=previousBlockHash,proto3" json:"previousBlockHash,omitempty"`
 	ConsensusMetadata []byte                     `protobuf:"bytes,6,opt,name=consensusMetadata,proto3" json:"consensusMetadata,omitempty"`
 	NonHashData       *NonHashData               `protobuf:"bytes,7,opt,name=nonHashData" json:"nonHashData,omitempty"`
+	PrivateDataHash   []byte                     `protobuf:"bytes,8,opt,name=privateDataHash,proto3" json:"privateDataHash,omitempty"`
+	GenesisSpec       *GenesisSpec               `protobuf:"bytes,9,opt,name=genesisSpec" json:"genesisSpec,omitempty"`
 }
 
 func (m *Block) Reset()         { *m = Block{} }
@@ -281,6 +500,53 @@ func (m *Block) GetNonHashData() *NonHashData {
 	return nil
 }
 
+func (m *Block) GetGenesisSpec() *GenesisSpec {
+	if m != nil {
+		return m.GenesisSpec
+	}
+	return nil
+}
+
+// GenesisSpec describes the genesis block, so that all validators start from
+// an identical genesis block rather than from whatever their local
+// configuration produced.
+// deployments - The chaincodes deployed by the genesis block, in order.
+// parameters - The parameters of the network, sorted by name.
+// consensusConfigHash - The hash of the configuration of the consensus.
+type GenesisSpec struct {
+	Deployments         []*ChaincodeDeploymentSpec `protobuf:"bytes,1,rep,name=deployments" json:"deployments,omitempty"`
+	Parameters          []*NetworkParameter        `protobuf:"bytes,2,rep,name=parameters" json:"parameters,omitempty"`
+	ConsensusConfigHash []byte                     `protobuf:"bytes,3,opt,name=consensusConfigHash,proto3" json:"consensusConfigHash,omitempty"`
+}
+
+func (m *GenesisSpec) Reset()         { *m = GenesisSpec{} }
+func (m *GenesisSpec) String() string { return proto.CompactTextString(m) }
+func (*GenesisSpec) ProtoMessage()    {}
+
+func (m *GenesisSpec) GetDeployments() []*ChaincodeDeploymentSpec {
+	if m != nil {
+		return m.Deployments
+	}
+	return nil
+}
+
+func (m *GenesisSpec) GetParameters() []*NetworkParameter {
+	if m != nil {
+		return m.Parameters
+	}
+	return nil
+}
+
+// NetworkParameter is a parameter of the network set by the genesis block.
+type NetworkParameter struct {
+	Name  string `protobuf:"bytes,1,opt,name=name" json:"name,omitempty"`
+	Value string `protobuf:"bytes,2,opt,name=value" json:"value,omitempty"`
+}
+
+func (m *NetworkParameter) Reset()         { *m = NetworkParameter{} }
+func (m *NetworkParameter) String() string { return proto.CompactTextString(m) }
+func (*NetworkParameter) ProtoMessage()    {}
+
 // Contains information about the blockchain ledger such as height, current
 // block hash, and previous block hash.
 type BlockchainInfo struct {
@@ -293,12 +559,57 @@ func (m *BlockchainInfo) Reset()         { *m = BlockchainInfo{} }
 func (m *BlockchainInfo) String() string { return proto.CompactTextString(m) }
 func (*BlockchainInfo) ProtoMessage()    {}
 
+// Outcome of verifying the blocks between from and to of the ledger, walking
+// from to down. The verification stops at the first divergence found.
+type ChainVerification struct {
+	From uint64 `protobuf:"varint,1,opt,name=from" json:"from,omitempty"`
+	To   uint64 `protobuf:"varint,2,opt,name=to" json:"to,omitempty"`
+	// lowest block whose state hash was verified, to + 1 if none was as the
+	// state deltas needed are no longer kept
+	StateVerifiedFrom uint64                           `protobuf:"varint,3,opt,name=stateVerifiedFrom" json:"stateVerifiedFrom,omitempty"`
+	Divergence        ChainVerification_DivergenceType `protobuf:"varint,4,opt,name=divergence,enum=protos.ChainVerification_DivergenceType" json:"divergence,omitempty"`
+	DivergentBlock    uint64                           `protobuf:"varint,5,opt,name=divergentBlock" json:"divergentBlock,omitempty"`
+	// the hash recorded in the ledger and the hash recomputed
+	ExpectedHash []byte `protobuf:"bytes,6,opt,name=expectedHash,proto3" json:"expectedHash,omitempty"`
+	ActualHash   []byte `protobuf:"bytes,7,opt,name=actualHash,proto3" json:"actualHash,omitempty"`
+}
+
+func (m *ChainVerification) Reset()         { *m = ChainVerification{} }
+func (m *ChainVerification) String() string { return proto.CompactTextString(m) }
+func (*ChainVerification) ProtoMessage()    {}
+
+// Outcome of replaying the transactions of the blocks of the ledger from the
+// genesis block on a scratch state, walking up. The replay stops at the first
+// block whose state hash differs from the one committed.
+type ChainReplay struct {
+	// the blocks replayed, from the genesis block to to
+	To             uint64 `protobuf:"varint,1,opt,name=to" json:"to,omitempty"`
+	Diverged       bool   `protobuf:"varint,2,opt,name=diverged" json:"diverged,omitempty"`
+	DivergentBlock uint64 `protobuf:"varint,3,opt,name=divergentBlock" json:"divergentBlock,omitempty"`
+	// the state hash recorded in the ledger and the state hash of the replay
+	ExpectedHash []byte `protobuf:"bytes,4,opt,name=expectedHash,proto3" json:"expectedHash,omitempty"`
+	ActualHash   []byte `protobuf:"bytes,5,opt,name=actualHash,proto3" json:"actualHash,omitempty"`
+}
+
+func (m *ChainReplay) Reset()         { *m = ChainReplay{} }
+func (m *ChainReplay) String() string { return proto.CompactTextString(m) }
+func (*ChainReplay) ProtoMessage()    {}
+
 // NonHashData is data that is recorded on the block, but not included in
 // the block hash when verifying the blockchain.
 // localLedgerCommitTimestamp - The time at which the block was added
 // to the ledger on the local peer.
 type NonHashData struct {
 	LocalLedgerCommitTimestamp *google_protobuf.Timestamp `protobuf:"bytes,1,opt,name=localLedgerCommitTimestamp" json:"localLedgerCommitTimestamp,omitempty"`
+	// the outcome of executing each transaction of the batch the block was
+	// cut from, the failed ones included
+	TransactionResults []*TransactionResult `protobuf:"bytes,2,rep,name=transactionResults" json:"transactionResults,omitempty"`
+	// set once the transactions of the block were pruned, the hash of the
+	// block as it was committed, which its content no longer hashes to
+	PrunedBlockHash []byte `protobuf:"bytes,3,opt,name=prunedBlockHash,proto3" json:"prunedBlockHash,omitempty"`
+	// attached by the consensus plugin once the block is committed, the proof
+	// that the block was properly ordered
+	CommitCertificate *CommitCertificate `protobuf:"bytes,4,opt,name=commitCertificate" json:"commitCertificate,omitempty"`
 }
 
 func (m *NonHashData) Reset()         { *m = NonHashData{} }
@@ -312,6 +623,63 @@ func (m *NonHashData) GetLocalLedgerCommitTimestamp() *google_protobuf.Timestamp
 	return nil
 }
 
+func (m *NonHashData) GetTransactionResults() []*TransactionResult {
+	if m != nil {
+		return m.TransactionResults
+	}
+	return nil
+}
+
+func (m *NonHashData) GetCommitCertificate() *CommitCertificate {
+	if m != nil {
+		return m.CommitCertificate
+	}
+	return nil
+}
+
+// CommitCertificate is the proof, given by the consensus plugin, that a block
+// was properly ordered, e.g. the signatures of 2f+1 validators over the batch
+// the block was cut from. It is kept out of the block hash, as validators may
+// collect different sets of signatures for the same block.
+// signedData - The data the validators signed, e.g. the digest of the batch
+// and its sequence number.
+// signatures - The signatures of the validators over signedData.
+// aggregate - The signature aggregating those of the validators, for plugins
+// which combine them.
+type CommitCertificate struct {
+	SignedData []byte             `protobuf:"bytes,1,opt,name=signedData,proto3" json:"signedData,omitempty"`
+	Signatures []*CommitSignature `protobuf:"bytes,2,rep,name=signatures" json:"signatures,omitempty"`
+	Aggregate  []byte             `protobuf:"bytes,3,opt,name=aggregate,proto3" json:"aggregate,omitempty"`
+}
+
+func (m *CommitCertificate) Reset()         { *m = CommitCertificate{} }
+func (m *CommitCertificate) String() string { return proto.CompactTextString(m) }
+func (*CommitCertificate) ProtoMessage()    {}
+
+func (m *CommitCertificate) GetSignatures() []*CommitSignature {
+	if m != nil {
+		return m.Signatures
+	}
+	return nil
+}
+
+// CommitSignature is the signature of a validator in a CommitCertificate.
+type CommitSignature struct {
+	Signer    *PeerID `protobuf:"bytes,1,opt,name=signer" json:"signer,omitempty"`
+	Signature []byte  `protobuf:"bytes,2,opt,name=signature,proto3" json:"signature,omitempty"`
+}
+
+func (m *CommitSignature) Reset()         { *m = CommitSignature{} }
+func (m *CommitSignature) String() string { return proto.CompactTextString(m) }
+func (*CommitSignature) ProtoMessage()    {}
+
+func (m *CommitSignature) GetSigner() *PeerID {
+	if m != nil {
+		return m.Signer
+	}
+	return nil
+}
+
 type PeerAddress struct {
 	Host string `protobuf:"bytes,1,opt,name=host" json:"host,omitempty"`
 	Port int32  `protobuf:"varint,2,opt,name=port" json:"port,omitempty"`
@@ -373,6 +741,12 @@ func (*PeersAddresses) ProtoMessage()    {}
 type HelloMessage struct {
 	PeerEndpoint   *PeerEndpoint   `protobuf:"bytes,1,opt,name=peerEndpoint" json:"peerEndpoint,omitempty"`
 	BlockchainInfo *BlockchainInfo `protobuf:"bytes,2,opt,name=blockchainInfo" json:"blockchainInfo,omitempty"`
+	// the highest consensus envelope version the sender understands, 0 for
+	// peers which send consensus payloads unwrapped
+	ConsensusEnvelopeVersion uint32 `protobuf:"varint,3,opt,name=consensusEnvelopeVersion" json:"consensusEnvelopeVersion,omitempty"`
+	// the compressions of the state deltas the sender can decompress, none for
+	// peers which only receive uncompressed state deltas
+	StateDeltaCompressions []SyncStateDeltas_Compression `protobuf:"varint,4,rep,packed,name=stateDeltaCompressions,enum=protos.SyncStateDeltas_Compression" json:"stateDeltaCompressions,omitempty"`
 }
 
 func (m *HelloMessage) Reset()         { *m = HelloMessage{} }
@@ -411,6 +785,17 @@ func (m *Message) GetTimestamp() *google_protobuf.Timestamp {
 	return nil
 }
 
+// ConsensusEnvelope wraps the payload of CONSENSUS messages, so peers running
+// different releases can agree on the encoding during a rolling upgrade
+type ConsensusEnvelope struct {
+	Version uint32 `protobuf:"varint,1,opt,name=version" json:"version,omitempty"`
+	Payload []byte `protobuf:"bytes,2,opt,name=payload,proto3" json:"payload,omitempty"`
+}
+
+func (m *ConsensusEnvelope) Reset()         { *m = ConsensusEnvelope{} }
+func (m *ConsensusEnvelope) String() string { return proto.CompactTextString(m) }
+func (*ConsensusEnvelope) ProtoMessage()    {}
+
 type Response struct {
 	Status Response_StatusCode `protobuf:"varint,1,opt,name=status,enum=protos.Response_StatusCode" json:"status,omitempty"`
 	Msg    []byte              `protobuf:"bytes,2,opt,name=msg,proto3" json:"msg,omitempty"`
@@ -536,6 +921,9 @@ func (m *SyncStateDeltasRequest) GetRange() *SyncBlockRange {
 type SyncStateDeltas struct {
 	Range  *SyncBlockRange `protobuf:"bytes,1,opt,name=range" json:"range,omitempty"`
 	Deltas [][]byte        `protobuf:"bytes,2,rep,name=deltas,proto3" json:"deltas,omitempty"`
+	// the compression of each of the deltas, only used if the receiver
+	// advertised it in its HelloMessage
+	Compression SyncStateDeltas_Compression `protobuf:"varint,3,opt,name=compression,enum=protos.SyncStateDeltas_Compression" json:"compression,omitempty"`
 }
 
 func (m *SyncStateDeltas) Reset()         { *m = SyncStateDeltas{} }
@@ -551,9 +939,12 @@ func (m *SyncStateDeltas) GetRange() *SyncBlockRange {
 
 func init() {
 	proto.RegisterEnum("protos.Transaction_Type", Transaction_Type_name, Transaction_Type_value)
+	proto.RegisterEnum("protos.TransactionReceipt_Status", TransactionReceipt_Status_name, TransactionReceipt_Status_value)
+	proto.RegisterEnum("protos.ChainVerification_DivergenceType", ChainVerification_DivergenceType_name, ChainVerification_DivergenceType_value)
 	proto.RegisterEnum("protos.PeerEndpoint_Type", PeerEndpoint_Type_name, PeerEndpoint_Type_value)
 	proto.RegisterEnum("protos.Message_Type", Message_Type_name, Message_Type_value)
 	proto.RegisterEnum("protos.Response_StatusCode", Response_StatusCode_name, Response_StatusCode_value)
+	proto.RegisterEnum("protos.SyncStateDeltas_Compression", SyncStateDeltas_Compression_name, SyncStateDeltas_Compression_value)
 }
 
 // Reference imports to suppress errors if they are not otherwise used.
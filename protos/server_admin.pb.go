@@ -59,6 +59,121 @@ func (m *ServerStatus) Reset()         { *m = ServerStatus{} }
 func (m *ServerStatus) String() string { return proto.CompactTextString(m) }
 func (*ServerStatus) ProtoMessage()    {}
 
+type ConsensusState struct {
+	// JSON serialization of the consensus plugin's state
+	State string `protobuf:"bytes,1,opt,name=state" json:"state,omitempty"`
+}
+
+func (m *ConsensusState) Reset()         { *m = ConsensusState{} }
+func (m *ConsensusState) String() string { return proto.CompactTextString(m) }
+func (*ConsensusState) ProtoMessage()    {}
+
+type ConsensusSwitch struct {
+	// Name of the consensus plugin to switch to, as for peer.validator.consensus.plugin
+	Plugin string `protobuf:"bytes,1,opt,name=plugin" json:"plugin,omitempty"`
+	// Height of the blockchain at which the plugin takes over, the number of
+	// the first block it commits.  Must be the same on every validator.
+	Height uint64 `protobuf:"varint,2,opt,name=height" json:"height,omitempty"`
+}
+
+func (m *ConsensusSwitch) Reset()         { *m = ConsensusSwitch{} }
+func (m *ConsensusSwitch) String() string { return proto.CompactTextString(m) }
+func (*ConsensusSwitch) ProtoMessage()    {}
+
+type ConsensusHealth struct {
+	// Whether the consensus plugin and its stack work
+	Healthy bool `protobuf:"varint,1,opt,name=healthy" json:"healthy,omitempty"`
+	// What they are doing, or why they do not work
+	Detail string `protobuf:"bytes,2,opt,name=detail" json:"detail,omitempty"`
+	// Measurements of the plugin and its stack, by name
+	Metrics map[string]float64 `protobuf:"bytes,3,rep,name=metrics" json:"metrics,omitempty" protobuf_key:"bytes,1,opt,name=key" protobuf_val:"fixed64,2,opt,name=value"`
+}
+
+func (m *ConsensusHealth) Reset()         { *m = ConsensusHealth{} }
+func (m *ConsensusHealth) String() string { return proto.CompactTextString(m) }
+func (*ConsensusHealth) ProtoMessage()    {}
+
+func (m *ConsensusHealth) GetMetrics() map[string]float64 {
+	if m != nil {
+		return m.Metrics
+	}
+	return nil
+}
+
+type ClientLimit struct {
+	// Enrollment ID of the client, or "replica <id>" for the transactions a
+	// replica received without an enrollment certificate
+	Client string `protobuf:"bytes,1,opt,name=client" json:"client,omitempty"`
+	// Transactions per second the client may submit, zero for no limit, or
+	// negative to restore the configured limits
+	Rate float64 `protobuf:"fixed64,2,opt,name=rate" json:"rate,omitempty"`
+	// Transactions the client may submit at once beyond its rate, zero for the
+	// configured burst
+	Burst int32 `protobuf:"varint,3,opt,name=burst" json:"burst,omitempty"`
+}
+
+func (m *ClientLimit) Reset()         { *m = ClientLimit{} }
+func (m *ClientLimit) String() string { return proto.CompactTextString(m) }
+func (*ClientLimit) ProtoMessage()    {}
+
+type LedgerSnapshot struct {
+	// File the snapshot is written to, on the host of the peer
+	Path string `protobuf:"bytes,1,opt,name=path" json:"path,omitempty"`
+	// Height of the blockchain the snapshot was taken at
+	Height uint64 `protobuf:"varint,2,opt,name=height" json:"height,omitempty"`
+	// Hash of the last block of the snapshot
+	BlockHash []byte `protobuf:"bytes,3,opt,name=blockHash,proto3" json:"blockHash,omitempty"`
+	// Hash of the state of the snapshot
+	StateHash []byte `protobuf:"bytes,4,opt,name=stateHash,proto3" json:"stateHash,omitempty"`
+}
+
+func (m *LedgerSnapshot) Reset()         { *m = LedgerSnapshot{} }
+func (m *LedgerSnapshot) String() string { return proto.CompactTextString(m) }
+func (*LedgerSnapshot) ProtoMessage()    {}
+
+type LedgerDBStats struct {
+	// Backend of the database, as for peer.db.backend
+	Backend string `protobuf:"bytes,1,opt,name=backend" json:"backend,omitempty"`
+	// Statistics of the database, by name
+	Stats map[string]float64 `protobuf:"bytes,2,rep,name=stats" json:"stats,omitempty" protobuf_key:"bytes,1,opt,name=key" protobuf_val:"fixed64,2,opt,name=value"`
+}
+
+func (m *LedgerDBStats) Reset()         { *m = LedgerDBStats{} }
+func (m *LedgerDBStats) String() string { return proto.CompactTextString(m) }
+func (*LedgerDBStats) ProtoMessage()    {}
+
+func (m *LedgerDBStats) GetStats() map[string]float64 {
+	if m != nil {
+		return m.Stats
+	}
+	return nil
+}
+
+type LedgerGarbage struct {
+	// Rows removed, by column family
+	Rows map[string]uint64 `protobuf:"bytes,1,rep,name=rows" json:"rows,omitempty" protobuf_key:"bytes,1,opt,name=key" protobuf_val:"varint,2,opt,name=value"`
+	// Bytes of the keys and values of the rows removed, by column family
+	Bytes map[string]uint64 `protobuf:"bytes,2,rep,name=bytes" json:"bytes,omitempty" protobuf_key:"bytes,1,opt,name=key" protobuf_val:"varint,2,opt,name=value"`
+}
+
+func (m *LedgerGarbage) Reset()         { *m = LedgerGarbage{} }
+func (m *LedgerGarbage) String() string { return proto.CompactTextString(m) }
+func (*LedgerGarbage) ProtoMessage()    {}
+
+func (m *LedgerGarbage) GetRows() map[string]uint64 {
+	if m != nil {
+		return m.Rows
+	}
+	return nil
+}
+
+func (m *LedgerGarbage) GetBytes() map[string]uint64 {
+	if m != nil {
+		return m.Bytes
+	}
+	return nil
+}
+
 func init() {
 	proto.RegisterEnum("protos.ServerStatus_StatusCode", ServerStatus_StatusCode_name, ServerStatus_StatusCode_value)
 }
@@ -74,6 +189,22 @@ type AdminClient interface {
 	GetStatus(ctx context.Context, in *google_protobuf1.Empty, opts ...grpc.CallOption) (*ServerStatus, error)
 	StartServer(ctx context.Context, in *google_protobuf1.Empty, opts ...grpc.CallOption) (*ServerStatus, error)
 	StopServer(ctx context.Context, in *google_protobuf1.Empty, opts ...grpc.CallOption) (*ServerStatus, error)
+	// Return the internal state of the consensus plugin, for debugging.
+	GetConsensusState(ctx context.Context, in *google_protobuf1.Empty, opts ...grpc.CallOption) (*ConsensusState, error)
+	// Reload the configuration of the consensus plugin.
+	ReloadConsensusConfig(ctx context.Context, in *google_protobuf1.Empty, opts ...grpc.CallOption) (*google_protobuf1.Empty, error)
+	// Switch to another consensus plugin once the blockchain reaches a height.
+	SwitchConsensusPlugin(ctx context.Context, in *ConsensusSwitch, opts ...grpc.CallOption) (*google_protobuf1.Empty, error)
+	// Return the health and metrics of the consensus plugin and its stack.
+	GetConsensusHealth(ctx context.Context, in *google_protobuf1.Empty, opts ...grpc.CallOption) (*ConsensusHealth, error)
+	// Override the transaction rate limits of a client until the peer restarts.
+	SetClientLimit(ctx context.Context, in *ClientLimit, opts ...grpc.CallOption) (*google_protobuf1.Empty, error)
+	// Export a snapshot of the ledger to a file on the host of the peer.
+	ExportLedgerSnapshot(ctx context.Context, in *LedgerSnapshot, opts ...grpc.CallOption) (*LedgerSnapshot, error)
+	// Return the statistics of the database the ledger is kept in.
+	GetLedgerDBStats(ctx context.Context, in *google_protobuf1.Empty, opts ...grpc.CallOption) (*LedgerDBStats, error)
+	// Remove the rows of the ledger database no block refers to any longer.
+	CollectLedgerGarbage(ctx context.Context, in *google_protobuf1.Empty, opts ...grpc.CallOption) (*LedgerGarbage, error)
 }
 
 type adminClient struct {
@@ -111,6 +242,78 @@ func (c *adminClient) StopServer(ctx context.Context, in *google_protobuf1.Empty
 	return out, nil
 }
 
+func (c *adminClient) GetConsensusState(ctx context.Context, in *google_protobuf1.Empty, opts ...grpc.CallOption) (*ConsensusState, error) {
+	out := new(ConsensusState)
+	err := grpc.Invoke(ctx, "/protos.Admin/GetConsensusState", in, out, c.cc, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *adminClient) ReloadConsensusConfig(ctx context.Context, in *google_protobuf1.Empty, opts ...grpc.CallOption) (*google_protobuf1.Empty, error) {
+	out := new(google_protobuf1.Empty)
+	err := grpc.Invoke(ctx, "/protos.Admin/ReloadConsensusConfig", in, out, c.cc, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *adminClient) SwitchConsensusPlugin(ctx context.Context, in *ConsensusSwitch, opts ...grpc.CallOption) (*google_protobuf1.Empty, error) {
+	out := new(google_protobuf1.Empty)
+	err := grpc.Invoke(ctx, "/protos.Admin/SwitchConsensusPlugin", in, out, c.cc, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *adminClient) GetConsensusHealth(ctx context.Context, in *google_protobuf1.Empty, opts ...grpc.CallOption) (*ConsensusHealth, error) {
+	out := new(ConsensusHealth)
+	err := grpc.Invoke(ctx, "/protos.Admin/GetConsensusHealth", in, out, c.cc, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *adminClient) SetClientLimit(ctx context.Context, in *ClientLimit, opts ...grpc.CallOption) (*google_protobuf1.Empty, error) {
+	out := new(google_protobuf1.Empty)
+	err := grpc.Invoke(ctx, "/protos.Admin/SetClientLimit", in, out, c.cc, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *adminClient) ExportLedgerSnapshot(ctx context.Context, in *LedgerSnapshot, opts ...grpc.CallOption) (*LedgerSnapshot, error) {
+	out := new(LedgerSnapshot)
+	err := grpc.Invoke(ctx, "/protos.Admin/ExportLedgerSnapshot", in, out, c.cc, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *adminClient) GetLedgerDBStats(ctx context.Context, in *google_protobuf1.Empty, opts ...grpc.CallOption) (*LedgerDBStats, error) {
+	out := new(LedgerDBStats)
+	err := grpc.Invoke(ctx, "/protos.Admin/GetLedgerDBStats", in, out, c.cc, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *adminClient) CollectLedgerGarbage(ctx context.Context, in *google_protobuf1.Empty, opts ...grpc.CallOption) (*LedgerGarbage, error) {
+	out := new(LedgerGarbage)
+	err := grpc.Invoke(ctx, "/protos.Admin/CollectLedgerGarbage", in, out, c.cc, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
 // Server API for Admin service
 
 type AdminServer interface {
@@ -118,6 +321,22 @@ type AdminServer interface {
 	GetStatus(context.Context, *google_protobuf1.Empty) (*ServerStatus, error)
 	StartServer(context.Context, *google_protobuf1.Empty) (*ServerStatus, error)
 	StopServer(context.Context, *google_protobuf1.Empty) (*ServerStatus, error)
+	// Return the internal state of the consensus plugin, for debugging.
+	GetConsensusState(context.Context, *google_protobuf1.Empty) (*ConsensusState, error)
+	// Reload the configuration of the consensus plugin.
+	ReloadConsensusConfig(context.Context, *google_protobuf1.Empty) (*google_protobuf1.Empty, error)
+	// Switch to another consensus plugin once the blockchain reaches a height.
+	SwitchConsensusPlugin(context.Context, *ConsensusSwitch) (*google_protobuf1.Empty, error)
+	// Return the health and metrics of the consensus plugin and its stack.
+	GetConsensusHealth(context.Context, *google_protobuf1.Empty) (*ConsensusHealth, error)
+	// Override the transaction rate limits of a client until the peer restarts.
+	SetClientLimit(context.Context, *ClientLimit) (*google_protobuf1.Empty, error)
+	// Export a snapshot of the ledger to a file on the host of the peer.
+	ExportLedgerSnapshot(context.Context, *LedgerSnapshot) (*LedgerSnapshot, error)
+	// Return the statistics of the database the ledger is kept in.
+	GetLedgerDBStats(context.Context, *google_protobuf1.Empty) (*LedgerDBStats, error)
+	// Remove the rows of the ledger database no block refers to any longer.
+	CollectLedgerGarbage(context.Context, *google_protobuf1.Empty) (*LedgerGarbage, error)
 }
 
 func RegisterAdminServer(s *grpc.Server, srv AdminServer) {
@@ -160,6 +379,102 @@ func _Admin_StopServer_Handler(srv interface{}, ctx context.Context, dec func(in
 	return out, nil
 }
 
+func _Admin_GetConsensusState_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error) (interface{}, error) {
+	in := new(google_protobuf1.Empty)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	out, err := srv.(AdminServer).GetConsensusState(ctx, in)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func _Admin_ReloadConsensusConfig_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error) (interface{}, error) {
+	in := new(google_protobuf1.Empty)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	out, err := srv.(AdminServer).ReloadConsensusConfig(ctx, in)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func _Admin_SwitchConsensusPlugin_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error) (interface{}, error) {
+	in := new(ConsensusSwitch)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	out, err := srv.(AdminServer).SwitchConsensusPlugin(ctx, in)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func _Admin_GetConsensusHealth_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error) (interface{}, error) {
+	in := new(google_protobuf1.Empty)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	out, err := srv.(AdminServer).GetConsensusHealth(ctx, in)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func _Admin_SetClientLimit_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error) (interface{}, error) {
+	in := new(ClientLimit)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	out, err := srv.(AdminServer).SetClientLimit(ctx, in)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func _Admin_ExportLedgerSnapshot_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error) (interface{}, error) {
+	in := new(LedgerSnapshot)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	out, err := srv.(AdminServer).ExportLedgerSnapshot(ctx, in)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func _Admin_GetLedgerDBStats_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error) (interface{}, error) {
+	in := new(google_protobuf1.Empty)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	out, err := srv.(AdminServer).GetLedgerDBStats(ctx, in)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func _Admin_CollectLedgerGarbage_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error) (interface{}, error) {
+	in := new(google_protobuf1.Empty)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	out, err := srv.(AdminServer).CollectLedgerGarbage(ctx, in)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
 var _Admin_serviceDesc = grpc.ServiceDesc{
 	ServiceName: "protos.Admin",
 	HandlerType: (*AdminServer)(nil),
@@ -176,6 +491,38 @@ var _Admin_serviceDesc = grpc.ServiceDesc{
 			MethodName: "StopServer",
 			Handler:    _Admin_StopServer_Handler,
 		},
+		{
+			MethodName: "GetConsensusState",
+			Handler:    _Admin_GetConsensusState_Handler,
+		},
+		{
+			MethodName: "ReloadConsensusConfig",
+			Handler:    _Admin_ReloadConsensusConfig_Handler,
+		},
+		{
+			MethodName: "SwitchConsensusPlugin",
+			Handler:    _Admin_SwitchConsensusPlugin_Handler,
+		},
+		{
+			MethodName: "GetConsensusHealth",
+			Handler:    _Admin_GetConsensusHealth_Handler,
+		},
+		{
+			MethodName: "SetClientLimit",
+			Handler:    _Admin_SetClientLimit_Handler,
+		},
+		{
+			MethodName: "ExportLedgerSnapshot",
+			Handler:    _Admin_ExportLedgerSnapshot_Handler,
+		},
+		{
+			MethodName: "GetLedgerDBStats",
+			Handler:    _Admin_GetLedgerDBStats_Handler,
+		},
+		{
+			MethodName: "CollectLedgerGarbage",
+			Handler:    _Admin_CollectLedgerGarbage_Handler,
+		},
 	},
 	Streams: []grpc.StreamDesc{},
 }
@@ -0,0 +1,86 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package protos
+
+import (
+	"fmt"
+
+	"github.com/hyperledger/fabric/core/util"
+)
+
+// StateDeltaCompressions are the compressions of the state deltas this peer
+// can decompress, they are advertised to the other peers in the HelloMessage
+var StateDeltaCompressions = []SyncStateDeltas_Compression{SyncStateDeltas_GZIP}
+
+// NegotiateStateDeltaCompression returns the compression of the state deltas
+// to send to a peer advertising remote, which is preferred if the peer can
+// decompress it, NONE otherwise
+func NegotiateStateDeltaCompression(preferred SyncStateDeltas_Compression, remote []SyncStateDeltas_Compression) SyncStateDeltas_Compression {
+	for _, compression := range remote {
+		if compression == preferred {
+			return preferred
+		}
+	}
+	return SyncStateDeltas_NONE
+}
+
+// Compress compresses the deltas, which must not be compressed yet
+func (m *SyncStateDeltas) Compress(compression SyncStateDeltas_Compression) error {
+	if m.Compression != SyncStateDeltas_NONE {
+		return fmt.Errorf("The state deltas are already compressed with %s", m.Compression)
+	}
+	switch compression {
+	case SyncStateDeltas_NONE:
+		return nil
+	case SyncStateDeltas_GZIP:
+		deltas := make([][]byte, len(m.Deltas))
+		for i, delta := range m.Deltas {
+			compressed, err := util.GzipCompress(delta)
+			if err != nil {
+				return fmt.Errorf("Could not compress state delta: %s", err)
+			}
+			deltas[i] = compressed
+		}
+		m.Deltas = deltas
+		m.Compression = compression
+		return nil
+	default:
+		return fmt.Errorf("State delta compression %s is not supported", compression)
+	}
+}
+
+// Decompress decompresses the deltas, leaving uncompressed deltas as they are
+func (m *SyncStateDeltas) Decompress() error {
+	switch m.Compression {
+	case SyncStateDeltas_NONE:
+		return nil
+	case SyncStateDeltas_GZIP:
+		deltas := make([][]byte, len(m.Deltas))
+		for i, delta := range m.Deltas {
+			decompressed, err := util.GzipDecompress(delta)
+			if err != nil {
+				return fmt.Errorf("Could not decompress state delta: %s", err)
+			}
+			deltas[i] = decompressed
+		}
+		m.Deltas = deltas
+		m.Compression = SyncStateDeltas_NONE
+		return nil
+	default:
+		return fmt.Errorf("State delta compression %s is not supported", m.Compression)
+	}
+}
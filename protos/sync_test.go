@@ -0,0 +1,70 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package protos
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/golang/protobuf/proto"
+)
+
+func TestSyncStateDeltasCompressionRoundTrip(t *testing.T) {
+	delta := bytes.Repeat([]byte(`{"owner":"alice","amount":100}`), 100)
+	syncStateDeltas := &SyncStateDeltas{Range: &SyncBlockRange{Start: 1, End: 1}, Deltas: [][]byte{delta}}
+	if err := syncStateDeltas.Compress(SyncStateDeltas_GZIP); err != nil {
+		t.Fatalf("Could not compress state deltas: %s", err)
+	}
+	if len(syncStateDeltas.Deltas[0]) >= len(delta) {
+		t.Errorf("Expected the state delta to be compressed, got %d bytes from %d", len(syncStateDeltas.Deltas[0]), len(delta))
+	}
+	if err := syncStateDeltas.Compress(SyncStateDeltas_GZIP); err == nil {
+		t.Errorf("Expected compressing compressed state deltas to fail")
+	}
+
+	data, err := proto.Marshal(syncStateDeltas)
+	if err != nil {
+		t.Fatalf("Could not marshal state deltas: %s", err)
+	}
+	received := &SyncStateDeltas{}
+	if err := proto.Unmarshal(data, received); err != nil {
+		t.Fatalf("Could not unmarshal state deltas: %s", err)
+	}
+	if err := received.Decompress(); err != nil {
+		t.Fatalf("Could not decompress state deltas: %s", err)
+	}
+	if received.Compression != SyncStateDeltas_NONE || !bytes.Equal(received.Deltas[0], delta) {
+		t.Errorf("Expected the decompressed state delta to be the original one")
+	}
+
+	received.Compression = SyncStateDeltas_GZIP
+	if err := received.Decompress(); err == nil {
+		t.Errorf("Expected decompressing uncompressed state deltas flagged as compressed to fail")
+	}
+}
+
+func TestNegotiateStateDeltaCompression(t *testing.T) {
+	if compression := NegotiateStateDeltaCompression(SyncStateDeltas_GZIP, nil); compression != SyncStateDeltas_NONE {
+		t.Errorf("Expected peers predating the compression to be sent uncompressed state deltas, negotiated %s", compression)
+	}
+	if compression := NegotiateStateDeltaCompression(SyncStateDeltas_GZIP, StateDeltaCompressions); compression != SyncStateDeltas_GZIP {
+		t.Errorf("Expected a peer advertising %s to be sent compressed state deltas, negotiated %s", SyncStateDeltas_GZIP, compression)
+	}
+	if compression := NegotiateStateDeltaCompression(SyncStateDeltas_NONE, StateDeltaCompressions); compression != SyncStateDeltas_NONE {
+		t.Errorf("Expected state deltas not to be compressed when compression is disabled, negotiated %s", compression)
+	}
+}
@@ -25,7 +25,6 @@ import (
 	"github.com/hyperledger/fabric/core/db"
 	"github.com/hyperledger/fabric/protos"
 	"github.com/spf13/viper"
-	"github.com/tecbot/gorocksdb"
 )
 
 const (
@@ -78,8 +77,12 @@ func main() {
 
 func printLiveFilesMetaData(openchainDB *db.OpenchainDB) {
 	fmt.Println("------ Details of LiveFilesMetaData ---")
-	db := openchainDB.DB
-	liveFileMetadata := db.GetLiveFilesMetaData()
+	rocksDB := openchainDB.RocksDB()
+	if rocksDB == nil {
+		fmt.Println("Not available, the DB is not kept in RocksDB")
+		return
+	}
+	liveFileMetadata := rocksDB.GetLiveFilesMetaData()
 	for _, file := range liveFileMetadata {
 		fmt.Printf("file.Name=[%s], file.Level=[%d], file.Size=[%d]\n",
 			file.Name, file.Level, file.Size)
@@ -88,53 +91,57 @@ func printLiveFilesMetaData(openchainDB *db.OpenchainDB) {
 
 func printProperties(openchainDB *db.OpenchainDB) {
 	fmt.Println("------ Details of Properties ---")
-	db := openchainDB.DB
+	rocksDB := openchainDB.RocksDB()
+	if rocksDB == nil {
+		fmt.Println("Not available, the DB is not kept in RocksDB")
+		return
+	}
+	property := func(name string, cf db.ColumnFamily) string {
+		return rocksDB.GetPropertyCF(name, openchainDB.RocksDBColumnFamily(cf))
+	}
 	fmt.Printf("rocksdb.estimate-live-data-size:- BlockchainCF:%s, StateCF:%s, StateDeltaCF:%s, IndexesCF:%s, PersistCF:%s\n\n",
-		db.GetPropertyCF("rocksdb.estimate-live-data-size", openchainDB.BlockchainCF),
-		db.GetPropertyCF("rocksdb.estimate-live-data-size", openchainDB.StateCF),
-		db.GetPropertyCF("rocksdb.estimate-live-data-size", openchainDB.StateDeltaCF),
-		db.GetPropertyCF("rocksdb.estimate-live-data-size", openchainDB.IndexesCF),
-		db.GetPropertyCF("rocksdb.estimate-live-data-size", openchainDB.PersistCF))
-	fmt.Printf("Default:%s\n", db.GetProperty("rocksdb.estimate-live-data-size"))
+		property("rocksdb.estimate-live-data-size", openchainDB.BlockchainCF),
+		property("rocksdb.estimate-live-data-size", openchainDB.StateCF),
+		property("rocksdb.estimate-live-data-size", openchainDB.StateDeltaCF),
+		property("rocksdb.estimate-live-data-size", openchainDB.IndexesCF),
+		property("rocksdb.estimate-live-data-size", openchainDB.PersistCF))
+	fmt.Printf("Default:%s\n", rocksDB.GetProperty("rocksdb.estimate-live-data-size"))
 
 	fmt.Printf("rocksdb.num-live-versions:- BlockchainCF:%s, StateCF:%s, StateDeltaCF:%s, IndexesCF:%s, PersistCF:%s\n\n",
-		db.GetPropertyCF("rocksdb.num-live-versions", openchainDB.BlockchainCF),
-		db.GetPropertyCF("rocksdb.num-live-versions", openchainDB.StateCF),
-		db.GetPropertyCF("rocksdb.num-live-versions", openchainDB.StateDeltaCF),
-		db.GetPropertyCF("rocksdb.num-live-versions", openchainDB.IndexesCF),
-		db.GetPropertyCF("rocksdb.num-live-versions", openchainDB.PersistCF))
+		property("rocksdb.num-live-versions", openchainDB.BlockchainCF),
+		property("rocksdb.num-live-versions", openchainDB.StateCF),
+		property("rocksdb.num-live-versions", openchainDB.StateDeltaCF),
+		property("rocksdb.num-live-versions", openchainDB.IndexesCF),
+		property("rocksdb.num-live-versions", openchainDB.PersistCF))
 
 	fmt.Printf("rocksdb.cfstats:\n %s %s %s %s %s\n\n",
-		db.GetPropertyCF("rocksdb.cfstats", openchainDB.BlockchainCF),
-		db.GetPropertyCF("rocksdb.cfstats", openchainDB.StateCF),
-		db.GetPropertyCF("rocksdb.cfstats", openchainDB.StateDeltaCF),
-		db.GetPropertyCF("rocksdb.cfstats", openchainDB.IndexesCF),
-		db.GetPropertyCF("rocksdb.cfstats", openchainDB.PersistCF))
+		property("rocksdb.cfstats", openchainDB.BlockchainCF),
+		property("rocksdb.cfstats", openchainDB.StateCF),
+		property("rocksdb.cfstats", openchainDB.StateDeltaCF),
+		property("rocksdb.cfstats", openchainDB.IndexesCF),
+		property("rocksdb.cfstats", openchainDB.PersistCF))
 }
 
-func scan(openchainDB *db.OpenchainDB, cfName string, cf *gorocksdb.ColumnFamilyHandle, printer detailPrinter) (int, int) {
+func scan(openchainDB *db.OpenchainDB, cfName string, cf db.ColumnFamily, printer detailPrinter) (int, int) {
 	fmt.Printf("------- Printing Key-values larger than [%d] bytes in Column family [%s]--------\n", MaxValueSize, cfName)
 	itr := openchainDB.GetIterator(cf)
 	totalKVs := 0
 	overSizeKVs := 0
 	itr.SeekToFirst()
 	for ; itr.Valid(); itr.Next() {
-		k := itr.Key()
+		keyBytes := itr.Key()
 		v := itr.Value()
-		keyBytes := k.Data()
-		valueSize := v.Size()
+		valueSize := len(v)
 		totalKVs++
 		if valueSize >= MaxValueSize {
 			overSizeKVs++
 			fmt.Printf("key=[%x], valueSize=[%d]\n", keyBytes, valueSize)
 			if printer != nil {
 				fmt.Println("=== KV Details === ")
-				printer(v.Data())
+				printer(v)
 				fmt.Println("")
 			}
 		}
-		k.Free()
-		v.Free()
 	}
 	itr.Close()
 	fmt.Printf("totalKVs=[%d], overSizeKVs=[%d]\n", totalKVs, overSizeKVs)